@@ -1,17 +1,31 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/branchd-dev/branchd/internal/backup"
+	"github.com/branchd-dev/branchd/internal/branches"
 	"github.com/branchd-dev/branchd/internal/config"
 	"github.com/branchd-dev/branchd/internal/logger"
 	"github.com/branchd-dev/branchd/internal/server"
+	"github.com/branchd-dev/branchd/internal/workers"
 )
 
 var version = "dev" // Will be set during build with -ldflags
 
 func main() {
+	// Run the worker in this process so small installs only need one service
+	// Without Redis (REDIS_ADDRESS set but empty) tasks are always processed here, with an in-process runner
+	allInOne := flag.Bool("all-in-one", false, "also process background tasks (replaces branchd-worker)")
+	restoreBackup := flag.String("restore-backup", "", "replace the database (DATABASE_URL) with the one of a backup archive and exit, run while branchd is stopped")
+	smokeTest := flag.Bool("smoke-test", false, "clone the latest ready restore's dataset as creating a branch does and exit, run by the update script")
+	flag.Parse()
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -20,19 +34,69 @@ func main() {
 	}
 
 	// Initialize logger
-	logger.Init(cfg.Logging.Level, cfg.Logging.Format)
+	if err := logger.Init(cfg.Logging); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logging: %v\n", err)
+		os.Exit(1)
+	}
+	defer logger.Close()
 	log := logger.GetLogger()
 
+	if *restoreBackup != "" {
+		kept, err := backup.Restore(*restoreBackup, cfg.Database.URL)
+		if err != nil {
+			log.Fatal().Err(err).Str("archive", *restoreBackup).Msg("Failed to restore database backup")
+		}
+		log.Info().Str("archive", *restoreBackup).Str("database", cfg.Database.URL).Str("previous_database", kept).Msg("Database backup restored")
+		return
+	}
+
 	// Create server
 	srv, err := server.New(cfg, log, version)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create server")
 	}
 
-	log.Info().Str("version", version).Msg("Starting Branchd server...")
+	if *smokeTest {
+		err := branches.NewService(srv.GetDB(), cfg, log).SmokeTest(context.Background())
+		srv.Close()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Branch smoke test failed")
+		}
+		return
+	}
+
+	if !*allInOne && cfg.Redis.Enabled() {
+		log.Info().Str("version", version).Msg("Starting Branchd server...")
+
+		// Start HTTP server (this blocks)
+		if err := srv.Start(); err != nil {
+			log.Fatal().Err(err).Msg("Server failed to start")
+		}
+		return
+	}
+
+	log.Info().Str("version", version).Msg("Starting Branchd server and worker (all-in-one)...")
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var worker *workers.Worker
+	if runner := srv.TaskRunner(); runner != nil {
+		worker = workers.NewLocalWorker(srv.GetDB(), cfg, runner, log)
+	} else {
+		worker = workers.NewWorker(srv.GetDB(), cfg, log)
+	}
+	if err := worker.Start(); err != nil {
+		log.Fatal().Err(err).Msg("Asynq worker server failed")
+	}
+
+	// Shutdown order: stop accepting requests (which enqueue tasks), let running periodic
+	// jobs and tasks finish, then close the shared database last
+	serveErr := srv.Serve(ctx)
+	worker.Shutdown()
+	srv.Close()
 
-	// Start HTTP server (this blocks)
-	if err := srv.Start(); err != nil {
-		log.Fatal().Err(err).Msg("Server failed to start")
+	if serveErr != nil {
+		log.Fatal().Err(serveErr).Msg("Server shutdown failed")
 	}
 }
@@ -2,11 +2,14 @@ package anonymize
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
 )
@@ -21,41 +24,41 @@ type TablePrimaryKey struct {
 // Uses PostgreSQL row_number() for deterministic anonymization
 // primaryKeys maps table names to their primary key columns for consistent ordering
 func GenerateSQL(rules []models.AnonRule, primaryKeys map[string]string) string {
-	if len(rules) == 0 {
-		return ""
+	var sqlStatements []string
+	for _, statement := range generateStatements(rules, primaryKeys) {
+		sqlStatements = append(sqlStatements, statement.SQL)
 	}
+	return strings.Join(sqlStatements, "\n\n")
+}
+
+// tableStatement is the UPDATE applying the rules of one table
+type tableStatement struct {
+	Table string
+	Rules []models.AnonRule
+	SQL   string
+}
 
-	// Group rules by table
+// generateStatements generates one UPDATE per table, in the order tables first appear in rules
+func generateStatements(rules []models.AnonRule, primaryKeys map[string]string) []tableStatement {
 	tableRules := make(map[string][]models.AnonRule)
 	for _, rule := range rules {
 		tableRules[rule.Table] = append(tableRules[rule.Table], rule)
 	}
 
-	var sqlStatements []string
-
-	for table, rules := range tableRules {
+	var statements []tableStatement
+	for _, table := range uniqueTables(rules) {
 		pkColumn := primaryKeys[table] // Empty string if not found
-		sql := generateTableUpdateSQL(table, rules, pkColumn)
-		sqlStatements = append(sqlStatements, sql)
+		statements = append(statements, tableStatement{
+			Table: table,
+			Rules: tableRules[table],
+			SQL:   generateTableUpdateSQL(table, tableRules[table], pkColumn),
+		})
 	}
-
-	return strings.Join(sqlStatements, "\n\n")
+	return statements
 }
 
-// generatePrimaryKeyQuerySQL generates SQL to query primary keys for all tables
-func generatePrimaryKeyQuerySQL(tables []string) string {
-	if len(tables) == 0 {
-		return ""
-	}
-
-	// Build SQL to find primary key columns for all tables
-	// Returns: table_name | column_name (one row per table with single-column PK)
-	quotedTables := make([]string, len(tables))
-	for i, table := range tables {
-		quotedTables[i] = fmt.Sprintf("'%s'", strings.ReplaceAll(table, "'", "''"))
-	}
-
-	sql := fmt.Sprintf(`
+// primaryKeyQuery finds the single-column primary keys of the public tables in $1
+const primaryKeyQuery = `
 SELECT
     t.tablename as table_name,
     a.attname as column_name
@@ -64,13 +67,9 @@ JOIN pg_class c ON c.relname = t.tablename
 JOIN pg_index i ON i.indrelid = c.oid AND i.indisprimary
 JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = ANY(i.indkey)
 WHERE t.schemaname = 'public'
-  AND t.tablename IN (%s)
+  AND t.tablename = ANY($1)
   AND array_length(i.indkey, 1) = 1  -- Only single-column primary keys
-ORDER BY t.tablename;
-`, strings.Join(quotedTables, ", "))
-
-	return sql
-}
+ORDER BY t.tablename`
 
 // generateTableUpdateSQL generates UPDATE statement for a single table
 // pkColumn is the primary key column name (empty string means use ctid)
@@ -83,7 +82,7 @@ func generateTableUpdateSQL(table string, rules []models.AnonRule, pkColumn stri
 	var orderBy string
 	var orderByComment string
 	if pkColumn != "" {
-		orderBy = quoteIdentifier(pkColumn)
+		orderBy = pgclient.QuoteIdentifier(pkColumn)
 		orderByComment = fmt.Sprintf(" (ordered by PK: %s)", pkColumn)
 	} else {
 		orderBy = "ctid"
@@ -93,16 +92,17 @@ func generateTableUpdateSQL(table string, rules []models.AnonRule, pkColumn stri
 	// Build SET clause with row_number replacement and IS DISTINCT FROM for idempotency
 	var setClauses []string
 	var whereConditions []string
-	for _, rule := range rules {
-		setValue := renderTemplate(rule.Template, rule.ColumnType)
-		columnQuoted := quoteIdentifier(rule.Column)
+	columns, values := renderColumnValues(table, rules)
+	for _, column := range columns {
+		setValue := values[column]
+		columnQuoted := pgclient.QuoteIdentifier(column)
 
 		// Add SET clause
 		setClauses = append(setClauses, fmt.Sprintf("%s = %s", columnQuoted, setValue))
 
 		// Add condition to skip rows that already have the target value (idempotency)
 		whereConditions = append(whereConditions, fmt.Sprintf("%s.%s IS DISTINCT FROM %s",
-			quoteIdentifier(table), columnQuoted, setValue))
+			pgclient.QuoteIdentifier(table), columnQuoted, setValue))
 	}
 
 	// Combine WHERE conditions with OR (update if ANY column is different)
@@ -122,20 +122,94 @@ WHERE %s.ctid = numbered_rows.ctid
 		table,
 		orderByComment,
 		orderBy,
-		quoteIdentifier(table),
-		quoteIdentifier(table),
+		pgclient.QuoteIdentifier(table),
+		pgclient.QuoteIdentifier(table),
 		strings.Join(setClauses, ",\n    "),
-		quoteIdentifier(table),
+		pgclient.QuoteIdentifier(table),
 		whereClause,
 	)
 
 	return sql
 }
 
-// renderTemplate converts template string to SQL expression
-// Replaces ${index} with row number reference
-// Handles different column types: text, integer, boolean, null
+// renderColumnValues returns the SQL expression assigned to each column, in the order columns first appear in rules
+// Rules replacing fields of the same JSON column are nested into one expression
+func renderColumnValues(table string, rules []models.AnonRule) ([]string, map[string]string) {
+	var columns []string
+	values := make(map[string]string)
+	for _, rule := range rules {
+		value, seen := values[rule.Column]
+		if !seen {
+			columns = append(columns, rule.Column)
+			value = pgclient.QuoteIdentifier(table) + "." + pgclient.QuoteIdentifier(rule.Column)
+		}
+		if rule.JSONPath == "" {
+			values[rule.Column] = renderRuleValue(table, rule)
+		} else {
+			values[rule.Column] = renderJSONPathValue(table, value, rule)
+		}
+	}
+	return columns, values
+}
+
+// ruleSource renders the current value a rule replaces as text: its column, or its field of a JSON column
+func ruleSource(table string, rule models.AnonRule) string {
+	column := pgclient.QuoteIdentifier(table) + "." + pgclient.QuoteIdentifier(rule.Column)
+	if rule.JSONPath != "" {
+		return fmt.Sprintf("(%s #>> %s)", column, jsonPathArray(rule.JSONPath))
+	}
+	return column + "::text"
+}
+
+// renderRuleValue converts a rule to the SQL expression of the value it writes, to its column or JSON field
+// Rules with a built-in function use the function, others use the static template
+func renderRuleValue(table string, rule models.AnonRule) string {
+	if rule.Function != "" {
+		return renderFunction(table, rule)
+	}
+	return renderIndexedTemplate(rule.Template, rule.ColumnType, ruleIndex(table, rule))
+}
+
+// rowNumber is the number of the row being updated, see generateTableUpdateSQL
+const rowNumber = "numbered_rows._row_num"
+
+// consistentIndexBits is the size of the numbers derived from values in consistent mode,
+// large enough for distinct values not to collide
+const consistentIndexBits = 60
+
+// ruleIndex renders the ${index} of a rule, which also picks the values of the fake_* functions
+// It is the row number, unless the rule is consistent: the number is then derived from a salted hash of the
+// value replaced, so the same value gets the same output in every table (e.g. users.email and orders.customer_email)
+func ruleIndex(table string, rule models.AnonRule) string {
+	if !rule.Consistent {
+		return rowNumber
+	}
+
+	index := fmt.Sprintf("('x' || substr(md5(%s || %s), 1, %d))::bit(%d)::bigint",
+		pgclient.QuoteLiteral(rule.FunctionOptions.Salt), ruleSource(table, rule), consistentIndexBits/4, consistentIndexBits)
+	if rule.ColumnType == "integer" {
+		// Integer templates are cast to integer, distinct values may collide in this smaller range
+		return fmt.Sprintf("(%s %% 2147483647)", index)
+	}
+	return "(" + index + ")"
+}
+
+// renderTemplate converts template string to SQL expression, with ${index} the row number
 func renderTemplate(template string, columnType string) string {
+	return renderIndexedTemplate(template, columnType, rowNumber)
+}
+
+// renderIndexedTemplate converts template string to SQL expression
+// Replaces ${index} with indexExpr (see ruleIndex)
+// Handles different column types: text, integer, boolean, null, date, timestamp, uuid
+func renderIndexedTemplate(template, columnType, indexExpr string) string {
+	switch columnType {
+	case "date", "timestamp":
+		return renderDateTemplate(template, columnType, indexExpr)
+	case "uuid":
+		return renderUUIDTemplate(template, indexExpr)
+	}
+
 	// Handle NULL type - ignore template and return SQL NULL
 	if columnType == "null" {
 		return "NULL"
@@ -160,7 +234,7 @@ func renderTemplate(template string, columnType string) string {
 					sqlParts = append(sqlParts, "'"+part+"'")
 				}
 				if i < len(parts)-1 {
-					sqlParts = append(sqlParts, "numbered_rows._row_num::text")
+					sqlParts = append(sqlParts, indexExpr+"::text")
 				}
 			}
 			// Concatenate and cast to integer
@@ -188,143 +262,219 @@ func renderTemplate(template string, columnType string) string {
 		}
 		// Add row number between parts (except after last part)
 		if i < len(parts)-1 {
-			sqlParts = append(sqlParts, "numbered_rows._row_num")
+			sqlParts = append(sqlParts, indexExpr)
 		}
 	}
 
 	return strings.Join(sqlParts, " || ")
 }
 
-// quoteIdentifier quotes a PostgreSQL identifier
-func quoteIdentifier(name string) string {
-	return fmt.Sprintf("\"%s\"", strings.ReplaceAll(name, "\"", "\"\""))
-}
-
 // ApplyParams contains parameters needed to apply anonymization rules
 type ApplyParams struct {
-	DatabaseName    string
-	PostgresVersion string
-	PostgresPort    int
+	DatabaseName string
+	PostgresPort int
+
+	// Apply records the run (models.AnonRun) when RestoreID is set
+	RestoreID   string
+	RestoreName string
+	Trigger     string // models.AnonRunTrigger*
+}
+
+// ApplyResult reports what Apply changed
+type ApplyResult struct {
+	RulesApplied int                    `json:"rules_applied"`
+	Tables       []models.AnonRunResult `json:"tables"`
 }
 
 // Apply loads and applies anonymization rules to a database
-// Returns the number of rules applied and any error
-func Apply(ctx context.Context, db *gorm.DB, params ApplyParams, logger zerolog.Logger) (int, error) {
+// The tables are updated in a single transaction, so a failing rule leaves the data untouched
+func Apply(ctx context.Context, db *gorm.DB, params ApplyParams, logger zerolog.Logger) (*ApplyResult, error) {
 	// Load all anonymization rules
 	var rules []models.AnonRule
 	if err := db.Find(&rules).Error; err != nil {
-		return 0, fmt.Errorf("failed to load anon rules: %w", err)
+		return nil, fmt.Errorf("failed to load anon rules: %w", err)
 	}
 
+	start := time.Now()
+	results := []models.AnonRunResult{}
+	var err error
 	if len(rules) == 0 {
 		logger.Info().
 			Str("database_name", params.DatabaseName).
 			Msg("No anonymization rules configured, skipping")
-		return 0, nil
+	} else {
+		logger.Info().
+			Str("database_name", params.DatabaseName).
+			Int("rule_count", len(rules)).
+			Msg("Applying anonymization rules")
+		results, err = applyRules(ctx, rules, params, logger)
 	}
 
-	logger.Info().
-		Str("database_name", params.DatabaseName).
-		Int("rule_count", len(rules)).
-		Msg("Applying anonymization rules")
+	if params.RestoreID != "" {
+		recordRun(db, params, len(rules), results, time.Since(start), err, logger)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	// Extract unique table names from rules
-	tableMap := make(map[string]bool)
-	for _, rule := range rules {
-		tableMap[rule.Table] = true
+	if len(rules) > 0 {
+		logger.Info().
+			Str("database_name", params.DatabaseName).
+			Int("rule_count", len(rules)).
+			Msg("Anonymization rules applied successfully")
 	}
-	var tables []string
-	for table := range tableMap {
-		tables = append(tables, table)
+
+	return &ApplyResult{RulesApplied: len(rules), Tables: results}, nil
+}
+
+// applyRules runs the UPDATE of each table and returns their results, including on failure
+func applyRules(ctx context.Context, rules []models.AnonRule, params ApplyParams, logger zerolog.Logger) ([]models.AnonRunResult, error) {
+	client, err := pgclient.OpenLocal(ctx, params.PostgresPort, params.DatabaseName)
+	if err != nil {
+		return []models.AnonRunResult{}, err
+	}
+	defer client.Close()
+
+	// Query for primary keys (falls back to ctid ordering on failure)
+	primaryKeys := queryPrimaryKeys(ctx, client, uniqueTables(rules), logger)
+
+	// Generate one UPDATE per table with primary key information
+	statements := generateStatements(rules, primaryKeys)
+	results := make([]models.AnonRunResult, len(statements))
+	sqlStatements := make([]string, len(statements))
+	for i, statement := range statements {
+		results[i] = newRunResult(statement)
+		sqlStatements[i] = statement.SQL
 	}
 
-	// Query for primary keys
-	primaryKeys := make(map[string]string)
-	if len(tables) > 0 {
-		pkQuerySQL := generatePrimaryKeyQuerySQL(tables)
-		pkScript := fmt.Sprintf(`#!/bin/bash
-set -euo pipefail
-DATABASE_NAME="%s"
-PG_VERSION="%s"
-PG_PORT="%d"
-PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
-
-sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -d "${DATABASE_NAME}" -t -A -F'|' <<'PK_QUERY'
-%s
-PK_QUERY
-`, params.DatabaseName, params.PostgresVersion, params.PostgresPort, pkQuerySQL)
-
-		cmd := exec.CommandContext(ctx, "bash", "-c", pkScript)
-		outputBytes, err := cmd.CombinedOutput()
-		if err != nil {
-			// Log warning but continue - we'll use ctid as fallback
-			logger.Warn().
-				Err(err).
-				Str("output", string(outputBytes)).
-				Msg("Failed to query primary keys, will use ctid for ordering")
-		} else {
-			// Parse output: table_name|column_name (one per line)
-			output := strings.TrimSpace(string(outputBytes))
-			if output != "" {
-				for _, line := range strings.Split(output, "\n") {
-					parts := strings.Split(line, "|")
-					if len(parts) == 2 {
-						tableName := strings.TrimSpace(parts[0])
-						columnName := strings.TrimSpace(parts[1])
-						primaryKeys[tableName] = columnName
-						logger.Debug().
-							Str("table", tableName).
-							Str("pk_column", columnName).
-							Msg("Detected primary key")
-					}
-				}
-			}
+	statementResults, err := client.ExecTransaction(ctx, sqlStatements)
+	for i, statementResult := range statementResults {
+		results[i].Status = models.AnonResultApplied
+		results[i].RowsUpdated = statementResult.RowsAffected
+		results[i].DurationMs = statementResult.Duration.Milliseconds()
+	}
+
+	if err != nil {
+		for i := range statementResults {
+			results[i].Status = models.AnonResultRolledBack
+		}
+		var stmtErr *pgclient.StatementError
+		if errors.As(err, &stmtErr) {
+			failed := &results[stmtErr.Index-1]
+			failed.Status = models.AnonResultFailed
+			failed.Error = stmtErr.Err.Error()
+			logger.Error().
+				Err(stmtErr.Err).
+				Str("database_name", params.DatabaseName).
+				Str("table", failed.Table).
+				Msg("Failed to anonymize table")
+			return results, fmt.Errorf("failed to anonymize table %s: %w", failed.Table, stmtErr.Err)
 		}
+		return results, fmt.Errorf("failed to apply anonymization rules: %w", err)
 	}
 
-	// Generate SQL from rules with primary key information
-	sql := GenerateSQL(rules, primaryKeys)
-	if sql == "" {
-		logger.Warn().Msg("Generated empty SQL from rules")
-		return 0, nil
+	for _, result := range results {
+		logger.Info().
+			Str("table", result.Table).
+			Int64("rows_updated", result.RowsUpdated).
+			Int64("duration_ms", result.DurationMs).
+			Msg("Anonymized table")
 	}
+	return results, nil
+}
 
-	// Execute anonymization SQL on the database
-	script := fmt.Sprintf(`#!/bin/bash
-set -euo pipefail
+// newRunResult returns the result of a table whose UPDATE hasn't run yet
+func newRunResult(statement tableStatement) models.AnonRunResult {
+	result := models.AnonRunResult{
+		Table:   statement.Table,
+		Columns: make([]string, len(statement.Rules)),
+		RuleIDs: make([]string, len(statement.Rules)),
+		Status:  models.AnonResultNotRun,
+	}
+	for i, rule := range statement.Rules {
+		result.Columns[i] = rule.Column
+		result.RuleIDs[i] = rule.ID
+	}
+	return result
+}
 
-DATABASE_NAME="%s"
-PG_VERSION="%s"
-PG_PORT="%d"
-PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
+// recordRun saves the anonymization run of a restore
+// Failing to save it is logged, the anonymization itself happened either way
+func recordRun(db *gorm.DB, params ApplyParams, ruleCount int, results []models.AnonRunResult, duration time.Duration, applyErr error, logger zerolog.Logger) {
+	run := models.AnonRun{
+		RestoreID:    params.RestoreID,
+		RestoreName:  params.RestoreName,
+		DatabaseName: params.DatabaseName,
+		Trigger:      params.Trigger,
+		Status:       models.AnonRunStatusSucceeded,
+		RulesApplied: ruleCount,
+		DurationMs:   duration.Milliseconds(),
+		Results:      results,
+	}
+	if applyErr != nil {
+		run.Status = models.AnonRunStatusFailed
+		run.RulesApplied = 0
+		run.Error = applyErr.Error()
+	} else {
+		for _, result := range results {
+			run.RowsUpdated += result.RowsUpdated
+		}
+	}
 
-echo "Applying anonymization rules to database ${DATABASE_NAME}"
+	if err := db.Create(&run).Error; err != nil {
+		logger.Error().
+			Err(err).
+			Str("restore_id", params.RestoreID).
+			Msg("Failed to record anonymization run")
+	}
+}
 
-# Execute anonymization SQL with correct port
-sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -d "${DATABASE_NAME}" <<'ANONYMIZE_SQL'
-%s
-ANONYMIZE_SQL
+// uniqueTables returns the distinct table names referenced by rules
+func uniqueTables(rules []models.AnonRule) []string {
+	tableMap := make(map[string]bool)
+	var tables []string
+	for _, rule := range rules {
+		if !tableMap[rule.Table] {
+			tableMap[rule.Table] = true
+			tables = append(tables, rule.Table)
+		}
+	}
+	return tables
+}
 
-echo "Anonymization completed successfully"
-`, params.DatabaseName, params.PostgresVersion, params.PostgresPort, sql)
+// queryPrimaryKeys looks up single-column primary keys for the given tables
+// Errors are logged and result in an empty map (callers order by ctid instead)
+func queryPrimaryKeys(ctx context.Context, client *pgclient.Client, tables []string, logger zerolog.Logger) map[string]string {
+	primaryKeys := make(map[string]string)
+	if len(tables) == 0 {
+		return primaryKeys
+	}
 
-	cmd := exec.CommandContext(ctx, "bash", "-c", script)
-	outputBytes, err := cmd.CombinedOutput()
-	output := string(outputBytes)
+	rows, err := client.Query(ctx, primaryKeyQuery, pq.Array(tables))
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var tableName, columnName string
+			if err = rows.Scan(&tableName, &columnName); err != nil {
+				break
+			}
+			primaryKeys[tableName] = columnName
+			logger.Debug().
+				Str("table", tableName).
+				Str("pk_column", columnName).
+				Msg("Detected primary key")
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+	}
 	if err != nil {
-		logger.Error().
+		// Log warning but continue - we'll use ctid as fallback
+		logger.Warn().
 			Err(err).
-			Str("output", output).
-			Str("database_name", params.DatabaseName).
-			Msg("Failed to execute anonymization script")
-		return 0, fmt.Errorf("anonymization script execution failed: %w", err)
+			Msg("Failed to query primary keys, will use ctid for ordering")
+		return make(map[string]string)
 	}
 
-	logger.Info().
-		Str("database_name", params.DatabaseName).
-		Int("rule_count", len(rules)).
-		Str("output", output).
-		Msg("Anonymization rules applied successfully")
-
-	return len(rules), nil
+	return primaryKeys
 }
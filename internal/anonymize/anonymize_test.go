@@ -56,6 +56,25 @@ func TestGenerateSQL(t *testing.T) {
 	}
 }
 
+func TestNewRunResult(t *testing.T) {
+	email := models.AnonRule{Table: "users", Column: "email", Template: "user_${index}@example.com", ColumnType: "text"}
+	email.ID = "rule-1"
+	name := models.AnonRule{Table: "users", Column: "name", Template: "User ${index}", ColumnType: "text"}
+	name.ID = "rule-2"
+	reference := models.AnonRule{Table: "orders", Column: "reference", Template: "ORD-${index}", ColumnType: "text"}
+	reference.ID = "rule-3"
+
+	statements := generateStatements([]models.AnonRule{email, reference, name}, map[string]string{})
+	if len(statements) != 2 || statements[0].Table != "users" || statements[1].Table != "orders" {
+		t.Fatalf("generateStatements() = %+v, want users then orders", statements)
+	}
+
+	got := newRunResult(statements[0])
+	if got.Status != models.AnonResultNotRun || strings.Join(got.Columns, ",") != "email,name" || strings.Join(got.RuleIDs, ",") != "rule-1,rule-2" {
+		t.Errorf("newRunResult() = %+v", got)
+	}
+}
+
 func TestRenderTemplate(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -122,28 +141,213 @@ func TestRenderTemplate(t *testing.T) {
 	}
 }
 
-func TestQuoteIdentifier(t *testing.T) {
+func TestRenderFunction(t *testing.T) {
+	defaultValue := "other"
+
 	tests := []struct {
 		name string
-		id   string
+		rule models.AnonRule
 		want string
 	}{
 		{
-			name: "simple identifier",
-			id:   "users",
-			want: "\"users\"",
+			name: "md5 with salt",
+			rule: models.AnonRule{Column: "email", Function: FunctionMD5, ColumnType: "text",
+				FunctionOptions: models.AnonFunctionOptions{Salt: "s'1"}},
+			want: `md5('s''1' || "users"."email"::text)`,
+		},
+		{
+			name: "sha256",
+			rule: models.AnonRule{Column: "email", Function: FunctionSHA256, ColumnType: "text"},
+			want: `encode(sha256(convert_to('' || "users"."email"::text, 'UTF8')), 'hex')`,
 		},
 		{
-			name: "identifier with quotes",
-			id:   "user\"name",
-			want: "\"user\"\"name\"",
+			name: "mask defaults to last 4",
+			rule: models.AnonRule{Column: "ssn", Function: FunctionMask, ColumnType: "text"},
+			want: `CASE WHEN length("users"."ssn"::text) <= 4 THEN "users"."ssn"::text ELSE repeat('*', length("users"."ssn"::text) - 4) || right("users"."ssn"::text, 4) END`,
 		},
+		{
+			name: "regex",
+			rule: models.AnonRule{Column: "phone", Function: FunctionRegex, ColumnType: "text",
+				FunctionOptions: models.AnonFunctionOptions{Pattern: "[0-9]", Replacement: "X"}},
+			want: `regexp_replace("users"."phone"::text, '[0-9]', 'X', 'g')`,
+		},
+		{
+			name: "lookup with default",
+			rule: models.AnonRule{Column: "plan", Function: FunctionLookup, ColumnType: "text",
+				FunctionOptions: models.AnonFunctionOptions{Mapping: map[string]string{"pro": "basic", "enterprise": "basic"}, Default: &defaultValue}},
+			want: `CASE "users"."plan"::text WHEN 'enterprise' THEN 'basic' WHEN 'pro' THEN 'basic' ELSE 'other' END`,
+		},
+		{
+			name: "integer column is cast",
+			rule: models.AnonRule{Column: "code", Function: FunctionLookup, ColumnType: "integer",
+				FunctionOptions: models.AnonFunctionOptions{Mapping: map[string]string{"1": "2"}}},
+			want: `(CASE "users"."code"::text WHEN '1' THEN '2' ELSE "users"."code"::text END)::integer`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderFunction("users", tt.rule); got != tt.want {
+				t.Errorf("renderFunction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderFunction_FakeValues(t *testing.T) {
+	for _, function := range []string{FunctionFakeName, FunctionFakeEmail, FunctionFakeAddress} {
+		got := renderFunction("users", models.AnonRule{Column: "name", Function: function, ColumnType: "text"})
+		if !strings.Contains(got, "numbered_rows._row_num") || !strings.Contains(got, "ARRAY[") {
+			t.Errorf("%s: expected deterministic row-number based expression, got %v", function, got)
+		}
+	}
+}
+
+func TestValidateFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		function string
+		opts     models.AnonFunctionOptions
+		wantErr  bool
+	}{
+		{name: "empty function", function: ""},
+		{name: "unknown function", function: "rot13", wantErr: true},
+		{name: "regex without pattern", function: FunctionRegex, wantErr: true},
+		{name: "regex with invalid pattern", function: FunctionRegex, opts: models.AnonFunctionOptions{Pattern: "("}, wantErr: true},
+		{name: "lookup without mapping", function: FunctionLookup, wantErr: true},
+		{name: "mask with negative keep", function: FunctionMask, opts: models.AnonFunctionOptions{KeepLast: -1}, wantErr: true},
+		{name: "valid mask", function: FunctionMask, opts: models.AnonFunctionOptions{KeepLast: 2, MaskChar: "#"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFunction(tt.function, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFunction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFunctionType(t *testing.T) {
+	defaultValue := "none"
+	tests := []struct {
+		name       string
+		function   string
+		opts       models.AnonFunctionOptions
+		columnType string
+		wantErr    bool
+	}{
+		{name: "text hash", function: FunctionMD5, columnType: "text"},
+		{name: "integer hash", function: FunctionMD5, columnType: "integer", wantErr: true},
+		{name: "integer fake name", function: FunctionFakeName, columnType: "integer", wantErr: true},
+		{name: "integer regex", function: FunctionRegex, opts: models.AnonFunctionOptions{Pattern: "[0-9]"}, columnType: "integer", wantErr: true},
+		{name: "integer lookup", function: FunctionLookup, opts: models.AnonFunctionOptions{Mapping: map[string]string{"1": "10", "2": " 20"}}, columnType: "integer"},
+		{name: "integer lookup to text", function: FunctionLookup, opts: models.AnonFunctionOptions{Mapping: map[string]string{"1": "gold"}}, columnType: "integer", wantErr: true},
+		{name: "integer lookup with text default", function: FunctionLookup, opts: models.AnonFunctionOptions{Mapping: map[string]string{"1": "10"}, Default: &defaultValue}, columnType: "integer", wantErr: true},
+		{name: "integer mask with digit", function: FunctionMask, opts: models.AnonFunctionOptions{MaskChar: "0"}, columnType: "integer"},
+		{name: "integer mask with default char", function: FunctionMask, columnType: "integer", wantErr: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := quoteIdentifier(tt.id); got != tt.want {
-				t.Errorf("quoteIdentifier() = %v, want %v", got, tt.want)
+			err := ValidateFunctionType(tt.function, tt.opts, tt.columnType)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFunctionType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeneratePreviewSampleSQL(t *testing.T) {
+	rules := []models.AnonRule{
+		{Table: "users", Column: "email", Template: "user_${index}@example.com", ColumnType: "text"},
+	}
+
+	got := generatePreviewSampleSQL("users", rules, "id", 5)
+	for _, want := range []string{"LIMIT 5", "ORDER BY \"id\"", "json_build_array(\"users\".\"email\"::text"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("generatePreviewSampleSQL() missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "UPDATE") {
+		t.Errorf("generatePreviewSampleSQL() must not update:\n%s", got)
+	}
+}
+
+func TestParsePreviewSample(t *testing.T) {
+	rules := []models.AnonRule{
+		{Table: "users", Column: "email"},
+		{Table: "users", Column: "name"},
+	}
+	preview := TablePreview{Columns: []ColumnPreview{{Column: "email"}, {Column: "name"}}}
+
+	if err := parsePreviewSample(`[["a@b.com","user_1@example.com"],[null,"User 1"]]`, rules, &preview); err != nil {
+		t.Fatalf("parsePreviewSample() error = %v", err)
+	}
+
+	if len(preview.Columns[0].Samples) != 1 || *preview.Columns[0].Samples[0].After != "user_1@example.com" {
+		t.Errorf("unexpected email samples: %+v", preview.Columns[0].Samples)
+	}
+	if preview.Columns[1].Samples[0].Before != nil {
+		t.Errorf("expected NULL before value, got %v", *preview.Columns[1].Samples[0].Before)
+	}
+	if err := parsePreviewSample("not json", rules, &preview); err == nil {
+		t.Error("parsePreviewSample() expected an error for invalid JSON")
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema := Schema{"users": {
+		"id":       {DataType: "integer", UDTName: "int4"},
+		"email":    {DataType: "character varying", UDTName: "varchar"},
+		"age":      {DataType: "integer", UDTName: "int4", Nullable: true},
+		"active":   {DataType: "boolean", UDTName: "bool"},
+		"nickname": {DataType: "USER-DEFINED", UDTName: "citext", Nullable: true},
+		"dob":      {DataType: "date", UDTName: "date"},
+		"external": {DataType: "uuid", UDTName: "uuid"},
+		"metadata": {DataType: "jsonb", UDTName: "jsonb"},
+		"settings": {DataType: "json", UDTName: "json"},
+	}}
+
+	tests := []struct {
+		name     string
+		rule     models.AnonRule
+		wantCode string
+	}{
+		{name: "valid text", rule: models.AnonRule{Table: "users", Column: "email", Template: "user_${index}@example.com", ColumnType: "text"}},
+		{name: "missing table", rule: models.AnonRule{Table: "accounts", Column: "email", ColumnType: "text"}, wantCode: ValidationMissingTable},
+		{name: "dropped column", rule: models.AnonRule{Table: "users", Column: "phone", ColumnType: "text"}, wantCode: ValidationMissingColumn},
+		{name: "text template on integer", rule: models.AnonRule{Table: "users", Column: "age", Template: "age_${index}", ColumnType: "text"}, wantCode: ValidationTypeMismatch},
+		{name: "numeric literal on integer", rule: models.AnonRule{Table: "users", Column: "age", Template: "42", ColumnType: "text"}},
+		{name: "integer on integer", rule: models.AnonRule{Table: "users", Column: "age", Template: "${index}", ColumnType: "integer"}},
+		{name: "integer on boolean", rule: models.AnonRule{Table: "users", Column: "active", Template: "1", ColumnType: "integer"}, wantCode: ValidationTypeMismatch},
+		{name: "boolean on text", rule: models.AnonRule{Table: "users", Column: "email", Template: "true", ColumnType: "boolean"}},
+		{name: "function on integer", rule: models.AnonRule{Table: "users", Column: "age", Function: FunctionMD5, ColumnType: "text"}, wantCode: ValidationTypeMismatch},
+		{name: "function on citext", rule: models.AnonRule{Table: "users", Column: "nickname", Function: FunctionFakeName, ColumnType: "text"}},
+		{name: "null on not null", rule: models.AnonRule{Table: "users", Column: "email", ColumnType: "null"}, wantCode: ValidationNotNullable},
+		{name: "null on nullable", rule: models.AnonRule{Table: "users", Column: "age", ColumnType: "null"}},
+		{name: "date on date", rule: models.AnonRule{Table: "users", Column: "dob", Template: "${now} - ${index} days", ColumnType: "date"}},
+		{name: "date on text", rule: models.AnonRule{Table: "users", Column: "email", Template: "${now}", ColumnType: "date"}, wantCode: ValidationTypeMismatch},
+		{name: "uuid on uuid", rule: models.AnonRule{Table: "users", Column: "external", Template: "${uuid}", ColumnType: "uuid"}},
+		{name: "uuid on date", rule: models.AnonRule{Table: "users", Column: "dob", Template: "${uuid}", ColumnType: "uuid"}, wantCode: ValidationTypeMismatch},
+		{name: "json field of jsonb", rule: models.AnonRule{Table: "users", Column: "metadata", JSONPath: "contact.email", Function: FunctionFakeEmail, ColumnType: "text"}},
+		{name: "null json field of not null jsonb", rule: models.AnonRule{Table: "users", Column: "metadata", JSONPath: "ssn", ColumnType: "null"}},
+		{name: "json field of json", rule: models.AnonRule{Table: "users", Column: "settings", JSONPath: "email", ColumnType: "text"}, wantCode: ValidationTypeMismatch},
+		{name: "json field of text", rule: models.AnonRule{Table: "users", Column: "email", JSONPath: "email", ColumnType: "text"}, wantCode: ValidationTypeMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateSchema([]models.AnonRule{tt.rule}, schema)
+			if tt.wantCode == "" {
+				if len(got) != 0 {
+					t.Errorf("ValidateSchema() = %+v, want no errors", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Code != tt.wantCode {
+				t.Errorf("ValidateSchema() = %+v, want code %s", got, tt.wantCode)
 			}
 		})
 	}
@@ -0,0 +1,109 @@
+package anonymize
+
+import (
+	"reflect"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// RulesDiff is what replacing the current rules with desired ones changes
+// Rules are matched by table and column (and JSON field), a column or JSON field has at most one rule
+type RulesDiff struct {
+	Added     []models.AnonRule `json:"added"`
+	Removed   []models.AnonRule `json:"removed"`
+	Changed   []RuleChange      `json:"changed"`
+	Unchanged []models.AnonRule `json:"unchanged"`
+}
+
+// RuleChange is a column whose rule is replaced
+type RuleChange struct {
+	Before models.AnonRule `json:"before"`
+	After  models.AnonRule `json:"after"`
+}
+
+// Empty reports whether applying the diff changes nothing
+func (d RulesDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffRules compares the current rules with the desired ones, keeping the order of desired
+// Current rules beyond the first for a column (e.g. created twice with POST /api/anon-rules) are removed
+func DiffRules(current, desired []models.AnonRule) RulesDiff {
+	diff := RulesDiff{
+		Added:     []models.AnonRule{},
+		Removed:   []models.AnonRule{},
+		Changed:   []RuleChange{},
+		Unchanged: []models.AnonRule{},
+	}
+
+	existing := make(map[string]int) // table.column -> index of its first rule in current
+	for i, rule := range current {
+		if _, duplicate := existing[ruleKey(rule)]; duplicate {
+			diff.Removed = append(diff.Removed, rule)
+			continue
+		}
+		existing[ruleKey(rule)] = i
+	}
+
+	for _, rule := range desired {
+		i, ok := existing[ruleKey(rule)]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, rule)
+		case sameRule(current[i], rule):
+			diff.Unchanged = append(diff.Unchanged, current[i])
+		default:
+			diff.Changed = append(diff.Changed, RuleChange{Before: current[i], After: rule})
+		}
+		delete(existing, ruleKey(rule))
+	}
+
+	for i, rule := range current {
+		if first, ok := existing[ruleKey(rule)]; ok && first == i {
+			diff.Removed = append(diff.Removed, rule)
+		}
+	}
+	return diff
+}
+
+// DuplicateRule returns the first rule of a column or JSON field that already has one in rules
+// A rule replacing a whole column conflicts with rules replacing its JSON fields
+func DuplicateRule(rules []models.AnonRule) (models.AnonRule, bool) {
+	seen := make(map[string]bool)
+	wholeColumn := make(map[string]bool)
+	fields := make(map[string]bool)
+	for _, rule := range rules {
+		column := rule.Table + "." + rule.Column
+		if seen[ruleKey(rule)] || wholeColumn[column] || (rule.JSONPath == "" && fields[column]) {
+			return rule, true
+		}
+		seen[ruleKey(rule)] = true
+		if rule.JSONPath == "" {
+			wholeColumn[column] = true
+		} else {
+			fields[column] = true
+		}
+	}
+	return models.AnonRule{}, false
+}
+
+// RuleTarget names what a rule replaces, e.g. "users.email" or "users.metadata->contact.email"
+func RuleTarget(rule models.AnonRule) string {
+	return ruleKey(rule)
+}
+
+func ruleKey(rule models.AnonRule) string {
+	if rule.JSONPath != "" {
+		return rule.Table + "." + rule.Column + "->" + rule.JSONPath
+	}
+	return rule.Table + "." + rule.Column
+}
+
+// sameRule compares what two rules do, ignoring their IDs and timestamps
+func sameRule(a, b models.AnonRule) bool {
+	return a.Template == b.Template &&
+		a.ColumnType == b.ColumnType &&
+		a.Function == b.Function &&
+		a.Consistent == b.Consistent &&
+		reflect.DeepEqual(a.FunctionOptions, b.FunctionOptions)
+}
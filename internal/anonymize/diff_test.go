@@ -0,0 +1,50 @@
+package anonymize
+
+import (
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestDiffRules(t *testing.T) {
+	rule := func(id, table, column, function string) models.AnonRule {
+		r := models.AnonRule{Table: table, Column: column, ColumnType: "text", Function: function}
+		r.ID = id
+		return r
+	}
+	current := []models.AnonRule{
+		rule("1", "users", "email", FunctionFakeEmail),
+		rule("2", "users", "name", FunctionFakeName),
+		rule("3", "users", "phone", FunctionMask),
+		rule("4", "users", "email", FunctionMD5), // Duplicate
+	}
+	desired := []models.AnonRule{
+		rule("", "users", "email", FunctionFakeEmail),
+		rule("", "users", "name", FunctionMD5),
+		rule("", "orders", "reference", FunctionMD5),
+	}
+
+	diff := DiffRules(current, desired)
+	if len(diff.Unchanged) != 1 || diff.Unchanged[0].ID != "1" {
+		t.Errorf("Unchanged = %+v, want users.email with its ID", diff.Unchanged)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Before.ID != "2" || diff.Changed[0].After.Function != FunctionMD5 {
+		t.Errorf("Changed = %+v, want users.name", diff.Changed)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Table != "orders" {
+		t.Errorf("Added = %+v, want orders.reference", diff.Added)
+	}
+	if len(diff.Removed) != 2 || diff.Removed[0].ID != "4" || diff.Removed[1].ID != "3" {
+		t.Errorf("Removed = %+v, want the duplicate and users.phone", diff.Removed)
+	}
+	if diff.Empty() {
+		t.Error("Empty() = true")
+	}
+
+	if diff := DiffRules(desired, desired); !diff.Empty() || len(diff.Unchanged) != 3 {
+		t.Errorf("DiffRules(same) = %+v, want everything unchanged", diff)
+	}
+	if _, ok := DuplicateRule(current); !ok {
+		t.Error("DuplicateRule() found no duplicate")
+	}
+}
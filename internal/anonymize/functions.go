@@ -0,0 +1,251 @@
+package anonymize
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+// Built-in anonymization functions (AnonRule.Function)
+const (
+	FunctionMD5         = "md5"
+	FunctionSHA256      = "sha256"
+	FunctionFakeName    = "fake_name"
+	FunctionFakeEmail   = "fake_email"
+	FunctionFakeAddress = "fake_address"
+	FunctionMask        = "mask"
+	FunctionRegex       = "regex"
+	FunctionLookup      = "lookup"
+)
+
+// Functions lists all supported built-in anonymization functions
+var Functions = []string{
+	FunctionMD5,
+	FunctionSHA256,
+	FunctionFakeName,
+	FunctionFakeEmail,
+	FunctionFakeAddress,
+	FunctionMask,
+	FunctionRegex,
+	FunctionLookup,
+}
+
+// defaultMaskKeepLast is the number of trailing characters kept by the mask function
+const defaultMaskKeepLast = 4
+
+// Word lists for faker-style values
+// Values are picked deterministically from the row number so that
+// re-running anonymization on the same data produces the same output
+var (
+	fakeFirstNames = []string{
+		"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda",
+		"David", "Elizabeth", "William", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+		"Thomas", "Sarah", "Charles", "Karen", "Daniel", "Lisa", "Matthew", "Nancy",
+	}
+	fakeLastNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+		"Rodriguez", "Martinez", "Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas",
+		"Taylor", "Moore", "Jackson", "Martin", "Lee", "Perez", "Thompson", "White",
+	}
+	fakeStreetNames = []string{
+		"Main", "Oak", "Pine", "Maple", "Cedar", "Elm", "Washington", "Lake",
+		"Hill", "Park", "Walnut", "Sunset", "Lincoln", "Jackson", "Church", "River",
+	}
+	fakeStreetSuffixes = []string{"St", "Ave", "Rd", "Blvd", "Ln", "Dr", "Ct", "Way"}
+	fakeCities         = []string{
+		"Springfield", "Riverside", "Franklin", "Greenville", "Bristol", "Clinton", "Fairview", "Salem",
+		"Madison", "Georgetown", "Arlington", "Ashland", "Dover", "Oxford", "Jackson", "Burlington",
+	}
+)
+
+// IsFunction reports whether name is a supported built-in function
+func IsFunction(name string) bool {
+	for _, f := range Functions {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateFunction validates a function name and its options
+// An empty function name means the rule uses a static template and is always valid
+func ValidateFunction(function string, opts models.AnonFunctionOptions) error {
+	if function == "" {
+		return nil
+	}
+
+	if !IsFunction(function) {
+		return fmt.Errorf("invalid function '%s', must be one of: %s", function, strings.Join(Functions, ", "))
+	}
+
+	switch function {
+	case FunctionMask:
+		if opts.KeepLast < 0 {
+			return fmt.Errorf("mask keep_last must not be negative")
+		}
+		if len([]rune(opts.MaskChar)) > 1 {
+			return fmt.Errorf("mask mask_char must be a single character")
+		}
+	case FunctionRegex:
+		if opts.Pattern == "" {
+			return fmt.Errorf("regex function requires a pattern")
+		}
+		// PostgreSQL uses POSIX ARE syntax, which is close enough to RE2 for a sanity check
+		if _, err := regexp.Compile(opts.Pattern); err != nil {
+			return fmt.Errorf("invalid regex pattern: %w", err)
+		}
+	case FunctionLookup:
+		if len(opts.Mapping) == 0 {
+			return fmt.Errorf("lookup function requires a non-empty mapping")
+		}
+	}
+
+	return nil
+}
+
+// ValidateFunctionType checks that a function's output fits the rule's column type
+// Functions produce text that is cast back for integer columns, which only works for lookups mapping to integers
+// and masks with a digit mask_char
+func ValidateFunctionType(function string, opts models.AnonFunctionOptions, columnType string) error {
+	if function == "" || columnType != "integer" {
+		return nil
+	}
+
+	switch function {
+	case FunctionLookup:
+		keys := make([]string, 0, len(opts.Mapping))
+		for key := range opts.Mapping {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !isInteger(opts.Mapping[key]) {
+				return fmt.Errorf("lookup maps '%s' to '%s', which isn't an integer", key, opts.Mapping[key])
+			}
+		}
+		if opts.Default != nil && !isInteger(*opts.Default) {
+			return fmt.Errorf("lookup default '%s' isn't an integer", *opts.Default)
+		}
+		return nil
+	case FunctionMask:
+		if runes := []rune(opts.MaskChar); len(runes) != 1 || !unicode.IsDigit(runes[0]) {
+			return fmt.Errorf("mask of an integer column requires a digit mask_char")
+		}
+		return nil
+	}
+	return fmt.Errorf("function '%s' produces text, type integer is only supported by %s and %s", function, FunctionLookup, FunctionMask)
+}
+
+// isInteger reports whether value casts to an integer
+func isInteger(value string) bool {
+	_, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return err == nil
+}
+
+// renderFunction converts a built-in function rule to an SQL expression
+// The source value is the rule's column or JSON field (see ruleSource); fake values are picked by ruleIndex
+func renderFunction(table string, rule models.AnonRule) string {
+	source := ruleSource(table, rule)
+	opts := rule.FunctionOptions
+
+	var expr string
+	switch rule.Function {
+	case FunctionMD5:
+		expr = fmt.Sprintf("md5(%s || %s)", pgclient.QuoteLiteral(opts.Salt), source)
+
+	case FunctionSHA256:
+		expr = fmt.Sprintf("encode(sha256(convert_to(%s || %s, 'UTF8')), 'hex')", pgclient.QuoteLiteral(opts.Salt), source)
+
+	case FunctionFakeName, FunctionFakeEmail, FunctionFakeAddress:
+		expr, _ = FakeValueSQL(rule.Function, ruleIndex(table, rule))
+
+	case FunctionMask:
+		keepLast := opts.KeepLast
+		if keepLast == 0 {
+			keepLast = defaultMaskKeepLast
+		}
+		maskChar := opts.MaskChar
+		if maskChar == "" {
+			maskChar = "*"
+		}
+		expr = fmt.Sprintf("CASE WHEN length(%[1]s) <= %[2]d THEN %[1]s ELSE repeat(%[3]s, length(%[1]s) - %[2]d) || right(%[1]s, %[2]d) END",
+			source, keepLast, pgclient.QuoteLiteral(maskChar))
+
+	case FunctionRegex:
+		expr = fmt.Sprintf("regexp_replace(%s, %s, %s, 'g')", source, pgclient.QuoteLiteral(opts.Pattern), pgclient.QuoteLiteral(opts.Replacement))
+
+	case FunctionLookup:
+		// Sort keys so generated SQL is stable
+		keys := make([]string, 0, len(opts.Mapping))
+		for key := range opts.Mapping {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var cases []string
+		for _, key := range keys {
+			cases = append(cases, fmt.Sprintf("WHEN %s THEN %s", pgclient.QuoteLiteral(key), pgclient.QuoteLiteral(opts.Mapping[key])))
+		}
+
+		fallback := source
+		if opts.Default != nil {
+			fallback = pgclient.QuoteLiteral(*opts.Default)
+		}
+		expr = fmt.Sprintf("CASE %s %s ELSE %s END", source, strings.Join(cases, " "), fallback)
+
+	default:
+		// Unknown functions are rejected by ValidateFunction; leave the column unchanged
+		expr = source
+	}
+
+	// Functions produce text, cast back for integer columns
+	if rule.ColumnType == "integer" {
+		return fmt.Sprintf("(%s)::integer", expr)
+	}
+
+	return expr
+}
+
+// FakeValueSQL renders a faker-style function (fake_name, fake_email, fake_address) as an SQL expression
+// Values are picked from the word lists by indexExpr (e.g. a row number), so the same index always gives the same value
+func FakeValueSQL(function, indexExpr string) (string, bool) {
+	switch function {
+	case FunctionFakeName:
+		return fmt.Sprintf("%s || ' ' || %s",
+			pickFromList(fakeFirstNames, indexExpr),
+			pickFromList(fakeLastNames, fmt.Sprintf("%s / %d", indexExpr, len(fakeFirstNames))),
+		), true
+
+	case FunctionFakeEmail:
+		return fmt.Sprintf("lower(%s || '.' || %s) || %s || '@example.com'",
+			pickFromList(fakeFirstNames, indexExpr),
+			pickFromList(fakeLastNames, fmt.Sprintf("%s / %d", indexExpr, len(fakeFirstNames))),
+			indexExpr,
+		), true
+
+	case FunctionFakeAddress:
+		return fmt.Sprintf("(1 + %s %% 9999)::text || ' ' || %s || ' ' || %s || ', ' || %s",
+			indexExpr,
+			pickFromList(fakeStreetNames, indexExpr),
+			pickFromList(fakeStreetSuffixes, fmt.Sprintf("%s / %d", indexExpr, len(fakeStreetNames))),
+			pickFromList(fakeCities, fmt.Sprintf("%s / %d", indexExpr, len(fakeStreetNames)*len(fakeStreetSuffixes))),
+		), true
+	}
+	return "", false
+}
+
+// pickFromList renders an SQL expression selecting a list element by a row-number based index
+func pickFromList(values []string, indexExpr string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = pgclient.QuoteLiteral(v)
+	}
+	return fmt.Sprintf("(ARRAY[%s])[1 + ((%s) %% %d)]", strings.Join(quoted, ", "), indexExpr, len(values))
+}
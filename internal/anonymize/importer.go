@@ -0,0 +1,486 @@
+package anonymize
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Annotation sources supported by Import
+const (
+	ImportFormatDBT  = "dbt"  // dbt schema.yml (models/sources) or manifest.json, column meta and tags
+	ImportFormatDBML = "dbml" // DBML column notes
+	ImportFormatSQL  = "sql"  // COMMENT ON COLUMN statements
+)
+
+// ImportFormats lists all supported import formats
+var ImportFormats = []string{ImportFormatDBT, ImportFormatDBML, ImportFormatSQL}
+
+// ImportSkipped describes an annotated column no rule was generated for
+type ImportSkipped struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Reason string `json:"reason"`
+}
+
+// ImportResult holds the rules generated from PII annotations
+type ImportResult struct {
+	Rules   []models.AnonRule `json:"rules"`
+	Skipped []ImportSkipped   `json:"skipped"`
+}
+
+// Import generates anonymization rules from PII annotations
+//
+// Annotations use the same convention in every format:
+//   - "pii" (or pii: true) generates a rule with a function guessed from the column name
+//   - "pii: <function>" (e.g. "pii: fake_email") uses that built-in function
+//   - "pii: null" sets the column to NULL
+//   - "pii: false" is ignored
+//
+// dbt additionally supports meta.anonymize (a function name, or a map with "function" and function options)
+// and the "pii" column tag. Only columns in the public schema are imported.
+func Import(format string, content []byte) (*ImportResult, error) {
+	var annotations []annotation
+	var err error
+	switch format {
+	case ImportFormatDBT:
+		annotations, err = parseDBT(content)
+	case ImportFormatDBML:
+		annotations, err = parseDBML(content)
+	case ImportFormatSQL:
+		annotations = parseSQLComments(content)
+	default:
+		return nil, fmt.Errorf("invalid format '%s', must be one of: %s", format, strings.Join(ImportFormats, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{Rules: []models.AnonRule{}, Skipped: []ImportSkipped{}}
+	seen := map[string]int{} // table.column -> index in result.Rules (later annotations win)
+	for _, a := range annotations {
+		table, ok := publicTable(a.table)
+		if !ok {
+			result.Skipped = append(result.Skipped, ImportSkipped{Table: a.table, Column: a.column, Reason: "only tables in the public schema are anonymized"})
+			continue
+		}
+
+		rule, err := a.rule(table)
+		if err != nil {
+			result.Skipped = append(result.Skipped, ImportSkipped{Table: table, Column: a.column, Reason: err.Error()})
+			continue
+		}
+
+		key := table + "." + a.column
+		if i, exists := seen[key]; exists {
+			result.Rules[i] = rule
+			continue
+		}
+		seen[key] = len(result.Rules)
+		result.Rules = append(result.Rules, rule)
+	}
+
+	return result, nil
+}
+
+// annotation is a PII-annotated column found in the imported content
+type annotation struct {
+	table    string // As written, possibly schema-qualified
+	column   string
+	function string // Empty = guess from the column name
+	options  models.AnonFunctionOptions
+}
+
+// rule converts the annotation to an AnonRule
+func (a annotation) rule(table string) (models.AnonRule, error) {
+	if a.function == "null" {
+		return models.AnonRule{Table: table, Column: a.column, ColumnType: "null"}, nil
+	}
+
+	function := a.function
+	if function == "" {
+		function = GuessFunction(a.column)
+	}
+	if err := ValidateFunction(function, a.options); err != nil {
+		return models.AnonRule{}, err
+	}
+
+	return models.AnonRule{
+		Table:           table,
+		Column:          a.column,
+		ColumnType:      "text",
+		Function:        function,
+		FunctionOptions: a.options,
+	}, nil
+}
+
+// GuessFunction picks a built-in function for a PII column from its name
+// Falls back to md5, which keeps values unique and joinable
+func GuessFunction(column string) string {
+	name := strings.ToLower(column)
+	switch {
+	case strings.Contains(name, "email"):
+		return FunctionFakeEmail
+	case strings.Contains(name, "address") || strings.Contains(name, "street"):
+		return FunctionFakeAddress
+	case strings.Contains(name, "name"):
+		return FunctionFakeName
+	case strings.Contains(name, "phone") || strings.Contains(name, "ssn") || strings.Contains(name, "card") ||
+		strings.Contains(name, "iban") || strings.Contains(name, "account"):
+		return FunctionMask
+	default:
+		return FunctionMD5
+	}
+}
+
+// publicTable strips a "public." qualifier and reports whether the table is in the public schema
+func publicTable(table string) (string, bool) {
+	schema, name, qualified := strings.Cut(table, ".")
+	if !qualified {
+		return table, true
+	}
+	return name, schema == "public"
+}
+
+// piiTagPattern matches "pii", "pii: <value>" and "pii=<value>" in free text (notes, comments)
+var piiTagPattern = regexp.MustCompile(`(?i)\bpii\b(?:\s*[:=]\s*([a-z0-9_]+))?`)
+
+// parsePIITag extracts the function from a PII tag in free text
+// ok is false when the text has no tag or explicitly marks the column as not PII
+func parsePIITag(text string) (function string, ok bool) {
+	match := piiTagPattern.FindStringSubmatch(text)
+	if match == nil {
+		return "", false
+	}
+	return piiValue(match[1])
+}
+
+// piiValue interprets the value of a pii annotation
+func piiValue(value string) (function string, ok bool) {
+	switch strings.ToLower(value) {
+	case "", "true", "yes":
+		return "", true
+	case "false", "no":
+		return "", false
+	default:
+		return strings.ToLower(value), true
+	}
+}
+
+// dbt
+
+type dbtFile struct {
+	Models  []dbtModel          `yaml:"models"`
+	Sources dbtSources          `yaml:"sources"`
+	Nodes   map[string]dbtModel `yaml:"nodes"` // manifest.json
+}
+
+type dbtSource struct {
+	Schema string     `yaml:"schema"`
+	Tables []dbtModel `yaml:"tables"`
+}
+
+// dbtSources accepts both the schema.yml list of sources and the manifest.json map of source tables
+type dbtSources []dbtSource
+
+func (s *dbtSources) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		var tables map[string]dbtModel
+		if err := value.Decode(&tables); err != nil {
+			return err
+		}
+		ids := make([]string, 0, len(tables))
+		for id := range tables {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			*s = append(*s, dbtSource{Tables: []dbtModel{tables[id]}})
+		}
+		return nil
+	}
+
+	var sources []dbtSource
+	if err := value.Decode(&sources); err != nil {
+		return err
+	}
+	*s = sources
+	return nil
+}
+
+type dbtModel struct {
+	Name         string     `yaml:"name"`
+	Alias        string     `yaml:"alias"`
+	Identifier   string     `yaml:"identifier"`
+	Schema       string     `yaml:"schema"`
+	ResourceType string     `yaml:"resource_type"`
+	Columns      dbtColumns `yaml:"columns"`
+}
+
+type dbtColumn struct {
+	Name   string                 `yaml:"name"`
+	Meta   map[string]interface{} `yaml:"meta"`
+	Tags   []string               `yaml:"tags"`
+	Config struct {
+		Meta map[string]interface{} `yaml:"meta"`
+		Tags []string               `yaml:"tags"`
+	} `yaml:"config"`
+}
+
+// dbtColumns accepts both the schema.yml list and the manifest.json map of columns
+type dbtColumns []dbtColumn
+
+func (c *dbtColumns) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		var columns map[string]dbtColumn
+		if err := value.Decode(&columns); err != nil {
+			return err
+		}
+		names := make([]string, 0, len(columns))
+		for name := range columns {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			column := columns[name]
+			if column.Name == "" {
+				column.Name = name
+			}
+			*c = append(*c, column)
+		}
+		return nil
+	}
+
+	var columns []dbtColumn
+	if err := value.Decode(&columns); err != nil {
+		return err
+	}
+	*c = columns
+	return nil
+}
+
+// table returns the database table a dbt model or source table is materialized as
+func (m dbtModel) table(schema string) string {
+	name := m.Name
+	if m.Identifier != "" {
+		name = m.Identifier
+	} else if m.Alias != "" {
+		name = m.Alias
+	}
+	if m.Schema != "" {
+		schema = m.Schema
+	}
+	if schema != "" {
+		return schema + "." + name
+	}
+	return name
+}
+
+// parseDBT reads PII annotations from a dbt schema.yml or manifest.json (JSON is valid YAML)
+func parseDBT(content []byte) ([]annotation, error) {
+	var file dbtFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("invalid dbt file: %w", err)
+	}
+
+	var annotations []annotation
+	collect := func(model dbtModel, schema string) error {
+		table := model.table(schema)
+		for _, column := range model.Columns {
+			a, ok, err := dbtColumnAnnotation(column)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", table, column.Name, err)
+			}
+			if ok {
+				a.table = table
+				a.column = column.Name
+				annotations = append(annotations, a)
+			}
+		}
+		return nil
+	}
+
+	for _, model := range file.Models {
+		if err := collect(model, ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, source := range file.Sources {
+		for _, table := range source.Tables {
+			if err := collect(table, source.Schema); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(file.Nodes))
+	for id := range file.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		node := file.Nodes[id]
+		if node.ResourceType != "" && node.ResourceType != "model" && node.ResourceType != "source" && node.ResourceType != "seed" && node.ResourceType != "snapshot" {
+			continue
+		}
+		if err := collect(node, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return annotations, nil
+}
+
+// dbtColumnAnnotation reads meta.pii, meta.anonymize and the "pii" tag of a dbt column
+func dbtColumnAnnotation(column dbtColumn) (annotation, bool, error) {
+	meta := map[string]interface{}{}
+	for key, value := range column.Config.Meta {
+		meta[key] = value
+	}
+	for key, value := range column.Meta {
+		meta[key] = value
+	}
+
+	if spec, exists := meta["anonymize"]; exists {
+		switch v := spec.(type) {
+		case string:
+			function, ok := piiValue(v)
+			return annotation{function: function}, ok, nil
+		case bool:
+			return annotation{}, v, nil
+		case map[string]interface{}:
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return annotation{}, false, err
+			}
+			var parsed struct {
+				Function string `json:"function"`
+				models.AnonFunctionOptions
+			}
+			if err := json.Unmarshal(raw, &parsed); err != nil {
+				return annotation{}, false, fmt.Errorf("invalid anonymize meta: %w", err)
+			}
+			return annotation{function: parsed.Function, options: parsed.AnonFunctionOptions}, true, nil
+		default:
+			return annotation{}, false, fmt.Errorf("anonymize meta must be a function name or a map")
+		}
+	}
+
+	if pii, exists := meta["pii"]; exists {
+		function, ok := piiValue(fmt.Sprint(pii))
+		return annotation{function: function}, ok, nil
+	}
+
+	for _, tag := range append(column.Tags, column.Config.Tags...) {
+		if strings.EqualFold(tag, "pii") {
+			return annotation{}, true, nil
+		}
+	}
+
+	return annotation{}, false, nil
+}
+
+// DBML
+
+var (
+	dbmlTablePattern  = regexp.MustCompile(`(?i)^\s*table\s+("[^"]+"(?:\."[^"]+")?|[\w.]+)`)
+	dbmlColumnPattern = regexp.MustCompile(`^\s*("[^"]+"|\w+)\s+\S+.*\[(.*)\]\s*$`)
+	dbmlNotePattern   = regexp.MustCompile(`(?i)\bnote\s*:\s*(?:'''([\s\S]*?)'''|'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)")`)
+)
+
+// parseDBML reads PII annotations from DBML column notes, e.g. `email varchar [note: 'pii: fake_email']`
+func parseDBML(content []byte) ([]annotation, error) {
+	var annotations []annotation
+	table := ""
+	depth := 0
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = stripDBMLComment(line)
+
+		if depth == 0 {
+			if match := dbmlTablePattern.FindStringSubmatch(line); match != nil {
+				table = unquoteIdentifier(match[1])
+			}
+		} else if depth == 1 && table != "" {
+			if match := dbmlColumnPattern.FindStringSubmatch(line); match != nil {
+				if note := dbmlNotePattern.FindStringSubmatch(match[2]); note != nil {
+					if function, ok := parsePIITag(note[1] + note[2] + note[3]); ok {
+						annotations = append(annotations, annotation{
+							table:    table,
+							column:   unquoteIdentifier(match[1]),
+							function: function,
+						})
+					}
+				}
+			}
+		}
+
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if depth < 0 {
+			return nil, fmt.Errorf("invalid DBML: unbalanced braces")
+		}
+		if depth == 0 {
+			table = ""
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("invalid DBML: unbalanced braces")
+	}
+	return annotations, nil
+}
+
+// stripDBMLComment removes a trailing // comment outside of quotes
+func stripDBMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '/' && strings.HasPrefix(line[i:], "//"):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// SQL
+
+var sqlCommentPattern = regexp.MustCompile(`(?is)comment\s+on\s+column\s+((?:"[^"]+"|\w+)(?:\s*\.\s*(?:"[^"]+"|\w+)){1,2})\s+is\s+'((?:[^']|'')*)'`)
+
+// parseSQLComments reads PII annotations from COMMENT ON COLUMN statements (e.g. from pg_dump --schema-only)
+func parseSQLComments(content []byte) []annotation {
+	var annotations []annotation
+	for _, match := range sqlCommentPattern.FindAllStringSubmatch(string(content), -1) {
+		function, ok := parsePIITag(strings.ReplaceAll(match[2], "''", "'"))
+		if !ok {
+			continue
+		}
+
+		parts := strings.Split(match[1], ".")
+		for i := range parts {
+			parts[i] = unquoteIdentifier(strings.TrimSpace(parts[i]))
+		}
+		annotations = append(annotations, annotation{
+			table:    strings.Join(parts[:len(parts)-1], "."),
+			column:   parts[len(parts)-1],
+			function: function,
+		})
+	}
+	return annotations
+}
+
+// unquoteIdentifier removes double quotes from a possibly schema-qualified identifier
+func unquoteIdentifier(name string) string {
+	return strings.ReplaceAll(name, `"`, "")
+}
@@ -0,0 +1,184 @@
+package anonymize
+
+import (
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestImport_DBT(t *testing.T) {
+	schemaYAML := `
+version: 2
+models:
+  - name: users
+    columns:
+      - name: id
+      - name: email
+        meta:
+          pii: true
+      - name: full_name
+        tags: [pii]
+      - name: ssn
+        meta:
+          anonymize:
+            function: mask
+            keep_last: 2
+      - name: notes
+        meta:
+          pii: false
+sources:
+  - name: app
+    schema: audit
+    tables:
+      - name: events
+        columns:
+          - name: ip
+            meta:
+              pii: md5
+`
+
+	result, err := Import(ImportFormatDBT, []byte(schemaYAML))
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	want := []models.AnonRule{
+		{Table: "users", Column: "email", ColumnType: "text", Function: FunctionFakeEmail},
+		{Table: "users", Column: "full_name", ColumnType: "text", Function: FunctionFakeName},
+		{Table: "users", Column: "ssn", ColumnType: "text", Function: FunctionMask, FunctionOptions: models.AnonFunctionOptions{KeepLast: 2}},
+	}
+	assertRules(t, result.Rules, want)
+
+	if len(result.Skipped) != 1 || result.Skipped[0].Table != "audit.events" {
+		t.Errorf("Skipped = %+v, want the non-public audit.events.ip", result.Skipped)
+	}
+}
+
+func TestImport_DBTManifest(t *testing.T) {
+	manifest := `{
+  "nodes": {
+    "model.shop.customers": {
+      "resource_type": "model",
+      "name": "customers",
+      "schema": "public",
+      "columns": {"phone": {"name": "phone", "meta": {"pii": true}}}
+    },
+    "test.shop.not_null": {"resource_type": "test", "name": "not_null", "columns": {"x": {"meta": {"pii": true}}}}
+  },
+  "sources": {
+    "source.shop.app.orders": {
+      "name": "orders",
+      "schema": "public",
+      "columns": {"address": {"tags": ["pii"]}}
+    }
+  }
+}`
+
+	result, err := Import(ImportFormatDBT, []byte(manifest))
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	assertRules(t, result.Rules, []models.AnonRule{
+		{Table: "orders", Column: "address", ColumnType: "text", Function: FunctionFakeAddress},
+		{Table: "customers", Column: "phone", ColumnType: "text", Function: FunctionMask},
+	})
+}
+
+func TestImport_DBML(t *testing.T) {
+	dbml := `
+Table users {
+  id integer [pk]
+  email varchar [not null, note: 'pii: fake_email'] // contact address
+  nickname varchar [note: "PII"]
+  deleted_reason text [note: 'pii: null']
+  bio text [note: 'public profile']
+
+  indexes {
+    email [unique, note: 'pii']
+  }
+}
+
+Table "public"."accounts" {
+  iban varchar [note: '''pii''']
+}
+`
+
+	result, err := Import(ImportFormatDBML, []byte(dbml))
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	assertRules(t, result.Rules, []models.AnonRule{
+		{Table: "users", Column: "email", ColumnType: "text", Function: FunctionFakeEmail},
+		{Table: "users", Column: "nickname", ColumnType: "text", Function: FunctionFakeName},
+		{Table: "users", Column: "deleted_reason", ColumnType: "null"},
+		{Table: "accounts", Column: "iban", ColumnType: "text", Function: FunctionMask},
+	})
+
+	if _, err := Import(ImportFormatDBML, []byte("Table users {\n  id int\n")); err == nil {
+		t.Error("Import() with unbalanced braces should fail")
+	}
+}
+
+func TestImport_SQL(t *testing.T) {
+	sql := `
+COMMENT ON COLUMN public.users.email IS 'Contact email (PII)';
+COMMENT ON COLUMN users.token IS 'pii: sha256';
+comment on column "Orders"."card_number" is 'PII: mask';
+COMMENT ON COLUMN users.bio IS 'it''s not sensitive';
+COMMENT ON COLUMN users.legacy IS 'pii: rot13';
+COMMENT ON COLUMN billing.invoices.address IS 'pii';
+COMMENT ON TABLE users IS 'pii';
+`
+
+	result, err := Import(ImportFormatSQL, []byte(sql))
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	assertRules(t, result.Rules, []models.AnonRule{
+		{Table: "users", Column: "email", ColumnType: "text", Function: FunctionFakeEmail},
+		{Table: "users", Column: "token", ColumnType: "text", Function: FunctionSHA256},
+		{Table: "Orders", Column: "card_number", ColumnType: "text", Function: FunctionMask},
+	})
+
+	if len(result.Skipped) != 2 {
+		t.Errorf("Skipped = %+v, want the unknown function and the non-public table", result.Skipped)
+	}
+}
+
+func TestImport_InvalidFormat(t *testing.T) {
+	if _, err := Import("erd", nil); err == nil {
+		t.Error("Import() with unknown format should fail")
+	}
+}
+
+func TestGuessFunction(t *testing.T) {
+	tests := map[string]string{
+		"email":          FunctionFakeEmail,
+		"billing_street": FunctionFakeAddress,
+		"LastName":       FunctionFakeName,
+		"phone_number":   FunctionMask,
+		"date_of_birth":  FunctionMD5,
+	}
+	for column, want := range tests {
+		if got := GuessFunction(column); got != want {
+			t.Errorf("GuessFunction(%q) = %q, want %q", column, got, want)
+		}
+	}
+}
+
+func assertRules(t *testing.T, got, want []models.AnonRule) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d rules %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i].Table != want[i].Table || got[i].Column != want[i].Column ||
+			got[i].ColumnType != want[i].ColumnType || got[i].Function != want[i].Function ||
+			got[i].FunctionOptions.KeepLast != want[i].FunctionOptions.KeepLast {
+			t.Errorf("rule %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
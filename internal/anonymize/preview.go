@@ -0,0 +1,240 @@
+package anonymize
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+const (
+	// DefaultPreviewSampleSize is the number of sample rows returned per table
+	DefaultPreviewSampleSize = 10
+	// MaxPreviewSampleSize caps the number of sample rows returned per table
+	MaxPreviewSampleSize = 100
+
+	// previewStatementTimeout bounds how long the trial UPDATE may run per table
+	previewStatementTimeout = "60s"
+)
+
+// PreviewParams contains parameters for previewing anonymization rules
+type PreviewParams struct {
+	ApplyParams
+	SampleSize int // Sample rows per table (defaults to DefaultPreviewSampleSize)
+}
+
+// PreviewResult contains the outcome of a dry run for each table
+type PreviewResult struct {
+	Tables []TablePreview `json:"tables"`
+}
+
+// TablePreview describes what the rules would do to a single table
+type TablePreview struct {
+	Table       string          `json:"table"`
+	OrderedBy   string          `json:"ordered_by"`   // Primary key column or "ctid"
+	TotalRows   int64           `json:"total_rows"`   // Rows in the table
+	RowsUpdated int64           `json:"rows_updated"` // Rows the UPDATE changed
+	RowsSkipped int64           `json:"rows_skipped"` // Rows left untouched (already matching target values)
+	Columns     []ColumnPreview `json:"columns"`
+	Error       string          `json:"error,omitempty"` // Set when the generated SQL failed for this table
+}
+
+// ColumnPreview contains before/after samples for a single column
+type ColumnPreview struct {
+	Column   string        `json:"column"`
+	JSONPath string        `json:"json_path,omitempty"` // Field of a JSON column replaced by the rule
+	Samples  []SampleValue `json:"samples"`
+}
+
+// SampleValue is a single before/after pair (nil means SQL NULL)
+type SampleValue struct {
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
+
+// Preview runs the generated anonymization SQL inside transactions that are always
+// rolled back, and returns before/after samples and row counts per table
+func Preview(ctx context.Context, rules []models.AnonRule, params PreviewParams, logger zerolog.Logger) (*PreviewResult, error) {
+	result := &PreviewResult{Tables: []TablePreview{}}
+	if len(rules) == 0 {
+		return result, nil
+	}
+
+	sampleSize := params.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = DefaultPreviewSampleSize
+	}
+	if sampleSize > MaxPreviewSampleSize {
+		sampleSize = MaxPreviewSampleSize
+	}
+
+	logger.Info().
+		Str("database_name", params.DatabaseName).
+		Int("rule_count", len(rules)).
+		Int("sample_size", sampleSize).
+		Msg("Previewing anonymization rules")
+
+	client, err := pgclient.OpenLocal(ctx, params.PostgresPort, params.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	tables := uniqueTables(rules)
+	primaryKeys := queryPrimaryKeys(ctx, client, tables, logger)
+
+	tableRules := make(map[string][]models.AnonRule)
+	for _, rule := range rules {
+		tableRules[rule.Table] = append(tableRules[rule.Table], rule)
+	}
+
+	// Run each table separately so one failing rule doesn't hide results for others
+	for _, table := range tables {
+		preview := previewTable(ctx, client, table, tableRules[table], primaryKeys[table], sampleSize)
+		if preview.Error != "" {
+			logger.Warn().
+				Str("table", table).
+				Str("error", preview.Error).
+				Msg("Anonymization preview failed for table")
+		}
+		result.Tables = append(result.Tables, preview)
+	}
+
+	return result, nil
+}
+
+// previewTable runs the sample query and the rolled back UPDATE for one table
+func previewTable(ctx context.Context, client *pgclient.Client, table string, rules []models.AnonRule, pkColumn string, sampleSize int) TablePreview {
+	preview := TablePreview{
+		Table:     table,
+		OrderedBy: "ctid",
+		Columns:   make([]ColumnPreview, len(rules)),
+	}
+	if pkColumn != "" {
+		preview.OrderedBy = pkColumn
+	}
+	for i, rule := range rules {
+		preview.Columns[i] = ColumnPreview{Column: rule.Column, JSONPath: rule.JSONPath, Samples: []SampleValue{}}
+	}
+
+	if err := sampleTable(ctx, client, table, rules, pkColumn, sampleSize, &preview); err != nil {
+		preview.Error = previewErrorMessage(err)
+		return preview
+	}
+	if err := countUpdatedRows(ctx, client, table, rules, pkColumn, &preview); err != nil {
+		preview.Error = previewErrorMessage(err)
+	}
+	return preview
+}
+
+// sampleTable adds rows with their current and computed values to the preview
+func sampleTable(ctx context.Context, client *pgclient.Client, table string, rules []models.AnonRule, pkColumn string, sampleSize int, preview *TablePreview) error {
+	rows, err := client.Query(ctx, generatePreviewSampleSQL(table, rules, pkColumn, sampleSize))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sample string
+		if err := rows.Scan(&sample); err != nil {
+			return err
+		}
+		if err := parsePreviewSample(sample, rules, preview); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// countUpdatedRows runs the real UPDATE in a transaction that is always rolled back
+func countUpdatedRows(ctx context.Context, client *pgclient.Client, table string, rules []models.AnonRule, pkColumn string, preview *TablePreview) error {
+	tx, err := client.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = '%s'", previewStatementTimeout)); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, generateTableUpdateSQL(table, rules, pkColumn))
+	if err != nil {
+		return err
+	}
+	if preview.RowsUpdated, err = result.RowsAffected(); err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM "+pgclient.QuoteIdentifier(table)).Scan(&preview.TotalRows); err != nil {
+		return err
+	}
+	preview.RowsSkipped = preview.TotalRows - preview.RowsUpdated
+	return nil
+}
+
+// generatePreviewSampleSQL builds the query sampling rows with their current and computed values,
+// numbered like the real UPDATE numbers them. Each row is a JSON array of [before, after] pairs
+func generatePreviewSampleSQL(table string, rules []models.AnonRule, pkColumn string, sampleSize int) string {
+	orderBy := "ctid"
+	if pkColumn != "" {
+		orderBy = pgclient.QuoteIdentifier(pkColumn)
+	}
+	tableQuoted := pgclient.QuoteIdentifier(table)
+
+	var columnPairs []string
+	for _, rule := range rules {
+		columnPairs = append(columnPairs, fmt.Sprintf("json_build_array(%s, (%s)::text)",
+			ruleSource(table, rule), renderRuleValue(table, rule)))
+	}
+
+	return fmt.Sprintf(`WITH numbered_rows AS (
+  SELECT ctid, row_number() OVER (ORDER BY %s) as _row_num
+  FROM %s
+)
+SELECT json_build_array(%s)::text
+FROM %s
+JOIN numbered_rows ON %s.ctid = numbered_rows.ctid
+ORDER BY numbered_rows._row_num
+LIMIT %d`,
+		orderBy,
+		tableQuoted,
+		strings.Join(columnPairs, ", "),
+		tableQuoted,
+		tableQuoted,
+		sampleSize,
+	)
+}
+
+// parsePreviewSample adds a sampled row (see generatePreviewSampleSQL) to the column samples
+func parsePreviewSample(sample string, rules []models.AnonRule, preview *TablePreview) error {
+	var pairs [][2]*string
+	if err := json.Unmarshal([]byte(sample), &pairs); err != nil {
+		return fmt.Errorf("failed to parse preview sample: %w", err)
+	}
+	for i := range pairs {
+		if i >= len(rules) {
+			break
+		}
+		preview.Columns[i].Samples = append(preview.Columns[i].Samples, SampleValue{
+			Before: pairs[i][0],
+			After:  pairs[i][1],
+		})
+	}
+	return nil
+}
+
+// previewErrorMessage returns the PostgreSQL error without the driver's prefix
+func previewErrorMessage(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return "ERROR: " + pqErr.Message
+	}
+	return err.Error()
+}
@@ -0,0 +1,334 @@
+package anonymize
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+const (
+	// DefaultScanSampleSize is the number of rows sampled per table by Scan
+	DefaultScanSampleSize = 100
+	// MaxScanSampleSize caps the number of rows sampled per table
+	MaxScanSampleSize = 1000
+
+	// scanStatementTimeout bounds how long sampling a table may take
+	scanStatementTimeout = "30s"
+)
+
+// Kinds of PII detected by Scan (ScanSuggestion.Kind)
+const (
+	PIIKindEmail      = "email"
+	PIIKindPhone      = "phone"
+	PIIKindSSN        = "ssn"
+	PIIKindCreditCard = "credit_card"
+	PIIKindName       = "name"
+	PIIKindAddress    = "address"
+)
+
+// Suggestion confidence (ScanSuggestion.Confidence)
+const (
+	ConfidenceHigh   = "high"   // Most sampled values look like the kind of PII
+	ConfidenceMedium = "medium" // Only the column name suggests PII (e.g. an empty table)
+)
+
+// ScanParams contains parameters for scanning a database for PII
+type ScanParams struct {
+	ApplyParams
+	SampleSize int // Rows sampled per table (defaults to DefaultScanSampleSize)
+}
+
+// ScanResult lists the columns that look like PII and aren't anonymized yet
+type ScanResult struct {
+	TablesScanned  int              `json:"tables_scanned"`
+	ColumnsScanned int              `json:"columns_scanned"`
+	Suggestions    []ScanSuggestion `json:"suggestions"`
+}
+
+// ScanSuggestion is a column that looks like PII, with a rule anonymizing it
+// Sampled values are never returned, only how many of them matched
+type ScanSuggestion struct {
+	Table         string          `json:"table"`
+	Column        string          `json:"column"`
+	DataType      string          `json:"data_type"`
+	Kind          string          `json:"kind"`       // PIIKind*
+	Confidence    string          `json:"confidence"` // ConfidenceHigh or ConfidenceMedium
+	SampledValues int             `json:"sampled_values"`
+	MatchedValues int             `json:"matched_values"`
+	Rule          models.AnonRule `json:"rule"` // Ready to be saved as is
+}
+
+// piiKind detects one kind of PII from column names and values
+type piiKind struct {
+	kind     string
+	function string
+	name     *regexp.Regexp    // Column names suggesting the kind
+	value    func(string) bool // nil when values can't be recognized (e.g. names)
+	// Values are only trusted in columns named like the kind (e.g. any 7+ digit string looks like a phone number)
+	needsName bool
+}
+
+var (
+	emailValuePattern = regexp.MustCompile(`(?i)^[^@\s]+@[^@\s]+\.[a-z]{2,}$`)
+	phoneValuePattern = regexp.MustCompile(`^\+?[0-9][0-9 ().-]{5,18}[0-9]$`)
+	ssnValuePattern   = regexp.MustCompile(`^[0-9]{3}-[0-9]{2}-[0-9]{4}$`)
+	cardValuePattern  = regexp.MustCompile(`^[0-9]{4}([ -]?[0-9]{4}){2}[ -]?[0-9]{1,7}$`)
+)
+
+// piiKinds are checked in order, the first kind matching a column wins
+var piiKinds = []piiKind{
+	{kind: PIIKindEmail, function: FunctionFakeEmail, name: regexp.MustCompile(`(?i)e_?mail`), value: emailValuePattern.MatchString},
+	{kind: PIIKindSSN, function: FunctionMask, name: regexp.MustCompile(`(?i)(^|_)ssn($|_)|social_?security`), value: ssnValuePattern.MatchString},
+	{kind: PIIKindCreditCard, function: FunctionMask, name: regexp.MustCompile(`(?i)(credit_?)?card_?(number|num|no)|(^|_)(cc|pan)(_?num(ber)?)?$`), value: isCardNumber},
+	{kind: PIIKindPhone, function: FunctionMask, name: regexp.MustCompile(`(?i)phone|mobile|(^|_)(tel|fax|msisdn)($|_)`), value: isPhoneNumber, needsName: true},
+	{kind: PIIKindName, function: FunctionFakeName, name: regexp.MustCompile(`(?i)^((first|last|middle|full|given|family|sur|maiden|display|contact|customer|user)_?)name$`)},
+	{kind: PIIKindAddress, function: FunctionFakeAddress, name: regexp.MustCompile(`(?i)^(street|billing|shipping|home|mailing|postal)?_?address(_?line)?_?[0-9]?$|^street`)},
+}
+
+// scanColumnsQuery lists the text columns of the public tables
+// Only text columns are scanned: the suggested functions produce text
+const scanColumnsQuery = `
+SELECT c.table_name, c.column_name, c.data_type
+FROM information_schema.columns c
+JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+WHERE c.table_schema = 'public'
+  AND t.table_type = 'BASE TABLE'
+  AND (c.data_type IN ('text', 'character varying', 'character') OR c.udt_name = 'citext')
+ORDER BY c.table_name, c.ordinal_position`
+
+// Scan samples the text columns of a database and suggests rules for those that look like PII
+// Columns that already have a rule in existing are skipped
+func Scan(ctx context.Context, existing []models.AnonRule, params ScanParams, logger zerolog.Logger) (*ScanResult, error) {
+	sampleSize := params.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = DefaultScanSampleSize
+	}
+	if sampleSize > MaxScanSampleSize {
+		sampleSize = MaxScanSampleSize
+	}
+
+	client, err := pgclient.OpenLocal(ctx, params.PostgresPort, params.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	tables, err := queryScanColumns(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	covered := make(map[string]bool)
+	for _, rule := range existing {
+		covered[rule.Table+"."+rule.Column] = true
+	}
+
+	result := &ScanResult{Suggestions: []ScanSuggestion{}}
+	for _, table := range slices.Sorted(maps.Keys(tables)) {
+		var columns []scanColumn
+		for _, column := range tables[table] {
+			if !covered[table+"."+column.name] {
+				columns = append(columns, column)
+			}
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		samples, err := sampleColumns(ctx, client, table, columns, sampleSize)
+		if err != nil {
+			// A table we can't read shouldn't hide the others
+			logger.Warn().Err(err).Str("table", table).Msg("Failed to sample table for PII scan")
+			continue
+		}
+
+		result.TablesScanned++
+		result.ColumnsScanned += len(columns)
+		for i, column := range columns {
+			if suggestion, ok := detectPII(table, column, samples[i]); ok {
+				result.Suggestions = append(result.Suggestions, suggestion)
+			}
+		}
+	}
+
+	logger.Info().
+		Str("database_name", params.DatabaseName).
+		Int("tables_scanned", result.TablesScanned).
+		Int("suggestions", len(result.Suggestions)).
+		Msg("PII scan completed")
+
+	return result, nil
+}
+
+// scanColumn is a text column of a scanned table
+type scanColumn struct {
+	name     string
+	dataType string
+}
+
+// queryScanColumns returns the text columns of each public table
+func queryScanColumns(ctx context.Context, client *pgclient.Client) (map[string][]scanColumn, error) {
+	rows, err := client.Query(ctx, scanColumnsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns: %w", err)
+	}
+	defer rows.Close()
+
+	tables := make(map[string][]scanColumn)
+	for rows.Next() {
+		var table string
+		var column scanColumn
+		if err := rows.Scan(&table, &column.name, &column.dataType); err != nil {
+			return nil, fmt.Errorf("failed to query columns: %w", err)
+		}
+		tables[table] = append(tables[table], column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query columns: %w", err)
+	}
+	return tables, nil
+}
+
+// sampleColumns returns up to sampleSize non-NULL values of each column
+func sampleColumns(ctx context.Context, client *pgclient.Client, table string, columns []scanColumn, sampleSize int) ([][]string, error) {
+	tx, err := client.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = '%s'", scanStatementTimeout)); err != nil {
+		return nil, err
+	}
+
+	selects := make([]string, len(columns))
+	for i, column := range columns {
+		selects[i] = pgclient.QuoteIdentifier(column.name) + "::text"
+	}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s LIMIT %d",
+		strings.Join(selects, ", "), pgclient.QuoteIdentifier(table), sampleSize))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([][]string, len(columns))
+	values := make([]*string, len(columns))
+	targets := make([]any, len(columns))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			if value != nil && strings.TrimSpace(*value) != "" {
+				samples[i] = append(samples[i], strings.TrimSpace(*value))
+			}
+		}
+	}
+	return samples, rows.Err()
+}
+
+// detectPII checks a column's name and sampled values against the PII kinds
+// Values decide when the kind can recognize them: a column named "email" holding ids isn't suggested,
+// a "contact" column holding email addresses is. Without samples the name decides
+func detectPII(table string, column scanColumn, samples []string) (ScanSuggestion, bool) {
+	for _, kind := range piiKinds {
+		nameMatches := kind.name.MatchString(column.name)
+		matched := 0
+		if kind.value != nil {
+			for _, value := range samples {
+				if kind.value(value) {
+					matched++
+				}
+			}
+		}
+
+		confidence := ""
+		switch {
+		case kind.value != nil && len(samples) > 0 && matched*2 >= len(samples) && (nameMatches || !kind.needsName):
+			confidence = ConfidenceHigh
+		case nameMatches && (kind.value == nil || len(samples) == 0):
+			confidence = ConfidenceMedium
+		}
+		if confidence == "" {
+			continue
+		}
+
+		return ScanSuggestion{
+			Table:         table,
+			Column:        column.name,
+			DataType:      column.dataType,
+			Kind:          kind.kind,
+			Confidence:    confidence,
+			SampledValues: len(samples),
+			MatchedValues: matched,
+			Rule: models.AnonRule{
+				Table:      table,
+				Column:     column.name,
+				ColumnType: "text",
+				Function:   kind.function,
+			},
+		}, true
+	}
+	return ScanSuggestion{}, false
+}
+
+// isPhoneNumber accepts phone-like values with 7 to 15 digits (E.164)
+func isPhoneNumber(value string) bool {
+	if !phoneValuePattern.MatchString(value) {
+		return false
+	}
+	digits := countDigits(value)
+	return digits >= 7 && digits <= 15
+}
+
+// isCardNumber accepts 13 to 19 digit numbers passing the Luhn check
+func isCardNumber(value string) bool {
+	if !cardValuePattern.MatchString(value) {
+		return false
+	}
+	digits := countDigits(value)
+	if digits < 13 || digits > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(value) - 1; i >= 0; i-- {
+		c := value[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func countDigits(value string) int {
+	digits := 0
+	for _, c := range value {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	return digits
+}
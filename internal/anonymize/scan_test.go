@@ -0,0 +1,43 @@
+package anonymize
+
+import "testing"
+
+func TestDetectPII(t *testing.T) {
+	tests := []struct {
+		name           string
+		column         string
+		samples        []string
+		wantKind       string
+		wantConfidence string
+	}{
+		{name: "email values", column: "contact", samples: []string{"a@example.com", "b@example.org", "unknown"}, wantKind: PIIKindEmail, wantConfidence: ConfidenceHigh},
+		{name: "email name without rows", column: "email", wantKind: PIIKindEmail, wantConfidence: ConfidenceMedium},
+		{name: "email name with other values", column: "email", samples: []string{"8f14e45f", "c9f0f895"}},
+		{name: "ssn values", column: "tax_id", samples: []string{"123-45-6789", "987-65-4321"}, wantKind: PIIKindSSN, wantConfidence: ConfidenceHigh},
+		{name: "card values", column: "payment", samples: []string{"4111 1111 1111 1111", "5500-0000-0000-0004"}, wantKind: PIIKindCreditCard, wantConfidence: ConfidenceHigh},
+		{name: "numbers failing luhn", column: "payment", samples: []string{"4111111111111112", "1234567812345678"}},
+		{name: "phone values", column: "mobile_number", samples: []string{"+1 (555) 010-2030", "555.010.4050"}, wantKind: PIIKindPhone, wantConfidence: ConfidenceHigh},
+		{name: "phone-like values in other columns", column: "order_number", samples: []string{"5550102030", "5550104050"}},
+		{name: "name", column: "first_name", samples: []string{"Ada"}, wantKind: PIIKindName, wantConfidence: ConfidenceMedium},
+		{name: "address", column: "billing_address", samples: []string{"1 Main St"}, wantKind: PIIKindAddress, wantConfidence: ConfidenceMedium},
+		{name: "ip address", column: "ip_address", samples: []string{"10.0.0.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := detectPII("users", scanColumn{name: tt.column, dataType: "text"}, tt.samples)
+			if tt.wantKind == "" {
+				if ok {
+					t.Errorf("detectPII() = %+v, want no suggestion", got)
+				}
+				return
+			}
+			if !ok || got.Kind != tt.wantKind || got.Confidence != tt.wantConfidence {
+				t.Fatalf("detectPII() = %+v, %v, want %s (%s)", got, ok, tt.wantKind, tt.wantConfidence)
+			}
+			if got.Rule.Table != "users" || got.Rule.Column != tt.column || ValidateFunction(got.Rule.Function, got.Rule.FunctionOptions) != nil {
+				t.Errorf("detectPII() rule = %+v, want a valid rule for the column", got.Rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package anonymize
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+// ColumnTypes lists the value types a rule can produce (AnonRule.ColumnType)
+var ColumnTypes = []string{"text", "integer", "boolean", "null", "date", "timestamp", "uuid"}
+
+// IsColumnType reports whether columnType is a supported rule value type
+func IsColumnType(columnType string) bool {
+	for _, t := range ColumnTypes {
+		if t == columnType {
+			return true
+		}
+	}
+	return false
+}
+
+// Placeholders of date and uuid templates, next to ${index}
+const (
+	placeholderNow  = "${now}"
+	placeholderUUID = "${uuid}"
+)
+
+// dateOffsetPattern matches one "+ 3 days" or "- ${index} months" term of a date template
+var dateOffsetPattern = regexp.MustCompile(`^\s*([+-])\s*(\d+|\$\{index\})\s*(second|minute|hour|day|week|month|year)s?\s*`)
+
+// dateLiteralLayouts are the accepted base dates of date and timestamp templates
+var dateLiteralLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05", time.RFC3339}
+
+// dateOffsetStart finds where the literal base date of a template ends
+var dateOffsetStart = regexp.MustCompile(`\s[+-]`)
+
+var uuidPattern = regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// dateTemplate is a parsed date or timestamp template: a base date shifted by offsets
+// e.g. "${now} - ${index} days" or "1990-01-01 + ${index} months"
+type dateTemplate struct {
+	base    string // placeholderNow or a literal in one of dateLiteralLayouts
+	offsets []dateOffset
+}
+
+type dateOffset struct {
+	sign   string // "+" or "-"
+	amount string // A number or "${index}"
+	unit   string // "day", "month", ...
+}
+
+// parseDateTemplate parses "<${now} or literal> [+|- <number or ${index}> <unit>]..."
+func parseDateTemplate(template string) (dateTemplate, error) {
+	rest := strings.TrimSpace(template)
+	var parsed dateTemplate
+
+	if strings.HasPrefix(rest, placeholderNow) {
+		parsed.base = placeholderNow
+		rest = rest[len(placeholderNow):]
+	} else {
+		// The literal ends where the first offset begins, dates contain "-" themselves
+		end := len(rest)
+		if match := dateOffsetStart.FindStringIndex(rest); match != nil {
+			end = match[0]
+		}
+		literal := rest[:end]
+		valid := false
+		for _, layout := range dateLiteralLayouts {
+			if _, err := time.Parse(layout, literal); err == nil {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return parsed, fmt.Errorf("date template must start with %s or a date like 1990-01-01, got %q", placeholderNow, template)
+		}
+		parsed.base = literal
+		rest = rest[end:]
+	}
+
+	for strings.TrimSpace(rest) != "" {
+		match := dateOffsetPattern.FindStringSubmatch(rest)
+		if match == nil {
+			return parsed, fmt.Errorf("invalid date offset %q, expected e.g. \"- ${index} days\" or \"+ 1 year\"", strings.TrimSpace(rest))
+		}
+		parsed.offsets = append(parsed.offsets, dateOffset{sign: match[1], amount: match[2], unit: match[3]})
+		rest = rest[len(match[0]):]
+	}
+	return parsed, nil
+}
+
+// ValidateTemplate checks a static template can be rendered for its column type
+// Text, integer and boolean templates are checked when the rule is parsed
+func ValidateTemplate(template, columnType string) error {
+	switch columnType {
+	case "date", "timestamp":
+		_, err := parseDateTemplate(template)
+		return err
+	case "uuid":
+		if template == placeholderUUID || strings.Contains(template, "${index}") || uuidPattern.MatchString(template) {
+			return nil
+		}
+		return fmt.Errorf("uuid template must be %s, contain ${index} or be a UUID, got %q", placeholderUUID, template)
+	}
+	return nil
+}
+
+// renderDateTemplate converts a date or timestamp template to an SQL expression
+// ${now} is the time of the anonymization run, so re-running it shifts the values
+func renderDateTemplate(template, columnType, indexExpr string) string {
+	parsed, err := parseDateTemplate(template)
+	if err != nil {
+		// Rejected by ValidateTemplate, leave the value to PostgreSQL to report
+		return pgclient.QuoteLiteral(template)
+	}
+
+	cast := "timestamptz"
+	if columnType == "date" {
+		cast = "date"
+	}
+
+	expr := pgclient.QuoteLiteral(parsed.base) + "::" + cast
+	if parsed.base == placeholderNow {
+		expr = "now()"
+		if columnType == "date" {
+			expr = "CURRENT_DATE"
+		}
+	}
+
+	for _, offset := range parsed.offsets {
+		if offset.amount == "${index}" {
+			expr += fmt.Sprintf(" %s %s * interval '1 %s'", offset.sign, indexExpr, offset.unit)
+		} else {
+			expr += fmt.Sprintf(" %s interval '%s %s'", offset.sign, offset.amount, offset.unit)
+		}
+	}
+
+	// date +/- interval gives a timestamp
+	return fmt.Sprintf("(%s)::%s", expr, cast)
+}
+
+// renderUUIDTemplate converts a uuid template to an SQL expression
+// ${uuid} generates a random UUID, a template with ${index} a UUID derived from the text it renders to,
+// so the same template and index always give the same UUID
+func renderUUIDTemplate(template, indexExpr string) string {
+	switch {
+	case template == placeholderUUID:
+		return "gen_random_uuid()"
+	case strings.Contains(template, "${index}"):
+		return fmt.Sprintf("md5(%s)::uuid", renderIndexedTemplate(template, "text", indexExpr))
+	default:
+		return pgclient.QuoteLiteral(template) + "::uuid"
+	}
+}
+
+// ValidateConsistent checks a consistent rule (AnonRule.Consistent) has row-number based values to derive from its value:
+// a template with ${index} or a fake_* function. Other functions already map equal values to equal outputs
+func ValidateConsistent(function, template string) error {
+	switch function {
+	case FunctionFakeName, FunctionFakeEmail, FunctionFakeAddress:
+		return nil
+	case "":
+		if strings.Contains(template, "${index}") {
+			return nil
+		}
+		return fmt.Errorf("consistent rules need a template with ${index}, a static template is the same for every row")
+	}
+	return fmt.Errorf("function '%s' always gives the same output for the same value, consistent is only needed for templates with ${index} and fake_* functions", function)
+}
+
+// ValidateJSONPath checks the path of a rule replacing a JSON field, e.g. "contact.email" or "phones.0"
+func ValidateJSONPath(path string) error {
+	if path == "" {
+		return nil
+	}
+	for _, element := range strings.Split(path, ".") {
+		if element == "" {
+			return fmt.Errorf("invalid json_path %q, expected field names separated by dots (e.g. contact.email)", path)
+		}
+	}
+	return nil
+}
+
+// jsonPathArray renders a JSON path as the text[] taken by #>> and jsonb_set
+func jsonPathArray(path string) string {
+	elements := strings.Split(path, ".")
+	for i, element := range elements {
+		elements[i] = pgclient.QuoteLiteral(element)
+	}
+	return "ARRAY[" + strings.Join(elements, ", ") + "]::text[]"
+}
+
+// jsonValueCasts types the value written to a JSON field, to_jsonb can't take untyped literals
+var jsonValueCasts = map[string]string{
+	"text":      "text",
+	"integer":   "bigint",
+	"boolean":   "boolean",
+	"date":      "date",
+	"timestamp": "timestamptz",
+	"uuid":      "uuid",
+}
+
+// renderJSONPathValue wraps target, the value of a jsonb column, to replace the field of rule.JSONPath
+// Rows where the field doesn't exist are left as is, a value computed as NULL becomes JSON null
+func renderJSONPathValue(table, target string, rule models.AnonRule) string {
+	value := "'null'::jsonb"
+	if rule.ColumnType != "null" {
+		cast, ok := jsonValueCasts[rule.ColumnType]
+		if !ok {
+			cast = "text"
+		}
+		value = fmt.Sprintf("COALESCE(to_jsonb((%s)::%s), 'null'::jsonb)", renderRuleValue(table, rule), cast)
+	}
+	return fmt.Sprintf("jsonb_set(%s, %s, %s, false)", target, jsonPathArray(rule.JSONPath), value)
+}
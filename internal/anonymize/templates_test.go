@@ -0,0 +1,161 @@
+package anonymize
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestRenderTemplate_Dates(t *testing.T) {
+	tests := []struct {
+		name       string
+		template   string
+		columnType string
+		want       string
+	}{
+		{
+			name:       "date before now by index",
+			template:   "${now}-${index} days",
+			columnType: "date",
+			want:       "(CURRENT_DATE - numbered_rows._row_num * interval '1 day')::date",
+		},
+		{
+			name:       "date literal with offsets",
+			template:   "1990-01-01 + ${index} months - 2 days",
+			columnType: "date",
+			want:       "('1990-01-01'::date + numbered_rows._row_num * interval '1 month' - interval '2 day')::date",
+		},
+		{
+			name:       "timestamp now",
+			template:   "${now}",
+			columnType: "timestamp",
+			want:       "(now())::timestamptz",
+		},
+		{
+			name:       "timestamp literal",
+			template:   "2020-06-01 12:00:00 - ${index} hours",
+			columnType: "timestamp",
+			want:       "('2020-06-01 12:00:00'::timestamptz - numbered_rows._row_num * interval '1 hour')::timestamptz",
+		},
+		{
+			name:       "random uuid",
+			template:   "${uuid}",
+			columnType: "uuid",
+			want:       "gen_random_uuid()",
+		},
+		{
+			name:       "uuid derived from index",
+			template:   "user-${index}",
+			columnType: "uuid",
+			want:       "md5('user-' || numbered_rows._row_num)::uuid",
+		},
+		{
+			name:       "uuid literal",
+			template:   "00000000-0000-0000-0000-000000000000",
+			columnType: "uuid",
+			want:       "'00000000-0000-0000-0000-000000000000'::uuid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateTemplate(tt.template, tt.columnType); err != nil {
+				t.Fatalf("ValidateTemplate() error = %v", err)
+			}
+			if got := renderTemplate(tt.template, tt.columnType); got != tt.want {
+				t.Errorf("renderTemplate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		template   string
+		columnType string
+	}{
+		{template: "yesterday", columnType: "date"},
+		{template: "1990-13-01", columnType: "date"},
+		{template: "${now} - ${index} fortnights", columnType: "date"},
+		{template: "${now} ${index} days", columnType: "timestamp"},
+		{template: "not-a-uuid", columnType: "uuid"},
+	}
+	for _, tt := range tests {
+		if err := ValidateTemplate(tt.template, tt.columnType); err == nil {
+			t.Errorf("ValidateTemplate(%q, %s) error = nil, want an error", tt.template, tt.columnType)
+		}
+	}
+
+	if err := ValidateJSONPath("contact..email"); err == nil {
+		t.Error("ValidateJSONPath() with an empty field error = nil")
+	}
+	if err := ValidateJSONPath("phones.0.number"); err != nil {
+		t.Errorf("ValidateJSONPath() error = %v", err)
+	}
+}
+
+// TestGenerateSQL_JSONPaths tests rules on fields of the same jsonb column are nested into one assignment
+func TestGenerateSQL_JSONPaths(t *testing.T) {
+	rules := []models.AnonRule{
+		{Table: "users", Column: "metadata", JSONPath: "contact.email", Function: FunctionMD5, ColumnType: "text"},
+		{Table: "users", Column: "email", Template: "user_${index}@example.com", ColumnType: "text"},
+		{Table: "users", Column: "metadata", JSONPath: "ssn", ColumnType: "null"},
+	}
+
+	got := GenerateSQL(rules, map[string]string{"users": "id"})
+	want := `"metadata" = jsonb_set(jsonb_set("users"."metadata", ARRAY['contact', 'email']::text[], ` +
+		`COALESCE(to_jsonb((md5('' || ("users"."metadata" #>> ARRAY['contact', 'email']::text[])))::text), 'null'::jsonb), false), ` +
+		`ARRAY['ssn']::text[], 'null'::jsonb, false)`
+	if !strings.Contains(got, want) {
+		t.Errorf("GenerateSQL() = %s\nwant assignment %s", got, want)
+	}
+	if strings.Count(got, `"metadata" =`) != 1 {
+		t.Errorf("GenerateSQL() assigns metadata more than once:\n%s", got)
+	}
+
+	if _, ok := DuplicateRule(rules); ok {
+		t.Error("DuplicateRule() reported fields of the same column as duplicates")
+	}
+	whole := models.AnonRule{Table: "users", Column: "metadata", ColumnType: "null"}
+	if duplicate, ok := DuplicateRule(append(rules, whole)); !ok || duplicate.JSONPath != "" {
+		t.Errorf("DuplicateRule() = %+v, %v, want the whole column rule conflicting with its fields", duplicate, ok)
+	}
+}
+
+// TestRuleIndex_Consistent tests consistent rules on different tables derive their values from the value alone
+func TestRuleIndex_Consistent(t *testing.T) {
+	users := models.AnonRule{Table: "users", Column: "email", Function: FunctionFakeEmail, ColumnType: "text", Consistent: true,
+		FunctionOptions: models.AnonFunctionOptions{Salt: "s3cret"}}
+	orders := models.AnonRule{Table: "orders", Column: "customer_email", Function: FunctionFakeEmail, ColumnType: "text", Consistent: true,
+		FunctionOptions: models.AnonFunctionOptions{Salt: "s3cret"}}
+
+	usersValue := renderRuleValue("users", users)
+	ordersValue := renderRuleValue("orders", orders)
+	if strings.Contains(usersValue, rowNumber) {
+		t.Errorf("consistent rule uses the row number: %s", usersValue)
+	}
+	wantIndex := `(('x' || substr(md5('s3cret' || "users"."email"::text), 1, 15))::bit(60)::bigint)`
+	if !strings.Contains(usersValue, wantIndex) {
+		t.Errorf("renderRuleValue() = %s, want index %s", usersValue, wantIndex)
+	}
+	if strings.ReplaceAll(ordersValue, `"orders"."customer_email"`, `"users"."email"`) != usersValue {
+		t.Errorf("consistent rules differ beyond their source column:\n%s\n%s", usersValue, ordersValue)
+	}
+
+	// Integer templates are cast to integer
+	id := models.AnonRule{Table: "users", Column: "legacy_id", Template: "${index}", ColumnType: "integer", Consistent: true}
+	if got := renderRuleValue("users", id); !strings.Contains(got, "% 2147483647)") {
+		t.Errorf("renderRuleValue() = %s, want the index kept in integer range", got)
+	}
+
+	if err := ValidateConsistent("", "user_${index}"); err != nil {
+		t.Errorf("ValidateConsistent() error = %v", err)
+	}
+	if err := ValidateConsistent("", "static"); err == nil {
+		t.Error("ValidateConsistent() with a static template error = nil")
+	}
+	if err := ValidateConsistent(FunctionMD5, ""); err == nil {
+		t.Error("ValidateConsistent() with md5 error = nil")
+	}
+}
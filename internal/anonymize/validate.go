@@ -0,0 +1,271 @@
+package anonymize
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+// Validation error codes
+const (
+	ValidationMissingTable  = "missing_table"
+	ValidationMissingColumn = "missing_column"
+	ValidationTypeMismatch  = "type_mismatch"
+	ValidationNotNullable   = "not_nullable"
+)
+
+// ValidationError describes a rule that does not match the database schema
+type ValidationError struct {
+	Index      int    `json:"index"` // Position of the rule in the validated list
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	ColumnType string `json:"column_type,omitempty"` // Actual column type in the database
+}
+
+// SchemaColumn describes a column as reported by information_schema
+type SchemaColumn struct {
+	DataType string // information_schema data_type (e.g. "integer", "character varying")
+	UDTName  string // Underlying type name (e.g. "int4", "citext")
+	Nullable bool
+}
+
+// Schema maps table name -> column name -> column info
+type Schema map[string]map[string]SchemaColumn
+
+// Validate checks rules against the schema of the database described by params
+// Returns one ValidationError per problem found (empty when all rules are valid)
+func Validate(ctx context.Context, rules []models.AnonRule, params ApplyParams, logger zerolog.Logger) ([]ValidationError, error) {
+	if len(rules) == 0 {
+		return []ValidationError{}, nil
+	}
+
+	schema, err := querySchema(ctx, params, uniqueTables(rules))
+	if err != nil {
+		return nil, err
+	}
+
+	validationErrors := ValidateSchema(rules, schema)
+
+	logger.Debug().
+		Str("database_name", params.DatabaseName).
+		Int("rule_count", len(rules)).
+		Int("error_count", len(validationErrors)).
+		Msg("Validated anonymization rules against schema")
+
+	return validationErrors, nil
+}
+
+// ValidateSchema checks rules against an already loaded schema
+func ValidateSchema(rules []models.AnonRule, schema Schema) []ValidationError {
+	validationErrors := []ValidationError{}
+
+	for i, rule := range rules {
+		columns, ok := schema[rule.Table]
+		if !ok {
+			validationErrors = append(validationErrors, ValidationError{
+				Index:   i,
+				Table:   rule.Table,
+				Column:  rule.Column,
+				Code:    ValidationMissingTable,
+				Message: fmt.Sprintf("table '%s' does not exist", rule.Table),
+			})
+			continue
+		}
+
+		column, ok := columns[rule.Column]
+		if !ok {
+			validationErrors = append(validationErrors, ValidationError{
+				Index:   i,
+				Table:   rule.Table,
+				Column:  rule.Column,
+				Code:    ValidationMissingColumn,
+				Message: fmt.Sprintf("column '%s' does not exist on table '%s'", rule.Column, rule.Table),
+			})
+			continue
+		}
+
+		if code, message := checkColumnType(rule, column); code != "" {
+			validationErrors = append(validationErrors, ValidationError{
+				Index:      i,
+				Table:      rule.Table,
+				Column:     rule.Column,
+				Code:       code,
+				Message:    message,
+				ColumnType: column.DataType,
+			})
+		}
+	}
+
+	return validationErrors
+}
+
+// Column type categories used for compatibility checks
+const (
+	categoryString  = "string"
+	categoryNumeric = "numeric"
+	categoryBoolean = "boolean"
+	categoryDate    = "date"
+	categoryUUID    = "uuid"
+	categoryJSONB   = "jsonb"
+	categoryOther   = "other"
+)
+
+// columnCategory groups PostgreSQL column types by what a rule value can be assigned to them
+func columnCategory(column SchemaColumn) string {
+	switch column.DataType {
+	case "text", "character varying", "character", "name":
+		return categoryString
+	case "smallint", "integer", "bigint", "numeric", "real", "double precision":
+		return categoryNumeric
+	case "boolean":
+		return categoryBoolean
+	case "date", "timestamp without time zone", "timestamp with time zone":
+		return categoryDate
+	case "uuid":
+		return categoryUUID
+	case "jsonb":
+		return categoryJSONB
+	case "USER-DEFINED":
+		if column.UDTName == "citext" {
+			return categoryString
+		}
+	}
+	return categoryOther
+}
+
+// checkColumnType reports whether the value produced by a rule can be assigned to the column
+// Returns an empty code when compatible
+func checkColumnType(rule models.AnonRule, column SchemaColumn) (code string, message string) {
+	category := columnCategory(column)
+
+	mismatch := func(valueType string) (string, string) {
+		return ValidationTypeMismatch, fmt.Sprintf("rule produces %s values but column '%s' is of type %s", valueType, rule.Column, column.DataType)
+	}
+
+	// A JSON field can hold any value, json columns can't be compared to skip unchanged rows
+	if rule.JSONPath != "" {
+		if category != categoryJSONB {
+			return ValidationTypeMismatch, fmt.Sprintf("rule replaces the JSON field '%s' but column '%s' is of type %s, not jsonb", rule.JSONPath, rule.Column, column.DataType)
+		}
+		return "", ""
+	}
+
+	// NULL fits any nullable column
+	if rule.ColumnType == "null" {
+		if !column.Nullable {
+			return ValidationNotNullable, fmt.Sprintf("column '%s' is NOT NULL and cannot be set to null", rule.Column)
+		}
+		return "", ""
+	}
+
+	// Dates and UUIDs are typed expressions, which PostgreSQL can't compare with a string column's values
+	switch rule.ColumnType {
+	case "date", "timestamp":
+		if category == categoryDate {
+			return "", ""
+		}
+		return mismatch(rule.ColumnType)
+	case "uuid":
+		if category == categoryUUID {
+			return "", ""
+		}
+		return mismatch("uuid")
+	}
+
+	// String columns accept any value (PostgreSQL casts to text on assignment)
+	if category == categoryString {
+		return "", ""
+	}
+
+	switch rule.ColumnType {
+	case "integer":
+		if category == categoryNumeric {
+			return "", ""
+		}
+		return mismatch("integer")
+
+	case "boolean":
+		if category == categoryBoolean {
+			return "", ""
+		}
+		return mismatch("boolean")
+
+	default:
+		// Functions and ${index} templates produce text expressions, which PostgreSQL
+		// does not implicitly cast to non-string types
+		if rule.Function != "" {
+			return mismatch(fmt.Sprintf("text (%s)", rule.Function))
+		}
+		if strings.Contains(rule.Template, "${index}") {
+			return mismatch("text")
+		}
+
+		// A static template is an untyped literal and is coerced by PostgreSQL,
+		// so only check what can be checked
+		switch category {
+		case categoryNumeric:
+			if _, err := strconv.ParseFloat(rule.Template, 64); err != nil {
+				return mismatch("text")
+			}
+		case categoryBoolean:
+			if _, err := strconv.ParseBool(rule.Template); err != nil {
+				return mismatch("text")
+			}
+		}
+		return "", ""
+	}
+}
+
+// schemaQuery lists the columns of the public tables in $1
+const schemaQuery = `
+SELECT table_name, column_name, data_type, udt_name, is_nullable
+FROM information_schema.columns
+WHERE table_schema = 'public'
+  AND table_name = ANY($1)
+ORDER BY table_name, ordinal_position`
+
+// querySchema loads column information for the given tables
+func querySchema(ctx context.Context, params ApplyParams, tables []string) (Schema, error) {
+	schema := Schema{}
+	if len(tables) == 0 {
+		return schema, nil
+	}
+
+	client, err := pgclient.OpenLocal(ctx, params.PostgresPort, params.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	rows, err := client.Query(ctx, schemaQuery, pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table, column, isNullable string
+		var schemaColumn SchemaColumn
+		if err := rows.Scan(&table, &column, &schemaColumn.DataType, &schemaColumn.UDTName, &isNullable); err != nil {
+			return nil, fmt.Errorf("failed to query schema: %w", err)
+		}
+		schemaColumn.Nullable = isNullable == "YES"
+		if schema[table] == nil {
+			schema[table] = make(map[string]SchemaColumn)
+		}
+		schema[table][column] = schemaColumn
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query schema: %w", err)
+	}
+	return schema, nil
+}
@@ -2,36 +2,73 @@ package auth
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret []byte
+// jwtSecret signs and validates tokens, requests read it while a rotated secret is loaded (see InitializeJWT)
+var (
+	jwtMu     sync.RWMutex
+	jwtSecret []byte
+)
 
 // JWTClaims represents the JWT token claims
 type JWTClaims struct {
 	UserID  string `json:"user_id"`
 	Email   string `json:"email"`
 	IsAdmin bool   `json:"is_admin"`
+
+	TwoFactor bool `json:"two_factor,omitempty"` // The user entered a TOTP code when the token was issued
+
 	jwt.RegisteredClaims
 }
 
 // InitializeJWT sets the JWT secret key
+// Called again with the stored secret on every authenticated request, so a rotation by another process
+// (decommissioning in the worker) applies right away
 func InitializeJWT(secret string) {
+	jwtMu.RLock()
+	unchanged := string(jwtSecret) == secret
+	jwtMu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	jwtMu.Lock()
 	jwtSecret = []byte(secret)
+	jwtMu.Unlock()
+}
+
+// currentSecret returns the JWT secret key
+func currentSecret() []byte {
+	jwtMu.RLock()
+	defer jwtMu.RUnlock()
+	return jwtSecret
 }
 
 // GenerateToken creates a new JWT token for a user
 func GenerateToken(userID, email string, isAdmin bool) (string, error) {
-	if len(jwtSecret) == 0 {
+	return generateToken(userID, email, isAdmin, false)
+}
+
+// GenerateTwoFactorToken creates a JWT token for a user who also entered a valid TOTP code
+func GenerateTwoFactorToken(userID, email string, isAdmin bool) (string, error) {
+	return generateToken(userID, email, isAdmin, true)
+}
+
+func generateToken(userID, email string, isAdmin, twoFactor bool) (string, error) {
+	secret := currentSecret()
+	if len(secret) == 0 {
 		return "", fmt.Errorf("JWT secret not initialized")
 	}
 
 	claims := JWTClaims{
-		UserID:  userID,
-		Email:   email,
-		IsAdmin: isAdmin,
+		UserID:    userID,
+		Email:     email,
+		IsAdmin:   isAdmin,
+		TwoFactor: twoFactor,
 		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -39,12 +76,13 @@ func GenerateToken(userID, email string, isAdmin bool) (string, error) {
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return token.SignedString(secret)
 }
 
 // ValidateToken validates a JWT token and returns the claims
 func ValidateToken(tokenString string) (*JWTClaims, error) {
-	if len(jwtSecret) == 0 {
+	secret := currentSecret()
+	if len(secret) == 0 {
 		return nil, fmt.Errorf("JWT secret not initialized")
 	}
 
@@ -53,7 +91,7 @@ func ValidateToken(tokenString string) (*JWTClaims, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return jwtSecret, nil
+		return secret, nil
 	})
 
 	if err != nil {
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcHTTPTimeout bounds each request to the identity provider
+const oidcHTTPTimeout = 10 * time.Second
+
+// OIDCConfig identifies the branchd client at an OpenID Connect provider (e.g. Okta)
+type OIDCConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // .../api/auth/oidc/callback, must be registered at the provider
+	GroupsScope  bool   // Also request the "groups" scope (Okta), needed for admin group mapping
+}
+
+// OIDCClaims are the ID token claims used to find or provision the user
+type OIDCClaims struct {
+	Email         string   `json:"email"`
+	EmailVerified *bool    `json:"email_verified"` // Must be true, an unverified address could be anyone's
+	Name          string   `json:"name"`
+	Groups        []string `json:"groups"` // Okta: add a "groups" claim to the ID token
+	Nonce         string   `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// OIDCProvider is a discovered OpenID Connect provider
+// Signing keys are fetched on first use and again when a token is signed with an unknown key (rotation)
+type OIDCProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey // By key ID
+}
+
+// DiscoverOIDC reads the provider's /.well-known/openid-configuration
+func DiscoverOIDC(ctx context.Context, issuerURL string) (*OIDCProvider, error) {
+	issuerURL = strings.TrimSuffix(issuerURL, "/")
+
+	var provider OIDCProvider
+	if err := getJSON(ctx, issuerURL+"/.well-known/openid-configuration", &provider); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	if provider.Issuer != issuerURL {
+		return nil, fmt.Errorf("OIDC provider issuer %q does not match %q", provider.Issuer, issuerURL)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC provider configuration is missing endpoints")
+	}
+	return &provider, nil
+}
+
+// AuthCodeURL returns the provider URL the user is redirected to for login
+func (p *OIDCProvider) AuthCodeURL(cfg OIDCConfig, state, nonce string) string {
+	scope := "openid email profile"
+	if cfg.GroupsScope {
+		scope += " groups"
+	}
+
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {cfg.ClientID},
+		"redirect_uri":  {cfg.RedirectURL},
+		"scope":         {scope},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// Exchange trades an authorization code for the user's verified ID token claims
+func (p *OIDCProvider) Exchange(ctx context.Context, cfg OIDCConfig, code, nonce string) (*OIDCClaims, error) {
+	ctx, cancel := context.WithTimeout(ctx, oidcHTTPTimeout)
+	defer cancel()
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {cfg.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client_secret_basic, the default authentication method of OIDC clients
+	req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to parse token response (status %d): %w", resp.StatusCode, err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s", strings.TrimSpace(token.Error+" "+token.ErrorDescription))
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return nil, fmt.Errorf("token request returned status %d without an ID token", resp.StatusCode)
+	}
+
+	return p.VerifyIDToken(ctx, cfg, token.IDToken, nonce)
+}
+
+// VerifyIDToken checks an ID token's signature, issuer, audience, expiry and nonce
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, cfg OIDCConfig, rawToken, nonce string) (*OIDCClaims, error) {
+	claims := &OIDCClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("invalid ID token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("ID token has no subject")
+	}
+	if claims.Email == "" {
+		return nil, fmt.Errorf("ID token has no email claim, request the email scope")
+	}
+	if claims.EmailVerified == nil || !*claims.EmailVerified {
+		return nil, fmt.Errorf("email %s is not verified by the identity provider", claims.Email)
+	}
+	return claims, nil
+}
+
+// signingKey returns the provider key with the given ID, refetching the key set once if it's unknown
+func (p *OIDCProvider) signingKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+
+	keys, err := fetchJWKS(ctx, p.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("signing key %q not found", kid)
+}
+
+// lookupKey finds a cached key, a token without kid matches the only key of a single-key set
+func (p *OIDCProvider) lookupKey(kid string) *rsa.PublicKey {
+	if key, ok := p.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+// fetchJWKS reads the RSA signing keys of a JSON Web Key Set
+func fetchJWKS(ctx context.Context, jwksURI string) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %q: %w", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// getJSON fetches and decodes a JSON document from the provider
+func getJSON(ctx context.Context, url string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, oidcHTTPTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifyIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	provider := &OIDCProvider{Issuer: "https://company.okta.com", keys: map[string]*rsa.PublicKey{"k1": &key.PublicKey}}
+	cfg := OIDCConfig{ClientID: "branchd"}
+
+	verified, unverified := true, false
+	sign := func(claims OIDCClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+	claims := func(emailVerified *bool) OIDCClaims {
+		return OIDCClaims{
+			Email:         "dev@example.com",
+			EmailVerified: emailVerified,
+			Nonce:         "nonce",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    provider.Issuer,
+				Subject:   "00u1",
+				Audience:  jwt.ClaimStrings{"branchd"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}
+	}
+
+	got, err := provider.VerifyIDToken(context.Background(), cfg, sign(claims(&verified)), "nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+	if got.Subject != "00u1" || got.Email != "dev@example.com" {
+		t.Errorf("VerifyIDToken() = %+v", got)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+		want  string
+	}{
+		{name: "unverified email", token: sign(claims(&unverified)), nonce: "nonce", want: "not verified"},
+		{name: "missing email_verified", token: sign(claims(nil)), nonce: "nonce", want: "not verified"},
+		{name: "nonce mismatch", token: sign(claims(&verified)), nonce: "other", want: "nonce mismatch"},
+		{name: "other audience", token: sign(func() OIDCClaims {
+			c := claims(&verified)
+			c.Audience = jwt.ClaimStrings{"other"}
+			return c
+		}()), nonce: "nonce", want: "invalid ID token"},
+		{name: "no subject", token: sign(func() OIDCClaims {
+			c := claims(&verified)
+			c.Subject = ""
+			return c
+		}()), nonce: "nonce", want: "no subject"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(context.Background(), cfg, tt.token, tt.nonce)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("VerifyIDToken() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
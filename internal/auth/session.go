@@ -1,9 +1,16 @@
 package auth
 
+import "time"
+
 // SessionData represents the authenticated session context for a request
 type SessionData struct {
 	UserID     string `json:"user_id"`
 	Email      string `json:"email"`
 	IsAdmin    bool   `json:"is_admin"`
 	AuthMethod string `json:"auth_method"` // "web", "cli"
+
+	TwoFactorEnabled bool `json:"two_factor_enabled"` // The user enrolled a TOTP authenticator
+	TwoFactor        bool `json:"two_factor"`         // The token was issued after a TOTP code was verified
+
+	TwoFactorDeadline *time.Time `json:"two_factor_deadline,omitempty"` // Until then admin routes don't require TwoFactor
 }
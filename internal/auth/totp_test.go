@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B vectors (SHA1), the last 6 of the 8 digits
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode(T=%d) = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current code", secret: secret, code: "050471", wantStep: step, wantOK: true},
+		{name: "spaces", secret: secret, code: " 050 471 ", wantStep: step, wantOK: true},
+		{name: "lowercase secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: "050471", wantStep: step, wantOK: true},
+		{name: "previous period", secret: secret, code: "081804", wantStep: step - 1, wantOK: true},
+		{name: "wrong code", secret: secret, code: "050472"},
+		{name: "too short", secret: secret, code: "05047"},
+		{name: "invalid secret", secret: "not base32!", code: "050471"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := ValidateTOTP(tt.secret, tt.code, now)
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() = (%d, %v), want (%d, %v)", gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+
+	// Codes two periods away are outside the allowed clock drift
+	if _, ok := ValidateTOTP(secret, "050471", now.Add(2*totpPeriod*time.Second)); ok {
+		t.Error("ValidateTOTP() accepted a code two periods old")
+	}
+}
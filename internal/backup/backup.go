@@ -0,0 +1,353 @@
+// Package backup snapshots branchd's own SQLite database, the only record of the restores and branches on the
+// ZFS datasets, to gzipped tar archives in a local directory and optionally an S3 bucket
+//
+// Restoring replaces the database with the one of an archive while branchd is stopped:
+//
+//	systemctl stop branchd-server branchd-worker
+//	branchd-server --restore-backup /data/backups/branchd-20250301T030000Z.tar.gz
+//	systemctl start branchd-server branchd-worker
+//
+// Datasets of restores and branches created after the backup aren't in the restored database, restores can be
+// adopted again (POST /api/restores/adopt)
+//
+// Archives aren't encrypted and the database holds every secret branchd stores: the JWT secret, source and
+// integration credentials and users' TOTP secrets (fleet agent tokens are sealed with FLEET_TOKEN_KEY, which isn't
+// archived). BACKUP_DIR is only readable by branchd and uploads ask S3 for server-side encryption
+// (BACKUP_S3_ENCRYPTION), access to the bucket must be restricted as much as access to the server
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// Files of an archive
+const (
+	DatabaseFile = "branchd.sqlite"
+	ConfigFile   = "config.json" // The server configuration the backup was taken with, without its own secrets (see redact)
+)
+
+// Archives are named branchd-<UTC time>.tar.gz, so they sort by age
+const (
+	archivePrefix = "branchd-"
+	archiveSuffix = ".tar.gz"
+	timeFormat    = "20060102T150405Z"
+)
+
+// sqliteHeader starts every SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// now returns the time archives are named after (replaced in tests)
+var now = time.Now
+
+// mu serializes backups of the process, scheduled ones may overlap with requested ones
+var mu sync.Mutex
+
+// Result describes a backup archive
+type Result struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	SizeBytes int64     `json:"size_bytes"`
+	S3URL     string    `json:"s3_url,omitempty"` // s3://bucket/key of the uploaded copy, empty without BACKUP_S3_BUCKET
+	Deleted   []string  `json:"deleted"`          // Older archives deleted past BACKUP_KEEP
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Run snapshots the database into a new archive in cfg.Backup.Dir, uploads it to S3 if configured and
+// deletes archives past cfg.Backup.Keep
+// The snapshot is taken with VACUUM INTO, a consistent copy while the server keeps writing
+func Run(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) (*Result, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	createdAt := now().UTC()
+	result := &Result{
+		Name:      archivePrefix + createdAt.Format(timeFormat) + archiveSuffix,
+		Deleted:   []string{},
+		CreatedAt: createdAt,
+	}
+	result.Path = filepath.Join(cfg.Backup.Dir, result.Name)
+
+	if err := os.MkdirAll(cfg.Backup.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// The snapshot is written next to the archive, VACUUM INTO refuses to overwrite a file
+	snapshot := result.Path + ".sqlite"
+	os.Remove(snapshot)
+	defer os.Remove(snapshot)
+	if err := db.WithContext(ctx).Exec("VACUUM INTO ?", snapshot).Error; err != nil {
+		return nil, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	size, err := writeArchive(result.Path, snapshot, cfg)
+	if err != nil {
+		os.Remove(result.Path)
+		return nil, err
+	}
+	result.SizeBytes = size
+
+	if cfg.Backup.S3Bucket != "" {
+		key := result.Name
+		if cfg.Backup.S3Prefix != "" {
+			key = cfg.Backup.S3Prefix + "/" + key
+		}
+		if err := uploadS3(ctx, cfg.Backup, key, result.Path); err != nil {
+			return nil, err
+		}
+		result.S3URL = fmt.Sprintf("s3://%s/%s", cfg.Backup.S3Bucket, key)
+	}
+
+	deleted, err := prune(cfg.Backup.Dir, cfg.Backup.Keep)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to delete old database backups")
+	}
+	result.Deleted = append(result.Deleted, deleted...)
+
+	logger.Info().
+		Str("path", result.Path).
+		Int64("size_bytes", result.SizeBytes).
+		Str("s3_url", result.S3URL).
+		Strs("deleted", result.Deleted).
+		Msg("Database backed up")
+	return result, nil
+}
+
+// writeArchive writes the snapshot and the configuration to a gzipped tar archive, returning its size
+func writeArchive(path, snapshot string, cfg *config.Config) (int64, error) {
+	configJSON, err := json.MarshalIndent(redact(*cfg), "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal configuration: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	archive := tar.NewWriter(gz)
+	if err := addFile(archive, DatabaseFile, snapshot); err != nil {
+		return 0, err
+	}
+	if err := archive.WriteHeader(&tar.Header{Name: ConfigFile, Mode: 0o600, Size: int64(len(configJSON)), ModTime: now()}); err != nil {
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := archive.Write(configJSON); err != nil {
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat archive: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// addFile copies a file into the archive
+func addFile(archive *tar.Writer, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", name, err)
+	}
+
+	if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := io.Copy(archive, file); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// redact clears the secrets of the configuration stored in archives
+func redact(cfg config.Config) config.Config {
+	cfg.Metrics.Token = ""
+	cfg.Backup.S3SecretAccessKey = ""
+	cfg.Backup.S3SessionToken = ""
+	cfg.Fleet.TokenKey = ""
+	return cfg
+}
+
+// prune deletes the oldest archives of dir past keep (0 = none), returning their names
+func prune(dir string, keep int) ([]string, error) {
+	if keep == 0 {
+		return nil, nil
+	}
+	names, err := archives(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) <= keep {
+		return nil, nil
+	}
+	return remove(dir, names[:len(names)-keep])
+}
+
+// DeleteAll deletes every archive of dir (see Run), returning their names
+// A decommission deletes them, they contain the credentials it revokes
+func DeleteAll(dir string) ([]string, error) {
+	names, err := archives(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return remove(dir, names)
+}
+
+// archives returns the names of the archives of dir, oldest first
+func archives(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), archivePrefix) && strings.HasSuffix(entry.Name(), archiveSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// remove deletes the named archives of dir, returning the names of those deleted
+func remove(dir string, names []string) ([]string, error) {
+	var deleted []string
+	var errs []error
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		deleted = append(deleted, name)
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// Restore replaces the database at databasePath with the one of an archive, run while branchd is stopped
+// The current database is kept as <databasePath>.<UTC time>.bak (with its WAL), its path is returned
+// (empty if there was none)
+func Restore(archivePath, databasePath string) (string, error) {
+	restored := databasePath + ".restoring"
+	if err := extractDatabase(archivePath, restored); err != nil {
+		os.Remove(restored)
+		return "", err
+	}
+
+	var kept string
+	if _, err := os.Stat(databasePath); err == nil {
+		kept = fmt.Sprintf("%s.%s.bak", databasePath, now().UTC().Format(timeFormat))
+		if err := os.Rename(databasePath, kept); err != nil {
+			os.Remove(restored)
+			return "", fmt.Errorf("failed to keep current database: %w", err)
+		}
+	}
+	// The WAL of the current database mustn't be applied to the restored one
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(databasePath + suffix); err != nil {
+			continue
+		}
+		var err error
+		if kept != "" {
+			err = os.Rename(databasePath+suffix, kept+suffix)
+		} else {
+			err = os.Remove(databasePath + suffix)
+		}
+		if err != nil {
+			os.Remove(restored)
+			return "", fmt.Errorf("failed to move %s%s aside: %w", databasePath, suffix, err)
+		}
+	}
+
+	if err := os.Rename(restored, databasePath); err != nil {
+		return "", fmt.Errorf("failed to move restored database into place: %w", err)
+	}
+	return kept, nil
+}
+
+// extractDatabase writes the database of an archive to path, checking it's an SQLite database
+func extractDatabase(archivePath, path string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	archive := tar.NewReader(gz)
+
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return fmt.Errorf("archive has no %s", DatabaseFile)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Name != DatabaseFile {
+			continue
+		}
+
+		out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create database: %w", err)
+		}
+		head := make([]byte, len(sqliteHeader))
+		n, _ := io.ReadFull(archive, head)
+		if !bytes.Equal(head[:n], sqliteHeader) {
+			out.Close()
+			return fmt.Errorf("%s of the archive isn't an SQLite database", DatabaseFile)
+		}
+		if _, err := out.Write(head); err != nil {
+			out.Close()
+			return fmt.Errorf("failed to write database: %w", err)
+		}
+		if _, err := io.Copy(out, archive); err != nil {
+			out.Close()
+			return fmt.Errorf("failed to write database: %w", err)
+		}
+		if err := out.Sync(); err != nil {
+			out.Close()
+			return fmt.Errorf("failed to write database: %w", err)
+		}
+		return out.Close()
+	}
+}
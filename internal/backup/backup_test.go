@@ -0,0 +1,229 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func openDB(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	return db
+}
+
+// readArchiveFile returns a file of an archive
+func readArchiveFile(t *testing.T, path, name string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err != nil {
+			t.Fatalf("%s not found in archive: %v", name, err)
+		}
+		if header.Name == name {
+			data, _ := io.ReadAll(archive)
+			return string(data)
+		}
+	}
+}
+
+// stubNow names archives after successive minutes from 2025-03-01 03:00 UTC
+func stubNow(t *testing.T) {
+	t.Helper()
+	original := now
+	t.Cleanup(func() { now = original })
+	at := time.Date(2025, 3, 1, 3, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		at = at.Add(time.Minute)
+		return at
+	}
+}
+
+func TestRunAndRestore(t *testing.T) {
+	stubNow(t)
+	dir := t.TempDir()
+	db := openDB(t, filepath.Join(dir, "branchd.sqlite"))
+	if err := db.Create(&models.Restore{Name: "restore_1", State: models.RestoreStateReady}).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	cfg := &config.Config{
+		Metrics: config.MetricsConfig{Token: "metrics-secret"},
+		Backup:  config.BackupConfig{Dir: filepath.Join(dir, "backups"), Keep: 2},
+		Fleet:   config.FleetConfig{TokenKey: "fleet-token-key"},
+	}
+
+	var results []*Result
+	for range 3 {
+		result, err := Run(context.Background(), db, cfg, zerolog.Nop())
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		results = append(results, result)
+	}
+	if results[0].Name != "branchd-20250301T030100Z.tar.gz" || results[0].SizeBytes == 0 {
+		t.Errorf("first backup = %+v", results[0])
+	}
+	if len(results[2].Deleted) != 1 || results[2].Deleted[0] != results[0].Name {
+		t.Errorf("deleted = %v, want the first backup deleted past keep 2", results[2].Deleted)
+	}
+	if configJSON := readArchiveFile(t, results[2].Path, ConfigFile); !strings.Contains(configJSON, "backups") ||
+		strings.Contains(configJSON, "metrics-secret") || strings.Contains(configJSON, "fleet-token-key") {
+		t.Errorf("%s = %s, want the configuration without secrets", ConfigFile, configJSON)
+	}
+	entries, err := os.ReadDir(cfg.Backup.Dir)
+	if err != nil {
+		t.Fatalf("failed to list backups: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("backups = %v, want 2 archives and no leftover snapshots", entries)
+	}
+
+	// Restored over a database with other contents, which is kept
+	databasePath := filepath.Join(dir, "restored.sqlite")
+	other := openDB(t, databasePath)
+	if err := other.Create(&models.Restore{Name: "restore_2", State: models.RestoreStateReady}).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	sqlDB, _ := other.DB()
+	sqlDB.Close()
+
+	kept, err := Restore(results[2].Path, databasePath)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if !strings.HasPrefix(kept, databasePath+".") || !strings.HasSuffix(kept, ".bak") {
+		t.Errorf("kept = %q, want the replaced database kept next to it", kept)
+	}
+
+	var restores []models.Restore
+	if err := openDB(t, databasePath).Find(&restores).Error; err != nil {
+		t.Fatalf("failed to load restores: %v", err)
+	}
+	if len(restores) != 1 || restores[0].Name != "restore_1" {
+		t.Errorf("restores = %+v, want restore_1 of the backup", restores)
+	}
+}
+
+func TestRestoreRejectsOtherArchives(t *testing.T) {
+	dir := t.TempDir()
+	databasePath := filepath.Join(dir, "branchd.sqlite")
+	if err := os.WriteFile(databasePath, []byte("current"), 0o600); err != nil {
+		t.Fatalf("failed to write database: %v", err)
+	}
+	archive := filepath.Join(dir, "other.tar.gz")
+	if err := os.WriteFile(archive, []byte("not gzip"), 0o600); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	if _, err := Restore(archive, databasePath); err == nil {
+		t.Fatal("Restore() error = nil, want the archive rejected")
+	}
+	if current, _ := os.ReadFile(databasePath); string(current) != "current" {
+		t.Errorf("database = %q, want it left as it was", current)
+	}
+}
+
+func TestDeleteAll(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"branchd-20250301T030000Z.tar.gz", "branchd-20250302T030000Z.tar.gz", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := DeleteAll(dir)
+	if err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("deleted = %v, want both archives", deleted)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("other files must be kept: %v", err)
+	}
+
+	if deleted, err := DeleteAll(filepath.Join(dir, "missing")); err != nil || len(deleted) != 0 {
+		t.Errorf("DeleteAll() of a missing directory = %v, %v", deleted, err)
+	}
+}
+
+func TestRunUploadsToS3(t *testing.T) {
+	stubNow(t)
+	var path, authorization, encryption, token string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, authorization = r.URL.Path, r.Header.Get("Authorization")
+		encryption, token = r.Header.Get("X-Amz-Server-Side-Encryption"), r.Header.Get("X-Amz-Security-Token")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	db := openDB(t, filepath.Join(dir, "branchd.sqlite"))
+	cfg := &config.Config{Backup: config.BackupConfig{Dir: dir, S3Bucket: "backups", S3Prefix: "branchd/db1", S3Region: "eu-west-1",
+		S3Endpoint: server.URL, S3AccessKeyID: "AKID", S3SecretAccessKey: "secret", S3SessionToken: "token", S3Encryption: "AES256"}}
+
+	result, err := Run(context.Background(), db, cfg, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.S3URL != "s3://backups/branchd/db1/branchd-20250301T030100Z.tar.gz" {
+		t.Errorf("S3URL = %q", result.S3URL)
+	}
+	if path != "/backups/branchd/db1/branchd-20250301T030100Z.tar.gz" || int64(len(body)) != result.SizeBytes {
+		t.Errorf("uploaded %d bytes to %s, want the %d byte archive", len(body), path, result.SizeBytes)
+	}
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKID/20250301/eu-west-1/s3/aws4_request, "+
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token;x-amz-server-side-encryption, Signature=") {
+		t.Errorf("Authorization = %q", authorization)
+	}
+	if encryption != "AES256" || token != "token" {
+		t.Errorf("x-amz-server-side-encryption = %q, x-amz-security-token = %q", encryption, token)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	// Example of the Signature Version 4 documentation
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	if got := hex.EncodeToString(key); got != "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d" {
+		t.Errorf("signingKey() = %s", got)
+	}
+}
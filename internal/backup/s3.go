@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// uploadS3 PUTs an archive to the bucket, signed with AWS Signature Version 4
+// Objects are addressed path-style (endpoint/bucket/key), which S3-compatible stores support as well
+func uploadS3(ctx context.Context, cfg config.BackupConfig, key, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	// The signature covers the payload's hash
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return fmt.Errorf("failed to hash archive: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	endpoint := cfg.S3Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("s3.%s.amazonaws.com", cfg.S3Region)
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+
+	canonicalURI := "/" + uriEncode(cfg.S3Bucket)
+	for _, segment := range strings.Split(key, "/") {
+		canonicalURI += "/" + uriEncode(segment)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, base.Scheme+"://"+base.Host+canonicalURI, file)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+	if cfg.S3Encryption != "" {
+		req.Header.Set("X-Amz-Server-Side-Encryption", cfg.S3Encryption)
+	}
+	if cfg.S3SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.S3SessionToken)
+	}
+	sign(req, cfg, canonicalURI, hex.EncodeToString(hash.Sum(nil)), now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to upload archive to S3: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("S3 upload returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds the Signature Version 4 headers of a request without query parameters
+// The x-amz-* headers set on the request (security token, server-side encryption) are signed as well
+func sign(req *http.Request, cfg config.BackupConfig, canonicalURI, payloadHash string, at time.Time) {
+	amzDate := at.Format("20060102T150405Z")
+	date := at.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Canonical headers are sorted by their lowercase names
+	headers := []string{"host:" + req.URL.Host}
+	names := []string{"host"}
+	var amzNames []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			amzNames = append(amzNames, lower)
+		}
+	}
+	sort.Strings(amzNames)
+	for _, name := range amzNames {
+		headers = append(headers, name+":"+strings.TrimSpace(req.Header.Get(name)))
+		names = append(names, name)
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		"", // Query
+		strings.Join(headers, "\n"),
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, cfg.S3Region)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(signingKey(cfg.S3SecretAccessKey, date, cfg.S3Region, "s3"), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cfg.S3AccessKeyID, scope, signedHeaders, signature))
+}
+
+// signingKey derives the Signature Version 4 key of a day, region and service
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode percent-encodes everything but unreserved characters, as Signature Version 4 requires
+func uriEncode(segment string) string {
+	var b strings.Builder
+	for _, c := range []byte(segment) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,192 @@
+package branches
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// DefaultStaleDays is after how many days without client connections a branch counts as stale
+const DefaultStaleDays = 14
+
+// activityWindowDays is how many days of branch creations the per-user counts and the heatmap cover
+const activityWindowDays = 30
+
+// BranchActivity is when a branch was last connected to
+type BranchActivity struct {
+	BranchID       string     `json:"branch_id"`
+	BranchName     string     `json:"branch_name"`
+	RestoreID      string     `json:"restore_id"`
+	CreatedByID    string     `json:"created_by_id"`
+	CreatedByEmail string     `json:"created_by_email"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastActivityAt *time.Time `json:"last_activity_at"` // Last time a client connection or transaction was seen (nil = never)
+	IdleDays       int        `json:"idle_days"`        // Full days since the last connection, or since creation if never connected
+	Suspended      bool       `json:"suspended"`
+	Stale          bool       `json:"stale"`
+
+	ActiveConnections int `json:"active_connections"` // Client connections at the last sample
+}
+
+// UserActivity is how much a user uses branches
+type UserActivity struct {
+	UserID              string     `json:"user_id"`
+	Email               string     `json:"email"`
+	Branches            int        `json:"branches"`       // Branches the user currently owns
+	StaleBranches       int        `json:"stale_branches"` // Of which no connections in the stale period
+	BranchesCreated     int        `json:"branches_created"`
+	LastBranchCreatedAt *time.Time `json:"last_branch_created_at"`
+	LastActivityAt      *time.Time `json:"last_activity_at"` // Last connection to any of the user's branches
+}
+
+// BranchActivityReport shows which branches are still used and who uses branches at all
+// Connections are sampled every few minutes by the worker, shorter sessions may go unseen
+type BranchActivityReport struct {
+	GeneratedAt   time.Time        `json:"generated_at"`
+	StaleDays     int              `json:"stale_days"`
+	WindowDays    int              `json:"window_days"`    // Period of the creation counts and the heatmap
+	Branches      []BranchActivity `json:"branches"`       // Least recently used first
+	StaleBranches []BranchActivity `json:"stale_branches"` // No connections in StaleDays
+	Users         []UserActivity   `json:"users"`          // Most recently active first, users without branches last
+	Heatmap       [7][24]int       `json:"heatmap"`        // Branch creations in the window by UTC weekday (0 = Sunday) and hour
+}
+
+// ActivityReport returns the branch usage report, branches without connections in staleDays are stale
+func (s *Service) ActivityReport(staleDays int) (*BranchActivityReport, error) {
+	var branches []models.Branch
+	if err := s.db.Find(&branches).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branches: %w", err)
+	}
+
+	now := time.Now()
+	var creations []models.BranchCreation
+	if err := s.db.Where("created_at > ?", now.AddDate(0, 0, -activityWindowDays)).Find(&creations).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branch creations: %w", err)
+	}
+
+	var users []models.User
+	if err := s.db.Select("id", "email").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to load users: %w", err)
+	}
+
+	return buildActivityReport(branches, creations, users, staleDays, now), nil
+}
+
+// buildActivityReport aggregates branch activity at now
+// creations are those of the activity window, users without any branch are included to show adoption
+func buildActivityReport(branches []models.Branch, creations []models.BranchCreation, users []models.User, staleDays int, now time.Time) *BranchActivityReport {
+	report := &BranchActivityReport{
+		GeneratedAt:   now,
+		StaleDays:     staleDays,
+		WindowDays:    activityWindowDays,
+		Branches:      make([]BranchActivity, 0, len(branches)),
+		StaleBranches: []BranchActivity{},
+		Users:         []UserActivity{},
+	}
+
+	byUser := map[string]*UserActivity{}
+	get := func(id, email string) *UserActivity {
+		if activity, ok := byUser[id]; ok {
+			if activity.Email == "" {
+				activity.Email = email
+			}
+			return activity
+		}
+		activity := &UserActivity{UserID: id, Email: email}
+		byUser[id] = activity
+		return activity
+	}
+	for _, user := range users {
+		get(user.ID, user.Email)
+	}
+
+	for _, creation := range creations {
+		utc := creation.CreatedAt.UTC()
+		report.Heatmap[utc.Weekday()][utc.Hour()]++
+
+		creator := get(creation.CreatedByID, creation.CreatedByEmail)
+		creator.BranchesCreated++
+		createdAt := creation.CreatedAt
+		if creator.LastBranchCreatedAt == nil || createdAt.After(*creator.LastBranchCreatedAt) {
+			creator.LastBranchCreatedAt = &createdAt
+		}
+	}
+
+	staleAfter := time.Duration(staleDays) * 24 * time.Hour
+	for _, branch := range branches {
+		lastUsed := branch.CreatedAt
+		if branch.LastActivityAt != nil {
+			lastUsed = *branch.LastActivityAt
+		}
+		idle := now.Sub(lastUsed)
+
+		owner := get(branch.CreatedByID, "")
+		activity := BranchActivity{
+			BranchID:       branch.ID,
+			BranchName:     branch.Name,
+			RestoreID:      branch.RestoreID,
+			CreatedByID:    branch.CreatedByID,
+			CreatedByEmail: owner.Email,
+			CreatedAt:      branch.CreatedAt,
+			LastActivityAt: branch.LastActivityAt,
+			IdleDays:       int(idle / (24 * time.Hour)),
+			Suspended:      branch.SuspendedAt != nil,
+			Stale:          idle >= staleAfter,
+
+			ActiveConnections: branch.ActiveConnections,
+		}
+		report.Branches = append(report.Branches, activity)
+
+		owner.Branches++
+		if activity.Stale {
+			owner.StaleBranches++
+		}
+		if activity.LastActivityAt != nil && (owner.LastActivityAt == nil || activity.LastActivityAt.After(*owner.LastActivityAt)) {
+			owner.LastActivityAt = activity.LastActivityAt
+		}
+	}
+
+	sort.SliceStable(report.Branches, func(i, j int) bool {
+		return lastUsedAt(report.Branches[i]).Before(lastUsedAt(report.Branches[j]))
+	})
+	for _, activity := range report.Branches {
+		if activity.Stale {
+			report.StaleBranches = append(report.StaleBranches, activity)
+		}
+	}
+
+	for _, activity := range byUser {
+		report.Users = append(report.Users, *activity)
+	}
+	sort.Slice(report.Users, func(i, j int) bool {
+		a, b := lastActiveAt(report.Users[i]), lastActiveAt(report.Users[j])
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return report.Users[i].Email < report.Users[j].Email
+	})
+
+	return report
+}
+
+// lastUsedAt is when a branch was last connected to, or created if never
+func lastUsedAt(activity BranchActivity) time.Time {
+	if activity.LastActivityAt != nil {
+		return *activity.LastActivityAt
+	}
+	return activity.CreatedAt
+}
+
+// lastActiveAt is the latest connection or branch creation of a user (zero if neither)
+func lastActiveAt(activity UserActivity) time.Time {
+	var last time.Time
+	if activity.LastActivityAt != nil {
+		last = *activity.LastActivityAt
+	}
+	if activity.LastBranchCreatedAt != nil && activity.LastBranchCreatedAt.After(last) {
+		last = *activity.LastBranchCreatedAt
+	}
+	return last
+}
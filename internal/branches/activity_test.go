@@ -0,0 +1,111 @@
+package branches
+
+import (
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestBuildActivityReport(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC) // Monday
+	daysAgo := func(d int) *time.Time {
+		at := now.AddDate(0, 0, -d)
+		return &at
+	}
+	branch := func(id, userID string, createdDaysAgo int, lastActivity *time.Time) models.Branch {
+		b := models.Branch{BaseModel: models.BaseModel{ID: id}, Name: id, CreatedByID: userID, LastActivityAt: lastActivity}
+		b.CreatedAt = *daysAgo(createdDaysAgo)
+		return b
+	}
+	creation := func(userID, email string, at time.Time) models.BranchCreation {
+		c := models.BranchCreation{CreatedByID: userID, CreatedByEmail: email}
+		c.CreatedAt = at
+		return c
+	}
+
+	users := []models.User{
+		{BaseModel: models.BaseModel{ID: "u1"}, Email: "a@example.com"},
+		{BaseModel: models.BaseModel{ID: "u2"}, Email: "b@example.com"},
+		{BaseModel: models.BaseModel{ID: "u3"}, Email: "c@example.com"},
+	}
+	branches := []models.Branch{
+		branch("used", "u1", 20, daysAgo(1)),
+		branch("abandoned", "u1", 30, daysAgo(10)),
+		branch("never-connected", "u2", 9, nil),
+		branch("new", "u2", 2, nil),
+	}
+	creations := []models.BranchCreation{
+		creation("u1", "a@example.com", now.Add(-time.Hour)),         // Monday 11:00
+		creation("u2", "b@example.com", now.AddDate(0, 0, -2)),       // Saturday 12:00
+		creation("u4", "deleted@example.com", now.AddDate(0, 0, -7)), // Monday 12:00
+		creation("u2", "b@example.com", now.AddDate(0, 0, -2).Add(-time.Minute)),
+	}
+
+	report := buildActivityReport(branches, creations, users, 7, now)
+
+	order := []string{"abandoned", "never-connected", "new", "used"}
+	if len(report.Branches) != len(order) {
+		t.Fatalf("got %d branches, want %d", len(report.Branches), len(order))
+	}
+	for i, name := range order {
+		if report.Branches[i].BranchName != name {
+			t.Errorf("Branches[%d] = %s, want %s", i, report.Branches[i].BranchName, name)
+		}
+	}
+
+	if len(report.StaleBranches) != 2 || report.StaleBranches[0].BranchName != "abandoned" || report.StaleBranches[1].BranchName != "never-connected" {
+		t.Errorf("StaleBranches = %+v, want abandoned and never-connected", report.StaleBranches)
+	}
+	if got := report.Branches[0]; got.IdleDays != 10 || got.CreatedByEmail != "a@example.com" {
+		t.Errorf("abandoned = %+v, want 10 idle days by a@example.com", got)
+	}
+
+	wantUsers := []struct {
+		email                    string
+		branches, stale, created int
+	}{
+		{"a@example.com", 2, 1, 1},
+		{"b@example.com", 2, 1, 2},
+		{"deleted@example.com", 0, 0, 1},
+		{"c@example.com", 0, 0, 0},
+	}
+	if len(report.Users) != len(wantUsers) {
+		t.Fatalf("got %d users, want %d: %+v", len(report.Users), len(wantUsers), report.Users)
+	}
+	for i, want := range wantUsers {
+		got := report.Users[i]
+		if got.Email != want.email || got.Branches != want.branches || got.StaleBranches != want.stale || got.BranchesCreated != want.created {
+			t.Errorf("Users[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+	if got := report.Users[0].LastActivityAt; got == nil || !got.Equal(*daysAgo(1)) {
+		t.Errorf("a@example.com last_activity_at = %v, want a day ago", got)
+	}
+
+	if report.Heatmap[time.Monday][11] != 1 || report.Heatmap[time.Monday][12] != 1 || report.Heatmap[time.Saturday][11] != 1 || report.Heatmap[time.Saturday][12] != 1 {
+		t.Errorf("Heatmap = %v, want creations on Monday 11h and 12h and Saturday 11h and 12h", report.Heatmap)
+	}
+}
+
+func TestActivityReport(t *testing.T) {
+	s, restore := newTestService(t)
+
+	user := models.User{Email: "dev@example.com", PasswordHash: "hash"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	lastActivity := time.Now().Add(-30 * 24 * time.Hour)
+	createTestBranch(t, s, &models.Branch{Name: "old", RestoreID: restore.ID, CreatedByID: user.ID, LastActivityAt: &lastActivity})
+
+	report, err := s.ActivityReport(DefaultStaleDays)
+	if err != nil {
+		t.Fatalf("ActivityReport() error = %v", err)
+	}
+	if len(report.StaleBranches) != 1 || report.StaleBranches[0].IdleDays != 30 {
+		t.Errorf("StaleBranches = %+v, want old with 30 idle days", report.StaleBranches)
+	}
+	if len(report.Users) != 1 || report.Users[0].Email != "dev@example.com" || report.Users[0].StaleBranches != 1 {
+		t.Errorf("Users = %+v, want dev@example.com with a stale branch", report.Users)
+	}
+}
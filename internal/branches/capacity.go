@@ -0,0 +1,106 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
+)
+
+// ErrCapacityExceeded is returned by CreateBranch when the VM is short of memory, CPU or disk space for another branch
+var ErrCapacityExceeded = errors.New("not enough capacity for another branch")
+
+// Readers of the VM's resources, replaced in tests
+var (
+	availableMemoryMB = sysinfo.AvailableMemoryMB
+	loadAverage       = sysinfo.LoadAverage
+	freeDiskPercent   = sysinfo.FreeDiskPercent
+	cpuCount          = runtime.NumCPU
+)
+
+// Capacity is the VM's headroom for new branches against the Config.Capacity* thresholds
+// Resources that can't be read (e.g. no ZFS on development machines) are omitted and never block branch creation
+type Capacity struct {
+	Admits  bool     `json:"admits"`            // New branches are created, otherwise rejected with ErrCapacityExceeded
+	Reasons []string `json:"reasons,omitempty"` // Why branches are rejected, with what to do about it
+
+	Memory *CapacityHeadroom `json:"memory,omitempty"` // Available memory in MB
+	Load   *CapacityHeadroom `json:"load,omitempty"`   // 1-minute load average per CPU core in percent
+	Disk   *CapacityHeadroom `json:"disk,omitempty"`   // Free space of the ZFS dataset root in percent
+}
+
+// CapacityHeadroom is a resource's current value against its threshold
+type CapacityHeadroom struct {
+	Current  float64 `json:"current"`
+	Limit    float64 `json:"limit"`    // 0 = not checked
+	Headroom float64 `json:"headroom"` // How far the current value is from the limit, negative once it's crossed, 0 without a limit
+}
+
+// Capacity reads the VM's memory, load and disk space and checks them against the config's thresholds
+func (s *Service) Capacity(ctx context.Context, config *models.Config) *Capacity {
+	capacity := &Capacity{Admits: true}
+
+	if available, err := availableMemoryMB(); err == nil {
+		capacity.Memory = &CapacityHeadroom{Current: float64(available), Limit: float64(config.CapacityMinMemoryMB)}
+		if config.CapacityMinMemoryMB > 0 {
+			capacity.Memory.Headroom = float64(available - config.CapacityMinMemoryMB)
+			if available < config.CapacityMinMemoryMB {
+				capacity.reject(fmt.Sprintf("only %d MB memory available, capacity_min_memory_mb is %d: "+
+					"suspend or delete idle branches, or lower the memory_mb of new ones", available, config.CapacityMinMemoryMB))
+			}
+		}
+	} else {
+		s.logger.Debug().Err(err).Msg("Failed to read available memory")
+	}
+
+	if load, err := loadAverage(); err == nil {
+		percent := load * 100 / float64(max(cpuCount(), 1))
+		capacity.Load = &CapacityHeadroom{Current: percent, Limit: float64(config.CapacityMaxLoadPercent)}
+		if config.CapacityMaxLoadPercent > 0 {
+			capacity.Load.Headroom = float64(config.CapacityMaxLoadPercent) - percent
+			if percent > float64(config.CapacityMaxLoadPercent) {
+				capacity.reject(fmt.Sprintf("load average is %.0f%% of the CPU cores, capacity_max_load_percent is %d: "+
+					"wait for running restores and heavy queries to finish", percent, config.CapacityMaxLoadPercent))
+			}
+		}
+	} else {
+		s.logger.Debug().Err(err).Msg("Failed to read load average")
+	}
+
+	if s.config.Storage.DatasetRoot != "" {
+		if percent, _, err := freeDiskPercent(ctx, s.config.Storage.DatasetRoot); err == nil {
+			capacity.Disk = &CapacityHeadroom{Current: percent, Limit: float64(config.CapacityMinDiskPercent)}
+			if config.CapacityMinDiskPercent > 0 {
+				capacity.Disk.Headroom = percent - float64(config.CapacityMinDiskPercent)
+				if percent < float64(config.CapacityMinDiskPercent) {
+					capacity.reject(fmt.Sprintf("only %.1f%% of %s is free, capacity_min_disk_percent is %d: "+
+						"delete unused branches and restores, or grow the pool", percent, s.config.Storage.DatasetRoot, config.CapacityMinDiskPercent))
+				}
+			}
+		} else {
+			s.logger.Debug().Err(err).Msg("Failed to check free disk space")
+		}
+	}
+
+	return capacity
+}
+
+// reject records why new branches aren't admitted
+func (c *Capacity) reject(reason string) {
+	c.Admits = false
+	c.Reasons = append(c.Reasons, reason)
+}
+
+// checkCapacity fails with ErrCapacityExceeded when the VM is past one of the config's thresholds
+func (s *Service) checkCapacity(ctx context.Context, config *models.Config) error {
+	capacity := s.Capacity(ctx, config)
+	if capacity.Admits {
+		return nil
+	}
+	s.logger.Warn().Strs("reasons", capacity.Reasons).Msg("Branch creation rejected, not enough capacity")
+	return fmt.Errorf("%w: %s", ErrCapacityExceeded, strings.Join(capacity.Reasons, "; "))
+}
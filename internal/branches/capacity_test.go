@@ -0,0 +1,86 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// stubResources reports the given available memory, load average (on 4 CPU cores) and free disk space for the test's duration
+func stubResources(t *testing.T, memoryMB int, load, diskPercent float64) {
+	t.Helper()
+	originalMemory, originalLoad, originalDisk, originalCPUs := availableMemoryMB, loadAverage, freeDiskPercent, cpuCount
+	t.Cleanup(func() {
+		availableMemoryMB, loadAverage, freeDiskPercent, cpuCount = originalMemory, originalLoad, originalDisk, originalCPUs
+	})
+	availableMemoryMB = func() (int, error) { return memoryMB, nil }
+	loadAverage = func() (float64, error) { return load, nil }
+	freeDiskPercent = func(ctx context.Context, dataset string) (float64, int64, error) {
+		return diskPercent, int64(diskPercent) << 30, nil
+	}
+	cpuCount = func() int { return 4 }
+}
+
+func TestCapacity(t *testing.T) {
+	s, _ := newTestService(t)
+	s.config.Storage.DatasetRoot = "tank"
+	config := &models.Config{CapacityMinMemoryMB: 1024, CapacityMaxLoadPercent: 150, CapacityMinDiskPercent: 10}
+
+	tests := []struct {
+		name        string
+		memoryMB    int
+		load        float64
+		diskPercent float64
+		wantReasons []string
+	}{
+		{name: "headroom", memoryMB: 4096, load: 2, diskPercent: 40},
+		{name: "low memory", memoryMB: 700, load: 2, diskPercent: 40, wantReasons: []string{"only 700 MB memory available"}},
+		{name: "overloaded", memoryMB: 4096, load: 8, diskPercent: 40, wantReasons: []string{"load average is 200% of the CPU cores"}},
+		{name: "everything short", memoryMB: 100, load: 8, diskPercent: 3, wantReasons: []string{"memory", "load", "3.0% of tank is free"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubResources(t, tt.memoryMB, tt.load, tt.diskPercent)
+
+			capacity := s.Capacity(context.Background(), config)
+			if capacity.Admits != (len(tt.wantReasons) == 0) || len(capacity.Reasons) != len(tt.wantReasons) {
+				t.Fatalf("Capacity() = %+v, want reasons %v", capacity, tt.wantReasons)
+			}
+			for i, want := range tt.wantReasons {
+				if !strings.Contains(capacity.Reasons[i], want) {
+					t.Errorf("reason %d = %q, want it to contain %q", i, capacity.Reasons[i], want)
+				}
+			}
+		})
+	}
+
+	stubResources(t, 4096, 2, 40)
+	capacity := s.Capacity(context.Background(), config)
+	if capacity.Memory.Headroom != 3072 || capacity.Load.Current != 50 || capacity.Load.Headroom != 100 || capacity.Disk.Headroom != 30 {
+		t.Errorf("headroom = memory %+v, load %+v, disk %+v", *capacity.Memory, *capacity.Load, *capacity.Disk)
+	}
+
+	// Thresholds of 0 aren't checked
+	stubResources(t, 10, 100, 0.5)
+	if capacity := s.Capacity(context.Background(), &models.Config{}); !capacity.Admits {
+		t.Errorf("Capacity() without thresholds = %+v, want it to admit branches", capacity)
+	}
+}
+
+func TestCreateBranchRejectedWithoutCapacity(t *testing.T) {
+	s, _ := newTestService(t)
+	stubResources(t, 200, 1, 50)
+	user := models.User{Email: "bob@example.com", PasswordHash: "hash"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	// The config defaults to capacity_min_memory_mb 512
+	_, err := s.CreateBranch(context.Background(), CreateBranchParams{BranchName: "feature-x", CreatedByID: user.ID})
+	if !errors.Is(err, ErrCapacityExceeded) || !strings.Contains(err.Error(), "capacity_min_memory_mb is 512") {
+		t.Errorf("CreateBranch() error = %v, want ErrCapacityExceeded naming the threshold", err)
+	}
+}
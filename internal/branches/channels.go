@@ -0,0 +1,57 @@
+package branches
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/notify"
+)
+
+// postBranchCreated posts a new branch to the notification channels subscribed to branch.created
+func (s *Service) postBranchCreated(ctx context.Context, config *models.Config, branch *models.Branch, restore *models.Restore, started time.Time) {
+	fields := []notify.ChannelField{
+		{Name: "Restore", Value: restore.Name},
+		{Name: "Created by", Value: s.userEmail(branch.CreatedByID)},
+		{Name: "Duration", Value: notify.FormatDuration(time.Since(started))},
+		{Name: "Port", Value: strconv.Itoa(branch.Port)},
+	}
+	if branch.Template != "" {
+		fields = append(fields, notify.ChannelField{Name: "Template", Value: branch.Template})
+	}
+	if branch.ExpiresAt != nil {
+		fields = append(fields, notify.ChannelField{Name: "Expires", Value: branch.ExpiresAt.UTC().Format(time.RFC1123)})
+	}
+
+	notify.NewService(s.db, s.config, s.logger).Post(ctx, notify.ChannelMessage{
+		Event:   models.ChannelEventBranchCreated,
+		Title:   fmt.Sprintf("Branch %s created", branch.Name),
+		Fields:  fields,
+		LogsURL: notify.LogsURL(config, "/api/branches/"+branch.ID+"/logs"),
+	})
+}
+
+// postBranchDeleted posts a deleted branch to the notification channels subscribed to branch.deleted
+// Its logs were deleted with it, the message has no link
+func (s *Service) postBranchDeleted(ctx context.Context, branch *models.Branch, restore *models.Restore) {
+	notify.NewService(s.db, s.config, s.logger).Post(ctx, notify.ChannelMessage{
+		Event: models.ChannelEventBranchDeleted,
+		Title: fmt.Sprintf("Branch %s deleted", branch.Name),
+		Fields: []notify.ChannelField{
+			{Name: "Restore", Value: restore.Name},
+			{Name: "Created by", Value: s.userEmail(branch.CreatedByID)},
+			{Name: "Age", Value: notify.FormatDuration(time.Since(branch.CreatedAt))},
+		},
+	})
+}
+
+// userEmail returns the email of a user, its ID if it's gone
+func (s *Service) userEmail(userID string) string {
+	var user models.User
+	if err := s.db.Select("email").Where("id = ?", userID).First(&user).Error; err != nil {
+		return userID
+	}
+	return user.Email
+}
@@ -17,6 +17,10 @@ set -eu  # Exit on error and undefined variables, but no pipefail
 # 6. Start PostgreSQL service (as independent primary)
 # 7. Wait for PostgreSQL to be ready and create database user
 # 8. Apply custom PostgreSQL configuration if provided
+# 9. Create the configured extensions (binaries are verified before step 2)
+#
+# If pg_wal lives on a separate WAL dataset, that dataset is snapshotted and cloned alongside
+# the data dataset and the branch's pg_wal symlink is repointed to the clone.
 #
 # Note: The source is a primary database created via pg_dump/restore.
 # The ZFS clone starts as an independent primary (no promotion or WAL replay needed).
@@ -24,14 +28,28 @@ set -eu  # Exit on error and undefined variables, but no pipefail
 # Output after set -eu
 echo "BRANCH_CREATION_STARTED=true"
 
-# Input parameters
-BRANCH_NAME="{{.BranchName}}"
-DATASET_NAME="{{.DatasetName}}"  # e.g., tank/restore_20250915120000
-RESTORE_PORT="{{.RestorePort}}"  # Port of the restore's PostgreSQL cluster
-USER="{{.User}}"
-PASSWORD="{{.Password}}"
-PG_VERSION="{{.PgVersion}}"
-CUSTOM_POSTGRESQL_CONF="{{.CustomPostgresqlConf}}"
+# Input parameters, passed in the environment (never rendered into the script)
+BRANCH_NAME="${BRANCH_NAME}"
+DATASET_NAME="${DATASET_NAME}"  # e.g., tank/restore_20250915120000
+WAL_DATASET_NAME="${WAL_DATASET_NAME}"  # e.g., nvme/wal/restore_20250915120000 (empty = pg_wal inside data directory)
+BRANCH_DATASET="${BRANCH_DATASET}"  # e.g., tank/my-branch
+BRANCH_MOUNTPOINT="${BRANCH_MOUNTPOINT}"  # e.g., /opt/branchd/my-branch
+BRANCH_WAL_DATASET="${BRANCH_WAL_DATASET}"  # e.g., nvme/wal/my-branch
+BRANCH_WAL_MOUNTPOINT="${BRANCH_WAL_MOUNTPOINT}"  # e.g., /opt/branchd-wal/my-branch
+RESTORE_PORT="${RESTORE_PORT}"  # Port of the restore's PostgreSQL cluster
+USER="${BRANCH_USER}"
+PASSWORD="${BRANCH_PASSWORD}"
+PG_VERSION="${PG_VERSION}"
+CUSTOM_POSTGRESQL_CONF="${CUSTOM_POSTGRESQL_CONF}"
+MAX_CONNECTIONS="${MAX_CONNECTIONS}"  # Enforced max_connections (empty = keep restore's value)
+HBA_CONF="${HBA_CONF}"  # base64-encoded pg_hba.conf (local peer, the branch user's rules, reject everything else)
+QUOTA="${QUOTA}"  # ZFS refquota of the clone (e.g. 50G, none = unlimited)
+RESERVATION="${RESERVATION}"  # ZFS reservation of the clone (none = no guaranteed space)
+# systemd resource control directives (CPUQuota, MemoryMax, ...), one per line
+RESOURCE_DIRECTIVES="${RESOURCE_DIRECTIVES}"
+EXTENSIONS="${EXTENSIONS}"  # Space-separated extensions created in the branch (e.g. "vector postgis")
+DATABASE_NAME="${DATABASE_NAME}"  # Database the extensions are created in
+BREAK_GLASS="${BREAK_GLASS}"  # true = branch of a break-glass grant, its user isn't a superuser
 
 echo "DEBUG: Parameters loaded successfully"
 echo "DEBUG: PostgreSQL version ${PG_VERSION}, restore port ${RESTORE_PORT}"
@@ -41,7 +59,6 @@ echo "DEBUG: Cloning from restore dataset: ${DATASET_NAME}"
 PORT_RANGE_START=15432
 PORT_RANGE_END=16432
 
-BRANCH_MOUNTPOINT="/opt/branchd/${BRANCH_NAME}"
 # Branch PostgreSQL data directory (in 'data' subdirectory after ZFS clone from restore)
 BRANCH_PGDATA="${BRANCH_MOUNTPOINT}/data"
 PORT_ALLOCATION_LOCK="/tmp/branchd-port-allocation.lock"
@@ -94,6 +111,12 @@ cleanup() {
             fi
         fi
 
+        # Remove WAL snapshot and clone
+        if [ -n "${WAL_DATASET_NAME}" ] && sudo zfs list -t snapshot "${WAL_DATASET_NAME}@${BRANCH_NAME}" >/dev/null 2>&1; then
+            echo "Removing WAL snapshot and dependent clones..."
+            sudo zfs destroy -R "${WAL_DATASET_NAME}@${BRANCH_NAME}" || echo "Warning: Failed to remove WAL snapshot and clones"
+        fi
+
         # Close UFW port if it was opened
         if [ -n "${AVAILABLE_PORT:-}" ]; then
             echo "Closing UFW port ${AVAILABLE_PORT}..."
@@ -209,6 +232,15 @@ fi
 
 echo "Source database is ready to accept connections on port ${RESTORE_PORT}"
 
+# Verify the extensions' packages are installed before anything is cloned
+# WHY: CREATE EXTENSION only fails after the branch is running, this gives a clear error up front
+for ext in ${EXTENSIONS}; do
+    if [ ! -f "/usr/share/postgresql/${PG_VERSION}/extension/${ext}.control" ]; then
+        echo "BRANCHD_ERROR:EXTENSION_MISSING: Extension ${ext} is not installed for PostgreSQL ${PG_VERSION} (install its package, e.g. postgresql-${PG_VERSION}-pgvector for vector)"
+        exit 1
+    fi
+done
+
 # Find available port with locking
 echo "Finding available port..."
 AVAILABLE_PORT=$(find_available_port | tail -1)
@@ -219,6 +251,14 @@ fi
 
 echo "Found available port: ${AVAILABLE_PORT}"
 
+# Flush the restore to disk before snapshotting data and WAL separately
+# WHY: Snapshots of two datasets are not atomic (the WAL dataset may live on another pool),
+# the restore is idle once ready so a checkpoint makes both snapshots consistent
+if [ -n "${WAL_DATASET_NAME}" ]; then
+    echo "Checkpointing restore before snapshot..."
+    sudo -u postgres psql -p "${RESTORE_PORT}" -c "CHECKPOINT" >/dev/null
+fi
+
 # Create ZFS snapshot
 # WHY: Snapshot preserves the current database state for branching
 echo "Creating ZFS snapshot..."
@@ -231,25 +271,25 @@ fi
 
 # Create ZFS clone with direct mountpoint
 echo "Creating ZFS clone..."
-if sudo zfs list "tank/${BRANCH_NAME}" >/dev/null 2>&1; then
+if sudo zfs list "${BRANCH_DATASET}" >/dev/null 2>&1; then
     echo "ZFS clone already exists, ensuring it's mounted..."
 
     # Ensure systemd ignore property is set
-    sudo zfs set org.openzfs.systemd:ignore=on "tank/${BRANCH_NAME}"
+    sudo zfs set org.openzfs.systemd:ignore=on "${BRANCH_DATASET}"
 
     # Check if already mounted using ZFS
-    if [ "$(sudo zfs get -H -o value mounted tank/${BRANCH_NAME})" = "yes" ]; then
+    if [ "$(sudo zfs get -H -o value mounted ${BRANCH_DATASET})" = "yes" ]; then
         echo "ZFS clone already mounted"
     else
         echo "ZFS clone exists but not mounted, mounting now..."
         # Unmount first to be safe (ignore errors)
-        sudo zfs unmount "tank/${BRANCH_NAME}" 2>/dev/null || true
+        sudo zfs unmount "${BRANCH_DATASET}" 2>/dev/null || true
         # Create mountpoint if it doesn't exist
         if [ ! -d "${BRANCH_MOUNTPOINT}" ]; then
             sudo mkdir -p "${BRANCH_MOUNTPOINT}"
         fi
         # Mount the clone
-        if ! sudo zfs mount "tank/${BRANCH_NAME}"; then
+        if ! sudo zfs mount "${BRANCH_DATASET}"; then
             echo "BRANCHD_ERROR: Failed to mount existing ZFS clone"
             exit 1
         fi
@@ -259,17 +299,17 @@ else
     # Create clone - ZFS should automatically mount it
     # Set org.openzfs.systemd:ignore to prevent systemd from managing this mount
     echo "Creating ZFS clone with automatic mount..."
-    sudo zfs clone -o mountpoint="${BRANCH_MOUNTPOINT}" -o org.openzfs.systemd:ignore=on "${DATASET_NAME}@${BRANCH_NAME}" "tank/${BRANCH_NAME}"
+    sudo zfs clone -o mountpoint="${BRANCH_MOUNTPOINT}" -o org.openzfs.systemd:ignore=on "${DATASET_NAME}@${BRANCH_NAME}" "${BRANCH_DATASET}"
 
     # Verify the clone was mounted using ZFS
-    if [ "$(sudo zfs get -H -o value mounted tank/${BRANCH_NAME})" != "yes" ]; then
+    if [ "$(sudo zfs get -H -o value mounted ${BRANCH_DATASET})" != "yes" ]; then
         echo "Clone created but not automatically mounted, mounting explicitly..."
         # Create mountpoint if it doesn't exist
         if [ ! -d "${BRANCH_MOUNTPOINT}" ]; then
             sudo mkdir -p "${BRANCH_MOUNTPOINT}"
         fi
         # Mount the clone
-        if ! sudo zfs mount "tank/${BRANCH_NAME}"; then
+        if ! sudo zfs mount "${BRANCH_DATASET}"; then
             echo "BRANCHD_ERROR: Failed to mount ZFS clone after creation"
             exit 1
         fi
@@ -277,6 +317,37 @@ else
     echo "ZFS clone created and mounted successfully"
 fi
 
+# Limit the data the branch can hold, including what it shares with the restore, so it can't fill the pool
+if ! sudo zfs set refquota="${QUOTA}" reservation="${RESERVATION}" "${BRANCH_DATASET}"; then
+    echo "BRANCHD_ERROR: Failed to set ZFS quota (refquota=${QUOTA}, reservation=${RESERVATION})"
+    exit 1
+fi
+
+# Clone the WAL dataset when the restore keeps pg_wal on a separate device
+WAL_EXEC_START_PRE=""
+if [ -n "${WAL_DATASET_NAME}" ] && [ -L "${BRANCH_PGDATA}/pg_wal" ]; then
+    echo "Creating WAL snapshot and clone..."
+    if ! sudo zfs list -t snapshot "${WAL_DATASET_NAME}@${BRANCH_NAME}" >/dev/null 2>&1; then
+        sudo zfs snapshot "${WAL_DATASET_NAME}@${BRANCH_NAME}"
+    fi
+    if ! sudo zfs list "${BRANCH_WAL_DATASET}" >/dev/null 2>&1; then
+        sudo zfs clone -o mountpoint="${BRANCH_WAL_MOUNTPOINT}" -o org.openzfs.systemd:ignore=on "${WAL_DATASET_NAME}@${BRANCH_NAME}" "${BRANCH_WAL_DATASET}"
+    fi
+    if [ "$(sudo zfs get -H -o value mounted ${BRANCH_WAL_DATASET})" != "yes" ]; then
+        sudo mkdir -p "${BRANCH_WAL_MOUNTPOINT}"
+        if ! sudo zfs mount "${BRANCH_WAL_DATASET}"; then
+            echo "BRANCHD_ERROR: Failed to mount WAL clone"
+            exit 1
+        fi
+    fi
+
+    # Point the branch's pg_wal at its own WAL clone instead of the restore's
+    sudo -u postgres ln -sfn "${BRANCH_WAL_MOUNTPOINT}/pg_wal" "${BRANCH_PGDATA}/pg_wal"
+    sudo chown postgres:postgres -R "${BRANCH_WAL_MOUNTPOINT}"
+    WAL_EXEC_START_PRE="ExecStartPre=+/usr/bin/sh -c '/usr/sbin/zfs mount ${BRANCH_WAL_DATASET} 2>/dev/null || true'"
+    echo "WAL clone created and mounted at ${BRANCH_WAL_MOUNTPOINT}"
+fi
+
 # Clean up PostgreSQL files in the clone
 echo "Cleaning up PostgreSQL files..."
 sudo -u postgres rm -f "${BRANCH_PGDATA}/postmaster.pid"
@@ -299,22 +370,19 @@ sudo -u postgres sed -i "s|^#*hba_file = .*|hba_file = '${BRANCH_PGDATA}/pg_hba.
 # CRITICAL: Point ident_file to the branch's pg_ident.conf
 sudo -u postgres sed -i "s|^#*ident_file = .*|ident_file = '${BRANCH_PGDATA}/pg_ident.conf'|" "${BRANCH_PGDATA}/postgresql.conf"
 
+# Enforce connection limit from the branch's resource profile
+if [ -n "${MAX_CONNECTIONS}" ]; then
+    echo "Enforcing max_connections = ${MAX_CONNECTIONS}"
+    if sudo -u postgres grep -q "^#*max_connections\s*=" "${BRANCH_PGDATA}/postgresql.conf"; then
+        sudo -u postgres sed -i "s/^#*max_connections\s*=.*/max_connections = ${MAX_CONNECTIONS}/" "${BRANCH_PGDATA}/postgresql.conf"
+    else
+        echo "max_connections = ${MAX_CONNECTIONS}" | sudo -u postgres tee -a "${BRANCH_PGDATA}/postgresql.conf" > /dev/null
+    fi
+fi
+
 # Update pg_hba.conf for security
 echo "Updating pg_hba.conf for security..."
-sudo -u postgres tee "${BRANCH_PGDATA}/pg_hba.conf" > /dev/null << EOF
-# TYPE  DATABASE        USER            ADDRESS                 METHOD
-
-# Allow local socket connections
-local   all             all                                     peer
-
-# Require SSL for generated user (without client certificates)
-hostssl all             ${USER}         0.0.0.0/0               scram-sha-256
-hostssl all             ${USER}         ::/0                    scram-sha-256
-
-# Deny all other connections
-host    all             all             0.0.0.0/0               reject
-host    all             all             ::/0                    reject
-EOF
+echo "${HBA_CONF}" | base64 -d | sudo -u postgres tee "${BRANCH_PGDATA}/pg_hba.conf" > /dev/null
 
 sudo chown postgres:postgres -R "${BRANCH_MOUNTPOINT}"
 
@@ -325,13 +393,16 @@ PG_CTL_PATH="/usr/lib/postgresql/${PG_VERSION}/bin/pg_ctl"
 sudo tee "/etc/systemd/system/${SERVICE_NAME}.service" > /dev/null << EOF
 [Unit]
 Description=Branchd Branch (${BRANCH_NAME})
-After=network.target
+# Started on boot once the pool is imported, so branches survive host reboots
+Wants=zfs-import.target
+After=network.target zfs-import.target zfs-mount.service
 
 [Service]
 Type=forking
 User=postgres
 # Ensure ZFS mount is present before starting PostgreSQL (run as root with +)
-ExecStartPre=+/usr/bin/sh -c '/usr/sbin/zfs mount tank/${BRANCH_NAME} 2>/dev/null || true'
+ExecStartPre=+/usr/bin/sh -c '/usr/sbin/zfs mount ${BRANCH_DATASET} 2>/dev/null || true'
+${WAL_EXEC_START_PRE}
 ExecStart=${PG_CTL_PATH} start -D ${BRANCH_PGDATA} -l ${BRANCH_PGDATA}/postgresql.log
 ExecStop=${PG_CTL_PATH} stop -D ${BRANCH_PGDATA} -m immediate
 ExecReload=/bin/kill -HUP \$MAINPID
@@ -341,6 +412,8 @@ TimeoutStartSec=30
 TimeoutStopSec=30
 Restart=on-failure
 RestartSec=5s
+# Resource limits (cgroup) from the branch's resource profile
+${RESOURCE_DIRECTIVES}
 
 [Install]
 WantedBy=multi-user.target
@@ -374,12 +447,12 @@ sudo systemctl daemon-reload
 # Verify ZFS mount is still present after daemon-reload
 # (daemon-reload can sometimes trigger mount/umount events)
 echo "Verifying ZFS mount after daemon-reload..."
-if [ "$(sudo zfs get -H -o value mounted tank/${BRANCH_NAME})" != "yes" ]; then
+if [ "$(sudo zfs get -H -o value mounted ${BRANCH_DATASET})" != "yes" ]; then
     echo "WARNING: ZFS mount was unmounted during daemon-reload, remounting..."
-    sudo zfs mount "tank/${BRANCH_NAME}"
+    sudo zfs mount "${BRANCH_DATASET}"
 
     # Verify mount succeeded
-    if [ "$(sudo zfs get -H -o value mounted tank/${BRANCH_NAME})" != "yes" ]; then
+    if [ "$(sudo zfs get -H -o value mounted ${BRANCH_DATASET})" != "yes" ]; then
         echo "BRANCHD_ERROR: Failed to remount ZFS dataset after daemon-reload"
         exit 1
     fi
@@ -407,11 +480,11 @@ if ! sudo systemctl is-active --quiet "${SERVICE_NAME}" 2>/dev/null; then
     # Final mount verification right before starting service
     # (systemctl operations can trigger unmount)
     echo "Final mount verification before starting service..."
-    if [ "$(sudo zfs get -H -o value mounted tank/${BRANCH_NAME})" != "yes" ]; then
+    if [ "$(sudo zfs get -H -o value mounted ${BRANCH_DATASET})" != "yes" ]; then
         echo "WARNING: ZFS mount was unmounted before service start, remounting..."
-        sudo zfs mount "tank/${BRANCH_NAME}"
+        sudo zfs mount "${BRANCH_DATASET}"
 
-        if [ "$(sudo zfs get -H -o value mounted tank/${BRANCH_NAME})" != "yes" ]; then
+        if [ "$(sudo zfs get -H -o value mounted ${BRANCH_DATASET})" != "yes" ]; then
             echo "BRANCHD_ERROR: Failed to remount ZFS dataset before service start"
             exit 1
         fi
@@ -423,10 +496,10 @@ if ! sudo systemctl is-active --quiet "${SERVICE_NAME}" 2>/dev/null; then
     # Force remount to ensure it stays mounted during systemctl start
     # (systemctl can unmount ZFS datasets even with org.openzfs.systemd:ignore=on)
     echo "Force remounting to ensure stability..."
-    sudo zfs unmount "tank/${BRANCH_NAME}" 2>/dev/null || true
-    sudo zfs mount "tank/${BRANCH_NAME}"
+    sudo zfs unmount "${BRANCH_DATASET}" 2>/dev/null || true
+    sudo zfs mount "${BRANCH_DATASET}"
 
-    if [ "$(sudo zfs get -H -o value mounted tank/${BRANCH_NAME})" != "yes" ]; then
+    if [ "$(sudo zfs get -H -o value mounted ${BRANCH_DATASET})" != "yes" ]; then
         echo "BRANCHD_ERROR: Mount verification failed after force remount"
         exit 1
     fi
@@ -477,10 +550,24 @@ if ! wait_for_postgres "${AVAILABLE_PORT}"; then
 fi
 
 # Create database user with full privileges
+# The user of a break-glass branch reads and writes all data without being a superuser, so it can't turn off the
+# enforced statement logging (log_statement and friends can only be changed by superusers)
 echo "Creating database user '${USER}'..."
-if ! sudo -u postgres psql -p "${AVAILABLE_PORT}" -c "
-    CREATE USER \"${USER}\" WITH PASSWORD '${PASSWORD}' SUPERUSER;
-"; then
+if [ "${BREAK_GLASS}" = "true" ]; then
+    USER_SQL=$(cat <<'SQL'
+CREATE USER :"user" WITH PASSWORD :'password' NOSUPERUSER NOCREATEROLE;
+GRANT pg_read_all_data, pg_write_all_data TO :"user";
+SQL
+)
+else
+    USER_SQL=$(cat <<'SQL'
+CREATE USER :"user" WITH PASSWORD :'password' SUPERUSER;
+SQL
+)
+fi
+# Values are psql variables quoted by psql (:"name" as an identifier, :'name' as a literal), never spliced into SQL
+if ! sudo -u postgres psql -X -v ON_ERROR_STOP=1 -p "${AVAILABLE_PORT}" -v user="${USER}" -v password="${PASSWORD}" <<< "${USER_SQL}"
+then
     echo "BRANCHD_ERROR: Failed to create user '${USER}' (see error above)"
     exit 1
 fi
@@ -543,6 +630,18 @@ else
     echo "DEBUG: No custom PostgreSQL configuration provided"
 fi
 
+# Create the configured extensions (usually inherited from the restore, added here when the setting changed since)
+for ext in ${EXTENSIONS}; do
+    echo "Creating extension ${ext}..."
+    if ! sudo -u postgres psql -X -v ON_ERROR_STOP=1 -p "${AVAILABLE_PORT}" -d "${DATABASE_NAME}" -v ext="${ext}" <<'SQL'
+CREATE EXTENSION IF NOT EXISTS :"ext";
+SQL
+    then
+        echo "BRANCHD_ERROR: Failed to create extension ${ext} (see error above)"
+        exit 1
+    fi
+done
+
 echo "USER_CREATION_SUCCESS=true"
 
 # Output port for Go code to parse
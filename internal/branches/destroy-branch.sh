@@ -11,18 +11,23 @@ set -eu  # Exit on error and undefined variables, but no pipefail
 # 3. Kill any remaining PostgreSQL processes
 # 4. Destroy ZFS clone
 # 5. Destroy ZFS snapshot (with -R for recursive cleanup)
-# 6. Close UFW port
-# 7. Output success marker
+# 6. Destroy WAL clone and snapshot (if pg_wal lives on a separate dataset)
+# 7. Close UFW port
+# 8. Output success marker
 
 # Immediate output so we know script started
 echo "BRANCH_DELETION_STARTED=true"
 
-# Input parameters
-BRANCH_NAME="{{.BranchName}}"
-DATASET_NAME="{{.DatasetName}}"
+# Input parameters, passed in the environment (never rendered into the script)
+BRANCH_NAME="${BRANCH_NAME}"
+DATASET_NAME="${DATASET_NAME}"
+WAL_DATASET_NAME="${WAL_DATASET_NAME}"
+BRANCH_DATASET="${BRANCH_DATASET}"
+BRANCH_MOUNTPOINT="${BRANCH_MOUNTPOINT}"
+BRANCH_WAL_DATASET="${BRANCH_WAL_DATASET}"
+BRANCH_WAL_MOUNTPOINT="${BRANCH_WAL_MOUNTPOINT}"
 
 # Configuration
-BRANCH_MOUNTPOINT="/opt/branchd/${BRANCH_NAME}"
 BRANCH_PGDATA="${BRANCH_MOUNTPOINT}/main"
 SERVICE_NAME="branchd-branch-${BRANCH_NAME}"
 
@@ -44,6 +49,8 @@ if systemctl list-unit-files "${SERVICE_NAME}.service" 2>/dev/null | grep -q .;
     sudo systemctl stop "${SERVICE_NAME}" 2>/dev/null || true
     sudo systemctl disable "${SERVICE_NAME}" 2>/dev/null || true
     sudo rm -f "/etc/systemd/system/${SERVICE_NAME}.service"
+    # Drop-ins written by the worker (boot ordering)
+    sudo rm -rf "/etc/systemd/system/${SERVICE_NAME}.service.d"
     sudo systemctl daemon-reload
     echo "Service stopped and removed"
 else
@@ -66,10 +73,10 @@ else
 fi
 
 # Unmount ZFS clone if still mounted
-echo "Unmounting ZFS clone tank/${BRANCH_NAME}..."
-if sudo zfs list "tank/${BRANCH_NAME}" >/dev/null 2>&1; then
-    if sudo zfs get -H -o value mounted "tank/${BRANCH_NAME}" | grep -q "yes"; then
-        if sudo zfs unmount "tank/${BRANCH_NAME}" 2>&1; then
+echo "Unmounting ZFS clone ${BRANCH_DATASET}..."
+if sudo zfs list "${BRANCH_DATASET}" >/dev/null 2>&1; then
+    if sudo zfs get -H -o value mounted "${BRANCH_DATASET}" | grep -q "yes"; then
+        if sudo zfs unmount "${BRANCH_DATASET}" 2>&1; then
             echo "Clone unmounted"
         else
             echo "BRANCHD_ERROR: Failed to unmount ZFS clone (see error above)"
@@ -80,10 +87,20 @@ if sudo zfs list "tank/${BRANCH_NAME}" >/dev/null 2>&1; then
     fi
 fi
 
+# Snapshot the clone was created from, usually ${DATASET_NAME}@${BRANCH_NAME}
+# WHY: Promoting another branch of the restore (zfs promote) moves older snapshots to the promoted dataset
+SNAPSHOT="${DATASET_NAME}@${BRANCH_NAME}"
+if sudo zfs list "${BRANCH_DATASET}" >/dev/null 2>&1; then
+    ORIGIN=$(sudo zfs get -H -o value origin "${BRANCH_DATASET}" 2>/dev/null || echo "-")
+    if [ -n "${ORIGIN}" ] && [ "${ORIGIN}" != "-" ]; then
+        SNAPSHOT="${ORIGIN}"
+    fi
+fi
+
 # Destroy ZFS clone
-echo "Destroying ZFS clone tank/${BRANCH_NAME}..."
-if sudo zfs list "tank/${BRANCH_NAME}" >/dev/null 2>&1; then
-    if sudo zfs destroy "tank/${BRANCH_NAME}" 2>&1; then
+echo "Destroying ZFS clone ${BRANCH_DATASET}..."
+if sudo zfs list "${BRANCH_DATASET}" >/dev/null 2>&1; then
+    if sudo zfs destroy "${BRANCH_DATASET}" 2>&1; then
         echo "Clone destroyed"
     else
         echo "BRANCHD_ERROR: Failed to destroy ZFS clone (see error above)"
@@ -94,9 +111,9 @@ else
 fi
 
 # Destroy ZFS snapshot with recursive flag
-echo "Destroying ZFS snapshot ${DATASET_NAME}@${BRANCH_NAME}..."
-if sudo zfs list -t snapshot "${DATASET_NAME}@${BRANCH_NAME}" >/dev/null 2>&1; then
-    if sudo zfs destroy -R "${DATASET_NAME}@${BRANCH_NAME}" 2>&1; then
+echo "Destroying ZFS snapshot ${SNAPSHOT}..."
+if sudo zfs list -t snapshot "${SNAPSHOT}" >/dev/null 2>&1; then
+    if sudo zfs destroy -R "${SNAPSHOT}" 2>&1; then
         echo "Snapshot destroyed"
     else
         echo "BRANCHD_ERROR: Failed to destroy ZFS snapshot (see error above)"
@@ -113,10 +130,44 @@ if [ -d "${BRANCH_MOUNTPOINT}" ]; then
     echo "Mountpoint directory removed"
 fi
 
+# Destroy WAL clone and snapshot
+if [ -n "${WAL_DATASET_NAME}" ]; then
+    WAL_SNAPSHOT="${WAL_DATASET_NAME}@${BRANCH_NAME}"
+    if sudo zfs list "${BRANCH_WAL_DATASET}" >/dev/null 2>&1; then
+        WAL_ORIGIN=$(sudo zfs get -H -o value origin "${BRANCH_WAL_DATASET}" 2>/dev/null || echo "-")
+        if [ -n "${WAL_ORIGIN}" ] && [ "${WAL_ORIGIN}" != "-" ]; then
+            WAL_SNAPSHOT="${WAL_ORIGIN}"
+        fi
+    fi
+
+    echo "Destroying WAL clone ${BRANCH_WAL_DATASET}..."
+    if sudo zfs list "${BRANCH_WAL_DATASET}" >/dev/null 2>&1; then
+        if sudo zfs destroy "${BRANCH_WAL_DATASET}" 2>&1; then
+            echo "WAL clone destroyed"
+        else
+            echo "BRANCHD_ERROR: Failed to destroy WAL clone (see error above)"
+            exit 1
+        fi
+    else
+        echo "WAL clone not found, skipping"
+    fi
+
+    if sudo zfs list -t snapshot "${WAL_SNAPSHOT}" >/dev/null 2>&1; then
+        sudo zfs destroy -R "${WAL_SNAPSHOT}" 2>&1 || echo "Warning: Failed to destroy WAL snapshot"
+    fi
+
+    if [ -d "${BRANCH_WAL_MOUNTPOINT}" ]; then
+        sudo rmdir "${BRANCH_WAL_MOUNTPOINT}" 2>/dev/null || sudo rm -rf "${BRANCH_WAL_MOUNTPOINT}"
+    fi
+fi
+
 # Close UFW port
 if [ -n "$PORT" ]; then
     echo "Closing UFW port ${PORT}..."
-    sudo ufw --force delete allow "${PORT}/tcp" 2>/dev/null || true
+    # Every rule of the port, the branch's allowed networks have one each (see applyFirewall)
+    for rule in $(sudo ufw status numbered | sed -n "s/^\[ *\([0-9]*\)\] ${PORT}\/tcp .*/\1/p" | sort -rn); do
+        sudo ufw --force delete "${rule}" >/dev/null 2>&1 || true
+    done
     echo "Port closed"
 else
     echo "No port found, skipping UFW cleanup"
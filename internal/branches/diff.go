@@ -0,0 +1,280 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// ErrDiffUnavailable is returned when the branch or its restore can't be queried
+var ErrDiffUnavailable = errors.New("diff not available")
+
+// SchemaChange is a schema object that differs between a branch and its restore
+type SchemaChange struct {
+	Kind   string `json:"kind"`             // table, column, index, constraint, trigger, view or function
+	Name   string `json:"name"`             // Schema-qualified, columns, constraints and triggers prefixed with their table
+	Change string `json:"change"`           // added, removed or changed on the branch
+	Before string `json:"before,omitempty"` // Definition in the restore
+	After  string `json:"after,omitempty"`  // Definition in the branch
+}
+
+// RowCountChange is a table whose row count differs between a branch and its restore
+type RowCountChange struct {
+	Table       string `json:"table"`
+	RestoreRows *int64 `json:"restore_rows"` // nil if the branch added the table
+	BranchRows  *int64 `json:"branch_rows"`  // nil if the branch dropped the table
+	Delta       int64  `json:"delta"`
+	Estimated   bool   `json:"estimated"` // Planner estimate on either side (tables of over a million rows)
+}
+
+// BranchDiff compares a branch against the current state of its restore
+type BranchDiff struct {
+	BranchID       string           `json:"branch_id"`
+	BranchName     string           `json:"branch_name"`
+	RestoreID      string           `json:"restore_id"`
+	RestoreName    string           `json:"restore_name"`
+	SchemaChanges  []SchemaChange   `json:"schema_changes"`
+	RowCounts      []RowCountChange `json:"row_counts"`
+	TablesCompared int              `json:"tables_compared"` // Tables in both, unchanged ones aren't listed in RowCounts
+	ComparedAt     time.Time        `json:"compared_at"`
+}
+
+// diffCatalogQuery returns one kind|table|name|definition line per schema object and row count
+// Definitions have whitespace collapsed so they fit a line. Rows of tables estimated at over a million are
+// not counted (that would take longer than a developer waits for a diff), the estimate is returned as "~n"
+const diffCatalogQuery = `WITH rels AS (
+	SELECT c.oid, c.relkind, c.reltuples, n.nspname, c.relname, n.nspname || '.' || c.relname AS qualified
+	FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p', 'v', 'm') AND n.nspname !~ '^pg_' AND n.nspname <> 'information_schema'
+)
+SELECT 'table|' || qualified || '|' || qualified || '|' FROM rels WHERE relkind IN ('r', 'p')
+UNION ALL
+SELECT 'view||' || qualified || '|' || regexp_replace(pg_get_viewdef(oid), '\s+', ' ', 'g') FROM rels WHERE relkind IN ('v', 'm')
+UNION ALL
+SELECT 'column|' || r.qualified || '|' || r.qualified || '.' || a.attname || '|' || format_type(a.atttypid, a.atttypmod)
+	|| CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END || COALESCE(' DEFAULT ' || pg_get_expr(d.adbin, d.adrelid), '')
+FROM rels r
+JOIN pg_attribute a ON a.attrelid = r.oid AND a.attnum > 0 AND NOT a.attisdropped
+LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE r.relkind IN ('r', 'p')
+UNION ALL
+SELECT 'index|' || r.qualified || '|' || r.nspname || '.' || i.relname || '|' || pg_get_indexdef(x.indexrelid)
+FROM pg_index x JOIN pg_class i ON i.oid = x.indexrelid JOIN rels r ON r.oid = x.indrelid
+UNION ALL
+SELECT 'constraint|' || r.qualified || '|' || r.qualified || '.' || con.conname || '|' || pg_get_constraintdef(con.oid)
+FROM pg_constraint con JOIN rels r ON r.oid = con.conrelid
+UNION ALL
+SELECT 'trigger|' || r.qualified || '|' || r.qualified || '.' || t.tgname || '|' || pg_get_triggerdef(t.oid)
+FROM pg_trigger t JOIN rels r ON r.oid = t.tgrelid WHERE NOT t.tgisinternal
+UNION ALL
+SELECT 'function||' || n.nspname || '.' || p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')|'
+	|| regexp_replace(pg_get_functiondef(p.oid), '\s+', ' ', 'g')
+FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+WHERE p.prokind IN ('f', 'p') AND n.nspname !~ '^pg_' AND n.nspname <> 'information_schema'
+	AND NOT EXISTS (SELECT 1 FROM pg_depend dep WHERE dep.classid = 'pg_proc'::regclass AND dep.objid = p.oid AND dep.deptype = 'e')
+UNION ALL
+SELECT 'rows|' || qualified || '|' || qualified || '|' || CASE WHEN reltuples < 1000000 THEN
+	(xpath('/row/c/text()', query_to_xml(format('SELECT count(*) AS c FROM %I.%I', nspname, relname), false, true, '')))[1]::text
+	ELSE '~' || reltuples::bigint END
+FROM rels WHERE relkind = 'r'`
+
+// queryDiffCatalog runs diffCatalogQuery against the database of the cluster on port (replaced in tests)
+var queryDiffCatalog = func(ctx context.Context, port int, database string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sudo", "-u", "postgres", "psql", "-X", "-At", "-v", "ON_ERROR_STOP=1", "-p", strconv.Itoa(port), "-d", database, "-c", diffCatalogQuery)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("failed to query catalog: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to query catalog: %w", err)
+	}
+	return string(output), nil
+}
+
+// catalogObject is one line of diffCatalogQuery's output
+type catalogObject struct {
+	kind       string
+	table      string // Table the object belongs to (the table itself for tables), empty for views and functions
+	name       string
+	definition string
+}
+
+// catalog holds the schema objects (keyed by kind and name) and row counts of one side of a diff
+type catalog struct {
+	objects map[string]catalogObject
+	rows    map[string]rowCount
+}
+
+type rowCount struct {
+	rows      int64
+	estimated bool
+}
+
+// DiffBranch compares the schema and per-table row counts of a branch against its restore
+// The restore is compared as it is now, a refresh since the branch was created shows up as changes too.
+// A suspended branch is resumed first
+func (s *Service) DiffBranch(ctx context.Context, branch *models.Branch) (*BranchDiff, error) {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var restore models.Restore
+	if err := s.db.Where("id = ?", branch.RestoreID).First(&restore).Error; err != nil {
+		return nil, fmt.Errorf("failed to load restore: %w", err)
+	}
+	if branch.Port == 0 {
+		return nil, fmt.Errorf("%w: branch %s has no running cluster", ErrDiffUnavailable, branch.Name)
+	}
+	if restore.ReadyAt == nil || restore.Port == 0 {
+		return nil, fmt.Errorf("%w: restore %s is not ready", ErrDiffUnavailable, restore.Name)
+	}
+
+	if branch.SuspendedAt != nil {
+		if err := s.ResumeBranch(ctx, branch.ID); err != nil {
+			return nil, fmt.Errorf("failed to resume branch: %w", err)
+		}
+	}
+
+	database := branchDatabaseName(&config)
+	restoreOutput, err := queryDiffCatalog(ctx, restore.Port, database)
+	if err != nil {
+		return nil, fmt.Errorf("%w: restore %s: %v", ErrDiffUnavailable, restore.Name, err)
+	}
+	branchOutput, err := queryDiffCatalog(ctx, branch.Port, database)
+	if err != nil {
+		return nil, fmt.Errorf("%w: branch %s: %v", ErrDiffUnavailable, branch.Name, err)
+	}
+
+	before, err := parseCatalog(restoreOutput)
+	if err != nil {
+		return nil, err
+	}
+	after, err := parseCatalog(branchOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := compareCatalogs(before, after)
+	diff.BranchID = branch.ID
+	diff.BranchName = branch.Name
+	diff.RestoreID = restore.ID
+	diff.RestoreName = restore.Name
+	diff.ComparedAt = time.Now()
+	return diff, nil
+}
+
+// parseCatalog parses the output of diffCatalogQuery
+func parseCatalog(output string) (*catalog, error) {
+	c := &catalog{objects: map[string]catalogObject{}, rows: map[string]rowCount{}}
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "|", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected catalog line %q", line)
+		}
+		object := catalogObject{kind: fields[0], table: fields[1], name: fields[2], definition: fields[3]}
+
+		if object.kind == "rows" {
+			count := rowCount{}
+			value := object.definition
+			if strings.HasPrefix(value, "~") {
+				count.estimated = true
+				value = value[1:]
+			}
+			rows, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected row count of %s: %q", object.name, object.definition)
+			}
+			count.rows = rows
+			c.rows[object.name] = count
+			continue
+		}
+		c.objects[object.kind+"|"+object.name] = object
+	}
+	return c, nil
+}
+
+// schemaKindOrder sorts schema changes so tables come before what they contain
+var schemaKindOrder = map[string]int{"table": 0, "column": 1, "constraint": 2, "index": 3, "trigger": 4, "view": 5, "function": 6}
+
+// compareCatalogs lists what the branch (after) changed compared to the restore (before)
+// Objects of added or dropped tables are left out, the table change covers them
+func compareCatalogs(before, after *catalog) *BranchDiff {
+	diff := &BranchDiff{SchemaChanges: []SchemaChange{}, RowCounts: []RowCountChange{}}
+
+	addedTables, droppedTables := map[string]bool{}, map[string]bool{}
+	for key, object := range after.objects {
+		if _, ok := before.objects[key]; !ok && object.kind == "table" {
+			addedTables[object.name] = true
+		}
+	}
+	for key, object := range before.objects {
+		if _, ok := after.objects[key]; !ok && object.kind == "table" {
+			droppedTables[object.name] = true
+		}
+	}
+	coveredByTable := func(object catalogObject) bool {
+		return object.kind != "table" && (addedTables[object.table] || droppedTables[object.table])
+	}
+
+	for key, object := range after.objects {
+		previous, ok := before.objects[key]
+		switch {
+		case coveredByTable(object):
+		case !ok:
+			diff.SchemaChanges = append(diff.SchemaChanges, SchemaChange{Kind: object.kind, Name: object.name, Change: "added", After: object.definition})
+		case previous.definition != object.definition:
+			diff.SchemaChanges = append(diff.SchemaChanges, SchemaChange{Kind: object.kind, Name: object.name, Change: "changed", Before: previous.definition, After: object.definition})
+		}
+	}
+	for key, object := range before.objects {
+		if _, ok := after.objects[key]; ok || coveredByTable(object) {
+			continue
+		}
+		diff.SchemaChanges = append(diff.SchemaChanges, SchemaChange{Kind: object.kind, Name: object.name, Change: "removed", Before: object.definition})
+	}
+	sort.Slice(diff.SchemaChanges, func(i, j int) bool {
+		a, b := diff.SchemaChanges[i], diff.SchemaChanges[j]
+		if a.Kind != b.Kind {
+			return schemaKindOrder[a.Kind] < schemaKindOrder[b.Kind]
+		}
+		return a.Name < b.Name
+	})
+
+	for table, branchCount := range after.rows {
+		branchRows := branchCount.rows
+		change := RowCountChange{Table: table, BranchRows: &branchRows, Delta: branchRows, Estimated: branchCount.estimated}
+		if restoreCount, ok := before.rows[table]; ok {
+			diff.TablesCompared++
+			if restoreCount.rows == branchCount.rows {
+				continue
+			}
+			restoreRows := restoreCount.rows
+			change.RestoreRows = &restoreRows
+			change.Delta = branchRows - restoreRows
+			change.Estimated = change.Estimated || restoreCount.estimated
+		}
+		diff.RowCounts = append(diff.RowCounts, change)
+	}
+	for table, restoreCount := range before.rows {
+		if _, ok := after.rows[table]; ok {
+			continue
+		}
+		restoreRows := restoreCount.rows
+		diff.RowCounts = append(diff.RowCounts, RowCountChange{Table: table, RestoreRows: &restoreRows, Delta: -restoreRows, Estimated: restoreCount.estimated})
+	}
+	sort.Slice(diff.RowCounts, func(i, j int) bool { return diff.RowCounts[i].Table < diff.RowCounts[j].Table })
+
+	return diff
+}
@@ -0,0 +1,139 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+const restoreCatalog = `table|public.users|public.users|
+column|public.users|public.users.id|bigint NOT NULL
+column|public.users|public.users.email|text
+index|public.users|public.users_email_idx|CREATE INDEX users_email_idx ON public.users USING btree (email)
+table|public.legacy|public.legacy|
+column|public.legacy|public.legacy.id|bigint
+table|public.events|public.events|
+view||public.active_users|SELECT users.id FROM users;
+rows|public.users|public.users|100
+rows|public.legacy|public.legacy|3
+rows|public.events|public.events|~5000000
+`
+
+const branchCatalog = `table|public.users|public.users|
+column|public.users|public.users.id|bigint NOT NULL
+column|public.users|public.users.email|text NOT NULL
+column|public.users|public.users.nickname|text
+index|public.users|public.users_email_idx|CREATE UNIQUE INDEX users_email_idx ON public.users USING btree (email)
+table|public.orders|public.orders|
+column|public.orders|public.orders.id|bigint
+table|public.events|public.events|
+view||public.active_users|SELECT users.id FROM users;
+rows|public.users|public.users|112
+rows|public.orders|public.orders|0
+rows|public.events|public.events|~5000000
+`
+
+func TestDiffBranch(t *testing.T) {
+	s, restore := newTestService(t)
+	if err := s.db.Model(&models.Config{}).Where("1 = 1").Update("connection_string", "postgres://source/app").Error; err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001}
+	createTestBranch(t, s, branch)
+
+	original := queryDiffCatalog
+	t.Cleanup(func() { queryDiffCatalog = original })
+	queried := map[int]string{}
+	queryDiffCatalog = func(ctx context.Context, port int, database string) (string, error) {
+		queried[port] = database
+		if port == branch.Port {
+			return branchCatalog, nil
+		}
+		return restoreCatalog, nil
+	}
+
+	diff, err := s.DiffBranch(context.Background(), branch)
+	if err != nil {
+		t.Fatalf("DiffBranch() error = %v", err)
+	}
+	if queried[restore.Port] != "app" || queried[branch.Port] != "app" {
+		t.Errorf("queried %v, want the app database of restore and branch", queried)
+	}
+	if diff.BranchName != "feature-x" || diff.RestoreName != restore.Name {
+		t.Errorf("diff of %s vs %s, want feature-x vs %s", diff.BranchName, diff.RestoreName, restore.Name)
+	}
+
+	// Columns of the added and dropped tables are covered by the table changes
+	wantSchema := []SchemaChange{
+		{Kind: "table", Name: "public.legacy", Change: "removed"},
+		{Kind: "table", Name: "public.orders", Change: "added"},
+		{Kind: "column", Name: "public.users.email", Change: "changed", Before: "text", After: "text NOT NULL"},
+		{Kind: "column", Name: "public.users.nickname", Change: "added", After: "text"},
+		{Kind: "index", Name: "public.users_email_idx", Change: "changed",
+			Before: "CREATE INDEX users_email_idx ON public.users USING btree (email)",
+			After:  "CREATE UNIQUE INDEX users_email_idx ON public.users USING btree (email)"},
+	}
+	if len(diff.SchemaChanges) != len(wantSchema) {
+		t.Fatalf("SchemaChanges = %+v, want %+v", diff.SchemaChanges, wantSchema)
+	}
+	for i := range wantSchema {
+		if diff.SchemaChanges[i] != wantSchema[i] {
+			t.Errorf("SchemaChanges[%d] = %+v, want %+v", i, diff.SchemaChanges[i], wantSchema[i])
+		}
+	}
+
+	if diff.TablesCompared != 2 {
+		t.Errorf("TablesCompared = %d, want 2", diff.TablesCompared)
+	}
+	if len(diff.RowCounts) != 3 {
+		t.Fatalf("RowCounts = %+v, want legacy, orders and users", diff.RowCounts)
+	}
+	legacy, orders, users := diff.RowCounts[0], diff.RowCounts[1], diff.RowCounts[2]
+	if legacy.Table != "public.legacy" || legacy.BranchRows != nil || *legacy.RestoreRows != 3 || legacy.Delta != -3 {
+		t.Errorf("legacy = %+v, want dropped with 3 rows", legacy)
+	}
+	if orders.Table != "public.orders" || orders.RestoreRows != nil || *orders.BranchRows != 0 || orders.Delta != 0 {
+		t.Errorf("orders = %+v, want added and empty", orders)
+	}
+	if users.Table != "public.users" || *users.RestoreRows != 100 || *users.BranchRows != 112 || users.Delta != 12 || users.Estimated {
+		t.Errorf("users = %+v, want 100 -> 112 counted", users)
+	}
+}
+
+func TestDiffBranchUnavailable(t *testing.T) {
+	s, restore := newTestService(t)
+	notCreated := &models.Branch{Name: "not-created", RestoreID: restore.ID}
+	createTestBranch(t, s, notCreated)
+	if _, err := s.DiffBranch(context.Background(), notCreated); !errors.Is(err, ErrDiffUnavailable) {
+		t.Errorf("DiffBranch() of a branch without cluster error = %v, want ErrDiffUnavailable", err)
+	}
+
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001}
+	createTestBranch(t, s, branch)
+	original := queryDiffCatalog
+	t.Cleanup(func() { queryDiffCatalog = original })
+	queryDiffCatalog = func(ctx context.Context, port int, database string) (string, error) {
+		return "", errors.New("failed to query catalog: connection refused")
+	}
+	if _, err := s.DiffBranch(context.Background(), branch); !errors.Is(err, ErrDiffUnavailable) {
+		t.Errorf("DiffBranch() with the restore down error = %v, want ErrDiffUnavailable", err)
+	}
+}
+
+func TestParseCatalog(t *testing.T) {
+	for _, output := range []string{"table|public.users", "rows|public.users|public.users|many"} {
+		if _, err := parseCatalog(output); err == nil {
+			t.Errorf("parseCatalog(%q) succeeded", output)
+		}
+	}
+
+	c, err := parseCatalog("rows|public.events|public.events|~5000000\n")
+	if err != nil {
+		t.Fatalf("parseCatalog() error = %v", err)
+	}
+	if got := c.rows["public.events"]; got.rows != 5000000 || !got.estimated {
+		t.Errorf("rows = %+v, want estimated 5000000", got)
+	}
+}
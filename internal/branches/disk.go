@@ -0,0 +1,304 @@
+package branches
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// DiskUsage is the ZFS space use of a branch's clone
+type DiskUsage struct {
+	UsedBytes        int64 // Space the branch wrote (blocks shared with the restore are not counted)
+	ReferencedBytes  int64 // Data the branch holds, including blocks shared with the restore
+	QuotaBytes       int64 // refquota on ReferencedBytes, 0 = no quota
+	ReservationBytes int64 // 0 = no reservation
+}
+
+// Disk quota states of a branch (Branch.DiskQuotaState)
+const (
+	DiskQuotaStateNone      = ""           // No quota
+	DiskQuotaStateOK        = "ok"         // Below the warning threshold
+	DiskQuotaStateNearLimit = "near_limit" // Holds at least diskQuotaWarnRatio of its quota
+	DiskQuotaStateExceeded  = "exceeded"   // At its quota, writes (including temp tables) fail
+)
+
+// Share of the quota at which a branch is reported near its limit, or over it
+// ZFS stops writes slightly below the quota, so "exceeded" starts just before 100%
+const (
+	diskQuotaWarnRatio     = 0.9
+	diskQuotaExceededRatio = 0.99
+)
+
+// QuotaState classifies the space use against the quota
+func (u DiskUsage) QuotaState() string {
+	if u.QuotaBytes <= 0 {
+		return DiskQuotaStateNone
+	}
+	ratio := float64(u.ReferencedBytes) / float64(u.QuotaBytes)
+	switch {
+	case ratio >= diskQuotaExceededRatio:
+		return DiskQuotaStateExceeded
+	case ratio >= diskQuotaWarnRatio:
+		return DiskQuotaStateNearLimit
+	default:
+		return DiskQuotaStateOK
+	}
+}
+
+// DiskUsage returns the space use of every dataset under the storage root, keyed by branch or restore name
+func (s *Service) DiskUsage(ctx context.Context) (map[string]DiskUsage, error) {
+	root := s.config.Storage.DatasetRoot
+	cmd := exec.CommandContext(ctx, "zfs", "list", "-H", "-p", "-d", "1", "-o", "name,used,referenced,refquota,reservation", root)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ZFS datasets: %w", err)
+	}
+	return parseDiskUsage(string(output), root)
+}
+
+// parseDiskUsage parses `zfs list -H -p -o name,used,referenced,refquota,reservation` output
+// The root dataset itself is skipped
+func parseDiskUsage(output, root string) (map[string]DiskUsage, error) {
+	usage := make(map[string]DiskUsage)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] == root {
+			continue
+		}
+
+		var values [4]int64
+		for i, field := range fields[1:] {
+			// Unset quota/reservation are "0" with -p, "-" on older ZFS versions
+			if field == "-" || field == "none" {
+				continue
+			}
+			value, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse ZFS size %q of %s: %w", field, fields[0], err)
+			}
+			values[i] = value
+		}
+
+		usage[path.Base(fields[0])] = DiskUsage{
+			UsedBytes:        values[0],
+			ReferencedBytes:  values[1],
+			QuotaBytes:       values[2],
+			ReservationBytes: values[3],
+		}
+	}
+	return usage, nil
+}
+
+// CheckDiskQuotas records the disk quota state of every branch, logging branches that reach their quota
+// so a runaway branch is noticed before its writes fail
+func (s *Service) CheckDiskQuotas(ctx context.Context) error {
+	usage, err := s.DiskUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	var branches []models.Branch
+	if err := s.db.Find(&branches).Error; err != nil {
+		return fmt.Errorf("failed to load branches: %w", err)
+	}
+
+	for _, branch := range branches {
+		branchUsage, ok := usage[branch.Name]
+		if !ok {
+			// Clone not created yet or already destroyed
+			continue
+		}
+		state := branchUsage.QuotaState()
+		if state == branch.DiskQuotaState {
+			continue
+		}
+
+		event := s.logger.Info()
+		if state == DiskQuotaStateNearLimit || state == DiskQuotaStateExceeded {
+			event = s.logger.Warn()
+		}
+		event.
+			Str("branch_name", branch.Name).
+			Str("disk_quota_state", state).
+			Str("previous_state", branch.DiskQuotaState).
+			Int64("used_bytes", branchUsage.UsedBytes).
+			Int64("quota_bytes", branchUsage.QuotaBytes).
+			Msg("Branch disk quota state changed")
+
+		if err := s.db.Model(&branch).Update("disk_quota_state", state).Error; err != nil {
+			s.logger.Warn().Err(err).Str("branch_name", branch.Name).Msg("Failed to record branch disk quota state")
+		}
+	}
+	return nil
+}
+
+// SetDiskQuota changes the ZFS refquota and reservation of a branch's clone (0 = none)
+func (s *Service) SetDiskQuota(ctx context.Context, branchID string, quotaGB, reservationGB int) (*models.Branch, error) {
+	var branch models.Branch
+	if err := s.db.Where("id = ?", branchID).First(&branch).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branch: %w", err)
+	}
+
+	limits := branch.ResourceLimits
+	limits.DiskQuotaGB = quotaGB
+	limits.DiskReservationGB = reservationGB
+	if err := ValidateResourceLimits(limits); err != nil {
+		return nil, err
+	}
+
+	dataset := s.config.Storage.DatasetName(branch.Name)
+	cmd := exec.CommandContext(ctx, "sudo", "zfs", "set",
+		"refquota="+formatZFSSize(quotaGB),
+		"reservation="+formatZFSSize(reservationGB),
+		dataset)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("branch_id", branch.ID).
+			Str("output", string(output)).
+			Msg("Failed to set branch disk quota")
+		return nil, fmt.Errorf("failed to set disk quota: %s", strings.TrimSpace(string(output)))
+	}
+
+	branch.ResourceLimits = limits
+	if err := s.db.Model(&branch).Select("ResourceLimits").Updates(&branch).Error; err != nil {
+		return nil, fmt.Errorf("failed to store disk quota: %w", err)
+	}
+
+	s.logger.Info().
+		Str("branch_id", branch.ID).
+		Int("disk_quota_gb", quotaGB).
+		Int("disk_reservation_gb", reservationGB).
+		Msg("Branch disk quota updated")
+
+	return &branch, nil
+}
+
+// BranchUsage is the detailed ZFS space use of a branch
+type BranchUsage struct {
+	BranchID         string  `json:"branch_id"`
+	BranchName       string  `json:"branch_name"`
+	ReferencedBytes  int64   `json:"referenced_bytes"`   // Data the branch sees, including what it shares with the restore
+	UsedBytes        int64   `json:"used_bytes"`         // Space the branch wrote, freed when it's deleted
+	LogicalUsedBytes int64   `json:"logical_used_bytes"` // UsedBytes before compression
+	CompressRatio    float64 `json:"compress_ratio"`     // e.g. 2.5 = data takes 40% of its logical size
+	QuotaBytes       int64   `json:"quota_bytes"`        // refquota on ReferencedBytes, 0 = no quota
+	ReservationBytes int64   `json:"reservation_bytes"`  // 0 = no reservation
+	WALUsedBytes     int64   `json:"wal_used_bytes"`     // Space of the separate WAL clone, 0 if WAL is inside the data directory
+	QuotaState       string  `json:"quota_state"`        // ok, near_limit or exceeded, empty without quota
+}
+
+// StorageUsage aggregates the space use of the data pool
+type StorageUsage struct {
+	UsedBytes         int64   `json:"used_bytes"`
+	AvailableBytes    int64   `json:"available_bytes"`
+	CompressRatio     float64 `json:"compress_ratio"`
+	RestoresUsedBytes int64   `json:"restores_used_bytes"`
+	BranchesUsedBytes int64   `json:"branches_used_bytes"`
+	BranchCount       int     `json:"branch_count"`
+}
+
+// BranchUsage returns the ZFS space use of a branch's datasets
+func (s *Service) BranchUsage(ctx context.Context, branch *models.Branch) (*BranchUsage, error) {
+	storage := s.config.Storage
+	props, err := zfsProperties(ctx, storage.DatasetName(branch.Name), "referenced", "used", "logicalused", "compressratio", "refquota", "reservation")
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &BranchUsage{
+		BranchID:         branch.ID,
+		BranchName:       branch.Name,
+		ReferencedBytes:  parseZFSBytes(props["referenced"]),
+		UsedBytes:        parseZFSBytes(props["used"]),
+		LogicalUsedBytes: parseZFSBytes(props["logicalused"]),
+		CompressRatio:    parseZFSRatio(props["compressratio"]),
+		QuotaBytes:       parseZFSBytes(props["refquota"]),
+		ReservationBytes: parseZFSBytes(props["reservation"]),
+	}
+	usage.QuotaState = DiskUsage{ReferencedBytes: usage.ReferencedBytes, QuotaBytes: usage.QuotaBytes}.QuotaState()
+
+	if walDataset := storage.WALDatasetName(branch.Name); walDataset != "" {
+		// The WAL clone only exists when the restore keeps pg_wal on the separate device
+		if walProps, err := zfsProperties(ctx, walDataset, "used"); err == nil {
+			usage.WALUsedBytes = parseZFSBytes(walProps["used"])
+		}
+	}
+	return usage, nil
+}
+
+// StorageUsage returns the data pool's space use split between restores and branches
+func (s *Service) StorageUsage(ctx context.Context) (*StorageUsage, error) {
+	root := s.config.Storage.DatasetRoot
+	props, err := zfsProperties(ctx, root, "used", "available", "compressratio")
+	if err != nil {
+		return nil, err
+	}
+
+	datasets, err := s.DiskUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var restoreNames, branchNames []string
+	if err := s.db.Model(&models.Restore{}).Pluck("name", &restoreNames).Error; err != nil {
+		return nil, fmt.Errorf("failed to load restores: %w", err)
+	}
+	if err := s.db.Model(&models.Branch{}).Pluck("name", &branchNames).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branches: %w", err)
+	}
+
+	usage := &StorageUsage{
+		UsedBytes:      parseZFSBytes(props["used"]),
+		AvailableBytes: parseZFSBytes(props["available"]),
+		CompressRatio:  parseZFSRatio(props["compressratio"]),
+		BranchCount:    len(branchNames),
+	}
+	for _, name := range restoreNames {
+		usage.RestoresUsedBytes += datasets[name].UsedBytes
+	}
+	for _, name := range branchNames {
+		usage.BranchesUsedBytes += datasets[name].UsedBytes
+	}
+	return usage, nil
+}
+
+// zfsProperties reads parsable (-p) property values of a dataset
+func zfsProperties(ctx context.Context, dataset string, properties ...string) (map[string]string, error) {
+	cmd := exec.CommandContext(ctx, "zfs", "get", "-H", "-p", "-o", "property,value", strings.Join(properties, ","), dataset)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ZFS properties of %s: %w", dataset, err)
+	}
+
+	values := make(map[string]string, len(properties))
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if property, value, ok := strings.Cut(line, "\t"); ok {
+			values[property] = value
+		}
+	}
+	return values, nil
+}
+
+// parseZFSBytes parses a parsable ZFS size, unset values ("-", "none") are 0
+func parseZFSBytes(value string) int64 {
+	bytes, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return bytes
+}
+
+// parseZFSRatio parses a compression ratio ("2.50" or "2.50x"), 1 if unknown
+func parseZFSRatio(value string) float64 {
+	ratio, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	if err != nil || ratio <= 0 {
+		return 1
+	}
+	return ratio
+}
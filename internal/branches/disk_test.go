@@ -0,0 +1,68 @@
+package branches
+
+import "testing"
+
+func TestParseDiskUsage(t *testing.T) {
+	output := "tank\t1073741824\t24576\t0\t0\n" +
+		"tank/restore_20250101000000\t536870912\t536870912\t0\t0\n" +
+		"tank/feature-x\t1048576\t537919488\t53687091200\t10737418240\n" +
+		"tank/old-branch\t2048\t536872960\t-\t-\n"
+
+	usage, err := parseDiskUsage(output, "tank")
+	if err != nil {
+		t.Fatalf("parseDiskUsage() error = %v", err)
+	}
+
+	if _, ok := usage["tank"]; ok {
+		t.Error("root dataset should be skipped")
+	}
+	if got := usage["feature-x"]; got != (DiskUsage{UsedBytes: 1048576, ReferencedBytes: 537919488, QuotaBytes: 53687091200, ReservationBytes: 10737418240}) {
+		t.Errorf("feature-x = %+v", got)
+	}
+	if got := usage["old-branch"]; got != (DiskUsage{UsedBytes: 2048, ReferencedBytes: 536872960}) {
+		t.Errorf("old-branch = %+v, want no quota", got)
+	}
+
+	if _, err := parseDiskUsage("tank/broken\tabc\t0\t0\t0\n", "tank"); err == nil {
+		t.Error("expected error for unparsable size")
+	}
+}
+
+func TestParseZFSValues(t *testing.T) {
+	if got := parseZFSBytes("1048576"); got != 1048576 {
+		t.Errorf("parseZFSBytes = %d, want 1048576", got)
+	}
+	if got := parseZFSBytes("-"); got != 0 {
+		t.Errorf("parseZFSBytes(-) = %d, want 0", got)
+	}
+	if got := parseZFSRatio("2.50"); got != 2.5 {
+		t.Errorf("parseZFSRatio = %v, want 2.5", got)
+	}
+	if got := parseZFSRatio("1.85x"); got != 1.85 {
+		t.Errorf("parseZFSRatio(x suffix) = %v, want 1.85", got)
+	}
+	if got := parseZFSRatio("-"); got != 1 {
+		t.Errorf("parseZFSRatio(-) = %v, want 1", got)
+	}
+}
+
+func TestDiskUsageQuotaState(t *testing.T) {
+	tests := []struct {
+		usage DiskUsage
+		want  string
+	}{
+		{DiskUsage{ReferencedBytes: 1 << 30}, DiskQuotaStateNone},
+		{DiskUsage{ReferencedBytes: 50, QuotaBytes: 100}, DiskQuotaStateOK},
+		{DiskUsage{ReferencedBytes: 90, QuotaBytes: 100}, DiskQuotaStateNearLimit},
+		{DiskUsage{ReferencedBytes: 99, QuotaBytes: 100}, DiskQuotaStateExceeded},
+		{DiskUsage{ReferencedBytes: 100, QuotaBytes: 100}, DiskQuotaStateExceeded},
+		// Blocks shared with the restore count towards the refquota
+		{DiskUsage{UsedBytes: 10, ReferencedBytes: 95, QuotaBytes: 100}, DiskQuotaStateNearLimit},
+	}
+
+	for _, tt := range tests {
+		if got := tt.usage.QuotaState(); got != tt.want {
+			t.Errorf("QuotaState(%+v) = %q, want %q", tt.usage, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package branches
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// maxAllowedCIDRs bounds the allowlist of a branch, every entry is a ufw rule
+const maxAllowedCIDRs = 50
+
+// ufwAnywhere is the source of a port's rule without an allowlist
+const ufwAnywhere = "Anywhere"
+
+// runUFW runs a ufw command, replaced in tests
+var runUFW = func(ctx context.Context, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, "sudo", append([]string{"ufw"}, args...)...).CombinedOutput()
+}
+
+// ParseAllowedCIDRs parses a comma-separated allowlist (models.Config.BranchAllowedCIDRs), empty means open
+func ParseAllowedCIDRs(list string) ([]string, error) {
+	var cidrs []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			cidrs = append(cidrs, entry)
+		}
+	}
+	return cidrs, validateCIDRs(cidrs)
+}
+
+// ValidateAllowedCIDRs checks the allowlist of a branch, every entry has to lie within the config-level
+// allowlist if there is one
+func ValidateAllowedCIDRs(cidrs []string, configList string) error {
+	if err := validateCIDRs(cidrs); err != nil {
+		return err
+	}
+	allowed, err := ParseAllowedCIDRs(configList)
+	if err != nil {
+		return fmt.Errorf("invalid branch allowlist setting: %w", err)
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, cidr := range cidrs {
+		if !withinCIDRs(netip.MustParsePrefix(cidr), allowed) {
+			return fmt.Errorf("%s is outside the allowed networks (%s)", cidr, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+func validateCIDRs(cidrs []string) error {
+	if len(cidrs) > maxAllowedCIDRs {
+		return fmt.Errorf("at most %d networks are allowed, got %d", maxAllowedCIDRs, len(cidrs))
+	}
+	for _, cidr := range cidrs {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			return fmt.Errorf("invalid cidr %q (use e.g. 10.0.0.0/8 or 203.0.113.7/32)", cidr)
+		}
+	}
+	return nil
+}
+
+// withinCIDRs reports whether prefix lies entirely within one of cidrs
+func withinCIDRs(prefix netip.Prefix, cidrs []string) bool {
+	for _, cidr := range cidrs {
+		outer, err := netip.ParsePrefix(cidr)
+		if err == nil && outer.Bits() <= prefix.Bits() && outer.Contains(prefix.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveAllowedCIDRs returns the networks a branch's port is open to, empty meaning everywhere: the branch's
+// own allowlist as far as the config-level one allows it, otherwise the config-level one
+func EffectiveAllowedCIDRs(configList string, branchCIDRs []string) []string {
+	allowed, _ := ParseAllowedCIDRs(configList)
+
+	var cidrs []string
+	for _, cidr := range branchCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			continue
+		}
+		// Entries outside a config-level allowlist narrowed after the branch's was set are dropped
+		if len(allowed) == 0 || withinCIDRs(prefix, allowed) {
+			cidrs = append(cidrs, prefix.Masked().String())
+		}
+	}
+	if len(cidrs) == 0 {
+		for _, cidr := range allowed {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				cidrs = append(cidrs, prefix.Masked().String())
+			}
+		}
+	}
+	return cidrs
+}
+
+// firewallAllows applies the allowlist of a branch's port to a client of the proxy, which it bypasses
+func firewallAllows(configList string, branch *models.Branch, addr netip.Addr) error {
+	cidrs := EffectiveAllowedCIDRs(configList, branch.AllowedCIDRs)
+	if len(cidrs) == 0 {
+		return nil
+	}
+	for _, cidr := range cidrs {
+		if netip.MustParsePrefix(cidr).Contains(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("connections from %s aren't in the branch's allowed networks", addr)
+}
+
+// parseUFWSources returns the sources of the ufw rules allowing port, as listed by `ufw status`
+// IPv4 and IPv6 rules of the same source (ufw allow PORT/tcp adds both) are one entry
+func parseUFWSources(status string, port int) []string {
+	to := strconv.Itoa(port) + "/tcp"
+	seen := make(map[string]bool)
+	var sources []string
+	for _, line := range strings.Split(status, "\n") {
+		line, _, _ = strings.Cut(line, "#") // rule comments
+		if _, rest, numbered := strings.Cut(line, "] "); numbered && strings.HasPrefix(line, "[") {
+			line = rest // `ufw status numbered`
+		}
+		var fields []string
+		for _, field := range strings.Fields(line) {
+			if field != "(v6)" {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) < 3 || fields[0] != to || fields[1] != "ALLOW" {
+			continue
+		}
+		source := fields[2]
+		if source == "IN" && len(fields) > 3 {
+			source = fields[3]
+		}
+		if source != ufwAnywhere {
+			// ufw lists single addresses without their prefix length
+			if addr, err := netip.ParseAddr(source); err == nil {
+				source = netip.PrefixFrom(addr, addr.BitLen()).String()
+			}
+		}
+		if !seen[source] {
+			seen[source] = true
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// ufwRule returns the ufw rule allowing source to connect to port
+func ufwRule(port int, source string) []string {
+	if source == ufwAnywhere {
+		return []string{"allow", fmt.Sprintf("%d/tcp", port)}
+	}
+	return []string{"allow", "from", source, "to", "any", "port", strconv.Itoa(port), "proto", "tcp"}
+}
+
+// applyFirewall makes ufw allow port from exactly cidrs, or from anywhere if there are none
+// The new rules are added before the old ones are deleted, the port stays reserved (see create-branch.sh)
+func (s *Service) applyFirewall(ctx context.Context, port int, cidrs []string) error {
+	status, err := runUFW(ctx, "status")
+	if err != nil {
+		return fmt.Errorf("failed to list firewall rules: %s", strings.TrimSpace(string(status)))
+	}
+	current := parseUFWSources(string(status), port)
+
+	desired := cidrs
+	if len(desired) == 0 {
+		desired = []string{ufwAnywhere}
+	}
+	keep := make(map[string]bool, len(desired))
+	for _, source := range desired {
+		keep[source] = true
+	}
+	exists := make(map[string]bool, len(current))
+	for _, source := range current {
+		exists[source] = true
+	}
+
+	for _, source := range desired {
+		if exists[source] {
+			continue
+		}
+		if output, err := runUFW(ctx, ufwRule(port, source)...); err != nil {
+			return fmt.Errorf("failed to allow %s on port %d: %s", source, port, strings.TrimSpace(string(output)))
+		}
+	}
+	for _, source := range current {
+		if keep[source] {
+			continue
+		}
+		args := append([]string{"--force", "delete"}, ufwRule(port, source)...)
+		if output, err := runUFW(ctx, args...); err != nil {
+			return fmt.Errorf("failed to remove %s from port %d: %s", source, port, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// applyBranchFirewall restricts a branch's port to its allowed networks
+func (s *Service) applyBranchFirewall(ctx context.Context, config *models.Config, branch *models.Branch) error {
+	cidrs := EffectiveAllowedCIDRs(config.BranchAllowedCIDRs, branch.AllowedCIDRs)
+	if err := s.applyFirewall(ctx, branch.Port, cidrs); err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Int("port", branch.Port).Msg("Failed to apply branch firewall rules")
+		return err
+	}
+	return nil
+}
+
+// SetAllowedCIDRs replaces the allowlist of a branch and updates its firewall rules, an empty list falls back
+// to the config-level allowlist
+func (s *Service) SetAllowedCIDRs(ctx context.Context, branchID string, cidrs []string) (*models.Branch, error) {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := ValidateAllowedCIDRs(cidrs, config.BranchAllowedCIDRs); err != nil {
+		return nil, err
+	}
+
+	var branch models.Branch
+	if err := s.db.Where("id = ?", branchID).First(&branch).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branch: %w", err)
+	}
+
+	branch.AllowedCIDRs = cidrs
+	if err := s.applyBranchFirewall(ctx, &config, &branch); err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&branch).Select("AllowedCIDRs").Updates(&branch).Error; err != nil {
+		return nil, fmt.Errorf("failed to store allowed networks: %w", err)
+	}
+
+	s.logger.Info().
+		Str("branch_id", branch.ID).
+		Int("cidrs", len(cidrs)).
+		Msg("Branch firewall rules updated")
+
+	return &branch, nil
+}
+
+// ApplyFirewallAll updates the firewall rules of every branch, after the config-level allowlist changed
+// Every branch is attempted, the first error is returned
+func (s *Service) ApplyFirewallAll(ctx context.Context) error {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	var branches []models.Branch
+	if err := s.db.Find(&branches).Error; err != nil {
+		return fmt.Errorf("failed to load branches: %w", err)
+	}
+
+	var firstErr error
+	for i := range branches {
+		if err := s.applyBranchFirewall(ctx, &config, &branches[i]); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("branch %s: %w", branches[i].Name, err)
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,169 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestValidateAllowedCIDRs(t *testing.T) {
+	tests := []struct {
+		name       string
+		cidrs      []string
+		configList string
+		wantErr    bool
+	}{
+		{"none", nil, "", false},
+		{"open config", []string{"203.0.113.7/32", "2001:db8::/32"}, "", false},
+		{"within config", []string{"10.1.0.0/16"}, "10.0.0.0/8, 192.168.0.0/16", false},
+		{"config network itself", []string{"10.0.0.0/8"}, "10.0.0.0/8", false},
+		{"wider than config", []string{"10.0.0.0/7"}, "10.0.0.0/8", true},
+		{"outside config", []string{"203.0.113.7/32"}, "10.0.0.0/8", true},
+		{"address without prefix", []string{"10.0.0.1"}, "", true},
+		{"too many", make([]string, maxAllowedCIDRs+1), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAllowedCIDRs(tt.cidrs, tt.configList); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAllowedCIDRs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := ParseAllowedCIDRs("10.0.0.0/8,nope"); err == nil {
+		t.Error("ParseAllowedCIDRs() accepted an invalid entry")
+	}
+}
+
+func TestEffectiveAllowedCIDRs(t *testing.T) {
+	tests := []struct {
+		name       string
+		configList string
+		branch     []string
+		want       []string
+	}{
+		{"open", "", nil, nil},
+		{"config only", "10.0.0.0/8,203.0.113.7/32", nil, []string{"10.0.0.0/8", "203.0.113.7/32"}},
+		{"branch narrows config", "10.0.0.0/8", []string{"10.1.2.3/16"}, []string{"10.1.0.0/16"}},
+		{"branch without config", "", []string{"203.0.113.7/32"}, []string{"203.0.113.7/32"}},
+		// The config was narrowed after the branch's allowlist was set
+		{"branch partly outside", "10.0.0.0/8", []string{"10.1.0.0/16", "192.168.0.0/16"}, []string{"10.1.0.0/16"}},
+		{"branch outside", "10.0.0.0/8", []string{"192.168.0.0/16"}, []string{"10.0.0.0/8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EffectiveAllowedCIDRs(tt.configList, tt.branch); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EffectiveAllowedCIDRs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	branch := &models.Branch{AllowedCIDRs: []string{"10.1.0.0/16"}}
+	if err := firewallAllows("", branch, netip.MustParseAddr("10.1.2.3")); err != nil {
+		t.Errorf("firewallAllows() of an allowed address error = %v", err)
+	}
+	if err := firewallAllows("", branch, netip.MustParseAddr("10.2.0.1")); err == nil {
+		t.Error("firewallAllows() allowed an address outside the branch's networks")
+	}
+	if err := firewallAllows("", &models.Branch{}, netip.MustParseAddr("198.51.100.1")); err != nil {
+		t.Errorf("firewallAllows() without allowlists error = %v", err)
+	}
+}
+
+func TestParseUFWSources(t *testing.T) {
+	status := `Status: active
+
+To                         Action      From
+--                         ------      ----
+22/tcp                     ALLOW       Anywhere                   # SSH access
+6001/tcp                   ALLOW       Anywhere
+6001/tcp                   ALLOW       10.0.0.0/8
+6001/tcp                   ALLOW       203.0.113.7
+60010/tcp                  ALLOW       192.168.0.0/16
+22/tcp (v6)                ALLOW       Anywhere (v6)              # SSH access
+6001/tcp (v6)              ALLOW       Anywhere (v6)
+6001/tcp (v6)              ALLOW       2001:db8::/32
+`
+	want := []string{"Anywhere", "10.0.0.0/8", "203.0.113.7/32", "2001:db8::/32"}
+	if got := parseUFWSources(status, 6001); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseUFWSources() = %v, want %v", got, want)
+	}
+
+	// `ufw status numbered` lists the direction too
+	numbered := "[ 3] 6001/tcp                   ALLOW IN    10.0.0.0/8\n"
+	if got := parseUFWSources(numbered, 6001); !reflect.DeepEqual(got, []string{"10.0.0.0/8"}) {
+		t.Errorf("parseUFWSources() of numbered status = %v", got)
+	}
+}
+
+func TestSetAllowedCIDRs(t *testing.T) {
+	s, restore := newTestService(t)
+
+	status := "6001/tcp                   ALLOW       Anywhere\n6001/tcp (v6)              ALLOW       Anywhere (v6)\n"
+	var commands []string
+	ufwErr := error(nil)
+	orig := runUFW
+	t.Cleanup(func() { runUFW = orig })
+	runUFW = func(ctx context.Context, args ...string) ([]byte, error) {
+		if args[0] == "status" {
+			return []byte(status), nil
+		}
+		commands = append(commands, strings.Join(args, " "))
+		return nil, ufwErr
+	}
+
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001}
+	createTestBranch(t, s, branch)
+
+	// New rules are added before the reservation rule open to anywhere is removed
+	if _, err := s.SetAllowedCIDRs(context.Background(), branch.ID, []string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("SetAllowedCIDRs() error = %v", err)
+	}
+	want := []string{
+		"allow from 10.0.0.0/8 to any port 6001 proto tcp",
+		"--force delete allow 6001/tcp",
+	}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("ufw commands = %q, want %q", commands, want)
+	}
+	if got := loadBranch(t, s, branch.ID); !reflect.DeepEqual(got.AllowedCIDRs, []string{"10.0.0.0/8"}) {
+		t.Errorf("stored allowed cidrs = %v, want the new list", got.AllowedCIDRs)
+	}
+
+	// Networks outside the config-level allowlist are rejected without touching ufw
+	s.db.Model(&models.Config{}).Where("1 = 1").Update("branch_allowed_cidrs", "192.168.0.0/16")
+	commands = nil
+	if _, err := s.SetAllowedCIDRs(context.Background(), branch.ID, []string{"10.0.0.0/8"}); err == nil {
+		t.Error("SetAllowedCIDRs() accepted a network outside the config's allowlist")
+	}
+	if len(commands) != 0 {
+		t.Errorf("ufw commands = %q, want none for a rejected list", commands)
+	}
+
+	// Changing the config-level allowlist moves branches without their own onto it
+	status = "6001/tcp                   ALLOW       10.0.0.0/8\n"
+	if err := s.ApplyFirewallAll(context.Background()); err != nil {
+		t.Fatalf("ApplyFirewallAll() error = %v", err)
+	}
+	want = []string{
+		"allow from 192.168.0.0/16 to any port 6001 proto tcp",
+		"--force delete allow from 10.0.0.0/8 to any port 6001 proto tcp",
+	}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("ufw commands = %q, want %q", commands, want)
+	}
+
+	// A failed ufw command keeps the stored list
+	ufwErr = errors.New("exit status 1")
+	if _, err := s.SetAllowedCIDRs(context.Background(), branch.ID, nil); err == nil {
+		t.Error("SetAllowedCIDRs() succeeded although ufw failed")
+	}
+	if got := loadBranch(t, s, branch.ID); len(got.AllowedCIDRs) != 1 {
+		t.Errorf("stored allowed cidrs = %v, want them kept after a failed update", got.AllowedCIDRs)
+	}
+}
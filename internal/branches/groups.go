@@ -0,0 +1,134 @@
+package branches
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+var (
+	ErrBranchQuotaExceeded = errors.New("branch quota exceeded")
+	ErrSourceNotAllowed    = errors.New("restore not allowed for your groups")
+	ErrBranchNameTaken     = errors.New("branch name not available")
+	ErrInvalidBranchName   = errors.New("invalid branch name")
+)
+
+// GroupPolicy is what a user's groups allow at branch creation
+type GroupPolicy struct {
+	Groups         []string                    // Names of the groups the policy was built from
+	ResourceLimits models.BranchResourceLimits // Applied when a branch is created without explicit resources
+	MaxBranches    int                         // Branches the user may own at once, 0 = unlimited
+	AllowedSources []string                    // Restore IDs or models.GroupSourceLatest, nil = any restore
+}
+
+// mergeGroupPolicies combines the groups of a user, nil if the user is in no group
+// The quota and sources are the most permissive of all groups, the profile is the first one set (groups ordered by name)
+func mergeGroupPolicies(groups []models.Group) *GroupPolicy {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	policy := &GroupPolicy{}
+	unlimitedBranches := false
+	anySource := false
+	for _, group := range groups {
+		policy.Groups = append(policy.Groups, group.Name)
+
+		if policy.ResourceLimits == (models.BranchResourceLimits{}) {
+			policy.ResourceLimits = group.ResourceLimits
+		}
+
+		if group.MaxBranchesPerUser <= 0 {
+			unlimitedBranches = true
+		} else if group.MaxBranchesPerUser > policy.MaxBranches {
+			policy.MaxBranches = group.MaxBranchesPerUser
+		}
+
+		if len(group.AllowedSources) == 0 {
+			anySource = true
+		}
+		for _, source := range group.AllowedSources {
+			if !slices.Contains(policy.AllowedSources, source) {
+				policy.AllowedSources = append(policy.AllowedSources, source)
+			}
+		}
+	}
+
+	if unlimitedBranches {
+		policy.MaxBranches = 0
+	}
+	if anySource {
+		policy.AllowedSources = nil
+	}
+	return policy
+}
+
+// AllowsSource reports whether a branch can be created from the restore
+// latest is true when the restore was picked as the default source (no restore requested)
+func (p *GroupPolicy) AllowsSource(restoreID string, latest bool) bool {
+	if p.AllowedSources == nil {
+		return true
+	}
+	if latest && slices.Contains(p.AllowedSources, models.GroupSourceLatest) {
+		return true
+	}
+	return slices.Contains(p.AllowedSources, restoreID)
+}
+
+// groupPolicy loads the policy of a user's groups, nil for admins and users without groups
+func (s *Service) groupPolicy(userID string) (*GroupPolicy, error) {
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if user.IsAdmin {
+		return nil, nil
+	}
+
+	var groups []models.Group
+	if err := s.db.
+		Joins("JOIN group_members ON group_members.group_id = groups.id").
+		Where("group_members.user_id = ?", userID).
+		Order("groups.name ASC").
+		Find(&groups).Error; err != nil {
+		return nil, fmt.Errorf("failed to load user groups: %w", err)
+	}
+
+	return mergeGroupPolicies(groups), nil
+}
+
+// applyGroupPolicy checks the user's quota and allowed sources, and applies the group profile
+// when no resources were requested
+func (s *Service) applyGroupPolicy(params *CreateBranchParams, restore *models.Restore) error {
+	policy, err := s.groupPolicy(params.CreatedByID)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return nil
+	}
+
+	if !policy.AllowsSource(restore.ID, params.RestoreID == "") {
+		if params.RestoreID == "" {
+			return fmt.Errorf("%w: the latest restore is not allowed, pass a restore_id", ErrSourceNotAllowed)
+		}
+		return fmt.Errorf("%w: %s", ErrSourceNotAllowed, restore.Name)
+	}
+
+	if policy.MaxBranches > 0 {
+		var count int64
+		if err := s.db.Model(&models.Branch{}).Where("created_by_id = ?", params.CreatedByID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count user branches: %w", err)
+		}
+		if int(count) >= policy.MaxBranches {
+			return fmt.Errorf("%w: %d of %d branches in use, delete a branch first", ErrBranchQuotaExceeded, count, policy.MaxBranches)
+		}
+	}
+
+	if params.ResourceLimits == (models.BranchResourceLimits{}) {
+		params.ResourceLimits = policy.ResourceLimits
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package branches
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestMergeGroupPolicies(t *testing.T) {
+	if policy := mergeGroupPolicies(nil); policy != nil {
+		t.Fatalf("mergeGroupPolicies(nil) = %+v, want nil", policy)
+	}
+
+	qa := models.Group{
+		Name:               "qa",
+		ResourceLimits:     models.BranchResourceLimits{MemoryMB: 1024},
+		MaxBranchesPerUser: 3,
+		AllowedSources:     []string{models.GroupSourceLatest, "golden"},
+	}
+	contractors := models.Group{
+		Name:               "contractors",
+		ResourceLimits:     models.BranchResourceLimits{MemoryMB: 512},
+		MaxBranchesPerUser: 1,
+		AllowedSources:     []string{"golden", "sanitized"},
+	}
+
+	policy := mergeGroupPolicies([]models.Group{contractors, qa})
+	if policy.ResourceLimits.MemoryMB != 512 {
+		t.Errorf("MemoryMB = %d, want 512 (first group's profile)", policy.ResourceLimits.MemoryMB)
+	}
+	if policy.MaxBranches != 3 {
+		t.Errorf("MaxBranches = %d, want 3", policy.MaxBranches)
+	}
+	if want := []string{"golden", "sanitized", models.GroupSourceLatest}; !slices.Equal(policy.AllowedSources, want) {
+		t.Errorf("AllowedSources = %v, want %v", policy.AllowedSources, want)
+	}
+
+	// Any unrestricted group lifts the restriction
+	unrestricted := models.Group{Name: "developers"}
+	policy = mergeGroupPolicies([]models.Group{unrestricted, qa})
+	if policy.MaxBranches != 0 {
+		t.Errorf("MaxBranches = %d, want 0 (unlimited)", policy.MaxBranches)
+	}
+	if policy.AllowedSources != nil {
+		t.Errorf("AllowedSources = %v, want nil (any)", policy.AllowedSources)
+	}
+	if policy.ResourceLimits.MemoryMB != 1024 {
+		t.Errorf("MemoryMB = %d, want 1024 (first profile set)", policy.ResourceLimits.MemoryMB)
+	}
+}
+
+func TestGroupPolicyAllowsSource(t *testing.T) {
+	tests := []struct {
+		name      string
+		sources   []string
+		restoreID string
+		latest    bool
+		want      bool
+	}{
+		{"any source", nil, "r1", true, true},
+		{"latest allowed", []string{models.GroupSourceLatest}, "r1", true, true},
+		{"latest requested by ID", []string{models.GroupSourceLatest}, "r1", false, false},
+		{"restore allowed", []string{"golden"}, "golden", false, true},
+		{"latest not allowed", []string{"golden"}, "r1", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &GroupPolicy{AllowedSources: tt.sources}
+			if got := policy.AllowsSource(tt.restoreID, tt.latest); got != tt.want {
+				t.Errorf("AllowsSource(%q, %v) = %v, want %v", tt.restoreID, tt.latest, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package branches
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// SSL use of a pg_hba.conf rule (models.BranchHBARule.SSL)
+const (
+	HBASSLRequire  = "require"  // hostssl, the default
+	HBASSLOptional = "optional" // host
+	HBASSLDisable  = "disable"  // hostnossl
+)
+
+// hbaConnectionTypes maps the SSL use of a rule to its pg_hba.conf connection type
+var hbaConnectionTypes = map[string]string{
+	HBASSLRequire:  "hostssl",
+	HBASSLOptional: "host",
+	HBASSLDisable:  "hostnossl",
+}
+
+// hbaMethods are the authentication methods a rule can use, without trust and password (sent in clear text)
+var hbaMethods = map[string]bool{
+	"scram-sha-256": true,
+	"md5":           true,
+	"cert":          true,
+	"reject":        true,
+}
+
+// defaultHBAMethod authenticates rules without a method
+const defaultHBAMethod = "scram-sha-256"
+
+// maxHBARules bounds the rules of a branch, every connection attempt walks the list
+const maxHBARules = 50
+
+// defaultHBARules let the branch's user connect from anywhere over SSL, the rules of branches without their own
+var defaultHBARules = []models.BranchHBARule{
+	{CIDR: "0.0.0.0/0"},
+	{CIDR: "::/0"},
+}
+
+// Cluster commands of HBA updates, replaced in tests
+var (
+	// writeHBAFile replaces a branch's pg_hba.conf as the postgres user
+	writeHBAFile = func(ctx context.Context, path string, content []byte) error {
+		cmd := exec.CommandContext(ctx, "sudo", "-u", "postgres", "tee", path)
+		cmd.Stdin = bytes.NewReader(content)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to write %s: %s", path, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	// reloadCluster makes the cluster on port reread its configuration files
+	reloadCluster = func(ctx context.Context, port int) ([]byte, error) {
+		return exec.CommandContext(ctx, "sudo", "-u", "postgres", "psql", "-p", strconv.Itoa(port), "-d", "postgres", "-Atc", "SELECT pg_reload_conf()").CombinedOutput()
+	}
+)
+
+// ValidateHBARules checks the pg_hba.conf rules of a branch or template, an empty list means defaultHBARules
+func ValidateHBARules(rules []models.BranchHBARule) error {
+	if len(rules) > maxHBARules {
+		return fmt.Errorf("at most %d rules are allowed, got %d", maxHBARules, len(rules))
+	}
+	for i, rule := range rules {
+		if _, err := netip.ParsePrefix(rule.CIDR); err != nil {
+			return fmt.Errorf("rule %d: invalid cidr %q (use e.g. 10.0.0.0/8 or 203.0.113.7/32)", i+1, rule.CIDR)
+		}
+		if rule.Method != "" && !hbaMethods[rule.Method] {
+			return fmt.Errorf("rule %d: method must be scram-sha-256, md5, cert or reject, got %q", i+1, rule.Method)
+		}
+		if _, ok := hbaConnectionTypes[rule.SSL]; rule.SSL != "" && !ok {
+			return fmt.Errorf("rule %d: ssl must be require, optional or disable, got %q", i+1, rule.SSL)
+		}
+		// Client certificates are only sent over SSL
+		if rule.Method == "cert" && rule.SSL != "" && rule.SSL != HBASSLRequire {
+			return fmt.Errorf("rule %d: the cert method requires ssl = require", i+1)
+		}
+	}
+	return nil
+}
+
+// renderHBAConf renders the pg_hba.conf of a branch: local socket connections for branchd itself, loopback
+// connections of the proxy, the rules for the branch's user, then a rejection of everything else
+// The proxy applies the rules to the client's address itself (see proxyAllows), the branch only sees the proxy's
+func renderHBAConf(user string, rules []models.BranchHBARule) string {
+	if len(rules) == 0 {
+		rules = defaultHBARules
+	}
+
+	var conf strings.Builder
+	conf.WriteString("# Managed by branchd, edit the branch's hba_rules through the API instead\n")
+	conf.WriteString("# TYPE  DATABASE        USER            ADDRESS                 METHOD\n\n")
+	conf.WriteString("# Allow local socket connections\n")
+	conf.WriteString("local   all             all                                     peer\n\n")
+
+	// Share roles (see CreateShare) connect like the branch's user
+	users := []string{user, "+" + shareGroupRole}
+
+	conf.WriteString("# branchd proxy, which applies the branch user's rules to the client's address\n")
+	for _, address := range []string{"127.0.0.1/32", "::1/128"} {
+		for _, u := range users {
+			fmt.Fprintf(&conf, "%-7s %-15s %-15s %-23s %s\n", hbaConnectionTypes[HBASSLRequire], "all", u, address, defaultHBAMethod)
+		}
+	}
+	conf.WriteString("\n")
+
+	conf.WriteString("# Branch user and share roles\n")
+	for _, rule := range rules {
+		connectionType := hbaConnectionTypes[rule.SSL]
+		if connectionType == "" {
+			connectionType = hbaConnectionTypes[HBASSLRequire]
+		}
+		method := rule.Method
+		if method == "" {
+			method = defaultHBAMethod
+		}
+		address := rule.CIDR
+		if prefix, err := netip.ParsePrefix(rule.CIDR); err == nil {
+			address = prefix.Masked().String()
+		}
+		for _, u := range users {
+			fmt.Fprintf(&conf, "%-7s %-15s %-15s %-23s %s\n", connectionType, "all", u, address, method)
+		}
+	}
+
+	conf.WriteString("\n# Deny all other connections\n")
+	conf.WriteString("host    all             all             0.0.0.0/0               reject\n")
+	conf.WriteString("host    all             all             ::/0                    reject\n")
+	return conf.String()
+}
+
+// SetHBARules replaces the pg_hba.conf rules of a branch and reloads its cluster, an empty list restores
+// defaultHBARules. Suspended branches pick the rules up when they're resumed
+func (s *Service) SetHBARules(ctx context.Context, branchID string, rules []models.BranchHBARule) (*models.Branch, error) {
+	if err := ValidateHBARules(rules); err != nil {
+		return nil, err
+	}
+
+	var branch models.Branch
+	if err := s.db.Where("id = ?", branchID).First(&branch).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branch: %w", err)
+	}
+
+	path := s.config.Storage.DataDir(branch.Name) + "/pg_hba.conf"
+	if err := writeHBAFile(ctx, path, []byte(renderHBAConf(branch.User, rules))); err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to write branch pg_hba.conf")
+		return nil, err
+	}
+	if branch.SuspendedAt == nil {
+		if output, err := reloadCluster(ctx, branch.Port); err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("branch_id", branch.ID).
+				Str("output", string(output)).
+				Msg("Failed to reload branch configuration")
+			return nil, fmt.Errorf("failed to reload branch configuration: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	branch.HBARules = rules
+	if err := s.db.Model(&branch).Select("HBARules").Updates(&branch).Error; err != nil {
+		return nil, fmt.Errorf("failed to store hba rules: %w", err)
+	}
+
+	s.logger.Info().
+		Str("branch_id", branch.ID).
+		Int("rules", len(rules)).
+		Msg("Branch pg_hba.conf updated")
+
+	return &branch, nil
+}
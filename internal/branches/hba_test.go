@@ -0,0 +1,128 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestValidateHBARules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []models.BranchHBARule
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"defaults", []models.BranchHBARule{{CIDR: "10.0.0.0/8"}}, false},
+		{"all options", []models.BranchHBARule{{CIDR: "203.0.113.7/32", Method: "md5", SSL: HBASSLOptional}, {CIDR: "::/0", Method: "reject"}}, false},
+		{"cert over ssl", []models.BranchHBARule{{CIDR: "10.0.0.0/8", Method: "cert", SSL: HBASSLRequire}}, false},
+		{"address without prefix", []models.BranchHBARule{{CIDR: "10.0.0.1"}}, true},
+		{"trust", []models.BranchHBARule{{CIDR: "10.0.0.0/8", Method: "trust"}}, true},
+		{"unknown ssl", []models.BranchHBARule{{CIDR: "10.0.0.0/8", SSL: "prefer"}}, true},
+		{"cert without ssl", []models.BranchHBARule{{CIDR: "10.0.0.0/8", Method: "cert", SSL: HBASSLOptional}}, true},
+		{"too many", make([]models.BranchHBARule, maxHBARules+1), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateHBARules(tt.rules); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateHBARules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderHBAConf(t *testing.T) {
+	conf := renderHBAConf("u1", []models.BranchHBARule{
+		{CIDR: "10.1.2.3/8"},
+		{CIDR: "192.168.0.0/16", Method: "md5", SSL: HBASSLOptional},
+	})
+	for _, want := range []string{
+		"local   all             all                                     peer\n",
+		"hostssl all             u1              127.0.0.1/32            scram-sha-256\n",
+		"hostssl all             u1              10.0.0.0/8              scram-sha-256\n",
+		"host    all             u1              192.168.0.0/16          md5\n",
+		"host    all             +branchd_shares 192.168.0.0/16          md5\n",
+		"host    all             all             0.0.0.0/0               reject\n",
+	} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("renderHBAConf() = %q, want a line %q", conf, want)
+		}
+	}
+	// The branch user's rules come before the catch-all rejection
+	if strings.Index(conf, "u1") > strings.Index(conf, "reject") {
+		t.Errorf("renderHBAConf() = %q, want the rules before the rejection", conf)
+	}
+
+	// Without rules the branch user connects from anywhere over SSL
+	defaults := renderHBAConf("u1", nil)
+	if !strings.Contains(defaults, "hostssl all             u1              0.0.0.0/0               scram-sha-256\n") ||
+		!strings.Contains(defaults, "hostssl all             u1              ::/0                    scram-sha-256\n") {
+		t.Errorf("renderHBAConf() without rules = %q, want SSL from anywhere", defaults)
+	}
+}
+
+func TestSetHBARules(t *testing.T) {
+	s, restore := newTestService(t)
+
+	var written string
+	var reloaded []int
+	reloadErr := error(nil)
+	origWrite, origReload := writeHBAFile, reloadCluster
+	t.Cleanup(func() { writeHBAFile, reloadCluster = origWrite, origReload })
+	writeHBAFile = func(ctx context.Context, path string, content []byte) error {
+		written = path + "\n" + string(content)
+		return nil
+	}
+	reloadCluster = func(ctx context.Context, port int) ([]byte, error) {
+		reloaded = append(reloaded, port)
+		return nil, reloadErr
+	}
+
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, User: "u1", Port: 6001}
+	createTestBranch(t, s, branch)
+
+	rules := []models.BranchHBARule{{CIDR: "10.0.0.0/8"}}
+	if _, err := s.SetHBARules(context.Background(), branch.ID, rules); err != nil {
+		t.Fatalf("SetHBARules() error = %v", err)
+	}
+	if !strings.HasPrefix(written, s.config.Storage.DataDir("feature-x")+"/pg_hba.conf\n") || !strings.Contains(written, "10.0.0.0/8") {
+		t.Errorf("written pg_hba.conf = %q, want the branch's with the rule", written)
+	}
+	if len(reloaded) != 1 || reloaded[0] != 6001 {
+		t.Errorf("reloaded ports = %v, want [6001]", reloaded)
+	}
+	if got := loadBranch(t, s, branch.ID); len(got.HBARules) != 1 || got.HBARules[0].CIDR != "10.0.0.0/8" {
+		t.Errorf("stored hba rules = %+v, want the new rule", got.HBARules)
+	}
+
+	// Invalid rules don't touch the cluster
+	if _, err := s.SetHBARules(context.Background(), branch.ID, []models.BranchHBARule{{CIDR: "nope"}}); err == nil {
+		t.Error("SetHBARules() accepted an invalid cidr")
+	}
+	if len(reloaded) != 1 {
+		t.Errorf("reloaded ports = %v, want no reload for invalid rules", reloaded)
+	}
+
+	// A failed reload keeps the stored rules
+	reloadErr = errors.New("exit status 2")
+	if _, err := s.SetHBARules(context.Background(), branch.ID, nil); err == nil {
+		t.Error("SetHBARules() succeeded although the reload failed")
+	}
+	if got := loadBranch(t, s, branch.ID); len(got.HBARules) != 1 {
+		t.Errorf("stored hba rules = %+v, want them kept after a failed reload", got.HBARules)
+	}
+
+	// Suspended branches read the file when they start again
+	now := time.Now()
+	s.db.Model(branch).Update("suspended_at", &now)
+	if _, err := s.SetHBARules(context.Background(), branch.ID, nil); err != nil {
+		t.Fatalf("SetHBARules() of a suspended branch error = %v", err)
+	}
+	if got := loadBranch(t, s, branch.ID); len(got.HBARules) != 0 {
+		t.Errorf("stored hba rules = %+v, want the defaults", got.HBARules)
+	}
+}
@@ -0,0 +1,157 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Health statuses of a branch (Branch.Status)
+const (
+	BranchStatusUnknown = ""        // Not checked yet
+	BranchStatusRunning = "running" // Accepting connections (or starting up)
+	BranchStatusStopped = "stopped" // Suspended or stopped on purpose
+	BranchStatusCrashed = "crashed" // Not responding although it should be running
+)
+
+// healthCheckTimeout bounds a single pg_isready call
+const healthCheckTimeout = 5 * time.Second
+
+// pg_isready exit codes
+const (
+	pgIsReadyAccepting = 0 // Accepting connections
+	pgIsReadyRejecting = 1 // Rejecting connections, e.g. starting up or recovering
+)
+
+// Health probes of branch clusters, replaced in tests
+var (
+	// pgIsReady returns pg_isready's exit code for the cluster on port, err is set if it couldn't run at all
+	pgIsReady = func(ctx context.Context, port int) (int, error) {
+		err := exec.CommandContext(ctx, "sudo", "-u", "postgres", "pg_isready", "-q", "-p", strconv.Itoa(port)).Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return pgIsReadyAccepting, err
+	}
+
+	// unitState returns the state of a systemd unit (e.g. "active", "failed")
+	unitState = func(ctx context.Context, unit string) string {
+		// is-active exits non-zero for every state but active, its output is the state
+		output, _ := exec.CommandContext(ctx, "systemctl", "is-active", unit).Output()
+		return strings.TrimSpace(string(output))
+	}
+)
+
+// classifyBranchHealth derives a branch's status from pg_isready's exit code and its systemd unit state
+// A branch that doesn't respond is only "stopped" when its unit was stopped cleanly
+func classifyBranchHealth(readyExitCode int, unitState string, suspended bool) string {
+	if suspended {
+		return BranchStatusStopped
+	}
+	if readyExitCode == pgIsReadyAccepting || readyExitCode == pgIsReadyRejecting {
+		return BranchStatusRunning
+	}
+	if unitState == "inactive" {
+		return BranchStatusStopped
+	}
+	// failed, activating (restart loop) or active without a responding postmaster
+	return BranchStatusCrashed
+}
+
+// CheckBranchHealth records the status of every created branch, logging branches that crash or recover
+// Crashed branches are restarted, see recoverBranch
+func (s *Service) CheckBranchHealth(ctx context.Context) error {
+	var branches []models.Branch
+	if err := s.db.Where("port > 0").Find(&branches).Error; err != nil {
+		return fmt.Errorf("failed to load branches: %w", err)
+	}
+
+	for _, branch := range branches {
+		s.checkBranch(ctx, &branch)
+	}
+	return nil
+}
+
+// CheckBranch checks a single branch right away, e.g. after a client reported it couldn't connect
+// Returns the branch's status after restarting it if it crashed
+func (s *Service) CheckBranch(ctx context.Context, branchID string) (string, error) {
+	var branch models.Branch
+	if err := s.db.Where("id = ?", branchID).First(&branch).Error; err != nil {
+		return "", fmt.Errorf("failed to load branch: %w", err)
+	}
+	if branch.Port == 0 {
+		return "", fmt.Errorf("branch %s is not created yet", branch.Name)
+	}
+	return s.checkBranch(ctx, &branch), nil
+}
+
+// checkBranch records a branch's status and restarts it if it crashed
+func (s *Service) checkBranch(ctx context.Context, branch *models.Branch) string {
+	status := s.branchHealth(ctx, branch)
+	now := time.Now()
+
+	if status != branch.Status {
+		event := s.logger.Info()
+		if status == BranchStatusCrashed {
+			event = s.logger.Warn()
+		}
+		event.
+			Str("branch_name", branch.Name).
+			Int("port", branch.Port).
+			Str("status", status).
+			Str("previous_status", branch.Status).
+			Msg("Branch status changed")
+	}
+
+	updates := map[string]interface{}{}
+	switch {
+	case status == BranchStatusCrashed:
+		var recovery map[string]interface{}
+		status, recovery = s.recoverBranch(ctx, branch, now)
+		for column, value := range recovery {
+			updates[column] = value
+		}
+	case status == BranchStatusRunning && branch.RecoveryAttempts > 0:
+		// Came back by itself (e.g. systemd's Restart=on-failure)
+		updates["recovery_attempts"] = 0
+		updates["next_recovery_at"] = nil
+	}
+	updates["status"] = status
+	updates["last_checked_at"] = now
+
+	if err := s.db.Model(branch).Updates(updates).Error; err != nil {
+		s.logger.Warn().Err(err).Str("branch_name", branch.Name).Msg("Failed to record branch status")
+	}
+	return status
+}
+
+// branchHealth checks a single branch
+// Suspended branches are not probed: the waker listening on their port would resume them
+func (s *Service) branchHealth(ctx context.Context, branch *models.Branch) string {
+	if branch.SuspendedAt != nil {
+		return classifyBranchHealth(-1, "", true)
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	exitCode, err := pgIsReady(checkCtx, branch.Port)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("branch_name", branch.Name).Msg("Failed to run pg_isready")
+		return branch.Status
+	}
+
+	state := ""
+	if exitCode != pgIsReadyAccepting && exitCode != pgIsReadyRejecting {
+		state = unitState(ctx, serviceName(branch.Name))
+	}
+
+	return classifyBranchHealth(exitCode, state, false)
+}
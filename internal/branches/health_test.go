@@ -0,0 +1,153 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// fakeProbes stands in for pg_isready and systemctl is-active of branch clusters
+type fakeProbes struct {
+	exitCodes map[int]int       // pg_isready exit code by port, 0 (accepting) if missing
+	failing   map[int]bool      // Ports where pg_isready can't run at all
+	states    map[string]string // Unit state by unit name
+	probed    map[int]bool
+}
+
+// stubHealthProbes replaces the health probes with a fake for the test's duration
+func stubHealthProbes(t *testing.T) *fakeProbes {
+	t.Helper()
+	fake := &fakeProbes{exitCodes: map[int]int{}, failing: map[int]bool{}, states: map[string]string{}, probed: map[int]bool{}}
+
+	origReady, origState := pgIsReady, unitState
+	t.Cleanup(func() { pgIsReady, unitState = origReady, origState })
+
+	pgIsReady = func(ctx context.Context, port int) (int, error) {
+		fake.probed[port] = true
+		if fake.failing[port] {
+			return 0, errors.New("sudo: command not found")
+		}
+		return fake.exitCodes[port], nil
+	}
+	unitState = func(ctx context.Context, unit string) string {
+		return fake.states[unit]
+	}
+	return fake
+}
+
+func TestClassifyBranchHealth(t *testing.T) {
+	tests := []struct {
+		exitCode  int
+		unitState string
+		suspended bool
+		want      string
+	}{
+		{0, "", false, BranchStatusRunning},
+		{1, "", false, BranchStatusRunning}, // Starting up
+		{2, "inactive", false, BranchStatusStopped},
+		{2, "failed", false, BranchStatusCrashed},
+		{2, "activating", false, BranchStatusCrashed},
+		{2, "active", false, BranchStatusCrashed},
+		{-1, "active", false, BranchStatusCrashed}, // pg_isready timed out
+		{-1, "", true, BranchStatusStopped},
+	}
+
+	for _, tt := range tests {
+		if got := classifyBranchHealth(tt.exitCode, tt.unitState, tt.suspended); got != tt.want {
+			t.Errorf("classifyBranchHealth(%d, %q, %v) = %q, want %q", tt.exitCode, tt.unitState, tt.suspended, got, tt.want)
+		}
+	}
+}
+
+func TestCheckBranchHealth(t *testing.T) {
+	s, restore := newTestService(t)
+	probes := stubHealthProbes(t)
+
+	now := time.Now()
+	later := now.Add(time.Hour)
+	running := &models.Branch{Name: "running", RestoreID: restore.ID, Port: 6001}
+	starting := &models.Branch{Name: "starting", RestoreID: restore.ID, Port: 6002, Status: BranchStatusCrashed}
+	stopped := &models.Branch{Name: "stopped", RestoreID: restore.ID, Port: 6003, Status: BranchStatusRunning}
+	// Its next restart is due later, so it's only recorded as crashed
+	crashed := &models.Branch{Name: "crashed", RestoreID: restore.ID, Port: 6004, Status: BranchStatusRunning, RecoveryAttempts: 2, NextRecoveryAt: &later}
+	suspended := &models.Branch{Name: "suspended", RestoreID: restore.ID, Port: 6005, Status: BranchStatusRunning, SuspendedAt: &now}
+	selfRecovered := &models.Branch{Name: "self-recovered", RestoreID: restore.ID, Port: 6006, Status: BranchStatusCrashed, RecoveryAttempts: 3, NextRecoveryAt: &later}
+	unprobed := &models.Branch{Name: "unprobed", RestoreID: restore.ID, Port: 6007, Status: BranchStatusRunning}
+	notCreated := &models.Branch{Name: "not-created", RestoreID: restore.ID}
+	for _, branch := range []*models.Branch{running, starting, stopped, crashed, suspended, selfRecovered, unprobed, notCreated} {
+		createTestBranch(t, s, branch)
+	}
+
+	probes.exitCodes = map[int]int{6002: 1, 6003: 2, 6004: 2}
+	probes.states = map[string]string{serviceName("stopped"): "inactive", serviceName("crashed"): "failed"}
+	probes.failing[6007] = true
+
+	if err := s.CheckBranchHealth(context.Background()); err != nil {
+		t.Fatalf("CheckBranchHealth() error = %v", err)
+	}
+
+	want := map[string]string{
+		running.ID:       BranchStatusRunning,
+		starting.ID:      BranchStatusRunning,
+		stopped.ID:       BranchStatusStopped,
+		crashed.ID:       BranchStatusCrashed,
+		suspended.ID:     BranchStatusStopped,
+		selfRecovered.ID: BranchStatusRunning,
+		unprobed.ID:      BranchStatusRunning, // Kept when pg_isready can't run
+	}
+	for id, status := range want {
+		branch := loadBranch(t, s, id)
+		if branch.Status != status {
+			t.Errorf("branch %s status = %q, want %q", branch.Name, branch.Status, status)
+		}
+		if branch.LastCheckedAt == nil {
+			t.Errorf("branch %s last_checked_at not recorded", branch.Name)
+		}
+	}
+
+	if probes.probed[6005] {
+		t.Error("suspended branch probed, which would resume it")
+	}
+	if got := loadBranch(t, s, notCreated.ID); got.Status != BranchStatusUnknown || got.LastCheckedAt != nil {
+		t.Errorf("branch without cluster checked: status %q", got.Status)
+	}
+
+	// A crashed branch waiting for its restart keeps its backoff, one that came back by itself is reset
+	if got := loadBranch(t, s, crashed.ID); got.RecoveryAttempts != 2 || got.NextRecoveryAt == nil {
+		t.Errorf("crashed branch recovery = %d attempts, next at %v; want unchanged", got.RecoveryAttempts, got.NextRecoveryAt)
+	}
+	if got := loadBranch(t, s, selfRecovered.ID); got.RecoveryAttempts != 0 || got.NextRecoveryAt != nil {
+		t.Errorf("recovered branch recovery = %d attempts, next at %v; want reset", got.RecoveryAttempts, got.NextRecoveryAt)
+	}
+}
+
+func TestCheckBranch(t *testing.T) {
+	s, restore := newTestService(t)
+	probes := stubHealthProbes(t)
+
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001, Status: BranchStatusRunning}
+	notCreated := &models.Branch{Name: "not-created", RestoreID: restore.ID}
+	createTestBranch(t, s, branch)
+	createTestBranch(t, s, notCreated)
+
+	probes.exitCodes[6001] = 2
+	probes.states[serviceName("feature-x")] = "inactive"
+
+	status, err := s.CheckBranch(context.Background(), branch.ID)
+	if err != nil || status != BranchStatusStopped {
+		t.Errorf("CheckBranch() = %q, %v, want %q", status, err, BranchStatusStopped)
+	}
+	if got := loadBranch(t, s, branch.ID); got.Status != BranchStatusStopped {
+		t.Errorf("recorded status = %q, want %q", got.Status, BranchStatusStopped)
+	}
+
+	if _, err := s.CheckBranch(context.Background(), notCreated.ID); err == nil {
+		t.Error("CheckBranch() succeeded for a branch without cluster")
+	}
+	if _, err := s.CheckBranch(context.Background(), "missing"); err == nil {
+		t.Error("CheckBranch() succeeded for an unknown branch")
+	}
+}
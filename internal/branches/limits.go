@@ -0,0 +1,107 @@
+package branches
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Bounds for per-branch resource limits
+const (
+	minBranchMemoryMB       = 256 // PostgreSQL won't reliably start below this
+	minBranchCPUCores       = 0.1
+	minBranchMaxConnections = 5   // Must exceed superuser_reserved_connections or PostgreSQL refuses to start
+	maxBranchMaxConnections = 100 // Same cap as the max_connections custom setting
+)
+
+// ValidateResourceLimits checks a branch resource profile
+// Zero values are allowed and mean "no limit"
+func ValidateResourceLimits(limits models.BranchResourceLimits) error {
+	if limits.CPUCores < 0 || (limits.CPUCores > 0 && limits.CPUCores < minBranchCPUCores) {
+		return fmt.Errorf("cpu_cores must be at least %.1f", minBranchCPUCores)
+	}
+	if limits.MemoryMB < 0 || (limits.MemoryMB > 0 && limits.MemoryMB < minBranchMemoryMB) {
+		return fmt.Errorf("memory_mb must be at least %d", minBranchMemoryMB)
+	}
+	if limits.MaxConnections < 0 || (limits.MaxConnections > 0 && limits.MaxConnections < minBranchMaxConnections) || limits.MaxConnections > maxBranchMaxConnections {
+		return fmt.Errorf("max_connections must be between %d and %d", minBranchMaxConnections, maxBranchMaxConnections)
+	}
+	if limits.DiskQuotaGB < 0 || limits.DiskReservationGB < 0 {
+		return fmt.Errorf("disk_quota_gb and disk_reservation_gb must be 0 (none) or more")
+	}
+	if limits.DiskQuotaGB > 0 && limits.DiskReservationGB > limits.DiskQuotaGB {
+		return fmt.Errorf("disk_reservation_gb can't exceed disk_quota_gb")
+	}
+	return nil
+}
+
+// systemdResourceDirectives renders the [Service] directives enforcing limits
+// Returns an empty string when no CPU or memory limit is set
+func systemdResourceDirectives(limits models.BranchResourceLimits) string {
+	var directives []string
+	if limits.CPUCores > 0 {
+		// CPUQuota is a percentage of one CPU (150% = 1.5 cores)
+		directives = append(directives, fmt.Sprintf("CPUQuota=%d%%", int(limits.CPUCores*100)))
+	}
+	if limits.MemoryMB > 0 {
+		// Start reclaiming at 90% so PostgreSQL sees memory pressure before the OOM killer does
+		directives = append(directives,
+			fmt.Sprintf("MemoryHigh=%dM", limits.MemoryMB*9/10),
+			fmt.Sprintf("MemoryMax=%dM", limits.MemoryMB),
+			"MemorySwapMax=0",
+		)
+	}
+	return strings.Join(directives, "\n")
+}
+
+// withoutSetting removes a setting from filtered PostgreSQL configuration
+// Used so custom configuration can't override an enforced limit
+func withoutSetting(conf string, key string) string {
+	if conf == "" {
+		return conf
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(conf, "\n"), "\n") {
+		if strings.TrimSpace(strings.SplitN(line, "=", 2)[0]) == key {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// statementLoggingSettings are enforced on break-glass branches, custom configuration can't turn them off
+var statementLoggingSettings = []string{"log_destination", "syslog_ident", "log_statement", "log_connections", "log_disconnections"}
+
+// withStatementLogging makes the branch log every statement and connection to syslog, tagged with the branch name
+// Syslog outlives the branch's data directory, so the log is kept after the break-glass grant ended
+func withStatementLogging(conf string, branchName string) string {
+	for _, key := range statementLoggingSettings {
+		conf = withoutSetting(conf, key)
+	}
+	return conf + fmt.Sprintf("log_destination = syslog\nsyslog_ident = %s\nlog_statement = all\nlog_connections = on\nlog_disconnections = on\n", branchName)
+}
+
+// formatMaxConnections renders the enforced max_connections value for the script
+// Empty string means the cloned postgresql.conf value is kept
+func formatMaxConnections(limits models.BranchResourceLimits) string {
+	if limits.MaxConnections == 0 {
+		return ""
+	}
+	return strconv.Itoa(limits.MaxConnections)
+}
+
+// formatZFSSize renders a size in GB as a ZFS property value ("none" for 0)
+func formatZFSSize(gb int) string {
+	if gb <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%dG", gb)
+}
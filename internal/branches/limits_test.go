@@ -0,0 +1,65 @@
+package branches
+
+import (
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestValidateResourceLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  models.BranchResourceLimits
+		wantErr bool
+	}{
+		{name: "no limits", limits: models.BranchResourceLimits{}},
+		{name: "all limits", limits: models.BranchResourceLimits{CPUCores: 1.5, MemoryMB: 2048, MaxConnections: 20}},
+		{name: "negative cpu", limits: models.BranchResourceLimits{CPUCores: -1}, wantErr: true},
+		{name: "tiny memory", limits: models.BranchResourceLimits{MemoryMB: 64}, wantErr: true},
+		{name: "too few connections", limits: models.BranchResourceLimits{MaxConnections: 2}, wantErr: true},
+		{name: "too many connections", limits: models.BranchResourceLimits{MaxConnections: 500}, wantErr: true},
+		{name: "disk quota and reservation", limits: models.BranchResourceLimits{DiskQuotaGB: 50, DiskReservationGB: 10}},
+		{name: "negative disk quota", limits: models.BranchResourceLimits{DiskQuotaGB: -1}, wantErr: true},
+		{name: "reservation above quota", limits: models.BranchResourceLimits{DiskQuotaGB: 10, DiskReservationGB: 20}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateResourceLimits(tt.limits)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateResourceLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSystemdResourceDirectives(t *testing.T) {
+	if got := systemdResourceDirectives(models.BranchResourceLimits{}); got != "" {
+		t.Errorf("expected no directives without limits, got %q", got)
+	}
+
+	got := systemdResourceDirectives(models.BranchResourceLimits{CPUCores: 1.5, MemoryMB: 1000})
+	want := "CPUQuota=150%\nMemoryHigh=900M\nMemoryMax=1000M\nMemorySwapMax=0"
+	if got != want {
+		t.Errorf("systemdResourceDirectives() = %q, want %q", got, want)
+	}
+}
+
+func TestWithoutSetting(t *testing.T) {
+	conf := "max_connections = 50\nwork_mem = 64MB\n"
+	if got := withoutSetting(conf, "max_connections"); got != "work_mem = 64MB\n" {
+		t.Errorf("withoutSetting() = %q", got)
+	}
+	if got := withoutSetting("max_connections = 50\n", "max_connections"); got != "" {
+		t.Errorf("withoutSetting() = %q, want empty", got)
+	}
+}
+
+func TestWithStatementLogging(t *testing.T) {
+	// Custom settings can't weaken the logging, other settings are kept
+	conf := "work_mem = 64MB\nlog_statement = none\nlog_destination = stderr\n"
+	want := "work_mem = 64MB\nlog_destination = syslog\nsyslog_ident = breakglass-01abc\nlog_statement = all\nlog_connections = on\nlog_disconnections = on\n"
+	if got := withStatementLogging(conf, "breakglass-01abc"); got != want {
+		t.Errorf("withStatementLogging() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package branches
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// BranchMetrics are the PostgreSQL statistics of a branch exposed on /metrics
+// Counters are cumulative since the branch's cluster started, rates (e.g. TPS) are left to Prometheus
+type BranchMetrics struct {
+	BranchName  string
+	RestoreName string
+	Up          bool // False if the branch couldn't be queried, the statistics are zero then
+
+	Connections  int   // Client connections
+	XactCommit   int64 // Committed transactions of the branch database
+	XactRollback int64 // Rolled back transactions of the branch database
+	BlocksHit    int64 // Blocks found in shared buffers
+	BlocksRead   int64 // Blocks read from disk
+	LiveTuples   int64 // Estimated live rows of all user tables
+	DeadTuples   int64 // Estimated dead rows of all user tables (bloat until vacuumed)
+}
+
+// CacheHitRatio returns the share of blocks found in shared buffers (0 before any block was read)
+func (m BranchMetrics) CacheHitRatio() float64 {
+	if m.BlocksHit+m.BlocksRead == 0 {
+		return 0
+	}
+	return float64(m.BlocksHit) / float64(m.BlocksHit+m.BlocksRead)
+}
+
+// branchStatsQuery returns one CSV line: connections, xact_commit, xact_rollback, blks_hit, blks_read, live and dead tuples
+const branchStatsQuery = `SELECT
+	(SELECT count(*) FROM pg_stat_activity WHERE backend_type = 'client backend' AND pid <> pg_backend_pid()),
+	d.xact_commit, d.xact_rollback, d.blks_hit, d.blks_read,
+	(SELECT COALESCE(sum(n_live_tup), 0) FROM pg_stat_user_tables),
+	(SELECT COALESCE(sum(n_dead_tup), 0) FROM pg_stat_user_tables)
+FROM pg_stat_database d WHERE d.datname = current_database()`
+
+// queryBranchStats runs branchStatsQuery against a branch database (replaced in tests)
+var queryBranchStats = func(ctx context.Context, port int, database string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sudo", "-u", "postgres", "psql", "-p", strconv.Itoa(port), "-d", database, "-AtF,", "-c", branchStatsQuery)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to query branch statistics: %w", err)
+	}
+	return string(output), nil
+}
+
+// CollectBranchMetrics queries the statistics of every running branch
+// Suspended branches are skipped (querying them would resume them), branches that fail to answer within timeout are reported down
+func (s *Service) CollectBranchMetrics(ctx context.Context, timeout time.Duration) ([]BranchMetrics, error) {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var branches []models.Branch
+	if err := s.db.Preload("Restore").Where("port > 0 AND suspended_at IS NULL").Order("name").Find(&branches).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branches: %w", err)
+	}
+
+	database := branchDatabaseName(&config)
+	metrics := make([]BranchMetrics, 0, len(branches))
+	for _, branch := range branches {
+		m := BranchMetrics{BranchName: branch.Name, RestoreName: branch.Restore.Name}
+
+		queryCtx, cancel := context.WithTimeout(ctx, timeout)
+		output, err := queryBranchStats(queryCtx, branch.Port, database)
+		cancel()
+		if err == nil {
+			err = parseBranchStats(output, &m)
+		}
+		if err != nil {
+			s.logger.Debug().Err(err).Str("branch_name", branch.Name).Msg("Failed to collect branch metrics")
+		} else {
+			m.Up = true
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// parseBranchStats parses the output of branchStatsQuery into m
+func parseBranchStats(output string, m *BranchMetrics) error {
+	fields := strings.Split(strings.TrimSpace(output), ",")
+	if len(fields) != 7 {
+		return fmt.Errorf("unexpected branch statistics %q", strings.TrimSpace(output))
+	}
+
+	values := make([]int64, len(fields))
+	for i, field := range fields {
+		v, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return fmt.Errorf("unexpected branch statistics %q: %w", strings.TrimSpace(output), err)
+		}
+		values[i] = v
+	}
+
+	m.Connections = int(values[0])
+	m.XactCommit, m.XactRollback = values[1], values[2]
+	m.BlocksHit, m.BlocksRead = values[3], values[4]
+	m.LiveTuples, m.DeadTuples = values[5], values[6]
+	return nil
+}
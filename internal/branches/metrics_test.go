@@ -0,0 +1,71 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestCollectBranchMetrics(t *testing.T) {
+	s, restore := newTestService(t)
+	if err := s.db.Model(&models.Config{}).Where("1 = 1").Update("connection_string", "postgres://source/app").Error; err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+
+	now := time.Now()
+	for _, branch := range []*models.Branch{
+		{Name: "feature-x", RestoreID: restore.ID, Port: 6001},
+		{Name: "feature-y", RestoreID: restore.ID, Port: 6002},
+		{Name: "suspended", RestoreID: restore.ID, Port: 6003, SuspendedAt: &now},
+		{Name: "not-created", RestoreID: restore.ID},
+	} {
+		createTestBranch(t, s, branch)
+	}
+
+	original := queryBranchStats
+	t.Cleanup(func() { queryBranchStats = original })
+	queried := map[int]string{}
+	queryBranchStats = func(ctx context.Context, port int, database string) (string, error) {
+		queried[port] = database
+		if port == 6002 {
+			return "", errors.New("connection refused")
+		}
+		return "3,1200,12,9900,100,5000,250\n", nil
+	}
+
+	metrics, err := s.CollectBranchMetrics(context.Background(), time.Second)
+	if err != nil {
+		t.Fatalf("CollectBranchMetrics() error = %v", err)
+	}
+
+	want := []BranchMetrics{
+		{BranchName: "feature-x", RestoreName: restore.Name, Up: true, Connections: 3, XactCommit: 1200, XactRollback: 12, BlocksHit: 9900, BlocksRead: 100, LiveTuples: 5000, DeadTuples: 250},
+		{BranchName: "feature-y", RestoreName: restore.Name},
+	}
+	if len(metrics) != len(want) {
+		t.Fatalf("CollectBranchMetrics() = %+v, want %+v", metrics, want)
+	}
+	for i := range want {
+		if metrics[i] != want[i] {
+			t.Errorf("metrics[%d] = %+v, want %+v", i, metrics[i], want[i])
+		}
+	}
+	if len(queried) != 2 || queried[6001] != "app" {
+		t.Errorf("queried %v, want the branch database of feature-x and feature-y only", queried)
+	}
+	if got := metrics[0].CacheHitRatio(); got != 0.99 {
+		t.Errorf("CacheHitRatio() = %v, want 0.99", got)
+	}
+}
+
+func TestParseBranchStats(t *testing.T) {
+	for _, output := range []string{"", "3,1200,12", "3,1200,12,9900,100,5000,many"} {
+		var m BranchMetrics
+		if err := parseBranchStats(output, &m); err == nil {
+			t.Errorf("parseBranchStats(%q) succeeded", output)
+		}
+	}
+}
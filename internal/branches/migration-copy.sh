@@ -0,0 +1,125 @@
+#!/bin/bash
+set -eu  # Exit on error and undefined variables, but no pipefail
+
+# Branchd Migration Check Copy Script
+#
+# Creates or destroys the throwaway copy of a branch a migration check runs in.
+#
+# create:
+# 1. Checkpoint the branch so its data and WAL snapshots are consistent
+# 2. Snapshot the branch's dataset (and WAL dataset) and clone the snapshot
+# 3. Start PostgreSQL on the clone, listening on its Unix socket only (no systemd unit, no UFW port)
+# 4. Output COPY_PORT=<port>
+#
+# destroy:
+# 1. Stop the copy's PostgreSQL
+# 2. Destroy the clones and snapshots, the branch itself is never modified
+#
+# A copy left behind by a crashed check is destroyed before a new one is created.
+
+echo "MIGRATION_COPY_STARTED=true"
+
+# Input parameters, passed in the environment (never rendered into the script)
+ACTION="${ACTION}"  # create or destroy
+COPY_NAME="${COPY_NAME}"  # e.g., my-branch.migration-check
+BRANCH_DATASET="${BRANCH_DATASET}"  # e.g., tank/my-branch
+BRANCH_WAL_DATASET="${BRANCH_WAL_DATASET}"  # e.g., nvme/wal/my-branch (empty = pg_wal inside data directory)
+BRANCH_PORT="${BRANCH_PORT}"
+COPY_DATASET="${COPY_DATASET}"  # e.g., tank/my-branch.migration-check
+COPY_MOUNTPOINT="${COPY_MOUNTPOINT}"
+COPY_WAL_DATASET="${COPY_WAL_DATASET}"
+COPY_WAL_MOUNTPOINT="${COPY_WAL_MOUNTPOINT}"
+PG_VERSION="${PG_VERSION}"
+
+COPY_PGDATA="${COPY_MOUNTPOINT}/data"
+PG_CTL="/usr/lib/postgresql/${PG_VERSION}/bin/pg_ctl"
+SNAPSHOT="${BRANCH_DATASET}@${COPY_NAME}"
+WAL_SNAPSHOT="${BRANCH_WAL_DATASET}@${COPY_NAME}"
+
+destroy_copy() {
+    if sudo -u postgres test -f "${COPY_PGDATA}/postmaster.pid" 2>/dev/null; then
+        echo "Stopping copy PostgreSQL..."
+        sudo -u postgres "${PG_CTL}" stop -D "${COPY_PGDATA}" -m immediate >/dev/null 2>&1 || true
+    fi
+
+    if sudo zfs list "${COPY_DATASET}" >/dev/null 2>&1; then
+        echo "Destroying copy clone ${COPY_DATASET}..."
+        sudo zfs destroy -f "${COPY_DATASET}"
+    fi
+    if sudo zfs list -t snapshot "${SNAPSHOT}" >/dev/null 2>&1; then
+        echo "Destroying snapshot ${SNAPSHOT}..."
+        sudo zfs destroy "${SNAPSHOT}"
+    fi
+    if [ -n "${BRANCH_WAL_DATASET}" ]; then
+        if sudo zfs list "${COPY_WAL_DATASET}" >/dev/null 2>&1; then
+            sudo zfs destroy -f "${COPY_WAL_DATASET}"
+        fi
+        if sudo zfs list -t snapshot "${WAL_SNAPSHOT}" >/dev/null 2>&1; then
+            sudo zfs destroy "${WAL_SNAPSHOT}"
+        fi
+        sudo rm -rf "${COPY_WAL_MOUNTPOINT}"
+    fi
+
+    # zfs destroy unmounts but leaves the directory
+    sudo rm -rf "${COPY_MOUNTPOINT}"
+}
+
+if [ "${ACTION}" = "destroy" ]; then
+    destroy_copy
+    echo "MIGRATION_COPY_DESTROYED=true"
+    exit 0
+fi
+
+# Leftovers of a check that didn't clean up (e.g. the server was restarted meanwhile)
+destroy_copy
+
+# Flush the branch to disk before snapshotting data and WAL separately
+# WHY: Snapshots of two datasets are not atomic, without a separate WAL dataset the snapshot is crash-consistent
+echo "Checkpointing branch..."
+if ! sudo -u postgres psql -X -p "${BRANCH_PORT}" -c "CHECKPOINT" >/dev/null; then
+    echo "BRANCHD_ERROR:BRANCH_NOT_READY: Branch is not accepting connections on port ${BRANCH_PORT}"
+    exit 1
+fi
+
+echo "Creating snapshot ${SNAPSHOT}..."
+sudo zfs snapshot "${SNAPSHOT}"
+if [ -n "${BRANCH_WAL_DATASET}" ]; then
+    sudo zfs snapshot "${WAL_SNAPSHOT}"
+fi
+
+echo "Cloning snapshot to ${COPY_DATASET}..."
+sudo zfs clone -o mountpoint="${COPY_MOUNTPOINT}" -o org.openzfs.systemd:ignore=on "${SNAPSHOT}" "${COPY_DATASET}"
+if [ -n "${BRANCH_WAL_DATASET}" ]; then
+    sudo zfs clone -o mountpoint="${COPY_WAL_MOUNTPOINT}" -o org.openzfs.systemd:ignore=on "${WAL_SNAPSHOT}" "${COPY_WAL_DATASET}"
+    sudo -u postgres ln -sfn "${COPY_WAL_MOUNTPOINT}/pg_wal" "${COPY_PGDATA}/pg_wal"
+    sudo chown postgres:postgres -R "${COPY_WAL_MOUNTPOINT}"
+fi
+sudo chown postgres:postgres -R "${COPY_MOUNTPOINT}"
+sudo -u postgres rm -f "${COPY_PGDATA}/postmaster.pid"
+
+# Socket-only ports don't need UFW, they must not collide with another cluster's socket
+COPY_PORT=""
+for port in $(seq 29000 29999); do
+    if [ ! -e "/var/run/postgresql/.s.PGSQL.${port}" ] && ! ss -ln | grep -q ":${port} "; then
+        COPY_PORT="${port}"
+        break
+    fi
+done
+if [ -z "${COPY_PORT}" ]; then
+    echo "BRANCHD_ERROR: Failed to find available port"
+    destroy_copy
+    exit 1
+fi
+
+# The cloned postgresql.conf points at the branch's files and port, overridden on the command line
+# WHY: Small shared_buffers, the copy only lives for one migration next to the running branches
+echo "Starting copy PostgreSQL on port ${COPY_PORT}..."
+if ! sudo -u postgres "${PG_CTL}" start -D "${COPY_PGDATA}" -w -t 120 -l "${COPY_PGDATA}/migration-check.log" \
+    -o "-p ${COPY_PORT} -c listen_addresses='' -c data_directory='${COPY_PGDATA}' -c hba_file='${COPY_PGDATA}/pg_hba.conf' -c ident_file='${COPY_PGDATA}/pg_ident.conf' -c shared_buffers=128MB -c log_destination=stderr -c logging_collector=off" >/dev/null; then
+    echo "BRANCHD_ERROR: Copy PostgreSQL failed to start: $(sudo tail -n 5 "${COPY_PGDATA}/migration-check.log" 2>/dev/null | tr '\n' ' ')"
+    destroy_copy
+    exit 1
+fi
+
+echo "COPY_PORT=${COPY_PORT}"
+echo "MIGRATION_COPY_CREATED=true"
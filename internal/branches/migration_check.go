@@ -0,0 +1,484 @@
+package branches
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+//go:embed migration-copy.sh
+var migrationCopyScript string
+
+// ErrInvalidMigration is returned for migrations that can't be checked, e.g. without statements
+var ErrInvalidMigration = errors.New("invalid migration")
+
+// migrationCheckMu serializes migration checks, each one starts a PostgreSQL cluster on a copy of its branch
+var migrationCheckMu sync.Mutex
+
+// migrationCheckMarker prefixes the lines the check's own queries print, output of the migration is ignored
+const migrationCheckMarker = "BRANCHD_CHECK|"
+
+// Copy script and migration execution (replaced in tests)
+var (
+	runMigrationCopyScript = func(ctx context.Context, params migrationCopyParams) (string, error) {
+		output, err := shellexec.Command(ctx, migrationCopyScript, params).CombinedOutput()
+		return string(output), err
+	}
+	// runMigration runs each command with its own -c, so psql sends statements to the server as they are and
+	// never interprets meta-commands (e.g. \! would run a shell command as postgres)
+	runMigration = func(ctx context.Context, port int, database string, commands []string) (string, string, error) {
+		args := []string{"-u", "postgres", "psql", "-X", "-q", "-At", "-v", "ON_ERROR_STOP=1", "-p", strconv.Itoa(port), "-d", database}
+		for _, command := range commands {
+			args = append(args, "-c", command)
+		}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "sudo", args...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stdout.String(), stderr.String(), err
+	}
+)
+
+// LockInfo is the strongest lock a statement held on a relation
+type LockInfo struct {
+	Relation string `json:"relation"`
+	Mode     string `json:"mode"` // pg_locks mode, e.g. AccessExclusiveLock
+}
+
+// StatementCheck reports how one statement of a migration ran
+type StatementCheck struct {
+	File          string     `json:"file,omitempty"`
+	SQL           string     `json:"sql"`
+	DurationMs    float64    `json:"duration_ms"`
+	Transactional bool       `json:"transactional"` // False for e.g. CREATE INDEX CONCURRENTLY, whose locks aren't observed
+	Locks         []LockInfo `json:"locks"`         // Relation locks held when the statement finished, catalogs excluded
+	Rewrites      []string   `json:"rewrites"`      // Tables whose data was rewritten (every row copied)
+	Warnings      []string   `json:"warnings"`
+	Error         string     `json:"error,omitempty"` // Set on the statement the migration failed at
+}
+
+// MigrationCheck reports a migration run in a throwaway copy of a branch
+type MigrationCheck struct {
+	BranchID   string           `json:"branch_id"`
+	BranchName string           `json:"branch_name"`
+	Succeeded  bool             `json:"succeeded"`  // Statements after a failing one aren't run or reported
+	Statements []StatementCheck `json:"statements"` // In the order they ran, each in its own transaction
+	Warnings   int              `json:"warnings"`
+	DurationMs float64          `json:"duration_ms"`
+	CheckedAt  time.Time        `json:"checked_at"`
+}
+
+// migrationStatement is one statement of a migration and the file it's from
+type migrationStatement struct {
+	file          string
+	sql           string
+	transactional bool
+}
+
+type migrationCopyParams struct {
+	Action            string `env:"ACTION"` // create or destroy
+	CopyName          string `env:"COPY_NAME"`
+	BranchDataset     string `env:"BRANCH_DATASET"`
+	BranchWALDataset  string `env:"BRANCH_WAL_DATASET"`
+	BranchPort        int    `env:"BRANCH_PORT"`
+	CopyDataset       string `env:"COPY_DATASET"`
+	CopyMountpoint    string `env:"COPY_MOUNTPOINT"`
+	CopyWALDataset    string `env:"COPY_WAL_DATASET"`
+	CopyWALMountpoint string `env:"COPY_WAL_MOUNTPOINT"`
+	PgVersion         string `env:"PG_VERSION"`
+}
+
+var (
+	blockingIndexStatement = regexp.MustCompile(`(?i)^CREATE\s+(UNIQUE\s+)?INDEX\b`)
+	migrationCopyPortRegex = regexp.MustCompile(`COPY_PORT=(\d+)`)
+)
+
+// lockStrength orders pg_locks modes, weakest first
+var lockStrength = map[string]int{
+	"AccessShareLock":          1,
+	"RowShareLock":             2,
+	"RowExclusiveLock":         3,
+	"ShareUpdateExclusiveLock": 4,
+	"ShareLock":                5,
+	"ShareRowExclusiveLock":    6,
+	"ExclusiveLock":            7,
+	"AccessExclusiveLock":      8,
+}
+
+// CheckMigration runs a migration in a copy of a branch cloned from a fresh ZFS snapshot, reports the locks each
+// statement took, how long it ran and which tables it rewrote, then destroys the copy. The branch isn't modified
+// A migration failing at a statement is reported in the check, errors are returned when the check couldn't run
+func (s *Service) CheckMigration(ctx context.Context, branch *models.Branch, files []models.MigrationFile) (*MigrationCheck, error) {
+	statements, err := parseMigration(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	var restore models.Restore
+	if err := s.db.Where("id = ?", branch.RestoreID).First(&restore).Error; err != nil {
+		return nil, fmt.Errorf("failed to load restore: %w", err)
+	}
+	if branch.Port == 0 {
+		return nil, fmt.Errorf("branch %s has no running cluster", branch.Name)
+	}
+
+	migrationCheckMu.Lock()
+	defer migrationCheckMu.Unlock()
+
+	if branch.SuspendedAt != nil {
+		if err := s.ResumeBranch(ctx, branch.ID); err != nil {
+			return nil, fmt.Errorf("failed to resume branch: %w", err)
+		}
+	}
+
+	storage := s.config.Storage
+	copyName := branch.Name + ".migration-check" // Branch names can't contain a dot
+	params := migrationCopyParams{
+		CopyName:          copyName,
+		BranchDataset:     storage.DatasetName(branch.Name),
+		BranchWALDataset:  storage.WALDatasetName(branch.Name),
+		BranchPort:        branch.Port,
+		CopyDataset:       storage.DatasetName(copyName),
+		CopyMountpoint:    storage.MountPath(copyName),
+		CopyWALDataset:    storage.WALDatasetName(copyName),
+		CopyWALMountpoint: storage.WALMountPath(copyName),
+		PgVersion:         restore.ClusterPostgresVersion(&config),
+	}
+	port, err := s.createMigrationCopy(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// Also after a timeout, the copy holds a running cluster and a snapshot of the branch
+		if err := s.destroyMigrationCopy(context.WithoutCancel(ctx), params); err != nil {
+			s.logger.Error().Err(err).Str("branch_name", branch.Name).Msg("Failed to destroy migration check copy")
+		}
+	}()
+
+	started := time.Now()
+	stdout, stderr, runErr := runMigration(ctx, port, branchDatabaseName(&config), migrationCommands(statements))
+	if runErr != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("migration check interrupted: %w", ctx.Err())
+	}
+
+	check, err := parseMigrationOutput(statements, stdout)
+	if err != nil {
+		return nil, err
+	}
+	check.Succeeded = runErr == nil && len(check.Statements) == len(statements)
+	if runErr != nil {
+		// The last statement that started failed, or its COMMIT did (e.g. a deferred constraint)
+		last := len(check.Statements) - 1
+		if last < 0 {
+			return nil, fmt.Errorf("failed to run migration: %s", migrationError(stderr))
+		}
+		check.Statements[last].Error = migrationError(stderr)
+	}
+
+	check.BranchID = branch.ID
+	check.BranchName = branch.Name
+	check.DurationMs = float64(time.Since(started).Microseconds()) / 1000
+	check.CheckedAt = time.Now()
+	for _, statement := range check.Statements {
+		check.Warnings += len(statement.Warnings)
+	}
+
+	s.logger.Info().
+		Str("branch_name", branch.Name).
+		Int("statements", len(check.Statements)).
+		Int("warnings", check.Warnings).
+		Bool("succeeded", check.Succeeded).
+		Msg("Migration checked")
+	return check, nil
+}
+
+// createMigrationCopy snapshots and clones the branch and starts PostgreSQL on the clone, returning its port
+func (s *Service) createMigrationCopy(ctx context.Context, params migrationCopyParams) (int, error) {
+	params.Action = "create"
+	output, err := s.runMigrationCopy(ctx, params)
+	if err != nil {
+		// Partially created copies are destroyed by the script
+		if strings.Contains(output, "BRANCHD_ERROR") {
+			return 0, fmt.Errorf("failed to create migration check copy: %s", extractErrorMessage(output))
+		}
+		s.logger.Error().Err(err).Str("output", output).Msg("Failed to create migration check copy")
+		return 0, fmt.Errorf("failed to create migration check copy: %w", err)
+	}
+
+	matches := migrationCopyPortRegex.FindStringSubmatch(output)
+	if len(matches) < 2 {
+		return 0, fmt.Errorf("migration copy script did not report a port")
+	}
+	return strconv.Atoi(matches[1])
+}
+
+// destroyMigrationCopy stops the copy's PostgreSQL and destroys its clone and snapshot
+func (s *Service) destroyMigrationCopy(ctx context.Context, params migrationCopyParams) error {
+	params.Action = "destroy"
+	output, err := s.runMigrationCopy(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to destroy migration check copy: %w: %s", err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+func (s *Service) runMigrationCopy(ctx context.Context, params migrationCopyParams) (string, error) {
+	return runMigrationCopyScript(ctx, params)
+}
+
+// ValidateMigration checks a migration can be run by CheckMigration, without running it
+func ValidateMigration(files []models.MigrationFile) error {
+	_, err := parseMigration(files)
+	return err
+}
+
+// parseMigration splits the files into statements, dropping transaction control
+func parseMigration(files []models.MigrationFile) ([]migrationStatement, error) {
+	var statements []migrationStatement
+	for _, file := range files {
+		for _, sql := range pgclient.SplitStatements(file.SQL) {
+			if strings.HasPrefix(sql, `\`) {
+				return nil, fmt.Errorf("%w: psql meta-commands aren't supported (%s)", ErrInvalidMigration, firstLine(sql))
+			}
+			// Every statement runs in its own transaction, the migration's own transaction control is dropped
+			if pgclient.IsTransactionControl(sql) {
+				continue
+			}
+			statements = append(statements, migrationStatement{
+				file:          file.Name,
+				sql:           sql,
+				transactional: !pgclient.IsNonTransactional(sql),
+			})
+		}
+	}
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("%w: no statements", ErrInvalidMigration)
+	}
+	return statements, nil
+}
+
+// migrationCommands wraps each statement in the queries recording its timing, locks and the tables' data files
+// Statement i (from 1) runs between start|i and end|i markers, relations|0 is the state before the migration
+func migrationCommands(statements []migrationStatement) []string {
+	commands := []string{relationsQuery(0)}
+	for i, statement := range statements {
+		n := i + 1
+		if statement.transactional {
+			commands = append(commands, "BEGIN")
+		}
+		commands = append(commands,
+			fmt.Sprintf(`SELECT '%sstart|%d|' || (extract(epoch FROM clock_timestamp()) * 1000)`, migrationCheckMarker, n),
+			statement.sql,
+			fmt.Sprintf(`SELECT '%send|%d|' || (extract(epoch FROM clock_timestamp()) * 1000)`, migrationCheckMarker, n),
+		)
+		if statement.transactional {
+			// Locks are held until commit, pg_locks lists everything the statement took
+			commands = append(commands, fmt.Sprintf(`SELECT '%slock|%d|' || l.relation || '|' || l.mode FROM pg_locks l `+
+				`WHERE l.pid = pg_backend_pid() AND l.locktype = 'relation' AND l.granted AND l.relation IS NOT NULL`, migrationCheckMarker, n))
+		}
+		commands = append(commands, relationsQuery(n))
+		if statement.transactional {
+			commands = append(commands, "COMMIT")
+		}
+	}
+	return commands
+}
+
+// relationsQuery lists the user tables, materialized views and indexes with their data files (relfilenode),
+// a table's relfilenode changes when a statement rewrites it
+func relationsQuery(n int) string {
+	return fmt.Sprintf(`SELECT '%srel|%d|' || c.oid || '|' || c.relfilenode || '|' || c.relkind || '|' || n.nspname || '.' || c.relname `+
+		`FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace `+
+		`WHERE c.relkind IN ('r', 'p', 'm', 'i') AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg\_%%'`,
+		migrationCheckMarker, n)
+}
+
+// migrationRelation is a relation listed by relationsQuery
+type migrationRelation struct {
+	fileNode string
+	kind     string
+	name     string
+}
+
+// parseMigrationOutput builds the statement reports from the marker lines of the migration's output
+// Only statements that started are reported, the last one failed if it has no end marker
+func parseMigrationOutput(statements []migrationStatement, output string) (*MigrationCheck, error) {
+	relations := map[int]map[string]migrationRelation{}
+	starts := map[int]float64{}
+	ends := map[int]float64{}
+	locks := map[int]map[string]string{} // Relation OID -> strongest mode
+
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, migrationCheckMarker) {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimPrefix(line, migrationCheckMarker), "|", 6)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected check line %q", line)
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 || n > len(statements) {
+			return nil, fmt.Errorf("unexpected check line %q", line)
+		}
+
+		switch fields[0] {
+		case "start", "end":
+			ms, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected check line %q", line)
+			}
+			if fields[0] == "start" {
+				starts[n] = ms
+			} else {
+				ends[n] = ms
+			}
+		case "lock":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("unexpected check line %q", line)
+			}
+			if locks[n] == nil {
+				locks[n] = map[string]string{}
+			}
+			if lockStrength[fields[3]] > lockStrength[locks[n][fields[2]]] {
+				locks[n][fields[2]] = fields[3]
+			}
+		case "rel":
+			if len(fields) != 6 {
+				return nil, fmt.Errorf("unexpected check line %q", line)
+			}
+			if relations[n] == nil {
+				relations[n] = map[string]migrationRelation{}
+			}
+			relations[n][fields[2]] = migrationRelation{fileNode: fields[3], kind: fields[4], name: fields[5]}
+		default:
+			return nil, fmt.Errorf("unexpected check line %q", line)
+		}
+	}
+
+	check := &MigrationCheck{Statements: []StatementCheck{}}
+	before := relations[0]
+	previous := before
+	for i, statement := range statements {
+		n := i + 1
+		start, ok := starts[n]
+		if !ok {
+			break
+		}
+		result := StatementCheck{
+			File:          statement.file,
+			SQL:           statement.sql,
+			Transactional: statement.transactional,
+			Locks:         []LockInfo{},
+			Rewrites:      []string{},
+			Warnings:      []string{},
+		}
+		end, finished := ends[n]
+		if !finished {
+			result.Error = "statement failed"
+			check.Statements = append(check.Statements, result)
+			break
+		}
+		result.DurationMs = end - start
+
+		after := relations[n]
+		// Relations dropped by the statement are only known from before it
+		resolve := func(oid string) (migrationRelation, bool) {
+			if relation, ok := after[oid]; ok {
+				return relation, true
+			}
+			relation, ok := previous[oid]
+			return relation, ok
+		}
+
+		for oid, mode := range locks[n] {
+			relation, ok := resolve(oid)
+			if !ok {
+				continue // System catalogs
+			}
+			result.Locks = append(result.Locks, LockInfo{Relation: relation.name, Mode: mode})
+			// Tables created by the migration have no readers or writers to block
+			if _, existed := before[oid]; existed && relation.kind != "i" {
+				if warning := lockWarning(statement.sql, relation.name, mode, result.DurationMs); warning != "" {
+					result.Warnings = append(result.Warnings, warning)
+				}
+			}
+		}
+		sort.Slice(result.Locks, func(a, b int) bool {
+			if lockStrength[result.Locks[a].Mode] != lockStrength[result.Locks[b].Mode] {
+				return lockStrength[result.Locks[a].Mode] > lockStrength[result.Locks[b].Mode]
+			}
+			return result.Locks[a].Relation < result.Locks[b].Relation
+		})
+
+		for oid, relation := range after {
+			old, existed := previous[oid]
+			if !existed || (relation.kind != "r" && relation.kind != "m") || old.fileNode == relation.fileNode {
+				continue
+			}
+			result.Rewrites = append(result.Rewrites, relation.name)
+		}
+		sort.Strings(result.Rewrites)
+		for _, table := range result.Rewrites {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Rewrites %s: every row is copied, which needs disk space for a second copy of the table", table))
+		}
+		sort.Strings(result.Warnings)
+
+		check.Statements = append(check.Statements, result)
+		previous = after
+	}
+	return check, nil
+}
+
+// lockWarning describes what a lock on an existing table blocks, empty for locks that don't block reads or writes
+func lockWarning(sql, table, mode string, durationMs float64) string {
+	var warning string
+	switch mode {
+	case "AccessExclusiveLock":
+		warning = "Blocks reads and writes of " + table
+	case "ExclusiveLock", "ShareRowExclusiveLock", "ShareLock":
+		warning = "Blocks writes to " + table
+	default:
+		return ""
+	}
+	if durationMs >= 1000 {
+		warning += fmt.Sprintf(" for %s on this branch's data", (time.Duration(durationMs) * time.Millisecond).Round(100*time.Millisecond))
+	}
+	warning += " until the transaction commits"
+	if mode == "ShareLock" && blockingIndexStatement.MatchString(sql) {
+		warning += ", use CREATE INDEX CONCURRENTLY"
+	}
+	return warning
+}
+
+// migrationError returns psql's error message without the notices printed before it
+func migrationError(stderr string) string {
+	if i := strings.Index(stderr, "ERROR:"); i >= 0 {
+		stderr = stderr[i:]
+	}
+	return strings.TrimSpace(stderr)
+}
+
+func firstLine(s string) string {
+	if newline := strings.IndexByte(s, '\n'); newline >= 0 {
+		return s[:newline]
+	}
+	return s
+}
@@ -0,0 +1,171 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestValidateMigration(t *testing.T) {
+	for name, files := range map[string][]models.MigrationFile{
+		"empty":             {{Name: "001.sql", SQL: "-- nothing yet\n"}},
+		"only transactions": {{Name: "001.sql", SQL: "BEGIN; COMMIT;"}},
+		"meta-command":      {{Name: "001.sql", SQL: "\\i other.sql\nSELECT 1;"}},
+	} {
+		if err := ValidateMigration(files); !errors.Is(err, ErrInvalidMigration) {
+			t.Errorf("ValidateMigration(%s) error = %v, want ErrInvalidMigration", name, err)
+		}
+	}
+	if err := ValidateMigration([]models.MigrationFile{{Name: "001.sql", SQL: "BEGIN; CREATE TABLE a (id int); COMMIT;"}}); err != nil {
+		t.Errorf("ValidateMigration() error = %v", err)
+	}
+}
+
+// stubMigrationCopy replaces the copy script, recording the actions it ran
+func stubMigrationCopy(t *testing.T) *[]string {
+	original := runMigrationCopyScript
+	t.Cleanup(func() { runMigrationCopyScript = original })
+	var actions []string
+	runMigrationCopyScript = func(ctx context.Context, params migrationCopyParams) (string, error) {
+		if params.Action == "create" {
+			actions = append(actions, "create")
+			return "MIGRATION_COPY_STARTED=true\nCOPY_PORT=29000\nMIGRATION_COPY_CREATED=true\n", nil
+		}
+		actions = append(actions, "destroy")
+		return "MIGRATION_COPY_DESTROYED=true\n", nil
+	}
+	return &actions
+}
+
+func stubMigration(t *testing.T, stdout, stderr string, err error) *[]string {
+	original := runMigration
+	t.Cleanup(func() { runMigration = original })
+	var ran []string
+	runMigration = func(ctx context.Context, port int, database string, commands []string) (string, string, error) {
+		if port != 29000 || database != "app" {
+			t.Errorf("migration ran on port %d, database %s, want the copy's 29000 and app", port, database)
+		}
+		ran = commands
+		return stdout, stderr, err
+	}
+	return &ran
+}
+
+const migrationRelationsBefore = `BRANCHD_CHECK|rel|0|16384|16384|r|public.users
+BRANCHD_CHECK|rel|0|16390|16390|i|public.users_pkey
+BRANCHD_CHECK|rel|0|16400|16400|r|public.events
+`
+
+func TestCheckMigration(t *testing.T) {
+	s, restore := newTestService(t)
+	if err := s.db.Model(&models.Config{}).Where("1 = 1").Update("connection_string", "postgres://source/app").Error; err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001}
+	createTestBranch(t, s, branch)
+
+	actions := stubMigrationCopy(t)
+	stdout := migrationRelationsBefore + `BRANCHD_CHECK|start|1|1700000000000.000
+BRANCHD_CHECK|end|1|1700000002500.000
+BRANCHD_CHECK|lock|1|16384|AccessExclusiveLock
+BRANCHD_CHECK|lock|1|16384|ShareUpdateExclusiveLock
+BRANCHD_CHECK|lock|1|1259|AccessShareLock
+BRANCHD_CHECK|rel|1|16384|16500|r|public.users
+BRANCHD_CHECK|rel|1|16390|16501|i|public.users_pkey
+BRANCHD_CHECK|rel|1|16400|16400|r|public.events
+BRANCHD_CHECK|start|2|1700000002600.000
+BRANCHD_CHECK|end|2|1700000002610.000
+BRANCHD_CHECK|lock|2|16600|AccessExclusiveLock
+BRANCHD_CHECK|rel|2|16384|16500|r|public.users
+BRANCHD_CHECK|rel|2|16390|16501|i|public.users_pkey
+BRANCHD_CHECK|rel|2|16400|16400|r|public.events
+BRANCHD_CHECK|rel|2|16600|16600|r|public.orders
+BRANCHD_CHECK|start|3|1700000002700.000
+BRANCHD_CHECK|end|3|1700000003700.000
+BRANCHD_CHECK|rel|3|16384|16500|r|public.users
+BRANCHD_CHECK|rel|3|16390|16501|i|public.users_pkey
+BRANCHD_CHECK|rel|3|16400|16400|r|public.events
+BRANCHD_CHECK|rel|3|16600|16600|r|public.orders
+BRANCHD_CHECK|rel|3|16700|16700|i|public.events_created_at_idx
+`
+	ran := stubMigration(t, stdout, "", nil)
+
+	check, err := s.CheckMigration(context.Background(), branch, []models.MigrationFile{
+		{Name: "001_users.sql", SQL: "BEGIN;\nALTER TABLE users ALTER COLUMN id TYPE bigint;\nCOMMIT;\n"},
+		{Name: "002_orders.sql", SQL: "CREATE TABLE orders (id bigint);\nCREATE INDEX CONCURRENTLY events_created_at_idx ON events (created_at);\n"},
+	})
+	if err != nil {
+		t.Fatalf("CheckMigration() error = %v", err)
+	}
+	if !reflect.DeepEqual(*actions, []string{"create", "destroy"}) {
+		t.Errorf("copy actions = %v, want create then destroy", *actions)
+	}
+	if !check.Succeeded || len(check.Statements) != 3 {
+		t.Fatalf("check = %+v, want 3 statements succeeded", check)
+	}
+	// BEGIN and COMMIT of the migration are replaced by a transaction per statement, except the concurrent index
+	if begins := strings.Count(strings.Join(*ran, "\n"), "\nBEGIN\n"); begins != 2 {
+		t.Errorf("ran %d transactions, want 2", begins)
+	}
+
+	alter, create, index := check.Statements[0], check.Statements[1], check.Statements[2]
+	if alter.File != "001_users.sql" || alter.DurationMs != 2500 || !alter.Transactional {
+		t.Errorf("alter = %+v, want 001_users.sql, 2500ms in a transaction", alter)
+	}
+	if !reflect.DeepEqual(alter.Locks, []LockInfo{{Relation: "public.users", Mode: "AccessExclusiveLock"}}) {
+		t.Errorf("alter locks = %+v, want the strongest lock on users, catalogs excluded", alter.Locks)
+	}
+	if !reflect.DeepEqual(alter.Rewrites, []string{"public.users"}) {
+		t.Errorf("alter rewrites = %v, want users", alter.Rewrites)
+	}
+	if len(alter.Warnings) != 2 || !strings.HasPrefix(alter.Warnings[0], "Blocks reads and writes of public.users for 2.5s") || !strings.HasPrefix(alter.Warnings[1], "Rewrites public.users") {
+		t.Errorf("alter warnings = %q, want blocking and rewrite warnings", alter.Warnings)
+	}
+	if len(create.Locks) != 1 || len(create.Warnings) != 0 {
+		t.Errorf("create = %+v, want a lock on the new table without warnings", create)
+	}
+	if index.Transactional || len(index.Locks) != 0 || len(index.Warnings) != 0 {
+		t.Errorf("index = %+v, want a concurrent index outside a transaction", index)
+	}
+	if check.Warnings != 2 {
+		t.Errorf("Warnings = %d, want 2", check.Warnings)
+	}
+}
+
+func TestCheckMigrationFailure(t *testing.T) {
+	s, restore := newTestService(t)
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001}
+	createTestBranch(t, s, branch)
+	if err := s.db.Model(&models.Config{}).Where("1 = 1").Update("connection_string", "postgres://source/app").Error; err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+
+	actions := stubMigrationCopy(t)
+	stdout := migrationRelationsBefore + `BRANCHD_CHECK|start|1|1700000000000.000
+BRANCHD_CHECK|end|1|1700000000001.000
+BRANCHD_CHECK|rel|1|16384|16384|r|public.users
+BRANCHD_CHECK|start|2|1700000000010.000
+`
+	stderr := "NOTICE:  table \"legacy\" does not exist, skipping\nERROR:  column \"email\" of relation \"users\" contains null values\n"
+	stubMigration(t, stdout, stderr, errors.New("exit status 1"))
+
+	check, err := s.CheckMigration(context.Background(), branch, []models.MigrationFile{
+		{SQL: "DROP TABLE IF EXISTS legacy; ALTER TABLE users ALTER COLUMN email SET NOT NULL; ALTER TABLE users ADD COLUMN age int;"},
+	})
+	if err != nil {
+		t.Fatalf("CheckMigration() error = %v", err)
+	}
+	if check.Succeeded || len(check.Statements) != 2 {
+		t.Fatalf("check = %+v, want failed at the second statement", check)
+	}
+	if got := check.Statements[1].Error; got != `ERROR:  column "email" of relation "users" contains null values` {
+		t.Errorf("Error = %q, want the psql error without notices", got)
+	}
+	if !reflect.DeepEqual(*actions, []string{"create", "destroy"}) {
+		t.Errorf("copy actions = %v, want the copy destroyed after the failure", *actions)
+	}
+}
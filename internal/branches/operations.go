@@ -0,0 +1,31 @@
+package branches
+
+import (
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Branch operations (models.BranchOperation.Operation)
+const branchOperationCreate = "create"
+
+// beginBranchOperation records an in-flight branch operation, due scheduled refreshes wait until it's done
+// The returned func ends the operation; failing to record one only means a refresh may start meanwhile
+func (s *Service) beginBranchOperation(branchName, operation, createdByID string) func() {
+	// Operations left over from a crashed process no longer defer refreshes, drop them
+	if err := s.db.Where("created_at <= ?", time.Now().Add(-models.BranchOperationTTL)).Delete(&models.BranchOperation{}).Error; err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to delete expired branch operations")
+	}
+
+	op := models.BranchOperation{BranchName: branchName, Operation: operation, CreatedByID: createdByID}
+	if err := s.db.Create(&op).Error; err != nil {
+		s.logger.Warn().Err(err).Str("branch_name", branchName).Msg("Failed to record branch operation (non-fatal)")
+		return func() {}
+	}
+
+	return func() {
+		if err := s.db.Delete(&op).Error; err != nil {
+			s.logger.Warn().Err(err).Str("branch_name", branchName).Msg("Failed to end branch operation")
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package branches
+
+import (
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestBeginBranchOperation(t *testing.T) {
+	s, _ := newTestService(t)
+
+	stale := models.BranchOperation{BaseModel: models.BaseModel{CreatedAt: time.Now().Add(-time.Hour)}, BranchName: "crashed", Operation: branchOperationCreate}
+	if err := s.db.Create(&stale).Error; err != nil {
+		t.Fatalf("failed to create branch operation: %v", err)
+	}
+
+	done := s.beginBranchOperation("feature-x", branchOperationCreate, "user-1")
+
+	var operations []models.BranchOperation
+	if err := s.db.Find(&operations).Error; err != nil {
+		t.Fatalf("failed to load branch operations: %v", err)
+	}
+	if len(operations) != 1 || operations[0].BranchName != "feature-x" || operations[0].CreatedByID != "user-1" {
+		t.Fatalf("branch operations = %+v, want only feature-x's (expired ones deleted)", operations)
+	}
+
+	done()
+	var count int64
+	s.db.Model(&models.BranchOperation{}).Count(&count)
+	if count != 0 {
+		t.Errorf("branch operations after done = %d, want 0", count)
+	}
+}
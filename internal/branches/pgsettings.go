@@ -0,0 +1,160 @@
+package branches
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
+)
+
+// Shares of a branch's memory budget that custom settings may claim
+const (
+	maxSharedBuffersShare      = 0.25 // The usual PostgreSQL recommendation for a dedicated server
+	maxMaintenanceWorkMemShare = 0.25
+)
+
+// defaultMaxConnections is PostgreSQL's max_connections default, used to size work_mem
+const defaultMaxConnections = 100
+
+var memorySettingRegex = regexp.MustCompile(`^(\d+)\s*(kB|MB|GB|TB)?$`)
+
+// memorySettingBlockKB is the unit of memory settings given without a unit (kB unless listed)
+var memorySettingBlockKB = map[string]int64{
+	"shared_buffers": 8,
+}
+
+// ValidatePostgresqlConf checks custom branch PostgreSQL settings
+// Memory settings are checked against the VM's memory shared by the existing branches (at least one)
+func (s *Service) ValidatePostgresqlConf(conf string) error {
+	var branchCount int64
+	if err := s.db.Model(&models.Branch{}).Count(&branchCount).Error; err != nil {
+		return fmt.Errorf("failed to count branches: %w", err)
+	}
+	return s.checkPostgresqlConf(conf, max(int(branchCount), 1), models.BranchResourceLimits{})
+}
+
+// checkPostgresqlConf validates settings against the VM's memory shared by branchCount branches
+// Only syntax is checked when the VM's memory can't be read
+func (s *Service) checkPostgresqlConf(conf string, branchCount int, limits models.BranchResourceLimits) error {
+	totalMemoryMB, err := sysinfo.TotalMemoryMB()
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to read VM memory, skipping PostgreSQL memory limits")
+		totalMemoryMB = 0
+	}
+	return validatePostgresqlSettings(conf, totalMemoryMB, branchCount, limits)
+}
+
+// validatePostgresqlSettings checks custom PostgreSQL settings strictly (unlike filterPostgresqlSettings)
+// so users get an error for every setting that would be dropped or could exhaust the VM's memory
+// Each branch gets totalMemoryMB / branchCount, or its memory limit if lower (totalMemoryMB 0 skips memory checks)
+func validatePostgresqlSettings(conf string, totalMemoryMB, branchCount int, limits models.BranchResourceLimits) error {
+	settings := map[string]string{}
+	for i, line := range strings.Split(conf, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("line %d: expected 'setting = value', got %q", i+1, line)
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.Trim(strings.TrimSpace(parts[1]), "'")
+
+		if !allowedPostgresqlSettings[key] {
+			return fmt.Errorf("line %d: %s can't be customized for branches", i+1, key)
+		}
+		settings[key] = value
+	}
+
+	maxConnections := defaultMaxConnections
+	if value, ok := settings["max_connections"]; ok {
+		conn, err := strconv.Atoi(value)
+		if err != nil || conn < 1 || conn > maxBranchMaxConnections {
+			return fmt.Errorf("max_connections must be between 1 and %d, got %q", maxBranchMaxConnections, value)
+		}
+		maxConnections = conn
+	}
+	if limits.MaxConnections > 0 {
+		maxConnections = limits.MaxConnections
+	}
+
+	memoryKB := map[string]int64{}
+	for _, key := range []string{"shared_buffers", "work_mem", "maintenance_work_mem"} {
+		value, ok := settings[key]
+		if !ok {
+			continue
+		}
+		kb, err := parseMemorySetting(key, value)
+		if err != nil {
+			return err
+		}
+		memoryKB[key] = kb
+	}
+
+	if totalMemoryMB <= 0 {
+		return nil
+	}
+
+	budgetMB := totalMemoryMB / max(branchCount, 1)
+	budgetSource := fmt.Sprintf("%dMB of RAM shared by %d branches", totalMemoryMB, branchCount)
+	if limits.MemoryMB > 0 && limits.MemoryMB < budgetMB {
+		budgetMB = limits.MemoryMB
+		budgetSource = fmt.Sprintf("the branch's %dMB memory limit", limits.MemoryMB)
+	}
+	budgetKB := int64(budgetMB) * 1024
+
+	if kb, ok := memoryKB["shared_buffers"]; ok {
+		if allowed := int64(float64(budgetKB) * maxSharedBuffersShare); kb > allowed {
+			return fmt.Errorf("shared_buffers = %s exceeds 25%% of %s; set it to at most %dMB, or delete branches",
+				settings["shared_buffers"], budgetSource, allowed/1024)
+		}
+	}
+	if kb, ok := memoryKB["maintenance_work_mem"]; ok {
+		if allowed := int64(float64(budgetKB) * maxMaintenanceWorkMemShare); kb > allowed {
+			return fmt.Errorf("maintenance_work_mem = %s exceeds 25%% of %s; set it to at most %dMB, or delete branches",
+				settings["maintenance_work_mem"], budgetSource, allowed/1024)
+		}
+	}
+	// Every connection may use work_mem (per sort or hash), so they must fit in the budget together
+	if kb, ok := memoryKB["work_mem"]; ok {
+		if allowed := budgetKB / int64(maxConnections); kb > allowed {
+			return fmt.Errorf("work_mem = %s times %d max_connections exceeds %s; set work_mem to at most %dkB or lower max_connections",
+				settings["work_mem"], maxConnections, budgetSource, allowed)
+		}
+	}
+
+	return nil
+}
+
+// parseMemorySetting converts a PostgreSQL memory value (e.g. "128MB") to kilobytes
+func parseMemorySetting(key, value string) (int64, error) {
+	matches := memorySettingRegex.FindStringSubmatch(value)
+	if matches == nil {
+		return 0, fmt.Errorf("%s: invalid memory value %q (use a whole number with kB, MB, GB or TB)", key, value)
+	}
+
+	amount, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid memory value %q", key, value)
+	}
+
+	switch matches[2] {
+	case "kB":
+		return amount, nil
+	case "MB":
+		return amount * 1024, nil
+	case "GB":
+		return amount * 1024 * 1024, nil
+	case "TB":
+		return amount * 1024 * 1024 * 1024, nil
+	}
+	if blockKB, ok := memorySettingBlockKB[key]; ok {
+		return amount * blockKB, nil
+	}
+	return amount, nil
+}
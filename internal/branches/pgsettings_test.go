@@ -0,0 +1,78 @@
+package branches
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestValidatePostgresqlSettings(t *testing.T) {
+	tests := []struct {
+		name          string
+		conf          string
+		totalMemoryMB int
+		branchCount   int
+		limits        models.BranchResourceLimits
+		wantErr       string
+	}{
+		{name: "empty", conf: "", totalMemoryMB: 16384, branchCount: 1},
+		{name: "comments and blank lines", conf: "# tuned\n\nrandom_page_cost = 1.1\n", totalMemoryMB: 16384, branchCount: 1},
+		{name: "malformed line", conf: "shared_buffers 1GB", totalMemoryMB: 16384, branchCount: 1, wantErr: "line 1"},
+		{name: "unsupported setting", conf: "fsync = off", totalMemoryMB: 16384, branchCount: 1, wantErr: "fsync can't be customized"},
+		{name: "invalid max_connections", conf: "max_connections = 500", totalMemoryMB: 16384, branchCount: 1, wantErr: "max_connections must be between"},
+		{name: "invalid memory value", conf: "work_mem = lots", totalMemoryMB: 16384, branchCount: 1, wantErr: "invalid memory value"},
+		{name: "shared_buffers within budget", conf: "shared_buffers = 4GB", totalMemoryMB: 16384, branchCount: 1},
+		{name: "shared_buffers quoted", conf: "shared_buffers = '4GB'", totalMemoryMB: 16384, branchCount: 1},
+		{name: "shared_buffers over budget", conf: "shared_buffers = 4GB", totalMemoryMB: 16384, branchCount: 4, wantErr: "at most 1024MB"},
+		{name: "shared_buffers in blocks", conf: "shared_buffers = 131072", totalMemoryMB: 16384, branchCount: 4},
+		{name: "shared_buffers over memory limit", conf: "shared_buffers = 1GB", totalMemoryMB: 16384, branchCount: 1,
+			limits: models.BranchResourceLimits{MemoryMB: 2048}, wantErr: "2048MB memory limit"},
+		{name: "maintenance_work_mem over budget", conf: "maintenance_work_mem = 2GB", totalMemoryMB: 8192, branchCount: 2, wantErr: "maintenance_work_mem"},
+		{name: "work_mem within budget", conf: "work_mem = 64MB", totalMemoryMB: 16384, branchCount: 1},
+		{name: "work_mem over budget", conf: "work_mem = 256MB", totalMemoryMB: 16384, branchCount: 1, wantErr: "lower max_connections"},
+		{name: "work_mem with fewer connections", conf: "work_mem = 256MB\nmax_connections = 20", totalMemoryMB: 16384, branchCount: 1},
+		{name: "work_mem with enforced connections", conf: "work_mem = 256MB", totalMemoryMB: 16384, branchCount: 1,
+			limits: models.BranchResourceLimits{MaxConnections: 20}},
+		{name: "unknown memory skips limits", conf: "shared_buffers = 64GB", totalMemoryMB: 0, branchCount: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePostgresqlSettings(tt.conf, tt.totalMemoryMB, tt.branchCount, tt.limits)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseMemorySetting(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		want  int64
+	}{
+		{key: "work_mem", value: "4MB", want: 4096},
+		{key: "work_mem", value: "512kB", want: 512},
+		{key: "work_mem", value: "1024", want: 1024},
+		{key: "shared_buffers", value: "1GB", want: 1024 * 1024},
+		{key: "shared_buffers", value: "16384", want: 131072},
+	}
+
+	for _, tt := range tests {
+		got, err := parseMemorySetting(tt.key, tt.value)
+		if err != nil {
+			t.Fatalf("parseMemorySetting(%q, %q) error = %v", tt.key, tt.value, err)
+		}
+		if got != tt.want {
+			t.Errorf("parseMemorySetting(%q, %q) = %d, want %d", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package branches
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+)
+
+// branchLogDir holds a log file per branch next to the restore logs (replaced in tests)
+var branchLogDir = restore.RestoreLogDir
+
+// execPostBranchSQL runs SQL in a branch's database, stopping at the first error (replaced in tests)
+// The SQL is passed to psql on stdin, never through a shell or the command line
+var execPostBranchSQL = func(ctx context.Context, postgresVersion string, port int, databaseName, sql string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sudo", "-u", "postgres",
+		fmt.Sprintf("/usr/lib/postgresql/%s/bin/psql", postgresVersion),
+		"-X", "-v", "ON_ERROR_STOP=1",
+		"-p", strconv.Itoa(port), "-d", databaseName, "-f", "-")
+	cmd.Stdin = strings.NewReader(sql)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// BranchLogPath returns the log file of a branch, e.g. with the output of its post-branch SQL
+func BranchLogPath(branchName string) string {
+	return filepath.Join(branchLogDir, "branch-"+branchName+".log")
+}
+
+// applyPostBranchSQL runs the post-branch SQL in a recorded branch, deleting the branch when it fails
+// Break-glass branches hold raw data for investigations, nothing is run in them
+func (s *Service) applyPostBranchSQL(ctx context.Context, config *models.Config, restoreRecord *models.Restore, branch *models.Branch, params CreateBranchParams) error {
+	if params.BreakGlass {
+		return nil
+	}
+	err := s.runPostBranchSQL(ctx, config, restoreRecord, branch, params)
+	if err == nil {
+		return nil
+	}
+	if deleteErr := s.DeleteBranch(context.WithoutCancel(ctx), DeleteBranchParams{BranchName: branch.Name}); deleteErr != nil {
+		s.logger.Error().Err(deleteErr).Str("branch_name", branch.Name).Msg("Failed to delete branch after post-branch SQL failed")
+	}
+	return err
+}
+
+// runPostBranchSQL runs the config's post-branch SQL, then the template's and the create request's, in a new branch
+// Output (secrets redacted) is appended to the branch log, the first failing statement fails the branch creation
+func (s *Service) runPostBranchSQL(ctx context.Context, config *models.Config, restoreRecord *models.Restore, branch *models.Branch, params CreateBranchParams) error {
+	var templateSQL string
+	if params.branchTemplate != nil {
+		templateSQL = params.branchTemplate.PostBranchSQL
+	}
+	stages := []struct{ name, sql string }{
+		{"config", config.PostBranchSQL},
+		{"template", templateSQL},
+		{"request", params.PostBranchSQL},
+	}
+
+	databaseName := branchDatabaseName(config)
+	vars := restore.NewPostBranchSQLVars(branch, restoreRecord, databaseName, time.Now())
+	for _, stage := range stages {
+		if strings.TrimSpace(stage.sql) == "" {
+			continue
+		}
+
+		rendered, secrets, err := restore.RenderPostBranchSQL(stage.sql, vars)
+		if err != nil {
+			return fmt.Errorf("post-branch SQL (%s): %w", stage.name, err)
+		}
+
+		s.logger.Info().
+			Str("branch_name", branch.Name).
+			Str("stage", stage.name).
+			Msg("Executing post-branch SQL")
+
+		output, err := execPostBranchSQL(ctx, restoreRecord.ClusterPostgresVersion(config), branch.Port, databaseName, rendered)
+		output = restore.RedactSecrets(output, secrets)
+		s.appendBranchLog(branch.Name, fmt.Sprintf("post-branch SQL (%s)", stage.name), output, err)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("branch_name", branch.Name).
+				Str("stage", stage.name).
+				Str("output", output).
+				Msg("Failed to execute post-branch SQL")
+			return fmt.Errorf("post-branch SQL (%s) failed: %s", stage.name, postBranchSQLError(output, err))
+		}
+	}
+	return nil
+}
+
+// appendBranchLog appends a section to the branch log, failing to write it doesn't fail the branch
+func (s *Service) appendBranchLog(branchName, title, output string, runErr error) {
+	status := "succeeded"
+	if runErr != nil {
+		status = "failed: " + runErr.Error()
+	}
+	entry := fmt.Sprintf("=== %s %s %s ===\n%s", time.Now().UTC().Format(time.RFC3339), title, status, output)
+	if !strings.HasSuffix(entry, "\n") {
+		entry += "\n"
+	}
+
+	path := BranchLogPath(branchName)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err == nil {
+		_, err = file.WriteString(entry)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		s.logger.Warn().Err(err).Str("path", path).Msg("Failed to write branch log (non-fatal)")
+	}
+}
+
+// removeBranchLog removes the log of a deleted branch, a new branch of the same name starts a new log
+func (s *Service) removeBranchLog(branchName string) {
+	if err := os.Remove(BranchLogPath(branchName)); err != nil && !os.IsNotExist(err) {
+		s.logger.Warn().Err(err).Str("branch_name", branchName).Msg("Failed to remove branch log (non-fatal)")
+	}
+}
+
+// postBranchSQLError returns psql's error lines, the output can be long (e.g. a NOTICE per inserted row)
+func postBranchSQLError(output string, err error) string {
+	var errorLines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "ERROR:") || strings.Contains(line, "FATAL:") {
+			errorLines = append(errorLines, strings.TrimSpace(line))
+		}
+	}
+	if len(errorLines) == 0 {
+		return err.Error()
+	}
+	return strings.Join(errorLines, "; ")
+}
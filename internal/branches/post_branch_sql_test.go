@@ -0,0 +1,68 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+)
+
+func TestRunPostBranchSQL(t *testing.T) {
+	s, restoreRecord := newTestService(t)
+	branch := &models.Branch{Name: "feature-x", ShortID: "k7f3m2qa", RestoreID: restoreRecord.ID, Port: 6001}
+	createTestBranch(t, s, branch)
+	config := &models.Config{
+		DatabaseName:  "app",
+		PostBranchSQL: `INSERT INTO tenants (name) VALUES ({{literal .BranchName}});`,
+	}
+	t.Setenv(restore.SecretEnvPrefix+"API_KEY", "sk_live_123")
+
+	originalDir, originalExec := branchLogDir, execPostBranchSQL
+	t.Cleanup(func() { branchLogDir, execPostBranchSQL = originalDir, originalExec })
+	branchLogDir = t.TempDir()
+	var ran []string
+	execPostBranchSQL = func(ctx context.Context, postgresVersion string, port int, databaseName, sql string) (string, error) {
+		if port != 6001 || databaseName != "app" {
+			t.Errorf("ran on port %d, database %s, want the branch's 6001 and app", port, databaseName)
+		}
+		ran = append(ran, sql)
+		if strings.Contains(sql, "api_keys") {
+			return "UPDATE 1\nERROR:  relation \"api_keys\" does not exist\nLINE 1: UPDATE api_keys SET key = 'sk_live_123'\n", errors.New("exit status 3")
+		}
+		return "INSERT 0 1\n", nil
+	}
+
+	params := CreateBranchParams{
+		PostBranchSQL:  "TRUNCATE jobs;",
+		branchTemplate: &models.BranchTemplate{Name: "ci-small", PostBranchSQL: "DELETE FROM audit_log;"},
+	}
+	if err := s.runPostBranchSQL(context.Background(), config, restoreRecord, branch, params); err != nil {
+		t.Fatalf("runPostBranchSQL() error = %v", err)
+	}
+	if len(ran) != 3 || ran[0] != `INSERT INTO tenants (name) VALUES ('feature-x');` || ran[1] != "DELETE FROM audit_log;" || ran[2] != "TRUNCATE jobs;" {
+		t.Errorf("ran %q, want the rendered config SQL, then the template's and the request's", ran)
+	}
+
+	err := s.runPostBranchSQL(context.Background(), &models.Config{DatabaseName: "app"}, restoreRecord, branch, CreateBranchParams{PostBranchSQL: `UPDATE api_keys SET key = {{literal (secret "API_KEY")}};`})
+	if err == nil || !strings.Contains(err.Error(), `relation "api_keys" does not exist`) || strings.Contains(err.Error(), "sk_live_123") {
+		t.Errorf("runPostBranchSQL() error = %v, want the psql error with the secret redacted", err)
+	}
+
+	data, err := os.ReadFile(BranchLogPath("feature-x"))
+	if err != nil {
+		t.Fatalf("failed to read branch log: %v", err)
+	}
+	log := string(data)
+	for _, want := range []string{"post-branch SQL (config) succeeded", "post-branch SQL (template) succeeded", "post-branch SQL (request) succeeded", "post-branch SQL (request) failed: exit status 3", "SET key = '[REDACTED]'"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("branch log missing %q:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "sk_live_123") {
+		t.Errorf("branch log contains the secret:\n%s", log)
+	}
+}
@@ -0,0 +1,493 @@
+package branches
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Request codes of the first message of a PostgreSQL connection, in place of a protocol version
+const (
+	sslRequestCode    = 80877103
+	gssEncRequestCode = 80877104
+	cancelRequestCode = 80877102
+)
+
+// maxStartupMessageLength is PostgreSQL's own limit of startup messages
+const maxStartupMessageLength = 10000
+
+// maxProxiedMessageLength bounds the backend messages read before the connection is ready, all of them are small
+const maxProxiedMessageLength = 1 << 20
+
+// proxyStartupTimeout bounds SSL negotiation and routing, proxyBackendTimeout the startup of the branch connection
+// which includes resuming a suspended branch (see waker)
+const (
+	proxyStartupTimeout = 30 * time.Second
+	proxyBackendTimeout = 2*resumeReadyTimeout + 30*time.Second
+)
+
+// ErrNoBranchRoute is returned for connections that name no branch
+var ErrNoBranchRoute = errors.New("no branch matches the connection")
+
+// proxy routes PostgreSQL connections on one port to the branches
+// Clients pick the branch by the TLS server name (e.g. "k7f3m2qa.db.example.com"), their user or the database
+// (see routeBranch). The branches see connections from the proxy, so it applies their hba rules itself
+type proxy struct {
+	service *Service
+	tls     *tls.Config // Nil without certificate, clients asking for SSL are told it's unavailable
+
+	mu      sync.Mutex
+	cancels map[string]string // Backend key data -> branch address, cancel requests carry only the key
+}
+
+// StartProxy listens on cfg.Address and routes connections to the branches until ctx is done
+// Only one process may run the proxy (the API server), since it binds the port
+func (s *Service) StartProxy(ctx context.Context, cfg config.ProxyConfig) error {
+	p := &proxy{service: s, cancels: map[string]string{}}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load proxy certificate: %w", err)
+		}
+		p.tls = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	ln, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cfg.Address, err)
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	go p.accept(ln)
+
+	s.logger.Info().Str("address", cfg.Address).Bool("tls", p.tls != nil).Msg("Branch proxy started")
+	return nil
+}
+
+func (p *proxy) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(conn)
+	}
+}
+
+// handle negotiates SSL, routes the connection and relays it to the branch
+func (p *proxy) handle(conn net.Conn) {
+	defer conn.Close()
+	logger := p.service.logger.With().Str("client", conn.RemoteAddr().String()).Logger()
+
+	conn.SetDeadline(time.Now().Add(proxyStartupTimeout))
+	client, code, params, err := p.negotiate(conn)
+	if err != nil {
+		logger.Debug().Err(err).Msg("Proxy connection failed before startup")
+		return
+	}
+	if params == nil {
+		// Cancel request, forwarded by negotiate
+		return
+	}
+	defer client.Close()
+
+	serverName := ""
+	if tlsConn, ok := client.(*tls.Conn); ok {
+		serverName = tlsConn.ConnectionState().ServerName
+	}
+	branch, err := p.routeBranch(serverName, params)
+	if err != nil {
+		logger.Info().Err(err).Str("user", params["user"]).Str("database", params["database"]).Msg("Proxy connection not routed")
+		writeProxyError(client, "08004", err.Error())
+		return
+	}
+	logger = logger.With().Str("branch_name", branch.Name).Logger()
+
+	_, ssl := client.(*tls.Conn)
+	if err := proxyAllows(branch.HBARules, remoteAddr(conn), ssl); err != nil {
+		logger.Info().Err(err).Msg("Proxy connection rejected by branch hba rules")
+		writeProxyError(client, "28000", err.Error())
+		return
+	}
+	// The proxy's port isn't covered by the branch's firewall rules, its allowlist applies here instead
+	var cfg models.Config
+	if err := p.service.db.First(&cfg).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to load config")
+		writeProxyError(client, "08004", "failed to load config")
+		return
+	}
+	if err := firewallAllows(cfg.BranchAllowedCIDRs, branch, remoteAddr(conn)); err != nil {
+		logger.Info().Err(err).Msg("Proxy connection rejected by branch allowlist")
+		writeProxyError(client, "28000", err.Error())
+		return
+	}
+
+	backend, err := dialBranch(branch.Port)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to connect to branch")
+		writeProxyError(client, "08006", fmt.Sprintf("branch %s is not reachable", branch.Name))
+		return
+	}
+	defer backend.Close()
+
+	backend.SetDeadline(time.Now().Add(proxyBackendTimeout))
+	if _, err := backend.Write(encodeStartupMessage(code, params)); err != nil {
+		logger.Warn().Err(err).Msg("Failed to send startup message to branch")
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(backend, client)
+		done <- struct{}{}
+	}()
+	go func() {
+		key, err := relayStartup(client, backend)
+		if key != "" {
+			p.trackCancelKey(key, fmt.Sprintf("127.0.0.1:%d", branch.Port))
+			defer p.untrackCancelKey(key)
+		}
+		if err == nil {
+			backend.SetDeadline(time.Time{})
+			io.Copy(client, backend)
+		}
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// negotiate answers SSL and GSS encryption requests until the client sends its startup message
+// Returns the (TLS) connection, the protocol version and the startup parameters, which are nil for cancel requests
+func (p *proxy) negotiate(conn net.Conn) (net.Conn, uint32, map[string]string, error) {
+	client := conn
+	for attempt := 0; attempt < 3; attempt++ {
+		code, payload, err := readStartupMessage(client)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+
+		switch {
+		case code == sslRequestCode:
+			if _, ok := client.(*tls.Conn); ok || p.tls == nil {
+				if _, err := client.Write([]byte{'N'}); err != nil {
+					return nil, 0, nil, err
+				}
+				continue
+			}
+			if _, err := client.Write([]byte{'S'}); err != nil {
+				return nil, 0, nil, err
+			}
+			tlsConn := tls.Server(client, p.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return nil, 0, nil, fmt.Errorf("TLS handshake failed: %w", err)
+			}
+			client = tlsConn
+		case code == gssEncRequestCode:
+			if _, err := client.Write([]byte{'N'}); err != nil {
+				return nil, 0, nil, err
+			}
+		case code == cancelRequestCode:
+			p.forwardCancel(payload)
+			return client, code, nil, nil
+		case code>>16 == 3:
+			params, err := parseStartupParams(payload)
+			if err != nil {
+				return nil, 0, nil, err
+			}
+			return client, code, params, nil
+		default:
+			return nil, 0, nil, fmt.Errorf("unsupported protocol version %d.%d", code>>16, code&0xffff)
+		}
+	}
+	return nil, 0, nil, fmt.Errorf("no startup message after %d requests", 3)
+}
+
+// routeBranch finds the branch of a connection, in order by
+//   - the first label of the TLS server name, a branch short ID or name (e.g. "k7f3m2qa.db.example.com")
+//   - the user, every branch has its own
+//   - the database, a branch short ID or name, replaced by the branch's database in params
+func (p *proxy) routeBranch(serverName string, params map[string]string) (*models.Branch, error) {
+	var branch models.Branch
+
+	if label, _, _ := strings.Cut(serverName, "."); label != "" && net.ParseIP(serverName) == nil {
+		err := models.FindBranch(p.service.db, strings.ToLower(label), &branch)
+		if err == nil {
+			return &branch, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to load branch: %w", err)
+		}
+	}
+
+	if user := params["user"]; user != "" {
+		err := p.service.db.Where("\"user\" = ?", user).First(&branch).Error
+		if err == nil {
+			return &branch, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to load branch: %w", err)
+		}
+
+		var share models.BranchShare
+		err = p.service.db.Where("\"user\" = ? AND revoked_at IS NULL", user).First(&share).Error
+		if err == nil {
+			if err := p.service.db.Where("id = ?", share.BranchID).First(&branch).Error; err != nil {
+				return nil, fmt.Errorf("failed to load branch: %w", err)
+			}
+			return &branch, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to load branch share: %w", err)
+		}
+	}
+
+	if database := params["database"]; database != "" {
+		err := models.FindBranch(p.service.db, database, &branch)
+		if err == nil {
+			var cfg models.Config
+			if err := p.service.db.First(&cfg).Error; err != nil {
+				return nil, fmt.Errorf("failed to load config: %w", err)
+			}
+			params["database"] = branchDatabaseName(&cfg)
+			return &branch, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to load branch: %w", err)
+		}
+	}
+
+	return nil, ErrNoBranchRoute
+}
+
+// proxyAllows applies a branch's hba rules to the client, like PostgreSQL would if the client connected directly
+// Client certificates end at the proxy, so cert rules can only be used on the branch's own port
+func proxyAllows(rules []models.BranchHBARule, addr netip.Addr, ssl bool) error {
+	if len(rules) == 0 {
+		rules = defaultHBARules
+	}
+	for _, rule := range rules {
+		prefix, err := netip.ParsePrefix(rule.CIDR)
+		if err != nil || !prefix.Contains(addr) {
+			continue
+		}
+		if ((rule.SSL == "" || rule.SSL == HBASSLRequire) && !ssl) || (rule.SSL == HBASSLDisable && ssl) {
+			continue
+		}
+
+		switch rule.Method {
+		case "reject":
+			return fmt.Errorf("connections from %s are rejected by the branch's hba rules", addr)
+		case "cert":
+			return fmt.Errorf("cert authentication isn't supported through the proxy, connect to the branch's port")
+		}
+		return nil
+	}
+
+	encryption := "SSL off"
+	if ssl {
+		encryption = "SSL on"
+	}
+	return fmt.Errorf("no hba rule of the branch allows connections from %s, %s", addr, encryption)
+}
+
+// remoteAddr returns the client's IP address, IPv4 clients of dual-stack listeners as IPv4
+func remoteAddr(conn net.Conn) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
+
+// dialBranch connects to a branch's cluster, over SSL if it supports it
+// A suspended branch's port is held by the waker, which resumes the branch before answering
+func dialBranch(port int) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(proxyBackendTimeout))
+
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], sslRequestCode)
+	response := make([]byte, 1)
+	if _, err := conn.Write(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if response[0] != 'S' {
+		return conn, nil
+	}
+
+	// Loopback to a cluster using the proxy's certificate, there is nothing to verify
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with branch failed: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// relayStartup relays the branch's messages to the client until the connection is ready for queries
+// Returns the backend key data, which cancel requests for the connection carry
+func relayStartup(client io.Writer, backend io.Reader) (string, error) {
+	key := ""
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(backend, header); err != nil {
+			return key, err
+		}
+		length := binary.BigEndian.Uint32(header[1:5])
+		if length < 4 || length > maxProxiedMessageLength {
+			return key, fmt.Errorf("invalid message length %d", length)
+		}
+		body := make([]byte, length-4)
+		if _, err := io.ReadFull(backend, body); err != nil {
+			return key, err
+		}
+		if _, err := client.Write(append(header, body...)); err != nil {
+			return key, err
+		}
+
+		switch header[0] {
+		case 'K': // BackendKeyData
+			key = string(body)
+		case 'Z': // ReadyForQuery
+			return key, nil
+		case 'E': // ErrorResponse, the branch closes the connection
+			return key, io.EOF
+		}
+	}
+}
+
+func (p *proxy) trackCancelKey(key, addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cancels[key] = addr
+}
+
+func (p *proxy) untrackCancelKey(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.cancels, key)
+}
+
+// forwardCancel sends a cancel request to the branch running the connection with its key data
+// PostgreSQL handles cancel requests before authentication, so they're sent without SSL
+func (p *proxy) forwardCancel(key []byte) {
+	p.mu.Lock()
+	addr, ok := p.cancels[string(key)]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		p.service.logger.Warn().Err(err).Str("address", addr).Msg("Failed to forward cancel request")
+		return
+	}
+	defer conn.Close()
+
+	request := make([]byte, 8, 8+len(key))
+	binary.BigEndian.PutUint32(request[0:4], uint32(8+len(key)))
+	binary.BigEndian.PutUint32(request[4:8], cancelRequestCode)
+	conn.Write(append(request, key...))
+}
+
+// readStartupMessage reads a message without type byte (startup, SSL, GSS or cancel request)
+// Returns the protocol version or request code and the rest of the message
+func readStartupMessage(r io.Reader) (uint32, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < 8 || length > maxStartupMessageLength {
+		return 0, nil, fmt.Errorf("invalid startup message length %d", length)
+	}
+	payload := make([]byte, length-8)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return binary.BigEndian.Uint32(header[4:8]), payload, nil
+}
+
+// parseStartupParams parses the null-terminated names and values of a startup message
+func parseStartupParams(payload []byte) (map[string]string, error) {
+	params := map[string]string{}
+	fields := bytes.Split(payload, []byte{0})
+	for i := 0; i < len(fields) && len(fields[i]) > 0; i += 2 {
+		if i+1 >= len(fields) {
+			return nil, fmt.Errorf("malformed startup message")
+		}
+		params[string(fields[i])] = string(fields[i+1])
+	}
+	if params["user"] == "" {
+		return nil, fmt.Errorf("startup message without user")
+	}
+	return params, nil
+}
+
+// encodeStartupMessage renders a startup message of the protocol version with the parameters
+func encodeStartupMessage(version uint32, params map[string]string) []byte {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint32(message[4:8], version)
+	for _, name := range names {
+		message = append(message, name...)
+		message = append(message, 0)
+		message = append(message, params[name]...)
+		message = append(message, 0)
+	}
+	message = append(message, 0)
+	binary.BigEndian.PutUint32(message[0:4], uint32(len(message)))
+	return message
+}
+
+// writeProxyError sends a fatal ErrorResponse with the SQLSTATE code, the client shows the message
+func writeProxyError(w io.Writer, code, text string) {
+	var body []byte
+	for _, field := range []struct {
+		kind  byte
+		value string
+	}{{'S', "FATAL"}, {'V', "FATAL"}, {'C', code}, {'M', "branchd proxy: " + text}} {
+		body = append(body, field.kind)
+		body = append(body, field.value...)
+		body = append(body, 0)
+	}
+	body = append(body, 0)
+
+	message := make([]byte, 5, 5+len(body))
+	message[0] = 'E'
+	binary.BigEndian.PutUint32(message[1:5], uint32(4+len(body)))
+	w.Write(append(message, body...))
+}
@@ -0,0 +1,227 @@
+package branches
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestProxyAllows(t *testing.T) {
+	office := []models.BranchHBARule{
+		{CIDR: "10.0.0.5/32", Method: "reject"},
+		{CIDR: "10.0.0.0/8", SSL: HBASSLOptional},
+		{CIDR: "192.168.0.0/16", Method: "cert"},
+	}
+	tests := []struct {
+		name    string
+		rules   []models.BranchHBARule
+		addr    string
+		ssl     bool
+		wantErr string
+	}{
+		{"defaults over ssl", nil, "203.0.113.7", true, ""},
+		{"defaults without ssl", nil, "203.0.113.7", false, "no hba rule"},
+		{"defaults ipv6", nil, "2001:db8::1", true, ""},
+		{"optional ssl", office, "10.1.2.3", false, ""},
+		{"rejected before allowed", office, "10.0.0.5", true, "rejected"},
+		{"outside the networks", office, "172.16.0.1", true, "no hba rule"},
+		{"cert", office, "192.168.1.1", true, "cert authentication"},
+		{"ssl disabled", []models.BranchHBARule{{CIDR: "10.0.0.0/8", SSL: HBASSLDisable}}, "10.1.2.3", true, "no hba rule"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := proxyAllows(tt.rules, netip.MustParseAddr(tt.addr), tt.ssl)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("proxyAllows() error = %v, want allowed", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("proxyAllows() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStartupMessageRoundTrip(t *testing.T) {
+	message := encodeStartupMessage(196608, map[string]string{"user": "u1", "database": "app", "application_name": "psql"})
+
+	code, payload, err := readStartupMessage(bytes.NewReader(message))
+	if err != nil {
+		t.Fatalf("readStartupMessage() error = %v", err)
+	}
+	params, err := parseStartupParams(payload)
+	if err != nil {
+		t.Fatalf("parseStartupParams() error = %v", err)
+	}
+	if code != 196608 || len(params) != 3 || params["user"] != "u1" || params["database"] != "app" {
+		t.Errorf("startup message = %d %v, want protocol 3.0 with the parameters", code, params)
+	}
+
+	if _, err := parseStartupParams([]byte("database\x00app\x00\x00")); err == nil {
+		t.Error("parseStartupParams() accepted a startup message without user")
+	}
+}
+
+// fakeBranchCluster accepts PostgreSQL connections without SSL, completes their startup and records it
+type fakeBranchCluster struct {
+	port     int
+	startups chan map[string]string // Parameters of every startup message
+	cancels  chan []byte            // Key data of every cancel request
+}
+
+func startFakeBranchCluster(t *testing.T) *fakeBranchCluster {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	cluster := &fakeBranchCluster{
+		port:     ln.Addr().(*net.TCPAddr).Port,
+		startups: make(chan map[string]string, 10),
+		cancels:  make(chan []byte, 10),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go cluster.serve(conn)
+		}
+	}()
+	return cluster
+}
+
+func (f *fakeBranchCluster) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		code, payload, err := readStartupMessage(conn)
+		if err != nil {
+			return
+		}
+		switch code {
+		case sslRequestCode:
+			conn.Write([]byte{'N'})
+		case cancelRequestCode:
+			f.cancels <- payload
+			return
+		default:
+			params, _ := parseStartupParams(payload)
+			f.startups <- params
+			conn.Write(backendMessage('R', []byte{0, 0, 0, 0}))              // AuthenticationOk
+			conn.Write(backendMessage('K', []byte{0, 0, 0, 42, 1, 2, 3, 4})) // BackendKeyData
+			conn.Write(backendMessage('Z', []byte{'I'}))                     // ReadyForQuery
+			io.Copy(conn, conn)                                              // Echo once ready
+			return
+		}
+	}
+}
+
+func backendMessage(kind byte, body []byte) []byte {
+	message := []byte{kind, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(message[1:5], uint32(4+len(body)))
+	return append(message, body...)
+}
+
+// connectThroughProxy sends a startup message to the proxy and returns the connection and the first message type
+func connectThroughProxy(t *testing.T, addr string, params map[string]string) (net.Conn, byte) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect to proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write(encodeStartupMessage(196608, params)); err != nil {
+		t.Fatalf("failed to send startup message: %v", err)
+	}
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("failed to read from proxy: %v", err)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header[1:5])-4)
+	io.ReadFull(conn, body)
+	return conn, header[0]
+}
+
+func TestProxyRoutesToBranch(t *testing.T) {
+	s, restore := newTestService(t)
+	cluster := startFakeBranchCluster(t)
+
+	branch := &models.Branch{Name: "feature-x", ShortID: "k3m9x2ab", RestoreID: restore.ID, User: "u1", Port: cluster.port,
+		HBARules: []models.BranchHBARule{{CIDR: "127.0.0.0/8", SSL: HBASSLOptional}}}
+	createTestBranch(t, s, branch)
+	locked := &models.Branch{Name: "locked", RestoreID: restore.ID, User: "u2", Port: cluster.port,
+		HBARules: []models.BranchHBARule{{CIDR: "10.0.0.0/8"}}}
+	createTestBranch(t, s, locked)
+
+	p := &proxy{service: s, cancels: map[string]string{}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go p.accept(ln)
+	addr := ln.Addr().String()
+
+	// By user
+	conn, kind := connectThroughProxy(t, addr, map[string]string{"user": "u1", "database": "app"})
+	if kind != 'R' {
+		t.Fatalf("first message = %q, want AuthenticationOk from the branch", kind)
+	}
+	if got := <-cluster.startups; got["user"] != "u1" || got["database"] != "app" {
+		t.Errorf("branch startup = %v, want the client's", got)
+	}
+
+	// Relayed once ready, cancel requests reach the branch by their key data
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.mu.Lock()
+		tracked := len(p.cancels)
+		p.mu.Unlock()
+		if tracked == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.forwardCancel([]byte{0, 0, 0, 42, 1, 2, 3, 4})
+	select {
+	case key := <-cluster.cancels:
+		if !bytes.Equal(key, []byte{0, 0, 0, 42, 1, 2, 3, 4}) {
+			t.Errorf("cancel key = %v, want the connection's", key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("cancel request not forwarded to the branch")
+	}
+	conn.Close()
+
+	// By database, replaced by the branch's database
+	_, kind = connectThroughProxy(t, addr, map[string]string{"user": "someone", "database": "k3m9x2ab"})
+	if kind != 'R' {
+		t.Fatalf("first message = %q, want AuthenticationOk from the branch", kind)
+	}
+	if got := <-cluster.startups; got["database"] != "postgres" {
+		t.Errorf("branch startup database = %q, want the branches' database", got["database"])
+	}
+
+	// Unknown branch and rules not matching the client
+	for _, params := range []map[string]string{{"user": "nobody", "database": "app"}, {"user": "u2", "database": "app"}} {
+		if _, kind := connectThroughProxy(t, addr, params); kind != 'E' {
+			t.Errorf("first message for %v = %q, want an ErrorResponse", params, kind)
+		}
+	}
+	select {
+	case got := <-cluster.startups:
+		t.Errorf("branch startup = %v, want refused connections kept from the branch", got)
+	default:
+	}
+}
@@ -0,0 +1,153 @@
+package branches
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Delay after the first failed restart of a crashed branch, doubled on every further failure
+const (
+	recoveryBackoffBase = time.Minute
+	recoveryBackoffMax  = time.Hour
+)
+
+// Recovery commands, replaced in tests
+var (
+	// mountDataset mounts a ZFS dataset, failing when it's already mounted
+	mountDataset = func(ctx context.Context, dataset string) error {
+		return exec.CommandContext(ctx, "sudo", "zfs", "mount", dataset).Run()
+	}
+
+	// restartUnit restarts a systemd unit, returning its output
+	restartUnit = func(ctx context.Context, unit string) ([]byte, error) {
+		// A unit that hit its start limit refuses to start until its failed state is reset
+		_ = exec.CommandContext(ctx, "sudo", "systemctl", "reset-failed", unit).Run()
+		return exec.CommandContext(ctx, "sudo", "systemctl", "restart", unit).CombinedOutput()
+	}
+)
+
+// recoveryBackoff returns the delay before the next restart after the given number of failed attempts
+func recoveryBackoff(attempts int) time.Duration {
+	if attempts <= 0 {
+		return 0
+	}
+	backoff := recoveryBackoffBase
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= recoveryBackoffMax {
+			return recoveryBackoffMax
+		}
+	}
+	return backoff
+}
+
+// recoverBranch restarts a crashed branch unless its backoff hasn't elapsed yet
+// Every attempt is recorded in the audit log, returns the branch's status afterwards
+func (s *Service) recoverBranch(ctx context.Context, branch *models.Branch, now time.Time) (string, map[string]interface{}) {
+	if branch.NextRecoveryAt != nil && now.Before(*branch.NextRecoveryAt) {
+		return BranchStatusCrashed, nil
+	}
+
+	attempt := branch.RecoveryAttempts + 1
+	s.logger.Warn().
+		Str("branch_name", branch.Name).
+		Int("port", branch.Port).
+		Int("attempt", attempt).
+		Msg("Restarting crashed branch")
+
+	err := s.restartBranch(ctx, branch)
+	s.recordRecoveryEvent(branch, attempt, err)
+
+	if err != nil {
+		next := now.Add(recoveryBackoff(attempt))
+		s.logger.Error().
+			Err(err).
+			Str("branch_name", branch.Name).
+			Int("attempt", attempt).
+			Time("next_attempt_at", next).
+			Msg("Failed to restart crashed branch")
+		return BranchStatusCrashed, map[string]interface{}{
+			"recovery_attempts": attempt,
+			"next_recovery_at":  next,
+		}
+	}
+
+	s.logger.Info().
+		Str("branch_name", branch.Name).
+		Int("attempt", attempt).
+		Msg("Crashed branch restarted")
+	return BranchStatusRunning, map[string]interface{}{
+		"recovery_attempts": 0,
+		"next_recovery_at":  nil,
+	}
+}
+
+// restartBranch mounts a branch's datasets (unmounted after an unclean reboot) and restarts its unit
+func (s *Service) restartBranch(ctx context.Context, branch *models.Branch) error {
+	s.suspendMu.Lock()
+	defer s.suspendMu.Unlock()
+
+	// A branch suspended since the health check is stopped on purpose
+	var current models.Branch
+	if err := s.db.Select("suspended_at").Where("id = ?", branch.ID).First(&current).Error; err != nil {
+		return fmt.Errorf("failed to load branch: %w", err)
+	}
+	if current.SuspendedAt != nil {
+		return fmt.Errorf("branch was suspended")
+	}
+
+	datasets := []string{s.config.Storage.DatasetName(branch.Name)}
+	if wal := s.config.Storage.WALDatasetName(branch.Name); wal != "" {
+		datasets = append(datasets, wal)
+	}
+	for _, dataset := range datasets {
+		// Fails when already mounted, the unit's own zfs mount reports real errors
+		_ = mountDataset(ctx, dataset)
+	}
+
+	if output, err := restartUnit(ctx, serviceName(branch.Name)); err != nil {
+		return fmt.Errorf("failed to restart branch: %s", strings.TrimSpace(string(output)))
+	}
+
+	deadline := time.Now().Add(resumeReadyTimeout)
+	for {
+		if clusterReady(ctx, branch.Port) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("branch not ready within %s", resumeReadyTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// recordRecoveryEvent adds a restart attempt to the audit log, failures to record it are only logged
+func (s *Service) recordRecoveryEvent(branch *models.Branch, attempt int, restartErr error) {
+	event := models.AuditEvent{
+		Action:       "branch.recovered",
+		ResourceType: "branch",
+		ResourceID:   branch.ID,
+		Success:      restartErr == nil,
+		Details: map[string]string{
+			"name":    branch.Name,
+			"attempt": strconv.Itoa(attempt),
+		},
+	}
+	if restartErr != nil {
+		event.Action = "branch.recovery_failed"
+		event.Details["error"] = restartErr.Error()
+	}
+	if err := s.db.Create(&event).Error; err != nil {
+		s.logger.Warn().Err(err).Str("branch_name", branch.Name).Msg("Failed to record branch recovery audit event")
+	}
+}
@@ -0,0 +1,178 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestRecoveryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{50, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := recoveryBackoff(tt.attempts); got != tt.want {
+			t.Errorf("recoveryBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// fakeRecovery records the datasets mounted and units restarted by recoverBranch
+type fakeRecovery struct {
+	mounted   []string
+	restarted []string
+	fail      bool // Restarting fails
+}
+
+// stubRecoveryCommands replaces the recovery commands with a fake for the test's duration
+// Restarted clusters are ready right away
+func stubRecoveryCommands(t *testing.T) *fakeRecovery {
+	t.Helper()
+	fake := &fakeRecovery{}
+
+	origMount, origRestart, origReady := mountDataset, restartUnit, clusterReady
+	t.Cleanup(func() { mountDataset, restartUnit, clusterReady = origMount, origRestart, origReady })
+
+	mountDataset = func(ctx context.Context, dataset string) error {
+		fake.mounted = append(fake.mounted, dataset)
+		return errors.New("filesystem already mounted")
+	}
+	restartUnit = func(ctx context.Context, unit string) ([]byte, error) {
+		fake.restarted = append(fake.restarted, unit)
+		if fake.fail {
+			return []byte("Job for " + unit + " failed because the control process exited with error code.\n"), errors.New("exit status 1")
+		}
+		return nil, nil
+	}
+	clusterReady = func(ctx context.Context, port int) bool { return true }
+	return fake
+}
+
+// recoveryEvents returns the recovery audit events of a branch
+func recoveryEvents(t *testing.T, s *Service, branchID string) []models.AuditEvent {
+	t.Helper()
+	var events []models.AuditEvent
+	if err := s.db.Where("resource_type = ? AND resource_id = ?", "branch", branchID).Order("created_at").Find(&events).Error; err != nil {
+		t.Fatalf("failed to load audit events: %v", err)
+	}
+	return events
+}
+
+func TestCheckBranchHealthRestartsCrashedBranch(t *testing.T) {
+	s, restore := newTestService(t)
+	s.config.Storage = config.StorageConfig{DatasetRoot: "tank", WALDatasetRoot: "nvme/wal"}
+	probes := stubHealthProbes(t)
+	recovery := stubRecoveryCommands(t)
+
+	earlier := time.Now().Add(-time.Minute)
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001, Status: BranchStatusCrashed, RecoveryAttempts: 2, NextRecoveryAt: &earlier}
+	createTestBranch(t, s, branch)
+	probes.exitCodes[6001] = 2
+	probes.states[serviceName("feature-x")] = "failed"
+
+	if err := s.CheckBranchHealth(context.Background()); err != nil {
+		t.Fatalf("CheckBranchHealth() error = %v", err)
+	}
+
+	// Datasets are mounted first, e.g. after an unclean reboot
+	if want := []string{"tank/feature-x", "nvme/wal/feature-x"}; !reflect.DeepEqual(recovery.mounted, want) {
+		t.Errorf("mounted %v, want %v", recovery.mounted, want)
+	}
+	if want := []string{serviceName("feature-x")}; !reflect.DeepEqual(recovery.restarted, want) {
+		t.Errorf("restarted %v, want %v", recovery.restarted, want)
+	}
+
+	got := loadBranch(t, s, branch.ID)
+	if got.Status != BranchStatusRunning || got.RecoveryAttempts != 0 || got.NextRecoveryAt != nil {
+		t.Errorf("restarted branch = %q, %d attempts, next at %v; want running with backoff reset", got.Status, got.RecoveryAttempts, got.NextRecoveryAt)
+	}
+
+	events := recoveryEvents(t, s, branch.ID)
+	if len(events) != 1 {
+		t.Fatalf("recorded %d audit events, want 1", len(events))
+	}
+	want := map[string]string{"name": "feature-x", "attempt": "3"}
+	if events[0].Action != "branch.recovered" || !events[0].Success || !reflect.DeepEqual(events[0].Details, want) {
+		t.Errorf("audit event = %s (success %v) %v, want branch.recovered %v", events[0].Action, events[0].Success, events[0].Details, want)
+	}
+}
+
+func TestCheckBranchHealthBacksOffFailedRestarts(t *testing.T) {
+	s, restore := newTestService(t)
+	probes := stubHealthProbes(t)
+	recovery := stubRecoveryCommands(t)
+	recovery.fail = true
+
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001, Status: BranchStatusRunning}
+	createTestBranch(t, s, branch)
+	probes.exitCodes[6001] = 2
+	probes.states[serviceName("feature-x")] = "failed"
+
+	before := time.Now()
+	if err := s.CheckBranchHealth(context.Background()); err != nil {
+		t.Fatalf("CheckBranchHealth() error = %v", err)
+	}
+
+	got := loadBranch(t, s, branch.ID)
+	if got.Status != BranchStatusCrashed || got.RecoveryAttempts != 1 {
+		t.Errorf("branch = %q after %d attempts, want crashed after 1", got.Status, got.RecoveryAttempts)
+	}
+	if got.NextRecoveryAt == nil || got.NextRecoveryAt.Before(before.Add(recoveryBackoffBase)) || got.NextRecoveryAt.After(time.Now().Add(recoveryBackoffBase)) {
+		t.Errorf("next_recovery_at = %v, want in %s", got.NextRecoveryAt, recoveryBackoffBase)
+	}
+
+	events := recoveryEvents(t, s, branch.ID)
+	if len(events) != 1 {
+		t.Fatalf("recorded %d audit events, want 1", len(events))
+	}
+	if events[0].Action != "branch.recovery_failed" || events[0].Success || events[0].Details["attempt"] != "1" || events[0].Details["error"] == "" {
+		t.Errorf("audit event = %s (success %v) %v, want branch.recovery_failed with the error", events[0].Action, events[0].Success, events[0].Details)
+	}
+
+	// Within the backoff the branch is not restarted again
+	if err := s.CheckBranchHealth(context.Background()); err != nil {
+		t.Fatalf("CheckBranchHealth() error = %v", err)
+	}
+	if len(recovery.restarted) != 1 || len(recoveryEvents(t, s, branch.ID)) != 1 {
+		t.Errorf("restarted %d times with %d audit events within the backoff, want 1", len(recovery.restarted), len(recoveryEvents(t, s, branch.ID)))
+	}
+	if got := loadBranch(t, s, branch.ID); got.RecoveryAttempts != 1 || got.Status != BranchStatusCrashed {
+		t.Errorf("branch = %q after %d attempts, want crashed after 1", got.Status, got.RecoveryAttempts)
+	}
+}
+
+func TestRecoverBranchSuspendedMeanwhile(t *testing.T) {
+	s, restore := newTestService(t)
+	recovery := stubRecoveryCommands(t)
+
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001}
+	createTestBranch(t, s, branch)
+	// Suspended after the health check found it crashed
+	if err := s.db.Model(branch).Update("suspended_at", time.Now()).Error; err != nil {
+		t.Fatalf("failed to suspend branch: %v", err)
+	}
+
+	status, _ := s.recoverBranch(context.Background(), branch, time.Now())
+
+	if status != BranchStatusCrashed || len(recovery.restarted) != 0 {
+		t.Errorf("recoverBranch() = %q after %d restarts, want crashed without restart", status, len(recovery.restarted))
+	}
+	if events := recoveryEvents(t, s, branch.ID); len(events) != 1 || events[0].Details["error"] != "branch was suspended" {
+		t.Errorf("audit events = %+v, want one failed recovery of the suspended branch", events)
+	}
+}
@@ -0,0 +1,127 @@
+package branches
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// scheduleParser parses standard 5-field cron expressions (minute hour day-of-month month day-of-week)
+var scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// NextScheduleRun returns the first run of a cron expression after from
+func NextScheduleRun(expr string, from time.Time) (time.Time, error) {
+	schedule, err := scheduleParser.Parse(expr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid schedule %q: %w", expr, err)
+	}
+	return schedule.Next(from), nil
+}
+
+// RunBranchSchedule recreates the schedule's branch and records the outcome on the schedule
+func (s *Service) RunBranchSchedule(ctx context.Context, schedule *models.BranchSchedule) (*models.Branch, error) {
+	branch, err := s.recreateScheduledBranch(ctx, schedule)
+
+	now := time.Now()
+	schedule.LastRunAt = &now
+	schedule.LastError = ""
+	if branch != nil {
+		schedule.LastRestoreID = branch.RestoreID
+	}
+	if err != nil {
+		schedule.LastError = err.Error()
+		s.logger.Error().
+			Err(err).
+			Str("schedule_id", schedule.ID).
+			Str("branch_name", schedule.BranchName).
+			Msg("Scheduled branch creation failed")
+	} else {
+		s.logger.Info().
+			Str("schedule_id", schedule.ID).
+			Str("branch_id", branch.ID).
+			Str("branch_name", branch.Name).
+			Msg("Scheduled branch created")
+	}
+
+	if updateErr := s.db.Model(schedule).Updates(map[string]interface{}{
+		"last_run_at":     now,
+		"last_error":      schedule.LastError,
+		"last_restore_id": schedule.LastRestoreID,
+	}).Error; updateErr != nil {
+		s.logger.Error().Err(updateErr).Str("schedule_id", schedule.ID).Msg("Failed to record branch schedule run")
+	}
+
+	return branch, err
+}
+
+// LatestReadyRestore returns the restore branches are created from by default
+func (s *Service) LatestReadyRestore() (*models.Restore, error) {
+	return s.findSourceRestore("")
+}
+
+// ValidateScheduleSource checks that a schedule's source restore can be branched from
+func (s *Service) ValidateScheduleSource(schedule *models.BranchSchedule) error {
+	if schedule.RestoreID == "" {
+		return nil
+	}
+	if schedule.OnNewRestore {
+		return fmt.Errorf("on_new_restore requires the latest restore as source, not a fixed restore")
+	}
+	_, err := s.findSourceRestore(schedule.RestoreID)
+	return err
+}
+
+// recreateScheduledBranch creates the schedule's branch from its source restore
+// An existing branch is deleted first and its port and credentials are reused
+func (s *Service) recreateScheduledBranch(ctx context.Context, schedule *models.BranchSchedule) (*models.Branch, error) {
+	// Don't delete the previous branch when there's nothing to recreate it from
+	if _, err := s.findSourceRestore(schedule.RestoreID); err != nil {
+		return nil, err
+	}
+
+	var previous models.Branch
+	err := s.db.Where("name = ?", schedule.BranchName).First(&previous).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to load branch: %w", err)
+	}
+
+	params := CreateBranchParams{
+		BranchName:     schedule.BranchName,
+		CreatedByID:    schedule.CreatedByID,
+		ResourceLimits: schedule.ResourceLimits,
+		RestoreID:      schedule.RestoreID,
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		s.logger.Info().
+			Str("schedule_id", schedule.ID).
+			Str("branch_name", schedule.BranchName).
+			Msg("Creating scheduled branch")
+		return s.CreateBranch(ctx, params)
+	}
+
+	s.logger.Info().
+		Str("schedule_id", schedule.ID).
+		Str("branch_name", schedule.BranchName).
+		Str("previous_branch_id", previous.ID).
+		Msg("Recreating scheduled branch")
+
+	// The recreated branch keeps the rules set on the previous one
+	params.HBARules = previous.HBARules
+	params.AllowedCIDRs = previous.AllowedCIDRs
+
+	if err := s.DeleteBranch(ctx, DeleteBranchParams{BranchName: previous.Name}); err != nil {
+		return nil, fmt.Errorf("failed to delete previous branch: %w", err)
+	}
+
+	return s.CreateBranchWithForcedMetadata(ctx, params, ForcedBranchMetadata{
+		Port:     previous.Port,
+		User:     previous.User,
+		Password: previous.Password,
+	})
+}
@@ -0,0 +1,127 @@
+package branches
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestNextScheduleRun(t *testing.T) {
+	from := time.Date(2025, 3, 10, 7, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr    string
+		want    time.Time
+		wantErr bool
+	}{
+		{"0 6 * * *", time.Date(2025, 3, 11, 6, 0, 0, 0, time.UTC), false},
+		{"45 7 * * *", time.Date(2025, 3, 10, 7, 45, 0, 0, time.UTC), false},
+		{"0 6 * * 1-5", time.Date(2025, 3, 11, 6, 0, 0, 0, time.UTC), false},
+		{"0 6 * *", time.Time{}, true},
+		{"@every 1h", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := NextScheduleRun(tt.expr, from)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NextScheduleRun(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextScheduleRun(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestReadyRestore(t *testing.T) {
+	s, latest := newTestService(t)
+
+	// Newer restores that aren't ready, are clones, promoted or refreshing are never the default source
+	newer := time.Now().Add(time.Hour)
+	for _, restore := range []*models.Restore{
+		{Name: "restore_queued", SchemaReady: true},
+		{Name: "restore_clone", SchemaReady: true, ReadyAt: &newer, ClonedFromID: latest.ID},
+		{Name: "restore_promoted", SchemaReady: true, ReadyAt: &newer, PromotedFromBranch: "feature-x"},
+		{Name: "restore_refreshing", SchemaReady: true, ReadyAt: &newer, RefreshingSince: &newer},
+	} {
+		if err := s.db.Create(restore).Error; err != nil {
+			t.Fatalf("failed to create restore: %v", err)
+		}
+	}
+
+	got, err := s.LatestReadyRestore()
+	if err != nil || got.ID != latest.ID {
+		t.Errorf("LatestReadyRestore() = %v, %v, want %s", got, err, latest.Name)
+	}
+}
+
+func TestValidateScheduleSource(t *testing.T) {
+	s, latest := newTestService(t)
+	readyAt := time.Now()
+	promoted := &models.Restore{Name: "restore_promoted", SchemaReady: true, ReadyAt: &readyAt, PromotedFromBranch: "feature-x"}
+	clone := &models.Restore{Name: "restore_clone", SchemaReady: true, ReadyAt: &readyAt, ClonedFromID: latest.ID}
+	for _, restore := range []*models.Restore{promoted, clone} {
+		if err := s.db.Create(restore).Error; err != nil {
+			t.Fatalf("failed to create restore: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		schedule models.BranchSchedule
+		wantErr  string
+	}{
+		{name: "latest restore", schedule: models.BranchSchedule{OnNewRestore: true}},
+		{name: "pinned promoted restore", schedule: models.BranchSchedule{RestoreID: promoted.ID}},
+		{name: "pinned restore with on_new_restore", schedule: models.BranchSchedule{RestoreID: promoted.ID, OnNewRestore: true}, wantErr: "on_new_restore requires the latest restore"},
+		{name: "unknown restore", schedule: models.BranchSchedule{RestoreID: "missing"}, wantErr: "restore not found"},
+		{name: "clone", schedule: models.BranchSchedule{RestoreID: clone.ID}, wantErr: "is a clone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ValidateScheduleSource(&tt.schedule)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateScheduleSource() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateScheduleSource() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunBranchScheduleKeepsBranchWithoutSource(t *testing.T) {
+	s, restore := newTestService(t)
+	existing := &models.Branch{Name: "nightly-qa", RestoreID: restore.ID, Port: 6001}
+	createTestBranch(t, s, existing)
+
+	// The pinned restore was deleted since, the current branch stays
+	schedule := &models.BranchSchedule{BranchName: "nightly-qa", CreatedByID: "user-1", Enabled: true, RestoreID: "deleted", LastRestoreID: restore.ID}
+	if err := s.db.Create(schedule).Error; err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+
+	if _, err := s.RunBranchSchedule(context.Background(), schedule); err == nil {
+		t.Fatal("RunBranchSchedule() succeeded without a source restore")
+	}
+
+	var got models.BranchSchedule
+	s.db.First(&got, "id = ?", schedule.ID)
+	if got.LastRunAt == nil || !strings.Contains(got.LastError, "restore not found") {
+		t.Errorf("recorded run = last_run_at %v, last_error %q", got.LastRunAt, got.LastError)
+	}
+	if got.LastRestoreID != restore.ID {
+		t.Errorf("last_restore_id = %q, want %q (the branch wasn't recreated)", got.LastRestoreID, restore.ID)
+	}
+	if err := s.db.First(&models.Branch{}, "id = ?", existing.ID).Error; err != nil {
+		t.Errorf("existing branch deleted: %v", err)
+	}
+}
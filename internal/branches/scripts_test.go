@@ -0,0 +1,46 @@
+package branches
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+// scriptInputPattern matches the parameters a script reads from its environment, e.g. USER="${BRANCH_USER}"
+var scriptInputPattern = regexp.MustCompile(`(?m)^([A-Z_]+)="\$\{([A-Z_]+)\}"`)
+
+func TestScriptParamsCoverScriptInputs(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		params any
+	}{
+		{"create-branch.sh", createBranchScript, branchScriptParams{}},
+		{"destroy-branch.sh", destroyBranchScript, deleteBranchScriptParams{}},
+		{"migration-copy.sh", migrationCopyScript, migrationCopyParams{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.Contains(tt.script, "{{") {
+				t.Error("script still contains template actions")
+			}
+
+			env := make(map[string]bool)
+			for _, variable := range shellexec.Env(tt.params) {
+				name, _, _ := strings.Cut(variable, "=")
+				env[name] = true
+			}
+			inputs := scriptInputPattern.FindAllStringSubmatch(tt.script, -1)
+			if len(inputs) == 0 {
+				t.Fatal("script reads no parameters")
+			}
+			for _, input := range inputs {
+				if !env[input[2]] {
+					t.Errorf("script reads %s, the parameters don't set it", input[2])
+				}
+			}
+		})
+	}
+}
@@ -1,17 +1,17 @@
 package branches
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
 	_ "embed"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
-	"text/template"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
@@ -19,6 +19,9 @@ import (
 	"github.com/branchd-dev/branchd/internal/assert"
 	"github.com/branchd-dev/branchd/internal/config"
 	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/shellexec"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
+	"github.com/branchd-dev/branchd/pkg/branchd"
 )
 
 // allowedPostgresqlSettings defines which PostgreSQL settings users can customize
@@ -101,26 +104,63 @@ type Service struct {
 	db     *gorm.DB
 	config *config.Config
 	logger zerolog.Logger
+
+	suspendMu sync.Mutex // Serializes suspend and resume
+	waker     *waker     // Set in the API server by StartWaker
 }
 
 type CreateBranchParams struct {
-	BranchName  string
-	CreatedByID string
+	BranchName     string
+	CreatedByID    string
+	ResourceLimits models.BranchResourceLimits // Optional, zero values mean unlimited
+	RestoreID      string                      // Optional, defaults to the latest ready restore (e.g. a promoted restore)
+	PostBranchSQL  string                      // Optional, run after the config's PostBranchSQL (e.g. fixtures of one test suite)
+	Template       string                      // Optional BranchTemplate name, see resolveTemplate
+	HBARules       []models.BranchHBARule      // Optional pg_hba.conf rules, empty = the template's or defaultHBARules
+	AllowedCIDRs   []string                    // Optional networks the port is open to, within Config.BranchAllowedCIDRs
+	PullRequest    string                      // Optional GitHub pull request ("<owner>/<repository>#<number>") the branch is created for
+
+	// Set for the branch of a break-glass grant: RestoreID is its raw restore, group policies don't apply
+	// and every statement is logged to syslog, see statementLoggingConf. The branch user isn't a superuser, so it
+	// can't turn the logging off
+	BreakGlass bool
+
+	branchTemplate *models.BranchTemplate // Loaded from Template by CreateBranch
 }
 
+// branchScriptParams are the parameters of create-branch.sh, passed in its environment
 type branchScriptParams struct {
-	BranchName           string
-	DatasetName          string // Restore's ZFS dataset (e.g., tank/restore_20250915120000)
-	RestorePort          int    // Port of the restore's PostgreSQL cluster
-	User                 string
-	Password             string
-	PgVersion            string
-	CustomPostgresqlConf string // base64-encoded custom settings
+	BranchName           string `env:"BRANCH_NAME"`
+	DatasetName          string `env:"DATASET_NAME"`          // Restore's ZFS dataset (e.g., tank/restore_20250915120000)
+	WALDatasetName       string `env:"WAL_DATASET_NAME"`      // Restore's WAL dataset (empty = pg_wal inside the data directory)
+	BranchDataset        string `env:"BRANCH_DATASET"`        // Branch's ZFS clone (e.g., tank/my-branch)
+	BranchMountpoint     string `env:"BRANCH_MOUNTPOINT"`     // Branch's clone mountpoint (e.g., /opt/branchd/my-branch)
+	BranchWALDataset     string `env:"BRANCH_WAL_DATASET"`    // Branch's WAL clone (empty = pg_wal inside the data directory)
+	BranchWALMountpoint  string `env:"BRANCH_WAL_MOUNTPOINT"` // Branch's WAL clone mountpoint
+	RestorePort          int    `env:"RESTORE_PORT"`          // Port of the restore's PostgreSQL cluster
+	User                 string `env:"BRANCH_USER"`           // Not USER, which would replace the user of the environment
+	Password             string `env:"BRANCH_PASSWORD"`
+	PgVersion            string `env:"PG_VERSION"`
+	CustomPostgresqlConf string `env:"CUSTOM_POSTGRESQL_CONF"` // base64-encoded custom settings
+	ResourceDirectives   string `env:"RESOURCE_DIRECTIVES"`    // systemd [Service] resource control directives (CPUQuota, MemoryMax)
+	MaxConnections       string `env:"MAX_CONNECTIONS"`        // Enforced max_connections (empty = keep the restore's value)
+	HBAConf              string `env:"HBA_CONF"`               // base64-encoded pg_hba.conf, see renderHBAConf
+	Quota                string `env:"QUOTA"`                  // ZFS refquota of the branch's clone (e.g. "50G" or "none")
+	Reservation          string `env:"RESERVATION"`            // ZFS reservation of the branch's clone
+	Extensions           string `env:"EXTENSIONS"`             // Space-separated extensions to verify and create (Config.Extensions)
+	DatabaseName         string `env:"DATABASE_NAME"`          // Database the extensions are created in
+	BreakGlass           bool   `env:"BREAK_GLASS"`            // The branch user isn't a superuser, see CreateBranchParams.BreakGlass
 }
 
+// deleteBranchScriptParams are the parameters of destroy-branch.sh, passed in its environment
 type deleteBranchScriptParams struct {
-	BranchName  string
-	DatasetName string
+	BranchName          string `env:"BRANCH_NAME"`
+	DatasetName         string `env:"DATASET_NAME"`
+	WALDatasetName      string `env:"WAL_DATASET_NAME"`
+	BranchDataset       string `env:"BRANCH_DATASET"`
+	BranchMountpoint    string `env:"BRANCH_MOUNTPOINT"`
+	BranchWALDataset    string `env:"BRANCH_WAL_DATASET"`
+	BranchWALMountpoint string `env:"BRANCH_WAL_MOUNTPOINT"`
 }
 
 // ForcedBranchMetadata contains metadata to force during branch creation (used for refresh)
@@ -139,11 +179,24 @@ func NewService(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *Service
 }
 
 func (s *Service) CreateBranch(ctx context.Context, params CreateBranchParams) (*models.Branch, error) {
+	started := time.Now()
 	s.logger.Info().
 		Str("branch_name", params.BranchName).
 		Str("created_by_id", params.CreatedByID).
 		Msg("Creating new branch")
 
+	if err := ValidateResourceLimits(params.ResourceLimits); err != nil {
+		return nil, fmt.Errorf("invalid resource limits: %w", err)
+	}
+	if err := ValidateHBARules(params.HBARules); err != nil {
+		return nil, fmt.Errorf("invalid hba rules: %w", err)
+	}
+
+	// Template resources count as requested ones, the group profile doesn't replace them
+	if err := s.resolveTemplate(&params); err != nil {
+		return nil, err
+	}
+
 	// Load config (singleton)
 	var config models.Config
 	if err := s.db.First(&config).Error; err != nil {
@@ -153,24 +206,28 @@ func (s *Service) CreateBranch(ctx context.Context, params CreateBranchParams) (
 		s.logger.Error().Err(err).Msg("Failed to load config")
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	if err := ValidateAllowedCIDRs(params.AllowedCIDRs, config.BranchAllowedCIDRs); err != nil {
+		return nil, fmt.Errorf("invalid allowed cidrs: %w", err)
+	}
 
-	// Find the latest ready restore (must have ready_at set)
-	var restore models.Restore
-	if err := s.db.Where("schema_ready = ? AND ready_at IS NOT NULL", true).
-		Order("ready_at DESC").
-		First(&restore).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("no ready restore found")
-		}
-		s.logger.Error().Err(err).Msg("Failed to load restore")
-		return nil, fmt.Errorf("failed to load restore: %w", err)
+	findRestore := s.findSourceRestore
+	if params.BreakGlass {
+		findRestore = s.findRawRestore
+	}
+	restore, err := findRestore(params.RestoreID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if branch already exists by name (branch names are unique)
 	// If it exists, return it regardless of which restore it came from
 	var existingBranch models.Branch
-	err := s.db.Where("name = ?", params.BranchName).First(&existingBranch).Error
+	err = s.db.Preload("Restore").Where("name = ?", params.BranchName).First(&existingBranch).Error
 	if err == nil {
+		// Credentials of a break-glass branch are only handed to its user
+		if existingBranch.Restore.Raw && existingBranch.CreatedByID != params.CreatedByID {
+			return nil, fmt.Errorf("%w: %q", ErrBranchNameTaken, params.BranchName)
+		}
 		s.logger.Info().
 			Str("branch_id", existingBranch.ID).
 			Str("branch_name", params.BranchName).
@@ -182,6 +239,38 @@ func (s *Service) CreateBranch(ctx context.Context, params CreateBranchParams) (
 		return nil, fmt.Errorf("failed to check existing branch: %w", err)
 	}
 
+	// A name equal to another branch's ID or short ID would make lookups ambiguous, see models.FindBranch
+	var ambiguous int64
+	if err := s.db.Model(&models.Branch{}).
+		Where("id = ? OR short_id = ?", params.BranchName, params.BranchName).
+		Count(&ambiguous).Error; err != nil {
+		return nil, fmt.Errorf("failed to check existing branch: %w", err)
+	}
+	if ambiguous > 0 {
+		return nil, fmt.Errorf("%w: %q is the ID or short ID of another branch", ErrBranchNameTaken, params.BranchName)
+	}
+
+	// The name becomes a ZFS dataset, a mountpoint and a value in create-branch.sh, whichever caller chose it
+	if err := branchd.ValidateBranchName(params.BranchName); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBranchName, err)
+	}
+
+	// Group quota, allowed sources and default profile
+	if !params.BreakGlass {
+		if err := s.applyGroupPolicy(&params, restore); err != nil {
+			return nil, err
+		}
+	}
+
+	// The branch shares the restore's blocks, only the reserve for its own writes is needed up front
+	if err := s.checkDiskSpace(ctx); err != nil {
+		return nil, err
+	}
+	// Memory, CPU and disk headroom for another cluster (branches recreated by refreshes aren't checked)
+	if err := s.checkCapacity(ctx, &config); err != nil {
+		return nil, err
+	}
+
 	// Generate credentials for new branch
 	user, err := s.genRandomString(16)
 	if err != nil {
@@ -195,18 +284,49 @@ func (s *Service) CreateBranch(ctx context.Context, params CreateBranchParams) (
 		return nil, fmt.Errorf("failed to generate random password: %w", err)
 	}
 
-	// Execute branch creation synchronously
-	return s.executeBranchCreation(ctx, &config, &restore, params, user, password)
+	// Execute branch creation synchronously, scheduled refreshes wait for it
+	done := s.beginBranchOperation(params.BranchName, branchOperationCreate, params.CreatedByID)
+	defer done()
+	branch, err := s.executeBranchCreation(ctx, &config, restore, params, user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	s.postBranchCreated(ctx, &config, branch, restore, started)
+	return branch, nil
 }
 
 func (s *Service) executeBranchCreation(ctx context.Context, config *models.Config, restore *models.Restore, params CreateBranchParams, user, password string) (*models.Branch, error) {
 	// Filter and encode custom PostgreSQL configuration
-	filteredConf, err := filterPostgresqlSettings(config.BranchPostgresqlConf)
+	filteredConf, err := filterPostgresqlSettings(branchPostgresqlConf(config, params))
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Failed to filter PostgreSQL settings")
 		return nil, fmt.Errorf("failed to filter PostgreSQL settings: %w", err)
 	}
 
+	// Branches without their own disk quota get the configured default
+	if params.ResourceLimits.DiskQuotaGB == 0 {
+		params.ResourceLimits.DiskQuotaGB = config.BranchDiskQuotaGB
+	}
+
+	// An enforced connection limit takes precedence over custom configuration
+	if params.ResourceLimits.MaxConnections > 0 {
+		filteredConf = withoutSetting(filteredConf, "max_connections")
+	}
+
+	if params.BreakGlass {
+		filteredConf = withStatementLogging(filteredConf, params.BranchName)
+	}
+
+	// The new branch shares the VM's memory with the existing ones
+	var branchCount int64
+	if err := s.db.Model(&models.Branch{}).Count(&branchCount).Error; err != nil {
+		return nil, fmt.Errorf("failed to count branches: %w", err)
+	}
+	if err := s.checkPostgresqlConf(filteredConf, int(branchCount)+1, params.ResourceLimits); err != nil {
+		return nil, fmt.Errorf("branch PostgreSQL settings exceed this VM's resources: %w", err)
+	}
+
 	var encodedConf string
 	if filteredConf != "" {
 		encodedConf = base64.StdEncoding.EncodeToString([]byte(filteredConf))
@@ -216,27 +336,39 @@ func (s *Service) executeBranchCreation(ctx context.Context, config *models.Conf
 	assert.Length(user, 16)     // 16-char user
 	assert.Length(password, 32) // 32-char password
 
+	extensions, err := models.ParseExtensions(config.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extensions setting: %w", err)
+	}
+
 	// Execute branch creation script (includes ZFS clone, service start, user creation)
 	// Clone from restore's ZFS dataset (e.g., tank/restore_20250915120000)
-	restoreDatasetName := fmt.Sprintf("tank/%s", restore.Name)
+	storage := s.config.Storage
 	scriptParams := branchScriptParams{
 		BranchName:           params.BranchName,
-		DatasetName:          restoreDatasetName,
+		DatasetName:          storage.DatasetName(restore.Name),
+		WALDatasetName:       storage.WALDatasetName(restore.Name),
+		BranchDataset:        storage.DatasetName(params.BranchName),
+		BranchMountpoint:     storage.MountPath(params.BranchName),
+		BranchWALDataset:     storage.WALDatasetName(params.BranchName),
+		BranchWALMountpoint:  storage.WALMountPath(params.BranchName),
 		RestorePort:          restore.Port,
 		User:                 user,
 		Password:             password,
-		PgVersion:            config.PostgresVersion,
+		PgVersion:            restore.ClusterPostgresVersion(config),
 		CustomPostgresqlConf: encodedConf,
-	}
-
-	script, err := s.renderBranchScript(scriptParams)
-	if err != nil {
-		s.logger.Error().Err(err).Msg("Failed to render branch creation script")
-		return nil, fmt.Errorf("failed to render branch creation script: %w", err)
+		ResourceDirectives:   systemdResourceDirectives(params.ResourceLimits),
+		MaxConnections:       formatMaxConnections(params.ResourceLimits),
+		HBAConf:              base64.StdEncoding.EncodeToString([]byte(renderHBAConf(user, params.HBARules))),
+		Quota:                formatZFSSize(params.ResourceLimits.DiskQuotaGB),
+		Reservation:          formatZFSSize(params.ResourceLimits.DiskReservationGB),
+		Extensions:           strings.Join(extensions, " "),
+		DatabaseName:         branchDatabaseName(config),
+		BreakGlass:           params.BreakGlass,
 	}
 
 	// Execute branch creation script locally
-	cmd := exec.CommandContext(ctx, "bash", "-c", script)
+	cmd := shellexec.Command(ctx, createBranchScript, scriptParams)
 	outputBytes, err := cmd.CombinedOutput()
 	output := string(outputBytes)
 	if err != nil {
@@ -246,6 +378,11 @@ func (s *Service) executeBranchCreation(ctx context.Context, config *models.Conf
 			s.logger.Info().Str("branch_name", params.BranchName).Str("error_detail", errorMsg).Msg("Branch creation failed: source database not ready")
 			return nil, fmt.Errorf("restore is not accepting connections")
 		}
+		if strings.Contains(output, "BRANCHD_ERROR:EXTENSION_MISSING") {
+			errorMsg := extractErrorMessage(output)
+			s.logger.Info().Str("branch_name", params.BranchName).Str("error_detail", errorMsg).Msg("Branch creation failed: extension not installed")
+			return nil, errors.New(strings.TrimPrefix(errorMsg, "BRANCHD_ERROR:EXTENSION_MISSING: "))
+		}
 		if strings.Contains(output, "BRANCHD_ERROR:RESTORE_NOT_RUNNING") {
 			errorMsg := extractErrorMessage(output)
 			s.logger.Info().Str("branch_name", params.BranchName).Str("error_detail", errorMsg).Msg("Branch creation failed: restore process not running")
@@ -270,12 +407,18 @@ func (s *Service) executeBranchCreation(ctx context.Context, config *models.Conf
 
 	// Create branch record in database (only after successful creation)
 	branch := models.Branch{
-		Name:        params.BranchName,
-		RestoreID:   restore.ID,
-		CreatedByID: params.CreatedByID,
-		User:        user,
-		Password:    password,
-		Port:        port,
+		Name:           params.BranchName,
+		RestoreID:      restore.ID,
+		CreatedByID:    params.CreatedByID,
+		User:           user,
+		Password:       password,
+		Port:           port,
+		ResourceLimits: params.ResourceLimits,
+		HBARules:       params.HBARules,
+		AllowedCIDRs:   params.AllowedCIDRs,
+		Template:       params.Template,
+		ExpiresAt:      branchExpiry(params, time.Now()),
+		PullRequest:    params.PullRequest,
 	}
 
 	if err := s.db.Create(&branch).Error; err != nil {
@@ -283,6 +426,17 @@ func (s *Service) executeBranchCreation(ctx context.Context, config *models.Conf
 		return nil, fmt.Errorf("failed to create branch record: %w", err)
 	}
 
+	// create-branch.sh opens the port to anywhere, which reserves it
+	if err := s.applyBranchFirewall(ctx, config, &branch); err != nil {
+		return nil, err
+	}
+
+	if err := s.applyPostBranchSQL(ctx, config, restore, &branch, params); err != nil {
+		return nil, err
+	}
+
+	s.recordBranchCreation(&branch, restore)
+
 	s.logger.Info().
 		Str("branch_id", branch.ID).
 		Str("branch_name", params.BranchName).
@@ -292,20 +446,6 @@ func (s *Service) executeBranchCreation(ctx context.Context, config *models.Conf
 	return &branch, nil
 }
 
-func (s *Service) renderBranchScript(params branchScriptParams) (string, error) {
-	tmpl, err := template.New("create-branch").Parse(createBranchScript)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse script template: %w", err)
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, params); err != nil {
-		return "", fmt.Errorf("failed to execute script template: %w", err)
-	}
-
-	return buf.String(), nil
-}
-
 func (s *Service) parseBranchPortFromOutput(output string) (int, error) {
 	// Look for BRANCH_PORT=<number> in the output
 	re := regexp.MustCompile(`BRANCH_PORT=(\d+)`)
@@ -361,6 +501,14 @@ func extractErrorMessage(output string) string {
 	return "-- no error message --"
 }
 
+// branchDatabaseName returns the database branches are connected to (same resolution as the restores)
+func branchDatabaseName(config *models.Config) string {
+	if config.CrunchyBridgeDatabaseName != "" {
+		return config.CrunchyBridgeDatabaseName
+	}
+	return config.DatabaseName
+}
+
 // CreateBranchWithForcedMetadata creates a branch with forced port/credentials (used during refresh)
 func (s *Service) CreateBranchWithForcedMetadata(ctx context.Context, params CreateBranchParams, forced ForcedBranchMetadata) (*models.Branch, error) {
 	s.logger.Info().
@@ -378,31 +526,101 @@ func (s *Service) CreateBranchWithForcedMetadata(ctx context.Context, params Cre
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Find the latest ready restore (must have ready_at set)
+	// The latest ready restore unless params.RestoreID is set (clones and promoted restores are never branched from by default)
+	restore, err := s.findSourceRestore(params.RestoreID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute branch creation synchronously with forced port
+	return s.executeBranchCreationWithForcedPort(ctx, &config, restore, params, forced.User, forced.Password, forced.Port)
+}
+
+// checkDiskSpace fails with sysinfo.ErrInsufficientDiskSpace when the data pool is (almost) full
+// A pool that can't be inspected is not treated as full
+func (s *Service) checkDiskSpace(ctx context.Context) error {
+	err := sysinfo.CheckDiskSpace(ctx, s.config.Storage.DatasetRoot, 0)
+	if err != nil && !errors.Is(err, sysinfo.ErrInsufficientDiskSpace) {
+		s.logger.Warn().Err(err).Msg("Failed to check available disk space")
+		return nil
+	}
+	return err
+}
+
+// ErrNoReadyRestore is returned when a branch is created without a restore and none is ready
+var ErrNoReadyRestore = errors.New("no ready restore found")
+
+// findSourceRestore loads the restore a new branch is created from
+// Without restoreID it's the latest ready restore (clones and promoted restores are only used when requested)
+// Raw restores are never branched from here, their break-glass grant's branch is created from findRawRestore
+func (s *Service) findSourceRestore(restoreID string) (*models.Restore, error) {
 	var restore models.Restore
-	if err := s.db.Where("schema_ready = ? AND ready_at IS NOT NULL", true).
+	if restoreID != "" {
+		if err := s.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, fmt.Errorf("restore not found")
+			}
+			s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to load restore")
+			return nil, fmt.Errorf("failed to load restore: %w", err)
+		}
+		if restore.ClonedFromID != "" {
+			return nil, fmt.Errorf("restore %s is a clone and can't be branched from", restore.Name)
+		}
+		if restore.Raw {
+			return nil, fmt.Errorf("restore %s is raw (not anonymized), it's only accessible through its break-glass grant", restore.Name)
+		}
+		if !restore.SchemaReady || restore.ReadyAt == nil || restore.RefreshingSince != nil {
+			return nil, fmt.Errorf("restore %s is not ready", restore.Name)
+		}
+		return &restore, nil
+	}
+
+	if err := s.db.Where("schema_ready = ? AND ready_at IS NOT NULL AND cloned_from_id = '' AND promoted_from_branch = '' AND raw = ? AND refreshing_since IS NULL", true, false).
 		Order("ready_at DESC").
 		First(&restore).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("no ready restore found")
+			return nil, ErrNoReadyRestore
 		}
 		s.logger.Error().Err(err).Msg("Failed to load restore")
 		return nil, fmt.Errorf("failed to load restore: %w", err)
 	}
+	return &restore, nil
+}
 
-	// Execute branch creation synchronously with forced port
-	return s.executeBranchCreationWithForcedPort(ctx, &config, &restore, params, forced.User, forced.Password, forced.Port)
+// findRawRestore loads the ready raw restore of a break-glass grant
+func (s *Service) findRawRestore(restoreID string) (*models.Restore, error) {
+	var restore models.Restore
+	if err := s.db.Where("id = ? AND raw = ?", restoreID, true).First(&restore).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("raw restore not found")
+		}
+		return nil, fmt.Errorf("failed to load restore: %w", err)
+	}
+	if !restore.SchemaReady || restore.ReadyAt == nil {
+		return nil, fmt.Errorf("restore %s is not ready", restore.Name)
+	}
+	return &restore, nil
 }
 
 func (s *Service) executeBranchCreationWithForcedPort(ctx context.Context, config *models.Config, restore *models.Restore, params CreateBranchParams, user, password string, forcePort int) (*models.Branch, error) {
 	// Filter and encode custom PostgreSQL configuration
-	filteredConf, err := filterPostgresqlSettings(config.BranchPostgresqlConf)
+	filteredConf, err := filterPostgresqlSettings(branchPostgresqlConf(config, params))
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Failed to filter PostgreSQL settings")
 
 		return nil, fmt.Errorf("failed to filter PostgreSQL settings: %w", err)
 	}
 
+	// Branches without their own disk quota get the configured default
+	if params.ResourceLimits.DiskQuotaGB == 0 {
+		params.ResourceLimits.DiskQuotaGB = config.BranchDiskQuotaGB
+	}
+
+	// An enforced connection limit takes precedence over custom configuration
+	if params.ResourceLimits.MaxConnections > 0 {
+		filteredConf = withoutSetting(filteredConf, "max_connections")
+	}
+
 	var encodedConf string
 	if filteredConf != "" {
 		encodedConf = base64.StdEncoding.EncodeToString([]byte(filteredConf))
@@ -412,29 +630,40 @@ func (s *Service) executeBranchCreationWithForcedPort(ctx context.Context, confi
 	assert.Length(user, 16)     // 16-char user
 	assert.Length(password, 32) // 32-char password
 
+	extensions, err := models.ParseExtensions(config.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extensions setting: %w", err)
+	}
+
 	// Execute branch creation script with FORCE_PORT environment variable
 	// Clone from restore's ZFS dataset (e.g., tank/restore_20250915120000)
-	restoreDatasetName := fmt.Sprintf("tank/%s", restore.Name)
+	storage := s.config.Storage
 	scriptParams := branchScriptParams{
 		BranchName:           params.BranchName,
-		DatasetName:          restoreDatasetName,
+		DatasetName:          storage.DatasetName(restore.Name),
+		WALDatasetName:       storage.WALDatasetName(restore.Name),
+		BranchDataset:        storage.DatasetName(params.BranchName),
+		BranchMountpoint:     storage.MountPath(params.BranchName),
+		BranchWALDataset:     storage.WALDatasetName(params.BranchName),
+		BranchWALMountpoint:  storage.WALMountPath(params.BranchName),
 		RestorePort:          restore.Port,
 		User:                 user,
 		Password:             password,
-		PgVersion:            config.PostgresVersion,
+		PgVersion:            restore.ClusterPostgresVersion(config),
 		CustomPostgresqlConf: encodedConf,
-	}
-
-	script, err := s.renderBranchScript(scriptParams)
-	if err != nil {
-		s.logger.Error().Err(err).Msg("Failed to render branch creation script")
-
-		return nil, fmt.Errorf("failed to render branch creation script: %w", err)
+		ResourceDirectives:   systemdResourceDirectives(params.ResourceLimits),
+		MaxConnections:       formatMaxConnections(params.ResourceLimits),
+		HBAConf:              base64.StdEncoding.EncodeToString([]byte(renderHBAConf(user, params.HBARules))),
+		Quota:                formatZFSSize(params.ResourceLimits.DiskQuotaGB),
+		Reservation:          formatZFSSize(params.ResourceLimits.DiskReservationGB),
+		Extensions:           strings.Join(extensions, " "),
+		DatabaseName:         branchDatabaseName(config),
+		BreakGlass:           params.BreakGlass,
 	}
 
 	// Execute branch creation script locally with FORCE_PORT environment variable
-	scriptWithEnv := fmt.Sprintf("export FORCE_PORT=%d\n%s", forcePort, script)
-	cmd := exec.CommandContext(ctx, "bash", "-c", scriptWithEnv)
+	cmd := shellexec.Command(ctx, createBranchScript, scriptParams)
+	cmd.Env = append(cmd.Env, "FORCE_PORT="+strconv.Itoa(forcePort))
 	outputBytes, err := cmd.CombinedOutput()
 	output := string(outputBytes)
 	if err != nil {
@@ -445,6 +674,11 @@ func (s *Service) executeBranchCreationWithForcedPort(ctx context.Context, confi
 
 			return nil, fmt.Errorf("instance is still in initial recovery. Please wait a few minutes and try again")
 		}
+		if strings.Contains(output, "BRANCHD_ERROR:EXTENSION_MISSING") {
+			errorMsg := extractErrorMessage(output)
+			s.logger.Info().Str("branch_name", params.BranchName).Str("error_detail", errorMsg).Msg("Branch creation failed: extension not installed")
+			return nil, errors.New(strings.TrimPrefix(errorMsg, "BRANCHD_ERROR:EXTENSION_MISSING: "))
+		}
 		if strings.Contains(output, "BRANCHD_ERROR:RESTORE_NOT_RUNNING") {
 			errorMsg := extractErrorMessage(output)
 			s.logger.Info().Str("branch_name", params.BranchName).Str("error_detail", errorMsg).Msg("Branch creation failed: restore process not running")
@@ -483,12 +717,18 @@ func (s *Service) executeBranchCreationWithForcedPort(ctx context.Context, confi
 
 	// Create branch record in database (only after successful creation)
 	branch := models.Branch{
-		Name:        params.BranchName,
-		RestoreID:   restore.ID,
-		CreatedByID: params.CreatedByID,
-		User:        user,
-		Password:    password,
-		Port:        port,
+		Name:           params.BranchName,
+		RestoreID:      restore.ID,
+		CreatedByID:    params.CreatedByID,
+		User:           user,
+		Password:       password,
+		Port:           port,
+		ResourceLimits: params.ResourceLimits,
+		HBARules:       params.HBARules,
+		AllowedCIDRs:   params.AllowedCIDRs,
+		Template:       params.Template,
+		ExpiresAt:      branchExpiry(params, time.Now()),
+		PullRequest:    params.PullRequest,
 	}
 
 	if err := s.db.Create(&branch).Error; err != nil {
@@ -496,6 +736,17 @@ func (s *Service) executeBranchCreationWithForcedPort(ctx context.Context, confi
 		return nil, fmt.Errorf("failed to create branch record: %w", err)
 	}
 
+	// create-branch.sh opens the port to anywhere, which reserves it
+	if err := s.applyBranchFirewall(ctx, config, &branch); err != nil {
+		return nil, err
+	}
+
+	if err := s.applyPostBranchSQL(ctx, config, restore, &branch, params); err != nil {
+		return nil, err
+	}
+
+	s.recordBranchCreation(&branch, restore)
+
 	s.logger.Info().
 		Str("branch_id", branch.ID).
 		Str("branch_name", params.BranchName).
@@ -530,6 +781,11 @@ func (s *Service) DeleteBranch(ctx context.Context, params DeleteBranchParams) e
 		return fmt.Errorf("failed to load branch: %w", err)
 	}
 
+	// Free the port of a suspended branch (the deletion script closes it in UFW)
+	if s.waker != nil {
+		s.waker.release(branch.ID)
+	}
+
 	// Load config (singleton) to get dataset name
 	var config models.Config
 	if err := s.db.First(&config).Error; err != nil {
@@ -547,34 +803,25 @@ func (s *Service) DeleteBranch(ctx context.Context, params DeleteBranchParams) e
 		return fmt.Errorf("failed to load restore: %w", err)
 	}
 
-	// Render deletion script
+	// Deletion script parameters
 	// Clone from restore's ZFS dataset (e.g., tank/restore_20250915120000)
-	restoreDatasetName := fmt.Sprintf("tank/%s", restore.Name)
+	storage := s.config.Storage
 	scriptParams := deleteBranchScriptParams{
-		BranchName:  params.BranchName,
-		DatasetName: restoreDatasetName,
-	}
-
-	tmpl, err := template.New("delete-branch").Parse(destroyBranchScript)
-	if err != nil {
-		s.logger.Error().Err(err).Msg("Failed to parse script template")
-		return fmt.Errorf("failed to parse script template: %w", err)
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, scriptParams); err != nil {
-		s.logger.Error().Err(err).Msg("Failed to execute script template")
-		return fmt.Errorf("failed to execute script template: %w", err)
+		BranchName:          params.BranchName,
+		DatasetName:         storage.DatasetName(restore.Name),
+		WALDatasetName:      storage.WALDatasetName(restore.Name),
+		BranchDataset:       storage.DatasetName(params.BranchName),
+		BranchMountpoint:    storage.MountPath(params.BranchName),
+		BranchWALDataset:    storage.WALDatasetName(params.BranchName),
+		BranchWALMountpoint: storage.WALMountPath(params.BranchName),
 	}
 
-	script := buf.String()
-
 	// Execute deletion script locally (best effort - log errors but continue)
 	s.logger.Info().
 		Str("branch_name", params.BranchName).
 		Msg("Executing deletion script locally")
 
-	cmd := exec.CommandContext(ctx, "bash", "-c", script)
+	cmd := shellexec.Command(ctx, destroyBranchScript, scriptParams)
 	outputBytes, err := cmd.CombinedOutput()
 	output := string(outputBytes)
 	if err != nil {
@@ -609,6 +856,14 @@ func (s *Service) DeleteBranch(ctx context.Context, params DeleteBranchParams) e
 		return fmt.Errorf("failed to delete branch from database: %w", err)
 	}
 
+	// Share roles went with the cluster
+	if err := s.db.Where("branch_id = ?", branch.ID).Delete(&models.BranchShare{}).Error; err != nil {
+		s.logger.Warn().Err(err).Str("branch_id", branch.ID).Msg("Failed to delete branch shares")
+	}
+
+	s.removeBranchLog(params.BranchName)
+	s.postBranchDeleted(ctx, &branch, &restore)
+
 	s.logger.Info().
 		Str("branch_id", branch.ID).
 		Str("branch_name", params.BranchName).
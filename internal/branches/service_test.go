@@ -0,0 +1,108 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// newTestService returns a service on a migrated in-memory database with a config and a ready restore
+func newTestService(t *testing.T) (*Service, *models.Restore) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// In-memory databases exist per connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+
+	if err := db.Create(&models.Config{JWTSecret: "secret"}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+	readyAt := time.Now()
+	restore := &models.Restore{Name: "restore_20250101000000", SchemaReady: true, ReadyAt: &readyAt, Port: 5433}
+	if err := db.Create(restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+
+	return NewService(db, &config.Config{}, zerolog.Nop()), restore
+}
+
+// createTestBranch inserts a branch record without creating its cluster
+func createTestBranch(t *testing.T, s *Service, branch *models.Branch) {
+	t.Helper()
+	if branch.User == "" {
+		branch.User, branch.Password = "user", "password"
+	}
+	if err := s.db.Create(branch).Error; err != nil {
+		t.Fatalf("failed to create branch %s: %v", branch.Name, err)
+	}
+}
+
+func TestCreateBranchRejectsNamesOfOtherBranches(t *testing.T) {
+	s, restore := newTestService(t)
+	existing := &models.Branch{Name: "feature-x", RestoreID: restore.ID, ShortID: "k3m9x2ab", Port: 6001}
+	createTestBranch(t, s, existing)
+
+	for _, name := range []string{"k3m9x2ab", existing.ID} {
+		_, err := s.CreateBranch(context.Background(), CreateBranchParams{BranchName: name, CreatedByID: "user-1"})
+		if !errors.Is(err, ErrBranchNameTaken) {
+			t.Errorf("CreateBranch(%q) error = %v, want ErrBranchNameTaken", name, err)
+		}
+	}
+
+	// The branch's own name returns the existing branch
+	branch, err := s.CreateBranch(context.Background(), CreateBranchParams{BranchName: "feature-x", CreatedByID: "user-1"})
+	if err != nil {
+		t.Fatalf("CreateBranch(feature-x) error = %v", err)
+	}
+	if branch.ID != existing.ID {
+		t.Errorf("CreateBranch(feature-x) = %s, want existing %s", branch.ID, existing.ID)
+	}
+}
+
+func TestRawRestoresAreOnlyBranchedByTheirGrant(t *testing.T) {
+	s, restore := newTestService(t)
+	readyAt := time.Now().Add(time.Hour)
+	raw := &models.Restore{Name: "restore_20250102000000", SchemaReady: true, ReadyAt: &readyAt, Port: 5434, Raw: true}
+	if err := s.db.Create(raw).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+
+	// The newer raw restore isn't the default source
+	latest, err := s.findSourceRestore("")
+	if err != nil || latest.ID != restore.ID {
+		t.Errorf("findSourceRestore() = %v, %v; want %s", latest, err, restore.Name)
+	}
+	if _, err := s.findSourceRestore(raw.ID); err == nil {
+		t.Error("findSourceRestore(raw) succeeded, want error")
+	}
+	if _, err := s.findRawRestore(restore.ID); err == nil {
+		t.Error("findRawRestore(anonymized restore) succeeded, want error")
+	}
+	if got, err := s.findRawRestore(raw.ID); err != nil || got.ID != raw.ID {
+		t.Errorf("findRawRestore(raw) = %v, %v", got, err)
+	}
+
+	// Naming an existing break-glass branch doesn't hand out its credentials
+	createTestBranch(t, s, &models.Branch{Name: "breakglass-x", RestoreID: raw.ID, CreatedByID: "user-1", ShortID: "k3m9x2ab", Port: 6001})
+	if _, err := s.CreateBranch(context.Background(), CreateBranchParams{BranchName: "breakglass-x", CreatedByID: "user-2"}); !errors.Is(err, ErrBranchNameTaken) {
+		t.Errorf("CreateBranch(breakglass-x) by another user error = %v, want ErrBranchNameTaken", err)
+	}
+}
@@ -0,0 +1,213 @@
+package branches
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Share durations, long-lived access should be a branchd user instead
+const (
+	DefaultShareTTL = 24 * time.Hour
+	MaxShareTTL     = 7 * 24 * time.Hour
+)
+
+// shareGroupRole is the role every share role is a member of, allowed in the branch's pg_hba.conf
+const shareGroupRole = "branchd_shares"
+
+// shareConnectionLimit bounds the connections of one share role
+const shareConnectionLimit = 5
+
+// shareUserAlphabet keeps share role names valid unquoted identifiers
+const shareUserAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+// ErrShareRevoked is returned when revoking a share that already ended
+var ErrShareRevoked = errors.New("share already revoked or expired")
+
+// CreateShareParams contains parameters for sharing a branch
+type CreateShareParams struct {
+	BranchID    string
+	CreatedByID string
+	TTL         time.Duration // 0 = DefaultShareTTL
+	Note        string        // Who the access is for
+}
+
+// CreateShare creates a read-only role in a branch that can log in until the share expires, returning it with the
+// role's password. The password isn't stored, it's only handed out here
+func (s *Service) CreateShare(ctx context.Context, params CreateShareParams) (*models.BranchShare, string, error) {
+	if params.TTL == 0 {
+		params.TTL = DefaultShareTTL
+	}
+	if params.TTL < time.Minute || params.TTL > MaxShareTTL {
+		return nil, "", fmt.Errorf("share duration must be between 1 minute and %s", MaxShareTTL)
+	}
+
+	// The role is created in the running cluster
+	if err := s.ResumeBranch(ctx, params.BranchID); err != nil {
+		return nil, "", fmt.Errorf("failed to resume branch: %w", err)
+	}
+	branch, config, version, err := s.loadShareBranch(params.BranchID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	user, err := generateShareUser()
+	if err != nil {
+		return nil, "", err
+	}
+	password, err := s.genRandomString(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate share password: %w", err)
+	}
+
+	// Branches created before shares existed only allow their own user
+	path := s.config.Storage.DataDir(branch.Name) + "/pg_hba.conf"
+	if err := writeHBAFile(ctx, path, []byte(renderHBAConf(branch.User, branch.HBARules))); err != nil {
+		return nil, "", err
+	}
+	if output, err := reloadCluster(ctx, branch.Port); err != nil {
+		return nil, "", fmt.Errorf("failed to reload branch configuration: %s", strings.TrimSpace(string(output)))
+	}
+
+	share := models.BranchShare{
+		BranchID:    branch.ID,
+		BranchName:  branch.Name,
+		CreatedByID: params.CreatedByID,
+		Note:        params.Note,
+		User:        user,
+		ExpiresAt:   time.Now().Add(params.TTL).UTC().Truncate(time.Second),
+	}
+	if output, err := execPostBranchSQL(ctx, version, branch.Port, branchDatabaseName(config), createShareSQL(share, password)); err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Str("output", output).Msg("Failed to create share role")
+		return nil, "", fmt.Errorf("failed to create share role: %s", postBranchSQLError(output, err))
+	}
+	if err := s.db.Create(&share).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to record share: %w", err)
+	}
+
+	s.logger.Info().
+		Str("branch_id", branch.ID).
+		Str("share_id", share.ID).
+		Time("expires_at", share.ExpiresAt).
+		Msg("Branch shared")
+
+	return &share, password, nil
+}
+
+// RevokeShare drops the role of a share and terminates its connections, revokedByID empty = expired
+func (s *Service) RevokeShare(ctx context.Context, shareID, revokedByID string) (*models.BranchShare, error) {
+	var share models.BranchShare
+	if err := s.db.Where("id = ?", shareID).First(&share).Error; err != nil {
+		return nil, fmt.Errorf("failed to load share: %w", err)
+	}
+	if share.RevokedAt != nil {
+		return nil, ErrShareRevoked
+	}
+
+	if err := s.ResumeBranch(ctx, share.BranchID); err != nil {
+		return nil, fmt.Errorf("failed to resume branch: %w", err)
+	}
+	branch, config, version, err := s.loadShareBranch(share.BranchID)
+	if err != nil {
+		return nil, err
+	}
+	if output, err := execPostBranchSQL(ctx, version, branch.Port, branchDatabaseName(config), revokeShareSQL(share.User)); err != nil {
+		s.logger.Error().Err(err).Str("share_id", share.ID).Str("output", output).Msg("Failed to drop share role")
+		return nil, fmt.Errorf("failed to drop share role: %s", postBranchSQLError(output, err))
+	}
+
+	now := time.Now()
+	share.RevokedAt, share.RevokedByID = &now, revokedByID
+	if err := s.db.Model(&share).Select("RevokedAt", "RevokedByID").Updates(&share).Error; err != nil {
+		return nil, fmt.Errorf("failed to record share revocation: %w", err)
+	}
+
+	s.logger.Info().
+		Str("branch_id", branch.ID).
+		Str("share_id", share.ID).
+		Str("revoked_by_id", revokedByID).
+		Msg("Branch share revoked")
+
+	return &share, nil
+}
+
+// RevokeExpiredShares drops the roles of expired shares
+// Their passwords already stopped working at VALID UNTIL, this ends open sessions and removes the roles
+func (s *Service) RevokeExpiredShares(ctx context.Context) error {
+	var expired []models.BranchShare
+	if err := s.db.Where("revoked_at IS NULL AND expires_at <= ?", time.Now()).Find(&expired).Error; err != nil {
+		return fmt.Errorf("failed to load expired shares: %w", err)
+	}
+	for _, share := range expired {
+		if _, err := s.RevokeShare(ctx, share.ID, ""); err != nil {
+			s.logger.Error().Err(err).Str("share_id", share.ID).Str("branch_name", share.BranchName).Msg("Failed to revoke expired share")
+		}
+	}
+	return nil
+}
+
+// loadShareBranch loads a branch with what's needed to run SQL in it
+func (s *Service) loadShareBranch(branchID string) (*models.Branch, *models.Config, string, error) {
+	var branch models.Branch
+	if err := s.db.Where("id = ?", branchID).First(&branch).Error; err != nil {
+		return nil, nil, "", fmt.Errorf("failed to load branch: %w", err)
+	}
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		return nil, nil, "", fmt.Errorf("failed to load config: %w", err)
+	}
+	var restore models.Restore
+	if err := s.db.Where("id = ?", branch.RestoreID).First(&restore).Error; err != nil {
+		return nil, nil, "", fmt.Errorf("failed to load restore: %w", err)
+	}
+	return &branch, &config, restore.ClusterPostgresVersion(&config), nil
+}
+
+// generateShareUser returns a random share role name, e.g. share_k3m9x2abqr
+func generateShareUser() (string, error) {
+	random := make([]byte, 10)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate share user: %w", err)
+	}
+	for i, b := range random {
+		random[i] = shareUserAlphabet[int(b)%len(shareUserAlphabet)]
+	}
+	return "share_" + string(random), nil
+}
+
+// createShareSQL creates a share's role: it reads all data (pg_read_all_data, PostgreSQL 14+), its transactions
+// are read-only by default and its password stops working at the share's expiry
+func createShareSQL(share models.BranchShare, password string) string {
+	return fmt.Sprintf(`DO $$ BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = '%[1]s') THEN
+        CREATE ROLE %[1]s NOLOGIN;
+    END IF;
+END $$;
+CREATE ROLE %[2]s LOGIN PASSWORD '%[3]s' VALID UNTIL '%[4]s' CONNECTION LIMIT %[5]d IN ROLE %[1]s;
+GRANT pg_read_all_data TO %[2]s;
+ALTER ROLE %[2]s SET default_transaction_read_only = on;
+`, shareGroupRole, share.User, password, share.ExpiresAt.UTC().Format("2006-01-02 15:04:05+00"), shareConnectionLimit)
+}
+
+// revokeShareSQL disables a share's role and ends its sessions before dropping it, so a failed drop
+// still leaves no access. Roles that are already gone are skipped
+func revokeShareSQL(user string) string {
+	return fmt.Sprintf(`DO $$ BEGIN
+    IF EXISTS (SELECT FROM pg_roles WHERE rolname = '%[1]s') THEN
+        ALTER ROLE %[1]s NOLOGIN;
+        PERFORM pg_terminate_backend(pid) FROM pg_stat_activity WHERE usename = '%[1]s';
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF EXISTS (SELECT FROM pg_roles WHERE rolname = '%[1]s') THEN
+        DROP OWNED BY %[1]s;
+        DROP ROLE %[1]s;
+    END IF;
+END $$;
+`, user)
+}
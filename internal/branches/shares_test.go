@@ -0,0 +1,111 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestBranchShares(t *testing.T) {
+	s, restore := newTestService(t)
+
+	var ran []string
+	var hbaWritten string
+	sqlErr := error(nil)
+	origExec, origWrite, origReload := execPostBranchSQL, writeHBAFile, reloadCluster
+	t.Cleanup(func() { execPostBranchSQL, writeHBAFile, reloadCluster = origExec, origWrite, origReload })
+	execPostBranchSQL = func(ctx context.Context, postgresVersion string, port int, databaseName, sql string) (string, error) {
+		if port != 6001 {
+			t.Errorf("ran on port %d, want the branch's 6001", port)
+		}
+		ran = append(ran, sql)
+		if sqlErr != nil {
+			return "ERROR:  permission denied\n", sqlErr
+		}
+		return "", nil
+	}
+	writeHBAFile = func(ctx context.Context, path string, content []byte) error {
+		hbaWritten = string(content)
+		return nil
+	}
+	reloadCluster = func(ctx context.Context, port int) ([]byte, error) { return nil, nil }
+
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, User: "u1", Port: 6001}
+	createTestBranch(t, s, branch)
+
+	if _, _, err := s.CreateShare(context.Background(), CreateShareParams{BranchID: branch.ID, TTL: MaxShareTTL + time.Hour}); err == nil {
+		t.Error("CreateShare() accepted a duration above the maximum")
+	}
+
+	share, password, err := s.CreateShare(context.Background(), CreateShareParams{BranchID: branch.ID, CreatedByID: "u1", Note: "Acme"})
+	if err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+	if !strings.HasPrefix(share.User, "share_") || len(password) != 32 {
+		t.Errorf("share user %q, password %q, want a share_ role with a 32-char password", share.User, password)
+	}
+	if until := time.Until(share.ExpiresAt); until < DefaultShareTTL-time.Minute || until > DefaultShareTTL {
+		t.Errorf("share expires in %s, want the default %s", until, DefaultShareTTL)
+	}
+	if !strings.Contains(hbaWritten, "+"+shareGroupRole) {
+		t.Errorf("pg_hba.conf = %q, want the share group allowed", hbaWritten)
+	}
+	for _, want := range []string{
+		"CREATE ROLE " + share.User + " LOGIN PASSWORD '" + password + "' VALID UNTIL '" + share.ExpiresAt.Format("2006-01-02 15:04:05") + "+00'",
+		"IN ROLE " + shareGroupRole,
+		"GRANT pg_read_all_data TO " + share.User,
+		"default_transaction_read_only = on",
+	} {
+		if len(ran) != 1 || !strings.Contains(ran[0], want) {
+			t.Errorf("share SQL = %q, want %q", ran, want)
+		}
+	}
+	var stored models.BranchShare
+	if err := s.db.First(&stored, "id = ?", share.ID).Error; err != nil || stored.BranchName != "feature-x" || stored.Note != "Acme" {
+		t.Errorf("stored share = %+v, %v", stored, err)
+	}
+
+	// The proxy routes share roles to their branch
+	p := &proxy{service: s}
+	if routed, err := p.routeBranch("", map[string]string{"user": share.User}); err != nil || routed.ID != branch.ID {
+		t.Errorf("routeBranch() of the share user = %v, %v, want the branch", routed, err)
+	}
+
+	// A failed drop keeps the share active
+	sqlErr = errors.New("exit status 3")
+	if _, err := s.RevokeShare(context.Background(), share.ID, "u2"); err == nil {
+		t.Error("RevokeShare() succeeded although the role wasn't dropped")
+	}
+	sqlErr = nil
+	revoked, err := s.RevokeShare(context.Background(), share.ID, "u2")
+	if err != nil {
+		t.Fatalf("RevokeShare() error = %v", err)
+	}
+	if revoked.RevokedAt == nil || revoked.RevokedByID != "u2" || !strings.Contains(ran[len(ran)-1], "DROP ROLE "+share.User) {
+		t.Errorf("revoked share = %+v, last SQL %q", revoked, ran[len(ran)-1])
+	}
+	if _, err := s.RevokeShare(context.Background(), share.ID, "u2"); !errors.Is(err, ErrShareRevoked) {
+		t.Errorf("RevokeShare() again error = %v, want ErrShareRevoked", err)
+	}
+	if _, err := p.routeBranch("", map[string]string{"user": share.User}); !errors.Is(err, ErrNoBranchRoute) {
+		t.Errorf("routeBranch() of a revoked share user error = %v, want ErrNoBranchRoute", err)
+	}
+
+	// Expired shares are revoked by the janitor, without a revoking user
+	expired := models.BranchShare{BranchID: branch.ID, BranchName: branch.Name, User: "share_expired", ExpiresAt: time.Now().Add(-time.Minute)}
+	active := models.BranchShare{BranchID: branch.ID, BranchName: branch.Name, User: "share_active", ExpiresAt: time.Now().Add(time.Hour)}
+	s.db.Create(&expired)
+	s.db.Create(&active)
+	if err := s.RevokeExpiredShares(context.Background()); err != nil {
+		t.Fatalf("RevokeExpiredShares() error = %v", err)
+	}
+	s.db.First(&expired, "id = ?", expired.ID)
+	s.db.First(&active, "id = ?", active.ID)
+	if expired.RevokedAt == nil || expired.RevokedByID != "" || active.RevokedAt != nil {
+		t.Errorf("after janitor: expired revoked at %v by %q, active revoked at %v", expired.RevokedAt, expired.RevokedByID, active.RevokedAt)
+	}
+}
@@ -0,0 +1,56 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// smokeDatasetPrefix names the clone of SmokeTest, which isn't mounted and never becomes a branch
+const smokeDatasetPrefix = "branchd-smoke-"
+
+// runZFS runs a zfs command as root, returning its output (replaced in tests)
+var runZFS = func(ctx context.Context, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, "sudo", append([]string{"zfs"}, args...)...).CombinedOutput()
+}
+
+// SmokeTest snapshots and clones the dataset of the latest ready restore as creating a branch does, then destroys both
+// The update script runs it with the new release (branchd-server --smoke-test) and rolls back if it fails
+// Nothing is started or recorded, and without a ready restore there's nothing to clone and it passes
+func (s *Service) SmokeTest(ctx context.Context) error {
+	restore, err := s.findSourceRestore("")
+	if err != nil {
+		if errors.Is(err, ErrNoReadyRestore) {
+			s.logger.Info().Msg("No ready restore, skipping the branch smoke test")
+			return nil
+		}
+		return err
+	}
+
+	suffix := fmt.Sprintf("%d", time.Now().Unix())
+	snapshot := fmt.Sprintf("%s@%s%s", s.config.Storage.DatasetName(restore.Name), smokeDatasetPrefix, suffix)
+	clone := s.config.Storage.DatasetName(smokeDatasetPrefix + suffix)
+
+	if output, err := runZFS(ctx, "snapshot", snapshot); err != nil {
+		return fmt.Errorf("failed to snapshot restore %s: %s", restore.Name, strings.TrimSpace(string(output)))
+	}
+	// The snapshot can only be destroyed once its clone is gone
+	defer func() {
+		if output, err := runZFS(context.Background(), "destroy", snapshot); err != nil {
+			s.logger.Warn().Str("snapshot", snapshot).Str("output", strings.TrimSpace(string(output))).Msg("Failed to destroy smoke test snapshot")
+		}
+	}()
+
+	if output, err := runZFS(ctx, "clone", "-o", "canmount=off", "-o", "mountpoint=none", snapshot, clone); err != nil {
+		return fmt.Errorf("failed to clone restore %s: %s", restore.Name, strings.TrimSpace(string(output)))
+	}
+	if output, err := runZFS(ctx, "destroy", clone); err != nil {
+		return fmt.Errorf("failed to destroy clone %s: %s", clone, strings.TrimSpace(string(output)))
+	}
+
+	s.logger.Info().Str("restore_name", restore.Name).Msg("Branch smoke test passed")
+	return nil
+}
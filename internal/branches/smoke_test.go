@@ -0,0 +1,81 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// stubZFS records zfs commands, failing those starting with failing
+func stubZFS(t *testing.T, failing string) *[]string {
+	t.Helper()
+	original := runZFS
+	t.Cleanup(func() { runZFS = original })
+
+	var commands []string
+	runZFS = func(ctx context.Context, args ...string) ([]byte, error) {
+		command := strings.Join(args, " ")
+		commands = append(commands, command)
+		if failing != "" && strings.HasPrefix(command, failing) {
+			return []byte("cannot create snapshots: out of space"), errors.New("exit status 1")
+		}
+		return nil, nil
+	}
+	return &commands
+}
+
+func TestSmokeTestClonesLatestRestore(t *testing.T) {
+	s, restore := newTestService(t)
+	s.config = &config.Config{Storage: config.StorageConfig{DatasetRoot: "tank"}}
+	commands := stubZFS(t, "")
+
+	if err := s.SmokeTest(context.Background()); err != nil {
+		t.Fatalf("SmokeTest() error = %v", err)
+	}
+	if len(*commands) != 4 {
+		t.Fatalf("zfs commands = %v, want snapshot, clone and two destroys", *commands)
+	}
+	snapshot := strings.TrimPrefix((*commands)[0], "snapshot ")
+	if !strings.HasPrefix(snapshot, "tank/"+restore.Name+"@"+smokeDatasetPrefix) {
+		t.Errorf("snapshot = %q, want one of restore %s", snapshot, restore.Name)
+	}
+	if !strings.HasPrefix((*commands)[1], "clone -o canmount=off -o mountpoint=none "+snapshot+" tank/"+smokeDatasetPrefix) {
+		t.Errorf("clone = %q", (*commands)[1])
+	}
+	// The clone is destroyed before its snapshot
+	if !strings.HasPrefix((*commands)[2], "destroy tank/"+smokeDatasetPrefix) || (*commands)[3] != "destroy "+snapshot {
+		t.Errorf("destroys = %v", (*commands)[2:])
+	}
+}
+
+func TestSmokeTestFailsWhenCloneFails(t *testing.T) {
+	s, _ := newTestService(t)
+	s.config = &config.Config{Storage: config.StorageConfig{DatasetRoot: "tank"}}
+	commands := stubZFS(t, "clone")
+
+	err := s.SmokeTest(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "out of space") {
+		t.Fatalf("SmokeTest() error = %v, want the clone's output", err)
+	}
+	if last := (*commands)[len(*commands)-1]; !strings.HasPrefix(last, "destroy tank/restore_") {
+		t.Errorf("zfs commands = %v, want the snapshot destroyed", *commands)
+	}
+}
+
+func TestSmokeTestPassesWithoutRestore(t *testing.T) {
+	s, restore := newTestService(t)
+	if err := s.db.Delete(restore).Error; err != nil {
+		t.Fatalf("failed to delete restore: %v", err)
+	}
+	commands := stubZFS(t, "")
+
+	if err := s.SmokeTest(context.Background()); err != nil {
+		t.Fatalf("SmokeTest() error = %v", err)
+	}
+	if len(*commands) != 0 {
+		t.Errorf("zfs commands = %v, want nothing cloned", *commands)
+	}
+}
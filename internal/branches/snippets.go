@@ -0,0 +1,143 @@
+package branches
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Snippet formats supported by RenderSnippets
+const (
+	SnippetPsql   = "psql"
+	SnippetRails  = "rails"
+	SnippetPrisma = "prisma"
+	SnippetDjango = "django"
+	SnippetJDBC   = "jdbc"
+)
+
+// SnippetFormats lists all supported snippet formats in display order
+var SnippetFormats = []string{SnippetPsql, SnippetRails, SnippetPrisma, SnippetDjango, SnippetJDBC}
+
+// ConnectionInfo contains the connection details needed to render snippets
+type ConnectionInfo struct {
+	User     string
+	Password string
+	Host     string
+	Port     int
+	Database string
+}
+
+// URL returns the PostgreSQL connection URL (branches only accept SSL connections)
+// User, password and database are escaped, generated passwords may contain any character
+func (c ConnectionInfo) URL() string {
+	u := url.URL{
+		Scheme:   "postgresql",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		Path:     "/" + c.Database,
+		RawQuery: "sslmode=require",
+	}
+	return u.String()
+}
+
+// ParseSnippetFormats parses a comma-separated list of snippet formats
+// Empty input or "all" anywhere in the list selects every supported format
+func ParseSnippetFormats(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return SnippetFormats, nil
+	}
+
+	var formats []string
+	all := false
+	seen := make(map[string]bool)
+	for _, format := range strings.Split(value, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == "all" {
+			all = true
+			continue
+		}
+		if format == "" || seen[format] {
+			continue
+		}
+		if !isSnippetFormat(format) {
+			return nil, fmt.Errorf("unsupported snippet format '%s', must be one of: %s, all", format, strings.Join(SnippetFormats, ", "))
+		}
+		seen[format] = true
+		formats = append(formats, format)
+	}
+
+	if all {
+		return SnippetFormats, nil
+	}
+	return formats, nil
+}
+
+// RenderSnippets renders copy-paste-ready configuration for each requested format
+func RenderSnippets(info ConnectionInfo, formats []string) map[string]string {
+	snippets := make(map[string]string, len(formats))
+	for _, format := range formats {
+		if snippet, ok := renderSnippet(info, format); ok {
+			snippets[format] = snippet
+		}
+	}
+	return snippets
+}
+
+func isSnippetFormat(format string) bool {
+	for _, f := range SnippetFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func renderSnippet(info ConnectionInfo, format string) (string, bool) {
+	switch format {
+	case SnippetPsql:
+		return fmt.Sprintf(`psql "%s"`, info.URL()), true
+
+	case SnippetRails:
+		return fmt.Sprintf(`development:
+  adapter: postgresql
+  host: %s
+  port: %d
+  database: %s
+  username: %s
+  password: %s
+  sslmode: require
+`, yamlQuote(info.Host), info.Port, yamlQuote(info.Database), yamlQuote(info.User), yamlQuote(info.Password)), true
+
+	case SnippetPrisma:
+		return fmt.Sprintf(`DATABASE_URL="%s"`, info.URL()), true
+
+	case SnippetDjango:
+		return fmt.Sprintf(`DATABASES = {
+    "default": {
+        "ENGINE": "django.db.backends.postgresql",
+        "HOST": %s,
+        "PORT": "%d",
+        "NAME": %s,
+        "USER": %s,
+        "PASSWORD": %s,
+        "OPTIONS": {"sslmode": "require"},
+    }
+}
+`, strconv.Quote(info.Host), info.Port, strconv.Quote(info.Database), strconv.Quote(info.User), strconv.Quote(info.Password)), true
+
+	case SnippetJDBC:
+		return fmt.Sprintf("jdbc:postgresql://%s/%s?user=%s&password=%s&sslmode=require",
+			net.JoinHostPort(info.Host, strconv.Itoa(info.Port)), url.PathEscape(info.Database),
+			url.QueryEscape(info.User), url.QueryEscape(info.Password)), true
+	}
+
+	return "", false
+}
+
+// yamlQuote returns s as a single-quoted YAML scalar, so values like "#secret" or "a: b" stay strings
+func yamlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,170 @@
+package branches
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// CreatorCount is the number of branches a user created from a restore
+type CreatorCount struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Count  int    `json:"count"`
+}
+
+// RestoreFanOut summarizes the branches created from one restore
+type RestoreFanOut struct {
+	RestoreID       string         `json:"restore_id"`
+	RestoreName     string         `json:"restore_name"`
+	RestoreDeleted  bool           `json:"restore_deleted"`
+	BranchesCreated int            `json:"branches_created"`
+	ActiveBranches  int            `json:"active_branches"`
+	Creators        []CreatorCount `json:"creators"`
+	FirstBranchAt   *time.Time     `json:"first_branch_at"`
+	LastBranchAt    *time.Time     `json:"last_branch_at"`
+}
+
+// FanOutStats aggregates branch creations over all restores (newest restore first)
+// Only branches created since creations were tracked are counted
+type FanOutStats struct {
+	Restores                  []RestoreFanOut `json:"restores"`
+	TotalBranchesCreated      int             `json:"total_branches_created"`
+	RestoresNeverBranched     int             `json:"restores_never_branched"`
+	AverageBranchesPerRestore float64         `json:"average_branches_per_restore"`
+}
+
+// recordBranchCreation stores the creation in the branch history (best effort)
+func (s *Service) recordBranchCreation(branch *models.Branch, restore *models.Restore) {
+	creation := models.BranchCreation{
+		RestoreID:   restore.ID,
+		RestoreName: restore.Name,
+		BranchID:    branch.ID,
+		BranchName:  branch.Name,
+		CreatedByID: branch.CreatedByID,
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", branch.CreatedByID).First(&user).Error; err == nil {
+		creation.CreatedByEmail = user.Email
+	}
+
+	if err := s.db.Create(&creation).Error; err != nil {
+		s.logger.Warn().Err(err).Str("branch_id", branch.ID).Msg("Failed to record branch creation (non-fatal)")
+	}
+}
+
+// FanOutStats returns branch creation statistics for all restores
+func (s *Service) FanOutStats() (*FanOutStats, error) {
+	// Clones are never branched from, so they'd only skew the averages
+	var restores []models.Restore
+	if err := s.db.Where("ready_at IS NOT NULL AND cloned_from_id = ''").Find(&restores).Error; err != nil {
+		return nil, fmt.Errorf("failed to load restores: %w", err)
+	}
+
+	var creations []models.BranchCreation
+	if err := s.db.Order("created_at ASC").Find(&creations).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branch creations: %w", err)
+	}
+
+	var branches []models.Branch
+	if err := s.db.Select("id", "restore_id").Find(&branches).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branches: %w", err)
+	}
+
+	return buildFanOutStats(restores, creations, branches), nil
+}
+
+// RestoreFanOut returns branch creation statistics for one restore (nil if it is unknown)
+func (s *Service) RestoreFanOut(restoreID string) (*RestoreFanOut, error) {
+	stats, err := s.FanOutStats()
+	if err != nil {
+		return nil, err
+	}
+	for i := range stats.Restores {
+		if stats.Restores[i].RestoreID == restoreID {
+			return &stats.Restores[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// buildFanOutStats aggregates creations per restore
+// Restores that still exist are included even if they were never branched from
+func buildFanOutStats(restores []models.Restore, creations []models.BranchCreation, branches []models.Branch) *FanOutStats {
+	byRestore := map[string]*RestoreFanOut{}
+	get := func(id, name string) *RestoreFanOut {
+		if fanOut, ok := byRestore[id]; ok {
+			return fanOut
+		}
+		fanOut := &RestoreFanOut{RestoreID: id, RestoreName: name, RestoreDeleted: true, Creators: []CreatorCount{}}
+		byRestore[id] = fanOut
+		return fanOut
+	}
+
+	for _, restore := range restores {
+		get(restore.ID, restore.Name).RestoreDeleted = false
+	}
+
+	creators := map[string]map[string]*CreatorCount{}
+	for _, creation := range creations {
+		fanOut := get(creation.RestoreID, creation.RestoreName)
+		fanOut.BranchesCreated++
+
+		createdAt := creation.CreatedAt
+		if fanOut.FirstBranchAt == nil || createdAt.Before(*fanOut.FirstBranchAt) {
+			fanOut.FirstBranchAt = &createdAt
+		}
+		if fanOut.LastBranchAt == nil || createdAt.After(*fanOut.LastBranchAt) {
+			fanOut.LastBranchAt = &createdAt
+		}
+
+		if creators[creation.RestoreID] == nil {
+			creators[creation.RestoreID] = map[string]*CreatorCount{}
+		}
+		creator, ok := creators[creation.RestoreID][creation.CreatedByID]
+		if !ok {
+			creator = &CreatorCount{UserID: creation.CreatedByID, Email: creation.CreatedByEmail}
+			creators[creation.RestoreID][creation.CreatedByID] = creator
+		}
+		creator.Count++
+	}
+
+	for _, branch := range branches {
+		if fanOut, ok := byRestore[branch.RestoreID]; ok {
+			fanOut.ActiveBranches++
+		}
+	}
+
+	stats := &FanOutStats{Restores: make([]RestoreFanOut, 0, len(byRestore))}
+	for id, fanOut := range byRestore {
+		for _, creator := range creators[id] {
+			fanOut.Creators = append(fanOut.Creators, *creator)
+		}
+		sort.Slice(fanOut.Creators, func(i, j int) bool {
+			if fanOut.Creators[i].Count != fanOut.Creators[j].Count {
+				return fanOut.Creators[i].Count > fanOut.Creators[j].Count
+			}
+			return fanOut.Creators[i].Email < fanOut.Creators[j].Email
+		})
+
+		stats.TotalBranchesCreated += fanOut.BranchesCreated
+		if fanOut.BranchesCreated == 0 {
+			stats.RestoresNeverBranched++
+		}
+		stats.Restores = append(stats.Restores, *fanOut)
+	}
+
+	// Restore names embed their creation timestamp (restore_YYYYMMDDHHMMSS)
+	sort.Slice(stats.Restores, func(i, j int) bool {
+		return stats.Restores[i].RestoreName > stats.Restores[j].RestoreName
+	})
+
+	if len(stats.Restores) > 0 {
+		stats.AverageBranchesPerRestore = float64(stats.TotalBranchesCreated) / float64(len(stats.Restores))
+	}
+
+	return stats
+}
@@ -0,0 +1,76 @@
+package branches
+
+import (
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestBuildFanOutStats(t *testing.T) {
+	base := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+	creation := func(restoreID, restoreName, userID, email string, at time.Time) models.BranchCreation {
+		c := models.BranchCreation{
+			RestoreID:      restoreID,
+			RestoreName:    restoreName,
+			CreatedByID:    userID,
+			CreatedByEmail: email,
+		}
+		c.CreatedAt = at
+		return c
+	}
+
+	restores := []models.Restore{
+		{BaseModel: models.BaseModel{ID: "r2"}, Name: "restore_20250102000000"},
+		{BaseModel: models.BaseModel{ID: "r3"}, Name: "restore_20250103000000"},
+	}
+	creations := []models.BranchCreation{
+		creation("r1", "restore_20250101000000", "u1", "a@example.com", base),
+		creation("r2", "restore_20250102000000", "u1", "a@example.com", base.Add(time.Hour)),
+		creation("r2", "restore_20250102000000", "u2", "b@example.com", base.Add(2*time.Hour)),
+		creation("r2", "restore_20250102000000", "u2", "b@example.com", base.Add(3*time.Hour)),
+	}
+	branches := []models.Branch{{RestoreID: "r2"}, {RestoreID: "r2"}}
+
+	stats := buildFanOutStats(restores, creations, branches)
+
+	if stats.TotalBranchesCreated != 4 {
+		t.Errorf("TotalBranchesCreated = %d, want 4", stats.TotalBranchesCreated)
+	}
+	if stats.RestoresNeverBranched != 1 {
+		t.Errorf("RestoresNeverBranched = %d, want 1", stats.RestoresNeverBranched)
+	}
+	if len(stats.Restores) != 3 {
+		t.Fatalf("expected 3 restores, got %d", len(stats.Restores))
+	}
+	if stats.AverageBranchesPerRestore < 1.33 || stats.AverageBranchesPerRestore > 1.34 {
+		t.Errorf("AverageBranchesPerRestore = %f, want 1.33", stats.AverageBranchesPerRestore)
+	}
+
+	order := []string{"r3", "r2", "r1"}
+	for i, id := range order {
+		if stats.Restores[i].RestoreID != id {
+			t.Errorf("Restores[%d] = %s, want %s", i, stats.Restores[i].RestoreID, id)
+		}
+	}
+
+	r3 := stats.Restores[0]
+	if r3.BranchesCreated != 0 || r3.FirstBranchAt != nil || r3.Creators == nil {
+		t.Errorf("unexpected stats for never branched restore: %+v", r3)
+	}
+
+	r2 := stats.Restores[1]
+	if r2.RestoreDeleted || r2.BranchesCreated != 3 || r2.ActiveBranches != 2 {
+		t.Errorf("unexpected stats for r2: %+v", r2)
+	}
+	if len(r2.Creators) != 2 || r2.Creators[0].Email != "b@example.com" || r2.Creators[0].Count != 2 {
+		t.Errorf("unexpected creators for r2: %+v", r2.Creators)
+	}
+	if !r2.FirstBranchAt.Equal(base.Add(time.Hour)) || !r2.LastBranchAt.Equal(base.Add(3*time.Hour)) {
+		t.Errorf("unexpected branch times for r2: %v - %v", r2.FirstBranchAt, r2.LastBranchAt)
+	}
+
+	if !stats.Restores[2].RestoreDeleted {
+		t.Error("expected r1 to be reported as deleted")
+	}
+}
@@ -0,0 +1,231 @@
+package branches
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// resumeReadyTimeout bounds how long a resumed branch may take to accept connections
+const resumeReadyTimeout = 30 * time.Second
+
+// serviceName returns the systemd unit of a branch's PostgreSQL cluster
+func serviceName(branchName string) string {
+	return "branchd-branch-" + branchName
+}
+
+// Cluster commands of suspend and resume, replaced in tests
+var (
+	// systemctl runs a systemctl action (e.g. "disable") on a unit, returning its output
+	systemctl = func(ctx context.Context, action, unit string) ([]byte, error) {
+		return exec.CommandContext(ctx, "sudo", "systemctl", action, "--now", unit).CombinedOutput()
+	}
+
+	// clusterReady reports whether the cluster on port accepts connections
+	clusterReady = func(ctx context.Context, port int) bool {
+		return exec.CommandContext(ctx, "sudo", "-u", "postgres", "pg_isready", "-p", strconv.Itoa(port)).Run() == nil
+	}
+
+	// sampleActivity reads the client connections and transaction count of the cluster on port
+	sampleActivity = clusterActivity
+)
+
+// SuspendIdleBranches records client activity on running branches and suspends
+// branches that had no client connections for idleAfter (0 = only record activity)
+// A branch counts as active while clients are connected or when it ran transactions since the last sample,
+// so sessions shorter than the check interval are seen too
+func (s *Service) SuspendIdleBranches(ctx context.Context, idleAfter time.Duration) error {
+	var running []models.Branch
+	if err := s.db.Where("suspended_at IS NULL AND port > 0").Find(&running).Error; err != nil {
+		return fmt.Errorf("failed to load branches: %w", err)
+	}
+
+	now := time.Now()
+	for _, branch := range running {
+		sample, err := sampleActivity(ctx, branch.Port)
+		if err != nil {
+			// Stopped by hand or still starting, check again on the next run
+			s.logger.Debug().Err(err).Str("branch_name", branch.Name).Msg("Failed to check branch activity")
+			continue
+		}
+
+		// The first sample is only the baseline of the transaction count
+		active := sample.connections > 0 ||
+			(branch.ActivitySampledAt != nil && transactionsRan(branch.TransactionCount, sample.transactions))
+
+		updates := map[string]interface{}{
+			"active_connections":  sample.connections,
+			"transaction_count":   sample.transactions,
+			"activity_sampled_at": now,
+		}
+		if active {
+			updates["last_activity_at"] = now
+		}
+		if err := s.db.Model(&branch).Updates(updates).Error; err != nil {
+			s.logger.Warn().Err(err).Str("branch_name", branch.Name).Msg("Failed to record branch activity")
+		}
+
+		if active || idleAfter == 0 {
+			continue
+		}
+
+		lastActivity := branch.CreatedAt
+		if branch.LastActivityAt != nil {
+			lastActivity = *branch.LastActivityAt
+		}
+		if now.Sub(lastActivity) < idleAfter {
+			continue
+		}
+
+		s.logger.Info().
+			Str("branch_name", branch.Name).
+			Time("last_activity_at", lastActivity).
+			Msg("Suspending idle branch")
+		if err := s.SuspendBranch(ctx, branch.ID); err != nil {
+			s.logger.Error().Err(err).Str("branch_name", branch.Name).Msg("Failed to suspend idle branch")
+		}
+	}
+
+	return nil
+}
+
+// SuspendBranch stops a branch's PostgreSQL cluster until it is resumed
+// The branch keeps its port; a connection attempt resumes it (see StartWaker)
+func (s *Service) SuspendBranch(ctx context.Context, branchID string) error {
+	s.suspendMu.Lock()
+	defer s.suspendMu.Unlock()
+
+	var branch models.Branch
+	if err := s.db.Where("id = ?", branchID).First(&branch).Error; err != nil {
+		return fmt.Errorf("failed to load branch: %w", err)
+	}
+	if branch.SuspendedAt != nil {
+		return nil
+	}
+
+	// Disabled as well, so a reboot doesn't start suspended branches
+	if output, err := systemctl(ctx, "disable", serviceName(branch.Name)); err != nil {
+		return fmt.Errorf("failed to stop branch: %s", strings.TrimSpace(string(output)))
+	}
+
+	if err := s.db.Model(&branch).Updates(map[string]interface{}{
+		"suspended_at":       time.Now(),
+		"status":             BranchStatusStopped,
+		"active_connections": 0,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to mark branch suspended: %w", err)
+	}
+
+	// Take over the port right away when running in the API server
+	if s.waker != nil {
+		s.waker.sync()
+	}
+
+	s.logger.Info().Str("branch_name", branch.Name).Int("port", branch.Port).Msg("Branch suspended")
+	return nil
+}
+
+// ResumeBranch starts a suspended branch's PostgreSQL cluster and waits until it accepts connections
+// Resuming a running branch is a no-op
+func (s *Service) ResumeBranch(ctx context.Context, branchID string) error {
+	s.suspendMu.Lock()
+	defer s.suspendMu.Unlock()
+
+	var branch models.Branch
+	if err := s.db.Where("id = ?", branchID).First(&branch).Error; err != nil {
+		return fmt.Errorf("failed to load branch: %w", err)
+	}
+	if branch.SuspendedAt == nil {
+		return nil
+	}
+
+	// PostgreSQL can't bind the port while the waker listens on it
+	if s.waker != nil {
+		s.waker.release(branch.ID)
+	}
+
+	if output, err := systemctl(ctx, "enable", serviceName(branch.Name)); err != nil {
+		return fmt.Errorf("failed to start branch: %s", strings.TrimSpace(string(output)))
+	}
+
+	deadline := time.Now().Add(resumeReadyTimeout)
+	for {
+		if clusterReady(ctx, branch.Port) {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("branch not ready within %s", resumeReadyTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&branch).Updates(map[string]interface{}{
+		"suspended_at":     nil,
+		"last_activity_at": now,
+		"status":           BranchStatusRunning,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to mark branch resumed: %w", err)
+	}
+
+	s.logger.Info().Str("branch_name", branch.Name).Int("port", branch.Port).Msg("Branch resumed")
+	return nil
+}
+
+// activitySample is the client activity of a branch at one point in time
+type activitySample struct {
+	connections  int   // Client connections, excluding the sample's own
+	transactions int64 // Committed and rolled back transactions since the stats were reset
+}
+
+// clusterActivityQuery counts client connections and the transactions of the databases clients use
+// The postgres database is left out, the samples themselves (and other checks) run there
+const clusterActivityQuery = `SELECT
+  (SELECT count(*) FROM pg_stat_activity WHERE backend_type = 'client backend' AND pid <> pg_backend_pid()),
+  (SELECT COALESCE(sum(xact_commit + xact_rollback), 0) FROM pg_stat_database
+   WHERE datname IS NOT NULL AND datname NOT IN ('postgres', 'template0', 'template1'))`
+
+// clusterActivity samples the client activity of a branch's cluster
+func clusterActivity(ctx context.Context, port int) (activitySample, error) {
+	cmd := exec.CommandContext(ctx, "sudo", "-u", "postgres", "psql", "-p", strconv.Itoa(port), "-d", "postgres", "-Atc", clusterActivityQuery)
+	output, err := cmd.Output()
+	if err != nil {
+		return activitySample{}, fmt.Errorf("failed to query pg_stat_activity: %w", err)
+	}
+	return parseActivitySample(string(output))
+}
+
+// parseActivitySample parses the "connections|transactions" row of clusterActivityQuery
+func parseActivitySample(output string) (activitySample, error) {
+	connections, transactions, ok := strings.Cut(strings.TrimSpace(output), "|")
+	if !ok {
+		return activitySample{}, fmt.Errorf("unexpected activity sample %q", strings.TrimSpace(output))
+	}
+	var sample activitySample
+	var err error
+	if sample.connections, err = strconv.Atoi(connections); err != nil {
+		return activitySample{}, fmt.Errorf("invalid connection count %q: %w", connections, err)
+	}
+	if sample.transactions, err = strconv.ParseInt(transactions, 10, 64); err != nil {
+		return activitySample{}, fmt.Errorf("invalid transaction count %q: %w", transactions, err)
+	}
+	return sample, nil
+}
+
+// transactionsRan reports whether transactions ran between two samples of the transaction count
+// A lower count means the cluster restarted (e.g. resumed), any transaction since counts
+func transactionsRan(previous, current int64) bool {
+	if current < previous {
+		return current > 0
+	}
+	return current > previous
+}
@@ -0,0 +1,473 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// fakeCluster stands in for systemctl, pg_isready and psql of branch clusters
+type fakeCluster struct {
+	mu           sync.Mutex
+	calls        []string          // "<action> <unit>" of every systemctl call
+	connections  map[int]int       // Client connections by port, ports without an entry are unreachable
+	transactions map[int]int64     // Transaction count by port (0 without an entry)
+	failAction   string            // systemctl action that fails
+	onEnable     func(unit string) // Runs on a successful "enable", e.g. to start a fake PostgreSQL
+}
+
+// stubClusterCommands replaces the cluster commands with a fake for the test's duration
+func stubClusterCommands(t *testing.T) *fakeCluster {
+	t.Helper()
+	fake := &fakeCluster{connections: map[int]int{}, transactions: map[int]int64{}}
+
+	origSystemctl, origReady, origSample := systemctl, clusterReady, sampleActivity
+	t.Cleanup(func() {
+		systemctl, clusterReady, sampleActivity = origSystemctl, origReady, origSample
+	})
+
+	systemctl = func(ctx context.Context, action, unit string) ([]byte, error) {
+		fake.mu.Lock()
+		fake.calls = append(fake.calls, action+" "+unit)
+		fail, onEnable := fake.failAction == action, fake.onEnable
+		fake.mu.Unlock()
+
+		if fail {
+			return []byte("Failed to " + action + " unit"), errors.New("exit status 1")
+		}
+		if action == "enable" && onEnable != nil {
+			onEnable(unit)
+		}
+		return nil, nil
+	}
+	clusterReady = func(ctx context.Context, port int) bool { return true }
+	sampleActivity = func(ctx context.Context, port int) (activitySample, error) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		n, ok := fake.connections[port]
+		if !ok {
+			return activitySample{}, fmt.Errorf("connection refused on port %d", port)
+		}
+		return activitySample{connections: n, transactions: fake.transactions[port]}, nil
+	}
+	return fake
+}
+
+func (f *fakeCluster) systemctlCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// loadBranch reloads a branch from the database
+func loadBranch(t *testing.T, s *Service, id string) models.Branch {
+	t.Helper()
+	var branch models.Branch
+	if err := s.db.First(&branch, "id = ?", id).Error; err != nil {
+		t.Fatalf("failed to load branch %s: %v", id, err)
+	}
+	return branch
+}
+
+// freePort returns a TCP port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestSuspendIdleBranches(t *testing.T) {
+	s, restore := newTestService(t)
+	fake := stubClusterCommands(t)
+
+	hoursAgo := func(h int) *time.Time {
+		at := time.Now().Add(-time.Duration(h) * time.Hour)
+		return &at
+	}
+	active := &models.Branch{Name: "active", RestoreID: restore.ID, Port: 6001, LastActivityAt: hoursAgo(5)}
+	idle := &models.Branch{Name: "idle", RestoreID: restore.ID, Port: 6002, LastActivityAt: hoursAgo(3)}
+	recent := &models.Branch{Name: "recent", RestoreID: restore.ID, Port: 6003, LastActivityAt: hoursAgo(1)}
+	neverUsed := &models.Branch{Name: "never-used", RestoreID: restore.ID, Port: 6004}
+	unreachable := &models.Branch{Name: "unreachable", RestoreID: restore.ID, Port: 6005, LastActivityAt: hoursAgo(5)}
+	suspended := &models.Branch{Name: "suspended", RestoreID: restore.ID, Port: 6006, LastActivityAt: hoursAgo(5), SuspendedAt: hoursAgo(4)}
+	for _, branch := range []*models.Branch{active, idle, recent, neverUsed, unreachable, suspended} {
+		createTestBranch(t, s, branch)
+	}
+	// Created long ago, so idle by its creation time
+	if err := s.db.Model(neverUsed).Update("created_at", *hoursAgo(3)).Error; err != nil {
+		t.Fatalf("failed to backdate branch: %v", err)
+	}
+	fake.connections = map[int]int{6001: 2, 6002: 0, 6003: 0, 6004: 0, 6006: 0}
+
+	if err := s.SuspendIdleBranches(context.Background(), 2*time.Hour); err != nil {
+		t.Fatalf("SuspendIdleBranches() error = %v", err)
+	}
+
+	wantSuspended := map[string]bool{active.ID: false, idle.ID: true, recent.ID: false, neverUsed.ID: true, unreachable.ID: false, suspended.ID: true}
+	for id, want := range wantSuspended {
+		branch := loadBranch(t, s, id)
+		if got := branch.SuspendedAt != nil; got != want {
+			t.Errorf("branch %s suspended = %v, want %v", branch.Name, got, want)
+		}
+	}
+
+	if got := loadBranch(t, s, active.ID).LastActivityAt; got == nil || time.Since(*got) > time.Minute {
+		t.Errorf("active branch last_activity_at = %v, want now", got)
+	}
+	if got := loadBranch(t, s, idle.ID).Status; got != BranchStatusStopped {
+		t.Errorf("idle branch status = %q, want %q", got, BranchStatusStopped)
+	}
+
+	calls := fake.systemctlCalls()
+	want := map[string]bool{"disable branchd-branch-idle": true, "disable branchd-branch-never-used": true}
+	if len(calls) != len(want) {
+		t.Fatalf("systemctl calls = %v, want %d disables", calls, len(want))
+	}
+	for _, call := range calls {
+		if !want[call] {
+			t.Errorf("unexpected systemctl call %q", call)
+		}
+	}
+}
+
+func TestSuspendIdleBranchesRecordOnly(t *testing.T) {
+	s, restore := newTestService(t)
+	fake := stubClusterCommands(t)
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+	active := &models.Branch{Name: "active", RestoreID: restore.ID, Port: 6001, LastActivityAt: &longAgo}
+	idle := &models.Branch{Name: "idle", RestoreID: restore.ID, Port: 6002, LastActivityAt: &longAgo}
+	for _, branch := range []*models.Branch{active, idle} {
+		createTestBranch(t, s, branch)
+	}
+	fake.connections = map[int]int{6001: 1, 6002: 0}
+
+	if err := s.SuspendIdleBranches(context.Background(), 0); err != nil {
+		t.Fatalf("SuspendIdleBranches() error = %v", err)
+	}
+
+	if got := loadBranch(t, s, active.ID).LastActivityAt; got == nil || time.Since(*got) > time.Minute {
+		t.Errorf("active branch last_activity_at = %v, want now", got)
+	}
+	if calls := fake.systemctlCalls(); len(calls) != 0 {
+		t.Errorf("systemctl calls = %v, want none without auto-suspend", calls)
+	}
+}
+
+func TestSuspendIdleBranchesTransactions(t *testing.T) {
+	s, restore := newTestService(t)
+	fake := stubClusterCommands(t)
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+	busy := &models.Branch{Name: "busy", RestoreID: restore.ID, Port: 6001, LastActivityAt: &longAgo}
+	quiet := &models.Branch{Name: "quiet", RestoreID: restore.ID, Port: 6002, LastActivityAt: &longAgo}
+	for _, branch := range []*models.Branch{busy, quiet} {
+		createTestBranch(t, s, branch)
+	}
+	fake.connections = map[int]int{6001: 0, 6002: 0}
+	fake.transactions = map[int]int64{6001: 100, 6002: 50}
+
+	// The first sample is only a baseline
+	if err := s.SuspendIdleBranches(context.Background(), 0); err != nil {
+		t.Fatalf("SuspendIdleBranches() error = %v", err)
+	}
+	got := loadBranch(t, s, busy.ID)
+	if got.ActivitySampledAt == nil || got.TransactionCount != 100 || got.ActiveConnections != 0 {
+		t.Errorf("busy branch sampled_at = %v, transactions = %d, connections = %d, want sampled with 100 transactions",
+			got.ActivitySampledAt, got.TransactionCount, got.ActiveConnections)
+	}
+	if got.LastActivityAt == nil || time.Since(*got.LastActivityAt) < time.Hour {
+		t.Errorf("busy branch last_activity_at = %v, want unchanged by the baseline sample", got.LastActivityAt)
+	}
+
+	// A session between two samples ran transactions on busy
+	fake.transactions[6001] = 103
+	if err := s.SuspendIdleBranches(context.Background(), 2*time.Hour); err != nil {
+		t.Fatalf("SuspendIdleBranches() error = %v", err)
+	}
+	got = loadBranch(t, s, busy.ID)
+	if got.LastActivityAt == nil || time.Since(*got.LastActivityAt) > time.Minute {
+		t.Errorf("busy branch last_activity_at = %v, want now", got.LastActivityAt)
+	}
+	if got.SuspendedAt != nil {
+		t.Error("busy branch suspended although it ran transactions")
+	}
+	got = loadBranch(t, s, quiet.ID)
+	if got.SuspendedAt == nil || got.ActiveConnections != 0 {
+		t.Errorf("quiet branch suspended_at = %v, connections = %d, want suspended", got.SuspendedAt, got.ActiveConnections)
+	}
+}
+
+func TestParseActivitySample(t *testing.T) {
+	got, err := parseActivitySample("3|12345\n")
+	if err != nil {
+		t.Fatalf("parseActivitySample() error = %v", err)
+	}
+	if got != (activitySample{connections: 3, transactions: 12345}) {
+		t.Errorf("parseActivitySample() = %+v, want 3 connections and 12345 transactions", got)
+	}
+
+	for _, output := range []string{"", "3", "x|1", "1|x"} {
+		if _, err := parseActivitySample(output); err == nil {
+			t.Errorf("parseActivitySample(%q) succeeded, want error", output)
+		}
+	}
+}
+
+func TestTransactionsRan(t *testing.T) {
+	tests := []struct {
+		previous, current int64
+		want              bool
+	}{
+		{previous: 10, current: 10, want: false},
+		{previous: 10, current: 12, want: true},
+		{previous: 10, current: 0, want: false}, // Restarted, nothing ran since
+		{previous: 10, current: 4, want: true},  // Restarted, then used
+	}
+	for _, tt := range tests {
+		if got := transactionsRan(tt.previous, tt.current); got != tt.want {
+			t.Errorf("transactionsRan(%d, %d) = %v, want %v", tt.previous, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestSuspendBranch(t *testing.T) {
+	s, restore := newTestService(t)
+	fake := stubClusterCommands(t)
+
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001, Status: BranchStatusRunning}
+	createTestBranch(t, s, branch)
+
+	fake.failAction = "disable"
+	if err := s.SuspendBranch(context.Background(), branch.ID); err == nil {
+		t.Fatal("SuspendBranch() succeeded although systemctl failed")
+	}
+	if loadBranch(t, s, branch.ID).SuspendedAt != nil {
+		t.Error("branch marked suspended although systemctl failed")
+	}
+
+	fake.failAction = ""
+	if err := s.SuspendBranch(context.Background(), branch.ID); err != nil {
+		t.Fatalf("SuspendBranch() error = %v", err)
+	}
+	got := loadBranch(t, s, branch.ID)
+	if got.SuspendedAt == nil || got.Status != BranchStatusStopped {
+		t.Errorf("branch suspended_at = %v, status = %q, want suspended and %q", got.SuspendedAt, got.Status, BranchStatusStopped)
+	}
+
+	// Suspending again doesn't touch the cluster
+	if err := s.SuspendBranch(context.Background(), branch.ID); err != nil {
+		t.Fatalf("SuspendBranch() again error = %v", err)
+	}
+	if calls := fake.systemctlCalls(); len(calls) != 2 {
+		t.Errorf("systemctl calls = %v, want the failed and the successful disable only", calls)
+	}
+}
+
+func TestResumeBranch(t *testing.T) {
+	s, restore := newTestService(t)
+	fake := stubClusterCommands(t)
+
+	suspendedAt := time.Now().Add(-time.Hour)
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001, Status: BranchStatusStopped, SuspendedAt: &suspendedAt}
+	running := &models.Branch{Name: "running", RestoreID: restore.ID, Port: 6002, Status: BranchStatusRunning}
+	createTestBranch(t, s, branch)
+	createTestBranch(t, s, running)
+
+	fake.failAction = "enable"
+	if err := s.ResumeBranch(context.Background(), branch.ID); err == nil {
+		t.Fatal("ResumeBranch() succeeded although systemctl failed")
+	}
+	if loadBranch(t, s, branch.ID).SuspendedAt == nil {
+		t.Error("branch marked resumed although systemctl failed")
+	}
+
+	fake.failAction = ""
+	if err := s.ResumeBranch(context.Background(), branch.ID); err != nil {
+		t.Fatalf("ResumeBranch() error = %v", err)
+	}
+	got := loadBranch(t, s, branch.ID)
+	if got.SuspendedAt != nil || got.Status != BranchStatusRunning {
+		t.Errorf("branch suspended_at = %v, status = %q, want resumed and %q", got.SuspendedAt, got.Status, BranchStatusRunning)
+	}
+	if got.LastActivityAt == nil || time.Since(*got.LastActivityAt) > time.Minute {
+		t.Errorf("branch last_activity_at = %v, want now", got.LastActivityAt)
+	}
+
+	// Resuming a running branch doesn't touch the cluster
+	if err := s.ResumeBranch(context.Background(), running.ID); err != nil {
+		t.Fatalf("ResumeBranch(running) error = %v", err)
+	}
+	if calls := fake.systemctlCalls(); len(calls) != 2 {
+		t.Errorf("systemctl calls = %v, want the failed and the successful enable only", calls)
+	}
+}
+
+func TestResumeBranchWaitsUntilReady(t *testing.T) {
+	s, restore := newTestService(t)
+	stubClusterCommands(t)
+
+	checks := 0
+	clusterReady = func(ctx context.Context, port int) bool {
+		checks++
+		return checks > 1
+	}
+
+	suspendedAt := time.Now()
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6001, SuspendedAt: &suspendedAt}
+	createTestBranch(t, s, branch)
+
+	// Canceled while waiting for the cluster, so the branch stays suspended
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.ResumeBranch(ctx, branch.ID); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ResumeBranch() error = %v, want context.Canceled", err)
+	}
+	if loadBranch(t, s, branch.ID).SuspendedAt == nil {
+		t.Error("branch marked resumed before its cluster was ready")
+	}
+
+	if err := s.ResumeBranch(context.Background(), branch.ID); err != nil {
+		t.Fatalf("ResumeBranch() error = %v", err)
+	}
+	if loadBranch(t, s, branch.ID).SuspendedAt != nil {
+		t.Error("branch still suspended after its cluster became ready")
+	}
+}
+
+func TestWakerResumesBranchOnConnection(t *testing.T) {
+	s, restore := newTestService(t)
+	fake := stubClusterCommands(t)
+
+	port := freePort(t)
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: port, Status: BranchStatusRunning}
+	createTestBranch(t, s, branch)
+
+	// Starting the cluster binds the branch's port with an echo server
+	started := make(chan net.Listener, 1)
+	fake.onEnable = func(unit string) {
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Errorf("cluster failed to bind port %d: %v", port, err)
+			return
+		}
+		started <- ln
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					io.Copy(conn, conn)
+				}()
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartWaker(ctx)
+
+	if err := s.SuspendBranch(ctx, branch.ID); err != nil {
+		t.Fatalf("SuspendBranch() error = %v", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to suspended branch: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// The held connection is proxied to the resumed cluster
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(reply) != "ping" {
+		t.Errorf("reply = %q, want %q", reply, "ping")
+	}
+
+	ln := <-started
+	defer ln.Close()
+	if loadBranch(t, s, branch.ID).SuspendedAt != nil {
+		t.Error("branch still suspended after a connection")
+	}
+	s.waker.mu.Lock()
+	listening := len(s.waker.listeners)
+	s.waker.mu.Unlock()
+	if listening != 0 {
+		t.Errorf("waker listens on %d ports after resume, want 0", listening)
+	}
+}
+
+func TestWakerSync(t *testing.T) {
+	s, restore := newTestService(t)
+
+	suspendedAt := time.Now()
+	branch := &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: freePort(t), SuspendedAt: &suspendedAt}
+	createTestBranch(t, s, branch)
+
+	// Bound by something else, e.g. PostgreSQL still shutting down
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	busyBranch := &models.Branch{Name: "busy", RestoreID: restore.ID, Port: busy.Addr().(*net.TCPAddr).Port, SuspendedAt: &suspendedAt}
+	createTestBranch(t, s, busyBranch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.StartWaker(ctx)
+
+	listening := func() map[string]bool {
+		s.waker.mu.Lock()
+		defer s.waker.mu.Unlock()
+		ids := map[string]bool{}
+		for id := range s.waker.listeners {
+			ids[id] = true
+		}
+		return ids
+	}
+
+	if got := listening(); !got[branch.ID] || got[busyBranch.ID] {
+		t.Fatalf("listening on %v, want only %s", got, branch.ID)
+	}
+
+	// Freed ports are picked up on the next sync
+	busy.Close()
+	s.waker.lockedSync()
+	if got := listening(); !got[busyBranch.ID] {
+		t.Errorf("not listening on %s after its port was freed", busyBranch.Name)
+	}
+
+	// Branches resumed elsewhere (or deleted) release their port
+	if err := s.db.Model(branch).Update("suspended_at", nil).Error; err != nil {
+		t.Fatalf("failed to resume branch: %v", err)
+	}
+	s.waker.lockedSync()
+	if got := listening(); got[branch.ID] {
+		t.Errorf("still listening on %s after it was resumed", branch.Name)
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", branch.Port))
+	if err != nil {
+		t.Fatalf("port of resumed branch not released: %v", err)
+	}
+	ln.Close()
+}
@@ -0,0 +1,86 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+var ErrTemplateNotFound = errors.New("branch template not found")
+
+// resolveTemplate loads the params' template and applies its resources and hba rules when none were requested
+func (s *Service) resolveTemplate(params *CreateBranchParams) error {
+	if params.Template == "" {
+		return nil
+	}
+
+	var branchTemplate models.BranchTemplate
+	if err := s.db.Where("name = ?", params.Template).First(&branchTemplate).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("%w: %s", ErrTemplateNotFound, params.Template)
+		}
+		return fmt.Errorf("failed to load branch template: %w", err)
+	}
+	params.branchTemplate = &branchTemplate
+
+	if params.ResourceLimits == (models.BranchResourceLimits{}) {
+		params.ResourceLimits = branchTemplate.ResourceLimits
+	}
+	if len(params.HBARules) == 0 {
+		params.HBARules = branchTemplate.HBARules
+	}
+	return nil
+}
+
+// branchPostgresqlConf returns the custom settings of a new branch: the config's, then its template's
+// postgresql.conf keeps the last value of a setting, so the template's override the config's
+func branchPostgresqlConf(config *models.Config, params CreateBranchParams) string {
+	if params.branchTemplate == nil || strings.TrimSpace(params.branchTemplate.PostgresqlConf) == "" {
+		return config.BranchPostgresqlConf
+	}
+	return config.BranchPostgresqlConf + "\n" + params.branchTemplate.PostgresqlConf
+}
+
+// branchExpiry returns when a new branch is deleted, nil unless its template has a TTL
+func branchExpiry(params CreateBranchParams, now time.Time) *time.Time {
+	if params.branchTemplate == nil || params.branchTemplate.TTLHours <= 0 {
+		return nil
+	}
+	expiresAt := now.Add(time.Duration(params.branchTemplate.TTLHours) * time.Hour)
+	return &expiresAt
+}
+
+// DeleteExpiredBranches deletes the branches whose template TTL has passed
+func (s *Service) DeleteExpiredBranches(ctx context.Context) error {
+	expired, err := s.expiredBranches(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, branch := range expired {
+		s.logger.Info().
+			Str("branch_name", branch.Name).
+			Str("template", branch.Template).
+			Time("expires_at", *branch.ExpiresAt).
+			Msg("Deleting expired branch")
+		if err := s.DeleteBranch(ctx, DeleteBranchParams{BranchName: branch.Name}); err != nil {
+			s.logger.Error().Err(err).Str("branch_name", branch.Name).Msg("Failed to delete expired branch")
+		}
+	}
+	return nil
+}
+
+// expiredBranches returns the branches with an expiry before now
+func (s *Service) expiredBranches(now time.Time) ([]models.Branch, error) {
+	var expired []models.Branch
+	if err := s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Order("expires_at ASC").Find(&expired).Error; err != nil {
+		return nil, fmt.Errorf("failed to load expired branches: %w", err)
+	}
+	return expired, nil
+}
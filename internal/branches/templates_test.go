@@ -0,0 +1,76 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestResolveTemplate(t *testing.T) {
+	s, _ := newTestService(t)
+	ciSmall := models.BranchTemplate{
+		Name:           "ci-small",
+		ResourceLimits: models.BranchResourceLimits{CPUCores: 1, MemoryMB: 512},
+		PostgresqlConf: "work_mem = 8MB",
+		TTLHours:       6,
+	}
+	if err := s.db.Create(&ciSmall).Error; err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+
+	params := CreateBranchParams{BranchName: "ci-123", Template: "ci-small"}
+	if err := s.resolveTemplate(&params); err != nil {
+		t.Fatalf("resolveTemplate() error = %v", err)
+	}
+	if params.ResourceLimits != ciSmall.ResourceLimits {
+		t.Errorf("resources = %+v, want the template's %+v", params.ResourceLimits, ciSmall.ResourceLimits)
+	}
+	config := &models.Config{BranchPostgresqlConf: "work_mem = 4MB"}
+	if got := branchPostgresqlConf(config, params); got != "work_mem = 4MB\nwork_mem = 8MB" {
+		t.Errorf("branchPostgresqlConf() = %q, want the template's settings after the config's", got)
+	}
+	now := time.Now()
+	if got := branchExpiry(params, now); got == nil || !got.Equal(now.Add(6*time.Hour)) {
+		t.Errorf("branchExpiry() = %v, want 6 hours from now", got)
+	}
+
+	// Requested resources take precedence
+	requested := models.BranchResourceLimits{CPUCores: 4}
+	params = CreateBranchParams{BranchName: "ci-124", Template: "ci-small", ResourceLimits: requested}
+	if err := s.resolveTemplate(&params); err != nil {
+		t.Fatalf("resolveTemplate() error = %v", err)
+	}
+	if params.ResourceLimits != requested {
+		t.Errorf("resources = %+v, want the requested %+v", params.ResourceLimits, requested)
+	}
+
+	params = CreateBranchParams{BranchName: "ci-125"}
+	if err := s.resolveTemplate(&params); err != nil || branchExpiry(params, now) != nil || branchPostgresqlConf(config, params) != config.BranchPostgresqlConf {
+		t.Errorf("resolveTemplate() without template changed the branch (error = %v)", err)
+	}
+
+	_, err := s.CreateBranch(context.Background(), CreateBranchParams{BranchName: "ci-126", CreatedByID: "user-1", Template: "ci-large"})
+	if !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("CreateBranch() with unknown template error = %v, want ErrTemplateNotFound", err)
+	}
+}
+
+func TestExpiredBranches(t *testing.T) {
+	s, restore := newTestService(t)
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	createTestBranch(t, s, &models.Branch{Name: "ci-expired", RestoreID: restore.ID, Port: 6001, Template: "ci-small", ExpiresAt: &past})
+	createTestBranch(t, s, &models.Branch{Name: "ci-running", RestoreID: restore.ID, Port: 6002, Template: "ci-small", ExpiresAt: &future})
+	createTestBranch(t, s, &models.Branch{Name: "feature-x", RestoreID: restore.ID, Port: 6003})
+
+	expired, err := s.expiredBranches(now)
+	if err != nil {
+		t.Fatalf("expiredBranches() error = %v", err)
+	}
+	if len(expired) != 1 || expired[0].Name != "ci-expired" {
+		t.Errorf("expiredBranches() = %v, want only ci-expired", expired)
+	}
+}
@@ -0,0 +1,104 @@
+package branches
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// bootDropInName is the drop-in ordering a branch unit after the ZFS pool import on boot
+const bootDropInName = "10-branchd-boot.conf"
+
+// bootDropIn starts branch clusters only once their datasets can be mounted
+// Units created before boot ordering was part of create-branch.sh only waited for the network
+const bootDropIn = `# Managed by branchd, rewritten on worker start
+[Unit]
+Wants=zfs-import.target
+After=zfs-import.target zfs-mount.service
+`
+
+// Unit file commands, replaced in tests
+var (
+	// readUnitFile returns a file below /etc/systemd/system (nil if it doesn't exist)
+	readUnitFile = func(path string) []byte {
+		content, _ := os.ReadFile(path)
+		return content
+	}
+
+	// writeUnitFile writes a file below /etc/systemd/system as root
+	writeUnitFile = func(ctx context.Context, path string, content []byte) error {
+		if output, err := exec.CommandContext(ctx, "sudo", "mkdir", "-p", filepath.Dir(path)).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to create %s: %s", filepath.Dir(path), strings.TrimSpace(string(output)))
+		}
+		cmd := exec.CommandContext(ctx, "sudo", "tee", path)
+		cmd.Stdin = bytes.NewReader(content)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to write %s: %s", path, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	// daemonReload makes systemd pick up changed unit files
+	daemonReload = func(ctx context.Context) error {
+		return exec.CommandContext(ctx, "sudo", "systemctl", "daemon-reload").Run()
+	}
+)
+
+// bootDropInPath returns the path of a branch unit's boot ordering drop-in
+func bootDropInPath(branchName string) string {
+	return fmt.Sprintf("/etc/systemd/system/%s.service.d/%s", serviceName(branchName), bootDropInName)
+}
+
+// EnsureBranchUnits makes every branch come back after a host reboot: units are ordered after the
+// ZFS pool import and enabled, so systemd starts them on boot
+// Suspended branches stay disabled, they're started by the waker on their first connection
+func (s *Service) EnsureBranchUnits(ctx context.Context) error {
+	var branches []models.Branch
+	if err := s.db.Where("port > 0").Find(&branches).Error; err != nil {
+		return fmt.Errorf("failed to load branches: %w", err)
+	}
+
+	changed := false
+	for _, branch := range branches {
+		path := bootDropInPath(branch.Name)
+		if string(readUnitFile(path)) == bootDropIn {
+			continue
+		}
+		if err := writeUnitFile(ctx, path, []byte(bootDropIn)); err != nil {
+			s.logger.Warn().Err(err).Str("branch_name", branch.Name).Msg("Failed to order branch unit after the ZFS import")
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		if err := daemonReload(ctx); err != nil {
+			return fmt.Errorf("failed to reload systemd: %w", err)
+		}
+	}
+
+	s.suspendMu.Lock()
+	defer s.suspendMu.Unlock()
+
+	for _, branch := range branches {
+		// Reloaded so a branch suspended meanwhile isn't started again
+		var current models.Branch
+		if err := s.db.Select("suspended_at").Where("id = ?", branch.ID).First(&current).Error; err != nil || current.SuspendedAt != nil {
+			continue
+		}
+		// Also starts a unit that failed on boot, e.g. before this ordering was in place
+		if output, err := systemctl(ctx, "enable", serviceName(branch.Name)); err != nil {
+			s.logger.Warn().
+				Err(err).
+				Str("branch_name", branch.Name).
+				Str("output", strings.TrimSpace(string(output))).
+				Msg("Failed to enable branch unit")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package branches
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// stubUnitFiles replaces the unit file commands with an in-memory /etc/systemd/system for the test's duration
+func stubUnitFiles(t *testing.T, files map[string]string) (reloads *int) {
+	t.Helper()
+	origRead, origWrite, origReload := readUnitFile, writeUnitFile, daemonReload
+	t.Cleanup(func() { readUnitFile, writeUnitFile, daemonReload = origRead, origWrite, origReload })
+
+	reloads = new(int)
+	readUnitFile = func(path string) []byte {
+		content, ok := files[path]
+		if !ok {
+			return nil
+		}
+		return []byte(content)
+	}
+	writeUnitFile = func(ctx context.Context, path string, content []byte) error {
+		if path == bootDropInPath("read-only") {
+			return errors.New("read-only file system")
+		}
+		files[path] = string(content)
+		return nil
+	}
+	daemonReload = func(ctx context.Context) error {
+		*reloads++
+		return nil
+	}
+	return reloads
+}
+
+func TestEnsureBranchUnits(t *testing.T) {
+	s, restore := newTestService(t)
+	cluster := stubClusterCommands(t)
+
+	now := time.Now()
+	current := &models.Branch{Name: "current", RestoreID: restore.ID, Port: 6001}
+	legacy := &models.Branch{Name: "legacy", RestoreID: restore.ID, Port: 6002}
+	suspended := &models.Branch{Name: "suspended", RestoreID: restore.ID, Port: 6003, SuspendedAt: &now}
+	readOnly := &models.Branch{Name: "read-only", RestoreID: restore.ID, Port: 6004}
+	notCreated := &models.Branch{Name: "not-created", RestoreID: restore.ID}
+	for _, branch := range []*models.Branch{current, legacy, suspended, readOnly, notCreated} {
+		createTestBranch(t, s, branch)
+	}
+
+	files := map[string]string{bootDropInPath("current"): bootDropIn}
+	reloads := stubUnitFiles(t, files)
+
+	if err := s.EnsureBranchUnits(context.Background()); err != nil {
+		t.Fatalf("EnsureBranchUnits() error = %v", err)
+	}
+
+	// Suspended branches are ordered too, they start on boot once resumed
+	for _, name := range []string{"current", "legacy", "suspended"} {
+		if files[bootDropInPath(name)] != bootDropIn {
+			t.Errorf("branch %s has no boot ordering drop-in", name)
+		}
+	}
+	if _, ok := files[bootDropInPath("not-created")]; ok {
+		t.Error("drop-in written for a branch without cluster")
+	}
+	if *reloads != 1 {
+		t.Errorf("reloaded systemd %d times, want once", *reloads)
+	}
+
+	want := []string{"enable " + serviceName("current"), "enable " + serviceName("legacy"), "enable " + serviceName("read-only")}
+	if got := cluster.systemctlCalls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("systemctl calls = %v, want %v (suspended branches stay disabled)", got, want)
+	}
+
+	// Nothing to write on the next start
+	if err := s.EnsureBranchUnits(context.Background()); err != nil {
+		t.Fatalf("EnsureBranchUnits() error = %v", err)
+	}
+	if *reloads != 1 {
+		t.Errorf("reloaded systemd %d times without changed drop-ins", *reloads)
+	}
+}
@@ -0,0 +1,157 @@
+package branches
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// wakerSyncInterval is how often the waker picks up branches suspended by the worker
+const wakerSyncInterval = 10 * time.Second
+
+// waker listens on the ports of suspended branches and resumes a branch on its first connection
+// The connection is held while the branch starts and then proxied to it, so clients only see a slow connect
+type waker struct {
+	service *Service
+	ctx     context.Context // Lifetime of the waker, resumes triggered by connections use it
+
+	mu        sync.Mutex
+	listeners map[string]net.Listener // By branch ID
+}
+
+// StartWaker takes over the ports of suspended branches until ctx is done
+// Only one process may run the waker (the API server), since it binds the branch ports
+func (s *Service) StartWaker(ctx context.Context) {
+	w := &waker{service: s, ctx: ctx, listeners: map[string]net.Listener{}}
+	s.waker = w
+
+	w.lockedSync()
+	go w.run()
+}
+
+func (w *waker) run() {
+	ticker := time.NewTicker(wakerSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			w.closeAll()
+			return
+		case <-ticker.C:
+			w.lockedSync()
+		}
+	}
+}
+
+// lockedSync runs sync while no suspend or resume is in progress
+// WHY: A resume releases the port before starting PostgreSQL, sync must not grab it back in between
+func (w *waker) lockedSync() {
+	w.service.suspendMu.Lock()
+	defer w.service.suspendMu.Unlock()
+	w.sync()
+}
+
+// sync listens on every suspended branch's port and releases ports of branches that are gone or resumed
+// Callers must hold the service's suspendMu
+func (w *waker) sync() {
+	var suspended []models.Branch
+	if err := w.service.db.Where("suspended_at IS NOT NULL AND port > 0").Find(&suspended).Error; err != nil {
+		w.service.logger.Error().Err(err).Msg("Failed to load suspended branches")
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wanted := make(map[string]bool, len(suspended))
+	for _, branch := range suspended {
+		wanted[branch.ID] = true
+		if _, ok := w.listeners[branch.ID]; ok {
+			continue
+		}
+
+		ln, err := net.Listen("tcp", fmt.Sprintf(":%d", branch.Port))
+		if err != nil {
+			// PostgreSQL may still be shutting down, try again on the next sync
+			w.service.logger.Debug().Err(err).Str("branch_name", branch.Name).Msg("Failed to listen on suspended branch port")
+			continue
+		}
+		w.listeners[branch.ID] = ln
+		go w.accept(branch.ID, branch.Port, ln)
+	}
+
+	for branchID, ln := range w.listeners {
+		if !wanted[branchID] {
+			ln.Close()
+			delete(w.listeners, branchID)
+		}
+	}
+}
+
+// release stops listening on a branch's port
+func (w *waker) release(branchID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if ln, ok := w.listeners[branchID]; ok {
+		ln.Close()
+		delete(w.listeners, branchID)
+	}
+}
+
+func (w *waker) closeAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for branchID, ln := range w.listeners {
+		ln.Close()
+		delete(w.listeners, branchID)
+	}
+}
+
+// accept resumes the branch for every connection until the listener is released
+func (w *waker) accept(branchID string, port int, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go w.wake(branchID, port, conn)
+	}
+}
+
+// wake resumes the branch and proxies the held connection to it
+func (w *waker) wake(branchID string, port int, conn net.Conn) {
+	defer conn.Close()
+
+	resumeCtx, cancel := context.WithTimeout(w.ctx, 2*resumeReadyTimeout)
+	defer cancel()
+	if err := w.service.ResumeBranch(resumeCtx, branchID); err != nil {
+		w.service.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to resume branch on connection")
+		return
+	}
+
+	upstream, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		w.service.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to connect to resumed branch")
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
@@ -0,0 +1,324 @@
+package breakglass
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restores"
+)
+
+// Bounds of a grant's access window
+const (
+	MinDuration = 15 * time.Minute
+	MaxDuration = 24 * time.Hour
+)
+
+// minJustificationLength keeps placeholders like "debugging" out of the justification
+const minJustificationLength = 20
+
+var (
+	ErrInvalidGrant = errors.New("invalid break-glass grant")
+	ErrGrantOpen    = errors.New("user already has an open break-glass grant")
+	ErrGrantEnded   = errors.New("break-glass grant already ended")
+)
+
+// Branch and restore operations (replaced in tests)
+var (
+	createBranch = func(ctx context.Context, service *branches.Service, params branches.CreateBranchParams) (*models.Branch, error) {
+		return service.CreateBranch(ctx, params)
+	}
+	deleteBranch = func(ctx context.Context, service *branches.Service, name string) error {
+		return service.DeleteBranch(ctx, branches.DeleteBranchParams{BranchName: name})
+	}
+	deleteRestore = func(ctx context.Context, service *restores.Service, restore *models.Restore) error {
+		return service.Delete(ctx, restore)
+	}
+)
+
+// GrantParams describes the access an admin grants
+type GrantParams struct {
+	UserID        string // The user getting access
+	GrantedByID   string // The admin granting it
+	Justification string
+	Duration      time.Duration // Access window, counted from the moment the raw restore is ready
+}
+
+// Service creates, activates and ends break-glass grants
+type Service struct {
+	db       *gorm.DB
+	cfg      *config.Config
+	branches *branches.Service
+	restores *restores.Service
+	logger   zerolog.Logger
+}
+
+func NewService(db *gorm.DB, cfg *config.Config, branchesService *branches.Service, restoresService *restores.Service, logger zerolog.Logger) *Service {
+	return &Service{
+		db:       db,
+		cfg:      cfg,
+		branches: branchesService,
+		restores: restoresService,
+		logger:   logger.With().Str("component", "break_glass").Logger(),
+	}
+}
+
+// NewWorkerService creates a service with its own branches and restores services, for the worker's monitor
+func NewWorkerService(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *Service {
+	return NewService(db, cfg, branches.NewService(db, cfg, logger), restores.NewService(db, cfg, logger), logger)
+}
+
+// Grant records a grant and its raw restore, the caller enqueues the restore task
+// The user gets access once the restore is ready, see Check
+func (s *Service) Grant(ctx context.Context, params GrantParams) (*models.BreakGlassGrant, *models.Restore, error) {
+	justification := strings.TrimSpace(params.Justification)
+	if len(justification) < minJustificationLength {
+		return nil, nil, fmt.Errorf("%w: justification must be at least %d characters", ErrInvalidGrant, minJustificationLength)
+	}
+	if params.Duration < MinDuration || params.Duration > MaxDuration {
+		return nil, nil, fmt.Errorf("%w: duration must be between %s and %s", ErrInvalidGrant, MinDuration, MaxDuration)
+	}
+
+	var user, grantedBy models.User
+	if err := s.db.Where("id = ?", params.UserID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, fmt.Errorf("%w: user not found", ErrInvalidGrant)
+		}
+		return nil, nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if err := s.db.Where("id = ?", params.GrantedByID).First(&grantedBy).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load granting user: %w", err)
+	}
+
+	var open int64
+	if err := s.db.Model(&models.BreakGlassGrant{}).
+		Where("user_id = ? AND status IN ?", user.ID, []string{models.BreakGlassStatusPending, models.BreakGlassStatusActive}).
+		Count(&open).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to check open grants: %w", err)
+	}
+	if open > 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrGrantOpen, user.Email)
+	}
+
+	// Always a full data restore, the schema alone doesn't need break glass
+	restore := models.Restore{
+		Name: models.GenerateRestoreName(),
+		Port: 5432,
+		Raw:  true,
+	}
+	grant := models.BreakGlassGrant{
+		UserID:          user.ID,
+		UserEmail:       user.Email,
+		GrantedByID:     grantedBy.ID,
+		GrantedByEmail:  grantedBy.Email,
+		Justification:   justification,
+		DurationMinutes: int(params.Duration / time.Minute),
+		Status:          models.BreakGlassStatusPending,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&restore).Error; err != nil {
+			return fmt.Errorf("failed to create restore record: %w", err)
+		}
+		grant.RestoreID = restore.ID
+		grant.RestoreName = restore.Name
+		if err := tx.Create(&grant).Error; err != nil {
+			return fmt.Errorf("failed to create grant: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.notifyAdmins(ctx, "break_glass.granted", &grant, fmt.Sprintf(
+		"%s granted %s break-glass access to raw (not anonymized) data for %d minutes: %s",
+		grant.GrantedByEmail, grant.UserEmail, grant.DurationMinutes, grant.Justification))
+	return &grant, &restore, nil
+}
+
+// Check activates pending grants whose raw restore is ready and ends grants that expired (run every minute by the worker)
+func (s *Service) Check(ctx context.Context) error {
+	var grants []models.BreakGlassGrant
+	if err := s.db.Where("status IN ?", []string{models.BreakGlassStatusPending, models.BreakGlassStatusActive}).
+		Order("created_at").
+		Find(&grants).Error; err != nil {
+		return fmt.Errorf("failed to load grants: %w", err)
+	}
+
+	now := time.Now()
+	for i := range grants {
+		grant := &grants[i]
+		var err error
+		switch grant.Status {
+		case models.BreakGlassStatusPending:
+			err = s.checkPending(ctx, grant, now)
+		case models.BreakGlassStatusActive:
+			err = s.checkActive(ctx, grant, now)
+		}
+		if err != nil {
+			// Retried on the next check, an expired grant stays active until its branch is gone
+			s.logger.Error().Err(err).Str("grant_id", grant.ID).Msg("Failed to check break-glass grant")
+		}
+	}
+	return nil
+}
+
+// checkPending creates the user's branch once the raw restore is ready, or fails the grant with its restore
+func (s *Service) checkPending(ctx context.Context, grant *models.BreakGlassGrant, now time.Time) error {
+	var restore models.Restore
+	err := s.db.Where("id = ?", grant.RestoreID).First(&restore).Error
+	if err == gorm.ErrRecordNotFound {
+		return s.endAndRecord(ctx, grant, models.BreakGlassStatusFailed, "raw restore was deleted")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load restore: %w", err)
+	}
+	switch restore.State {
+	case models.RestoreStateFailed:
+		return s.endAndRecord(ctx, grant, models.BreakGlassStatusFailed, "raw restore failed: "+restore.FailureReason)
+	case models.RestoreStateCancelled:
+		return s.endAndRecord(ctx, grant, models.BreakGlassStatusFailed, "raw restore was cancelled")
+	case models.RestoreStateReady:
+	default:
+		return nil
+	}
+
+	branch, err := createBranch(ctx, s.branches, branches.CreateBranchParams{
+		BranchName:  branchName(grant),
+		CreatedByID: grant.UserID,
+		RestoreID:   restore.ID,
+		BreakGlass:  true,
+	})
+	if err != nil {
+		return s.endAndRecord(ctx, grant, models.BreakGlassStatusFailed, "failed to create branch: "+err.Error())
+	}
+
+	expiresAt := now.Add(time.Duration(grant.DurationMinutes) * time.Minute)
+	if err := s.db.Model(grant).Updates(map[string]interface{}{
+		"status":       models.BreakGlassStatusActive,
+		"branch_id":    branch.ID,
+		"branch_name":  branch.Name,
+		"activated_at": now,
+		"expires_at":   expiresAt,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to activate grant: %w", err)
+	}
+
+	s.recordEvent(grant, "break_glass.activated", map[string]string{
+		"branch_name": branch.Name,
+		"expires_at":  expiresAt.UTC().Format(time.RFC3339),
+	})
+	s.notifyAdmins(ctx, "break_glass.activated", grant, fmt.Sprintf(
+		"%s has break-glass access to raw data until %s (branch %s, every statement is logged)",
+		grant.UserEmail, expiresAt.UTC().Format(time.RFC3339), branch.Name))
+	return nil
+}
+
+// checkActive ends a grant that expired or whose branch its user deleted
+func (s *Service) checkActive(ctx context.Context, grant *models.BreakGlassGrant, now time.Time) error {
+	if grant.ExpiresAt != nil && !now.Before(*grant.ExpiresAt) {
+		return s.endAndRecord(ctx, grant, models.BreakGlassStatusExpired, "access window ended")
+	}
+
+	var count int64
+	if err := s.db.Model(&models.Branch{}).Where("id = ?", grant.BranchID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check branch: %w", err)
+	}
+	if count == 0 {
+		return s.endAndRecord(ctx, grant, models.BreakGlassStatusRevoked, "branch was deleted")
+	}
+	return nil
+}
+
+// Revoke ends an open grant before it expires, the API request is the audit event
+func (s *Service) Revoke(ctx context.Context, grant *models.BreakGlassGrant, revokedBy string) error {
+	if grant.Status != models.BreakGlassStatusPending && grant.Status != models.BreakGlassStatusActive {
+		return ErrGrantEnded
+	}
+	return s.end(ctx, grant, models.BreakGlassStatusRevoked, "revoked by "+revokedBy)
+}
+
+// endAndRecord ends a grant on behalf of the worker and adds it to the audit log
+func (s *Service) endAndRecord(ctx context.Context, grant *models.BreakGlassGrant, status, reason string) error {
+	if err := s.end(ctx, grant, status, reason); err != nil {
+		return err
+	}
+	s.recordEvent(grant, "break_glass."+status, map[string]string{"reason": reason})
+	return nil
+}
+
+// end revokes the user's credentials by deleting the branch, then deletes the raw restore
+// The grant only ends once both are gone, a failed deletion is retried by the next check
+func (s *Service) end(ctx context.Context, grant *models.BreakGlassGrant, status, reason string) error {
+	if grant.BranchName != "" {
+		var count int64
+		if err := s.db.Model(&models.Branch{}).Where("id = ?", grant.BranchID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check branch: %w", err)
+		}
+		if count > 0 {
+			if err := deleteBranch(ctx, s.branches, grant.BranchName); err != nil {
+				return fmt.Errorf("failed to delete branch %s: %w", grant.BranchName, err)
+			}
+		}
+	}
+
+	var restore models.Restore
+	err := s.db.Where("id = ?", grant.RestoreID).First(&restore).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("failed to load restore: %w", err)
+	}
+	if err == nil {
+		if err := deleteRestore(ctx, s.restores, &restore); err != nil {
+			return fmt.Errorf("failed to delete raw restore %s: %w", restore.Name, err)
+		}
+	}
+
+	now := time.Now()
+	if err := s.db.Model(grant).Updates(map[string]interface{}{
+		"status":     status,
+		"ended_at":   now,
+		"end_reason": reason,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to end grant: %w", err)
+	}
+
+	s.logger.Warn().
+		Str("grant_id", grant.ID).
+		Str("user_email", grant.UserEmail).
+		Str("status", status).
+		Str("reason", reason).
+		Msg("Break-glass grant ended, credentials and raw restore deleted")
+	s.notifyAdmins(ctx, "break_glass."+status, grant, fmt.Sprintf(
+		"Break-glass access of %s ended (%s): %s", grant.UserEmail, status, reason))
+	return nil
+}
+
+// recordEvent adds a grant change made by the worker to the audit log, failures to record it are only logged
+func (s *Service) recordEvent(grant *models.BreakGlassGrant, action string, details map[string]string) {
+	details["user_email"] = grant.UserEmail
+	details["duration_minutes"] = strconv.Itoa(grant.DurationMinutes)
+	event := models.AuditEvent{
+		Action:       action,
+		ResourceType: "break_glass",
+		ResourceID:   grant.ID,
+		Success:      action != "break_glass."+models.BreakGlassStatusFailed,
+		Details:      details,
+	}
+	if err := s.db.Create(&event).Error; err != nil {
+		s.logger.Warn().Err(err).Str("grant_id", grant.ID).Msg("Failed to record break-glass audit event")
+	}
+}
+
+// branchName names the user's branch after the grant, it's also the syslog tag of its statement log
+func branchName(grant *models.BreakGlassGrant) string {
+	return "breakglass-" + strings.ToLower(grant.ID)
+}
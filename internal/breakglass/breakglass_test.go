@@ -0,0 +1,274 @@
+package breakglass
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restores"
+)
+
+const testJustification = "INC-4711: orders missing after the checkout migration"
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// In-memory databases exist per connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	if err := db.Create(&models.Config{JWTSecret: "secret"}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+	for _, user := range []models.User{
+		{BaseModel: models.BaseModel{ID: "admin-1"}, Email: "alice@example.com", IsAdmin: true},
+		{BaseModel: models.BaseModel{ID: "admin-2"}, Email: "bob@example.com", IsAdmin: true},
+		{BaseModel: models.BaseModel{ID: "user-1"}, Email: "carol@example.com"},
+	} {
+		user.PasswordHash = "hash"
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	return NewService(db, &config.Config{}, nil, nil, zerolog.Nop())
+}
+
+// fakeOperations records branch and restore operations instead of running their scripts
+type fakeOperations struct {
+	created         []branches.CreateBranchParams
+	deletedBranches []string
+	deletedRestores []string
+	createErr       error
+}
+
+func stubOperations(t *testing.T, s *Service) *fakeOperations {
+	t.Helper()
+	fake := &fakeOperations{}
+	origCreate, origDeleteBranch, origDeleteRestore := createBranch, deleteBranch, deleteRestore
+	createBranch = func(ctx context.Context, _ *branches.Service, params branches.CreateBranchParams) (*models.Branch, error) {
+		if fake.createErr != nil {
+			return nil, fake.createErr
+		}
+		fake.created = append(fake.created, params)
+		branch := &models.Branch{Name: params.BranchName, RestoreID: params.RestoreID, CreatedByID: params.CreatedByID, User: "u", Password: "p", Port: 6001}
+		return branch, s.db.Create(branch).Error
+	}
+	deleteBranch = func(ctx context.Context, _ *branches.Service, name string) error {
+		fake.deletedBranches = append(fake.deletedBranches, name)
+		return s.db.Where("name = ?", name).Delete(&models.Branch{}).Error
+	}
+	deleteRestore = func(ctx context.Context, _ *restores.Service, restore *models.Restore) error {
+		fake.deletedRestores = append(fake.deletedRestores, restore.Name)
+		return s.db.Delete(restore).Error
+	}
+	t.Cleanup(func() {
+		createBranch, deleteBranch, deleteRestore = origCreate, origDeleteBranch, origDeleteRestore
+	})
+	return fake
+}
+
+func grantAccess(t *testing.T, s *Service) (*models.BreakGlassGrant, *models.Restore) {
+	t.Helper()
+	grant, restore, err := s.Grant(context.Background(), GrantParams{
+		UserID:        "user-1",
+		GrantedByID:   "admin-1",
+		Justification: testJustification,
+		Duration:      time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Grant() error = %v", err)
+	}
+	return grant, restore
+}
+
+func loadGrant(t *testing.T, s *Service, id string) models.BreakGlassGrant {
+	t.Helper()
+	var grant models.BreakGlassGrant
+	if err := s.db.First(&grant, "id = ?", id).Error; err != nil {
+		t.Fatalf("failed to load grant: %v", err)
+	}
+	return grant
+}
+
+func TestGrant(t *testing.T) {
+	s := newTestService(t)
+
+	var notifications []grantNotification
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n grantNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("invalid notification: %v", err)
+		}
+		notifications = append(notifications, n)
+	}))
+	defer webhook.Close()
+	s.db.Model(&models.Config{}).Where("1 = 1").Update("notification_webhook_url", webhook.URL)
+
+	var posts []string
+	channel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("invalid channel message: %v", err)
+		}
+		posts = append(posts, payload.Text)
+	}))
+	defer channel.Close()
+	if err := s.db.Create(&models.NotificationChannel{Name: "security", Kind: models.ChannelKindSlack, WebhookURL: channel.URL,
+		Events: []string{models.ChannelEventBreakGlass}}).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+
+	invalid := []GrantParams{
+		{UserID: "user-1", GrantedByID: "admin-1", Justification: "debugging", Duration: time.Hour},
+		{UserID: "user-1", GrantedByID: "admin-1", Justification: testJustification, Duration: 5 * time.Minute},
+		{UserID: "user-1", GrantedByID: "admin-1", Justification: testJustification, Duration: 48 * time.Hour},
+		{UserID: "unknown", GrantedByID: "admin-1", Justification: testJustification, Duration: time.Hour},
+	}
+	for _, params := range invalid {
+		if _, _, err := s.Grant(context.Background(), params); !errors.Is(err, ErrInvalidGrant) {
+			t.Errorf("Grant(%+v) error = %v, want ErrInvalidGrant", params, err)
+		}
+	}
+
+	grant, restore := grantAccess(t, s)
+	if grant.Status != models.BreakGlassStatusPending || grant.DurationMinutes != 60 || grant.UserEmail != "carol@example.com" {
+		t.Errorf("grant = %+v, want pending for carol@example.com, 60 minutes", grant)
+	}
+	if !restore.Raw || restore.SchemaOnly || grant.RestoreID != restore.ID {
+		t.Errorf("restore = %+v, want the grant's raw data restore", restore)
+	}
+
+	// The granting admin isn't among the admins notified
+	if len(notifications) != 1 {
+		t.Fatalf("notifications = %d, want 1", len(notifications))
+	}
+	n := notifications[0]
+	if n.Event != "break_glass.granted" || n.Justification != testJustification || len(n.Admins) != 1 || n.Admins[0] != "bob@example.com" {
+		t.Errorf("notification = %+v, want break_glass.granted to bob@example.com", n)
+	}
+	if len(posts) != 1 || !strings.Contains(posts[0], "granted carol@example.com break-glass access") {
+		t.Errorf("channel posts = %q, want the grant", posts)
+	}
+
+	// One open grant per user
+	if _, _, err := s.Grant(context.Background(), GrantParams{UserID: "user-1", GrantedByID: "admin-2", Justification: testJustification, Duration: time.Hour}); !errors.Is(err, ErrGrantOpen) {
+		t.Errorf("second Grant() error = %v, want ErrGrantOpen", err)
+	}
+}
+
+func TestCheckActivatesAndExpiresGrants(t *testing.T) {
+	s := newTestService(t)
+	fake := stubOperations(t, s)
+	grant, restore := grantAccess(t, s)
+
+	// Nothing happens while the raw restore is running
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(fake.created) != 0 {
+		t.Fatalf("branch created before the raw restore is ready")
+	}
+
+	readyAt := time.Now()
+	s.db.Model(restore).Updates(map[string]interface{}{"schema_ready": true, "data_ready": true, "ready_at": readyAt, "state": models.RestoreStateReady})
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(fake.created) != 1 {
+		t.Fatalf("branches created = %d, want 1", len(fake.created))
+	}
+	params := fake.created[0]
+	if !params.BreakGlass || params.RestoreID != restore.ID || params.CreatedByID != "user-1" || !strings.HasPrefix(params.BranchName, "breakglass-") {
+		t.Errorf("branch params = %+v, want a break-glass branch of the raw restore for user-1", params)
+	}
+
+	active := loadGrant(t, s, grant.ID)
+	if active.Status != models.BreakGlassStatusActive || active.BranchName != params.BranchName || active.ExpiresAt == nil {
+		t.Fatalf("grant = %+v, want active with branch and expiry", active)
+	}
+	if window := active.ExpiresAt.Sub(*active.ActivatedAt); window != time.Hour {
+		t.Errorf("access window = %v, want 1h", window)
+	}
+
+	// Expired: credentials (the branch) and the raw restore are deleted
+	s.db.Model(&active).Update("expires_at", time.Now().Add(-time.Minute))
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	expired := loadGrant(t, s, grant.ID)
+	if expired.Status != models.BreakGlassStatusExpired || expired.EndedAt == nil {
+		t.Errorf("grant = %+v, want expired", expired)
+	}
+	if len(fake.deletedBranches) != 1 || len(fake.deletedRestores) != 1 || fake.deletedRestores[0] != restore.Name {
+		t.Errorf("deleted branches %v, restores %v; want the grant's branch and raw restore", fake.deletedBranches, fake.deletedRestores)
+	}
+
+	var actions []string
+	s.db.Model(&models.AuditEvent{}).Where("resource_id = ?", grant.ID).Order("created_at").Pluck("action", &actions)
+	if strings.Join(actions, ",") != "break_glass.activated,break_glass.expired" {
+		t.Errorf("audit events = %v, want activated and expired", actions)
+	}
+}
+
+func TestCheckFailsGrantOfFailedRestore(t *testing.T) {
+	s := newTestService(t)
+	fake := stubOperations(t, s)
+	grant, restore := grantAccess(t, s)
+
+	failedAt := time.Now()
+	s.db.Model(restore).Updates(map[string]interface{}{"state": models.RestoreStateFailed, "failed_at": failedAt, "failure_reason": "pg_dump: connection refused"})
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	failed := loadGrant(t, s, grant.ID)
+	if failed.Status != models.BreakGlassStatusFailed || !strings.Contains(failed.EndReason, "connection refused") {
+		t.Errorf("grant = %+v, want failed with the restore's reason", failed)
+	}
+	if len(fake.created) != 0 || len(fake.deletedRestores) != 1 {
+		t.Errorf("created %v, deleted restores %v; want no branch and the failed restore deleted", fake.created, fake.deletedRestores)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	s := newTestService(t)
+	fake := stubOperations(t, s)
+	grant, _ := grantAccess(t, s)
+
+	if err := s.Revoke(context.Background(), grant, "bob@example.com"); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if grant.Status != models.BreakGlassStatusRevoked || grant.EndReason != "revoked by bob@example.com" {
+		t.Errorf("grant = %+v, want revoked by bob@example.com", grant)
+	}
+	if len(fake.deletedRestores) != 1 {
+		t.Errorf("deleted restores = %v, want the pending raw restore", fake.deletedRestores)
+	}
+
+	if err := s.Revoke(context.Background(), grant, "bob@example.com"); !errors.Is(err, ErrGrantEnded) {
+		t.Errorf("second Revoke() error = %v, want ErrGrantEnded", err)
+	}
+}
@@ -0,0 +1,91 @@
+package breakglass
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/notify"
+)
+
+// grantNotification is the webhook body, "text" makes it a valid Slack or Mattermost incoming webhook message
+type grantNotification struct {
+	Text          string   `json:"text"`
+	Event         string   `json:"event"`
+	Server        string   `json:"server"`
+	GrantID       string   `json:"grant_id"`
+	UserEmail     string   `json:"user_email"`
+	GrantedBy     string   `json:"granted_by"`
+	Justification string   `json:"justification"`
+	Admins        []string `json:"admins"` // Admins besides the granting one, who didn't take part in the decision
+}
+
+// notifyAdmins tells the other admins about a grant event
+// Every notification is logged (and so reaches the configured log sinks). It's also posted to
+// Config.NotificationWebhookURL, to the notification channels subscribed to break_glass and emailed to the
+// other admins when an SMTP server is configured, failures are only logged
+func (s *Service) notifyAdmins(ctx context.Context, event string, grant *models.BreakGlassGrant, text string) {
+	var admins []string
+	if err := s.db.Model(&models.User{}).
+		Where("is_admin = ? AND id != ?", true, grant.GrantedByID).
+		Order("email").
+		Pluck("email", &admins).Error; err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to load admins to notify")
+	}
+
+	s.logger.Warn().
+		Str("event", event).
+		Str("grant_id", grant.ID).
+		Str("user_email", grant.UserEmail).
+		Str("granted_by", grant.GrantedByEmail).
+		Strs("admins", admins).
+		Msg(text)
+
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to load config, break-glass notification not posted")
+		return
+	}
+
+	if config.NotificationWebhookURL != "" {
+		notification := grantNotification{
+			Text:          text,
+			Event:         event,
+			Server:        config.Domain,
+			GrantID:       grant.ID,
+			UserEmail:     grant.UserEmail,
+			GrantedBy:     grant.GrantedByEmail,
+			Justification: grant.Justification,
+			Admins:        admins,
+		}
+		if err := notify.PostWebhook(ctx, config.NotificationWebhookURL, notification); err != nil {
+			s.logger.Warn().Err(err).Str("event", event).Str("grant_id", grant.ID).Msg("Failed to post break-glass notification")
+		}
+	}
+
+	notifier := notify.NewService(s.db, s.cfg, s.logger)
+	notifier.Post(ctx, notify.ChannelMessage{
+		Event:  models.ChannelEventBreakGlass,
+		Title:  text,
+		Failed: event == "break_glass."+models.BreakGlassStatusFailed,
+		Fields: []notify.ChannelField{
+			{Name: "User", Value: grant.UserEmail},
+			{Name: "Granted by", Value: grant.GrantedByEmail},
+			{Name: "Justification", Value: grant.Justification},
+		},
+	})
+
+	if len(admins) == 0 {
+		return
+	}
+	err := notifier.SendTo(ctx, &config, admins, notify.Notification{
+		Event:   event,
+		Subject: fmt.Sprintf("Break-glass access of %s (%s)", grant.UserEmail, event),
+		Body: fmt.Sprintf("%s\n\nGrant: %s\nGranted by: %s\nJustification: %s\n\nSee GET /api/break-glass for all grants.\n",
+			text, grant.ID, grant.GrantedByEmail, grant.Justification),
+	})
+	if err != nil && !errors.Is(err, notify.ErrNotConfigured) {
+		s.logger.Warn().Err(err).Str("event", event).Str("grant_id", grant.ID).Msg("Failed to email break-glass notification")
+	}
+}
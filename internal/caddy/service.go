@@ -51,6 +51,11 @@ const (
         reverse_proxy localhost:8080
     }
 
+    # Prometheus metrics of branches (404 unless METRICS_ENABLED is set)
+    handle /metrics {
+        reverse_proxy localhost:8080
+    }
+
     # Static web UI files
     handle /* {
         root * /var/www/branchd
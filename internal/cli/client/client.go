@@ -1,51 +1,43 @@
 package client
 
 import (
-	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"time"
 
 	"github.com/branchd-dev/branchd/internal/cli/auth"
+	"github.com/branchd-dev/branchd/pkg/branchd"
 )
 
-// Client represents an HTTP client for the Branchd API
+// Client adapts the public Branchd SDK (pkg/branchd) to the CLI
+// Each call authenticates with the token stored for the server by `branchd login`
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
+	api *branchd.Client
 }
 
 // New creates a new API client
 func New(serverIP string) *Client {
 	// Assume HTTPS by default (Caddy serves on 443)
-	baseURL := fmt.Sprintf("https://%s", serverIP)
-
+	// Skip TLS verification for self-signed certificates
 	return &Client{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-			// Skip TLS verification for self-signed certificates
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-			},
-		},
+		api: branchd.New(serverIP, branchd.WithInsecureSkipVerify()),
 	}
 }
 
 // SetHTTPClient sets a custom HTTP client
 func (c *Client) SetHTTPClient(httpClient *http.Client) {
-	c.httpClient = httpClient
+	branchd.WithHTTPClient(httpClient)(c.api)
 }
 
-// LoginRequest represents the login request body
-type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+// authenticated returns the SDK client with the stored token for serverIP
+func (c *Client) authenticated(serverIP string) (*branchd.Client, error) {
+	token, err := auth.LoadToken(serverIP)
+	if err != nil {
+		return nil, err
+	}
+	c.api.SetToken(token)
+	return c.api, nil
 }
 
 // LoginResponse represents the login response
@@ -60,313 +52,390 @@ type LoginResponse struct {
 }
 
 // Login authenticates the user and returns a JWT token
-func (c *Client) Login(email, password string) (*LoginResponse, error) {
-	reqBody := LoginRequest{
-		Email:    email,
-		Password: password,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	resp, err := c.httpClient.Post(
-		fmt.Sprintf("%s/api/auth/login", c.baseURL),
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+// totpCode is only needed for users with two-factor authentication (see branchd.IsTwoFactorRequired)
+func (c *Client) Login(email, password, totpCode string) (*LoginResponse, error) {
+	resp, err := c.api.LoginWithTOTP(context.Background(), email, password, totpCode)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("login failed (status %d): %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("login failed: %w", err)
 	}
 
-	var loginResp LoginResponse
-	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return &loginResp, nil
-}
-
-// CreateBranchRequest represents the branch creation request
-type CreateBranchRequest struct {
-	Name string `json:"name"`
+	loginResp := &LoginResponse{Token: resp.Token}
+	loginResp.User.ID = resp.User.ID
+	loginResp.User.Email = resp.User.Email
+	loginResp.User.Name = resp.User.Name
+	loginResp.User.IsAdmin = resp.User.IsAdmin
+	return loginResp, nil
 }
 
 // CreateBranchResponse represents the branch creation response
-type CreateBranchResponse struct {
-	ID       string `json:"id"`
-	User     string `json:"user"`
-	Password string `json:"password"`
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Database string `json:"database"`
-}
+type CreateBranchResponse = branchd.CreateBranchResponse
 
-// CreateBranch creates a new database branch
-func (c *Client) CreateBranch(serverIP, branchName string) (*CreateBranchResponse, error) {
-	token, err := auth.LoadToken(serverIP)
+// CreateBranch creates a new database branch, from a branch template unless template is empty
+func (c *Client) CreateBranch(serverIP, branchName, template string) (*CreateBranchResponse, error) {
+	api, err := c.authenticated(serverIP)
 	if err != nil {
 		return nil, err
 	}
 
-	reqBody := CreateBranchRequest{
-		Name: branchName,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
+	resp, err := api.CreateBranch(context.Background(), branchd.CreateBranchRequest{Name: branchName, Template: template})
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to create branch: %w", err)
 	}
+	return resp, nil
+}
 
-	req, err := http.NewRequest(
-		"POST",
-		fmt.Sprintf("%s/api/branches", c.baseURL),
-		bytes.NewBuffer(jsonData),
-	)
+// CreateBranchWithSQL creates a branch like CreateBranch, running postBranchSQL in it (e.g. seeds of branchd.yaml)
+func (c *Client) CreateBranchWithSQL(serverIP, branchName, template, postBranchSQL string) (*CreateBranchResponse, error) {
+	api, err := c.authenticated(serverIP)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-
-	resp, err := c.httpClient.Do(req)
+	resp, err := api.CreateBranch(context.Background(), branchd.CreateBranchRequest{Name: branchName, Template: template, PostBranchSQL: postBranchSQL})
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to create branch: %w", err)
 	}
-	defer resp.Body.Close()
+	return resp, nil
+}
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to create branch (status %d): %s", resp.StatusCode, string(body))
-	}
+// FixtureResult reports the rows a fixture generated
+type FixtureResult = branchd.FixtureResult
 
-	var branchResp CreateBranchResponse
-	if err := json.NewDecoder(resp.Body).Decode(&branchResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// ApplyFixture generates the rows of the stored fixture named fixtureName in a branch and waits for them
+func (c *Client) ApplyFixture(serverIP, branchID, fixtureName string) (*FixtureResult, error) {
+	api, err := c.authenticated(serverIP)
+	if err != nil {
+		return nil, err
 	}
 
-	return &branchResp, nil
+	fixtures, err := api.ListFixtures(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fixtures: %w", err)
+	}
+	for _, fixture := range fixtures {
+		if fixture.Name != fixtureName {
+			continue
+		}
+		result, err := api.ApplyFixture(context.Background(), branchID, fixture.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply fixture '%s': %w", fixtureName, err)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("fixture '%s' not found", fixtureName)
 }
 
 // Branch represents a database branch
-type Branch struct {
-	ID            string `json:"id"`
-	Name          string `json:"name"`
-	CreatedAt     string `json:"created_at"`
-	CreatedBy     string `json:"created_by"`
-	RestoreID     string `json:"restore_id"`
-	RestoreName   string `json:"restore_name"`
-	Port          int    `json:"port"`
-	ConnectionURL string `json:"connection_url"`
-}
+type Branch = branchd.Branch
 
 // ListBranches returns all database branches
 func (c *Client) ListBranches(serverIP string) ([]Branch, error) {
-	token, err := auth.LoadToken(serverIP)
+	api, err := c.authenticated(serverIP)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(
-		"GET",
-		fmt.Sprintf("%s/api/branches", c.baseURL),
-		nil,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-
-	resp, err := c.httpClient.Do(req)
+	branches, err := api.ListBranches(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to list branches (status %d): %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("failed to list branches: %w", err)
 	}
-
-	var branches []Branch
-	if err := json.NewDecoder(resp.Body).Decode(&branches); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
 	return branches, nil
 }
 
 // DeleteBranch deletes a database branch by ID
 func (c *Client) DeleteBranch(serverIP, branchID string) error {
-	token, err := auth.LoadToken(serverIP)
+	api, err := c.authenticated(serverIP)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(
-		"DELETE",
-		fmt.Sprintf("%s/api/branches/%s", c.baseURL, branchID),
-		nil,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if err := api.DeleteBranch(context.Background(), branchID); err != nil {
+		return fmt.Errorf("failed to delete branch: %w", err)
 	}
+	return nil
+}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+// BranchDiff compares a branch against its restore
+type BranchDiff = branchd.BranchDiff
 
-	resp, err := c.httpClient.Do(req)
+// DiffBranch compares the schema and row counts of a branch (ID, short ID or name) against its restore
+func (c *Client) DiffBranch(serverIP, branch string) (*BranchDiff, error) {
+	api, err := c.authenticated(serverIP)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to delete branch (status %d): %s", resp.StatusCode, string(body))
+	diff, err := api.DiffBranch(context.Background(), branch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff branch: %w", err)
 	}
-
-	return nil
+	return diff, nil
 }
 
-// UpdateServer triggers a server update to the latest version
-func (c *Client) UpdateServer(serverIP string) error {
-	token, err := auth.LoadToken(serverIP)
+// MigrationCheck reports a migration run in a copy of a branch
+type MigrationCheck = branchd.MigrationCheck
+
+// CheckMigration runs migration files in a throwaway copy of a branch (ID, short ID or name) and waits for the report
+func (c *Client) CheckMigration(serverIP, branch string, files []branchd.MigrationFile) (*MigrationCheck, error) {
+	api, err := c.authenticated(serverIP)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	req, err := http.NewRequest(
-		"POST",
-		fmt.Sprintf("%s/api/system/update", c.baseURL),
-		nil,
-	)
+	check, err := api.CheckMigration(context.Background(), branch, "", files)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to check migration: %w", err)
 	}
+	return check, nil
+}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-
-	resp, err := c.httpClient.Do(req)
+// UpdateServer triggers a server update to the latest version
+func (c *Client) UpdateServer(serverIP string) error {
+	api, err := c.authenticated(serverIP)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to trigger update (status %d): %s", resp.StatusCode, string(body))
+	if _, err := api.UpdateServer(context.Background()); err != nil {
+		return fmt.Errorf("failed to trigger update: %w", err)
 	}
-
 	return nil
 }
 
-// AnonRule represents an anonymization rule
+// AnonRule represents an anonymization rule as written in branchd.json
 type AnonRule struct {
 	Table    string          `json:"table"`
 	Column   string          `json:"column"`
-	Template json.RawMessage `json:"template"`
-	Type     string          `json:"type,omitempty"` // Optional: "text", "integer", "boolean", "null"
-}
-
-// UpdateAnonRulesRequest represents the bulk update request
-type UpdateAnonRulesRequest struct {
-	Rules []AnonRule `json:"rules"`
+	Template json.RawMessage `json:"template,omitempty"`
+	Type     string          `json:"type,omitempty"` // Optional: "text", "integer", "boolean", "null", "date", "timestamp", "uuid"
+	JSONPath string          `json:"json_path,omitempty"`
+
+	// Optional built-in function and its arguments
+	Function        string          `json:"function,omitempty"`
+	FunctionOptions json.RawMessage `json:"function_options,omitempty"`
+	Consistent      bool            `json:"consistent,omitempty"`
 }
 
 // UpdateAnonRules bulk replaces all anonymization rules
 func (c *Client) UpdateAnonRules(serverIP string, rules []AnonRule) error {
-	token, err := auth.LoadToken(serverIP)
+	inputs := make([]branchd.AnonRuleInput, 0, len(rules))
+	for _, rule := range rules {
+		input := branchd.AnonRuleInput{
+			Table:      rule.Table,
+			Column:     rule.Column,
+			JSONPath:   rule.JSONPath,
+			Template:   rule.Template,
+			Type:       rule.Type,
+			Function:   rule.Function,
+			Consistent: rule.Consistent,
+		}
+		if len(rule.FunctionOptions) > 0 {
+			var options branchd.AnonFunctionOptions
+			if err := json.Unmarshal(rule.FunctionOptions, &options); err != nil {
+				return fmt.Errorf("invalid function_options for %s.%s: %w", rule.Table, rule.Column, err)
+			}
+			input.FunctionOptions = &options
+		}
+		inputs = append(inputs, input)
+	}
+
+	api, err := c.authenticated(serverIP)
 	if err != nil {
 		return err
 	}
 
-	reqBody := UpdateAnonRulesRequest{
-		Rules: rules,
+	if _, err := api.UpdateAnonRules(context.Background(), inputs); err != nil {
+		return fmt.Errorf("failed to update anon rules: %w", err)
 	}
+	return nil
+}
 
-	jsonData, err := json.Marshal(reqBody)
+// AnonRulesDiff is what applying anonymization rules changes
+type AnonRulesDiff = branchd.AnonRulesDiff
+
+// ListAnonRules returns the stored anonymization rules
+func (c *Client) ListAnonRules(serverIP string) ([]branchd.AnonRule, error) {
+	api, err := c.authenticated(serverIP)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
 
-	req, err := http.NewRequest(
-		"PUT",
-		fmt.Sprintf("%s/api/anon-rules", c.baseURL),
-		bytes.NewBuffer(jsonData),
-	)
+	rules, err := api.ListAnonRules(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to list anon rules: %w", err)
 	}
+	return rules, nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+// DiffAnonRules returns what replacing the anonymization rules with rules would change, without saving them
+func (c *Client) DiffAnonRules(serverIP string, rules []branchd.AnonRuleInput, skipValidation bool) (*AnonRulesDiff, error) {
+	api, err := c.authenticated(serverIP)
+	if err != nil {
+		return nil, err
+	}
 
-	resp, err := c.httpClient.Do(req)
+	diff, err := api.DiffAnonRules(context.Background(), rules, anonRuleOptions(skipValidation)...)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to diff anon rules: %w", err)
 	}
-	defer resp.Body.Close()
+	return diff, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to update anon rules (status %d): %s", resp.StatusCode, string(body))
+// ApplyAnonRules replaces the anonymization rules with rules
+func (c *Client) ApplyAnonRules(serverIP string, rules []branchd.AnonRuleInput, skipValidation bool) error {
+	api, err := c.authenticated(serverIP)
+	if err != nil {
+		return err
 	}
 
+	if _, err := api.UpdateAnonRules(context.Background(), rules, anonRuleOptions(skipValidation)...); err != nil {
+		return fmt.Errorf("failed to apply anon rules: %w", err)
+	}
 	return nil
 }
 
-// UpdateConfigRequest represents the config update request
-type UpdateConfigRequest struct {
-	PostRestoreSQL *string `json:"postRestoreSQL,omitempty"`
+func anonRuleOptions(skipValidation bool) []branchd.AnonRuleOption {
+	if skipValidation {
+		return []branchd.AnonRuleOption{branchd.SkipSchemaValidation()}
+	}
+	return nil
 }
 
 // UpdateConfig updates server configuration (e.g., post-restore SQL)
 func (c *Client) UpdateConfig(serverIP string, postRestoreSQL *string) error {
-	token, err := auth.LoadToken(serverIP)
+	api, err := c.authenticated(serverIP)
 	if err != nil {
 		return err
 	}
 
-	reqBody := UpdateConfigRequest{
-		PostRestoreSQL: postRestoreSQL,
+	if _, err := api.UpdateConfig(context.Background(), branchd.UpdateConfigRequest{PostRestoreSQL: postRestoreSQL}); err != nil {
+		return fmt.Errorf("failed to update config: %w", err)
 	}
+	return nil
+}
+
+// SystemInfo contains VM, source database and task queue information
+type SystemInfo = branchd.SystemInfo
 
-	jsonData, err := json.Marshal(reqBody)
+// GetSystemInfo returns the server's system information
+func (c *Client) GetSystemInfo(serverIP string) (*SystemInfo, error) {
+	api, err := c.authenticated(serverIP)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
 
-	req, err := http.NewRequest(
-		"PATCH",
-		fmt.Sprintf("%s/api/config", c.baseURL),
-		bytes.NewBuffer(jsonData),
-	)
+	info, err := api.SystemInfo(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to get system info: %w", err)
 	}
+	return info, nil
+}
+
+// Restore represents a restore of the source database
+type Restore = branchd.Restore
+
+// RestoreFilter narrows FindRestores
+type RestoreFilter = branchd.RestoreFilter
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+// ListRestores returns all restores, oldest first
+func (c *Client) ListRestores(serverIP string) ([]Restore, error) {
+	return c.FindRestores(serverIP, RestoreFilter{})
+}
+
+// FindRestores returns the restores matching filter, oldest first
+func (c *Client) FindRestores(serverIP string, filter RestoreFilter) ([]Restore, error) {
+	api, err := c.authenticated(serverIP)
+	if err != nil {
+		return nil, err
+	}
 
-	resp, err := c.httpClient.Do(req)
+	restores, err := api.FindRestores(context.Background(), filter)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to list restores: %w", err)
 	}
-	defer resp.Body.Close()
+	return restores, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to update config (status %d): %s", resp.StatusCode, string(body))
+// Config represents the server configuration
+type Config = branchd.Config
+
+// GetConfig returns the server configuration
+func (c *Client) GetConfig(serverIP string) (*Config, error) {
+	api, err := c.authenticated(serverIP)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	config, err := api.GetConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+	return config, nil
+}
+
+// DecommissionPreview describes what a decommission deletes
+type DecommissionPreview = branchd.DecommissionPreview
+
+// DecommissionResult reports what a decommission removed
+type DecommissionResult = branchd.DecommissionResult
+
+// BranchOwner lists the branches of one user that a decommission deletes
+type BranchOwner = branchd.BranchOwner
+
+// AuditEvent records a state-changing API request
+type AuditEvent = branchd.AuditEvent
+
+// RequestDecommission returns a confirmation token and what a decommission would delete
+func (c *Client) RequestDecommission(serverIP string) (*DecommissionPreview, error) {
+	api, err := c.authenticated(serverIP)
+	if err != nil {
+		return nil, err
+	}
+
+	preview, err := api.RequestDecommission(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to request decommission: %w", err)
+	}
+	return preview, nil
+}
+
+// Decommission tears down the server and waits for it to finish, the partial result is returned together with the error
+func (c *Client) Decommission(serverIP, confirmationToken string) (*DecommissionResult, error) {
+	api, err := c.authenticated(serverIP)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := api.Decommission(context.Background(), confirmationToken)
+	if err != nil {
+		return result, fmt.Errorf("failed to decommission server: %w", err)
+	}
+	return result, nil
+}
+
+// ReconcileReport lists the server's resources and records that don't match
+type ReconcileReport = branchd.ReconcileReport
+
+// ReconcileOrphan is a resource without the restore or branch record it belongs to
+type ReconcileOrphan = branchd.ReconcileOrphan
+
+// ReconcileMissing is a restore or branch record whose dataset is gone
+type ReconcileMissing = branchd.ReconcileMissing
+
+// Reconcile compares the server's datasets, units, processes and ports against its records, cleaning orphans up if fix is set
+func (c *Client) Reconcile(serverIP string, fix bool) (*ReconcileReport, error) {
+	api, err := c.authenticated(serverIP)
+	if err != nil {
+		return nil, err
+	}
+
+	reconcile := api.Reconcile
+	if fix {
+		reconcile = api.FixOrphans
+	}
+	report, err := reconcile(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile server: %w", err)
+	}
+	return report, nil
 }
@@ -0,0 +1,314 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+	"github.com/spf13/cobra"
+)
+
+// AnonClient defines the interface for managing anonymization rules
+type AnonClient interface {
+	ListAnonRules(serverIP string) ([]branchd.AnonRule, error)
+	DiffAnonRules(serverIP string, rules []branchd.AnonRuleInput, skipValidation bool) (*client.AnonRulesDiff, error)
+	ApplyAnonRules(serverIP string, rules []branchd.AnonRuleInput, skipValidation bool) error
+}
+
+// anonOptions allows dependency injection for testing
+type anonOptions struct {
+	apiClient      AnonClient
+	server         *config.Server
+	output         io.Writer
+	dryRun         bool
+	skipValidation bool
+}
+
+// AnonOption is a function that configures anonOptions
+type AnonOption func(*anonOptions)
+
+// WithAnonClient injects a custom API client (for testing)
+func WithAnonClient(client AnonClient) AnonOption {
+	return func(opts *anonOptions) {
+		opts.apiClient = client
+	}
+}
+
+// WithAnonServer injects a specific server (for testing)
+func WithAnonServer(server *config.Server) AnonOption {
+	return func(opts *anonOptions) {
+		opts.server = server
+	}
+}
+
+// WithAnonOutput injects a custom output writer (for testing)
+func WithAnonOutput(w io.Writer) AnonOption {
+	return func(opts *anonOptions) {
+		opts.output = w
+	}
+}
+
+// WithAnonDryRun only shows what applying the rules would change
+func WithAnonDryRun(dryRun bool) AnonOption {
+	return func(opts *anonOptions) {
+		opts.dryRun = dryRun
+	}
+}
+
+// WithAnonSkipValidation saves rules even if they don't match the latest restore's schema
+func WithAnonSkipValidation(skip bool) AnonOption {
+	return func(opts *anonOptions) {
+		opts.skipValidation = skip
+	}
+}
+
+// NewAnonCmd creates the anon command
+func NewAnonCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "anon",
+		Short: "Manage anonymization rules as a YAML file",
+		Long: `Keep the anonymization rules of the selected server in a YAML file under version
+control, next to migrations, instead of editing them in the web UI:
+
+  rules:
+    - table: users
+      column: email
+      function: fake_email
+    - table: users
+      column: api_token
+      template: null
+    - table: orders
+      column: card_number
+      function: mask
+      function_options:
+        keep_last: 4
+
+'branchd anon export' writes the current rules, 'branchd anon apply' makes the
+server's rules match the file.`,
+	}
+
+	cmd.AddCommand(newAnonApplyCmd())
+	cmd.AddCommand(newAnonExportCmd())
+
+	return cmd
+}
+
+func newAnonApplyCmd() *cobra.Command {
+	var file string
+	var dryRun bool
+	var skipValidation bool
+
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Replace the server's anonymization rules with those of a YAML file",
+		Long: `Replace the anonymization rules of the selected server with those of a YAML file
+(anon.yaml by default) and show what changed. Rules are matched by table and
+column: rules missing from the file are deleted.
+
+Rules are checked against the schema of the latest restore first, nothing is
+saved if one doesn't match it (unless --skip-validation).`,
+		Args:        cobra.NoArgs,
+		Annotations: jsonCommand(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAnonApply(file, WithAnonDryRun(dryRun), WithAnonSkipValidation(skipValidation))
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", config.AnonFileName, "Anonymization rules file")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show what would change")
+	cmd.Flags().BoolVar(&skipValidation, "skip-validation", false, "Don't check the rules against the latest restore's schema")
+
+	return cmd
+}
+
+func newAnonExportCmd() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write the server's anonymization rules as YAML",
+		Long: `Write the anonymization rules of the selected server as YAML, to stdout or to
+--file. Applying the written file leaves the rules unchanged.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAnonExport(file)
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Write to this file instead of stdout")
+
+	return cmd
+}
+
+// resolveAnonOptions applies opts and returns the selected server and API client
+func resolveAnonOptions(opts []AnonOption) (*anonOptions, *config.Server, AnonClient, error) {
+	// Apply options
+	options := &anonOptions{
+		output: os.Stdout, // Default to stdout
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	// Get selected server (unless injected for testing)
+	server := options.server
+	if server == nil {
+		var err error
+		server, err = getSelectedServer()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// Create API client (or use injected one for testing)
+	var apiClient AnonClient
+	if options.apiClient != nil {
+		apiClient = options.apiClient
+	} else {
+		apiClient = client.New(server.IP)
+	}
+
+	return options, server, apiClient, nil
+}
+
+func runAnonApply(path string, opts ...AnonOption) error {
+	file, err := config.LoadAnonFile(path)
+	if err != nil {
+		return err
+	}
+	rules, err := file.Inputs()
+	if err != nil {
+		return err
+	}
+
+	options, server, apiClient, err := resolveAnonOptions(opts)
+	if err != nil {
+		return err
+	}
+	out := options.output
+
+	// The diff is computed and validated by the server, nothing is saved yet
+	diff, err := apiClient.DiffAnonRules(server.IP, rules, options.skipValidation)
+	if err != nil {
+		return anonValidationError(out, err)
+	}
+
+	if !options.dryRun && !diff.Empty() {
+		if err := apiClient.ApplyAnonRules(server.IP, rules, options.skipValidation); err != nil {
+			return anonValidationError(out, err)
+		}
+	}
+	diff.DryRun = options.dryRun
+
+	if JSONOutput() {
+		return writeJSON(out, diff)
+	}
+	if Quiet() {
+		return nil
+	}
+
+	if diff.Empty() {
+		fmt.Fprintf(out, "Anonymization rules on %s (%s) are up to date (%d rule(s))\n", server.Alias, server.IP, len(diff.Unchanged))
+		return nil
+	}
+
+	for _, rule := range diff.Added {
+		fmt.Fprintf(out, "+ %s  %s\n", anonRuleTarget(rule), describeAnonRule(rule))
+	}
+	for _, change := range diff.Changed {
+		fmt.Fprintf(out, "~ %s  %s -> %s\n", anonRuleTarget(change.After), describeAnonRule(change.Before), describeAnonRule(change.After))
+	}
+	for _, rule := range diff.Removed {
+		fmt.Fprintf(out, "- %s  %s\n", anonRuleTarget(rule), describeAnonRule(rule))
+	}
+	fmt.Fprintln(out)
+
+	summary := fmt.Sprintf("%d added, %d changed, %d removed, %d unchanged", len(diff.Added), len(diff.Changed), len(diff.Removed), len(diff.Unchanged))
+	if options.dryRun {
+		fmt.Fprintf(out, "Dry run, nothing applied on %s (%s): %s\n", server.Alias, server.IP, summary)
+	} else {
+		fmt.Fprintf(out, "Applied anonymization rules on %s (%s): %s\n", server.Alias, server.IP, summary)
+	}
+	return nil
+}
+
+func runAnonExport(path string, opts ...AnonOption) error {
+	options, server, apiClient, err := resolveAnonOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	rules, err := apiClient.ListAnonRules(server.IP)
+	if err != nil {
+		return err
+	}
+
+	// Rules are listed newest first, the file keeps the order they were created in
+	slices.Reverse(rules)
+
+	file, err := config.NewAnonFile(rules)
+	if err != nil {
+		return err
+	}
+	data, err := file.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to write anonymization rules: %w", err)
+	}
+
+	if path == "" {
+		_, err := options.output.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if !Quiet() {
+		fmt.Fprintf(options.output, "Wrote %d anonymization rule(s) from %s (%s) to %s\n", len(rules), server.Alias, server.IP, path)
+	}
+	return nil
+}
+
+// anonValidationError lists the rules that don't match the latest restore's schema, if that's why err happened
+func anonValidationError(out io.Writer, err error) error {
+	validationErrors := branchd.ValidationErrors(err)
+	if len(validationErrors) == 0 {
+		return err
+	}
+
+	if !JSONOutput() {
+		for _, validationError := range validationErrors {
+			fmt.Fprintf(out, "rule %d (%s.%s): %s\n", validationError.Index+1, validationError.Table, validationError.Column, validationError.Message)
+		}
+		fmt.Fprintln(out)
+	}
+	return fmt.Errorf("%d rule(s) don't match the latest restore's schema, fix them or use --skip-validation", len(validationErrors))
+}
+
+// anonRuleTarget returns what a rule replaces, e.g. "users.email" or "users.metadata->contact.email"
+func anonRuleTarget(rule branchd.AnonRule) string {
+	if rule.JSONPath != "" {
+		return fmt.Sprintf("%s.%s->%s", rule.Table, rule.Column, rule.JSONPath)
+	}
+	return rule.Table + "." + rule.Column
+}
+
+// describeAnonRule returns what a rule writes, e.g. "fake_email" or "template 'user_${index}' (text)"
+func describeAnonRule(rule branchd.AnonRule) string {
+	if rule.Consistent {
+		rule.Consistent = false
+		return describeAnonRule(rule) + ", consistent"
+	}
+
+	switch {
+	case rule.Function != "":
+		return rule.Function
+	case rule.ColumnType == "null":
+		return "null"
+	default:
+		return fmt.Sprintf("template '%s' (%s)", rule.Template, rule.ColumnType)
+	}
+}
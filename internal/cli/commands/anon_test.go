@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+)
+
+// mockAnonClient simulates the API client for the anon commands
+type mockAnonClient struct {
+	rules   []branchd.AnonRule
+	diff    *client.AnonRulesDiff
+	diffed  []branchd.AnonRuleInput
+	applied []branchd.AnonRuleInput
+}
+
+func (m *mockAnonClient) ListAnonRules(serverIP string) ([]branchd.AnonRule, error) {
+	return m.rules, nil
+}
+
+func (m *mockAnonClient) DiffAnonRules(serverIP string, rules []branchd.AnonRuleInput, skipValidation bool) (*client.AnonRulesDiff, error) {
+	m.diffed = rules
+	return m.diff, nil
+}
+
+func (m *mockAnonClient) ApplyAnonRules(serverIP string, rules []branchd.AnonRuleInput, skipValidation bool) error {
+	m.applied = rules
+	return nil
+}
+
+func writeAnonFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), config.AnonFileName)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write anon file: %v", err)
+	}
+	return path
+}
+
+// TestAnonApplyCommand tests the diff is shown and only applied without --dry-run
+func TestAnonApplyCommand(t *testing.T) {
+	path := writeAnonFile(t, `rules:
+  - table: users
+    column: email
+    function: fake_email
+  - table: users
+    column: name
+    template: "user_${index}"
+`)
+
+	newMock := func() *mockAnonClient {
+		return &mockAnonClient{diff: &client.AnonRulesDiff{
+			Added: []branchd.AnonRule{{Table: "users", Column: "email", ColumnType: "text", Function: "fake_email"}},
+			Changed: []branchd.AnonRuleChange{{
+				Before: branchd.AnonRule{Table: "users", Column: "name", ColumnType: "null"},
+				After:  branchd.AnonRule{Table: "users", Column: "name", Template: "user_${index}", ColumnType: "text"},
+			}},
+			Removed: []branchd.AnonRule{{Table: "users", Column: "phone", ColumnType: "text", Function: "mask"}},
+		}}
+	}
+	server := WithAnonServer(&config.Server{IP: "1.2.3.4", Alias: "test"})
+
+	mockAPI := newMock()
+	var output bytes.Buffer
+	if err := runAnonApply(path, WithAnonClient(mockAPI), server, WithAnonOutput(&output), WithAnonDryRun(true)); err != nil {
+		t.Fatalf("runAnonApply() error = %v", err)
+	}
+	if len(mockAPI.diffed) != 2 || mockAPI.diffed[1].Column != "name" || string(mockAPI.diffed[1].Template) != `"user_${index}"` {
+		t.Errorf("diffed rules = %+v, want the file's rules", mockAPI.diffed)
+	}
+	if mockAPI.applied != nil {
+		t.Error("runAnonApply() with --dry-run applied the rules")
+	}
+	for _, want := range []string{
+		"+ users.email  fake_email",
+		"~ users.name  null -> template 'user_${index}' (text)",
+		"- users.phone  mask",
+		"Dry run, nothing applied on test (1.2.3.4): 1 added, 1 changed, 1 removed, 0 unchanged",
+	} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, output.String())
+		}
+	}
+
+	mockAPI = newMock()
+	output.Reset()
+	if err := runAnonApply(path, WithAnonClient(mockAPI), server, WithAnonOutput(&output)); err != nil {
+		t.Fatalf("runAnonApply() error = %v", err)
+	}
+	if len(mockAPI.applied) != 2 {
+		t.Errorf("applied rules = %+v, want the file's rules", mockAPI.applied)
+	}
+	if !strings.Contains(output.String(), "Applied anonymization rules on test (1.2.3.4)") {
+		t.Errorf("output missing the applied summary:\n%s", output.String())
+	}
+
+	// Nothing to change, nothing is applied
+	mockAPI = &mockAnonClient{diff: &client.AnonRulesDiff{Unchanged: make([]branchd.AnonRule, 2)}}
+	output.Reset()
+	if err := runAnonApply(path, WithAnonClient(mockAPI), server, WithAnonOutput(&output)); err != nil {
+		t.Fatalf("runAnonApply() error = %v", err)
+	}
+	if mockAPI.applied != nil || !strings.Contains(output.String(), "up to date (2 rule(s))") {
+		t.Errorf("applied %+v with output %q, want nothing applied", mockAPI.applied, output.String())
+	}
+}
+
+// TestAnonExportCommand tests rules are written oldest first
+func TestAnonExportCommand(t *testing.T) {
+	mockAPI := &mockAnonClient{rules: []branchd.AnonRule{
+		{Table: "users", Column: "name", Function: "fake_name", ColumnType: "text"},
+		{Table: "users", Column: "email", Function: "fake_email", ColumnType: "text"},
+	}}
+
+	var output bytes.Buffer
+	opts := []AnonOption{
+		WithAnonClient(mockAPI),
+		WithAnonServer(&config.Server{IP: "1.2.3.4", Alias: "test"}),
+		WithAnonOutput(&output),
+	}
+	if err := runAnonExport("", opts...); err != nil {
+		t.Fatalf("runAnonExport() error = %v", err)
+	}
+	email := strings.Index(output.String(), "column: email")
+	name := strings.Index(output.String(), "column: name")
+	if email < 0 || name < 0 || email > name {
+		t.Errorf("export should list email then name:\n%s", output.String())
+	}
+
+	path := filepath.Join(t.TempDir(), config.AnonFileName)
+	output.Reset()
+	if err := runAnonExport(path, opts...); err != nil {
+		t.Fatalf("runAnonExport() error = %v", err)
+	}
+	if _, err := config.LoadAnonFile(path); err != nil {
+		t.Errorf("exported file doesn't load: %v", err)
+	}
+}
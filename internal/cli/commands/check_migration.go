@@ -0,0 +1,224 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+	"github.com/spf13/cobra"
+)
+
+// CheckMigrationClient defines the interface for checking a migration
+type CheckMigrationClient interface {
+	CheckMigration(serverIP, branch string, files []branchd.MigrationFile) (*client.MigrationCheck, error)
+}
+
+// checkMigrationOptions allows dependency injection for testing
+type checkMigrationOptions struct {
+	apiClient      CheckMigrationClient
+	server         *config.Server
+	output         io.Writer
+	failOnWarnings bool
+}
+
+// CheckMigrationOption is a function that configures checkMigrationOptions
+type CheckMigrationOption func(*checkMigrationOptions)
+
+// WithCheckMigrationClient injects a custom API client (for testing)
+func WithCheckMigrationClient(client CheckMigrationClient) CheckMigrationOption {
+	return func(opts *checkMigrationOptions) {
+		opts.apiClient = client
+	}
+}
+
+// WithCheckMigrationServer injects a specific server (for testing)
+func WithCheckMigrationServer(server *config.Server) CheckMigrationOption {
+	return func(opts *checkMigrationOptions) {
+		opts.server = server
+	}
+}
+
+// WithCheckMigrationOutput injects a custom output writer (for testing)
+func WithCheckMigrationOutput(w io.Writer) CheckMigrationOption {
+	return func(opts *checkMigrationOptions) {
+		opts.output = w
+	}
+}
+
+// WithFailOnWarnings makes warnings fail the command, e.g. in CI
+func WithFailOnWarnings(fail bool) CheckMigrationOption {
+	return func(opts *checkMigrationOptions) {
+		opts.failOnWarnings = fail
+	}
+}
+
+// NewCheckMigrationCmd creates the check-migration command
+func NewCheckMigrationCmd() *cobra.Command {
+	var failOnWarnings bool
+
+	cmd := &cobra.Command{
+		Use:   "check-migration <branch-name> <file-or-directory>",
+		Short: "Check a SQL migration against a copy of a branch",
+		Long: `Run a SQL migration in a throwaway copy of a branch and report the locks each
+statement takes, how long it runs and which tables it rewrites. The branch
+itself isn't modified.
+
+Given a directory, its .sql files run in name order. Each statement runs in its
+own transaction, psql meta-commands (e.g. \copy) aren't supported.`,
+		Args:        cobra.ExactArgs(2),
+		Annotations: jsonCommand(),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			// The migration is a file or directory
+			if len(args) == 1 {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			return completeBranchNames(cmd, args, toComplete)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCheckMigration(args[0], args[1], WithFailOnWarnings(failOnWarnings))
+		},
+	}
+
+	cmd.Flags().BoolVar(&failOnWarnings, "fail-on-warnings", false, "Exit with an error when a statement blocks or rewrites a table")
+
+	return cmd
+}
+
+func runCheckMigration(branchName, path string, opts ...CheckMigrationOption) error {
+	// Apply options
+	options := &checkMigrationOptions{
+		output: os.Stdout, // Default to stdout
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	files, err := readMigrationFiles(path)
+	if err != nil {
+		return err
+	}
+
+	// Get selected server (unless injected for testing)
+	var server *config.Server
+	if options.server != nil {
+		server = options.server
+	} else {
+		server, err = getSelectedServer()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create API client (or use injected one for testing)
+	var apiClient CheckMigrationClient
+	if options.apiClient != nil {
+		apiClient = options.apiClient
+	} else {
+		apiClient = client.New(server.IP)
+	}
+
+	out := options.output
+	if !Quiet() && !JSONOutput() {
+		fmt.Fprintf(out, "Checking %d migration file(s) against a copy of '%s'...\n\n", len(files), branchName)
+	}
+	check, err := apiClient.CheckMigration(server.IP, branchName, files)
+	if err != nil {
+		return err
+	}
+
+	// The exit status is the same with --output json, so CI steps can both fail and keep the report
+	if JSONOutput() {
+		if err := writeJSON(out, check); err != nil {
+			return err
+		}
+		return migrationCheckError(check, options.failOnWarnings)
+	}
+
+	for i, statement := range check.Statements {
+		location := fmt.Sprintf("#%d", i+1)
+		if statement.File != "" {
+			location = statement.File + " " + location
+		}
+		fmt.Fprintf(out, "%s  %s  (%s)\n", location, summarizeStatement(statement.SQL), formatDurationMs(statement.DurationMs))
+		for _, lock := range statement.Locks {
+			fmt.Fprintf(out, "    lock     %s on %s\n", lock.Mode, lock.Relation)
+		}
+		for _, warning := range statement.Warnings {
+			fmt.Fprintf(out, "    warning  %s\n", warning)
+		}
+		if statement.Error != "" {
+			fmt.Fprintf(out, "    error    %s\n", statement.Error)
+		}
+	}
+	fmt.Fprintln(out)
+
+	if check.Succeeded {
+		fmt.Fprintf(out, "Migration succeeded in %s with %d warning(s)\n", formatDurationMs(check.DurationMs), check.Warnings)
+	}
+	return migrationCheckError(check, options.failOnWarnings)
+}
+
+// migrationCheckError returns the error check-migration exits with, nil if the migration passed
+func migrationCheckError(check *client.MigrationCheck, failOnWarnings bool) error {
+	if !check.Succeeded {
+		return fmt.Errorf("migration failed at statement %d", len(check.Statements))
+	}
+	if failOnWarnings && check.Warnings > 0 {
+		return fmt.Errorf("migration has %d warning(s)", check.Warnings)
+	}
+	return nil
+}
+
+// readMigrationFiles reads a SQL file, or the .sql files of a directory sorted by name
+func readMigrationFiles(path string) ([]branchd.MigrationFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration: %w", err)
+	}
+
+	paths := []string{path}
+	if info.IsDir() {
+		if paths, err = filepath.Glob(filepath.Join(path, "*.sql")); err != nil {
+			return nil, fmt.Errorf("failed to list migration files: %w", err)
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no .sql files in %s", path)
+		}
+		sort.Strings(paths)
+	}
+
+	files := make([]branchd.MigrationFile, 0, len(paths))
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration: %w", err)
+		}
+		files = append(files, branchd.MigrationFile{Name: filepath.Base(p), SQL: string(data)})
+	}
+	return files, nil
+}
+
+// summarizeStatement returns the first line of a statement, shortened to fit a terminal line
+func summarizeStatement(sql string) string {
+	summary, _, multiline := strings.Cut(sql, "\n")
+	if len(summary) > 60 {
+		return summary[:57] + "..."
+	}
+	if multiline {
+		return summary + " ..."
+	}
+	return summary
+}
+
+func formatDurationMs(ms float64) string {
+	if ms >= 1000 {
+		return fmt.Sprintf("%.1fs", ms/1000)
+	}
+	return fmt.Sprintf("%.0fms", ms)
+}
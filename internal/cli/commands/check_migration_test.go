@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+)
+
+// mockCheckMigrationClient simulates the API client for the check-migration command
+type mockCheckMigrationClient struct {
+	check     *client.MigrationCheck
+	requested string
+	files     []branchd.MigrationFile
+}
+
+func (m *mockCheckMigrationClient) CheckMigration(serverIP, branch string, files []branchd.MigrationFile) (*client.MigrationCheck, error) {
+	m.requested = branch
+	m.files = files
+	return m.check, nil
+}
+
+// TestCheckMigrationCommand_Directory tests the .sql files of a directory are sent in name order
+func TestCheckMigrationCommand_Directory(t *testing.T) {
+	dir := t.TempDir()
+	for name, sql := range map[string]string{
+		"002_orders.sql": "CREATE TABLE orders (id bigint);",
+		"001_users.sql":  "ALTER TABLE users ALTER COLUMN id TYPE bigint;",
+		"README.md":      "not a migration",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sql), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	mockAPI := &mockCheckMigrationClient{check: &client.MigrationCheck{
+		Succeeded:  true,
+		DurationMs: 2600,
+		Warnings:   1,
+		Statements: []branchd.MigrationStatement{
+			{File: "001_users.sql", SQL: "ALTER TABLE users ALTER COLUMN id TYPE bigint", DurationMs: 2500,
+				Locks:    []branchd.MigrationLock{{Relation: "public.users", Mode: "AccessExclusiveLock"}},
+				Warnings: []string{"Rewrites public.users: every row is copied"}},
+			{File: "002_orders.sql", SQL: "CREATE TABLE orders (id bigint)", DurationMs: 4},
+		},
+	}}
+
+	var output bytes.Buffer
+	opts := []CheckMigrationOption{
+		WithCheckMigrationClient(mockAPI),
+		WithCheckMigrationServer(&config.Server{IP: "1.2.3.4", Alias: "test"}),
+		WithCheckMigrationOutput(&output),
+	}
+	if err := runCheckMigration("feature-x", dir, opts...); err != nil {
+		t.Fatalf("runCheckMigration() error = %v", err)
+	}
+	if mockAPI.requested != "feature-x" || len(mockAPI.files) != 2 || mockAPI.files[0].Name != "001_users.sql" || mockAPI.files[1].Name != "002_orders.sql" {
+		t.Errorf("checked %s with %+v, want feature-x with the .sql files in name order", mockAPI.requested, mockAPI.files)
+	}
+	for _, want := range []string{
+		"001_users.sql #1  ALTER TABLE users ALTER COLUMN id TYPE bigint  (2.5s)",
+		"lock     AccessExclusiveLock on public.users",
+		"warning  Rewrites public.users",
+		"Migration succeeded in 2.6s with 1 warning(s)",
+	} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, output.String())
+		}
+	}
+
+	if err := runCheckMigration("feature-x", dir, append(opts, WithFailOnWarnings(true))...); err == nil {
+		t.Error("runCheckMigration() with --fail-on-warnings error = nil, want the warning reported")
+	}
+}
+
+// TestCheckMigrationCommand_Failed tests a failing migration fails the command
+func TestCheckMigrationCommand_Failed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migration.sql")
+	if err := os.WriteFile(path, []byte("ALTER TABLE users ALTER COLUMN email SET NOT NULL;"), 0o644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	mockAPI := &mockCheckMigrationClient{check: &client.MigrationCheck{
+		Statements: []branchd.MigrationStatement{
+			{File: "migration.sql", SQL: "ALTER TABLE users ALTER COLUMN email SET NOT NULL", Error: `ERROR:  column "email" of relation "users" contains null values`},
+		},
+	}}
+
+	var output bytes.Buffer
+	err := runCheckMigration("feature-x", path,
+		WithCheckMigrationClient(mockAPI),
+		WithCheckMigrationServer(&config.Server{IP: "1.2.3.4", Alias: "test"}),
+		WithCheckMigrationOutput(&output),
+	)
+	if err == nil || !strings.Contains(err.Error(), "statement 1") {
+		t.Errorf("runCheckMigration() error = %v, want the failed statement", err)
+	}
+	if !strings.Contains(output.String(), "contains null values") {
+		t.Errorf("output missing the error:\n%s", output.String())
+	}
+}
@@ -2,21 +2,33 @@ package commands
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/branchd-dev/branchd/internal/cli/client"
 	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/pkg/branchd"
 	"github.com/spf13/cobra"
 )
 
 // CheckoutClient defines the interface for branch creation operations
 type CheckoutClient interface {
-	CreateBranch(serverIP, branchName string) (*client.CreateBranchResponse, error)
+	CreateBranch(serverIP, branchName, template string) (*client.CreateBranchResponse, error)
+	ListBranches(serverIP string) ([]client.Branch, error)
 }
 
 // checkoutOptions allows dependency injection for testing
 type checkoutOptions struct {
 	apiClient CheckoutClient
 	server    *config.Server
+	format    string
+	template  string
+	envFile   string // Env file the connection string is written to, none when empty
+	envVar    string
 }
 
 // CheckoutOption is a function that configures checkoutOptions
@@ -36,17 +48,56 @@ func WithCheckoutServer(server *config.Server) CheckoutOption {
 	}
 }
 
+// WithCheckoutFormat selects a connection snippet format to print instead of the connection string
+func WithCheckoutFormat(format string) CheckoutOption {
+	return func(opts *checkoutOptions) {
+		opts.format = format
+	}
+}
+
+// WithCheckoutTemplate creates the branch from a named branch template (e.g. "ci-small")
+func WithCheckoutTemplate(template string) CheckoutOption {
+	return func(opts *checkoutOptions) {
+		opts.template = template
+	}
+}
+
+// WithCheckoutEnvFile writes the connection string to name in an env file, restored by delete
+func WithCheckoutEnvFile(path, name string) CheckoutOption {
+	return func(opts *checkoutOptions) {
+		opts.envFile = path
+		opts.envVar = name
+	}
+}
+
 // NewCheckoutCmd creates the checkout command
 func NewCheckoutCmd() *cobra.Command {
+	var format, template, envFile, envVar string
+
 	cmd := &cobra.Command{
-		Use:   "checkout <branch-name>",
+		Use:   "checkout [branch-name]",
 		Short: "Create a new database branch",
-		Args:  cobra.ExactArgs(1),
+		Long: `Create a new database branch and print its connection string. Without a name,
+pick an existing branch from a list and print its connection string instead.`,
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: jsonCommand(),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runCheckout(args[0])
+			if cmd.Flags().Changed("var") && envFile == "" {
+				return fmt.Errorf("--var needs --write-env")
+			}
+			branchName := ""
+			if len(args) > 0 {
+				branchName = args[0]
+			}
+			return runCheckout(branchName, WithCheckoutFormat(format), WithCheckoutTemplate(template), WithCheckoutEnvFile(envFile, envVar))
 		},
 	}
 
+	cmd.Flags().StringVarP(&format, "format", "f", "", "Print a connection snippet instead of the connection string (psql, rails, prisma, django, jdbc)")
+	cmd.Flags().StringVarP(&template, "template", "t", "", "Create the branch from a branch template (resources, settings, post-branch SQL and TTL)")
+	cmd.Flags().StringVar(&envFile, "write-env", "", "Set the connection string in an env file (e.g. .env), branchd delete restores the previous value")
+	cmd.Flags().StringVar(&envVar, "var", defaultEnvVar, "Variable --write-env sets")
+
 	return cmd
 }
 
@@ -60,6 +111,31 @@ func runCheckoutWithOptions(branchName string, opts ...CheckoutOption) error {
 	for _, opt := range opts {
 		opt(options)
 	}
+	if options.format != "" && JSONOutput() {
+		return fmt.Errorf("--format can't be combined with --output json, the JSON includes the snippets")
+	}
+	if options.envFile != "" {
+		if options.envVar == "" {
+			options.envVar = defaultEnvVar
+		}
+		// Checked before the branch is created
+		if err := config.ValidateEnvVarName(options.envVar); err != nil {
+			return err
+		}
+	}
+
+	// The server normalizes names the same way, checking it here fails before any request
+	if branchName != "" {
+		normalized := branchd.NormalizeBranchName(branchName)
+		if err := branchd.ValidateBranchName(normalized); err != nil {
+			return err
+		}
+		if normalized != branchName && !Quiet() && !JSONOutput() {
+			fmt.Fprintf(os.Stderr, "Using branch name '%s'\n", normalized)
+		}
+		branchName = normalized
+	}
+
 	// Get selected server (unless injected for testing)
 	var server *config.Server
 	var err error
@@ -80,20 +156,98 @@ func runCheckoutWithOptions(branchName string, opts ...CheckoutOption) error {
 		apiClient = client.New(server.IP)
 	}
 
+	if branchName == "" {
+		return checkoutExisting(apiClient, server, options)
+	}
+
 	// Create branch
-	branch, err := apiClient.CreateBranch(server.IP, branchName)
+	branch, err := apiClient.CreateBranch(server.IP, branchName, options.template)
+	if err != nil {
+		return err
+	}
+
+	if options.envFile != "" {
+		if err := writeBranchEnv(server.IP, branch.ID, options.envFile, options.envVar, connectionString(branch)); err != nil {
+			return fmt.Errorf("branch '%s' was created but writing %s failed: %w", branchName, options.envFile, err)
+		}
+		if !Quiet() && !JSONOutput() {
+			fmt.Fprintf(os.Stderr, "Set %s in %s\n", options.envVar, options.envFile)
+		}
+	}
+
+	// Print the requested snippet if a format was given
+	if options.format != "" {
+		snippet, ok := branch.Snippets[strings.ToLower(options.format)]
+		if !ok {
+			return fmt.Errorf("snippet format '%s' not available (available: %s)", options.format, strings.Join(availableSnippetFormats(branch.Snippets), ", "))
+		}
+		fmt.Print(snippet)
+		if !strings.HasSuffix(snippet, "\n") {
+			fmt.Println()
+		}
+		return nil
+	}
+
+	if JSONOutput() {
+		return writeJSON(os.Stdout, checkoutResult{CreateBranchResponse: branch, ConnectionString: connectionString(branch)})
+	}
+
+	// Print only the connection string (the same with --quiet, so it can be captured in scripts)
+	fmt.Println(connectionString(branch))
+
+	return nil
+}
+
+// checkoutExisting prints the connection string of a branch picked from a list, for checkout without a name
+func checkoutExisting(apiClient CheckoutClient, server *config.Server, options *checkoutOptions) error {
+	if options.format != "" {
+		return fmt.Errorf("--format needs a branch name, snippets are only returned when a branch is created")
+	}
+	branches, err := apiClient.ListBranches(server.IP)
+	if err != nil {
+		return err
+	}
+	branch, err := pickBranch(branches, "Select a branch")
 	if err != nil {
 		return err
 	}
 
-	// Print only the connection string
-	fmt.Printf("postgresql://%s:%s@%s:%d/%s\n",
-		branch.User,
-		branch.Password,
-		branch.Host,
-		branch.Port,
-		branch.Database,
-	)
+	if options.envFile != "" {
+		if err := writeBranchEnv(server.IP, branch.ID, options.envFile, options.envVar, branch.ConnectionURL); err != nil {
+			return fmt.Errorf("failed to write %s: %w", options.envFile, err)
+		}
+		if !Quiet() {
+			fmt.Fprintf(os.Stderr, "Set %s in %s\n", options.envVar, options.envFile)
+		}
+	}
 
+	fmt.Println(branch.ConnectionURL)
 	return nil
 }
+
+// checkoutResult is the JSON output of checkout
+type checkoutResult struct {
+	*client.CreateBranchResponse
+	ConnectionString string `json:"connection_string"`
+}
+
+// connectionString returns the postgresql:// URL of a created branch
+func connectionString(branch *client.CreateBranchResponse) string {
+	connectionURL := url.URL{
+		Scheme: "postgresql",
+		User:   url.UserPassword(branch.User, branch.Password),
+		Host:   net.JoinHostPort(branch.Host, strconv.Itoa(branch.Port)),
+		Path:   "/" + branch.Database,
+	}
+	return connectionURL.String()
+}
+
+// availableSnippetFormats returns the snippet formats returned by the server, sorted
+func availableSnippetFormats(snippets map[string]string) []string {
+	formats := make([]string, 0, len(snippets))
+	for format := range snippets {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
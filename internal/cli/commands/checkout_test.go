@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -16,10 +17,13 @@ import (
 type mockCheckoutClient struct {
 	shouldFail bool
 	branchName string
+	template   string // Template of the last call
 	response   *client.CreateBranchResponse
 }
 
-func (m *mockCheckoutClient) CreateBranch(serverIP, branchName string) (*client.CreateBranchResponse, error) {
+func (m *mockCheckoutClient) CreateBranch(serverIP, branchName, template string) (*client.CreateBranchResponse, error) {
+	m.template = template
+
 	if m.shouldFail {
 		return nil, fmt.Errorf("failed to create branch (status 500): internal server error")
 	}
@@ -31,22 +35,26 @@ func (m *mockCheckoutClient) CreateBranch(serverIP, branchName string) (*client.
 	return m.response, nil
 }
 
+func (m *mockCheckoutClient) ListBranches(serverIP string) ([]client.Branch, error) {
+	return nil, nil
+}
+
 // TestCheckoutCommand_CommandStructure tests the command is properly configured
 func TestCheckoutCommand_CommandStructure(t *testing.T) {
 	cmd := NewCheckoutCmd()
 
-	if cmd.Use != "checkout <branch-name>" {
-		t.Errorf("expected Use to be 'checkout <branch-name>', got %s", cmd.Use)
+	if cmd.Use != "checkout [branch-name]" {
+		t.Errorf("expected Use to be 'checkout [branch-name]', got %s", cmd.Use)
 	}
 
 	if cmd.Short != "Create a new database branch" {
 		t.Errorf("expected Short description, got %s", cmd.Short)
 	}
 
-	// Test that it requires exactly 1 argument
+	// Without a name an existing branch is picked
 	err := cmd.Args(cmd, []string{})
-	if err == nil {
-		t.Error("expected error when no branch name provided")
+	if err != nil {
+		t.Errorf("expected no error without a branch name, got: %v", err)
 	}
 
 	err = cmd.Args(cmd, []string{"branch1", "branch2"})
@@ -121,3 +129,37 @@ func captureOutput(f func()) string {
 	io.Copy(&buf, r)
 	return buf.String()
 }
+
+// TestCheckoutCommand_WriteEnv tests checkout sets the variable in an env file and delete restores it
+func TestCheckoutCommand_WriteEnv(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	setOutputFlags(t, "", true)
+	envPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envPath, []byte("DATABASE_URL=postgres://localhost/dev\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	server := &config.Server{IP: "192.168.1.100", Alias: "test"}
+
+	checkoutAPI := &mockCheckoutClient{response: &client.CreateBranchResponse{ID: "b1", User: "u", Password: "p", Host: "10.0.0.1", Port: 15432, Database: "app"}}
+	var err error
+	output := captureOutput(func() {
+		err = runCheckout("feature", WithCheckoutClient(checkoutAPI), WithCheckoutServer(server), WithCheckoutEnvFile(envPath, "DATABASE_URL"))
+	})
+	if err != nil {
+		t.Fatalf("runCheckout() error = %v", err)
+	}
+	if output != "postgresql://u:p@10.0.0.1:15432/app\n" {
+		t.Errorf("output = %q, want only the connection string", output)
+	}
+	if data, _ := os.ReadFile(envPath); string(data) != "DATABASE_URL=postgresql://u:p@10.0.0.1:15432/app\n" {
+		t.Errorf("env file after checkout = %q", data)
+	}
+
+	deleteAPI := &mockDeleteClient{branches: []client.Branch{{ID: "b1", Name: "feature"}}}
+	if err := runDelete("feature", WithDeleteClient(deleteAPI), WithDeleteServer(server)); err != nil {
+		t.Fatalf("runDelete() error = %v", err)
+	}
+	if data, _ := os.ReadFile(envPath); string(data) != "DATABASE_URL=postgres://localhost/dev\n" {
+		t.Errorf("env file after delete = %q, want the previous value", data)
+	}
+}
@@ -1,24 +1,146 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/branchd-dev/branchd/internal/cli/config"
 	"github.com/branchd-dev/branchd/internal/cli/serverselect"
+	"github.com/spf13/cobra"
 )
 
+// Output formats of --output
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// jsonAnnotation marks the commands that print JSON with --output json (see SupportsJSON)
+const jsonAnnotation = "branchd/json"
+
+// globalFlags holds the flags every command accepts (registered by AddGlobalFlags)
+var globalFlags struct {
+	server         string
+	nonInteractive bool
+	output         string
+	quiet          bool
+}
+
+// AddGlobalFlags registers --server, --non-interactive, --output and --quiet on the root command
+func AddGlobalFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&globalFlags.server, "server", "", "Server IP or alias to use instead of the selected server (or set BRANCHD_SERVER)")
+	cmd.PersistentFlags().BoolVar(&globalFlags.nonInteractive, "non-interactive", false, "Fail instead of prompting, for CI runners (or set BRANCHD_NON_INTERACTIVE=true)")
+	cmd.PersistentFlags().StringVarP(&globalFlags.output, "output", "o", "", "Output format: table or json (or set BRANCHD_OUTPUT)")
+	cmd.PersistentFlags().BoolVarP(&globalFlags.quiet, "quiet", "q", false, "Only print the result, e.g. the connection string of checkout or branch names of ls (or set BRANCHD_QUIET=true)")
+
+	_ = cmd.RegisterFlagCompletionFunc("server", completeServers)
+	_ = cmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{OutputTable, OutputJSON}, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// ValidateGlobalFlags checks --output before cmd runs, only commands that support JSON accept json
+func ValidateGlobalFlags(cmd *cobra.Command) error {
+	switch outputFormat() {
+	case OutputTable:
+		return nil
+	case OutputJSON:
+		if !SupportsJSON(cmd) {
+			return fmt.Errorf("'branchd %s' has no JSON output", cmd.Name())
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid output format '%s' (use table or json)", outputFormat())
+	}
+}
+
+// SupportsJSON reports whether cmd prints JSON with --output json
+func SupportsJSON(cmd *cobra.Command) bool {
+	return cmd.Annotations[jsonAnnotation] == "true"
+}
+
+// jsonCommand returns annotations marking a command as printing JSON with --output json
+func jsonCommand() map[string]string {
+	return map[string]string{jsonAnnotation: "true"}
+}
+
+// outputFormat returns the format given with --output or BRANCHD_OUTPUT, table by default
+func outputFormat() string {
+	format := globalFlags.output
+	if format == "" {
+		format = os.Getenv("BRANCHD_OUTPUT")
+	}
+	if format == "" {
+		return OutputTable
+	}
+	return strings.ToLower(format)
+}
+
+// JSONOutput reports whether commands print JSON instead of tables and messages
+func JSONOutput() bool {
+	return outputFormat() == OutputJSON
+}
+
+// Quiet reports whether commands only print their result, without headers and progress
+func Quiet() bool {
+	if globalFlags.quiet {
+		return true
+	}
+	quiet, _ := strconv.ParseBool(os.Getenv("BRANCHD_QUIET"))
+	return quiet
+}
+
+// writeJSON prints v as indented JSON, the only output of a command with --output json
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to write JSON output: %w", err)
+	}
+	return nil
+}
+
+// NonInteractive reports whether commands must fail instead of prompting
+func NonInteractive() bool {
+	if globalFlags.nonInteractive {
+		return true
+	}
+	nonInteractive, _ := strconv.ParseBool(os.Getenv("BRANCHD_NON_INTERACTIVE"))
+	return nonInteractive
+}
+
+// serverOverride returns the server given with --server or BRANCHD_SERVER, if any
+func serverOverride() string {
+	if globalFlags.server != "" {
+		return globalFlags.server
+	}
+	return os.Getenv("BRANCHD_SERVER")
+}
+
 // getSelectedServer loads the config and returns the selected server.
 // This is common logic used by most commands.
 // If you need the config object itself, call config.LoadFromCurrentDir() separately.
 func getSelectedServer() (*config.Server, error) {
+	return resolveSelectedServer(!NonInteractive())
+}
+
+// resolveSelectedServer returns the selected server, prompting for one only when interactive is set
+func resolveSelectedServer(interactive bool) (*config.Server, error) {
 	// Load config
 	cfg, err := config.LoadFromCurrentDir()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w\nRun 'branchd init' to create a configuration file", err)
 	}
 
-	// Resolve which server to use
-	server, err := serverselect.ResolveServer(cfg)
+	// Resolve which server to use, --server takes precedence over the selected server
+	var server *config.Server
+	if ipOrAlias := serverOverride(); ipOrAlias != "" {
+		server, err = serverselect.GetServerByIPOrAlias(cfg, ipOrAlias)
+	} else {
+		server, err = serverselect.ResolveServer(cfg, interactive)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -29,3 +151,20 @@ func getSelectedServer() (*config.Server, error) {
 
 	return server, nil
 }
+
+// getTargetServers returns the servers commands acting on all servers apply to,
+// only the --server one when it's given
+func getTargetServers(cfg *config.Config) ([]config.Server, error) {
+	if len(cfg.Servers) == 0 {
+		return nil, fmt.Errorf("no servers configured. Run 'branchd init' to add a server")
+	}
+
+	if ipOrAlias := serverOverride(); ipOrAlias != "" {
+		server, err := serverselect.GetServerByIPOrAlias(cfg, ipOrAlias)
+		if err != nil {
+			return nil, err
+		}
+		return []config.Server{*server}, nil
+	}
+	return cfg.Servers, nil
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// setOutputFlags sets --output and --quiet for one test
+func setOutputFlags(t *testing.T, output string, quiet bool) {
+	t.Helper()
+	globalFlags.output, globalFlags.quiet = output, quiet
+	t.Cleanup(func() { globalFlags.output, globalFlags.quiet = "", false })
+}
+
+// TestValidateGlobalFlags tests only commands with JSON output accept --output json
+func TestValidateGlobalFlags(t *testing.T) {
+	plain := &cobra.Command{Use: "init"}
+
+	tests := []struct {
+		name    string
+		output  string
+		cmd     *cobra.Command
+		wantErr bool
+	}{
+		{name: "default", cmd: plain},
+		{name: "table", output: "table", cmd: plain},
+		{name: "json", output: "JSON", cmd: NewListCmd()},
+		{name: "json without JSON output", output: "json", cmd: plain, wantErr: true},
+		{name: "unknown format", output: "yaml", cmd: NewListCmd(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setOutputFlags(t, tt.output, false)
+			if err := ValidateGlobalFlags(tt.cmd); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateGlobalFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestOutputEnv tests BRANCHD_OUTPUT and BRANCHD_QUIET apply without the flags
+func TestOutputEnv(t *testing.T) {
+	t.Setenv("BRANCHD_OUTPUT", "json")
+	t.Setenv("BRANCHD_QUIET", "true")
+	if !JSONOutput() || !Quiet() {
+		t.Errorf("JSONOutput() = %v, Quiet() = %v, want both set from the environment", JSONOutput(), Quiet())
+	}
+
+	setOutputFlags(t, "table", false)
+	if JSONOutput() {
+		t.Error("--output table should override BRANCHD_OUTPUT")
+	}
+}
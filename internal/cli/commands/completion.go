@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// NewCompletionCmd creates the completion command
+func NewCompletionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion <bash|zsh|fish|powershell>",
+		Short: "Generate a shell completion script",
+		Long: `Generate a completion script for your shell. Branch names are completed from
+the selected server.
+
+  bash:  source <(branchd completion bash)
+         (or save it to /etc/bash_completion.d/branchd)
+  zsh:   branchd completion zsh > "${fpath[1]}/_branchd"
+  fish:  branchd completion fish > ~/.config/fish/completions/branchd.fish`,
+		Args:                  cobra.ExactArgs(1),
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(os.Stdout, true)
+			case "zsh":
+				return root.GenZshCompletion(os.Stdout)
+			case "fish":
+				return root.GenFishCompletion(os.Stdout, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(os.Stdout)
+			default:
+				return fmt.Errorf("unsupported shell '%s' (use bash, zsh, fish or powershell)", args[0])
+			}
+		},
+	}
+
+	return cmd
+}
+
+// IsCompletionCommand reports whether cmd generates or serves shell completions, whose output is read by the shell
+func IsCompletionCommand(cmd *cobra.Command) bool {
+	switch cmd.Name() {
+	case "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return true
+	}
+	return false
+}
+
+// completeBranchNames completes the first argument with the branch names of the selected server
+// Completion can't prompt, without a selected server nothing is completed
+func completeBranchNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	server, err := resolveSelectedServer(false)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	branches, err := client.New(server.IP).ListBranches(server.IP)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var names []string
+	for _, branch := range branches {
+		if strings.HasPrefix(branch.Name, toComplete) {
+			names = append(names, branch.Name+"\t"+branchDescription(branch))
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeServers completes --server with the aliases of branchd.json
+func completeServers(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := config.LoadFromCurrentDir()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var servers []string
+	for _, server := range cfg.Servers {
+		servers = append(servers, server.Alias+"\t"+server.IP)
+	}
+	return servers, cobra.ShellCompDirectiveNoFileComp
+}
+
+// branchDescription describes a branch in completions and the branch picker
+func branchDescription(branch client.Branch) string {
+	description := "from " + branch.RestoreName
+	if branch.Suspended {
+		description += ", suspended"
+	}
+	return description
+}
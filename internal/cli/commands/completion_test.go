@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// TestCompletionCommand tests completion scripts are generated for every supported shell
+func TestCompletionCommand(t *testing.T) {
+	root := &cobra.Command{Use: "branchd"}
+	root.AddCommand(NewDeleteCmd(), NewCompletionCmd())
+
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		output := captureOutput(func() {
+			root.SetArgs([]string{"completion", shell})
+			if err := root.Execute(); err != nil {
+				t.Errorf("completion %s error = %v", shell, err)
+			}
+		})
+		if !strings.Contains(output, "branchd") {
+			t.Errorf("completion %s printed no script", shell)
+		}
+	}
+
+	var stderr bytes.Buffer
+	root.SetErr(&stderr)
+	root.SetArgs([]string{"completion", "tcsh"})
+	if err := root.Execute(); err == nil {
+		t.Error("expected an error for an unsupported shell")
+	}
+}
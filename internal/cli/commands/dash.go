@@ -34,6 +34,11 @@ func runDash() error {
 	fmt.Printf("Opening dashboard for %s (%s)...\n", server.Alias, server.IP)
 	fmt.Printf("URL: %s\n", dashboardURL)
 
+	// No browser to open in CI runners
+	if NonInteractive() {
+		return nil
+	}
+
 	// Open browser based on OS
 	if err := openBrowser(dashboardURL); err != nil {
 		return fmt.Errorf("failed to open browser: %w\nPlease visit: %s", err, dashboardURL)
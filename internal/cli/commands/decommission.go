@@ -0,0 +1,253 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// DecommissionClient defines the interface for decommissioning a server
+type DecommissionClient interface {
+	RequestDecommission(serverIP string) (*client.DecommissionPreview, error)
+	Decommission(serverIP, confirmationToken string) (*client.DecommissionResult, error)
+}
+
+// DecommissionTokenStore defines the interface for removing the revoked token
+type DecommissionTokenStore interface {
+	DeleteToken(serverIP string) error
+}
+
+// decommissionOptions allows dependency injection for testing
+type decommissionOptions struct {
+	apiClient  DecommissionClient
+	tokenStore DecommissionTokenStore
+	server     *config.Server
+	input      io.Reader
+	confirm    string // Server alias given with --confirm, skips the prompt
+	output     io.Writer
+	auditDir   string
+	now        func() time.Time
+}
+
+// DecommissionOption is a function that configures decommissionOptions
+type DecommissionOption func(*decommissionOptions)
+
+// WithDecommissionClient injects a custom API client (for testing)
+func WithDecommissionClient(client DecommissionClient) DecommissionOption {
+	return func(opts *decommissionOptions) {
+		opts.apiClient = client
+	}
+}
+
+// WithDecommissionTokenStore injects a custom token store (for testing)
+func WithDecommissionTokenStore(store DecommissionTokenStore) DecommissionOption {
+	return func(opts *decommissionOptions) {
+		opts.tokenStore = store
+	}
+}
+
+// WithDecommissionServer injects a specific server (for testing)
+func WithDecommissionServer(server *config.Server) DecommissionOption {
+	return func(opts *decommissionOptions) {
+		opts.server = server
+	}
+}
+
+// WithDecommissionInput injects a custom input reader for the confirmation prompt (for testing)
+func WithDecommissionInput(r io.Reader) DecommissionOption {
+	return func(opts *decommissionOptions) {
+		opts.input = r
+	}
+}
+
+// WithDecommissionConfirm confirms with the server alias instead of prompting (--confirm)
+func WithDecommissionConfirm(alias string) DecommissionOption {
+	return func(opts *decommissionOptions) {
+		opts.confirm = alias
+	}
+}
+
+// WithDecommissionOutput injects a custom output writer (for testing)
+func WithDecommissionOutput(w io.Writer) DecommissionOption {
+	return func(opts *decommissionOptions) {
+		opts.output = w
+	}
+}
+
+// NewDecommissionCmd creates the decommission command
+func NewDecommissionCmd() *cobra.Command {
+	var auditDir, confirm string
+
+	cmd := &cobra.Command{
+		Use:   "decommission",
+		Short: "Delete all branches and restores and revoke all access to the server",
+		Long: `Tear down the selected server before shutting it down: deletes all branches
+and restores, destroys their datasets, clears the source database credentials
+and revokes all tokens. Requires admin privileges.
+
+The final audit log is saved to the current directory (or --audit-dir). Owners
+of the deleted branches are notified through the server's notification webhook,
+those it couldn't reach are listed so they can be notified manually.
+
+In non-interactive mode the server alias must be passed with --confirm.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDecommission(func(opts *decommissionOptions) {
+				opts.auditDir = auditDir
+			}, WithDecommissionConfirm(confirm))
+		},
+	}
+
+	cmd.Flags().StringVar(&auditDir, "audit-dir", ".", "Directory to save the final audit log to")
+	cmd.Flags().StringVar(&confirm, "confirm", "", "Server alias, confirms without prompting")
+
+	return cmd
+}
+
+func runDecommission(opts ...DecommissionOption) error {
+	// Apply options
+	options := &decommissionOptions{
+		input:    os.Stdin,
+		output:   os.Stdout, // Default to stdout
+		auditDir: ".",
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	out := options.output
+
+	// Get selected server (unless injected for testing)
+	var server *config.Server
+	var err error
+	if options.server != nil {
+		server = options.server
+	} else {
+		server, err = getSelectedServer()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create API client (or use injected one for testing)
+	var apiClient DecommissionClient
+	if options.apiClient != nil {
+		apiClient = options.apiClient
+	} else {
+		apiClient = client.New(server.IP)
+	}
+
+	// Create token store (or use injected one for testing)
+	var tokenStore DecommissionTokenStore
+	if options.tokenStore != nil {
+		tokenStore = options.tokenStore
+	} else {
+		tokenStore = &defaultTokenStore{}
+	}
+
+	preview, err := apiClient.RequestDecommission(server.IP)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Decommissioning %s (%s) will permanently delete:\n", server.Alias, server.IP)
+	fmt.Fprintf(out, "  %d branch(es) and %d restore(s), including their data\n", preview.Branches, preview.Restores)
+	fmt.Fprintln(out, "  the source database credentials")
+	fmt.Fprintln(out, "  all login sessions and API tokens")
+	printBranchOwners(out, "Branch owners:", preview.BranchOwners)
+
+	// Require the alias to be typed, a plain y/N is too easy to confirm by accident
+	answer := options.confirm
+	if answer == "" {
+		if NonInteractive() {
+			return fmt.Errorf("confirmation is required in non-interactive mode (use --confirm %s)", server.Alias)
+		}
+		fmt.Fprintf(out, "\nType the server alias (%s) to confirm: ", server.Alias)
+		answer, err = bufio.NewReader(options.input).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read confirmation: %w", err)
+		}
+	}
+	if strings.TrimSpace(answer) != server.Alias {
+		return fmt.Errorf("confirmation did not match, server '%s' was not decommissioned", server.Alias)
+	}
+
+	result, decommissionErr := apiClient.Decommission(server.IP, preview.ConfirmationToken)
+	if result == nil {
+		return decommissionErr
+	}
+
+	fmt.Fprintf(out, "\nDeleted %d branch(es) and %d restore(s)\n", len(result.BranchesDeleted), len(result.RestoresDeleted))
+	if len(result.DatasetsDestroyed) > 0 {
+		fmt.Fprintf(out, "Destroyed %d stray dataset(s): %s\n", len(result.DatasetsDestroyed), strings.Join(result.DatasetsDestroyed, ", "))
+	}
+	if len(result.BackupsDeleted) > 0 {
+		fmt.Fprintf(out, "Deleted %d local backup archive(s)\n", len(result.BackupsDeleted))
+	}
+
+	auditPath, err := writeAuditExport(options.auditDir, server.Alias, options.now(), result.AuditEvents)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Audit log saved to %s\n", auditPath)
+
+	var unnotified []client.BranchOwner
+	for _, owner := range result.BranchOwners {
+		if !owner.Notified {
+			unnotified = append(unnotified, owner)
+		}
+	}
+	if notified := len(result.BranchOwners) - len(unnotified); notified > 0 {
+		fmt.Fprintf(out, "Notified %d branch owner(s)\n", notified)
+	}
+	printBranchOwners(out, "Notify these branch owners:", unnotified)
+
+	if decommissionErr != nil {
+		for _, msg := range result.Errors {
+			fmt.Fprintf(out, "  ✗ %s\n", msg)
+		}
+		return decommissionErr
+	}
+
+	// All tokens were revoked, including ours
+	if err := tokenStore.DeleteToken(server.IP); err != nil {
+		fmt.Fprintf(out, "Warning: failed to remove the local authentication token: %v\n", err)
+	}
+
+	fmt.Fprintf(out, "✓ Server '%s' decommissioned, it can now be shut down\n", server.Alias)
+	return nil
+}
+
+// printBranchOwners prints the owners of the branches, if any
+func printBranchOwners(out io.Writer, title string, owners []client.BranchOwner) {
+	if len(owners) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "\n%s\n", title)
+	for _, owner := range owners {
+		fmt.Fprintf(out, "  %s: %s\n", owner.Email, strings.Join(owner.Branches, ", "))
+	}
+}
+
+// writeAuditExport saves the audit events as JSON and returns the file path
+func writeAuditExport(dir, alias string, now time.Time, events []client.AuditEvent) (string, error) {
+	data, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit log: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("branchd-audit-%s-%s.json", alias, now.UTC().Format("20060102-150405")))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to save audit log: %w", err)
+	}
+	return path, nil
+}
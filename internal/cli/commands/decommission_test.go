@@ -0,0 +1,228 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+)
+
+// mockDecommissionClient simulates the API client for the decommission command
+type mockDecommissionClient struct {
+	preview       *client.DecommissionPreview
+	result        *client.DecommissionResult
+	err           error
+	receivedToken string
+	called        bool
+}
+
+func (m *mockDecommissionClient) RequestDecommission(serverIP string) (*client.DecommissionPreview, error) {
+	return m.preview, nil
+}
+
+func (m *mockDecommissionClient) Decommission(serverIP, confirmationToken string) (*client.DecommissionResult, error) {
+	m.called = true
+	m.receivedToken = confirmationToken
+	return m.result, m.err
+}
+
+// mockDeleteTokenStore records deleted tokens
+type mockDeleteTokenStore struct {
+	deleted []string
+}
+
+func (m *mockDeleteTokenStore) DeleteToken(serverIP string) error {
+	m.deleted = append(m.deleted, serverIP)
+	return nil
+}
+
+func withDecommissionAuditDir(dir string, now time.Time) DecommissionOption {
+	return func(opts *decommissionOptions) {
+		opts.auditDir = dir
+		opts.now = func() time.Time { return now }
+	}
+}
+
+func testDecommissionPreview() *client.DecommissionPreview {
+	return &client.DecommissionPreview{
+		ConfirmationToken: "confirm-123",
+		Branches:          2,
+		Restores:          1,
+		BranchOwners: []client.BranchOwner{
+			{UserID: "u1", Email: "alice@example.com", Branches: []string{"feature-a", "feature-b"}},
+		},
+	}
+}
+
+// TestDecommissionCommand_Success tests a confirmed decommission
+func TestDecommissionCommand_Success(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	mockAPI := &mockDecommissionClient{
+		preview: testDecommissionPreview(),
+		result: &client.DecommissionResult{
+			BranchesDeleted: []string{"feature-a", "feature-b"},
+			RestoresDeleted: []string{"restore_20250301"},
+			BranchOwners: []client.BranchOwner{
+				{UserID: "u1", Email: "alice@example.com", Branches: []string{"feature-a"}, Notified: true},
+				{UserID: "u2", Email: "bob@example.com", Branches: []string{"feature-b"}},
+			},
+			AuditEvents: []client.AuditEvent{{Action: "system.decommissioned"}},
+		},
+	}
+	tokenStore := &mockDeleteTokenStore{}
+	var out bytes.Buffer
+
+	err := runDecommission(
+		WithDecommissionClient(mockAPI),
+		WithDecommissionTokenStore(tokenStore),
+		WithDecommissionServer(&config.Server{IP: "192.168.1.100", Alias: "staging"}),
+		WithDecommissionInput(strings.NewReader("staging\n")),
+		WithDecommissionOutput(&out),
+		withDecommissionAuditDir(dir, now),
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if mockAPI.receivedToken != "confirm-123" {
+		t.Errorf("Expected confirmation token 'confirm-123', got %q", mockAPI.receivedToken)
+	}
+	if len(tokenStore.deleted) != 1 || tokenStore.deleted[0] != "192.168.1.100" {
+		t.Errorf("Expected local token to be deleted, got %v", tokenStore.deleted)
+	}
+
+	auditPath := filepath.Join(dir, "branchd-audit-staging-20250301-120000.json")
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("Expected audit log at %s: %v", auditPath, err)
+	}
+	if !strings.Contains(string(data), "system.decommissioned") {
+		t.Errorf("Expected audit log to contain events, got: %s", data)
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"2 branch(es) and 1 restore(s)",
+		"alice@example.com: feature-a, feature-b",
+		"Audit log saved to " + auditPath,
+		"Notified 1 branch owner(s)",
+		"Notify these branch owners:\n  bob@example.com: feature-b",
+		"✓ Server 'staging' decommissioned",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "alice@example.com: feature-a\n") {
+		t.Errorf("Expected notified owner to be left out of the manual list, got:\n%s", output)
+	}
+}
+
+// TestDecommissionCommand_ConfirmationMismatch tests that a wrong alias aborts
+func TestDecommissionCommand_ConfirmationMismatch(t *testing.T) {
+	mockAPI := &mockDecommissionClient{preview: testDecommissionPreview()}
+	var out bytes.Buffer
+
+	err := runDecommission(
+		WithDecommissionClient(mockAPI),
+		WithDecommissionTokenStore(&mockDeleteTokenStore{}),
+		WithDecommissionServer(&config.Server{IP: "192.168.1.100", Alias: "staging"}),
+		WithDecommissionInput(strings.NewReader("production\n")),
+		WithDecommissionOutput(&out),
+		withDecommissionAuditDir(t.TempDir(), time.Now()),
+	)
+	if err == nil {
+		t.Fatal("Expected error for mismatched confirmation")
+	}
+	if mockAPI.called {
+		t.Error("Decommission should not be called without confirmation")
+	}
+}
+
+// TestDecommissionCommand_PartialFailure tests that the audit log is saved and the token kept on failure
+func TestDecommissionCommand_PartialFailure(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	mockAPI := &mockDecommissionClient{
+		preview: testDecommissionPreview(),
+		result: &client.DecommissionResult{
+			BranchesDeleted: []string{"feature-a"},
+			Errors:          []string{"branch feature-b: dataset is busy"},
+			AuditEvents:     []client.AuditEvent{},
+		},
+		err: errors.New("failed to decommission server: decommission incomplete: branch feature-b: dataset is busy"),
+	}
+	tokenStore := &mockDeleteTokenStore{}
+	var out bytes.Buffer
+
+	err := runDecommission(
+		WithDecommissionClient(mockAPI),
+		WithDecommissionTokenStore(tokenStore),
+		WithDecommissionServer(&config.Server{IP: "192.168.1.100", Alias: "staging"}),
+		WithDecommissionInput(strings.NewReader("staging\n")),
+		WithDecommissionOutput(&out),
+		withDecommissionAuditDir(dir, now),
+	)
+	if err == nil {
+		t.Fatal("Expected error for partial decommission")
+	}
+	if len(tokenStore.deleted) != 0 {
+		t.Errorf("Expected local token to be kept, got deleted %v", tokenStore.deleted)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "branchd-audit-staging-20250301-120000.json")); err != nil {
+		t.Errorf("Expected audit log to be saved: %v", err)
+	}
+	if !strings.Contains(out.String(), "✗ branch feature-b: dataset is busy") {
+		t.Errorf("Expected errors in output, got:\n%s", out.String())
+	}
+}
+
+// TestDecommissionCommand_NonInteractive tests that non-interactive mode requires --confirm instead of prompting
+func TestDecommissionCommand_NonInteractive(t *testing.T) {
+	globalFlags.nonInteractive = true
+	t.Cleanup(func() { globalFlags.nonInteractive = false })
+
+	mockAPI := &mockDecommissionClient{preview: testDecommissionPreview()}
+	err := runDecommission(
+		WithDecommissionClient(mockAPI),
+		WithDecommissionTokenStore(&mockDeleteTokenStore{}),
+		WithDecommissionServer(&config.Server{IP: "192.168.1.100", Alias: "staging"}),
+		WithDecommissionInput(strings.NewReader("staging\n")),
+		WithDecommissionOutput(&bytes.Buffer{}),
+		withDecommissionAuditDir(t.TempDir(), time.Now()),
+	)
+	if err == nil || !strings.Contains(err.Error(), "--confirm staging") {
+		t.Fatalf("Expected --confirm error, got: %v", err)
+	}
+	if mockAPI.called {
+		t.Error("Decommission should not be called without confirmation")
+	}
+
+	mockAPI = &mockDecommissionClient{
+		preview: testDecommissionPreview(),
+		result:  &client.DecommissionResult{AuditEvents: []client.AuditEvent{}},
+	}
+	err = runDecommission(
+		WithDecommissionClient(mockAPI),
+		WithDecommissionTokenStore(&mockDeleteTokenStore{}),
+		WithDecommissionServer(&config.Server{IP: "192.168.1.100", Alias: "staging"}),
+		WithDecommissionConfirm("staging"),
+		WithDecommissionOutput(&bytes.Buffer{}),
+		withDecommissionAuditDir(t.TempDir(), time.Now()),
+	)
+	if err != nil {
+		t.Fatalf("Expected no error with --confirm, got: %v", err)
+	}
+	if !mockAPI.called {
+		t.Error("Expected Decommission to be called")
+	}
+}
@@ -2,9 +2,11 @@ package commands
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/branchd-dev/branchd/internal/cli/client"
 	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/pkg/branchd"
 	"github.com/spf13/cobra"
 )
 
@@ -40,10 +42,17 @@ func WithDeleteServer(server *config.Server) DeleteOption {
 // NewDeleteCmd creates the delete command
 func NewDeleteCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "delete <branch-name>",
+		Use:   "delete [branch-name]",
 		Short: "Delete a branch",
-		Args:  cobra.ExactArgs(1),
+		Long: `Delete a branch by name, ID or short ID, restoring the env files checkout
+--write-env changed for it. Without a name, pick the branch from a list.`,
+		Args:              cobra.MaximumNArgs(1),
+		Annotations:       jsonCommand(),
+		ValidArgsFunction: completeBranchNames,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return runDelete("")
+			}
 			return runDelete(args[0])
 		},
 	}
@@ -87,23 +96,38 @@ func runDeleteWithOptions(branchName string, opts ...DeleteOption) error {
 		return fmt.Errorf("failed to list branches: %w", err)
 	}
 
-	// Find branch by name
-	var branchID string
-	for _, branch := range branches {
-		if branch.Name == branchName {
-			branchID = branch.ID
-			break
+	// Find branch by ID, then name, then short ID (same precedence as the server), or pick it without a name
+	var branch *client.Branch
+	if branchName == "" {
+		if branch, err = pickBranch(branches, "Select a branch to delete"); err != nil {
+			return err
 		}
-	}
-
-	if branchID == "" {
+		if !confirmPrompt(fmt.Sprintf("Delete branch '%s'", branch.Name)) {
+			return fmt.Errorf("deletion cancelled")
+		}
+		branchName = branch.Name
+	} else if branch = branchd.MatchBranch(branches, branchName); branch == nil {
 		return fmt.Errorf("branch '%s' not found", branchName)
 	}
 
-	if err := apiClient.DeleteBranch(server.IP, branchID); err != nil {
+	if err := apiClient.DeleteBranch(server.IP, branch.ID); err != nil {
 		return err
 	}
 
-	fmt.Printf("✓ Branch '%s' deleted successfully\n", branchName)
+	restoreBranchEnv(server.IP, branch.ID, os.Stderr)
+
+	if JSONOutput() {
+		return writeJSON(os.Stdout, deletedBranch{ID: branch.ID, Name: branch.Name, Deleted: true})
+	}
+	if !Quiet() {
+		fmt.Printf("✓ Branch '%s' deleted successfully\n", branchName)
+	}
 	return nil
 }
+
+// deletedBranch is the JSON output of delete and down
+type deletedBranch struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted"` // false when down found no branch
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"errors"
 	"os"
 	"testing"
 
@@ -41,13 +42,14 @@ func (m *mockDeleteClient) DeleteBranch(serverIP, branchID string) error {
 func TestDeleteCommand_CommandStructure(t *testing.T) {
 	cmd := NewDeleteCmd()
 
-	if cmd.Use != "delete <branch-name>" {
-		t.Errorf("expected Use to be 'delete <branch-name>', got %s", cmd.Use)
+	if cmd.Use != "delete [branch-name]" {
+		t.Errorf("expected Use to be 'delete [branch-name]', got %s", cmd.Use)
 	}
 
+	// Without a name the branch is picked
 	err := cmd.Args(cmd, []string{})
-	if err == nil {
-		t.Error("expected error when no arguments provided, got nil")
+	if err != nil {
+		t.Errorf("expected no error without arguments, got %v", err)
 	}
 
 	err = cmd.Args(cmd, []string{"branch1", "branch2"})
@@ -86,7 +88,7 @@ func TestDeleteCommand_NoConfigFile(t *testing.T) {
 	}
 }
 
-// TestDeleteCommand_EmptyBranchName tests validation of empty branch name
+// TestDeleteCommand_EmptyBranchName tests an empty branch name can't be picked outside a terminal
 func TestDeleteCommand_EmptyBranchName(t *testing.T) {
 	server := &config.Server{
 		Alias: "test-server",
@@ -99,19 +101,17 @@ func TestDeleteCommand_EmptyBranchName(t *testing.T) {
 		},
 	}
 
-	// Empty string should still go through and return "not found"
+	// Tests don't run in a terminal, nothing is picked or deleted
 	err := runDelete(
 		"",
 		WithDeleteClient(mockAPI),
 		WithDeleteServer(server),
 	)
 
-	if err == nil {
-		t.Error("expected error when branch name is empty, got nil")
+	if !errors.Is(err, errNoBranchName) {
+		t.Errorf("expected errNoBranchName, got %v", err)
 	}
-
-	expectedError := "branch '' not found"
-	if err.Error() != expectedError {
-		t.Errorf("expected error '%s', got '%s'", expectedError, err.Error())
+	if mockAPI.deletedBranch != "" {
+		t.Errorf("expected nothing deleted, deleted %s", mockAPI.deletedBranch)
 	}
 }
@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+	"github.com/spf13/cobra"
+)
+
+// DiffClient defines the interface for diffing a branch
+type DiffClient interface {
+	DiffBranch(serverIP, branch string) (*client.BranchDiff, error)
+}
+
+// diffOptions allows dependency injection for testing
+type diffOptions struct {
+	apiClient DiffClient
+	server    *config.Server
+	output    io.Writer
+}
+
+// DiffOption is a function that configures diffOptions
+type DiffOption func(*diffOptions)
+
+// WithDiffClient injects a custom API client (for testing)
+func WithDiffClient(client DiffClient) DiffOption {
+	return func(opts *diffOptions) {
+		opts.apiClient = client
+	}
+}
+
+// WithDiffServer injects a specific server (for testing)
+func WithDiffServer(server *config.Server) DiffOption {
+	return func(opts *diffOptions) {
+		opts.server = server
+	}
+}
+
+// WithDiffOutput injects a custom output writer (for testing)
+func WithDiffOutput(w io.Writer) DiffOption {
+	return func(opts *diffOptions) {
+		opts.output = w
+	}
+}
+
+// NewDiffCmd creates the diff command
+func NewDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <branch-name>",
+		Short: "Show what a branch changed compared to its restore",
+		Long: `Compare the schema (tables, columns, indexes, constraints, triggers, views
+and functions) and the row count of every table of a branch against its restore,
+e.g. to see what migrations or tests changed before deleting the branch.
+
+Tables of over a million rows aren't counted, their planner estimates are
+compared instead (marked with ~).`,
+		Args:              cobra.ExactArgs(1),
+		Annotations:       jsonCommand(),
+		ValidArgsFunction: completeBranchNames,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiff(args[0])
+		},
+	}
+
+	return cmd
+}
+
+func runDiff(branchName string, opts ...DiffOption) error {
+	// Apply options
+	options := &diffOptions{
+		output: os.Stdout, // Default to stdout
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	// Get selected server (unless injected for testing)
+	var server *config.Server
+	var err error
+	if options.server != nil {
+		server = options.server
+	} else {
+		server, err = getSelectedServer()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create API client (or use injected one for testing)
+	var apiClient DiffClient
+	if options.apiClient != nil {
+		apiClient = options.apiClient
+	} else {
+		apiClient = client.New(server.IP)
+	}
+
+	// The server resolves the branch by ID, name or short ID
+	diff, err := apiClient.DiffBranch(server.IP, branchName)
+	if err != nil {
+		return err
+	}
+
+	out := options.output
+	if JSONOutput() {
+		return writeJSON(out, diff)
+	}
+	if !Quiet() {
+		fmt.Fprintf(out, "Branch '%s' compared to restore %s:\n\n", diff.BranchName, diff.RestoreName)
+	}
+
+	if len(diff.SchemaChanges) == 0 {
+		fmt.Fprintln(out, "No schema changes")
+	} else {
+		fmt.Fprintf(out, "Schema changes (%d):\n", len(diff.SchemaChanges))
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, change := range diff.SchemaChanges {
+			switch change.Change {
+			case "added":
+				fmt.Fprintf(w, "  + %s\t%s\t%s\n", change.Kind, change.Name, change.After)
+			case "removed":
+				fmt.Fprintf(w, "  - %s\t%s\t%s\n", change.Kind, change.Name, change.Before)
+			default:
+				fmt.Fprintf(w, "  ~ %s\t%s\twas: %s\n", change.Kind, change.Name, change.Before)
+				fmt.Fprintf(w, "   \t\tnow: %s\n", change.After)
+			}
+		}
+		w.Flush()
+	}
+	fmt.Fprintln(out)
+
+	if len(diff.RowCounts) == 0 {
+		fmt.Fprintf(out, "No row count changes (%d tables compared)\n", diff.TablesCompared)
+		return nil
+	}
+	fmt.Fprintf(out, "Row count changes (%d tables compared):\n", diff.TablesCompared)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  TABLE\tRESTORE\tBRANCH\tDELTA")
+	for _, change := range diff.RowCounts {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", change.Table, formatRowCount(change.RestoreRows, change), formatRowCount(change.BranchRows, change), formatDelta(change))
+	}
+	w.Flush()
+
+	return nil
+}
+
+// formatRowCount renders one side's row count, "-" if the table doesn't exist there
+func formatRowCount(rows *int64, change branchd.RowCountChange) string {
+	if rows == nil {
+		return "-"
+	}
+	if change.Estimated {
+		return fmt.Sprintf("~%d", *rows)
+	}
+	return fmt.Sprintf("%d", *rows)
+}
+
+func formatDelta(change branchd.RowCountChange) string {
+	delta := fmt.Sprintf("%+d", change.Delta)
+	if change.Estimated {
+		return "~" + delta
+	}
+	return delta
+}
@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+)
+
+// mockDiffClient simulates the API client for the diff command
+type mockDiffClient struct {
+	diff      *client.BranchDiff
+	diffError error
+	requested string
+}
+
+func (m *mockDiffClient) DiffBranch(serverIP, branch string) (*client.BranchDiff, error) {
+	m.requested = branch
+	if m.diffError != nil {
+		return nil, m.diffError
+	}
+	return m.diff, nil
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+// TestDiffCommand_Output tests the rendered schema and row count changes
+func TestDiffCommand_Output(t *testing.T) {
+	mockAPI := &mockDiffClient{diff: &client.BranchDiff{
+		BranchName:  "feature-x",
+		RestoreName: "restore_20250301090000",
+		SchemaChanges: []branchd.SchemaChange{
+			{Kind: "table", Name: "public.orders", Change: "added"},
+			{Kind: "column", Name: "public.users.email", Change: "changed", Before: "text", After: "text NOT NULL"},
+			{Kind: "index", Name: "public.users_name_idx", Change: "removed", Before: "CREATE INDEX users_name_idx ON public.users USING btree (name)"},
+		},
+		RowCounts: []branchd.RowCountChange{
+			{Table: "public.events", RestoreRows: int64Ptr(5000000), BranchRows: int64Ptr(5001000), Delta: 1000, Estimated: true},
+			{Table: "public.orders", BranchRows: int64Ptr(0)},
+			{Table: "public.users", RestoreRows: int64Ptr(100), BranchRows: int64Ptr(88), Delta: -12},
+		},
+		TablesCompared: 12,
+	}}
+
+	var output bytes.Buffer
+	err := runDiff("feature-x",
+		WithDiffClient(mockAPI),
+		WithDiffServer(&config.Server{IP: "1.2.3.4", Alias: "test"}),
+		WithDiffOutput(&output),
+	)
+	if err != nil {
+		t.Fatalf("runDiff() error = %v", err)
+	}
+	if mockAPI.requested != "feature-x" {
+		t.Errorf("requested diff of %q, want feature-x", mockAPI.requested)
+	}
+
+	got := output.String()
+	for _, want := range []string{
+		"Branch 'feature-x' compared to restore restore_20250301090000",
+		"Schema changes (3):",
+		"+ table",
+		"~ column  public.users.email",
+		"was: text",
+		"now: text NOT NULL",
+		"- index",
+		"Row count changes (12 tables compared):",
+		"~5000000",
+		"~+1000",
+		"-12",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+
+	// A table added by the branch has no restore count
+	for _, line := range strings.Split(got, "\n") {
+		if fields := strings.Fields(line); len(fields) == 4 && fields[0] == "public.orders" {
+			if strings.Join(fields, " ") != "public.orders - 0 +0" {
+				t.Errorf("orders row = %q, want - as restore count", line)
+			}
+		}
+	}
+}
+
+// TestDiffCommand_NoChanges tests the output of an unchanged branch
+func TestDiffCommand_NoChanges(t *testing.T) {
+	mockAPI := &mockDiffClient{diff: &client.BranchDiff{BranchName: "feature-x", RestoreName: "restore_20250301090000", TablesCompared: 12}}
+
+	var output bytes.Buffer
+	err := runDiff("feature-x",
+		WithDiffClient(mockAPI),
+		WithDiffServer(&config.Server{IP: "1.2.3.4", Alias: "test"}),
+		WithDiffOutput(&output),
+	)
+	if err != nil {
+		t.Fatalf("runDiff() error = %v", err)
+	}
+	if got := output.String(); !strings.Contains(got, "No schema changes") || !strings.Contains(got, "No row count changes (12 tables compared)") {
+		t.Errorf("output = %q, want no changes", got)
+	}
+}
+
+// TestDiffCommand_Error tests that API errors are returned
+func TestDiffCommand_Error(t *testing.T) {
+	mockAPI := &mockDiffClient{diffError: errors.New("failed to diff branch: branch not found")}
+
+	err := runDiff("missing",
+		WithDiffClient(mockAPI),
+		WithDiffServer(&config.Server{IP: "1.2.3.4", Alias: "test"}),
+		WithDiffOutput(&bytes.Buffer{}),
+	)
+	if err == nil || !strings.Contains(err.Error(), "branch not found") {
+		t.Errorf("runDiff() error = %v, want the API error", err)
+	}
+}
@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/internal/cli/userconfig"
+)
+
+// defaultEnvVar is the variable checkout --write-env sets without --var
+const defaultEnvVar = "DATABASE_URL"
+
+// writeBranchEnv sets name to a branch's connection string in an env file and records the previous value,
+// which delete restores
+func writeBranchEnv(serverIP, branchID, path, name, connectionURL string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve env file path: %w", err)
+	}
+	line, previous, err := config.SetEnvVar(path, name, connectionURL)
+	if err != nil {
+		return err
+	}
+	return userconfig.RecordEnvWrite(userconfig.EnvWrite{
+		ServerIP: serverIP,
+		BranchID: branchID,
+		Path:     path,
+		Var:      name,
+		Line:     line,
+		Previous: previous,
+	})
+}
+
+// restoreBranchEnv restores the env files checkout --write-env changed for a deleted branch
+// Variables edited since are left alone. The branch is already gone, so failures are only warned about on log
+func restoreBranchEnv(serverIP, branchID string, log io.Writer) {
+	verbose := !Quiet() && !JSONOutput()
+	writes, err := userconfig.LoadEnvWrites()
+	if err != nil {
+		fmt.Fprintf(log, "Warning: failed to restore env files: %v\n", err)
+		return
+	}
+
+	var kept []userconfig.EnvWrite
+	found := false
+	for i, write := range writes {
+		if write.ServerIP != serverIP || write.BranchID != branchID {
+			kept = append(kept, write)
+			continue
+		}
+		found = true
+
+		restored, err := config.RestoreEnvVar(write.Path, write.Var, write.Line, write.Previous)
+		switch {
+		case err != nil:
+			fmt.Fprintf(log, "Warning: failed to restore %s in %s: %v\n", write.Var, write.Path, err)
+		case restored:
+			if verbose {
+				fmt.Fprintf(log, "Restored %s in %s\n", write.Var, write.Path)
+			}
+		default:
+			// A later checkout replaced the line, it restores what this one replaced instead
+			for j := i + 1; j < len(writes); j++ {
+				later := &writes[j]
+				if later.Path == write.Path && later.Var == write.Var && later.Previous != nil && *later.Previous == write.Line {
+					later.Previous = write.Previous
+				}
+			}
+			if verbose {
+				fmt.Fprintf(log, "Left %s in %s, it changed since checkout\n", write.Var, write.Path)
+			}
+		}
+	}
+	if !found {
+		return
+	}
+	if err := userconfig.SaveEnvWrites(kept); err != nil {
+		fmt.Fprintf(log, "Warning: failed to update env writes: %v\n", err)
+	}
+}
@@ -103,8 +103,10 @@ func runInitWithOptions(args []string, opts *initOptions) error {
 		}
 	}
 
-	// Open browser to setup page (unless skipped for testing)
-	if !opts.skipBrowser {
+	// Open browser to setup page (unless skipped for testing or non-interactive)
+	if NonInteractive() {
+		fmt.Printf("\nSetup page: https://%s/setup\n", ipAddress)
+	} else if !opts.skipBrowser {
 		setupURL := fmt.Sprintf("https://%s/setup", ipAddress)
 		fmt.Printf("\nOpening setup page at %s...\n", setupURL)
 
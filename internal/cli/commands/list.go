@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"text/tabwriter"
+	"time"
 
 	"github.com/branchd-dev/branchd/internal/cli/client"
 	"github.com/branchd-dev/branchd/internal/cli/config"
@@ -50,9 +52,10 @@ func WithListOutput(w io.Writer) ListOption {
 // NewListCmd creates the list command
 func NewListCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "ls",
-		Aliases: []string{"list"},
-		Short:   "List branches",
+		Use:         "ls",
+		Aliases:     []string{"list"},
+		Short:       "List branches",
+		Annotations: jsonCommand(),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runList()
 		},
@@ -100,6 +103,19 @@ func runListWithOptions(opts ...ListOption) error {
 		return err
 	}
 
+	if JSONOutput() {
+		if branches == nil {
+			branches = []client.Branch{}
+		}
+		return writeJSON(options.output, branches)
+	}
+	if Quiet() {
+		for _, branch := range branches {
+			fmt.Fprintln(options.output, branch.Name)
+		}
+		return nil
+	}
+
 	if len(branches) == 0 {
 		fmt.Fprintln(options.output, "No branches found.")
 		fmt.Fprintln(options.output, "\nCreate a branch with: branchd checkout <branch-name>")
@@ -110,12 +126,17 @@ func runListWithOptions(opts ...ListOption) error {
 	fmt.Fprintf(options.output, "Branches on %s (%s):\n\n", server.Alias, server.IP)
 
 	w := tabwriter.NewWriter(options.output, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "NAME\tCREATED BY\tCREATED AT\tRESTORE")
-	fmt.Fprintln(w, "────\t──────────\t──────────\t───────")
+	fmt.Fprintln(w, "NAME\tSHORT ID\tSTATUS\tCONNECTIONS\tLAST USED\tCREATED BY\tCREATED AT\tRESTORE")
+	fmt.Fprintln(w, "────\t────────\t──────\t───────────\t─────────\t──────────\t──────────\t───────")
 
+	now := time.Now()
 	for _, branch := range branches {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
 			branch.Name,
+			branch.ShortID,
+			branchStatus(branch),
+			branchConnections(branch),
+			branchLastUsed(branch, now),
 			branch.CreatedBy,
 			branch.CreatedAt,
 			branch.RestoreName,
@@ -126,3 +147,27 @@ func runListWithOptions(opts ...ListOption) error {
 
 	return nil
 }
+
+// branchStatus returns the status shown for a branch, "-" until the server has checked it
+func branchStatus(branch client.Branch) string {
+	if branch.Status == "" {
+		return "-"
+	}
+	return branch.Status
+}
+
+// branchConnections returns the client connections of a branch's last activity sample, "-" until it was sampled
+func branchConnections(branch client.Branch) string {
+	if branch.ActivitySampledAt == nil || branch.Suspended {
+		return "-"
+	}
+	return strconv.Itoa(branch.ActiveConnections)
+}
+
+// branchLastUsed returns how long ago a client last used a branch (e.g. "3h ago")
+func branchLastUsed(branch client.Branch, now time.Time) string {
+	if branch.LastActivityAt == nil {
+		return "never"
+	}
+	return formatAge(now.Sub(*branch.LastActivityAt)) + " ago"
+}
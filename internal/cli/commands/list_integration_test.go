@@ -28,6 +28,7 @@ func TestListIntegration_SingleBranch(t *testing.T) {
 				RestoreName:   "restore_20251101143000",
 				Port:          5432,
 				ConnectionURL: "postgresql://...",
+				Status:        "crashed",
 			},
 		},
 		shouldFail: false,
@@ -81,6 +82,9 @@ func TestListIntegration_SingleBranch(t *testing.T) {
 	if !strings.Contains(outputStr, "restore_20251101143000") {
 		t.Errorf("expected restore name, got: %s", outputStr)
 	}
+	if !strings.Contains(outputStr, "STATUS") || !strings.Contains(outputStr, "crashed") {
+		t.Errorf("expected branch status 'crashed', got: %s", outputStr)
+	}
 }
 
 // TestListIntegration_MultipleBranches tests listing multiple branches
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/branchd-dev/branchd/internal/cli/client"
 	"github.com/branchd-dev/branchd/internal/cli/config"
@@ -141,3 +142,69 @@ func mustChdir(t *testing.T, dir string) {
 		t.Fatalf("failed to change directory: %v", err)
 	}
 }
+
+// TestListCommand_Quiet tests --quiet prints only the branch names
+func TestListCommand_Quiet(t *testing.T) {
+	setOutputFlags(t, "", true)
+	mockAPI := &mockListClient{branches: []client.Branch{{ID: "b1", Name: "feature-a"}, {ID: "b2", Name: "feature-b"}}}
+
+	var output bytes.Buffer
+	err := runList(
+		WithListClient(mockAPI),
+		WithListServer(&config.Server{Alias: "test-server", IP: "192.168.1.100"}),
+		WithListOutput(&output),
+	)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+	if output.String() != "feature-a\nfeature-b\n" {
+		t.Errorf("output = %q, want one branch name per line", output.String())
+	}
+}
+
+// TestListCommand_Activity tests the table shows each branch's connections and when it was last used
+func TestListCommand_Activity(t *testing.T) {
+	setOutputFlags(t, "", false)
+	sampledAt := time.Now()
+	lastUsed := sampledAt.Add(-3 * time.Hour)
+	mockAPI := &mockListClient{branches: []client.Branch{
+		{ID: "b1", Name: "feature-a", ActiveConnections: 2, LastActivityAt: &sampledAt, ActivitySampledAt: &sampledAt},
+		{ID: "b2", Name: "feature-b", LastActivityAt: &lastUsed, ActivitySampledAt: &sampledAt},
+		{ID: "b3", Name: "feature-c"},
+	}}
+
+	var output bytes.Buffer
+	err := runList(
+		WithListClient(mockAPI),
+		WithListServer(&config.Server{Alias: "test-server", IP: "192.168.1.100"}),
+		WithListOutput(&output),
+	)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	lines := strings.Split(output.String(), "\n")
+	want := map[string][]string{
+		"feature-a": {"2", "<1m ago"},
+		"feature-b": {"0", "3h ago"},
+		"feature-c": {"-", "never"},
+	}
+	for name, columns := range want {
+		found := false
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) == 0 || fields[0] != name {
+				continue
+			}
+			found = true
+			for _, column := range columns {
+				if !strings.Contains(line, " "+column+" ") {
+					t.Errorf("row %q doesn't show %q", line, column)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no row for %s in:\n%s", name, output.String())
+		}
+	}
+}
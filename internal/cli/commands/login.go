@@ -8,13 +8,14 @@ import (
 
 	"github.com/branchd-dev/branchd/internal/cli/client"
 	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/pkg/branchd"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 )
 
 // LoginClient defines the interface for API login operations
 type LoginClient interface {
-	Login(email, password string) (*client.LoginResponse, error)
+	Login(email, password, totpCode string) (*client.LoginResponse, error)
 }
 
 // LoginTokenStore defines the interface for token storage
@@ -27,6 +28,7 @@ type loginOptions struct {
 	apiClient  LoginClient
 	tokenStore LoginTokenStore
 	server     *config.Server
+	totpCode   string
 }
 
 // LoginOption is a function that configures loginOptions
@@ -53,20 +55,28 @@ func WithServer(server *config.Server) LoginOption {
 	}
 }
 
+// WithTOTPCode sets the two-factor code sent with the login
+func WithTOTPCode(code string) LoginOption {
+	return func(opts *loginOptions) {
+		opts.totpCode = code
+	}
+}
+
 // NewLoginCmd creates the login command
 func NewLoginCmd() *cobra.Command {
-	var email, password string
+	var email, password, totpCode string
 
 	cmd := &cobra.Command{
 		Use:   "login",
 		Short: "Login to a branchd server",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runLogin(email, password)
+			return runLogin(email, password, WithTOTPCode(totpCode))
 		},
 	}
 
 	cmd.Flags().StringVar(&email, "email", "", "Email address (or set BRANCHD_EMAIL)")
 	cmd.Flags().StringVar(&password, "password", "", "Password (or set BRANCHD_PASSWORD, will prompt if not provided)")
+	cmd.Flags().StringVar(&totpCode, "totp-code", "", "Two-factor code of your authenticator app (or set BRANCHD_TOTP_CODE, will prompt if required)")
 
 	return cmd
 }
@@ -88,6 +98,10 @@ func runLoginWithOptions(email, password string, opts ...LoginOption) error {
 	if password == "" {
 		password = os.Getenv("BRANCHD_PASSWORD")
 	}
+	totpCode := options.totpCode
+	if totpCode == "" {
+		totpCode = os.Getenv("BRANCHD_TOTP_CODE")
+	}
 
 	// Validate email
 	if email == "" {
@@ -109,7 +123,7 @@ func runLoginWithOptions(email, password string, opts ...LoginOption) error {
 	// Prompt for password if not provided via flag or env var
 	if password == "" {
 		// Check if stdin is a terminal (not piped)
-		if term.IsTerminal(int(syscall.Stdin)) {
+		if term.IsTerminal(int(syscall.Stdin)) && !NonInteractive() {
 			fmt.Print("Password: ")
 			bytePassword, err := term.ReadPassword(int(syscall.Stdin))
 			if err != nil {
@@ -141,7 +155,19 @@ func runLoginWithOptions(email, password string, opts ...LoginOption) error {
 	// Attempt login
 	fmt.Printf("Logging in to %s (%s)...\n", server.Alias, server.IP)
 
-	loginResp, err := apiClient.Login(email, password)
+	loginResp, err := apiClient.Login(email, password, totpCode)
+	if err != nil && totpCode == "" && branchd.IsTwoFactorRequired(err) {
+		// Two-factor authentication is enabled for this user, ask for a code of the authenticator app
+		if !term.IsTerminal(int(syscall.Stdin)) || NonInteractive() {
+			return fmt.Errorf("two-factor code is required in non-interactive mode (use --totp-code flag or BRANCHD_TOTP_CODE env var)")
+		}
+		fmt.Print("Two-factor code: ")
+		var code string
+		if _, err := fmt.Scanln(&code); err != nil {
+			return fmt.Errorf("failed to read two-factor code: %w", err)
+		}
+		loginResp, err = apiClient.Login(email, password, code)
+	}
 	if err != nil {
 		return fmt.Errorf("login failed: %w", err)
 	}
@@ -8,3 +8,7 @@ type defaultTokenStore struct{}
 func (d *defaultTokenStore) SaveToken(serverIP, token string) error {
 	return auth.SaveToken(serverIP, token)
 }
+
+func (d *defaultTokenStore) DeleteToken(serverIP string) error {
+	return auth.DeleteToken(serverIP)
+}
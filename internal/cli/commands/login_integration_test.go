@@ -16,7 +16,7 @@ type mockAPIClient struct {
 	token      string
 }
 
-func (m *mockAPIClient) Login(email, password string) (*client.LoginResponse, error) {
+func (m *mockAPIClient) Login(email, password, totpCode string) (*client.LoginResponse, error) {
 	if m.shouldFail || email != m.email || password != m.password {
 		return nil, fmt.Errorf("login failed (status 401): {\"error\": \"invalid credentials\"}")
 	}
@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/manifoldco/promptui"
+	"golang.org/x/term"
+)
+
+// errNoBranchName is returned when a branch name is needed and can't be picked
+var errNoBranchName = errors.New("branch name required (run in a terminal without --non-interactive to pick one)")
+
+// canPrompt reports whether commands may show interactive prompts
+func canPrompt() bool {
+	return !NonInteractive() && !JSONOutput() && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// pickBranch shows the branches in a list filtered by typing (see fuzzyMatch), for commands run without a branch name
+func pickBranch(branches []client.Branch, label string) (*client.Branch, error) {
+	if !canPrompt() {
+		return nil, errNoBranchName
+	}
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("no branches found, create one with 'branchd checkout <branch-name>'")
+	}
+
+	type branchOption struct {
+		Name        string
+		Description string
+	}
+	options := make([]branchOption, len(branches))
+	for i, branch := range branches {
+		options[i] = branchOption{Name: branch.Name, Description: branchDescription(branch)}
+	}
+
+	prompt := promptui.Select{
+		Label: label,
+		Items: options,
+		Templates: &promptui.SelectTemplates{
+			Label:    "{{ . }}",
+			Active:   "> {{ .Name | cyan }} {{ .Description | faint }}",
+			Inactive: "  {{ .Name }} {{ .Description | faint }}",
+			Selected: "{{ .Name | green }}",
+		},
+		Size: 10,
+		Searcher: func(input string, index int) bool {
+			return fuzzyMatch(input, options[index].Name)
+		},
+		StartInSearchMode: true,
+	}
+
+	index, _, err := prompt.Run()
+	if err != nil {
+		return nil, fmt.Errorf("branch selection cancelled: %w", err)
+	}
+	return &branches[index], nil
+}
+
+// confirmPrompt asks a yes/no question, false unless the user answers yes
+func confirmPrompt(label string) bool {
+	prompt := promptui.Prompt{Label: label, IsConfirm: true}
+	_, err := prompt.Run()
+	return err == nil
+}
+
+// fuzzyMatch reports whether the characters of input appear in name in order, ignoring case and spaces
+// e.g. "fl" matches "feature-login"
+func fuzzyMatch(input, name string) bool {
+	name = strings.ToLower(name)
+	for _, r := range strings.ToLower(strings.ReplaceAll(input, " ", "")) {
+		i := strings.IndexRune(name, r)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(string(r)):]
+	}
+	return true
+}
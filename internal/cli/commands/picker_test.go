@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		input string
+		name  string
+		want  bool
+	}{
+		{"", "feature-login", true},
+		{"fl", "feature-login", true},
+		{"FEAT log", "feature-login", true},
+		{"login", "feature-login", true},
+		{"lf", "feature-login", false},
+		{"featurex", "feature-login", false},
+	}
+
+	for _, tt := range tests {
+		if got := fuzzyMatch(tt.input, tt.name); got != tt.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", tt.input, tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestPickBranch_NonInteractive tests the picker refuses to prompt with --non-interactive
+func TestPickBranch_NonInteractive(t *testing.T) {
+	globalFlags.nonInteractive = true
+	t.Cleanup(func() { globalFlags.nonInteractive = false })
+
+	_, err := pickBranch([]client.Branch{{ID: "b1", Name: "main"}}, "Select a branch")
+	if !errors.Is(err, errNoBranchName) {
+		t.Errorf("pickBranch() error = %v, want errNoBranchName", err)
+	}
+}
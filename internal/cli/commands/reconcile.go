@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// ReconcileClient defines the interface for reconciling a server's resources
+type ReconcileClient interface {
+	Reconcile(serverIP string, fix bool) (*client.ReconcileReport, error)
+}
+
+// reconcileOptions allows dependency injection for testing
+type reconcileOptions struct {
+	apiClient ReconcileClient
+	server    *config.Server
+	fix       bool
+	output    io.Writer
+}
+
+// ReconcileOption is a function that configures reconcileOptions
+type ReconcileOption func(*reconcileOptions)
+
+// WithReconcileClient injects a custom API client (for testing)
+func WithReconcileClient(client ReconcileClient) ReconcileOption {
+	return func(opts *reconcileOptions) {
+		opts.apiClient = client
+	}
+}
+
+// WithReconcileServer injects a specific server (for testing)
+func WithReconcileServer(server *config.Server) ReconcileOption {
+	return func(opts *reconcileOptions) {
+		opts.server = server
+	}
+}
+
+// WithReconcileFix cleans the orphans up (--fix)
+func WithReconcileFix(fix bool) ReconcileOption {
+	return func(opts *reconcileOptions) {
+		opts.fix = fix
+	}
+}
+
+// WithReconcileOutput injects a custom output writer (for testing)
+func WithReconcileOutput(w io.Writer) ReconcileOption {
+	return func(opts *reconcileOptions) {
+		opts.output = w
+	}
+}
+
+// NewReconcileCmd creates the reconcile command
+func NewReconcileCmd() *cobra.Command {
+	var fix bool
+
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Find datasets, processes and ports left behind by failed branches and restores",
+		Long: `Compare the selected server's ZFS datasets, systemd units, PostgreSQL
+processes, listening ports and firewall rules against its branches and
+restores. Requires admin privileges.
+
+Resources without a branch or restore are listed as orphans, --fix removes
+them. Branches and restores whose dataset is gone are listed as well, delete
+them with 'branchd delete' or through the dashboard.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReconcile(WithReconcileFix(fix))
+		},
+	}
+
+	cmd.Flags().BoolVar(&fix, "fix", false, "Clean the orphaned resources up")
+
+	return cmd
+}
+
+func runReconcile(opts ...ReconcileOption) error {
+	// Apply options
+	options := &reconcileOptions{
+		output: os.Stdout, // Default to stdout
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	out := options.output
+
+	// Get selected server (unless injected for testing)
+	var server *config.Server
+	var err error
+	if options.server != nil {
+		server = options.server
+	} else {
+		server, err = getSelectedServer()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create API client (or use injected one for testing)
+	var apiClient ReconcileClient
+	if options.apiClient != nil {
+		apiClient = options.apiClient
+	} else {
+		apiClient = client.New(server.IP)
+	}
+
+	report, err := apiClient.Reconcile(server.IP, options.fix)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range report.Errors {
+		fmt.Fprintf(out, "Warning: %s\n", msg)
+	}
+
+	if len(report.Orphans) == 0 && len(report.Missing) == 0 {
+		fmt.Fprintf(out, "✓ Resources of '%s' match its branches and restores\n", server.Alias)
+		return nil
+	}
+
+	failed := 0
+	if len(report.Orphans) > 0 {
+		fmt.Fprintf(out, "Orphaned resources on '%s':\n", server.Alias)
+		for _, orphan := range report.Orphans {
+			status := ""
+			switch {
+			case orphan.Fixed:
+				status = " ✓ removed"
+			case orphan.Error != "":
+				status = " ✗ " + orphan.Error
+				failed++
+			}
+			fmt.Fprintf(out, "  %-8s %s%s%s\n", orphan.Kind, orphan.Name, orphanDetail(orphan), status)
+		}
+	}
+
+	if len(report.Missing) > 0 {
+		fmt.Fprintln(out, "\nRecords whose dataset is gone:")
+		for _, missing := range report.Missing {
+			fmt.Fprintf(out, "  %-8s %s (%s)\n", missing.Kind, missing.Name, missing.Dataset)
+		}
+	}
+
+	if !options.fix && len(report.Orphans) > 0 {
+		fmt.Fprintln(out, "\nRun 'branchd reconcile --fix' to clean the orphaned resources up")
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to clean up %d orphaned resource(s)", failed)
+	}
+	return nil
+}
+
+// orphanDetail describes what an orphan belonged to, if known
+func orphanDetail(orphan client.ReconcileOrphan) string {
+	switch {
+	case orphan.Owner != "" && orphan.Detail != "":
+		return fmt.Sprintf(" (%s, %s)", orphan.Owner, orphan.Detail)
+	case orphan.Owner != "":
+		return fmt.Sprintf(" (%s)", orphan.Owner)
+	case orphan.Detail != "":
+		return fmt.Sprintf(" (%s)", orphan.Detail)
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+)
+
+// mockReconcileClient simulates the API client for the reconcile command
+type mockReconcileClient struct {
+	report      *client.ReconcileReport
+	receivedFix bool
+}
+
+func (m *mockReconcileClient) Reconcile(serverIP string, fix bool) (*client.ReconcileReport, error) {
+	m.receivedFix = fix
+	return m.report, nil
+}
+
+// TestReconcileCommand_Report tests listing orphans without cleaning them up
+func TestReconcileCommand_Report(t *testing.T) {
+	mockAPI := &mockReconcileClient{report: &client.ReconcileReport{
+		Orphans: []client.ReconcileOrphan{
+			{Kind: "dataset", Name: "tank/feature-old", Owner: "feature-old", Detail: "/opt/branchd/feature-old"},
+			{Kind: "port", Name: "15440", Detail: "postgres pid 200"},
+		},
+		Missing: []client.ReconcileMissing{{Kind: "branch", ID: "b1", Name: "feature-gone", Dataset: "tank/feature-gone"}},
+	}}
+	var out bytes.Buffer
+
+	err := runReconcile(
+		WithReconcileClient(mockAPI),
+		WithReconcileServer(&config.Server{IP: "192.168.1.100", Alias: "staging"}),
+		WithReconcileOutput(&out),
+	)
+	if err != nil {
+		t.Fatalf("runReconcile() error = %v", err)
+	}
+	if mockAPI.receivedFix {
+		t.Error("expected orphans to be left alone without --fix")
+	}
+	for _, want := range []string{
+		"dataset  tank/feature-old (feature-old, /opt/branchd/feature-old)",
+		"port     15440 (postgres pid 200)",
+		"branch   feature-gone (tank/feature-gone)",
+		"branchd reconcile --fix",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestReconcileCommand_Fix tests cleaning orphans up, failures fail the command
+func TestReconcileCommand_Fix(t *testing.T) {
+	mockAPI := &mockReconcileClient{report: &client.ReconcileReport{
+		Fix: true,
+		Orphans: []client.ReconcileOrphan{
+			{Kind: "unit", Name: "branchd-branch-feature-old.service", Owner: "feature-old", Fixed: true},
+			{Kind: "dataset", Name: "tank/feature-old", Owner: "feature-old", Error: "dataset is busy"},
+		},
+	}}
+	var out bytes.Buffer
+
+	err := runReconcile(
+		WithReconcileClient(mockAPI),
+		WithReconcileServer(&config.Server{IP: "192.168.1.100", Alias: "staging"}),
+		WithReconcileFix(true),
+		WithReconcileOutput(&out),
+	)
+	if err == nil || !strings.Contains(err.Error(), "1 orphaned resource") {
+		t.Fatalf("runReconcile() error = %v, want the failed cleanup reported", err)
+	}
+	if !mockAPI.receivedFix {
+		t.Error("expected orphans to be cleaned up with --fix")
+	}
+	if !strings.Contains(out.String(), "✓ removed") || !strings.Contains(out.String(), "✗ dataset is busy") {
+		t.Errorf("output = %s", out.String())
+	}
+	if strings.Contains(out.String(), "--fix") {
+		t.Errorf("output suggests --fix after fixing:\n%s", out.String())
+	}
+}
+
+// TestReconcileCommand_Clean tests a server without orphans
+func TestReconcileCommand_Clean(t *testing.T) {
+	var out bytes.Buffer
+
+	err := runReconcile(
+		WithReconcileClient(&mockReconcileClient{report: &client.ReconcileReport{}}),
+		WithReconcileServer(&config.Server{IP: "192.168.1.100", Alias: "staging"}),
+		WithReconcileOutput(&out),
+	)
+	if err != nil {
+		t.Fatalf("runReconcile() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "match its branches and restores") {
+		t.Errorf("output = %s", out.String())
+	}
+}
@@ -0,0 +1,185 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// maxNoteWidth truncates restore notes in the table
+const maxNoteWidth = 40
+
+// RestoresClient defines the interface for listing restores
+type RestoresClient interface {
+	FindRestores(serverIP string, filter client.RestoreFilter) ([]client.Restore, error)
+}
+
+// restoresOptions allows dependency injection for testing
+type restoresOptions struct {
+	apiClient RestoresClient
+	server    *config.Server
+	output    io.Writer
+	filter    client.RestoreFilter
+}
+
+// RestoresOption is a function that configures restoresOptions
+type RestoresOption func(*restoresOptions)
+
+// WithRestoresClient injects a custom API client (for testing)
+func WithRestoresClient(client RestoresClient) RestoresOption {
+	return func(opts *restoresOptions) {
+		opts.apiClient = client
+	}
+}
+
+// WithRestoresServer injects a specific server (for testing)
+func WithRestoresServer(server *config.Server) RestoresOption {
+	return func(opts *restoresOptions) {
+		opts.server = server
+	}
+}
+
+// WithRestoresOutput injects a custom output writer (for testing)
+func WithRestoresOutput(w io.Writer) RestoresOption {
+	return func(opts *restoresOptions) {
+		opts.output = w
+	}
+}
+
+// WithRestoresFilter only lists the restores matching filter
+func WithRestoresFilter(filter client.RestoreFilter) RestoresOption {
+	return func(opts *restoresOptions) {
+		opts.filter = filter
+	}
+}
+
+// NewRestoresCmd creates the restores command
+func NewRestoresCmd() *cobra.Command {
+	var label string
+	var pinned bool
+
+	cmd := &cobra.Command{
+		Use:         "restores",
+		Short:       "List restores with their labels",
+		Annotations: jsonCommand(),
+		Long: `List the restores of the selected server, oldest first, with their labels and notes.
+Pinned restores are kept until unpinned, whatever the retention policy.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter := client.RestoreFilter{Label: label}
+			if cmd.Flags().Changed("pinned") {
+				filter.Pinned = &pinned
+			}
+			return runRestores(WithRestoresFilter(filter))
+		},
+	}
+
+	cmd.Flags().StringVar(&label, "label", "", "Only restores with this label")
+	cmd.Flags().BoolVar(&pinned, "pinned", false, "Only pinned restores (--pinned=false for unpinned ones)")
+
+	return cmd
+}
+
+func runRestores(opts ...RestoresOption) error {
+	// Apply options
+	options := &restoresOptions{
+		output: os.Stdout, // Default to stdout
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	// Get selected server (unless injected for testing)
+	var server *config.Server
+	var err error
+	if options.server != nil {
+		server = options.server
+	} else {
+		server, err = getSelectedServer()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create API client (or use injected one for testing)
+	var apiClient RestoresClient
+	if options.apiClient != nil {
+		apiClient = options.apiClient
+	} else {
+		apiClient = client.New(server.IP)
+	}
+
+	restores, err := apiClient.FindRestores(server.IP, options.filter)
+	if err != nil {
+		return err
+	}
+
+	if JSONOutput() {
+		if restores == nil {
+			restores = []client.Restore{}
+		}
+		return writeJSON(options.output, restores)
+	}
+	if Quiet() {
+		for _, restore := range restores {
+			fmt.Fprintln(options.output, restore.Name)
+		}
+		return nil
+	}
+
+	if len(restores) == 0 {
+		fmt.Fprintln(options.output, "No restores found.")
+		return nil
+	}
+
+	fmt.Fprintf(options.output, "Restores on %s (%s):\n\n", server.Alias, server.IP)
+
+	w := tabwriter.NewWriter(options.output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tLABEL\tPINNED\tBRANCHES\tCREATED AT\tNOTE")
+	fmt.Fprintln(w, "────\t─────\t─────\t──────\t────────\t──────────\t────")
+
+	for _, restore := range restores {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			restore.Name,
+			restore.State,
+			orDash(restore.Label),
+			pinnedMark(restore.Pinned),
+			len(restore.Branches),
+			restore.CreatedAt.Local().Format("2006-01-02 15:04"),
+			orDash(truncateNote(restore.Note)),
+		)
+	}
+
+	w.Flush()
+
+	return nil
+}
+
+// orDash returns "-" for empty table cells
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func pinnedMark(pinned bool) string {
+	if pinned {
+		return "yes"
+	}
+	return "-"
+}
+
+// truncateNote keeps a note on one line of the table
+func truncateNote(note string) string {
+	note = strings.Join(strings.Fields(note), " ")
+	if len([]rune(note)) > maxNoteWidth {
+		return string([]rune(note)[:maxNoteWidth-3]) + "..."
+	}
+	return note
+}
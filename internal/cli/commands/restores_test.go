@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+)
+
+// mockRestoresClient simulates the API client for listing restores
+type mockRestoresClient struct {
+	restores []client.Restore
+	filter   client.RestoreFilter
+	err      error
+}
+
+func (m *mockRestoresClient) FindRestores(serverIP string, filter client.RestoreFilter) ([]client.Restore, error) {
+	m.filter = filter
+	return m.restores, m.err
+}
+
+func TestRestoresCommand(t *testing.T) {
+	server := &config.Server{Alias: "test-server", IP: "192.168.1.100"}
+	created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	pinned := true
+	mockAPI := &mockRestoresClient{restores: []client.Restore{
+		{Name: "restore_20250301090000", State: "ready", CreatedAt: created, Label: "pre-migration-baseline", Pinned: true,
+			Note: "Taken before the orders\nmigration, keep until the rollout is done"},
+		{Name: "restore_20250302090000", State: "restoring", CreatedAt: created.Add(24 * time.Hour)},
+	}}
+
+	var output bytes.Buffer
+	err := runRestores(
+		WithRestoresClient(mockAPI),
+		WithRestoresServer(server),
+		WithRestoresOutput(&output),
+		WithRestoresFilter(client.RestoreFilter{Label: "pre-migration-baseline", Pinned: &pinned}),
+	)
+	if err != nil {
+		t.Fatalf("runRestores() error = %v", err)
+	}
+	if mockAPI.filter.Label != "pre-migration-baseline" || mockAPI.filter.Pinned == nil || !*mockAPI.filter.Pinned {
+		t.Errorf("filter = %+v, want the label and pinned", mockAPI.filter)
+	}
+
+	lines := strings.Split(output.String(), "\n")
+	var labeled, unlabeled string
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "restore_20250301090000"):
+			labeled = line
+		case strings.HasPrefix(line, "restore_20250302090000"):
+			unlabeled = line
+		}
+	}
+	for _, want := range []string{"pre-migration-baseline", "yes", "Taken before the orders migration, ke..."} {
+		if !strings.Contains(labeled, want) {
+			t.Errorf("labeled restore row %q is missing %q", labeled, want)
+		}
+	}
+	if fields := strings.Fields(unlabeled); len(fields) < 4 || fields[2] != "-" || fields[3] != "-" {
+		t.Errorf("unlabeled restore row = %q, want no label and not pinned", unlabeled)
+	}
+}
+
+func TestRestoresCommand_NoRestores(t *testing.T) {
+	server := &config.Server{Alias: "test-server", IP: "192.168.1.100"}
+
+	var output bytes.Buffer
+	if err := runRestores(WithRestoresClient(&mockRestoresClient{}), WithRestoresServer(server), WithRestoresOutput(&output)); err != nil {
+		t.Fatalf("runRestores() error = %v", err)
+	}
+	if !strings.Contains(output.String(), "No restores found") {
+		t.Errorf("output = %q, want no restores message", output.String())
+	}
+
+	failing := &mockRestoresClient{err: errors.New("not authenticated. Please run 'branchd login' first")}
+	if err := runRestores(WithRestoresClient(failing), WithRestoresServer(server), WithRestoresOutput(&output)); err == nil {
+		t.Error("runRestores() with a failing API succeeded")
+	}
+}
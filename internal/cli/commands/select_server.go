@@ -24,7 +24,7 @@ Examples:
   $ branchd select-server production   # Select by alias`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var ipOrAlias string
+			ipOrAlias := serverOverride()
 			if len(args) > 0 {
 				ipOrAlias = args[0]
 			}
@@ -50,6 +50,8 @@ func runSelectServer(ipOrAlias string) error {
 		if err != nil {
 			return err
 		}
+	} else if NonInteractive() {
+		return fmt.Errorf("server IP or alias is required in non-interactive mode")
 	} else {
 		// Show interactive selection
 		server, err = serverselect.PromptServerSelection(cfg)
@@ -0,0 +1,296 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// diskWarningPercent is the disk usage from which status flags the disk
+const diskWarningPercent = 85
+
+// StatusClient defines the interface for fetching the server status
+type StatusClient interface {
+	GetSystemInfo(serverIP string) (*client.SystemInfo, error)
+	ListRestores(serverIP string) ([]client.Restore, error)
+	ListBranches(serverIP string) ([]client.Branch, error)
+	GetConfig(serverIP string) (*client.Config, error)
+}
+
+// statusOptions allows dependency injection for testing
+type statusOptions struct {
+	apiClient StatusClient
+	server    *config.Server
+	output    io.Writer
+	now       func() time.Time
+}
+
+// StatusOption is a function that configures statusOptions
+type StatusOption func(*statusOptions)
+
+// WithStatusClient injects a custom API client (for testing)
+func WithStatusClient(client StatusClient) StatusOption {
+	return func(opts *statusOptions) {
+		opts.apiClient = client
+	}
+}
+
+// WithStatusServer injects a specific server (for testing)
+func WithStatusServer(server *config.Server) StatusOption {
+	return func(opts *statusOptions) {
+		opts.server = server
+	}
+}
+
+// WithStatusOutput injects a custom output writer (for testing)
+func WithStatusOutput(w io.Writer) StatusOption {
+	return func(opts *statusOptions) {
+		opts.output = w
+	}
+}
+
+// NewStatusCmd creates the status command
+func NewStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show a summary of the server's health",
+		Long: `Show disk usage, restore freshness, branches, the next scheduled refresh
+and failed tasks of the selected server at a glance.`,
+		Annotations: jsonCommand(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStatus()
+		},
+	}
+
+	return cmd
+}
+
+func runStatus(opts ...StatusOption) error {
+	// Apply options
+	options := &statusOptions{
+		output: os.Stdout, // Default to stdout
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	// Get selected server (unless injected for testing)
+	var server *config.Server
+	var err error
+	if options.server != nil {
+		server = options.server
+	} else {
+		server, err = getSelectedServer()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create API client (or use injected one for testing)
+	var apiClient StatusClient
+	if options.apiClient != nil {
+		apiClient = options.apiClient
+	} else {
+		apiClient = client.New(server.IP)
+	}
+
+	info, err := apiClient.GetSystemInfo(server.IP)
+	if err != nil {
+		return err
+	}
+	restores, err := apiClient.ListRestores(server.IP)
+	if err != nil {
+		return err
+	}
+	branches, err := apiClient.ListBranches(server.IP)
+	if err != nil {
+		return err
+	}
+	serverConfig, err := apiClient.GetConfig(server.IP)
+	if err != nil {
+		return err
+	}
+
+	now := options.now()
+
+	if JSONOutput() {
+		return writeJSON(options.output, newStatusReport(info, restores, branches, serverConfig))
+	}
+	if !Quiet() {
+		fmt.Fprintf(options.output, "Status of %s (%s):\n\n", server.Alias, server.IP)
+	}
+
+	w := tabwriter.NewWriter(options.output, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Version:\t%s\n", info.Version)
+	fmt.Fprintf(w, "Disk:\t%s\n", formatDiskStatus(info))
+	fmt.Fprintf(w, "Source database:\t%s\n", formatSourceStatus(info))
+	fmt.Fprintf(w, "Latest restore:\t%s\n", formatRestoreStatus(restores, now))
+	fmt.Fprintf(w, "Branches:\t%s\n", formatBranchStatus(branches))
+	fmt.Fprintf(w, "Next refresh:\t%s\n", formatNextRefresh(serverConfig, now))
+	fmt.Fprintf(w, "Failed tasks:\t%s\n", formatFailedTasks(info))
+	w.Flush()
+
+	return nil
+}
+
+// statusReport is the JSON output of status
+type statusReport struct {
+	System             *client.SystemInfo `json:"system"` // Includes the task queues of the failed tasks
+	LatestRestore      *client.Restore    `json:"latest_restore"`
+	RestoresInProgress int                `json:"restores_in_progress"`
+	Branches           int                `json:"branches"`
+	SuspendedBranches  int                `json:"suspended_branches"`
+	RefreshSchedule    string             `json:"refresh_schedule"`
+	NextRefreshAt      *time.Time         `json:"next_refresh_at"`
+}
+
+func newStatusReport(info *client.SystemInfo, restores []client.Restore, branches []client.Branch, serverConfig *client.Config) statusReport {
+	report := statusReport{
+		System:          info,
+		LatestRestore:   latestReadyRestore(restores),
+		Branches:        len(branches),
+		RefreshSchedule: serverConfig.RefreshSchedule,
+	}
+	for _, restore := range restores {
+		if restore.ClonedFromID == "" && !restore.Ready() {
+			report.RestoresInProgress++
+		}
+	}
+	for _, branch := range branches {
+		if branch.Suspended {
+			report.SuspendedBranches++
+		}
+	}
+	if serverConfig.RefreshSchedule != "" {
+		report.NextRefreshAt = serverConfig.NextRefreshAt
+	}
+	return report
+}
+
+func formatDiskStatus(info *client.SystemInfo) string {
+	status := fmt.Sprintf("%.1f of %.1f GB used (%.0f%%)", info.VM.DiskUsedGB, info.VM.DiskTotalGB, info.VM.DiskUsedPercent)
+	if info.VM.DiskUsedPercent >= diskWarningPercent {
+		status += " - running low, delete branches or lower max restores"
+	}
+	return status
+}
+
+func formatSourceStatus(info *client.SystemInfo) string {
+	source := info.SourceDatabase
+	if source == nil {
+		return "not configured"
+	}
+	if !source.Connected {
+		if source.Error != "" {
+			return "unreachable - " + source.Error
+		}
+		return "unreachable"
+	}
+	return fmt.Sprintf("%s (PostgreSQL %s, %.1f GB)", source.Name, source.Version, source.SizeGB)
+}
+
+// formatRestoreStatus describes the newest ready restore and any restore in progress
+func formatRestoreStatus(restores []client.Restore, now time.Time) string {
+	latest := latestReadyRestore(restores)
+	inProgress := 0
+	for _, restore := range restores {
+		if restore.ClonedFromID == "" && !restore.Ready() {
+			inProgress++
+		}
+	}
+
+	status := "none ready"
+	if latest != nil {
+		status = latest.Name
+		if latest.Label != "" {
+			status += " [" + latest.Label + "]"
+		}
+		status += fmt.Sprintf(", ready %s ago", formatAge(now.Sub(*latest.ReadyAt)))
+	}
+	if inProgress > 0 {
+		status += fmt.Sprintf(" (%d in progress)", inProgress)
+	}
+	return status
+}
+
+// latestReadyRestore returns the restore that became ready last, nil if none is ready
+// Clones are copies of existing restores, they don't tell how fresh the data is
+func latestReadyRestore(restores []client.Restore) *client.Restore {
+	var latest *client.Restore
+	for i := range restores {
+		restore := &restores[i]
+		if restore.ClonedFromID != "" || !restore.Ready() {
+			continue
+		}
+		if latest == nil || restore.ReadyAt.After(*latest.ReadyAt) {
+			latest = restore
+		}
+	}
+	return latest
+}
+
+func formatBranchStatus(branches []client.Branch) string {
+	suspended := 0
+	for _, branch := range branches {
+		if branch.Suspended {
+			suspended++
+		}
+	}
+
+	status := fmt.Sprintf("%d", len(branches))
+	if suspended > 0 {
+		status += fmt.Sprintf(" (%d suspended)", suspended)
+	}
+	return status
+}
+
+func formatNextRefresh(serverConfig *client.Config, now time.Time) string {
+	if serverConfig.RefreshSchedule == "" || serverConfig.NextRefreshAt == nil {
+		return "not scheduled"
+	}
+
+	next := *serverConfig.NextRefreshAt
+	if !next.After(now) {
+		return fmt.Sprintf("due since %s (%s)", formatAge(now.Sub(next)), serverConfig.RefreshSchedule)
+	}
+	return fmt.Sprintf("in %s (%s)", formatAge(next.Sub(now)), serverConfig.RefreshSchedule)
+}
+
+// formatFailedTasks counts tasks that exhausted their retries (archived) or are waiting to be retried
+func formatFailedTasks(info *client.SystemInfo) string {
+	if info.Redis == nil {
+		return "unknown (task queue unavailable)"
+	}
+
+	archived, retrying := 0, 0
+	for _, queue := range info.Redis.Queues {
+		archived += queue.Archived
+		retrying += queue.Retry
+	}
+
+	if archived == 0 && retrying == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d failed, %d retrying", archived, retrying)
+}
+
+// formatAge renders a duration in its largest whole unit (e.g. 3h, 2d)
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "<1m"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
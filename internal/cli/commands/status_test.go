@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+)
+
+// mockStatusClient simulates the API client for the status command
+type mockStatusClient struct {
+	info     *client.SystemInfo
+	restores []client.Restore
+	branches []client.Branch
+	config   *client.Config
+	failOn   string
+}
+
+func (m *mockStatusClient) GetSystemInfo(serverIP string) (*client.SystemInfo, error) {
+	if m.failOn == "info" {
+		return nil, errors.New("failed to get system info: connection refused")
+	}
+	return m.info, nil
+}
+
+func (m *mockStatusClient) ListRestores(serverIP string) ([]client.Restore, error) {
+	return m.restores, nil
+}
+
+func (m *mockStatusClient) ListBranches(serverIP string) ([]client.Branch, error) {
+	return m.branches, nil
+}
+
+func (m *mockStatusClient) GetConfig(serverIP string) (*client.Config, error) {
+	return m.config, nil
+}
+
+func withStatusNow(now time.Time) StatusOption {
+	return func(opts *statusOptions) {
+		opts.now = func() time.Time { return now }
+	}
+}
+
+// TestStatusCommand_Summary tests the aggregated status output
+func TestStatusCommand_Summary(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	oldReady := now.Add(-50 * time.Hour)
+	latestReady := now.Add(-3 * time.Hour)
+	nextRefresh := now.Add(90 * time.Minute)
+
+	mockAPI := &mockStatusClient{
+		info: &client.SystemInfo{
+			Version: "1.2.3",
+			VM:      branchd.VMMetrics{DiskTotalGB: 100, DiskUsedGB: 90, DiskUsedPercent: 90},
+			SourceDatabase: &branchd.DatabaseMetrics{
+				Name: "app", Version: "16.2", SizeGB: 12.5, Connected: true,
+			},
+			Redis: &branchd.RedisMetrics{Queues: []branchd.QueueMetrics{
+				{Queue: "default", Archived: 2, Retry: 1},
+				{Queue: "critical", Archived: 1},
+			}},
+		},
+		restores: []client.Restore{
+			{Name: "restore_20250227100000", ReadyAt: &oldReady},
+			{Name: "restore_20250301090000", ReadyAt: &latestReady, Label: "pre-migration"},
+			{Name: "restore_20250301110000"},
+			{Name: "restore_20250301115000", ClonedFromID: "r2"},
+		},
+		branches: []client.Branch{{Name: "a"}, {Name: "b", Suspended: true}},
+		config:   &client.Config{RefreshSchedule: "0 * * * *", NextRefreshAt: &nextRefresh},
+	}
+
+	var output bytes.Buffer
+	err := runStatus(
+		WithStatusClient(mockAPI),
+		WithStatusServer(&config.Server{Alias: "test-server", IP: "192.168.1.100"}),
+		WithStatusOutput(&output),
+		withStatusNow(now),
+	)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	outputStr := output.String()
+	expected := []string{
+		"Status of test-server (192.168.1.100)",
+		"1.2.3",
+		"90.0 of 100.0 GB used (90%) - running low",
+		"app (PostgreSQL 16.2, 12.5 GB)",
+		"restore_20250301090000 [pre-migration], ready 3h ago (1 in progress)",
+		"2 (1 suspended)",
+		"in 1h (0 * * * *)",
+		"3 failed, 1 retrying",
+	}
+	for _, want := range expected {
+		if !strings.Contains(outputStr, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, outputStr)
+		}
+	}
+}
+
+// TestStatusCommand_FreshServer tests a server without restores, schedule or failures
+func TestStatusCommand_FreshServer(t *testing.T) {
+	mockAPI := &mockStatusClient{
+		info: &client.SystemInfo{
+			VM:    branchd.VMMetrics{DiskTotalGB: 100, DiskUsedGB: 10, DiskUsedPercent: 10},
+			Redis: &branchd.RedisMetrics{},
+		},
+		config: &client.Config{},
+	}
+
+	var output bytes.Buffer
+	err := runStatus(
+		WithStatusClient(mockAPI),
+		WithStatusServer(&config.Server{Alias: "test-server", IP: "192.168.1.100"}),
+		WithStatusOutput(&output),
+	)
+	if err != nil {
+		t.Fatalf("expected success, got error: %v", err)
+	}
+
+	outputStr := output.String()
+	for _, want := range []string{"not configured", "none ready", "not scheduled", "Failed tasks:     none"} {
+		if !strings.Contains(outputStr, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, outputStr)
+		}
+	}
+	if strings.Contains(outputStr, "running low") {
+		t.Errorf("expected no disk warning, got:\n%s", outputStr)
+	}
+}
+
+// TestStatusCommand_APIError tests that API errors are returned
+func TestStatusCommand_APIError(t *testing.T) {
+	var output bytes.Buffer
+	err := runStatus(
+		WithStatusClient(&mockStatusClient{failOn: "info"}),
+		WithStatusServer(&config.Server{Alias: "test-server", IP: "192.168.1.100"}),
+		WithStatusOutput(&output),
+	)
+	if err == nil {
+		t.Fatal("expected error, got success")
+	}
+	if !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("expected connection error, got: %v", err)
+	}
+}
@@ -0,0 +1,385 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+	"github.com/spf13/cobra"
+)
+
+// BranchFileClient defines the interface for reconciling the branch declared in branchd.yaml
+type BranchFileClient interface {
+	ListBranches(serverIP string) ([]client.Branch, error)
+	ListRestores(serverIP string) ([]client.Restore, error)
+	CreateBranchWithSQL(serverIP, branchName, template, postBranchSQL string) (*client.CreateBranchResponse, error)
+	ApplyFixture(serverIP, branchID, fixtureName string) (*client.FixtureResult, error)
+	DeleteBranch(serverIP, branchID string) error
+}
+
+// branchFileOptions allows dependency injection for testing
+type branchFileOptions struct {
+	apiClient BranchFileClient
+	server    *config.Server
+	path      string                 // branchd.yaml, searched from the current directory when empty
+	vars      *config.BranchNameVars // Name template values, detected when nil
+	output    io.Writer              // Connection string
+	log       io.Writer              // Progress and hook output
+}
+
+// BranchFileOption is a function that configures branchFileOptions
+type BranchFileOption func(*branchFileOptions)
+
+// WithBranchFileClient injects a custom API client (for testing)
+func WithBranchFileClient(client BranchFileClient) BranchFileOption {
+	return func(opts *branchFileOptions) {
+		opts.apiClient = client
+	}
+}
+
+// WithBranchFileServer injects a specific server (for testing)
+func WithBranchFileServer(server *config.Server) BranchFileOption {
+	return func(opts *branchFileOptions) {
+		opts.server = server
+	}
+}
+
+// WithBranchFilePath uses a branch file instead of searching for branchd.yaml
+func WithBranchFilePath(path string) BranchFileOption {
+	return func(opts *branchFileOptions) {
+		opts.path = path
+	}
+}
+
+// WithBranchNameVars injects the name template values instead of detecting them (for testing)
+func WithBranchNameVars(vars config.BranchNameVars) BranchFileOption {
+	return func(opts *branchFileOptions) {
+		opts.vars = &vars
+	}
+}
+
+// WithBranchFileOutput injects custom output writers for the connection string and progress (for testing)
+func WithBranchFileOutput(output, log io.Writer) BranchFileOption {
+	return func(opts *branchFileOptions) {
+		opts.output = output
+		opts.log = log
+	}
+}
+
+// NewUpCmd creates the up command
+func NewUpCmd() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Create or rotate the branch declared in branchd.yaml",
+		Long: `Reconcile the branch declared in branchd.yaml (searched from the current
+directory upwards): create it if it's missing, rotate it (delete and create
+again) once a newer restore is ready or it's older than its ttl, and leave it
+alone otherwise. The connection string is printed on stdout, progress on stderr:
+
+  export DATABASE_URL=$(branchd up)
+
+Example branchd.yaml:
+
+  name: "{{.Project}}-{{.GitBranch}}"   # also {{.User}}
+  profile: dev-small                    # branch template on the server
+  ttl: 72h
+  seeds:
+    - sql: db/seeds.sql
+    - fixture: demo-orders
+  hooks:
+    post_create: ["bin/rails db:migrate"]
+    pre_delete: []`,
+		Args:        cobra.NoArgs,
+		Annotations: jsonCommand(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUp(WithBranchFilePath(file))
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Branch file to use instead of branchd.yaml")
+
+	return cmd
+}
+
+// NewDownCmd creates the down command
+func NewDownCmd() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:         "down",
+		Short:       "Delete the branch declared in branchd.yaml",
+		Long:        "Delete the branch declared in branchd.yaml after running its pre_delete hooks, nothing happens if it doesn't exist",
+		Args:        cobra.NoArgs,
+		Annotations: jsonCommand(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDown(WithBranchFilePath(file))
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Branch file to use instead of branchd.yaml")
+
+	return cmd
+}
+
+// Actions of up, in its JSON output
+const (
+	upActionCreated   = "created"
+	upActionRotated   = "rotated"
+	upActionUnchanged = "unchanged"
+)
+
+// upResult is the JSON output of up
+type upResult struct {
+	Branch        string `json:"branch"`
+	Action        string `json:"action"`
+	ConnectionURL string `json:"connection_url"`
+}
+
+// branchFileRun is the declared branch a command reconciles
+type branchFileRun struct {
+	options    *branchFileOptions
+	progress   io.Writer // The log without --quiet and --output json, hook output always goes to the log
+	file       *config.BranchFile
+	branchName string
+	server     *config.Server
+	apiClient  BranchFileClient
+}
+
+// loadBranchFileRun applies opts, loads the branch file and resolves the branch name, server and API client
+func loadBranchFileRun(opts []BranchFileOption) (*branchFileRun, error) {
+	options := &branchFileOptions{
+		output: os.Stdout,
+		log:    os.Stderr, // Keeps stdout to the connection string
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	path := options.path
+	if path == "" {
+		var err error
+		if path, err = config.FindBranchFile(); err != nil {
+			return nil, err
+		}
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve branch file path: %w", err)
+	}
+	file, err := config.LoadBranchFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := options.vars
+	if vars == nil {
+		detected := detectBranchNameVars(file.Dir())
+		vars = &detected
+	}
+	branchName, err := file.BranchName(*vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get selected server (unless injected for testing)
+	server := options.server
+	if server == nil {
+		if server, err = getSelectedServer(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create API client (or use injected one for testing)
+	var apiClient BranchFileClient
+	if options.apiClient != nil {
+		apiClient = options.apiClient
+	} else {
+		apiClient = client.New(server.IP)
+	}
+
+	progress := options.log
+	if Quiet() || JSONOutput() {
+		progress = io.Discard
+	}
+
+	return &branchFileRun{options: options, progress: progress, file: file, branchName: branchName, server: server, apiClient: apiClient}, nil
+}
+
+func runUp(opts ...BranchFileOption) error {
+	run, err := loadBranchFileRun(opts)
+	if err != nil {
+		return err
+	}
+	log := run.progress
+
+	existing, err := run.findBranch()
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		restores, err := run.apiClient.ListRestores(run.server.IP)
+		if err != nil {
+			return err
+		}
+		reason := staleReason(existing, restores, run.file.MaxAge(), time.Now())
+		if reason == "" {
+			fmt.Fprintf(log, "✓ Branch '%s' is up to date\n", run.branchName)
+			return run.printUp(upActionUnchanged, existing.ConnectionURL)
+		}
+
+		fmt.Fprintf(log, "Rotating branch '%s' (%s)...\n", run.branchName, reason)
+		if err := run.runHooks(run.file.Hooks.PreDelete, existing.ConnectionURL); err != nil {
+			return err
+		}
+		if err := run.apiClient.DeleteBranch(run.server.IP, existing.ID); err != nil {
+			return err
+		}
+	}
+
+	seedSQL, err := run.file.SeedSQL()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(log, "Creating branch '%s'...\n", run.branchName)
+	branch, err := run.apiClient.CreateBranchWithSQL(run.server.IP, run.branchName, run.file.Profile, seedSQL)
+	if err != nil {
+		return err
+	}
+
+	for _, fixture := range run.file.Fixtures() {
+		result, err := run.apiClient.ApplyFixture(run.server.IP, branch.ID, fixture)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(log, "Applied fixture '%s' (%d rows)\n", fixture, result.Rows)
+	}
+
+	connectionURL := connectionString(branch)
+	if err := run.runHooks(run.file.Hooks.PostCreate, connectionURL); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(log, "✓ Branch '%s' created\n", run.branchName)
+	action := upActionCreated
+	if existing != nil {
+		action = upActionRotated
+	}
+	return run.printUp(action, connectionURL)
+}
+
+// printUp prints the connection URL of the declared branch, or the result of up with --output json
+func (r *branchFileRun) printUp(action, connectionURL string) error {
+	if JSONOutput() {
+		return writeJSON(r.options.output, upResult{Branch: r.branchName, Action: action, ConnectionURL: connectionURL})
+	}
+	fmt.Fprintln(r.options.output, connectionURL)
+	return nil
+}
+
+func runDown(opts ...BranchFileOption) error {
+	run, err := loadBranchFileRun(opts)
+	if err != nil {
+		return err
+	}
+	log := run.progress
+
+	branch, err := run.findBranch()
+	if err != nil {
+		return err
+	}
+	if branch == nil {
+		fmt.Fprintf(log, "Branch '%s' doesn't exist, nothing to delete\n", run.branchName)
+		if JSONOutput() {
+			return writeJSON(run.options.output, deletedBranch{Name: run.branchName})
+		}
+		return nil
+	}
+
+	if err := run.runHooks(run.file.Hooks.PreDelete, branch.ConnectionURL); err != nil {
+		return err
+	}
+	if err := run.apiClient.DeleteBranch(run.server.IP, branch.ID); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(log, "✓ Branch '%s' deleted successfully\n", run.branchName)
+	if JSONOutput() {
+		return writeJSON(run.options.output, deletedBranch{ID: branch.ID, Name: run.branchName, Deleted: true})
+	}
+	return nil
+}
+
+// findBranch returns the declared branch, nil if it doesn't exist
+// Only names match: a rendered name that happens to be another branch's ID mustn't rotate it
+func (r *branchFileRun) findBranch() (*client.Branch, error) {
+	branches, err := r.apiClient.ListBranches(r.server.IP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	for i := range branches {
+		if branches[i].Name == r.branchName {
+			return &branches[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// runHooks runs hook commands with sh in the directory of the branch file, stopping at the first failure
+func (r *branchFileRun) runHooks(hooks []string, connectionURL string) error {
+	for _, hook := range hooks {
+		fmt.Fprintf(r.options.log, "Running hook: %s\n", hook)
+		cmd := exec.Command("sh", "-c", hook)
+		cmd.Dir = r.file.Dir()
+		cmd.Env = append(os.Environ(), "BRANCHD_BRANCH="+r.branchName, "BRANCHD_DATABASE_URL="+connectionURL)
+		cmd.Stdout = r.options.log
+		cmd.Stderr = r.options.log
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("hook %q failed: %w", hook, err)
+		}
+	}
+	return nil
+}
+
+// staleReason describes why an existing branch has to be rotated, empty if it's up to date:
+// a restore became ready after the branch was created from an older one, or the branch is older than maxAge
+func staleReason(branch *client.Branch, restores []client.Restore, maxAge time.Duration, now time.Time) string {
+	createdAt, err := time.Parse(time.RFC3339, branch.CreatedAt)
+	if err != nil {
+		return ""
+	}
+
+	if maxAge > 0 && now.Sub(createdAt) > maxAge {
+		return fmt.Sprintf("older than %s", maxAge)
+	}
+	if latest := latestReadyRestore(restores); latest != nil && latest.ID != branch.RestoreID && latest.ReadyAt.After(createdAt) {
+		return fmt.Sprintf("restore %s is newer", latest.Name)
+	}
+	return ""
+}
+
+// detectBranchNameVars returns the name template values for a branch file in dir
+func detectBranchNameVars(dir string) config.BranchNameVars {
+	vars := config.BranchNameVars{Project: filepath.Base(dir), User: os.Getenv("USER")}
+	if current, err := user.Current(); err == nil {
+		vars.User = current.Username
+	}
+
+	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+	cmd.Dir = dir
+	if out, err := cmd.Output(); err == nil {
+		// A detached HEAD has no branch name
+		if branch := strings.TrimSpace(string(out)); branch != "HEAD" {
+			vars.GitBranch = branch
+		}
+	}
+	return vars
+}
@@ -0,0 +1,224 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/cli/client"
+	"github.com/branchd-dev/branchd/internal/cli/config"
+)
+
+// mockBranchFileClient simulates the API client for the up and down commands
+type mockBranchFileClient struct {
+	branches []client.Branch
+	restores []client.Restore
+
+	created       string // Name of the created branch
+	template      string
+	postBranchSQL string
+	fixtures      []string
+	deleted       []string // Deleted branch IDs
+}
+
+func (m *mockBranchFileClient) ListBranches(serverIP string) ([]client.Branch, error) {
+	return m.branches, nil
+}
+
+func (m *mockBranchFileClient) ListRestores(serverIP string) ([]client.Restore, error) {
+	return m.restores, nil
+}
+
+func (m *mockBranchFileClient) CreateBranchWithSQL(serverIP, branchName, template, postBranchSQL string) (*client.CreateBranchResponse, error) {
+	m.created, m.template, m.postBranchSQL = branchName, template, postBranchSQL
+	return &client.CreateBranchResponse{ID: "new-id", User: "u", Password: "p", Host: "10.0.0.1", Port: 15432, Database: "app"}, nil
+}
+
+func (m *mockBranchFileClient) ApplyFixture(serverIP, branchID, fixtureName string) (*client.FixtureResult, error) {
+	if branchID != "new-id" {
+		return nil, fmt.Errorf("fixture applied to %s", branchID)
+	}
+	m.fixtures = append(m.fixtures, fixtureName)
+	return &client.FixtureResult{Rows: 100}, nil
+}
+
+func (m *mockBranchFileClient) DeleteBranch(serverIP, branchID string) error {
+	m.deleted = append(m.deleted, branchID)
+	return nil
+}
+
+// upTestFile writes a branchd.yaml whose post_create hook records the branch it ran for
+func upTestFile(t *testing.T) (path, hookOutput string) {
+	t.Helper()
+	dir := t.TempDir()
+	hookOutput = filepath.Join(dir, "hook.out")
+	content := `name: "{{.Project}}-{{.GitBranch}}"
+profile: dev-small
+ttl: 24h
+seeds:
+  - sql: seeds.sql
+  - fixture: demo-orders
+hooks:
+  post_create: ["echo \"$BRANCHD_BRANCH $BRANCHD_DATABASE_URL\" > hook.out"]
+  pre_delete: ["echo deleting $BRANCHD_BRANCH"]
+`
+	for name, data := range map[string]string{config.BranchFileName: content, "seeds.sql": "INSERT INTO users VALUES (1);\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, config.BranchFileName), hookOutput
+}
+
+func upTestOptions(path string, mockAPI *mockBranchFileClient, output, log *bytes.Buffer) []BranchFileOption {
+	return []BranchFileOption{
+		WithBranchFileClient(mockAPI),
+		WithBranchFileServer(&config.Server{IP: "1.2.3.4", Alias: "test"}),
+		WithBranchFilePath(path),
+		WithBranchNameVars(config.BranchNameVars{Project: "shop", GitBranch: "feature/login"}),
+		WithBranchFileOutput(output, log),
+	}
+}
+
+// TestUpCommand_CreatesMissingBranch tests a missing branch is created with its profile, seeds and hooks
+func TestUpCommand_CreatesMissingBranch(t *testing.T) {
+	path, hookOutput := upTestFile(t)
+	mockAPI := &mockBranchFileClient{branches: []client.Branch{{ID: "shop-feature-login", Name: "other"}}}
+
+	var output, log bytes.Buffer
+	if err := runUp(upTestOptions(path, mockAPI, &output, &log)...); err != nil {
+		t.Fatalf("runUp() error = %v\n%s", err, log.String())
+	}
+
+	if mockAPI.created != "shop-feature-login" || mockAPI.template != "dev-small" || mockAPI.postBranchSQL != "INSERT INTO users VALUES (1);\n" {
+		t.Errorf("created %q from %q with SQL %q", mockAPI.created, mockAPI.template, mockAPI.postBranchSQL)
+	}
+	if len(mockAPI.fixtures) != 1 || mockAPI.fixtures[0] != "demo-orders" || len(mockAPI.deleted) != 0 {
+		t.Errorf("fixtures %v, deleted %v, want demo-orders applied and nothing deleted", mockAPI.fixtures, mockAPI.deleted)
+	}
+
+	wantURL := "postgresql://u:p@10.0.0.1:15432/app"
+	if output.String() != wantURL+"\n" {
+		t.Errorf("output = %q, want only the connection string", output.String())
+	}
+	hook, err := os.ReadFile(hookOutput)
+	if err != nil || string(hook) != "shop-feature-login "+wantURL+"\n" {
+		t.Errorf("post_create hook wrote %q (%v)", hook, err)
+	}
+}
+
+// TestUpCommand_ExistingBranch tests an existing branch is kept while fresh and rotated once stale
+func TestUpCommand_ExistingBranch(t *testing.T) {
+	now := time.Now()
+	restoreReady := now.Add(-2 * time.Hour)
+	newerReady := now.Add(-time.Minute)
+
+	tests := []struct {
+		name       string
+		createdAt  time.Time
+		restores   []client.Restore
+		wantRotate string
+	}{
+		{name: "fresh", createdAt: now.Add(-time.Hour), restores: []client.Restore{{ID: "r1", ReadyAt: &restoreReady}}},
+		{name: "older than ttl", createdAt: now.Add(-25 * time.Hour), restores: []client.Restore{{ID: "r1", ReadyAt: &restoreReady}}, wantRotate: "older than 24h0m0s"},
+		{name: "newer restore", createdAt: now.Add(-time.Hour), restores: []client.Restore{{ID: "r1", ReadyAt: &restoreReady}, {ID: "r2", Name: "restore_2", ReadyAt: &newerReady}}, wantRotate: "restore restore_2 is newer"},
+		{name: "newer clone", createdAt: now.Add(-time.Hour), restores: []client.Restore{{ID: "r1", ReadyAt: &restoreReady}, {ID: "r2", ReadyAt: &newerReady, ClonedFromID: "r1"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, _ := upTestFile(t)
+			mockAPI := &mockBranchFileClient{
+				branches: []client.Branch{{ID: "b1", Name: "shop-feature-login", RestoreID: "r1", CreatedAt: tt.createdAt.Format(time.RFC3339), ConnectionURL: "postgresql://existing"}},
+				restores: tt.restores,
+			}
+
+			var output, log bytes.Buffer
+			if err := runUp(upTestOptions(path, mockAPI, &output, &log)...); err != nil {
+				t.Fatalf("runUp() error = %v\n%s", err, log.String())
+			}
+
+			if tt.wantRotate == "" {
+				if mockAPI.created != "" || len(mockAPI.deleted) != 0 || output.String() != "postgresql://existing\n" {
+					t.Errorf("up-to-date branch: created %q, deleted %v, output %q", mockAPI.created, mockAPI.deleted, output.String())
+				}
+				return
+			}
+			if len(mockAPI.deleted) != 1 || mockAPI.deleted[0] != "b1" || mockAPI.created != "shop-feature-login" {
+				t.Errorf("stale branch: deleted %v, created %q, want b1 rotated", mockAPI.deleted, mockAPI.created)
+			}
+			if !strings.Contains(log.String(), tt.wantRotate) || !strings.Contains(log.String(), "deleting shop-feature-login") {
+				t.Errorf("log doesn't report %q and the pre_delete hook:\n%s", tt.wantRotate, log.String())
+			}
+		})
+	}
+}
+
+// TestUpCommand_FailingHook tests a failing hook fails the command
+func TestUpCommand_FailingHook(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, config.BranchFileName)
+	if err := os.WriteFile(path, []byte("name: app\nhooks:\n  post_create: [\"exit 3\"]\n"), 0o644); err != nil {
+		t.Fatalf("failed to write branch file: %v", err)
+	}
+
+	var output, log bytes.Buffer
+	err := runUp(upTestOptions(path, &mockBranchFileClient{}, &output, &log)...)
+	if err == nil || !strings.Contains(err.Error(), `hook "exit 3" failed`) {
+		t.Errorf("runUp() error = %v, want the hook failure", err)
+	}
+	if output.Len() != 0 {
+		t.Errorf("output = %q, want no connection string", output.String())
+	}
+}
+
+// TestDownCommand tests down deletes the declared branch and succeeds when it doesn't exist
+func TestDownCommand(t *testing.T) {
+	path, _ := upTestFile(t)
+	mockAPI := &mockBranchFileClient{branches: []client.Branch{{ID: "b1", Name: "shop-feature-login"}, {ID: "b2", Name: "shop-main"}}}
+
+	var output, log bytes.Buffer
+	if err := runDown(upTestOptions(path, mockAPI, &output, &log)...); err != nil {
+		t.Fatalf("runDown() error = %v", err)
+	}
+	if len(mockAPI.deleted) != 1 || mockAPI.deleted[0] != "b1" || !strings.Contains(log.String(), "deleting shop-feature-login") {
+		t.Errorf("deleted %v, log:\n%s", mockAPI.deleted, log.String())
+	}
+
+	mockAPI.branches = nil
+	if err := runDown(upTestOptions(path, mockAPI, &output, &log)...); err != nil {
+		t.Fatalf("runDown() without the branch error = %v", err)
+	}
+	if len(mockAPI.deleted) != 1 {
+		t.Errorf("deleted %v, want nothing deleted without the branch", mockAPI.deleted)
+	}
+}
+
+// TestUpCommand_JSONOutput tests --output json prints the result without progress, hook output is kept
+func TestUpCommand_JSONOutput(t *testing.T) {
+	setOutputFlags(t, OutputJSON, false)
+	path, _ := upTestFile(t)
+	mockAPI := &mockBranchFileClient{}
+
+	var output, log bytes.Buffer
+	if err := runUp(upTestOptions(path, mockAPI, &output, &log)...); err != nil {
+		t.Fatalf("runUp() error = %v\n%s", err, log.String())
+	}
+
+	var result upResult
+	if err := json.Unmarshal(output.Bytes(), &result); err != nil {
+		t.Fatalf("output isn't JSON: %v\n%s", err, output.String())
+	}
+	want := upResult{Branch: "shop-feature-login", Action: upActionCreated, ConnectionURL: "postgresql://u:p@10.0.0.1:15432/app"}
+	if result != want {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+	if strings.Contains(log.String(), "Creating branch") || !strings.Contains(log.String(), "Running hook") {
+		t.Errorf("log should only hold hook output, got:\n%s", log.String())
+	}
+}
@@ -12,7 +12,7 @@ import (
 func NewUpdateConfigCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "update-config",
-		Short: "Update configuration (anon rules, post-restore SQL) on all servers",
+		Short: "Update configuration (anon rules, post-restore SQL) on all servers (or only --server)",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runUpdateConfig()
 		},
@@ -28,8 +28,9 @@ func runUpdateConfig() error {
 		return fmt.Errorf("failed to load config: %w\nRun 'branchd init' to create a configuration file", err)
 	}
 
-	if len(cfg.Servers) == 0 {
-		return fmt.Errorf("no servers configured. Run 'branchd init' to add a server")
+	servers, err := getTargetServers(cfg)
+	if err != nil {
+		return err
 	}
 
 	// Check if there's anything to update
@@ -45,16 +46,20 @@ func runUpdateConfig() error {
 	if hasAnonRules {
 		for _, rule := range cfg.AnonRules {
 			rules = append(rules, client.AnonRule{
-				Table:    rule.Table,
-				Column:   rule.Column,
-				Template: rule.Template,
-				Type:     rule.Type,
+				Table:           rule.Table,
+				Column:          rule.Column,
+				JSONPath:        rule.JSONPath,
+				Template:        rule.Template,
+				Type:            rule.Type,
+				Function:        rule.Function,
+				FunctionOptions: rule.FunctionOptions,
+				Consistent:      rule.Consistent,
 			})
 		}
 	}
 
-	// Update all servers
-	for _, server := range cfg.Servers {
+	// Update all servers (or the --server one)
+	for _, server := range servers {
 		if server.IP == "" {
 			continue
 		}
@@ -12,7 +12,7 @@ import (
 func NewUpdateServerCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "update-server",
-		Short: "Update all branchd servers version",
+		Short: "Update all branchd servers version (or only --server)",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runUpdateServer()
 		},
@@ -28,12 +28,13 @@ func runUpdateServer() error {
 		return fmt.Errorf("failed to load config: %w\nRun 'branchd init' to create a configuration file", err)
 	}
 
-	if len(cfg.Servers) == 0 {
-		return fmt.Errorf("no servers configured. Run 'branchd init' to add a server")
+	servers, err := getTargetServers(cfg)
+	if err != nil {
+		return err
 	}
 
-	// Update all servers
-	for _, server := range cfg.Servers {
+	// Update all servers (or the --server one)
+	for _, server := range servers {
 		if server.IP == "" {
 			fmt.Printf("Skipping server '%s' (no IP configured)\n", server.Alias)
 			continue
@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// NewVersionCmd creates the version command
+func NewVersionCmd(version string) *cobra.Command {
+	return &cobra.Command{
+		Use:         "version",
+		Short:       "Show version",
+		Annotations: jsonCommand(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch {
+			case JSONOutput():
+				return writeJSON(os.Stdout, map[string]string{"version": version})
+			case Quiet():
+				fmt.Println(version)
+			default:
+				fmt.Printf("branchd version %s\n", version)
+			}
+			return nil
+		},
+	}
+}
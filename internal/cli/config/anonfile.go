@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/branchd-dev/branchd/pkg/branchd"
+	"gopkg.in/yaml.v3"
+)
+
+// AnonFileName is the default anonymization rules file, see `branchd anon apply`
+const AnonFileName = "anon.yaml"
+
+// AnonFile declares all the anonymization rules of a server, kept in version control next to migrations
+type AnonFile struct {
+	Rules []AnonFileRule `yaml:"rules"`
+}
+
+// AnonFileRule is an anonymization rule, see branchd.AnonRuleInput
+type AnonFileRule struct {
+	Table  string `yaml:"table"`
+	Column string `yaml:"column"`
+
+	// Optional: replace this field of a jsonb column (e.g. "contact.email") instead of the whole column
+	JSONPath string `yaml:"json_path,omitempty"`
+
+	// Scalar template value (e.g. "user_${index}@example.com", 0, true, null), required unless Function is set
+	Template yaml.Node `yaml:"template,omitempty"`
+	Type     string    `yaml:"type,omitempty"` // Optional: "text", "integer", "boolean", "null", "date", "timestamp", "uuid"
+
+	// Optional built-in function and its arguments (see branchd.AnonFunctionOptions)
+	Function        string         `yaml:"function,omitempty"`
+	FunctionOptions map[string]any `yaml:"function_options,omitempty"`
+
+	// Optional: the same value gets the same output in every table, rules meant to match use the same salt
+	Consistent bool `yaml:"consistent,omitempty"`
+}
+
+// LoadAnonFile reads and checks an anonymization rules file
+func LoadAnonFile(path string) (*AnonFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var file AnonFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if _, err := file.Inputs(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// Inputs converts the rules to API rule inputs
+func (f *AnonFile) Inputs() ([]branchd.AnonRuleInput, error) {
+	inputs := make([]branchd.AnonRuleInput, 0, len(f.Rules))
+	seen := make(map[string]bool)
+	for i, rule := range f.Rules {
+		if rule.Table == "" || rule.Column == "" {
+			return nil, fmt.Errorf("rule %d: table and column are required", i+1)
+		}
+		key := rule.Table + "." + rule.Column
+		if rule.JSONPath != "" {
+			key += "->" + rule.JSONPath
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("rule %d: %s already has a rule, a column or JSON field can only have one", i+1, key)
+		}
+		seen[key] = true
+
+		input := branchd.AnonRuleInput{
+			Table:      rule.Table,
+			Column:     rule.Column,
+			JSONPath:   rule.JSONPath,
+			Type:       rule.Type,
+			Function:   rule.Function,
+			Consistent: rule.Consistent,
+		}
+
+		// A missing template has no kind, unlike "template: null"
+		if rule.Template.Kind != 0 {
+			if rule.Template.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("rule %d (%s): template must be a text, number, boolean or null", i+1, key)
+			}
+			var value any
+			if err := rule.Template.Decode(&value); err != nil {
+				return nil, fmt.Errorf("rule %d (%s): invalid template: %w", i+1, key, err)
+			}
+			template, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d (%s): invalid template: %w", i+1, key, err)
+			}
+			input.Template = template
+		}
+
+		if rule.FunctionOptions != nil {
+			options, err := parseAnonFunctionOptions(rule.FunctionOptions)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d (%s): invalid function_options: %w", i+1, key, err)
+			}
+			input.FunctionOptions = options
+		}
+
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+// parseAnonFunctionOptions converts YAML function options, rejecting unknown ones (e.g. typos)
+func parseAnonFunctionOptions(values map[string]any) (*branchd.AnonFunctionOptions, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var options branchd.AnonFunctionOptions
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&options); err != nil {
+		return nil, err
+	}
+	return &options, nil
+}
+
+// NewAnonFile returns the file declaring rules, applying it leaves them unchanged
+func NewAnonFile(rules []branchd.AnonRule) (*AnonFile, error) {
+	file := &AnonFile{Rules: make([]AnonFileRule, 0, len(rules))}
+	for _, rule := range rules {
+		fileRule := AnonFileRule{
+			Table:      rule.Table,
+			Column:     rule.Column,
+			JSONPath:   rule.JSONPath,
+			Function:   rule.Function,
+			Consistent: rule.Consistent,
+		}
+
+		if rule.Function != "" {
+			if rule.ColumnType != "text" {
+				fileRule.Type = rule.ColumnType
+			}
+		} else {
+			fileRule.Template, fileRule.Type = anonTemplateNode(rule.Template, rule.ColumnType)
+		}
+
+		// Template rules can have options too, e.g. the salt of a consistent rule
+		options, err := anonFunctionOptionValues(rule.FunctionOptions)
+		if err != nil {
+			return nil, err
+		}
+		fileRule.FunctionOptions = options
+
+		file.Rules = append(file.Rules, fileRule)
+	}
+	return file, nil
+}
+
+// Marshal returns the file's YAML
+func (f *AnonFile) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(f); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// anonTemplateNode returns a stored template as YAML, with the type only when the value doesn't imply it
+func anonTemplateNode(template, columnType string) (yaml.Node, string) {
+	switch columnType {
+	case "null":
+		return yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, ""
+	case "integer":
+		if _, err := strconv.ParseInt(template, 10, 64); err == nil {
+			return yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: template}, ""
+		}
+	case "boolean":
+		if template == "true" || template == "false" {
+			return yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: template}, ""
+		}
+	case "text":
+		return yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: template}, ""
+	}
+	return yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: template}, columnType
+}
+
+// anonFunctionOptionValues returns the set function options, nil if there are none
+func anonFunctionOptionValues(options branchd.AnonFunctionOptions) (map[string]any, error) {
+	data, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values, nil
+}
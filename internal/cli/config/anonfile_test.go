@@ -0,0 +1,165 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/pkg/branchd"
+)
+
+func TestLoadAnonFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string // JSON templates, "" when there is none
+		wantErr string
+	}{
+		{
+			name: "scalar templates and functions",
+			content: `rules:
+  - table: users
+    column: email
+    template: "user_${index}@example.com"
+  - table: users
+    column: age
+    template: 42
+  - table: users
+    column: active
+    template: true
+  - table: users
+    column: api_token
+    template: null
+  - table: orders
+    column: card_number
+    function: mask
+    function_options:
+      keep_last: 4
+`,
+			want: []string{`"user_${index}@example.com"`, `42`, `true`, `null`, ``},
+		},
+		{
+			name:    "unknown field",
+			content: "rules:\n  - table: users\n    column: email\n    templat: x\n",
+			wantErr: "field templat not found",
+		},
+		{
+			name:    "unknown function option",
+			content: "rules:\n  - table: users\n    column: email\n    function: mask\n    function_options:\n      keeplast: 4\n",
+			wantErr: "invalid function_options",
+		},
+		{
+			name:    "duplicate column",
+			content: "rules:\n  - table: users\n    column: email\n    template: x\n  - table: users\n    column: email\n    function: fake_email\n",
+			wantErr: "users.email already has a rule",
+		},
+		{
+			name:    "list template",
+			content: "rules:\n  - table: users\n    column: email\n    template: [x]\n",
+			wantErr: "template must be",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), AnonFileName)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			file, err := LoadAnonFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadAnonFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadAnonFile() error = %v", err)
+			}
+
+			inputs, err := file.Inputs()
+			if err != nil {
+				t.Fatalf("Inputs() error = %v", err)
+			}
+			if len(inputs) != len(tt.want) {
+				t.Fatalf("Inputs() = %d rules, want %d", len(inputs), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if string(inputs[i].Template) != want {
+					t.Errorf("rule %d template = %s, want %s", i, inputs[i].Template, want)
+				}
+			}
+			if last := inputs[len(inputs)-1]; last.FunctionOptions == nil || last.FunctionOptions.KeepLast != 4 {
+				t.Errorf("mask options = %+v, want keep_last 4", last.FunctionOptions)
+			}
+		})
+	}
+}
+
+// TestNewAnonFile tests exported rules parse back to the same rules
+func TestNewAnonFile(t *testing.T) {
+	fallback := "unknown"
+	rules := []branchd.AnonRule{
+		{Table: "users", Column: "email", Template: "user_${index}@example.com", ColumnType: "text"},
+		{Table: "users", Column: "age", Template: "42", ColumnType: "integer"},
+		{Table: "users", Column: "score", Template: "1.500000", ColumnType: "integer"},
+		{Table: "users", Column: "active", Template: "false", ColumnType: "boolean"},
+		{Table: "users", Column: "zip", Template: "01234", ColumnType: "text"},
+		{Table: "users", Column: "api_token", ColumnType: "null"},
+		{Table: "users", Column: "country", ColumnType: "text", Function: "lookup",
+			FunctionOptions: branchd.AnonFunctionOptions{Mapping: map[string]string{"FR": "DE"}, Default: &fallback}},
+		{Table: "orders", Column: "card_id", ColumnType: "integer", Function: "md5"},
+		{Table: "orders", Column: "customer_email", Template: "user_${index}@example.com", ColumnType: "text", Consistent: true,
+			FunctionOptions: branchd.AnonFunctionOptions{Salt: "s3cret"}},
+	}
+
+	file, err := NewAnonFile(rules)
+	if err != nil {
+		t.Fatalf("NewAnonFile() error = %v", err)
+	}
+	data, err := file.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), "template: 42\n") || !strings.Contains(string(data), "template: null\n") {
+		t.Errorf("Marshal() should write templates as plain YAML scalars:\n%s", data)
+	}
+
+	path := filepath.Join(t.TempDir(), AnonFileName)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	loaded, err := LoadAnonFile(path)
+	if err != nil {
+		t.Fatalf("LoadAnonFile() error = %v\n%s", err, data)
+	}
+	inputs, err := loaded.Inputs()
+	if err != nil {
+		t.Fatalf("Inputs() error = %v", err)
+	}
+
+	want := []struct{ template, typ string }{
+		{`"user_${index}@example.com"`, ""},
+		{`42`, ""},
+		{`"1.500000"`, "integer"},
+		{`false`, ""},
+		{`"01234"`, ""},
+		{`null`, ""},
+		{``, ""},
+		{``, "integer"},
+		{`"user_${index}@example.com"`, ""},
+	}
+	for i, input := range inputs {
+		if string(input.Template) != want[i].template || input.Type != want[i].typ {
+			t.Errorf("rule %d = template %s type %q, want template %s type %q", i, input.Template, input.Type, want[i].template, want[i].typ)
+		}
+	}
+	if last := inputs[8]; !last.Consistent || last.FunctionOptions == nil || last.FunctionOptions.Salt != "s3cret" {
+		t.Errorf("consistent rule = %+v, want consistent with its salt", last)
+	}
+	if options := inputs[6].FunctionOptions; options == nil || options.Mapping["FR"] != "DE" || options.Default == nil || *options.Default != fallback {
+		t.Errorf("lookup options = %+v, want the mapping and default kept", options)
+	}
+}
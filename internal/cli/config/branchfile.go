@@ -0,0 +1,164 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/branchd-dev/branchd/pkg/branchd"
+	"gopkg.in/yaml.v3"
+)
+
+// BranchFileName is the declarative branch definition of a project repository, see `branchd up`
+const BranchFileName = "branchd.yaml"
+
+// BranchFile declares the branch a project works against, like a service in docker-compose.yml
+type BranchFile struct {
+	// Name template of the branch, e.g. "{{.Project}}-{{.GitBranch}}" (see BranchNameVars)
+	Name string `yaml:"name"`
+
+	// Branch template on the server the branch is created from (resources, settings, post-branch SQL and TTL)
+	Profile string `yaml:"profile,omitempty"`
+
+	// Age after which `branchd up` rotates the branch (e.g. "72h"), empty = only when a newer restore is ready
+	TTL string `yaml:"ttl,omitempty"`
+
+	Seeds []BranchSeed `yaml:"seeds,omitempty"`
+	Hooks BranchHooks  `yaml:"hooks,omitempty"`
+
+	dir string        // Directory of the file, seed files and hooks are relative to it
+	ttl time.Duration // Parsed TTL
+}
+
+// BranchSeed loads data into a created branch: a SQL file or a fixture stored on the server
+type BranchSeed struct {
+	SQL     string `yaml:"sql,omitempty"`     // File run with the post-branch SQL, the branch isn't created if it fails
+	Fixture string `yaml:"fixture,omitempty"` // Fixture name, applied once the branch is created
+}
+
+// BranchHooks are shell commands run in the directory of branchd.yaml
+// BRANCHD_BRANCH and BRANCHD_DATABASE_URL are set to the branch name and its connection string
+type BranchHooks struct {
+	PostCreate []string `yaml:"post_create,omitempty"` // After `branchd up` created the branch, e.g. migrations
+	PreDelete  []string `yaml:"pre_delete,omitempty"`  // Before `branchd up` rotates or `branchd down` deletes it
+}
+
+// BranchNameVars are the values the name template can use
+type BranchNameVars struct {
+	GitBranch string // Checked out git branch, empty outside a repository
+	User      string // Local user name
+	Project   string // Name of the directory holding branchd.yaml
+}
+
+// FindBranchFile searches for branchd.yaml in current directory and parent directories
+func FindBranchFile() (string, error) {
+	return findFile(BranchFileName)
+}
+
+// LoadBranchFile reads and validates a branch definition
+func LoadBranchFile(path string) (*BranchFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read branch file: %w", err)
+	}
+
+	var file BranchFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true) // Misspelled keys would silently be ignored
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if file.Name == "" {
+		return nil, fmt.Errorf("%s: name is required", path)
+	}
+	if _, err := template.New("name").Parse(file.Name); err != nil {
+		return nil, fmt.Errorf("%s: invalid name template: %w", path, err)
+	}
+	if file.TTL != "" {
+		if file.ttl, err = time.ParseDuration(file.TTL); err != nil || file.ttl <= 0 {
+			return nil, fmt.Errorf("%s: invalid ttl %q, must be a positive duration like 72h", path, file.TTL)
+		}
+	}
+	for i, seed := range file.Seeds {
+		if (seed.SQL == "") == (seed.Fixture == "") {
+			return nil, fmt.Errorf("%s: seed %d must set exactly one of sql or fixture", path, i+1)
+		}
+	}
+
+	file.dir = filepath.Dir(path)
+	return &file, nil
+}
+
+// Dir returns the directory of the branch file, hooks run in it
+func (f *BranchFile) Dir() string {
+	return f.dir
+}
+
+// MaxAge returns the age after which the branch is rotated, 0 = no limit
+func (f *BranchFile) MaxAge() time.Duration {
+	return f.ttl
+}
+
+// BranchName renders the name template, normalized like the server does (branchd.NormalizeBranchName, e.g. the
+// slash of "feature/login" becomes -) and shortened to 50 characters
+func (f *BranchFile) BranchName(vars BranchNameVars) (string, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(f.Name)
+	if err != nil {
+		return "", fmt.Errorf("invalid name template: %w", err)
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, vars); err != nil {
+		return "", fmt.Errorf("failed to render name template: %w", err)
+	}
+
+	name := branchd.NormalizeBranchName(rendered.String())
+	if len(name) > branchd.MaxBranchNameLength {
+		name = strings.TrimRight(name[:branchd.MaxBranchNameLength], "-_")
+	}
+	if name == "" {
+		return "", fmt.Errorf("name template %q renders an empty branch name", f.Name)
+	}
+	if err := branchd.ValidateBranchName(name); err != nil {
+		return "", fmt.Errorf("name template %q: %w", f.Name, err)
+	}
+	return name, nil
+}
+
+// SeedSQL returns the SQL seed files joined in declaration order, empty without SQL seeds
+func (f *BranchFile) SeedSQL() (string, error) {
+	var sql strings.Builder
+	for _, seed := range f.Seeds {
+		if seed.SQL == "" {
+			continue
+		}
+		path := seed.SQL
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(f.dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read seed: %w", err)
+		}
+		sql.Write(data)
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			sql.WriteString("\n")
+		}
+	}
+	return sql.String(), nil
+}
+
+// Fixtures returns the names of the fixture seeds in declaration order
+func (f *BranchFile) Fixtures() []string {
+	var fixtures []string
+	for _, seed := range f.Seeds {
+		if seed.Fixture != "" {
+			fixtures = append(fixtures, seed.Fixture)
+		}
+	}
+	return fixtures
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeBranchFile writes branchd.yaml and extra files into a temp directory, returns the branchd.yaml path
+func writeBranchFile(t *testing.T, content string, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	path := filepath.Join(dir, BranchFileName)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write branch file: %v", err)
+	}
+	return path
+}
+
+func TestLoadBranchFile(t *testing.T) {
+	path := writeBranchFile(t, `
+name: "{{.Project}}-{{.GitBranch}}"
+profile: dev-small
+ttl: 72h
+seeds:
+  - sql: db/users.sql
+  - fixture: demo-orders
+  - sql: db/orders.sql
+hooks:
+  post_create: ["bin/migrate"]
+`, map[string]string{
+		"db/users.sql":  "INSERT INTO users VALUES (1);",
+		"db/orders.sql": "INSERT INTO orders VALUES (1);\n",
+	})
+
+	file, err := LoadBranchFile(path)
+	if err != nil {
+		t.Fatalf("LoadBranchFile() error = %v", err)
+	}
+	if file.Profile != "dev-small" || file.MaxAge() != 72*time.Hour || file.Dir() != filepath.Dir(path) || len(file.Hooks.PostCreate) != 1 {
+		t.Errorf("LoadBranchFile() = %+v", file)
+	}
+
+	sql, err := file.SeedSQL()
+	if err != nil {
+		t.Fatalf("SeedSQL() error = %v", err)
+	}
+	if sql != "INSERT INTO users VALUES (1);\nINSERT INTO orders VALUES (1);\n" {
+		t.Errorf("SeedSQL() = %q, want the SQL seeds in declaration order", sql)
+	}
+	if fixtures := file.Fixtures(); len(fixtures) != 1 || fixtures[0] != "demo-orders" {
+		t.Errorf("Fixtures() = %v, want [demo-orders]", fixtures)
+	}
+}
+
+func TestLoadBranchFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "missing name", content: "profile: dev\n", wantErr: "name is required"},
+		{name: "unknown key", content: "name: app\nttls: 1h\n", wantErr: "field ttls not found"},
+		{name: "invalid template", content: "name: \"{{.Project\"\n", wantErr: "invalid name template"},
+		{name: "invalid ttl", content: "name: app\nttl: 3d\n", wantErr: "invalid ttl"},
+		{name: "seed with both", content: "name: app\nseeds:\n  - sql: a.sql\n    fixture: b\n", wantErr: "seed 1 must set exactly one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadBranchFile(writeBranchFile(t, tt.content, nil))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadBranchFile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBranchFileBranchName(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		vars     BranchNameVars
+		want     string
+		wantErr  bool
+	}{
+		{name: "git branch with slash", template: "{{.Project}}-{{.GitBranch}}", vars: BranchNameVars{Project: "Shop", GitBranch: "feature/Login"}, want: "shop-feature-login"},
+		{name: "user", template: "{{.User}}_dev", vars: BranchNameVars{User: "jane.doe"}, want: "jane-doe_dev"},
+		{name: "outside a repository", template: "{{.Project}}-{{.GitBranch}}", vars: BranchNameVars{Project: "shop"}, want: "shop"},
+		{name: "truncated", template: "{{.GitBranch}}", vars: BranchNameVars{GitBranch: strings.Repeat("a", 49) + "/b"}, want: strings.Repeat("a", 49)},
+		{name: "empty", template: "{{.GitBranch}}", vars: BranchNameVars{}, wantErr: true},
+		{name: "reserved prefix", template: "pg_{{.User}}", vars: BranchNameVars{User: "jane"}, wantErr: true},
+		{name: "unknown variable", template: "{{.Branch}}", vars: BranchNameVars{GitBranch: "main"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &BranchFile{Name: tt.template}
+			got, err := file.BranchName(tt.vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BranchName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("BranchName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -20,7 +20,15 @@ type AnonRule struct {
 	Table    string          `json:"table"`
 	Column   string          `json:"column"`
 	Template json.RawMessage `json:"template"`
-	Type     string          `json:"type,omitempty"` // Optional: "text", "integer", "boolean", "null" - overrides auto-detection
+	Type     string          `json:"type,omitempty"`     // Optional: "text", "integer", "boolean", "null", "date", "timestamp", "uuid" - overrides auto-detection
+	JSONPath string          `json:"jsonPath,omitempty"` // Optional: replace this field of a jsonb column (e.g. "contact.email")
+
+	// Optional built-in function (e.g. "md5", "fake_name", "mask", "lookup"), template is ignored when set
+	Function        string          `json:"function,omitempty"`
+	FunctionOptions json.RawMessage `json:"functionOptions,omitempty"` // Function arguments, e.g. {"keep_last": 4}
+
+	// Optional: the same value gets the same output in every table (templates with ${index} and fake_* functions)
+	Consistent bool `json:"consistent,omitempty"`
 }
 
 // ParsedAnonRule represents a parsed anonymization rule with type information
@@ -28,14 +36,25 @@ type ParsedAnonRule struct {
 	Table      string
 	Column     string
 	Template   string // String representation of the template value
-	ColumnType string // "text", "integer", "boolean", "null"
+	ColumnType string // "text", "integer", "boolean", "null", "date", "timestamp", "uuid"
+	Function   string // Built-in function name, empty for template rules
 }
 
 // Parse parses the JSON template and returns type information
 func (r *AnonRule) Parse() (ParsedAnonRule, error) {
 	parsed := ParsedAnonRule{
-		Table:  r.Table,
-		Column: r.Column,
+		Table:    r.Table,
+		Column:   r.Column,
+		Function: r.Function,
+	}
+
+	// Function rules are validated by the server, the template is not used
+	if r.Function != "" {
+		parsed.ColumnType = r.Type
+		if parsed.ColumnType == "" {
+			parsed.ColumnType = "text"
+		}
+		return parsed, nil
 	}
 
 	// Try to unmarshal as different types to detect the JSON type
@@ -46,9 +65,9 @@ func (r *AnonRule) Parse() (ParsedAnonRule, error) {
 	// If type is explicitly specified, use it and extract the template value
 	if r.Type != "" {
 		// Validate the type
-		validTypes := map[string]bool{"text": true, "integer": true, "boolean": true, "null": true}
+		validTypes := map[string]bool{"text": true, "integer": true, "boolean": true, "null": true, "date": true, "timestamp": true, "uuid": true}
 		if !validTypes[r.Type] {
-			return parsed, fmt.Errorf("invalid type '%s', must be one of: text, integer, boolean, null", r.Type)
+			return parsed, fmt.Errorf("invalid type '%s', must be one of: text, integer, boolean, null, date, timestamp, uuid", r.Type)
 		}
 
 		parsed.ColumnType = r.Type
@@ -160,17 +179,22 @@ func DefaultConfig() *Config {
 
 // FindConfigFile searches for branchd.json in current directory and parent directories
 func FindConfigFile() (string, error) {
+	return findFile(ConfigFileName)
+}
+
+// findFile searches for a file named name in current directory and parent directories
+func findFile(name string) (string, error) {
 	currentDir, err := os.Getwd()
 	if err != nil {
 		return "", fmt.Errorf("failed to get current directory: %w", err)
 	}
 
-	// Search upwards until we find branchd.json or reach root
+	// Search upwards until we find the file or reach root
 	dir := currentDir
 	for {
-		configPath := filepath.Join(dir, ConfigFileName)
-		if _, err := os.Stat(configPath); err == nil {
-			return configPath, nil
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
 		}
 
 		parent := filepath.Dir(dir)
@@ -181,7 +205,7 @@ func FindConfigFile() (string, error) {
 		dir = parent
 	}
 
-	return "", fmt.Errorf("branchd.json not found in %s or any parent directory", currentDir)
+	return "", fmt.Errorf("%s not found in %s or any parent directory", name, currentDir)
 }
 
 // Load reads the configuration file
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envVarName matches the variable names SetEnvVar accepts
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateEnvVarName checks name is a valid environment variable name
+func ValidateEnvVarName(name string) error {
+	if !envVarName.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q (use letters, digits and _, e.g. DATABASE_URL)", name)
+	}
+	return nil
+}
+
+// SetEnvVar assigns value to name in a .env file, creating the file if it doesn't exist
+// The last assignment of name (the one loaders use) is replaced and keeps its export prefix, other lines are
+// left as they are. It returns the line written and the line replaced, nil if name wasn't assigned
+func SetEnvVar(path, name, value string) (string, *string, error) {
+	if err := ValidateEnvVarName(name); err != nil {
+		return "", nil, err
+	}
+	lines, mode, err := readEnvFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	line := name + "=" + quoteEnvValue(value)
+	var previous *string
+	if i := findEnvVar(lines, name); i >= 0 {
+		replaced := lines[i]
+		previous = &replaced
+		if strings.HasPrefix(strings.TrimSpace(replaced), "export ") {
+			line = "export " + line
+		}
+		lines[i] = line
+	} else {
+		lines = append(lines, line)
+	}
+
+	if err := writeEnvFile(path, lines, mode); err != nil {
+		return "", nil, err
+	}
+	return line, previous, nil
+}
+
+// RestoreEnvVar undoes a SetEnvVar: the line written is replaced by the previous one, or removed if there was none
+// Nothing changes when the assignment was edited or removed since, it reports whether the file was restored
+func RestoreEnvVar(path, name, written string, previous *string) (bool, error) {
+	lines, mode, err := readEnvFile(path)
+	if err != nil {
+		return false, err
+	}
+	i := findEnvVar(lines, name)
+	if i < 0 || strings.TrimSpace(lines[i]) != strings.TrimSpace(written) {
+		return false, nil
+	}
+
+	if previous != nil {
+		lines[i] = *previous
+	} else {
+		lines = append(lines[:i], lines[i+1:]...)
+	}
+	if err := writeEnvFile(path, lines, mode); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readEnvFile returns the lines and mode of a .env file, no lines and 0600 (it holds passwords) if it doesn't exist
+func readEnvFile(path string) ([]string, os.FileMode, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0o600, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read env file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read env file: %w", err)
+	}
+
+	content := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if content == "" {
+		return nil, info.Mode().Perm(), nil
+	}
+	return strings.Split(content, "\n"), info.Mode().Perm(), nil
+}
+
+func writeEnvFile(path string, lines []string, mode os.FileMode) error {
+	content := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		content += "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		return fmt.Errorf("failed to write env file: %w", err)
+	}
+	return nil
+}
+
+// findEnvVar returns the index of the last line assigning name, -1 if there is none
+func findEnvVar(lines []string, name string) int {
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimPrefix(strings.TrimSpace(lines[i]), "export ")
+		if key, _, ok := strings.Cut(line, "="); ok && strings.TrimSpace(key) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// quoteEnvValue double-quotes a value that a .env loader or shell would otherwise split or expand
+func quoteEnvValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t#\"'$\\`") {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetAndRestoreEnvVar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	original := "# app\nexport DATABASE_URL=postgres://localhost/dev\nREDIS_URL=redis://localhost\n"
+	if err := os.WriteFile(path, []byte(original), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	line, previous, err := SetEnvVar(path, "DATABASE_URL", "postgresql://u:p@10.0.0.1:15432/app")
+	if err != nil {
+		t.Fatalf("SetEnvVar() error = %v", err)
+	}
+	if line != "export DATABASE_URL=postgresql://u:p@10.0.0.1:15432/app" || previous == nil || *previous != "export DATABASE_URL=postgres://localhost/dev" {
+		t.Errorf("SetEnvVar() = %q, %v", line, previous)
+	}
+	data, _ := os.ReadFile(path)
+	if want := "# app\n" + line + "\nREDIS_URL=redis://localhost\n"; string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, want the file's mode kept", info.Mode().Perm())
+	}
+
+	restored, err := RestoreEnvVar(path, "DATABASE_URL", line, previous)
+	if err != nil || !restored {
+		t.Fatalf("RestoreEnvVar() = %v, %v", restored, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != original {
+		t.Errorf("restored file = %q, want %q", data, original)
+	}
+}
+
+func TestRestoreEnvVar_Unset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+
+	line, previous, err := SetEnvVar(path, "DATABASE_URL", "postgresql://u:p w@host/app")
+	if err != nil || previous != nil {
+		t.Fatalf("SetEnvVar() = %v, %v", previous, err)
+	}
+	if line != `DATABASE_URL="postgresql://u:p w@host/app"` {
+		t.Errorf("line = %q, want the value quoted", line)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want a new file only readable by the user", info.Mode().Perm())
+	}
+
+	// Edited since: left alone
+	if err := os.WriteFile(path, []byte("DATABASE_URL=mine\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if restored, err := RestoreEnvVar(path, "DATABASE_URL", line, previous); err != nil || restored {
+		t.Errorf("RestoreEnvVar() of an edited line = %v, %v", restored, err)
+	}
+
+	if err := os.WriteFile(path, []byte("A=1\n"+line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if restored, err := RestoreEnvVar(path, "DATABASE_URL", line, previous); err != nil || !restored {
+		t.Fatalf("RestoreEnvVar() = %v, %v", restored, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "A=1\n" {
+		t.Errorf("file = %q, want the variable removed", data)
+	}
+}
+
+func TestSetEnvVar_InvalidName(t *testing.T) {
+	if _, _, err := SetEnvVar(filepath.Join(t.TempDir(), ".env"), "DATABASE-URL", "x"); err == nil {
+		t.Error("expected an error for an invalid variable name")
+	}
+}
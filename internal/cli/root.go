@@ -16,38 +16,54 @@ var rootCmd = &cobra.Command{
 	Short:         "PostgreSQL database branching",
 	SilenceUsage:  true,
 	SilenceErrors: true,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		// Skip update check
-		if cmd.Name() == "update" || cmd.Name() == "checkout" {
-			return
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Shells read the output of completions, it's never JSON and mustn't hold the update notification
+		if commands.IsCompletionCommand(cmd) {
+			return nil
+		}
+		if err := commands.ValidateGlobalFlags(cmd); err != nil {
+			return err
+		}
+
+		// Skip update check (and its output in CI runners and scripts)
+		if cmd.Name() == "update" || cmd.Name() == "checkout" || commands.NonInteractive() || commands.Quiet() || commands.JSONOutput() {
+			return nil
 		}
 
 		// Check for updates (runs before every command except update/version)
 		update.PrintUpdateNotification(version)
+		return nil
 	},
 }
 
 func init() {
 	// Add version command
-	rootCmd.AddCommand(&cobra.Command{
-		Use:   "version",
-		Short: "Show version",
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Printf("branchd version %s\n", version)
-		},
-	})
+	rootCmd.AddCommand(commands.NewVersionCmd(version))
+
+	// Flags accepted by every command
+	commands.AddGlobalFlags(rootCmd)
 
 	// Add all subcommands
 	rootCmd.AddCommand(commands.NewInitCmd())
 	rootCmd.AddCommand(commands.NewLoginCmd())
 	rootCmd.AddCommand(commands.NewCheckoutCmd())
+	rootCmd.AddCommand(commands.NewUpCmd())
+	rootCmd.AddCommand(commands.NewDownCmd())
 	rootCmd.AddCommand(commands.NewDeleteCmd())
+	rootCmd.AddCommand(commands.NewDiffCmd())
+	rootCmd.AddCommand(commands.NewCheckMigrationCmd())
 	rootCmd.AddCommand(commands.NewListCmd())
+	rootCmd.AddCommand(commands.NewStatusCmd())
+	rootCmd.AddCommand(commands.NewRestoresCmd())
 	rootCmd.AddCommand(commands.NewDashCmd())
 	rootCmd.AddCommand(commands.NewSelectServerCmd())
 	rootCmd.AddCommand(commands.NewUpdateCmd(version))
 	rootCmd.AddCommand(commands.NewUpdateServerCmd())
 	rootCmd.AddCommand(commands.NewUpdateConfigCmd())
+	rootCmd.AddCommand(commands.NewAnonCmd())
+	rootCmd.AddCommand(commands.NewDecommissionCmd())
+	rootCmd.AddCommand(commands.NewReconcileCmd())
+	rootCmd.AddCommand(commands.NewCompletionCmd())
 }
 
 // Execute runs the root command
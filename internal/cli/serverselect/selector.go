@@ -2,17 +2,19 @@ package serverselect
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/branchd-dev/branchd/internal/cli/config"
 	"github.com/branchd-dev/branchd/internal/cli/userconfig"
 	"github.com/manifoldco/promptui"
+	"golang.org/x/term"
 )
 
 // ResolveServer determines which server to use based on the following priority:
 // 1. If user has a selected server in their local config, use that
 // 2. If only one server in project config, use that
-// 3. Otherwise, prompt user to select a server interactively
-func ResolveServer(projectConfig *config.Config) (*config.Server, error) {
+// 3. Otherwise, prompt user to select a server interactively (fails when interactive is false or stdin isn't a terminal)
+func ResolveServer(projectConfig *config.Config, interactive bool) (*config.Server, error) {
 	// Priority 1: Use selected server from user config
 	selectedIP, err := userconfig.GetSelectedServer()
 	if err != nil {
@@ -42,6 +44,9 @@ func ResolveServer(projectConfig *config.Config) (*config.Server, error) {
 	}
 
 	// Priority 3: Prompt user to select a server
+	if !interactive || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("multiple servers configured, pass --server <ip-or-alias> or run 'branchd select-server' first")
+	}
 	server, err := PromptServerSelection(projectConfig)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,81 @@
+package userconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// envWritesFileName holds the env files `branchd checkout --write-env` changed, next to config.json
+// It's only readable by the user, the lines it keeps hold passwords
+const envWritesFileName = "env-writes.json"
+
+// EnvWrite is a variable `branchd checkout --write-env` set, `branchd delete` restores it
+type EnvWrite struct {
+	ServerIP string  `json:"server_ip"`
+	BranchID string  `json:"branch_id"`
+	Path     string  `json:"path"` // Absolute path of the env file
+	Var      string  `json:"var"`
+	Line     string  `json:"line"`     // Line written
+	Previous *string `json:"previous"` // Line replaced, nil if the variable wasn't set
+}
+
+func envWritesPath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), envWritesFileName), nil
+}
+
+// LoadEnvWrites reads the recorded env writes, none if there are no records
+func LoadEnvWrites() ([]EnvWrite, error) {
+	path, err := envWritesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env writes: %w", err)
+	}
+
+	var writes []EnvWrite
+	if err := json.Unmarshal(data, &writes); err != nil {
+		return nil, fmt.Errorf("failed to parse env writes: %w", err)
+	}
+	return writes, nil
+}
+
+// SaveEnvWrites replaces the recorded env writes
+func SaveEnvWrites(writes []EnvWrite) error {
+	path, err := envWritesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(writes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal env writes: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write env writes: %w", err)
+	}
+	return nil
+}
+
+// RecordEnvWrite adds an env write to the records
+func RecordEnvWrite(write EnvWrite) error {
+	writes, err := LoadEnvWrites()
+	if err != nil {
+		return err
+	}
+	return SaveEnvWrites(append(writes, write))
+}
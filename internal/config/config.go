@@ -1,7 +1,14 @@
 package config
 
 import (
+	"encoding/hex"
+	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +23,33 @@ type Config struct {
 
 	// Logging Configuration
 	Logging LoggingConfig
+
+	// Storage Configuration
+	Storage StorageConfig
+
+	// Restore process priority
+	RestorePriority PriorityConfig
+
+	// API rate and request size limits
+	API APIConfig
+
+	// Authentication
+	Auth AuthConfig
+
+	// Background task processing
+	Worker WorkerConfig
+
+	// Prometheus metrics of branches
+	Metrics MetricsConfig
+
+	// PostgreSQL proxy routing connections on one port to the branches
+	Proxy ProxyConfig
+
+	// Control-plane mode managing registered agent servers
+	Fleet FleetConfig
+
+	// Backups of the SQLite database
+	Backup BackupConfig
 }
 
 // DatabaseConfig holds database configuration
@@ -25,13 +59,288 @@ type DatabaseConfig struct {
 
 // RedisConfig holds Redis configuration
 type RedisConfig struct {
-	Address string // Redis address (host:port)
+	Address string // Redis address (host:port), empty = no Redis, the server processes tasks in-process
+
+	// Task history retention - keeps Redis small on long-running servers
+	CompletedTaskRetention time.Duration // How long successful tasks stay inspectable (0 = deleted immediately)
+	ArchivedTaskRetention  time.Duration // How long failed (archived) tasks are kept before trimming
+	TaskGCInterval         time.Duration // How often the worker trims task history and reports Redis memory
+}
+
+// Enabled reports whether tasks go through Redis (asynq), otherwise the server runs them in-process
+func (r RedisConfig) Enabled() bool {
+	return r.Address != ""
 }
 
 // LoggingConfig holds logging-related configuration
 type LoggingConfig struct {
 	Level  string
 	Format string // json, console
+
+	// Per-component levels, e.g. "restore_orchestrator=debug,branches_service=warn"
+	ComponentLevels string
+
+	// Sinks in addition to stdout, they always receive JSON
+	File           string // Log file path, empty = no file
+	FileMaxSizeMB  int    // The file is rotated once it reaches this size
+	FileMaxBackups int    // Rotated files kept (branchd.log.1 ... branchd.log.N)
+	SyslogAddress  string // "local", "udp://host:514" or "tcp://host:514", empty = no syslog
+	LokiURL        string // Loki push endpoint (e.g. http://loki:3100/loki/api/v1/push), empty = no Loki
+	LokiLabels     string // Extra Loki stream labels, e.g. "env=prod,region=eu"
+}
+
+// StorageConfig holds the ZFS dataset layout for restore and branch clusters
+// Every restore and branch gets its own dataset under DatasetRoot, mounted under MountRoot
+type StorageConfig struct {
+	DatasetRoot    string // Parent ZFS dataset (e.g. "tank" or "tank/branchd")
+	MountRoot      string // Directory datasets are mounted under (e.g. /opt/branchd)
+	WALDatasetRoot string // Optional parent dataset for pg_wal on a separate device (e.g. "nvme/wal"), empty = WAL inside the data directory
+	WALMountRoot   string // Directory WAL datasets are mounted under (e.g. /opt/branchd-wal)
+}
+
+// DatasetName returns the ZFS dataset for a restore or branch
+func (s StorageConfig) DatasetName(name string) string {
+	return fmt.Sprintf("%s/%s", s.DatasetRoot, name)
+}
+
+// MountPath returns the mountpoint of a restore or branch dataset
+func (s StorageConfig) MountPath(name string) string {
+	return fmt.Sprintf("%s/%s", s.MountRoot, name)
+}
+
+// DataDir returns the PostgreSQL data directory of a restore or branch
+func (s StorageConfig) DataDir(name string) string {
+	return fmt.Sprintf("%s/data", s.MountPath(name))
+}
+
+// ExportDir returns the directory branch export archives are written to, on the data pool
+// The leading dot keeps it apart from the mountpoints, restore and branch names can't contain one
+func (s StorageConfig) ExportDir() string {
+	return fmt.Sprintf("%s/.exports", s.MountRoot)
+}
+
+// SeparateWAL reports whether pg_wal is placed on its own dataset
+func (s StorageConfig) SeparateWAL() bool {
+	return s.WALDatasetRoot != ""
+}
+
+// WALDatasetName returns the WAL dataset for a restore or branch (empty if WAL is not separate)
+func (s StorageConfig) WALDatasetName(name string) string {
+	if !s.SeparateWAL() {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", s.WALDatasetRoot, name)
+}
+
+// WALMountPath returns the mountpoint of a WAL dataset (empty if WAL is not separate)
+func (s StorageConfig) WALMountPath(name string) string {
+	if !s.SeparateWAL() {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", s.WALMountRoot, name)
+}
+
+// WALDir returns the pg_wal directory on the WAL dataset (empty if WAL is not separate)
+func (s StorageConfig) WALDir(name string) string {
+	if !s.SeparateWAL() {
+		return ""
+	}
+	return fmt.Sprintf("%s/pg_wal", s.WALMountPath(name))
+}
+
+// APIConfig holds the limits protecting the API from runaway clients (e.g. a CI retry loop)
+// Rates are requests per second, 0 disables the limit
+type APIConfig struct {
+	RateLimit      float64 // All requests together
+	RateBurst      int
+	TokenRateLimit float64 // Per user of a valid bearer token, other requests are limited per client IP
+	TokenRateBurst int
+
+	MaxBodyBytes      int64         // Larger request bodies are rejected with 413
+	MaxHeaderBytes    int           // Request line and headers
+	ReadHeaderTimeout time.Duration // Slow clients (e.g. slowloris) are disconnected after this long
+}
+
+// AuthConfig holds the authentication settings
+type AuthConfig struct {
+	// Admin routes require two-factor authentication, admins who haven't enrolled an authenticator yet may use them
+	// for this long after their first admin request (0 = enroll before using admin routes)
+	TwoFactorGracePeriod time.Duration
+}
+
+// Worker queues, tasks.QueueOf maps task types to them
+const (
+	QueueCritical = "critical"
+	QueueDefault  = "default"
+	QueueLow      = "low"
+)
+
+// WorkerConfig holds how many tasks the worker runs at once and how it shares them between queues
+// Workers pick queues in proportion to their weights, e.g. 6/3/1 gives critical tasks 60% of the picks
+type WorkerConfig struct {
+	Concurrency    int
+	CriticalWeight int // Branch operations developers wait on, decommission
+	DefaultWeight  int // Restores, clones, promotions, exports
+	LowWeight      int // Restore progress polls, unboosts, incremental refreshes
+
+	// Critical tasks always go first, lower queues only run while higher ones are empty
+	StrictPriority bool
+
+	// Queue per task type overriding the defaults (see tasks.QueueOf), e.g. "branch:export" -> "low"
+	TaskQueues map[string]string
+
+	// Timeout of every task on a queue overriding the task type's own (see tasks.Timeout), e.g. "default" -> 12h
+	QueueTimeouts map[string]time.Duration
+}
+
+// Queues returns the asynq queue weights
+func (w WorkerConfig) Queues() map[string]int {
+	return map[string]int{
+		QueueCritical: w.CriticalWeight,
+		QueueDefault:  w.DefaultWeight,
+		QueueLow:      w.LowWeight,
+	}
+}
+
+// parseTaskQueues parses "task_type=queue,..." (WORKER_TASK_QUEUES)
+func parseTaskQueues(value string) (map[string]string, error) {
+	queues := map[string]string{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		taskType, queue, ok := strings.Cut(entry, "=")
+		taskType, queue = strings.TrimSpace(taskType), strings.TrimSpace(queue)
+		if !ok || taskType == "" {
+			return nil, fmt.Errorf("invalid task queue %q, expected task_type=queue", entry)
+		}
+		if queue != QueueCritical && queue != QueueDefault && queue != QueueLow {
+			return nil, fmt.Errorf("invalid queue %q for %s, must be one of: critical, default, low", queue, taskType)
+		}
+		queues[taskType] = queue
+	}
+	return queues, nil
+}
+
+// parseQueueTimeouts parses "queue=duration,..." (WORKER_QUEUE_TIMEOUTS)
+func parseQueueTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		queue, duration, ok := strings.Cut(entry, "=")
+		queue, duration = strings.TrimSpace(queue), strings.TrimSpace(duration)
+		if !ok {
+			return nil, fmt.Errorf("invalid queue timeout %q, expected queue=duration", entry)
+		}
+		if queue != QueueCritical && queue != QueueDefault && queue != QueueLow {
+			return nil, fmt.Errorf("invalid queue %q, must be one of: critical, default, low", queue)
+		}
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for %s: %w", queue, err)
+		}
+		if d < time.Minute {
+			return nil, fmt.Errorf("invalid timeout for %s: must be at least 1m", queue)
+		}
+		timeouts[queue] = d
+	}
+	return timeouts, nil
+}
+
+// MetricsConfig holds the optional Prometheus endpoint (/metrics) exposing per-branch PostgreSQL metrics
+// Scrapers authenticate with Token as bearer token (bearer_token in the Prometheus scrape config)
+type MetricsConfig struct {
+	Enabled bool
+	Token   string
+	Timeout time.Duration // Bounds the queries of a single branch, unreachable branches are reported as down
+}
+
+// Default certificate of the proxy, the one restores and branches are set up with
+const (
+	DefaultProxyCertFile = "/etc/postgresql-common/ssl/server.crt"
+	DefaultProxyKeyFile  = "/etc/postgresql-common/ssl/server.key"
+)
+
+// ProxyConfig holds the optional PostgreSQL proxy that routes connections on one port to the branches (see
+// branches.StartProxy), so only that port has to be reachable instead of every branch's own
+// The branches' certificate keeps SCRAM channel binding working through the proxy, another one breaks it
+type ProxyConfig struct {
+	Address  string // Listen address, e.g. ":5432" (empty = no proxy)
+	CertFile string
+	KeyFile  string
+}
+
+// FleetConfig holds the optional control-plane mode: the server aggregates the branches and restores of registered
+// agent servers (/api/fleet) and creates branches on the least-loaded one (see fleet.Service)
+type FleetConfig struct {
+	Enabled bool
+	Timeout time.Duration // Bounds the requests to a single agent, unreachable agents are reported as such
+
+	// TokenKey is the hex-encoded AES-256 key sealing the agents' admin tokens in the database (FLEET_TOKEN_KEY,
+	// openssl rand -hex 32), required when Enabled
+	TokenKey string
+}
+
+// BackupConfig holds the backups of branchd's own SQLite database (see backup.Run), which keeps the only record of
+// the restores and branches on the ZFS datasets
+type BackupConfig struct {
+	Dir      string        // Directory archives are written to
+	Interval time.Duration // How often the worker backs up, 0 = only on request (POST /api/system/backup)
+	Keep     int           // Archives kept in Dir, older ones are deleted (0 = all)
+
+	// Optional copy of every archive in an S3 (or compatible) bucket
+	S3Bucket          string // Empty = archives are only kept in Dir
+	S3Prefix          string // Key prefix, e.g. "branchd/db1"
+	S3Region          string
+	S3Endpoint        string // Host or URL (e.g. http://minio.internal:9000), empty = s3.<region>.amazonaws.com
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3SessionToken    string // Of temporary credentials (e.g. an assumed role), empty = long-term keys
+	S3Encryption      string // x-amz-server-side-encryption of uploads: AES256 (default) or aws:kms, empty = none
+}
+
+// PriorityConfig holds the CPU and IO priority restore processes run with
+// Applied to pg_dump/pg_restore/pgbackrest (nice/ionice) and to the restore cluster's
+// systemd unit (Nice, IOSchedulingClass and cgroup weights), so background refreshes
+// don't compete with branches for CPU and disk
+type PriorityConfig struct {
+	Nice      int    // Process niceness (-20..19, higher = lower priority)
+	IOClass   string // ionice scheduling class: "best-effort" or "idle"
+	IOLevel   int    // ionice level within the best-effort class (0..7, higher = lower priority)
+	CPUWeight int    // systemd CPUWeight (1..10000, default for other units is 100)
+	IOWeight  int    // systemd IOWeight (1..10000, default for other units is 100)
+}
+
+// IOClassNumber returns the ionice -c value for IOClass
+func (p PriorityConfig) IOClassNumber() int {
+	if p.IOClass == "idle" {
+		return 3
+	}
+	return 2
+}
+
+// Validate checks that all values are within the ranges accepted by nice, ionice and systemd
+func (p PriorityConfig) Validate() error {
+	if p.Nice < -20 || p.Nice > 19 {
+		return fmt.Errorf("nice must be between -20 and 19")
+	}
+	if p.IOClass != "best-effort" && p.IOClass != "idle" {
+		return fmt.Errorf("ionice class must be one of: best-effort, idle")
+	}
+	if p.IOLevel < 0 || p.IOLevel > 7 {
+		return fmt.Errorf("ionice level must be between 0 and 7")
+	}
+	if p.CPUWeight < 1 || p.CPUWeight > 10000 {
+		return fmt.Errorf("CPU weight must be between 1 and 10000")
+	}
+	if p.IOWeight < 1 || p.IOWeight > 10000 {
+		return fmt.Errorf("IO weight must be between 1 and 10000")
+	}
+	return nil
 }
 
 // Load loads configuration from environment variables
@@ -47,11 +356,36 @@ func Load() (*Config, error) {
 	}
 
 	// Redis address - default to localhost:6379, allow override for dev/docker
-	redisAddr := os.Getenv("REDIS_ADDRESS")
-	if redisAddr == "" {
+	// Set but empty runs without Redis: single-box installs process tasks in the server process
+	redisAddr, ok := os.LookupEnv("REDIS_ADDRESS")
+	if !ok {
 		redisAddr = "localhost:6379"
 	}
 
+	// Task history retention - completed tasks for a day, failures for a week
+	completedRetention := 24 * time.Hour
+	archivedRetention := 7 * 24 * time.Hour
+	taskGCInterval := time.Hour
+	for env, target := range map[string]*time.Duration{
+		"REDIS_COMPLETED_TASK_RETENTION": &completedRetention,
+		"REDIS_ARCHIVED_TASK_RETENTION":  &archivedRetention,
+		"REDIS_TASK_GC_INTERVAL":         &taskGCInterval,
+	} {
+		if v := os.Getenv(env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", env, err)
+			}
+			if d < 0 {
+				return nil, fmt.Errorf("invalid %s: must not be negative", env)
+			}
+			*target = d
+		}
+	}
+	if taskGCInterval < time.Minute {
+		return nil, fmt.Errorf("invalid REDIS_TASK_GC_INTERVAL: must be at least 1m")
+	}
+
 	// Logging configuration - defaults suitable for production
 	logLevel := os.Getenv("LOG_LEVEL")
 	if logLevel == "" {
@@ -63,16 +397,356 @@ func Load() (*Config, error) {
 		logFormat = "json"
 	}
 
+	// Log file rotation - 100MB files, 5 backups
+	logFileMaxSizeMB := 100
+	logFileMaxBackups := 5
+	for env, target := range map[string]*int{
+		"LOG_FILE_MAX_SIZE_MB": &logFileMaxSizeMB,
+		"LOG_FILE_MAX_BACKUPS": &logFileMaxBackups,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", env, err)
+			}
+			if n < 0 {
+				return nil, fmt.Errorf("invalid %s: must not be negative", env)
+			}
+			*target = n
+		}
+	}
+	if logFileMaxSizeMB < 1 {
+		return nil, fmt.Errorf("invalid LOG_FILE_MAX_SIZE_MB: must be at least 1")
+	}
+
+	// Storage layout - defaults match the installer (pool "tank" mounted under /opt/branchd)
+	datasetRoot := strings.TrimSuffix(os.Getenv("ZFS_DATASET_ROOT"), "/")
+	if datasetRoot == "" {
+		datasetRoot = "tank"
+	}
+
+	mountRoot := strings.TrimSuffix(os.Getenv("DATA_MOUNT_ROOT"), "/")
+	if mountRoot == "" {
+		mountRoot = "/opt/branchd"
+	}
+
+	// Separate WAL device is opt-in (e.g. a pool on local NVMe scratch disk)
+	walDatasetRoot := strings.TrimSuffix(os.Getenv("ZFS_WAL_DATASET_ROOT"), "/")
+
+	walMountRoot := strings.TrimSuffix(os.Getenv("WAL_MOUNT_ROOT"), "/")
+	if walMountRoot == "" {
+		walMountRoot = "/opt/branchd-wal"
+	}
+
+	// Restore priority - defaults run restores below branches (weight 100, nice 0)
+	restorePriority := PriorityConfig{
+		Nice:      10,
+		IOClass:   "best-effort",
+		IOLevel:   7,
+		CPUWeight: 50,
+		IOWeight:  50,
+	}
+	if v := os.Getenv("RESTORE_IONICE_CLASS"); v != "" {
+		restorePriority.IOClass = v
+	}
+	for env, target := range map[string]*int{
+		"RESTORE_NICE":         &restorePriority.Nice,
+		"RESTORE_IONICE_LEVEL": &restorePriority.IOLevel,
+		"RESTORE_CPU_WEIGHT":   &restorePriority.CPUWeight,
+		"RESTORE_IO_WEIGHT":    &restorePriority.IOWeight,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", env, err)
+			}
+			*target = n
+		}
+	}
+	if err := restorePriority.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid restore priority: %w", err)
+	}
+
+	// API limits - a token may burst 60 requests, then 2 per second (120 per minute, the UI polls far less)
+	api := APIConfig{
+		RateLimit:         50,
+		RateBurst:         100,
+		TokenRateLimit:    2,
+		TokenRateBurst:    60,
+		MaxBodyBytes:      10 << 20, // 10MB, fixtures and SQL settings are the largest bodies
+		MaxHeaderBytes:    64 << 10, // 64KB
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	for env, target := range map[string]*float64{
+		"API_RATE_LIMIT":       &api.RateLimit,
+		"API_TOKEN_RATE_LIMIT": &api.TokenRateLimit,
+	} {
+		if v := os.Getenv(env); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", env, err)
+			}
+			if f < 0 {
+				return nil, fmt.Errorf("invalid %s: must not be negative", env)
+			}
+			*target = f
+		}
+	}
+	for env, target := range map[string]*int{
+		"API_RATE_BURST":       &api.RateBurst,
+		"API_TOKEN_RATE_BURST": &api.TokenRateBurst,
+		"API_MAX_HEADER_BYTES": &api.MaxHeaderBytes,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", env, err)
+			}
+			if n < 1 {
+				return nil, fmt.Errorf("invalid %s: must be at least 1", env)
+			}
+			*target = n
+		}
+	}
+	if v := os.Getenv("API_MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API_MAX_BODY_BYTES: %w", err)
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("invalid API_MAX_BODY_BYTES: must be at least 1")
+		}
+		api.MaxBodyBytes = n
+	}
+	if v := os.Getenv("API_READ_HEADER_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API_READ_HEADER_TIMEOUT: %w", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid API_READ_HEADER_TIMEOUT: must be at least 1s")
+		}
+		api.ReadHeaderTimeout = d
+	}
+
+	// Two-factor grace period - a week to enroll, so upgrading doesn't lock admins (and their scripts) out
+	twoFactorGracePeriod := 7 * 24 * time.Hour
+	if v := os.Getenv("TWO_FACTOR_GRACE_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TWO_FACTOR_GRACE_PERIOD: %w", err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("invalid TWO_FACTOR_GRACE_PERIOD: must not be negative")
+		}
+		twoFactorGracePeriod = d
+	}
+
+	// Worker - 10 concurrent tasks, weighted 6/3/1 across the critical, default and low queues
+	worker := WorkerConfig{
+		Concurrency:    10,
+		CriticalWeight: 6,
+		DefaultWeight:  3,
+		LowWeight:      1,
+	}
+	for env, target := range map[string]*int{
+		"WORKER_CONCURRENCY":           &worker.Concurrency,
+		"WORKER_QUEUE_CRITICAL_WEIGHT": &worker.CriticalWeight,
+		"WORKER_QUEUE_DEFAULT_WEIGHT":  &worker.DefaultWeight,
+		"WORKER_QUEUE_LOW_WEIGHT":      &worker.LowWeight,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", env, err)
+			}
+			// A zero weight would starve the queue, asynq skips it entirely
+			if n < 1 {
+				return nil, fmt.Errorf("invalid %s: must be at least 1", env)
+			}
+			*target = n
+		}
+	}
+	if v := os.Getenv("WORKER_STRICT_PRIORITY"); v != "" {
+		strict, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WORKER_STRICT_PRIORITY: %w", err)
+		}
+		worker.StrictPriority = strict
+	}
+	taskQueues, err := parseTaskQueues(os.Getenv("WORKER_TASK_QUEUES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WORKER_TASK_QUEUES: %w", err)
+	}
+	worker.TaskQueues = taskQueues
+	queueTimeouts, err := parseQueueTimeouts(os.Getenv("WORKER_QUEUE_TIMEOUTS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WORKER_QUEUE_TIMEOUTS: %w", err)
+	}
+	worker.QueueTimeouts = queueTimeouts
+
+	// Branch metrics - off by default, every scrape queries each running branch
+	metrics := MetricsConfig{
+		Token:   os.Getenv("METRICS_TOKEN"),
+		Timeout: 5 * time.Second,
+	}
+	if v := os.Getenv("METRICS_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid METRICS_ENABLED: %w", err)
+		}
+		metrics.Enabled = enabled
+	}
+	if metrics.Enabled && metrics.Token == "" {
+		return nil, fmt.Errorf("METRICS_TOKEN is required when METRICS_ENABLED is set")
+	}
+	if v := os.Getenv("METRICS_BRANCH_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid METRICS_BRANCH_TIMEOUT: %w", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid METRICS_BRANCH_TIMEOUT: must be at least 1s")
+		}
+		metrics.Timeout = d
+	}
+
+	// Branch proxy - off by default, the branches' ports are reachable directly
+	proxy := ProxyConfig{
+		Address:  os.Getenv("PROXY_ADDRESS"),
+		CertFile: DefaultProxyCertFile,
+		KeyFile:  DefaultProxyKeyFile,
+	}
+	if v := os.Getenv("PROXY_TLS_CERT_FILE"); v != "" {
+		proxy.CertFile = v
+	}
+	if v := os.Getenv("PROXY_TLS_KEY_FILE"); v != "" {
+		proxy.KeyFile = v
+	}
+	if proxy.Address != "" {
+		if _, _, err := net.SplitHostPort(proxy.Address); err != nil {
+			return nil, fmt.Errorf("invalid PROXY_ADDRESS: %w", err)
+		}
+	}
+
+	// Control-plane mode - off by default, every server is managed on its own
+	fleet := FleetConfig{Timeout: 10 * time.Second}
+	if v := os.Getenv("FLEET_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FLEET_ENABLED: %w", err)
+		}
+		fleet.Enabled = enabled
+	}
+	if v := os.Getenv("FLEET_AGENT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FLEET_AGENT_TIMEOUT: %w", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid FLEET_AGENT_TIMEOUT: must be at least 1s")
+		}
+		fleet.Timeout = d
+	}
+	fleet.TokenKey = os.Getenv("FLEET_TOKEN_KEY")
+	if fleet.TokenKey != "" {
+		if key, err := hex.DecodeString(fleet.TokenKey); err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid FLEET_TOKEN_KEY: must be 64 hex characters (openssl rand -hex 32)")
+		}
+	} else if fleet.Enabled {
+		return nil, fmt.Errorf("FLEET_TOKEN_KEY is required when FLEET_ENABLED is set (openssl rand -hex 32)")
+	}
+
+	// Backups - daily, a week of archives next to the database
+	backup := BackupConfig{
+		Dir:               os.Getenv("BACKUP_DIR"),
+		Interval:          24 * time.Hour,
+		Keep:              7,
+		S3Bucket:          os.Getenv("BACKUP_S3_BUCKET"),
+		S3Prefix:          strings.Trim(os.Getenv("BACKUP_S3_PREFIX"), "/"),
+		S3Region:          os.Getenv("BACKUP_S3_REGION"),
+		S3Endpoint:        strings.TrimSuffix(os.Getenv("BACKUP_S3_ENDPOINT"), "/"),
+		S3AccessKeyID:     os.Getenv("BACKUP_S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey: os.Getenv("BACKUP_S3_SECRET_ACCESS_KEY"),
+		S3SessionToken:    os.Getenv("BACKUP_S3_SESSION_TOKEN"),
+		S3Encryption:      "AES256",
+	}
+	if backup.S3SessionToken == "" {
+		backup.S3SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if backup.Dir == "" {
+		backup.Dir = filepath.Join(filepath.Dir(dbURL), "backups")
+	}
+	if v := os.Getenv("BACKUP_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_INTERVAL: %w", err)
+		}
+		if d != 0 && d < time.Minute {
+			return nil, fmt.Errorf("invalid BACKUP_INTERVAL: must be 0 or at least 1m")
+		}
+		backup.Interval = d
+	}
+	if v := os.Getenv("BACKUP_KEEP"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_KEEP: %w", err)
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("invalid BACKUP_KEEP: must not be negative")
+		}
+		backup.Keep = n
+	}
+	// Archives hold every credential of the database, stores without server-side encryption need BACKUP_S3_ENCRYPTION=none
+	switch v := os.Getenv("BACKUP_S3_ENCRYPTION"); v {
+	case "":
+	case "none":
+		backup.S3Encryption = ""
+	case "AES256", "aws:kms":
+		backup.S3Encryption = v
+	default:
+		return nil, fmt.Errorf("invalid BACKUP_S3_ENCRYPTION: must be AES256, aws:kms or none")
+	}
+	if backup.S3Bucket != "" && (backup.S3Region == "" || backup.S3AccessKeyID == "" || backup.S3SecretAccessKey == "") {
+		return nil, fmt.Errorf("BACKUP_S3_REGION, BACKUP_S3_ACCESS_KEY_ID and BACKUP_S3_SECRET_ACCESS_KEY are required with BACKUP_S3_BUCKET")
+	}
+
 	return &Config{
 		Database: DatabaseConfig{
 			URL: dbURL,
 		},
 		Redis: RedisConfig{
-			Address: redisAddr,
+			Address:                redisAddr,
+			CompletedTaskRetention: completedRetention,
+			ArchivedTaskRetention:  archivedRetention,
+			TaskGCInterval:         taskGCInterval,
 		},
 		Logging: LoggingConfig{
-			Level:  logLevel,
-			Format: logFormat,
+			Level:           logLevel,
+			Format:          logFormat,
+			ComponentLevels: os.Getenv("LOG_COMPONENT_LEVELS"),
+			File:            os.Getenv("LOG_FILE"),
+			FileMaxSizeMB:   logFileMaxSizeMB,
+			FileMaxBackups:  logFileMaxBackups,
+			SyslogAddress:   os.Getenv("LOG_SYSLOG_ADDRESS"),
+			LokiURL:         os.Getenv("LOG_LOKI_URL"),
+			LokiLabels:      os.Getenv("LOG_LOKI_LABELS"),
+		},
+		Storage: StorageConfig{
+			DatasetRoot:    datasetRoot,
+			MountRoot:      mountRoot,
+			WALDatasetRoot: walDatasetRoot,
+			WALMountRoot:   walMountRoot,
+		},
+		RestorePriority: restorePriority,
+		API:             api,
+		Auth: AuthConfig{
+			TwoFactorGracePeriod: twoFactorGracePeriod,
 		},
+		Worker:  worker,
+		Metrics: metrics,
+		Proxy:   proxy,
+		Fleet:   fleet,
+		Backup:  backup,
 	}, nil
 }
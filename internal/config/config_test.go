@@ -0,0 +1,523 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStorageConfigPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage StorageConfig
+		want    map[string]string
+	}{
+		{
+			name:    "WAL inside the data directory",
+			storage: StorageConfig{DatasetRoot: "tank", MountRoot: "/opt/branchd", WALMountRoot: "/opt/branchd-wal"},
+			want: map[string]string{
+				"dataset":     "tank/feature-x",
+				"mount":       "/opt/branchd/feature-x",
+				"data":        "/opt/branchd/feature-x/data",
+				"wal dataset": "",
+				"wal mount":   "",
+				"wal dir":     "",
+			},
+		},
+		{
+			name:    "separate WAL device",
+			storage: StorageConfig{DatasetRoot: "tank/branchd", MountRoot: "/srv/pg", WALDatasetRoot: "nvme/wal", WALMountRoot: "/opt/branchd-wal"},
+			want: map[string]string{
+				"dataset":     "tank/branchd/feature-x",
+				"mount":       "/srv/pg/feature-x",
+				"data":        "/srv/pg/feature-x/data",
+				"wal dataset": "nvme/wal/feature-x",
+				"wal mount":   "/opt/branchd-wal/feature-x",
+				"wal dir":     "/opt/branchd-wal/feature-x/pg_wal",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{
+				"dataset":     tt.storage.DatasetName("feature-x"),
+				"mount":       tt.storage.MountPath("feature-x"),
+				"data":        tt.storage.DataDir("feature-x"),
+				"wal dataset": tt.storage.WALDatasetName("feature-x"),
+				"wal mount":   tt.storage.WALMountPath("feature-x"),
+				"wal dir":     tt.storage.WALDir("feature-x"),
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s = %q, want %q", key, got[key], want)
+				}
+			}
+			if separate := tt.want["wal dataset"] != ""; tt.storage.SeparateWAL() != separate {
+				t.Errorf("SeparateWAL() = %v, want %v", tt.storage.SeparateWAL(), separate)
+			}
+		})
+	}
+}
+
+func TestLoadStorage(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want StorageConfig
+	}{
+		{
+			name: "installer defaults",
+			want: StorageConfig{DatasetRoot: "tank", MountRoot: "/opt/branchd", WALMountRoot: "/opt/branchd-wal"},
+		},
+		{
+			name: "custom layout with trailing slashes",
+			env: map[string]string{
+				"ZFS_DATASET_ROOT":     "tank/branchd/",
+				"DATA_MOUNT_ROOT":      "/srv/pg/",
+				"ZFS_WAL_DATASET_ROOT": "nvme/wal/",
+				"WAL_MOUNT_ROOT":       "/mnt/wal/",
+			},
+			want: StorageConfig{DatasetRoot: "tank/branchd", MountRoot: "/srv/pg", WALDatasetRoot: "nvme/wal", WALMountRoot: "/mnt/wal"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"ZFS_DATASET_ROOT", "DATA_MOUNT_ROOT", "ZFS_WAL_DATASET_ROOT", "WAL_MOUNT_ROOT"} {
+				t.Setenv(env, tt.env[env])
+			}
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Storage != tt.want {
+				t.Errorf("Storage = %+v, want %+v", cfg.Storage, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRestorePriority(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    PriorityConfig
+		wantErr string
+	}{
+		{
+			name: "background defaults",
+			want: PriorityConfig{Nice: 10, IOClass: "best-effort", IOLevel: 7, CPUWeight: 50, IOWeight: 50},
+		},
+		{
+			name: "idle with custom weights",
+			env:  map[string]string{"RESTORE_NICE": "19", "RESTORE_IONICE_CLASS": "idle", "RESTORE_CPU_WEIGHT": "10", "RESTORE_IO_WEIGHT": "20"},
+			want: PriorityConfig{Nice: 19, IOClass: "idle", IOLevel: 7, CPUWeight: 10, IOWeight: 20},
+		},
+		{
+			name:    "not a number",
+			env:     map[string]string{"RESTORE_NICE": "low"},
+			wantErr: "invalid RESTORE_NICE",
+		},
+		{
+			name:    "nice out of range",
+			env:     map[string]string{"RESTORE_NICE": "20"},
+			wantErr: "nice must be between -20 and 19",
+		},
+		{
+			name:    "unknown ionice class",
+			env:     map[string]string{"RESTORE_IONICE_CLASS": "realtime"},
+			wantErr: "ionice class must be one of",
+		},
+		{
+			name:    "ionice level out of range",
+			env:     map[string]string{"RESTORE_IONICE_LEVEL": "8"},
+			wantErr: "ionice level must be between 0 and 7",
+		},
+		{
+			name:    "zero CPU weight",
+			env:     map[string]string{"RESTORE_CPU_WEIGHT": "0"},
+			wantErr: "CPU weight must be between 1 and 10000",
+		},
+		{
+			name:    "IO weight too high",
+			env:     map[string]string{"RESTORE_IO_WEIGHT": "10001"},
+			wantErr: "IO weight must be between 1 and 10000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"RESTORE_NICE", "RESTORE_IONICE_CLASS", "RESTORE_IONICE_LEVEL", "RESTORE_CPU_WEIGHT", "RESTORE_IO_WEIGHT"} {
+				t.Setenv(env, tt.env[env])
+			}
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.RestorePriority != tt.want {
+				t.Errorf("RestorePriority = %+v, want %+v", cfg.RestorePriority, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    MetricsConfig
+		wantErr string
+	}{
+		{
+			name: "disabled by default",
+			want: MetricsConfig{Timeout: 5 * time.Second},
+		},
+		{
+			name: "enabled with token",
+			env:  map[string]string{"METRICS_ENABLED": "true", "METRICS_TOKEN": "scrape-token", "METRICS_BRANCH_TIMEOUT": "2s"},
+			want: MetricsConfig{Enabled: true, Token: "scrape-token", Timeout: 2 * time.Second},
+		},
+		{
+			name:    "enabled without token",
+			env:     map[string]string{"METRICS_ENABLED": "1"},
+			wantErr: "METRICS_TOKEN is required",
+		},
+		{
+			name:    "not a bool",
+			env:     map[string]string{"METRICS_ENABLED": "yes"},
+			wantErr: "invalid METRICS_ENABLED",
+		},
+		{
+			name:    "timeout too short",
+			env:     map[string]string{"METRICS_BRANCH_TIMEOUT": "100ms"},
+			wantErr: "must be at least 1s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"METRICS_ENABLED", "METRICS_TOKEN", "METRICS_BRANCH_TIMEOUT"} {
+				t.Setenv(env, tt.env[env])
+			}
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Metrics != tt.want {
+				t.Errorf("Metrics = %+v, want %+v", cfg.Metrics, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFleet(t *testing.T) {
+	const testTokenKey = "abababababababababababababababababababababababababababababababab"
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    FleetConfig
+		wantErr string
+	}{
+		{
+			name: "disabled by default",
+			want: FleetConfig{Timeout: 10 * time.Second},
+		},
+		{
+			name: "enabled",
+			env:  map[string]string{"FLEET_ENABLED": "true", "FLEET_AGENT_TIMEOUT": "30s", "FLEET_TOKEN_KEY": testTokenKey},
+			want: FleetConfig{Enabled: true, Timeout: 30 * time.Second, TokenKey: testTokenKey},
+		},
+		{
+			name:    "enabled without a token key",
+			env:     map[string]string{"FLEET_ENABLED": "true"},
+			wantErr: "FLEET_TOKEN_KEY is required",
+		},
+		{
+			name:    "token key too short",
+			env:     map[string]string{"FLEET_TOKEN_KEY": "abcd"},
+			wantErr: "invalid FLEET_TOKEN_KEY",
+		},
+		{
+			name:    "not a bool",
+			env:     map[string]string{"FLEET_ENABLED": "yes"},
+			wantErr: "invalid FLEET_ENABLED",
+		},
+		{
+			name:    "timeout too short",
+			env:     map[string]string{"FLEET_AGENT_TIMEOUT": "500ms"},
+			wantErr: "must be at least 1s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"FLEET_ENABLED", "FLEET_AGENT_TIMEOUT", "FLEET_TOKEN_KEY"} {
+				t.Setenv(env, tt.env[env])
+			}
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Fleet != tt.want {
+				t.Errorf("Fleet = %+v, want %+v", cfg.Fleet, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadBackup(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    BackupConfig
+		wantErr string
+	}{
+		{
+			name: "daily next to the database by default",
+			env:  map[string]string{"DATABASE_URL": "/data/branchd.sqlite"},
+			want: BackupConfig{Dir: "/data/backups", Interval: 24 * time.Hour, Keep: 7, S3Encryption: "AES256"},
+		},
+		{
+			name: "S3",
+			env: map[string]string{"BACKUP_DIR": "/mnt/backups", "BACKUP_INTERVAL": "6h", "BACKUP_KEEP": "0", "BACKUP_S3_BUCKET": "backups",
+				"BACKUP_S3_PREFIX": "/branchd/db1/", "BACKUP_S3_REGION": "eu-west-1", "BACKUP_S3_ACCESS_KEY_ID": "AKID", "BACKUP_S3_SECRET_ACCESS_KEY": "secret"},
+			want: BackupConfig{Dir: "/mnt/backups", Interval: 6 * time.Hour, S3Bucket: "backups", S3Prefix: "branchd/db1",
+				S3Region: "eu-west-1", S3AccessKeyID: "AKID", S3SecretAccessKey: "secret", S3Encryption: "AES256"},
+		},
+		{
+			name: "S3 with temporary credentials and without encryption",
+			env: map[string]string{"BACKUP_DIR": "/mnt/backups", "BACKUP_S3_BUCKET": "backups", "BACKUP_S3_REGION": "eu-west-1",
+				"BACKUP_S3_ACCESS_KEY_ID": "ASIA", "BACKUP_S3_SECRET_ACCESS_KEY": "secret", "AWS_SESSION_TOKEN": "token", "BACKUP_S3_ENCRYPTION": "none"},
+			want: BackupConfig{Dir: "/mnt/backups", Interval: 24 * time.Hour, Keep: 7, S3Bucket: "backups", S3Region: "eu-west-1",
+				S3AccessKeyID: "ASIA", S3SecretAccessKey: "secret", S3SessionToken: "token"},
+		},
+		{
+			name: "only on request",
+			env:  map[string]string{"BACKUP_DIR": "/mnt/backups", "BACKUP_INTERVAL": "0"},
+			want: BackupConfig{Dir: "/mnt/backups", Keep: 7, S3Encryption: "AES256"},
+		},
+		{
+			name:    "unknown encryption",
+			env:     map[string]string{"BACKUP_S3_ENCRYPTION": "aes"},
+			wantErr: "invalid BACKUP_S3_ENCRYPTION",
+		},
+		{
+			name:    "interval too short",
+			env:     map[string]string{"BACKUP_INTERVAL": "30s"},
+			wantErr: "must be 0 or at least 1m",
+		},
+		{
+			name:    "S3 without credentials",
+			env:     map[string]string{"BACKUP_S3_BUCKET": "backups", "BACKUP_S3_REGION": "eu-west-1"},
+			wantErr: "required with BACKUP_S3_BUCKET",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"DATABASE_URL", "BACKUP_DIR", "BACKUP_INTERVAL", "BACKUP_KEEP", "BACKUP_S3_BUCKET", "BACKUP_S3_PREFIX",
+				"BACKUP_S3_REGION", "BACKUP_S3_ENDPOINT", "BACKUP_S3_ACCESS_KEY_ID", "BACKUP_S3_SECRET_ACCESS_KEY", "BACKUP_S3_SESSION_TOKEN",
+				"AWS_SESSION_TOKEN", "BACKUP_S3_ENCRYPTION"} {
+				t.Setenv(env, tt.env[env])
+			}
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Backup != tt.want {
+				t.Errorf("Backup = %+v, want %+v", cfg.Backup, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    ProxyConfig
+		wantErr string
+	}{
+		{
+			name: "disabled by default",
+			want: ProxyConfig{CertFile: DefaultProxyCertFile, KeyFile: DefaultProxyKeyFile},
+		},
+		{
+			name: "own certificate",
+			env:  map[string]string{"PROXY_ADDRESS": ":5432", "PROXY_TLS_CERT_FILE": "/etc/branchd/proxy.crt", "PROXY_TLS_KEY_FILE": "/etc/branchd/proxy.key"},
+			want: ProxyConfig{Address: ":5432", CertFile: "/etc/branchd/proxy.crt", KeyFile: "/etc/branchd/proxy.key"},
+		},
+		{
+			name:    "port missing",
+			env:     map[string]string{"PROXY_ADDRESS": "5432"},
+			wantErr: "invalid PROXY_ADDRESS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"PROXY_ADDRESS", "PROXY_TLS_CERT_FILE", "PROXY_TLS_KEY_FILE"} {
+				t.Setenv(env, tt.env[env])
+			}
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Proxy != tt.want {
+				t.Errorf("Proxy = %+v, want %+v", cfg.Proxy, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadWorkerTaskQueues(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr string
+	}{
+		{name: "defaults", want: map[string]string{}},
+		{name: "overrides", value: "branch:export=low, restore:clone=critical", want: map[string]string{"branch:export": "low", "restore:clone": "critical"}},
+		{name: "unknown queue", value: "branch:export=urgent", wantErr: "must be one of: critical, default, low"},
+		{name: "missing queue", value: "branch:export", wantErr: "expected task_type=queue"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WORKER_TASK_QUEUES", tt.value)
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !reflect.DeepEqual(cfg.Worker.TaskQueues, tt.want) {
+				t.Errorf("TaskQueues = %v, want %v", cfg.Worker.TaskQueues, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadWorkerConcurrency(t *testing.T) {
+	t.Setenv("WORKER_CONCURRENCY", "4")
+	t.Setenv("WORKER_QUEUE_LOW_WEIGHT", "2")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Worker.Concurrency != 4 || !reflect.DeepEqual(cfg.Worker.Queues(), map[string]int{QueueCritical: 6, QueueDefault: 3, QueueLow: 2}) {
+		t.Errorf("Worker = %+v, want concurrency 4 and weights 6/3/2", cfg.Worker)
+	}
+
+	for env, value := range map[string]string{"WORKER_CONCURRENCY": "0", "WORKER_QUEUE_DEFAULT_WEIGHT": "many"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), env) {
+				t.Errorf("Load() error = %v, want invalid %s", err, env)
+			}
+		})
+	}
+}
+
+func TestLoadWorkerQueueTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]time.Duration
+		wantErr string
+	}{
+		{name: "defaults", want: map[string]time.Duration{}},
+		{name: "overrides", value: "default=12h, low=30m", want: map[string]time.Duration{QueueDefault: 12 * time.Hour, QueueLow: 30 * time.Minute}},
+		{name: "unknown queue", value: "urgent=1h", wantErr: "must be one of: critical, default, low"},
+		{name: "invalid duration", value: "low=soon", wantErr: "invalid timeout for low"},
+		{name: "too short", value: "critical=10s", wantErr: "must be at least 1m"},
+		{name: "missing duration", value: "low", wantErr: "expected queue=duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WORKER_QUEUE_TIMEOUTS", tt.value)
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !reflect.DeepEqual(cfg.Worker.QueueTimeouts, tt.want) {
+				t.Errorf("QueueTimeouts = %v, want %v", cfg.Worker.QueueTimeouts, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRedisAddress(t *testing.T) {
+	// t.Setenv restores the variable afterwards, unsetting it then tests the default
+	t.Setenv("REDIS_ADDRESS", "")
+	os.Unsetenv("REDIS_ADDRESS")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Redis.Address != "localhost:6379" || !cfg.Redis.Enabled() {
+		t.Errorf("Redis without REDIS_ADDRESS = %+v, want localhost:6379", cfg.Redis)
+	}
+
+	// Set but empty runs without Redis
+	t.Setenv("REDIS_ADDRESS", "")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Redis.Enabled() {
+		t.Errorf("Redis with empty REDIS_ADDRESS = %+v, want disabled", cfg.Redis)
+	}
+}
@@ -0,0 +1,267 @@
+// Package decommission tears down a Branchd host: branches, restores, datasets and credentials
+package decommission
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/backup"
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restores"
+)
+
+// Path is the API route that starts a decommission, recorded in its audit event
+const Path = "/api/system/decommission"
+
+// BranchOwner lists the branches of one user that a decommission deletes
+type BranchOwner struct {
+	UserID   string   `json:"user_id"`
+	Email    string   `json:"email"`
+	Branches []string `json:"branches"`
+	Notified bool     `json:"notified"` // Posted to Config.NotificationWebhookURL or emailed before the branches were deleted
+}
+
+// Params identifies the admin who confirmed the decommission, for the audit event
+type Params struct {
+	UserID    string `json:"user_id"`
+	UserEmail string `json:"user_email"`
+	ClientIP  string `json:"client_ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+// Result reports what a decommission removed
+type Result struct {
+	BranchesDeleted   []string            `json:"branches_deleted"`
+	RestoresDeleted   []string            `json:"restores_deleted"`
+	DatasetsDestroyed []string            `json:"datasets_destroyed"` // Stray datasets left behind by earlier failures
+	BackupsDeleted    []string            `json:"backups_deleted"`    // Local backup archives, they contain the revoked credentials
+	BranchOwners      []BranchOwner       `json:"branch_owners"`
+	Errors            []string            `json:"errors"`
+	AuditEvents       []models.AuditEvent `json:"audit_events"` // Final export of the audit log, oldest first
+}
+
+// Run deletes all branches and restores, destroys stray datasets, clears the stored credentials, rotates the
+// JWT secret and deletes the local backup archives, then records the audit event and exports the audit log
+// Steps continue after failures, which are reported in Result.Errors
+func Run(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger, params Params) *Result {
+	logger.Warn().Str("user_id", params.UserID).Msg("Decommissioning server")
+
+	result := &Result{
+		BranchesDeleted:   []string{},
+		RestoresDeleted:   []string{},
+		DatasetsDestroyed: []string{},
+		BackupsDeleted:    []string{},
+		BranchOwners:      []BranchOwner{},
+		Errors:            []string{},
+	}
+
+	// Stop scheduled refreshes and branches first so nothing starts while tearing down
+	if err := db.Model(&models.Config{}).Where("1 = 1").Updates(map[string]interface{}{
+		"refresh_schedule": "",
+		"next_refresh_at":  nil,
+	}).Error; err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("disable refresh schedule: %v", err))
+	}
+	if err := db.Where("1 = 1").Delete(&models.BranchSchedule{}).Error; err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("delete branch schedules: %v", err))
+	}
+
+	var branchList []models.Branch
+	if err := db.Find(&branchList).Error; err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("load branches: %v", err))
+	}
+	result.BranchOwners = BranchOwners(db, branchList)
+
+	var config models.Config
+	if err := db.First(&config).Error; err != nil && err != gorm.ErrRecordNotFound {
+		result.Errors = append(result.Errors, fmt.Sprintf("load config: %v", err))
+	}
+	notifyBranchOwners(ctx, db, cfg, &config, result.BranchOwners, logger)
+
+	branchesService := branches.NewService(db, cfg, logger)
+	for _, branch := range branchList {
+		if err := branchesService.DeleteBranch(ctx, branches.DeleteBranchParams{BranchName: branch.Name}); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("delete branch %s: %v", branch.Name, err))
+			continue
+		}
+		result.BranchesDeleted = append(result.BranchesDeleted, branch.Name)
+	}
+
+	// Clones depend on their source restore's snapshots, so they go first
+	restoresService := restores.NewService(db, cfg, logger)
+	var restoreList []models.Restore
+	if err := db.Order("cloned_from_id = '' ASC").Find(&restoreList).Error; err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("load restores: %v", err))
+	}
+	for i := range restoreList {
+		restore := &restoreList[i]
+		if err := restoresService.Delete(ctx, restore); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("delete restore %s: %v", restore.Name, err))
+			continue
+		}
+		result.RestoresDeleted = append(result.RestoresDeleted, restore.Name)
+	}
+
+	// Only sweep once everything was deleted, datasets of failed deletions still have records
+	if len(result.Errors) == 0 {
+		destroyed, errs := destroyStrayDatasets(ctx, cfg.Storage)
+		result.DatasetsDestroyed = append(result.DatasetsDestroyed, destroyed...)
+		result.Errors = append(result.Errors, errs...)
+	}
+
+	if err := revokeCredentials(db); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("revoke credentials: %v", err))
+	}
+	if cfg.Backup.Dir != "" {
+		deleted, err := backup.DeleteAll(cfg.Backup.Dir)
+		result.BackupsDeleted = append(result.BackupsDeleted, deleted...)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("delete backups: %v", err))
+		}
+	}
+
+	// Recorded here rather than by the audit middleware so the export includes it
+	status := http.StatusOK
+	if len(result.Errors) > 0 {
+		status = http.StatusInternalServerError
+	}
+	event := models.AuditEvent{
+		Action:       "system.decommissioned",
+		ResourceType: "system",
+		Method:       http.MethodPost,
+		Path:         Path,
+		StatusCode:   status,
+		Success:      status == http.StatusOK,
+		ClientIP:     params.ClientIP,
+		UserAgent:    params.UserAgent,
+		UserID:       params.UserID,
+		UserEmail:    params.UserEmail,
+		Details: map[string]string{
+			"branches_deleted":   fmt.Sprintf("%d", len(result.BranchesDeleted)),
+			"restores_deleted":   fmt.Sprintf("%d", len(result.RestoresDeleted)),
+			"datasets_destroyed": fmt.Sprintf("%d", len(result.DatasetsDestroyed)),
+			"backups_deleted":    fmt.Sprintf("%d", len(result.BackupsDeleted)),
+			"errors":             fmt.Sprintf("%d", len(result.Errors)),
+		},
+	}
+	if err := db.Create(&event).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to record decommission audit event")
+	}
+
+	if err := db.Order("created_at ASC").Find(&result.AuditEvents).Error; err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("export audit log: %v", err))
+	}
+
+	logger.Warn().
+		Int("branches_deleted", len(result.BranchesDeleted)).
+		Int("restores_deleted", len(result.RestoresDeleted)).
+		Int("datasets_destroyed", len(result.DatasetsDestroyed)).
+		Strs("errors", result.Errors).
+		Msg("Server decommissioned")
+
+	return result
+}
+
+// BranchOwners groups branches by the user who created them
+func BranchOwners(db *gorm.DB, branchList []models.Branch) []BranchOwner {
+	byUser := map[string]*BranchOwner{}
+	for _, branch := range branchList {
+		owner, ok := byUser[branch.CreatedByID]
+		if !ok {
+			owner = &BranchOwner{UserID: branch.CreatedByID, Branches: []string{}}
+			var user models.User
+			if err := db.Where("id = ?", branch.CreatedByID).First(&user).Error; err == nil {
+				owner.Email = user.Email
+			}
+			byUser[branch.CreatedByID] = owner
+		}
+		owner.Branches = append(owner.Branches, branch.Name)
+	}
+
+	owners := make([]BranchOwner, 0, len(byUser))
+	for _, owner := range byUser {
+		sort.Strings(owner.Branches)
+		owners = append(owners, *owner)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].Email < owners[j].Email })
+	return owners
+}
+
+// destroyStrayDatasets destroys datasets under the dataset roots that are mounted under the
+// mount roots, i.e. restore and branch datasets whose records are already gone
+func destroyStrayDatasets(ctx context.Context, storage config.StorageConfig) ([]string, []string) {
+	roots := [][2]string{{storage.DatasetRoot, storage.MountRoot}}
+	if storage.SeparateWAL() {
+		roots = append(roots, [2]string{storage.WALDatasetRoot, storage.WALMountRoot})
+	}
+
+	var destroyed, errs []string
+	for _, root := range roots {
+		datasetRoot, mountRoot := root[0], root[1]
+		output, err := exec.CommandContext(ctx, "sudo", "zfs", "list", "-H", "-o", "name,mountpoint", "-d", "1", datasetRoot).Output()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("list datasets under %s: %v", datasetRoot, err))
+			continue
+		}
+
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 2 || fields[0] == datasetRoot || !strings.HasPrefix(fields[1], mountRoot+"/") {
+				continue
+			}
+			if out, err := exec.CommandContext(ctx, "sudo", "zfs", "destroy", "-r", fields[0]).CombinedOutput(); err != nil {
+				errs = append(errs, fmt.Sprintf("destroy dataset %s: %s", fields[0], strings.TrimSpace(string(out))))
+				continue
+			}
+			destroyed = append(destroyed, fields[0])
+		}
+	}
+	return destroyed, errs
+}
+
+// revokeCredentials clears the stored credentials (source, integrations, notification webhooks and fleet agent
+// tokens) and rotates the JWT secret, which invalidates every issued token (dashboard sessions and CLI logins)
+// A server in another process picks the new secret up on its next authenticated request
+func revokeCredentials(db *gorm.DB) error {
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return fmt.Errorf("failed to generate JWT secret: %w", err)
+	}
+	jwtSecret := hex.EncodeToString(secretBytes)
+
+	if err := db.Model(&models.Config{}).Where("1 = 1").Updates(map[string]interface{}{
+		"jwt_secret":                 jwtSecret,
+		"connection_string":          "",
+		"crunchy_bridge_api_key":     "",
+		"pg_back_rest_s3_key":        "",
+		"pg_back_rest_s3_key_secret": "",
+		"pg_back_rest_cipher_pass":   "",
+		"git_hub_webhook_secret":     "",
+		"smtp_password":              "",
+		"o_id_c_client_secret":       "",
+		"notification_webhook_url":   "",
+	}).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.NotificationChannel{}).Where("1 = 1").Update("webhook_url", "").Error; err != nil {
+		return fmt.Errorf("failed to clear notification channels: %w", err)
+	}
+	if err := db.Model(&models.FleetAgent{}).Where("1 = 1").Update("token", "").Error; err != nil {
+		return fmt.Errorf("failed to clear fleet agent tokens: %w", err)
+	}
+
+	auth.InitializeJWT(jwtSecret)
+	return nil
+}
@@ -0,0 +1,91 @@
+package decommission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/notify"
+)
+
+// maxOwnersListed bounds the owners named in the channel message, chats reject long field values
+const maxOwnersListed = 10
+
+// ownerNotification is the webhook body, "text" makes it a valid Slack or Mattermost incoming webhook message
+type ownerNotification struct {
+	Text     string   `json:"text"`
+	Event    string   `json:"event"`
+	Server   string   `json:"server"`
+	Email    string   `json:"email"`
+	Branches []string `json:"branches"`
+}
+
+// notifyBranchOwners tells each owner that their branches are about to be deleted
+// Every notification is logged (and so reaches the configured log sinks). It's also posted to
+// Config.NotificationWebhookURL and emailed to the owner when an SMTP server is configured, owners either reached
+// are marked Notified. The notification channels subscribed to server.decommissioned get one message for all owners
+func notifyBranchOwners(ctx context.Context, db *gorm.DB, cfg *config.Config, config *models.Config, owners []BranchOwner, logger zerolog.Logger) {
+	notifier := notify.NewService(db, cfg, logger)
+	for i := range owners {
+		owner := &owners[i]
+		logger.Warn().
+			Str("event", "branches.decommissioned").
+			Str("email", owner.Email).
+			Strs("branches", owner.Branches).
+			Msg("Notifying branch owner of decommission")
+
+		text := fmt.Sprintf("Branchd server %s is being decommissioned, the branches of %s are deleted: %s",
+			config.Domain, owner.Email, strings.Join(owner.Branches, ", "))
+		if config.NotificationWebhookURL != "" {
+			if err := notify.PostWebhook(ctx, config.NotificationWebhookURL, ownerNotification{
+				Text:     text,
+				Event:    "branches.decommissioned",
+				Server:   config.Domain,
+				Email:    owner.Email,
+				Branches: owner.Branches,
+			}); err != nil {
+				logger.Warn().Err(err).Str("email", owner.Email).Msg("Failed to notify branch owner")
+			} else {
+				owner.Notified = true
+			}
+		}
+
+		err := notifier.SendTo(ctx, config, []string{owner.Email}, notify.Notification{
+			Event:   "branches.decommissioned",
+			Subject: "Your branches are deleted, the server is being decommissioned",
+			Body:    text + "\n\nCopy any data you need elsewhere, the server's restores are deleted as well.\n",
+		})
+		switch {
+		case err == nil:
+			owner.Notified = true
+		case !errors.Is(err, notify.ErrNotConfigured):
+			logger.Warn().Err(err).Str("email", owner.Email).Msg("Failed to email branch owner")
+		}
+	}
+
+	var emails []string
+	branchCount := 0
+	for _, owner := range owners {
+		emails = append(emails, owner.Email)
+		branchCount += len(owner.Branches)
+	}
+	fields := []notify.ChannelField{{Name: "Branches deleted", Value: strconv.Itoa(branchCount)}}
+	if len(emails) > maxOwnersListed {
+		emails = append(emails[:maxOwnersListed], fmt.Sprintf("and %d more", len(owners)-maxOwnersListed))
+	}
+	if len(emails) > 0 {
+		fields = append(fields, notify.ChannelField{Name: "Owners", Value: strings.Join(emails, ", ")})
+	}
+	notifier.Post(ctx, notify.ChannelMessage{
+		Event:  models.ChannelEventDecommissioned,
+		Title:  "Server is being decommissioned, all branches and restores are deleted",
+		Fields: fields,
+	})
+}
@@ -0,0 +1,260 @@
+package dependencies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restores"
+)
+
+// Node types
+const (
+	TypeRestore         = "restore"
+	TypeBranch          = "branch"
+	TypeBranchSchedule  = "branch_schedule"
+	TypeBreakGlassGrant = "break_glass_grant"
+)
+
+// What a cascade does to a node
+const (
+	ActionDelete  = "delete"
+	ActionDisable = "disable" // Schedules, so they don't recreate what the cascade deletes
+	ActionEnd     = "end"     // Break-glass grants, ended by the worker once their branch or restore is gone
+)
+
+// ErrCascadeBlocked is returned when even a cascade can't delete the root, e.g. while one of its branches is promoted
+var ErrCascadeBlocked = errors.New("cascade not possible")
+
+// Branch and restore operations (replaced in tests)
+var (
+	deleteBranch = func(ctx context.Context, service *branches.Service, name string) error {
+		return service.DeleteBranch(ctx, branches.DeleteBranchParams{BranchName: name})
+	}
+	deleteRestore = func(ctx context.Context, service *restores.Service, restore *models.Restore) error {
+		return service.Delete(ctx, restore)
+	}
+)
+
+// Node is a restore, branch, schedule or grant in a dependency graph
+type Node struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"` // restore, branch, branch_schedule or break_glass_grant
+	Name   string `json:"name"`
+	Blocks bool   `json:"blocks"`           // Prevents deleting the root without cascade
+	Action string `json:"action,omitempty"` // What a cascade does to it (delete, disable or end), empty for the root and blocking promotions
+}
+
+// Edge links a node to the node it depends on
+type Edge struct {
+	From string `json:"from"` // The dependent node
+	To   string `json:"to"`
+	Kind string `json:"kind"` // branch_of, clone_of, schedule_of, grant_of or promotion_of
+}
+
+// Graph is everything that depends on a restore or branch, and the order a cascade deletes it in
+type Graph struct {
+	Root         Node     `json:"root"`
+	Nodes        []Node   `json:"nodes"` // Dependents, the root excluded
+	Edges        []Edge   `json:"edges"`
+	Blockers     []string `json:"blockers"`      // IDs of the nodes that prevent a plain delete
+	CascadeOrder []string `json:"cascade_order"` // IDs of the nodes a cascade disables or deletes, in that order, the root last
+
+	// Why even a cascade can't delete the root now, empty if it can
+	CascadeBlocked string `json:"cascade_blocked,omitempty"`
+}
+
+// CascadeResult lists what a cascade did, in order
+type CascadeResult struct {
+	Deleted  []Node `json:"deleted"`
+	Disabled []Node `json:"disabled"`
+}
+
+// Service builds dependency graphs and executes cascades
+type Service struct {
+	db       *gorm.DB
+	branches *branches.Service
+	restores *restores.Service
+	logger   zerolog.Logger
+}
+
+func NewService(db *gorm.DB, branchesService *branches.Service, restoresService *restores.Service, logger zerolog.Logger) *Service {
+	return &Service{
+		db:       db,
+		branches: branchesService,
+		restores: restoresService,
+		logger:   logger.With().Str("component", "dependencies").Logger(),
+	}
+}
+
+// add records a dependent node and its edge to the node it depends on
+func (g *Graph) add(node Node, dependsOn, kind string) {
+	g.Nodes = append(g.Nodes, node)
+	g.Edges = append(g.Edges, Edge{From: node.ID, To: dependsOn, Kind: kind})
+	if node.Blocks {
+		g.Blockers = append(g.Blockers, node.ID)
+	}
+}
+
+func newGraph(root Node) *Graph {
+	return &Graph{Root: root, Nodes: []Node{}, Edges: []Edge{}, Blockers: []string{}, CascadeOrder: []string{}}
+}
+
+// ForRestore returns the dependency graph of a restore: its branches and clones (blocking, as their datasets are
+// clones of the restore's), the clones' own dependents, schedules creating branches from it and break-glass grants
+func (s *Service) ForRestore(restore *models.Restore) (*Graph, error) {
+	g := newGraph(Node{ID: restore.ID, Type: TypeRestore, Name: restore.Name})
+	if err := s.addRestoreDependents(g, restore, true); err != nil {
+		return nil, err
+	}
+	g.CascadeOrder = append(g.CascadeOrder, restore.ID)
+	return g, nil
+}
+
+// ForBranch returns the dependency graph of a branch: the schedule recreating it, a running promotion
+// (which blocks even a cascade) and its break-glass grant
+func (s *Service) ForBranch(branch *models.Branch) (*Graph, error) {
+	g := newGraph(Node{ID: branch.ID, Type: TypeBranch, Name: branch.Name})
+
+	// Deleted on its own the branch is recreated on the schedule's next run
+	var schedule models.BranchSchedule
+	err := s.db.Where("branch_name = ? AND enabled = ?", branch.Name, true).First(&schedule).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to load branch schedule: %w", err)
+	}
+	if err == nil {
+		g.add(Node{ID: schedule.ID, Type: TypeBranchSchedule, Name: schedule.BranchName, Action: ActionDisable}, branch.ID, "schedule_of")
+		g.CascadeOrder = append(g.CascadeOrder, schedule.ID)
+	}
+
+	if err := s.addBranchDependents(g, branch); err != nil {
+		return nil, err
+	}
+	g.CascadeOrder = append(g.CascadeOrder, branch.ID)
+	return g, nil
+}
+
+// addRestoreDependents adds what depends on restore, depth first so the cascade order deletes clones' branches
+// before the clones. Only the root's direct branches and clones block, as in a plain restore delete
+func (s *Service) addRestoreDependents(g *Graph, restore *models.Restore, direct bool) error {
+	// Schedules pinned to the restore would fail every run once it's gone, disabled before its branches are deleted
+	var schedules []models.BranchSchedule
+	if err := s.db.Where("restore_id = ? AND enabled = ?", restore.ID, true).Order("branch_name").Find(&schedules).Error; err != nil {
+		return fmt.Errorf("failed to load branch schedules: %w", err)
+	}
+	for _, schedule := range schedules {
+		g.add(Node{ID: schedule.ID, Type: TypeBranchSchedule, Name: schedule.BranchName, Action: ActionDisable}, restore.ID, "schedule_of")
+		g.CascadeOrder = append(g.CascadeOrder, schedule.ID)
+	}
+
+	var branchList []models.Branch
+	if err := s.db.Where("restore_id = ?", restore.ID).Order("name").Find(&branchList).Error; err != nil {
+		return fmt.Errorf("failed to load branches: %w", err)
+	}
+	for i := range branchList {
+		branch := &branchList[i]
+		g.add(Node{ID: branch.ID, Type: TypeBranch, Name: branch.Name, Blocks: direct, Action: ActionDelete}, restore.ID, "branch_of")
+		if err := s.addBranchDependents(g, branch); err != nil {
+			return err
+		}
+		g.CascadeOrder = append(g.CascadeOrder, branch.ID)
+	}
+
+	var clones []models.Restore
+	if err := s.db.Where("cloned_from_id = ?", restore.ID).Order("name").Find(&clones).Error; err != nil {
+		return fmt.Errorf("failed to load clones: %w", err)
+	}
+	for i := range clones {
+		clone := &clones[i]
+		g.add(Node{ID: clone.ID, Type: TypeRestore, Name: clone.Name, Blocks: direct, Action: ActionDelete}, restore.ID, "clone_of")
+		if err := s.addRestoreDependents(g, clone, false); err != nil {
+			return err
+		}
+		g.CascadeOrder = append(g.CascadeOrder, clone.ID)
+	}
+
+	var grants []models.BreakGlassGrant
+	if err := s.db.Where("restore_id = ? AND status IN ?", restore.ID, []string{models.BreakGlassStatusPending, models.BreakGlassStatusActive}).Find(&grants).Error; err != nil {
+		return fmt.Errorf("failed to load break-glass grants: %w", err)
+	}
+	for _, grant := range grants {
+		g.add(Node{ID: grant.ID, Type: TypeBreakGlassGrant, Name: grant.UserEmail, Action: ActionEnd}, restore.ID, "grant_of")
+	}
+	return nil
+}
+
+// addBranchDependents adds a running promotion of branch and its break-glass grant
+func (s *Service) addBranchDependents(g *Graph, branch *models.Branch) error {
+	// The promotion takes over the branch's datasets, deleting the branch meanwhile would break it
+	var promotion models.Restore
+	err := s.db.Where("promoted_from_branch = ? AND ready_at IS NULL AND failed_at IS NULL", branch.Name).First(&promotion).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("failed to load promotion: %w", err)
+	}
+	if err == nil {
+		g.add(Node{ID: promotion.ID, Type: TypeRestore, Name: promotion.Name, Blocks: true}, branch.ID, "promotion_of")
+		if g.CascadeBlocked == "" {
+			g.CascadeBlocked = fmt.Sprintf("branch %s is being promoted to restore %s", branch.Name, promotion.Name)
+		}
+	}
+
+	var grant models.BreakGlassGrant
+	err = s.db.Where("branch_id = ? AND status = ?", branch.ID, models.BreakGlassStatusActive).First(&grant).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("failed to load break-glass grant: %w", err)
+	}
+	if err == nil {
+		g.add(Node{ID: grant.ID, Type: TypeBreakGlassGrant, Name: grant.UserEmail, Action: ActionEnd}, branch.ID, "grant_of")
+	}
+	return nil
+}
+
+// Cascade disables and deletes the graph's nodes in CascadeOrder, the root last
+// Dependents always go before what they depend on, so stopping at the first failure (what was done is
+// returned with the error) leaves nothing behind whose restore or branch is gone
+func (s *Service) Cascade(ctx context.Context, g *Graph) (*CascadeResult, error) {
+	result := &CascadeResult{Deleted: []Node{}, Disabled: []Node{}}
+	if g.CascadeBlocked != "" {
+		return result, fmt.Errorf("%w: %s", ErrCascadeBlocked, g.CascadeBlocked)
+	}
+
+	nodes := map[string]Node{g.Root.ID: g.Root}
+	for _, node := range g.Nodes {
+		nodes[node.ID] = node
+	}
+
+	for _, id := range g.CascadeOrder {
+		node := nodes[id]
+		s.logger.Info().Str("type", node.Type).Str("name", node.Name).Str("root", g.Root.Name).Msg("Cascading deletion")
+
+		switch node.Type {
+		case TypeBranchSchedule:
+			if err := s.db.Model(&models.BranchSchedule{}).Where("id = ?", node.ID).Update("enabled", false).Error; err != nil {
+				return result, fmt.Errorf("failed to disable schedule of %s: %w", node.Name, err)
+			}
+			result.Disabled = append(result.Disabled, node)
+
+		case TypeBranch:
+			if err := deleteBranch(ctx, s.branches, node.Name); err != nil {
+				return result, fmt.Errorf("failed to delete branch %s: %w", node.Name, err)
+			}
+			result.Deleted = append(result.Deleted, node)
+
+		case TypeRestore:
+			var restore models.Restore
+			if err := s.db.Where("id = ?", node.ID).First(&restore).Error; err != nil {
+				return result, fmt.Errorf("failed to load restore %s: %w", node.Name, err)
+			}
+			if err := deleteRestore(ctx, s.restores, &restore); err != nil {
+				return result, fmt.Errorf("failed to delete restore %s: %w", node.Name, err)
+			}
+			result.Deleted = append(result.Deleted, node)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,205 @@
+package dependencies
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restores"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// In-memory databases exist per connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	return NewService(db, nil, nil, zerolog.Nop())
+}
+
+func create(t *testing.T, s *Service, records ...interface{}) {
+	t.Helper()
+	for _, record := range records {
+		if err := s.db.Create(record).Error; err != nil {
+			t.Fatalf("failed to create %T: %v", record, err)
+		}
+	}
+}
+
+// stubOperations records deletions instead of running their scripts, failing the one of failOn
+func stubOperations(t *testing.T, s *Service, failOn string) *[]string {
+	t.Helper()
+	var deleted []string
+	origBranch, origRestore := deleteBranch, deleteRestore
+	deleteBranch = func(ctx context.Context, _ *branches.Service, name string) error {
+		if name == failOn {
+			return errors.New("zfs destroy failed")
+		}
+		deleted = append(deleted, name)
+		return s.db.Where("name = ?", name).Delete(&models.Branch{}).Error
+	}
+	deleteRestore = func(ctx context.Context, _ *restores.Service, restore *models.Restore) error {
+		if restore.Name == failOn {
+			return errors.New("zfs destroy failed")
+		}
+		deleted = append(deleted, restore.Name)
+		return s.db.Delete(restore).Error
+	}
+	t.Cleanup(func() { deleteBranch, deleteRestore = origBranch, origRestore })
+	return &deleted
+}
+
+// restoreTree creates restore_a with branch feature-x, a clone restore_b with branch feature-y,
+// a schedule pinned to restore_a and an active break-glass grant on feature-x
+func restoreTree(t *testing.T, s *Service) (*models.Restore, *models.BranchSchedule) {
+	t.Helper()
+	readyAt := time.Now()
+	source := &models.Restore{Name: "restore_a", ReadyAt: &readyAt, Port: 5433}
+	create(t, s, source)
+	clone := &models.Restore{Name: "restore_b", ReadyAt: &readyAt, Port: 5434, ClonedFromID: source.ID}
+	create(t, s, clone)
+	featureX := &models.Branch{Name: "feature-x", RestoreID: source.ID, CreatedByID: "user-1", User: "u", Password: "p", Port: 6001}
+	featureY := &models.Branch{Name: "feature-y", RestoreID: clone.ID, CreatedByID: "user-1", User: "u", Password: "p", Port: 6002}
+	schedule := &models.BranchSchedule{BranchName: "nightly", Schedule: "0 6 * * *", CreatedByID: "user-1", Enabled: true, RestoreID: source.ID}
+	create(t, s, featureX, featureY, schedule)
+	create(t, s, &models.BreakGlassGrant{UserEmail: "carol@example.com", Status: models.BreakGlassStatusActive, BranchID: featureX.ID})
+	return source, schedule
+}
+
+func nodeNames(t *testing.T, g *Graph, ids []string) string {
+	t.Helper()
+	names := map[string]string{g.Root.ID: g.Root.Name}
+	for _, node := range g.Nodes {
+		names[node.ID] = node.Type + ":" + node.Name
+	}
+	var result []string
+	for _, id := range ids {
+		result = append(result, names[id])
+	}
+	return strings.Join(result, ",")
+}
+
+func TestForRestore(t *testing.T) {
+	s := newTestService(t)
+	source, _ := restoreTree(t, s)
+
+	g, err := s.ForRestore(source)
+	if err != nil {
+		t.Fatalf("ForRestore() error = %v", err)
+	}
+
+	// Only the direct branch and clone block, as in a plain delete
+	if got := nodeNames(t, g, g.Blockers); got != "branch:feature-x,restore:restore_b" {
+		t.Errorf("blockers = %s, want feature-x and restore_b", got)
+	}
+	// Schedules first, dependents before what they depend on, the root last
+	want := "branch_schedule:nightly,branch:feature-x,branch:feature-y,restore:restore_b,restore_a"
+	if got := nodeNames(t, g, g.CascadeOrder); got != want {
+		t.Errorf("cascade order = %s, want %s", got, want)
+	}
+	if len(g.Nodes) != 5 || len(g.Edges) != 5 || g.CascadeBlocked != "" {
+		t.Errorf("graph = %+v, want 5 nodes (with the grant) and edges, cascade possible", g)
+	}
+}
+
+func TestCascadeRestore(t *testing.T) {
+	s := newTestService(t)
+	source, schedule := restoreTree(t, s)
+	deleted := stubOperations(t, s, "")
+
+	g, err := s.ForRestore(source)
+	if err != nil {
+		t.Fatalf("ForRestore() error = %v", err)
+	}
+	result, err := s.Cascade(context.Background(), g)
+	if err != nil {
+		t.Fatalf("Cascade() error = %v", err)
+	}
+
+	if got := strings.Join(*deleted, ","); got != "feature-x,feature-y,restore_b,restore_a" {
+		t.Errorf("deleted %s, want feature-x, feature-y, restore_b, restore_a", got)
+	}
+	if len(result.Deleted) != 4 || len(result.Disabled) != 1 {
+		t.Errorf("result = %+v, want 4 deleted, 1 disabled", result)
+	}
+	var reloaded models.BranchSchedule
+	s.db.First(&reloaded, "id = ?", schedule.ID)
+	if reloaded.Enabled {
+		t.Error("schedule pinned to the restore still enabled")
+	}
+}
+
+func TestCascadeStopsAtFirstFailure(t *testing.T) {
+	s := newTestService(t)
+	source, _ := restoreTree(t, s)
+	deleted := stubOperations(t, s, "feature-y")
+
+	g, err := s.ForRestore(source)
+	if err != nil {
+		t.Fatalf("ForRestore() error = %v", err)
+	}
+	result, err := s.Cascade(context.Background(), g)
+	if err == nil || !strings.Contains(err.Error(), "feature-y") {
+		t.Fatalf("Cascade() error = %v, want feature-y's failure", err)
+	}
+	// The clone and the root, which feature-y depends on, are kept
+	if got := strings.Join(*deleted, ","); got != "feature-x" || len(result.Deleted) != 1 {
+		t.Errorf("deleted %s (result %+v), want only feature-x", got, result.Deleted)
+	}
+}
+
+func TestForBranch(t *testing.T) {
+	s := newTestService(t)
+	readyAt := time.Now()
+	source := &models.Restore{Name: "restore_a", ReadyAt: &readyAt, Port: 5433}
+	create(t, s, source)
+	branch := &models.Branch{Name: "nightly", RestoreID: source.ID, CreatedByID: "user-1", User: "u", Password: "p", Port: 6001}
+	create(t, s, branch, &models.BranchSchedule{BranchName: "nightly", Schedule: "0 6 * * *", CreatedByID: "user-1", Enabled: true})
+	deleted := stubOperations(t, s, "")
+
+	g, err := s.ForBranch(branch)
+	if err != nil {
+		t.Fatalf("ForBranch() error = %v", err)
+	}
+	if len(g.Blockers) != 0 {
+		t.Errorf("blockers = %v, want none", g.Blockers)
+	}
+	if got := nodeNames(t, g, g.CascadeOrder); got != "branch_schedule:nightly,nightly" {
+		t.Errorf("cascade order = %s, want the schedule, then the branch", got)
+	}
+
+	// A running promotion takes over the branch's datasets
+	startedAt := time.Now()
+	create(t, s, &models.Restore{Name: "restore_p", Port: 5435, StartedAt: &startedAt, PromotedFromBranch: "nightly", PromotedFromRestoreID: source.ID})
+	g, err = s.ForBranch(branch)
+	if err != nil {
+		t.Fatalf("ForBranch() error = %v", err)
+	}
+	if got := nodeNames(t, g, g.Blockers); got != "restore:restore_p" || !strings.Contains(g.CascadeBlocked, "restore_p") {
+		t.Errorf("blockers = %s, cascade blocked %q; want the promotion", got, g.CascadeBlocked)
+	}
+	if _, err := s.Cascade(context.Background(), g); !errors.Is(err, ErrCascadeBlocked) {
+		t.Errorf("Cascade() error = %v, want ErrCascadeBlocked", err)
+	}
+	if len(*deleted) != 0 {
+		t.Errorf("deleted %v during a promotion", *deleted)
+	}
+}
@@ -0,0 +1,219 @@
+package exports
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Retention is how long a downloadable archive is kept
+const Retention = 24 * time.Hour
+
+// dumpBranch writes a custom-format pg_dump archive of a branch database to w (replaced in tests)
+var dumpBranch = func(ctx context.Context, postgresVersion string, port int, database string, w io.Writer) error {
+	pgDump := fmt.Sprintf("/usr/lib/postgresql/%s/bin/pg_dump", postgresVersion)
+	cmd := exec.CommandContext(ctx, "sudo", "-u", "postgres", pgDump, "-Fc", "-p", strconv.Itoa(port), "-d", database)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("pg_dump failed: %s", message)
+		}
+		return fmt.Errorf("pg_dump failed: %w", err)
+	}
+	return nil
+}
+
+// ArchivePath returns where the archive of an export is kept for download
+func ArchivePath(storage config.StorageConfig, exportID string) string {
+	return filepath.Join(storage.ExportDir(), exportID+".dump")
+}
+
+// FileName returns the name an archive is downloaded as, e.g. feature-x-20250301143000.dump
+func FileName(export *models.BranchExport) string {
+	return fmt.Sprintf("%s-%s.dump", export.BranchName, export.CreatedAt.UTC().Format("20060102150405"))
+}
+
+// ValidateUploadURL checks a pre-signed upload URL before it's queued
+func ValidateUploadURL(uploadURL string) error {
+	u, err := url.Parse(uploadURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("upload_url must be an http(s) URL")
+	}
+	return nil
+}
+
+// Run dumps the branch of an export (the worker's export task)
+// Without uploadURL the archive is kept for download until Retention passed, with it the archive is
+// PUT there (e.g. a pre-signed S3 URL) and not kept
+func Run(ctx context.Context, db *gorm.DB, storage config.StorageConfig, exportID, uploadURL string, logger zerolog.Logger) error {
+	var export models.BranchExport
+	if err := db.Where("id = ?", exportID).First(&export).Error; err != nil {
+		return fmt.Errorf("failed to load export: %w", err)
+	}
+	if err := db.Model(&export).Update("status", models.ExportStatusRunning).Error; err != nil {
+		return fmt.Errorf("failed to update export: %w", err)
+	}
+
+	size, err := run(ctx, db, storage, &export, uploadURL)
+	now := time.Now()
+	updates := map[string]interface{}{"completed_at": now}
+	if err != nil {
+		updates["status"] = models.ExportStatusFailed
+		updates["error"] = err.Error()
+	} else {
+		updates["status"] = models.ExportStatusCompleted
+		updates["size_bytes"] = size
+		updates["uploaded"] = uploadURL != ""
+		if uploadURL == "" {
+			updates["expires_at"] = now.Add(Retention)
+		}
+	}
+	if updateErr := db.Model(&export).Updates(updates).Error; updateErr != nil {
+		logger.Error().Err(updateErr).Str("export_id", export.ID).Msg("Failed to record export result")
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info().
+		Str("export_id", export.ID).
+		Str("branch_name", export.BranchName).
+		Int64("size_bytes", size).
+		Bool("uploaded", uploadURL != "").
+		Msg("Branch exported")
+	return nil
+}
+
+// run writes the archive and uploads it if requested, returning its size
+func run(ctx context.Context, db *gorm.DB, storage config.StorageConfig, export *models.BranchExport, uploadURL string) (int64, error) {
+	var branch models.Branch
+	if err := db.Preload("Restore").Where("id = ?", export.BranchID).First(&branch).Error; err != nil {
+		return 0, fmt.Errorf("failed to load branch %s: %w", export.BranchName, err)
+	}
+	if branch.SuspendedAt != nil {
+		return 0, fmt.Errorf("branch %s is suspended", branch.Name)
+	}
+	// Branches of raw restores hold data that isn't anonymized, it mustn't leave the server
+	if branch.Restore.Raw {
+		return 0, fmt.Errorf("branch %s is a break-glass branch", branch.Name)
+	}
+	var config models.Config
+	if err := db.First(&config).Error; err != nil {
+		return 0, fmt.Errorf("failed to load config: %w", err)
+	}
+	// Same target database resolution as createBranch
+	databaseName := config.DatabaseName
+	if config.CrunchyBridgeDatabaseName != "" {
+		databaseName = config.CrunchyBridgeDatabaseName
+	}
+
+	if err := os.MkdirAll(storage.ExportDir(), 0o700); err != nil {
+		return 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	path := ArchivePath(storage, export.ID)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	err = dumpBranch(ctx, branch.Restore.ClusterPostgresVersion(&config), branch.Port, databaseName, file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write archive: %w", closeErr)
+	}
+	var size int64
+	if err == nil {
+		var info os.FileInfo
+		if info, err = os.Stat(path); err == nil {
+			size = info.Size()
+		}
+	}
+	if err == nil && uploadURL != "" {
+		err = upload(ctx, uploadURL, path)
+	}
+
+	// Uploaded archives and partial ones aren't kept
+	if err != nil || uploadURL != "" {
+		if removeErr := os.Remove(path); removeErr != nil && !os.IsNotExist(removeErr) && err == nil {
+			err = fmt.Errorf("failed to remove uploaded archive: %w", removeErr)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// upload PUTs the archive to a pre-signed URL
+func upload(ctx context.Context, uploadURL, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat archive: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uploadURL, file)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL carries the upload's signature, keep it out of the recorded error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to upload archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("upload returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// DeleteExpired deletes the archives of exports kept past their expiry
+func DeleteExpired(db *gorm.DB, storage config.StorageConfig, now time.Time) (int, error) {
+	var expired []models.BranchExport
+	if err := db.Where("status = ? AND uploaded = ? AND expires_at < ?", models.ExportStatusCompleted, false, now).Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to load expired exports: %w", err)
+	}
+
+	deleted := 0
+	for i := range expired {
+		export := &expired[i]
+		if err := os.Remove(ArchivePath(storage, export.ID)); err != nil && !os.IsNotExist(err) {
+			return deleted, fmt.Errorf("failed to delete archive of export %s: %w", export.ID, err)
+		}
+		if err := db.Model(export).Update("status", models.ExportStatusExpired).Error; err != nil {
+			return deleted, fmt.Errorf("failed to update export %s: %w", export.ID, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,196 @@
+package exports
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// newTestExport creates branch feature-x of a ready restore and a pending export of it
+func newTestExport(t *testing.T, raw bool) (*gorm.DB, config.StorageConfig, *models.BranchExport) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// In-memory databases exist per connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+
+	readyAt := time.Now()
+	restore := &models.Restore{Name: "restore_a", ReadyAt: &readyAt, Port: 5433, PostgresVersion: "17", Raw: raw}
+	branch := &models.Branch{Name: "feature-x", CreatedByID: "user-1", User: "u", Password: "p", Port: 6001}
+	export := &models.BranchExport{BranchName: "feature-x", RequestedByID: "user-1", Status: models.ExportStatusPending}
+	for _, record := range []interface{}{&models.Config{ConnectionString: "postgres://source/app"}, restore} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("failed to create %T: %v", record, err)
+		}
+	}
+	branch.RestoreID = restore.ID
+	if err := db.Create(branch).Error; err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+	export.BranchID = branch.ID
+	if err := db.Create(export).Error; err != nil {
+		t.Fatalf("failed to create export: %v", err)
+	}
+	return db, config.StorageConfig{MountRoot: t.TempDir()}, export
+}
+
+// stubDump writes archive instead of running pg_dump, failing with err if set
+func stubDump(t *testing.T, archive string, err error) {
+	t.Helper()
+	orig := dumpBranch
+	dumpBranch = func(ctx context.Context, postgresVersion string, port int, database string, w io.Writer) error {
+		if postgresVersion != "17" || port != 6001 || database != "app" {
+			t.Errorf("dumpBranch(%s, %d, %s), want 17, 6001, app", postgresVersion, port, database)
+		}
+		io.WriteString(w, archive)
+		return err
+	}
+	t.Cleanup(func() { dumpBranch = orig })
+}
+
+func reload(t *testing.T, db *gorm.DB, export *models.BranchExport) *models.BranchExport {
+	t.Helper()
+	var reloaded models.BranchExport
+	if err := db.First(&reloaded, "id = ?", export.ID).Error; err != nil {
+		t.Fatalf("failed to reload export: %v", err)
+	}
+	return &reloaded
+}
+
+func TestRunKeepsArchiveForDownload(t *testing.T) {
+	db, storage, export := newTestExport(t, false)
+	stubDump(t, "PGDMP archive", nil)
+
+	if err := Run(context.Background(), db, storage, export.ID, "", zerolog.Nop()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	got := reload(t, db, export)
+	if got.Status != models.ExportStatusCompleted || got.SizeBytes != 13 || got.Uploaded || got.ExpiresAt == nil {
+		t.Errorf("export = %+v, want completed, 13 bytes, expiring", got)
+	}
+	if data, err := os.ReadFile(ArchivePath(storage, export.ID)); err != nil || string(data) != "PGDMP archive" {
+		t.Errorf("archive = %q (%v), want the dump", data, err)
+	}
+
+	// Expired archives are deleted
+	deleted, err := DeleteExpired(db, storage, got.ExpiresAt.Add(time.Minute))
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteExpired() = %d, %v; want 1", deleted, err)
+	}
+	if _, err := os.Stat(ArchivePath(storage, export.ID)); !os.IsNotExist(err) {
+		t.Errorf("archive still exists after expiry: %v", err)
+	}
+	if got := reload(t, db, export); got.Status != models.ExportStatusExpired {
+		t.Errorf("status = %s, want expired", got.Status)
+	}
+}
+
+func TestRunUploadsArchive(t *testing.T) {
+	db, storage, export := newTestExport(t, false)
+	stubDump(t, "PGDMP archive", nil)
+
+	var uploaded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPut {
+			t.Errorf("upload method = %s, want PUT", r.Method)
+		}
+		uploaded = string(body)
+	}))
+	defer server.Close()
+
+	if err := Run(context.Background(), db, storage, export.ID, server.URL+"/bucket/feature-x.dump?X-Amz-Signature=secret", zerolog.Nop()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if uploaded != "PGDMP archive" {
+		t.Errorf("uploaded %q, want the dump", uploaded)
+	}
+	got := reload(t, db, export)
+	if got.Status != models.ExportStatusCompleted || !got.Uploaded || got.SizeBytes != 13 || got.ExpiresAt != nil {
+		t.Errorf("export = %+v, want completed, uploaded, 13 bytes", got)
+	}
+	if _, err := os.Stat(ArchivePath(storage, export.ID)); !os.IsNotExist(err) {
+		t.Errorf("uploaded archive kept: %v", err)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	t.Run("pg_dump", func(t *testing.T) {
+		db, storage, export := newTestExport(t, false)
+		stubDump(t, "PGDMP partial", errors.New("pg_dump failed: connection refused"))
+
+		if err := Run(context.Background(), db, storage, export.ID, "", zerolog.Nop()); err == nil {
+			t.Fatal("Run() error = nil, want pg_dump's failure")
+		}
+		if got := reload(t, db, export); got.Status != models.ExportStatusFailed || !strings.Contains(got.Error, "connection refused") {
+			t.Errorf("export = %+v, want failed with pg_dump's error", got)
+		}
+		if _, err := os.Stat(ArchivePath(storage, export.ID)); !os.IsNotExist(err) {
+			t.Errorf("partial archive kept: %v", err)
+		}
+	})
+
+	t.Run("upload", func(t *testing.T) {
+		db, storage, export := newTestExport(t, false)
+		stubDump(t, "PGDMP archive", nil)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		if err := Run(context.Background(), db, storage, export.ID, server.URL+"/?X-Amz-Signature=secret", zerolog.Nop()); err == nil {
+			t.Fatal("Run() error = nil, want the upload's failure")
+		}
+		got := reload(t, db, export)
+		if got.Status != models.ExportStatusFailed || !strings.Contains(got.Error, "403") || strings.Contains(got.Error, "secret") {
+			t.Errorf("error = %q, want the status without the signature", got.Error)
+		}
+	})
+
+	t.Run("raw restore", func(t *testing.T) {
+		db, storage, export := newTestExport(t, true)
+		stubDump(t, "PGDMP archive", nil)
+
+		if err := Run(context.Background(), db, storage, export.ID, "", zerolog.Nop()); err == nil || !strings.Contains(err.Error(), "break-glass") {
+			t.Errorf("Run() error = %v, want break-glass branches rejected", err)
+		}
+	})
+}
+
+func TestValidateUploadURL(t *testing.T) {
+	for _, uploadURL := range []string{"https://bucket.s3.amazonaws.com/a.dump?X-Amz-Signature=x", "http://minio:9000/a.dump"} {
+		if err := ValidateUploadURL(uploadURL); err != nil {
+			t.Errorf("ValidateUploadURL(%s) error = %v", uploadURL, err)
+		}
+	}
+	for _, uploadURL := range []string{"s3://bucket/a.dump", "/tmp/a.dump", "https://"} {
+		if err := ValidateUploadURL(uploadURL); err == nil {
+			t.Errorf("ValidateUploadURL(%s) error = nil, want invalid", uploadURL)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package fixtures
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+// ApplyParams identifies the database a fixture is applied to
+type ApplyParams struct {
+	DatabaseName    string
+	PostgresVersion string
+	PostgresPort    int
+}
+
+// ApplyResult reports the rows a fixture inserted
+type ApplyResult struct {
+	Tables []TableResult `json:"tables"`
+	Rows   int           `json:"rows"`
+}
+
+// TableResult reports the rows inserted into one table
+type TableResult struct {
+	Table string `json:"table"`
+	Rows  int    `json:"rows"`
+}
+
+// Apply generates a fixture's rows in a database, in a single transaction
+func Apply(ctx context.Context, fixture *models.Fixture, params ApplyParams, logger zerolog.Logger) (*ApplyResult, error) {
+	if err := Validate(fixture.Tables); err != nil {
+		return nil, err
+	}
+
+	columnTypes, err := queryColumnTypes(ctx, params, fixture.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	sql, err := GenerateSQL(fixture, columnTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info().
+		Str("database_name", params.DatabaseName).
+		Str("fixture", fixture.Name).
+		Int("tables", len(fixture.Tables)).
+		Msg("Applying fixture")
+
+	if output, err := runPsql(ctx, params, sql, "--single-transaction"); err != nil {
+		logger.Error().
+			Err(err).
+			Str("output", output).
+			Str("database_name", params.DatabaseName).
+			Msg("Failed to apply fixture")
+		return nil, fmt.Errorf("failed to apply fixture: %s", psqlError(output, err))
+	}
+
+	result := &ApplyResult{Tables: make([]TableResult, len(fixture.Tables))}
+	for i, table := range fixture.Tables {
+		result.Tables[i] = TableResult{Table: table.Table, Rows: table.Rows}
+		result.Rows += table.Rows
+	}
+
+	logger.Info().
+		Str("database_name", params.DatabaseName).
+		Str("fixture", fixture.Name).
+		Int("rows", result.Rows).
+		Msg("Fixture applied successfully")
+
+	return result, nil
+}
+
+// queryColumnTypes looks up the types of the fixture's columns (table -> column -> type)
+// Tables are resolved with the database's search_path, so unqualified names work
+func queryColumnTypes(ctx context.Context, params ApplyParams, tables []models.FixtureTable) (map[string]map[string]string, error) {
+	var queries []string
+	for _, table := range tables {
+		queries = append(queries, fmt.Sprintf(
+			"SELECT %[1]s, attname, format_type(atttypid, atttypmod) FROM pg_attribute WHERE attrelid = to_regclass(%[1]s) AND attnum > 0 AND NOT attisdropped",
+			pgclient.QuoteLiteral(pgclient.QuoteTable(table.Table)),
+		))
+	}
+
+	output, err := runPsql(ctx, params, strings.Join(queries, "\nUNION ALL\n")+";", "-t", "-A", "-F", "|")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query column types: %s", psqlError(output, err))
+	}
+
+	// The query returns the quoted name, map it back to the fixture's table name
+	names := make(map[string]string, len(tables))
+	for _, table := range tables {
+		names[pgclient.QuoteTable(table.Table)] = table.Table
+	}
+
+	columnTypes := make(map[string]map[string]string, len(tables))
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		parts := strings.SplitN(line, "|", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		table := names[parts[0]]
+		if columnTypes[table] == nil {
+			columnTypes[table] = map[string]string{}
+		}
+		columnTypes[table][parts[1]] = parts[2]
+	}
+
+	for _, table := range tables {
+		if columnTypes[table.Table] == nil {
+			return nil, fmt.Errorf("table %s does not exist", table.Table)
+		}
+	}
+	return columnTypes, nil
+}
+
+// runPsql runs SQL as the postgres user against the target database
+func runPsql(ctx context.Context, params ApplyParams, sql string, args ...string) (string, error) {
+	psql := fmt.Sprintf("/usr/lib/postgresql/%s/bin/psql", params.PostgresVersion)
+	cmdArgs := append([]string{"-u", "postgres", psql,
+		"-p", fmt.Sprintf("%d", params.PostgresPort),
+		"-d", params.DatabaseName,
+		"-v", "ON_ERROR_STOP=1",
+	}, args...)
+
+	cmd := exec.CommandContext(ctx, "sudo", cmdArgs...)
+	cmd.Stdin = strings.NewReader(sql)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// psqlError returns the ERROR line of psql output, or the exec error if there is none
+func psqlError(output string, err error) string {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "ERROR:") {
+			return strings.TrimSpace(line)
+		}
+	}
+	return err.Error()
+}
@@ -0,0 +1,309 @@
+package fixtures
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/anonymize"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+// Value generators (FixtureColumn.Generator)
+const (
+	GeneratorSequence    = "sequence"
+	GeneratorInteger     = "integer"
+	GeneratorDecimal     = "decimal"
+	GeneratorBoolean     = "boolean"
+	GeneratorText        = "text"
+	GeneratorChoice      = "choice"
+	GeneratorTimestamp   = "timestamp"
+	GeneratorUUID        = "uuid"
+	GeneratorReference   = "reference"
+	GeneratorFakeName    = anonymize.FunctionFakeName
+	GeneratorFakeEmail   = anonymize.FunctionFakeEmail
+	GeneratorFakeAddress = anonymize.FunctionFakeAddress
+	GeneratorNull        = "null"
+)
+
+// Generators lists all supported value generators
+var Generators = []string{
+	GeneratorSequence,
+	GeneratorInteger,
+	GeneratorDecimal,
+	GeneratorBoolean,
+	GeneratorText,
+	GeneratorChoice,
+	GeneratorTimestamp,
+	GeneratorUUID,
+	GeneratorReference,
+	GeneratorFakeName,
+	GeneratorFakeEmail,
+	GeneratorFakeAddress,
+	GeneratorNull,
+}
+
+// MaxRows caps the rows generated per table, fixtures are meant to be applied in seconds
+const MaxRows = 10_000_000
+
+// Defaults of the generator options
+const (
+	defaultMax   = 1000
+	defaultRatio = 0.5
+	defaultFrom  = "2024-01-01"
+	defaultTo    = "2025-01-01"
+)
+
+// rowIndex is the row number column of the generate_series the values are computed from
+const rowIndex = "n"
+
+// Validate checks a fixture's tables and generator options
+func Validate(tables []models.FixtureTable) error {
+	if len(tables) == 0 {
+		return fmt.Errorf("at least one table is required")
+	}
+
+	seen := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		if strings.TrimSpace(table.Table) == "" {
+			return fmt.Errorf("table name is required")
+		}
+		if seen[table.Table] {
+			return fmt.Errorf("table %s is listed twice", table.Table)
+		}
+		if table.Rows < 1 || table.Rows > MaxRows {
+			return fmt.Errorf("%s: rows must be between 1 and %d", table.Table, MaxRows)
+		}
+		if len(table.Columns) == 0 {
+			return fmt.Errorf("%s: at least one column is required", table.Table)
+		}
+
+		columns := make(map[string]bool, len(table.Columns))
+		for _, column := range table.Columns {
+			if column.Column == "" {
+				return fmt.Errorf("%s: column name is required", table.Table)
+			}
+			if columns[column.Column] {
+				return fmt.Errorf("%s: column %s is listed twice", table.Table, column.Column)
+			}
+			columns[column.Column] = true
+
+			if err := validateColumn(column, tables, seen); err != nil {
+				return fmt.Errorf("%s.%s: %w", table.Table, column.Column, err)
+			}
+		}
+		seen[table.Table] = true
+	}
+	return nil
+}
+
+// validateColumn checks a column's generator options
+// filled holds the tables before the column's table, the only ones it can reference
+func validateColumn(column models.FixtureColumn, tables []models.FixtureTable, filled map[string]bool) error {
+	if column.NullRatio < 0 || column.NullRatio > 1 {
+		return fmt.Errorf("null_ratio must be between 0 and 1")
+	}
+
+	switch column.Generator {
+	case GeneratorSequence, GeneratorText, GeneratorUUID, GeneratorFakeName, GeneratorFakeEmail, GeneratorFakeAddress, GeneratorNull:
+	case GeneratorInteger, GeneratorDecimal:
+		if max := maxOrDefault(column); max < column.Min {
+			return fmt.Errorf("max must not be less than min")
+		}
+	case GeneratorBoolean:
+		if column.Ratio < 0 || column.Ratio > 1 {
+			return fmt.Errorf("ratio must be between 0 and 1")
+		}
+	case GeneratorChoice:
+		if len(column.Values) == 0 {
+			return fmt.Errorf("choice generator requires values")
+		}
+	case GeneratorTimestamp:
+		from, to, err := timestampRange(column)
+		if err != nil {
+			return err
+		}
+		if !to.After(from) {
+			return fmt.Errorf("to must be after from")
+		}
+	case GeneratorReference:
+		if !filled[column.References] {
+			return fmt.Errorf("references must name a table listed before this one")
+		}
+		if _, _, ok := referencedSequence(tables, column.References); !ok {
+			return fmt.Errorf("referenced table %s has no sequence column", column.References)
+		}
+	default:
+		return fmt.Errorf("invalid generator '%s', must be one of: %s", column.Generator, strings.Join(Generators, ", "))
+	}
+	return nil
+}
+
+// GenerateSQL renders the INSERT statements of a fixture
+// columnTypes maps table -> column -> type, values are cast to the column's type
+func GenerateSQL(fixture *models.Fixture, columnTypes map[string]map[string]string) (string, error) {
+	var statements []string
+	for _, table := range fixture.Tables {
+		types := columnTypes[table.Table]
+
+		columns := make([]string, len(table.Columns))
+		values := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			columnType, ok := types[column.Column]
+			if !ok {
+				return "", fmt.Errorf("column %s.%s does not exist", table.Table, column.Column)
+			}
+			columns[i] = pgclient.QuoteIdentifier(column.Column)
+			values[i] = fmt.Sprintf("(%s)::text::%s", columnValue(fixture, table, column), columnType)
+		}
+
+		if table.Truncate {
+			statements = append(statements, fmt.Sprintf("TRUNCATE %s CASCADE;", pgclient.QuoteTable(table.Table)))
+		}
+		statements = append(statements, fmt.Sprintf("INSERT INTO %s (%s)\nSELECT %s\nFROM generate_series(1, %d)::bigint AS %s;",
+			pgclient.QuoteTable(table.Table),
+			strings.Join(columns, ", "),
+			strings.Join(values, ",\n       "),
+			table.Rows,
+			rowIndex,
+		))
+	}
+	return strings.Join(statements, "\n\n"), nil
+}
+
+// columnValue renders the SQL expression generating a column's value for row n
+func columnValue(fixture *models.Fixture, table models.FixtureTable, column models.FixtureColumn) string {
+	salt := columnSalt(fixture.Seed, table.Table, column.Column)
+	random := randomExpr(salt)
+
+	var expr string
+	switch column.Generator {
+	case GeneratorSequence:
+		expr = fmt.Sprintf("%d + %s - 1", startOrDefault(column.Start), rowIndex)
+
+	case GeneratorInteger:
+		min := int64(column.Min)
+		span := int64(maxOrDefault(column)) - min + 1
+		expr = fmt.Sprintf("%d + %s %% %d", min, random, span)
+
+	case GeneratorDecimal:
+		expr = fmt.Sprintf("round(%g + %s::numeric / 4294967295 * %g, 2)", column.Min, random, maxOrDefault(column)-column.Min)
+
+	case GeneratorBoolean:
+		ratio := column.Ratio
+		if ratio == 0 {
+			ratio = defaultRatio
+		}
+		expr = fmt.Sprintf("%s %% 10000 < %d", random, int64(ratio*10000))
+
+	case GeneratorText:
+		parts := strings.Split(column.Template, "${index}")
+		quoted := make([]string, len(parts))
+		for i, part := range parts {
+			quoted[i] = pgclient.QuoteLiteral(part)
+		}
+		expr = strings.Join(quoted, " || "+rowIndex+" || ")
+
+	case GeneratorChoice:
+		quoted := make([]string, len(column.Values))
+		for i, value := range column.Values {
+			quoted[i] = pgclient.QuoteLiteral(value)
+		}
+		expr = fmt.Sprintf("(ARRAY[%s])[1 + %s %% %d]", strings.Join(quoted, ", "), random, len(column.Values))
+
+	case GeneratorTimestamp:
+		from, to, _ := timestampRange(column)
+		seconds := int64(to.Sub(from).Seconds())
+		expr = fmt.Sprintf("%s::timestamptz + (%s %% %d) * interval '1 second'",
+			pgclient.QuoteLiteral(from.Format(time.RFC3339)), random, seconds)
+
+	case GeneratorUUID:
+		expr = fmt.Sprintf("md5('%d:' || %s)::uuid", salt, rowIndex)
+
+	case GeneratorReference:
+		start, rows, _ := referencedSequence(fixture.Tables, column.References)
+		expr = fmt.Sprintf("%d + %s %% %d", start, random, rows)
+
+	case GeneratorFakeName, GeneratorFakeEmail, GeneratorFakeAddress:
+		expr, _ = anonymize.FakeValueSQL(column.Generator, fmt.Sprintf("(%s + %d)", rowIndex, fixture.Seed))
+
+	default:
+		// GeneratorNull, unknown generators are rejected by Validate
+		expr = "NULL"
+	}
+
+	if column.NullRatio > 0 {
+		nullRandom := randomExpr(columnSalt(fixture.Seed, table.Table, column.Column+"/null"))
+		expr = fmt.Sprintf("CASE WHEN %s %% 10000 < %d THEN NULL ELSE %s END", nullRandom, int64(column.NullRatio*10000), expr)
+	}
+	return expr
+}
+
+// randomExpr renders a pseudo-random value in [0, 2^32) derived from the row number and salt
+// Multiplicative hashing keeps it deterministic and free of PostgreSQL version specifics,
+// the halves are swapped because the low bits of the product are poorly mixed
+func randomExpr(salt uint32) string {
+	mixed := fmt.Sprintf("((%s * 2654435761 + %d) %% 4294967296)", rowIndex, salt)
+	return fmt.Sprintf("(%[1]s / 65536 + %[1]s %% 65536 * 65536)", mixed)
+}
+
+// columnSalt derives a per-column salt, so columns of the same row aren't correlated
+func columnSalt(seed int64, table, column string) uint32 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d/%s/%s", seed, table, column)
+	return h.Sum32()
+}
+
+// referencedSequence returns the first value and row count of a table's sequence column
+func referencedSequence(tables []models.FixtureTable, name string) (int64, int, bool) {
+	for _, table := range tables {
+		if table.Table != name {
+			continue
+		}
+		for _, column := range table.Columns {
+			if column.Generator == GeneratorSequence {
+				return startOrDefault(column.Start), table.Rows, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// timestampRange parses the from/to options of the timestamp generator
+func timestampRange(column models.FixtureColumn) (time.Time, time.Time, error) {
+	from, err := parseTime(column.From, defaultFrom)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+	}
+	to, err := parseTime(column.To, defaultTo)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+	}
+	return from, to, nil
+}
+
+func parseTime(value, fallback string) (time.Time, error) {
+	if value == "" {
+		value = fallback
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func startOrDefault(start int64) int64 {
+	if start == 0 {
+		return 1
+	}
+	return start
+}
+
+func maxOrDefault(column models.FixtureColumn) float64 {
+	if column.Max == 0 && column.Min < defaultMax {
+		return defaultMax
+	}
+	return column.Max
+}
@@ -0,0 +1,327 @@
+// Package fleet implements the control-plane mode (FLEET_ENABLED): one server aggregates the branches and restores
+// of the agent servers registered with it, and places new branches on the least-loaded server.
+// Agents are plain branchd servers reached through their API, they don't know they're part of a fleet.
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+)
+
+// LocalHost is the name of the control-plane server itself in the fleet view
+const LocalHost = "local"
+
+// ErrNoHost is returned by Place when no reachable host has a ready restore and capacity for another branch
+var ErrNoHost = errors.New("no reachable host with a ready restore and capacity for another branch")
+
+// localCapacity reads the local server's headroom for new branches (replaced in tests)
+var localCapacity = func(ctx context.Context, s *Service, config *models.Config) *branches.Capacity {
+	return branches.NewService(s.db, s.cfg, s.logger).Capacity(ctx, config)
+}
+
+// Host is a server of the fleet and its load
+type Host struct {
+	Name            string     `json:"name"`
+	URL             string     `json:"url,omitempty"` // Empty for the local server
+	Reachable       bool       `json:"reachable"`
+	Error           string     `json:"error,omitempty"` // Why the host couldn't be queried
+	BranchCount     int        `json:"branch_count"`
+	ReadyRestores   int        `json:"ready_restores"`
+	FreeDiskPercent *float64   `json:"free_disk_percent"` // Free ZFS space, nil when unknown
+	LastSeenAt      *time.Time `json:"last_seen_at,omitempty"`
+
+	// Admission control of the host, see branches.Capacity (agents that don't report it admit branches)
+	Admits          bool     `json:"admits"`
+	CapacityReasons []string `json:"capacity_reasons,omitempty"`
+}
+
+// Branch is a branch of a fleet host, without its credentials
+type Branch struct {
+	Host        string `json:"host"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	CreatedAt   string `json:"created_at"`
+	CreatedBy   string `json:"created_by"`
+	RestoreName string `json:"restore_name"`
+	Port        int    `json:"port"`
+}
+
+// Restore is a restore of a fleet host
+type Restore struct {
+	Host      string     `json:"host"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadyAt   *time.Time `json:"ready_at"`
+}
+
+// View is the unified view of the fleet, the local server first, then the agents by name
+type View struct {
+	Hosts    []Host    `json:"hosts"`
+	Branches []Branch  `json:"branches"`
+	Restores []Restore `json:"restores"`
+}
+
+// Service aggregates the local server and the registered agents
+type Service struct {
+	db     *gorm.DB
+	cfg    *config.Config
+	logger zerolog.Logger
+}
+
+func NewService(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *Service {
+	return &Service{
+		db:     db,
+		cfg:    cfg,
+		logger: logger.With().Str("component", "fleet").Logger(),
+	}
+}
+
+// Client returns an API client of an agent, authenticated with its token (see SealToken)
+func (s *Service) Client(agent *models.FleetAgent) (*branchd.Client, error) {
+	token, err := OpenToken(s.cfg.Fleet.TokenKey, agent.Name, agent.Token)
+	if err != nil {
+		return nil, err
+	}
+	options := []branchd.Option{branchd.WithToken(token), branchd.WithRetries(0, 0)}
+	if agent.Insecure {
+		options = append(options, branchd.WithInsecureSkipVerify())
+	}
+	return branchd.New(agent.URL, options...), nil
+}
+
+// View queries the local server and every agent concurrently
+// Unreachable agents are reported in their host entry, they don't fail the view
+func (s *Service) View(ctx context.Context) (*View, error) {
+	var agents []models.FleetAgent
+	if err := s.db.Order("name").Find(&agents).Error; err != nil {
+		return nil, fmt.Errorf("failed to load fleet agents: %w", err)
+	}
+
+	local, err := s.localView(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]*View, len(agents))
+	var wg sync.WaitGroup
+	for i := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			views[i] = s.agentView(ctx, &agents[i])
+		}()
+	}
+	wg.Wait()
+
+	view := local
+	for _, agentView := range views {
+		view.Hosts = append(view.Hosts, agentView.Hosts...)
+		view.Branches = append(view.Branches, agentView.Branches...)
+		view.Restores = append(view.Restores, agentView.Restores...)
+	}
+	return view, nil
+}
+
+// Place picks the host to create a branch on: the reachable host with a ready restore, capacity for another branch
+// and the fewest branches, the one with the most free disk space among equals
+func Place(view *View) (*Host, error) {
+	var candidates []*Host
+	for i := range view.Hosts {
+		if view.Hosts[i].Reachable && view.Hosts[i].ReadyRestores > 0 && view.Hosts[i].Admits {
+			candidates = append(candidates, &view.Hosts[i])
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoHost
+	}
+
+	// Stable, the local server wins ties that free disk space doesn't break
+	slices.SortStableFunc(candidates, func(a, b *Host) int {
+		if a.BranchCount != b.BranchCount {
+			return a.BranchCount - b.BranchCount
+		}
+		freeA, freeB := freeDisk(a), freeDisk(b)
+		switch {
+		case freeA > freeB:
+			return -1
+		case freeA < freeB:
+			return 1
+		}
+		return 0
+	})
+	return candidates[0], nil
+}
+
+// freeDisk is the free disk space of a host, unknown counting as none
+func freeDisk(host *Host) float64 {
+	if host.FreeDiskPercent == nil {
+		return 0
+	}
+	return *host.FreeDiskPercent
+}
+
+// localView reads the control-plane server's own branches and restores from its database
+func (s *Service) localView(ctx context.Context) (*View, error) {
+	var branches []models.Branch
+	if err := s.db.Preload("Restore").Preload("CreatedBy").Order("created_at ASC").Find(&branches).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branches: %w", err)
+	}
+	var restores []models.Restore
+	if err := s.db.Order("created_at ASC").Find(&restores).Error; err != nil {
+		return nil, fmt.Errorf("failed to load restores: %w", err)
+	}
+
+	now := time.Now()
+	host := Host{Name: LocalHost, Reachable: true, BranchCount: len(branches), LastSeenAt: &now, Admits: true}
+
+	// Before onboarding there's nothing to branch from, the thresholds don't matter
+	var config models.Config
+	if err := s.db.First(&config).Error; err == nil {
+		capacity := localCapacity(ctx, s, &config)
+		host.Admits = capacity.Admits
+		host.CapacityReasons = capacity.Reasons
+		if capacity.Disk != nil {
+			host.FreeDiskPercent = &capacity.Disk.Current
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	view := &View{}
+	for _, branch := range branches {
+		createdBy := "Unknown"
+		if branch.CreatedBy != nil {
+			createdBy = branch.CreatedBy.Email
+		}
+		view.Branches = append(view.Branches, Branch{
+			Host:        LocalHost,
+			ID:          branch.ID,
+			Name:        branch.Name,
+			CreatedAt:   branch.CreatedAt.Format(time.RFC3339),
+			CreatedBy:   createdBy,
+			RestoreName: branch.Restore.Name,
+			Port:        branch.Port,
+		})
+	}
+	for _, restore := range restores {
+		if restore.State == models.RestoreStateReady {
+			host.ReadyRestores++
+		}
+		view.Restores = append(view.Restores, Restore{
+			Host:      LocalHost,
+			ID:        restore.ID,
+			Name:      restore.Name,
+			State:     restore.State,
+			CreatedAt: restore.CreatedAt,
+			ReadyAt:   restore.ReadyAt,
+		})
+	}
+	view.Hosts = []Host{host}
+	return view, nil
+}
+
+// agentView queries an agent's API, recording the outcome on the agent
+func (s *Service) agentView(ctx context.Context, agent *models.FleetAgent) *View {
+	host := Host{Name: agent.Name, URL: agent.URL, LastSeenAt: agent.LastSeenAt}
+	view := &View{}
+
+	branches, restores, info, err := s.queryAgent(ctx, agent)
+	s.RecordOutcome(agent, err)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("agent", agent.Name).Msg("Failed to query fleet agent")
+		host.Error = err.Error()
+		view.Hosts = []Host{host}
+		return view
+	}
+
+	host.Reachable = true
+	host.LastSeenAt = agent.LastSeenAt
+	host.BranchCount = len(branches)
+	host.Admits = info.Capacity == nil || info.Capacity.Admits
+	if info.Capacity != nil {
+		host.CapacityReasons = info.Capacity.Reasons
+	}
+	if info.Storage != nil && info.Storage.UsedBytes+info.Storage.AvailableBytes > 0 {
+		percent := float64(info.Storage.AvailableBytes) / float64(info.Storage.UsedBytes+info.Storage.AvailableBytes) * 100
+		host.FreeDiskPercent = &percent
+	}
+	for _, branch := range branches {
+		view.Branches = append(view.Branches, Branch{
+			Host:        agent.Name,
+			ID:          branch.ID,
+			Name:        branch.Name,
+			CreatedAt:   branch.CreatedAt,
+			CreatedBy:   branch.CreatedBy,
+			RestoreName: branch.RestoreName,
+			Port:        branch.Port,
+		})
+	}
+	for _, restore := range restores {
+		if restore.State == models.RestoreStateReady {
+			host.ReadyRestores++
+		}
+		view.Restores = append(view.Restores, Restore{
+			Host:      agent.Name,
+			ID:        restore.ID,
+			Name:      restore.Name,
+			State:     restore.State,
+			CreatedAt: restore.CreatedAt,
+			ReadyAt:   restore.ReadyAt,
+		})
+	}
+	view.Hosts = []Host{host}
+	return view
+}
+
+// queryAgent lists an agent's branches and restores and reads its storage, within the agent timeout
+func (s *Service) queryAgent(ctx context.Context, agent *models.FleetAgent) ([]branchd.Branch, []branchd.Restore, *branchd.SystemInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Fleet.Timeout)
+	defer cancel()
+
+	client, err := s.Client(agent)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	branches, err := client.ListBranches(ctx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	restores, err := client.ListRestores(ctx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to list restores: %w", err)
+	}
+	info, err := client.SystemInfo(ctx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get system info: %w", err)
+	}
+	return branches, restores, info, nil
+}
+
+// RecordOutcome records the outcome of a request to an agent: when it was last seen, or why it couldn't be reached
+func (s *Service) RecordOutcome(agent *models.FleetAgent, requestErr error) {
+	agent.LastError = ""
+	if requestErr != nil {
+		agent.LastError = requestErr.Error()
+	} else {
+		now := time.Now()
+		agent.LastSeenAt = &now
+	}
+	updates := map[string]interface{}{"last_seen_at": agent.LastSeenAt, "last_error": agent.LastError}
+	if err := s.db.Model(agent).Updates(updates).Error; err != nil {
+		s.logger.Warn().Err(err).Str("agent", agent.Name).Msg("Failed to record fleet agent outcome")
+	}
+}
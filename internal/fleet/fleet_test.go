@@ -0,0 +1,211 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// In-memory databases exist per connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	return NewService(db, &config.Config{
+		Storage: config.StorageConfig{DatasetRoot: "tank"},
+		Fleet:   config.FleetConfig{Timeout: 5 * time.Second, TokenKey: testTokenKey},
+	}, zerolog.Nop())
+}
+
+const testTokenKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+// stubCapacity reports the local server's capacity for the test's duration
+func stubCapacity(t *testing.T, capacity *branches.Capacity) {
+	t.Helper()
+	original := localCapacity
+	t.Cleanup(func() { localCapacity = original })
+	localCapacity = func(ctx context.Context, s *Service, config *models.Config) *branches.Capacity {
+		return capacity
+	}
+}
+
+// newTestAgent serves an agent's branches, restores, storage and capacity, checking the token
+func newTestAgent(t *testing.T, branches []branchd.Branch, restores []branchd.Restore, storage *branchd.StorageUsage, capacity *branchd.Capacity) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer agent-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body any
+		switch r.URL.Path {
+		case "/api/branches":
+			body = branches
+		case "/api/restores":
+			body = restores
+		case "/api/system/info":
+			body = branchd.SystemInfo{Storage: storage, Capacity: capacity}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func createAgent(t *testing.T, s *Service, name, url string) {
+	t.Helper()
+	token, err := SealToken(testTokenKey, name, "agent-token")
+	if err != nil {
+		t.Fatalf("SealToken() error = %v", err)
+	}
+	if err := s.db.Create(&models.FleetAgent{Name: name, URL: url, Token: token}).Error; err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+}
+
+func TestView(t *testing.T) {
+	s := newTestService(t)
+	stubCapacity(t, &branches.Capacity{Admits: true, Disk: &branches.CapacityHeadroom{Current: 40, Limit: 5, Headroom: 35}})
+	if err := s.db.Create(&models.Config{JWTSecret: "secret"}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	user := models.User{Email: "bob@example.com", PasswordHash: "hash"}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	restore := models.Restore{Name: "restore_1", State: models.RestoreStateReady}
+	if err := s.db.Create(&restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	if err := s.db.Create(&models.Branch{Name: "feature-x", RestoreID: restore.ID, CreatedByID: user.ID, Port: 15432}).Error; err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+
+	agent := newTestAgent(t,
+		[]branchd.Branch{{ID: "b1", Name: "feature-y", CreatedBy: "alice@example.com", RestoreName: "restore_2", Port: 15433}},
+		[]branchd.Restore{{ID: "r2", Name: "restore_2", State: models.RestoreStateReady}, {ID: "r3", Name: "restore_3", State: models.RestoreStateRestoring}},
+		&branchd.StorageUsage{UsedBytes: 25, AvailableBytes: 75}, &branchd.Capacity{Reasons: []string{"only 100 MB memory available"}})
+	createAgent(t, s, "db2", agent.URL)
+	createAgent(t, s, "db3", "http://127.0.0.1:1")
+
+	view, err := s.View(context.Background())
+	if err != nil {
+		t.Fatalf("View() error = %v", err)
+	}
+
+	if len(view.Hosts) != 3 {
+		t.Fatalf("hosts = %+v, want local, db2 and db3", view.Hosts)
+	}
+	local, db2, db3 := view.Hosts[0], view.Hosts[1], view.Hosts[2]
+	if local.Name != LocalHost || local.BranchCount != 1 || local.ReadyRestores != 1 || *local.FreeDiskPercent != 40 || !local.Admits {
+		t.Errorf("local host = %+v", local)
+	}
+	if db2.Name != "db2" || !db2.Reachable || db2.BranchCount != 1 || db2.ReadyRestores != 1 || *db2.FreeDiskPercent != 75 ||
+		db2.Admits || len(db2.CapacityReasons) != 1 {
+		t.Errorf("db2 host = %+v", db2)
+	}
+	if db3.Reachable || db3.Error == "" {
+		t.Errorf("db3 host = %+v, want it unreachable", db3)
+	}
+
+	if len(view.Branches) != 2 || view.Branches[0].Host != LocalHost || view.Branches[0].CreatedBy != "bob@example.com" ||
+		view.Branches[1].Host != "db2" || view.Branches[1].Name != "feature-y" {
+		t.Errorf("branches = %+v, want feature-x on local and feature-y on db2", view.Branches)
+	}
+	if len(view.Restores) != 3 || view.Restores[2].Host != "db2" || view.Restores[2].State != models.RestoreStateRestoring {
+		t.Errorf("restores = %+v", view.Restores)
+	}
+
+	var agents []models.FleetAgent
+	if err := s.db.Order("name").Find(&agents).Error; err != nil {
+		t.Fatalf("failed to load agents: %v", err)
+	}
+	if agents[0].LastSeenAt == nil || agents[0].LastError != "" {
+		t.Errorf("db2 = %+v, want it seen", agents[0])
+	}
+	if agents[1].LastSeenAt != nil || agents[1].LastError == "" {
+		t.Errorf("db3 = %+v, want its error recorded", agents[1])
+	}
+}
+
+func TestPlace(t *testing.T) {
+	percent := func(p float64) *float64 { return &p }
+	tests := []struct {
+		name  string
+		hosts []Host
+		want  string
+	}{
+		{
+			name: "fewest branches",
+			hosts: []Host{
+				{Name: LocalHost, Reachable: true, Admits: true, ReadyRestores: 1, BranchCount: 5, FreeDiskPercent: percent(80)},
+				{Name: "db2", Reachable: true, Admits: true, ReadyRestores: 1, BranchCount: 2, FreeDiskPercent: percent(10)},
+			},
+			want: "db2",
+		},
+		{
+			name: "most free disk among equals",
+			hosts: []Host{
+				{Name: LocalHost, Reachable: true, Admits: true, ReadyRestores: 1, BranchCount: 2},
+				{Name: "db2", Reachable: true, Admits: true, ReadyRestores: 1, BranchCount: 2, FreeDiskPercent: percent(10)},
+				{Name: "db3", Reachable: true, Admits: true, ReadyRestores: 2, BranchCount: 2, FreeDiskPercent: percent(30)},
+			},
+			want: "db3",
+		},
+		{
+			name: "skips unreachable hosts, hosts without a ready restore and hosts without capacity",
+			hosts: []Host{
+				{Name: LocalHost, Reachable: true, Admits: true, BranchCount: 0},
+				{Name: "db2", BranchCount: 0, ReadyRestores: 1},
+				{Name: "db3", Reachable: true, ReadyRestores: 1, BranchCount: 1},
+				{Name: "db4", Reachable: true, Admits: true, ReadyRestores: 1, BranchCount: 9},
+			},
+			want: "db4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, err := Place(&View{Hosts: tt.hosts})
+			if err != nil {
+				t.Fatalf("Place() error = %v", err)
+			}
+			if host.Name != tt.want {
+				t.Errorf("Place() = %s, want %s", host.Name, tt.want)
+			}
+		})
+	}
+
+	if _, err := Place(&View{Hosts: []Host{{Name: LocalHost, Reachable: true}}}); !errors.Is(err, ErrNoHost) {
+		t.Errorf("Place() error = %v, want ErrNoHost", err)
+	}
+}
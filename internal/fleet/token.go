@@ -0,0 +1,92 @@
+package fleet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Agent tokens are admin API tokens of other servers. They're stored sealed with AES-GCM under FLEET_TOKEN_KEY,
+// so the database (or a backup archive of it) doesn't hand out admin access to the whole fleet on its own.
+
+// sealedTokenPrefix marks sealed tokens, tokens registered before sealing are plain and sealed by SealStoredTokens
+const sealedTokenPrefix = "sealed:v1:"
+
+// ErrTokenKey is returned when an agent token can't be sealed or opened with the configured FLEET_TOKEN_KEY
+var ErrTokenKey = errors.New("invalid fleet token key")
+
+// tokenCipher builds the AEAD of a hex-encoded AES-256 key
+func tokenCipher(key string) (cipher.AEAD, error) {
+	raw, err := hex.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("%w: must be 64 hex characters", ErrTokenKey)
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenKey, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealToken encrypts an agent token for storage, the agent's name is authenticated with it so sealed tokens can't be
+// swapped between agents
+func SealToken(key, agentName, token string) (string, error) {
+	aead, err := tokenCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(token), []byte(agentName))
+	return sealedTokenPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenToken decrypts a token sealed by SealToken
+func OpenToken(key, agentName, sealed string) (string, error) {
+	encoded, ok := strings.CutPrefix(sealed, sealedTokenPrefix)
+	if !ok {
+		return "", fmt.Errorf("%w: the token of %s isn't sealed", ErrTokenKey, agentName)
+	}
+	aead, err := tokenCipher(key)
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return "", fmt.Errorf("%w: the token of %s is corrupt", ErrTokenKey, agentName)
+	}
+	token, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(agentName))
+	if err != nil {
+		return "", fmt.Errorf("%w: the token of %s was sealed with another key, register the agent again", ErrTokenKey, agentName)
+	}
+	return string(token), nil
+}
+
+// SealStoredTokens seals the tokens of agents registered before tokens were sealed, run at startup
+// Tokens cleared by decommissioning are left empty
+func (s *Service) SealStoredTokens() error {
+	var agents []models.FleetAgent
+	if err := s.db.Where("token != '' AND token NOT LIKE ?", sealedTokenPrefix+"%").Find(&agents).Error; err != nil {
+		return fmt.Errorf("failed to load fleet agents: %w", err)
+	}
+	for _, agent := range agents {
+		sealed, err := SealToken(s.cfg.Fleet.TokenKey, agent.Name, agent.Token)
+		if err != nil {
+			return err
+		}
+		if err := s.db.Model(&models.FleetAgent{}).Where("id = ?", agent.ID).Update("token", sealed).Error; err != nil {
+			return fmt.Errorf("failed to seal the token of %s: %w", agent.Name, err)
+		}
+		s.logger.Info().Str("agent", agent.Name).Msg("Sealed fleet agent token")
+	}
+	return nil
+}
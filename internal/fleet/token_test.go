@@ -0,0 +1,75 @@
+package fleet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestSealToken(t *testing.T) {
+	sealed, err := SealToken(testTokenKey, "db2", "agent-token")
+	if err != nil {
+		t.Fatalf("SealToken() error = %v", err)
+	}
+	if strings.Contains(sealed, "agent-token") {
+		t.Fatalf("SealToken() = %q, want the token encrypted", sealed)
+	}
+
+	token, err := OpenToken(testTokenKey, "db2", sealed)
+	if err != nil || token != "agent-token" {
+		t.Fatalf("OpenToken() = %q, %v, want agent-token", token, err)
+	}
+
+	otherKey := strings.Repeat("ff", 32)
+	tests := []struct {
+		name   string
+		key    string
+		agent  string
+		sealed string
+	}{
+		{name: "other key", key: otherKey, agent: "db2", sealed: sealed},
+		{name: "other agent", key: testTokenKey, agent: "db3", sealed: sealed},
+		{name: "plain token", key: testTokenKey, agent: "db2", sealed: "agent-token"},
+		{name: "corrupt", key: testTokenKey, agent: "db2", sealed: sealedTokenPrefix + "AAAA"},
+		{name: "invalid key", key: "abcd", agent: "db2", sealed: sealed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := OpenToken(tt.key, tt.agent, tt.sealed); !errors.Is(err, ErrTokenKey) {
+				t.Errorf("OpenToken() error = %v, want ErrTokenKey", err)
+			}
+		})
+	}
+}
+
+func TestSealStoredTokens(t *testing.T) {
+	s := newTestService(t)
+	agents := []models.FleetAgent{
+		{Name: "db2", URL: "https://db2.example.com", Token: "agent-token"},
+		{Name: "db3", URL: "https://db3.example.com", Token: ""}, // Cleared by decommissioning
+	}
+	if err := s.db.Create(&agents).Error; err != nil {
+		t.Fatalf("failed to create agents: %v", err)
+	}
+
+	if err := s.SealStoredTokens(); err != nil {
+		t.Fatalf("SealStoredTokens() error = %v", err)
+	}
+	// Idempotent, sealed tokens aren't sealed again
+	if err := s.SealStoredTokens(); err != nil {
+		t.Fatalf("SealStoredTokens() error = %v", err)
+	}
+
+	var stored []models.FleetAgent
+	if err := s.db.Order("name").Find(&stored).Error; err != nil {
+		t.Fatalf("failed to load agents: %v", err)
+	}
+	if token, err := OpenToken(testTokenKey, "db2", stored[0].Token); err != nil || token != "agent-token" {
+		t.Errorf("db2 token opens to %q, %v, want agent-token", token, err)
+	}
+	if stored[1].Token != "" {
+		t.Errorf("db3 token = %q, want it left empty", stored[1].Token)
+	}
+}
@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "branchd.log")
+	f, err := newRotatingFile(path, 1, 2)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+	defer f.Close()
+	f.maxSize = 20 // Two 10 byte lines per file
+
+	for _, line := range []string{"line-0001", "line-0002", "line-0003", "line-0004", "line-0005", "line-0006", "line-0007"} {
+		if _, err := f.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	// The current file has the newest lines, the oldest backup beyond maxBackups is gone
+	want := map[string]string{
+		path:        "line-0007\n",
+		path + ".1": "line-0005\nline-0006\n",
+		path + ".2": "line-0003\nline-0004\n",
+	}
+	for file, content := range want {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", filepath.Base(file), err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want at most 2 backups", filepath.Base(path))
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "branchd.log")
+	if err := os.WriteFile(path, []byte("before restart\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := newRotatingFile(path, 1, 1)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+	f.Write([]byte("after restart\n"))
+	f.Close()
+
+	got, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(got), "before restart\n") || !strings.HasSuffix(string(got), "after restart\n") {
+		t.Errorf("log file = %q, want the new line appended", got)
+	}
+}
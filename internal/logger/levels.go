@@ -0,0 +1,150 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// componentField is the field services tag their logger with (e.g. "restore_orchestrator")
+const componentField = `"component":"`
+
+// levels holds the default and per-component log levels, changeable at runtime
+var levels = &levelRegistry{
+	defaultLevel: zerolog.InfoLevel,
+	components:   map[string]zerolog.Level{},
+}
+
+type levelRegistry struct {
+	mu           sync.RWMutex
+	defaultLevel zerolog.Level
+	components   map[string]zerolog.Level
+}
+
+// Levels is a snapshot of the log levels
+type Levels struct {
+	Default    string            `json:"default"`
+	Components map[string]string `json:"components"` // Components logging at their own level
+}
+
+// GetLevels returns the current log levels
+func GetLevels() Levels {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+
+	snapshot := Levels{
+		Default:    levels.defaultLevel.String(),
+		Components: make(map[string]string, len(levels.components)),
+	}
+	for component, level := range levels.components {
+		snapshot.Components[component] = level.String()
+	}
+	return snapshot
+}
+
+// SetLevel changes the level of a component, or the default level if component is empty
+// An empty level resets the component to the default level
+func SetLevel(component, level string) error {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	if level == "" {
+		if component == "" {
+			return fmt.Errorf("level is required")
+		}
+		delete(levels.components, component)
+		levels.applyGlobalLevel()
+		return nil
+	}
+
+	logLevel, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil || logLevel == zerolog.NoLevel {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	if component == "" {
+		levels.defaultLevel = logLevel
+	} else {
+		levels.components[component] = logLevel
+	}
+	levels.applyGlobalLevel()
+	return nil
+}
+
+// parseComponentLevels parses "component=level,..." (LOG_COMPONENT_LEVELS)
+func parseComponentLevels(value string) (map[string]zerolog.Level, error) {
+	components := map[string]zerolog.Level{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		component, level, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(component) == "" {
+			return nil, fmt.Errorf("invalid component level %q, expected component=level", entry)
+		}
+		logLevel, err := zerolog.ParseLevel(strings.ToLower(strings.TrimSpace(level)))
+		if err != nil || logLevel == zerolog.NoLevel {
+			return nil, fmt.Errorf("invalid log level %q for component %s", level, component)
+		}
+		components[strings.TrimSpace(component)] = logLevel
+	}
+	return components, nil
+}
+
+// applyGlobalLevel lowers zerolog's global level to the most verbose configured level,
+// the component filter drops what the other components don't want (caller holds mu)
+func (r *levelRegistry) applyGlobalLevel() {
+	lowest := r.defaultLevel
+	for _, level := range r.components {
+		if level < lowest {
+			lowest = level
+		}
+	}
+	zerolog.SetGlobalLevel(lowest)
+}
+
+// enabled reports whether an event of the component is logged
+func (r *levelRegistry) enabled(component string, level zerolog.Level) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	minLevel, ok := r.components[component]
+	if !ok {
+		minLevel = r.defaultLevel
+	}
+	return level >= minLevel
+}
+
+// componentFilter drops events below their component's level before they reach the sinks
+type componentFilter struct {
+	out zerolog.LevelWriter
+}
+
+func (f componentFilter) Write(p []byte) (int, error) {
+	return f.out.Write(p)
+}
+
+func (f componentFilter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if !levels.enabled(eventComponent(p), level) {
+		return len(p), nil
+	}
+	return f.out.WriteLevel(level, p)
+}
+
+// eventComponent extracts the component field of a JSON event, empty if it has none
+func eventComponent(p []byte) string {
+	start := bytes.Index(p, []byte(componentField))
+	if start < 0 {
+		return ""
+	}
+	value := p[start+len(componentField):]
+	end := bytes.IndexByte(value, '"')
+	if end < 0 {
+		return ""
+	}
+	return string(value[:end])
+}
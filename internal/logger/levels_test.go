@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestComponentFilter(t *testing.T) {
+	previous := zerolog.GlobalLevel()
+	t.Cleanup(func() {
+		levels.mu.Lock()
+		levels.defaultLevel = zerolog.InfoLevel
+		levels.components = map[string]zerolog.Level{}
+		levels.mu.Unlock()
+		zerolog.SetGlobalLevel(previous)
+	})
+
+	if err := SetLevel("", "warn"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLevel("restore_orchestrator", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	if zerolog.GlobalLevel() != zerolog.DebugLevel {
+		t.Errorf("global level = %s, want debug (the most verbose component)", zerolog.GlobalLevel())
+	}
+
+	var out bytes.Buffer
+	logger := zerolog.New(componentFilter{out: zerolog.MultiLevelWriter(&out)})
+	orchestrator := logger.With().Str("component", "restore_orchestrator").Logger()
+
+	orchestrator.Debug().Msg("orchestrator debug")
+	logger.Info().Msg("default info")
+	logger.Warn().Msg("default warn")
+
+	got := out.String()
+	if !strings.Contains(got, "orchestrator debug") || !strings.Contains(got, "default warn") {
+		t.Errorf("output = %q, want the orchestrator debug and default warn events", got)
+	}
+	if strings.Contains(got, "default info") {
+		t.Errorf("output = %q, info below the default level was logged", got)
+	}
+
+	// Resetting the component falls back to the default level
+	if err := SetLevel("restore_orchestrator", ""); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	orchestrator.Debug().Msg("orchestrator debug")
+	if out.Len() != 0 {
+		t.Errorf("output = %q after reset, want nothing", out.String())
+	}
+	if snapshot := GetLevels(); snapshot.Default != "warn" || len(snapshot.Components) != 0 {
+		t.Errorf("GetLevels() = %+v", snapshot)
+	}
+}
+
+func TestParseComponentLevels(t *testing.T) {
+	got, err := parseComponentLevels("restore_orchestrator=debug, worker = warn")
+	if err != nil {
+		t.Fatalf("parseComponentLevels() error = %v", err)
+	}
+	if got["restore_orchestrator"] != zerolog.DebugLevel || got["worker"] != zerolog.WarnLevel {
+		t.Errorf("parseComponentLevels() = %v", got)
+	}
+	for _, value := range []string{"worker", "worker=loud", "=debug"} {
+		if _, err := parseComponentLevels(value); err == nil {
+			t.Errorf("parseComponentLevels(%q) expected error", value)
+		}
+	}
+}
+
+func TestEventComponent(t *testing.T) {
+	if got := eventComponent([]byte(`{"level":"info","component":"worker","message":"x"}`)); got != "worker" {
+		t.Errorf("eventComponent() = %q, want worker", got)
+	}
+	if got := eventComponent([]byte(`{"level":"info","message":"x"}`)); got != "" {
+		t.Errorf("eventComponent() = %q, want empty", got)
+	}
+}
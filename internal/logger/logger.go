@@ -1,44 +1,116 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+
+	"github.com/branchd-dev/branchd/internal/config"
 )
 
 // Logger is the application logger instance
 var Logger zerolog.Logger
 
+// sinks are the writers closed (and flushed) by Close
+var sinks []io.Closer
+
 // Init initializes the logger with the given configuration
-func Init(level, format string) {
-	// Set log level
-	logLevel := parseLogLevel(level)
-	zerolog.SetGlobalLevel(logLevel)
+// Events go to stdout and to the configured file, syslog and Loki sinks
+func Init(cfg config.LoggingConfig) error {
+	// Set log levels
+	components, err := parseComponentLevels(cfg.ComponentLevels)
+	if err != nil {
+		return fmt.Errorf("invalid LOG_COMPONENT_LEVELS: %w", err)
+	}
+	levels.mu.Lock()
+	levels.defaultLevel = parseLogLevel(cfg.Level)
+	levels.components = components
+	levels.applyGlobalLevel()
+	levels.mu.Unlock()
 
 	// Configure output format
-	if strings.ToLower(format) == "json" {
-		Logger = zerolog.New(os.Stdout).With().
-			Timestamp().
-			Caller().
-			Logger()
-	} else {
+	var stdout io.Writer = os.Stdout
+	if strings.ToLower(cfg.Format) != "json" {
 		// Console format with colors
-		output := zerolog.ConsoleWriter{
+		stdout = zerolog.ConsoleWriter{
 			Out:        os.Stdout,
 			TimeFormat: time.RFC3339,
 			NoColor:    false,
 		}
-		Logger = zerolog.New(output).With().
-			Timestamp().
-			Caller().
-			Logger()
+	}
+	writers := []io.Writer{stdout}
+
+	if cfg.File != "" {
+		file, err := newRotatingFile(cfg.File, cfg.FileMaxSizeMB, cfg.FileMaxBackups)
+		if err != nil {
+			return err
+		}
+		writers = append(writers, file)
+		sinks = append(sinks, file)
+	}
+
+	if cfg.SyslogAddress != "" {
+		syslog, err := newSyslogWriter(cfg.SyslogAddress)
+		if err != nil {
+			return err
+		}
+		writers = append(writers, syslog)
+		sinks = append(sinks, syslog)
+	}
+
+	if cfg.LokiURL != "" {
+		labels, err := parseLokiLabels(cfg.LokiLabels)
+		if err != nil {
+			return fmt.Errorf("invalid LOG_LOKI_LABELS: %w", err)
+		}
+		loki := newLokiWriter(cfg.LokiURL, labels)
+		writers = append(writers, loki)
+		sinks = append(sinks, loki)
 	}
 
+	output := componentFilter{out: zerolog.MultiLevelWriter(writers...)}
+	Logger = zerolog.New(output).With().
+		Timestamp().
+		Caller().
+		Logger()
+
 	// Set the global logger
 	log.Logger = Logger
+	return nil
+}
+
+// Close flushes and closes the file, syslog and Loki sinks
+func Close() {
+	for _, sink := range sinks {
+		sink.Close()
+	}
+	sinks = nil
+}
+
+// parseLokiLabels parses "key=value,..." and adds the job and host labels
+func parseLokiLabels(value string) (map[string]string, error) {
+	labels := map[string]string{"job": "branchd"}
+	if host, err := os.Hostname(); err == nil {
+		labels["host"] = host
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", entry)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return labels, nil
 }
 
 // parseLogLevel parses string log level to zerolog level
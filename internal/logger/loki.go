@@ -0,0 +1,169 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	lokiFlushInterval = 2 * time.Second
+	lokiBatchSize     = 500   // Lines that trigger an early flush
+	lokiMaxBuffered   = 10000 // Oldest lines are dropped beyond this while Loki is unreachable
+)
+
+// lokiWriter batches JSON events and pushes them to Loki's HTTP push API
+// Events are labeled with the static labels and their level
+type lokiWriter struct {
+	url    string
+	labels map[string]string
+	client *http.Client
+
+	mu      sync.Mutex
+	entries map[string][][2]string // level -> [timestamp ns, line]
+	count   int
+	flush   chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// newLokiWriter starts pushing to url (e.g. http://loki:3100/loki/api/v1/push)
+func newLokiWriter(url string, labels map[string]string) *lokiWriter {
+	w := &lokiWriter{
+		url:     url,
+		labels:  labels,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		entries: map[string][][2]string{},
+		flush:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *lokiWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *lokiWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	line := string(bytes.TrimRight(p, "\n"))
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	w.mu.Lock()
+	if w.count >= lokiMaxBuffered {
+		w.dropOldest()
+	}
+	w.entries[level.String()] = append(w.entries[level.String()], [2]string{timestamp, line})
+	w.count++
+	full := w.count >= lokiBatchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Close pushes the buffered events and stops the writer
+func (w *lokiWriter) Close() error {
+	close(w.done)
+	<-w.stopped
+	return nil
+}
+
+func (w *lokiWriter) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(lokiFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.push()
+		case <-w.flush:
+			w.push()
+		case <-w.done:
+			w.push()
+			return
+		}
+	}
+}
+
+// push sends the buffered events, failed batches are dropped so a Loki outage can't block logging
+func (w *lokiWriter) push() {
+	w.mu.Lock()
+	entries := w.entries
+	count := w.count
+	w.entries = map[string][][2]string{}
+	w.count = 0
+	w.mu.Unlock()
+
+	if count == 0 {
+		return
+	}
+
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	var payload struct {
+		Streams []stream `json:"streams"`
+	}
+	for level, values := range entries {
+		labels := make(map[string]string, len(w.labels)+1)
+		for k, v := range w.labels {
+			labels[k] = v
+		}
+		labels["level"] = level
+		payload.Streams = append(payload.Streams, stream{Stream: labels, Values: values})
+	}
+
+	if err := w.send(payload); err != nil {
+		// The logger can't log its own failures, stderr ends up in journald
+		fmt.Fprintf(os.Stderr, "Failed to push %d log lines to Loki: %v\n", count, err)
+	}
+}
+
+func (w *lokiWriter) send(payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Loki returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// dropOldest removes the oldest buffered line (caller holds mu)
+func (w *lokiWriter) dropOldest() {
+	oldestLevel := ""
+	for level, values := range w.entries {
+		if len(values) > 0 && (oldestLevel == "" || values[0][0] < w.entries[oldestLevel][0][0]) {
+			oldestLevel = level
+		}
+	}
+	if oldestLevel != "" {
+		w.entries[oldestLevel] = w.entries[oldestLevel][1:]
+		w.count--
+	}
+}
@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLokiWriterPushesOnClose(t *testing.T) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	var (
+		mu      sync.Mutex
+		streams []stream
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("push request = %s %s (%s)", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var payload struct {
+			Streams []stream `json:"streams"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode push payload: %v", err)
+		}
+		mu.Lock()
+		streams = append(streams, payload.Streams...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	w := newLokiWriter(server.URL+"/loki/api/v1/push", map[string]string{"job": "branchd", "env": "test"})
+	logger := zerolog.New(w)
+	logger.Info().Str("component", "worker").Msg("restore started")
+	logger.Error().Msg("restore failed")
+	logger.Info().Msg("restore retried")
+	w.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	lines := map[string][]string{}
+	for _, s := range streams {
+		if s.Stream["job"] != "branchd" || s.Stream["env"] != "test" {
+			t.Errorf("stream labels = %v, want the static labels", s.Stream)
+		}
+		for _, value := range s.Values {
+			if value[0] == "" {
+				t.Errorf("line %q has no timestamp", value[1])
+			}
+			lines[s.Stream["level"]] = append(lines[s.Stream["level"]], value[1])
+		}
+	}
+
+	want := map[string][]string{
+		"info":  {`{"level":"info","component":"worker","message":"restore started"}`, `{"level":"info","message":"restore retried"}`},
+		"error": {`{"level":"error","message":"restore failed"}`},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("pushed streams = %v, want %v", lines, want)
+	}
+	for level, wantLines := range want {
+		if len(lines[level]) != len(wantLines) {
+			t.Fatalf("%s lines = %v, want %v", level, lines[level], wantLines)
+		}
+		for i := range wantLines {
+			if lines[level][i] != wantLines[i] {
+				t.Errorf("%s line %d = %s, want %s", level, i, lines[level][i], wantLines[i])
+			}
+		}
+	}
+}
+
+func TestLokiWriterDropsOldestWhenFull(t *testing.T) {
+	w := &lokiWriter{entries: map[string][][2]string{}, flush: make(chan struct{}, 1)}
+	w.entries["info"] = [][2]string{{"3", "third"}}
+	w.entries["error"] = [][2]string{{"1", "first"}, {"2", "second"}}
+	w.count = 3
+
+	w.dropOldest()
+
+	if w.count != 2 || len(w.entries["error"]) != 1 || w.entries["error"][0][1] != "second" || len(w.entries["info"]) != 1 {
+		t.Errorf("after dropOldest entries = %v (count %d), want the first line dropped", w.entries, w.count)
+	}
+}
+
+func TestParseLokiLabels(t *testing.T) {
+	labels, err := parseLokiLabels("env=prod, region = eu-west-1")
+	if err != nil {
+		t.Fatalf("parseLokiLabels() error = %v", err)
+	}
+	if labels["job"] != "branchd" || labels["env"] != "prod" || labels["region"] != "eu-west-1" {
+		t.Errorf("parseLokiLabels() = %v", labels)
+	}
+	if _, err := parseLokiLabels("env"); err == nil {
+		t.Error("parseLokiLabels(env) expected error")
+	}
+}
@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"fmt"
+	"log/syslog"
+	"net/url"
+
+	"github.com/rs/zerolog"
+)
+
+// syslogWriter forwards JSON events to syslog with the severity of their level
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+// newSyslogWriter connects to the syslog server at address ("udp://host:514", "tcp://host:514"),
+// or to the local syslog daemon if address is "local"
+func newSyslogWriter(address string) (*syslogWriter, error) {
+	var network, raddr string
+	if address != "local" {
+		u, err := url.Parse(address)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return nil, fmt.Errorf("invalid syslog address %q, expected local, udp://host:port or tcp://host:port", address)
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, "branchd")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (s *syslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	msg := string(p)
+	var err error
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		err = s.w.Debug(msg)
+	case zerolog.WarnLevel:
+		err = s.w.Warning(msg)
+	case zerolog.ErrorLevel:
+		err = s.w.Err(msg)
+	case zerolog.FatalLevel:
+		err = s.w.Crit(msg)
+	case zerolog.PanicLevel:
+		err = s.w.Emerg(msg)
+	default:
+		err = s.w.Info(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the syslog connection
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSyslogWriterSeverity(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	w, err := newSyslogWriter("udp://" + conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("newSyslogWriter() error = %v", err)
+	}
+	defer w.Close()
+	logger := zerolog.New(w)
+
+	// Priority = facility daemon (3) * 8 + severity
+	tests := []struct {
+		log          func(msg string)
+		wantPriority string
+	}{
+		{log: func(msg string) { logger.Debug().Msg(msg) }, wantPriority: "<31>"},
+		{log: func(msg string) { logger.Info().Msg(msg) }, wantPriority: "<30>"},
+		{log: func(msg string) { logger.Warn().Msg(msg) }, wantPriority: "<28>"},
+		{log: func(msg string) { logger.Error().Msg(msg) }, wantPriority: "<27>"},
+	}
+
+	buf := make([]byte, 2048)
+	for _, tt := range tests {
+		tt.log("disk almost full")
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("failed to read syslog message: %v", err)
+		}
+		msg := string(buf[:n])
+		if !strings.HasPrefix(msg, tt.wantPriority) || !strings.Contains(msg, "branchd") ||
+			!strings.Contains(msg, `"message":"disk almost full"`) {
+			t.Errorf("syslog message = %q, want priority %s, tag branchd and the JSON event", msg, tt.wantPriority)
+		}
+	}
+}
+
+func TestSyslogWriterInvalidAddress(t *testing.T) {
+	for _, address := range []string{"syslog.example.com:514", "http://syslog.example.com", "udp://"} {
+		if _, err := newSyslogWriter(address); err == nil {
+			t.Errorf("newSyslogWriter(%q) expected error", address)
+		}
+	}
+}
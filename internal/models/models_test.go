@@ -0,0 +1,273 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns a migrated in-memory database
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	return db
+}
+
+func TestFindBranch(t *testing.T) {
+	db := newTestDB(t)
+	restore := Restore{Name: "restore_20250101000000"}
+	if err := db.Create(&restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+
+	// Named before short IDs existed: its name is another branch's short ID
+	legacy := Branch{Name: "k3m9x2ab", RestoreID: restore.ID, User: "u", Password: "p", ShortID: "p7q2r4st"}
+	other := Branch{Name: "feature-x", RestoreID: restore.ID, User: "u", Password: "p", ShortID: "k3m9x2ab"}
+	for _, branch := range []*Branch{&legacy, &other} {
+		if err := db.Create(branch).Error; err != nil {
+			t.Fatalf("failed to create branch: %v", err)
+		}
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: other.ID, want: other.ID},
+		{ref: "feature-x", want: other.ID},
+		{ref: "p7q2r4st", want: legacy.ID},
+		{ref: "k3m9x2ab", want: legacy.ID}, // Name before short ID
+	}
+	for _, tt := range tests {
+		var branch Branch
+		if err := FindBranch(db, tt.ref, &branch); err != nil {
+			t.Fatalf("FindBranch(%q) error = %v", tt.ref, err)
+		}
+		if branch.ID != tt.want {
+			t.Errorf("FindBranch(%q) = %s, want %s", tt.ref, branch.ID, tt.want)
+		}
+	}
+
+	var branch Branch
+	if err := FindBranch(db, "missing", &branch); err != gorm.ErrRecordNotFound {
+		t.Errorf("FindBranch(missing) error = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestBranchShortIDUnique(t *testing.T) {
+	db := newTestDB(t)
+	restore := Restore{Name: "restore_20250101000000"}
+	if err := db.Create(&restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+
+	first := Branch{Name: "first", RestoreID: restore.ID, User: "u", Password: "p"}
+	if err := db.Create(&first).Error; err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+	if len(first.ShortID) != branchShortIDLength {
+		t.Errorf("ShortID = %q, want %d characters", first.ShortID, branchShortIDLength)
+	}
+
+	duplicate := Branch{Name: "second", RestoreID: restore.ID, User: "u", Password: "p", ShortID: first.ShortID}
+	if err := db.Create(&duplicate).Error; err == nil {
+		t.Error("created a branch with a duplicate short ID")
+	}
+}
+
+func TestBackfillRestoreStates(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	restores := map[string]*Restore{
+		RestoreStateReady:     {Name: "restore_ready", StartedAt: &now, ReadyAt: &now},
+		RestoreStateFailed:    {Name: "restore_failed", StartedAt: &now, FailedAt: &now},
+		RestoreStateRestoring: {Name: "restore_running", StartedAt: &now},
+		RestoreStatePending:   {Name: "restore_queued"},
+	}
+	for _, restore := range restores {
+		if err := db.Create(restore).Error; err != nil {
+			t.Fatalf("failed to create restore: %v", err)
+		}
+	}
+
+	if err := backfillRestoreStates(db); err != nil {
+		t.Fatalf("backfillRestoreStates() error = %v", err)
+	}
+
+	for want, restore := range restores {
+		var got Restore
+		if err := db.First(&got, "id = ?", restore.ID).Error; err != nil {
+			t.Fatalf("failed to load restore: %v", err)
+		}
+		if got.State != want {
+			t.Errorf("%s state = %q, want %q", restore.Name, got.State, want)
+		}
+	}
+}
+
+func TestValidateTargetPostgresVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{name: "no target", config: Config{PostgresVersion: "14"}},
+		{name: "upgrade", config: Config{PostgresVersion: "14", TargetPostgresVersion: "16"}},
+		{name: "same version", config: Config{PostgresVersion: "16", TargetPostgresVersion: "16"}},
+		{name: "downgrade", config: Config{PostgresVersion: "16", TargetPostgresVersion: "14"}, wantErr: "older than the source's (16)"},
+		{name: "not a major version", config: Config{PostgresVersion: "14", TargetPostgresVersion: "16.2"}, wantErr: "invalid target PostgreSQL version"},
+		{name: "zero", config: Config{TargetPostgresVersion: "0"}, wantErr: "invalid target PostgreSQL version"},
+		{name: "Crunchy Bridge", config: Config{CrunchyBridgeAPIKey: "key", PostgresVersion: "14", TargetPostgresVersion: "16"}, wantErr: "not supported for Crunchy Bridge"},
+		{name: "pgBackRest", config: Config{PgBackRestStanza: "main", PostgresVersion: "14", TargetPostgresVersion: "16"}, wantErr: "not supported for pgBackRest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.ValidateTargetPostgresVersion()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateTargetPostgresVersion() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateTargetPostgresVersion() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCrunchyBridge(t *testing.T) {
+	for _, name := range []string{"", "postgres", "app_db", "_app2"} {
+		if err := (&Config{CrunchyBridgeDatabaseName: name}).ValidateCrunchyBridge(); err != nil {
+			t.Errorf("ValidateCrunchyBridge(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{`app"; rm -rf /`, "2app", "app db", "$(id)", strings.Repeat("a", 64)} {
+		if err := (&Config{CrunchyBridgeDatabaseName: name}).ValidateCrunchyBridge(); err == nil {
+			t.Errorf("ValidateCrunchyBridge(%q) expected error", name)
+		}
+	}
+}
+
+func TestValidatePgBackRest(t *testing.T) {
+	valid := Config{PgBackRestStanza: "main", PgBackRestRepoPath: "/var/lib/pgbackrest", PgBackRestDatabaseName: "app"}
+	s3 := valid
+	s3.PgBackRestS3Bucket, s3.PgBackRestS3Endpoint, s3.PgBackRestS3Region = "backups", "s3.amazonaws.com", "us-east-1"
+
+	tests := []struct {
+		name    string
+		base    Config
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{name: "posix", base: valid},
+		{name: "S3 with instance credentials", base: s3},
+		{name: "S3 with keys", base: s3, modify: func(c *Config) { c.PgBackRestS3Key, c.PgBackRestS3KeySecret = "AKIA", "secret" }},
+		{name: "unsafe stanza", base: valid, modify: func(c *Config) { c.PgBackRestStanza = "main]\nrepo1-path=/" }, wantErr: "invalid pgBackRest stanza"},
+		{name: "no database", base: valid, modify: func(c *Config) { c.PgBackRestDatabaseName = "" }, wantErr: "database name is required"},
+		{name: "relative repository path", base: valid, modify: func(c *Config) { c.PgBackRestRepoPath = "pgbackrest" }, wantErr: "must be absolute"},
+		{name: "S3 without region", base: s3, modify: func(c *Config) { c.PgBackRestS3Region = "" }, wantErr: "endpoint and a region"},
+		{name: "S3 key without secret", base: s3, modify: func(c *Config) { c.PgBackRestS3Key = "AKIA" }, wantErr: "set together"},
+		{name: "line break", base: valid, modify: func(c *Config) { c.PgBackRestCipherPass = "pass\nrepo1-type=posix" }, wantErr: "line breaks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.base
+			if tt.modify != nil {
+				tt.modify(&config)
+			}
+			err := config.ValidatePgBackRest()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidatePgBackRest() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidatePgBackRest() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Branches connect to the configured database, there's no connection string
+	if got := valid.databaseName(); got != "app" {
+		t.Errorf("databaseName() = %q, want app", got)
+	}
+}
+
+func TestClusterPostgresVersion(t *testing.T) {
+	config := &Config{PostgresVersion: "14"}
+	if got := config.ClusterPostgresVersion(); got != "14" {
+		t.Errorf("ClusterPostgresVersion() without target = %q, want the source's 14", got)
+	}
+
+	config.TargetPostgresVersion = "16"
+	if got := config.ClusterPostgresVersion(); got != "16" {
+		t.Errorf("ClusterPostgresVersion() = %q, want the target 16", got)
+	}
+
+	// Restores keep the version they were restored with, older ones run the configured version
+	if got := (&Restore{PostgresVersion: "15"}).ClusterPostgresVersion(config); got != "15" {
+		t.Errorf("Restore.ClusterPostgresVersion() = %q, want the recorded 15", got)
+	}
+	if got := (&Restore{}).ClusterPostgresVersion(config); got != "16" {
+		t.Errorf("Restore.ClusterPostgresVersion() without recorded version = %q, want 16", got)
+	}
+}
+
+func TestParseRefreshWindows(t *testing.T) {
+	windows, err := ParseRefreshWindows(" 01:00-05:30, 22:00-02:00 ,")
+	if err != nil {
+		t.Fatalf("ParseRefreshWindows() error = %v", err)
+	}
+	if len(windows) != 2 {
+		t.Fatalf("ParseRefreshWindows() = %v, want 2 windows", windows)
+	}
+
+	at := func(hour, minute int) time.Time { return time.Date(2025, 1, 1, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		window RefreshWindow
+		at     time.Time
+		want   bool
+	}{
+		{windows[0], at(1, 0), true},
+		{windows[0], at(5, 29), true},
+		{windows[0], at(5, 30), false},
+		{windows[0], at(0, 59), false},
+		{windows[1], at(23, 0), true}, // Wraps past midnight
+		{windows[1], at(1, 59), true},
+		{windows[1], at(2, 0), false},
+		{windows[1], at(12, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.window.Contains(tt.at); got != tt.want {
+			t.Errorf("%v.Contains(%s) = %v, want %v", tt.window, tt.at.Format("15:04"), got, tt.want)
+		}
+	}
+
+	// Contains compares UTC times
+	if !windows[0].Contains(time.Date(2025, 1, 1, 3, 0, 0, 0, time.FixedZone("CET", 3600))) {
+		t.Error("02:00 UTC (03:00 CET) is outside 01:00-05:30")
+	}
+
+	if windows, err := ParseRefreshWindows(""); err != nil || windows != nil {
+		t.Errorf("ParseRefreshWindows(\"\") = %v, %v, want no windows", windows, err)
+	}
+	for _, invalid := range []string{"01:00", "1am-5am", "25:00-02:00", "03:00-03:00"} {
+		if _, err := ParseRefreshWindows(invalid); err == nil {
+			t.Errorf("ParseRefreshWindows(%q) succeeded, want an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
+)
+
+// channelTimeout bounds one webhook request, an unreachable chat must not hold up branch operations or the checks
+const channelTimeout = 10 * time.Second
+
+// Colors of channel messages (RGB)
+const (
+	colorSucceeded = 0x2eb886
+	colorFailed    = 0xd00000
+)
+
+// maxFieldLength bounds field values, e.g. long failure reasons (Discord rejects values over 1024 characters)
+const maxFieldLength = 1000
+
+// ChannelMessage is an event posted to notification channels
+type ChannelMessage struct {
+	Event   string         // models.ChannelEvent*
+	Title   string         // e.g. "Branch feature-x created"
+	Failed  bool           // Shown in red
+	Fields  []ChannelField // Shown as a table, e.g. the duration and restore
+	LogsURL string         // Optional link to the logs, see LogsURL
+}
+
+// ChannelField is a labelled value of a channel message
+type ChannelField struct {
+	Name  string
+	Value string
+}
+
+// ChannelKind infers the kind of a notification channel from its webhook URL, empty if it isn't a known chat
+func ChannelKind(webhookURL string) string {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(parsed.Hostname())
+	switch {
+	case host == "hooks.slack.com":
+		return models.ChannelKindSlack
+	case (host == "discord.com" || host == "discordapp.com") && strings.HasPrefix(parsed.Path, "/api/webhooks/"):
+		return models.ChannelKindDiscord
+	case strings.HasSuffix(host, ".webhook.office.com") || strings.HasSuffix(host, ".logic.azure.com") ||
+		strings.HasSuffix(host, ".environment.api.powerplatform.com"):
+		return models.ChannelKindTeams
+	}
+	return ""
+}
+
+// LogsURL links to the API path of some logs (e.g. "/api/restores/<id>/logs"), empty without a domain
+func LogsURL(config *models.Config, path string) string {
+	if config.Domain == "" {
+		return ""
+	}
+	return "https://" + config.Domain + path
+}
+
+// Post posts a message to every notification channel subscribed to its event
+// Failures are recorded on the channel and logged, they never fail the operation the message is about
+func (s *Service) Post(ctx context.Context, message ChannelMessage) {
+	var channels []models.NotificationChannel
+	if err := s.db.Order("name").Find(&channels).Error; err != nil {
+		s.logger.Warn().Err(err).Str("event", message.Event).Msg("Failed to load notification channels")
+		return
+	}
+	for i := range channels {
+		if !channels[i].Subscribed(message.Event) {
+			continue
+		}
+		if err := s.PostTo(ctx, &channels[i], message); err != nil {
+			s.logger.Warn().Err(err).Str("event", message.Event).Str("channel", channels[i].Name).Msg("Failed to post to notification channel")
+		}
+	}
+}
+
+// PostTo posts a message to one channel whatever its events, recording the outcome on the channel
+func (s *Service) PostTo(ctx context.Context, channel *models.NotificationChannel, message ChannelMessage) error {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	postErr := PostWebhook(ctx, channel.WebhookURL, channelPayload(channel.Kind, serverName(&config), message))
+
+	now := time.Now()
+	channel.LastPostedAt = &now
+	channel.LastError = ""
+	if postErr != nil {
+		channel.LastError = postErr.Error()
+	}
+	updates := map[string]interface{}{"last_posted_at": now, "last_error": channel.LastError}
+	if err := s.db.Model(channel).Updates(updates).Error; err != nil {
+		s.logger.Warn().Err(err).Str("channel", channel.Name).Msg("Failed to record notification channel post")
+	}
+	return postErr
+}
+
+// checkChannelEvents posts the refresh runs that succeeded and the restores that failed since the last check
+// The first check only starts from now, enabling channels doesn't post older events
+func (s *Service) checkChannelEvents(ctx context.Context, config *models.Config, now time.Time) error {
+	if config.ChannelsCheckedAt != nil {
+		since := *config.ChannelsCheckedAt
+
+		var runs []models.RefreshRun
+		if err := s.db.Where("outcome = ? AND finished_at > ? AND finished_at <= ?", models.RefreshOutcomeSucceeded, since, now).
+			Order("finished_at").
+			Find(&runs).Error; err != nil {
+			return fmt.Errorf("failed to load finished refreshes: %w", err)
+		}
+		for _, run := range runs {
+			s.Post(ctx, refreshCompletedMessage(config, &run))
+		}
+
+		var restores []models.Restore
+		if err := s.db.Where("state = ? AND failed_at > ? AND failed_at <= ?", models.RestoreStateFailed, since, now).
+			Order("failed_at").
+			Find(&restores).Error; err != nil {
+			return fmt.Errorf("failed to load failed restores: %w", err)
+		}
+		for _, restore := range restores {
+			s.Post(ctx, restoreFailedMessage(config, &restore))
+		}
+	}
+
+	if err := s.db.Model(config).Update("channels_checked_at", now).Error; err != nil {
+		return fmt.Errorf("failed to record notification channel check: %w", err)
+	}
+	return nil
+}
+
+// refreshCompletedMessage describes a succeeded refresh run
+func refreshCompletedMessage(config *models.Config, run *models.RefreshRun) ChannelMessage {
+	fields := []ChannelField{
+		{Name: "Duration", Value: FormatDuration(time.Duration(run.DurationSeconds) * time.Second)},
+		{Name: "Mode", Value: run.Mode},
+		{Name: "Trigger", Value: run.Trigger},
+	}
+	if run.BytesTransferred > 0 {
+		fields = append(fields, ChannelField{Name: "Transferred", Value: sysinfo.FormatBytes(run.BytesTransferred)})
+	}
+	return ChannelMessage{
+		Event:   models.ChannelEventRefreshCompleted,
+		Title:   fmt.Sprintf("Refresh %s completed", run.RestoreName),
+		Fields:  fields,
+		LogsURL: LogsURL(config, "/api/restores/"+run.RestoreID+"/logs"),
+	}
+}
+
+// restoreFailedMessage describes a failed restore
+func restoreFailedMessage(config *models.Config, restore *models.Restore) ChannelMessage {
+	var fields []ChannelField
+	if restore.StartedAt != nil && restore.FailedAt != nil {
+		fields = append(fields, ChannelField{Name: "Ran for", Value: FormatDuration(restore.FailedAt.Sub(*restore.StartedAt))})
+	}
+	if restore.FailureReason != "" {
+		fields = append(fields, ChannelField{Name: "Reason", Value: truncate(restore.FailureReason, maxFieldLength)})
+	}
+	return ChannelMessage{
+		Event:   models.ChannelEventRestoreFailed,
+		Title:   fmt.Sprintf("Restore %s failed", restore.Name),
+		Failed:  true,
+		Fields:  fields,
+		LogsURL: LogsURL(config, "/api/restores/"+restore.ID+"/logs"),
+	}
+}
+
+// channelPayload formats a message for the kind of channel, server identifies the branchd server
+func channelPayload(kind, server string, message ChannelMessage) any {
+	color := colorSucceeded
+	if message.Failed {
+		color = colorFailed
+	}
+	footer := "branchd " + server
+
+	switch kind {
+	case models.ChannelKindDiscord:
+		return discordPayload(message, color, footer)
+	case models.ChannelKindTeams:
+		return teamsPayload(message, footer)
+	default:
+		return slackPayload(message, color, footer)
+	}
+}
+
+// slackPayload is a Slack message with a colored attachment, "text" is shown in notifications
+func slackPayload(message ChannelMessage, color int, footer string) map[string]any {
+	blocks := []map[string]any{
+		{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": "*" + slackEscape(message.Title) + "*"}},
+	}
+	if len(message.Fields) > 0 {
+		var fields []map[string]any
+		for _, field := range message.Fields {
+			fields = append(fields, map[string]any{"type": "mrkdwn", "text": "*" + field.Name + "*\n" + slackEscape(field.Value)})
+		}
+		blocks = append(blocks, map[string]any{"type": "section", "fields": fields})
+	}
+	footerText := slackEscape(footer)
+	if message.LogsURL != "" {
+		footerText += " · <" + message.LogsURL + "|View logs>"
+	}
+	blocks = append(blocks, map[string]any{"type": "context", "elements": []map[string]any{{"type": "mrkdwn", "text": footerText}}})
+
+	return map[string]any{
+		"text":        message.Title,
+		"attachments": []map[string]any{{"color": fmt.Sprintf("#%06x", color), "blocks": blocks}},
+	}
+}
+
+// slackEscape escapes the characters Slack's mrkdwn treats as markup
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// discordPayload is a Discord message with one embed, linking to the logs from its title
+func discordPayload(message ChannelMessage, color int, footer string) map[string]any {
+	var fields []map[string]any
+	for _, field := range message.Fields {
+		// Long values (e.g. failure reasons) get a row of their own
+		fields = append(fields, map[string]any{"name": field.Name, "value": field.Value, "inline": len(field.Value) <= 40})
+	}
+
+	embed := map[string]any{
+		"title":     truncate(message.Title, 256),
+		"color":     color,
+		"fields":    fields,
+		"footer":    map[string]any{"text": footer},
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}
+	if message.LogsURL != "" {
+		embed["url"] = message.LogsURL
+	}
+	return map[string]any{"embeds": []map[string]any{embed}}
+}
+
+// teamsPayload is a Teams Workflows message with an Adaptive Card
+func teamsPayload(message ChannelMessage, footer string) map[string]any {
+	titleColor := "Good"
+	if message.Failed {
+		titleColor = "Attention"
+	}
+	body := []map[string]any{
+		{"type": "TextBlock", "text": message.Title, "weight": "Bolder", "size": "Medium", "color": titleColor, "wrap": true},
+	}
+	if len(message.Fields) > 0 {
+		var facts []map[string]any
+		for _, field := range message.Fields {
+			facts = append(facts, map[string]any{"title": field.Name, "value": field.Value})
+		}
+		body = append(body, map[string]any{"type": "FactSet", "facts": facts})
+	}
+	body = append(body, map[string]any{"type": "TextBlock", "text": footer, "isSubtle": true, "size": "Small", "wrap": true})
+
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	if message.LogsURL != "" {
+		card["actions"] = []map[string]any{{"type": "Action.OpenUrl", "title": "View logs", "url": message.LogsURL}}
+	}
+	return map[string]any{
+		"type":        "message",
+		"attachments": []map[string]any{{"contentType": "application/vnd.microsoft.card.adaptive", "content": card}},
+	}
+}
+
+// truncate shortens text to at most limit characters
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// PostWebhook posts a JSON payload to a webhook, channel messages as well as the generic notifications of
+// Config.NotificationWebhookURL (break-glass grants and decommissions)
+func PostWebhook(ctx context.Context, webhookURL string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, channelTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// webhookRecorder is a chat webhook recording the bodies posted to it
+type webhookRecorder struct {
+	server *httptest.Server
+	bodies []string
+	status int
+}
+
+func newWebhookRecorder(t *testing.T) *webhookRecorder {
+	t.Helper()
+	recorder := &webhookRecorder{status: http.StatusOK}
+	recorder.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		recorder.bodies = append(recorder.bodies, string(body))
+		w.WriteHeader(recorder.status)
+	}))
+	t.Cleanup(recorder.server.Close)
+	return recorder
+}
+
+func createChannel(t *testing.T, s *Service, channel models.NotificationChannel) *models.NotificationChannel {
+	t.Helper()
+	if err := s.db.Create(&channel).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+	return &channel
+}
+
+func TestChannelKind(t *testing.T) {
+	tests := map[string]string{
+		"https://hooks.slack.com/services/T000/B000/XXXX":                                       models.ChannelKindSlack,
+		"https://discord.com/api/webhooks/123/abc":                                              models.ChannelKindDiscord,
+		"https://company.webhook.office.com/webhookb2/abc":                                      models.ChannelKindTeams,
+		"https://prod-12.westus.logic.azure.com:443/workflows/abc/triggers/manual/paths/invoke": models.ChannelKindTeams,
+		"https://discord.com/channels/123":                                                      "",
+		"https://chat.example.com/hooks/abc":                                                    "",
+	}
+	for webhookURL, want := range tests {
+		if got := ChannelKind(webhookURL); got != want {
+			t.Errorf("ChannelKind(%q) = %q, want %q", webhookURL, got, want)
+		}
+	}
+}
+
+func TestPostFormatsPerKind(t *testing.T) {
+	s := newTestService(t)
+	slack := newWebhookRecorder(t)
+	discord := newWebhookRecorder(t)
+	teams := newWebhookRecorder(t)
+	createChannel(t, s, models.NotificationChannel{Name: "slack", Kind: models.ChannelKindSlack, WebhookURL: slack.server.URL})
+	createChannel(t, s, models.NotificationChannel{Name: "discord", Kind: models.ChannelKindDiscord, WebhookURL: discord.server.URL})
+	createChannel(t, s, models.NotificationChannel{Name: "teams", Kind: models.ChannelKindTeams, WebhookURL: teams.server.URL,
+		Events: []string{models.ChannelEventBranchDeleted}})
+
+	s.Post(context.Background(), ChannelMessage{
+		Event:   models.ChannelEventRestoreFailed,
+		Title:   "Restore restore_1 failed",
+		Failed:  true,
+		Fields:  []ChannelField{{Name: "Reason", Value: "could not connect <server>"}},
+		LogsURL: "https://db.example.com/api/restores/r1/logs",
+	})
+
+	if len(teams.bodies) != 0 {
+		t.Errorf("teams channel got %d messages, it's only subscribed to branch.deleted", len(teams.bodies))
+	}
+	if len(slack.bodies) != 1 || len(discord.bodies) != 1 {
+		t.Fatalf("slack got %d and discord %d messages, want one each", len(slack.bodies), len(discord.bodies))
+	}
+	for _, want := range []string{`"text":"Restore restore_1 failed"`, `"color":"#d00000"`, `could not connect \u0026lt;server\u0026gt;`,
+		`\u003chttps://db.example.com/api/restores/r1/logs|View logs\u003e`, "branchd db.example.com"} {
+		if !strings.Contains(slack.bodies[0], want) {
+			t.Errorf("slack message doesn't contain %s:\n%s", want, slack.bodies[0])
+		}
+	}
+
+	var discordMessage struct {
+		Embeds []struct {
+			Title  string `json:"title"`
+			URL    string `json:"url"`
+			Color  int    `json:"color"`
+			Fields []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"fields"`
+		} `json:"embeds"`
+	}
+	if err := json.Unmarshal([]byte(discord.bodies[0]), &discordMessage); err != nil {
+		t.Fatalf("invalid discord message: %v", err)
+	}
+	if len(discordMessage.Embeds) != 1 || discordMessage.Embeds[0].Color != colorFailed ||
+		discordMessage.Embeds[0].URL != "https://db.example.com/api/restores/r1/logs" || len(discordMessage.Embeds[0].Fields) != 1 {
+		t.Errorf("discord message = %+v, want one red embed linking to the logs", discordMessage)
+	}
+
+	var channel models.NotificationChannel
+	if err := s.db.Where("name = ?", "slack").First(&channel).Error; err != nil {
+		t.Fatalf("failed to load channel: %v", err)
+	}
+	if channel.LastPostedAt == nil || channel.LastError != "" {
+		t.Errorf("channel = %+v, want a recorded successful post", channel)
+	}
+
+	// Teams gets an Adaptive Card
+	s.Post(context.Background(), ChannelMessage{Event: models.ChannelEventBranchDeleted, Title: "Branch feature-x deleted"})
+	if len(teams.bodies) != 1 || !strings.Contains(teams.bodies[0], `"contentType":"application/vnd.microsoft.card.adaptive"`) {
+		t.Errorf("teams messages = %v, want one Adaptive Card", teams.bodies)
+	}
+}
+
+func TestPostToRecordsFailure(t *testing.T) {
+	s := newTestService(t)
+	webhook := newWebhookRecorder(t)
+	webhook.status = http.StatusNotFound
+	channel := createChannel(t, s, models.NotificationChannel{Name: "slack", Kind: models.ChannelKindSlack, WebhookURL: webhook.server.URL})
+
+	if err := s.PostTo(context.Background(), channel, ChannelMessage{Title: "Test"}); err == nil {
+		t.Fatal("PostTo() succeeded, want the webhook's status")
+	}
+	var stored models.NotificationChannel
+	if err := s.db.First(&stored, "id = ?", channel.ID).Error; err != nil {
+		t.Fatalf("failed to load channel: %v", err)
+	}
+	if stored.LastError != "webhook returned status 404" {
+		t.Errorf("last_error = %q, want the webhook's status", stored.LastError)
+	}
+}
+
+func TestCheckChannelEvents(t *testing.T) {
+	s := newTestService(t)
+	stubMail(t, nil)
+	free := 50.0
+	stubFreeDisk(t, &free)
+	webhook := newWebhookRecorder(t)
+	createChannel(t, s, models.NotificationChannel{Name: "ops", Kind: models.ChannelKindSlack, WebhookURL: webhook.server.URL})
+
+	finished := time.Now().Add(-time.Minute)
+	createRun := func(name, outcome string) {
+		t.Helper()
+		run := models.RefreshRun{RestoreID: name, RestoreName: name, Trigger: models.RefreshTriggerScheduled, Mode: models.RefreshModeFull,
+			Outcome: outcome, FinishedAt: &finished, DurationSeconds: 754, BytesTransferred: 3 << 30}
+		if err := s.db.Create(&run).Error; err != nil {
+			t.Fatalf("failed to create refresh run: %v", err)
+		}
+	}
+
+	// Events before the first check aren't posted
+	createRun("restore_old", models.RefreshOutcomeSucceeded)
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(webhook.bodies) != 0 {
+		t.Fatalf("posted %d messages on the first check, want none", len(webhook.bodies))
+	}
+
+	finished = time.Now()
+	started := finished.Add(-90 * time.Minute)
+	createRun("restore_new", models.RefreshOutcomeSucceeded)
+	createRun("restore_failed", models.RefreshOutcomeFailed)
+	if err := s.db.Create(&models.Restore{Name: "restore_failed", State: models.RestoreStateFailed, StartedAt: &started, FailedAt: &finished,
+		FailureReason: "pg_restore: error: could not execute query"}).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+
+	for range 2 {
+		if err := s.Check(context.Background()); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+	}
+
+	if len(webhook.bodies) != 2 {
+		t.Fatalf("posted %v, want the completed refresh and the failed restore once", webhook.bodies)
+	}
+	for i, wants := range [][]string{
+		{"Refresh restore_new completed", "12m34s", "3.0 GB"},
+		{"Restore restore_failed failed", "1h30m", "could not execute query"},
+	} {
+		for _, want := range wants {
+			if !strings.Contains(webhook.bodies[i], want) {
+				t.Errorf("message %d doesn't contain %q:\n%s", i, want, webhook.bodies[i])
+			}
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		35 * time.Second:                          "35s",
+		12*time.Minute + 5*time.Second:            "12m05s",
+		3*time.Hour + 5*time.Minute + time.Second: "3h05m",
+	}
+	for d, want := range tests {
+		if got := FormatDuration(d); got != want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
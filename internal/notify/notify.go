@@ -0,0 +1,261 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
+)
+
+// Events of notifications (Notification.Event)
+const (
+	EventRefreshFailed = "refresh.failed"    // A scheduled refresh failed
+	EventRestoreSlow   = "restore.slow"      // A restore ran past Config.NotifyRestoreHours
+	EventDiskLow       = "disk.low"          // ZFS free space dropped below Config.NotifyDiskFreePercent
+	EventTest          = "notification.test" // Sent by POST /api/config/test-email and /api/notification-channels/:id/test
+)
+
+// refreshFailureWindow is how old failed refreshes may be to be notified, so enabling email doesn't report old ones
+const refreshFailureWindow = 24 * time.Hour
+
+// diskLowRepeat is how often low disk space is notified again while it stays low
+const diskLowRepeat = 24 * time.Hour
+
+// ErrNotConfigured is returned by Send when no SMTP server is configured
+var ErrNotConfigured = errors.New("no SMTP server configured")
+
+// freeDiskPercent reads the free space of the dataset root (replaced in tests)
+var freeDiskPercent = sysinfo.FreeDiskPercent
+
+// Notification is a message to the admins
+type Notification struct {
+	Event   string
+	Subject string
+	Body    string
+}
+
+// Service emails admins about refresh failures, slow restores and low disk space
+type Service struct {
+	db     *gorm.DB
+	cfg    *config.Config
+	logger zerolog.Logger
+}
+
+func NewService(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *Service {
+	return &Service{
+		db:     db,
+		cfg:    cfg,
+		logger: logger.With().Str("component", "notify").Logger(),
+	}
+}
+
+// Enabled reports whether notifications are emailed, otherwise they're only logged
+func Enabled(config *models.Config) bool {
+	return config.SMTPHost != ""
+}
+
+// Send logs a notification and emails it to all admins
+// Returns ErrNotConfigured without an SMTP server, the notification is then only logged
+func (s *Service) Send(ctx context.Context, config *models.Config, notification Notification) error {
+	s.logger.Warn().Str("event", notification.Event).Msg(notification.Subject)
+	if !Enabled(config) {
+		return ErrNotConfigured
+	}
+
+	var admins []string
+	if err := s.db.Model(&models.User{}).Where("is_admin = ?", true).Order("email").Pluck("email", &admins).Error; err != nil {
+		return fmt.Errorf("failed to load admins: %w", err)
+	}
+	if len(admins) == 0 {
+		return fmt.Errorf("no admins to notify")
+	}
+	return s.SendTo(ctx, config, admins, notification)
+}
+
+// SendTo emails a notification to the recipients, e.g. the owners of branches
+// Returns ErrNotConfigured without an SMTP server
+func (s *Service) SendTo(ctx context.Context, config *models.Config, recipients []string, notification Notification) error {
+	if !Enabled(config) {
+		return ErrNotConfigured
+	}
+
+	subject := fmt.Sprintf("[branchd %s] %s", serverName(config), notification.Subject)
+	message := buildMessage(config.SMTPFrom, recipients, subject, notification.Body, time.Now())
+	if err := sendMail(ctx, config, recipients, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	s.logger.Info().Str("event", notification.Event).Strs("recipients", recipients).Msg("Notification emailed")
+	return nil
+}
+
+// Check notifies admins of failed scheduled refreshes, slow restores and low disk space, each once
+// A notification that couldn't be emailed is retried on the next check
+// Finished refreshes and failed restores are also posted to the notification channels subscribed to them
+func (s *Service) Check(ctx context.Context) error {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	now := time.Now()
+	if err := s.checkRefreshFailures(ctx, &config, now); err != nil {
+		return err
+	}
+	if err := s.checkSlowRestores(ctx, &config, now); err != nil {
+		return err
+	}
+	if err := s.checkChannelEvents(ctx, &config, now); err != nil {
+		return err
+	}
+	return s.checkDiskSpace(ctx, &config, now)
+}
+
+// checkRefreshFailures notifies each scheduled refresh run that failed recently
+func (s *Service) checkRefreshFailures(ctx context.Context, config *models.Config, now time.Time) error {
+	var runs []models.RefreshRun
+	if err := s.db.Where("trigger = ? AND outcome = ? AND notified_at IS NULL AND finished_at > ?",
+		models.RefreshTriggerScheduled, models.RefreshOutcomeFailed, now.Add(-refreshFailureWindow)).
+		Order("finished_at").
+		Find(&runs).Error; err != nil {
+		return fmt.Errorf("failed to load failed refreshes: %w", err)
+	}
+
+	for _, run := range runs {
+		notification := Notification{
+			Event:   EventRefreshFailed,
+			Subject: fmt.Sprintf("Scheduled refresh %s failed (%s)", run.RestoreName, run.FailureCategory),
+			Body: fmt.Sprintf("The scheduled %s refresh %s failed at %s, branches keep using the previous restore's data.\n\n"+
+				"Reason: %s\n\nSee GET /api/reports/refresh-history for earlier runs.\n",
+				run.Mode, run.RestoreName, run.FinishedAt.UTC().Format(time.RFC1123), run.FailureReason),
+		}
+		if !s.deliver(ctx, config, notification) {
+			continue
+		}
+		if err := s.db.Model(&run).Update("notified_at", now).Error; err != nil {
+			return fmt.Errorf("failed to record refresh failure notification: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkSlowRestores notifies each restore still running after Config.NotifyRestoreHours
+func (s *Service) checkSlowRestores(ctx context.Context, config *models.Config, now time.Time) error {
+	if config.NotifyRestoreHours <= 0 {
+		return nil
+	}
+	threshold := time.Duration(config.NotifyRestoreHours) * time.Hour
+
+	var restores []models.Restore
+	if err := s.db.Where("state IN ? AND slow_notified_at IS NULL AND started_at < ?",
+		[]string{models.RestoreStateDumping, models.RestoreStateRestoring, models.RestoreStateAnonymizing}, now.Add(-threshold)).
+		Find(&restores).Error; err != nil {
+		return fmt.Errorf("failed to load running restores: %w", err)
+	}
+
+	for _, restore := range restores {
+		running := FormatDuration(now.Sub(*restore.StartedAt))
+		body := fmt.Sprintf("Restore %s has been running for %s (%s), longer than notify_restore_hours (%d).\n",
+			restore.Name, running, restore.State, config.NotifyRestoreHours)
+		if config.RestoreDeadlineHours > 0 {
+			body += fmt.Sprintf("\nIt is stopped and marked failed after restore_deadline_hours (%d).\n", config.RestoreDeadlineHours)
+		}
+		notification := Notification{
+			Event:   EventRestoreSlow,
+			Subject: fmt.Sprintf("Restore %s still running after %s", restore.Name, running),
+			Body:    body,
+		}
+		if !s.deliver(ctx, config, notification) {
+			continue
+		}
+		if err := s.db.Model(&restore).Update("slow_notified_at", now).Error; err != nil {
+			return fmt.Errorf("failed to record slow restore notification: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkDiskSpace notifies when the free space of the ZFS dataset root is below Config.NotifyDiskFreePercent,
+// again every diskLowRepeat while it stays low
+func (s *Service) checkDiskSpace(ctx context.Context, config *models.Config, now time.Time) error {
+	if config.NotifyDiskFreePercent <= 0 || s.cfg.Storage.DatasetRoot == "" {
+		return nil
+	}
+
+	percent, available, err := freeDiskPercent(ctx, s.cfg.Storage.DatasetRoot)
+	if err != nil {
+		// No ZFS (e.g. development machines), nothing to watch
+		s.logger.Debug().Err(err).Msg("Failed to check free disk space")
+		return nil
+	}
+
+	if percent >= float64(config.NotifyDiskFreePercent) {
+		if config.DiskLowNotifiedAt != nil {
+			s.logger.Info().Float64("free_percent", percent).Msg("Free disk space recovered")
+			return s.db.Model(config).Update("disk_low_notified_at", nil).Error
+		}
+		return nil
+	}
+	if config.DiskLowNotifiedAt != nil && now.Sub(*config.DiskLowNotifiedAt) < diskLowRepeat {
+		return nil
+	}
+
+	notification := Notification{
+		Event:   EventDiskLow,
+		Subject: fmt.Sprintf("Only %.0f%% disk space left on %s", percent, s.cfg.Storage.DatasetRoot),
+		Body: fmt.Sprintf("ZFS dataset %s has %s (%.1f%%) available, less than notify_disk_free_percent (%d%%).\n\n"+
+			"Restores and branches fail once it's full. Delete unused branches and restores, lower max_restores "+
+			"or restore_max_age_days, or grow the pool.\n",
+			s.cfg.Storage.DatasetRoot, sysinfo.FormatBytes(available), percent, config.NotifyDiskFreePercent),
+	}
+	if !s.deliver(ctx, config, notification) {
+		return nil
+	}
+	return s.db.Model(config).Update("disk_low_notified_at", now).Error
+}
+
+// deliver sends a notification, reporting whether it's done: emailed, or only logged without an SMTP server
+func (s *Service) deliver(ctx context.Context, config *models.Config, notification Notification) bool {
+	err := s.Send(ctx, config, notification)
+	if err != nil && !errors.Is(err, ErrNotConfigured) {
+		s.logger.Warn().Err(err).Str("event", notification.Event).Msg("Failed to email notification")
+		return false
+	}
+	return true
+}
+
+// FormatDuration renders a duration in hours and minutes, e.g. "3h05m", or "12m40s" and "35s" under an hour
+func FormatDuration(d time.Duration) string {
+	seconds := int(d / time.Second)
+	switch {
+	case seconds < 60:
+		return fmt.Sprintf("%ds", seconds)
+	case seconds < 3600:
+		return fmt.Sprintf("%dm%02ds", seconds/60, seconds%60)
+	}
+	minutes := seconds / 60
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
+
+// serverName identifies the server in subjects: its domain, or its hostname without one
+func serverName(config *models.Config) string {
+	if config.Domain != "" {
+		return config.Domain
+	}
+	if host, err := os.Hostname(); err == nil {
+		return strings.SplitN(host, ".", 2)[0]
+	}
+	return "server"
+}
@@ -0,0 +1,262 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// sentMail is an email recorded instead of delivered
+type sentMail struct {
+	to      []string
+	message string
+}
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// In-memory databases exist per connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	if err := db.Create(&models.Config{JWTSecret: "secret", Domain: "db.example.com", SMTPHost: "smtp.example.com", SMTPPort: 587,
+		SMTPFrom: "branchd@example.com", NotifyRestoreHours: 2, NotifyDiskFreePercent: 10}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+	for _, user := range []models.User{
+		{Email: "bob@example.com", IsAdmin: true},
+		{Email: "alice@example.com", IsAdmin: true},
+		{Email: "carol@example.com"},
+	} {
+		user.PasswordHash = "hash"
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	return NewService(db, &config.Config{Storage: config.StorageConfig{DatasetRoot: "tank"}}, zerolog.Nop())
+}
+
+// stubMail records sent emails for the test's duration, failing with sendErr while it's set
+func stubMail(t *testing.T, sendErr *error) *[]sentMail {
+	t.Helper()
+	var sent []sentMail
+	original := sendMail
+	t.Cleanup(func() { sendMail = original })
+	sendMail = func(ctx context.Context, config *models.Config, to []string, message []byte) error {
+		if sendErr != nil && *sendErr != nil {
+			return *sendErr
+		}
+		sent = append(sent, sentMail{to: to, message: string(message)})
+		return nil
+	}
+	return &sent
+}
+
+// stubFreeDisk reports percent free space on the dataset root for the test's duration
+func stubFreeDisk(t *testing.T, percent *float64) {
+	t.Helper()
+	original := freeDiskPercent
+	t.Cleanup(func() { freeDiskPercent = original })
+	freeDiskPercent = func(ctx context.Context, dataset string) (float64, int64, error) {
+		return *percent, int64(*percent) << 30, nil
+	}
+}
+
+func loadConfig(t *testing.T, s *Service) models.Config {
+	t.Helper()
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	return config
+}
+
+func TestCheckRefreshFailures(t *testing.T) {
+	s := newTestService(t)
+	var sendErr error
+	sent := stubMail(t, &sendErr)
+	free := 50.0
+	stubFreeDisk(t, &free)
+
+	now := time.Now()
+	longAgo := now.Add(-48 * time.Hour)
+	runs := []models.RefreshRun{
+		{RestoreName: "restore_1", Trigger: models.RefreshTriggerScheduled, Mode: models.RefreshModeFull, Outcome: models.RefreshOutcomeFailed,
+			FinishedAt: &now, FailureCategory: models.RefreshFailureSource, FailureReason: "could not connect to server"},
+		{RestoreName: "restore_2", Trigger: models.RefreshTriggerManual, Outcome: models.RefreshOutcomeFailed, FinishedAt: &now},
+		{RestoreName: "restore_3", Trigger: models.RefreshTriggerScheduled, Outcome: models.RefreshOutcomeSucceeded, FinishedAt: &now},
+		{RestoreName: "restore_4", Trigger: models.RefreshTriggerScheduled, Outcome: models.RefreshOutcomeFailed, FinishedAt: &longAgo},
+	}
+	for i := range runs {
+		runs[i].RestoreID = runs[i].RestoreName
+		if err := s.db.Create(&runs[i]).Error; err != nil {
+			t.Fatalf("failed to create refresh run: %v", err)
+		}
+	}
+
+	// Failed delivery is retried on the next check
+	sendErr = errors.New("connection refused")
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	sendErr = nil
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() again error = %v", err)
+	}
+
+	if len(*sent) != 1 {
+		t.Fatalf("sent %d emails, want only the recent scheduled failure once", len(*sent))
+	}
+	mail := (*sent)[0]
+	if strings.Join(mail.to, ",") != "alice@example.com,bob@example.com" {
+		t.Errorf("recipients = %v, want the admins", mail.to)
+	}
+	for _, want := range []string{"Subject: [branchd db.example.com] Scheduled refresh restore_1 failed (source)", "could not connect to server"} {
+		if !strings.Contains(mail.message, want) {
+			t.Errorf("email doesn't contain %q:\n%s", want, mail.message)
+		}
+	}
+}
+
+func TestCheckSlowRestores(t *testing.T) {
+	s := newTestService(t)
+	sent := stubMail(t, nil)
+	free := 50.0
+	stubFreeDisk(t, &free)
+
+	hoursAgo := func(h int) *time.Time {
+		at := time.Now().Add(-time.Duration(h) * time.Hour)
+		return &at
+	}
+	for _, restore := range []models.Restore{
+		{Name: "restore_slow", State: models.RestoreStateRestoring, StartedAt: hoursAgo(3)},
+		{Name: "restore_recent", State: models.RestoreStateDumping, StartedAt: hoursAgo(1)},
+		{Name: "restore_ready", State: models.RestoreStateReady, StartedAt: hoursAgo(5)},
+		{Name: "restore_queued", State: models.RestoreStatePending},
+	} {
+		if err := s.db.Create(&restore).Error; err != nil {
+			t.Fatalf("failed to create restore: %v", err)
+		}
+	}
+
+	for range 2 {
+		if err := s.Check(context.Background()); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+	}
+
+	if len(*sent) != 1 || !strings.Contains((*sent)[0].message, "Restore restore_slow still running after 3h00m") {
+		t.Fatalf("sent %v, want one email about restore_slow", *sent)
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	s := newTestService(t)
+	sent := stubMail(t, nil)
+	free := 8.0
+	stubFreeDisk(t, &free)
+
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() again error = %v", err)
+	}
+	if len(*sent) != 1 || !strings.Contains((*sent)[0].message, "Only 8% disk space left on tank") {
+		t.Fatalf("sent %v, want one low disk space email", *sent)
+	}
+	if loadConfig(t, s).DiskLowNotifiedAt == nil {
+		t.Error("disk_low_notified_at not recorded")
+	}
+
+	// Still low a day later
+	if err := s.db.Model(&models.Config{}).Where("1 = 1").Update("disk_low_notified_at", time.Now().Add(-25*time.Hour)).Error; err != nil {
+		t.Fatalf("failed to backdate notification: %v", err)
+	}
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(*sent) != 2 {
+		t.Fatalf("sent %d emails, want a reminder after a day", len(*sent))
+	}
+
+	free = 30
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if loadConfig(t, s).DiskLowNotifiedAt != nil {
+		t.Error("disk_low_notified_at not cleared once space recovered")
+	}
+}
+
+func TestSendNotConfigured(t *testing.T) {
+	s := newTestService(t)
+	sent := stubMail(t, nil)
+	config := loadConfig(t, s)
+	config.SMTPHost = ""
+
+	err := s.Send(context.Background(), &config, Notification{Event: EventTest, Subject: "Test"})
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Send() error = %v, want ErrNotConfigured", err)
+	}
+	if len(*sent) != 0 {
+		t.Errorf("sent %d emails without an SMTP server", len(*sent))
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	now := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	message := string(buildMessage("branchd@example.com", []string{"a@example.com", "b@example.com"}, "Disk full ✗", "line 1\nline 2\n", now))
+
+	for _, want := range []string{
+		"From: branchd@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: =?utf-8?q?Disk_full_=E2=9C=97?=\r\n",
+		"Date: Tue, 04 Mar 2025 05:06:07 +0000\r\n",
+		"\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message doesn't contain %q:\n%s", want, message)
+		}
+	}
+}
+
+func TestSendTo(t *testing.T) {
+	s := newTestService(t)
+	sent := stubMail(t, nil)
+	config := loadConfig(t, s)
+
+	if err := s.SendTo(context.Background(), &config, []string{"carol@example.com"}, Notification{Event: EventTest, Subject: "Hello", Body: "Hi\n"}); err != nil {
+		t.Fatalf("SendTo() error = %v", err)
+	}
+	if len(*sent) != 1 || len((*sent)[0].to) != 1 || (*sent)[0].to[0] != "carol@example.com" ||
+		!strings.Contains((*sent)[0].message, "[branchd db.example.com] Hello") {
+		t.Errorf("sent = %+v, want one email to carol@example.com only", *sent)
+	}
+
+	config.SMTPHost = ""
+	if err := s.SendTo(context.Background(), &config, []string{"carol@example.com"}, Notification{Event: EventTest}); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("SendTo() without SMTP error = %v, want ErrNotConfigured", err)
+	}
+}
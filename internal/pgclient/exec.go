@@ -0,0 +1,106 @@
+package pgclient
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Transaction control in a script, which then manages its own transactions
+var transactionControlStatement = regexp.MustCompile(`(?i)^(BEGIN|COMMIT|ROLLBACK|END|ABORT|START\s+TRANSACTION)\b`)
+
+// IsTransactionControl reports whether statement begins or ends a transaction
+func IsTransactionControl(statement string) bool {
+	return transactionControlStatement.MatchString(statement)
+}
+
+// StatementResult is the outcome of a statement run by ExecTransaction or ExecScript
+type StatementResult struct {
+	Statement    string
+	RowsAffected int64
+	Duration     time.Duration
+}
+
+// StatementError is the error of the statement that stopped ExecTransaction or ExecScript
+type StatementError struct {
+	Index     int // Position of the statement, from 1
+	Statement string
+	Err       error
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement %d failed: %v", e.Index, e.Err)
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// Query runs a query returning rows
+func (c *Client) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.db.QueryContext(ctx, query, args...)
+}
+
+// BeginTx starts a transaction
+func (c *Client) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return c.db.BeginTx(ctx, nil)
+}
+
+// ExecTransaction runs statements in a single transaction, committed only if they all succeed
+func (c *Client) ExecTransaction(ctx context.Context, statements []string) ([]StatementResult, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	results, err := execStatements(ctx, tx, statements)
+	if err != nil {
+		return results, err
+	}
+	if err := tx.Commit(); err != nil {
+		return results, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return results, nil
+}
+
+// ExecScript runs the statements of a SQL script, stopping at the first error
+// Scripts run in a single transaction, unless they control transactions themselves or contain statements
+// PostgreSQL refuses in a transaction block (see IsNonTransactional): those run statement by statement,
+// like psql would, on one connection
+func (c *Client) ExecScript(ctx context.Context, script string) ([]StatementResult, error) {
+	statements := SplitStatements(script)
+	for _, statement := range statements {
+		if IsTransactionControl(statement) || IsNonTransactional(statement) {
+			conn, err := c.db.Conn(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect: %w", err)
+			}
+			defer conn.Close()
+			return execStatements(ctx, conn, statements)
+		}
+	}
+	return c.ExecTransaction(ctx, statements)
+}
+
+// execer is satisfied by *sql.Tx and *sql.Conn
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func execStatements(ctx context.Context, db execer, statements []string) ([]StatementResult, error) {
+	results := make([]StatementResult, 0, len(statements))
+	for i, statement := range statements {
+		start := time.Now()
+		result, err := db.ExecContext(ctx, statement)
+		if err != nil {
+			return results, &StatementError{Index: i + 1, Statement: statement, Err: err}
+		}
+		// Statements without a row count (e.g. CREATE TABLE) report 0
+		rows, _ := result.RowsAffected()
+		results = append(results, StatementResult{Statement: statement, RowsAffected: rows, Duration: time.Since(start)})
+	}
+	return results, nil
+}
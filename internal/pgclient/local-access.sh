@@ -0,0 +1,31 @@
+#!/bin/bash
+# Lets branchd connect to a cluster on this server as postgres over its unix socket
+# Peer authentication only lets an OS user connect as the role of the same name, so the branchd
+# ident map also allows root (branchd's user) to connect as postgres. Other roles are unaffected
+#
+# Inputs: PORT (the cluster's port)
+set -euo pipefail
+
+psql_admin() {
+    sudo -u postgres psql -X -q -t -A -v ON_ERROR_STOP=1 -p "${PORT}" -d postgres "$@"
+}
+
+HBA_FILE=$(psql_admin -c "SHOW hba_file")
+IDENT_FILE=$(psql_admin -c "SHOW ident_file")
+
+# The first matching line wins, so the map line goes before any other local line
+if ! sudo -u postgres grep -q "map=branchd" "${HBA_FILE}"; then
+    {
+        echo "local   all             postgres                                peer map=branchd"
+        sudo -u postgres cat "${HBA_FILE}"
+    } | sudo -u postgres tee "${HBA_FILE}.branchd" >/dev/null
+    sudo -u postgres mv "${HBA_FILE}.branchd" "${HBA_FILE}"
+fi
+
+if ! sudo -u postgres grep -q "^branchd[[:space:]]" "${IDENT_FILE}"; then
+    printf 'branchd         root                    postgres\nbranchd         postgres                postgres\n' |
+        sudo -u postgres tee -a "${IDENT_FILE}" >/dev/null
+fi
+
+psql_admin -c "SELECT pg_reload_conf()" >/dev/null
+echo "Local access granted on port ${PORT}"
@@ -0,0 +1,68 @@
+package pgclient
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+// LocalSocketDir is the directory of the unix sockets of the clusters on this server
+const LocalSocketDir = "/var/run/postgresql"
+
+//go:embed local-access.sh
+var localAccessScript string
+
+// pqInvalidAuthorization is the SQLSTATE of failed authentication (e.g. peer authentication)
+const pqInvalidAuthorization = "28000"
+
+// runLocalAccessScript is a variable so tests can replace it
+var runLocalAccessScript = func(ctx context.Context, port int) (string, error) {
+	output, err := shellexec.Command(ctx, localAccessScript, localAccessParams{Port: port}).CombinedOutput()
+	return string(output), err
+}
+
+type localAccessParams struct {
+	Port int `env:"PORT"`
+}
+
+// LocalConnectionString returns the connection string for database on the cluster listening on port,
+// as postgres over the unix socket
+func LocalConnectionString(port int, database string) string {
+	return fmt.Sprintf("host=%s port=%d user=postgres dbname=%s sslmode=disable", LocalSocketDir, port, quoteConninfoValue(database))
+}
+
+// OpenLocal connects to database on the cluster listening on port as postgres
+// Clusters whose pg_hba.conf doesn't let branchd in yet get the branchd ident map first (see local-access.sh)
+func OpenLocal(ctx context.Context, port int, database string) (*Client, error) {
+	client, err := NewClient(LocalConnectionString(port, database))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(ctx)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqInvalidAuthorization {
+		if output, grantErr := runLocalAccessScript(ctx, port); grantErr != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to grant local access on port %d: %w (output: %s)", port, grantErr, strings.TrimSpace(output))
+		}
+		err = client.Ping(ctx)
+	}
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to %s on port %d: %w", database, port, err)
+	}
+	return client, nil
+}
+
+// quoteConninfoValue quotes a value of a key=value connection string
+func quoteConninfoValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
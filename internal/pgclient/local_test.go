@@ -0,0 +1,11 @@
+package pgclient
+
+import "testing"
+
+func TestLocalConnectionString(t *testing.T) {
+	got := LocalConnectionString(5433, `it's my\db`)
+	want := `host=/var/run/postgresql port=5433 user=postgres dbname='it\'s my\\db' sslmode=disable`
+	if got != want {
+		t.Errorf("LocalConnectionString() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package pgclient
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DatabaseLocale is the encoding and default collation of a database
+type DatabaseLocale struct {
+	Encoding string // Server encoding, e.g. UTF8
+	Collate  string // LC_COLLATE, e.g. en_US.UTF-8
+	Ctype    string // LC_CTYPE
+	Provider string // Default collation provider: libc, icu or builtin (always libc before PostgreSQL 15)
+	Locale   string // ICU or builtin locale of the default collation, empty for libc
+}
+
+// GetDatabaseLocale retrieves the encoding and default collation of the connection's database
+func GetDatabaseLocale(ctx context.Context, connectionString string) (*DatabaseLocale, error) {
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+	}
+	defer db.Close()
+
+	var versionNum int
+	if err := db.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int").Scan(&versionNum); err != nil {
+		return nil, fmt.Errorf("failed to query PostgreSQL version: %w", err)
+	}
+
+	// datlocprovider was added in PostgreSQL 15, daticulocale was renamed to datlocale in 17
+	providerColumns := "'libc', ''"
+	switch {
+	case versionNum >= 170000:
+		providerColumns = "CASE datlocprovider WHEN 'i' THEN 'icu' WHEN 'b' THEN 'builtin' ELSE 'libc' END, coalesce(datlocale, '')"
+	case versionNum >= 150000:
+		providerColumns = "CASE datlocprovider WHEN 'i' THEN 'icu' ELSE 'libc' END, coalesce(daticulocale, '')"
+	}
+	query := fmt.Sprintf(`SELECT pg_encoding_to_char(encoding), datcollate, datctype, %s
+		FROM pg_database WHERE datname = current_database()`, providerColumns)
+
+	var locale DatabaseLocale
+	if err := db.QueryRowContext(ctx, query).Scan(&locale.Encoding, &locale.Collate, &locale.Ctype, &locale.Provider, &locale.Locale); err != nil {
+		return nil, fmt.Errorf("failed to query database locale: %w", err)
+	}
+	return &locale, nil
+}
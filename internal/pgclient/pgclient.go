@@ -59,6 +59,56 @@ func (c *Client) GetDatabaseSize(ctx context.Context) (float64, error) {
 	return float64(sizeBytes) / (1024 * 1024 * 1024), nil
 }
 
+// GetSetting retrieves the current value of a server setting, e.g. wal_level
+func (c *Client) GetSetting(ctx context.Context, name string) (string, error) {
+	var value string
+	if err := c.db.QueryRowContext(ctx, "SELECT current_setting($1)", name).Scan(&value); err != nil {
+		return "", fmt.Errorf("failed to query setting %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// UnreadableTables counts the tables, sequences and materialized views outside the system schemas and returns
+// the ones the user can't read (no USAGE on the schema or no SELECT), which pg_dump fails on
+func (c *Client) UnreadableTables(ctx context.Context) (int, []string, error) {
+	query := `
+		SELECT
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname),
+			has_schema_privilege(n.oid, 'USAGE') AND has_table_privilege(c.oid, 'SELECT')
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p', 'm', 'S')
+			AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+			AND n.nspname NOT LIKE 'pg_toast%'
+			AND n.nspname NOT LIKE 'pg_temp%'
+		ORDER BY 1
+	`
+
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to query table privileges: %w", err)
+	}
+	defer rows.Close()
+
+	total := 0
+	var unreadable []string
+	for rows.Next() {
+		var name string
+		var readable bool
+		if err := rows.Scan(&name, &readable); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan table privileges: %w", err)
+		}
+		total++
+		if !readable {
+			unreadable = append(unreadable, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("error iterating table privileges: %w", err)
+	}
+	return total, unreadable, nil
+}
+
 // GetSchema retrieves table and column information from the public schema
 func (c *Client) GetSchema(ctx context.Context) ([]TableSchema, error) {
 	query := `
@@ -210,9 +260,8 @@ func GetDatabaseSchema(ctx context.Context, connectionString string) ([]TableSch
 // ValidateConnection validates that a connection string has sufficient permissions
 // by running pg_dump --schema-only
 func ValidateConnection(ctx context.Context, connectionString string) error {
-	// Use bash to run pg_dump with proper error handling
-	cmd := exec.CommandContext(ctx, "bash", "-c",
-		fmt.Sprintf(`pg_dump --schema-only --file=/dev/null "%s" 2>&1`, connectionString))
+	// The connection string is passed as pg_dump's argument, never through a shell
+	cmd := exec.CommandContext(ctx, "pg_dump", "--schema-only", "--file=/dev/null", "--dbname="+connectionString)
 
 	output, err := cmd.CombinedOutput()
 	outputStr := string(output)
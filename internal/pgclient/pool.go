@@ -0,0 +1,183 @@
+package pgclient
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrSourceUnavailable is returned without contacting the database while a source's circuit breaker is open
+var ErrSourceUnavailable = errors.New("source database unavailable")
+
+// PoolConfig bounds the time and connections spent on source databases
+type PoolConfig struct {
+	ConnectTimeout   time.Duration // Added as connect_timeout to connection strings that don't set one
+	OperationTimeout time.Duration // Deadline of each Do call (on top of the caller's context)
+	MaxOpenConns     int           // Per source
+	FailureThreshold int           // Consecutive failures that open the circuit breaker
+	Cooldown         time.Duration // How long an open circuit breaker rejects calls before letting one through
+	IdleTimeout      time.Duration // Sources unused for this long are closed (e.g. after the connection string changed)
+}
+
+// DefaultPoolConfig suits API handlers: answers within seconds, or fails fast while the source is down
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		ConnectTimeout:   5 * time.Second,
+		OperationTimeout: 10 * time.Second,
+		MaxOpenConns:     4,
+		FailureThreshold: 3,
+		Cooldown:         30 * time.Second,
+		IdleTimeout:      30 * time.Minute,
+	}
+}
+
+// Pool keeps one Client per connection string, with a circuit breaker per source
+// Safe for concurrent use
+type Pool struct {
+	config PoolConfig
+	now    func() time.Time // time.Now, replaced in tests
+
+	mu      sync.Mutex
+	sources map[string]*poolSource
+}
+
+// poolSource is the pooled client and circuit breaker state of one connection string
+type poolSource struct {
+	client    *Client
+	lastUsed  time.Time
+	failures  int       // Consecutive failures
+	openUntil time.Time // Calls are rejected until then
+	probing   bool      // A call is testing the source after the cooldown
+}
+
+// NewPool creates an empty pool, clients are opened on first use
+func NewPool(config PoolConfig) *Pool {
+	return &Pool{
+		config:  config,
+		now:     time.Now,
+		sources: make(map[string]*poolSource),
+	}
+}
+
+// Do runs fn with the pooled client of a connection string and the operation timeout
+// Connection failures and timeouts count towards the circuit breaker, errors reported by
+// PostgreSQL itself (permissions, syntax) don't since the source is responding
+func (p *Pool) Do(ctx context.Context, connectionString string, fn func(ctx context.Context, client *Client) error) error {
+	source, err := p.acquire(connectionString)
+	if err != nil {
+		return err
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, p.config.OperationTimeout)
+	defer cancel()
+
+	err = fn(opCtx, source.client)
+	if err != nil && errors.Is(opCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("source database did not respond within %s: %w", p.config.OperationTimeout, err)
+	}
+
+	// A caller that gave up says nothing about the source
+	p.release(source, err, ctx.Err() != nil)
+	return err
+}
+
+// Close closes all pooled clients
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for connectionString, source := range p.sources {
+		source.client.Close()
+		delete(p.sources, connectionString)
+	}
+}
+
+// acquire returns the source of a connection string, or ErrSourceUnavailable while its breaker is open
+func (p *Pool) acquire(connectionString string) (*poolSource, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	p.closeIdle(now)
+
+	source, ok := p.sources[connectionString]
+	if !ok {
+		db, err := sql.Open("postgres", withConnectTimeout(connectionString, p.config.ConnectTimeout))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse connection string: %w", err)
+		}
+		db.SetMaxOpenConns(p.config.MaxOpenConns)
+		db.SetMaxIdleConns(p.config.MaxOpenConns)
+		db.SetConnMaxIdleTime(5 * time.Minute)
+
+		source = &poolSource{client: &Client{db: db, connectionString: connectionString}}
+		p.sources[connectionString] = source
+	}
+	source.lastUsed = now
+
+	if source.failures >= p.config.FailureThreshold {
+		if now.Before(source.openUntil) || source.probing {
+			return nil, fmt.Errorf("%w after %d failed attempts, retry in %s",
+				ErrSourceUnavailable, source.failures, source.openUntil.Sub(now).Round(time.Second))
+		}
+		// Half-open: this call tests the source, the others keep failing fast until it returns
+		source.probing = true
+	}
+	return source, nil
+}
+
+// release records the outcome of a call in the source's circuit breaker
+func (p *Pool) release(source *poolSource, err error, canceled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	source.probing = false
+	var pqErr *pq.Error
+	switch {
+	case err == nil || errors.As(err, &pqErr):
+		source.failures = 0
+	case canceled:
+	default:
+		source.failures++
+		if source.failures >= p.config.FailureThreshold {
+			source.openUntil = p.now().Add(p.config.Cooldown)
+		}
+	}
+}
+
+// closeIdle closes the clients of sources unused for IdleTimeout, the caller holds p.mu
+func (p *Pool) closeIdle(now time.Time) {
+	for connectionString, source := range p.sources {
+		if now.Sub(source.lastUsed) > p.config.IdleTimeout && !source.probing {
+			source.client.Close()
+			delete(p.sources, connectionString)
+		}
+	}
+}
+
+// withConnectTimeout adds connect_timeout (whole seconds) unless the connection string sets it
+func withConnectTimeout(connectionString string, timeout time.Duration) string {
+	seconds := int(timeout.Seconds())
+	if seconds <= 0 || strings.Contains(connectionString, "connect_timeout") {
+		return connectionString
+	}
+
+	if strings.HasPrefix(connectionString, "postgresql://") || strings.HasPrefix(connectionString, "postgres://") {
+		u, err := url.Parse(connectionString)
+		if err != nil {
+			return connectionString
+		}
+		query := u.Query()
+		query.Set("connect_timeout", fmt.Sprintf("%d", seconds))
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return fmt.Sprintf("%s connect_timeout=%d", connectionString, seconds)
+}
@@ -0,0 +1,177 @@
+package pgclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const testConnectionString = "postgres://branchd@127.0.0.1:1/app?sslmode=disable"
+
+// newTestPool returns a pool with a fake clock, advanced by the returned function
+func newTestPool() (*Pool, func(time.Duration)) {
+	pool := NewPool(PoolConfig{
+		OperationTimeout: time.Second,
+		MaxOpenConns:     1,
+		FailureThreshold: 3,
+		Cooldown:         30 * time.Second,
+		IdleTimeout:      10 * time.Minute,
+	})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pool.now = func() time.Time { return now }
+	return pool, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestPoolCircuitBreaker(t *testing.T) {
+	errConnection := errors.New("dial tcp 127.0.0.1:1: connect: connection refused")
+	errPostgres := &pq.Error{Code: "42501", Message: "permission denied for table users"}
+
+	// A call is made after advancing the clock and returns err, unless the breaker rejects it
+	type call struct {
+		advance  time.Duration
+		err      error
+		canceled bool // The caller gave up before the call returned
+		rejected bool // Want ErrSourceUnavailable without the call running
+	}
+	fail := call{err: errConnection}
+	succeed := call{}
+
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name:  "opens after the failure threshold",
+			calls: []call{fail, fail, fail, {rejected: true}},
+		},
+		{
+			name:  "stays open until the cooldown passed",
+			calls: []call{fail, fail, fail, {advance: 29 * time.Second, rejected: true}},
+		},
+		{
+			name:  "successful call after the cooldown closes it",
+			calls: []call{fail, fail, fail, {advance: 30 * time.Second}, succeed, fail, succeed},
+		},
+		{
+			name:  "failed call after the cooldown reopens it",
+			calls: []call{fail, fail, fail, {advance: 30 * time.Second, err: errConnection}, {rejected: true}, {advance: 30 * time.Second}},
+		},
+		{
+			name:  "success resets the consecutive failures",
+			calls: []call{fail, fail, succeed, fail, fail, succeed},
+		},
+		{
+			name:  "postgres errors don't count",
+			calls: []call{{err: errPostgres}, {err: errPostgres}, {err: errPostgres}, {err: errPostgres}, succeed},
+		},
+		{
+			name:  "canceled callers don't count",
+			calls: []call{fail, fail, {err: context.Canceled, canceled: true}, succeed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, advance := newTestPool()
+			defer pool.Close()
+
+			for i, c := range tt.calls {
+				advance(c.advance)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				ran := false
+				err := pool.Do(ctx, testConnectionString, func(ctx context.Context, client *Client) error {
+					ran = true
+					if c.canceled {
+						cancel()
+					}
+					return c.err
+				})
+				cancel()
+
+				if c.rejected {
+					if ran || !errors.Is(err, ErrSourceUnavailable) {
+						t.Fatalf("call %d: ran = %v, err = %v, want rejected with ErrSourceUnavailable", i, ran, err)
+					}
+					continue
+				}
+				if !ran {
+					t.Fatalf("call %d: rejected (%v), want it to run", i, err)
+				}
+				if !errors.Is(err, c.err) {
+					t.Fatalf("call %d: err = %v, want %v", i, err, c.err)
+				}
+			}
+		})
+	}
+}
+
+func TestPoolHalfOpenLetsOneCallThrough(t *testing.T) {
+	pool, advance := newTestPool()
+	defer pool.Close()
+
+	for i := 0; i < 3; i++ {
+		pool.Do(context.Background(), testConnectionString, func(ctx context.Context, client *Client) error {
+			return errors.New("connection refused")
+		})
+	}
+	advance(time.Minute)
+
+	var concurrent error
+	err := pool.Do(context.Background(), testConnectionString, func(ctx context.Context, client *Client) error {
+		// Other calls fail fast while this one tests the source
+		concurrent = pool.Do(context.Background(), testConnectionString, func(ctx context.Context, client *Client) error {
+			t.Error("call ran while the source was being tested")
+			return nil
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if !errors.Is(concurrent, ErrSourceUnavailable) {
+		t.Errorf("concurrent call err = %v, want ErrSourceUnavailable", concurrent)
+	}
+}
+
+func TestPoolReusesClients(t *testing.T) {
+	pool, advance := newTestPool()
+	defer pool.Close()
+
+	clientOf := func(connectionString string) *Client {
+		var got *Client
+		if err := pool.Do(context.Background(), connectionString, func(ctx context.Context, client *Client) error {
+			got = client
+			return nil
+		}); err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+		return got
+	}
+
+	first := clientOf(testConnectionString)
+	advance(5 * time.Minute)
+	if clientOf(testConnectionString) != first {
+		t.Error("same connection string got a new client")
+	}
+	other := clientOf("postgres://branchd@127.0.0.1:2/app?sslmode=disable")
+	if other == first {
+		t.Error("different connection strings share a client")
+	}
+
+	// Unused for 9 minutes is within the idle timeout, 11 minutes isn't
+	advance(9 * time.Minute)
+	if clientOf(testConnectionString) != first {
+		t.Error("client closed before the idle timeout")
+	}
+	advance(11 * time.Minute)
+	if clientOf(testConnectionString) == first {
+		t.Error("idle client was reused")
+	}
+	if len(pool.sources) != 1 {
+		t.Errorf("pooled sources = %d, want 1 (idle ones closed)", len(pool.sources))
+	}
+}
@@ -0,0 +1,22 @@
+package pgclient
+
+import "strings"
+
+// QuoteIdentifier quotes a PostgreSQL identifier
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteTable quotes a possibly schema-qualified table name (e.g. public.users)
+func QuoteTable(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// QuoteLiteral quotes a PostgreSQL string literal (standard_conforming_strings, the default since PostgreSQL 9.1)
+func QuoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,71 @@
+package pgclient
+
+import "testing"
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{
+			name: "simple identifier",
+			id:   "users",
+			want: "\"users\"",
+		},
+		{
+			name: "identifier with quotes",
+			id:   "user\"name",
+			want: "\"user\"\"name\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QuoteIdentifier(tt.id); got != tt.want {
+				t.Errorf("QuoteIdentifier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		want  string
+	}{
+		{name: "unqualified", table: "users", want: `"users"`},
+		{name: "schema-qualified", table: "public.users", want: `"public"."users"`},
+		{name: "quotes", table: `app."Users"`, want: `"app"."""Users"""`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QuoteTable(tt.table); got != tt.want {
+				t.Errorf("QuoteTable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "plain", value: "acme", want: "'acme'"},
+		{name: "single quotes", value: "o'brien", want: "'o''brien'"},
+		{name: "injection", value: "x'; DROP TABLE users; --", want: "'x''; DROP TABLE users; --'"},
+		{name: "empty", value: "", want: "''"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QuoteLiteral(tt.value); got != tt.want {
+				t.Errorf("QuoteLiteral() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package pgclient
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// Statements PostgreSQL refuses to run in a transaction block
+	nonTransactionalStatement = regexp.MustCompile(`(?is)^((CREATE\s+(UNIQUE\s+)?INDEX|DROP\s+INDEX|REINDEX)\s.*\bCONCURRENTLY\b|ALTER\s+TABLE\s.*\bDETACH\s+PARTITION\s.*\bCONCURRENTLY\b|VACUUM\b|(CREATE|DROP)\s+(DATABASE|TABLESPACE)\b|ALTER\s+SYSTEM\b)`)
+	dollarQuoteTag            = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+)
+
+// IsNonTransactional reports whether PostgreSQL refuses to run statement in a transaction block
+func IsNonTransactional(statement string) bool {
+	return nonTransactionalStatement.MatchString(statement)
+}
+
+// SplitStatements splits SQL at semicolons outside of comments, quoted strings and identifiers, and dollar quotes
+// Leading comments are dropped, statements are returned without their semicolon
+func SplitStatements(sql string) []string {
+	var statements []string
+	var current strings.Builder
+	flush := func() {
+		if statement := strings.TrimSpace(stripLeadingComments(current.String())); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(sql); {
+		end := i + 1
+		switch c := sql[i]; {
+		case c == ';':
+			flush()
+			i++
+			continue
+		case strings.HasPrefix(sql[i:], "--"):
+			end = len(sql)
+			if newline := strings.IndexByte(sql[i:], '\n'); newline >= 0 {
+				end = i + newline
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end = blockCommentEnd(sql, i)
+		case c == '\'' || c == '"':
+			// E'...' strings escape quotes with backslashes
+			escapes := c == '\'' && i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i == 1 || !isIdentifierChar(sql[i-2]))
+			end = quotedEnd(sql, i, c, escapes)
+		case c == '$' && (i == 0 || !isIdentifierChar(sql[i-1])):
+			if tag := dollarQuoteTag.FindString(sql[i:]); tag != "" {
+				end = len(sql)
+				if close := strings.Index(sql[i+len(tag):], tag); close >= 0 {
+					end = i + len(tag) + close + len(tag)
+				}
+			}
+		}
+		current.WriteString(sql[i:end])
+		i = end
+	}
+	flush()
+	return statements
+}
+
+// blockCommentEnd returns the index after the (possibly nested) block comment starting at i
+func blockCommentEnd(sql string, i int) int {
+	depth := 0
+	for j := i; j < len(sql)-1; j++ {
+		switch sql[j : j+2] {
+		case "/*":
+			depth++
+			j++
+		case "*/":
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+// quotedEnd returns the index after the quoted string or identifier starting at i, doubled quotes are escapes
+func quotedEnd(sql string, i int, quote byte, backslashEscapes bool) int {
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case backslashEscapes && sql[j] == '\\':
+			j++
+		case sql[j] == quote:
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(sql)
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
+
+// stripLeadingComments removes whitespace and comments before a statement
+func stripLeadingComments(sql string) string {
+	for {
+		sql = strings.TrimLeft(sql, " \t\r\n")
+		switch {
+		case strings.HasPrefix(sql, "--"):
+			newline := strings.IndexByte(sql, '\n')
+			if newline < 0 {
+				return ""
+			}
+			sql = sql[newline+1:]
+		case strings.HasPrefix(sql, "/*"):
+			sql = sql[blockCommentEnd(sql, 0):]
+		default:
+			return sql
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package pgclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{name: "statements", sql: "CREATE TABLE a (id int);\nALTER TABLE a ADD COLUMN b text;", want: []string{"CREATE TABLE a (id int)", "ALTER TABLE a ADD COLUMN b text"}},
+		{name: "no trailing semicolon", sql: "SELECT 1; SELECT 2", want: []string{"SELECT 1", "SELECT 2"}},
+		{name: "comments", sql: "-- migrate up; not a statement\n/* a /* nested; */ comment */ SELECT 1; -- trailing;\n", want: []string{"SELECT 1"}},
+		{name: "quoted", sql: `INSERT INTO a VALUES ('x;''y'), (E'\';'); SELECT "a;b" FROM a`, want: []string{`INSERT INTO a VALUES ('x;''y'), (E'\';')`, `SELECT "a;b" FROM a`}},
+		{name: "dollar quoted", sql: "CREATE FUNCTION f() RETURNS int AS $fn$ BEGIN RETURN 1; END $fn$ LANGUAGE plpgsql; DO $$ BEGIN NULL; END $$", want: []string{"CREATE FUNCTION f() RETURNS int AS $fn$ BEGIN RETURN 1; END $fn$ LANGUAGE plpgsql", "DO $$ BEGIN NULL; END $$"}},
+		{name: "parameter", sql: "PREPARE p AS SELECT $1; EXECUTE p(1)", want: []string{"PREPARE p AS SELECT $1", "EXECUTE p(1)"}},
+		{name: "empty", sql: " ;\n-- nothing\n", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitStatements(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
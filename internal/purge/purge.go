@@ -0,0 +1,157 @@
+package purge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+// KeyColumn is a column identifying the data subject of a row, e.g. public.orders.user_id
+type KeyColumn struct {
+	Table  string
+	Column string
+}
+
+func (k KeyColumn) String() string {
+	return k.Table + "." + k.Column
+}
+
+// Params identifies the database a purge runs against
+type Params struct {
+	DatabaseName string
+	PostgresPort int
+}
+
+// Result reports the rows a purge deleted from one database
+type Result struct {
+	Tables  []models.PurgeTableResult
+	Missing []string // Key tables that don't exist in this database (e.g. excluded from the restore)
+	Rows    int
+}
+
+// ParseKeyColumns parses Config.PurgeKeyColumns: comma-separated table.column entries,
+// e.g. "public.orders.user_id,public.users.id" (the last dot separates the column)
+func ParseKeyColumns(value string) ([]KeyColumn, error) {
+	var keys []KeyColumn
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		dot := strings.LastIndex(entry, ".")
+		if dot <= 0 || dot == len(entry)-1 {
+			return nil, fmt.Errorf("invalid purge key column %q, expected table.column", entry)
+		}
+		if seen[entry] {
+			return nil, fmt.Errorf("purge key column %s is listed twice", entry)
+		}
+		seen[entry] = true
+
+		keys = append(keys, KeyColumn{Table: entry[:dot], Column: entry[dot+1:]})
+	}
+	return keys, nil
+}
+
+// HashSubject returns the SHA-256 of a subject identifier, recorded instead of the identifier itself
+func HashSubject(subjectID string) string {
+	sum := sha256.Sum256([]byte(subjectID))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateStatements renders one DELETE per key column
+// Key columns are deleted in the configured order, so referencing tables must be listed first
+// (unless their foreign keys cascade). Values are compared as text, so any key type works
+func GenerateStatements(keys []KeyColumn, subjectID string) []string {
+	statements := make([]string, len(keys))
+	for i, key := range keys {
+		statements[i] = fmt.Sprintf(
+			"DELETE FROM %s WHERE %s::text = %s",
+			pgclient.QuoteTable(key.Table),
+			pgclient.QuoteIdentifier(key.Column),
+			pgclient.QuoteLiteral(subjectID),
+		)
+	}
+	return statements
+}
+
+// Apply deletes the subject's rows from a database, in a single transaction
+func Apply(ctx context.Context, keys []KeyColumn, subjectID string, params Params, logger zerolog.Logger) (*Result, error) {
+	client, err := pgclient.OpenLocal(ctx, params.PostgresPort, params.DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	existing, err := queryExistingTables(ctx, client, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	var present []KeyColumn
+	for _, key := range keys {
+		if existing[key.Table] {
+			present = append(present, key)
+		} else {
+			result.Missing = append(result.Missing, key.Table)
+		}
+	}
+	if len(present) == 0 {
+		return result, nil
+	}
+
+	results, err := client.ExecTransaction(ctx, GenerateStatements(present, subjectID))
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("database_name", params.DatabaseName).
+			Int("port", params.PostgresPort).
+			Msg("Failed to purge subject rows")
+		return nil, fmt.Errorf("failed to delete rows: %w", err)
+	}
+
+	for i, key := range present {
+		count := int(results[i].RowsAffected)
+		result.Tables = append(result.Tables, models.PurgeTableResult{Table: key.Table, Column: key.Column, Rows: count})
+		result.Rows += count
+	}
+	return result, nil
+}
+
+// queryExistingTables returns which key tables exist, resolved with the database's search_path
+func queryExistingTables(ctx context.Context, client *pgclient.Client, keys []KeyColumn) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	for _, key := range keys {
+		if existing[key.Table] {
+			continue
+		}
+		rows, err := client.Query(ctx,
+			"SELECT to_regclass(array_to_string(ARRAY(SELECT quote_ident(p) FROM unnest(string_to_array($1, '.')) AS p), '.')) IS NOT NULL",
+			key.Table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query tables: %w", err)
+		}
+		var found bool
+		if rows.Next() {
+			err = rows.Scan(&found)
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to query tables: %w", err)
+		}
+		existing[key.Table] = found
+	}
+	return existing, nil
+}
@@ -0,0 +1,46 @@
+package purge
+
+import "testing"
+
+func TestParseKeyColumns(t *testing.T) {
+	keys, err := ParseKeyColumns(" public.orders.user_id, users.id ,")
+	if err != nil {
+		t.Fatalf("ParseKeyColumns() error = %v", err)
+	}
+	want := []KeyColumn{{Table: "public.orders", Column: "user_id"}, {Table: "users", Column: "id"}}
+	if len(keys) != len(want) {
+		t.Fatalf("ParseKeyColumns() = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("key %d = %v, want %v", i, keys[i], want[i])
+		}
+	}
+
+	for _, invalid := range []string{"users", "users.", ".id", "users.id,users.id"} {
+		if _, err := ParseKeyColumns(invalid); err == nil {
+			t.Errorf("ParseKeyColumns(%q) expected error", invalid)
+		}
+	}
+}
+
+func TestGenerateStatements(t *testing.T) {
+	statements := GenerateStatements([]KeyColumn{
+		{Table: "public.orders", Column: "user_id"},
+		{Table: "public.users", Column: "id"},
+	}, "42' OR '1'='1")
+
+	// Referencing tables first, in the configured order
+	want := []string{
+		`DELETE FROM "public"."orders" WHERE "user_id"::text = '42'' OR ''1''=''1'`,
+		`DELETE FROM "public"."users" WHERE "id"::text = '42'' OR ''1''=''1'`,
+	}
+	if len(statements) != len(want) {
+		t.Fatalf("GenerateStatements() = %q, want %q", statements, want)
+	}
+	for i := range want {
+		if statements[i] != want[i] {
+			t.Errorf("statement %d = %q, want %q", i, statements[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dataset is a ZFS dataset and where it's mounted
+type dataset struct {
+	name       string
+	mountpoint string
+}
+
+// postmaster is a PostgreSQL server process and its data directory
+type postmaster struct {
+	pid     int
+	dataDir string
+}
+
+// listener is a PostgreSQL process listening on a TCP port
+type listener struct {
+	port int
+	pid  int
+}
+
+// Readers of the host's resources, replaced in tests
+var (
+	// listDatasets returns root and its child datasets
+	listDatasets = func(ctx context.Context, root string) ([]dataset, error) {
+		output, err := exec.CommandContext(ctx, "sudo", "zfs", "list", "-H", "-o", "name,mountpoint", "-d", "1", root).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("%s", strings.TrimSpace(string(output)))
+		}
+		return parseDatasets(string(output)), nil
+	}
+
+	// listUnits returns the unit files of branch and restore clusters
+	listUnits = func(ctx context.Context) ([]string, error) {
+		output, err := exec.CommandContext(ctx, "systemctl", "list-unit-files", "--no-legend", "--plain",
+			branchUnitPrefix+"*", restoreUnitPrefix+"*").Output()
+		if err != nil {
+			return nil, err
+		}
+		return parseUnits(string(output)), nil
+	}
+
+	// listPostmasters returns the running PostgreSQL servers
+	listPostmasters = func(ctx context.Context) ([]postmaster, error) {
+		output, err := exec.CommandContext(ctx, "ps", "-eo", "pid=,args=").Output()
+		if err != nil {
+			return nil, err
+		}
+		return parsePostmasters(string(output)), nil
+	}
+
+	// listListeners returns the TCP ports PostgreSQL processes listen on
+	listListeners = func(ctx context.Context) ([]listener, error) {
+		output, err := exec.CommandContext(ctx, "sudo", "ss", "-ltnpH").CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("%s", strings.TrimSpace(string(output)))
+		}
+		return parseListeners(string(output)), nil
+	}
+
+	// listFirewallPorts returns the TCP ports ufw allows
+	listFirewallPorts = func(ctx context.Context) ([]int, error) {
+		output, err := exec.CommandContext(ctx, "sudo", "ufw", "status").CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("%s", strings.TrimSpace(string(output)))
+		}
+		return parseFirewallPorts(string(output)), nil
+	}
+)
+
+// Cleanups of orphans, taking the orphan's name, replaced in tests
+var (
+	// removeUnit stops, disables and deletes a unit and its drop-ins (as destroy-branch.sh does)
+	removeUnit = func(ctx context.Context, unit string) error {
+		_ = exec.CommandContext(ctx, "sudo", "systemctl", "disable", "--now", unit).Run()
+		if output, err := exec.CommandContext(ctx, "sudo", "rm", "-rf", "/etc/systemd/system/"+unit, "/etc/systemd/system/"+unit+".d").CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to remove unit file: %s", strings.TrimSpace(string(output)))
+		}
+		if output, err := exec.CommandContext(ctx, "sudo", "systemctl", "daemon-reload").CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to reload systemd: %s", strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	// stopProcess shuts a postmaster down (fast shutdown: clients are disconnected, nothing is waited for)
+	stopProcess = func(ctx context.Context, pid string) error {
+		if output, err := exec.CommandContext(ctx, "sudo", "kill", "-INT", pid).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to stop process: %s", strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	// closePort deletes the ufw rules of a port, highest rule number first so the others keep theirs
+	closePort = func(ctx context.Context, port string) error {
+		output, err := exec.CommandContext(ctx, "sudo", "ufw", "status", "numbered").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to list firewall rules: %s", strings.TrimSpace(string(output)))
+		}
+		numbers := parseRuleNumbers(string(output), port)
+		for i := len(numbers) - 1; i >= 0; i-- {
+			if output, err := exec.CommandContext(ctx, "sudo", "ufw", "--force", "delete", strconv.Itoa(numbers[i])).CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to delete firewall rule %d: %s", numbers[i], strings.TrimSpace(string(output)))
+			}
+		}
+		return nil
+	}
+
+	// destroyDataset destroys a dataset and the snapshot it was cloned from, which only the clone used
+	destroyDataset = func(ctx context.Context, name string) error {
+		origin, _ := exec.CommandContext(ctx, "sudo", "zfs", "get", "-H", "-o", "value", "origin", name).Output()
+		if output, err := exec.CommandContext(ctx, "sudo", "zfs", "destroy", "-r", name).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to destroy dataset: %s", strings.TrimSpace(string(output)))
+		}
+		if snapshot := strings.TrimSpace(string(origin)); snapshot != "" && snapshot != "-" {
+			if output, err := exec.CommandContext(ctx, "sudo", "zfs", "destroy", snapshot).CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to destroy origin snapshot %s: %s", snapshot, strings.TrimSpace(string(output)))
+			}
+		}
+		return nil
+	}
+)
+
+// parseDatasets parses `zfs list -H -o name,mountpoint`
+func parseDatasets(output string) []dataset {
+	var datasets []dataset
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			continue
+		}
+		datasets = append(datasets, dataset{name: fields[0], mountpoint: fields[1]})
+	}
+	return datasets
+}
+
+// parseUnits parses `systemctl list-unit-files --no-legend --plain`
+func parseUnits(output string) []string {
+	var units []string
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			units = append(units, fields[0])
+		}
+	}
+	return units
+}
+
+// parsePostmasters parses `ps -eo pid=,args=`, postmasters are started as `postgres -D <data directory>` by pg_ctl
+// Their backends are renamed ("postgres: checkpointer") and don't match
+func parsePostmasters(output string) []postmaster {
+	var postmasters []postmaster
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasSuffix(fields[1], "/postgres") {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		for i := 2; i < len(fields)-1; i++ {
+			if fields[i] == "-D" {
+				postmasters = append(postmasters, postmaster{pid: pid, dataDir: strings.TrimSuffix(fields[i+1], "/")})
+				break
+			}
+		}
+	}
+	return postmasters
+}
+
+// parseListeners parses `ss -ltnpH`, e.g.
+// LISTEN 0 200 0.0.0.0:15433 0.0.0.0:* users:(("postgres",pid=1234,fd=6))
+// A postmaster listening on IPv4 and IPv6 is one listener
+func parseListeners(output string) []listener {
+	seen := map[listener]bool{}
+	var listeners []listener
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || !strings.Contains(fields[5], `"postgres"`) {
+			continue
+		}
+		address := fields[3]
+		port, err := strconv.Atoi(address[strings.LastIndex(address, ":")+1:])
+		if err != nil {
+			continue
+		}
+		_, rest, ok := strings.Cut(fields[5], "pid=")
+		if !ok {
+			continue
+		}
+		pidText, _, _ := strings.Cut(rest, ",")
+		pid, err := strconv.Atoi(pidText)
+		if err != nil {
+			continue
+		}
+		l := listener{port: port, pid: pid}
+		if !seen[l] {
+			seen[l] = true
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners
+}
+
+// parseFirewallPorts parses `ufw status` for the single TCP ports it allows
+func parseFirewallPorts(output string) []int {
+	seen := map[int]bool{}
+	var ports []int
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] != "ALLOW" {
+			continue
+		}
+		port, err := strconv.Atoi(strings.TrimSuffix(fields[0], "/tcp"))
+		if err != nil || !strings.HasSuffix(fields[0], "/tcp") {
+			continue
+		}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// parseRuleNumbers parses `ufw status numbered` for the numbers of the rules allowing port, ascending
+func parseRuleNumbers(output, port string) []int {
+	var numbers []int
+	for _, line := range strings.Split(output, "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "[")
+		if !ok {
+			continue
+		}
+		number, rule, ok := strings.Cut(rest, "]")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rule)
+		if len(fields) == 0 || fields[0] != port+"/tcp" {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(number)); err == nil {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
@@ -0,0 +1,270 @@
+// Package reconcile compares the host's ZFS datasets, systemd units, PostgreSQL processes, listening ports and
+// firewall reservations against the Branch and Restore records, so leftovers of failed scripts are found (and
+// cleaned up) without SSHing into the host
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Kinds of resources (Orphan.Kind)
+const (
+	KindDataset  = "dataset"  // ZFS dataset of a restore or branch (or its WAL)
+	KindUnit     = "unit"     // systemd unit of a restore or branch cluster
+	KindProcess  = "process"  // PostgreSQL postmaster running from a data directory under the mount root
+	KindPort     = "port"     // Port a PostgreSQL process listens on in the branch or restore range
+	KindFirewall = "firewall" // ufw rule reserving a port of the branch range (see create-branch.sh)
+)
+
+// Port ranges of branch clusters (create-branch.sh) and restore clusters (restore.ResourceManager.FindAvailablePort)
+const (
+	branchPortMin  = 15432
+	branchPortMax  = 16432
+	restorePortMin = 50000
+	restorePortMax = 59999
+)
+
+// Unit name prefixes of branch and restore clusters
+const (
+	branchUnitPrefix  = "branchd-branch-"
+	restoreUnitPrefix = "branchd-restore-"
+)
+
+// Orphan is a resource without the restore or branch record it belongs to
+type Orphan struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`             // Dataset, unit, PID or port
+	Owner  string `json:"owner,omitempty"`  // Name of the restore or branch the resource was created for, if known
+	Detail string `json:"detail,omitempty"` // e.g. the mountpoint of a dataset or the data directory of a process
+	Fixed  bool   `json:"fixed"`
+	Error  string `json:"error,omitempty"` // Why it couldn't be cleaned up
+}
+
+// Missing is a restore or branch record whose dataset is gone, deleting it through the API removes the record
+type Missing struct {
+	Kind    string `json:"kind"` // "restore" or "branch"
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Dataset string `json:"dataset"`
+}
+
+// Report lists the resources and records that don't match
+type Report struct {
+	Orphans   []Orphan  `json:"orphans"`
+	Missing   []Missing `json:"missing"`
+	Errors    []string  `json:"errors"` // Resources that couldn't be listed, they're not compared
+	Fix       bool      `json:"fix"`    // Orphans were cleaned up
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Run compares the host's resources against the records, cleaning orphans up if fix is set
+// Names of branches still being created (models.BranchOperation) and of scheduled branches are known, their
+// records are written after their resources
+func Run(ctx context.Context, db *gorm.DB, cfg *config.Config, fix bool, logger zerolog.Logger) (*Report, error) {
+	report := &Report{Orphans: []Orphan{}, Missing: []Missing{}, Errors: []string{}, Fix: fix, CheckedAt: time.Now()}
+
+	var restoreList []models.Restore
+	if err := db.Find(&restoreList).Error; err != nil {
+		return nil, fmt.Errorf("failed to load restores: %w", err)
+	}
+	var branchList []models.Branch
+	if err := db.Find(&branchList).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branches: %w", err)
+	}
+	var schedules []models.BranchSchedule
+	if err := db.Find(&schedules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branch schedules: %w", err)
+	}
+	var operations []models.BranchOperation
+	if err := db.Where("created_at > ?", time.Now().Add(-models.BranchOperationTTL)).Find(&operations).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branch operations: %w", err)
+	}
+
+	restoreNames := map[string]bool{}
+	branchNames := map[string]bool{}
+	ports := map[int]bool{}
+	for _, restore := range restoreList {
+		restoreNames[restore.Name] = true
+		ports[restore.Port] = true
+	}
+	for _, branch := range branchList {
+		branchNames[branch.Name] = true
+		ports[branch.Port] = true
+	}
+	// Scheduled branches are deleted before they're recreated
+	for _, schedule := range schedules {
+		branchNames[schedule.BranchName] = true
+	}
+	for _, op := range operations {
+		branchNames[op.BranchName] = true
+	}
+	known := func(name string) bool { return restoreNames[name] || branchNames[name] }
+
+	storage := cfg.Storage
+	roots := [][2]string{{storage.DatasetRoot, storage.MountRoot}}
+	if storage.SeparateWAL() {
+		roots = append(roots, [2]string{storage.WALDatasetRoot, storage.WALMountRoot})
+	}
+	var datasetOrphans []Orphan
+	datasets := map[string]bool{}
+	datasetsListed := true
+	for _, root := range roots {
+		list, err := listDatasets(ctx, root[0])
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("list datasets under %s: %v", root[0], err))
+			datasetsListed = false
+			continue
+		}
+		for _, ds := range list {
+			owner, ok := childName(ds.mountpoint, root[1])
+			if ds.name == root[0] || !ok {
+				continue
+			}
+			datasets[ds.name] = true
+			if !known(owner) {
+				datasetOrphans = append(datasetOrphans, Orphan{Kind: KindDataset, Name: ds.name, Owner: owner, Detail: ds.mountpoint})
+			}
+		}
+	}
+	if datasetsListed {
+		for _, restore := range restoreList {
+			if restore.State == models.RestoreStateReady && !datasets[storage.DatasetName(restore.Name)] {
+				report.Missing = append(report.Missing, Missing{Kind: "restore", ID: restore.ID, Name: restore.Name, Dataset: storage.DatasetName(restore.Name)})
+			}
+		}
+		for _, branch := range branchList {
+			if branch.Port > 0 && !datasets[storage.DatasetName(branch.Name)] {
+				report.Missing = append(report.Missing, Missing{Kind: "branch", ID: branch.ID, Name: branch.Name, Dataset: storage.DatasetName(branch.Name)})
+			}
+		}
+	}
+
+	// Units first, a unit left enabled would start its postmaster again
+	if units, err := listUnits(ctx); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("list units: %v", err))
+	} else {
+		for _, unit := range units {
+			name := strings.TrimSuffix(unit, ".service")
+			if owner, ok := strings.CutPrefix(name, branchUnitPrefix); ok && !branchNames[owner] {
+				report.Orphans = append(report.Orphans, fixOrphan(ctx, fix, Orphan{Kind: KindUnit, Name: unit, Owner: owner}, removeUnit))
+			} else if owner, ok := strings.CutPrefix(name, restoreUnitPrefix); ok && !restoreNames[owner] {
+				report.Orphans = append(report.Orphans, fixOrphan(ctx, fix, Orphan{Kind: KindUnit, Name: unit, Owner: owner}, removeUnit))
+			}
+		}
+	}
+
+	stopped := map[int]bool{}
+	if postmasters, err := listPostmasters(ctx); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("list processes: %v", err))
+	} else {
+		for _, p := range postmasters {
+			owner, ok := childName(p.dataDir, storage.MountRoot)
+			if !ok || known(owner) {
+				continue
+			}
+			orphan := fixOrphan(ctx, fix, Orphan{Kind: KindProcess, Name: strconv.Itoa(p.pid), Owner: owner, Detail: p.dataDir}, stopProcess)
+			stopped[p.pid] = orphan.Fixed
+			report.Orphans = append(report.Orphans, orphan)
+		}
+	}
+
+	// Ports are reserved before the branch being created is recorded
+	if len(operations) == 0 {
+		if listeners, err := listListeners(ctx); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("list listening ports: %v", err))
+		} else {
+			for _, l := range listeners {
+				if ports[l.port] || !clusterPort(l.port) {
+					continue
+				}
+				orphan := Orphan{Kind: KindPort, Name: strconv.Itoa(l.port), Detail: fmt.Sprintf("postgres pid %d", l.pid)}
+				if fixed, ok := stopped[l.pid]; ok {
+					// Stopped (or not) as an orphaned process
+					orphan.Fixed = fixed
+				} else {
+					pid := strconv.Itoa(l.pid)
+					orphan = fixOrphan(ctx, fix, orphan, func(ctx context.Context, port string) error { return stopProcess(ctx, pid) })
+					stopped[l.pid] = orphan.Fixed
+				}
+				report.Orphans = append(report.Orphans, orphan)
+			}
+		}
+
+		if reserved, err := listFirewallPorts(ctx); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("list firewall rules: %v", err))
+		} else {
+			for _, port := range reserved {
+				if ports[port] || port < branchPortMin || port > branchPortMax {
+					continue
+				}
+				report.Orphans = append(report.Orphans, fixOrphan(ctx, fix, Orphan{Kind: KindFirewall, Name: strconv.Itoa(port)}, closePort))
+			}
+		}
+	}
+
+	// Datasets last, they can't be destroyed while a postmaster has them open
+	for _, orphan := range datasetOrphans {
+		report.Orphans = append(report.Orphans, fixOrphan(ctx, fix, orphan, destroyDataset))
+	}
+
+	sort.SliceStable(report.Orphans, func(i, j int) bool { return report.Orphans[i].Kind < report.Orphans[j].Kind })
+	if len(report.Orphans) > 0 || len(report.Missing) > 0 {
+		fixed := 0
+		for _, orphan := range report.Orphans {
+			if orphan.Fixed {
+				fixed++
+			}
+		}
+		logger.Warn().
+			Int("orphans", len(report.Orphans)).
+			Int("fixed", fixed).
+			Int("missing", len(report.Missing)).
+			Msg("Resources don't match the restore and branch records")
+	}
+	return report, nil
+}
+
+// fixOrphan cleans an orphan up with fixer if fix is set, recording the outcome
+// Fixers take the orphan's name (the PID of a process, the port of a firewall rule)
+func fixOrphan(ctx context.Context, fix bool, orphan Orphan, fixer func(ctx context.Context, name string) error) Orphan {
+	if !fix {
+		return orphan
+	}
+	if err := fixer(ctx, orphan.Name); err != nil {
+		orphan.Error = err.Error()
+		return orphan
+	}
+	orphan.Fixed = true
+	return orphan
+}
+
+// childName returns the first path segment of path under root, e.g. "feature-x" for /opt/branchd/feature-x/main
+func childName(path, root string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, root+"/")
+	if !ok {
+		return "", false
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	// Restore and branch names can't contain a dot, which keeps directories such as the export directory
+	// (see config.StorageConfig.ExportDir) and migration check copies (<branch>.migration-check) apart
+	if name == "" || strings.Contains(name, ".") {
+		return "", false
+	}
+	return name, true
+}
+
+// clusterPort reports whether port is in the range of branch or restore clusters
+func clusterPort(port int) bool {
+	return (port >= branchPortMin && port <= branchPortMax) || (port >= restorePortMin && port <= restorePortMax)
+}
@@ -0,0 +1,238 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// In-memory databases exist per connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	return db
+}
+
+// stubHost reports the given resources and records cleanups for the test's duration
+func stubHost(t *testing.T, datasets []dataset, units []string, postmasters []postmaster, listeners []listener, firewallPorts []int) *[]string {
+	t.Helper()
+	originals := []any{listDatasets, listUnits, listPostmasters, listListeners, listFirewallPorts, removeUnit, stopProcess, closePort, destroyDataset}
+	t.Cleanup(func() {
+		listDatasets = originals[0].(func(context.Context, string) ([]dataset, error))
+		listUnits = originals[1].(func(context.Context) ([]string, error))
+		listPostmasters = originals[2].(func(context.Context) ([]postmaster, error))
+		listListeners = originals[3].(func(context.Context) ([]listener, error))
+		listFirewallPorts = originals[4].(func(context.Context) ([]int, error))
+		removeUnit = originals[5].(func(context.Context, string) error)
+		stopProcess = originals[6].(func(context.Context, string) error)
+		closePort = originals[7].(func(context.Context, string) error)
+		destroyDataset = originals[8].(func(context.Context, string) error)
+	})
+
+	listDatasets = func(ctx context.Context, root string) ([]dataset, error) { return datasets, nil }
+	listUnits = func(ctx context.Context) ([]string, error) { return units, nil }
+	listPostmasters = func(ctx context.Context) ([]postmaster, error) { return postmasters, nil }
+	listListeners = func(ctx context.Context) ([]listener, error) { return listeners, nil }
+	listFirewallPorts = func(ctx context.Context) ([]int, error) { return firewallPorts, nil }
+
+	var fixed []string
+	fixer := func(kind string) func(context.Context, string) error {
+		return func(ctx context.Context, name string) error {
+			fixed = append(fixed, kind+" "+name)
+			return nil
+		}
+	}
+	removeUnit, stopProcess, closePort, destroyDataset = fixer(KindUnit), fixer(KindProcess), fixer(KindFirewall), fixer(KindDataset)
+	return &fixed
+}
+
+func TestRun(t *testing.T) {
+	db := newTestDB(t)
+	restore := models.Restore{Name: "restore_1", State: models.RestoreStateReady, Port: 50001}
+	if err := db.Create(&restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	for _, branch := range []models.Branch{
+		{Name: "feature-x", RestoreID: restore.ID, CreatedByID: "u1", Port: 15433},
+		{Name: "feature-gone", RestoreID: restore.ID, CreatedByID: "u1", Port: 15434},
+	} {
+		if err := db.Create(&branch).Error; err != nil {
+			t.Fatalf("failed to create branch: %v", err)
+		}
+	}
+	cfg := &config.Config{Storage: config.StorageConfig{DatasetRoot: "tank", MountRoot: "/opt/branchd"}}
+
+	fixed := stubHost(t,
+		[]dataset{
+			{name: "tank", mountpoint: "/opt/branchd"},
+			{name: "tank/restore_1", mountpoint: "/opt/branchd/restore_1"},
+			{name: "tank/feature-x", mountpoint: "/opt/branchd/feature-x"},
+			{name: "tank/feature-old", mountpoint: "/opt/branchd/feature-old"},
+			{name: "tank/unrelated", mountpoint: "/srv/unrelated"},
+			{name: "tank/feature-x.migration-check", mountpoint: "/opt/branchd/feature-x.migration-check"},
+		},
+		[]string{"branchd-branch-feature-x.service", "branchd-branch-feature-old.service", "branchd-restore-restore_0.service"},
+		[]postmaster{{pid: 100, dataDir: "/opt/branchd/feature-x/main"}, {pid: 200, dataDir: "/opt/branchd/feature-old/main"},
+			{pid: 250, dataDir: "/opt/branchd/feature-x.migration-check/main"}},
+		[]listener{{port: 15433, pid: 100}, {port: 15440, pid: 200}, {port: 50002, pid: 300}, {port: 5432, pid: 400}},
+		[]int{22, 15433, 15440},
+	)
+
+	report, err := Run(context.Background(), db, cfg, false, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := []Orphan{
+		{Kind: KindDataset, Name: "tank/feature-old", Owner: "feature-old", Detail: "/opt/branchd/feature-old"},
+		{Kind: KindFirewall, Name: "15440"},
+		{Kind: KindPort, Name: "15440", Detail: "postgres pid 200"},
+		{Kind: KindPort, Name: "50002", Detail: "postgres pid 300"},
+		{Kind: KindProcess, Name: "200", Owner: "feature-old", Detail: "/opt/branchd/feature-old/main"},
+		{Kind: KindUnit, Name: "branchd-branch-feature-old.service", Owner: "feature-old"},
+		{Kind: KindUnit, Name: "branchd-restore-restore_0.service", Owner: "restore_0"},
+	}
+	if !reflect.DeepEqual(report.Orphans, want) {
+		t.Errorf("orphans = %+v\nwant %+v", report.Orphans, want)
+	}
+	if len(report.Missing) != 1 || report.Missing[0].Name != "feature-gone" || report.Missing[0].Dataset != "tank/feature-gone" {
+		t.Errorf("missing = %+v, want feature-gone", report.Missing)
+	}
+	if len(*fixed) != 0 {
+		t.Errorf("fixed = %v, want nothing cleaned up without fix", *fixed)
+	}
+
+	report, err = Run(context.Background(), db, cfg, true, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// Units before processes, datasets last; pid 200 is stopped once
+	wantFixed := []string{
+		"unit branchd-branch-feature-old.service", "unit branchd-restore-restore_0.service",
+		"process 200", "process 300", "firewall 15440", "dataset tank/feature-old",
+	}
+	if !reflect.DeepEqual(*fixed, wantFixed) {
+		t.Errorf("fixed = %v, want %v", *fixed, wantFixed)
+	}
+	for _, orphan := range report.Orphans {
+		if !orphan.Fixed {
+			t.Errorf("orphan %+v not fixed", orphan)
+		}
+	}
+}
+
+func TestRunSkipsBranchesBeingCreated(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Create(&models.BranchOperation{BranchName: "feature-new", Operation: "create", CreatedByID: "u1"}).Error; err != nil {
+		t.Fatalf("failed to create branch operation: %v", err)
+	}
+	cfg := &config.Config{Storage: config.StorageConfig{DatasetRoot: "tank", MountRoot: "/opt/branchd"}}
+	stubHost(t,
+		[]dataset{{name: "tank/feature-new", mountpoint: "/opt/branchd/feature-new"}},
+		[]string{"branchd-branch-feature-new.service"},
+		[]postmaster{{pid: 100, dataDir: "/opt/branchd/feature-new/main"}},
+		[]listener{{port: 15433, pid: 100}},
+		[]int{15433},
+	)
+
+	report, err := Run(context.Background(), db, cfg, true, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(report.Orphans) != 0 {
+		t.Errorf("orphans = %+v, want the branch being created left alone", report.Orphans)
+	}
+}
+
+func TestRunReportsUnlistedResources(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &config.Config{Storage: config.StorageConfig{DatasetRoot: "tank", MountRoot: "/opt/branchd"}}
+	stubHost(t, nil, nil, nil, nil, nil)
+	listDatasets = func(ctx context.Context, root string) ([]dataset, error) {
+		return nil, errors.New("cannot open 'tank': dataset does not exist")
+	}
+
+	report, err := Run(context.Background(), db, cfg, false, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(report.Errors) != 1 || len(report.Missing) != 0 {
+		t.Errorf("report = %+v, want the listing error and no missing datasets", report)
+	}
+}
+
+func TestParseHostOutput(t *testing.T) {
+	if got := parseDatasets("tank\t/opt/branchd\ntank/feature-x\t/opt/branchd/feature-x\n"); !reflect.DeepEqual(got, []dataset{
+		{name: "tank", mountpoint: "/opt/branchd"}, {name: "tank/feature-x", mountpoint: "/opt/branchd/feature-x"},
+	}) {
+		t.Errorf("parseDatasets() = %+v", got)
+	}
+
+	if got := parseUnits("branchd-branch-feature-x.service enabled enabled\nbranchd-restore-restore_1.service disabled enabled\n"); !reflect.DeepEqual(got,
+		[]string{"branchd-branch-feature-x.service", "branchd-restore-restore_1.service"}) {
+		t.Errorf("parseUnits() = %v", got)
+	}
+
+	ps := `    1 /sbin/init
+  100 /usr/lib/postgresql/16/bin/postgres -D /opt/branchd/feature-x/main
+  101 postgres: checkpointer
+  200 /usr/lib/postgresql/17/bin/postgres -D /opt/branchd/restore_1/data/ -c config_file=/etc/postgresql.conf
+`
+	if got := parsePostmasters(ps); !reflect.DeepEqual(got, []postmaster{
+		{pid: 100, dataDir: "/opt/branchd/feature-x/main"}, {pid: 200, dataDir: "/opt/branchd/restore_1/data"},
+	}) {
+		t.Errorf("parsePostmasters() = %+v", got)
+	}
+
+	ss := `LISTEN 0      200          0.0.0.0:15433      0.0.0.0:*    users:(("postgres",pid=100,fd=6))
+LISTEN 0      200             [::]:15433         [::]:*    users:(("postgres",pid=100,fd=7))
+LISTEN 0      4096   127.0.0.1:8080      0.0.0.0:*    users:(("branchd-server",pid=50,fd=3))
+`
+	if got := parseListeners(ss); !reflect.DeepEqual(got, []listener{{port: 15433, pid: 100}}) {
+		t.Errorf("parseListeners() = %+v", got)
+	}
+
+	ufw := `Status: active
+
+To                         Action      From
+--                         ------      ----
+22/tcp                     ALLOW       Anywhere
+15440/tcp                  ALLOW       10.0.0.0/8
+15433/tcp                  ALLOW       Anywhere
+15433/tcp (v6)             ALLOW       Anywhere (v6)
+`
+	if got := parseFirewallPorts(ufw); !reflect.DeepEqual(got, []int{22, 15433, 15440}) {
+		t.Errorf("parseFirewallPorts() = %v", got)
+	}
+
+	numbered := `Status: active
+
+     To                         Action      From
+     --                         ------      ----
+[ 1] 22/tcp                     ALLOW IN    Anywhere
+[ 2] 15433/tcp                  ALLOW IN    Anywhere
+[10] 15433/tcp (v6)             ALLOW IN    Anywhere (v6)
+`
+	if got := parseRuleNumbers(numbered, "15433"); !reflect.DeepEqual(got, []int{2, 10}) {
+		t.Errorf("parseRuleNumbers() = %v", got)
+	}
+}
@@ -0,0 +1,139 @@
+package restore
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+//go:embed adopt_cluster.sh
+var adoptClusterScript string
+
+type adoptClusterParams struct {
+	PgVersion          string `env:"PG_VERSION"`
+	SourceDir          string `env:"SOURCE_DIR"`
+	RestoreName        string `env:"RESTORE_NAME"`
+	PgPort             int    `env:"PG_PORT"`
+	DatabaseName       string `env:"DATABASE_NAME"`
+	ZFSDataset         string `env:"ZFS_DATASET"`
+	DataDir            string `env:"DATA_DIR"`
+	WALDataset         string `env:"WAL_DATASET"`
+	WALDir             string `env:"WAL_DIR"`
+	PriorityDirectives string `env:"PRIORITY_DIRECTIVES"`
+}
+
+// Adopt copies the stopped local cluster in restore.AdoptedFrom into the restore's datasets and starts it
+// The source directory is only read, the copy then goes through Complete like any other restore
+// (extensions, post-restore SQL, anonymization), so branches never see unanonymized data
+func (o *Orchestrator) Adopt(ctx context.Context, restoreID string) error {
+	var restore models.Restore
+	if err := o.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
+		return fmt.Errorf("failed to load restore: %w", err)
+	}
+	if restore.AdoptedFrom == "" {
+		return fmt.Errorf("restore %s has no cluster to adopt", restore.Name)
+	}
+
+	if restore.State == models.RestoreStatePending {
+		if err := o.MarkStarted(ctx, restore.ID); err != nil {
+			return err
+		}
+	}
+
+	var config models.Config
+	if err := o.db.First(&config).Error; err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// The copy takes the source's size on the data pool
+	sourceBytes, err := directorySize(ctx, restore.AdoptedFrom)
+	if err != nil {
+		o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to get cluster size, skipping space estimate")
+	}
+	if err := o.checkDiskSpace(ctx, &restore, sourceBytes); err != nil {
+		return err
+	}
+
+	pgPort, err := o.resources.FindAvailablePort(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find available port: %w", err)
+	}
+	if err := o.db.Model(&restore).Updates(map[string]interface{}{
+		"port":             pgPort,
+		"postgres_version": config.ClusterPostgresVersion(),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to store port in database: %w", err)
+	}
+
+	databaseName := config.DatabaseName
+	if config.CrunchyBridgeAPIKey != "" {
+		databaseName = config.CrunchyBridgeDatabaseName
+	}
+
+	scriptParams := adoptClusterParams{
+		PgVersion:          config.ClusterPostgresVersion(),
+		SourceDir:          restore.AdoptedFrom,
+		RestoreName:        restore.Name,
+		PgPort:             pgPort,
+		DatabaseName:       databaseName,
+		ZFSDataset:         o.resources.GetZFSDatasetName(restore.Name),
+		DataDir:            o.resources.GetDataDirectory(restore.Name),
+		WALDataset:         o.resources.GetWALDatasetName(restore.Name),
+		WALDir:             o.resources.GetWALDirectory(restore.Name),
+		PriorityDirectives: priorityDirectives(o.priority),
+	}
+
+	o.logger.Info().
+		Str("restore_id", restore.ID).
+		Str("restore_name", restore.Name).
+		Str("source_dir", restore.AdoptedFrom).
+		Int("port", pgPort).
+		Msg("Adopting existing cluster")
+
+	cmd := shellexec.Command(ctx, adoptClusterScript, scriptParams)
+	outputBytes, err := cmd.CombinedOutput()
+	output := string(outputBytes)
+	if err != nil {
+		o.logger.Error().
+			Err(err).
+			Str("restore_id", restore.ID).
+			Str("output", output).
+			Msg("Failed to adopt cluster")
+		return fmt.Errorf("failed to adopt cluster: %s", cloneErrorMessage(output, err))
+	}
+
+	return o.Complete(ctx, restore.ID)
+}
+
+// MarkStarted takes a restore out of the queue without starting a restore process
+// Adoptions hold their restore slot from then on, see QueueState
+// A retried start finds the restore restoring already
+func (o *Orchestrator) MarkStarted(ctx context.Context, restoreID string) error {
+	var restore models.Restore
+	if err := o.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
+		return fmt.Errorf("failed to load restore: %w", err)
+	}
+	if restore.State != models.RestoreStatePending {
+		return nil
+	}
+	return Transition(o.db, &restore, models.RestoreStateRestoring, nil)
+}
+
+// directorySize returns the size of a directory in bytes
+func directorySize(ctx context.Context, dir string) (int64, error) {
+	output, err := exec.CommandContext(ctx, "sudo", "du", "-sb", dir).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size of %s: %w", dir, err)
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected du output for %s", dir)
+	}
+	return strconv.ParseInt(fields[0], 10, 64)
+}
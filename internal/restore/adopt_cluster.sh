@@ -0,0 +1,208 @@
+#!/bin/bash
+# Cluster adoption script for Branchd - copies an existing, stopped local PostgreSQL cluster into a restore
+set -euo pipefail
+
+# Parameters, passed in the environment (never rendered into the script)
+readonly PG_VERSION="${PG_VERSION}"
+readonly SOURCE_DIR="${SOURCE_DIR}"       # e.g., /var/lib/postgresql/16/main
+readonly RESTORE_NAME="${RESTORE_NAME}"   # e.g., restore_20250916093000
+readonly PG_PORT="${PG_PORT}"
+readonly DATABASE_NAME="${DATABASE_NAME}" # Must exist in the adopted cluster
+readonly ZFS_DATASET="${ZFS_DATASET}"     # e.g., tank/restore_20250916093000
+readonly DATA_DIR="${DATA_DIR}"           # e.g., /opt/branchd/restore_20250916093000/data
+readonly WAL_DATASET="${WAL_DATASET}"     # e.g., nvme/wal/restore_20250916093000 (empty = pg_wal inside DATA_DIR)
+readonly WAL_DIR="${WAL_DIR}"             # e.g., /opt/branchd-wal/restore_20250916093000/pg_wal
+readonly PRIORITY_DIRECTIVES="${PRIORITY_DIRECTIVES}" # systemd [Service] priority directives of the cluster unit
+
+# Paths
+readonly PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
+readonly MOUNTPOINT=$(dirname "${DATA_DIR}")  # /opt/branchd/restore_YYYYMMDDHHMMSS
+readonly SERVICE_NAME="branchd-restore-${RESTORE_NAME}"
+
+# Helper functions
+log() {
+    echo "$(date '+%Y-%m-%d %H:%M:%S') - $1"
+}
+
+die() {
+    log "ERROR: $1" >&2
+
+    # Stop and remove systemd service if it was created
+    if [ -f "/etc/systemd/system/${SERVICE_NAME}.service" ]; then
+        log "Removing systemd service..."
+        sudo systemctl stop "${SERVICE_NAME}" 2>/dev/null || true
+        sudo systemctl disable "${SERVICE_NAME}" 2>/dev/null || true
+        sudo rm -f "/etc/systemd/system/${SERVICE_NAME}.service"
+        sudo systemctl daemon-reload
+    fi
+
+    # Destroy the datasets of the copy, the source directory is never modified
+    if [ "${DATASET_CREATED:-false}" = "true" ] && sudo zfs list "${ZFS_DATASET}" >/dev/null 2>&1; then
+        log "Destroying ZFS dataset..."
+        sudo zfs destroy -r "${ZFS_DATASET}" 2>/dev/null || log "Warning: Could not destroy ZFS dataset"
+    fi
+    if [ "${WAL_DATASET_CREATED:-false}" = "true" ] && sudo zfs list "${WAL_DATASET}" >/dev/null 2>&1; then
+        log "Destroying WAL dataset..."
+        sudo zfs destroy -r "${WAL_DATASET}" 2>/dev/null || log "Warning: Could not destroy WAL dataset"
+    fi
+
+    echo "BRANCHD_ERROR: $1"
+    exit 1
+}
+
+log "Adopting ${SOURCE_DIR} as ${RESTORE_NAME} (port ${PG_PORT})"
+
+# 1. Verify the source is a stopped cluster of the configured PostgreSQL version
+# WHY: Copying the files of a running cluster gives an inconsistent copy
+sudo test -f "${SOURCE_DIR}/PG_VERSION" || die "${SOURCE_DIR} is not a PostgreSQL data directory (no PG_VERSION file)"
+SOURCE_VERSION=$(sudo cat "${SOURCE_DIR}/PG_VERSION")
+if [ "${SOURCE_VERSION}" != "${PG_VERSION}" ]; then
+    die "Cluster in ${SOURCE_DIR} is PostgreSQL ${SOURCE_VERSION}, branchd is configured for PostgreSQL ${PG_VERSION}"
+fi
+if sudo -u postgres ${PG_BIN}/pg_ctl status -D "${SOURCE_DIR}" >/dev/null 2>&1; then
+    die "Cluster in ${SOURCE_DIR} is running, stop it before adopting it"
+fi
+if [ -n "$(sudo ls -A "${SOURCE_DIR}/pg_tblspc" 2>/dev/null)" ]; then
+    die "Cluster in ${SOURCE_DIR} uses tablespaces, which can't be adopted"
+fi
+
+# 2. Create the restore's datasets
+if sudo zfs list "${ZFS_DATASET}" >/dev/null 2>&1; then
+    die "ZFS dataset ${ZFS_DATASET} already exists"
+fi
+sudo zfs create -p -o mountpoint="${MOUNTPOINT}" "${ZFS_DATASET}" || die "Failed to create ZFS dataset"
+DATASET_CREATED=true
+if [ "$(sudo zfs get -H -o value mounted ${ZFS_DATASET})" != "yes" ]; then
+    sudo mkdir -p "${MOUNTPOINT}"
+    sudo zfs mount "${ZFS_DATASET}" || die "Failed to mount ZFS dataset"
+fi
+log "ZFS dataset created and mounted at ${MOUNTPOINT}"
+
+if [ -n "${WAL_DATASET}" ]; then
+    readonly WAL_MOUNTPOINT=$(dirname "${WAL_DIR}")
+    sudo zfs create -p -o mountpoint="${WAL_MOUNTPOINT}" "${WAL_DATASET}" || die "Failed to create WAL dataset"
+    WAL_DATASET_CREATED=true
+    sudo mkdir -p "${WAL_DIR}"
+    sudo chown -R postgres:postgres "${WAL_MOUNTPOINT}"
+    log "WAL dataset created and mounted at ${WAL_MOUNTPOINT}"
+fi
+
+# 3. Copy the data directory (pg_wal separately, the source's may be a symlink to another device)
+log "Copying ${SOURCE_DIR} into ${DATA_DIR}..."
+sudo mkdir -p "${DATA_DIR}"
+sudo rsync -a --exclude=/pg_wal "${SOURCE_DIR}/" "${DATA_DIR}/" || die "Failed to copy data directory"
+
+SOURCE_WAL=$(sudo readlink -f "${SOURCE_DIR}/pg_wal")
+if [ -n "${WAL_DATASET}" ]; then
+    sudo rsync -a "${SOURCE_WAL}/" "${WAL_DIR}/" || die "Failed to copy pg_wal"
+    sudo ln -sfn "${WAL_DIR}" "${DATA_DIR}/pg_wal"
+else
+    sudo mkdir -p "${DATA_DIR}/pg_wal"
+    sudo rsync -a "${SOURCE_WAL}/" "${DATA_DIR}/pg_wal/" || die "Failed to copy pg_wal"
+fi
+log "Data directory copied"
+
+# 4. Replace the source's configuration with a restore cluster's
+# WHY: The source's settings (data_directory, port, replication, hba) belong to its old location
+sudo rm -f "${DATA_DIR}/postmaster.pid" "${DATA_DIR}/postmaster.opts" \
+    "${DATA_DIR}/standby.signal" "${DATA_DIR}/recovery.signal" "${DATA_DIR}/postgresql.auto.conf"
+
+sudo cp /etc/postgresql-common/ssl/server.crt "${DATA_DIR}/"
+sudo cp /etc/postgresql-common/ssl/server.key "${DATA_DIR}/"
+sudo chmod 0600 "${DATA_DIR}/server.key"
+sudo chmod 0644 "${DATA_DIR}/server.crt"
+
+sudo tee "${DATA_DIR}/postgresql.conf" > /dev/null << EOF
+# Basic settings
+port = ${PG_PORT}
+listen_addresses = '127.0.0.1'
+max_connections = 100
+shared_buffers = 128MB
+work_mem = 4MB
+maintenance_work_mem = 64MB
+
+# WAL settings
+wal_level = replica
+max_wal_size = 1GB
+min_wal_size = 80MB
+
+# Logging
+logging_collector = on
+log_directory = 'log'
+log_filename = 'postgresql-%Y-%m-%d_%H%M%S.log'
+log_rotation_age = 1d
+log_rotation_size = 100MB
+log_line_prefix = '%m [%p] %u@%d '
+log_timezone = 'UTC'
+
+# TLS/SSL
+ssl = on
+ssl_cert_file = 'server.crt'
+ssl_key_file = 'server.key'
+
+# Default locale
+datestyle = 'iso, mdy'
+timezone = 'UTC'
+default_text_search_config = 'pg_catalog.english'
+EOF
+
+sudo tee "${DATA_DIR}/pg_hba.conf" > /dev/null << EOF
+# TYPE  DATABASE        USER            ADDRESS                 METHOD
+local   all             all                                     peer
+host    all             all             127.0.0.1/32            scram-sha-256
+host    all             all             ::1/128                 scram-sha-256
+EOF
+
+sudo chown -R postgres:postgres "${MOUNTPOINT}"
+sudo chmod 0700 "${DATA_DIR}"
+
+# 5. Create systemd service for the adopted cluster
+log "Creating systemd service: ${SERVICE_NAME}"
+sudo tee "/etc/systemd/system/${SERVICE_NAME}.service" > /dev/null << EOF
+[Unit]
+Description=PostgreSQL Restore Cluster (${RESTORE_NAME}, adopted)
+After=network.target zfs-mount.service
+Requires=zfs-mount.service
+
+[Service]
+Type=forking
+User=postgres
+Group=postgres
+ExecStart=${PG_BIN}/pg_ctl start -D ${DATA_DIR} -l ${DATA_DIR}/postgresql.log
+ExecStop=${PG_BIN}/pg_ctl stop -D ${DATA_DIR} -m fast
+ExecReload=${PG_BIN}/pg_ctl reload -D ${DATA_DIR}
+KillMode=mixed
+KillSignal=SIGINT
+TimeoutStartSec=300
+TimeoutStopSec=300
+Restart=on-failure
+RestartSec=5s
+${PRIORITY_DIRECTIVES}
+
+[Install]
+WantedBy=multi-user.target
+EOF
+
+sudo systemctl daemon-reload
+
+# 6. Start the adopted cluster (crash recovery of an unclean shutdown happens here)
+sudo systemctl enable "${SERVICE_NAME}"
+sudo systemctl start "${SERVICE_NAME}" || die "Failed to start adopted cluster"
+
+MAX_RETRIES=300
+RETRY_COUNT=0
+while ! sudo -u postgres ${PG_BIN}/pg_isready -p ${PG_PORT} -h 127.0.0.1 >/dev/null 2>&1; do
+    RETRY_COUNT=$((RETRY_COUNT + 1))
+    if [ ${RETRY_COUNT} -ge ${MAX_RETRIES} ]; then
+        die "Adopted cluster not ready after ${MAX_RETRIES} attempts"
+    fi
+    sleep 1
+done
+
+# 7. Branches connect to the configured database
+DATABASE_EXISTS=$(sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -Atc "SELECT 1 FROM pg_database WHERE datname = '${DATABASE_NAME}'")
+if [ "${DATABASE_EXISTS}" != "1" ]; then
+    die "Adopted cluster has no database ${DATABASE_NAME} (the database of the configured connection string)"
+fi
+
+log "Adopted restore cluster running on port ${PG_PORT}"
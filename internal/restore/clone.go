@@ -0,0 +1,135 @@
+package restore
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+//go:embed clone_restore.sh
+var cloneRestoreScript string
+
+type cloneRestoreParams struct {
+	PgVersion          string `env:"PG_VERSION"`
+	SourcePort         int    `env:"SOURCE_PORT"`
+	SourceDataset      string `env:"SOURCE_DATASET"`
+	SourceWALDataset   string `env:"SOURCE_WAL_DATASET"`
+	CloneName          string `env:"CLONE_NAME"`
+	PgPort             int    `env:"PG_PORT"`
+	ZFSDataset         string `env:"ZFS_DATASET"`
+	DataDir            string `env:"DATA_DIR"`
+	WALDataset         string `env:"WAL_DATASET"`
+	WALDir             string `env:"WAL_DIR"`
+	PriorityDirectives string `env:"PRIORITY_DIRECTIVES"`
+}
+
+// CreateClone records an independent restore cloned from a ready restore, RunClone creates it
+// The clone gets its own cluster and port, and is never branched from or cleaned up as stale
+func (o *Orchestrator) CreateClone(ctx context.Context, source *models.Restore) (*models.Restore, error) {
+	var config models.Config
+	if err := o.db.First(&config).Error; err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// The clone shares the source's blocks, only the reserve for its own writes is needed up front
+	if err := o.checkDiskSpace(ctx, source, 0); err != nil {
+		return nil, err
+	}
+
+	pgPort, err := o.resources.FindAvailablePort(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find available port: %w", err)
+	}
+
+	clone := models.Restore{
+		Name:         models.GenerateRestoreName(),
+		SchemaOnly:   source.SchemaOnly,
+		Port:         pgPort,
+		ClonedFromID: source.ID,
+
+		PostgresVersion: source.ClusterPostgresVersion(&config),
+	}
+	if err := o.db.Create(&clone).Error; err != nil {
+		return nil, fmt.Errorf("failed to create restore record: %w", err)
+	}
+	return &clone, nil
+}
+
+// RunClone ZFS-clones the source of a restore recorded by CreateClone and starts its cluster
+func (o *Orchestrator) RunClone(ctx context.Context, cloneID string) error {
+	var clone models.Restore
+	if err := o.db.Where("id = ?", cloneID).First(&clone).Error; err != nil {
+		return fmt.Errorf("failed to load clone: %w", err)
+	}
+	var source models.Restore
+	if err := o.db.Where("id = ?", clone.ClonedFromID).First(&source).Error; err != nil {
+		return fmt.Errorf("failed to load source restore: %w", err)
+	}
+
+	o.logger.Info().
+		Str("restore_id", clone.ID).
+		Str("restore_name", clone.Name).
+		Str("source_restore_id", source.ID).
+		Int("port", clone.Port).
+		Msg("Cloning restore")
+
+	scriptParams := cloneRestoreParams{
+		PgVersion:          clone.PostgresVersion,
+		SourcePort:         source.Port,
+		SourceDataset:      o.resources.GetZFSDatasetName(source.Name),
+		SourceWALDataset:   o.resources.GetWALDatasetName(source.Name),
+		CloneName:          clone.Name,
+		PgPort:             clone.Port,
+		ZFSDataset:         o.resources.GetZFSDatasetName(clone.Name),
+		DataDir:            o.resources.GetDataDirectory(clone.Name),
+		WALDataset:         o.resources.GetWALDatasetName(clone.Name),
+		WALDir:             o.resources.GetWALDirectory(clone.Name),
+		PriorityDirectives: priorityDirectives(o.priority),
+	}
+
+	if err := Transition(o.db, &clone, models.RestoreStateRestoring, nil); err != nil {
+		return fmt.Errorf("failed to mark clone started: %w", err)
+	}
+
+	cmd := shellexec.Command(ctx, cloneRestoreScript, scriptParams)
+	outputBytes, err := cmd.CombinedOutput()
+	output := string(outputBytes)
+	if err != nil {
+		o.logger.Error().
+			Err(err).
+			Str("restore_id", clone.ID).
+			Str("output", output).
+			Msg("Failed to clone restore")
+		return fmt.Errorf("failed to clone restore: %s", cloneErrorMessage(output, err))
+	}
+
+	updates := map[string]interface{}{
+		"schema_ready": source.SchemaReady,
+		"data_ready":   source.DataReady,
+	}
+	if err := Transition(o.db, &clone, models.RestoreStateReady, updates); err != nil {
+		return fmt.Errorf("failed to mark clone ready: %w", err)
+	}
+
+	o.logger.Info().
+		Str("restore_id", clone.ID).
+		Str("restore_name", clone.Name).
+		Str("source_restore_id", source.ID).
+		Msg("Restore cloned successfully")
+
+	return nil
+}
+
+// cloneErrorMessage extracts the BRANCHD_ERROR line from the script output
+func cloneErrorMessage(output string, err error) string {
+	for _, line := range strings.Split(output, "\n") {
+		if msg, ok := strings.CutPrefix(strings.TrimSpace(line), "BRANCHD_ERROR: "); ok {
+			return msg
+		}
+	}
+	return err.Error()
+}
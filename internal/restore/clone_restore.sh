@@ -0,0 +1,138 @@
+#!/bin/bash
+# Restore clone script for Branchd - ZFS-clones a ready restore into an independent restore cluster
+set -euo pipefail
+
+# Parameters, passed in the environment (never rendered into the script)
+readonly PG_VERSION="${PG_VERSION}"
+readonly SOURCE_PORT="${SOURCE_PORT}"
+readonly SOURCE_DATASET="${SOURCE_DATASET}"         # e.g., tank/restore_20250915120000
+readonly SOURCE_WAL_DATASET="${SOURCE_WAL_DATASET}"  # e.g., nvme/wal/restore_20250915120000 (empty = pg_wal inside data directory)
+readonly CLONE_NAME="${CLONE_NAME}"                 # e.g., restore_20250916093000
+readonly PG_PORT="${PG_PORT}"
+readonly ZFS_DATASET="${ZFS_DATASET}"               # e.g., tank/restore_20250916093000
+readonly DATA_DIR="${DATA_DIR}"                     # e.g., /opt/branchd/restore_20250916093000/data
+readonly WAL_DATASET="${WAL_DATASET}"               # e.g., nvme/wal/restore_20250916093000
+readonly WAL_DIR="${WAL_DIR}"                       # e.g., /opt/branchd-wal/restore_20250916093000/pg_wal
+readonly PRIORITY_DIRECTIVES="${PRIORITY_DIRECTIVES}" # systemd [Service] priority directives of the cluster unit
+
+# Paths
+readonly PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
+readonly MOUNTPOINT=$(dirname "${DATA_DIR}")  # /opt/branchd/restore_YYYYMMDDHHMMSS
+readonly SNAPSHOT="${SOURCE_DATASET}@${CLONE_NAME}"
+readonly WAL_SNAPSHOT="${SOURCE_WAL_DATASET}@${CLONE_NAME}"
+readonly SERVICE_NAME="branchd-restore-${CLONE_NAME}"
+
+# Helper functions
+log() {
+    echo "$(date '+%Y-%m-%d %H:%M:%S') - $1"
+}
+
+die() {
+    log "ERROR: $1" >&2
+
+    # Stop and remove systemd service if it was created
+    if [ -f "/etc/systemd/system/${SERVICE_NAME}.service" ]; then
+        log "Removing systemd service..."
+        sudo systemctl stop "${SERVICE_NAME}" 2>/dev/null || true
+        sudo systemctl disable "${SERVICE_NAME}" 2>/dev/null || true
+        sudo rm -f "/etc/systemd/system/${SERVICE_NAME}.service"
+        sudo systemctl daemon-reload
+    fi
+
+    # Destroy snapshots together with their clones
+    if sudo zfs list -t snapshot "${SNAPSHOT}" >/dev/null 2>&1; then
+        log "Destroying ZFS snapshot and clone..."
+        sudo zfs destroy -R "${SNAPSHOT}" 2>/dev/null || log "Warning: Could not destroy ZFS snapshot"
+    fi
+    if [ -n "${SOURCE_WAL_DATASET}" ] && sudo zfs list -t snapshot "${WAL_SNAPSHOT}" >/dev/null 2>&1; then
+        log "Destroying WAL snapshot and clone..."
+        sudo zfs destroy -R "${WAL_SNAPSHOT}" 2>/dev/null || log "Warning: Could not destroy WAL snapshot"
+    fi
+
+    echo "BRANCHD_ERROR: $1"
+    exit 1
+}
+
+log "Cloning ${SOURCE_DATASET} into ${ZFS_DATASET} (port ${PG_PORT})"
+
+# 1. Verify the source restore is running
+if ! sudo -u postgres ${PG_BIN}/pg_isready -p ${SOURCE_PORT} -h 127.0.0.1 >/dev/null 2>&1; then
+    die "Source restore is not accepting connections on port ${SOURCE_PORT}"
+fi
+
+# Flush the source to disk so the clone starts without crash recovery
+# WHY: Data and WAL snapshots are not atomic when pg_wal lives on another dataset
+sudo -u postgres ${PG_BIN}/psql -p ${SOURCE_PORT} -c "CHECKPOINT" >/dev/null || die "Failed to checkpoint source restore"
+
+# 2. Snapshot and clone the data dataset
+sudo zfs snapshot "${SNAPSHOT}" || die "Failed to create ZFS snapshot"
+sudo zfs clone -o mountpoint="${MOUNTPOINT}" "${SNAPSHOT}" "${ZFS_DATASET}" || die "Failed to create ZFS clone"
+if [ "$(sudo zfs get -H -o value mounted ${ZFS_DATASET})" != "yes" ]; then
+    sudo mkdir -p "${MOUNTPOINT}"
+    sudo zfs mount "${ZFS_DATASET}" || die "Failed to mount ZFS clone"
+fi
+log "ZFS clone mounted at ${MOUNTPOINT}"
+
+# 2b. Snapshot and clone the WAL dataset, then point pg_wal at the clone
+if [ -n "${SOURCE_WAL_DATASET}" ] && [ -L "${DATA_DIR}/pg_wal" ]; then
+    readonly WAL_MOUNTPOINT=$(dirname "${WAL_DIR}")
+    sudo zfs snapshot "${WAL_SNAPSHOT}" || die "Failed to create WAL snapshot"
+    sudo zfs clone -o mountpoint="${WAL_MOUNTPOINT}" "${WAL_SNAPSHOT}" "${WAL_DATASET}" || die "Failed to create WAL clone"
+    if [ "$(sudo zfs get -H -o value mounted ${WAL_DATASET})" != "yes" ]; then
+        sudo mkdir -p "${WAL_MOUNTPOINT}"
+        sudo zfs mount "${WAL_DATASET}" || die "Failed to mount WAL clone"
+    fi
+    sudo -u postgres ln -sfn "${WAL_DIR}" "${DATA_DIR}/pg_wal"
+    sudo chown -R postgres:postgres "${WAL_MOUNTPOINT}"
+    log "WAL clone mounted at ${WAL_MOUNTPOINT}"
+fi
+
+# 3. Remove the source's runtime state and move the clone to its own port
+sudo -u postgres rm -f "${DATA_DIR}/postmaster.pid"
+sudo -u postgres sed -i "s/^#*port = .*/port = ${PG_PORT}/" "${DATA_DIR}/postgresql.conf"
+sudo chown -R postgres:postgres "${MOUNTPOINT}"
+
+# 4. Create systemd service for the cloned cluster
+log "Creating systemd service: ${SERVICE_NAME}"
+sudo tee "/etc/systemd/system/${SERVICE_NAME}.service" > /dev/null << EOF
+[Unit]
+Description=PostgreSQL Restore Cluster (${CLONE_NAME}, cloned)
+After=network.target zfs-mount.service
+Requires=zfs-mount.service
+
+[Service]
+Type=forking
+User=postgres
+Group=postgres
+ExecStart=${PG_BIN}/pg_ctl start -D ${DATA_DIR} -l ${DATA_DIR}/postgresql.log
+ExecStop=${PG_BIN}/pg_ctl stop -D ${DATA_DIR} -m fast
+ExecReload=${PG_BIN}/pg_ctl reload -D ${DATA_DIR}
+KillMode=mixed
+KillSignal=SIGINT
+TimeoutStartSec=300
+TimeoutStopSec=300
+Restart=on-failure
+RestartSec=5s
+${PRIORITY_DIRECTIVES}
+
+[Install]
+WantedBy=multi-user.target
+EOF
+
+sudo systemctl daemon-reload
+
+# 5. Start the cloned cluster
+sudo systemctl enable "${SERVICE_NAME}"
+sudo systemctl start "${SERVICE_NAME}" || die "Failed to start cloned cluster"
+
+MAX_RETRIES=60
+RETRY_COUNT=0
+while ! sudo -u postgres ${PG_BIN}/pg_isready -p ${PG_PORT} -h 127.0.0.1 >/dev/null 2>&1; do
+    RETRY_COUNT=$((RETRY_COUNT + 1))
+    if [ ${RETRY_COUNT} -ge ${MAX_RETRIES} ]; then
+        die "Cloned cluster not ready after ${MAX_RETRIES} attempts"
+    fi
+    sleep 1
+done
+
+log "Cloned restore cluster running on port ${PG_PORT}"
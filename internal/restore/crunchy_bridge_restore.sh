@@ -2,14 +2,18 @@
 # pgBackRest restore script for Crunchy Bridge backups
 set -euo pipefail
 
-# Configuration from template
-readonly PG_VERSION="{{.PgVersion}}"
-readonly PG_PORT="{{.PgPort}}"
-readonly RESTORE_NAME="{{.RestoreName}}"              # e.g., restore_20251211000011
-readonly TARGET_DATABASE_NAME="{{.TargetDatabaseName}}" # e.g., db_prod
-readonly DATA_DIR="{{.DataDir}}"       # e.g., /opt/branchd/restore_20250915120000/data
-readonly PGBACKREST_CONF="{{.PgBackRestConfPath}}"
-readonly STANZA_NAME="{{.StanzaName}}"
+# Parameters, passed in the environment (never rendered into the script)
+readonly PG_VERSION="${PG_VERSION}"
+readonly PG_PORT="${PG_PORT}"
+readonly RESTORE_NAME="${RESTORE_NAME}"              # e.g., restore_20251211000011
+readonly TARGET_DATABASE_NAME="${TARGET_DATABASE_NAME}" # e.g., db_prod
+readonly DATA_DIR="${DATA_DIR}"       # e.g., /opt/branchd/restore_20250915120000/data
+readonly ZFS_DATASET="${ZFS_DATASET}" # e.g., tank/restore_20250915120000
+readonly WAL_DATASET="${WAL_DATASET}" # e.g., nvme/wal/restore_20250915120000 (empty = pg_wal inside DATA_DIR)
+readonly WAL_DIR="${WAL_DIR}"         # e.g., /opt/branchd-wal/restore_20250915120000/pg_wal
+readonly PGBACKREST_CONF="${PGBACKREST_CONF}"
+readonly STANZA_NAME="${STANZA_NAME}"
+readonly PRIORITY_DIRECTIVES="${PRIORITY_DIRECTIVES}" # systemd [Service] priority directives of the cluster unit
 
 # Paths
 readonly RESTORE_LOG_DIR="/var/log/branchd"
@@ -17,7 +21,6 @@ readonly RESTORE_LOG="${RESTORE_LOG_DIR}/restore-${RESTORE_NAME}.log"
 readonly RESTORE_PID="${RESTORE_LOG_DIR}/restore-${RESTORE_NAME}.pid"
 readonly PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
 readonly RESTORE_DATASET_PATH=$(dirname "${DATA_DIR}")  # /opt/branchd/restore_YYYYMMDDHHMMSS
-readonly ZFS_DATASET="tank/${RESTORE_NAME}"
 readonly SERVICE_NAME="branchd-restore-${RESTORE_NAME}"
 
 # Helper functions
@@ -25,6 +28,11 @@ log() {
     echo "$(date '+%Y-%m-%d %H:%M:%S') - $1"
 }
 
+# Provenance lines are parsed from the restore log once the restore succeeded (see restore.ReadProvenance)
+provenance() {
+    echo "__BRANCHD_PROVENANCE__ $1=$2"
+}
+
 die() {
     log "ERROR: $1" >&2
 
@@ -78,10 +86,25 @@ if sudo zfs list "${ZFS_DATASET}" >/dev/null 2>&1; then
     sudo zfs destroy -r "${ZFS_DATASET}" || die "Failed to destroy existing ZFS dataset"
 fi
 
-sudo zfs create "${ZFS_DATASET}" || die "Failed to create ZFS dataset"
+sudo zfs create -p "${ZFS_DATASET}" || die "Failed to create ZFS dataset"
 sudo zfs set mountpoint="${RESTORE_DATASET_PATH}" "${ZFS_DATASET}"
 log "ZFS dataset created and mounted at ${RESTORE_DATASET_PATH}"
 
+# 1b. Create WAL dataset on the separate device (if configured)
+if [ -n "${WAL_DATASET}" ]; then
+    readonly WAL_DATASET_PATH=$(dirname "${WAL_DIR}")  # /opt/branchd-wal/restore_YYYYMMDDHHMMSS
+    log "Creating WAL dataset: ${WAL_DATASET}"
+    if sudo zfs list "${WAL_DATASET}" >/dev/null 2>&1; then
+        log "WAL dataset already exists, destroying and recreating..."
+        sudo zfs destroy -r "${WAL_DATASET}" || die "Failed to destroy existing WAL dataset"
+    fi
+
+    sudo zfs create -p "${WAL_DATASET}" || die "Failed to create WAL dataset"
+    sudo zfs set mountpoint="${WAL_DATASET_PATH}" "${WAL_DATASET}"
+    sudo chown -R postgres:postgres "${WAL_DATASET_PATH}"
+    log "WAL dataset created and mounted at ${WAL_DATASET_PATH}"
+fi
+
 # 2. Create data directory and set ownership
 log "Creating data directory..."
 sudo mkdir -p "${DATA_DIR}" || die "Failed to create data directory"
@@ -118,10 +141,29 @@ fi
 PG_DATA_VERSION=$(cat "${DATA_DIR}/PG_VERSION")
 log "Restored PostgreSQL version: ${PG_DATA_VERSION}"
 
+# Record which backup the restore holds, read before recovery consumes backup_label
+# pgBackRest checks every restored file against the checksum in the backup manifest
+provenance method crunchy_bridge
+provenance source_database "${TARGET_DATABASE_NAME}"
+provenance source_version "${PG_DATA_VERSION}"
+provenance source_system_identifier "$(sudo -u postgres ${PG_BIN}/pg_controldata "${DATA_DIR}" 2>/dev/null | sed -n 's/^Database system identifier: *//p' || true)"
+provenance dump_tool "$(pgbackrest version 2>/dev/null || true)"
+provenance snapshot_id "$(sudo -u postgres sed -n 's/^LABEL: pgBackRest backup //p' "${DATA_DIR}/backup_label" 2>/dev/null || true)"
+provenance start_lsn "$(sudo -u postgres sed -n 's/^START WAL LOCATION: \([^ ]*\).*/\1/p' "${DATA_DIR}/backup_label" 2>/dev/null || true)"
+provenance checksums_verified true
+
 if [ "${PG_DATA_VERSION}" != "${PG_VERSION}" ]; then
     log "WARNING: Restored version (${PG_DATA_VERSION}) differs from expected version (${PG_VERSION})"
 fi
 
+# Move pg_wal to the WAL dataset (pgBackRest always restores it inside the data directory)
+if [ -n "${WAL_DIR}" ]; then
+    log "Moving pg_wal to ${WAL_DIR}..."
+    sudo -u postgres mv "${DATA_DIR}/pg_wal" "${WAL_DIR}" || die "Failed to move pg_wal to WAL dataset"
+    sudo -u postgres ln -s "${WAL_DIR}" "${DATA_DIR}/pg_wal" || die "Failed to link pg_wal to WAL dataset"
+    log "pg_wal moved to WAL dataset"
+fi
+
 # 5. Configure PostgreSQL for local access
 log "Configuring PostgreSQL..."
 
@@ -260,6 +302,8 @@ TimeoutStartSec=86400
 TimeoutStopSec=300
 Restart=on-failure
 RestartSec=5s
+# Run below branches so refreshes don't degrade interactive work (see POST /api/restores/:id/boost)
+${PRIORITY_DIRECTIVES}
 
 [Install]
 WantedBy=multi-user.target
@@ -295,7 +339,7 @@ log "Cleaning up schemas and extensions..."
 
 # Use Unix socket connection (no -h flag) to leverage peer authentication
 # This avoids needing the postgres password from the restored database
-sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -d ${TARGET_DATABASE_NAME} << 'EOSQL'
+sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -d "${TARGET_DATABASE_NAME}" << 'EOSQL'
 DROP EXTENSION IF EXISTS crunchy_pooler CASCADE;
 EOSQL
 
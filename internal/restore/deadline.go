@@ -0,0 +1,95 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Deadline returns when a started restore is stopped for running too long (nil = no deadline)
+func Deadline(restore *models.Restore, config *models.Config) *time.Time {
+	if restore.StartedAt == nil || config.RestoreDeadlineHours <= 0 {
+		return nil
+	}
+	deadline := restore.StartedAt.Add(time.Duration(config.RestoreDeadlineHours) * time.Hour)
+	return &deadline
+}
+
+// Fail marks a restore as failed so it's no longer supervised or counted as running
+// A restore that finished meanwhile (e.g. cancelled) keeps its state
+func (o *Orchestrator) Fail(ctx context.Context, restoreID string, reason string) error {
+	var restore models.Restore
+	if err := o.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
+		return fmt.Errorf("failed to load restore: %w", err)
+	}
+	if restore.Finished() {
+		return nil
+	}
+	if err := Transition(o.db, &restore, models.RestoreStateFailed, map[string]interface{}{"failure_reason": reason}); err != nil {
+		return fmt.Errorf("failed to mark restore as failed: %w", err)
+	}
+	return nil
+}
+
+// StopDeadlineExceeded stops a restore that ran past Config.RestoreDeadlineHours and marks it failed
+// The restore's datasets are kept until the restore is deleted
+func (o *Orchestrator) StopDeadlineExceeded(ctx context.Context, restore *models.Restore, deadlineHours int) error {
+	// The log is removed with the process, keep its end for troubleshooting
+	if logTail, err := o.processManager.ReadLogTail(ctx, restore.Name, 50); err == nil {
+		o.logger.Warn().
+			Str("restore_id", restore.ID).
+			Str("log_tail", logTail).
+			Msg("Stopping restore - deadline exceeded")
+	}
+
+	if err := o.stopProcess(ctx, restore); err != nil {
+		return err
+	}
+
+	reason := fmt.Sprintf("%s: restore still running after %d hours (restore_deadline_hours)", StatusDeadlineExceeded, deadlineHours)
+	return o.Fail(ctx, restore.ID, reason)
+}
+
+// Cancel stops a queued or running restore and marks it cancelled
+// A restore that's anonymizing stops at its next transition. The datasets are kept until the restore is deleted
+func (o *Orchestrator) Cancel(ctx context.Context, restoreID string) (*models.Restore, error) {
+	var restore models.Restore
+	if err := o.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
+		return nil, fmt.Errorf("failed to load restore: %w", err)
+	}
+
+	// Cancelled first, so the restore supervisor doesn't complete the restore once its process is killed
+	previous := restore.State
+	if err := Transition(o.db, &restore, models.RestoreStateCancelled, nil); err != nil {
+		return nil, err
+	}
+
+	// Adoptions, clones and promotions run in their worker task rather than a restore process
+	hasProcess := restore.AdoptedFrom == "" && restore.ClonedFromID == "" && restore.PromotedFromBranch == ""
+	if hasProcess && (previous == models.RestoreStateDumping || previous == models.RestoreStateRestoring) {
+		if err := o.stopProcess(ctx, &restore); err != nil {
+			return nil, err
+		}
+	}
+
+	o.logger.Info().
+		Str("restore_id", restore.ID).
+		Str("restore_name", restore.Name).
+		Str("previous_state", previous).
+		Msg("Restore cancelled")
+	return &restore, nil
+}
+
+// stopProcess kills the restore script of a restore and the processes it started
+func (o *Orchestrator) stopProcess(ctx context.Context, restore *models.Restore) error {
+	if err := o.processManager.KillProcess(ctx, restore.Name); err != nil {
+		return fmt.Errorf("failed to stop restore process: %w", err)
+	}
+	// pg_dump/pg_restore outlive the restore script when it's killed
+	if err := o.resources.KillProcessesInDirectory(ctx, o.resources.GetRestoreDataPath(restore.Name)); err != nil {
+		o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to stop restore processes")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package restore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestDeadline(t *testing.T) {
+	startedAt := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	deadline := startedAt.Add(12 * time.Hour)
+
+	tests := []struct {
+		name      string
+		startedAt *time.Time
+		hours     int
+		want      *time.Time
+	}{
+		{name: "queued restore", startedAt: nil, hours: 12, want: nil},
+		{name: "no deadline", startedAt: &startedAt, hours: 0, want: nil},
+		{name: "negative hours", startedAt: &startedAt, hours: -1, want: nil},
+		{name: "started restore", startedAt: &startedAt, hours: 12, want: &deadline},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Deadline(&models.Restore{StartedAt: tt.startedAt}, &models.Config{RestoreDeadlineHours: tt.hours})
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("Deadline() = %v, want none", *got)
+			case tt.want != nil && (got == nil || !got.Equal(*tt.want)):
+				t.Errorf("Deadline() = %v, want %v", got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestFail(t *testing.T) {
+	o := newTestOrchestrator(t)
+
+	restore := &models.Restore{BaseModel: models.BaseModel{ID: "r1"}, Name: "restore_20250101000000"}
+	other := &models.Restore{BaseModel: models.BaseModel{ID: "r2"}, Name: "restore_20250102000000"}
+	for _, r := range []*models.Restore{restore, other} {
+		if err := o.db.Create(r).Error; err != nil {
+			t.Fatalf("failed to create restore: %v", err)
+		}
+	}
+
+	reason := string(StatusDeadlineExceeded) + ": restore still running after 12 hours (restore_deadline_hours)"
+	if err := o.Fail(context.Background(), restore.ID, reason); err != nil {
+		t.Fatalf("Fail() error = %v", err)
+	}
+
+	var failed, untouched models.Restore
+	o.db.First(&failed, "id = ?", restore.ID)
+	o.db.First(&untouched, "id = ?", other.ID)
+	if failed.State != models.RestoreStateFailed || failed.FailedAt == nil || failed.FailureReason != reason {
+		t.Errorf("failed restore = failed_at %v, failure_reason %q; want set to %q", failed.FailedAt, failed.FailureReason, reason)
+	}
+	if untouched.FailedAt != nil || untouched.FailureReason != "" {
+		t.Errorf("other restore marked failed: %q", untouched.FailureReason)
+	}
+}
+
+func TestFailKeepsFinishedRestore(t *testing.T) {
+	o := newTestOrchestrator(t)
+
+	restore := &models.Restore{Name: "restore_20250101000000", State: models.RestoreStateCancelled}
+	if err := o.db.Create(restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+
+	// e.g. the killed restore process of a cancelled restore
+	if err := o.Fail(context.Background(), restore.ID, "restore process died"); err != nil {
+		t.Fatalf("Fail() error = %v", err)
+	}
+
+	var got models.Restore
+	o.db.First(&got, "id = ?", restore.ID)
+	if got.State != models.RestoreStateCancelled || got.FailedAt != nil {
+		t.Errorf("cancelled restore = state %q, failed_at %v; want it kept cancelled", got.State, got.FailedAt)
+	}
+}
@@ -0,0 +1,132 @@
+package restore
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+//go:embed demo_source.sh
+var demoSourceScript string
+
+//go:embed demo_source.sql
+var demoSourceSQL string
+
+// Demo source of Config.DemoMode: the bundled sample database on a local cluster, restored logically over loopback
+const (
+	DemoSourcePort     = 5499 // Outside the restore ports (50000-60000), listening on 127.0.0.1 only
+	DemoSourceDatabase = "shop"
+	demoSourceUser     = "branchd_demo"
+	demoSourceDataDir  = "/var/lib/branchd/demo-source"
+	demoSeedFile       = "/tmp/branchd_demo_source.sql"
+)
+
+type demoSourceParams struct {
+	PgVersion    string `env:"PG_VERSION"`
+	PgPort       int    `env:"PG_PORT"`
+	DataDir      string `env:"DATA_DIR"`
+	DatabaseName string `env:"DATABASE_NAME"`
+	User         string `env:"DEMO_USER"`
+	Password     string `env:"DEMO_PASSWORD"`
+	SeedFile     string `env:"SEED_FILE"`
+}
+
+// postgresInstallDir holds a directory per installed PostgreSQL major version, replaced in tests
+var postgresInstallDir = "/usr/lib/postgresql"
+
+// runDemoSourceScript runs the demo source script, replaced in tests
+var runDemoSourceScript = func(ctx context.Context, params demoSourceParams) ([]byte, error) {
+	return shellexec.Command(ctx, demoSourceScript, params).CombinedOutput()
+}
+
+// DemoConnectionString is the connection string restores of demo mode dump the sample database with
+func DemoConnectionString(password string) string {
+	u := url.URL{
+		Scheme:   "postgresql",
+		User:     url.UserPassword(demoSourceUser, password),
+		Host:     fmt.Sprintf("127.0.0.1:%d", DemoSourcePort),
+		Path:     "/" + DemoSourceDatabase,
+		RawQuery: "sslmode=disable",
+	}
+	return u.String()
+}
+
+// DemoPassword returns the demo source password of a DemoConnectionString, empty for other connection strings
+func DemoPassword(connectionString string) string {
+	u, err := url.Parse(connectionString)
+	if err != nil || u.User == nil || u.User.Username() != demoSourceUser {
+		return ""
+	}
+	password, _ := u.User.Password()
+	return password
+}
+
+// LatestPostgresVersion returns the newest PostgreSQL major version installed on the VM, the demo source runs it
+func LatestPostgresVersion() (string, error) {
+	entries, err := os.ReadDir(postgresInstallDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to list installed PostgreSQL versions: %w", err)
+	}
+	latest := 0
+	for _, entry := range entries {
+		version, err := strconv.Atoi(entry.Name())
+		if err != nil || version <= latest {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(postgresInstallDir, entry.Name(), "bin", "pg_restore")); err == nil {
+			latest = version
+		}
+	}
+	if latest == 0 {
+		return "", fmt.Errorf("no PostgreSQL installation found in %s", postgresInstallDir)
+	}
+	return strconv.Itoa(latest), nil
+}
+
+// EnsureDemoSource creates the demo source cluster with the sample database, or starts an existing one
+// The role's password is set on every call, the connection string stored in the config is the one that works
+func EnsureDemoSource(ctx context.Context, postgresVersion, password string, logger zerolog.Logger) error {
+	if err := os.WriteFile(demoSeedFile, []byte(demoSourceSQL), 0644); err != nil {
+		return fmt.Errorf("failed to write sample database: %w", err)
+	}
+	defer os.Remove(demoSeedFile)
+
+	output, err := runDemoSourceScript(ctx, demoSourceParams{
+		PgVersion:    postgresVersion,
+		PgPort:       DemoSourcePort,
+		DataDir:      demoSourceDataDir,
+		DatabaseName: DemoSourceDatabase,
+		User:         demoSourceUser,
+		Password:     password,
+		SeedFile:     demoSeedFile,
+	})
+	if err != nil {
+		logger.Error().Err(err).Str("output", string(output)).Msg("Failed to set up demo source")
+		return fmt.Errorf("failed to set up demo source: %s", cloneErrorMessage(string(output), err))
+	}
+
+	logger.Info().
+		Str("postgres_version", postgresVersion).
+		Int("port", DemoSourcePort).
+		Msg("Demo source ready")
+	return nil
+}
+
+// DemoAnonRules anonymize the personal data of the sample database's customers
+func DemoAnonRules() []models.AnonRule {
+	return []models.AnonRule{
+		{Table: "customers", Column: "full_name", ColumnType: "text", Function: "fake_name"},
+		{Table: "customers", Column: "email", ColumnType: "text", Function: "fake_email"},
+		{Table: "customers", Column: "phone", ColumnType: "text", Function: "mask", FunctionOptions: models.AnonFunctionOptions{KeepLast: 2}},
+		{Table: "customers", Column: "address", ColumnType: "text", Function: "fake_address"},
+	}
+}
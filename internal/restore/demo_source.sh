@@ -0,0 +1,108 @@
+#!/bin/bash
+# Demo source for Branchd - a local cluster with the bundled sample database, restored like any other source
+# Idempotent: an existing cluster is started if needed and only gets the current password
+set -euo pipefail
+
+# Parameters, passed in the environment (never rendered into the script)
+readonly PG_VERSION="${PG_VERSION}"
+readonly PG_PORT="${PG_PORT}"
+readonly DATA_DIR="${DATA_DIR}"          # e.g., /var/lib/branchd/demo-source
+readonly DATABASE_NAME="${DATABASE_NAME}"
+readonly DEMO_USER="${DEMO_USER}"
+readonly DEMO_PASSWORD="${DEMO_PASSWORD}"
+readonly SEED_FILE="${SEED_FILE}"        # demo_source.sql, loaded once into a new cluster
+
+readonly PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
+readonly SERVICE_NAME="branchd-demo-source"
+
+log() {
+    echo "$(date '+%Y-%m-%d %H:%M:%S') - $1"
+}
+
+# Error lines are reported as the failure reason (see cloneErrorMessage)
+die() {
+    echo "BRANCHD_ERROR: $1"
+    exit 1
+}
+
+psql_admin() {
+    sudo -u postgres ${PG_BIN}/psql -X -v ON_ERROR_STOP=1 -p "${PG_PORT}" "$@"
+}
+
+# 1. Create the cluster (only listening on loopback, restores dump it over 127.0.0.1)
+if [ ! -f "${DATA_DIR}/PG_VERSION" ]; then
+    log "Initializing demo source cluster..."
+    sudo mkdir -p "${DATA_DIR}"
+    sudo chown postgres:postgres "${DATA_DIR}"
+    sudo -u postgres ${PG_BIN}/initdb -D "${DATA_DIR}" --encoding=UTF8 --locale=C.UTF-8 >/dev/null \
+        || die "Failed to initialize demo source cluster"
+
+    sudo -u postgres tee -a "${DATA_DIR}/postgresql.conf" > /dev/null << EOF
+port = ${PG_PORT}
+listen_addresses = '127.0.0.1'
+max_connections = 20
+shared_buffers = 32MB
+EOF
+
+    sudo -u postgres tee "${DATA_DIR}/pg_hba.conf" > /dev/null << EOF
+# TYPE  DATABASE        USER            ADDRESS                 METHOD
+local   all             all                                     peer
+host    all             ${DEMO_USER}    127.0.0.1/32            scram-sha-256
+EOF
+fi
+
+# 2. Run it as a systemd service so it comes back after reboots
+if [ ! -f "/etc/systemd/system/${SERVICE_NAME}.service" ]; then
+    log "Creating systemd service: ${SERVICE_NAME}"
+    sudo tee "/etc/systemd/system/${SERVICE_NAME}.service" > /dev/null << EOF
+[Unit]
+Description=Branchd demo source database
+After=network.target
+
+[Service]
+Type=forking
+User=postgres
+Group=postgres
+ExecStart=${PG_BIN}/pg_ctl start -D ${DATA_DIR} -l ${DATA_DIR}/postgresql.log
+ExecStop=${PG_BIN}/pg_ctl stop -D ${DATA_DIR} -m fast
+KillMode=mixed
+KillSignal=SIGINT
+Restart=on-failure
+RestartSec=5s
+
+[Install]
+WantedBy=multi-user.target
+EOF
+    sudo systemctl daemon-reload
+    sudo systemctl enable "${SERVICE_NAME}"
+fi
+sudo systemctl start "${SERVICE_NAME}"
+
+for _ in $(seq 1 60); do
+    if sudo -u postgres ${PG_BIN}/pg_isready -p "${PG_PORT}" -h 127.0.0.1 >/dev/null 2>&1; then
+        break
+    fi
+    sleep 1
+done
+sudo -u postgres ${PG_BIN}/pg_isready -p "${PG_PORT}" -h 127.0.0.1 >/dev/null 2>&1 \
+    || die "Demo source cluster not ready after 60 seconds"
+
+# 3. Role and sample database
+psql_admin -d postgres -c "DO \$\$ BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = '${DEMO_USER}') THEN
+        CREATE ROLE ${DEMO_USER} LOGIN;
+    END IF;
+END \$\$" >/dev/null
+psql_admin -d postgres -v user="${DEMO_USER}" -v password="${DEMO_PASSWORD}" >/dev/null <<'SQL'
+ALTER ROLE :"user" PASSWORD :'password';
+SQL
+
+if [ "$(psql_admin -d postgres -Atc "SELECT 1 FROM pg_database WHERE datname = '${DATABASE_NAME}'")" != "1" ]; then
+    log "Loading sample database ${DATABASE_NAME}..."
+    psql_admin -d postgres -c "CREATE DATABASE ${DATABASE_NAME} OWNER ${DEMO_USER}" >/dev/null
+    sudo -u postgres ${PG_BIN}/psql -X -v ON_ERROR_STOP=1 -p "${PG_PORT}" -d "${DATABASE_NAME}" \
+        -c "SET ROLE ${DEMO_USER}" -f "${SEED_FILE}" >/dev/null \
+        || { psql_admin -d postgres -c "DROP DATABASE ${DATABASE_NAME}" >/dev/null; die "Failed to load sample database"; }
+fi
+
+log "Demo source ready on 127.0.0.1:${PG_PORT}"
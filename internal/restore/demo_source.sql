@@ -0,0 +1,69 @@
+-- Sample database of demo mode (see restore.EnsureDemoSource): a small shop whose customers hold the
+-- kind of personal data anonymization rules are written for. Generated deterministically, no random()
+BEGIN;
+
+CREATE TABLE customers (
+    id         serial PRIMARY KEY,
+    full_name  text NOT NULL,
+    email      text NOT NULL UNIQUE,
+    phone      text NOT NULL,
+    address    text NOT NULL,
+    created_at timestamptz NOT NULL
+);
+
+CREATE TABLE products (
+    id    serial PRIMARY KEY,
+    sku   text NOT NULL UNIQUE,
+    name  text NOT NULL,
+    price numeric(10, 2) NOT NULL
+);
+
+CREATE TABLE orders (
+    id          serial PRIMARY KEY,
+    customer_id integer NOT NULL REFERENCES customers (id),
+    status      text NOT NULL,
+    created_at  timestamptz NOT NULL
+);
+CREATE INDEX orders_customer_id_idx ON orders (customer_id);
+
+CREATE TABLE order_items (
+    order_id   integer NOT NULL REFERENCES orders (id),
+    product_id integer NOT NULL REFERENCES products (id),
+    quantity   integer NOT NULL,
+    unit_price numeric(10, 2) NOT NULL,
+    PRIMARY KEY (order_id, product_id)
+);
+
+INSERT INTO customers (full_name, email, phone, address, created_at)
+SELECT first_name || ' ' || last_name,
+       lower(first_name || '.' || last_name || n) || '@example.com',
+       '+1 555 ' || lpad((n * 7919 % 10000000)::text, 7, '0'),
+       (n * 37 % 9000 + 100) || ' ' || street || ' St, ' || city,
+       timestamptz '2024-01-01' + (n * interval '7 hours')
+FROM generate_series(1, 1000) AS n,
+     LATERAL (SELECT (ARRAY['Olivia', 'Liam', 'Emma', 'Noah', 'Ava', 'Mateo', 'Sofia', 'Lucas', 'Mia', 'Elijah'])[n % 10 + 1] AS first_name,
+                     (ARRAY['Keller', 'Novak', 'Okafor', 'Lindqvist', 'Tanaka', 'Moreau', 'Castillo', 'Brennan'])[n % 8 + 1] AS last_name,
+                     (ARRAY['Harbor', 'Willow', 'Granite', 'Meadow', 'Orchard', 'Summit'])[n % 6 + 1] AS street,
+                     (ARRAY['Portland', 'Austin', 'Denver', 'Raleigh', 'Madison'])[n % 5 + 1] AS city) AS names;
+
+INSERT INTO products (sku, name, price)
+SELECT 'SKU-' || lpad(n::text, 4, '0'),
+       (ARRAY['Mug', 'Notebook', 'Backpack', 'Lamp', 'Headphones', 'Kettle', 'Blanket', 'Planter', 'Tripod', 'Keyboard'])[n % 10 + 1] || ' ' || n,
+       (n * 13 % 200) + 4.99
+FROM generate_series(1, 50) AS n;
+
+INSERT INTO orders (customer_id, status, created_at)
+SELECT n * 17 % 1000 + 1,
+       (ARRAY['pending', 'paid', 'shipped', 'delivered', 'delivered', 'refunded'])[n % 6 + 1],
+       timestamptz '2024-03-01' + (n * interval '83 minutes')
+FROM generate_series(1, 5000) AS n;
+
+INSERT INTO order_items (order_id, product_id, quantity, unit_price)
+SELECT o.id, p.id, (o.id + item) % 4 + 1, p.price
+FROM orders o
+CROSS JOIN generate_series(0, 2) AS item
+JOIN products p ON p.id = (o.id * 7 + item * 11) % 50 + 1;
+
+COMMIT;
+
+ANALYZE;
@@ -0,0 +1,101 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+// extensionDir is where the packages of a PostgreSQL version install extension control files
+const extensionDir = "/usr/share/postgresql/%s/extension"
+
+// checkExtensionsInstalled fails when a configured extension's package is missing for the restore's PostgreSQL version
+// Runs before pg_dump starts, createExtensions would otherwise only find out once the dump finished
+func checkExtensionsInstalled(extensionList, postgresVersion string) error {
+	extensions, err := models.ParseExtensions(extensionList)
+	if err != nil {
+		return err
+	}
+	missing := missingExtensions(fmt.Sprintf(extensionDir, postgresVersion), extensions)
+	if len(missing) > 0 {
+		return fmt.Errorf("extensions %s are not installed for PostgreSQL %s (install their packages, e.g. postgresql-%s-pgvector for vector)",
+			strings.Join(missing, ", "), postgresVersion, postgresVersion)
+	}
+	return nil
+}
+
+// missingExtensions returns the extensions without a control file in dir
+func missingExtensions(dir string, extensions []string) []string {
+	var missing []string
+	for _, ext := range extensions {
+		if _, err := os.Stat(filepath.Join(dir, ext+".control")); err != nil {
+			missing = append(missing, ext)
+		}
+	}
+	return missing
+}
+
+// createExtensionsScript verifies the extensions' packages and creates them in the restore's database
+const createExtensionsScript = `set -euo pipefail
+
+PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
+
+for ext in ${EXTENSIONS}; do
+    if [ ! -f "/usr/share/postgresql/${PG_VERSION}/extension/${ext}.control" ]; then
+        echo "BRANCHD_ERROR: Extension ${ext} is not installed for PostgreSQL ${PG_VERSION} (install its package, e.g. postgresql-${PG_VERSION}-pgvector for vector)"
+        exit 1
+    fi
+done
+
+for ext in ${EXTENSIONS}; do
+    sudo -u postgres "${PG_BIN}/psql" -v ON_ERROR_STOP=1 -p "${PG_PORT}" -d "${DATABASE_NAME}" -c "CREATE EXTENSION IF NOT EXISTS \"${ext}\""
+done`
+
+// createExtensionsParams are the parameters of createExtensionsScript
+type createExtensionsParams struct {
+	DatabaseName string `env:"DATABASE_NAME"`
+	PgVersion    string `env:"PG_VERSION"`
+	PgPort       int    `env:"PG_PORT"`
+	Extensions   string `env:"EXTENSIONS"` // Space-separated, validated by models.ParseExtensions
+}
+
+// createExtensions creates the configured extensions (Config.Extensions) in the restore's database
+// Branches inherit them through the ZFS clone, missing packages fail the restore with the extension's name
+func (o *Orchestrator) createExtensions(ctx context.Context, restore *models.Restore, extensionList, databaseName, postgresVersion string) error {
+	extensions, err := models.ParseExtensions(extensionList)
+	if err != nil {
+		return err
+	}
+	if len(extensions) == 0 {
+		return nil
+	}
+
+	o.logger.Info().
+		Str("restore_id", restore.ID).
+		Strs("extensions", extensions).
+		Msg("Creating extensions")
+
+	cmd := shellexec.Command(ctx, createExtensionsScript, createExtensionsParams{
+		DatabaseName: databaseName,
+		PgVersion:    postgresVersion,
+		PgPort:       restore.Port,
+		Extensions:   strings.Join(extensions, " "),
+	})
+	outputBytes, err := cmd.CombinedOutput()
+	output := string(outputBytes)
+	if err != nil {
+		o.logger.Error().
+			Err(err).
+			Str("output", output).
+			Str("database_name", databaseName).
+			Msg("Failed to create extensions")
+		return fmt.Errorf("failed to create extensions: %s", cloneErrorMessage(output, err))
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package restore
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMissingExtensions(t *testing.T) {
+	dir := t.TempDir()
+	for _, ext := range []string{"vector", "pg_trgm"} {
+		if err := os.WriteFile(filepath.Join(dir, ext+".control"), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		extensions []string
+		want       []string
+	}{
+		{name: "none configured", extensions: nil, want: nil},
+		{name: "all installed", extensions: []string{"vector", "pg_trgm"}, want: nil},
+		{name: "missing packages", extensions: []string{"postgis", "vector", "uuid-ossp"}, want: []string{"postgis", "uuid-ossp"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingExtensions(dir, tt.extensions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingExtensions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package restore
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/anonymize"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+//go:embed incremental_refresh.sh
+var incrementalRefreshScript string
+
+// ReplicationPublication is the publication created on the source for incremental refreshes
+const ReplicationPublication = "branchd_refresh"
+
+// incrementalRefreshTimeout bounds how long a restore may take to catch up with the source
+const incrementalRefreshTimeout = 4 * time.Hour
+
+type incrementalRefreshParams struct {
+	ConnectionString string `env:"CONNECTION_STRING"`
+	PgVersion        string `env:"PG_VERSION"`
+	PgPort           int    `env:"PG_PORT"`
+	DatabaseName     string `env:"TARGET_DATABASE"`
+	SubscriptionName string `env:"SUBSCRIPTION_NAME"`
+	TimeoutSeconds   int    `env:"TIMEOUT_SECONDS"`
+}
+
+// SubscriptionName returns the subscription (and source replication slot) name for a restore
+func SubscriptionName(restoreName string) string {
+	return "branchd_" + restoreName
+}
+
+// RefreshIncremental applies the source's changes since the last refresh onto an existing restore
+// Branching from the restore is blocked while it runs, and anonymization is re-applied afterwards
+// because changed rows arrive from the source un-anonymized
+func (o *Orchestrator) RefreshIncremental(ctx context.Context, restoreID string) error {
+	var restore models.Restore
+	if err := o.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
+		return fmt.Errorf("failed to load restore: %w", err)
+	}
+
+	refreshErr := o.refreshIncremental(ctx, &restore)
+
+	outcome, reason := models.RefreshOutcomeSucceeded, ""
+	if refreshErr != nil {
+		outcome, reason = models.RefreshOutcomeFailed, refreshErr.Error()
+	}
+	if err := FinishRefreshRun(o.db, &restore, outcome, reason); err != nil {
+		o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to record refresh outcome")
+	}
+	return refreshErr
+}
+
+// refreshIncremental runs the incremental refresh of RefreshIncremental
+func (o *Orchestrator) refreshIncremental(ctx context.Context, restore *models.Restore) error {
+	if restore.SubscriptionName == "" {
+		return fmt.Errorf("restore %s has no subscription", restore.Name)
+	}
+
+	var config models.Config
+	if err := o.db.First(&config).Error; err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := o.db.Model(restore).Update("refreshing_since", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to mark restore refreshing: %w", err)
+	}
+
+	o.logger.Info().
+		Str("restore_id", restore.ID).
+		Str("restore_name", restore.Name).
+		Str("subscription", restore.SubscriptionName).
+		Msg("Starting incremental refresh")
+
+	refreshErr := o.applySourceChanges(ctx, restore, &config)
+
+	// Re-anonymize even on failure, a partially applied refresh may contain source rows
+	_, err := anonymize.Apply(ctx, o.db, anonymize.ApplyParams{
+		DatabaseName: config.DatabaseName,
+		PostgresPort: restore.Port,
+		RestoreID:    restore.ID,
+		RestoreName:  restore.Name,
+		Trigger:      models.AnonRunTriggerRefresh,
+	}, o.logger)
+	if err != nil {
+		// Leave refreshing_since set so nobody branches from un-anonymized data
+		o.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to apply anonymization rules")
+		return fmt.Errorf("failed to apply anonymization rules: %w", err)
+	}
+
+	// Seed SQL runs after every refresh, so it has to be idempotent (e.g. INSERT ... ON CONFLICT DO NOTHING)
+	if refreshErr == nil && config.SeedSQL != "" {
+		refreshErr = o.executeSQLStage(ctx, restore, "seed", config.SeedSQL, config.DatabaseName)
+	}
+
+	if refreshErr != nil {
+		if err := o.db.Model(restore).Update("refreshing_since", nil).Error; err != nil {
+			o.logger.Error().Err(err).Msg("Failed to clear refreshing state")
+		}
+		return refreshErr
+	}
+
+	now := time.Now()
+	if err := o.db.Model(restore).Updates(map[string]interface{}{
+		"ready_at":         now,
+		"refreshing_since": nil,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to mark restore ready: %w", err)
+	}
+
+	if config.RefreshSchedule != "" {
+		nextRefresh := o.calculateNextRefresh(config.RefreshSchedule, now)
+		if err := o.db.Model(&config).Updates(map[string]interface{}{
+			"last_refreshed_at": now,
+			"next_refresh_at":   nextRefresh,
+		}).Error; err != nil {
+			o.logger.Error().Err(err).Msg("Failed to update refresh timestamps")
+		}
+	}
+
+	if _, err := o.GenerateReport(ctx, restore, &config, config.DatabaseName); err != nil {
+		o.logger.Warn().Err(err).Msg("Failed to generate restore comparison report (non-fatal)")
+	}
+
+	o.logger.Info().
+		Str("restore_id", restore.ID).
+		Msg("Incremental refresh completed successfully")
+
+	return nil
+}
+
+// applySourceChanges runs the incremental refresh script and the post-restore SQL
+func (o *Orchestrator) applySourceChanges(ctx context.Context, restore *models.Restore, config *models.Config) error {
+	scriptParams := incrementalRefreshParams{
+		ConnectionString: config.ConnectionString,
+		PgVersion:        restore.ClusterPostgresVersion(config),
+		PgPort:           restore.Port,
+		DatabaseName:     config.DatabaseName,
+		SubscriptionName: restore.SubscriptionName,
+		TimeoutSeconds:   int(incrementalRefreshTimeout.Seconds()),
+	}
+
+	cmd := shellexec.Command(ctx, incrementalRefreshScript, scriptParams)
+	outputBytes, err := cmd.CombinedOutput()
+	output := string(outputBytes)
+	if err != nil || !strings.Contains(output, "__BRANCHD_INCREMENTAL_REFRESH_SUCCESS__") {
+		o.logger.Error().
+			Err(err).
+			Str("restore_id", restore.ID).
+			Str("output", output).
+			Msg("Incremental refresh failed")
+		if err == nil {
+			err = fmt.Errorf("script did not report success")
+		}
+		return fmt.Errorf("incremental refresh failed: %s", cloneErrorMessage(output, err))
+	}
+
+	// Extensions added to the config since the full refresh
+	if err := o.createExtensions(ctx, restore, config.Extensions, config.DatabaseName, restore.ClusterPostgresVersion(config)); err != nil {
+		return err
+	}
+
+	if config.PostRestoreSQL != "" {
+		if err := o.executeSQLStage(ctx, restore, "post-restore", config.PostRestoreSQL, config.DatabaseName); err != nil {
+			return fmt.Errorf("failed to execute post-restore SQL: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// subscriptionExists reports whether the restore cluster has the restore's subscription
+func (o *Orchestrator) subscriptionExists(ctx context.Context, restore *models.Restore, postgresVersion, databaseName string) bool {
+	query := fmt.Sprintf("SELECT count(*) FROM pg_subscription WHERE subname = '%s'", restore.SubscriptionName)
+	cmd := exec.CommandContext(ctx, "sudo", "-u", "postgres",
+		fmt.Sprintf("/usr/lib/postgresql/%s/bin/psql", postgresVersion),
+		"-p", fmt.Sprintf("%d", restore.Port), "-d", databaseName, "-Atc", query)
+	output, err := cmd.Output()
+	if err != nil {
+		o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to check restore subscription")
+		return false
+	}
+	return strings.TrimSpace(string(output)) == "1"
+}
+
+// dropReplicationSlot drops a restore's replication slot on the source (best effort)
+// Slots retain WAL on the source until dropped, so they must not outlive their restore
+func (o *Orchestrator) dropReplicationSlot(ctx context.Context, slotName string) {
+	var config models.Config
+	if err := o.db.First(&config).Error; err != nil || config.ConnectionString == "" {
+		return
+	}
+
+	query := fmt.Sprintf("SELECT pg_drop_replication_slot(slot_name) FROM pg_replication_slots WHERE slot_name = '%s'", slotName)
+	cmd := exec.CommandContext(ctx, "sudo", "-u", "postgres",
+		fmt.Sprintf("/usr/lib/postgresql/%s/bin/psql", config.ClusterPostgresVersion()),
+		config.ConnectionString, "-Atc", query)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		o.logger.Warn().
+			Err(err).
+			Str("slot", slotName).
+			Str("output", string(output)).
+			Msg("Failed to drop replication slot on source, drop it manually to release retained WAL")
+	}
+}
@@ -0,0 +1,91 @@
+#!/bin/bash
+# Incremental refresh script for Branchd - applies the source's changes onto an existing restore
+# The restore's subscription is enabled until it has caught up with the source, then parked again
+set -euo pipefail
+
+# Parameters, passed in the environment (never rendered into the script)
+readonly CONNECTION_STRING="${CONNECTION_STRING}"
+readonly PG_VERSION="${PG_VERSION}"
+readonly PG_PORT="${PG_PORT}"
+readonly TARGET_DATABASE="${TARGET_DATABASE}"
+readonly SUBSCRIPTION_NAME="${SUBSCRIPTION_NAME}"
+readonly TIMEOUT_SECONDS="${TIMEOUT_SECONDS}"
+
+readonly PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
+
+log() {
+    echo "$(date '+%Y-%m-%d %H:%M:%S') - $1"
+}
+
+restore_psql() {
+    sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -d "${TARGET_DATABASE}" -v ON_ERROR_STOP=1 -Atc "$1"
+}
+
+source_psql() {
+    sudo -u postgres ${PG_BIN}/psql "${CONNECTION_STRING}" -v ON_ERROR_STOP=1 -Atc "$1"
+}
+
+# Park the subscription without the source's credentials (branches copy the restore's catalog)
+park() {
+    restore_psql "ALTER SUBSCRIPTION ${SUBSCRIPTION_NAME} DISABLE" >/dev/null 2>&1 || true
+    restore_psql "ALTER SUBSCRIPTION ${SUBSCRIPTION_NAME} CONNECTION 'dbname=branchd_disconnected'" >/dev/null 2>&1 || true
+}
+
+die() {
+    log "ERROR: $1" >&2
+    park
+    echo "BRANCHD_ERROR: $1"
+    exit 1
+}
+
+# 1. Make sure the slot still exists (it may have been dropped or invalidated on the source)
+SLOT_EXISTS=$(source_psql "SELECT count(*) FROM pg_replication_slots WHERE slot_name = '${SUBSCRIPTION_NAME}'" 2>&1) \
+    || die "Failed to query replication slot on source: ${SLOT_EXISTS}"
+if [ "${SLOT_EXISTS}" = "0" ]; then
+    die "Replication slot ${SUBSCRIPTION_NAME} no longer exists on the source"
+fi
+# wal_status is PostgreSQL 13+
+if [ "$(source_psql "SELECT wal_status FROM pg_replication_slots WHERE slot_name = '${SUBSCRIPTION_NAME}'" 2>/dev/null || true)" = "lost" ]; then
+    die "Replication slot ${SUBSCRIPTION_NAME} was invalidated on the source (max_slot_wal_keep_size exceeded)"
+fi
+
+# 2. Catch up to the source's current position
+TARGET_LSN=$(source_psql "SELECT pg_current_wal_lsn()") || die "Failed to read source WAL position"
+log "Applying changes up to source LSN ${TARGET_LSN}"
+
+# Apply errors (e.g. a column added on the source) are retried forever by PostgreSQL, count them to fail fast
+APPLY_ERRORS_QUERY="SELECT apply_error_count FROM pg_stat_subscription_stats WHERE subname = '${SUBSCRIPTION_NAME}'"
+INITIAL_APPLY_ERRORS=$(restore_psql "${APPLY_ERRORS_QUERY}" 2>/dev/null || echo "")
+
+# The connection string is a psql variable, quoted by psql as a literal (:'conninfo')
+sudo -u postgres ${PG_BIN}/psql -X -p ${PG_PORT} -d "${TARGET_DATABASE}" -v ON_ERROR_STOP=1 \
+    -v subscription="${SUBSCRIPTION_NAME}" -v conninfo="${CONNECTION_STRING}" >/dev/null <<'SQL' || die "Failed to set subscription connection"
+ALTER SUBSCRIPTION :"subscription" CONNECTION :'conninfo';
+SQL
+restore_psql "ALTER SUBSCRIPTION ${SUBSCRIPTION_NAME} ENABLE" >/dev/null || die "Failed to enable subscription"
+
+START=$(date +%s)
+while true; do
+    CAUGHT_UP=$(source_psql "SELECT confirmed_flush_lsn >= '${TARGET_LSN}'::pg_lsn FROM pg_replication_slots WHERE slot_name = '${SUBSCRIPTION_NAME}'" 2>/dev/null || echo "")
+    if [ "${CAUGHT_UP}" = "t" ]; then
+        break
+    fi
+
+    if [ -n "${INITIAL_APPLY_ERRORS}" ]; then
+        APPLY_ERRORS=$(restore_psql "${APPLY_ERRORS_QUERY}" 2>/dev/null || echo "${INITIAL_APPLY_ERRORS}")
+        if [ "${APPLY_ERRORS}" != "${INITIAL_APPLY_ERRORS}" ]; then
+            die "Applying changes failed (schema changed on the source?), see the restore's postgresql.log"
+        fi
+    fi
+
+    if [ $(($(date +%s) - START)) -ge ${TIMEOUT_SECONDS} ]; then
+        die "Not caught up with the source after ${TIMEOUT_SECONDS}s"
+    fi
+
+    sleep 5
+done
+
+# 3. Park the subscription until the next refresh
+park
+log "Caught up with source LSN ${TARGET_LSN}"
+echo "__BRANCHD_INCREMENTAL_REFRESH_SUCCESS__"
@@ -0,0 +1,33 @@
+package restore
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// maxLabelLength and maxNoteLength bound models.Restore.Label and Note
+const (
+	maxLabelLength = 63
+	maxNoteLength  = 1000
+)
+
+// labelPattern keeps labels usable in filters and shell arguments, e.g. "pre-migration-baseline" or "v2.3_release"
+var labelPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// ValidateLabel checks the label and note of a restore, an empty label is none
+// A pinned restore needs a label, it tells why the restore is kept
+func ValidateLabel(label, note string, pinned bool) error {
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("label must be at most %d characters", maxLabelLength)
+	}
+	if label != "" && !labelPattern.MatchString(label) {
+		return fmt.Errorf("invalid label %q (use lowercase letters, digits, '.', '_' and '-', e.g. pre-migration-baseline)", label)
+	}
+	if len(note) > maxNoteLength {
+		return fmt.Errorf("note must be at most %d characters", maxNoteLength)
+	}
+	if pinned && label == "" {
+		return fmt.Errorf("a pinned restore needs a label")
+	}
+	return nil
+}
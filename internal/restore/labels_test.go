@@ -0,0 +1,35 @@
+package restore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   string
+		note    string
+		pinned  bool
+		wantErr bool
+	}{
+		{name: "no label"},
+		{name: "label", label: "pre-migration-baseline", note: "Before the orders migration"},
+		{name: "dots and underscores", label: "v2.3_release", pinned: true},
+		{name: "uppercase", label: "Baseline", wantErr: true},
+		{name: "spaces", label: "pre migration", wantErr: true},
+		{name: "leading dash", label: "-baseline", wantErr: true},
+		{name: "too long", label: strings.Repeat("a", 64), wantErr: true},
+		{name: "note too long", label: "baseline", note: strings.Repeat("a", 1001), wantErr: true},
+		{name: "pinned without label", pinned: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLabel(tt.label, tt.note, tt.pinned)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateLabel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+// ErrIncompatibleLocale fails restores whose cluster can't match the source's encoding, locale or collation versions
+var ErrIncompatibleLocale = errors.New("restore cluster locale is incompatible with the source")
+
+// sourceLocaleTimeout bounds reading the source's locale before a restore
+const sourceLocaleTimeout = 30 * time.Second
+
+// defaultLocale initializes restore clusters when the source's locale can't be read
+var defaultLocale = pgclient.DatabaseLocale{Encoding: "UTF8", Collate: "C.UTF-8", Ctype: "C.UTF-8", Provider: "libc"}
+
+// localeNamePattern matches encoding and locale names that are safe to render into the restore script
+var localeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.@=-]+$`)
+
+// readSourceLocale reads the encoding and default collation of the source database (replaced in tests)
+var readSourceLocale = pgclient.GetDatabaseLocale
+
+// installedLocales lists the locales installed on this VM, as printed by locale -a (replaced in tests)
+var installedLocales = func(ctx context.Context) ([]string, error) {
+	output, err := exec.CommandContext(ctx, "locale", "-a").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list installed locales: %w", err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// runCollationQuery runs the collation version query on a restore cluster (replaced in tests)
+var runCollationQuery = runReportQuery
+
+// checkSourceLocale reads the source's locale and checks restore clusters can be initialized with it
+// An unreadable source falls back to C.UTF-8, pg_dump then reports why it can't connect
+func (o *Orchestrator) checkSourceLocale(ctx context.Context, config *models.Config) (*pgclient.DatabaseLocale, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, sourceLocaleTimeout)
+	defer cancel()
+
+	locale, err := readSourceLocale(queryCtx, config.ConnectionString)
+	if err != nil {
+		o.logger.Warn().Err(err).Msg("Failed to read source locale, initializing the restore cluster with C.UTF-8")
+		return &defaultLocale, nil
+	}
+
+	installed, err := installedLocales(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLocaleCompatibility(locale, config.ClusterPostgresVersion(), installed); err != nil {
+		return nil, err
+	}
+	return locale, nil
+}
+
+// checkLocaleCompatibility returns an error listing each way a restore cluster of postgresVersion can't mirror the
+// source's locale, with how to fix it
+func checkLocaleCompatibility(locale *pgclient.DatabaseLocale, postgresVersion string, installed []string) error {
+	var problems []string
+	for _, name := range []string{locale.Encoding, locale.Collate, locale.Ctype, locale.Locale} {
+		if name != "" && !localeNamePattern.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("source locale %q is not a valid locale name: create the source database with a standard locale", name))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w:\n%s", ErrIncompatibleLocale, strings.Join(problems, "\n"))
+	}
+
+	major, _ := strconv.Atoi(postgresVersion)
+	switch {
+	case locale.Provider == "icu" && major < 15:
+		problems = append(problems, fmt.Sprintf("source uses the ICU collation %s, PostgreSQL %s clusters only support libc collations: set the target PostgreSQL version to 15 or later",
+			locale.Locale, postgresVersion))
+	case locale.Provider == "builtin" && major < 17:
+		problems = append(problems, fmt.Sprintf("source uses the builtin collation %s, PostgreSQL %s clusters don't support it: set the target PostgreSQL version to 17 or later",
+			locale.Locale, postgresVersion))
+	}
+
+	available := make(map[string]bool, len(installed))
+	for _, name := range installed {
+		available[normalizeLocale(name)] = true
+	}
+	var missing []string
+	for _, name := range []string{locale.Collate, locale.Ctype} {
+		if name == "C" || name == "POSIX" || available[normalizeLocale(name)] || slices.Contains(missing, name) {
+			continue
+		}
+		missing = append(missing, name)
+		problems = append(problems, fmt.Sprintf("source locale %s is not installed on this VM: install it (sudo locale-gen %s) and retry the restore", name, name))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w:\n%s", ErrIncompatibleLocale, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// normalizeLocale normalizes a locale's codeset the way glibc does, so en_US.UTF-8 matches locale -a's en_US.utf8
+func normalizeLocale(name string) string {
+	language, codeset, ok := strings.Cut(name, ".")
+	if !ok {
+		return name
+	}
+	codeset, modifier, hasModifier := strings.Cut(codeset, "@")
+	codeset = strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(codeset))
+	if hasModifier {
+		return language + "." + codeset + "@" + modifier
+	}
+	return language + "." + codeset
+}
+
+// collationVersionQuery lists the collations whose recorded version differs from the version of the VM's glibc or
+// ICU, as kind|name|recorded|actual lines
+// Databases record their default collation's version since PostgreSQL 15
+func collationVersionQuery(postgresVersion string) string {
+	query := `SELECT 'collation', quote_ident(n.nspname) || '.' || quote_ident(c.collname), c.collversion, pg_collation_actual_version(c.oid)
+FROM pg_collation c JOIN pg_namespace n ON n.oid = c.collnamespace
+WHERE c.collversion IS NOT NULL AND c.collversion IS DISTINCT FROM pg_collation_actual_version(c.oid)`
+	if major, _ := strconv.Atoi(postgresVersion); major >= 15 {
+		query += `
+UNION ALL
+SELECT 'database', quote_ident(datname), datcollversion, pg_database_collation_actual_version(oid)
+FROM pg_database
+WHERE datname = current_database() AND datcollversion IS NOT NULL AND datcollversion IS DISTINCT FROM pg_database_collation_actual_version(oid)`
+	}
+	return query + ";"
+}
+
+// collationMismatch is a collation whose recorded version differs from the VM's
+type collationMismatch struct {
+	Kind     string // collation or database
+	Name     string
+	Recorded string
+	Actual   string
+}
+
+// parseCollationMismatches parses the output of collationVersionQuery
+func parseCollationMismatches(output string) []collationMismatch {
+	var mismatches []collationMismatch
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.Split(strings.TrimSpace(line), "|")
+		if len(parts) != 4 {
+			continue
+		}
+		mismatches = append(mismatches, collationMismatch{Kind: parts[0], Name: parts[1], Recorded: parts[2], Actual: parts[3]})
+	}
+	return mismatches
+}
+
+// checkCollationVersions fails restores whose collations were versioned by another glibc or ICU than the VM's
+// Physical restores copy indexes sorted by the source's collation rules, another version silently corrupts them
+// Post-restore SQL runs first, so it can rebuild the indexes and refresh the versions
+func (o *Orchestrator) checkCollationVersions(ctx context.Context, restore *models.Restore, databaseName, postgresVersion string) error {
+	output, err := runCollationQuery(ctx, databaseName, postgresVersion, restore.Port, collationVersionQuery(postgresVersion))
+	if err != nil {
+		o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to check collation versions")
+		return nil
+	}
+
+	mismatches := parseCollationMismatches(output)
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	problems := make([]string, 0, len(mismatches)+1)
+	for _, m := range mismatches {
+		refresh := fmt.Sprintf("ALTER COLLATION %s REFRESH VERSION", m.Name)
+		if m.Kind == "database" {
+			refresh = fmt.Sprintf("ALTER DATABASE %s REFRESH COLLATION VERSION", m.Name)
+		}
+		problems = append(problems, fmt.Sprintf("%s %s has collation version %s, this VM has %s: add REINDEX DATABASE and %s; to the post-restore SQL",
+			m.Kind, m.Name, m.Recorded, m.Actual, refresh))
+	}
+	problems = append(problems, "indexes on text columns may be corrupt until rebuilt, or restore on a VM with the source's glibc and ICU versions")
+	return fmt.Errorf("%w:\n%s", ErrIncompatibleLocale, strings.Join(problems, "\n"))
+}
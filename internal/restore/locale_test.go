@@ -0,0 +1,188 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+func TestCheckLocaleCompatibility(t *testing.T) {
+	installed := []string{"C", "C.utf8", "POSIX", "en_US.utf8", "de_DE@euro"}
+
+	tests := []struct {
+		name    string
+		locale  pgclient.DatabaseLocale
+		version string
+		want    []string // Substrings of the error, nil = compatible
+	}{
+		{name: "default", locale: defaultLocale, version: "16"},
+		{name: "C locale", locale: pgclient.DatabaseLocale{Encoding: "SQL_ASCII", Collate: "C", Ctype: "POSIX", Provider: "libc"}, version: "14"},
+		{name: "installed libc locale", locale: pgclient.DatabaseLocale{Encoding: "UTF8", Collate: "en_US.UTF-8", Ctype: "en_US.UTF-8", Provider: "libc"}, version: "16"},
+		{name: "ICU on 15", locale: pgclient.DatabaseLocale{Encoding: "UTF8", Collate: "C.UTF-8", Ctype: "C.UTF-8", Provider: "icu", Locale: "en-US"}, version: "15"},
+		{
+			name:    "missing locale",
+			locale:  pgclient.DatabaseLocale{Encoding: "LATIN1", Collate: "fr_FR.ISO-8859-1", Ctype: "fr_FR.ISO-8859-1", Provider: "libc"},
+			version: "16",
+			want:    []string{"fr_FR.ISO-8859-1 is not installed", "sudo locale-gen fr_FR.ISO-8859-1"},
+		},
+		{
+			name:    "ICU before 15",
+			locale:  pgclient.DatabaseLocale{Encoding: "UTF8", Collate: "en_US.UTF-8", Ctype: "en_US.UTF-8", Provider: "icu", Locale: "en-US"},
+			version: "14",
+			want:    []string{"ICU collation en-US", "15 or later"},
+		},
+		{
+			name:    "builtin before 17",
+			locale:  pgclient.DatabaseLocale{Encoding: "UTF8", Collate: "C.UTF-8", Ctype: "C.UTF-8", Provider: "builtin", Locale: "C.UTF-8"},
+			version: "16",
+			want:    []string{"builtin collation C.UTF-8", "17 or later"},
+		},
+		{
+			name:    "unsafe name",
+			locale:  pgclient.DatabaseLocale{Encoding: "UTF8", Collate: `en_US"; rm -rf /`, Ctype: "C", Provider: "libc"},
+			version: "16",
+			want:    []string{"is not a valid locale name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLocaleCompatibility(&tt.locale, tt.version, installed)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("checkLocaleCompatibility() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrIncompatibleLocale) {
+				t.Fatalf("checkLocaleCompatibility() error = %v, want ErrIncompatibleLocale", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSourceLocale(t *testing.T) {
+	o := newTestOrchestrator(t)
+	config := &models.Config{ConnectionString: "postgres://source/app", PostgresVersion: "16"}
+
+	originalRead, originalInstalled := readSourceLocale, installedLocales
+	t.Cleanup(func() { readSourceLocale, installedLocales = originalRead, originalInstalled })
+	installedLocales = func(context.Context) ([]string, error) { return []string{"C.utf8", "en_US.utf8"}, nil }
+
+	// An unreachable source falls back to C.UTF-8
+	readSourceLocale = func(context.Context, string) (*pgclient.DatabaseLocale, error) {
+		return nil, errors.New("connection refused")
+	}
+	locale, err := o.checkSourceLocale(context.Background(), config)
+	if err != nil || !reflect.DeepEqual(*locale, defaultLocale) {
+		t.Fatalf("checkSourceLocale() = %+v, %v, want the default locale", locale, err)
+	}
+
+	source := pgclient.DatabaseLocale{Encoding: "UTF8", Collate: "en_US.UTF-8", Ctype: "en_US.UTF-8", Provider: "libc"}
+	readSourceLocale = func(context.Context, string) (*pgclient.DatabaseLocale, error) { return &source, nil }
+	if locale, err = o.checkSourceLocale(context.Background(), config); err != nil || *locale != source {
+		t.Fatalf("checkSourceLocale() = %+v, %v, want the source locale", locale, err)
+	}
+
+	source.Collate = "ja_JP.UTF-8"
+	if _, err := o.checkSourceLocale(context.Background(), config); !errors.Is(err, ErrIncompatibleLocale) {
+		t.Fatalf("checkSourceLocale() error = %v, want ErrIncompatibleLocale", err)
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := map[string]string{
+		"C":                "C",
+		"C.UTF-8":          "C.utf8",
+		"en_US.utf8":       "en_US.utf8",
+		"fr_FR.ISO-8859-1": "fr_FR.iso88591",
+		"de_DE.UTF-8@euro": "de_DE.utf8@euro",
+	}
+	for name, want := range tests {
+		if got := normalizeLocale(name); got != want {
+			t.Errorf("normalizeLocale(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCollationVersionQuery(t *testing.T) {
+	if query := collationVersionQuery("14"); strings.Contains(query, "datcollversion") {
+		t.Error("PostgreSQL 14 query checks datcollversion, which was added in 15")
+	}
+	if query := collationVersionQuery("16"); !strings.Contains(query, "pg_database_collation_actual_version") {
+		t.Error("PostgreSQL 16 query doesn't check the database collation version")
+	}
+}
+
+func TestCheckCollationVersions(t *testing.T) {
+	o := newTestOrchestrator(t)
+	restore := &models.Restore{BaseModel: models.BaseModel{ID: "r1"}, Port: 5433}
+
+	original := runCollationQuery
+	t.Cleanup(func() { runCollationQuery = original })
+
+	runCollationQuery = func(context.Context, string, string, int, string) (string, error) { return "\n", nil }
+	if err := o.checkCollationVersions(context.Background(), restore, "app", "16"); err != nil {
+		t.Fatalf("checkCollationVersions() error = %v, want nil without mismatches", err)
+	}
+
+	runCollationQuery = func(context.Context, string, string, int, string) (string, error) {
+		return "collation|public.\"en-x-icu\"|153.112|153.120\ndatabase|app|2.31|2.35\n", nil
+	}
+	err := o.checkCollationVersions(context.Background(), restore, "app", "16")
+	if !errors.Is(err, ErrIncompatibleLocale) {
+		t.Fatalf("checkCollationVersions() error = %v, want ErrIncompatibleLocale", err)
+	}
+	for _, want := range []string{
+		"database app has collation version 2.31, this VM has 2.35",
+		"ALTER DATABASE app REFRESH COLLATION VERSION",
+		`ALTER COLLATION public."en-x-icu" REFRESH VERSION`,
+		"REINDEX DATABASE",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't contain %q", err, want)
+		}
+	}
+
+	// A cluster that can't be queried doesn't block the restore
+	runCollationQuery = func(context.Context, string, string, int, string) (string, error) {
+		return "", errors.New("connection refused")
+	}
+	if err := o.checkCollationVersions(context.Background(), restore, "app", "16"); err != nil {
+		t.Fatalf("checkCollationVersions() error = %v, want nil when the query fails", err)
+	}
+}
+
+func TestLogicalRestoreScriptLocale(t *testing.T) {
+	env := scriptEnv(logicalRestoreParams{
+		SourceDatabaseName: "app",
+		Encoding:           "UTF8",
+		LcCollate:          "en_US.UTF-8",
+		LcCtype:            "en_US.UTF-8",
+		LocaleProvider:     "icu",
+		ProviderLocale:     "en-US",
+	})
+
+	for name, want := range map[string]string{
+		"SOURCE_LC_COLLATE":      "en_US.UTF-8",
+		"SOURCE_LOCALE_PROVIDER": "icu",
+		"SOURCE_PROVIDER_LOCALE": "en-US",
+	} {
+		if env[name] != want {
+			t.Errorf("%s = %q, want %q", name, env[name], want)
+		}
+	}
+	if !strings.Contains(logicalRestoreScript, `"${INITDB_LOCALE_FLAGS[@]}"`) {
+		t.Error("script doesn't pass the locale flags to initdb")
+	}
+}
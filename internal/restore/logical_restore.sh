@@ -2,15 +2,32 @@
 # pg_dump/restore Script for Branchd - Each restore is a separate PostgreSQL cluster
 set -euo pipefail
 
-# Configuration from template
-readonly CONNECTION_STRING="{{.ConnectionString}}"
-readonly PG_VERSION="{{.PgVersion}}"
-readonly PG_PORT="{{.PgPort}}"
-readonly DATABASE_NAME="{{.DatabaseName}}"
-readonly SCHEMA_ONLY="{{.SchemaOnly}}"
-readonly PARALLEL_JOBS="{{.ParallelJobs}}"
-readonly DUMP_FILE="{{.DumpDir}}"      # e.g., /opt/branchd/restore_20250915120000/dump.pgdump
-readonly DATA_DIR="{{.DataDir}}"       # e.g., /opt/branchd/restore_20250915120000/data
+# Parameters, passed in the environment (never rendered into the script)
+readonly CONNECTION_STRING="${CONNECTION_STRING}"
+readonly PG_VERSION="${PG_VERSION}"
+readonly PG_PORT="${PG_PORT}"
+readonly DATABASE_NAME="${DATABASE_NAME}"
+readonly SOURCE_HOST="${SOURCE_HOST}" # host:port without credentials, recorded as provenance
+readonly SCHEMA_ONLY="${SCHEMA_ONLY}"
+readonly PARALLEL_JOBS="${PARALLEL_JOBS}"
+readonly DUMP_FILE="${DUMP_FILE}"      # e.g., /opt/branchd/restore_20250915120000/dump.pgdump
+readonly DATA_DIR="${DATA_DIR}"       # e.g., /opt/branchd/restore_20250915120000/data
+readonly ZFS_DATASET="${ZFS_DATASET}" # e.g., tank/restore_20250915120000
+readonly WAL_DATASET="${WAL_DATASET}" # e.g., nvme/wal/restore_20250915120000 (empty = pg_wal inside DATA_DIR)
+readonly WAL_DIR="${WAL_DIR}"         # e.g., /opt/branchd-wal/restore_20250915120000/pg_wal
+readonly SUBSCRIPTION_NAME="${SUBSCRIPTION_NAME}" # Set up logical replication for incremental refreshes (empty = full refresh only)
+readonly PUBLICATION_NAME="${PUBLICATION_NAME}"
+readonly SOURCE_ENCODING="${SOURCE_ENCODING}"              # Source encoding and default collation, mirrored by initdb
+readonly SOURCE_LC_COLLATE="${SOURCE_LC_COLLATE}"
+readonly SOURCE_LC_CTYPE="${SOURCE_LC_CTYPE}"
+readonly SOURCE_LOCALE_PROVIDER="${SOURCE_LOCALE_PROVIDER}" # libc, icu or builtin
+readonly SOURCE_PROVIDER_LOCALE="${SOURCE_PROVIDER_LOCALE}" # ICU or builtin locale (empty for libc)
+readonly PRIORITY_DIRECTIVES="${PRIORITY_DIRECTIVES}" # systemd [Service] priority directives of the cluster unit
+readonly SOURCE_DATABASE_NAME="${SOURCE_DATABASE_NAME}" # Database restored into, named like the source database
+readonly TABLE_SAMPLES="${TABLE_SAMPLES}" # "<rows> <table>" per line, tables copied with a row limit after the restore
+readonly TUNE_SQL="${TUNE_SQL}"           # ALTER SYSTEM statements applied while restoring, one per line
+readonly RESET_SQL="${RESET_SQL}"         # ALTER SYSTEM statements resetting them
+# pg_dump table filter flags are the script's arguments
 
 # Paths
 readonly RESTORE_LOG_DIR="/var/log/branchd"
@@ -18,7 +35,6 @@ readonly RESTORE_LOG="${RESTORE_LOG_DIR}/restore-${DATABASE_NAME}.log"
 readonly RESTORE_PID="${RESTORE_LOG_DIR}/restore-${DATABASE_NAME}.pid"
 readonly PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
 readonly RESTORE_DATASET_PATH=$(dirname "${DATA_DIR}")  # /opt/branchd/restore_YYYYMMDDHHMMSS
-readonly ZFS_DATASET="tank/${DATABASE_NAME}"
 readonly SERVICE_NAME="branchd-restore-${DATABASE_NAME}"
 
 # Helper functions
@@ -26,6 +42,21 @@ log() {
     echo "$(date '+%Y-%m-%d %H:%M:%S') - $1"
 }
 
+# Provenance lines are parsed from the restore log once the restore succeeded (see restore.ReadProvenance)
+provenance() {
+    echo "__BRANCHD_PROVENANCE__ $1=$2"
+}
+
+# Phase lines move the restore's state while it runs (see restore.ReadPhase)
+phase() {
+    echo "__BRANCHD_PHASE__ $1"
+}
+
+# WAL position of the source (replayed position on a standby), empty if it can't be read
+source_lsn() {
+    sudo -u postgres ${PG_BIN}/psql "${CONNECTION_STRING}" -XAtc "SELECT CASE WHEN pg_is_in_recovery() THEN pg_last_wal_replay_lsn() ELSE pg_current_wal_lsn() END" 2>/dev/null || true
+}
+
 die() {
     log "ERROR: $1" >&2
 
@@ -46,7 +77,7 @@ die() {
     # Clean up dump file
     if [ -f "${DUMP_FILE}" ]; then
         log "Cleaning up dump file..."
-        rm -f "${DUMP_FILE}" 2>/dev/null || log "Warning: Could not remove dump file"
+        rm -f "${DUMP_FILE}" "${DUMP_FILE}.sha256" 2>/dev/null || log "Warning: Could not remove dump file"
     fi
 
     # Destroy ZFS dataset if it was created
@@ -55,6 +86,18 @@ die() {
         sudo zfs destroy -r "${ZFS_DATASET}" 2>/dev/null || log "Warning: Could not destroy ZFS dataset"
     fi
 
+    # Destroy WAL dataset if it was created
+    if [ -n "${WAL_DATASET}" ] && sudo zfs list "${WAL_DATASET}" >/dev/null 2>&1; then
+        log "Destroying WAL dataset..."
+        sudo zfs destroy -r "${WAL_DATASET}" 2>/dev/null || log "Warning: Could not destroy WAL dataset"
+    fi
+
+    # Drop the replication slot on the source, it would retain WAL forever
+    if [ "${SLOT_CREATED:-false}" = "true" ]; then
+        log "Dropping replication slot on source..."
+        sudo -u postgres ${PG_BIN}/psql "${CONNECTION_STRING}" -Atc "SELECT pg_drop_replication_slot('${SUBSCRIPTION_NAME}')" >/dev/null 2>&1 || log "Warning: Could not drop replication slot ${SUBSCRIPTION_NAME} on source"
+    fi
+
     # Write failure marker
     echo '__BRANCHD_RESTORE_FAILED__' >> "${RESTORE_LOG}"
     sync
@@ -68,6 +111,7 @@ die() {
 log "Starting restore: ${DATABASE_NAME}"
 log "PostgreSQL version: ${PG_VERSION}, Port: ${PG_PORT}"
 log "Data directory: ${DATA_DIR}"
+log "WAL directory: ${WAL_DIR:-${DATA_DIR}/pg_wal}"
 log "Dump file: ${DUMP_FILE}"
 
 # 1. Create ZFS dataset for this restore
@@ -77,10 +121,27 @@ if sudo zfs list "${ZFS_DATASET}" >/dev/null 2>&1; then
     sudo zfs destroy -r "${ZFS_DATASET}" || die "Failed to destroy existing ZFS dataset"
 fi
 
-sudo zfs create "${ZFS_DATASET}" || die "Failed to create ZFS dataset"
+sudo zfs create -p "${ZFS_DATASET}" || die "Failed to create ZFS dataset"
 sudo zfs set mountpoint="${RESTORE_DATASET_PATH}" "${ZFS_DATASET}"
 log "ZFS dataset created and mounted at ${RESTORE_DATASET_PATH}"
 
+# 1b. Create WAL dataset on the separate device (if configured)
+INITDB_WAL_FLAG=""
+if [ -n "${WAL_DATASET}" ]; then
+    readonly WAL_DATASET_PATH=$(dirname "${WAL_DIR}")  # /opt/branchd-wal/restore_YYYYMMDDHHMMSS
+    log "Creating WAL dataset: ${WAL_DATASET}"
+    if sudo zfs list "${WAL_DATASET}" >/dev/null 2>&1; then
+        log "WAL dataset already exists, destroying and recreating..."
+        sudo zfs destroy -r "${WAL_DATASET}" || die "Failed to destroy existing WAL dataset"
+    fi
+
+    sudo zfs create -p "${WAL_DATASET}" || die "Failed to create WAL dataset"
+    sudo zfs set mountpoint="${WAL_DATASET_PATH}" "${WAL_DATASET}"
+    sudo chown -R postgres:postgres "${WAL_DATASET_PATH}"
+    INITDB_WAL_FLAG="--waldir=${WAL_DIR}"
+    log "WAL dataset created and mounted at ${WAL_DATASET_PATH}"
+fi
+
 # 2. Create data directory and set ownership
 log "Creating data directory..."
 sudo mkdir -p "${DATA_DIR}" || die "Failed to create data directory"
@@ -89,10 +150,17 @@ log "Data directory created with postgres ownership"
 
 # 3. Initialize PostgreSQL cluster with initdb
 log "Initializing PostgreSQL cluster with initdb..."
+# Mirror the source's encoding and collation, pg_restore can't convert text between them
+INITDB_LOCALE_FLAGS=(--encoding="${SOURCE_ENCODING}" --locale=C.UTF-8 --lc-collate="${SOURCE_LC_COLLATE}" --lc-ctype="${SOURCE_LC_CTYPE}")
+case "${SOURCE_LOCALE_PROVIDER}" in
+    icu) INITDB_LOCALE_FLAGS+=(--locale-provider=icu --icu-locale="${SOURCE_PROVIDER_LOCALE}") ;;
+    builtin) INITDB_LOCALE_FLAGS+=(--locale-provider=builtin --builtin-locale="${SOURCE_PROVIDER_LOCALE}") ;;
+esac
+log "Cluster locale: encoding ${SOURCE_ENCODING}, collate ${SOURCE_LC_COLLATE}, ctype ${SOURCE_LC_CTYPE}, provider ${SOURCE_LOCALE_PROVIDER} ${SOURCE_PROVIDER_LOCALE}"
 sudo -u postgres ${PG_BIN}/initdb -D "${DATA_DIR}" \
-    --encoding=UTF8 \
-    --locale=C.UTF-8 \
+    "${INITDB_LOCALE_FLAGS[@]}" \
     --data-checksums \
+    ${INITDB_WAL_FLAG} \
     || die "Failed to initialize PostgreSQL cluster with initdb"
 log "PostgreSQL cluster initialized successfully"
 
@@ -178,6 +246,8 @@ TimeoutStartSec=300
 TimeoutStopSec=300
 Restart=on-failure
 RestartSec=5s
+# Run below branches so refreshes don't degrade interactive work (see POST /api/restores/:id/boost)
+${PRIORITY_DIRECTIVES}
 
 [Install]
 WantedBy=multi-user.target
@@ -210,9 +280,9 @@ done
 
 # 7. Apply performance optimizations for restore
 log "Applying performance optimizations (parallel_jobs=${PARALLEL_JOBS})..."
-{{range .TuneSQL}}
-sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -c "{{.}}" 2>&1 || log "Warning: Could not apply tuning parameter"
-{{end}}
+while IFS= read -r -u 3 statement; do
+    sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -c "${statement}" 2>&1 || log "Warning: Could not apply tuning parameter"
+done 3<<< "${TUNE_SQL}"
 sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -c "SELECT pg_reload_conf()" 2>&1 || log "Warning: Could not reload config"
 
 # 8. Start pg_dump from source database
@@ -232,9 +302,46 @@ if [ "${SCHEMA_ONLY}" = "true" ]; then
     DUMP_FLAGS="${DUMP_FLAGS} --schema-only"
 fi
 
+# Table filters (quoted so wildcard patterns are passed to pg_dump, not expanded by the shell)
+TABLE_FILTER_FLAGS=("$@")
+if [ ${#TABLE_FILTER_FLAGS[@]} -gt 0 ]; then
+    log "Table filters: ${TABLE_FILTER_FLAGS[*]}"
+fi
+
+# Incremental refreshes: publish all tables on the source and create the slot before dumping
+# WHY: The slot is created first so no change made after the dump's snapshot is lost,
+# the initial data is then copied by the subscription instead of pg_dump
+INCREMENTAL=false
+if [ -n "${SUBSCRIPTION_NAME}" ] && [ "${SCHEMA_ONLY}" != "true" ]; then
+    log "Setting up logical replication on source for incremental refreshes..."
+    WAL_LEVEL=$(sudo -u postgres ${PG_BIN}/psql "${CONNECTION_STRING}" -Atc "SHOW wal_level" 2>&1 || true)
+    if [ "${WAL_LEVEL}" != "logical" ]; then
+        log "Warning: source wal_level is '${WAL_LEVEL}' (needs 'logical'), falling back to a full data restore"
+    elif ! sudo -u postgres ${PG_BIN}/psql "${CONNECTION_STRING}" -v ON_ERROR_STOP=1 -c "DO \$\$ BEGIN IF NOT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = '${PUBLICATION_NAME}') THEN CREATE PUBLICATION ${PUBLICATION_NAME} FOR ALL TABLES; END IF; END \$\$" 2>&1; then
+        log "Warning: could not create publication ${PUBLICATION_NAME} on source (needs superuser), falling back to a full data restore"
+    elif ! sudo -u postgres ${PG_BIN}/psql "${CONNECTION_STRING}" -v ON_ERROR_STOP=1 -Atc "SELECT pg_create_logical_replication_slot('${SUBSCRIPTION_NAME}', 'pgoutput')" 2>&1; then
+        log "Warning: could not create replication slot on source (needs REPLICATION privilege), falling back to a full data restore"
+    else
+        SLOT_CREATED=true
+        INCREMENTAL=true
+        DUMP_FLAGS="${DUMP_FLAGS} --schema-only"
+        log "Replication slot ${SUBSCRIPTION_NAME} created, data will be copied by logical replication"
+    fi
+fi
+
+# Record which source state the dump is taken from
+provenance method logical
+provenance source_host "${SOURCE_HOST}"
+provenance source_database "${SOURCE_DATABASE_NAME}"
+provenance source_version "$(sudo -u postgres ${PG_BIN}/psql "${CONNECTION_STRING}" -XAtc "SHOW server_version" 2>/dev/null || true)"
+provenance source_system_identifier "$(sudo -u postgres ${PG_BIN}/psql "${CONNECTION_STRING}" -XAtc "SELECT system_identifier FROM pg_control_system()" 2>/dev/null || true)"
+provenance dump_tool "$(${PG_BIN}/pg_dump --version)"
+provenance restore_tool "$(${PG_BIN}/pg_restore --version)"
+provenance start_lsn "$(source_lsn)"
+
 # Run pg_dump to file
 set +e
-sudo -u postgres ${PG_BIN}/pg_dump "${CONNECTION_STRING}" ${DUMP_FLAGS} --file="${DUMP_FILE}" 2>&1
+sudo -u postgres ${PG_BIN}/pg_dump "${CONNECTION_STRING}" ${DUMP_FLAGS} "${TABLE_FILTER_FLAGS[@]}" --file="${DUMP_FILE}" 2>&1
 PGDUMP_EXIT=$?
 set -e
 
@@ -244,17 +351,34 @@ if [ ${PGDUMP_EXIT} -ne 0 ]; then
     die "pg_dump failed with exit code ${PGDUMP_EXIT}"
 fi
 
+# pg_dump's snapshot was taken between start_lsn and end_lsn
+provenance end_lsn "$(source_lsn)"
+
+# Checksum the dump, it's verified before pg_restore reads it
+log "Computing dump checksum..."
+DUMP_SHA256=$(sudo -u postgres sha256sum "${DUMP_FILE}" | cut -d' ' -f1) || die "Failed to compute dump checksum"
+DUMP_SIZE=$(sudo -u postgres stat -c %s "${DUMP_FILE}") || die "Failed to read dump size"
+echo "${DUMP_SHA256}  ${DUMP_FILE}" | sudo -u postgres tee "${DUMP_FILE}.sha256" > /dev/null
+provenance artifact "$(basename "${DUMP_FILE}"):${DUMP_SIZE}:${DUMP_SHA256}"
+log "Dump checksum (sha256): ${DUMP_SHA256}, size: ${DUMP_SIZE} bytes"
+
 # 9. Create target database (same name as source)
-log "Creating target database: {{.SourceDatabaseName}}"
-sudo -u postgres ${PG_BIN}/createdb -p ${PG_PORT} "{{.SourceDatabaseName}}" || log "Database may already exist"
+log "Creating target database: ${SOURCE_DATABASE_NAME}"
+sudo -u postgres ${PG_BIN}/createdb -p ${PG_PORT} "${SOURCE_DATABASE_NAME}" || log "Database may already exist"
 
 # 10. Three-Phase Restore
+phase restoring
+
+# The dump must be what pg_dump wrote, e.g. not truncated by a full disk or corrupted since
+log "Verifying dump checksum..."
+sudo -u postgres sha256sum --check --status "${DUMP_FILE}.sha256" || die "Dump checksum mismatch, ${DUMP_FILE} changed after pg_dump"
+provenance checksums_verified true
 
 # Phase 1: Schema
 log "Phase 1/3: Restoring schema..."
 SCHEMA_FLAGS="--format=custom --section=pre-data --no-owner --no-acl --verbose"
 set +e
-sudo -u postgres ${PG_BIN}/pg_restore ${SCHEMA_FLAGS} --dbname="{{.SourceDatabaseName}}" --port=${PG_PORT} "${DUMP_FILE}" 2>&1
+sudo -u postgres ${PG_BIN}/pg_restore ${SCHEMA_FLAGS} --dbname="${SOURCE_DATABASE_NAME}" --port=${PG_PORT} "${DUMP_FILE}" 2>&1
 SCHEMA_EXIT=$?
 set -e
 
@@ -265,11 +389,24 @@ if [ ${SCHEMA_EXIT} -gt 1 ]; then
 fi
 
 # Phase 2: Data (parallel)
+# Incremental restores get their data from the subscription once indexes exist (replica identity lookups need them)
+# The dump's table data entries and their size on the source are listed first, restore progress is estimated from
+# them and pg_restore's verbose output (see restore.Progress)
+if [ "${INCREMENTAL}" != "true" ]; then
+    sudo -u postgres ${PG_BIN}/pg_restore --list "${DUMP_FILE}" 2>/dev/null \
+        | awk '$4 == "TABLE" && $5 == "DATA" { sub(";", "", $1); print "__BRANCHD_TABLE_DATA__ " $1 " " $6 "." $7 }' || true
+    sudo -u postgres ${PG_BIN}/psql "${CONNECTION_STRING}" -XAtc "SELECT '__BRANCHD_TABLE_SIZE__ ' || n.nspname || '.' || c.relname || ' ' || pg_table_size(c.oid) FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE c.relkind = 'r' AND n.nspname NOT IN ('pg_catalog', 'information_schema')" 2>/dev/null || true
+fi
 log "Phase 2/3: Loading data (parallel, jobs=${PARALLEL_JOBS})..."
 DATA_FLAGS="--format=custom --section=data --jobs=${PARALLEL_JOBS} --no-owner --no-acl --verbose"
 set +e
-sudo -u postgres ${PG_BIN}/pg_restore ${DATA_FLAGS} --dbname="{{.SourceDatabaseName}}" --port=${PG_PORT} "${DUMP_FILE}" 2>&1
-DATA_EXIT=$?
+if [ "${INCREMENTAL}" = "true" ]; then
+    log "Skipping data section, copied by logical replication after phase 3"
+    DATA_EXIT=0
+else
+    sudo -u postgres ${PG_BIN}/pg_restore ${DATA_FLAGS} --dbname="${SOURCE_DATABASE_NAME}" --port=${PG_PORT} "${DUMP_FILE}" 2>&1
+    DATA_EXIT=$?
+fi
 set -e
 
 log "Phase 2 completed with exit code: ${DATA_EXIT}"
@@ -282,7 +419,7 @@ fi
 log "Phase 3/3: Building indexes and constraints (parallel, jobs=${PARALLEL_JOBS})..."
 POSTDATA_FLAGS="--format=custom --section=post-data --jobs=${PARALLEL_JOBS} --no-owner --no-acl --verbose"
 set +e
-sudo -u postgres ${PG_BIN}/pg_restore ${POSTDATA_FLAGS} --dbname="{{.SourceDatabaseName}}" --port=${PG_PORT} "${DUMP_FILE}" 2>&1
+sudo -u postgres ${PG_BIN}/pg_restore ${POSTDATA_FLAGS} --dbname="${SOURCE_DATABASE_NAME}" --port=${PG_PORT} "${DUMP_FILE}" 2>&1
 POSTDATA_EXIT=$?
 set -e
 
@@ -297,18 +434,59 @@ log "  Phase 1 (schema):  exit code ${SCHEMA_EXIT}"
 log "  Phase 2 (data):    exit code ${DATA_EXIT} (${PARALLEL_JOBS} parallel jobs)"
 log "  Phase 3 (indexes): exit code ${POSTDATA_EXIT} (${PARALLEL_JOBS} parallel jobs)"
 
+# Sampled tables (dumped without data, copy a limited number of rows from the source)
+# WHY: session_replication_role = replica skips foreign key checks, sampled rows may reference rows that weren't copied
+if [ "${SCHEMA_ONLY}" != "true" ] && [ -n "${TABLE_SAMPLES}" ]; then
+    while read -r -u 3 rows table; do
+        log "Sampling ${rows} rows of ${table}..."
+        sudo -u postgres ${PG_BIN}/psql "${CONNECTION_STRING}" -v ON_ERROR_STOP=1 -c "\copy (SELECT * FROM ${table} LIMIT ${rows}) TO STDOUT" \
+            | sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -d "${SOURCE_DATABASE_NAME}" -v ON_ERROR_STOP=1 -c "SET session_replication_role = replica" -c "\copy ${table} FROM pstdin" 2>&1 \
+            || die "Failed to sample table ${table}"
+    done 3<<< "${TABLE_SAMPLES}"
+fi
+# Phase 2b: Initial data copy via logical replication (incremental refreshes)
+if [ "${INCREMENTAL}" = "true" ]; then
+    log "Creating subscription ${SUBSCRIPTION_NAME}..."
+    # The connection string is a psql variable, quoted by psql as a literal (:'conninfo')
+    sudo -u postgres ${PG_BIN}/psql -X -p ${PG_PORT} -d "${SOURCE_DATABASE_NAME}" -v ON_ERROR_STOP=1 \
+        -v subscription="${SUBSCRIPTION_NAME}" -v publication="${PUBLICATION_NAME}" -v conninfo="${CONNECTION_STRING}" 2>&1 <<'SQL' || die "Failed to create subscription"
+CREATE SUBSCRIPTION :"subscription" CONNECTION :'conninfo' PUBLICATION :"publication"
+    WITH (create_slot = false, slot_name = :'subscription', copy_data = true);
+SQL
+
+    log "Waiting for the initial table copy to finish..."
+    while true; do
+        PENDING=$(sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -d "${SOURCE_DATABASE_NAME}" -Atc \
+            "SELECT count(*) FROM pg_subscription_rel r JOIN pg_subscription s ON s.oid = r.srsubid WHERE s.subname = '${SUBSCRIPTION_NAME}' AND r.srsubstate <> 'r'") \
+            || die "Failed to check subscription state"
+        if [ "${PENDING}" = "0" ]; then
+            break
+        fi
+        log "Initial copy in progress (${PENDING} tables remaining)..."
+        sleep 10
+    done
+
+    # Park the subscription between refreshes, without the source's credentials
+    # WHY: Branches and clones copy the restore's catalog, including pg_subscription
+    sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -d "${SOURCE_DATABASE_NAME}" -v ON_ERROR_STOP=1 \
+        -c "ALTER SUBSCRIPTION ${SUBSCRIPTION_NAME} DISABLE" \
+        -c "ALTER SUBSCRIPTION ${SUBSCRIPTION_NAME} CONNECTION 'dbname=branchd_disconnected'" 2>&1 \
+        || die "Failed to disable subscription"
+    log "Initial copy complete, subscription ${SUBSCRIPTION_NAME} parked until the next incremental refresh"
+fi
+
 # 10. Clean up dump file
 log "Cleaning up dump file..."
 if [ -f "${DUMP_FILE}" ]; then
-    rm -f "${DUMP_FILE}" || log "Warning: Could not remove dump file"
+    rm -f "${DUMP_FILE}" "${DUMP_FILE}.sha256" || log "Warning: Could not remove dump file"
     log "Dump file removed"
 fi
 
 # 11. Reset performance optimizations
 log "Resetting performance optimizations..."
-{{range .ResetSQL}}
-sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -c "{{.}}" 2>&1 || log "Warning: Could not reset parameter"
-{{end}}
+while IFS= read -r -u 3 statement; do
+    sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -c "${statement}" 2>&1 || log "Warning: Could not reset parameter"
+done 3<<< "${RESET_SQL}"
 sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -c "SELECT pg_reload_conf()" 2>&1 || log "Warning: Could not reload config"
 
 log "PostgreSQL restore completed successfully [schema_only=${SCHEMA_ONLY}]"
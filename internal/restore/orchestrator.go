@@ -3,7 +3,6 @@ package restore
 import (
 	"context"
 	"fmt"
-	"os/exec"
 	"time"
 
 	"github.com/robfig/cron/v3"
@@ -11,7 +10,9 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/branchd-dev/branchd/internal/anonymize"
+	"github.com/branchd-dev/branchd/internal/config"
 	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
 )
 
 // Orchestrator coordinates all restore operations
@@ -20,15 +21,17 @@ type Orchestrator struct {
 	db             *gorm.DB
 	processManager *ProcessManager
 	resources      *ResourceManager
+	priority       config.PriorityConfig
 	logger         zerolog.Logger
 }
 
 // NewOrchestrator creates a new restore orchestrator
-func NewOrchestrator(db *gorm.DB, logger zerolog.Logger) *Orchestrator {
+func NewOrchestrator(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *Orchestrator {
 	return &Orchestrator{
 		db:             db,
 		processManager: NewProcessManager(logger),
-		resources:      NewResourceManager(logger),
+		resources:      NewResourceManager(cfg.Storage, logger),
+		priority:       cfg.RestorePriority,
 		logger:         logger.With().Str("component", "restore_orchestrator").Logger(),
 	}
 }
@@ -40,12 +43,16 @@ func (o *Orchestrator) SelectProvider(config *models.Config) (Provider, Provider
 		return NewCrunchyBridgeProvider(o.logger), ProviderTypeCrunchyBridge, nil
 	}
 
+	if config.UsesPgBackRest() {
+		return NewPgBackRestProvider(o.logger), ProviderTypePgBackRest, nil
+	}
+
 	// Fallback to logical restore
 	if config.ConnectionString != "" {
 		return NewLogicalProvider(o.logger), ProviderTypeLogical, nil
 	}
 
-	return nil, "", fmt.Errorf("no restore source configured (need either ConnectionString or CrunchyBridge credentials)")
+	return nil, "", fmt.Errorf("no restore source configured (need either ConnectionString, CrunchyBridge credentials or a pgBackRest repository)")
 }
 
 // Start begins a restore operation
@@ -66,7 +73,27 @@ func (o *Orchestrator) Start(ctx context.Context, restoreID string) error {
 	// Select appropriate provider based on config
 	provider, providerType, err := o.SelectProvider(&config)
 	if err != nil {
-		return fmt.Errorf("failed to select restore provider: %w", err)
+		err = fmt.Errorf("failed to select restore provider: %w", err)
+		if failErr := o.Fail(ctx, restore.ID, err.Error()); failErr != nil {
+			o.logger.Error().Err(failErr).Str("restore_id", restore.ID).Msg("Failed to mark restore as failed")
+		}
+		return err
+	}
+
+	// Leave the queue even if starting fails, a failed restore must not block the ones queued after it
+	// A retried start finds the restore dumping or restoring, its process may already be running (checked below)
+	switch restore.State {
+	case models.RestoreStatePending:
+		state := models.RestoreStateRestoring
+		if providerType == ProviderTypeLogical {
+			state = models.RestoreStateDumping
+		}
+		if err := Transition(o.db, &restore, state, nil); err != nil {
+			return err
+		}
+	case models.RestoreStateDumping, models.RestoreStateRestoring:
+	default:
+		return fmt.Errorf("%w: restore %s is %s, can't start", ErrInvalidTransition, restore.Name, restore.State)
 	}
 
 	o.logger.Info().
@@ -80,17 +107,68 @@ func (o *Orchestrator) Start(ctx context.Context, restoreID string) error {
 		return fmt.Errorf("provider validation failed: %w", err)
 	}
 
+	// Fail fast instead of letting pg_restore run out of space halfway
+	if err := o.checkRestoreSpace(ctx, &restore, &config, providerType); err != nil {
+		if failErr := o.Fail(ctx, restore.ID, err.Error()); failErr != nil {
+			o.logger.Error().Err(failErr).Str("restore_id", restore.ID).Msg("Failed to mark restore as failed")
+		}
+		return err
+	}
+
+	// Missing extension packages would only fail the restore after the whole dump, check them first
+	if err := checkExtensionsInstalled(config.Extensions, config.ClusterPostgresVersion()); err != nil {
+		if failErr := o.Fail(ctx, restore.ID, err.Error()); failErr != nil {
+			o.logger.Error().Err(failErr).Str("restore_id", restore.ID).Msg("Failed to mark restore as failed")
+		}
+		return err
+	}
+
+	// The demo source is a local cluster, bring it back if it was stopped or removed since demo mode was started
+	if config.DemoMode {
+		if err := EnsureDemoSource(ctx, config.PostgresVersion, DemoPassword(config.ConnectionString), o.logger); err != nil {
+			if failErr := o.Fail(ctx, restore.ID, err.Error()); failErr != nil {
+				o.logger.Error().Err(failErr).Str("restore_id", restore.ID).Msg("Failed to mark restore as failed")
+			}
+			return err
+		}
+	}
+
+	// initdb mirrors the source's locale, a locale the VM can't provide would only fail the restore after the dump
+	var sourceLocale *pgclient.DatabaseLocale
+	if providerType == ProviderTypeLogical {
+		sourceLocale, err = o.checkSourceLocale(ctx, &config)
+		if err != nil {
+			if failErr := o.Fail(ctx, restore.ID, err.Error()); failErr != nil {
+				o.logger.Error().Err(failErr).Str("restore_id", restore.ID).Msg("Failed to mark restore as failed")
+			}
+			return err
+		}
+	}
+
 	// Find available port for this restore's PostgreSQL cluster
 	pgPort, err := o.resources.FindAvailablePort(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to find available port: %w", err)
 	}
 
-	// Store port in database
-	if err := o.db.Model(&restore).Update("port", pgPort).Error; err != nil {
+	// Store port and cluster version in database (branches of the restore run its version)
+	if err := o.db.Model(&restore).Updates(map[string]interface{}{
+		"port":             pgPort,
+		"postgres_version": config.ClusterPostgresVersion(),
+	}).Error; err != nil {
 		return fmt.Errorf("failed to store port in database: %w", err)
 	}
 
+	// Incremental refreshes apply changes onto this restore later, set up its subscription now
+	// The restore script falls back to a plain data restore if the source can't replicate
+	// A subscription copies every table, so restores with table filters never get one
+	if config.RefreshMode == models.RefreshModeIncremental && providerType == ProviderTypeLogical && !restore.SchemaOnly && !restore.Raw &&
+		config.RestoreIncludeTables == "" && config.RestoreExcludeTables == "" && config.RestoreTableSamples == "" {
+		if err := o.db.Model(&restore).Update("subscription_name", SubscriptionName(restore.Name)).Error; err != nil {
+			return fmt.Errorf("failed to store subscription name: %w", err)
+		}
+	}
+
 	// Create log directory
 	if err := o.processManager.CreateLogDirectory(ctx); err != nil {
 		return fmt.Errorf("failed to create log directory: %w", err)
@@ -110,8 +188,8 @@ func (o *Orchestrator) Start(ctx context.Context, restoreID string) error {
 		return nil
 	}
 
-	// Calculate restore dataset path
-	restoreDataPath := GetRestoreDataPath(restore.Name)
+	// Calculate restore dataset paths
+	restoreDataPath := o.resources.GetRestoreDataPath(restore.Name)
 
 	// Delegate to provider to start the restore
 	params := ProviderParams{
@@ -119,8 +197,16 @@ func (o *Orchestrator) Start(ctx context.Context, restoreID string) error {
 		Config:          &config,
 		Port:            pgPort,
 		RestoreDataPath: restoreDataPath,
+		ZFSDataset:      o.resources.GetZFSDatasetName(restore.Name),
+		WALDataset:      o.resources.GetWALDatasetName(restore.Name),
+		WALDir:          o.resources.GetWALDirectory(restore.Name),
+		Priority:        o.priority,
 		Logger:          o.logger,
 		ProcessManager:  o.processManager,
+		SourceLocale:    sourceLocale,
+	}
+	if providerType == ProviderTypePgBackRest {
+		params.DeltaBaseDataset = o.deltaBaseDataset(&restore, &config)
 	}
 
 	if err := provider.StartRestore(ctx, params); err != nil {
@@ -164,7 +250,7 @@ func (o *Orchestrator) CheckProgress(ctx context.Context, restoreID string) (Sta
 }
 
 // Complete finalizes a successful restore operation
-// It runs post-restore SQL, applies anonymization, and marks the restore as ready
+// It creates extensions, runs post-restore SQL, applies anonymization, runs seed SQL and marks the restore as ready
 func (o *Orchestrator) Complete(ctx context.Context, restoreID string) error {
 	// Load restore record
 	var restore models.Restore
@@ -185,39 +271,95 @@ func (o *Orchestrator) Complete(ctx context.Context, restoreID string) error {
 		targetDatabase = config.CrunchyBridgeDatabaseName
 	}
 
+	// A dump that finished since the restore supervisor last checked, a retried completion is already anonymizing
+	if err := o.SyncPhase(&restore); err != nil {
+		return err
+	}
+	if restore.State != models.RestoreStateAnonymizing {
+		if err := Transition(o.db, &restore, models.RestoreStateAnonymizing, nil); err != nil {
+			return err
+		}
+	}
+
+	o.recordProvenance(&restore)
+
+	// Forget the subscription if the restore script fell back to a plain data restore
+	if restore.SubscriptionName != "" && !o.subscriptionExists(ctx, &restore, restore.ClusterPostgresVersion(&config), targetDatabase) {
+		o.logger.Warn().
+			Str("restore_id", restore.ID).
+			Msg("Source does not support logical replication, the next scheduled refresh will be a full refresh")
+		if err := o.db.Model(&restore).Update("subscription_name", "").Error; err != nil {
+			return fmt.Errorf("failed to clear subscription name: %w", err)
+		}
+	}
+
+	// Create extensions (before post-restore SQL, which may use them)
+	if err := o.createExtensions(ctx, &restore, config.Extensions, targetDatabase, restore.ClusterPostgresVersion(&config)); err != nil {
+		return err
+	}
+
 	// Execute post-restore SQL
 	if config.PostRestoreSQL != "" {
-		if err := o.executePostRestoreSQL(ctx, config.PostRestoreSQL, targetDatabase, config.PostgresVersion, restore.Port); err != nil {
+		if err := o.executeSQLStage(ctx, &restore, "post-restore", config.PostRestoreSQL, targetDatabase); err != nil {
 			o.logger.Error().Err(err).Msg("Failed to execute post-restore SQL")
 			return fmt.Errorf("failed to execute post-restore SQL: %w", err)
 		}
 	}
 
+	// Indexes copied by physical restores are only valid with the source's collation versions
+	if err := o.checkCollationVersions(ctx, &restore, targetDatabase, restore.ClusterPostgresVersion(&config)); err != nil {
+		if failErr := o.Fail(ctx, restore.ID, err.Error()); failErr != nil {
+			o.logger.Error().Err(failErr).Str("restore_id", restore.ID).Msg("Failed to mark restore as failed")
+		}
+		return err
+	}
+
+	// Raw restores of break-glass grants keep the original data
+	if restore.Raw {
+		return o.completeRaw(&restore)
+	}
+
 	// Apply anonymization
 	_, err := anonymize.Apply(ctx, o.db, anonymize.ApplyParams{
-		DatabaseName:    targetDatabase,
-		PostgresVersion: config.PostgresVersion,
-		PostgresPort:    restore.Port,
+		DatabaseName: targetDatabase,
+		PostgresPort: restore.Port,
+		RestoreID:    restore.ID,
+		RestoreName:  restore.Name,
+		Trigger:      models.AnonRunTriggerRestore,
 	}, o.logger)
 	if err != nil {
 		o.logger.Error().Err(err).Msg("Failed to apply anonymization rules")
 		return fmt.Errorf("failed to apply anonymization rules: %w", err)
 	}
 
-	// Mark database as ready
+	// Seed SQL runs on anonymized data, e.g. adding synthetic tenants
+	if config.SeedSQL != "" {
+		if err := o.executeSQLStage(ctx, &restore, "seed", config.SeedSQL, targetDatabase); err != nil {
+			o.logger.Error().Err(err).Msg("Failed to execute seed SQL")
+			return fmt.Errorf("failed to execute seed SQL: %w", err)
+		}
+	}
+
+	// Mark database as ready, unless it was cancelled meanwhile
 	now := time.Now()
 	updates := map[string]interface{}{
 		"schema_ready": true,
-		"ready_at":     now,
 	}
 	if !restore.SchemaOnly {
 		updates["data_ready"] = true
 	}
 
-	if err := o.db.Model(&restore).Updates(updates).Error; err != nil {
+	if err := Transition(o.db, &restore, models.RestoreStateReady, updates); err != nil {
 		return fmt.Errorf("failed to mark database ready: %w", err)
 	}
 
+	// Nobody is waiting on the restore anymore, drop back to background priority
+	if restore.BoostedUntil != nil {
+		if err := o.EndBoost(ctx, &restore); err != nil {
+			o.logger.Warn().Err(err).Msg("Failed to end restore boost (non-fatal)")
+		}
+	}
+
 	// Update refresh timestamps only if a refresh schedule is configured
 	// This ensures manual restores don't affect the scheduled refresh timing
 	if config.RefreshSchedule != "" {
@@ -235,9 +377,14 @@ func (o *Orchestrator) Complete(ctx context.Context, restoreID string) error {
 		}
 	}
 
-	// Delete stale restores (restores without branches) after successful restore
-	if err := o.DeleteStaleRestores(ctx, restore.ID); err != nil {
-		o.logger.Warn().Err(err).Msg("Failed to delete stale restores (non-fatal)")
+	// Compare against the previous restore (before the retention policy deletes it)
+	if _, err := o.GenerateReport(ctx, &restore, &config, targetDatabase); err != nil {
+		o.logger.Warn().Err(err).Msg("Failed to generate restore comparison report (non-fatal)")
+	}
+
+	// Apply the retention policy now that a newer restore is ready
+	if _, err := o.ApplyRetention(ctx, 0); err != nil {
+		o.logger.Warn().Err(err).Msg("Failed to apply restore retention policy (non-fatal)")
 	}
 
 	o.logger.Info().
@@ -247,6 +394,26 @@ func (o *Orchestrator) Complete(ctx context.Context, restoreID string) error {
 	return nil
 }
 
+// completeRaw marks a raw restore ready without anonymizing it
+// It isn't a refresh: refresh timestamps, reports and stale restores are left alone
+func (o *Orchestrator) completeRaw(restore *models.Restore) error {
+	updates := map[string]interface{}{
+		"schema_ready": true,
+	}
+	if !restore.SchemaOnly {
+		updates["data_ready"] = true
+	}
+	if err := Transition(o.db, restore, models.RestoreStateReady, updates); err != nil {
+		return fmt.Errorf("failed to mark database ready: %w", err)
+	}
+
+	o.logger.Warn().
+		Str("restore_id", restore.ID).
+		Str("restore_name", restore.Name).
+		Msg("Raw restore completed without anonymization (break-glass grant)")
+	return nil
+}
+
 // Delete removes a restore and all its resources
 func (o *Orchestrator) Delete(ctx context.Context, restoreID string) error {
 	// Load restore record
@@ -261,6 +428,16 @@ func (o *Orchestrator) Delete(ctx context.Context, restoreID string) error {
 		Int("port", restore.Port).
 		Msg("Deleting restore cluster and dataset")
 
+	// Release the source's replication slot, it retains WAL on the source until dropped
+	if restore.SubscriptionName != "" {
+		o.dropReplicationSlot(ctx, restore.SubscriptionName)
+	}
+
+	// A promoted restore's datasets are the origin of its source restore's datasets
+	if err := o.releasePromotedDatasets(ctx, &restore); err != nil {
+		return fmt.Errorf("failed to detach source restore: %w", err)
+	}
+
 	// Cleanup all resources
 	if err := o.resources.CleanupRestore(ctx, restore.Name, o.processManager); err != nil {
 		return fmt.Errorf("failed to cleanup restore resources: %w", err)
@@ -291,6 +468,16 @@ func (o *Orchestrator) DeleteByModel(ctx context.Context, restore *models.Restor
 		Int("port", restore.Port).
 		Msg("Deleting restore cluster and dataset")
 
+	// Release the source's replication slot, it retains WAL on the source until dropped
+	if restore.SubscriptionName != "" {
+		o.dropReplicationSlot(ctx, restore.SubscriptionName)
+	}
+
+	// A promoted restore's datasets are the origin of its source restore's datasets
+	if err := o.releasePromotedDatasets(ctx, restore); err != nil {
+		return fmt.Errorf("failed to detach source restore: %w", err)
+	}
+
 	// Cleanup all resources
 	if err := o.resources.CleanupRestore(ctx, restore.Name, o.processManager); err != nil {
 		return fmt.Errorf("failed to cleanup restore resources: %w", err)
@@ -313,56 +500,6 @@ func (o *Orchestrator) DeleteByModel(ctx context.Context, restore *models.Restor
 	return nil
 }
 
-// DeleteStaleRestores removes all restores that have no branches
-// A "stale" restore is one that has no branches attached to it
-// The excludeRestoreID parameter prevents deleting the just-completed restore
-func (o *Orchestrator) DeleteStaleRestores(ctx context.Context, excludeRestoreID string) error {
-	// Find all restores with branches preloaded
-	var allRestores []models.Restore
-	if err := o.db.Preload("Branches").Find(&allRestores).Error; err != nil {
-		return fmt.Errorf("failed to load restores: %w", err)
-	}
-
-	// Find stale restores (no branches, not the just-completed one)
-	var staleRestores []models.Restore
-	for _, restore := range allRestores {
-		hasBranches := len(restore.Branches) > 0
-		isExcluded := restore.ID == excludeRestoreID
-
-		if !hasBranches && !isExcluded {
-			staleRestores = append(staleRestores, restore)
-		}
-	}
-
-	if len(staleRestores) == 0 {
-		o.logger.Debug().Msg("No stale restores to clean up")
-		return nil
-	}
-
-	o.logger.Info().
-		Int("count", len(staleRestores)).
-		Msg("Deleting stale restores (restores without branches)")
-
-	// Delete each stale restore
-	for _, restore := range staleRestores {
-		o.logger.Info().
-			Str("restore_id", restore.ID).
-			Str("restore_name", restore.Name).
-			Msg("Deleting stale restore")
-
-		if err := o.DeleteByModel(ctx, &restore); err != nil {
-			o.logger.Error().
-				Err(err).
-				Str("restore_id", restore.ID).
-				Msg("Failed to delete stale restore")
-			// Continue with other restores even if one fails
-			continue
-		}
-	}
-
-	return nil
-}
-
 // IsRunning checks if a restore is currently in progress
 func (o *Orchestrator) IsRunning(ctx context.Context, restoreID string) (bool, int, error) {
 	// Load restore record
@@ -384,50 +521,6 @@ func (o *Orchestrator) GetResourceManager() *ResourceManager {
 	return o.resources
 }
 
-// executePostRestoreSQL executes custom SQL statements after restore completes
-func (o *Orchestrator) executePostRestoreSQL(ctx context.Context, sql, databaseName, postgresVersion string, port int) error {
-	o.logger.Info().
-		Str("database_name", databaseName).
-		Int("port", port).
-		Msg("Executing post-restore SQL")
-
-	script := fmt.Sprintf(`#!/bin/bash
-set -euo pipefail
-
-DATABASE_NAME="%s"
-PG_VERSION="%s"
-PG_PORT="%d"
-PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
-
-echo "Executing post-restore SQL on database ${DATABASE_NAME}"
-
-sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -d "${DATABASE_NAME}" <<'POST_RESTORE_SQL'
-%s
-POST_RESTORE_SQL
-
-echo "Post-restore SQL completed successfully"
-`, databaseName, postgresVersion, port, sql)
-
-	cmd := exec.CommandContext(ctx, "bash", "-c", script)
-	outputBytes, err := cmd.CombinedOutput()
-	output := string(outputBytes)
-	if err != nil {
-		o.logger.Error().
-			Err(err).
-			Str("output", output).
-			Str("database_name", databaseName).
-			Msg("Failed to execute post-restore SQL")
-		return fmt.Errorf("post-restore SQL execution failed: %w", err)
-	}
-
-	o.logger.Info().
-		Str("database_name", databaseName).
-		Str("output", output).
-		Msg("Post-restore SQL executed successfully")
-
-	return nil
-}
-
 // calculateNextRefresh calculates next refresh time from cron schedule
 func (o *Orchestrator) calculateNextRefresh(cronExpr string, from time.Time) *time.Time {
 	if cronExpr == "" {
@@ -0,0 +1,328 @@
+#!/bin/bash
+# pgBackRest restore script for self-hosted pgBackRest repositories
+set -euo pipefail
+
+# Parameters, passed in the environment (never rendered into the script)
+readonly PG_VERSION="${PG_VERSION}"
+readonly PG_PORT="${PG_PORT}"
+readonly RESTORE_NAME="${RESTORE_NAME}"              # e.g., restore_20251211000011
+readonly TARGET_DATABASE_NAME="${TARGET_DATABASE_NAME}" # e.g., app
+readonly DATA_DIR="${DATA_DIR}"       # e.g., /opt/branchd/restore_20250915120000/data
+readonly ZFS_DATASET="${ZFS_DATASET}" # e.g., tank/restore_20250915120000
+readonly WAL_DATASET="${WAL_DATASET}" # e.g., nvme/wal/restore_20250915120000 (empty = pg_wal inside DATA_DIR)
+readonly WAL_DIR="${WAL_DIR}"         # e.g., /opt/branchd-wal/restore_20250915120000/pg_wal
+readonly PGBACKREST_CONF="${PGBACKREST_CONF}"
+readonly STANZA_NAME="${STANZA_NAME}"
+readonly REPOSITORY="${REPOSITORY}"                 # e.g., s3://backups/pgbackrest (without credentials)
+readonly DELTA_BASE_DATASET="${DELTA_BASE_DATASET}"   # e.g., tank/restore_20250914120000 (empty = full restore)
+readonly PRIORITY_DIRECTIVES="${PRIORITY_DIRECTIVES}" # systemd [Service] priority directives of the cluster unit
+
+# Paths
+readonly RESTORE_LOG_DIR="/var/log/branchd"
+readonly RESTORE_LOG="${RESTORE_LOG_DIR}/restore-${RESTORE_NAME}.log"
+readonly RESTORE_PID="${RESTORE_LOG_DIR}/restore-${RESTORE_NAME}.pid"
+readonly PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
+readonly RESTORE_DATASET_PATH=$(dirname "${DATA_DIR}")  # /opt/branchd/restore_YYYYMMDDHHMMSS
+readonly SERVICE_NAME="branchd-restore-${RESTORE_NAME}"
+readonly SEED_SNAPSHOT="${DELTA_BASE_DATASET}@${RESTORE_NAME}"
+
+# Helper functions
+log() {
+    echo "$(date '+%Y-%m-%d %H:%M:%S') - $1"
+}
+
+# Provenance lines are parsed from the restore log once the restore succeeded (see restore.ReadProvenance)
+provenance() {
+    echo "__BRANCHD_PROVENANCE__ $1=$2"
+}
+
+die() {
+    log "ERROR: $1" >&2
+
+    # Remove the seed snapshot of the previous restore, the new dataset is left intact for debugging
+    if [ -n "${DELTA_BASE_DATASET}" ] && sudo zfs list -t snapshot "${SEED_SNAPSHOT}" >/dev/null 2>&1; then
+        sudo zfs destroy "${SEED_SNAPSHOT}" 2>/dev/null || log "Warning: Could not destroy seed snapshot"
+    fi
+    log "WARNING: ZFS dataset ${ZFS_DATASET} left intact for debugging (not destroyed)"
+
+    # The config holds the repository credentials
+    sudo rm -f "${PGBACKREST_CONF}" 2>/dev/null || log "Warning: Could not remove pgBackRest config"
+
+    # Write failure marker
+    echo '__BRANCHD_RESTORE_FAILED__' >> "${RESTORE_LOG}"
+    sync
+    sleep 0.5
+
+    # Remove PID file
+    rm -f "${RESTORE_PID}" 2>/dev/null || true
+    exit 1
+}
+
+# pg_controldata_setting prints a setting the backed up cluster ran with (e.g. "max_connections setting")
+pg_controldata_setting() {
+    sudo -u postgres ${PG_BIN}/pg_controldata "${DATA_DIR}" 2>/dev/null | sed -n "s/^$1: *//p"
+}
+
+log "Starting pgBackRest restore: ${RESTORE_NAME}"
+log "PostgreSQL version: ${PG_VERSION}, Port: ${PG_PORT}"
+log "Data directory: ${DATA_DIR}"
+log "Repository: ${REPOSITORY}, Stanza: ${STANZA_NAME}"
+
+# 1. Create ZFS dataset for this restore
+log "Creating ZFS dataset: ${ZFS_DATASET}"
+if sudo zfs list "${ZFS_DATASET}" >/dev/null 2>&1; then
+    log "ZFS dataset already exists, destroying and recreating..."
+    sudo zfs destroy -r "${ZFS_DATASET}" || die "Failed to destroy existing ZFS dataset"
+fi
+
+# Seed the dataset with a copy of the previous pgBackRest restore, so the delta restore only fetches the files
+# that changed since from the repository (a copy instead of a clone keeps both restores independent)
+DELTA=false
+if [ -n "${DELTA_BASE_DATASET}" ] && sudo zfs list "${DELTA_BASE_DATASET}" >/dev/null 2>&1; then
+    log "Seeding from ${DELTA_BASE_DATASET} for a delta restore..."
+    if sudo zfs snapshot "${SEED_SNAPSHOT}" && \
+        sudo zfs send "${SEED_SNAPSHOT}" | sudo zfs recv -o mountpoint="${RESTORE_DATASET_PATH}" "${ZFS_DATASET}"; then
+        sudo zfs destroy "${ZFS_DATASET}@${RESTORE_NAME}" || log "Warning: Could not destroy received seed snapshot"
+        DELTA=true
+        log "Dataset seeded from ${DELTA_BASE_DATASET}"
+    else
+        log "WARNING: Failed to seed from ${DELTA_BASE_DATASET}, running a full restore"
+        sudo zfs destroy -r "${ZFS_DATASET}" 2>/dev/null || true
+    fi
+    sudo zfs destroy "${SEED_SNAPSHOT}" 2>/dev/null || log "Warning: Could not destroy seed snapshot"
+fi
+
+if [ "${DELTA}" = "false" ]; then
+    sudo zfs create -p "${ZFS_DATASET}" || die "Failed to create ZFS dataset"
+    sudo zfs set mountpoint="${RESTORE_DATASET_PATH}" "${ZFS_DATASET}"
+fi
+log "ZFS dataset created and mounted at ${RESTORE_DATASET_PATH}"
+
+# 1b. Create WAL dataset on the separate device (if configured)
+if [ -n "${WAL_DATASET}" ]; then
+    readonly WAL_DATASET_PATH=$(dirname "${WAL_DIR}")  # /opt/branchd-wal/restore_YYYYMMDDHHMMSS
+    log "Creating WAL dataset: ${WAL_DATASET}"
+    if sudo zfs list "${WAL_DATASET}" >/dev/null 2>&1; then
+        log "WAL dataset already exists, destroying and recreating..."
+        sudo zfs destroy -r "${WAL_DATASET}" || die "Failed to destroy existing WAL dataset"
+    fi
+
+    sudo zfs create -p "${WAL_DATASET}" || die "Failed to create WAL dataset"
+    sudo zfs set mountpoint="${WAL_DATASET_PATH}" "${WAL_DATASET}"
+    sudo chown -R postgres:postgres "${WAL_DATASET_PATH}"
+    log "WAL dataset created and mounted at ${WAL_DATASET_PATH}"
+fi
+
+# 2. Create data directory and set ownership
+log "Creating data directory..."
+sudo mkdir -p "${DATA_DIR}" || die "Failed to create data directory"
+sudo chown -R postgres:postgres "${RESTORE_DATASET_PATH}"
+log "Data directory created with postgres ownership"
+
+# The seed was copied from a running cluster: pgBackRest refuses to restore over a postmaster.pid, and a pg_wal
+# link would still point to the previous restore's WAL dataset
+if [ "${DELTA}" = "true" ]; then
+    sudo rm -f "${DATA_DIR}/postmaster.pid"
+    if sudo test -L "${DATA_DIR}/pg_wal"; then
+        sudo rm -f "${DATA_DIR}/pg_wal"
+    fi
+fi
+
+# 3. Restore from the repository using pgBackRest
+log "Starting pgBackRest restore (delta: ${DELTA})..."
+sudo chown postgres:postgres "${PGBACKREST_CONF}"
+
+RESTORE_FLAGS=(--type=immediate --target-action=promote --tablespace-map-all="${RESTORE_DATASET_PATH}/tablespaces")
+if [ "${DELTA}" = "true" ]; then
+    # Compares the seeded files with the backup by checksum, only changed files are fetched
+    RESTORE_FLAGS+=(--delta)
+fi
+
+set +e
+sudo -u postgres pgbackrest --config="${PGBACKREST_CONF}" \
+    --stanza="${STANZA_NAME}" \
+    --pg1-path="${DATA_DIR}" \
+    "${RESTORE_FLAGS[@]}" \
+    restore 2>&1
+RESTORE_EXIT=$?
+set -e
+
+log "pgBackRest restore completed with exit code: ${RESTORE_EXIT}"
+
+if [ ${RESTORE_EXIT} -ne 0 ]; then
+    die "pgBackRest restore failed with exit code ${RESTORE_EXIT}"
+fi
+
+# 4. Verify PostgreSQL data directory
+log "Verifying PostgreSQL data directory..."
+if ! sudo test -f "${DATA_DIR}/PG_VERSION"; then
+    die "PostgreSQL data directory is invalid (missing PG_VERSION file)"
+fi
+
+PG_DATA_VERSION=$(sudo cat "${DATA_DIR}/PG_VERSION")
+log "Restored PostgreSQL version: ${PG_DATA_VERSION}"
+
+if [ "${PG_DATA_VERSION}" != "${PG_VERSION}" ]; then
+    die "Restored version (${PG_DATA_VERSION}) differs from the configured version (${PG_VERSION}), set postgres_version to ${PG_DATA_VERSION}"
+fi
+
+# Record which backup the restore holds, read before recovery consumes backup_label
+# pgBackRest checks every restored file against the checksum in the backup manifest
+provenance method pgbackrest
+provenance source_host "${REPOSITORY}"
+provenance source_database "${TARGET_DATABASE_NAME}"
+provenance source_version "${PG_DATA_VERSION}"
+provenance source_system_identifier "$(pg_controldata_setting 'Database system identifier' || true)"
+provenance dump_tool "$(pgbackrest version 2>/dev/null || true)"
+provenance snapshot_id "$(sudo -u postgres sed -n 's/^LABEL: pgBackRest backup //p' "${DATA_DIR}/backup_label" 2>/dev/null || true)"
+provenance start_lsn "$(sudo -u postgres sed -n 's/^START WAL LOCATION: \([^ ]*\).*/\1/p' "${DATA_DIR}/backup_label" 2>/dev/null || true)"
+provenance checksums_verified true
+
+# Move pg_wal to the WAL dataset (pgBackRest always restores it inside the data directory)
+if [ -n "${WAL_DIR}" ]; then
+    log "Moving pg_wal to ${WAL_DIR}..."
+    sudo -u postgres mv "${DATA_DIR}/pg_wal" "${WAL_DIR}" || die "Failed to move pg_wal to WAL dataset"
+    sudo -u postgres ln -s "${WAL_DIR}" "${DATA_DIR}/pg_wal" || die "Failed to link pg_wal to WAL dataset"
+    log "pg_wal moved to WAL dataset"
+fi
+
+# 5. Configure PostgreSQL for local access
+log "Configuring PostgreSQL..."
+
+# Copy TLS certificates (shared across all clusters)
+sudo -u postgres cp /etc/postgresql-common/ssl/server.crt "${DATA_DIR}/"
+sudo -u postgres cp /etc/postgresql-common/ssl/server.key "${DATA_DIR}/"
+# Fix permissions on server.key (PostgreSQL requires 0600)
+sudo -u postgres chmod 0600 "${DATA_DIR}/server.key"
+sudo -u postgres chmod 0644 "${DATA_DIR}/server.crt"
+
+# Self-hosted servers often keep postgresql.conf outside the data directory (e.g. /etc/postgresql on Debian),
+# and the source's settings may reference paths, libraries or archive commands of the source server
+# Keep the source's config for reference and start from a minimal one
+if sudo test -f "${DATA_DIR}/postgresql.conf"; then
+    sudo -u postgres mv "${DATA_DIR}/postgresql.conf" "${DATA_DIR}/postgresql.conf.source"
+fi
+
+# ALTER SYSTEM settings of the source that would prevent startup or archive into the source's repository
+# pgBackRest's recovery settings (restore_command, recovery_target) are kept
+if sudo test -f "${DATA_DIR}/postgresql.auto.conf"; then
+    sudo -u postgres sed -i -E \
+        's/^\s*(shared_preload_libraries|archive_mode|archive_command|archive_library|primary_conninfo|primary_slot_name)\b/# &/' \
+        "${DATA_DIR}/postgresql.auto.conf"
+fi
+
+# Recovery-critical parameters must be >= the values the backed up server ran with, pg_control records them
+MAX_CONNECTIONS=$(pg_controldata_setting 'max_connections setting')
+MAX_WORKER_PROCESSES=$(pg_controldata_setting 'max_worker_processes setting')
+MAX_WAL_SENDERS=$(pg_controldata_setting 'max_wal_senders setting')
+MAX_PREPARED_XACTS=$(pg_controldata_setting 'max_prepared_xacts setting')
+MAX_LOCKS_PER_XACT=$(pg_controldata_setting 'max_locks_per_xact setting')
+
+sudo -u postgres tee "${DATA_DIR}/postgresql.conf" > /dev/null << EOF
+# Branchd restore cluster (the source's config is kept in postgresql.conf.source)
+port = ${PG_PORT}
+listen_addresses = '127.0.0.1'
+ssl = on
+ssl_cert_file = 'server.crt'
+ssl_key_file = 'server.key'
+archive_mode = off
+logging_collector = on
+log_directory = 'log'
+
+# Recovery-critical parameters from pg_control
+# These must be >= primary server values for recovery to succeed
+max_connections = ${MAX_CONNECTIONS:-100}
+max_worker_processes = ${MAX_WORKER_PROCESSES:-8}
+max_wal_senders = ${MAX_WAL_SENDERS:-10}
+max_prepared_transactions = ${MAX_PREPARED_XACTS:-0}
+max_locks_per_transaction = ${MAX_LOCKS_PER_XACT:-64}
+
+# Performance parameters optimized for dev environment
+shared_buffers = '128MB'
+huge_pages = try
+EOF
+
+log "postgresql.conf configured"
+
+# Configure pg_hba.conf for local access only
+sudo -u postgres tee "${DATA_DIR}/pg_hba.conf" > /dev/null << EOF
+# TYPE  DATABASE        USER            ADDRESS                 METHOD
+local   all             all                                     peer
+host    all             all             127.0.0.1/32            scram-sha-256
+host    all             all             ::1/128                 scram-sha-256
+EOF
+
+log "PostgreSQL configuration complete"
+
+# 6. Create systemd service for this restore cluster
+log "Creating systemd service: ${SERVICE_NAME}"
+sudo tee "/etc/systemd/system/${SERVICE_NAME}.service" > /dev/null << EOF
+[Unit]
+Description=PostgreSQL Restore Cluster from pgBackRest (${RESTORE_NAME})
+After=network.target zfs-mount.service
+Requires=zfs-mount.service
+
+[Service]
+Type=forking
+User=postgres
+Group=postgres
+# Long timeout (4 hours) to allow WAL replay for large databases
+ExecStart=${PG_BIN}/pg_ctl start -t 14400 -D ${DATA_DIR} -l ${DATA_DIR}/postgresql.log
+ExecStop=${PG_BIN}/pg_ctl stop -D ${DATA_DIR} -m fast
+ExecReload=${PG_BIN}/pg_ctl reload -D ${DATA_DIR}
+KillMode=mixed
+KillSignal=SIGINT
+TimeoutStartSec=86400
+TimeoutStopSec=300
+Restart=on-failure
+RestartSec=5s
+# Run below branches so refreshes don't degrade interactive work (see POST /api/restores/:id/boost)
+${PRIORITY_DIRECTIVES}
+
+[Install]
+WantedBy=multi-user.target
+EOF
+
+sudo systemctl daemon-reload
+log "Systemd service created"
+
+# 7. Start PostgreSQL cluster
+log "Starting PostgreSQL cluster..."
+sudo systemctl enable "${SERVICE_NAME}" || die "Failed to enable systemd service"
+sudo systemctl start "${SERVICE_NAME}" || die "Failed to start systemd service"
+
+# Wait for PostgreSQL to be ready
+log "Waiting for PostgreSQL to be ready..."
+MAX_RETRIES=60
+RETRY_COUNT=0
+while [ ${RETRY_COUNT} -lt ${MAX_RETRIES} ]; do
+    if sudo -u postgres ${PG_BIN}/pg_isready -p ${PG_PORT} -h 127.0.0.1 >/dev/null 2>&1; then
+        log "PostgreSQL is ready and accepting connections"
+        break
+    fi
+    RETRY_COUNT=$((RETRY_COUNT + 1))
+    if [ ${RETRY_COUNT} -eq ${MAX_RETRIES} ]; then
+        die "PostgreSQL not ready after ${MAX_RETRIES} attempts"
+    fi
+    log "PostgreSQL not ready, retrying (${RETRY_COUNT}/${MAX_RETRIES})..."
+    sleep 1
+done
+
+# Use Unix socket connection (no -h flag) to leverage peer authentication
+if ! sudo -u postgres ${PG_BIN}/psql -p ${PG_PORT} -d postgres -tAc "SELECT 1 FROM pg_database WHERE datname = '${TARGET_DATABASE_NAME}'" | grep -q 1; then
+    die "Database ${TARGET_DATABASE_NAME} does not exist in the backup"
+fi
+
+log "Cleaning up pgBackRest config..."
+sudo rm -f "${PGBACKREST_CONF}" || log "Warning: Could not remove pgBackRest config"
+
+log "pgBackRest restore completed successfully"
+log "Restore cluster running on port ${PG_PORT}"
+
+# Write success marker
+echo '__BRANCHD_RESTORE_SUCCESS__' >> "${RESTORE_LOG}"
+sync
+sleep 0.5
+
+# Remove PID file to signal completion
+rm -f "${RESTORE_PID}" || log "Warning: Could not remove PID file"
@@ -0,0 +1,210 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+)
+
+// SecretEnvPrefix is the environment variable prefix for secrets referenced by post-restore SQL
+// {{secret "STRIPE_KEY"}} reads BRANCHD_SECRET_STRIPE_KEY from the worker's environment
+const SecretEnvPrefix = "BRANCHD_SECRET_"
+
+// redactedSecret replaces secret values in errors before they're logged
+const redactedSecret = "[REDACTED]"
+
+// PostRestoreSQLVars are the variables available to post-restore and seed SQL templates
+type PostRestoreSQLVars struct {
+	RestoreID    string
+	RestoreName  string
+	DatabaseName string
+	Port         int
+	Date         string // Restore completion date (YYYY-MM-DD, UTC)
+	Timestamp    string // Restore completion time (RFC 3339, UTC)
+}
+
+// PostBranchSQLVars are the variables available to post-branch SQL templates
+type PostBranchSQLVars struct {
+	BranchID     string
+	BranchName   string
+	ShortID      string
+	RestoreName  string
+	DatabaseName string
+	Port         int
+	Date         string // Branch creation date (YYYY-MM-DD, UTC)
+	Timestamp    string // Branch creation time (RFC 3339, UTC)
+}
+
+// NewPostBranchSQLVars returns the template variables for a branch of a restore
+func NewPostBranchSQLVars(branch *models.Branch, restore *models.Restore, databaseName string, now time.Time) PostBranchSQLVars {
+	now = now.UTC()
+	return PostBranchSQLVars{
+		BranchID:     branch.ID,
+		BranchName:   branch.Name,
+		ShortID:      branch.ShortID,
+		RestoreName:  restore.Name,
+		DatabaseName: databaseName,
+		Port:         branch.Port,
+		Date:         now.Format("2006-01-02"),
+		Timestamp:    now.Format(time.RFC3339),
+	}
+}
+
+// newPostRestoreSQLVars returns the template variables for a restore
+func newPostRestoreSQLVars(restore *models.Restore, databaseName string, now time.Time) PostRestoreSQLVars {
+	now = now.UTC()
+	return PostRestoreSQLVars{
+		RestoreID:    restore.ID,
+		RestoreName:  restore.Name,
+		DatabaseName: databaseName,
+		Port:         restore.Port,
+		Date:         now.Format("2006-01-02"),
+		Timestamp:    now.Format(time.RFC3339),
+	}
+}
+
+// RenderPostRestoreSQL renders the template variables and secret references in post-restore or seed SQL
+// Values are inserted as-is; use the literal and ident functions to quote them
+// The values of the secrets it used are returned too, to redact them from output
+func RenderPostRestoreSQL(sql string, vars PostRestoreSQLVars) (string, []string, error) {
+	return renderPostRestoreSQL(sql, vars, lookupSecret)
+}
+
+// ValidatePostRestoreSQL checks that post-restore or seed SQL is a valid template
+// Secrets are not resolved since they only need to be set in the worker's environment
+func ValidatePostRestoreSQL(sql string) error {
+	vars := newPostRestoreSQLVars(&models.Restore{Name: "restore_20250101000000", Port: 5433}, "postgres", time.Now())
+	_, _, err := renderPostRestoreSQL(sql, vars, func(string) (string, error) { return "", nil })
+	return err
+}
+
+// RenderPostBranchSQL renders post-branch SQL like RenderPostRestoreSQL, with the branch's variables
+func RenderPostBranchSQL(sql string, vars PostBranchSQLVars) (string, []string, error) {
+	return renderPostRestoreSQL(sql, vars, lookupSecret)
+}
+
+// ValidatePostBranchSQL checks that post-branch SQL is a valid template, secrets are not resolved
+func ValidatePostBranchSQL(sql string) error {
+	vars := NewPostBranchSQLVars(&models.Branch{Name: "feature-x", ShortID: "k7f3m2qa", Port: 6001},
+		&models.Restore{Name: "restore_20250101000000"}, "postgres", time.Now())
+	_, _, err := renderPostRestoreSQL(sql, vars, func(string) (string, error) { return "", nil })
+	return err
+}
+
+// vars is PostRestoreSQLVars or PostBranchSQLVars, unknown variables are errors either way
+func renderPostRestoreSQL(sql string, vars any, lookup func(string) (string, error)) (string, []string, error) {
+	// Plain SQL doesn't need a template pass (and may contain {{ in string literals)
+	if !strings.Contains(sql, "{{") {
+		return sql, nil, nil
+	}
+
+	var secrets []string
+	secret := func(name string) (string, error) {
+		value, err := lookup(name)
+		if err == nil && value != "" {
+			secrets = append(secrets, value)
+		}
+		return value, err
+	}
+
+	tmpl, err := template.New("post-restore-sql").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"secret":  secret,
+			"literal": pgclient.QuoteLiteral,
+			"ident":   pgclient.QuoteIdentifier,
+		}).
+		Parse(sql)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid SQL template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", nil, fmt.Errorf("failed to render SQL template: %w", err)
+	}
+	return buf.String(), secrets, nil
+}
+
+// RedactSecrets replaces the secret values in output, e.g. an error quoting a failed statement
+// Longer secrets first, so a secret containing another one is redacted as a whole
+func RedactSecrets(output string, secrets []string) string {
+	sorted := append([]string(nil), secrets...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, secret := range sorted {
+		if secret != "" {
+			output = strings.ReplaceAll(output, secret, redactedSecret)
+		}
+	}
+	return output
+}
+
+// executeSQLStage renders and runs post-restore or seed SQL (stage names it in logs and errors)
+// The statements run in a single transaction (see pgclient.ExecScript) and stop at the first error
+func (o *Orchestrator) executeSQLStage(ctx context.Context, restore *models.Restore, stage, sql, databaseName string) error {
+	rendered, secrets, err := RenderPostRestoreSQL(sql, newPostRestoreSQLVars(restore, databaseName, time.Now()))
+	if err != nil {
+		return fmt.Errorf("%s SQL: %w", stage, err)
+	}
+
+	o.logger.Info().
+		Str("stage", stage).
+		Str("database_name", databaseName).
+		Int("port", restore.Port).
+		Msg("Executing SQL stage")
+
+	client, err := pgclient.OpenLocal(ctx, restore.Port, databaseName)
+	if err != nil {
+		return fmt.Errorf("%s SQL: %w", stage, err)
+	}
+	defer client.Close()
+
+	results, err := client.ExecScript(ctx, rendered)
+	if err != nil {
+		// The statement and the error may both contain secret values
+		message := RedactSecrets(err.Error(), secrets)
+		logEvent := o.logger.Error().
+			Str("stage", stage).
+			Str("error", message).
+			Str("database_name", databaseName)
+		var stmtErr *pgclient.StatementError
+		if errors.As(err, &stmtErr) {
+			logEvent = logEvent.
+				Int("statement_index", stmtErr.Index).
+				Str("statement", RedactSecrets(stmtErr.Statement, secrets))
+		}
+		logEvent.Msg("Failed to execute SQL stage")
+		return fmt.Errorf("%s SQL execution failed: %s", stage, message)
+	}
+
+	var rowsAffected int64
+	for _, result := range results {
+		rowsAffected += result.RowsAffected
+	}
+	o.logger.Info().
+		Str("stage", stage).
+		Str("database_name", databaseName).
+		Int("statements", len(results)).
+		Int64("rows_affected", rowsAffected).
+		Msg("SQL stage executed successfully")
+
+	return nil
+}
+
+// lookupSecret reads a secret from the environment
+func lookupSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(SecretEnvPrefix + name)
+	if !ok {
+		return "", fmt.Errorf("secret %q is not set (%s%s)", name, SecretEnvPrefix, name)
+	}
+	return value, nil
+}
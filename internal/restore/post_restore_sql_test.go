@@ -0,0 +1,133 @@
+package restore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestRenderPostRestoreSQL(t *testing.T) {
+	t.Setenv(SecretEnvPrefix+"API_KEY", "sk_live_123")
+	t.Setenv(SecretEnvPrefix+"QUOTED", "it's")
+	vars := newPostRestoreSQLVars(&models.Restore{BaseModel: models.BaseModel{ID: "r1"}, Name: "restore_20250102030405", Port: 5433}, "app",
+		time.Date(2025, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)))
+
+	tests := []struct {
+		name        string
+		sql         string
+		want        string
+		wantSecrets []string
+		wantErr     string
+	}{
+		{
+			name: "plain SQL is not a template",
+			sql:  "SELECT '{not a template}';",
+			want: "SELECT '{not a template}';",
+		},
+		{
+			name: "variables",
+			sql:  "-- {{.RestoreID}} {{.RestoreName}} {{.DatabaseName}} {{.Port}} {{.Date}} {{.Timestamp}}",
+			want: "-- r1 restore_20250102030405 app 5433 2025-01-02 2025-01-02T02:04:05Z",
+		},
+		{
+			name: "literal quoting",
+			sql:  `INSERT INTO tenants (name) VALUES ({{literal (printf "demo-%s" .Date)}});`,
+			want: "INSERT INTO tenants (name) VALUES ('demo-2025-01-02');",
+		},
+		{
+			name: "ident quoting",
+			sql:  `CREATE SCHEMA {{ident .RestoreName}};`,
+			want: `CREATE SCHEMA "restore_20250102030405";`,
+		},
+		{
+			name:        "secret",
+			sql:         `UPDATE settings SET value = {{literal (secret "API_KEY")}};`,
+			want:        "UPDATE settings SET value = 'sk_live_123';",
+			wantSecrets: []string{"sk_live_123"},
+		},
+		{
+			name:        "secret with quotes can't break out of the literal",
+			sql:         `SELECT {{literal (secret "QUOTED")}};`,
+			want:        "SELECT 'it''s';",
+			wantSecrets: []string{"it's"},
+		},
+		{
+			name:    "missing secret",
+			sql:     `SELECT {{secret "MISSING"}};`,
+			wantErr: "BRANCHD_SECRET_MISSING",
+		},
+		{
+			name:    "unknown variable",
+			sql:     `SELECT {{.Nope}};`,
+			wantErr: "failed to render",
+		},
+		{
+			name:    "invalid template",
+			sql:     `SELECT {{.Date`,
+			wantErr: "invalid SQL template",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, secrets, err := RenderPostRestoreSQL(tt.sql, vars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RenderPostRestoreSQL() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderPostRestoreSQL() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderPostRestoreSQL() = %q, want %q", got, tt.want)
+			}
+			if strings.Join(secrets, ",") != strings.Join(tt.wantSecrets, ",") {
+				t.Errorf("secrets = %q, want %q", secrets, tt.wantSecrets)
+			}
+		})
+	}
+}
+
+func TestValidatePostRestoreSQL(t *testing.T) {
+	// Secrets only have to exist in the worker's environment
+	if err := ValidatePostRestoreSQL(`SELECT {{literal (secret "NOT_SET_HERE")}};`); err != nil {
+		t.Errorf("ValidatePostRestoreSQL() error = %v", err)
+	}
+	if err := ValidatePostRestoreSQL(`SELECT {{.Nope}};`); err == nil {
+		t.Error("ValidatePostRestoreSQL() accepted an unknown variable")
+	}
+}
+
+func TestRenderPostBranchSQL(t *testing.T) {
+	vars := NewPostBranchSQLVars(&models.Branch{BaseModel: models.BaseModel{ID: "b1"}, Name: "feature-x", ShortID: "k7f3m2qa", Port: 6001},
+		&models.Restore{Name: "restore_20250102030405"}, "app", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	got, _, err := RenderPostBranchSQL(`INSERT INTO tenants (name) VALUES ({{literal .BranchName}}), ({{literal .ShortID}});`, vars)
+	if err != nil {
+		t.Fatalf("RenderPostBranchSQL() error = %v", err)
+	}
+	if want := `INSERT INTO tenants (name) VALUES ('feature-x'), ('k7f3m2qa');`; got != want {
+		t.Errorf("RenderPostBranchSQL() = %q, want %q", got, want)
+	}
+
+	if err := ValidatePostBranchSQL(`SELECT {{literal .BranchName}}, {{literal (secret "NOT_SET_HERE")}};`); err != nil {
+		t.Errorf("ValidatePostBranchSQL() error = %v", err)
+	}
+	// Restore variables that branches don't have
+	if err := ValidatePostBranchSQL(`SELECT {{.RestoreID}};`); err == nil {
+		t.Error("ValidatePostBranchSQL() accepted an unknown variable")
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	output := `ERROR:  relation "x" does not exist
+LINE 1: UPDATE x SET key = 'sk_live_123', prefix = 'sk_live';`
+	got := RedactSecrets(output, []string{"sk_live", "sk_live_123", ""})
+	want := `ERROR:  relation "x" does not exist
+LINE 1: UPDATE x SET key = '[REDACTED]', prefix = '[REDACTED]';`
+	if got != want {
+		t.Errorf("RedactSecrets() = %q, want %q", got, want)
+	}
+}
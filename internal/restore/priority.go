@@ -0,0 +1,153 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+// BoostedPriority is applied while a restore is boosted
+// Weights above the systemd default (100) let the restore win over branches for CPU and disk
+var BoostedPriority = config.PriorityConfig{
+	Nice:      0,
+	IOClass:   "best-effort",
+	IOLevel:   0,
+	CPUWeight: 400,
+	IOWeight:  400,
+}
+
+// priorityDirectives renders the systemd [Service] directives for a restore cluster unit
+func priorityDirectives(p config.PriorityConfig) string {
+	directives := []string{
+		fmt.Sprintf("Nice=%d", p.Nice),
+		fmt.Sprintf("IOSchedulingClass=%s", p.IOClass),
+	}
+	if p.IOClass != "idle" {
+		directives = append(directives, fmt.Sprintf("IOSchedulingPriority=%d", p.IOLevel))
+	}
+	directives = append(directives,
+		fmt.Sprintf("CPUWeight=%d", p.CPUWeight),
+		fmt.Sprintf("IOWeight=%d", p.IOWeight),
+	)
+	return strings.Join(directives, "\n")
+}
+
+// priorityCommand renders the nice/ionice prefix for restore subprocesses (pg_dump, pg_restore, pgbackrest)
+func priorityCommand(p config.PriorityConfig) string {
+	return fmt.Sprintf("nice -n %d ionice -c %d%s", p.Nice, p.IOClassNumber(), ioniceLevelFlag(p))
+}
+
+// Boost temporarily raises a restore's priority above branches
+// Applies to the running restore script (and its pg_dump/pg_restore children) and the restore cluster
+func (o *Orchestrator) Boost(ctx context.Context, restore *models.Restore) error {
+	return o.applyPriority(ctx, restore, BoostedPriority)
+}
+
+// Unboost returns a restore to the configured background priority
+func (o *Orchestrator) Unboost(ctx context.Context, restore *models.Restore) error {
+	return o.applyPriority(ctx, restore, o.priority)
+}
+
+// EndBoost unboosts a restore and clears its boosted_until timestamp
+func (o *Orchestrator) EndBoost(ctx context.Context, restore *models.Restore) error {
+	if err := o.Unboost(ctx, restore); err != nil {
+		return err
+	}
+	if err := o.db.Model(restore).Update("boosted_until", nil).Error; err != nil {
+		return fmt.Errorf("failed to clear boosted_until: %w", err)
+	}
+	restore.BoostedUntil = nil
+	return nil
+}
+
+// applyPriorityScript re-prioritizes the processes of a restore's cluster unit and of its restore script
+const applyPriorityScript = `set -u
+
+PIDS=""
+
+# Restore cluster: cgroup weights plus every process in the unit's cgroup
+if systemctl list-unit-files "${SERVICE_NAME}.service" 2>/dev/null | grep -q .; then
+    sudo systemctl set-property --runtime "${SERVICE_NAME}" "CPUWeight=${CPU_WEIGHT}" "IOWeight=${IO_WEIGHT}"
+    CGROUP=$(systemctl show -p ControlGroup --value "${SERVICE_NAME}" 2>/dev/null || true)
+    if [ -n "${CGROUP}" ] && [ -f "/sys/fs/cgroup${CGROUP}/cgroup.procs" ]; then
+        PIDS="$(cat "/sys/fs/cgroup${CGROUP}/cgroup.procs")"
+    fi
+fi
+
+# Restore script and its children (pg_dump, pg_restore, pgbackrest)
+descendants() {
+    echo "$1"
+    for child in $(pgrep -P "$1"); do
+        descendants "${child}"
+    done
+}
+if [ -f "${PID_FILE}" ]; then
+    SCRIPT_PID=$(cat "${PID_FILE}")
+    if kill -0 "${SCRIPT_PID}" 2>/dev/null; then
+        PIDS="${PIDS} $(descendants "${SCRIPT_PID}")"
+    fi
+fi
+
+COUNT=0
+for pid in ${PIDS}; do
+    sudo renice -n "${NICE}" -p "${pid}" >/dev/null 2>&1 || continue
+    sudo ionice ${IONICE_FLAGS} -p "${pid}" >/dev/null 2>&1 || true
+    COUNT=$((COUNT + 1))
+done
+
+echo "PRIORITY_PROCESSES=${COUNT}"`
+
+// applyPriorityParams are the parameters of applyPriorityScript
+type applyPriorityParams struct {
+	ServiceName string `env:"SERVICE_NAME"`
+	PIDFile     string `env:"PID_FILE"`
+	Nice        int    `env:"NICE"`
+	IONiceFlags string `env:"IONICE_FLAGS"` // ionice class and level flags, e.g. "-c 2 -n 7"
+	CPUWeight   int    `env:"CPU_WEIGHT"`
+	IOWeight    int    `env:"IO_WEIGHT"`
+}
+
+// applyPriority re-prioritizes a running restore
+// cgroup weights are changed at runtime only, so the unit file keeps the configured defaults
+func (o *Orchestrator) applyPriority(ctx context.Context, restore *models.Restore, p config.PriorityConfig) error {
+	cmd := shellexec.Command(ctx, applyPriorityScript, applyPriorityParams{
+		ServiceName: o.resources.GetServiceName(restore.Name),
+		PIDFile:     o.processManager.GetPIDFilePath(restore.Name),
+		Nice:        p.Nice,
+		IONiceFlags: fmt.Sprintf("-c %d%s", p.IOClassNumber(), ioniceLevelFlag(p)),
+		CPUWeight:   p.CPUWeight,
+		IOWeight:    p.IOWeight,
+	})
+	outputBytes, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(outputBytes))
+	if err != nil {
+		o.logger.Error().
+			Err(err).
+			Str("restore_id", restore.ID).
+			Str("output", output).
+			Msg("Failed to apply restore priority")
+		return fmt.Errorf("failed to apply restore priority: %w", err)
+	}
+
+	o.logger.Info().
+		Str("restore_id", restore.ID).
+		Int("nice", p.Nice).
+		Int("cpu_weight", p.CPUWeight).
+		Int("io_weight", p.IOWeight).
+		Str("output", output).
+		Msg("Applied restore priority")
+
+	return nil
+}
+
+// ioniceLevelFlag returns the ionice -n flag (the idle class takes no level)
+func ioniceLevelFlag(p config.PriorityConfig) string {
+	if p.IOClass == "idle" {
+		return ""
+	}
+	return fmt.Sprintf(" -n %d", p.IOLevel)
+}
@@ -0,0 +1,52 @@
+package restore
+
+import (
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+func TestPriorityDirectives(t *testing.T) {
+	tests := []struct {
+		name        string
+		priority    config.PriorityConfig
+		wantUnit    string
+		wantCommand string
+	}{
+		{
+			name:        "background best-effort",
+			priority:    config.PriorityConfig{Nice: 10, IOClass: "best-effort", IOLevel: 7, CPUWeight: 50, IOWeight: 50},
+			wantUnit:    "Nice=10\nIOSchedulingClass=best-effort\nIOSchedulingPriority=7\nCPUWeight=50\nIOWeight=50",
+			wantCommand: "nice -n 10 ionice -c 2 -n 7",
+		},
+		{
+			name:        "idle takes no level",
+			priority:    config.PriorityConfig{Nice: 19, IOClass: "idle", IOLevel: 7, CPUWeight: 1, IOWeight: 1},
+			wantUnit:    "Nice=19\nIOSchedulingClass=idle\nCPUWeight=1\nIOWeight=1",
+			wantCommand: "nice -n 19 ionice -c 3",
+		},
+		{
+			name:        "boosted",
+			priority:    BoostedPriority,
+			wantUnit:    "Nice=0\nIOSchedulingClass=best-effort\nIOSchedulingPriority=0\nCPUWeight=400\nIOWeight=400",
+			wantCommand: "nice -n 0 ionice -c 2 -n 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := priorityDirectives(tt.priority); got != tt.wantUnit {
+				t.Errorf("priorityDirectives() = %q, want %q", got, tt.wantUnit)
+			}
+			if got := priorityCommand(tt.priority); got != tt.wantCommand {
+				t.Errorf("priorityCommand() = %q, want %q", got, tt.wantCommand)
+			}
+		})
+	}
+}
+
+func TestBoostedPriorityIsValid(t *testing.T) {
+	if err := BoostedPriority.Validate(); err != nil {
+		t.Errorf("BoostedPriority.Validate() error = %v", err)
+	}
+}
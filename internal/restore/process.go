@@ -9,6 +9,9 @@ import (
 	"strings"
 
 	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/shellexec"
 )
 
 const (
@@ -142,6 +145,31 @@ func (p *ProcessManager) GetPIDFilePath(restoreName string) string {
 	return fmt.Sprintf("%s/restore-%s.pid", RestoreLogDir, restoreName)
 }
 
+// restoreLauncherScript starts the restore script ($1, with the remaining arguments) in the background at the
+// restore priority, its output going to the restore log and its PID to the PID file
+const restoreLauncherScript = `nohup ${RESTORE_PRIORITY} bash -c "$1" restore "${@:2}" > "${RESTORE_LOG_FILE}" 2>&1 &
+echo $! > "${RESTORE_PID_FILE}"`
+
+// restoreLaunchParams are the parameters of restoreLauncherScript
+type restoreLaunchParams struct {
+	Priority string `env:"RESTORE_PRIORITY"` // nice/ionice prefix, see priorityCommand
+	LogFile  string `env:"RESTORE_LOG_FILE"`
+	PIDFile  string `env:"RESTORE_PID_FILE"`
+}
+
+// StartScript starts a restore script in the background, CheckStatus follows it through the restore log
+// params are passed in the script's environment and args as its arguments, see shellexec
+func (p *ProcessManager) StartScript(ctx context.Context, restoreName, script string, params any, priority config.PriorityConfig, args ...string) (string, error) {
+	cmd := shellexec.Command(ctx, restoreLauncherScript, params, append([]string{script}, args...)...)
+	cmd.Env = append(cmd.Env, shellexec.Env(restoreLaunchParams{
+		Priority: priorityCommand(priority),
+		LogFile:  p.GetLogFilePath(restoreName),
+		PIDFile:  p.GetPIDFilePath(restoreName),
+	})...)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
 // CleanupPIDFile removes the PID file for a restore
 func (p *ProcessManager) CleanupPIDFile(restoreName string) error {
 	pidFile := p.GetPIDFilePath(restoreName)
@@ -213,26 +241,40 @@ func (p *ProcessManager) ReadLogTail(ctx context.Context, restoreName string, li
 	return strings.TrimSpace(string(output)), nil
 }
 
+// restoreProcessStatusScript prints "running:<pid>" if the process of the PID file runs, "stopped" or "not_found"
+const restoreProcessStatusScript = `if [ -f "${PID_FILE}" ]; then
+    pid=$(cat "${PID_FILE}")
+    if kill -0 "${pid}" 2>/dev/null; then
+        echo "running:${pid}"
+    else
+        echo "stopped"
+    fi
+else
+    echo "not_found"
+fi`
+
+// killRestoreProcessScript stops a restore process, with SIGKILL if it's still running a second after SIGTERM
+const killRestoreProcessScript = `if kill -0 "${PID}" 2>/dev/null; then
+    kill -TERM "${PID}" 2>/dev/null || true
+    sleep 1
+    if kill -0 "${PID}" 2>/dev/null; then
+        kill -KILL "${PID}" 2>/dev/null || true
+    fi
+fi`
+
+// restoreProcessParams are the parameters of restoreProcessStatusScript and killRestoreProcessScript
+type restoreProcessParams struct {
+	PIDFile string `env:"PID_FILE"`
+	PID     string `env:"PID"`
+}
+
 // KillProcess kills a restore process if it's running
 func (p *ProcessManager) KillProcess(ctx context.Context, restoreName string) error {
 	pidFile := p.GetPIDFilePath(restoreName)
 	logFile := p.GetLogFilePath(restoreName)
 
 	// Check if PID file exists and process is running
-	checkCmd := fmt.Sprintf(`
-		if [ -f %s ]; then
-			pid=$(cat %s)
-			if kill -0 $pid 2>/dev/null; then
-				echo "running:$pid"
-			else
-				echo "stopped"
-			fi
-		else
-			echo "not_found"
-		fi
-	`, pidFile, pidFile)
-
-	cmd := exec.CommandContext(ctx, "bash", "-c", checkCmd)
+	cmd := shellexec.Command(ctx, restoreProcessStatusScript, restoreProcessParams{PIDFile: pidFile})
 	outputBytes, err := cmd.CombinedOutput()
 	if err != nil {
 		p.logger.Warn().
@@ -248,18 +290,7 @@ func (p *ProcessManager) KillProcess(ctx context.Context, restoreName string) er
 		pid := strings.TrimPrefix(output, "running:")
 
 		// Kill the process (SIGTERM first, then SIGKILL if needed)
-		killCmd := fmt.Sprintf(`
-			pid=%s
-			if kill -0 $pid 2>/dev/null; then
-				kill -TERM $pid 2>/dev/null || true
-				sleep 1
-				if kill -0 $pid 2>/dev/null; then
-					kill -KILL $pid 2>/dev/null || true
-				fi
-			fi
-		`, pid)
-
-		killExecCmd := exec.CommandContext(ctx, "bash", "-c", killCmd)
+		killExecCmd := shellexec.Command(ctx, killRestoreProcessScript, restoreProcessParams{PID: pid})
 		if killOutput, killErr := killExecCmd.CombinedOutput(); killErr != nil {
 			p.logger.Warn().
 				Err(killErr).
@@ -275,8 +306,7 @@ func (p *ProcessManager) KillProcess(ctx context.Context, restoreName string) er
 	}
 
 	// Clean up PID and log files
-	cleanupCmd := fmt.Sprintf("rm -f %s %s", pidFile, logFile)
-	cleanupExecCmd := exec.CommandContext(ctx, "bash", "-c", cleanupCmd)
+	cleanupExecCmd := exec.CommandContext(ctx, "rm", "-f", pidFile, logFile)
 	if cleanupOutput, cleanupErr := cleanupExecCmd.CombinedOutput(); cleanupErr != nil {
 		p.logger.Warn().
 			Err(cleanupErr).
@@ -0,0 +1,182 @@
+package restore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Markers of the lines logical_restore.sh writes before loading data: the dump's table data entries
+// ("<dump ID> <schema>.<table>") and the size of the source's tables ("<schema>.<table> <bytes>")
+const (
+	tableDataMarker = "__BRANCHD_TABLE_DATA__ "
+	tableSizeMarker = "__BRANCHD_TABLE_SIZE__ "
+)
+
+// logTimeLayout is the timestamp of the script's log lines ("2025-01-01 09:00:00 - ...", the VM's local time)
+const logTimeLayout = "2006-01-02 15:04:05"
+
+var (
+	// pg_restore --verbose: a table's data load started, with --jobs > 1 also when it finished
+	processingDataPattern = regexp.MustCompile(`^pg_restore: processing data for table "([^"]+)"`)
+	finishedItemPattern   = regexp.MustCompile(`^pg_restore: finished item (\d+) TABLE DATA `)
+)
+
+// Progress is how far the data load of a logical restore got
+type Progress struct {
+	TablesTotal    int
+	TablesRestored int
+	BytesTotal     int64 // Source size of the dumped tables, 0 when the sizes couldn't be read
+	BytesRestored  int64
+
+	DataStartedAt *time.Time // When the data load started, nil before
+	DataLoaded    bool       // The data load finished
+}
+
+// Percent returns the share of the data loaded, weighted by table size (by table count without sizes)
+func (p *Progress) Percent() float64 {
+	if p.DataLoaded {
+		return 100
+	}
+	if p.BytesTotal > 0 {
+		return float64(p.BytesRestored) * 100 / float64(p.BytesTotal)
+	}
+	if p.TablesTotal > 0 {
+		return float64(p.TablesRestored) * 100 / float64(p.TablesTotal)
+	}
+	return 0
+}
+
+// EstimatedFinish extrapolates when the data load finishes from its rate so far
+// Nil before a table was loaded and once the load finished
+func (p *Progress) EstimatedFinish(now time.Time) *time.Time {
+	percent := p.Percent()
+	if p.DataLoaded || p.DataStartedAt == nil || percent <= 0 {
+		return nil
+	}
+	elapsed := now.Sub(*p.DataStartedAt)
+	finish := now.Add(time.Duration(float64(elapsed) * (100 - percent) / percent))
+	return &finish
+}
+
+// ReadProgress parses the data load progress from a restore log, nil if the script listed no table data
+func (p *ProcessManager) ReadProgress(restoreName string) (*Progress, error) {
+	file, err := os.Open(p.GetLogFilePath(restoreName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open restore log: %w", err)
+	}
+	defer file.Close()
+
+	return parseProgress(file)
+}
+
+// parseProgress collects the table data entries, table sizes and pg_restore's progress lines of a restore log
+// pg_restore only reports finished tables with --jobs > 1, serially a table is done once the next one starts
+func parseProgress(r io.Reader) (*Progress, error) {
+	tables := map[string]string{} // Dump ID -> table
+	sizes := map[string]int64{}   // Table -> bytes
+	finished := map[string]bool{} // Tables
+	var started []string          // Tables in the order their data load started
+	parallel := false
+	progress := &Progress{}
+
+	scanner := bufio.NewScanner(r)
+	// Same limit as parseProvenance, COPY errors can quote long rows
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if value, ok := strings.CutPrefix(line, tableDataMarker); ok {
+			if id, table, ok := strings.Cut(strings.TrimSpace(value), " "); ok {
+				tables[id] = table
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, tableSizeMarker); ok {
+			table, size, _ := strings.Cut(strings.TrimSpace(value), " ")
+			if bytes, err := strconv.ParseInt(size, 10, 64); err == nil {
+				sizes[table] = bytes
+			}
+			continue
+		}
+		if match := processingDataPattern.FindStringSubmatch(line); match != nil {
+			started = append(started, match[1])
+			continue
+		}
+		if match := finishedItemPattern.FindStringSubmatch(line); match != nil {
+			parallel = true
+			if table, ok := tables[match[1]]; ok {
+				finished[table] = true
+			}
+			continue
+		}
+
+		// The script's own log lines around the data load
+		timestamp, message, ok := strings.Cut(line, " - ")
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(message, "Phase 2/3:") {
+			if at, err := time.ParseInLocation(logTimeLayout, timestamp, time.Local); err == nil {
+				progress.DataStartedAt = &at
+			}
+		} else if strings.HasPrefix(message, "Phase 2 completed") {
+			progress.DataLoaded = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read restore log: %w", err)
+	}
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	if !parallel && len(started) > 0 {
+		for _, table := range started[:len(started)-1] {
+			finished[table] = true
+		}
+	}
+
+	for _, table := range tables {
+		progress.TablesTotal++
+		progress.BytesTotal += sizes[table]
+		if finished[table] || progress.DataLoaded {
+			progress.TablesRestored++
+			progress.BytesRestored += sizes[table]
+		}
+	}
+	return progress, nil
+}
+
+// UpdateProgress records the data load progress of a restoring restore from its log, see models.Restore.TablesTotal
+// Restores whose script lists no table data (e.g. physical or schema-only restores) are left alone
+func (o *Orchestrator) UpdateProgress(restore *models.Restore, now time.Time) error {
+	if restore.State != models.RestoreStateRestoring {
+		return nil
+	}
+	progress, err := o.processManager.ReadProgress(restore.Name)
+	if err != nil || progress == nil {
+		return err
+	}
+
+	restore.TablesTotal = progress.TablesTotal
+	restore.TablesRestored = progress.TablesRestored
+	restore.ProgressPercent = progress.Percent()
+	restore.EstimatedDataLoadedAt = progress.EstimatedFinish(now)
+	if err := o.db.Model(restore).Updates(map[string]interface{}{
+		"tables_total":             restore.TablesTotal,
+		"tables_restored":          restore.TablesRestored,
+		"progress_percent":         restore.ProgressPercent,
+		"estimated_data_loaded_at": restore.EstimatedDataLoadedAt,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record restore progress: %w", err)
+	}
+	return nil
+}
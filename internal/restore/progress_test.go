@@ -0,0 +1,88 @@
+package restore
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const progressLogHeader = `2025-01-01 09:00:00 - Phase 1/3: Restoring schema...
+__BRANCHD_TABLE_DATA__ 3401 public.users
+__BRANCHD_TABLE_DATA__ 3402 public.orders
+__BRANCHD_TABLE_DATA__ 3403 public.events
+__BRANCHD_TABLE_SIZE__ public.users 100
+__BRANCHD_TABLE_SIZE__ public.orders 300
+__BRANCHD_TABLE_SIZE__ public.events 600
+__BRANCHD_TABLE_SIZE__ public.not_dumped 5000
+2025-01-01 09:10:00 - Phase 2/3: Loading data...
+`
+
+func TestParseProgressParallel(t *testing.T) {
+	log := progressLogHeader + `pg_restore: launching item 3401 TABLE DATA users
+pg_restore: launching item 3402 TABLE DATA orders
+pg_restore: processing data for table "public.users"
+pg_restore: processing data for table "public.orders"
+pg_restore: finished item 3402 TABLE DATA orders
+pg_restore: launching item 3403 TABLE DATA events
+pg_restore: processing data for table "public.events"
+`
+	progress, err := parseProgress(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("parseProgress() error = %v", err)
+	}
+	if progress.TablesTotal != 3 || progress.TablesRestored != 1 || progress.BytesTotal != 1000 || progress.BytesRestored != 300 {
+		t.Errorf("progress = %+v; want 1 of 3 tables, 300 of 1000 bytes", progress)
+	}
+	if progress.Percent() != 30 {
+		t.Errorf("Percent() = %v; want 30", progress.Percent())
+	}
+
+	// 30% in 7 minutes, the remaining 70% take another 16m20s
+	started := time.Date(2025, 1, 1, 9, 10, 0, 0, time.Local)
+	if progress.DataStartedAt == nil || !progress.DataStartedAt.Equal(started) {
+		t.Fatalf("DataStartedAt = %v; want %v", progress.DataStartedAt, started)
+	}
+	now := started.Add(7 * time.Minute)
+	if got, want := progress.EstimatedFinish(now), now.Add(16*time.Minute+20*time.Second); got == nil || !got.Equal(want) {
+		t.Errorf("EstimatedFinish() = %v; want %v", got, want)
+	}
+}
+
+func TestParseProgressSerial(t *testing.T) {
+	// A table is done once the next one starts
+	log := progressLogHeader + `pg_restore: processing data for table "public.users"
+pg_restore: processing data for table "public.orders"
+`
+	progress, err := parseProgress(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("parseProgress() error = %v", err)
+	}
+	if progress.TablesRestored != 1 || progress.BytesRestored != 100 {
+		t.Errorf("progress = %+v; want users restored", progress)
+	}
+
+	progress, err = parseProgress(strings.NewReader(log + "2025-01-01 09:20:00 - Phase 2 completed with exit code: 0\n"))
+	if err != nil {
+		t.Fatalf("parseProgress() error = %v", err)
+	}
+	if !progress.DataLoaded || progress.TablesRestored != 3 || progress.Percent() != 100 || progress.EstimatedFinish(time.Now()) != nil {
+		t.Errorf("progress = %+v; want all tables loaded without an estimate", progress)
+	}
+}
+
+func TestParseProgressWithoutTables(t *testing.T) {
+	// Physical and schema-only restores list no table data
+	progress, err := parseProgress(strings.NewReader("2025-01-01 09:00:00 - Phase 1/3: Restoring schema...\n"))
+	if err != nil || progress != nil {
+		t.Errorf("parseProgress() = %+v, %v; want nil", progress, err)
+	}
+
+	// Without sizes, tables count alike and nothing loaded means no estimate
+	progress, err = parseProgress(strings.NewReader("__BRANCHD_TABLE_DATA__ 1 public.a\n__BRANCHD_TABLE_DATA__ 2 public.b\n"))
+	if err != nil {
+		t.Fatalf("parseProgress() error = %v", err)
+	}
+	if progress.Percent() != 0 || progress.EstimatedFinish(time.Now()) != nil {
+		t.Errorf("progress = %+v; want 0%% without an estimate", progress)
+	}
+}
@@ -0,0 +1,179 @@
+package restore
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+//go:embed promote_branch.sh
+var promoteBranchScript string
+
+type promoteBranchParams struct {
+	PgVersion          string `env:"PG_VERSION"`
+	BranchName         string `env:"BRANCH_NAME"`
+	BranchPort         int    `env:"BRANCH_PORT"`
+	BranchUser         string `env:"BRANCH_USER"`
+	BranchDataset      string `env:"BRANCH_DATASET"`
+	BranchMountpoint   string `env:"BRANCH_MOUNTPOINT"`
+	BranchWALDataset   string `env:"BRANCH_WAL_DATASET"`
+	RestoreName        string `env:"RESTORE_NAME"`
+	PgPort             int    `env:"PG_PORT"`
+	ZFSDataset         string `env:"ZFS_DATASET"`
+	DataDir            string `env:"DATA_DIR"`
+	WALDataset         string `env:"WAL_DATASET"`
+	WALDir             string `env:"WAL_DIR"`
+	PriorityDirectives string `env:"PRIORITY_DIRECTIVES"`
+}
+
+// CreatePromotion records the restore a branch is promoted to, RunPromotion promotes the branch
+// The restore isn't ready (and not branched from) until the promotion finished
+func (o *Orchestrator) CreatePromotion(ctx context.Context, branch *models.Branch) (*models.Restore, error) {
+	var source models.Restore
+	if err := o.db.Where("id = ?", branch.RestoreID).First(&source).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branch restore: %w", err)
+	}
+	// A promoted restore would be branched from without anonymization
+	if source.Raw {
+		return nil, fmt.Errorf("branch %s holds raw (not anonymized) data and can't be promoted", branch.Name)
+	}
+
+	var config models.Config
+	if err := o.db.First(&config).Error; err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	pgPort, err := o.resources.FindAvailablePort(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find available port: %w", err)
+	}
+
+	// Started right away, promotions don't wait for a restore slot
+	now := time.Now()
+	promoted := models.Restore{
+		Name:                  models.GenerateRestoreName(),
+		SchemaOnly:            source.SchemaOnly,
+		State:                 models.RestoreStateRestoring,
+		StartedAt:             &now,
+		RestoringAt:           &now,
+		Port:                  pgPort,
+		PromotedFromBranch:    branch.Name,
+		PromotedFromRestoreID: source.ID,
+		PostgresVersion:       source.ClusterPostgresVersion(&config),
+	}
+	if err := o.db.Create(&promoted).Error; err != nil {
+		return nil, fmt.Errorf("failed to create restore record: %w", err)
+	}
+	return &promoted, nil
+}
+
+// RunPromotion turns the branch of a restore recorded by CreatePromotion into that restore
+// The branch's datasets become the restore's (zfs promote, so they outlive the branch's restore),
+// the branch's user is dropped and the branch record is deleted
+// Promoted restores are kept until deleted explicitly, like clones
+func (o *Orchestrator) RunPromotion(ctx context.Context, restoreID string) error {
+	var promoted models.Restore
+	if err := o.db.Where("id = ?", restoreID).First(&promoted).Error; err != nil {
+		return fmt.Errorf("failed to load promoted restore: %w", err)
+	}
+	var branch models.Branch
+	if err := o.db.Where("name = ?", promoted.PromotedFromBranch).First(&branch).Error; err != nil {
+		return fmt.Errorf("failed to load branch %s: %w", promoted.PromotedFromBranch, err)
+	}
+	var source models.Restore
+	if err := o.db.Where("id = ?", promoted.PromotedFromRestoreID).First(&source).Error; err != nil {
+		return fmt.Errorf("failed to load branch restore: %w", err)
+	}
+
+	storage := o.resources.storage
+	scriptParams := promoteBranchParams{
+		PgVersion:          promoted.PostgresVersion,
+		BranchName:         branch.Name,
+		BranchPort:         branch.Port,
+		BranchUser:         branch.User,
+		BranchDataset:      storage.DatasetName(branch.Name),
+		BranchMountpoint:   storage.MountPath(branch.Name),
+		BranchWALDataset:   storage.WALDatasetName(branch.Name),
+		RestoreName:        promoted.Name,
+		PgPort:             promoted.Port,
+		ZFSDataset:         o.resources.GetZFSDatasetName(promoted.Name),
+		DataDir:            o.resources.GetDataDirectory(promoted.Name),
+		WALDataset:         o.resources.GetWALDatasetName(promoted.Name),
+		WALDir:             o.resources.GetWALDirectory(promoted.Name),
+		PriorityDirectives: priorityDirectives(o.priority),
+	}
+
+	o.logger.Info().
+		Str("branch_id", branch.ID).
+		Str("branch_name", branch.Name).
+		Str("restore_name", promoted.Name).
+		Int("port", promoted.Port).
+		Msg("Promoting branch to restore")
+
+	cmd := shellexec.Command(ctx, promoteBranchScript, scriptParams)
+	outputBytes, err := cmd.CombinedOutput()
+	output := string(outputBytes)
+	if err != nil {
+		o.logger.Error().
+			Err(err).
+			Str("branch_id", branch.ID).
+			Str("output", output).
+			Msg("Failed to promote branch")
+		return fmt.Errorf("failed to promote branch: %s", cloneErrorMessage(output, err))
+	}
+
+	// The branch no longer exists on disk, swap the records in one transaction
+	if err := o.db.Transaction(func(tx *gorm.DB) error {
+		if err := Transition(tx, &promoted, models.RestoreStateReady, map[string]interface{}{
+			"schema_ready": source.SchemaReady,
+			"data_ready":   source.DataReady,
+		}); err != nil {
+			return err
+		}
+		return tx.Delete(&branch).Error
+	}); err != nil {
+		return fmt.Errorf("failed to record promoted restore: %w", err)
+	}
+
+	o.logger.Info().
+		Str("restore_id", promoted.ID).
+		Str("restore_name", promoted.Name).
+		Str("branch_name", branch.Name).
+		Msg("Branch promoted to restore successfully")
+
+	return nil
+}
+
+// releasePromotedDatasets promotes the datasets of the restore a promoted restore was created from
+// back, since promotion made them clones of the promoted restore's datasets
+func (o *Orchestrator) releasePromotedDatasets(ctx context.Context, restore *models.Restore) error {
+	if restore.PromotedFromRestoreID == "" {
+		return nil
+	}
+
+	var source models.Restore
+	err := o.db.Where("id = ?", restore.PromotedFromRestoreID).First(&source).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load source restore: %w", err)
+	}
+
+	datasets := []string{o.resources.GetZFSDatasetName(source.Name)}
+	if walDataset := o.resources.GetWALDatasetName(source.Name); walDataset != "" {
+		datasets = append(datasets, walDataset)
+	}
+	for _, dataset := range datasets {
+		if err := o.resources.PromoteZFSDataset(ctx, dataset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+#!/bin/bash
+# Branch promotion script for Branchd - turns a branch into an independent restore cluster
+# The branch's datasets are renamed and promoted so they no longer depend on the restore the branch was created from
+set -euo pipefail
+
+# Parameters, passed in the environment (never rendered into the script)
+readonly PG_VERSION="${PG_VERSION}"
+readonly BRANCH_NAME="${BRANCH_NAME}"
+readonly BRANCH_PORT="${BRANCH_PORT}"
+readonly BRANCH_USER="${BRANCH_USER}"
+readonly BRANCH_DATASET="${BRANCH_DATASET}"              # e.g., tank/my-branch
+readonly BRANCH_MOUNTPOINT="${BRANCH_MOUNTPOINT}"        # e.g., /opt/branchd/my-branch
+readonly BRANCH_WAL_DATASET="${BRANCH_WAL_DATASET}"       # e.g., nvme/wal/my-branch (empty = pg_wal inside data directory)
+readonly RESTORE_NAME="${RESTORE_NAME}"                  # e.g., restore_20250916093000
+readonly PG_PORT="${PG_PORT}"
+readonly ZFS_DATASET="${ZFS_DATASET}"                    # e.g., tank/restore_20250916093000
+readonly DATA_DIR="${DATA_DIR}"                          # e.g., /opt/branchd/restore_20250916093000/data
+readonly WAL_DATASET="${WAL_DATASET}"                    # e.g., nvme/wal/restore_20250916093000
+readonly WAL_DIR="${WAL_DIR}"                            # e.g., /opt/branchd-wal/restore_20250916093000/pg_wal
+readonly PRIORITY_DIRECTIVES="${PRIORITY_DIRECTIVES}" # systemd [Service] priority directives of the cluster unit
+
+# Paths
+readonly PG_BIN="/usr/lib/postgresql/${PG_VERSION}/bin"
+readonly BRANCH_PGDATA="${BRANCH_MOUNTPOINT}/data"
+readonly MOUNTPOINT=$(dirname "${DATA_DIR}")  # /opt/branchd/restore_YYYYMMDDHHMMSS
+readonly BRANCH_SERVICE_NAME="branchd-branch-${BRANCH_NAME}"
+readonly SERVICE_NAME="branchd-restore-${RESTORE_NAME}"
+
+# Helper functions
+log() {
+    echo "$(date '+%Y-%m-%d %H:%M:%S') - $1"
+}
+
+die() {
+    log "ERROR: $1" >&2
+    echo "BRANCHD_ERROR: $1"
+    exit 1
+}
+
+log "Promoting branch ${BRANCH_NAME} to restore ${RESTORE_NAME} (port ${PG_PORT})"
+
+# 1. Verify the branch is running
+if ! sudo -u postgres ${PG_BIN}/pg_isready -p ${BRANCH_PORT} -h 127.0.0.1 >/dev/null 2>&1; then
+    die "Branch is not accepting connections on port ${BRANCH_PORT}"
+fi
+
+# 2. Drop the branch's user, its credentials must not carry over to branches of the new restore
+# Objects it created (fixtures) are handed over to postgres in every database
+for db in $(sudo -u postgres ${PG_BIN}/psql -p ${BRANCH_PORT} -Atc "SELECT datname FROM pg_database WHERE datallowconn"); do
+    sudo -u postgres ${PG_BIN}/psql -X -p ${BRANCH_PORT} -d "${db}" -v ON_ERROR_STOP=1 -v user="${BRANCH_USER}" >/dev/null <<'SQL' \
+        || die "Failed to reassign objects of the branch user in ${db}"
+REASSIGN OWNED BY :"user" TO postgres;
+DROP OWNED BY :"user";
+SQL
+done
+sudo -u postgres ${PG_BIN}/psql -X -p ${BRANCH_PORT} -v ON_ERROR_STOP=1 -v user="${BRANCH_USER}" >/dev/null <<'SQL' \
+    || die "Failed to drop the branch user"
+DROP ROLE :"user";
+SQL
+
+# 3. Stop the branch cleanly and remove its service
+sudo -u postgres ${PG_BIN}/pg_ctl stop -D "${BRANCH_PGDATA}" -m fast >/dev/null || die "Failed to stop branch"
+sudo systemctl stop "${BRANCH_SERVICE_NAME}" 2>/dev/null || true
+sudo systemctl disable "${BRANCH_SERVICE_NAME}" 2>/dev/null || true
+sudo rm -f "/etc/systemd/system/${BRANCH_SERVICE_NAME}.service"
+sudo systemctl daemon-reload
+# Every rule of the port, the branch's allowed networks have one each (see branches.applyFirewall)
+for rule in $(sudo ufw status numbered | sed -n "s/^\[ *\([0-9]*\)\] ${BRANCH_PORT}\/tcp .*/\1/p" | sort -rn); do
+    sudo ufw --force delete "${rule}" >/dev/null 2>&1 || true
+done
+log "Branch service removed"
+
+# 4. Move the branch's dataset to the restore and make it independent of its origin
+# WHY: zfs promote hands the origin snapshot over, so the old restore can be deleted (or refreshed away) later
+MOUNT_UNIT=$(systemd-escape --path "${BRANCH_MOUNTPOINT}").mount
+sudo systemctl stop "${MOUNT_UNIT}" 2>/dev/null || true
+if [ "$(sudo zfs get -H -o value mounted ${BRANCH_DATASET})" = "yes" ]; then
+    sudo zfs unmount "${BRANCH_DATASET}" || die "Failed to unmount branch dataset"
+fi
+sudo zfs rename "${BRANCH_DATASET}" "${ZFS_DATASET}" || die "Failed to rename branch dataset"
+sudo zfs set mountpoint="${MOUNTPOINT}" "${ZFS_DATASET}" || die "Failed to set restore mountpoint"
+sudo zfs promote "${ZFS_DATASET}" || die "Failed to promote restore dataset"
+sudo zfs set quota=none reservation=none "${ZFS_DATASET}" || die "Failed to clear branch disk quota"
+if [ "$(sudo zfs get -H -o value mounted ${ZFS_DATASET})" != "yes" ]; then
+    sudo mkdir -p "${MOUNTPOINT}"
+    sudo zfs mount "${ZFS_DATASET}" || die "Failed to mount restore dataset"
+fi
+sudo rmdir "${BRANCH_MOUNTPOINT}" 2>/dev/null || true
+log "Dataset promoted and mounted at ${MOUNTPOINT}"
+
+# 4b. Same for the WAL dataset, then point pg_wal at its new location
+if [ -n "${BRANCH_WAL_DATASET}" ] && sudo zfs list "${BRANCH_WAL_DATASET}" >/dev/null 2>&1; then
+    readonly WAL_MOUNTPOINT=$(dirname "${WAL_DIR}")
+    readonly BRANCH_WAL_MOUNTPOINT=$(sudo zfs get -H -o value mountpoint "${BRANCH_WAL_DATASET}")
+    if [ "$(sudo zfs get -H -o value mounted ${BRANCH_WAL_DATASET})" = "yes" ]; then
+        sudo zfs unmount "${BRANCH_WAL_DATASET}" || die "Failed to unmount branch WAL dataset"
+    fi
+    sudo zfs rename "${BRANCH_WAL_DATASET}" "${WAL_DATASET}" || die "Failed to rename branch WAL dataset"
+    sudo zfs set mountpoint="${WAL_MOUNTPOINT}" "${WAL_DATASET}" || die "Failed to set WAL mountpoint"
+    sudo zfs promote "${WAL_DATASET}" || die "Failed to promote WAL dataset"
+    if [ "$(sudo zfs get -H -o value mounted ${WAL_DATASET})" != "yes" ]; then
+        sudo mkdir -p "${WAL_MOUNTPOINT}"
+        sudo zfs mount "${WAL_DATASET}" || die "Failed to mount WAL dataset"
+    fi
+    sudo rmdir "${BRANCH_WAL_MOUNTPOINT}" 2>/dev/null || true
+    sudo -u postgres ln -sfn "${WAL_DIR}" "${DATA_DIR}/pg_wal"
+    sudo chown -R postgres:postgres "${WAL_MOUNTPOINT}"
+    log "WAL dataset promoted and mounted at ${WAL_MOUNTPOINT}"
+fi
+
+# 5. Move the cluster to the restore's port
+sudo -u postgres rm -f "${DATA_DIR}/postmaster.pid"
+sudo -u postgres sed -i "s/^#*port = .*/port = ${PG_PORT}/" "${DATA_DIR}/postgresql.conf"
+sudo chown -R postgres:postgres "${MOUNTPOINT}"
+
+# 6. Create systemd service for the restore cluster
+log "Creating systemd service: ${SERVICE_NAME}"
+sudo tee "/etc/systemd/system/${SERVICE_NAME}.service" > /dev/null << EOF
+[Unit]
+Description=PostgreSQL Restore Cluster (${RESTORE_NAME}, promoted from ${BRANCH_NAME})
+After=network.target zfs-mount.service
+Requires=zfs-mount.service
+
+[Service]
+Type=forking
+User=postgres
+Group=postgres
+ExecStartPre=+/usr/bin/sh -c '/usr/sbin/zfs mount ${ZFS_DATASET} 2>/dev/null || true'
+ExecStart=${PG_BIN}/pg_ctl start -D ${DATA_DIR} -l ${DATA_DIR}/postgresql.log
+ExecStop=${PG_BIN}/pg_ctl stop -D ${DATA_DIR} -m fast
+ExecReload=${PG_BIN}/pg_ctl reload -D ${DATA_DIR}
+KillMode=mixed
+KillSignal=SIGINT
+TimeoutStartSec=300
+TimeoutStopSec=300
+Restart=on-failure
+RestartSec=5s
+${PRIORITY_DIRECTIVES}
+
+[Install]
+WantedBy=multi-user.target
+EOF
+
+sudo systemctl daemon-reload
+
+# 7. Start the restore cluster
+sudo systemctl enable "${SERVICE_NAME}"
+sudo systemctl start "${SERVICE_NAME}" || die "Failed to start promoted cluster"
+
+MAX_RETRIES=60
+RETRY_COUNT=0
+while ! sudo -u postgres ${PG_BIN}/pg_isready -p ${PG_PORT} -h 127.0.0.1 >/dev/null 2>&1; do
+    RETRY_COUNT=$((RETRY_COUNT + 1))
+    if [ ${RETRY_COUNT} -ge ${MAX_RETRIES} ]; then
+        die "Promoted cluster not ready after ${MAX_RETRIES} attempts"
+    fi
+    sleep 1
+done
+
+log "Promoted restore cluster running on port ${PG_PORT}"
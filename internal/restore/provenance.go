@@ -0,0 +1,128 @@
+package restore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// provenanceMarker prefixes the "key=value" lines restore scripts write about the source and the dump
+const provenanceMarker = "__BRANCHD_PROVENANCE__ "
+
+// ReadProvenance parses the provenance a restore script wrote to the restore log, nil if it wrote none
+func (p *ProcessManager) ReadProvenance(restoreName string) (*models.RestoreProvenance, error) {
+	file, err := os.Open(p.GetLogFilePath(restoreName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open restore log: %w", err)
+	}
+	defer file.Close()
+
+	return parseProvenance(file)
+}
+
+// recordProvenance saves the provenance from the log of a succeeded restore
+// A restore without provenance is still usable, failing to record it is only logged
+func (o *Orchestrator) recordProvenance(restore *models.Restore) {
+	provenance, err := o.processManager.ReadProvenance(restore.Name)
+	if err != nil {
+		o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to read restore provenance")
+		return
+	}
+	if provenance == nil {
+		return
+	}
+
+	restore.Provenance = provenance
+	if err := o.db.Model(restore).Select("provenance").Updates(&models.Restore{Provenance: provenance}).Error; err != nil {
+		o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to record restore provenance")
+	}
+}
+
+// parseProvenance collects the provenance lines of a restore log, later values replace earlier ones
+func parseProvenance(r io.Reader) (*models.RestoreProvenance, error) {
+	var provenance *models.RestoreProvenance
+
+	scanner := bufio.NewScanner(r)
+	// pg_restore --verbose lines are short, but COPY errors can quote long rows
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(scanner.Text(), provenanceMarker)
+		if !ok {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		value = strings.TrimSpace(value)
+		if provenance == nil {
+			provenance = &models.RestoreProvenance{}
+		}
+
+		switch key {
+		case "method":
+			provenance.Method = value
+		case "source_host":
+			provenance.SourceHost = value
+		case "source_database":
+			provenance.SourceDatabase = value
+		case "source_version":
+			provenance.SourceVersion = value
+		case "source_system_identifier":
+			provenance.SourceSystemID = value
+		case "dump_tool":
+			provenance.DumpTool = value
+		case "restore_tool":
+			provenance.RestoreTool = value
+		case "start_lsn":
+			provenance.StartLSN = value
+		case "end_lsn":
+			provenance.EndLSN = value
+		case "snapshot_id":
+			provenance.SnapshotID = value
+		case "checksums_verified":
+			provenance.ChecksumsVerified = value == "true"
+		case "artifact":
+			// name:size:sha256
+			parts := strings.SplitN(value, ":", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			size, _ := strconv.ParseInt(parts[1], 10, 64)
+			provenance.Artifacts = append(provenance.Artifacts, models.RestoreArtifact{Name: parts[0], SizeBytes: size, SHA256: parts[2]})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read restore log: %w", err)
+	}
+	return provenance, nil
+}
+
+// sourceHost returns host:port of a URL or key=value connection string without its credentials
+func sourceHost(connectionString string) string {
+	if u, err := url.Parse(connectionString); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		if u.Port() == "" {
+			return u.Hostname()
+		}
+		return net.JoinHostPort(u.Hostname(), u.Port())
+	}
+
+	var host, port string
+	for _, field := range strings.Fields(connectionString) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "host":
+			host = strings.Trim(value, "'")
+		case "port":
+			port = strings.Trim(value, "'")
+		}
+	}
+	if host == "" || port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
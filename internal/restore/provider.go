@@ -5,11 +5,13 @@ import (
 
 	"github.com/rs/zerolog"
 
+	"github.com/branchd-dev/branchd/internal/config"
 	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
 )
 
 // Provider defines the interface that all restore methods must implement
-// Each provider (logical, Crunchy Bridge, etc.) handles the restore process differently
+// Each provider (logical, Crunchy Bridge, pgBackRest) handles the restore process differently
 type Provider interface {
 	// ValidateConfig validates provider-specific configuration
 	ValidateConfig(config *models.Config) error
@@ -26,10 +28,20 @@ type Provider interface {
 type ProviderParams struct {
 	Restore         *models.Restore
 	Config          *models.Config
-	Port            int    // Allocated PostgreSQL port for this restore
-	RestoreDataPath string // ZFS dataset path (e.g., /opt/branchd/restore_20250920143000)
+	Port            int                   // Allocated PostgreSQL port for this restore
+	RestoreDataPath string                // ZFS dataset path (e.g., /opt/branchd/restore_20250920143000)
+	ZFSDataset      string                // ZFS dataset name (e.g., tank/restore_20250920143000)
+	WALDataset      string                // Separate ZFS dataset for pg_wal (empty = WAL inside the data directory)
+	WALDir          string                // pg_wal directory on the WAL dataset (empty = WAL inside the data directory)
+	Priority        config.PriorityConfig // CPU/IO priority for restore subprocesses and the restore cluster
 	Logger          zerolog.Logger
 	ProcessManager  *ProcessManager // For getting log/PID file paths
+
+	// Source encoding and default collation mirrored by initdb (logical restores, nil = C.UTF-8)
+	SourceLocale *pgclient.DatabaseLocale
+
+	// ZFS dataset of the previous pgBackRest restore, copied and delta restored onto (empty = full restore)
+	DeltaBaseDataset string
 }
 
 // ProviderType identifies the type of restore provider
@@ -38,4 +50,5 @@ type ProviderType string
 const (
 	ProviderTypeLogical       ProviderType = "logical"
 	ProviderTypeCrunchyBridge ProviderType = "crunchy_bridge"
+	ProviderTypePgBackRest    ProviderType = "pgbackrest"
 )
@@ -1,13 +1,10 @@
 package restore
 
 import (
-	"bytes"
 	"context"
 	_ "embed"
 	"fmt"
 	"os"
-	"os/exec"
-	"text/template"
 
 	"github.com/rs/zerolog"
 
@@ -19,13 +16,17 @@ import (
 var crunchyBridgeRestoreScript string
 
 type crunchyBridgeRestoreParams struct {
-	PgVersion          string
-	PgPort             int
-	RestoreName        string // Name of the restore (e.g., restore_20251211000011) - used for logs, ZFS, service
-	TargetDatabaseName string // Actual database name in PostgreSQL
-	DataDir            string
-	PgBackRestConfPath string
-	StanzaName         string
+	PgVersion          string `env:"PG_VERSION"`
+	PgPort             int    `env:"PG_PORT"`
+	RestoreName        string `env:"RESTORE_NAME"`         // Name of the restore (e.g., restore_20251211000011) - used for logs, ZFS, service
+	TargetDatabaseName string `env:"TARGET_DATABASE_NAME"` // Actual database name in PostgreSQL
+	DataDir            string `env:"DATA_DIR"`
+	ZFSDataset         string `env:"ZFS_DATASET"`
+	WALDataset         string `env:"WAL_DATASET"`         // Optional ZFS dataset for pg_wal on a separate device
+	WALDir             string `env:"WAL_DIR"`             // Optional pg_wal directory, the restored pg_wal is moved there
+	PriorityDirectives string `env:"PRIORITY_DIRECTIVES"` // systemd priority directives for the restore cluster unit
+	PgBackRestConfPath string `env:"PGBACKREST_CONF"`
+	StanzaName         string `env:"STANZA_NAME"`
 }
 
 // CrunchyBridgeProvider implements restore from Crunchy Bridge backups via pgBackRest
@@ -59,7 +60,7 @@ func (p *CrunchyBridgeProvider) ValidateConfig(config *models.Config) error {
 	if config.PostgresVersion == "" {
 		return fmt.Errorf("PostgreSQL version is required")
 	}
-	return nil
+	return config.ValidateTargetPostgresVersion()
 }
 
 // StartRestore starts the restore process from Crunchy Bridge using pgBackRest
@@ -135,34 +136,16 @@ func (p *CrunchyBridgeProvider) StartRestore(ctx context.Context, params Provide
 		RestoreName:        params.Restore.Name,
 		TargetDatabaseName: params.Config.CrunchyBridgeDatabaseName,
 		DataDir:            dataDir,
+		ZFSDataset:         params.ZFSDataset,
+		WALDataset:         params.WALDataset,
+		WALDir:             params.WALDir,
+		PriorityDirectives: priorityDirectives(params.Priority),
 		PgBackRestConfPath: pgbackrestConfPath,
 		StanzaName:         backupToken.Stanza,
 	}
 
-	script, err := p.renderScript(scriptParams)
-	if err != nil {
-		return fmt.Errorf("failed to render Crunchy Bridge restore script: %w", err)
-	}
-
-	// Start the restore script in background
-	logFile := params.ProcessManager.GetLogFilePath(params.Restore.Name)
-	pidFile := params.ProcessManager.GetPIDFilePath(params.Restore.Name)
-
-	// Write script to a temporary file
-	scriptPath := fmt.Sprintf("/tmp/branchd_restore_cb_%s.sh", params.Restore.Name)
-	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
-		return fmt.Errorf("failed to write restore script: %w", err)
-	}
-
-	// Create a wrapper script that runs the restore in background and cleans up the temp file
-	wrapperScript := fmt.Sprintf(`
-		nohup bash -c 'bash "%s"; rm -f "%s"' > "%s" 2>&1 &
-		echo $! > "%s"
-	`, scriptPath, scriptPath, logFile, pidFile)
-
-	cmd := exec.CommandContext(ctx, "bash", "-c", wrapperScript)
-	outputBytes, err := cmd.CombinedOutput()
-	output := string(outputBytes)
+	// Start the restore script in background, parameters are passed in its environment
+	output, err := params.ProcessManager.StartScript(ctx, params.Restore.Name, crunchyBridgeRestoreScript, scriptParams, params.Priority)
 	if err != nil {
 		p.logger.Error().Err(err).Str("output", output).Msg("Failed to start restore script")
 		return fmt.Errorf("restore script execution failed: %w", err)
@@ -170,24 +153,9 @@ func (p *CrunchyBridgeProvider) StartRestore(ctx context.Context, params Provide
 
 	p.logger.Info().
 		Str("restore_id", params.Restore.ID).
-		Str("log_file", logFile).
-		Str("pid_file", pidFile).
+		Str("log_file", params.ProcessManager.GetLogFilePath(params.Restore.Name)).
+		Str("pid_file", params.ProcessManager.GetPIDFilePath(params.Restore.Name)).
 		Msg("Crunchy Bridge restore script started successfully")
 
 	return nil
 }
-
-// renderScript renders the bash script template with parameters
-func (p *CrunchyBridgeProvider) renderScript(params crunchyBridgeRestoreParams) (string, error) {
-	tmpl, err := template.New("crunchy-bridge-restore").Parse(crunchyBridgeRestoreScript)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse script template: %w", err)
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, params); err != nil {
-		return "", fmt.Errorf("failed to execute script template: %w", err)
-	}
-
-	return buf.String(), nil
-}
@@ -1,13 +1,11 @@
 package restore
 
 import (
-	"bytes"
 	"context"
 	_ "embed"
 	"fmt"
 	"os"
-	"os/exec"
-	"text/template"
+	"path"
 
 	"github.com/rs/zerolog"
 
@@ -20,19 +18,37 @@ import (
 var logicalRestoreScript string
 
 type logicalRestoreParams struct {
-	ConnectionString   string
-	PgVersion          string
-	PgPort             int
-	DatabaseName       string // Used for log/PID file naming (restore name)
-	SourceDatabaseName string // Source database name from connection string
-	SchemaOnly         string // "true" or "false" for template
-	ParallelJobs       int
-	DumpDir            string // Directory for pg_dump output
-	DataDir            string // PostgreSQL data directory for initdb
+	ConnectionString   string `env:"CONNECTION_STRING"`
+	PgVersion          string `env:"PG_VERSION"`
+	PgPort             int    `env:"PG_PORT"`
+	DatabaseName       string `env:"DATABASE_NAME"`        // Used for log/PID file naming (restore name)
+	SourceDatabaseName string `env:"SOURCE_DATABASE_NAME"` // Source database name from connection string
+	SourceHost         string `env:"SOURCE_HOST"`          // Source host:port without credentials, recorded as provenance
+	SchemaOnly         string `env:"SCHEMA_ONLY"`          // "true" or "false"
+	ParallelJobs       int    `env:"PARALLEL_JOBS"`
+	DumpDir            string `env:"DUMP_FILE"`           // Directory for pg_dump output
+	DataDir            string `env:"DATA_DIR"`            // PostgreSQL data directory for initdb
+	ZFSDataset         string `env:"ZFS_DATASET"`         // ZFS dataset for the restore
+	WALDataset         string `env:"WAL_DATASET"`         // Optional ZFS dataset for pg_wal on a separate device
+	WALDir             string `env:"WAL_DIR"`             // Optional pg_wal directory passed to initdb --waldir
+	PriorityDirectives string `env:"PRIORITY_DIRECTIVES"` // systemd priority directives for the restore cluster unit
+	SubscriptionName   string `env:"SUBSCRIPTION_NAME"`   // Optional subscription/slot for incremental refreshes
+	PublicationName    string `env:"PUBLICATION_NAME"`    // Source publication the subscription reads from
+
+	// Source encoding and default collation, mirrored by initdb
+	Encoding       string `env:"SOURCE_ENCODING"`
+	LcCollate      string `env:"SOURCE_LC_COLLATE"`
+	LcCtype        string `env:"SOURCE_LC_CTYPE"`
+	LocaleProvider string `env:"SOURCE_LOCALE_PROVIDER"` // libc, icu or builtin
+	ProviderLocale string `env:"SOURCE_PROVIDER_LOCALE"` // ICU or builtin locale (empty for libc)
+
+	// Table filters
+	TableFilterFlags []string      // pg_dump --table/--exclude-table-data flags, passed as the script's arguments
+	TableSamples     []TableSample `env:"TABLE_SAMPLES"` // Tables copied with a row limit after the restore
 
 	// PostgreSQL tuning parameters
-	TuneSQL  []string // SQL statements to apply tuning
-	ResetSQL []string // SQL statements to reset tuning
+	TuneSQL  []string `env:"TUNE_SQL"`  // SQL statements to apply tuning
+	ResetSQL []string `env:"RESET_SQL"` // SQL statements to reset tuning
 }
 
 // LogicalProvider implements logical restore via pg_dump/pg_restore
@@ -60,6 +76,14 @@ func (p *LogicalProvider) ValidateConfig(config *models.Config) error {
 	if config.PostgresVersion == "" {
 		return fmt.Errorf("PostgreSQL version is required")
 	}
+	if err := config.ValidateTargetPostgresVersion(); err != nil {
+		return err
+	}
+	// The restore cluster and pg_dump run the target version, fail before dumping if it isn't installed
+	pgRestore := fmt.Sprintf("/usr/lib/postgresql/%s/bin/pg_restore", config.ClusterPostgresVersion())
+	if _, err := os.Stat(pgRestore); err != nil {
+		return fmt.Errorf("PostgreSQL %s is not installed (%s not found)", config.ClusterPostgresVersion(), pgRestore)
+	}
 	return nil
 }
 
@@ -74,7 +98,7 @@ func (p *LogicalProvider) StartRestore(ctx context.Context, params ProviderParam
 	// Validate inputs using process manager
 	if err := params.ProcessManager.ValidateInputs(
 		params.Config.ConnectionString,
-		params.Config.PostgresVersion,
+		params.Config.ClusterPostgresVersion(),
 		params.Port,
 		params.Restore.Name,
 	); err != nil {
@@ -82,7 +106,7 @@ func (p *LogicalProvider) StartRestore(ctx context.Context, params ProviderParam
 	}
 
 	// Detect system resources and calculate optimal settings
-	resources, err := sysinfo.GetResources()
+	resources, err := sysinfo.GetResources(path.Dir(params.ZFSDataset))
 	if err != nil {
 		p.logger.Warn().Err(err).Msg("Failed to detect system resources, using defaults")
 	}
@@ -93,50 +117,52 @@ func (p *LogicalProvider) StartRestore(ctx context.Context, params ProviderParam
 	dataDir := fmt.Sprintf("%s/data", params.RestoreDataPath)        // PostgreSQL data directory
 	dumpDir := fmt.Sprintf("%s/dump.pgdump", params.RestoreDataPath) // pg_dump output file
 
+	filters, err := ParseTableFilters(params.Config)
+	if err != nil {
+		return err
+	}
+
 	// Render restore script
 	schemaOnlyStr := "false"
 	if params.Restore.SchemaOnly {
 		schemaOnlyStr = "true"
 	}
 
+	sourceLocale := params.SourceLocale
+	if sourceLocale == nil {
+		sourceLocale = &defaultLocale
+	}
+
 	scriptParams := logicalRestoreParams{
 		ConnectionString:   params.Config.ConnectionString,
-		PgVersion:          params.Config.PostgresVersion,
+		PgVersion:          params.Config.ClusterPostgresVersion(),
 		PgPort:             params.Port,
 		DatabaseName:       params.Restore.Name,
 		SourceDatabaseName: params.Config.DatabaseName, // Extracted from connection string
+		SourceHost:         sourceHost(params.Config.ConnectionString),
 		SchemaOnly:         schemaOnlyStr,
 		ParallelJobs:       tuning.ParallelJobs,
 		DumpDir:            dumpDir,
 		DataDir:            dataDir,
+		ZFSDataset:         params.ZFSDataset,
+		WALDataset:         params.WALDataset,
+		WALDir:             params.WALDir,
+		PriorityDirectives: priorityDirectives(params.Priority),
+		SubscriptionName:   params.Restore.SubscriptionName,
+		PublicationName:    ReplicationPublication,
+		Encoding:           sourceLocale.Encoding,
+		LcCollate:          sourceLocale.Collate,
+		LcCtype:            sourceLocale.Ctype,
+		LocaleProvider:     sourceLocale.Provider,
+		ProviderLocale:     sourceLocale.Locale,
+		TableFilterFlags:   filters.DumpFlags(),
+		TableSamples:       filters.Samples,
 		TuneSQL:            tuning.GenerateAlterSystemSQL(),
 		ResetSQL:           pgtuning.GenerateResetSQL(),
 	}
 
-	script, err := p.renderScript(scriptParams)
-	if err != nil {
-		return fmt.Errorf("failed to render logical restore script: %w", err)
-	}
-
-	// Start the restore script in background using nohup
-	logFile := params.ProcessManager.GetLogFilePath(params.Restore.Name)
-	pidFile := params.ProcessManager.GetPIDFilePath(params.Restore.Name)
-
-	// Write script to a temporary file to avoid shell quoting issues
-	scriptPath := fmt.Sprintf("/tmp/branchd_restore_%s.sh", params.Restore.Name)
-	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
-		return fmt.Errorf("failed to write restore script: %w", err)
-	}
-
-	// Create a wrapper script that runs the restore in background and cleans up the temp file
-	wrapperScript := fmt.Sprintf(`
-		nohup bash -c 'bash "%s"; rm -f "%s"' > "%s" 2>&1 &
-		echo $! > "%s"
-	`, scriptPath, scriptPath, logFile, pidFile)
-
-	cmd := exec.CommandContext(ctx, "bash", "-c", wrapperScript)
-	outputBytes, err := cmd.CombinedOutput()
-	output := string(outputBytes)
+	// Start the restore script in background, parameters are passed in its environment
+	output, err := params.ProcessManager.StartScript(ctx, params.Restore.Name, logicalRestoreScript, scriptParams, params.Priority, scriptParams.TableFilterFlags...)
 	if err != nil {
 		p.logger.Error().Err(err).Str("output", output).Msg("Failed to start restore script")
 		return fmt.Errorf("restore script execution failed: %w", err)
@@ -144,24 +170,9 @@ func (p *LogicalProvider) StartRestore(ctx context.Context, params ProviderParam
 
 	p.logger.Info().
 		Str("restore_id", params.Restore.ID).
-		Str("log_file", logFile).
-		Str("pid_file", pidFile).
+		Str("log_file", params.ProcessManager.GetLogFilePath(params.Restore.Name)).
+		Str("pid_file", params.ProcessManager.GetPIDFilePath(params.Restore.Name)).
 		Msg("Logical restore script started successfully")
 
 	return nil
 }
-
-// renderScript renders the bash script template with parameters
-func (p *LogicalProvider) renderScript(params logicalRestoreParams) (string, error) {
-	tmpl, err := template.New("logical-restore").Parse(logicalRestoreScript)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse script template: %w", err)
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, params); err != nil {
-		return "", fmt.Errorf("failed to execute script template: %w", err)
-	}
-
-	return buf.String(), nil
-}
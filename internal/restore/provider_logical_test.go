@@ -0,0 +1,23 @@
+package restore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestLogicalValidateConfigTargetVersion(t *testing.T) {
+	p := &LogicalProvider{}
+
+	// The target's binaries are required, not the source's
+	err := p.ValidateConfig(&models.Config{ConnectionString: "postgres://source/app", PostgresVersion: "14", TargetPostgresVersion: "999"})
+	if err == nil || !strings.Contains(err.Error(), "PostgreSQL 999 is not installed (/usr/lib/postgresql/999/bin/pg_restore not found)") {
+		t.Errorf("ValidateConfig() error = %v, want the missing target version", err)
+	}
+
+	err = p.ValidateConfig(&models.Config{ConnectionString: "postgres://source/app", PostgresVersion: "16", TargetPostgresVersion: "14"})
+	if err == nil || !strings.Contains(err.Error(), "restores can only be upgraded") {
+		t.Errorf("ValidateConfig() error = %v, want the downgrade rejected", err)
+	}
+}
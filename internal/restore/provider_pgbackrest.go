@@ -0,0 +1,181 @@
+package restore
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+//go:embed pgbackrest_restore.sh
+var pgBackRestRestoreScript string
+
+type pgBackRestRestoreParams struct {
+	PgVersion          string `env:"PG_VERSION"`
+	PgPort             int    `env:"PG_PORT"`
+	RestoreName        string `env:"RESTORE_NAME"`         // Name of the restore (e.g., restore_20251211000011) - used for logs, ZFS, service
+	TargetDatabaseName string `env:"TARGET_DATABASE_NAME"` // Actual database name in PostgreSQL
+	DataDir            string `env:"DATA_DIR"`
+	ZFSDataset         string `env:"ZFS_DATASET"`
+	WALDataset         string `env:"WAL_DATASET"`         // Optional ZFS dataset for pg_wal on a separate device
+	WALDir             string `env:"WAL_DIR"`             // Optional pg_wal directory, the restored pg_wal is moved there
+	PriorityDirectives string `env:"PRIORITY_DIRECTIVES"` // systemd priority directives for the restore cluster unit
+	PgBackRestConfPath string `env:"PGBACKREST_CONF"`
+	StanzaName         string `env:"STANZA_NAME"`
+	Repository         string `env:"REPOSITORY"`         // Repository without credentials, recorded as provenance
+	DeltaBaseDataset   string `env:"DELTA_BASE_DATASET"` // ZFS dataset copied before the delta restore (empty = full restore)
+}
+
+// PgBackRestProvider implements restore from a self-hosted pgBackRest repository
+type PgBackRestProvider struct {
+	logger zerolog.Logger
+}
+
+// NewPgBackRestProvider creates a new pgBackRest restore provider
+func NewPgBackRestProvider(logger zerolog.Logger) *PgBackRestProvider {
+	return &PgBackRestProvider{
+		logger: logger,
+	}
+}
+
+// GetProviderType returns the provider type identifier
+func (p *PgBackRestProvider) GetProviderType() string {
+	return string(ProviderTypePgBackRest)
+}
+
+// ValidateConfig validates that the pgBackRest repository is properly configured
+func (p *PgBackRestProvider) ValidateConfig(config *models.Config) error {
+	if err := config.ValidatePgBackRest(); err != nil {
+		return err
+	}
+	if config.PostgresVersion == "" {
+		return fmt.Errorf("PostgreSQL version is required")
+	}
+	if _, err := os.Stat(fmt.Sprintf("/usr/lib/postgresql/%s/bin/postgres", config.PostgresVersion)); err != nil {
+		return fmt.Errorf("PostgreSQL %s is not installed, pgBackRest restores the source's version", config.PostgresVersion)
+	}
+	return config.ValidateTargetPostgresVersion()
+}
+
+// StartRestore starts the restore process from the pgBackRest repository
+func (p *PgBackRestProvider) StartRestore(ctx context.Context, params ProviderParams) error {
+	p.logger.Info().
+		Str("restore_id", params.Restore.ID).
+		Str("restore_name", params.Restore.Name).
+		Str("stanza", params.Config.PgBackRestStanza).
+		Str("delta_base", params.DeltaBaseDataset).
+		Int("port", params.Port).
+		Msg("Starting pgBackRest restore")
+
+	dataDir := fmt.Sprintf("%s/data", params.RestoreDataPath)
+	// Write pgBackRest config to /tmp because ZFS mount will overwrite the restore directory
+	pgbackrestConfPath := fmt.Sprintf("/tmp/pgbackrest_%s.conf", params.Restore.Name)
+
+	// The config holds the repository credentials, the restore script hands it to postgres and removes it
+	if err := os.WriteFile(pgbackrestConfPath, []byte(pgBackRestConfig(params.Config, dataDir)), 0600); err != nil {
+		return fmt.Errorf("failed to write pgBackRest config: %w", err)
+	}
+
+	scriptParams := pgBackRestRestoreParams{
+		PgVersion:          params.Config.PostgresVersion,
+		PgPort:             params.Port,
+		RestoreName:        params.Restore.Name,
+		TargetDatabaseName: params.Config.PgBackRestDatabaseName,
+		DataDir:            dataDir,
+		ZFSDataset:         params.ZFSDataset,
+		WALDataset:         params.WALDataset,
+		WALDir:             params.WALDir,
+		PriorityDirectives: priorityDirectives(params.Priority),
+		PgBackRestConfPath: pgbackrestConfPath,
+		StanzaName:         params.Config.PgBackRestStanza,
+		Repository:         pgBackRestRepository(params.Config),
+		DeltaBaseDataset:   params.DeltaBaseDataset,
+	}
+
+	// Start the restore script in background, parameters are passed in its environment
+	output, err := params.ProcessManager.StartScript(ctx, params.Restore.Name, pgBackRestRestoreScript, scriptParams, params.Priority)
+	if err != nil {
+		p.logger.Error().Err(err).Str("output", output).Msg("Failed to start restore script")
+		return fmt.Errorf("restore script execution failed: %w", err)
+	}
+
+	p.logger.Info().
+		Str("restore_id", params.Restore.ID).
+		Str("log_file", params.ProcessManager.GetLogFilePath(params.Restore.Name)).
+		Str("pid_file", params.ProcessManager.GetPIDFilePath(params.Restore.Name)).
+		Msg("pgBackRest restore script started successfully")
+
+	return nil
+}
+
+// deltaBaseDataset returns the dataset of the latest ready pgBackRest restore of the same PostgreSQL version,
+// the restore is seeded from (empty = none, the restore fetches every file from the repository)
+// A base from another stanza is still correct, the delta restore just finds fewer matching files
+func (o *Orchestrator) deltaBaseDataset(restore *models.Restore, config *models.Config) string {
+	var candidates []models.Restore
+	if err := o.db.Where("id != ? AND ready_at IS NOT NULL AND failed_at IS NULL AND raw = ? AND cloned_from_id = '' AND promoted_from_branch = '' AND adopted_from = ''",
+		restore.ID, false).
+		Where("postgres_version = ?", config.PostgresVersion).
+		Order("ready_at DESC").
+		Find(&candidates).Error; err != nil {
+		o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to find a delta restore base, running a full restore")
+		return ""
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Provenance != nil && candidate.Provenance.Method == string(ProviderTypePgBackRest) {
+			return o.resources.GetZFSDatasetName(candidate.Name)
+		}
+	}
+	return ""
+}
+
+// pgBackRestConfig generates the pgbackrest.conf restoring the configured stanza into pgDataPath
+func pgBackRestConfig(config *models.Config, pgDataPath string) string {
+	var conf strings.Builder
+
+	conf.WriteString("[global]\n")
+	conf.WriteString("log-path=/var/log/pgbackrest\n")
+	conf.WriteString("spool-path=/var/spool/pgbackrest\n")
+	conf.WriteString("lock-path=/tmp\n")
+	conf.WriteString(fmt.Sprintf("repo1-path=%s\n", config.PgBackRestRepoPath))
+
+	if config.PgBackRestS3Bucket != "" {
+		conf.WriteString("repo1-type=s3\n")
+		conf.WriteString(fmt.Sprintf("repo1-s3-bucket=%s\n", config.PgBackRestS3Bucket))
+		conf.WriteString(fmt.Sprintf("repo1-s3-endpoint=%s\n", config.PgBackRestS3Endpoint))
+		conf.WriteString(fmt.Sprintf("repo1-s3-region=%s\n", config.PgBackRestS3Region))
+		if config.PgBackRestS3Key != "" {
+			conf.WriteString(fmt.Sprintf("repo1-s3-key=%s\n", config.PgBackRestS3Key))
+			conf.WriteString(fmt.Sprintf("repo1-s3-key-secret=%s\n", config.PgBackRestS3KeySecret))
+		} else {
+			conf.WriteString("repo1-s3-key-type=auto\n") // Instance profile or web identity credentials
+		}
+	} else {
+		conf.WriteString("repo1-type=posix\n")
+	}
+
+	if config.PgBackRestCipherPass != "" {
+		conf.WriteString("repo1-cipher-type=aes-256-cbc\n")
+		conf.WriteString(fmt.Sprintf("repo1-cipher-pass=%s\n", config.PgBackRestCipherPass))
+	}
+	conf.WriteString("\n")
+
+	conf.WriteString(fmt.Sprintf("[%s]\n", config.PgBackRestStanza))
+	conf.WriteString(fmt.Sprintf("pg1-path=%s\n", pgDataPath))
+
+	return conf.String()
+}
+
+// pgBackRestRepository describes the repository without credentials, e.g. s3://bucket/path
+func pgBackRestRepository(config *models.Config) string {
+	if config.PgBackRestS3Bucket != "" {
+		return fmt.Sprintf("s3://%s%s", config.PgBackRestS3Bucket, config.PgBackRestRepoPath)
+	}
+	return config.PgBackRestRepoPath
+}
@@ -0,0 +1,103 @@
+package restore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestPgBackRestConfig(t *testing.T) {
+	config := &models.Config{PgBackRestStanza: "main", PgBackRestRepoPath: "/var/lib/pgbackrest", PgBackRestDatabaseName: "app"}
+	conf := pgBackRestConfig(config, "/opt/branchd/restore_1/data")
+	for _, want := range []string{"repo1-path=/var/lib/pgbackrest\n", "repo1-type=posix\n", "[main]\npg1-path=/opt/branchd/restore_1/data\n"} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("posix config doesn't contain %q:\n%s", want, conf)
+		}
+	}
+	if strings.Contains(conf, "cipher") {
+		t.Errorf("unencrypted repository config sets a cipher:\n%s", conf)
+	}
+
+	config.PgBackRestS3Bucket, config.PgBackRestS3Endpoint, config.PgBackRestS3Region = "backups", "s3.amazonaws.com", "us-east-1"
+	config.PgBackRestCipherPass = "passphrase"
+	conf = pgBackRestConfig(config, "/opt/branchd/restore_1/data")
+	for _, want := range []string{"repo1-type=s3\n", "repo1-s3-bucket=backups\n", "repo1-s3-key-type=auto\n", "repo1-cipher-type=aes-256-cbc\n", "repo1-cipher-pass=passphrase\n"} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("S3 config doesn't contain %q:\n%s", want, conf)
+		}
+	}
+
+	config.PgBackRestS3Key, config.PgBackRestS3KeySecret = "AKIA", "secret"
+	conf = pgBackRestConfig(config, "/opt/branchd/restore_1/data")
+	if !strings.Contains(conf, "repo1-s3-key=AKIA\nrepo1-s3-key-secret=secret\n") || strings.Contains(conf, "key-type=auto") {
+		t.Errorf("S3 config with keys:\n%s", conf)
+	}
+
+	if got := pgBackRestRepository(config); got != "s3://backups/var/lib/pgbackrest" {
+		t.Errorf("pgBackRestRepository() = %q, want the bucket and path without credentials", got)
+	}
+}
+
+func TestPgBackRestScriptEnv(t *testing.T) {
+	env := scriptEnv(pgBackRestRestoreParams{
+		PgVersion:          "16",
+		RestoreName:        "restore_20250102000000",
+		StanzaName:         "main",
+		Repository:         "/var/lib/pgbackrest",
+		DeltaBaseDataset:   "tank/restore_20250101000000",
+		PgBackRestConfPath: "/tmp/pgbackrest_restore_20250102000000.conf",
+	})
+
+	for name, want := range map[string]string{
+		"DELTA_BASE_DATASET": "tank/restore_20250101000000",
+		"STANZA_NAME":        "main",
+		"PGBACKREST_CONF":    "/tmp/pgbackrest_restore_20250102000000.conf",
+	} {
+		if env[name] != want {
+			t.Errorf("%s = %q, want %q", name, env[name], want)
+		}
+	}
+	for _, want := range []string{"RESTORE_FLAGS+=(--delta)", "provenance method pgbackrest"} {
+		if !strings.Contains(pgBackRestRestoreScript, want) {
+			t.Errorf("script doesn't contain %q", want)
+		}
+	}
+}
+
+func TestDeltaBaseDataset(t *testing.T) {
+	o := newTestOrchestrator(t)
+	config := &models.Config{PgBackRestStanza: "main", PostgresVersion: "16"}
+
+	readyAt := time.Now().Add(-2 * time.Hour)
+	create := func(name, method, version string, ready time.Time, modify func(r *models.Restore)) *models.Restore {
+		t.Helper()
+		restore := &models.Restore{Name: name, PostgresVersion: version, ReadyAt: &ready, Provenance: &models.RestoreProvenance{Method: method}}
+		if modify != nil {
+			modify(restore)
+		}
+		if err := o.db.Create(restore).Error; err != nil {
+			t.Fatalf("failed to create restore: %v", err)
+		}
+		return restore
+	}
+
+	current := &models.Restore{Name: "restore_20250105000000"}
+	if err := o.db.Create(current).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	if got := o.deltaBaseDataset(current, config); got != "" {
+		t.Errorf("deltaBaseDataset() without earlier restores = %q, want a full restore", got)
+	}
+
+	create("restore_20250101000000", "pgbackrest", "16", readyAt, nil)
+	create("restore_20250102000000", "logical", "16", readyAt.Add(time.Minute), nil)
+	create("restore_20250103000000", "pgbackrest", "15", readyAt.Add(2*time.Minute), nil)
+	create("restore_20250104000000", "pgbackrest", "16", readyAt.Add(3*time.Minute), func(r *models.Restore) { r.Raw = true })
+
+	want := o.resources.GetZFSDatasetName("restore_20250101000000")
+	if got := o.deltaBaseDataset(current, config); got != want {
+		t.Errorf("deltaBaseDataset() = %q, want the latest pgBackRest restore of PostgreSQL 16 (%q)", got, want)
+	}
+}
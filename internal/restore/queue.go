@@ -0,0 +1,86 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// QueueState describes the restores competing for Config.MaxConcurrentRestores
+type QueueState struct {
+	Running []string         // IDs of restores whose restore process is running
+	Queued  []models.Restore // Restores waiting to start, oldest first
+}
+
+// QueueState returns the running and queued restores (clones and promotions are created outside the queue)
+func (o *Orchestrator) QueueState(ctx context.Context) (*QueueState, error) {
+	var started []models.Restore
+	if err := o.db.Where("state IN ? AND cloned_from_id = '' AND promoted_from_branch = ''",
+		[]string{models.RestoreStateDumping, models.RestoreStateRestoring}).Find(&started).Error; err != nil {
+		return nil, fmt.Errorf("failed to load started restores: %w", err)
+	}
+
+	// Restores whose process exited are completing or about to fail, they don't hold a slot
+	state := &QueueState{}
+	for _, restore := range started {
+		// Adoptions run in their worker task rather than a restore process
+		if restore.AdoptedFrom != "" {
+			state.Running = append(state.Running, restore.ID)
+			continue
+		}
+		isRunning, _, err := o.processManager.CheckIfRunning(ctx, restore.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check restore %s: %w", restore.Name, err)
+		}
+		if isRunning {
+			state.Running = append(state.Running, restore.ID)
+		}
+	}
+
+	if err := o.db.Where("state = ? AND cloned_from_id = '' AND promoted_from_branch = ''", models.RestoreStatePending).
+		Order("created_at ASC").
+		Find(&state.Queued).Error; err != nil {
+		return nil, fmt.Errorf("failed to load queued restores: %w", err)
+	}
+
+	return state, nil
+}
+
+// Position returns the queue position of a restore (1 = starts next) or 0 if it can start now
+// Restores queued before it start first; limit 0 means unlimited
+func (q *QueueState) Position(restoreID string, limit int) int {
+	running := 0
+	for _, id := range q.Running {
+		if id != restoreID {
+			running++
+		}
+	}
+
+	// A restore that isn't queued (e.g. a retried start) goes before all queued ones
+	ahead := 0
+	for _, restore := range q.Queued {
+		if restore.ID == restoreID {
+			break
+		}
+		ahead++
+	}
+	if ahead == len(q.Queued) {
+		ahead = 0
+	}
+
+	return queuePosition(running, ahead, limit)
+}
+
+// Full reports whether a newly triggered restore would have to wait
+func (q *QueueState) Full(limit int) bool {
+	return limit > 0 && len(q.Running)+len(q.Queued) >= limit
+}
+
+// queuePosition returns the position of a restore with queuedAhead restores before it
+func queuePosition(running, queuedAhead, limit int) int {
+	if limit <= 0 || running+queuedAhead < limit {
+		return 0
+	}
+	return running + queuedAhead - limit + 1
+}
@@ -0,0 +1,37 @@
+package restore
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// RefreshBlocker returns why a due scheduled refresh has to wait, empty if it can start at now
+// A restore competes with branch creations for disk and CPU, so refreshes wait for their window and for
+// in-flight branch creations unless the config's refresh is forced
+func RefreshBlocker(db *gorm.DB, config *models.Config, now time.Time) (string, error) {
+	if config.RefreshForced {
+		return "", nil
+	}
+
+	windows, err := models.ParseRefreshWindows(config.RefreshWindows)
+	if err != nil {
+		return "", err
+	}
+	if len(windows) > 0 && !slices.ContainsFunc(windows, func(w models.RefreshWindow) bool { return w.Contains(now) }) {
+		return fmt.Sprintf("outside the refresh windows %s (UTC)", config.RefreshWindows), nil
+	}
+
+	var inFlight int64
+	if err := db.Model(&models.BranchOperation{}).Where("created_at > ?", now.Add(-models.BranchOperationTTL)).Count(&inFlight).Error; err != nil {
+		return "", fmt.Errorf("failed to count branch operations: %w", err)
+	}
+	if inFlight > 0 {
+		return fmt.Sprintf("%d branch creation(s) in progress", inFlight), nil
+	}
+	return "", nil
+}
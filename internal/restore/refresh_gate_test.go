@@ -0,0 +1,50 @@
+package restore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestRefreshBlocker(t *testing.T) {
+	o := newTestOrchestrator(t)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	config := &models.Config{}
+	if reason, err := RefreshBlocker(o.db, config, now); err != nil || reason != "" {
+		t.Fatalf("RefreshBlocker() = %q, %v, want no blocker without windows or branch operations", reason, err)
+	}
+
+	config.RefreshWindows = "01:00-05:00"
+	if reason, _ := RefreshBlocker(o.db, config, now); !strings.Contains(reason, "outside the refresh windows") {
+		t.Errorf("RefreshBlocker() = %q, want outside the refresh windows", reason)
+	}
+	config.RefreshWindows = "01:00-05:00,11:00-13:00"
+	if reason, _ := RefreshBlocker(o.db, config, now); reason != "" {
+		t.Errorf("RefreshBlocker() = %q inside a refresh window", reason)
+	}
+
+	// Operations of a crashed process expire, in-flight ones defer the refresh
+	stale := models.BranchOperation{BaseModel: models.BaseModel{CreatedAt: now.Add(-time.Hour)}, BranchName: "old", Operation: "create"}
+	if err := o.db.Create(&stale).Error; err != nil {
+		t.Fatalf("failed to create branch operation: %v", err)
+	}
+	if reason, _ := RefreshBlocker(o.db, config, now); reason != "" {
+		t.Errorf("RefreshBlocker() = %q, want expired branch operations ignored", reason)
+	}
+	inFlight := models.BranchOperation{BaseModel: models.BaseModel{CreatedAt: now.Add(-time.Minute)}, BranchName: "feature-x", Operation: "create"}
+	if err := o.db.Create(&inFlight).Error; err != nil {
+		t.Fatalf("failed to create branch operation: %v", err)
+	}
+	if reason, _ := RefreshBlocker(o.db, config, now); reason != "1 branch creation(s) in progress" {
+		t.Errorf("RefreshBlocker() = %q, want the in-flight branch creation", reason)
+	}
+
+	config.RefreshForced = true
+	config.RefreshWindows = "01:00-05:00"
+	if reason, _ := RefreshBlocker(o.db, config, now); reason != "" {
+		t.Errorf("RefreshBlocker() = %q, want a forced refresh never blocked", reason)
+	}
+}
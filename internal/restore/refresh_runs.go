@@ -0,0 +1,188 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// RefreshStatsWindows are the rolling windows (in days) of the refresh history's success rates
+var RefreshStatsWindows = []int{1, 7, 30, 90}
+
+// refreshOutcomes maps the final states of a restore to the outcome of its refresh run
+var refreshOutcomes = map[string]string{
+	models.RestoreStateReady:     models.RefreshOutcomeSucceeded,
+	models.RestoreStateFailed:    models.RefreshOutcomeFailed,
+	models.RestoreStateCancelled: models.RefreshOutcomeCancelled,
+}
+
+// StartRefreshRun records a refresh attempt of a restore, finished by FinishRefreshRun
+// Full refreshes finish when their restore reaches a final state (see Transition)
+func StartRefreshRun(db *gorm.DB, restore *models.Restore, trigger, mode string) error {
+	run := models.RefreshRun{
+		RestoreID:   restore.ID,
+		RestoreName: restore.Name,
+		Trigger:     trigger,
+		Mode:        mode,
+	}
+	if err := db.Create(&run).Error; err != nil {
+		return fmt.Errorf("failed to record refresh run: %w", err)
+	}
+	return nil
+}
+
+// FinishRefreshRun records the outcome of the running refresh of a restore, if one was recorded
+// Restores that aren't refreshes (clones, promotions, adoptions, raw restores) have none
+func FinishRefreshRun(db *gorm.DB, restore *models.Restore, outcome, reason string) error {
+	var run models.RefreshRun
+	err := db.Where("restore_id = ? AND outcome = ?", restore.ID, models.RefreshOutcomeRunning).
+		Order("created_at DESC").
+		First(&run).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load refresh run: %w", err)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"outcome":          outcome,
+		"finished_at":      now,
+		"duration_seconds": int64(now.Sub(run.CreatedAt).Seconds()),
+	}
+	if outcome == models.RefreshOutcomeSucceeded && run.Mode == models.RefreshModeFull && restore.Provenance != nil {
+		var size int64
+		for _, artifact := range restore.Provenance.Artifacts {
+			size += artifact.SizeBytes
+		}
+		updates["bytes_transferred"] = size
+	}
+	if outcome == models.RefreshOutcomeFailed {
+		updates["failure_category"] = FailureCategory(reason)
+		updates["failure_reason"] = reason
+	}
+
+	if err := db.Model(&run).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to record refresh outcome: %w", err)
+	}
+	return nil
+}
+
+// failureCategories are matched in order against the lowercased failure reason
+var failureCategories = []struct {
+	category string
+	patterns []string
+}{
+	{models.RefreshFailureDeadline, []string{string(StatusDeadlineExceeded)}},
+	{models.RefreshFailureDiskSpace, []string{"insufficient disk space", "no space left on device"}},
+	{models.RefreshFailureInterrupted, []string{"interrupted"}},
+	{models.RefreshFailureConfiguration, []string{"no restore source configured", "provider validation failed", "are not installed for postgresql", "locale is incompatible"}},
+	{models.RefreshFailureAnonymization, []string{"anonymization"}},
+	{models.RefreshFailureSQL, []string{"post-restore sql", "seed sql"}},
+	{models.RefreshFailureSource, []string{"connection refused", "could not connect", "could not translate host name", "password authentication failed",
+		"no pg_hba.conf entry", "timeout expired", "i/o timeout", "ssl", "permission denied for"}},
+}
+
+// FailureCategory classifies the failure reason of a refresh, so the history shows what keeps failing
+func FailureCategory(reason string) string {
+	lower := strings.ToLower(reason)
+	for _, category := range failureCategories {
+		for _, pattern := range category.patterns {
+			if strings.Contains(lower, pattern) {
+				return category.category
+			}
+		}
+	}
+	return models.RefreshFailureRestore
+}
+
+// RefreshHistory lists the refresh runs of the last days, newest first, with success rates over RefreshStatsWindows
+type RefreshHistory struct {
+	Days  int                 `json:"days"`
+	Runs  []models.RefreshRun `json:"runs"`
+	Stats []RefreshStats      `json:"stats"`
+}
+
+// RefreshStats summarizes the refresh runs of a rolling window, runs still in progress aren't counted
+type RefreshStats struct {
+	WindowDays int `json:"window_days"`
+	Total      int `json:"total"` // Finished runs
+	Succeeded  int `json:"succeeded"`
+	Failed     int `json:"failed"`
+	Cancelled  int `json:"cancelled"`
+
+	// Percentage of succeeded and failed runs that succeeded, nil without any (cancelled runs don't count)
+	SuccessRate *float64 `json:"success_rate"`
+
+	// Median duration of succeeded runs, 0 without any
+	MedianDurationSeconds int64 `json:"median_duration_seconds"`
+
+	FailureCategories map[string]int `json:"failure_categories"` // Failed runs per RefreshFailure* category
+}
+
+// GetRefreshHistory returns the refresh runs of the last days and the rolling success rates at now
+func GetRefreshHistory(db *gorm.DB, now time.Time, days int) (*RefreshHistory, error) {
+	oldest := days
+	for _, window := range RefreshStatsWindows {
+		oldest = max(oldest, window)
+	}
+
+	var runs []models.RefreshRun
+	if err := db.Where("created_at > ?", now.AddDate(0, 0, -oldest)).Order("created_at DESC").Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load refresh runs: %w", err)
+	}
+
+	history := &RefreshHistory{Days: days, Runs: []models.RefreshRun{}}
+	for _, run := range runs {
+		if run.CreatedAt.After(now.AddDate(0, 0, -days)) {
+			history.Runs = append(history.Runs, run)
+		}
+	}
+	for _, window := range RefreshStatsWindows {
+		history.Stats = append(history.Stats, refreshStats(runs, now, window))
+	}
+	return history, nil
+}
+
+// refreshStats summarizes the runs created in the window days before now
+func refreshStats(runs []models.RefreshRun, now time.Time, days int) RefreshStats {
+	stats := RefreshStats{WindowDays: days, FailureCategories: map[string]int{}}
+	since := now.AddDate(0, 0, -days)
+
+	var durations []int64
+	for _, run := range runs {
+		if !run.CreatedAt.After(since) {
+			continue
+		}
+		switch run.Outcome {
+		case models.RefreshOutcomeSucceeded:
+			stats.Succeeded++
+			durations = append(durations, run.DurationSeconds)
+		case models.RefreshOutcomeFailed:
+			stats.Failed++
+			stats.FailureCategories[run.FailureCategory]++
+		case models.RefreshOutcomeCancelled:
+			stats.Cancelled++
+		default:
+			continue
+		}
+		stats.Total++
+	}
+
+	if attempts := stats.Succeeded + stats.Failed; attempts > 0 {
+		rate := float64(stats.Succeeded) * 100 / float64(attempts)
+		stats.SuccessRate = &rate
+	}
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		stats.MedianDurationSeconds = durations[len(durations)/2]
+	}
+	return stats
+}
@@ -0,0 +1,113 @@
+package restore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestFinishRefreshRunOnTransition(t *testing.T) {
+	o := newTestOrchestrator(t)
+
+	restore := &models.Restore{Name: "restore_20250101000000", State: models.RestoreStateRestoring}
+	if err := o.db.Create(restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	if err := StartRefreshRun(o.db, restore, models.RefreshTriggerScheduled, models.RefreshModeFull); err != nil {
+		t.Fatalf("StartRefreshRun() error = %v", err)
+	}
+
+	if err := Transition(o.db, restore, models.RestoreStateFailed, map[string]interface{}{
+		"failure_reason": "pg_dump: error: connection to server failed: Connection refused",
+	}); err != nil {
+		t.Fatalf("Transition(failed) error = %v", err)
+	}
+
+	var run models.RefreshRun
+	o.db.First(&run, "restore_id = ?", restore.ID)
+	if run.Outcome != models.RefreshOutcomeFailed || run.FailureCategory != models.RefreshFailureSource || run.FinishedAt == nil {
+		t.Errorf("refresh run = outcome %q, category %q, finished_at %v; want failed source failure",
+			run.Outcome, run.FailureCategory, run.FinishedAt)
+	}
+
+	// Restores without a refresh run (clones, adoptions, ...) finish without one
+	clone := &models.Restore{Name: "restore_20250101000001", State: models.RestoreStateRestoring}
+	if err := o.db.Create(clone).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	if err := Transition(o.db, clone, models.RestoreStateReady, nil); err != nil {
+		t.Fatalf("Transition(ready) error = %v", err)
+	}
+	var count int64
+	o.db.Model(&models.RefreshRun{}).Count(&count)
+	if count != 1 {
+		t.Errorf("refresh runs = %d, want 1", count)
+	}
+}
+
+func TestFailureCategory(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   string
+	}{
+		{"deadline_exceeded: restore ran past its 12h deadline", models.RefreshFailureDeadline},
+		{"insufficient disk space: need 120GB, 80GB available", models.RefreshFailureDiskSpace},
+		{"restore process was interrupted 4 times", models.RefreshFailureInterrupted},
+		{"failed to execute post-restore SQL: syntax error at or near \"SELEC\"", models.RefreshFailureSQL},
+		{"failed to apply anonymization rules: column \"email\" does not exist", models.RefreshFailureAnonymization},
+		{"pg_dump: error: FATAL: password authentication failed for user \"app\"", models.RefreshFailureSource},
+		{"pg_restore: error: could not execute query", models.RefreshFailureRestore},
+	}
+
+	for _, tt := range tests {
+		if got := FailureCategory(tt.reason); got != tt.want {
+			t.Errorf("FailureCategory(%q) = %q, want %q", tt.reason, got, tt.want)
+		}
+	}
+}
+
+func TestGetRefreshHistory(t *testing.T) {
+	o := newTestOrchestrator(t)
+
+	now := time.Now()
+	runs := []models.RefreshRun{
+		{Outcome: models.RefreshOutcomeSucceeded, DurationSeconds: 600, BaseModel: models.BaseModel{CreatedAt: now.Add(-time.Hour)}},
+		{Outcome: models.RefreshOutcomeFailed, FailureCategory: models.RefreshFailureSource, BaseModel: models.BaseModel{CreatedAt: now.AddDate(0, 0, -2)}},
+		{Outcome: models.RefreshOutcomeCancelled, BaseModel: models.BaseModel{CreatedAt: now.AddDate(0, 0, -3)}},
+		{Outcome: models.RefreshOutcomeSucceeded, DurationSeconds: 1200, BaseModel: models.BaseModel{CreatedAt: now.AddDate(0, 0, -10)}},
+		{Outcome: models.RefreshOutcomeRunning, BaseModel: models.BaseModel{CreatedAt: now.Add(-time.Minute)}},
+		{Outcome: models.RefreshOutcomeSucceeded, BaseModel: models.BaseModel{CreatedAt: now.AddDate(0, 0, -100)}},
+	}
+	for i := range runs {
+		runs[i].RestoreID = "r1"
+		runs[i].RestoreName = "restore_20250101000000"
+		runs[i].Trigger = models.RefreshTriggerScheduled
+		runs[i].Mode = models.RefreshModeFull
+		if err := o.db.Create(&runs[i]).Error; err != nil {
+			t.Fatalf("failed to create refresh run: %v", err)
+		}
+	}
+
+	history, err := GetRefreshHistory(o.db, now, 7)
+	if err != nil {
+		t.Fatalf("GetRefreshHistory() error = %v", err)
+	}
+	if len(history.Runs) != 4 || history.Runs[0].Outcome != models.RefreshOutcomeRunning {
+		t.Errorf("runs of the last 7 days = %d, first %q; want 4, newest first", len(history.Runs), history.Runs[0].Outcome)
+	}
+
+	want := map[int]struct {
+		total int
+		rate  float64
+	}{1: {1, 100}, 7: {3, 50}, 30: {4, 200.0 / 3}, 90: {4, 200.0 / 3}}
+	for _, stats := range history.Stats {
+		w := want[stats.WindowDays]
+		if stats.Total != w.total || stats.SuccessRate == nil || *stats.SuccessRate != w.rate {
+			t.Errorf("%d day stats = total %d, success rate %v; want %d, %v", stats.WindowDays, stats.Total, stats.SuccessRate, w.total, w.rate)
+		}
+	}
+	if stats := history.Stats[2]; stats.MedianDurationSeconds != 1200 || stats.FailureCategories[models.RefreshFailureSource] != 1 {
+		t.Errorf("30 day stats = median %ds, categories %v; want 1200s and one source failure", stats.MedianDurationSeconds, stats.FailureCategories)
+	}
+}
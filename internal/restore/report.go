@@ -0,0 +1,275 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+const (
+	// maxRestoreReports is the number of reports kept in SQLite
+	maxRestoreReports = 50
+
+	// rowDriftWarningPercent is the row count change of a tracked table that produces a warning
+	rowDriftWarningPercent = 20.0
+)
+
+// snapshot holds the statistics collected from a restored database
+type snapshot struct {
+	SizeBytes int64
+	Tables    []string         // schema-qualified table names, sorted
+	RowCounts map[string]int64 // exact row counts for tracked tables
+}
+
+// GenerateReport collects statistics from a completed restore and compares them
+// against the most recent report of a previous restore
+func (o *Orchestrator) GenerateReport(ctx context.Context, restore *models.Restore, config *models.Config, databaseName string) (*models.RestoreReport, error) {
+	current, err := o.collectSnapshot(ctx, databaseName, restore.ClusterPostgresVersion(config), restore.Port, parseTrackedTables(config.ReportTrackedTables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect restore statistics: %w", err)
+	}
+
+	// Previous restores may already be deleted, so compare against the stored report
+	var previous *models.RestoreReport
+	var previousReport models.RestoreReport
+	err = o.db.Where("restore_id != ?", restore.ID).Order("created_at DESC").First(&previousReport).Error
+	if err == nil {
+		previous = &previousReport
+	}
+
+	report := buildReport(restore, current, previous)
+
+	// Replace any earlier report for this restore (e.g. manual re-run)
+	if err := o.db.Where("restore_id = ?", restore.ID).Delete(&models.RestoreReport{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete existing report: %w", err)
+	}
+	if err := o.db.Create(report).Error; err != nil {
+		return nil, fmt.Errorf("failed to save restore report: %w", err)
+	}
+
+	o.pruneReports()
+
+	logEvent := o.logger.Info()
+	if len(report.Warnings) > 0 {
+		logEvent = o.logger.Warn().Strs("warnings", report.Warnings)
+	}
+	logEvent.
+		Str("restore_id", restore.ID).
+		Str("previous_restore_name", report.PreviousRestoreName).
+		Int64("size_delta_bytes", report.SizeDeltaBytes).
+		Int("table_count_delta", report.TableCountDelta).
+		Int("new_tables", len(report.NewTables)).
+		Int("dropped_tables", len(report.DroppedTables)).
+		Msg("Restore comparison report generated")
+
+	return report, nil
+}
+
+// buildReport compares the current snapshot against the previous report
+func buildReport(restore *models.Restore, current *snapshot, previous *models.RestoreReport) *models.RestoreReport {
+	report := &models.RestoreReport{
+		RestoreID:     restore.ID,
+		RestoreName:   restore.Name,
+		SizeBytes:     current.SizeBytes,
+		TableCount:    len(current.Tables),
+		NewTables:     []string{},
+		DroppedTables: []string{},
+		RowCountDrift: []models.RowCountDrift{},
+		Warnings:      []string{},
+		Tables:        current.Tables,
+		RowCounts:     current.RowCounts,
+	}
+
+	// First report has nothing to compare against
+	if previous == nil {
+		return report
+	}
+
+	report.PreviousRestoreID = previous.RestoreID
+	report.PreviousRestoreName = previous.RestoreName
+	report.SizeDeltaBytes = current.SizeBytes - previous.SizeBytes
+	report.TableCountDelta = len(current.Tables) - previous.TableCount
+
+	previousTables := make(map[string]bool, len(previous.Tables))
+	for _, table := range previous.Tables {
+		previousTables[table] = true
+	}
+	currentTables := make(map[string]bool, len(current.Tables))
+	for _, table := range current.Tables {
+		currentTables[table] = true
+		if !previousTables[table] {
+			report.NewTables = append(report.NewTables, table)
+		}
+	}
+	for _, table := range previous.Tables {
+		if !currentTables[table] {
+			report.DroppedTables = append(report.DroppedTables, table)
+			report.Warnings = append(report.Warnings, fmt.Sprintf("table %s was dropped", table))
+		}
+	}
+
+	// Row count drift for tracked tables present in both restores
+	tracked := make([]string, 0, len(current.RowCounts))
+	for table := range current.RowCounts {
+		tracked = append(tracked, table)
+	}
+	sort.Strings(tracked)
+
+	for _, table := range tracked {
+		previousRows, ok := previous.RowCounts[table]
+		if !ok {
+			continue
+		}
+		currentRows := current.RowCounts[table]
+
+		drift := models.RowCountDrift{
+			Table:        table,
+			PreviousRows: previousRows,
+			CurrentRows:  currentRows,
+			Delta:        currentRows - previousRows,
+		}
+		if previousRows > 0 {
+			drift.DeltaPercent = math.Round(float64(drift.Delta)/float64(previousRows)*1000) / 10
+		}
+		report.RowCountDrift = append(report.RowCountDrift, drift)
+
+		switch {
+		case previousRows > 0 && currentRows == 0:
+			report.Warnings = append(report.Warnings, fmt.Sprintf("table %s is now empty (previously %d rows)", table, previousRows))
+		case math.Abs(drift.DeltaPercent) >= rowDriftWarningPercent:
+			report.Warnings = append(report.Warnings, fmt.Sprintf("table %s row count changed by %.1f%% (%d -> %d)", table, drift.DeltaPercent, previousRows, currentRows))
+		}
+	}
+
+	return report
+}
+
+// collectSnapshot queries database size, table list and tracked table row counts
+func (o *Orchestrator) collectSnapshot(ctx context.Context, databaseName, postgresVersion string, port int, trackedTables []string) (*snapshot, error) {
+	output, err := runReportQuery(ctx, databaseName, postgresVersion, port, `
+SELECT 'SIZE|' || pg_database_size(current_database());
+SELECT 'TABLE|' || n.nspname || '.' || c.relname
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'p')
+  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+  AND n.nspname NOT LIKE 'pg_toast%'
+ORDER BY 1;`)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{Tables: []string{}, RowCounts: map[string]int64{}}
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if after, ok := strings.CutPrefix(line, "SIZE|"); ok {
+			snap.SizeBytes, _ = strconv.ParseInt(after, 10, 64)
+		} else if after, ok := strings.CutPrefix(line, "TABLE|"); ok {
+			snap.Tables = append(snap.Tables, after)
+			existing[after] = true
+		}
+	}
+	sort.Strings(snap.Tables)
+
+	// Exact counts only for tracked tables that exist (count(*) on every table would be too slow)
+	var countQueries []string
+	for _, table := range trackedTables {
+		if !existing[table] {
+			continue
+		}
+		countQueries = append(countQueries, fmt.Sprintf("SELECT 'ROWS|' || count(*) || '|' || %s FROM %s;",
+			pgclient.QuoteLiteral(table), pgclient.QuoteTable(table)))
+	}
+	if len(countQueries) == 0 {
+		return snap, nil
+	}
+
+	output, err = runReportQuery(ctx, databaseName, postgresVersion, port, strings.Join(countQueries, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		after, ok := strings.CutPrefix(strings.TrimSpace(line), "ROWS|")
+		if !ok {
+			continue
+		}
+		count, table, found := strings.Cut(after, "|")
+		if !found {
+			continue
+		}
+		if n, err := strconv.ParseInt(count, 10, 64); err == nil {
+			snap.RowCounts[table] = n
+		}
+	}
+
+	return snap, nil
+}
+
+// pruneReports deletes the oldest reports beyond maxRestoreReports
+func (o *Orchestrator) pruneReports() {
+	var staleIDs []string
+	if err := o.db.Model(&models.RestoreReport{}).
+		Order("created_at DESC").
+		Offset(maxRestoreReports).
+		Pluck("id", &staleIDs).Error; err != nil {
+		o.logger.Warn().Err(err).Msg("Failed to find old restore reports")
+		return
+	}
+	if len(staleIDs) == 0 {
+		return
+	}
+	if err := o.db.Where("id IN ?", staleIDs).Delete(&models.RestoreReport{}).Error; err != nil {
+		o.logger.Warn().Err(err).Msg("Failed to delete old restore reports")
+	}
+}
+
+// reportQueryScript runs the SQL on its standard input against a restore, printing unaligned tuples only
+const reportQueryScript = `set -euo pipefail
+sudo -u postgres "/usr/lib/postgresql/${PG_VERSION}/bin/psql" -X -t -A -v ON_ERROR_STOP=1 -p "${PG_PORT}" -d "${DATABASE_NAME}"`
+
+// reportQueryParams are the parameters of reportQueryScript
+type reportQueryParams struct {
+	DatabaseName string `env:"DATABASE_NAME"`
+	PgVersion    string `env:"PG_VERSION"`
+	PgPort       int    `env:"PG_PORT"`
+}
+
+// runReportQuery runs read-only SQL against a restore and returns unaligned tuples-only output
+func runReportQuery(ctx context.Context, databaseName, postgresVersion string, port int, sql string) (string, error) {
+	cmd := shellexec.Command(ctx, reportQueryScript, reportQueryParams{
+		DatabaseName: databaseName,
+		PgVersion:    postgresVersion,
+		PgPort:       port,
+	})
+	cmd.Stdin = strings.NewReader(sql)
+	outputBytes, err := cmd.CombinedOutput()
+	output := string(outputBytes)
+	if err != nil {
+		return "", fmt.Errorf("report query failed: %w (output: %s)", err, output)
+	}
+	return output, nil
+}
+
+// parseTrackedTables parses a comma-separated table list, defaulting to the public schema
+func parseTrackedTables(value string) []string {
+	var tables []string
+	for _, table := range strings.Split(value, ",") {
+		table = strings.TrimSpace(table)
+		if table == "" {
+			continue
+		}
+		if !strings.Contains(table, ".") {
+			table = "public." + table
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
@@ -0,0 +1,144 @@
+package restore
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// newTestOrchestrator returns an orchestrator on a migrated in-memory database
+func newTestOrchestrator(t *testing.T) *Orchestrator {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// In-memory databases exist per connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	return NewOrchestrator(db, &config.Config{}, zerolog.Nop())
+}
+
+func TestBuildReport(t *testing.T) {
+	restore := &models.Restore{BaseModel: models.BaseModel{ID: "r2"}, Name: "restore_20250102000000"}
+	previous := &models.RestoreReport{
+		RestoreID:   "r1",
+		RestoreName: "restore_20250101000000",
+		SizeBytes:   1000,
+		TableCount:  4,
+		Tables:      []string{"public.events", "public.orders", "public.sessions", "public.users"},
+		RowCounts:   map[string]int64{"public.events": 50, "public.orders": 100, "public.sessions": 10, "public.users": 200},
+	}
+	current := &snapshot{
+		SizeBytes: 1500,
+		Tables:    []string{"billing.invoices", "public.events", "public.orders", "public.users"},
+		RowCounts: map[string]int64{"billing.invoices": 5, "public.events": 0, "public.orders": 130, "public.users": 210},
+	}
+
+	report := buildReport(restore, current, previous)
+
+	if report.PreviousRestoreID != "r1" || report.PreviousRestoreName != "restore_20250101000000" {
+		t.Errorf("previous restore = %s/%s, want r1/restore_20250101000000", report.PreviousRestoreID, report.PreviousRestoreName)
+	}
+	if report.SizeDeltaBytes != 500 || report.TableCount != 4 || report.TableCountDelta != 0 {
+		t.Errorf("size delta = %d, tables = %d (delta %d), want 500, 4 (delta 0)", report.SizeDeltaBytes, report.TableCount, report.TableCountDelta)
+	}
+	if want := []string{"billing.invoices"}; !reflect.DeepEqual(report.NewTables, want) {
+		t.Errorf("NewTables = %v, want %v", report.NewTables, want)
+	}
+	if want := []string{"public.sessions"}; !reflect.DeepEqual(report.DroppedTables, want) {
+		t.Errorf("DroppedTables = %v, want %v", report.DroppedTables, want)
+	}
+
+	// Only tables tracked in both restores drift, sorted by name
+	wantDrift := []models.RowCountDrift{
+		{Table: "public.events", PreviousRows: 50, CurrentRows: 0, Delta: -50, DeltaPercent: -100},
+		{Table: "public.orders", PreviousRows: 100, CurrentRows: 130, Delta: 30, DeltaPercent: 30},
+		{Table: "public.users", PreviousRows: 200, CurrentRows: 210, Delta: 10, DeltaPercent: 5},
+	}
+	if !reflect.DeepEqual(report.RowCountDrift, wantDrift) {
+		t.Errorf("RowCountDrift = %+v, want %+v", report.RowCountDrift, wantDrift)
+	}
+
+	wantWarnings := []string{
+		"table public.sessions was dropped",
+		"table public.events is now empty (previously 50 rows)",
+		"table public.orders row count changed by 30.0% (100 -> 130)",
+	}
+	if !reflect.DeepEqual(report.Warnings, wantWarnings) {
+		t.Errorf("Warnings = %q, want %q", report.Warnings, wantWarnings)
+	}
+}
+
+func TestBuildReportWithoutPrevious(t *testing.T) {
+	restore := &models.Restore{BaseModel: models.BaseModel{ID: "r1"}, Name: "restore_20250101000000"}
+	current := &snapshot{SizeBytes: 1000, Tables: []string{"public.users"}, RowCounts: map[string]int64{"public.users": 200}}
+
+	report := buildReport(restore, current, nil)
+
+	if report.PreviousRestoreID != "" || report.SizeDeltaBytes != 0 || report.TableCountDelta != 0 {
+		t.Errorf("first report compares against something: %+v", report)
+	}
+	// Empty lists serialize as [] for API clients
+	if report.NewTables == nil || report.DroppedTables == nil || report.RowCountDrift == nil || report.Warnings == nil {
+		t.Errorf("first report has nil lists: %+v", report)
+	}
+	if !reflect.DeepEqual(report.Tables, current.Tables) || !reflect.DeepEqual(report.RowCounts, current.RowCounts) {
+		t.Errorf("report snapshot = %v %v, want %v %v", report.Tables, report.RowCounts, current.Tables, current.RowCounts)
+	}
+}
+
+func TestPruneReports(t *testing.T) {
+	o := newTestOrchestrator(t)
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxRestoreReports+3; i++ {
+		report := &models.RestoreReport{
+			BaseModel:   models.BaseModel{CreatedAt: base.Add(time.Duration(i) * time.Hour)},
+			RestoreID:   fmt.Sprintf("r%d", i),
+			RestoreName: fmt.Sprintf("restore_%d", i),
+		}
+		if err := o.db.Create(report).Error; err != nil {
+			t.Fatalf("failed to create report: %v", err)
+		}
+	}
+
+	o.pruneReports()
+
+	var restoreIDs []string
+	if err := o.db.Model(&models.RestoreReport{}).Order("created_at").Pluck("restore_id", &restoreIDs).Error; err != nil {
+		t.Fatalf("failed to load reports: %v", err)
+	}
+	if len(restoreIDs) != maxRestoreReports {
+		t.Fatalf("kept %d reports, want %d", len(restoreIDs), maxRestoreReports)
+	}
+	if restoreIDs[0] != "r3" {
+		t.Errorf("oldest kept report = %s, want r3 (the three oldest pruned)", restoreIDs[0])
+	}
+}
+
+func TestParseTrackedTables(t *testing.T) {
+	got := parseTrackedTables(" users, billing.invoices ,, orders")
+	want := []string{"public.users", "billing.invoices", "public.orders"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTrackedTables() = %v, want %v", got, want)
+	}
+	if got := parseTrackedTables(""); len(got) != 0 {
+		t.Errorf("parseTrackedTables(\"\") = %v, want none", got)
+	}
+}
@@ -7,25 +7,64 @@ import (
 	"strings"
 
 	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/shellexec"
 )
 
+// portStatusScript prints "in_use" if something listens on the port, "available" otherwise
+const portStatusScript = `ss -ln | grep -q ":${PORT} " && echo 'in_use' || echo 'available'`
+
+// portStatusParams are the parameters of portStatusScript
+type portStatusParams struct {
+	Port int `env:"PORT"`
+}
+
+// removeServiceScript removes a unit file and reloads systemd
+const removeServiceScript = `sudo rm -f "${SERVICE_FILE}" && sudo systemctl daemon-reload`
+
+// removeServiceParams are the parameters of removeServiceScript
+type removeServiceParams struct {
+	ServiceFile string `env:"SERVICE_FILE"`
+}
+
+// killDirectoryProcessesScript kills the processes with files open in a directory, with SIGKILL if SIGTERM isn't enough
+const killDirectoryProcessesScript = `pids=$(sudo lsof -t +D "${DIRECTORY}" 2>/dev/null || true)
+if [ -n "$pids" ]; then
+    echo "Killing processes: $pids"
+    sudo kill -TERM $pids 2>/dev/null || true
+    sleep 2
+    # Check again and use SIGKILL if needed
+    pids=$(sudo lsof -t +D "${DIRECTORY}" 2>/dev/null || true)
+    if [ -n "$pids" ]; then
+        sudo kill -9 $pids 2>/dev/null || true
+    fi
+fi`
+
+// killDirectoryProcessesParams are the parameters of killDirectoryProcessesScript
+type killDirectoryProcessesParams struct {
+	Directory string `env:"DIRECTORY"`
+}
+
 // ResourceManager handles system resources for restore operations
 // This includes port allocation, ZFS dataset management, and systemd services
 type ResourceManager struct {
-	logger zerolog.Logger
+	storage config.StorageConfig
+	logger  zerolog.Logger
 }
 
 // NewResourceManager creates a new resource manager
-func NewResourceManager(logger zerolog.Logger) *ResourceManager {
+func NewResourceManager(storage config.StorageConfig, logger zerolog.Logger) *ResourceManager {
 	return &ResourceManager{
-		logger: logger,
+		storage: storage,
+		logger:  logger,
 	}
 }
 
 // FindAvailablePort finds an available port in the range 50000-60000 for a new restore cluster
 func (r *ResourceManager) FindAvailablePort(ctx context.Context) (int, error) {
 	for port := 50000; port < 60000; port++ {
-		cmd := exec.CommandContext(ctx, "bash", "-c", fmt.Sprintf("ss -ln | grep -q ':%d ' && echo 'in_use' || echo 'available'", port))
+		cmd := shellexec.Command(ctx, portStatusScript, portStatusParams{Port: port})
 		output, err := cmd.Output()
 		if err != nil {
 			continue
@@ -45,8 +84,7 @@ func (r *ResourceManager) StopSystemdService(ctx context.Context, serviceName st
 	r.logger.Info().Str("service", serviceName).Msg("Stopping PostgreSQL service")
 
 	// Stop service
-	stopCmd := fmt.Sprintf("sudo systemctl stop %s || true", serviceName)
-	cmd := exec.CommandContext(ctx, "bash", "-c", stopCmd)
+	cmd := exec.CommandContext(ctx, "sudo", "systemctl", "stop", serviceName)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		r.logger.Warn().
 			Err(err).
@@ -55,8 +93,7 @@ func (r *ResourceManager) StopSystemdService(ctx context.Context, serviceName st
 	}
 
 	// Disable service
-	disableCmd := fmt.Sprintf("sudo systemctl disable %s || true", serviceName)
-	cmd = exec.CommandContext(ctx, "bash", "-c", disableCmd)
+	cmd = exec.CommandContext(ctx, "sudo", "systemctl", "disable", serviceName)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		r.logger.Warn().
 			Err(err).
@@ -71,9 +108,9 @@ func (r *ResourceManager) StopSystemdService(ctx context.Context, serviceName st
 func (r *ResourceManager) RemoveSystemdService(ctx context.Context, serviceName string) error {
 	r.logger.Info().Msg("Removing systemd service file")
 
-	serviceFile := fmt.Sprintf("/etc/systemd/system/%s.service", serviceName)
-	removeServiceCmd := fmt.Sprintf("sudo rm -f %s && sudo systemctl daemon-reload", serviceFile)
-	cmd := exec.CommandContext(ctx, "bash", "-c", removeServiceCmd)
+	cmd := shellexec.Command(ctx, removeServiceScript, removeServiceParams{
+		ServiceFile: fmt.Sprintf("/etc/systemd/system/%s.service", serviceName),
+	})
 	if output, err := cmd.CombinedOutput(); err != nil {
 		r.logger.Warn().
 			Err(err).
@@ -88,8 +125,7 @@ func (r *ResourceManager) RemoveSystemdService(ctx context.Context, serviceName
 func (r *ResourceManager) DestroyZFSDataset(ctx context.Context, datasetName string) error {
 	r.logger.Info().Str("zfs_dataset", datasetName).Msg("Destroying ZFS dataset")
 
-	destroyCmd := fmt.Sprintf("sudo zfs destroy -r %s", datasetName)
-	cmd := exec.CommandContext(ctx, "bash", "-c", destroyCmd)
+	cmd := exec.CommandContext(ctx, "sudo", "zfs", "destroy", "-r", datasetName)
 	outputBytes, err := cmd.CombinedOutput()
 	output := string(outputBytes)
 	if err != nil {
@@ -108,25 +144,32 @@ func (r *ResourceManager) DestroyZFSDataset(ctx context.Context, datasetName str
 	return nil
 }
 
+// PromoteZFSDataset promotes a cloned dataset so it no longer depends on its origin (no-op if it is not a clone)
+func (r *ResourceManager) PromoteZFSDataset(ctx context.Context, datasetName string) error {
+	if r.zfsOrigin(ctx, datasetName) == "" {
+		return nil
+	}
+
+	r.logger.Info().Str("zfs_dataset", datasetName).Msg("Promoting ZFS dataset")
+
+	cmd := exec.CommandContext(ctx, "sudo", "zfs", "promote", datasetName)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		r.logger.Error().
+			Err(err).
+			Str("zfs_dataset", datasetName).
+			Str("output", string(output)).
+			Msg("Failed to promote ZFS dataset")
+		return fmt.Errorf("failed to promote ZFS dataset: %w", err)
+	}
+
+	return nil
+}
+
 // KillProcessesInDirectory kills any processes that have files open in the given directory
 func (r *ResourceManager) KillProcessesInDirectory(ctx context.Context, directory string) error {
 	r.logger.Info().Str("directory", directory).Msg("Killing any remaining processes")
 
-	killCmd := fmt.Sprintf(`
-		pids=$(sudo lsof -t +D %s 2>/dev/null || true)
-		if [ -n "$pids" ]; then
-			echo "Killing processes: $pids"
-			sudo kill -TERM $pids 2>/dev/null || true
-			sleep 2
-			# Check again and use SIGKILL if needed
-			pids=$(sudo lsof -t +D %s 2>/dev/null || true)
-			if [ -n "$pids" ]; then
-				sudo kill -9 $pids 2>/dev/null || true
-			fi
-		fi
-	`, directory, directory)
-
-	cmd := exec.CommandContext(ctx, "bash", "-c", killCmd)
+	cmd := shellexec.Command(ctx, killDirectoryProcessesScript, killDirectoryProcessesParams{Directory: directory})
 	if output, err := cmd.CombinedOutput(); err != nil {
 		r.logger.Warn().
 			Err(err).
@@ -140,9 +183,9 @@ func (r *ResourceManager) KillProcessesInDirectory(ctx context.Context, director
 // CleanupRestore performs full cleanup of a restore's resources
 // This includes: killing processes, stopping systemd, destroying ZFS
 func (r *ResourceManager) CleanupRestore(ctx context.Context, restoreName string, processManager *ProcessManager) error {
-	serviceName := fmt.Sprintf("branchd-restore-%s", restoreName)
-	zfsDataset := fmt.Sprintf("tank/%s", restoreName)
-	dataDir := fmt.Sprintf("/opt/branchd/%s/data", restoreName)
+	serviceName := r.GetServiceName(restoreName)
+	zfsDataset := r.GetZFSDatasetName(restoreName)
+	dataDir := r.GetDataDirectory(restoreName)
 
 	// 1. Kill any active restore process (via PID file)
 	if err := processManager.KillProcess(ctx, restoreName); err != nil {
@@ -164,30 +207,77 @@ func (r *ResourceManager) CleanupRestore(ctx context.Context, restoreName string
 		r.logger.Warn().Err(err).Msg("Failed to kill remaining processes (continuing)")
 	}
 
-	// 5. Destroy ZFS dataset
+	// 5. Destroy ZFS dataset (and the source snapshot it was cloned from, for cloned restores)
+	origin := r.zfsOrigin(ctx, zfsDataset)
 	if err := r.DestroyZFSDataset(ctx, zfsDataset); err != nil {
 		return fmt.Errorf("failed to destroy ZFS dataset: %w", err)
 	}
+	if origin != "" {
+		if err := r.DestroyZFSDataset(ctx, origin); err != nil {
+			r.logger.Warn().Err(err).Str("snapshot", origin).Msg("Failed to destroy clone origin snapshot (continuing)")
+		}
+	}
+
+	// 6. Destroy WAL dataset if pg_wal lives on a separate device
+	// Only if it exists, the restore may predate the separate WAL configuration
+	if walDataset := r.GetWALDatasetName(restoreName); walDataset != "" {
+		checkCmd := exec.CommandContext(ctx, "sudo", "zfs", "list", walDataset)
+		if checkCmd.Run() == nil {
+			walOrigin := r.zfsOrigin(ctx, walDataset)
+			if err := r.DestroyZFSDataset(ctx, walDataset); err != nil {
+				return fmt.Errorf("failed to destroy WAL dataset: %w", err)
+			}
+			if walOrigin != "" {
+				if err := r.DestroyZFSDataset(ctx, walOrigin); err != nil {
+					r.logger.Warn().Err(err).Str("snapshot", walOrigin).Msg("Failed to destroy WAL clone origin snapshot (continuing)")
+				}
+			}
+		}
+	}
 
 	return nil
 }
 
+// zfsOrigin returns the snapshot a dataset was cloned from (empty if it is not a clone)
+func (r *ResourceManager) zfsOrigin(ctx context.Context, datasetName string) string {
+	cmd := exec.CommandContext(ctx, "sudo", "zfs", "get", "-H", "-o", "value", "origin", datasetName)
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	origin := strings.TrimSpace(string(output))
+	if origin == "-" {
+		return ""
+	}
+	return origin
+}
+
 // GetServiceName returns the systemd service name for a restore
-func GetServiceName(restoreName string) string {
+func (r *ResourceManager) GetServiceName(restoreName string) string {
 	return fmt.Sprintf("branchd-restore-%s", restoreName)
 }
 
 // GetZFSDatasetName returns the ZFS dataset name for a restore
-func GetZFSDatasetName(restoreName string) string {
-	return fmt.Sprintf("tank/%s", restoreName)
+func (r *ResourceManager) GetZFSDatasetName(restoreName string) string {
+	return r.storage.DatasetName(restoreName)
 }
 
 // GetDataDirectory returns the PostgreSQL data directory path for a restore
-func GetDataDirectory(restoreName string) string {
-	return fmt.Sprintf("/opt/branchd/%s/data", restoreName)
+func (r *ResourceManager) GetDataDirectory(restoreName string) string {
+	return r.storage.DataDir(restoreName)
 }
 
 // GetRestoreDataPath returns the base path for a restore's data
-func GetRestoreDataPath(restoreName string) string {
-	return fmt.Sprintf("/opt/branchd/%s", restoreName)
+func (r *ResourceManager) GetRestoreDataPath(restoreName string) string {
+	return r.storage.MountPath(restoreName)
+}
+
+// GetWALDatasetName returns the WAL dataset name for a restore (empty if WAL is not separate)
+func (r *ResourceManager) GetWALDatasetName(restoreName string) string {
+	return r.storage.WALDatasetName(restoreName)
+}
+
+// GetWALDirectory returns the pg_wal directory for a restore (empty if WAL is not separate)
+func (r *ResourceManager) GetWALDirectory(restoreName string) string {
+	return r.storage.WALDir(restoreName)
 }
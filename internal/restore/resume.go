@@ -0,0 +1,70 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// MaxResumes is how often an interrupted restore is queued again before it's marked failed
+// A restore that keeps getting interrupted (e.g. it runs the VM out of memory) would otherwise never stop
+const MaxResumes = 3
+
+// Interrupted reports whether a started restore's process is gone without writing its result,
+// e.g. because the VM rebooted. Restores whose process exited normally are completed by the restore supervisor
+func (o *Orchestrator) Interrupted(ctx context.Context, restore *models.Restore) (bool, error) {
+	if restore.State != models.RestoreStateDumping && restore.State != models.RestoreStateRestoring {
+		return false, nil
+	}
+
+	isRunning, pid, err := o.processManager.CheckIfRunning(ctx, restore.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to check restore process: %w", err)
+	}
+	if isRunning {
+		o.logger.Info().
+			Str("restore_id", restore.ID).
+			Str("state", restore.State).
+			Int("pid", pid).
+			Msg("Re-attached to running restore process")
+		return false, nil
+	}
+
+	status, _, err := o.processManager.CheckStatus(ctx, restore.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to check restore result: %w", err)
+	}
+	return !status.IsTerminal(), nil
+}
+
+// Requeue puts an interrupted restore back in the queue, its next start runs the restore from scratch
+// The restore script recreates the restore's datasets, only processes left over from the interrupted run are stopped
+func (o *Orchestrator) Requeue(ctx context.Context, restore *models.Restore) error {
+	if err := o.resources.KillProcessesInDirectory(ctx, o.resources.GetRestoreDataPath(restore.Name)); err != nil {
+		o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to stop restore processes")
+	}
+
+	// The deadline and queue position start over, the restore keeps its place before restores created after it
+	if err := Transition(o.db, restore, models.RestoreStatePending, map[string]interface{}{
+		"started_at":               nil,
+		"restoring_at":             nil,
+		"resume_count":             gorm.Expr("resume_count + 1"),
+		"tables_total":             0,
+		"tables_restored":          0,
+		"progress_percent":         0,
+		"estimated_data_loaded_at": nil,
+	}); err != nil {
+		return err
+	}
+	restore.ResumeCount++
+
+	o.logger.Warn().
+		Str("restore_id", restore.ID).
+		Str("restore_name", restore.Name).
+		Int("resume_count", restore.ResumeCount).
+		Msg("Restore process was interrupted, queued the restore again")
+	return nil
+}
@@ -0,0 +1,46 @@
+package restore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestRequeue(t *testing.T) {
+	o := newTestOrchestrator(t)
+
+	startedAt := time.Now().Add(-time.Hour)
+	restore := &models.Restore{Name: "restore_20250101000000", State: models.RestoreStateRestoring, StartedAt: &startedAt, RestoringAt: &startedAt, ResumeCount: 1}
+	if err := o.db.Create(restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+
+	if err := o.Requeue(context.Background(), restore); err != nil {
+		t.Fatalf("Requeue() error = %v", err)
+	}
+
+	var got models.Restore
+	o.db.First(&got, "id = ?", restore.ID)
+	if got.State != models.RestoreStatePending || got.ResumeCount != 2 || got.StartedAt != nil || got.RestoringAt != nil {
+		t.Errorf("requeued restore = state %q, resume_count %d, started_at %v, restoring_at %v; want pending and started over",
+			got.State, got.ResumeCount, got.StartedAt, got.RestoringAt)
+	}
+
+	// Queued restores haven't started, there is nothing to requeue
+	if err := o.Requeue(context.Background(), restore); err == nil {
+		t.Error("Requeue() of a queued restore succeeded")
+	}
+}
+
+func TestInterruptedOnlyChecksStartedRestores(t *testing.T) {
+	o := newTestOrchestrator(t)
+
+	for _, state := range []string{models.RestoreStatePending, models.RestoreStateAnonymizing, models.RestoreStateReady} {
+		interrupted, err := o.Interrupted(context.Background(), &models.Restore{Name: "restore_20250101000000", State: state})
+		if err != nil || interrupted {
+			t.Errorf("Interrupted(%s) = %v, %v; want false", state, interrupted, err)
+		}
+	}
+}
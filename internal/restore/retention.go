@@ -0,0 +1,187 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Reasons a restore is deleted by the retention policy, recorded in its audit event
+const (
+	RetentionReasonMaxRestores = "max_restores" // Beyond the newest Config.MaxRestores restores
+	RetentionReasonMaxAge      = "max_age"      // Older than Config.RestoreMaxAgeDays
+	RetentionReasonFailed      = "failed"       // Failed or cancelled, and a newer restore is ready
+)
+
+// RetentionDeletion is a restore deleted by the retention policy
+type RetentionDeletion struct {
+	RestoreID   string `json:"restore_id"`
+	RestoreName string `json:"restore_name"`
+	Reason      string `json:"reason"`
+}
+
+// retentionPolicy is what the retention engine keeps, see Config.MaxRestores, RestoreMaxAgeDays and RestoreKeepLatest
+type retentionPolicy struct {
+	maxRestores int           // Restores kept, including running ones
+	maxAge      time.Duration // 0 = no age limit
+	keepLatest  int           // Newest data-ready restores that are never deleted
+}
+
+// newRetentionPolicy returns the retention policy of a config, reserve leaves room for restores about to be created
+func newRetentionPolicy(config *models.Config, reserve int) retentionPolicy {
+	return retentionPolicy{
+		maxRestores: config.MaxRestores - reserve,
+		maxAge:      time.Duration(config.RestoreMaxAgeDays) * 24 * time.Hour,
+		keepLatest:  config.RestoreKeepLatest,
+	}
+}
+
+// selectRetention returns the restores the policy no longer keeps, oldest last
+// Clones, promoted, raw and pinned restores are deleted explicitly and aren't counted. Restores with branches,
+// clone sources, the newest ready restore and the newest keepLatest data-ready restores are always kept but count
+// towards maxRestores, as do running restores
+func selectRetention(restores []models.Restore, policy retentionPolicy, now time.Time) []RetentionDeletion {
+	hasClones := map[string]bool{}
+	var regular []models.Restore
+	for _, restore := range restores {
+		if restore.ClonedFromID != "" {
+			hasClones[restore.ClonedFromID] = true
+		}
+		if restore.ClonedFromID == "" && restore.PromotedFromBranch == "" && !restore.Raw && !restore.Pinned {
+			regular = append(regular, restore)
+		}
+	}
+	// Restore names are their UTC creation time, they order restores created within the same second
+	sort.SliceStable(regular, func(i, j int) bool {
+		if !regular[i].CreatedAt.Equal(regular[j].CreatedAt) {
+			return regular[i].CreatedAt.After(regular[j].CreatedAt)
+		}
+		return regular[i].Name > regular[j].Name
+	})
+
+	var deletions []RetentionDeletion
+	kept, dataReady := 0, 0
+	newerReady := false
+	for _, restore := range regular {
+		deletion := RetentionDeletion{RestoreID: restore.ID, RestoreName: restore.Name}
+
+		switch restore.State {
+		case models.RestoreStateFailed, models.RestoreStateCancelled:
+			// Failed restores don't take a place, they're only kept to look into until a newer restore succeeds
+			if newerReady && len(restore.Branches) == 0 && !hasClones[restore.ID] {
+				deletion.Reason = RetentionReasonFailed
+				deletions = append(deletions, deletion)
+			}
+			continue
+		case models.RestoreStateReady:
+		default:
+			kept++
+			continue
+		}
+
+		protected := len(restore.Branches) > 0 || hasClones[restore.ID] || !newerReady
+		if restore.DataReady {
+			protected = protected || dataReady < policy.keepLatest
+			dataReady++
+		}
+		newerReady = true
+
+		switch {
+		case protected:
+		case kept >= policy.maxRestores:
+			deletion.Reason = RetentionReasonMaxRestores
+		case policy.maxAge > 0 && now.Sub(retentionAge(&restore)) > policy.maxAge:
+			deletion.Reason = RetentionReasonMaxAge
+		}
+		if deletion.Reason != "" {
+			deletions = append(deletions, deletion)
+			continue
+		}
+		kept++
+	}
+	return deletions
+}
+
+// retentionAge returns when a restore's data was taken, restores from before ReadyAt was recorded use their creation
+func retentionAge(restore *models.Restore) time.Time {
+	if restore.ReadyAt != nil {
+		return *restore.ReadyAt
+	}
+	return restore.CreatedAt
+}
+
+// ApplyRetention deletes the restores the retention policy no longer keeps and records an audit event for each
+// reserve leaves room for restores about to be created, which count towards max_restores
+// Every restore is attempted, failed deletions are recorded and left out of the result
+func (o *Orchestrator) ApplyRetention(ctx context.Context, reserve int) ([]RetentionDeletion, error) {
+	var config models.Config
+	if err := o.db.First(&config).Error; err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	var restores []models.Restore
+	if err := o.db.Preload("Branches").Find(&restores).Error; err != nil {
+		return nil, fmt.Errorf("failed to load restores: %w", err)
+	}
+
+	policy := newRetentionPolicy(&config, reserve)
+	selected := selectRetention(restores, policy, time.Now())
+	if len(selected) == 0 {
+		o.logger.Debug().Msg("No restores to delete by the retention policy")
+		return nil, nil
+	}
+
+	byID := make(map[string]*models.Restore, len(restores))
+	for i := range restores {
+		byID[restores[i].ID] = &restores[i]
+	}
+
+	var deleted []RetentionDeletion
+	for _, deletion := range selected {
+		o.logger.Info().
+			Str("restore_id", deletion.RestoreID).
+			Str("restore_name", deletion.RestoreName).
+			Str("reason", deletion.Reason).
+			Msg("Deleting restore by the retention policy")
+
+		err := o.DeleteByModel(ctx, byID[deletion.RestoreID])
+		if err != nil {
+			o.logger.Error().
+				Err(err).
+				Str("restore_id", deletion.RestoreID).
+				Msg("Failed to delete restore by the retention policy")
+		} else {
+			deleted = append(deleted, deletion)
+		}
+		o.recordRetentionEvent(deletion, policy, err)
+	}
+
+	return deleted, nil
+}
+
+// recordRetentionEvent adds a retention deletion to the audit log, failures to record it are only logged
+func (o *Orchestrator) recordRetentionEvent(deletion RetentionDeletion, policy retentionPolicy, deleteErr error) {
+	event := models.AuditEvent{
+		Action:       "restore.retention_deleted",
+		ResourceType: "restore",
+		ResourceID:   deletion.RestoreID,
+		Success:      deleteErr == nil,
+		Details: map[string]string{
+			"name":         deletion.RestoreName,
+			"reason":       deletion.Reason,
+			"max_restores": strconv.Itoa(policy.maxRestores),
+			"max_age_days": strconv.Itoa(int(policy.maxAge / (24 * time.Hour))),
+			"keep_latest":  strconv.Itoa(policy.keepLatest),
+		},
+	}
+	if deleteErr != nil {
+		event.Action = "restore.retention_failed"
+		event.Details["error"] = deleteErr.Error()
+	}
+	if err := o.db.Create(&event).Error; err != nil {
+		o.logger.Warn().Err(err).Str("restore_id", deletion.RestoreID).Msg("Failed to record retention audit event")
+	}
+}
@@ -0,0 +1,127 @@
+package restore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestSelectRetention(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.Add(-time.Duration(days) * 24 * time.Hour) }
+
+	// restore returns a restore created days ago, r1 being the oldest
+	restore := func(id string, days int, state string, dataReady bool) models.Restore {
+		created := daysAgo(days)
+		r := models.Restore{
+			BaseModel: models.BaseModel{ID: id, CreatedAt: created},
+			Name:      "restore_" + created.Format("20060102150405"),
+			State:     state,
+			DataReady: dataReady,
+		}
+		if state == models.RestoreStateReady {
+			r.ReadyAt = &created
+		}
+		return r
+	}
+	ready := func(id string, days int) models.Restore { return restore(id, days, models.RestoreStateReady, true) }
+	withBranch := func(r models.Restore) models.Restore {
+		r.Branches = []models.Branch{{Name: "feature"}}
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		restores []models.Restore
+		policy   retentionPolicy
+		want     map[string]string // restore ID -> reason
+	}{
+		{
+			name:     "within max_restores",
+			restores: []models.Restore{ready("r1", 3), ready("r2", 2), ready("r3", 1)},
+			policy:   retentionPolicy{maxRestores: 3, keepLatest: 1},
+			want:     map[string]string{},
+		},
+		{
+			name:     "oldest beyond max_restores",
+			restores: []models.Restore{ready("r1", 3), ready("r2", 2), ready("r3", 1)},
+			policy:   retentionPolicy{maxRestores: 1, keepLatest: 1},
+			want:     map[string]string{"r1": RetentionReasonMaxRestores, "r2": RetentionReasonMaxRestores},
+		},
+		{
+			name:     "restores with branches and clone sources are kept and count",
+			restores: []models.Restore{ready("r1", 4), ready("r2", 3), withBranch(ready("r3", 2)), ready("r4", 1), {BaseModel: models.BaseModel{ID: "c1"}, ClonedFromID: "r2", State: models.RestoreStateReady}},
+			policy:   retentionPolicy{maxRestores: 2, keepLatest: 1},
+			want:     map[string]string{"r1": RetentionReasonMaxRestores},
+		},
+		{
+			name:     "running restores take a place",
+			restores: []models.Restore{ready("r1", 3), ready("r2", 2), restore("r3", 0, models.RestoreStateRestoring, false)},
+			policy:   retentionPolicy{maxRestores: 2, keepLatest: 1},
+			want:     map[string]string{"r1": RetentionReasonMaxRestores},
+		},
+		{
+			name:     "reserved place never deletes the newest ready restore",
+			restores: []models.Restore{ready("r1", 2), restore("r2", 1, models.RestoreStateReady, false)},
+			policy:   retentionPolicy{maxRestores: 0, keepLatest: 0},
+			want:     map[string]string{"r1": RetentionReasonMaxRestores},
+		},
+		{
+			name:     "keep latest data-ready restores beyond max_restores",
+			restores: []models.Restore{ready("r1", 4), ready("r2", 3), ready("r3", 2), ready("r4", 1)},
+			policy:   retentionPolicy{maxRestores: 1, keepLatest: 3},
+			want:     map[string]string{"r1": RetentionReasonMaxRestores},
+		},
+		{
+			name:     "older than max age",
+			restores: []models.Restore{ready("r1", 40), withBranch(ready("r2", 35)), ready("r3", 31), ready("r4", 1)},
+			policy:   retentionPolicy{maxRestores: 5, maxAge: 30 * 24 * time.Hour, keepLatest: 1},
+			want:     map[string]string{"r1": RetentionReasonMaxAge, "r3": RetentionReasonMaxAge},
+		},
+		{
+			name:     "keep latest outlasts max age",
+			restores: []models.Restore{ready("r1", 40), ready("r2", 35)},
+			policy:   retentionPolicy{maxRestores: 5, maxAge: 30 * 24 * time.Hour, keepLatest: 1},
+			want:     map[string]string{"r1": RetentionReasonMaxAge},
+		},
+		{
+			name:     "failed restores go once a newer restore is ready",
+			restores: []models.Restore{restore("r1", 3, models.RestoreStateFailed, false), ready("r2", 2), restore("r3", 1, models.RestoreStateCancelled, false)},
+			policy:   retentionPolicy{maxRestores: 1, keepLatest: 1},
+			want:     map[string]string{"r1": RetentionReasonFailed},
+		},
+		{
+			name: "clones, promoted, raw and pinned restores aren't counted",
+			restores: []models.Restore{
+				ready("r1", 2), ready("r2", 1),
+				{BaseModel: models.BaseModel{ID: "p1", CreatedAt: daysAgo(90)}, PromotedFromBranch: "feature", State: models.RestoreStateReady},
+				{BaseModel: models.BaseModel{ID: "x1", CreatedAt: daysAgo(90)}, Raw: true, State: models.RestoreStateReady},
+				{BaseModel: models.BaseModel{ID: "b1", CreatedAt: daysAgo(90)}, Label: "baseline", Pinned: true, State: models.RestoreStateReady, DataReady: true},
+			},
+			policy: retentionPolicy{maxRestores: 2, maxAge: 30 * 24 * time.Hour, keepLatest: 1},
+			want:   map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			for _, deletion := range selectRetention(tt.restores, tt.policy, now) {
+				got[deletion.RestoreID] = deletion.Reason
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectRetention() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRetentionPolicy(t *testing.T) {
+	config := &models.Config{MaxRestores: 3, RestoreMaxAgeDays: 7, RestoreKeepLatest: 2}
+	want := retentionPolicy{maxRestores: 2, maxAge: 7 * 24 * time.Hour, keepLatest: 2}
+	if got := newRetentionPolicy(config, 1); got != want {
+		t.Errorf("newRetentionPolicy() = %+v, want %+v", got, want)
+	}
+}
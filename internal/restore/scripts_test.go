@@ -0,0 +1,57 @@
+package restore
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/shellexec"
+)
+
+// scriptInputPattern matches the parameters a script reads from its environment, e.g. readonly PG_PORT="${PG_PORT}"
+var scriptInputPattern = regexp.MustCompile(`(?m)^(?:readonly )?([A-Z_]+)="\$\{([A-Z_]+)\}"`)
+
+// scriptEnv returns the environment shellexec passes a script for params
+func scriptEnv(params any) map[string]string {
+	env := make(map[string]string)
+	for _, variable := range shellexec.Env(params) {
+		name, value, _ := strings.Cut(variable, "=")
+		env[name] = value
+	}
+	return env
+}
+
+func TestScriptParamsCoverScriptInputs(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		params any
+	}{
+		{"adopt_cluster.sh", adoptClusterScript, adoptClusterParams{}},
+		{"clone_restore.sh", cloneRestoreScript, cloneRestoreParams{}},
+		{"crunchy_bridge_restore.sh", crunchyBridgeRestoreScript, crunchyBridgeRestoreParams{}},
+		{"demo_source.sh", demoSourceScript, demoSourceParams{}},
+		{"incremental_refresh.sh", incrementalRefreshScript, incrementalRefreshParams{}},
+		{"logical_restore.sh", logicalRestoreScript, logicalRestoreParams{}},
+		{"pgbackrest_restore.sh", pgBackRestRestoreScript, pgBackRestRestoreParams{}},
+		{"promote_branch.sh", promoteBranchScript, promoteBranchParams{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.Contains(tt.script, "{{") {
+				t.Error("script still contains template actions")
+			}
+
+			env := scriptEnv(tt.params)
+			inputs := scriptInputPattern.FindAllStringSubmatch(tt.script, -1)
+			if len(inputs) == 0 {
+				t.Fatal("script reads no parameters")
+			}
+			for _, input := range inputs {
+				if _, ok := env[input[2]]; !ok {
+					t.Errorf("script reads %s, the parameters don't set it", input[2])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
+)
+
+// restoreSpaceFactor is applied to the source database size: the restored cluster takes about
+// the source's size and the compressed dump is kept next to it until the restore completes
+const restoreSpaceFactor = 1.3
+
+// sourceSizeTimeout bounds the source database size query
+const sourceSizeTimeout = 30 * time.Second
+
+// Replaced in tests, the checks need the ZFS pool and the source database
+var (
+	checkPoolSpace = sysinfo.CheckDiskSpace
+	sourceSize     = sourceDatabaseSize
+)
+
+// checkRestoreSpace fails fast when the restore is not going to fit on the data pool
+// The estimate is skipped (only the reserve is checked) when the source size is unknown or table filters shrink the restore
+func (o *Orchestrator) checkRestoreSpace(ctx context.Context, restore *models.Restore, config *models.Config, providerType ProviderType) error {
+	var required int64
+	if providerType == ProviderTypeLogical && !restore.SchemaOnly &&
+		config.RestoreIncludeTables == "" && config.RestoreExcludeTables == "" && config.RestoreTableSamples == "" {
+		sizeGB, err := sourceSize(ctx, config.ConnectionString)
+		if err != nil {
+			o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to get source database size, skipping space estimate")
+		} else {
+			required = int64(sizeGB * restoreSpaceFactor * 1024 * 1024 * 1024)
+		}
+	}
+
+	return o.checkDiskSpace(ctx, restore, required)
+}
+
+// checkDiskSpace checks the data pool for requiredBytes, a pool that can't be inspected is not treated as full
+func (o *Orchestrator) checkDiskSpace(ctx context.Context, restore *models.Restore, requiredBytes int64) error {
+	err := checkPoolSpace(ctx, o.resources.storage.DatasetRoot, requiredBytes)
+	if err != nil && !errors.Is(err, sysinfo.ErrInsufficientDiskSpace) {
+		o.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to check available disk space")
+		return nil
+	}
+	return err
+}
+
+// sourceDatabaseSize returns the size of the source database in GB
+func sourceDatabaseSize(ctx context.Context, connectionString string) (float64, error) {
+	ctx, cancel := pgclient.WithTimeout(ctx, sourceSizeTimeout)
+	defer cancel()
+
+	client, err := pgclient.NewClient(connectionString)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	size, err := client.GetDatabaseSize(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get source database size: %w", err)
+	}
+	return size, nil
+}
@@ -0,0 +1,100 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
+)
+
+func TestCheckRestoreSpace(t *testing.T) {
+	tests := []struct {
+		name         string
+		restore      models.Restore
+		config       models.Config
+		provider     ProviderType
+		sizeErr      error
+		wantRequired int64
+	}{
+		{
+			name:         "full logical restore",
+			config:       models.Config{ConnectionString: "postgres://source/app"},
+			provider:     ProviderTypeLogical,
+			wantRequired: int64(10 * restoreSpaceFactor * 1024 * 1024 * 1024),
+		},
+		{
+			name:     "schema-only restore",
+			restore:  models.Restore{SchemaOnly: true},
+			config:   models.Config{ConnectionString: "postgres://source/app"},
+			provider: ProviderTypeLogical,
+		},
+		{
+			name:     "table filters",
+			config:   models.Config{ConnectionString: "postgres://source/app", RestoreTableSamples: "events:1000"},
+			provider: ProviderTypeLogical,
+		},
+		{
+			name:     "Crunchy Bridge",
+			config:   models.Config{CrunchyBridgeAPIKey: "key"},
+			provider: ProviderTypeCrunchyBridge,
+		},
+		{
+			name:     "source unreachable",
+			config:   models.Config{ConnectionString: "postgres://source/app"},
+			provider: ProviderTypeLogical,
+			sizeErr:  errors.New("connection refused"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOrchestrator(t)
+			o.resources.storage.DatasetRoot = "tank"
+
+			originalCheck, originalSize := checkPoolSpace, sourceSize
+			t.Cleanup(func() { checkPoolSpace, sourceSize = originalCheck, originalSize })
+			sourceSize = func(ctx context.Context, connectionString string) (float64, error) {
+				return 10, tt.sizeErr
+			}
+			var required int64 = -1
+			checkPoolSpace = func(ctx context.Context, dataset string, requiredBytes int64) error {
+				if dataset != "tank" {
+					t.Errorf("checked dataset %s, want tank", dataset)
+				}
+				required = requiredBytes
+				return nil
+			}
+
+			if err := o.checkRestoreSpace(context.Background(), &tt.restore, &tt.config, tt.provider); err != nil {
+				t.Fatalf("checkRestoreSpace() error = %v", err)
+			}
+			if required != tt.wantRequired {
+				t.Errorf("required %d bytes, want %d", required, tt.wantRequired)
+			}
+		})
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	o := newTestOrchestrator(t)
+	original := checkPoolSpace
+	t.Cleanup(func() { checkPoolSpace = original })
+
+	// Only a full pool fails, one that can't be inspected is not treated as full
+	checkPoolSpace = func(ctx context.Context, dataset string, requiredBytes int64) error {
+		return fmt.Errorf("%w on tank: 1.0 GB required, 0.5 GB available", sysinfo.ErrInsufficientDiskSpace)
+	}
+	if err := o.checkDiskSpace(context.Background(), &models.Restore{}, 0); !errors.Is(err, sysinfo.ErrInsufficientDiskSpace) {
+		t.Errorf("checkDiskSpace() on a full pool = %v, want ErrInsufficientDiskSpace", err)
+	}
+
+	checkPoolSpace = func(ctx context.Context, dataset string, requiredBytes int64) error {
+		return errors.New("failed to get ZFS available space: exit status 1")
+	}
+	if err := o.checkDiskSpace(context.Background(), &models.Restore{}, 0); err != nil {
+		t.Errorf("checkDiskSpace() without zfs = %v, want nil", err)
+	}
+}
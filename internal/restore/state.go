@@ -0,0 +1,138 @@
+package restore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// phaseMarker prefixes the lines restore scripts write when they enter a phase, e.g. restoring after pg_dump
+const phaseMarker = "__BRANCHD_PHASE__ "
+
+// ErrInvalidTransition is returned when a restore can't move to a state from the one it's in,
+// e.g. completing a cancelled restore or starting a restore twice
+var ErrInvalidTransition = errors.New("invalid restore state transition")
+
+// transitions lists the states each state can move to, final states have none
+// Started restores only go back to pending through Requeue
+var transitions = map[string][]string{
+	models.RestoreStatePending:     {models.RestoreStateDumping, models.RestoreStateRestoring, models.RestoreStateFailed, models.RestoreStateCancelled},
+	models.RestoreStateDumping:     {models.RestoreStateRestoring, models.RestoreStatePending, models.RestoreStateFailed, models.RestoreStateCancelled},
+	models.RestoreStateRestoring:   {models.RestoreStateAnonymizing, models.RestoreStateReady, models.RestoreStatePending, models.RestoreStateFailed, models.RestoreStateCancelled},
+	models.RestoreStateAnonymizing: {models.RestoreStateReady, models.RestoreStateFailed, models.RestoreStateCancelled},
+}
+
+// stateTimestamps is the column recording when a restore entered each state
+var stateTimestamps = map[string]string{
+	models.RestoreStateDumping:     "started_at",
+	models.RestoreStateRestoring:   "restoring_at",
+	models.RestoreStateAnonymizing: "anonymizing_at",
+	models.RestoreStateReady:       "ready_at",
+	models.RestoreStateFailed:      "failed_at",
+	models.RestoreStateCancelled:   "cancelled_at",
+}
+
+// CanTransition reports whether a restore in state from can move to state to
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves a restore to state to, recording the time along with updates
+// The update only applies if the restore is still in the state it was loaded in, so a concurrent transition
+// (e.g. a cancel while the restore completes) makes the other fail with ErrInvalidTransition
+func Transition(db *gorm.DB, restore *models.Restore, to string, updates map[string]interface{}) error {
+	from := restore.State
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: restore %s is %s, can't become %s", ErrInvalidTransition, restore.Name, from, to)
+	}
+
+	now := time.Now()
+	values := map[string]interface{}{"state": to}
+	for column, value := range updates {
+		values[column] = value
+	}
+	if column, ok := stateTimestamps[to]; ok {
+		values[column] = now
+	}
+	// Restores without a dump start restoring right away
+	if from == models.RestoreStatePending && to == models.RestoreStateRestoring {
+		values["started_at"] = now
+	}
+
+	// A final state also ends the restore's refresh run
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Restore{}).Where("id = ? AND state = ?", restore.ID, from).Updates(values)
+		if result.Error != nil {
+			return fmt.Errorf("failed to move restore %s to %s: %w", restore.Name, to, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: restore %s is no longer %s, can't become %s", ErrInvalidTransition, restore.Name, from, to)
+		}
+		if outcome, ok := refreshOutcomes[to]; ok {
+			reason, _ := updates["failure_reason"].(string)
+			return FinishRefreshRun(tx, restore, outcome, reason)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	restore.State = to
+	return nil
+}
+
+// ReadPhase returns the last phase a restore script wrote to the restore log, empty if it wrote none
+func (p *ProcessManager) ReadPhase(restoreName string) (string, error) {
+	file, err := os.Open(p.GetLogFilePath(restoreName))
+	if err != nil {
+		return "", fmt.Errorf("failed to open restore log: %w", err)
+	}
+	defer file.Close()
+
+	return parsePhase(file)
+}
+
+// parsePhase returns the last phase line of a restore log
+func parsePhase(r io.Reader) (string, error) {
+	phase := ""
+	scanner := bufio.NewScanner(r)
+	// Same limit as parseProvenance, COPY errors can quote long rows
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), phaseMarker); ok {
+			phase = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read restore log: %w", err)
+	}
+	return phase, nil
+}
+
+// SyncPhase moves a dumping restore to restoring once its script reported the dump finished
+func (o *Orchestrator) SyncPhase(restore *models.Restore) error {
+	if restore.State != models.RestoreStateDumping {
+		return nil
+	}
+	phase, err := o.processManager.ReadPhase(restore.Name)
+	if err != nil {
+		return err
+	}
+	if phase != models.RestoreStateRestoring {
+		return nil
+	}
+	return Transition(o.db, restore, models.RestoreStateRestoring, nil)
+}
@@ -0,0 +1,131 @@
+package restore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestTransition(t *testing.T) {
+	o := newTestOrchestrator(t)
+
+	restore := &models.Restore{Name: "restore_20250101000000"}
+	if err := o.db.Create(restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	if restore.State != models.RestoreStatePending {
+		t.Fatalf("new restore state = %q, want pending", restore.State)
+	}
+
+	for _, state := range []string{models.RestoreStateDumping, models.RestoreStateRestoring, models.RestoreStateAnonymizing} {
+		if err := Transition(o.db, restore, state, nil); err != nil {
+			t.Fatalf("Transition(%s) error = %v", state, err)
+		}
+	}
+	if err := Transition(o.db, restore, models.RestoreStateReady, map[string]interface{}{"schema_ready": true}); err != nil {
+		t.Fatalf("Transition(ready) error = %v", err)
+	}
+
+	var got models.Restore
+	o.db.First(&got, "id = ?", restore.ID)
+	if got.State != models.RestoreStateReady || !got.SchemaReady {
+		t.Errorf("restore = state %q, schema_ready %v; want ready", got.State, got.SchemaReady)
+	}
+	for name, timestamp := range map[string]*time.Time{"started_at": got.StartedAt, "restoring_at": got.RestoringAt, "anonymizing_at": got.AnonymizingAt, "ready_at": got.ReadyAt} {
+		if timestamp == nil {
+			t.Errorf("%s not recorded", name)
+		}
+	}
+	if got.FailedAt != nil || got.CancelledAt != nil {
+		t.Errorf("ready restore has failed_at %v, cancelled_at %v", got.FailedAt, got.CancelledAt)
+	}
+
+	// Final states don't move
+	if err := Transition(o.db, restore, models.RestoreStateCancelled, nil); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Transition(ready → cancelled) error = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestTransitionConcurrent(t *testing.T) {
+	o := newTestOrchestrator(t)
+
+	restore := &models.Restore{Name: "restore_20250101000000", State: models.RestoreStateAnonymizing}
+	if err := o.db.Create(restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+
+	// Cancelled while another copy of the record completes it
+	stale := *restore
+	if err := Transition(o.db, restore, models.RestoreStateCancelled, nil); err != nil {
+		t.Fatalf("Transition(cancelled) error = %v", err)
+	}
+	if err := Transition(o.db, &stale, models.RestoreStateReady, nil); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Transition(ready) of a cancelled restore error = %v, want ErrInvalidTransition", err)
+	}
+
+	var got models.Restore
+	o.db.First(&got, "id = ?", restore.ID)
+	if got.State != models.RestoreStateCancelled || got.ReadyAt != nil {
+		t.Errorf("restore = state %q, ready_at %v; want cancelled", got.State, got.ReadyAt)
+	}
+}
+
+func TestTransitionPendingToRestoringStarts(t *testing.T) {
+	o := newTestOrchestrator(t)
+
+	restore := &models.Restore{Name: "restore_20250101000000"}
+	if err := o.db.Create(restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	if err := Transition(o.db, restore, models.RestoreStateRestoring, nil); err != nil {
+		t.Fatalf("Transition(restoring) error = %v", err)
+	}
+
+	var got models.Restore
+	o.db.First(&got, "id = ?", restore.ID)
+	if got.StartedAt == nil || got.RestoringAt == nil {
+		t.Errorf("restore without a dump = started_at %v, restoring_at %v; want both set", got.StartedAt, got.RestoringAt)
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{models.RestoreStatePending, models.RestoreStateDumping, true},
+		{models.RestoreStatePending, models.RestoreStateCancelled, true},
+		{models.RestoreStateDumping, models.RestoreStateAnonymizing, false},
+		{models.RestoreStateRestoring, models.RestoreStateReady, true},
+		{models.RestoreStateAnonymizing, models.RestoreStateFailed, true},
+		{models.RestoreStateFailed, models.RestoreStatePending, false},
+		{models.RestoreStateCancelled, models.RestoreStateReady, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestParsePhase(t *testing.T) {
+	log := strings.Join([]string{
+		"2025-01-01 08:00:00 - Starting pg_dump [schema_only=false]...",
+		"__BRANCHD_PROVENANCE__ method=logical",
+		"__BRANCHD_PHASE__ restoring",
+		"2025-01-01 09:00:00 - Phase 1/3: Restoring schema...",
+	}, "\n")
+
+	got, err := parsePhase(strings.NewReader(log))
+	if err != nil || got != models.RestoreStateRestoring {
+		t.Errorf("parsePhase() = %q, %v; want restoring", got, err)
+	}
+
+	if got, err := parsePhase(strings.NewReader("2025-01-01 08:00:00 - Starting pg_dump...\n")); err != nil || got != "" {
+		t.Errorf("parsePhase() without phase lines = %q, %v; want empty", got, err)
+	}
+}
@@ -21,6 +21,9 @@ const (
 
 	// StatusUnknown indicates the restore status could not be determined
 	StatusUnknown Status = "unknown"
+
+	// StatusDeadlineExceeded indicates the restore was stopped after Config.RestoreDeadlineHours
+	StatusDeadlineExceeded Status = "deadline_exceeded"
 )
 
 // IsTerminal returns true if the status represents a final state
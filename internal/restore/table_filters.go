@@ -0,0 +1,114 @@
+package restore
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// tablePatternRegex matches pg_dump table patterns (optionally schema-qualified, with * and ? wildcards)
+// Quotes and whitespace are rejected
+var tablePatternRegex = regexp.MustCompile(`^[A-Za-z0-9_$*?]+(\.[A-Za-z0-9_$*?]+)?$`)
+
+// sampledTableRegex matches a plain (optionally schema-qualified) table name
+var sampledTableRegex = regexp.MustCompile(`^[A-Za-z0-9_$]+(\.[A-Za-z0-9_$]+)?$`)
+
+// TableSample is a table restored with at most Rows rows
+type TableSample struct {
+	Table string
+	Rows  int
+}
+
+// String formats a sample as the restore script reads it: "<rows> <table>"
+func (s TableSample) String() string {
+	return fmt.Sprintf("%d %s", s.Rows, s.Table)
+}
+
+// TableFilters restricts which tables (and how much of them) a logical restore copies
+type TableFilters struct {
+	Include []string      // pg_dump --table patterns, empty = all tables
+	Exclude []string      // pg_dump --exclude-table-data patterns
+	Samples []TableSample // Tables whose data is copied with a row limit after the restore
+}
+
+// ParseTableFilters parses the config's table filter settings
+func ParseTableFilters(config *models.Config) (*TableFilters, error) {
+	include, err := parseTablePatterns(config.RestoreIncludeTables)
+	if err != nil {
+		return nil, fmt.Errorf("invalid restore_include_tables: %w", err)
+	}
+	exclude, err := parseTablePatterns(config.RestoreExcludeTables)
+	if err != nil {
+		return nil, fmt.Errorf("invalid restore_exclude_tables: %w", err)
+	}
+	samples, err := parseTableSamples(config.RestoreTableSamples)
+	if err != nil {
+		return nil, fmt.Errorf("invalid restore_table_samples: %w", err)
+	}
+
+	return &TableFilters{Include: include, Exclude: exclude, Samples: samples}, nil
+}
+
+// Empty reports whether no filter is configured (every table is restored in full)
+func (f *TableFilters) Empty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0 && len(f.Samples) == 0
+}
+
+// DumpFlags returns the pg_dump flags for the filters
+// Sampled tables are dumped without data, their rows are copied separately
+func (f *TableFilters) DumpFlags() []string {
+	var flags []string
+	for _, pattern := range f.Include {
+		flags = append(flags, "--table="+pattern)
+	}
+	for _, pattern := range f.Exclude {
+		flags = append(flags, "--exclude-table-data="+pattern)
+	}
+	for _, sample := range f.Samples {
+		flags = append(flags, "--exclude-table-data="+sample.Table)
+	}
+	return flags
+}
+
+func parseTablePatterns(value string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if !tablePatternRegex.MatchString(pattern) {
+			return nil, fmt.Errorf("%q is not a valid table pattern", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func parseTableSamples(value string) ([]TableSample, error) {
+	var samples []TableSample
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		table, rows, ok := strings.Cut(entry, ":")
+		table = strings.TrimSpace(table)
+		if !ok || !sampledTableRegex.MatchString(table) {
+			return nil, fmt.Errorf("%q must be table:rows", entry)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(rows))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%q must have a positive row limit", entry)
+		}
+		if !strings.Contains(table, ".") {
+			table = "public." + table
+		}
+		samples = append(samples, TableSample{Table: table, Rows: n})
+	}
+	return samples, nil
+}
@@ -0,0 +1,135 @@
+package restore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestParseTableFilters(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    models.Config
+		want      TableFilters
+		wantFlags []string
+		wantErr   string
+	}{
+		{
+			name:   "no filters",
+			config: models.Config{},
+			want:   TableFilters{},
+		},
+		{
+			name: "patterns and samples",
+			config: models.Config{
+				RestoreIncludeTables: "public.*, billing.invoice_?",
+				RestoreExcludeTables: " audit_events ,,logs.*",
+				RestoreTableSamples:  "events:1000, analytics.page_views : 50",
+			},
+			want: TableFilters{
+				Include: []string{"public.*", "billing.invoice_?"},
+				Exclude: []string{"audit_events", "logs.*"},
+				Samples: []TableSample{{Table: "public.events", Rows: 1000}, {Table: "analytics.page_views", Rows: 50}},
+			},
+			wantFlags: []string{
+				"--table=public.*",
+				"--table=billing.invoice_?",
+				"--exclude-table-data=audit_events",
+				"--exclude-table-data=logs.*",
+				"--exclude-table-data=public.events",
+				"--exclude-table-data=analytics.page_views",
+			},
+		},
+		{
+			name:    "quotes in a pattern",
+			config:  models.Config{RestoreIncludeTables: "users'; rm -rf /"},
+			wantErr: "restore_include_tables",
+		},
+		{
+			name:    "whitespace in a pattern",
+			config:  models.Config{RestoreExcludeTables: "audit events"},
+			wantErr: "restore_exclude_tables",
+		},
+		{
+			name:    "three part name",
+			config:  models.Config{RestoreExcludeTables: "db.public.users"},
+			wantErr: "restore_exclude_tables",
+		},
+		{
+			name:    "sample without row limit",
+			config:  models.Config{RestoreTableSamples: "events"},
+			wantErr: "must be table:rows",
+		},
+		{
+			name:    "sample with wildcard",
+			config:  models.Config{RestoreTableSamples: "events_*:100"},
+			wantErr: "must be table:rows",
+		},
+		{
+			name:    "sample with zero rows",
+			config:  models.Config{RestoreTableSamples: "events:0"},
+			wantErr: "positive row limit",
+		},
+		{
+			name:    "sample with non-numeric rows",
+			config:  models.Config{RestoreTableSamples: "events:many"},
+			wantErr: "positive row limit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := ParseTableFilters(&tt.config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseTableFilters() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTableFilters() error = %v", err)
+			}
+			if !reflect.DeepEqual(*filters, tt.want) {
+				t.Errorf("ParseTableFilters() = %+v, want %+v", *filters, tt.want)
+			}
+			if got := filters.DumpFlags(); !reflect.DeepEqual(got, tt.wantFlags) {
+				t.Errorf("DumpFlags() = %q, want %q", got, tt.wantFlags)
+			}
+			if got, want := filters.Empty(), len(tt.wantFlags) == 0; got != want {
+				t.Errorf("Empty() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLogicalRestoreScriptTableFilters(t *testing.T) {
+	filters, err := ParseTableFilters(&models.Config{
+		RestoreExcludeTables: "audit_events",
+		RestoreTableSamples:  "events:1000,audit.logins:10",
+	})
+	if err != nil {
+		t.Fatalf("ParseTableFilters() error = %v", err)
+	}
+
+	// Samples are read by the script one "<rows> <table>" line at a time, filter flags are its arguments
+	env := scriptEnv(logicalRestoreParams{SourceDatabaseName: "app", TableSamples: filters.Samples})
+	if got, want := env["TABLE_SAMPLES"], "1000 public.events\n10 audit.logins"; got != want {
+		t.Errorf("TABLE_SAMPLES = %q, want %q", got, want)
+	}
+	for _, want := range []string{
+		`TABLE_FILTER_FLAGS=("$@")`,
+		`while read -r -u 3 rows table; do`,
+		`\copy (SELECT * FROM ${table} LIMIT ${rows}) TO STDOUT`,
+	} {
+		if !strings.Contains(logicalRestoreScript, want) {
+			t.Errorf("script doesn't contain %q", want)
+		}
+	}
+
+	// Without samples nothing is copied
+	if env := scriptEnv(logicalRestoreParams{SourceDatabaseName: "app"}); env["TABLE_SAMPLES"] != "" {
+		t.Errorf("TABLE_SAMPLES = %q without samples, want empty", env["TABLE_SAMPLES"])
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
 
+	"github.com/branchd-dev/branchd/internal/config"
 	"github.com/branchd-dev/branchd/internal/models"
 	"github.com/branchd-dev/branchd/internal/restore"
 )
@@ -18,9 +19,9 @@ type Service struct {
 }
 
 // NewService creates a new restores service
-func NewService(db *gorm.DB, logger zerolog.Logger) *Service {
+func NewService(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *Service {
 	return &Service{
-		orchestrator: restore.NewOrchestrator(db, logger),
+		orchestrator: restore.NewOrchestrator(db, cfg, logger),
 		logger:       logger.With().Str("component", "restores_service").Logger(),
 	}
 }
@@ -30,6 +31,18 @@ func (s *Service) Delete(ctx context.Context, restore *models.Restore) error {
 	return s.orchestrator.DeleteByModel(ctx, restore)
 }
 
+// Clone creates an independent restore from a ZFS clone of a ready restore
+// The clone is created by a restore:clone task, see restore.Orchestrator.RunClone
+func (s *Service) Clone(ctx context.Context, source *models.Restore) (*models.Restore, error) {
+	return s.orchestrator.CreateClone(ctx, source)
+}
+
+// PromoteBranch records the independent restore a branch is turned into, other branches can be created from it
+// The branch is promoted by a restore:promote task, see restore.Orchestrator.RunPromotion
+func (s *Service) PromoteBranch(ctx context.Context, branch *models.Branch) (*models.Restore, error) {
+	return s.orchestrator.CreatePromotion(ctx, branch)
+}
+
 // GetOrchestrator returns the underlying orchestrator for advanced operations
 func (s *Service) GetOrchestrator() *restore.Orchestrator {
 	return s.orchestrator
@@ -2,30 +2,91 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"github.com/branchd-dev/branchd/internal/anonymize"
 	"github.com/branchd-dev/branchd/internal/models"
 )
 
 type CreateAnonRuleRequest struct {
 	Table    string          `json:"table" binding:"required"`
 	Column   string          `json:"column" binding:"required"`
-	Template json.RawMessage `json:"template" binding:"required" swaggertype:"string" example:"\"user_${index}@example.com\""`
-	Type     string          `json:"type"` // Optional: "text", "integer", "boolean", "null" - overrides auto-detection
+	Template json.RawMessage `json:"template" swaggertype:"string" example:"\"user_${index}@example.com\""` // Required unless function is set
+	Type     string          `json:"type"`                                                                  // Optional: "text", "integer", "boolean", "null", "date", "timestamp", "uuid" - overrides auto-detection
+	JSONPath string          `json:"json_path"`                                                             // Optional: replace this field of a jsonb column (e.g. "contact.email")
+
+	// Optional built-in function ("md5", "sha256", "fake_name", "fake_email", "fake_address", "mask", "regex", "lookup")
+	// When set, the template is ignored and the function options are used instead; type is "text", or "integer" for
+	// lookups mapping to integers and masks with a digit mask_char
+	Function        string                     `json:"function"`
+	FunctionOptions models.AnonFunctionOptions `json:"function_options"`
+
+	// Optional: the same value gets the same output in every table (e.g. users.email and orders.customer_email)
+	// Rules meant to match must use the same function_options.salt
+	Consistent bool `json:"consistent"`
 }
 
 // Parse parses the template and detects its type
+// Date, timestamp and uuid templates are only detected with an explicit type
 func (r *CreateAnonRuleRequest) Parse() (template string, columnType string, err error) {
+	if err := anonymize.ValidateJSONPath(r.JSONPath); err != nil {
+		return "", "", err
+	}
+
+	template, columnType, err = r.parseTemplate()
+	if err != nil {
+		return "", "", err
+	}
+	if r.Function == "" {
+		if err := anonymize.ValidateTemplate(template, columnType); err != nil {
+			return "", "", err
+		}
+	}
+	if r.Consistent {
+		if err := anonymize.ValidateConsistent(r.Function, template); err != nil {
+			return "", "", err
+		}
+	}
+	return template, columnType, nil
+}
+
+func (r *CreateAnonRuleRequest) parseTemplate() (template string, columnType string, err error) {
+	// Function rules compute the value from the existing column, no template needed
+	if r.Function != "" {
+		if err := anonymize.ValidateFunction(r.Function, r.FunctionOptions); err != nil {
+			return "", "", err
+		}
+
+		switch r.Type {
+		case "":
+			return "", "text", nil
+		case "text", "integer":
+			if err := anonymize.ValidateFunctionType(r.Function, r.FunctionOptions, r.Type); err != nil {
+				return "", "", err
+			}
+			return "", r.Type, nil
+		default:
+			return "", "", fmt.Errorf("invalid type '%s' for function '%s', must be one of: text, integer", r.Type, r.Function)
+		}
+	}
+
+	if len(r.Template) == 0 {
+		return "", "", fmt.Errorf("template is required when no function is set")
+	}
+
 	// If type is explicitly specified, use it
 	if r.Type != "" {
 		// Validate the type
-		validTypes := map[string]bool{"text": true, "integer": true, "boolean": true, "null": true}
-		if !validTypes[r.Type] {
-			return "", "", fmt.Errorf("invalid type '%s', must be one of: text, integer, boolean, null", r.Type)
+		if !anonymize.IsColumnType(r.Type) {
+			return "", "", fmt.Errorf("invalid type '%s', must be one of: %s", r.Type, strings.Join(anonymize.ColumnTypes, ", "))
 		}
 
 		columnType = r.Type
@@ -120,7 +181,9 @@ func (s *Server) listAnonRules(c *gin.Context) {
 
 // @Router /api/anon-rules [post]
 // @Param request body CreateAnonRuleRequest true "Create anon rule request"
+// @Param skip_validation query bool false "Skip validation against the latest restore's schema"
 // @Success 201 {object} models.AnonRule
+// @Failure 422 {object} map[string]interface{}
 func (s *Server) createAnonRule(c *gin.Context) {
 	var req CreateAnonRuleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -139,10 +202,18 @@ func (s *Server) createAnonRule(c *gin.Context) {
 
 	// Create anon rule (global, applies to all database restores)
 	rule := models.AnonRule{
-		Table:      req.Table,
-		Column:     req.Column,
-		Template:   template,
-		ColumnType: columnType,
+		Table:           req.Table,
+		Column:          req.Column,
+		JSONPath:        req.JSONPath,
+		Template:        template,
+		ColumnType:      columnType,
+		Function:        req.Function,
+		FunctionOptions: req.FunctionOptions,
+		Consistent:      req.Consistent,
+	}
+
+	if !s.validateAnonRulesSchema(c, []models.AnonRule{rule}) {
+		return
 	}
 
 	if err := s.db.Create(&rule).Error; err != nil {
@@ -156,8 +227,13 @@ func (s *Server) createAnonRule(c *gin.Context) {
 		Str("table", rule.Table).
 		Str("column", rule.Column).
 		Str("column_type", rule.ColumnType).
+		Str("function", rule.Function).
 		Msg("Created anonymization rule")
 
+	setAuditResource(c, rule.ID)
+	setAuditDetail(c, "table", rule.Table)
+	setAuditDetail(c, "column", rule.Column)
+
 	c.JSON(http.StatusCreated, rule)
 }
 
@@ -190,12 +266,26 @@ func (s *Server) deleteAnonRule(c *gin.Context) {
 		Str("rule_id", ruleID).
 		Msg("Deleted anonymization rule")
 
+	setAuditDetail(c, "table", rule.Table)
+	setAuditDetail(c, "column", rule.Column)
+
 	c.Status(http.StatusNoContent)
 }
 
+// AnonRulesDiffResponse is what PUT /api/anon-rules?dry_run=true would change
+// Rules are matched by table and column, unchanged rules keep their IDs when applied
+type AnonRulesDiffResponse struct {
+	DryRun bool `json:"dry_run"`
+	anonymize.RulesDiff
+}
+
 // @Router /api/anon-rules [put]
 // @Param request body UpdateAnonRulesRequest true "Update anon rules request"
+// @Param skip_validation query bool false "Skip validation against the latest restore's schema"
+// @Param dry_run query bool false "Return the diff against the current rules without saving"
 // @Success 200 {object} []models.AnonRule
+// @Success 200 {object} AnonRulesDiffResponse "With dry_run=true"
+// @Failure 422 {object} map[string]interface{}
 func (s *Server) updateAnonRules(c *gin.Context) {
 	var req UpdateAnonRulesRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -214,23 +304,58 @@ func (s *Server) updateAnonRules(c *gin.Context) {
 			return
 		}
 		parsedRules = append(parsedRules, models.AnonRule{
-			Table:      rule.Table,
-			Column:     rule.Column,
-			Template:   template,
-			ColumnType: columnType,
+			Table:           rule.Table,
+			Column:          rule.Column,
+			JSONPath:        rule.JSONPath,
+			Template:        template,
+			ColumnType:      columnType,
+			Function:        rule.Function,
+			FunctionOptions: rule.FunctionOptions,
+			Consistent:      rule.Consistent,
 		})
 	}
 
-	// Use transaction to ensure atomicity (delete all + insert all)
+	if duplicate, ok := anonymize.DuplicateRule(parsedRules); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Duplicate rule for %s, a column or JSON field can only have one rule", anonymize.RuleTarget(duplicate))})
+		return
+	}
+
+	if !s.validateAnonRulesSchema(c, parsedRules) {
+		return
+	}
+
+	var current []models.AnonRule
+	if err := s.db.Order("created_at").Find(&current).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load anon rules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	diff := anonymize.DiffRules(current, parsedRules)
+
+	if c.Query("dry_run") == "true" {
+		setAuditDetail(c, "dry_run", "true")
+		c.JSON(http.StatusOK, AnonRulesDiffResponse{DryRun: true, RulesDiff: diff})
+		return
+	}
+
+	// Only the differences are written, unchanged rules keep their IDs
 	err := s.db.Transaction(func(tx *gorm.DB) error {
-		// Delete all existing rules
-		if err := tx.Where("1=1").Delete(&models.AnonRule{}).Error; err != nil {
-			return err
+		for _, rule := range diff.Removed {
+			if err := tx.Delete(&models.AnonRule{}, "id = ?", rule.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, change := range diff.Changed {
+			rule := change.After
+			rule.BaseModel = change.Before.BaseModel
+			if err := tx.Save(&rule).Error; err != nil {
+				return err
+			}
 		}
 
-		// Insert new rules
-		if len(parsedRules) > 0 {
-			if err := tx.Create(&parsedRules).Error; err != nil {
+		if len(diff.Added) > 0 {
+			if err := tx.Create(&diff.Added).Error; err != nil {
 				return err
 			}
 		}
@@ -254,7 +379,355 @@ func (s *Server) updateAnonRules(c *gin.Context) {
 
 	s.logger.Info().
 		Int("count", len(rules)).
+		Int("added", len(diff.Added)).
+		Int("changed", len(diff.Changed)).
+		Int("removed", len(diff.Removed)).
 		Msg("Updated anonymization rules")
 
+	setAuditDetail(c, "rule_count", strconv.Itoa(len(rules)))
+	setAuditDetail(c, "added", strconv.Itoa(len(diff.Added)))
+	setAuditDetail(c, "changed", strconv.Itoa(len(diff.Changed)))
+	setAuditDetail(c, "removed", strconv.Itoa(len(diff.Removed)))
+
 	c.JSON(http.StatusOK, rules)
 }
+
+type PreviewAnonRulesRequest struct {
+	RestoreID  string                  `json:"restore_id"`  // Optional: defaults to the latest ready restore
+	Rules      []CreateAnonRuleRequest `json:"rules"`       // Optional: defaults to the stored rules
+	SampleSize int                     `json:"sample_size"` // Optional: sample rows per table (default 10, max 100)
+}
+
+// @Router /api/anon-rules/preview [post]
+// @Param request body PreviewAnonRulesRequest true "Preview anon rules request"
+// @Success 200 {object} anonymize.PreviewResult
+func (s *Server) previewAnonRules(c *gin.Context) {
+	// Empty body previews the stored rules against the latest restore
+	var req PreviewAnonRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.logger.Warn().Err(err).Msg("Invalid request body")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	if req.SampleSize < 0 || req.SampleSize > anonymize.MaxPreviewSampleSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("sample_size must be between 1 and %d", anonymize.MaxPreviewSampleSize)})
+		return
+	}
+
+	// Use the rules from the request if given, otherwise the stored rules
+	var rules []models.AnonRule
+	if len(req.Rules) > 0 {
+		for _, rule := range req.Rules {
+			template, columnType, err := rule.Parse()
+			if err != nil {
+				s.logger.Warn().Err(err).Str("table", rule.Table).Str("column", rule.Column).Msg("Failed to parse template")
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid template for %s.%s", rule.Table, rule.Column), "details": err.Error()})
+				return
+			}
+			rules = append(rules, models.AnonRule{
+				Table:           rule.Table,
+				Column:          rule.Column,
+				JSONPath:        rule.JSONPath,
+				Template:        template,
+				ColumnType:      columnType,
+				Function:        rule.Function,
+				FunctionOptions: rule.FunctionOptions,
+				Consistent:      rule.Consistent,
+			})
+		}
+	} else if err := s.db.Find(&rules).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load anon rules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Find restore to run the preview against
+	restore, params, err := s.anonRulesTarget(req.RestoreID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("restore_id", req.RestoreID).Msg("Failed to resolve restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	result, err := anonymize.Preview(c.Request.Context(), rules, anonymize.PreviewParams{
+		ApplyParams: params,
+		SampleSize:  req.SampleSize,
+	}, s.logger)
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to preview anonymization")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to preview anonymization: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// anonRulesTarget resolves the restore anonymization rules are checked against
+// An empty restoreID selects the latest ready restore; gorm.ErrRecordNotFound is returned when none exists
+// Raw restores (break-glass) are never selected, not even by ID, their data is only seen by their grantee
+func (s *Server) anonRulesTarget(restoreID string) (*models.Restore, anonymize.ApplyParams, error) {
+	var restore models.Restore
+	query := s.db.Where("schema_ready = ? AND data_ready = ? AND cloned_from_id = '' AND raw = ?", true, true, false)
+	if restoreID != "" {
+		query = s.db.Where("id = ? AND raw = ?", restoreID, false)
+	}
+	if err := query.Order("created_at DESC").First(&restore).Error; err != nil {
+		return nil, anonymize.ApplyParams{}, err
+	}
+
+	// Load config to get PG version
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		return nil, anonymize.ApplyParams{}, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Same target database resolution as applyAnonymization
+	targetDatabase := config.DatabaseName
+	if config.CrunchyBridgeAPIKey != "" {
+		targetDatabase = config.CrunchyBridgeDatabaseName
+	}
+
+	return &restore, anonymize.ApplyParams{
+		DatabaseName: targetDatabase,
+		PostgresPort: restore.Port,
+	}, nil
+}
+
+// validateAnonRulesSchema checks rules against the latest ready restore's schema
+// Writes a 422 response and returns false when rules don't match the schema
+// Validation is skipped (returns true) with ?skip_validation=true, when no restore is ready yet,
+// or when the schema can't be queried, so rules can still be prepared ahead of a restore
+func (s *Server) validateAnonRulesSchema(c *gin.Context, rules []models.AnonRule) bool {
+	if c.Query("skip_validation") == "true" {
+		return true
+	}
+
+	restore, params, err := s.anonRulesTarget("")
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			s.logger.Warn().Err(err).Msg("Failed to resolve restore for anon rule validation, skipping")
+		}
+		return true
+	}
+
+	validationErrors, err := anonymize.Validate(c.Request.Context(), rules, params, s.logger)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to validate anon rules against schema, skipping")
+		return true
+	}
+
+	if len(validationErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":             "Anonymization rules do not match the database schema",
+			"restore_id":        restore.ID,
+			"validation_errors": validationErrors,
+		})
+		return false
+	}
+
+	return true
+}
+
+type ValidateAnonRulesResponse struct {
+	RestoreID string                      `json:"restore_id"`
+	Valid     bool                        `json:"valid"`
+	Errors    []anonymize.ValidationError `json:"errors"`
+}
+
+// @Router /api/anon-rules/validate [get]
+// @Param restore_id query string false "Restore ID (defaults to the latest ready restore)"
+// @Success 200 {object} ValidateAnonRulesResponse
+func (s *Server) validateAnonRules(c *gin.Context) {
+	// Stored rules can go stale when the source schema changes (e.g. a dropped column)
+	var rules []models.AnonRule
+	if err := s.db.Order("created_at DESC").Find(&rules).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load anon rules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	restoreID := c.Query("restore_id")
+	restore, params, err := s.anonRulesTarget(restoreID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to resolve restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	validationErrors, err := anonymize.Validate(c.Request.Context(), rules, params, s.logger)
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to validate anon rules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to validate anonymization rules: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, ValidateAnonRulesResponse{
+		RestoreID: restore.ID,
+		Valid:     len(validationErrors) == 0,
+		Errors:    validationErrors,
+	})
+}
+
+type ScanPIIRequest struct {
+	SampleSize int `json:"sample_size"` // Optional: rows sampled per table (default 100, max 1000)
+}
+
+type ScanPIIResponse struct {
+	RestoreID string `json:"restore_id"`
+	anonymize.ScanResult
+}
+
+// @Summary Scan a restore for PII
+// @Description Sample the text columns of a restore and suggest anonymization rules for those that look like PII
+// @Description (emails, phone numbers, SSNs, credit card numbers, names, addresses). Columns with a rule are skipped,
+// @Description suggested rules can be saved as is with POST /api/anon-rules
+// @Tags restores
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Restore ID"
+// @Param request body ScanPIIRequest false "Scan options"
+// @Success 200 {object} ScanPIIResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/restores/{id}/pii-scan [post]
+func (s *Server) scanRestorePII(c *gin.Context) {
+	var req ScanPIIRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.logger.Warn().Err(err).Msg("Invalid request body")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	if req.SampleSize < 0 || req.SampleSize > anonymize.MaxScanSampleSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("sample_size must be between 1 and %d", anonymize.MaxScanSampleSize)})
+		return
+	}
+
+	restoreID := c.Param("id")
+	restore, params, err := s.anonRulesTarget(restoreID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to resolve restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !restore.SchemaReady || !restore.DataReady {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Restore is not ready"})
+		return
+	}
+
+	var rules []models.AnonRule
+	if err := s.db.Find(&rules).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load anon rules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	result, err := anonymize.Scan(c.Request.Context(), rules, anonymize.ScanParams{
+		ApplyParams: params,
+		SampleSize:  req.SampleSize,
+	}, s.logger)
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to scan restore for PII")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to scan restore for PII: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, ScanPIIResponse{RestoreID: restore.ID, ScanResult: *result})
+}
+
+type ImportAnonRulesRequest struct {
+	Format  string `json:"format" binding:"required"`  // "dbt" (schema.yml or manifest.json), "dbml" or "sql" (COMMENT ON COLUMN)
+	Content string `json:"content" binding:"required"` // File contents
+	Replace bool   `json:"replace"`                    // Replace all existing rules instead of merging by table and column
+	DryRun  bool   `json:"dry_run"`                    // Return the generated rules without saving them
+}
+
+type ImportAnonRulesResponse struct {
+	Rules   []models.AnonRule         `json:"rules"`   // Generated rules (saved unless dry_run)
+	Skipped []anonymize.ImportSkipped `json:"skipped"` // Annotated columns no rule was generated for
+	DryRun  bool                      `json:"dry_run"`
+}
+
+// @Router /api/anon-rules/import [post]
+// @Param request body ImportAnonRulesRequest true "Import anon rules request"
+// @Param skip_validation query bool false "Skip validation against the latest restore's schema"
+// @Success 200 {object} ImportAnonRulesResponse
+// @Failure 422 {object} map[string]interface{}
+func (s *Server) importAnonRules(c *gin.Context) {
+	var req ImportAnonRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.logger.Warn().Err(err).Msg("Invalid request body")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	result, err := anonymize.Import(req.Format, []byte(req.Content))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to import annotations", "details": err.Error()})
+		return
+	}
+
+	if !s.validateAnonRulesSchema(c, result.Rules) {
+		return
+	}
+
+	if req.DryRun {
+		setAuditDetail(c, "dry_run", "true")
+		c.JSON(http.StatusOK, ImportAnonRulesResponse{Rules: result.Rules, Skipped: result.Skipped, DryRun: true})
+		return
+	}
+
+	// Imported rules take over the columns they annotate, other rules are kept unless replacing
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if req.Replace {
+			if err := tx.Where("1=1").Delete(&models.AnonRule{}).Error; err != nil {
+				return err
+			}
+		} else {
+			for _, rule := range result.Rules {
+				if err := tx.Where(&models.AnonRule{Table: rule.Table, Column: rule.Column}).Delete(&models.AnonRule{}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(result.Rules) > 0 {
+			if err := tx.Create(&result.Rules).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to import anon rules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import anonymization rules"})
+		return
+	}
+
+	s.logger.Info().
+		Str("format", req.Format).
+		Int("imported", len(result.Rules)).
+		Int("skipped", len(result.Skipped)).
+		Bool("replace", req.Replace).
+		Msg("Imported anonymization rules")
+
+	setAuditDetail(c, "format", req.Format)
+	setAuditDetail(c, "rule_count", strconv.Itoa(len(result.Rules)))
+	setAuditDetail(c, "replace", strconv.FormatBool(req.Replace))
+
+	c.JSON(http.StatusOK, ImportAnonRulesResponse{Rules: result.Rules, Skipped: result.Skipped})
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestUpdateAnonRulesAppliesDiff(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	email := models.AnonRule{Table: "users", Column: "email", ColumnType: "text", Function: "fake_email"}
+	name := models.AnonRule{Table: "users", Column: "name", Template: "user_${index}", ColumnType: "text"}
+	token := models.AnonRule{Table: "users", Column: "api_token", Template: "secret", ColumnType: "text"}
+	for _, rule := range []*models.AnonRule{&email, &name, &token} {
+		if err := s.db.Create(rule).Error; err != nil {
+			t.Fatalf("failed to create rule: %v", err)
+		}
+	}
+
+	put := func(query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/anon-rules"+query, strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		s.updateAnonRules(c)
+		return w
+	}
+
+	// email unchanged, name changed, api_token removed, phone added
+	body := `{"rules":[
+		{"table":"users","column":"email","function":"fake_email"},
+		{"table":"users","column":"name","function":"fake_name"},
+		{"table":"users","column":"phone","template":null}
+	]}`
+
+	w := put("?dry_run=true", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var diff AnonRulesDiffResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("failed to decode diff: %v", err)
+	}
+	if !diff.DryRun || len(diff.Added) != 1 || diff.Added[0].Column != "phone" ||
+		len(diff.Changed) != 1 || diff.Changed[0].Before.ID != name.ID ||
+		len(diff.Removed) != 1 || diff.Removed[0].ID != token.ID ||
+		len(diff.Unchanged) != 1 || diff.Unchanged[0].ID != email.ID {
+		t.Errorf("dry run diff = %+v, want phone added, name changed, api_token removed, email unchanged", diff)
+	}
+
+	var count int64
+	s.db.Model(&models.AnonRule{}).Count(&count)
+	if count != 3 {
+		t.Errorf("rules after dry run = %d, want the 3 rules untouched", count)
+	}
+
+	if w := put("", body); w.Code != http.StatusOK {
+		t.Fatalf("update status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var rules []models.AnonRule
+	s.db.Order("\"column\"").Find(&rules)
+	if len(rules) != 3 {
+		t.Fatalf("rules = %+v, want email, name and phone", rules)
+	}
+	byColumn := make(map[string]models.AnonRule)
+	for _, rule := range rules {
+		byColumn[rule.Column] = rule
+	}
+	if byColumn["email"].ID != email.ID {
+		t.Errorf("email rule ID = %s, want unchanged rule %s kept", byColumn["email"].ID, email.ID)
+	}
+	if got := byColumn["name"]; got.ID != name.ID || got.Function != "fake_name" || got.Template != "" {
+		t.Errorf("name rule = %+v, want rule %s replaced by fake_name", got, name.ID)
+	}
+	if got := byColumn["phone"]; got.ColumnType != "null" {
+		t.Errorf("phone rule = %+v, want a null rule", got)
+	}
+
+	if w := put("", `{"rules":[{"table":"users","column":"email","function":"fake_email"},{"table":"users","column":"email","template":"x"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("duplicate rules status = %d, want 400", w.Code)
+	}
+}
+
+func TestCreateAnonRuleRequestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "auto-detected text", body: `{"table":"users","column":"email","template":"user_${index}"}`, wantType: "text"},
+		{name: "date", body: `{"table":"users","column":"dob","template":"${now} - ${index} days","type":"date"}`, wantType: "date"},
+		{name: "invalid date", body: `{"table":"users","column":"dob","template":"yesterday","type":"date"}`, wantErr: true},
+		{name: "uuid", body: `{"table":"users","column":"external_id","template":"${uuid}","type":"uuid"}`, wantType: "uuid"},
+		{name: "unknown type", body: `{"table":"users","column":"dob","template":"x","type":"interval"}`, wantErr: true},
+		{name: "json field", body: `{"table":"users","column":"metadata","json_path":"contact.email","function":"fake_email"}`, wantType: "text"},
+		{name: "consistent fake email", body: `{"table":"orders","column":"customer_email","function":"fake_email","consistent":true,"function_options":{"salt":"s"}}`, wantType: "text"},
+		{name: "consistent static template", body: `{"table":"orders","column":"customer_email","template":"x","consistent":true}`, wantErr: true},
+		{name: "invalid json path", body: `{"table":"users","column":"metadata","json_path":"contact.","function":"fake_email"}`, wantErr: true},
+		{name: "integer lookup", body: `{"table":"users","column":"tier","function":"lookup","type":"integer","function_options":{"mapping":{"1":"2"},"default":"0"}}`, wantType: "integer"},
+		{name: "integer hash", body: `{"table":"users","column":"tier","function":"md5","type":"integer"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req CreateAnonRuleRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatalf("failed to decode request: %v", err)
+			}
+			_, columnType, err := req.Parse()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil || columnType != tt.wantType {
+				t.Errorf("Parse() = %s, %v, want %s", columnType, err, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// Context keys handlers use to enrich the audit event of the current request
+const (
+	auditResourceIDKey = "audit_resource_id"
+	auditDetailsKey    = "audit_details"
+	auditUserKey       = "audit_user"
+	auditSkippedKey    = "audit_skipped"
+)
+
+// auditedRoute describes how a state-changing route is recorded
+type auditedRoute struct {
+	Action       string
+	ResourceType string
+}
+
+// auditRegistrar registers routes on a group whose requests are recorded as one audit action
+type auditRegistrar struct {
+	server *Server
+	group  *gin.RouterGroup
+	route  auditedRoute
+}
+
+// audit returns a registrar for routes recorded as action on resourceType, e.g.
+// s.audit(api, "branch.created", "branch").POST("/branches", s.createBranch)
+// Routes registered without it (reads, previews, login) are not audited
+func (s *Server) audit(group *gin.RouterGroup, action, resourceType string) auditRegistrar {
+	return auditRegistrar{server: s, group: group, route: auditedRoute{Action: action, ResourceType: resourceType}}
+}
+
+func (a auditRegistrar) handle(method, relativePath string, handlers ...gin.HandlerFunc) {
+	a.group.Handle(method, relativePath, handlers...)
+	if a.server.auditedRoutes == nil {
+		a.server.auditedRoutes = map[string]auditedRoute{}
+	}
+	// Keyed like the route's c.FullPath()
+	a.server.auditedRoutes[method+" "+path.Join(a.group.BasePath(), relativePath)] = a.route
+}
+
+func (a auditRegistrar) GET(relativePath string, handlers ...gin.HandlerFunc) {
+	a.handle(http.MethodGet, relativePath, handlers...)
+}
+
+func (a auditRegistrar) POST(relativePath string, handlers ...gin.HandlerFunc) {
+	a.handle(http.MethodPost, relativePath, handlers...)
+}
+
+func (a auditRegistrar) PUT(relativePath string, handlers ...gin.HandlerFunc) {
+	a.handle(http.MethodPut, relativePath, handlers...)
+}
+
+func (a auditRegistrar) PATCH(relativePath string, handlers ...gin.HandlerFunc) {
+	a.handle(http.MethodPatch, relativePath, handlers...)
+}
+
+func (a auditRegistrar) DELETE(relativePath string, handlers ...gin.HandlerFunc) {
+	a.handle(http.MethodDelete, relativePath, handlers...)
+}
+
+// setAuditResource sets the ID of the resource a request created (routes without an :id param)
+func setAuditResource(c *gin.Context, resourceID string) {
+	c.Set(auditResourceIDKey, resourceID)
+}
+
+// setAuditDetail adds action-specific context to the audit event (never pass secrets)
+func setAuditDetail(c *gin.Context, key, value string) {
+	details := c.GetStringMapString(auditDetailsKey)
+	if details == nil {
+		details = map[string]string{}
+		c.Set(auditDetailsKey, details)
+	}
+	details[key] = value
+}
+
+// setAuditUser sets the acting user for routes without a session (first-run setup)
+func setAuditUser(c *gin.Context, user *models.User) {
+	c.Set(auditUserKey, user)
+}
+
+// setAuditSkipped suppresses the audit event of the request, e.g. for unauthenticated webhook deliveries
+func setAuditSkipped(c *gin.Context, skipped bool) {
+	c.Set(auditSkippedKey, skipped)
+}
+
+// auditMiddleware records an AuditEvent for every audited route after the handler ran
+// Requests rejected by auth middleware are recorded too, the route is known before any handler runs
+// Failures to write the event are logged and never fail the request
+func (s *Server) auditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		route, ok := s.auditedRoutes[c.Request.Method+" "+c.FullPath()]
+		if !ok || c.GetBool(auditSkippedKey) {
+			return
+		}
+
+		status := c.Writer.Status()
+		event := models.AuditEvent{
+			Action:       route.Action,
+			ResourceType: route.ResourceType,
+			ResourceID:   c.Param("id"),
+			Method:       c.Request.Method,
+			Path:         c.Request.URL.Path,
+			StatusCode:   status,
+			Success:      status >= 200 && status < 300,
+			ClientIP:     c.ClientIP(),
+			UserAgent:    c.Request.UserAgent(),
+			Details:      c.GetStringMapString(auditDetailsKey),
+		}
+		if resourceID := c.GetString(auditResourceIDKey); resourceID != "" {
+			event.ResourceID = resourceID
+		}
+
+		if sessionData, exists := GetSessionData(c); exists {
+			event.UserID = sessionData.UserID
+			event.UserEmail = sessionData.Email
+		} else if value, exists := c.Get(auditUserKey); exists {
+			if user, ok := value.(*models.User); ok {
+				event.UserID = user.ID
+				event.UserEmail = user.Email
+			}
+		}
+
+		if err := s.db.Create(&event).Error; err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("action", event.Action).
+				Str("user_id", event.UserID).
+				Msg("Failed to record audit event")
+		}
+	}
+}
+
+// Audit log paging bounds
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// @Summary List audit events
+// @Description List recorded state-changing operations, newest first (admin only)
+// @Tags audit
+// @Produce json
+// @Security BearerAuth
+// @Param action query string false "Filter by action (e.g. branch.created)"
+// @Param resource_type query string false "Filter by resource type (branch, restore, anon_rule, config, user, system)"
+// @Param resource_id query string false "Filter by resource ID"
+// @Param user_id query string false "Filter by acting user ID"
+// @Param success query bool false "Filter by outcome"
+// @Param since query string false "Only events at or after this time (RFC 3339)"
+// @Param until query string false "Only events before this time (RFC 3339)"
+// @Param limit query int false "Maximum number of events (default 100, max 1000)"
+// @Param before query string false "Only events older than the event with this ID (the last one of the previous page)"
+// @Success 200 {array} models.AuditEvent
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /api/audit [get]
+func (s *Server) listAuditEvents(c *gin.Context) {
+	query := s.db.Model(&models.AuditEvent{})
+
+	for _, filter := range []string{"action", "resource_type", "resource_id", "user_id"} {
+		if value := c.Query(filter); value != "" {
+			query = query.Where(filter+" = ?", value)
+		}
+	}
+
+	if successStr := c.Query("success"); successStr != "" {
+		success, err := strconv.ParseBool(successStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "success must be true or false"})
+			return
+		}
+		query = query.Where("success = ?", success)
+	}
+
+	for _, bound := range []struct {
+		param string
+		cond  string
+	}{
+		{"since", "created_at >= ?"},
+		{"until", "created_at < ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + " must be an RFC 3339 timestamp"})
+			return
+		}
+		query = query.Where(bound.cond, t.Local()) // Timestamps are stored as local-time strings
+	}
+
+	limit := defaultAuditLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 1 || l > maxAuditLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxAuditLimit)})
+			return
+		}
+		limit = l
+	}
+
+	// Pages continue after the previous page's last event, events of the same instant are ordered by ID
+	if before := c.Query("before"); before != "" {
+		var cursor models.AuditEvent
+		if err := s.db.Select("id").Where("id = ?", before).First(&cursor).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before must be the ID of an audit event"})
+			return
+		}
+		cursorTime := s.db.Model(&models.AuditEvent{}).Select("created_at").Where("id = ?", before)
+		query = query.Where("created_at < (?) OR (created_at = (?) AND id < ?)", cursorTime, cursorTime, before)
+	}
+
+	var events []models.AuditEvent
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Find(&events).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list audit events")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
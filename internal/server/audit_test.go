@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestListAuditEventsPages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	// Five events, the last three recorded in the same instant
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	var want []string
+	for i, offset := range []time.Duration{0, time.Second, 2 * time.Second, 2 * time.Second, 2 * time.Second} {
+		event := models.AuditEvent{
+			BaseModel:    models.BaseModel{ID: string(rune('a'+i)) + "-event", CreatedAt: base.Add(offset)},
+			Action:       "branch.created",
+			ResourceType: "branch",
+			Method:       http.MethodPost,
+			Path:         "/api/branches",
+		}
+		if err := s.db.Create(&event).Error; err != nil {
+			t.Fatalf("failed to create audit event: %v", err)
+		}
+		want = append([]string{event.ID}, want...)
+	}
+
+	list := func(query string) []models.AuditEvent {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/audit?"+query, nil)
+		s.listAuditEvents(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("listAuditEvents(%s) status = %d: %s", query, w.Code, w.Body.String())
+		}
+		var events []models.AuditEvent
+		if err := json.Unmarshal(w.Body.Bytes(), &events); err != nil {
+			t.Fatalf("failed to decode events: %v", err)
+		}
+		return events
+	}
+
+	var got []string
+	query := "limit=2"
+	for page := 0; page < 5; page++ {
+		events := list(query)
+		for _, event := range events {
+			got = append(got, event.ID)
+		}
+		if len(events) < 2 {
+			break
+		}
+		query = "limit=2&before=" + events[len(events)-1].ID
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("paged events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("paged events = %v, want %v", got, want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/audit?before=missing", nil)
+	s.listAuditEvents(c)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown before status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	s := newTestServer(t)
+
+	// Requests with a user header are authenticated, others rejected like JWTAuthMiddleware does
+	router := gin.New()
+	router.Use(s.auditMiddleware())
+	api := router.Group("/api", func(c *gin.Context) {
+		email := c.GetHeader("X-Test-User")
+		if email == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+			return
+		}
+		setSession(c, &auth.SessionData{UserID: "user-1", Email: email})
+	})
+	api.GET("/branches", func(c *gin.Context) { c.Status(http.StatusOK) })
+	s.audit(api, "branch.created", "branch").POST("/branches", func(c *gin.Context) {
+		setAuditResource(c, "branch-1")
+		setAuditDetail(c, "name", "feature-x")
+		c.Status(http.StatusCreated)
+	})
+	s.audit(api, "branch.deleted", "branch").DELETE("/branches/:id", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+	})
+	s.audit(api, "branch.suspended", "branch").POST("/branches/:id/suspend", func(c *gin.Context) {
+		setAuditSkipped(c, true)
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		user   string
+		want   *models.AuditEvent // nil = not audited
+	}{
+		{
+			name:   "created resource",
+			method: http.MethodPost,
+			path:   "/api/branches",
+			user:   "dev@example.com",
+			want: &models.AuditEvent{
+				Action: "branch.created", ResourceType: "branch", ResourceID: "branch-1",
+				UserID: "user-1", UserEmail: "dev@example.com", StatusCode: http.StatusCreated, Success: true,
+				Details: map[string]string{"name": "feature-x"},
+			},
+		},
+		{
+			name:   "failed request with resource from the route",
+			method: http.MethodDelete,
+			path:   "/api/branches/branch-2",
+			user:   "dev@example.com",
+			want: &models.AuditEvent{
+				Action: "branch.deleted", ResourceType: "branch", ResourceID: "branch-2",
+				UserID: "user-1", UserEmail: "dev@example.com", StatusCode: http.StatusNotFound,
+			},
+		},
+		{
+			name:   "rejected before the handler",
+			method: http.MethodDelete,
+			path:   "/api/branches/branch-3",
+			want: &models.AuditEvent{
+				Action: "branch.deleted", ResourceType: "branch", ResourceID: "branch-3", StatusCode: http.StatusUnauthorized,
+			},
+		},
+		{
+			name:   "route registered without audit",
+			method: http.MethodGet,
+			path:   "/api/branches",
+			user:   "dev@example.com",
+		},
+		{
+			name:   "skipped by the handler",
+			method: http.MethodPost,
+			path:   "/api/branches/branch-1/suspend",
+			user:   "dev@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.db.Where("1 = 1").Delete(&models.AuditEvent{}).Error; err != nil {
+				t.Fatalf("failed to clear audit events: %v", err)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.user != "" {
+				req.Header.Set("X-Test-User", tt.user)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			var events []models.AuditEvent
+			if err := s.db.Find(&events).Error; err != nil {
+				t.Fatalf("failed to load audit events: %v", err)
+			}
+			if tt.want == nil {
+				if len(events) != 0 {
+					t.Fatalf("recorded %+v, want no audit event", events)
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("recorded %d audit events, want 1", len(events))
+			}
+
+			got, want := events[0], *tt.want
+			if got.Action != want.Action || got.ResourceType != want.ResourceType || got.ResourceID != want.ResourceID ||
+				got.UserID != want.UserID || got.UserEmail != want.UserEmail ||
+				got.StatusCode != want.StatusCode || got.Success != want.Success {
+				t.Errorf("recorded %+v, want %+v", got, want)
+			}
+			if got.Method != tt.method || got.Path != tt.path {
+				t.Errorf("recorded %s %s, want %s %s", got.Method, got.Path, tt.method, tt.path)
+			}
+			if (len(got.Details) != 0 || len(want.Details) != 0) && !reflect.DeepEqual(got.Details, want.Details) {
+				t.Errorf("recorded details %v, want %v", got.Details, want.Details)
+			}
+		})
+	}
+}
+
+func TestAuditedRoutesMatchRegisteredRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.setupRouter()
+	gin.SetMode(gin.TestMode)
+
+	// Every audited route resolves to a registered route, so requests to it find their action
+	registered := map[string]bool{}
+	for _, route := range s.router.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+	for key, route := range s.auditedRoutes {
+		if !registered[key] {
+			t.Errorf("audited route %q (%s) is not registered", key, route.Action)
+		}
+	}
+
+	for key, action := range map[string]string{
+		"POST /api/setup":             "user.setup",
+		"POST /api/users":             "user.created",
+		"DELETE /api/branches/:id":    "branch.deleted",
+		"GET /api/auth/oidc/callback": "user.sso_provisioned",
+	} {
+		if got := s.auditedRoutes[key].Action; got != action {
+			t.Errorf("action of %q = %q, want %q", key, got, action)
+		}
+	}
+	for _, key := range []string{"GET /api/branches", "POST /api/auth/login", "GET /api/audit"} {
+		if route, ok := s.auditedRoutes[key]; ok {
+			t.Errorf("%q is audited as %s, want it unaudited", key, route.Action)
+		}
+	}
+}
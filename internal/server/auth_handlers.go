@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,6 +25,7 @@ type SetupRequest struct {
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	TOTPCode string `json:"totp_code"` // Required for users with two-factor authentication enabled
 }
 
 // LoginResponse represents a login response
@@ -39,6 +41,13 @@ type UserDetail struct {
 	Name      string    `json:"name"`
 	IsAdmin   bool      `json:"is_admin"`
 	CreatedAt time.Time `json:"created_at"`
+
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+	SSOLinked        bool `json:"sso_linked"` // The user can log in with SSO
+
+	// Current session only (GET /api/auth/me)
+	TwoFactorVerified bool       `json:"two_factor_verified,omitempty"` // The token was issued after a TOTP code was verified
+	TwoFactorDeadline *time.Time `json:"two_factor_deadline,omitempty"` // Admin routes require two-factor authentication after this
 }
 
 // CreateUserRequest represents a request to create a new user
@@ -142,6 +151,9 @@ func (s *Server) setupFirstAdmin(c *gin.Context) {
 
 	s.logger.Info().Str("user_id", user.ID).Str("email", user.Email).Msg("First admin user created")
 
+	setAuditUser(c, user)
+	setAuditResource(c, user.ID)
+
 	c.JSON(http.StatusOK, LoginResponse{
 		Token: token,
 		User: &UserDetail{
@@ -155,7 +167,8 @@ func (s *Server) setupFirstAdmin(c *gin.Context) {
 }
 
 // @Summary Login
-// @Description Authenticate with email and password
+// @Description Authenticate with email and password, plus totp_code for users with two-factor authentication
+// @Description After 5 wrong codes in a row codes aren't checked for a minute, doubling with every further wrong code (429)
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -163,6 +176,7 @@ func (s *Server) setupFirstAdmin(c *gin.Context) {
 // @Success 200 {object} LoginResponse
 // @Failure 400 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
 // @Router /api/auth/login [post]
 func (s *Server) login(c *gin.Context) {
 	var req LoginRequest
@@ -189,8 +203,32 @@ func (s *Server) login(c *gin.Context) {
 		return
 	}
 
+	// Users with two-factor authentication also need a code of their authenticator
+	generateToken := auth.GenerateToken
+	if user.TOTPEnabled {
+		if req.TOTPCode == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor code required", "two_factor_required": true})
+			return
+		}
+		valid, retryAfter, err := s.verifyTOTPCode(&user, req.TOTPCode)
+		if err != nil {
+			s.logger.Error().Err(err).Str("user_id", user.ID).Msg("Failed to verify TOTP code")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if retryAfter > 0 {
+			respondTOTPLocked(c, retryAfter)
+			return
+		}
+		if !valid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code", "two_factor_required": true})
+			return
+		}
+		generateToken = auth.GenerateTwoFactorToken
+	}
+
 	// Generate JWT token
-	token, err := auth.GenerateToken(user.ID, user.Email, user.IsAdmin)
+	token, err := generateToken(user.ID, user.Email, user.IsAdmin)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Failed to generate token")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -207,6 +245,9 @@ func (s *Server) login(c *gin.Context) {
 			Name:      user.Name,
 			IsAdmin:   user.IsAdmin,
 			CreatedAt: user.CreatedAt,
+
+			TwoFactorEnabled: user.TOTPEnabled,
+			SSOLinked:        user.OIDCSubject != "",
 		},
 	})
 }
@@ -239,6 +280,12 @@ func (s *Server) getCurrentUser(c *gin.Context) {
 		Name:      user.Name,
 		IsAdmin:   user.IsAdmin,
 		CreatedAt: user.CreatedAt,
+
+		TwoFactorEnabled: user.TOTPEnabled,
+		SSOLinked:        user.OIDCSubject != "",
+
+		TwoFactorVerified: sessionData.TwoFactor,
+		TwoFactorDeadline: user.TwoFactorDeadline,
 	})
 }
 
@@ -267,6 +314,9 @@ func (s *Server) listUsers(c *gin.Context) {
 			Name:      user.Name,
 			IsAdmin:   user.IsAdmin,
 			CreatedAt: user.CreatedAt,
+
+			TwoFactorEnabled: user.TOTPEnabled,
+			SSOLinked:        user.OIDCSubject != "",
 		}
 	}
 
@@ -321,6 +371,10 @@ func (s *Server) createUser(c *gin.Context) {
 		Str("created_by", sessionData.UserID).
 		Msg("User created")
 
+	setAuditResource(c, user.ID)
+	setAuditDetail(c, "email", user.Email)
+	setAuditDetail(c, "is_admin", strconv.FormatBool(user.IsAdmin))
+
 	c.JSON(http.StatusCreated, CreateUserResponse{
 		User: &UserDetail{
 			ID:        user.ID,
@@ -379,5 +433,7 @@ func (s *Server) deleteUser(c *gin.Context) {
 		Str("deleted_by", sessionData.UserID).
 		Msg("User deleted")
 
+	setAuditDetail(c, "email", user.Email)
+
 	c.Status(http.StatusNoContent)
 }
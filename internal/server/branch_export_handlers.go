@@ -0,0 +1,203 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/exports"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// ExportBranchRequest optionally uploads the archive instead of keeping it for download
+type ExportBranchRequest struct {
+	UploadURL string `json:"upload_url"` // Pre-signed PUT URL, e.g. of an S3 object
+}
+
+// @Summary Export branch
+// @Description Dump a branch to a pg_dump custom-format archive, restorable with pg_restore. Without upload_url the
+// @Description archive can be downloaded for 24 hours once completed, with it the archive is PUT to that URL instead.
+// @Description Branches of break-glass (raw) restores can't be exported
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param request body ExportBranchRequest false "Export branch request"
+// @Success 202 {object} models.BranchExport
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/export [post]
+func (s *Server) exportBranch(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var req ExportBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.UploadURL != "" {
+		if err := exports.ValidateUploadURL(req.UploadURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	sessionData, exists := GetSessionData(c)
+	if !exists {
+		s.logger.Error().Msg("Session data not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	setAuditDetail(c, "name", branch.Name)
+	if branch.SuspendedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Branch is suspended, resume it first"})
+		return
+	}
+	var restore models.Restore
+	if err := s.db.Where("id = ?", branch.RestoreID).First(&restore).Error; err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to load branch restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if restore.Raw {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Break-glass branches hold raw data and can't be exported"})
+		return
+	}
+
+	export := models.BranchExport{
+		BranchID:      branch.ID,
+		BranchName:    branch.Name,
+		RequestedByID: sessionData.UserID,
+		Status:        models.ExportStatusPending,
+	}
+	if err := s.db.Create(&export).Error; err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to create branch export")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	task, err := tasks.NewExportBranchTask(tasks.ExportBranchPayload{ExportID: export.ID, UploadURL: req.UploadURL})
+	if err == nil {
+		_, err = s.taskClient.Enqueue(task, tasks.Timeout(tasks.TypeExportBranch, tasks.ExportBranchTimeout, s.config.Worker), asynq.MaxRetry(0), tasks.Retention(tasks.TypeExportBranch, s.config.Redis), tasks.Queue(tasks.TypeExportBranch, s.config.Worker))
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to enqueue export task")
+		s.db.Model(&export).Updates(map[string]interface{}{"status": models.ExportStatusFailed, "error": "Failed to start export"})
+		s.respondEnqueueError(c, err, "Failed to start export")
+		return
+	}
+
+	setAuditDetail(c, "export_id", export.ID)
+	if req.UploadURL != "" {
+		setAuditDetail(c, "upload", "true")
+	}
+
+	c.JSON(http.StatusAccepted, export)
+}
+
+// @Summary Get branch export
+// @Description Reports the progress of a branch export, its size once completed and why it failed
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param export_id path string true "ID returned when the export was requested"
+// @Success 200 {object} models.BranchExport
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/exports/{export_id} [get]
+func (s *Server) getBranchExport(c *gin.Context) {
+	export, ok := s.findBranchExport(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
+
+// @Summary Download branch export
+// @Description Download the archive of a completed export, restore it with pg_restore
+// @Tags branches
+// @Produce octet-stream
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param export_id path string true "ID returned when the export was requested"
+// @Success 200 {file} file
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/branches/{id}/exports/{export_id}/download [get]
+func (s *Server) downloadBranchExport(c *gin.Context) {
+	export, ok := s.findBranchExport(c)
+	if !ok {
+		return
+	}
+
+	switch {
+	case export.Uploaded:
+		c.JSON(http.StatusConflict, gin.H{"error": "Export was uploaded, there is nothing to download"})
+		return
+	case export.Status == models.ExportStatusExpired || (export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt)):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export expired"})
+		return
+	case export.Status != models.ExportStatusCompleted:
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is " + export.Status})
+		return
+	}
+
+	path := exports.ArchivePath(s.config.Storage, export.ID)
+	if _, err := os.Stat(path); err != nil {
+		s.logger.Error().Err(err).Str("export_id", export.ID).Msg("Archive of completed export missing")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export archive not found"})
+		return
+	}
+
+	c.FileAttachment(path, exports.FileName(export))
+}
+
+// findBranchExport loads the export of the request's branch, writing the error response if it can't
+func (s *Server) findBranchExport(c *gin.Context) (*models.BranchExport, bool) {
+	branchID := c.Param("id")
+	exportID := c.Param("export_id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return nil, false
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+
+	// Exports of other branches aren't reported here
+	var export models.BranchExport
+	if err := s.db.Where("id = ? AND branch_id = ?", exportID, branch.ID).First(&export).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+			return nil, false
+		}
+		s.logger.Error().Err(err).Str("export_id", exportID).Msg("Failed to find branch export")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	return &export, true
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/exports"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestExportBranchValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	readyAt := time.Now()
+	restore := models.Restore{Name: "restore_20250101000000", SchemaReady: true, ReadyAt: &readyAt}
+	raw := models.Restore{Name: "restore_20250102000000", SchemaReady: true, ReadyAt: &readyAt, Raw: true}
+	for _, r := range []*models.Restore{&restore, &raw} {
+		if err := s.db.Create(r).Error; err != nil {
+			t.Fatalf("failed to create restore: %v", err)
+		}
+	}
+	suspendedAt := time.Now()
+	for _, branch := range []*models.Branch{
+		{Name: "feature-x", RestoreID: restore.ID, CreatedByID: "user-1", User: "u", Password: "p", Port: 6001},
+		{Name: "feature-y", RestoreID: restore.ID, CreatedByID: "user-1", User: "u", Password: "p", Port: 6002, SuspendedAt: &suspendedAt},
+		{Name: "breakglass-x", RestoreID: raw.ID, CreatedByID: "user-1", User: "u", Password: "p", Port: 6003},
+	} {
+		if err := s.db.Create(branch).Error; err != nil {
+			t.Fatalf("failed to create branch: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		branch string
+		body   string
+		want   int
+	}{
+		{name: "unknown branch", branch: "feature-z", want: http.StatusNotFound},
+		{name: "suspended branch", branch: "feature-y", want: http.StatusBadRequest},
+		{name: "break-glass branch", branch: "breakglass-x", want: http.StatusBadRequest},
+		{name: "invalid upload URL", branch: "feature-x", body: `{"upload_url":"s3://bucket/feature-x.dump"}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/branches/"+tt.branch+"/export", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = gin.Params{{Key: "id", Value: tt.branch}}
+			c.Set("session", &auth.SessionData{UserID: "user-1", Email: "carol@example.com"})
+			s.exportBranch(c)
+
+			if w.Code != tt.want {
+				t.Errorf("exportBranch() status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	var count int64
+	s.db.Model(&models.BranchExport{}).Count(&count)
+	if count != 0 {
+		t.Errorf("exports = %d, want none for invalid requests", count)
+	}
+}
+
+func TestDownloadBranchExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+	s.config.Storage.MountRoot = t.TempDir()
+
+	branch := models.Branch{Name: "feature-x", RestoreID: "restore-1", CreatedByID: "user-1", User: "u", Password: "p", Port: 6001}
+	if err := s.db.Create(&branch).Error; err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+	expiresAt := time.Now().Add(time.Hour)
+	expiredAt := time.Now().Add(-time.Hour)
+	list := map[string]*models.BranchExport{
+		"completed": {Status: models.ExportStatusCompleted, ExpiresAt: &expiresAt},
+		"running":   {Status: models.ExportStatusRunning},
+		"uploaded":  {Status: models.ExportStatusCompleted, Uploaded: true},
+		"expired":   {Status: models.ExportStatusCompleted, ExpiresAt: &expiredAt},
+	}
+	for _, export := range list {
+		export.BranchID, export.BranchName, export.RequestedByID = branch.ID, branch.Name, "user-1"
+		if err := s.db.Create(export).Error; err != nil {
+			t.Fatalf("failed to create export: %v", err)
+		}
+	}
+	if err := os.MkdirAll(s.config.Storage.ExportDir(), 0o700); err != nil {
+		t.Fatalf("failed to create export directory: %v", err)
+	}
+	if err := os.WriteFile(exports.ArchivePath(s.config.Storage, list["completed"].ID), []byte("PGDMP"), 0o600); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	for name, want := range map[string]int{"completed": http.StatusOK, "running": http.StatusConflict, "uploaded": http.StatusConflict, "expired": http.StatusNotFound} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/branches/feature-x/exports/"+list[name].ID+"/download", nil)
+			c.Params = gin.Params{{Key: "id", Value: "feature-x"}, {Key: "export_id", Value: list[name].ID}}
+			s.downloadBranchExport(c)
+
+			if w.Code != want {
+				t.Fatalf("downloadBranchExport() status = %d, want %d: %s", w.Code, want, w.Body.String())
+			}
+			if want == http.StatusOK {
+				if w.Body.String() != "PGDMP" || !strings.Contains(w.Header().Get("Content-Disposition"), "feature-x-") {
+					t.Errorf("download = %q (%s), want the archive as feature-x-<timestamp>.dump", w.Body.String(), w.Header().Get("Content-Disposition"))
+				}
+			}
+		})
+	}
+}
@@ -1,33 +1,75 @@
 package server
 
 import (
-	"fmt"
+	"errors"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
 	"gorm.io/gorm"
 
 	"github.com/branchd-dev/branchd/internal/branches"
 	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
+	"github.com/branchd-dev/branchd/internal/tasks"
+	"github.com/branchd-dev/branchd/pkg/branchd"
 )
 
 type CreateBranchRequest struct {
-	Name string `json:"name" binding:"required" validate:"required,min=1,max=50,alphanumdash"`
+	// Normalized (see branchd.NormalizeBranchName, e.g. "feature/ABC-123" becomes "feature-abc-123"), then it must
+	// follow the naming policy (branchd.ValidateBranchName) or the request fails with 422
+	Name string `json:"name" binding:"required" validate:"required"`
+
+	// Optional resource profile (CPU/memory cgroup limits and enforced max_connections)
+	Resources models.BranchResourceLimits `json:"resources"`
+
+	// Optional pg_hba.conf rules of the branch's user (networks, auth methods, SSL), defaults to the template's
+	// or connections from anywhere over SSL. Changed later with PUT /api/branches/{id}/hba
+	HBARules []models.BranchHBARule `json:"hba_rules"`
+
+	// Optional networks the branch's port is open to in the firewall, within the config's branch_allowed_cidrs
+	// Defaults to the config's allowlist. Changed later with PUT /api/branches/{id}/firewall
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+
+	// Optional restore to branch from (e.g. a promoted restore), defaults to the latest ready restore
+	RestoreID string `json:"restore_id"`
+
+	// Optional SQL run in the new branch after the configured post-branch SQL (e.g. fixtures of one test suite)
+	// Rendered like the configured one, the branch isn't created if it fails; output goes to the branch log
+	PostBranchSQL string `json:"post_branch_sql"`
+
+	// Optional branch template name (e.g. "ci-small"): its resources apply unless resources are given,
+	// its settings after the configured ones, its SQL before post_branch_sql and its TTL sets expires_at
+	Template string `json:"template"`
 }
 
 type CreateBranchResponse struct {
 	ID       string `json:"id"`       // Branch ID (ULID)
+	Name     string `json:"name"`     // Normalized branch name
 	User     string `json:"user"`     // 16-chars random string
 	Password string `json:"password"` // 32-chars random string
 	Host     string `json:"host"`     // localhost or VM IP
 	Port     int    `json:"port"`     // assigned port for this branch
 	Database string `json:"database"` // parsed from Config.ConnectionString
+
+	// Rendered connection snippets keyed by format (psql, rails, prisma, django, jdbc)
+	Snippets map[string]string `json:"snippets,omitempty"`
+
+	// Short DNS-safe identifier (8 lowercase letters and digits), accepted wherever a branch ID is
+	ShortID string `json:"short_id"`
 }
 
 // @Router /api/branches [post]
 // @Param body body CreateBranchRequest true "Branch creation request"
+// @Param snippets query string false "Comma-separated snippet formats (psql, rails, prisma, django, jdbc) or 'all' (default: all)"
 // @Success 201 {object} CreateBranchResponse
+// @Failure 503 {object} map[string]interface{} "Not enough memory, CPU or disk space for another branch (code capacity_exceeded)"
 func (s *Server) createBranch(c *gin.Context) {
 	sessionData, exists := GetSessionData(c)
 	if !exists {
@@ -51,8 +93,32 @@ func (s *Server) createBranch(c *gin.Context) {
 		return
 	}
 
-	// Normalize branch name to lowercase for consistency
-	req.Name = strings.ToLower(req.Name)
+	// Branch names become ZFS datasets, mountpoints and script values
+	name, ok := s.normalizeBranchName(c, req.Name)
+	if !ok {
+		return
+	}
+	req.Name = name
+
+	if err := branches.ValidateResourceLimits(req.Resources); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resources", "details": err.Error()})
+		return
+	}
+	if err := branches.ValidateHBARules(req.HBARules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hba_rules", "details": err.Error()})
+		return
+	}
+	if err := restore.ValidatePostBranchSQL(req.PostBranchSQL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post_branch_sql", "details": err.Error()})
+		return
+	}
+
+	// Parse requested snippet formats before doing any work
+	snippetFormats, err := branches.ParseSnippetFormats(c.Query("snippets"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snippets parameter", "details": err.Error()})
+		return
+	}
 
 	// Get config (singleton)
 	var config models.Config
@@ -65,14 +131,51 @@ func (s *Server) createBranch(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
+	if err := branches.ValidateAllowedCIDRs(req.AllowedCIDRs, config.BranchAllowedCIDRs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid allowed_cidrs", "details": err.Error()})
+		return
+	}
 
 	// Create branch using the service
 	branchParams := branches.CreateBranchParams{
-		BranchName:  req.Name,
-		CreatedByID: sessionData.UserID,
+		BranchName:     req.Name,
+		CreatedByID:    sessionData.UserID,
+		ResourceLimits: req.Resources,
+		HBARules:       req.HBARules,
+		AllowedCIDRs:   req.AllowedCIDRs,
+		RestoreID:      req.RestoreID,
+		PostBranchSQL:  req.PostBranchSQL,
+		Template:       req.Template,
+	}
+	if req.Template != "" {
+		setAuditDetail(c, "template", req.Template)
 	}
 
 	branch, err := s.branchesService.CreateBranch(c.Request.Context(), branchParams)
+	if errors.Is(err, sysinfo.ErrInsufficientDiskSpace) {
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, branches.ErrCapacityExceeded) {
+		respondCapacityExceeded(c, err)
+		return
+	}
+	if errors.Is(err, branches.ErrBranchQuotaExceeded) || errors.Is(err, branches.ErrSourceNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, branches.ErrBranchNameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, branches.ErrInvalidBranchName) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, branches.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Error creating branch")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -88,18 +191,7 @@ func (s *Server) createBranch(c *gin.Context) {
 	}
 
 	// Determine host for connection string
-	// Priority: 1. Config.Domain, 2. Request Host, 3. localhost
-	host := config.Domain
-	if host == "" {
-		host = c.Request.Host
-		if host == "" {
-			host = "localhost"
-		}
-		// Remove port from host if present (e.g., "example.com:8080" -> "example.com")
-		if colonIdx := strings.Index(host, ":"); colonIdx != -1 {
-			host = host[:colonIdx]
-		}
-	}
+	host := connectionHost(c, &config)
 
 	// Determine the actual database name inside the PostgreSQL cluster
 	// - For Crunchy Bridge restores: use the configured database name
@@ -110,27 +202,71 @@ func (s *Server) createBranch(c *gin.Context) {
 	}
 
 	// Return connection details with correct database name
+	connInfo := branches.ConnectionInfo{
+		User:     branch.User,
+		Password: branch.Password,
+		Host:     host,
+		Port:     branch.Port,
+		Database: databaseName,
+	}
 	response := CreateBranchResponse{
 		ID:       branch.ID,
+		Name:     branch.Name,
 		User:     branch.User,
 		Password: branch.Password,
 		Host:     host,
 		Port:     branch.Port,
 		Database: databaseName,
+		Snippets: branches.RenderSnippets(connInfo, snippetFormats),
+
+		ShortID: branch.ShortID,
 	}
 
+	setAuditResource(c, branch.ID)
+	setAuditDetail(c, "name", branch.Name)
+
 	c.JSON(http.StatusCreated, response)
 }
 
+// normalizeBranchName applies the branch naming policy to a requested name, responding with 422 itself when
+// the normalized name is still invalid
+func (s *Server) normalizeBranchName(c *gin.Context, requested string) (string, bool) {
+	name := branchd.NormalizeBranchName(requested)
+	if err := branchd.ValidateBranchName(name); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid branch name", "details": err.Error(), "name": name})
+		return "", false
+	}
+	return name, true
+}
+
+// connectionHost returns the host clients connect to branches with
+// Priority: 1. Config.Domain, 2. Request Host, 3. localhost
+func connectionHost(c *gin.Context, config *models.Config) string {
+	host := config.Domain
+	if host == "" {
+		host = c.Request.Host
+		if host == "" {
+			host = "localhost"
+		}
+		// Remove port from host if present (e.g., "example.com:8080" -> "example.com")
+		if colonIdx := strings.Index(host, ":"); colonIdx != -1 {
+			host = host[:colonIdx]
+		}
+	}
+	return host
+}
+
 // @Router /api/branches/:id [delete]
-// @Param id path string true "Branch ID"
+// @Param id path string true "Branch ID, short ID or name"
+// @Param cascade query bool false "Disable the schedule recreating the branch too"
 // @Success 200 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
 func (s *Server) deleteBranch(c *gin.Context) {
 	branchID := c.Param("id")
 
 	// Find branch
 	var branch models.Branch
-	if err := s.db.Where("id = ?", branchID).First(&branch).Error; err != nil {
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
 			return
@@ -140,6 +276,25 @@ func (s *Server) deleteBranch(c *gin.Context) {
 		return
 	}
 
+	graph, err := s.dependencies.ForBranch(&branch)
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to load branch dependencies")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	setAuditDetail(c, "name", branch.Name)
+
+	if c.Query("cascade") == "true" {
+		s.cascadeDelete(c, graph)
+		return
+	}
+
+	// A running promotion takes over the branch's datasets
+	if len(graph.Blockers) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": graph.CascadeBlocked, "dependencies": graph})
+		return
+	}
+
 	// Delete branch using service
 	deleteParams := branches.DeleteBranchParams{
 		BranchName: branch.Name,
@@ -155,6 +310,594 @@ func (s *Server) deleteBranch(c *gin.Context) {
 	})
 }
 
+// @Router /api/branches/:id/suspend [post]
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 200 {object} map[string]interface{}
+func (s *Server) suspendBranch(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := s.branchesService.SuspendBranch(c.Request.Context(), branch.ID); err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Error suspending branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setAuditDetail(c, "name", branch.Name)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Branch suspended successfully",
+	})
+}
+
+// @Router /api/branches/:id/resume [post]
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 200 {object} map[string]interface{}
+func (s *Server) resumeBranch(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := s.branchesService.ResumeBranch(c.Request.Context(), branch.ID); err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Error resuming branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setAuditDetail(c, "name", branch.Name)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Branch resumed successfully",
+	})
+}
+
+// @Router /api/branches/:id/connection-failure [post]
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 200 {object} map[string]interface{}
+func (s *Server) reportBranchConnectionFailure(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Checked right away instead of on the health checker's next run, a crashed branch is restarted
+	status, err := s.branchesService.CheckBranch(c.Request.Context(), branch.ID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Error checking branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setAuditDetail(c, "name", branch.Name)
+	setAuditDetail(c, "status", status)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": status,
+	})
+}
+
+// @Router /api/branches/:id/promote [post]
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 202 {object} models.Restore
+// @Failure 409 {object} map[string]interface{}
+func (s *Server) promoteBranch(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if branch.SuspendedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Branch is suspended, resume it before promoting"})
+		return
+	}
+
+	var pending int64
+	if err := s.db.Model(&models.Restore{}).
+		Where("promoted_from_branch = ? AND ready_at IS NULL AND failed_at IS NULL", branch.Name).
+		Count(&pending).Error; err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to check pending promotions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if pending > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Branch is already being promoted"})
+		return
+	}
+
+	restore, err := s.restoresService.PromoteBranch(c.Request.Context(), &branch)
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Error promoting branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Not retried, the script restarts the branch when the promotion fails and the user decides whether to try again
+	promoteTask, err := tasks.NewPromoteBranchTask(restore.ID)
+	if err == nil {
+		_, err = s.taskClient.Enqueue(promoteTask, tasks.Timeout(tasks.TypePromoteBranch, tasks.PromoteBranchTimeout, s.config.Worker), asynq.MaxRetry(0), tasks.Retention(tasks.TypePromoteBranch, s.config.Redis), tasks.Queue(tasks.TypePromoteBranch, s.config.Worker))
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to enqueue promote task")
+		if err := s.db.Delete(restore).Error; err != nil {
+			s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to delete restore record")
+		}
+		s.respondEnqueueError(c, err, "Failed to start promotion")
+		return
+	}
+
+	setAuditDetail(c, "name", branch.Name)
+	setAuditDetail(c, "restore_id", restore.ID)
+
+	c.JSON(http.StatusAccepted, restore)
+}
+
+// @Router /api/branches/:id/disk-quota [put]
+// @Param id path string true "Branch ID, short ID or name"
+// @Param body body SetBranchDiskQuotaRequest true "Disk quota"
+// @Success 200 {object} models.Branch
+func (s *Server) setBranchDiskQuota(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var req SetBranchDiskQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	limits := branch.ResourceLimits
+	limits.DiskQuotaGB = req.DiskQuotaGB
+	limits.DiskReservationGB = req.DiskReservationGB
+	if err := branches.ValidateResourceLimits(limits); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid disk quota", "details": err.Error()})
+		return
+	}
+
+	updated, err := s.branchesService.SetDiskQuota(c.Request.Context(), branch.ID, req.DiskQuotaGB, req.DiskReservationGB)
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Error setting branch disk quota")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setAuditDetail(c, "name", branch.Name)
+	setAuditDetail(c, "disk_quota_gb", strconv.Itoa(req.DiskQuotaGB))
+	setAuditDetail(c, "disk_reservation_gb", strconv.Itoa(req.DiskReservationGB))
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// SetBranchHBARulesRequest replaces the pg_hba.conf rules of a branch's user
+type SetBranchHBARulesRequest struct {
+	Rules []models.BranchHBARule `json:"rules"` // Empty = connections from anywhere over SSL
+}
+
+// BranchHBARulesResponse lists the pg_hba.conf rules of a branch's user
+type BranchHBARulesResponse struct {
+	BranchID string                 `json:"branch_id"`
+	Rules    []models.BranchHBARule `json:"rules"`
+	Default  bool                   `json:"default"` // The branch has no rules of its own, connections from anywhere over SSL are allowed
+}
+
+// @Summary Get branch pg_hba rules
+// @Description List the networks, auth methods and SSL use the branch's user may connect with
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 200 {object} BranchHBARulesResponse
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/hba [get]
+func (s *Server) getBranchHBARules(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	rules := branch.HBARules
+	if rules == nil {
+		rules = []models.BranchHBARule{}
+	}
+	c.JSON(http.StatusOK, BranchHBARulesResponse{BranchID: branch.ID, Rules: rules, Default: len(rules) == 0})
+}
+
+// @Summary Set branch pg_hba rules
+// @Description Replace the pg_hba.conf rules of the branch's user and reload the branch, no restart needed.
+// @Description Rules are matched in order; connections matching none are rejected (admin only)
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param body body SetBranchHBARulesRequest true "pg_hba rules"
+// @Success 200 {object} BranchHBARulesResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/hba [put]
+func (s *Server) setBranchHBARules(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var req SetBranchHBARulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if err := branches.ValidateHBARules(req.Rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rules", "details": err.Error()})
+		return
+	}
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	updated, err := s.branchesService.SetHBARules(c.Request.Context(), branch.ID, req.Rules)
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Error setting branch hba rules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cidrs := make([]string, 0, len(req.Rules))
+	for _, rule := range req.Rules {
+		cidrs = append(cidrs, rule.CIDR)
+	}
+	setAuditDetail(c, "name", branch.Name)
+	setAuditDetail(c, "cidrs", strings.Join(cidrs, ","))
+
+	rules := updated.HBARules
+	if rules == nil {
+		rules = []models.BranchHBARule{}
+	}
+	c.JSON(http.StatusOK, BranchHBARulesResponse{BranchID: updated.ID, Rules: rules, Default: len(rules) == 0})
+}
+
+// SetBranchFirewallRequest replaces the networks a branch's port is open to
+type SetBranchFirewallRequest struct {
+	AllowedCIDRs []string `json:"allowed_cidrs"` // Empty = the config's branch_allowed_cidrs
+}
+
+// BranchFirewallResponse lists the networks a branch's port is open to
+type BranchFirewallResponse struct {
+	BranchID     string   `json:"branch_id"`
+	AllowedCIDRs []string `json:"allowed_cidrs"` // The branch's own allowlist
+	Effective    []string `json:"effective"`     // What the firewall allows, empty = anywhere
+}
+
+// @Summary Get branch firewall rules
+// @Description List the networks the branch's port is open to, its own allowlist and the one in effect
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 200 {object} BranchFirewallResponse
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/firewall [get]
+func (s *Server) getBranchFirewall(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	response, err := s.branchFirewallResponse(&branch)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Set branch firewall rules
+// @Description Replace the networks the branch's port is open to in ufw, within the config's branch_allowed_cidrs.
+// @Description An empty list falls back to the config's allowlist (admin only)
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param body body SetBranchFirewallRequest true "Allowed networks"
+// @Success 200 {object} BranchFirewallResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/firewall [put]
+func (s *Server) setBranchFirewall(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var req SetBranchFirewallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err := branches.ValidateAllowedCIDRs(req.AllowedCIDRs, config.BranchAllowedCIDRs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid allowed_cidrs", "details": err.Error()})
+		return
+	}
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	updated, err := s.branchesService.SetAllowedCIDRs(c.Request.Context(), branch.ID, req.AllowedCIDRs)
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Error setting branch firewall rules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setAuditDetail(c, "name", branch.Name)
+	setAuditDetail(c, "cidrs", strings.Join(req.AllowedCIDRs, ","))
+
+	response, err := s.branchFirewallResponse(updated)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) branchFirewallResponse(branch *models.Branch) (*BranchFirewallResponse, error) {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		return nil, err
+	}
+	response := &BranchFirewallResponse{
+		BranchID:     branch.ID,
+		AllowedCIDRs: branch.AllowedCIDRs,
+		Effective:    branches.EffectiveAllowedCIDRs(config.BranchAllowedCIDRs, branch.AllowedCIDRs),
+	}
+	if response.AllowedCIDRs == nil {
+		response.AllowedCIDRs = []string{}
+	}
+	if response.Effective == nil {
+		response.Effective = []string{}
+	}
+	return response, nil
+}
+
+// @Router /api/branches/:id/usage [get]
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 200 {object} branches.BranchUsage
+func (s *Server) getBranchUsage(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	usage, err := s.branchesService.BranchUsage(c.Request.Context(), &branch)
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to get branch usage")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// @Summary Diff branch against its restore
+// @Description Compare a branch's schema (tables, columns, indexes, constraints, triggers, views, functions) and
+// @Description per-table row counts against its restore, e.g. to see what migrations or tests changed before deleting it.
+// @Description The restore is compared as it is now; a suspended branch is resumed
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 200 {object} branches.BranchDiff
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/branches/{id}/diff [get]
+func (s *Server) getBranchDiff(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	diff, err := s.branchesService.DiffBranch(c.Request.Context(), &branch)
+	if errors.Is(err, branches.ErrDiffUnavailable) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to diff branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// @Summary Get branch logs
+// @Description Get the log of a branch, e.g. the output of the post-branch SQL run when it was created
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param lines query int false "Number of lines to fetch (default: 50)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/logs [get]
+func (s *Server) getBranchLogs(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	s.writeLogTail(c, branches.BranchLogPath(branch.Name))
+}
+
+// @Router /api/branch-stats [get]
+// @Success 200 {object} branches.FanOutStats
+func (s *Server) getBranchStats(c *gin.Context) {
+	stats, err := s.branchesService.FanOutStats()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to compute branch stats")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute branch stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// maxStaleDays bounds the stale_days parameter of the branch usage report
+const maxStaleDays = 365
+
+// @Summary Get branch usage report
+// @Description Last connection of every branch, per-user activity and the branches without connections in stale_days
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param stale_days query int false "Days without connections after which a branch is stale (default 14)"
+// @Success 200 {object} branches.BranchActivityReport
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/reports/branch-usage [get]
+func (s *Server) getBranchUsageReport(c *gin.Context) {
+	staleDays := branches.DefaultStaleDays
+	if staleDaysStr := c.Query("stale_days"); staleDaysStr != "" {
+		d, err := strconv.Atoi(staleDaysStr)
+		if err != nil || d < 1 || d > maxStaleDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "stale_days must be between 1 and " + strconv.Itoa(maxStaleDays)})
+			return
+		}
+		staleDays = d
+	}
+
+	report, err := s.branchesService.ActivityReport(staleDays)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to compute branch usage report")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute branch usage report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// @Router /api/restores/:id/branch-stats [get]
+// @Param id path string true "Restore ID"
+// @Success 200 {object} branches.RestoreFanOut
+func (s *Server) getRestoreBranchStats(c *gin.Context) {
+	restoreID := c.Param("id")
+
+	fanOut, err := s.branchesService.RestoreFanOut(restoreID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to compute restore branch stats")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute branch stats"})
+		return
+	}
+	if fanOut == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, fanOut)
+}
+
 // BranchListResponse represents a branch in the list view
 type BranchListResponse struct {
 	ID            string `json:"id"`
@@ -164,7 +907,54 @@ type BranchListResponse struct {
 	RestoreID     string `json:"restore_id"`
 	RestoreName   string `json:"restore_name"`
 	Port          int    `json:"port"`
-	ConnectionURL string `json:"connection_url"`
+	ConnectionURL string `json:"connection_url"` // Empty for other users' break-glass branches
+	Suspended     bool   `json:"suspended"`      // PostgreSQL is stopped until the next connection or resume
+
+	// Client activity as of activity_sampled_at, sampled every few minutes (activity_sampled_at is null until the first sample)
+	ActiveConnections int        `json:"active_connections"`
+	TransactionCount  int64      `json:"transaction_count"` // Since the branch's PostgreSQL started
+	LastActivityAt    *time.Time `json:"last_activity_at"`  // Last connection or transaction seen (null = never)
+	ActivitySampledAt *time.Time `json:"activity_sampled_at"`
+
+	// ZFS space use of the branch's clone (omitted when it can't be read)
+	DiskUsedBytes       int64 `json:"disk_used_bytes,omitempty"`       // Space the branch wrote, data shared with the restore is not counted
+	DiskReferencedBytes int64 `json:"disk_referenced_bytes,omitempty"` // Data the branch holds, what the quota limits
+	DiskQuotaBytes      int64 `json:"disk_quota_bytes,omitempty"`      // 0 = no quota
+
+	// ok, near_limit or exceeded (writes fail), omitted without quota
+	DiskQuotaState string `json:"disk_quota_state,omitempty"`
+
+	// Short DNS-safe identifier, accepted wherever a branch ID is
+	ShortID string `json:"short_id"`
+
+	// running, stopped or crashed as of last_checked_at (empty until the first check)
+	Status        string     `json:"status"`
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+
+	// Failed automatic restarts since the branch crashed, omitted while it runs
+	RecoveryAttempts int `json:"recovery_attempts,omitempty"`
+
+	// Branch template the branch was created from and when its TTL deletes it, omitted without template or TTL
+	Template  string     `json:"template,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// GitHub pull request the webhook created the branch for, omitted for other branches
+	PullRequest string `json:"pull_request,omitempty"`
+}
+
+// branchQuotaState returns a branch's current disk quota state
+// The state recorded by the worker's disk monitor is used when ZFS couldn't be queried
+func branchQuotaState(branch models.Branch, diskUsage map[string]branches.DiskUsage) string {
+	if usage, ok := diskUsage[branch.Name]; ok {
+		return usage.QuotaState()
+	}
+	return branch.DiskQuotaState
+}
+
+// SetBranchDiskQuotaRequest sets the ZFS refquota and reservation of a branch (0 = none)
+type SetBranchDiskQuotaRequest struct {
+	DiskQuotaGB       int `json:"disk_quota_gb"`
+	DiskReservationGB int `json:"disk_reservation_gb"`
 }
 
 // @Router /api/branches [get]
@@ -190,18 +980,7 @@ func (s *Server) listBranches(c *gin.Context) {
 	}
 
 	// Determine host for connection strings
-	// Priority: 1. Config.Domain, 2. Request Host, 3. localhost
-	host := config.Domain
-	if host == "" {
-		host = c.Request.Host
-		if host == "" {
-			host = "localhost"
-		}
-		// Remove port from host if present (e.g., "example.com:8080" -> "example.com")
-		if colonIdx := strings.Index(host, ":"); colonIdx != -1 {
-			host = host[:colonIdx]
-		}
-	}
+	host := connectionHost(c, &config)
 
 	// Determine the actual database name inside the PostgreSQL cluster
 	// - For Crunchy Bridge restores: use the configured database name
@@ -211,6 +990,17 @@ func (s *Server) listBranches(c *gin.Context) {
 		databaseName = config.CrunchyBridgeDatabaseName
 	}
 
+	// Disk usage is best-effort, branches are listed without it when ZFS can't be queried
+	diskUsage, err := s.branchesService.DiskUsage(c.Request.Context())
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to get branch disk usage")
+	}
+
+	var userID string
+	if sessionData, exists := GetSessionData(c); exists {
+		userID = sessionData.UserID
+	}
+
 	response := make([]BranchListResponse, 0, len(branches))
 	for _, branch := range branches {
 		// Determine created by
@@ -220,13 +1010,16 @@ func (s *Server) listBranches(c *gin.Context) {
 		}
 
 		// Build connection URL using the actual database name
-		connectionURL := fmt.Sprintf("postgresql://%s:%s@%s:%d/%s",
-			branch.User,
-			branch.Password,
-			host,
-			branch.Port,
-			databaseName,
-		)
+		connectionURL := (&url.URL{
+			Scheme: "postgresql",
+			User:   url.UserPassword(branch.User, branch.Password),
+			Host:   net.JoinHostPort(host, strconv.Itoa(branch.Port)),
+			Path:   "/" + databaseName,
+		}).String()
+		// Credentials of a break-glass branch (raw restore) are only shown to the user it was granted to
+		if branch.Restore.Raw && branch.CreatedByID != userID {
+			connectionURL = ""
+		}
 
 		response = append(response, BranchListResponse{
 			ID:            branch.ID,
@@ -237,6 +1030,29 @@ func (s *Server) listBranches(c *gin.Context) {
 			RestoreName:   branch.Restore.Name,
 			Port:          branch.Port,
 			ConnectionURL: connectionURL,
+			Suspended:     branch.SuspendedAt != nil,
+
+			ActiveConnections: branch.ActiveConnections,
+			TransactionCount:  branch.TransactionCount,
+			LastActivityAt:    branch.LastActivityAt,
+			ActivitySampledAt: branch.ActivitySampledAt,
+
+			DiskUsedBytes:       diskUsage[branch.Name].UsedBytes,
+			DiskReferencedBytes: diskUsage[branch.Name].ReferencedBytes,
+			DiskQuotaBytes:      diskUsage[branch.Name].QuotaBytes,
+			DiskQuotaState:      branchQuotaState(branch, diskUsage),
+
+			ShortID: branch.ShortID,
+
+			Status:        branch.Status,
+			LastCheckedAt: branch.LastCheckedAt,
+
+			RecoveryAttempts: branch.RecoveryAttempts,
+
+			Template:  branch.Template,
+			ExpiresAt: branch.ExpiresAt,
+
+			PullRequest: branch.PullRequest,
 		})
 	}
 
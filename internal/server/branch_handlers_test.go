@@ -0,0 +1,159 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestGetBranchUsageReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+	s.branchesService = branches.NewService(s.db, s.config, s.logger)
+
+	user := &models.User{Email: "dev@example.com", PasswordHash: "hash"}
+	createTestUser(t, s, user)
+	lastActivity := time.Now().Add(-5 * 24 * time.Hour)
+	branch := models.Branch{Name: "feature-x", RestoreID: "r1", CreatedByID: user.ID, User: "user", Password: "password", LastActivityAt: &lastActivity}
+	if err := s.db.Create(&branch).Error; err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+
+	tests := []struct {
+		query     string
+		wantCode  int
+		wantStale int
+	}{
+		{query: "", wantCode: http.StatusOK, wantStale: 0},
+		{query: "?stale_days=3", wantCode: http.StatusOK, wantStale: 1},
+		{query: "?stale_days=0", wantCode: http.StatusBadRequest},
+		{query: "?stale_days=week", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/reports/branch-usage"+tt.query, nil)
+			s.getBranchUsageReport(c)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("getBranchUsageReport() status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var report branches.BranchActivityReport
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("failed to decode report: %v", err)
+			}
+			if len(report.StaleBranches) != tt.wantStale {
+				t.Errorf("stale branches = %d, want %d", len(report.StaleBranches), tt.wantStale)
+			}
+			if len(report.Users) != 1 || report.Users[0].Branches != 1 {
+				t.Errorf("users = %+v, want dev@example.com with one branch", report.Users)
+			}
+		})
+	}
+}
+
+func TestBranchHBARules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	branch := models.Branch{Name: "feature-x", RestoreID: "r1", CreatedByID: "u1", User: "user", Password: "password",
+		HBARules: []models.BranchHBARule{{CIDR: "10.0.0.0/8", SSL: branches.HBASSLOptional}}}
+	if err := s.db.Create(&branch).Error; err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/branches/feature-x/hba", nil)
+	c.Params = gin.Params{{Key: "id", Value: "feature-x"}}
+	s.getBranchHBARules(c)
+
+	var got BranchHBARulesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || got.Default || len(got.Rules) != 1 || got.Rules[0].SSL != branches.HBASSLOptional {
+		t.Errorf("getBranchHBARules() = %d %+v, want the branch's rule", w.Code, got)
+	}
+
+	// Invalid rules are rejected before the branch is touched
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/branches/feature-x/hba", strings.NewReader(`{"rules":[{"cidr":"10.0.0.1"}]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: "feature-x"}}
+	s.setBranchHBARules(c)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("setBranchHBARules() status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+}
+
+func TestBranchFirewall(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	if err := s.db.Create(&models.Config{JWTSecret: "secret", BranchAllowedCIDRs: "10.0.0.0/8"}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+	branch := models.Branch{Name: "feature-x", RestoreID: "r1", CreatedByID: "u1", User: "user", Password: "password", Port: 6001}
+	if err := s.db.Create(&branch).Error; err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/branches/feature-x/firewall", nil)
+	c.Params = gin.Params{{Key: "id", Value: "feature-x"}}
+	s.getBranchFirewall(c)
+
+	var got BranchFirewallResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || len(got.AllowedCIDRs) != 0 || len(got.Effective) != 1 || got.Effective[0] != "10.0.0.0/8" {
+		t.Errorf("getBranchFirewall() = %d %+v, want the config's allowlist in effect", w.Code, got)
+	}
+
+	// Networks outside the config's allowlist are rejected before the branch is touched
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/branches/feature-x/firewall", strings.NewReader(`{"allowed_cidrs":["203.0.113.7/32"]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: "feature-x"}}
+	s.setBranchFirewall(c)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("setBranchFirewall() status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+}
+
+func TestCreateBranchRejectsInvalidNames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	for _, name := range []string{"restore_20250915120000", strings.Repeat("feature-", 8), "///"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/branches", strings.NewReader(`{"name":"`+name+`"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("session", &auth.SessionData{UserID: "user-1", Email: "carol@example.com"})
+		s.createBranch(c)
+
+		if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "Invalid branch name") {
+			t.Errorf("createBranch(%q) = %d %s, want 422", name, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// ShareBranchRequest sets how long and for whom a branch is shared
+type ShareBranchRequest struct {
+	TTLHours int    `json:"ttl_hours"` // 0 = 24 hours, at most 168
+	Note     string `json:"note"`      // Who the access is for, e.g. "Acme contractor"
+}
+
+// ShareBranchResponse holds the credentials of a new share, the password isn't shown again
+type ShareBranchResponse struct {
+	models.BranchShare
+	Password         string `json:"password"`
+	Host             string `json:"host"`
+	Port             int    `json:"port"`
+	Database         string `json:"database"`
+	ConnectionString string `json:"connection_string"`
+	RevokeURL        string `json:"revoke_url"` // DELETE ends the access before it expires
+}
+
+// @Summary Share branch
+// @Description Create a read-only Postgres role in the branch that can log in until the share expires, e.g. to give
+// @Description an external contractor access without a branchd user. The password is only returned here.
+// @Description The role reads all data, ends when the branch is deleted or refreshed and connects under the branch's hba rules.
+// @Description Branches of break-glass (raw) restores can't be shared
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param request body ShareBranchRequest false "Share branch request"
+// @Success 201 {object} ShareBranchResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/share [post]
+func (s *Server) shareBranch(c *gin.Context) {
+	var req ShareBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ttl := time.Duration(req.TTLHours) * time.Hour
+	if req.TTLHours < 0 || ttl > branches.MaxShareTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ttl_hours must be between 1 and 168"})
+		return
+	}
+
+	sessionData, exists := GetSessionData(c)
+	if !exists {
+		s.logger.Error().Msg("Session data not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	branch, ok := s.findShareBranch(c)
+	if !ok {
+		return
+	}
+	var restore models.Restore
+	if err := s.db.Where("id = ?", branch.RestoreID).First(&restore).Error; err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to load branch restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if restore.Raw {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Break-glass branches hold raw data and can't be shared"})
+		return
+	}
+
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load configuration"})
+		return
+	}
+
+	share, password, err := s.branchesService.CreateShare(c.Request.Context(), branches.CreateShareParams{
+		BranchID:    branch.ID,
+		CreatedByID: sessionData.UserID,
+		TTL:         ttl,
+		Note:        strings.TrimSpace(req.Note),
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to share branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share branch", "details": err.Error()})
+		return
+	}
+
+	setAuditDetail(c, "share_id", share.ID)
+	setAuditDetail(c, "expires_at", share.ExpiresAt.Format(time.RFC3339))
+
+	host := connectionHost(c, &config)
+	databaseName := config.DatabaseName
+	if config.CrunchyBridgeDatabaseName != "" {
+		databaseName = config.CrunchyBridgeDatabaseName
+	}
+	connInfo := branches.ConnectionInfo{
+		User:     share.User,
+		Password: password,
+		Host:     host,
+		Port:     branch.Port,
+		Database: databaseName,
+	}
+	c.JSON(http.StatusCreated, ShareBranchResponse{
+		BranchShare:      *share,
+		Password:         password,
+		Host:             host,
+		Port:             branch.Port,
+		Database:         databaseName,
+		ConnectionString: connInfo.URL(),
+		RevokeURL:        "/api/branches/" + branch.ID + "/shares/" + share.ID,
+	})
+}
+
+// @Summary List branch shares
+// @Description List the shares of a branch, active, expired and revoked
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 200 {array} models.BranchShare
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/shares [get]
+func (s *Server) listBranchShares(c *gin.Context) {
+	branch, ok := s.findShareBranch(c)
+	if !ok {
+		return
+	}
+
+	shares := []models.BranchShare{}
+	if err := s.db.Where("branch_id = ?", branch.ID).Order("created_at DESC").Find(&shares).Error; err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to list branch shares")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shares)
+}
+
+// @Summary Revoke branch share
+// @Description Drop the role of a share and terminate its connections before it expires
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param share_id path string true "ID returned when the branch was shared"
+// @Success 200 {object} models.BranchShare
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/branches/{id}/shares/{share_id} [delete]
+func (s *Server) revokeBranchShare(c *gin.Context) {
+	sessionData, exists := GetSessionData(c)
+	if !exists {
+		s.logger.Error().Msg("Session data not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	branch, ok := s.findShareBranch(c)
+	if !ok {
+		return
+	}
+	var share models.BranchShare
+	if err := s.db.Where("id = ? AND branch_id = ?", c.Param("share_id"), branch.ID).First(&share).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+			return
+		}
+		s.logger.Error().Err(err).Msg("Failed to find branch share")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	setAuditDetail(c, "share_id", share.ID)
+
+	revoked, err := s.branchesService.RevokeShare(c.Request.Context(), share.ID, sessionData.UserID)
+	if err != nil {
+		if errors.Is(err, branches.ErrShareRevoked) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Share already revoked or expired"})
+			return
+		}
+		s.logger.Error().Err(err).Str("share_id", share.ID).Msg("Failed to revoke branch share")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, revoked)
+}
+
+// findShareBranch loads the branch of a share request, responding itself when it can't
+func (s *Server) findShareBranch(c *gin.Context) (*models.Branch, bool) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return nil, false
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	setAuditDetail(c, "name", branch.Name)
+	return &branch, true
+}
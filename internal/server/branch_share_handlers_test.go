@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestShareBranchValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	readyAt := time.Now()
+	raw := models.Restore{Name: "restore_20250102000000", SchemaReady: true, ReadyAt: &readyAt, Raw: true}
+	if err := s.db.Create(&raw).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	for _, branch := range []*models.Branch{
+		{Name: "feature-x", RestoreID: "restore-1", CreatedByID: "user-1", User: "u", Password: "p", Port: 6001},
+		{Name: "breakglass-x", RestoreID: raw.ID, CreatedByID: "user-1", User: "u", Password: "p", Port: 6003},
+	} {
+		if err := s.db.Create(branch).Error; err != nil {
+			t.Fatalf("failed to create branch: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		branch string
+		body   string
+		want   int
+	}{
+		{name: "unknown branch", branch: "feature-z", want: http.StatusNotFound},
+		{name: "break-glass branch", branch: "breakglass-x", want: http.StatusBadRequest},
+		{name: "too long", branch: "feature-x", body: `{"ttl_hours":169}`, want: http.StatusBadRequest},
+		{name: "negative duration", branch: "feature-x", body: `{"ttl_hours":-1}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/branches/"+tt.branch+"/share", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = gin.Params{{Key: "id", Value: tt.branch}}
+			c.Set("session", &auth.SessionData{UserID: "user-1", Email: "carol@example.com"})
+			s.shareBranch(c)
+
+			if w.Code != tt.want {
+				t.Errorf("shareBranch() status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestListAndRevokeBranchShares(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+	s.branchesService = branches.NewService(s.db, s.config, s.logger)
+
+	branch := models.Branch{Name: "feature-x", RestoreID: "restore-1", CreatedByID: "user-1", User: "u", Password: "p", Port: 6001}
+	other := models.Branch{Name: "feature-y", RestoreID: "restore-1", CreatedByID: "user-1", User: "v", Password: "p", Port: 6002}
+	for _, b := range []*models.Branch{&branch, &other} {
+		if err := s.db.Create(b).Error; err != nil {
+			t.Fatalf("failed to create branch: %v", err)
+		}
+	}
+	revokedAt := time.Now()
+	share := models.BranchShare{BranchID: branch.ID, BranchName: branch.Name, User: "share_a", ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt}
+	otherShare := models.BranchShare{BranchID: other.ID, BranchName: other.Name, User: "share_b", ExpiresAt: time.Now().Add(time.Hour)}
+	for _, sh := range []*models.BranchShare{&share, &otherShare} {
+		if err := s.db.Create(sh).Error; err != nil {
+			t.Fatalf("failed to create share: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/branches/feature-x/shares", nil)
+	c.Params = gin.Params{{Key: "id", Value: "feature-x"}}
+	s.listBranchShares(c)
+
+	var shares []models.BranchShare
+	if err := json.Unmarshal(w.Body.Bytes(), &shares); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusOK || len(shares) != 1 || shares[0].ID != share.ID {
+		t.Errorf("listBranchShares() = %d %+v, want the branch's share", w.Code, shares)
+	}
+
+	revoke := func(branchRef, shareID string) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/api/branches/"+branchRef+"/shares/"+shareID, nil)
+		c.Params = gin.Params{{Key: "id", Value: branchRef}, {Key: "share_id", Value: shareID}}
+		c.Set("session", &auth.SessionData{UserID: "user-1", Email: "carol@example.com"})
+		s.revokeBranchShare(c)
+		return w.Code
+	}
+	// Shares are only found through their own branch
+	if code := revoke("feature-x", otherShare.ID); code != http.StatusNotFound {
+		t.Errorf("revokeBranchShare() of another branch's share status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := revoke("feature-x", share.ID); code != http.StatusConflict {
+		t.Errorf("revokeBranchShare() of a revoked share status = %d, want %d", code, http.StatusConflict)
+	}
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+)
+
+// CreateBranchTemplateRequest represents a request to create a branch template
+type CreateBranchTemplateRequest struct {
+	Name           string                      `json:"name" binding:"required"`
+	Description    string                      `json:"description"`
+	Resources      models.BranchResourceLimits `json:"resources"`
+	PostgresqlConf string                      `json:"postgresql_conf"`
+	PostBranchSQL  string                      `json:"post_branch_sql"`
+	TTLHours       int                         `json:"ttl_hours"` // Branches are deleted this long after creation, 0 = kept
+
+	// pg_hba.conf rules of the template's branches, used when the create request has none
+	HBARules []models.BranchHBARule `json:"hba_rules"`
+}
+
+// UpdateBranchTemplateRequest updates the given branch template fields
+type UpdateBranchTemplateRequest struct {
+	Name           *string                      `json:"name"`
+	Description    *string                      `json:"description"`
+	Resources      *models.BranchResourceLimits `json:"resources"`
+	PostgresqlConf *string                      `json:"postgresql_conf"`
+	PostBranchSQL  *string                      `json:"post_branch_sql"`
+	TTLHours       *int                         `json:"ttl_hours"`
+	HBARules       *[]models.BranchHBARule      `json:"hba_rules"`
+}
+
+// @Summary List branch templates
+// @Description List the named presets that can be passed as template when creating a branch
+// @Tags branch-templates
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.BranchTemplate
+// @Router /api/branch-templates [get]
+func (s *Server) listBranchTemplates(c *gin.Context) {
+	var list []models.BranchTemplate
+	if err := s.db.Order("name ASC").Find(&list).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list branch templates")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Create branch template
+// @Description Create a named preset of resources, pg_hba rules, PostgreSQL settings, post-branch SQL and TTL (admin only)
+// @Tags branch-templates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateBranchTemplateRequest true "Create branch template request"
+// @Success 201 {object} models.BranchTemplate
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/branch-templates [post]
+func (s *Server) createBranchTemplate(c *gin.Context) {
+	var req CreateBranchTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	branchTemplate := models.BranchTemplate{
+		Name:           strings.TrimSpace(req.Name),
+		Description:    req.Description,
+		ResourceLimits: req.Resources,
+		PostgresqlConf: req.PostgresqlConf,
+		PostBranchSQL:  req.PostBranchSQL,
+		TTLHours:       req.TTLHours,
+		HBARules:       req.HBARules,
+	}
+	if !s.validateBranchTemplate(c, &branchTemplate) {
+		return
+	}
+
+	if err := s.db.Create(&branchTemplate).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create branch template")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create branch template"})
+		return
+	}
+
+	setAuditResource(c, branchTemplate.ID)
+	setAuditDetail(c, "name", branchTemplate.Name)
+
+	c.JSON(http.StatusCreated, branchTemplate)
+}
+
+// @Summary Update branch template
+// @Description Update a branch template, existing branches keep the options they were created with (admin only)
+// @Tags branch-templates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch template ID"
+// @Param request body UpdateBranchTemplateRequest true "Update branch template request"
+// @Success 200 {object} models.BranchTemplate
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branch-templates/{id} [patch]
+func (s *Server) updateBranchTemplate(c *gin.Context) {
+	branchTemplate, ok := s.findBranchTemplate(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req UpdateBranchTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		branchTemplate.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		branchTemplate.Description = *req.Description
+	}
+	if req.Resources != nil {
+		branchTemplate.ResourceLimits = *req.Resources
+	}
+	if req.PostgresqlConf != nil {
+		branchTemplate.PostgresqlConf = *req.PostgresqlConf
+	}
+	if req.PostBranchSQL != nil {
+		branchTemplate.PostBranchSQL = *req.PostBranchSQL
+	}
+	if req.TTLHours != nil {
+		branchTemplate.TTLHours = *req.TTLHours
+	}
+	if req.HBARules != nil {
+		branchTemplate.HBARules = *req.HBARules
+	}
+	if !s.validateBranchTemplate(c, branchTemplate) {
+		return
+	}
+
+	if err := s.db.Save(branchTemplate).Error; err != nil {
+		s.logger.Error().Err(err).Str("template_id", branchTemplate.ID).Msg("Failed to update branch template")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update branch template"})
+		return
+	}
+
+	setAuditDetail(c, "name", branchTemplate.Name)
+
+	c.JSON(http.StatusOK, branchTemplate)
+}
+
+// @Summary Delete branch template
+// @Description Delete a branch template, branches created from it are kept and still expire (admin only)
+// @Tags branch-templates
+// @Security BearerAuth
+// @Param id path string true "Branch template ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branch-templates/{id} [delete]
+func (s *Server) deleteBranchTemplate(c *gin.Context) {
+	branchTemplate, ok := s.findBranchTemplate(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := s.db.Delete(branchTemplate).Error; err != nil {
+		s.logger.Error().Err(err).Str("template_id", branchTemplate.ID).Msg("Failed to delete branch template")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete branch template"})
+		return
+	}
+
+	setAuditDetail(c, "name", branchTemplate.Name)
+
+	c.Status(http.StatusNoContent)
+}
+
+// findBranchTemplate loads a branch template by ID, writing the error response if it can't
+func (s *Server) findBranchTemplate(c *gin.Context, templateID string) (*models.BranchTemplate, bool) {
+	var branchTemplate models.BranchTemplate
+	if err := s.db.Where("id = ?", templateID).First(&branchTemplate).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch template not found"})
+			return nil, false
+		}
+		s.logger.Error().Err(err).Str("template_id", templateID).Msg("Failed to find branch template")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	return &branchTemplate, true
+}
+
+// validateBranchTemplate checks a branch template before it's saved, writing the error response if it's invalid
+func (s *Server) validateBranchTemplate(c *gin.Context, branchTemplate *models.BranchTemplate) bool {
+	if branchTemplate.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return false
+	}
+	if branchTemplate.TTLHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ttl_hours must be 0 (kept) or positive"})
+		return false
+	}
+	if err := branches.ValidateResourceLimits(branchTemplate.ResourceLimits); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resources", "details": err.Error()})
+		return false
+	}
+	if err := branches.ValidateHBARules(branchTemplate.HBARules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hba_rules", "details": err.Error()})
+		return false
+	}
+	if err := restore.ValidatePostBranchSQL(branchTemplate.PostBranchSQL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post_branch_sql", "details": err.Error()})
+		return false
+	}
+	if strings.TrimSpace(branchTemplate.PostgresqlConf) != "" {
+		if err := s.branchesService.ValidatePostgresqlConf(branchTemplate.PostgresqlConf); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid postgresql_conf", "details": err.Error()})
+			return false
+		}
+	}
+
+	var count int64
+	if err := s.db.Model(&models.BranchTemplate{}).Where("name = ? AND id != ?", branchTemplate.Name, branchTemplate.ID).Count(&count).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to check branch template name")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Branch template " + branchTemplate.Name + " already exists"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestCreateBranchTemplateValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	if err := s.db.Create(&models.BranchTemplate{Name: "ci-small", TTLHours: 6}).Error; err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "valid", body: `{"name":"ci-large","resources":{"cpu_cores":2},"post_branch_sql":"TRUNCATE jobs;","ttl_hours":24,"hba_rules":[{"cidr":"10.0.0.0/8"}]}`, want: http.StatusCreated},
+		{name: "missing name", body: `{"name":"  "}`, want: http.StatusBadRequest},
+		{name: "duplicate name", body: `{"name":"ci-small"}`, want: http.StatusConflict},
+		{name: "negative TTL", body: `{"name":"ci-tiny","ttl_hours":-1}`, want: http.StatusBadRequest},
+		{name: "invalid resources", body: `{"name":"ci-tiny","resources":{"cpu_cores":-1}}`, want: http.StatusBadRequest},
+		{name: "invalid hba rules", body: `{"name":"ci-tiny","hba_rules":[{"cidr":"10.0.0.0/8","method":"trust"}]}`, want: http.StatusBadRequest},
+		{name: "invalid post-branch SQL", body: `{"name":"ci-tiny","post_branch_sql":"{{.Unknown"}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/branch-templates", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			s.createBranchTemplate(c)
+
+			if w.Code != tt.want {
+				t.Errorf("createBranchTemplate() status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	var count int64
+	s.db.Model(&models.BranchTemplate{}).Count(&count)
+	if count != 2 {
+		t.Errorf("templates = %d, want ci-small and ci-large", count)
+	}
+}
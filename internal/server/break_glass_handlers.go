@@ -0,0 +1,179 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/breakglass"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// CreateBreakGlassGrantRequest represents an admin granting a user access to raw data
+type CreateBreakGlassGrantRequest struct {
+	UserID          string `json:"user_id" binding:"required"`
+	Justification   string `json:"justification" binding:"required"` // e.g. the incident being investigated, at least 20 characters
+	DurationMinutes int    `json:"duration_minutes" binding:"required"`
+}
+
+// @Summary Grant break-glass access
+// @Description Give a user time-boxed access to raw (not anonymized) data, e.g. for an incident investigation (admin only)
+// @Description A raw restore is started, once it's ready the user gets a branch of it (listed with its connection URL
+// @Description only for them) for duration_minutes (15 to 1440). Every statement on the branch is logged to syslog
+// @Description under the branch name. Other admins are notified; branch and raw restore are deleted when the grant ends
+// @Tags break-glass
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateBreakGlassGrantRequest true "Grant"
+// @Success 202 {object} models.BreakGlassGrant
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/break-glass [post]
+func (s *Server) createBreakGlassGrant(c *gin.Context) {
+	var req CreateBreakGlassGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionData, exists := GetSessionData(c)
+	if !exists {
+		s.logger.Error().Msg("Session data not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+			return
+		}
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if config.ConnectionString == "" && config.CrunchyBridgeAPIKey == "" && !config.UsesPgBackRest() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No restore source configured (need either connection string, Crunchy Bridge credentials or a pgBackRest repository)"})
+		return
+	}
+	if !s.checkRestoreQueue(c, &config) {
+		return
+	}
+
+	grant, restore, err := s.breakGlass.Grant(c.Request.Context(), breakglass.GrantParams{
+		UserID:        req.UserID,
+		GrantedByID:   sessionData.UserID,
+		Justification: req.Justification,
+		Duration:      time.Duration(req.DurationMinutes) * time.Minute,
+	})
+	if errors.Is(err, breakglass.ErrInvalidGrant) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, breakglass.ErrGrantOpen) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create break-glass grant")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create break-glass grant"})
+		return
+	}
+
+	setAuditResource(c, grant.ID)
+	setAuditDetail(c, "user_email", grant.UserEmail)
+	setAuditDetail(c, "justification", grant.Justification)
+	setAuditDetail(c, "duration_minutes", strconv.Itoa(grant.DurationMinutes))
+	setAuditDetail(c, "restore_name", restore.Name)
+
+	// Buffered while Redis is unavailable, the grant activates once the restore ran
+	restoreTask, err := tasks.NewTriggerRestoreTask(restore.ID)
+	if err == nil {
+		_, _, err = tasks.EnqueueOrBuffer(s.db, s.taskClient, restoreTask, s.config)
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("grant_id", grant.ID).Msg("Failed to enqueue raw restore task")
+		// Without a task the restore would stay queued forever, the grant is failed by the worker once it's gone
+		if err := s.db.Delete(restore).Error; err != nil {
+			s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to delete restore record")
+		}
+		s.respondEnqueueError(c, err, "Failed to start raw restore")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, grant)
+}
+
+// @Summary List break-glass grants
+// @Description List break-glass grants, newest first (admin only)
+// @Tags break-glass
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Only grants with this status (pending, active, expired, revoked, failed)"
+// @Success 200 {array} models.BreakGlassGrant
+// @Router /api/break-glass [get]
+func (s *Server) listBreakGlassGrants(c *gin.Context) {
+	query := s.db.Model(&models.BreakGlassGrant{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var grants []models.BreakGlassGrant
+	if err := query.Order("created_at DESC").Find(&grants).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list break-glass grants")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, grants)
+}
+
+// @Summary Revoke break-glass grant
+// @Description End a break-glass grant before it expires: the user's branch (and so their credentials) and the raw restore are deleted (admin only)
+// @Tags break-glass
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Grant ID"
+// @Success 200 {object} models.BreakGlassGrant
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/break-glass/{id} [delete]
+func (s *Server) revokeBreakGlassGrant(c *gin.Context) {
+	var grant models.BreakGlassGrant
+	if err := s.db.Where("id = ?", c.Param("id")).First(&grant).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Break-glass grant not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("grant_id", c.Param("id")).Msg("Failed to find break-glass grant")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	setAuditResource(c, grant.ID)
+	setAuditDetail(c, "user_email", grant.UserEmail)
+
+	revokedBy := "an admin"
+	if sessionData, exists := GetSessionData(c); exists {
+		revokedBy = sessionData.Email
+	}
+	err := s.breakGlass.Revoke(c.Request.Context(), &grant, revokedBy)
+	if errors.Is(err, breakglass.ErrGrantEnded) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Break-glass grant already ended", "status": grant.Status})
+		return
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("grant_id", grant.ID).Msg("Failed to revoke break-glass grant")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke break-glass grant", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, grant)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/breakglass"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestCreateBreakGlassGrantValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+	s.breakGlass = breakglass.NewService(s.db, s.config, nil, nil, s.logger)
+	if err := s.db.Create(&models.Config{ConnectionString: "postgres://source/app"}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+	createTestUser(t, s, &models.User{BaseModel: models.BaseModel{ID: "admin-1"}, Email: "alice@example.com", PasswordHash: "hash", IsAdmin: true})
+	createTestUser(t, s, &models.User{BaseModel: models.BaseModel{ID: "user-1"}, Email: "carol@example.com", PasswordHash: "hash"})
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "missing justification", body: `{"user_id":"user-1","duration_minutes":60}`, want: http.StatusBadRequest},
+		{name: "short justification", body: `{"user_id":"user-1","justification":"debugging","duration_minutes":60}`, want: http.StatusBadRequest},
+		{name: "duration too long", body: `{"user_id":"user-1","justification":"INC-4711: orders missing after checkout","duration_minutes":2880}`, want: http.StatusBadRequest},
+		{name: "unknown user", body: `{"user_id":"nobody","justification":"INC-4711: orders missing after checkout","duration_minutes":60}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/break-glass", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("session", &auth.SessionData{UserID: "admin-1", Email: "alice@example.com", IsAdmin: true})
+			s.createBreakGlassGrant(c)
+
+			if w.Code != tt.want {
+				t.Errorf("createBreakGlassGrant() status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	var grants int64
+	s.db.Model(&models.BreakGlassGrant{}).Count(&grants)
+	if grants != 0 {
+		t.Errorf("grants = %d, want none for invalid requests", grants)
+	}
+}
+
+func TestListBranchesHidesBreakGlassCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+	s.branchesService = branches.NewService(s.db, s.config, s.logger)
+	if err := s.db.Create(&models.Config{Domain: "db.example.com"}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	readyAt := time.Now()
+	raw := models.Restore{Name: "restore_20250101000000", SchemaReady: true, ReadyAt: &readyAt, Raw: true}
+	if err := s.db.Create(&raw).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	branch := models.Branch{Name: "breakglass-x", RestoreID: raw.ID, CreatedByID: "user-1", User: "user", Password: "password", Port: 6001}
+	if err := s.db.Create(&branch).Error; err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+
+	for userID, wantURL := range map[string]bool{"user-1": true, "admin-1": false} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/branches", nil)
+		c.Set("session", &auth.SessionData{UserID: userID})
+		s.listBranches(c)
+
+		var response []BranchListResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || len(response) != 1 {
+			t.Fatalf("listBranches() = %s, want one branch", w.Body.String())
+		}
+		if got := response[0].ConnectionURL != ""; got != wantURL {
+			t.Errorf("connection URL for %s = %q, want shown %v", userID, response[0].ConnectionURL, wantURL)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"net/http"
+	"net/mail"
 	"net/url"
 	"strings"
 	"time"
@@ -11,9 +12,14 @@ import (
 	"github.com/robfig/cron/v3"
 	"gorm.io/gorm"
 
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/branches"
 	"github.com/branchd-dev/branchd/internal/caddy"
+	"github.com/branchd-dev/branchd/internal/diagnostics"
 	"github.com/branchd-dev/branchd/internal/models"
 	"github.com/branchd-dev/branchd/internal/pgclient"
+	"github.com/branchd-dev/branchd/internal/purge"
+	"github.com/branchd-dev/branchd/internal/restore"
 )
 
 // OnboardingDatabaseRequest represents the onboarding request
@@ -27,36 +33,154 @@ type OnboardingDatabaseRequest struct {
 type ConfigResponse struct {
 	ID                        string     `json:"id"`
 	ConnectionString          string     `json:"connection_string"`
+	DemoMode                  bool       `json:"demo_mode"`
 	PostgresVersion           string     `json:"postgres_version"`
+	TargetPostgresVersion     string     `json:"target_postgres_version"`
 	SchemaOnly                bool       `json:"schema_only"`
 	RefreshSchedule           string     `json:"refresh_schedule"`
+	RefreshMode               string     `json:"refresh_mode"`
+	RefreshWindows            string     `json:"refresh_windows"`
+	RefreshForced             bool       `json:"refresh_forced"`
 	BranchPostgresqlConf      string     `json:"branch_postgresql_conf"`
 	DatabaseName              string     `json:"database_name"`
 	Domain                    string     `json:"domain"`
 	LetsEncryptEmail          string     `json:"lets_encrypt_email"`
 	MaxRestores               int        `json:"max_restores"`
+	RestoreMaxAgeDays         int        `json:"restore_max_age_days"`
+	RestoreKeepLatest         int        `json:"restore_keep_latest"`
+	MaxConcurrentRestores     int        `json:"max_concurrent_restores"`
+	RestoreQueuePolicy        string     `json:"restore_queue_policy"`
+	RestoreDeadlineHours      int        `json:"restore_deadline_hours"`
+	BranchIdleSuspendHours    int        `json:"branch_idle_suspend_hours"`
+	BranchDiskQuotaGB         int        `json:"branch_disk_quota_gb"`
+	BranchAllowedCIDRs        string     `json:"branch_allowed_cidrs"`
+	UpdateChecksDisabled      bool       `json:"update_checks_disabled"`
 	LastRefreshedAt           *time.Time `json:"last_refreshed_at"`
 	NextRefreshAt             *time.Time `json:"next_refresh_at"`
 	CreatedAt                 time.Time  `json:"created_at"`
 	CrunchyBridgeAPIKey       string     `json:"crunchy_bridge_api_key"`
 	CrunchyBridgeClusterName  string     `json:"crunchy_bridge_cluster_name"`
 	CrunchyBridgeDatabaseName string     `json:"crunchy_bridge_database_name"`
+	PgBackRestStanza          string     `json:"pgbackrest_stanza"`
+	PgBackRestRepoPath        string     `json:"pgbackrest_repo_path"`
+	PgBackRestS3Bucket        string     `json:"pgbackrest_s3_bucket"`
+	PgBackRestS3Endpoint      string     `json:"pgbackrest_s3_endpoint"`
+	PgBackRestS3Region        string     `json:"pgbackrest_s3_region"`
+	PgBackRestS3Key           string     `json:"pgbackrest_s3_key"`
+	PgBackRestS3KeySecret     string     `json:"pgbackrest_s3_key_secret"`
+	PgBackRestCipherPass      string     `json:"pgbackrest_cipher_pass"`
+	PgBackRestDatabaseName    string     `json:"pgbackrest_database_name"`
 	PostRestoreSQL            string     `json:"post_restore_sql"`
+	SeedSQL                   string     `json:"seed_sql"`
+	PostBranchSQL             string     `json:"post_branch_sql"`
+	ReportTrackedTables       string     `json:"report_tracked_tables"`
+	RestoreIncludeTables      string     `json:"restore_include_tables"`
+	RestoreExcludeTables      string     `json:"restore_exclude_tables"`
+	RestoreTableSamples       string     `json:"restore_table_samples"`
+	GitHubWebhookSecret       string     `json:"github_webhook_secret"`
+	NotificationWebhookURL    string     `json:"notification_webhook_url"`
+	SMTPHost                  string     `json:"smtp_host"`
+	SMTPPort                  int        `json:"smtp_port"`
+	SMTPUsername              string     `json:"smtp_username"`
+	SMTPPassword              string     `json:"smtp_password"`
+	SMTPFrom                  string     `json:"smtp_from"`
+	NotifyRestoreHours        int        `json:"notify_restore_hours"`
+	NotifyDiskFreePercent     int        `json:"notify_disk_free_percent"`
+	CapacityMinMemoryMB       int        `json:"capacity_min_memory_mb"`
+	CapacityMaxLoadPercent    int        `json:"capacity_max_load_percent"`
+	CapacityMinDiskPercent    int        `json:"capacity_min_disk_percent"`
+	OIDCIssuerURL             string     `json:"oidc_issuer_url"`
+	OIDCClientID              string     `json:"oidc_client_id"`
+	OIDCClientSecret          string     `json:"oidc_client_secret"`
+	OIDCAdminGroups           string     `json:"oidc_admin_groups"`
+	PurgeKeyColumns           string     `json:"purge_key_columns"`
+	Extensions                string     `json:"extensions"`
 }
 
 // UpdateConfigRequest represents the request to update configuration
 type UpdateConfigRequest struct {
 	ConnectionString          string  `json:"connectionString"`
 	PostgresVersion           string  `json:"postgresVersion"`
+	TargetPostgresVersion     *string `json:"targetPostgresVersion"` // Major version of restores and branches, empty = the source's
 	SchemaOnly                *bool   `json:"schemaOnly"`
 	RefreshSchedule           string  `json:"refreshSchedule"`
+	RefreshMode               string  `json:"refreshMode"`    // "full" or "incremental", empty = unchanged
+	RefreshWindows            *string `json:"refreshWindows"` // Comma-separated UTC ranges scheduled refreshes may start in, empty = any time
 	Domain                    string  `json:"domain"`
 	LetsEncryptEmail          string  `json:"letsEncryptEmail"`
 	MaxRestores               *int    `json:"maxRestores"`
+	RestoreMaxAgeDays         *int    `json:"restoreMaxAgeDays"`      // Restores older than this are deleted, 0 = no age limit
+	RestoreKeepLatest         *int    `json:"restoreKeepLatest"`      // Newest data-ready restores always kept
+	MaxConcurrentRestores     *int    `json:"maxConcurrentRestores"`  // 0 = unlimited
+	RestoreQueuePolicy        string  `json:"restoreQueuePolicy"`     // "queue" or "reject", empty = unchanged
+	RestoreDeadlineHours      *int    `json:"restoreDeadlineHours"`   // 0 = no deadline
+	BranchIdleSuspendHours    *int    `json:"branchIdleSuspendHours"` // 0 = never suspend
+	BranchDiskQuotaGB         *int    `json:"branchDiskQuotaGB"`      // Default ZFS refquota of new branches, 0 = none
+	BranchAllowedCIDRs        *string `json:"branchAllowedCIDRs"`     // Comma-separated networks branch ports are open to, empty = anywhere
+	BranchPostgresqlConf      *string `json:"branchPostgresqlConf"`   // postgresql.conf lines applied to new branches
+	UpdateChecksDisabled      *bool   `json:"updateChecksDisabled"`   // No GitHub lookups of the latest release (air-gapped installs)
 	CrunchyBridgeAPIKey       string  `json:"crunchyBridgeApiKey"`
 	CrunchyBridgeClusterName  string  `json:"crunchyBridgeClusterName"`
 	CrunchyBridgeDatabaseName string  `json:"crunchyBridgeDatabaseName"`
+	PgBackRestStanza          *string `json:"pgBackRestStanza"`   // Restores from a self-hosted pgBackRest repository, empty = another source
+	PgBackRestRepoPath        *string `json:"pgBackRestRepoPath"` // repo1-path, e.g. /var/lib/pgbackrest
+	PgBackRestS3Bucket        *string `json:"pgBackRestS3Bucket"` // Empty = posix repository
+	PgBackRestS3Endpoint      *string `json:"pgBackRestS3Endpoint"`
+	PgBackRestS3Region        *string `json:"pgBackRestS3Region"`
+	PgBackRestS3Key           *string `json:"pgBackRestS3Key"` // Empty = instance credentials
+	PgBackRestS3KeySecret     *string `json:"pgBackRestS3KeySecret"`
+	PgBackRestCipherPass      *string `json:"pgBackRestCipherPass"` // Empty = unencrypted repository
+	PgBackRestDatabaseName    *string `json:"pgBackRestDatabaseName"`
 	PostRestoreSQL            *string `json:"postRestoreSQL"`
+	SeedSQL                   *string `json:"seedSQL"`       // Run after anonymization, rendered like postRestoreSQL
+	PostBranchSQL             *string `json:"postBranchSQL"` // Run in every new branch, rendered with the branch's variables
+	ReportTrackedTables       *string `json:"reportTrackedTables"`
+	RestoreIncludeTables      *string `json:"restoreIncludeTables"`
+	RestoreExcludeTables      *string `json:"restoreExcludeTables"`
+	RestoreTableSamples       *string `json:"restoreTableSamples"`
+	GitHubWebhookSecret       *string `json:"githubWebhookSecret"`    // Empty disables the GitHub webhook
+	NotificationWebhookURL    *string `json:"notificationWebhookUrl"` // Empty = break-glass and decommission events go only to the log, channels and email
+	SMTPHost                  *string `json:"smtpHost"`               // Empty = admin notifications are only logged
+	SMTPPort                  *int    `json:"smtpPort"`               // 465 = implicit TLS, otherwise STARTTLS when offered
+	SMTPUsername              *string `json:"smtpUsername"`           // Empty = no authentication
+	SMTPPassword              *string `json:"smtpPassword"`
+	SMTPFrom                  *string `json:"smtpFrom"`               // Sender address, required with smtpHost
+	NotifyRestoreHours        *int    `json:"notifyRestoreHours"`     // Restores running longer are notified, 0 = never
+	NotifyDiskFreePercent     *int    `json:"notifyDiskFreePercent"`  // ZFS free space below this is notified, 0 = never
+	CapacityMinMemoryMB       *int    `json:"capacityMinMemoryMB"`    // Branches aren't created with less memory available, 0 = not checked
+	CapacityMaxLoadPercent    *int    `json:"capacityMaxLoadPercent"` // or a higher load average (100 = one runnable process per CPU core)
+	CapacityMinDiskPercent    *int    `json:"capacityMinDiskPercent"` // or less ZFS free space
+	OIDCIssuerURL             *string `json:"oidcIssuerUrl"`          // Empty disables SSO login
+	OIDCClientID              *string `json:"oidcClientId"`
+	OIDCClientSecret          *string `json:"oidcClientSecret"`
+	OIDCAdminGroups           *string `json:"oidcAdminGroups"` // Comma-separated
+	PurgeKeyColumns           *string `json:"purgeKeyColumns"` // Comma-separated table.column entries, referencing tables first
+	Extensions                *string `json:"extensions"`      // Comma-separated extensions created in restores and branches
+}
+
+// adminConfigFields returns the fields of req that only admins may change (with two-factor authentication, as on admin
+// routes), the JSON names of those set
+// SSO settings decide who becomes an admin, the GitHub webhook secret's setter owns pull request branches, the
+// allowlist opens every branch port and purge key columns decide which rows a purge deletes
+func adminConfigFields(req *UpdateConfigRequest) []string {
+	var fields []string
+	for _, field := range []struct {
+		name string
+		set  bool
+	}{
+		{"oidcIssuerUrl", req.OIDCIssuerURL != nil},
+		{"oidcClientId", req.OIDCClientID != nil},
+		{"oidcClientSecret", req.OIDCClientSecret != nil},
+		{"oidcAdminGroups", req.OIDCAdminGroups != nil},
+		{"githubWebhookSecret", req.GitHubWebhookSecret != nil},
+		{"branchAllowedCIDRs", req.BranchAllowedCIDRs != nil},
+		{"purgeKeyColumns", req.PurgeKeyColumns != nil},
+	} {
+		if field.set {
+			fields = append(fields, field.name)
+		}
+	}
+	return fields
 }
 
 // @Summary Get configuration
@@ -82,26 +206,74 @@ func (s *Server) getConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, ConfigResponse{
 		ID:                        config.ID,
 		ConnectionString:          redactConnectionString(config.ConnectionString),
+		DemoMode:                  config.DemoMode,
 		PostgresVersion:           config.PostgresVersion,
+		TargetPostgresVersion:     config.TargetPostgresVersion,
 		SchemaOnly:                config.SchemaOnly,
 		RefreshSchedule:           config.RefreshSchedule,
+		RefreshMode:               config.RefreshMode,
+		RefreshWindows:            config.RefreshWindows,
+		RefreshForced:             config.RefreshForced,
 		BranchPostgresqlConf:      config.BranchPostgresqlConf,
 		DatabaseName:              config.DatabaseName,
 		Domain:                    config.Domain,
 		LetsEncryptEmail:          config.LetsEncryptEmail,
 		MaxRestores:               config.MaxRestores,
+		RestoreMaxAgeDays:         config.RestoreMaxAgeDays,
+		RestoreKeepLatest:         config.RestoreKeepLatest,
+		MaxConcurrentRestores:     config.MaxConcurrentRestores,
+		RestoreQueuePolicy:        config.RestoreQueuePolicy,
+		RestoreDeadlineHours:      config.RestoreDeadlineHours,
+		BranchIdleSuspendHours:    config.BranchIdleSuspendHours,
+		BranchDiskQuotaGB:         config.BranchDiskQuotaGB,
+		BranchAllowedCIDRs:        config.BranchAllowedCIDRs,
+		UpdateChecksDisabled:      config.UpdateChecksDisabled,
 		LastRefreshedAt:           config.LastRefreshedAt,
 		NextRefreshAt:             config.NextRefreshAt,
 		CreatedAt:                 config.CreatedAt,
 		CrunchyBridgeAPIKey:       redactSecret(config.CrunchyBridgeAPIKey),
 		CrunchyBridgeClusterName:  config.CrunchyBridgeClusterName,
 		CrunchyBridgeDatabaseName: config.CrunchyBridgeDatabaseName,
+		PgBackRestStanza:          config.PgBackRestStanza,
+		PgBackRestRepoPath:        config.PgBackRestRepoPath,
+		PgBackRestS3Bucket:        config.PgBackRestS3Bucket,
+		PgBackRestS3Endpoint:      config.PgBackRestS3Endpoint,
+		PgBackRestS3Region:        config.PgBackRestS3Region,
+		PgBackRestS3Key:           config.PgBackRestS3Key,
+		PgBackRestS3KeySecret:     redactSecret(config.PgBackRestS3KeySecret),
+		PgBackRestCipherPass:      redactSecret(config.PgBackRestCipherPass),
+		PgBackRestDatabaseName:    config.PgBackRestDatabaseName,
 		PostRestoreSQL:            config.PostRestoreSQL,
+		SeedSQL:                   config.SeedSQL,
+		PostBranchSQL:             config.PostBranchSQL,
+		ReportTrackedTables:       config.ReportTrackedTables,
+		RestoreIncludeTables:      config.RestoreIncludeTables,
+		RestoreExcludeTables:      config.RestoreExcludeTables,
+		RestoreTableSamples:       config.RestoreTableSamples,
+		GitHubWebhookSecret:       redactSecret(config.GitHubWebhookSecret),
+		NotificationWebhookURL:    redactSecret(config.NotificationWebhookURL),
+		SMTPHost:                  config.SMTPHost,
+		SMTPPort:                  config.SMTPPort,
+		SMTPUsername:              config.SMTPUsername,
+		SMTPPassword:              redactSecret(config.SMTPPassword),
+		SMTPFrom:                  config.SMTPFrom,
+		NotifyRestoreHours:        config.NotifyRestoreHours,
+		NotifyDiskFreePercent:     config.NotifyDiskFreePercent,
+		CapacityMinMemoryMB:       config.CapacityMinMemoryMB,
+		CapacityMaxLoadPercent:    config.CapacityMaxLoadPercent,
+		CapacityMinDiskPercent:    config.CapacityMinDiskPercent,
+		OIDCIssuerURL:             config.OIDCIssuerURL,
+		OIDCClientID:              config.OIDCClientID,
+		OIDCClientSecret:          redactSecret(config.OIDCClientSecret),
+		OIDCAdminGroups:           config.OIDCAdminGroups,
+		PurgeKeyColumns:           config.PurgeKeyColumns,
+		Extensions:                config.Extensions,
 	})
 }
 
 // @Summary Update configuration
 // @Description Update the global configuration
+// @Description SSO settings (oidc*), githubWebhookSecret, branchAllowedCIDRs and purgeKeyColumns can only be changed by admins, with two-factor authentication
 // @Tags config
 // @Accept json
 // @Produce json
@@ -109,6 +281,7 @@ func (s *Server) getConfig(c *gin.Context) {
 // @Param request body UpdateConfigRequest true "Configuration updates"
 // @Success 200 {object} ConfigResponse
 // @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Router /api/config [patch]
 func (s *Server) updateConfig(c *gin.Context) {
@@ -117,6 +290,9 @@ func (s *Server) updateConfig(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
 		return
 	}
+	if fields := adminConfigFields(&req); len(fields) > 0 && !s.requireAdmin(c, fields) {
+		return
+	}
 
 	var config models.Config
 	if err := s.db.First(&config).Error; err != nil {
@@ -128,6 +304,7 @@ func (s *Server) updateConfig(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
+	before := config
 
 	// Update Crunchy Bridge configuration if provided
 	if req.CrunchyBridgeAPIKey != "" {
@@ -158,6 +335,46 @@ func (s *Server) updateConfig(c *gin.Context) {
 		config.CrunchyBridgeDatabaseName = ""
 	}
 
+	// Update pgBackRest repository if provided
+	for _, field := range []struct {
+		value *string
+		dest  *string
+	}{
+		{req.PgBackRestStanza, &config.PgBackRestStanza},
+		{req.PgBackRestRepoPath, &config.PgBackRestRepoPath},
+		{req.PgBackRestS3Bucket, &config.PgBackRestS3Bucket},
+		{req.PgBackRestS3Endpoint, &config.PgBackRestS3Endpoint},
+		{req.PgBackRestS3Region, &config.PgBackRestS3Region},
+		{req.PgBackRestS3Key, &config.PgBackRestS3Key},
+		{req.PgBackRestS3KeySecret, &config.PgBackRestS3KeySecret},
+		{req.PgBackRestCipherPass, &config.PgBackRestCipherPass},
+		{req.PgBackRestDatabaseName, &config.PgBackRestDatabaseName},
+	} {
+		if field.value != nil {
+			*field.dest = strings.TrimSpace(*field.value)
+		}
+	}
+
+	if req.ConnectionString != "" || req.CrunchyBridgeAPIKey != "" {
+		// Clear pgBackRest fields if another source is being set
+		clearPgBackRest(&config)
+	} else if req.PgBackRestStanza != nil && config.UsesPgBackRest() {
+		// Clear the other sources when switching to pgBackRest, which always restores full clusters
+		config.ConnectionString = ""
+		config.CrunchyBridgeAPIKey = ""
+		config.CrunchyBridgeClusterName = ""
+		config.CrunchyBridgeDatabaseName = ""
+		if config.SchemaOnly {
+			s.logger.Info().Msg("Automatically disabling schema_only for pgBackRest (not supported by pgBackRest)")
+			config.SchemaOnly = false
+		}
+	}
+
+	// A real source ends demo mode
+	if req.ConnectionString != "" || req.CrunchyBridgeAPIKey != "" || (req.PgBackRestStanza != nil && config.UsesPgBackRest()) {
+		config.DemoMode = false
+	}
+
 	// Update connection string if provided
 	if req.ConnectionString != "" {
 		// Validate new connection string
@@ -175,33 +392,33 @@ func (s *Server) updateConfig(c *gin.Context) {
 				Msg("Attempting to connect to PostgreSQL")
 		}
 
-		client, err := pgclient.NewClient(req.ConnectionString)
-		if err != nil {
-			s.logger.Warn().Err(err).Msg("Failed to create PostgreSQL client")
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Failed to parse connection string",
-				"details": err.Error(),
-			})
-			return
-		}
-		defer client.Close()
-
-		// Test connection
-		if err := client.Ping(ctx); err != nil {
+		// Test connection (pooled, so a hanging database fails fast on retries instead of tying up handlers)
+		if err := s.sourcePool.Do(ctx, req.ConnectionString, func(ctx context.Context, client *pgclient.Client) error {
+			return client.Ping(ctx)
+		}); err != nil {
 			s.logger.Warn().
 				Err(err).
 				Str("error_type", "connection_failed").
 				Msg("Failed to connect to PostgreSQL - check password encoding and network access")
+			hint := diagnostics.Hint(err)
+			if hint == "" {
+				hint = "Test the connection step by step with POST /api/diagnostics/test-connection"
+			}
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "Failed to connect to database",
 				"details": err.Error(),
+				"hint":    hint,
 			})
 			return
 		}
 
 		// Get PostgreSQL version
-		version, err := client.GetVersion(ctx)
-		if err != nil {
+		var version string
+		if err := s.sourcePool.Do(ctx, req.ConnectionString, func(ctx context.Context, client *pgclient.Client) error {
+			var err error
+			version, err = client.GetVersion(ctx)
+			return err
+		}); err != nil {
 			s.logger.Error().Err(err).Msg("Failed to get PostgreSQL version")
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "Failed to get database version",
@@ -219,6 +436,11 @@ func (s *Server) updateConfig(c *gin.Context) {
 		config.PostgresVersion = req.PostgresVersion
 	}
 
+	// Update target PostgreSQL version if provided (new restores only, existing ones keep their version)
+	if req.TargetPostgresVersion != nil {
+		config.TargetPostgresVersion = strings.TrimSpace(*req.TargetPostgresVersion)
+	}
+
 	// Update schema-only flag if provided
 	if req.SchemaOnly != nil {
 		// Validate: schema-only is not supported for Crunchy Bridge restores
@@ -228,6 +450,12 @@ func (s *Server) updateConfig(c *gin.Context) {
 			})
 			return
 		}
+		if *req.SchemaOnly && config.UsesPgBackRest() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "schema_only is not supported for pgBackRest restores (pgBackRest always restores full database)",
+			})
+			return
+		}
 		config.SchemaOnly = *req.SchemaOnly
 	}
 
@@ -242,6 +470,312 @@ func (s *Server) updateConfig(c *gin.Context) {
 		config.MaxRestores = *req.MaxRestores
 	}
 
+	// Update restore retention if provided (applied after the next restore or retention run)
+	if req.RestoreMaxAgeDays != nil {
+		if *req.RestoreMaxAgeDays < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "restore_max_age_days must not be negative",
+			})
+			return
+		}
+		config.RestoreMaxAgeDays = *req.RestoreMaxAgeDays
+	}
+	if req.RestoreKeepLatest != nil {
+		if *req.RestoreKeepLatest < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "restore_keep_latest must not be negative",
+			})
+			return
+		}
+		config.RestoreKeepLatest = *req.RestoreKeepLatest
+	}
+
+	// Update restore concurrency if provided
+	if req.MaxConcurrentRestores != nil {
+		if *req.MaxConcurrentRestores < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "max_concurrent_restores must not be negative",
+			})
+			return
+		}
+		config.MaxConcurrentRestores = *req.MaxConcurrentRestores
+	}
+	if req.RestoreQueuePolicy != "" {
+		if req.RestoreQueuePolicy != models.RestoreQueuePolicyQueue && req.RestoreQueuePolicy != models.RestoreQueuePolicyReject {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "restore_queue_policy must be 'queue' or 'reject'",
+			})
+			return
+		}
+		config.RestoreQueuePolicy = req.RestoreQueuePolicy
+	}
+
+	// Update restore deadline if provided (applies to running restores as well)
+	if req.RestoreDeadlineHours != nil {
+		if *req.RestoreDeadlineHours < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "restore_deadline_hours must not be negative",
+			})
+			return
+		}
+		config.RestoreDeadlineHours = *req.RestoreDeadlineHours
+	}
+
+	// Update idle branch suspension if provided
+	if req.BranchIdleSuspendHours != nil {
+		if *req.BranchIdleSuspendHours < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "branch_idle_suspend_hours must not be negative",
+			})
+			return
+		}
+		config.BranchIdleSuspendHours = *req.BranchIdleSuspendHours
+	}
+
+	// Update default branch disk quota if provided (applies to branches created afterwards)
+	if req.BranchDiskQuotaGB != nil {
+		if *req.BranchDiskQuotaGB < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "branch_disk_quota_gb must not be negative",
+			})
+			return
+		}
+		config.BranchDiskQuotaGB = *req.BranchDiskQuotaGB
+	}
+
+	// Update the networks branch ports are open to if provided (applied to existing branches after saving)
+	if req.BranchAllowedCIDRs != nil {
+		cidrs, err := branches.ParseAllowedCIDRs(*req.BranchAllowedCIDRs)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branchAllowedCIDRs", "details": err.Error()})
+			return
+		}
+		config.BranchAllowedCIDRs = strings.Join(cidrs, ",")
+	}
+
+	// Update the update checks switch if provided
+	if req.UpdateChecksDisabled != nil {
+		config.UpdateChecksDisabled = *req.UpdateChecksDisabled
+	}
+
+	// Update SSO login settings if provided, a new issuer must serve its OpenID configuration
+	if req.OIDCIssuerURL != nil {
+		issuerURL := strings.TrimSuffix(strings.TrimSpace(*req.OIDCIssuerURL), "/")
+		if issuerURL != "" && issuerURL != config.OIDCIssuerURL {
+			if _, err := auth.DiscoverOIDC(c.Request.Context(), issuerURL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OIDC issuer", "details": err.Error()})
+				return
+			}
+		}
+		config.OIDCIssuerURL = issuerURL
+	}
+	if req.OIDCClientID != nil {
+		config.OIDCClientID = strings.TrimSpace(*req.OIDCClientID)
+	}
+	if req.OIDCClientSecret != nil {
+		config.OIDCClientSecret = strings.TrimSpace(*req.OIDCClientSecret)
+	}
+	if req.OIDCAdminGroups != nil {
+		config.OIDCAdminGroups = strings.TrimSpace(*req.OIDCAdminGroups)
+	}
+	if req.OIDCIssuerURL != nil && config.OIDCIssuerURL != "" && config.Domain == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "SSO login requires a domain, the provider redirects to https://<domain>/api/auth/oidc/callback",
+		})
+		return
+	}
+
+	// Update purge key columns if provided
+	if req.PurgeKeyColumns != nil {
+		if _, err := purge.ParseKeyColumns(*req.PurgeKeyColumns); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purge key columns", "details": err.Error()})
+			return
+		}
+		config.PurgeKeyColumns = strings.TrimSpace(*req.PurgeKeyColumns)
+	}
+
+	// Update extensions if provided (created in new restores and branches, existing ones are unchanged)
+	if req.Extensions != nil {
+		extensions, err := models.ParseExtensions(*req.Extensions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid extensions", "details": err.Error()})
+			return
+		}
+		config.Extensions = strings.Join(extensions, ",")
+	}
+
+	// Update the GitHub webhook secret if provided, pull request branches are owned by the admin setting it
+	if req.GitHubWebhookSecret != nil {
+		config.GitHubWebhookSecret = strings.TrimSpace(*req.GitHubWebhookSecret)
+		config.GitHubWebhookUserID = ""
+		if sessionData, exists := GetSessionData(c); exists && config.GitHubWebhookSecret != "" {
+			config.GitHubWebhookUserID = sessionData.UserID
+		}
+	}
+
+	// Update the notification webhook if provided
+	if req.NotificationWebhookURL != nil {
+		webhookURL := strings.TrimSpace(*req.NotificationWebhookURL)
+		if webhookURL != "" {
+			if parsed, err := url.Parse(webhookURL); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Notification webhook URL must be an http(s) URL"})
+				return
+			}
+		}
+		config.NotificationWebhookURL = webhookURL
+	}
+
+	// Update the SMTP server of admin notifications if provided
+	for _, field := range []struct {
+		value *string
+		dest  *string
+	}{
+		{req.SMTPHost, &config.SMTPHost},
+		{req.SMTPUsername, &config.SMTPUsername},
+		{req.SMTPPassword, &config.SMTPPassword},
+		{req.SMTPFrom, &config.SMTPFrom},
+	} {
+		if field.value != nil {
+			*field.dest = strings.TrimSpace(*field.value)
+		}
+	}
+	if req.SMTPPort != nil {
+		if *req.SMTPPort < 1 || *req.SMTPPort > 65535 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "smtp_port must be between 1 and 65535"})
+			return
+		}
+		config.SMTPPort = *req.SMTPPort
+	}
+	if config.SMTPHost != "" {
+		if _, err := mail.ParseAddress(config.SMTPFrom); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "smtp_from must be an email address when smtp_host is set"})
+			return
+		}
+	}
+
+	// Update notification thresholds if provided
+	if req.NotifyRestoreHours != nil {
+		if *req.NotifyRestoreHours < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "notify_restore_hours must not be negative"})
+			return
+		}
+		config.NotifyRestoreHours = *req.NotifyRestoreHours
+	}
+	if req.NotifyDiskFreePercent != nil {
+		if *req.NotifyDiskFreePercent < 0 || *req.NotifyDiskFreePercent > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "notify_disk_free_percent must be between 0 and 100"})
+			return
+		}
+		config.NotifyDiskFreePercent = *req.NotifyDiskFreePercent
+	}
+
+	// Update admission control thresholds if provided
+	if req.CapacityMinMemoryMB != nil {
+		if *req.CapacityMinMemoryMB < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "capacity_min_memory_mb must not be negative"})
+			return
+		}
+		config.CapacityMinMemoryMB = *req.CapacityMinMemoryMB
+	}
+	if req.CapacityMaxLoadPercent != nil {
+		if *req.CapacityMaxLoadPercent < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "capacity_max_load_percent must not be negative"})
+			return
+		}
+		config.CapacityMaxLoadPercent = *req.CapacityMaxLoadPercent
+	}
+	if req.CapacityMinDiskPercent != nil {
+		if *req.CapacityMinDiskPercent < 0 || *req.CapacityMinDiskPercent > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "capacity_min_disk_percent must be between 0 and 100"})
+			return
+		}
+		config.CapacityMinDiskPercent = *req.CapacityMinDiskPercent
+	}
+
+	// Update refresh mode if provided
+	if req.RefreshMode != "" {
+		if req.RefreshMode != models.RefreshModeFull && req.RefreshMode != models.RefreshModeIncremental {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "refresh_mode must be 'full' or 'incremental'",
+			})
+			return
+		}
+		config.RefreshMode = req.RefreshMode
+	}
+
+	// Update refresh windows if provided (allow empty string to clear)
+	if req.RefreshWindows != nil {
+		if _, err := models.ParseRefreshWindows(*req.RefreshWindows); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refresh windows", "details": err.Error()})
+			return
+		}
+		config.RefreshWindows = strings.TrimSpace(*req.RefreshWindows)
+	}
+
+	// Update table filters for logical restores if provided (allow empty string to clear)
+	if req.RestoreIncludeTables != nil {
+		config.RestoreIncludeTables = *req.RestoreIncludeTables
+	}
+	if req.RestoreExcludeTables != nil {
+		config.RestoreExcludeTables = *req.RestoreExcludeTables
+	}
+	if req.RestoreTableSamples != nil {
+		config.RestoreTableSamples = *req.RestoreTableSamples
+	}
+	tableFilters, err := restore.ParseTableFilters(&config)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validate: incremental refreshes replicate from the source with logical replication
+	if config.RefreshMode == models.RefreshModeIncremental {
+		if !tableFilters.Empty() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "incremental refresh_mode is not supported with restore table filters (the subscription copies every table)",
+			})
+			return
+		}
+		if config.CrunchyBridgeAPIKey != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "incremental refresh_mode is not supported for Crunchy Bridge restores",
+			})
+			return
+		}
+		if config.UsesPgBackRest() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "incremental refresh_mode is not supported for pgBackRest restores",
+			})
+			return
+		}
+		if config.SchemaOnly {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "incremental refresh_mode is not supported for schema-only restores",
+			})
+			return
+		}
+	}
+
+	// Validate: the pgBackRest settings end up in pgbackrest.conf
+	if config.UsesPgBackRest() {
+		if err := config.ValidatePgBackRest(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pgBackRest configuration", "details": err.Error()})
+			return
+		}
+	}
+
+	// Validate: the Crunchy Bridge database name is passed to scripts and psql
+	if err := config.ValidateCrunchyBridge(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Crunchy Bridge configuration", "details": err.Error()})
+		return
+	}
+
+	// Validate: only logical restores can upgrade the source's data to another major version
+	if err := config.ValidateTargetPostgresVersion(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target PostgreSQL version", "details": err.Error()})
+		return
+	}
+
 	// Update refresh schedule (allow empty string to clear)
 	config.RefreshSchedule = req.RefreshSchedule
 	if req.RefreshSchedule != "" {
@@ -266,9 +800,45 @@ func (s *Server) updateConfig(c *gin.Context) {
 
 	// Update post-restore SQL if provided (allow empty string to clear)
 	if req.PostRestoreSQL != nil {
+		if err := restore.ValidatePostRestoreSQL(*req.PostRestoreSQL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		config.PostRestoreSQL = *req.PostRestoreSQL
 	}
 
+	// Update seed SQL if provided (allow empty string to clear)
+	if req.SeedSQL != nil {
+		if err := restore.ValidatePostRestoreSQL(*req.SeedSQL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "seed SQL: " + err.Error()})
+			return
+		}
+		config.SeedSQL = *req.SeedSQL
+	}
+
+	// Update post-branch SQL if provided (allow empty string to clear)
+	if req.PostBranchSQL != nil {
+		if err := restore.ValidatePostBranchSQL(*req.PostBranchSQL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "post-branch SQL: " + err.Error()})
+			return
+		}
+		config.PostBranchSQL = *req.PostBranchSQL
+	}
+
+	// Update custom branch PostgreSQL settings if provided (allow empty string to clear)
+	if req.BranchPostgresqlConf != nil {
+		if err := s.branchesService.ValidatePostgresqlConf(*req.BranchPostgresqlConf); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		config.BranchPostgresqlConf = *req.BranchPostgresqlConf
+	}
+
+	// Update tracked tables for restore reports if provided (allow empty string to clear)
+	if req.ReportTrackedTables != nil {
+		config.ReportTrackedTables = *req.ReportTrackedTables
+	}
+
 	// If domain is set, configure Caddy with Let's Encrypt
 	if req.Domain != "" {
 		if err := s.configureCaddy(req.Domain, req.LetsEncryptEmail); err != nil {
@@ -288,29 +858,100 @@ func (s *Server) updateConfig(c *gin.Context) {
 		return
 	}
 
+	// Branches with their own allowlist keep the part of it within the new one, see branches.ApplyFirewallAll
+	if config.BranchAllowedCIDRs != before.BranchAllowedCIDRs {
+		if err := s.branchesService.ApplyFirewallAll(c.Request.Context()); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to apply branch firewall rules")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Configuration saved, but failed to apply branch firewall rules", "details": err.Error()})
+			return
+		}
+	}
+
 	s.logger.Info().Str("config_id", config.ID).Msg("Configuration updated")
 
+	setAuditResource(c, config.ID)
+	setAuditDetail(c, "changed_fields", strings.Join(changedConfigFields(before, config), ","))
+
 	c.JSON(http.StatusOK, ConfigResponse{
 		ID:                        config.ID,
 		ConnectionString:          redactConnectionString(config.ConnectionString),
 		PostgresVersion:           config.PostgresVersion,
+		TargetPostgresVersion:     config.TargetPostgresVersion,
 		SchemaOnly:                config.SchemaOnly,
 		RefreshSchedule:           config.RefreshSchedule,
+		RefreshMode:               config.RefreshMode,
+		RefreshWindows:            config.RefreshWindows,
+		RefreshForced:             config.RefreshForced,
 		BranchPostgresqlConf:      config.BranchPostgresqlConf,
 		DatabaseName:              config.DatabaseName,
 		Domain:                    config.Domain,
 		LetsEncryptEmail:          config.LetsEncryptEmail,
 		MaxRestores:               config.MaxRestores,
+		RestoreMaxAgeDays:         config.RestoreMaxAgeDays,
+		RestoreKeepLatest:         config.RestoreKeepLatest,
+		MaxConcurrentRestores:     config.MaxConcurrentRestores,
+		RestoreQueuePolicy:        config.RestoreQueuePolicy,
+		RestoreDeadlineHours:      config.RestoreDeadlineHours,
+		BranchIdleSuspendHours:    config.BranchIdleSuspendHours,
+		BranchDiskQuotaGB:         config.BranchDiskQuotaGB,
+		BranchAllowedCIDRs:        config.BranchAllowedCIDRs,
+		UpdateChecksDisabled:      config.UpdateChecksDisabled,
 		LastRefreshedAt:           config.LastRefreshedAt,
 		NextRefreshAt:             config.NextRefreshAt,
 		CreatedAt:                 config.CreatedAt,
 		CrunchyBridgeAPIKey:       redactSecret(config.CrunchyBridgeAPIKey),
 		CrunchyBridgeClusterName:  config.CrunchyBridgeClusterName,
 		CrunchyBridgeDatabaseName: config.CrunchyBridgeDatabaseName,
+		PgBackRestStanza:          config.PgBackRestStanza,
+		PgBackRestRepoPath:        config.PgBackRestRepoPath,
+		PgBackRestS3Bucket:        config.PgBackRestS3Bucket,
+		PgBackRestS3Endpoint:      config.PgBackRestS3Endpoint,
+		PgBackRestS3Region:        config.PgBackRestS3Region,
+		PgBackRestS3Key:           config.PgBackRestS3Key,
+		PgBackRestS3KeySecret:     redactSecret(config.PgBackRestS3KeySecret),
+		PgBackRestCipherPass:      redactSecret(config.PgBackRestCipherPass),
+		PgBackRestDatabaseName:    config.PgBackRestDatabaseName,
 		PostRestoreSQL:            config.PostRestoreSQL,
+		SeedSQL:                   config.SeedSQL,
+		PostBranchSQL:             config.PostBranchSQL,
+		ReportTrackedTables:       config.ReportTrackedTables,
+		RestoreIncludeTables:      config.RestoreIncludeTables,
+		RestoreExcludeTables:      config.RestoreExcludeTables,
+		RestoreTableSamples:       config.RestoreTableSamples,
+		GitHubWebhookSecret:       redactSecret(config.GitHubWebhookSecret),
+		NotificationWebhookURL:    redactSecret(config.NotificationWebhookURL),
+		SMTPHost:                  config.SMTPHost,
+		SMTPPort:                  config.SMTPPort,
+		SMTPUsername:              config.SMTPUsername,
+		SMTPPassword:              redactSecret(config.SMTPPassword),
+		SMTPFrom:                  config.SMTPFrom,
+		NotifyRestoreHours:        config.NotifyRestoreHours,
+		NotifyDiskFreePercent:     config.NotifyDiskFreePercent,
+		CapacityMinMemoryMB:       config.CapacityMinMemoryMB,
+		CapacityMaxLoadPercent:    config.CapacityMaxLoadPercent,
+		CapacityMinDiskPercent:    config.CapacityMinDiskPercent,
+		OIDCIssuerURL:             config.OIDCIssuerURL,
+		OIDCClientID:              config.OIDCClientID,
+		OIDCClientSecret:          redactSecret(config.OIDCClientSecret),
+		OIDCAdminGroups:           config.OIDCAdminGroups,
+		PurgeKeyColumns:           config.PurgeKeyColumns,
+		Extensions:                config.Extensions,
 	})
 }
 
+// clearPgBackRest removes the pgBackRest repository settings, when switching to another source
+func clearPgBackRest(config *models.Config) {
+	config.PgBackRestStanza = ""
+	config.PgBackRestRepoPath = ""
+	config.PgBackRestS3Bucket = ""
+	config.PgBackRestS3Endpoint = ""
+	config.PgBackRestS3Region = ""
+	config.PgBackRestS3Key = ""
+	config.PgBackRestS3KeySecret = ""
+	config.PgBackRestCipherPass = ""
+	config.PgBackRestDatabaseName = ""
+}
+
 // redactSecret replaces a secret value with *** if it's not empty
 func redactSecret(secret string) string {
 	if secret == "" {
@@ -416,3 +1057,78 @@ func (s *Server) configureCaddy(domain, email string) error {
 		LetsEncryptEmail: email,
 	})
 }
+
+// changedConfigFields returns the names of the user-editable settings that differ
+// Only names are returned since values include credentials (connection string, API key)
+func changedConfigFields(before, after models.Config) []string {
+	fields := []struct {
+		name    string
+		changed bool
+	}{
+		{"connection_string", before.ConnectionString != after.ConnectionString},
+		{"postgres_version", before.PostgresVersion != after.PostgresVersion},
+		{"target_postgres_version", before.TargetPostgresVersion != after.TargetPostgresVersion},
+		{"schema_only", before.SchemaOnly != after.SchemaOnly},
+		{"refresh_schedule", before.RefreshSchedule != after.RefreshSchedule},
+		{"refresh_mode", before.RefreshMode != after.RefreshMode},
+		{"refresh_windows", before.RefreshWindows != after.RefreshWindows},
+		{"domain", before.Domain != after.Domain},
+		{"lets_encrypt_email", before.LetsEncryptEmail != after.LetsEncryptEmail},
+		{"max_restores", before.MaxRestores != after.MaxRestores},
+		{"restore_max_age_days", before.RestoreMaxAgeDays != after.RestoreMaxAgeDays},
+		{"restore_keep_latest", before.RestoreKeepLatest != after.RestoreKeepLatest},
+		{"max_concurrent_restores", before.MaxConcurrentRestores != after.MaxConcurrentRestores},
+		{"restore_queue_policy", before.RestoreQueuePolicy != after.RestoreQueuePolicy},
+		{"restore_deadline_hours", before.RestoreDeadlineHours != after.RestoreDeadlineHours},
+		{"branch_idle_suspend_hours", before.BranchIdleSuspendHours != after.BranchIdleSuspendHours},
+		{"branch_disk_quota_gb", before.BranchDiskQuotaGB != after.BranchDiskQuotaGB},
+		{"branch_allowed_cidrs", before.BranchAllowedCIDRs != after.BranchAllowedCIDRs},
+		{"branch_postgresql_conf", before.BranchPostgresqlConf != after.BranchPostgresqlConf},
+		{"update_checks_disabled", before.UpdateChecksDisabled != after.UpdateChecksDisabled},
+		{"crunchy_bridge_api_key", before.CrunchyBridgeAPIKey != after.CrunchyBridgeAPIKey},
+		{"crunchy_bridge_cluster_name", before.CrunchyBridgeClusterName != after.CrunchyBridgeClusterName},
+		{"crunchy_bridge_database_name", before.CrunchyBridgeDatabaseName != after.CrunchyBridgeDatabaseName},
+		{"pgbackrest_stanza", before.PgBackRestStanza != after.PgBackRestStanza},
+		{"pgbackrest_repo_path", before.PgBackRestRepoPath != after.PgBackRestRepoPath},
+		{"pgbackrest_s3_bucket", before.PgBackRestS3Bucket != after.PgBackRestS3Bucket},
+		{"pgbackrest_s3_endpoint", before.PgBackRestS3Endpoint != after.PgBackRestS3Endpoint},
+		{"pgbackrest_s3_region", before.PgBackRestS3Region != after.PgBackRestS3Region},
+		{"pgbackrest_s3_key", before.PgBackRestS3Key != after.PgBackRestS3Key},
+		{"pgbackrest_s3_key_secret", before.PgBackRestS3KeySecret != after.PgBackRestS3KeySecret},
+		{"pgbackrest_cipher_pass", before.PgBackRestCipherPass != after.PgBackRestCipherPass},
+		{"pgbackrest_database_name", before.PgBackRestDatabaseName != after.PgBackRestDatabaseName},
+		{"post_restore_sql", before.PostRestoreSQL != after.PostRestoreSQL},
+		{"seed_sql", before.SeedSQL != after.SeedSQL},
+		{"post_branch_sql", before.PostBranchSQL != after.PostBranchSQL},
+		{"report_tracked_tables", before.ReportTrackedTables != after.ReportTrackedTables},
+		{"restore_include_tables", before.RestoreIncludeTables != after.RestoreIncludeTables},
+		{"restore_exclude_tables", before.RestoreExcludeTables != after.RestoreExcludeTables},
+		{"restore_table_samples", before.RestoreTableSamples != after.RestoreTableSamples},
+		{"github_webhook_secret", before.GitHubWebhookSecret != after.GitHubWebhookSecret},
+		{"notification_webhook_url", before.NotificationWebhookURL != after.NotificationWebhookURL},
+		{"smtp_host", before.SMTPHost != after.SMTPHost},
+		{"smtp_port", before.SMTPPort != after.SMTPPort},
+		{"smtp_username", before.SMTPUsername != after.SMTPUsername},
+		{"smtp_password", before.SMTPPassword != after.SMTPPassword},
+		{"smtp_from", before.SMTPFrom != after.SMTPFrom},
+		{"notify_restore_hours", before.NotifyRestoreHours != after.NotifyRestoreHours},
+		{"notify_disk_free_percent", before.NotifyDiskFreePercent != after.NotifyDiskFreePercent},
+		{"capacity_min_memory_mb", before.CapacityMinMemoryMB != after.CapacityMinMemoryMB},
+		{"capacity_max_load_percent", before.CapacityMaxLoadPercent != after.CapacityMaxLoadPercent},
+		{"capacity_min_disk_percent", before.CapacityMinDiskPercent != after.CapacityMinDiskPercent},
+		{"oidc_issuer_url", before.OIDCIssuerURL != after.OIDCIssuerURL},
+		{"oidc_client_id", before.OIDCClientID != after.OIDCClientID},
+		{"oidc_client_secret", before.OIDCClientSecret != after.OIDCClientSecret},
+		{"oidc_admin_groups", before.OIDCAdminGroups != after.OIDCAdminGroups},
+		{"purge_key_columns", before.PurgeKeyColumns != after.PurgeKeyColumns},
+		{"extensions", before.Extensions != after.Extensions},
+	}
+
+	var changed []string
+	for _, field := range fields {
+		if field.changed {
+			changed = append(changed, field.name)
+		}
+	}
+	return changed
+}
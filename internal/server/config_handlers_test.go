@@ -0,0 +1,265 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestUpdateConfigRejectsUnsupportedIncrementalRefresh(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  models.Config
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "unknown mode",
+			config:  models.Config{ConnectionString: "postgres://source/app"},
+			body:    `{"refreshMode":"streaming"}`,
+			wantErr: "refresh_mode must be 'full' or 'incremental'",
+		},
+		{
+			name:    "Crunchy Bridge",
+			config:  models.Config{CrunchyBridgeAPIKey: "key", CrunchyBridgeClusterName: "prod"},
+			body:    `{"refreshMode":"incremental"}`,
+			wantErr: "not supported for Crunchy Bridge restores",
+		},
+		{
+			name:    "schema-only",
+			config:  models.Config{ConnectionString: "postgres://source/app", SchemaOnly: true},
+			body:    `{"refreshMode":"incremental"}`,
+			wantErr: "not supported for schema-only restores",
+		},
+		{
+			name:    "switching an incremental config to schema-only",
+			config:  models.Config{ConnectionString: "postgres://source/app", RefreshMode: models.RefreshModeIncremental},
+			body:    `{"schemaOnly":true}`,
+			wantErr: "not supported for schema-only restores",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			if err := s.db.Create(&tt.config).Error; err != nil {
+				t.Fatalf("failed to create config: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/api/config", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			s.updateConfig(c)
+
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantErr) {
+				t.Fatalf("updateConfig() = %d %s, want 400 with %q", w.Code, w.Body.String(), tt.wantErr)
+			}
+
+			var got models.Config
+			s.db.First(&got)
+			if got.RefreshMode != tt.config.RefreshMode || got.SchemaOnly != tt.config.SchemaOnly {
+				t.Errorf("config changed to refresh_mode %q, schema_only %v", got.RefreshMode, got.SchemaOnly)
+			}
+		})
+	}
+}
+
+func TestUpdateConfigRestoreDeadline(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.db.Create(&models.Config{ConnectionString: "postgres://source/app", RestoreDeadlineHours: 12}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/api/config", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		s.updateConfig(c)
+		return w
+	}
+
+	if w := update(`{"restoreDeadlineHours":-1}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "restore_deadline_hours must not be negative") {
+		t.Fatalf("updateConfig() with negative deadline = %d %s, want 400", w.Code, w.Body.String())
+	}
+	var got models.Config
+	s.db.First(&got)
+	if got.RestoreDeadlineHours != 12 {
+		t.Errorf("restore_deadline_hours = %d after rejected update, want 12", got.RestoreDeadlineHours)
+	}
+
+	// 0 disables the deadline
+	if w := update(`{"restoreDeadlineHours":0}`); w.Code != http.StatusOK {
+		t.Fatalf("updateConfig() disabling the deadline = %d %s, want 200", w.Code, w.Body.String())
+	}
+	s.db.First(&got)
+	if got.RestoreDeadlineHours != 0 {
+		t.Errorf("restore_deadline_hours = %d, want 0", got.RestoreDeadlineHours)
+	}
+}
+
+func TestUpdateConfigTargetPostgresVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  models.Config
+		body    string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "upgrade",
+			config: models.Config{ConnectionString: "postgres://source/app", PostgresVersion: "14"},
+			body:   `{"targetPostgresVersion":" 16 "}`,
+			want:   "16",
+		},
+		{
+			name:   "back to the source's version",
+			config: models.Config{ConnectionString: "postgres://source/app", PostgresVersion: "14", TargetPostgresVersion: "16"},
+			body:   `{"targetPostgresVersion":""}`,
+			want:   "",
+		},
+		{
+			name:    "downgrade",
+			config:  models.Config{ConnectionString: "postgres://source/app", PostgresVersion: "16"},
+			body:    `{"targetPostgresVersion":"14"}`,
+			wantErr: "older than the source's",
+		},
+		{
+			name:    "Crunchy Bridge",
+			config:  models.Config{CrunchyBridgeAPIKey: "key", CrunchyBridgeClusterName: "prod", PostgresVersion: "14"},
+			body:    `{"targetPostgresVersion":"16"}`,
+			wantErr: "not supported for Crunchy Bridge",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			if err := s.db.Create(&tt.config).Error; err != nil {
+				t.Fatalf("failed to create config: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/api/config", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			s.updateConfig(c)
+
+			var got models.Config
+			s.db.First(&got)
+			if tt.wantErr != "" {
+				if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantErr) {
+					t.Fatalf("updateConfig() = %d %s, want 400 with %q", w.Code, w.Body.String(), tt.wantErr)
+				}
+				if got.TargetPostgresVersion != tt.config.TargetPostgresVersion {
+					t.Errorf("target_postgres_version changed to %q by a rejected update", got.TargetPostgresVersion)
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("updateConfig() = %d %s, want 200", w.Code, w.Body.String())
+			}
+			if got.TargetPostgresVersion != tt.want {
+				t.Errorf("target_postgres_version = %q, want %q", got.TargetPostgresVersion, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateConfigPgBackRest(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.db.Create(&models.Config{ConnectionString: "postgres://source/app", SchemaOnly: true}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/api/config", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		s.updateConfig(c)
+		return w
+	}
+
+	if w := update(`{"pgBackRestStanza":"main","pgBackRestRepoPath":"relative","pgBackRestDatabaseName":"app"}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid pgBackRest configuration") {
+		t.Fatalf("updateConfig() with a relative repository path = %d %s, want 400", w.Code, w.Body.String())
+	}
+	var got models.Config
+	s.db.First(&got)
+	if got.UsesPgBackRest() || got.ConnectionString == "" {
+		t.Fatalf("rejected update changed the source to stanza %q, connection string %q", got.PgBackRestStanza, got.ConnectionString)
+	}
+
+	// Switching to pgBackRest replaces the logical source, pgBackRest restores are never schema-only
+	if w := update(`{"pgBackRestStanza":"main","pgBackRestRepoPath":"/var/lib/pgbackrest","pgBackRestDatabaseName":"app","pgBackRestCipherPass":"passphrase"}`); w.Code != http.StatusOK {
+		t.Fatalf("updateConfig() switching to pgBackRest = %d %s, want 200", w.Code, w.Body.String())
+	} else if strings.Contains(w.Body.String(), "passphrase") {
+		t.Errorf("response exposes the cipher passphrase: %s", w.Body.String())
+	}
+	s.db.First(&got)
+	if !got.UsesPgBackRest() || got.ConnectionString != "" || got.SchemaOnly {
+		t.Errorf("config = stanza %q, connection string %q, schema_only %v, want only pgBackRest", got.PgBackRestStanza, got.ConnectionString, got.SchemaOnly)
+	}
+
+}
+
+func TestUpdateConfigAdminOnlyFields(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.db.Create(&models.Config{ConnectionString: "postgres://source/app", Domain: "branchd.example.com", BranchAllowedCIDRs: "10.0.0.0/8"}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	update := func(session *auth.SessionData, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/api/config", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("session", session)
+		s.updateConfig(c)
+		return w
+	}
+	user := &auth.SessionData{UserID: "user-1", Email: "carol@example.com"}
+	admin := &auth.SessionData{UserID: "admin-1", Email: "alice@example.com", IsAdmin: true, TwoFactor: true, TwoFactorEnabled: true}
+
+	for _, body := range []string{
+		`{"oidcAdminGroups":"attackers"}`,
+		`{"oidcClientId":"client","oidcClientSecret":"secret"}`,
+		`{"githubWebhookSecret":"attacker-secret"}`,
+		`{"branchAllowedCIDRs":""}`,
+		`{"purgeKeyColumns":"public.users.id"}`,
+	} {
+		if w := update(user, body); w.Code != http.StatusForbidden {
+			t.Errorf("updateConfig(%s) by a user = %d %s, want 403", body, w.Code, w.Body.String())
+		}
+	}
+	var got models.Config
+	s.db.First(&got)
+	if got.OIDCAdminGroups != "" || got.OIDCClientID != "" || got.GitHubWebhookSecret != "" || got.BranchAllowedCIDRs != "10.0.0.0/8" {
+		t.Errorf("SSO settings changed by a user: %+v", got)
+	}
+
+	// Admins without two-factor authentication past their grace period are refused as on admin routes
+	if w := update(&auth.SessionData{UserID: "admin-2", IsAdmin: true}, `{"oidcAdminGroups":"platform"}`); w.Code != http.StatusForbidden {
+		t.Errorf("updateConfig() by an admin without 2FA = %d %s, want 403", w.Code, w.Body.String())
+	}
+
+	if w := update(admin, `{"oidcAdminGroups":"platform"}`); w.Code != http.StatusOK {
+		t.Fatalf("updateConfig() by an admin = %d %s, want 200", w.Code, w.Body.String())
+	}
+	s.db.First(&got)
+	if got.OIDCAdminGroups != "platform" {
+		t.Errorf("oidc_admin_groups = %q, want platform", got.OIDCAdminGroups)
+	}
+
+	// Other settings stay open to users
+	if w := update(user, `{"restoreDeadlineHours":6}`); w.Code != http.StatusOK {
+		t.Errorf("updateConfig() of another setting by a user = %d %s, want 200", w.Code, w.Body.String())
+	}
+}
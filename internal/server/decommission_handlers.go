@@ -0,0 +1,223 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+
+	"github.com/branchd-dev/branchd/internal/decommission"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// decommissionConfirmationTTL is how long a decommission confirmation token stays valid
+const decommissionConfirmationTTL = 10 * time.Minute
+
+// decommissionConfirmation is the pending confirmation token (at most one at a time)
+type decommissionConfirmation struct {
+	mu        sync.Mutex
+	token     string
+	userID    string // Only the admin who requested the token can use it
+	expiresAt time.Time
+}
+
+// DecommissionPreview describes what a decommission deletes
+type DecommissionPreview struct {
+	ConfirmationToken string                     `json:"confirmation_token"`
+	ExpiresAt         time.Time                  `json:"expires_at"`
+	Branches          int                        `json:"branches"`
+	Restores          int                        `json:"restores"`
+	BranchOwners      []decommission.BranchOwner `json:"branch_owners"`
+}
+
+// DecommissionRequest confirms a decommission
+type DecommissionRequest struct {
+	ConfirmationToken string `json:"confirmation_token" binding:"required"`
+}
+
+// DecommissionStatus is the progress of a decommission task
+type DecommissionStatus struct {
+	ID     string               `json:"id"`
+	Status string               `json:"status"`           // "pending", "running", "completed" or "failed"
+	Error  string               `json:"error,omitempty"`  // Why the task failed
+	Result *decommission.Result `json:"result,omitempty"` // Set once completed, steps that failed are listed in its errors
+}
+
+// decommissionResultRetention is how long a finished decommission can be polled
+const decommissionResultRetention = 24 * time.Hour
+
+// @Summary Request decommission confirmation
+// @Description Returns a confirmation token for POST /api/system/decommission and what it would delete (admin only)
+// @Tags system
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} DecommissionPreview
+// @Failure 403 {object} map[string]interface{}
+// @Router /api/system/decommission/confirmation [post]
+func (s *Server) requestDecommissionConfirmation(c *gin.Context) {
+	sessionData, _ := GetSessionData(c)
+
+	var branchList []models.Branch
+	if err := s.db.Find(&branchList).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load branches")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	var restoreCount int64
+	if err := s.db.Model(&models.Restore{}).Count(&restoreCount).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to count restores")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to generate confirmation token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	confirmation := &s.decommission
+	confirmation.mu.Lock()
+	confirmation.token = hex.EncodeToString(tokenBytes)
+	confirmation.userID = sessionData.UserID
+	confirmation.expiresAt = time.Now().Add(decommissionConfirmationTTL)
+	preview := DecommissionPreview{
+		ConfirmationToken: confirmation.token,
+		ExpiresAt:         confirmation.expiresAt,
+		Branches:          len(branchList),
+		Restores:          int(restoreCount),
+		BranchOwners:      decommission.BranchOwners(s.db, branchList),
+	}
+	confirmation.mu.Unlock()
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// @Summary Decommission server
+// @Description Starts deleting all branches and restores, destroying stray datasets, clearing stored credentials, revoking all tokens and deleting local backups (admin only)
+// @Description Requires a token from POST /api/system/decommission/confirmation. Branch owners are notified first (Config.NotificationWebhookURL, email and the server.decommissioned notification channels).
+// @Description Poll GET /api/system/decommission/{id} for the result, which includes a final export of the audit log.
+// @Tags system
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body DecommissionRequest true "Confirmation"
+// @Success 202 {object} DecommissionStatus
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /api/system/decommission [post]
+func (s *Server) decommissionServer(c *gin.Context) {
+	var req DecommissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	sessionData, _ := GetSessionData(c)
+	if !s.consumeDecommissionConfirmation(req.ConfirmationToken, sessionData.UserID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation token, request a new one"})
+		return
+	}
+
+	task, err := tasks.NewDecommissionTask(tasks.DecommissionPayload{
+		UserID:    sessionData.UserID,
+		UserEmail: sessionData.Email,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create decommission task")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// The task ID is the only credential for polling, tokens are revoked during the decommission
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to generate decommission ID")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	info, err := s.taskClient.Enqueue(task,
+		asynq.TaskID(hex.EncodeToString(idBytes)),
+		tasks.Queue(tasks.TypeDecommission, s.config.Worker),
+		asynq.MaxRetry(0),
+		tasks.Timeout(tasks.TypeDecommission, tasks.DecommissionTimeout, s.config.Worker),
+		asynq.Retention(decommissionResultRetention),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to enqueue decommission task")
+		s.respondEnqueueError(c, err, "Failed to start decommission")
+		return
+	}
+
+	s.logger.Warn().Str("user_id", sessionData.UserID).Str("task_id", info.ID).Msg("Decommission started")
+	setAuditResource(c, info.ID)
+	c.JSON(http.StatusAccepted, DecommissionStatus{ID: info.ID, Status: tasks.StatusPending})
+}
+
+// @Summary Get decommission status
+// @Description Reports the progress of a decommission and its result once completed
+// @Description Needs no token (they're revoked during the decommission), the unguessable ID authorizes the request
+// @Tags system
+// @Produce json
+// @Param id path string true "Decommission ID"
+// @Success 200 {object} DecommissionStatus
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/system/decommission/{id} [get]
+func (s *Server) getDecommission(c *gin.Context) {
+	id := c.Param("id")
+
+	info, err := s.taskInspector.GetTaskInfo(tasks.QueueOf(tasks.TypeDecommission, s.config.Worker), id)
+	if err != nil || info.Type != tasks.TypeDecommission {
+		if err != nil && !errors.Is(err, asynq.ErrTaskNotFound) && !errors.Is(err, asynq.ErrQueueNotFound) {
+			s.logger.Error().Err(err).Str("task_id", id).Msg("Failed to load decommission task")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Decommission not found"})
+		return
+	}
+
+	status := DecommissionStatus{ID: info.ID, Status: tasks.StatusOf(info)}
+	switch status.Status {
+	case tasks.StatusFailed:
+		status.Error = info.LastErr
+	case tasks.StatusCompleted:
+		var result decommission.Result
+		if err := json.Unmarshal(info.Result, &result); err != nil {
+			s.logger.Error().Err(err).Str("task_id", id).Msg("Failed to decode decommission result")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		status.Result = &result
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// consumeDecommissionConfirmation checks the pending confirmation token and invalidates it
+func (s *Server) consumeDecommissionConfirmation(token, userID string) bool {
+	confirmation := &s.decommission
+	confirmation.mu.Lock()
+	defer confirmation.mu.Unlock()
+
+	valid := confirmation.token != "" &&
+		subtle.ConstantTimeCompare([]byte(confirmation.token), []byte(token)) == 1 &&
+		confirmation.userID == userID &&
+		time.Now().Before(confirmation.expiresAt)
+	if valid {
+		confirmation.token = ""
+	}
+	return valid
+}
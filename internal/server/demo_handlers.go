@@ -0,0 +1,136 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+)
+
+// demoBranchName is the branch demo mode creates once the sample database is restored and anonymized
+const demoBranchName = "demo"
+
+// Demo source setup, replaced in tests
+var (
+	ensureDemoSource      = restore.EnsureDemoSource
+	latestPostgresVersion = restore.LatestPostgresVersion
+)
+
+// @Summary Start demo mode
+// @Description Restores a bundled sample database from a local cluster instead of a production source (admin only).
+// @Description Sets up the sample source, anonymization rules for its customers and a "demo" branch created once the restore is ready,
+// @Description then triggers the restore like POST /api/restores/trigger-restore. Only available before another source is configured;
+// @Description configuring a real source later ends demo mode (the demo schedule and rules stay until deleted)
+// @Tags config
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Success 202 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/config/demo [post]
+func (s *Server) startDemo(c *gin.Context) {
+	sessionData, exists := GetSessionData(c)
+	if !exists {
+		s.logger.Error().Msg("Session data not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+			return
+		}
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Demo mode never replaces a real source, starting it again only restores the sample database anew
+	if !config.DemoMode && (config.ConnectionString != "" || config.CrunchyBridgeAPIKey != "" || config.UsesPgBackRest()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A restore source is already configured, demo mode is only available before onboarding"})
+		return
+	}
+
+	postgresVersion, password := config.PostgresVersion, restore.DemoPassword(config.ConnectionString)
+	if !config.DemoMode || password == "" {
+		var err error
+		if postgresVersion, err = latestPostgresVersion(); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to determine PostgreSQL version for demo mode")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start demo mode", "details": err.Error()})
+			return
+		}
+		passwordBytes := make([]byte, 16)
+		if _, err := rand.Read(passwordBytes); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to generate demo source password")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start demo mode"})
+			return
+		}
+		password = hex.EncodeToString(passwordBytes)
+	}
+
+	if err := ensureDemoSource(c.Request.Context(), postgresVersion, password, s.logger); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up demo source", "details": err.Error()})
+		return
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// The sample database is small, restore its data rather than the schema-only default
+		if err := tx.Model(&config).Updates(map[string]interface{}{
+			"demo_mode":         true,
+			"connection_string": restore.DemoConnectionString(password),
+			"postgres_version":  postgresVersion,
+			"schema_only":       false,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Rules already set up (e.g. by an earlier start) are kept as they are
+		for _, rule := range restore.DemoAnonRules() {
+			var count int64
+			if err := tx.Model(&models.AnonRule{}).Where("\"table\" = ? AND \"column\" = ?", rule.Table, rule.Column).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				if err := tx.Create(&rule).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// The branch scheduler creates the demo branch from every new restore, see runNewRestoreBranchSchedules
+		var count int64
+		if err := tx.Model(&models.BranchSchedule{}).Where("branch_name = ?", demoBranchName).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return tx.Create(&models.BranchSchedule{
+				BranchName:   demoBranchName,
+				CreatedByID:  sessionData.UserID,
+				Enabled:      true,
+				OnNewRestore: true,
+			}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to configure demo mode")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start demo mode"})
+		return
+	}
+
+	s.logger.Info().
+		Str("postgres_version", postgresVersion).
+		Str("user_id", sessionData.UserID).
+		Msg("Demo mode started")
+
+	s.triggerRestore(c)
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/restores"
+)
+
+// recordingEnqueuer accepts every task and records its type
+type recordingEnqueuer struct {
+	types []string
+}
+
+func (r *recordingEnqueuer) Enqueue(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	r.types = append(r.types, task.Type())
+	return &asynq.TaskInfo{ID: "task-1"}, nil
+}
+
+func (r *recordingEnqueuer) Close() error { return nil }
+
+func TestStartDemo(t *testing.T) {
+	s := newTestServer(t)
+	s.restoresService = restores.NewService(s.db, s.config, s.logger)
+	enqueuer := &recordingEnqueuer{}
+	s.taskClient = enqueuer
+
+	admin := &models.User{Email: "alice@example.com", IsAdmin: true}
+	createTestUser(t, s, admin)
+	config := models.Config{JWTSecret: "secret", SchemaOnly: true}
+	if err := s.db.Create(&config).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	var passwords []string
+	setupErr := error(nil)
+	origEnsure, origVersion := ensureDemoSource, latestPostgresVersion
+	t.Cleanup(func() { ensureDemoSource, latestPostgresVersion = origEnsure, origVersion })
+	ensureDemoSource = func(ctx context.Context, postgresVersion, password string, logger zerolog.Logger) error {
+		passwords = append(passwords, password)
+		return setupErr
+	}
+	latestPostgresVersion = func() (string, error) { return "17", nil }
+
+	start := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/config/demo", nil)
+		c.Set("session", &auth.SessionData{UserID: admin.ID, Email: admin.Email, IsAdmin: true})
+		s.startDemo(c)
+		return w
+	}
+
+	if w := start(); w.Code != http.StatusOK {
+		t.Fatalf("startDemo() status = %d: %s", w.Code, w.Body.String())
+	}
+	var got models.Config
+	s.db.First(&got)
+	if !got.DemoMode || got.PostgresVersion != "17" || got.SchemaOnly || got.ConnectionString != restore.DemoConnectionString(passwords[0]) {
+		t.Errorf("config = demo %v, version %q, schema only %v, connection %q, want the demo source's data",
+			got.DemoMode, got.PostgresVersion, got.SchemaOnly, got.ConnectionString)
+	}
+	var restoreCount, ruleCount, scheduleCount int64
+	s.db.Model(&models.Restore{}).Count(&restoreCount)
+	s.db.Model(&models.AnonRule{}).Count(&ruleCount)
+	s.db.Model(&models.BranchSchedule{}).Where("branch_name = ? AND on_new_restore = ?", demoBranchName, true).Count(&scheduleCount)
+	if restoreCount != 1 || len(enqueuer.types) != 1 {
+		t.Errorf("restores = %d, tasks = %v, want one triggered restore", restoreCount, enqueuer.types)
+	}
+	if ruleCount != int64(len(restore.DemoAnonRules())) || scheduleCount != 1 {
+		t.Errorf("anon rules = %d, demo schedules = %d, want the demo's", ruleCount, scheduleCount)
+	}
+
+	// Starting again keeps the source's password and doesn't duplicate the rules or the schedule
+	// (restore names are unique per second)
+	s.db.Model(&models.Restore{}).Where("1 = 1").Update("name", "restore_20250101000000")
+	if w := start(); w.Code != http.StatusOK {
+		t.Fatalf("startDemo() again status = %d: %s", w.Code, w.Body.String())
+	}
+	s.db.Model(&models.AnonRule{}).Count(&ruleCount)
+	s.db.Model(&models.BranchSchedule{}).Count(&scheduleCount)
+	if len(passwords) != 2 || passwords[1] != passwords[0] || ruleCount != int64(len(restore.DemoAnonRules())) || scheduleCount != 1 {
+		t.Errorf("second start: passwords %v, anon rules %d, schedules %d", passwords, ruleCount, scheduleCount)
+	}
+
+	// A failed setup leaves the config alone
+	setupErr = errors.New("initdb failed")
+	if w := start(); w.Code != http.StatusInternalServerError {
+		t.Errorf("startDemo() with failing setup status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	// A real source ends demo mode, after which the demo can't replace it
+	s.db.Model(&got).Updates(map[string]interface{}{"demo_mode": false, "connection_string": "postgresql://app@db.example.com/app"})
+	setupErr = nil
+	if w := start(); w.Code != http.StatusConflict {
+		t.Errorf("startDemo() with a configured source status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if len(passwords) != 3 {
+		t.Errorf("demo source set up %d times, want no setup with a configured source", len(passwords))
+	}
+}
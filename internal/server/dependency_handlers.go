@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/dependencies"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// @Summary Get restore dependencies
+// @Description Get what depends on a restore: its branches and clones (which block deleting it), the clones' own
+// @Description dependents, schedules pinned to it and break-glass grants, plus the order DELETE with cascade=true removes them in
+// @Tags restores
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Restore ID"
+// @Success 200 {object} dependencies.Graph
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/restores/{id}/dependencies [get]
+func (s *Server) getRestoreDependencies(c *gin.Context) {
+	restoreID := c.Param("id")
+
+	var restore models.Restore
+	if err := s.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to find restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	graph, err := s.dependencies.ForRestore(&restore)
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to load restore dependencies")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load restore dependencies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
+
+// @Summary Get branch dependencies
+// @Description Get what depends on a branch: the schedule recreating it, a running promotion (blocks deleting it) and
+// @Description its break-glass grant, plus the order DELETE with cascade=true handles them in
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 200 {object} dependencies.Graph
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/dependencies [get]
+func (s *Server) getBranchDependencies(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	graph, err := s.dependencies.ForBranch(&branch)
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to load branch dependencies")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load branch dependencies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
+
+// cascadeDelete deletes the root of a graph after everything depending on it
+// The request's cancellation isn't passed on, a client giving up mustn't interrupt a restore or branch deletion halfway
+func (s *Server) cascadeDelete(c *gin.Context, graph *dependencies.Graph) {
+	result, err := s.dependencies.Cascade(context.WithoutCancel(c.Request.Context()), graph)
+	setAuditDetail(c, "cascade", "true")
+	setAuditDetail(c, "cascade_deleted", strconv.Itoa(len(result.Deleted)))
+
+	if errors.Is(err, dependencies.ErrCascadeBlocked) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "dependencies": graph})
+		return
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("root", graph.Root.Name).Msg("Cascading deletion failed")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Cascading deletion failed",
+			"details":  err.Error(),
+			"deleted":  result.Deleted,
+			"disabled": result.Disabled,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Deleted " + graph.Root.Name + " and its dependents",
+		"deleted":  result.Deleted,
+		"disabled": result.Disabled,
+	})
+}
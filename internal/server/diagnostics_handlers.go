@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/diagnostics"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/notify"
+)
+
+// connectionTestTimeout bounds all checks of a connection test, each network check has its own shorter timeout
+const connectionTestTimeout = 30 * time.Second
+
+// TestConnectionRequest is a candidate source connection string
+type TestConnectionRequest struct {
+	ConnectionString string `json:"connectionString" binding:"required"`
+}
+
+// @Summary Test a source connection string
+// @Description Check a candidate source connection string step by step without saving it: parsing, DNS, TCP
+// @Description reachability, TLS handshake, authentication, read privileges on all tables, database size and
+// @Description wal_level. Each check reports pass, warn, fail or skip with a hint on how to fix it
+// @Tags config
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TestConnectionRequest true "Connection string to test"
+// @Success 200 {object} diagnostics.Report
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/diagnostics/test-connection [post]
+func (s *Server) testConnection(c *gin.Context) {
+	var req TestConnectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), connectionTestTimeout)
+	defer cancel()
+
+	report := diagnostics.TestConnection(ctx, req.ConnectionString)
+	if !report.OK {
+		for _, check := range report.Checks {
+			if check.Status == diagnostics.StatusFail {
+				s.logger.Info().
+					Str("check", check.Name).
+					Str("message", check.Message).
+					Msg("Connection test failed")
+				break
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// @Summary Send a test email
+// @Description Email all admins through the configured SMTP server (smtpHost), to check notifications reach them
+// @Tags config
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 502 {object} map[string]interface{}
+// @Router /api/config/test-email [post]
+func (s *Server) testEmail(c *gin.Context) {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	notification := notify.Notification{
+		Event:   notify.EventTest,
+		Subject: "Test notification",
+		Body:    "Notifications of failed scheduled refreshes, slow restores and low disk space reach you.\n",
+	}
+	err := notify.NewService(s.db, s.config, s.logger).Send(c.Request.Context(), &config, notification)
+	if errors.Is(err, notify.ErrNotConfigured) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No SMTP server configured, set smtpHost first"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send test email", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Test email sent"})
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/diagnostics"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestTestConnection(t *testing.T) {
+	s := newTestServer(t)
+
+	request := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/diagnostics/test-connection", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		s.testConnection(c)
+		return w
+	}
+
+	if w := request(`{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("without connection string: status = %d, want 400", w.Code)
+	}
+
+	// A failing connection is a successful test
+	w := request(`{"connectionString":"postgres://app@db/shop?sslmode=prefer"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var report diagnostics.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if report.OK || len(report.Checks) == 0 || report.Checks[0].Name != diagnostics.CheckParse || report.Checks[0].Status != diagnostics.StatusFail {
+		t.Errorf("report = %+v, want the parse check failing", report)
+	}
+}
+
+func TestTestEmailNotConfigured(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.db.Create(&models.Config{JWTSecret: "secret"}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/config/test-email", nil)
+	s.testEmail(c)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "smtpHost") {
+		t.Errorf("status = %d (%s), want 400 asking for smtpHost", w.Code, w.Body.String())
+	}
+}
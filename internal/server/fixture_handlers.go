@@ -0,0 +1,348 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/fixtures"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// CreateFixtureRequest represents a request to create a fixture
+type CreateFixtureRequest struct {
+	Name        string                `json:"name" binding:"required"`
+	Description string                `json:"description"`
+	Seed        int64                 `json:"seed"`
+	Tables      []models.FixtureTable `json:"tables" binding:"required"`
+}
+
+// UpdateFixtureRequest updates the given fixture fields
+type UpdateFixtureRequest struct {
+	Name        *string                `json:"name"`
+	Description *string                `json:"description"`
+	Seed        *int64                 `json:"seed"`
+	Tables      *[]models.FixtureTable `json:"tables"`
+}
+
+// ApplyFixtureRequest applies a stored fixture, or an inline definition
+type ApplyFixtureRequest struct {
+	FixtureID string                `json:"fixture_id"`
+	Seed      int64                 `json:"seed"`   // Inline definition only
+	Tables    []models.FixtureTable `json:"tables"` // Inline definition, used when fixture_id is empty
+}
+
+// FixtureStatus is the progress of a fixture applied to a branch
+type FixtureStatus struct {
+	ID     string                `json:"id"`
+	Status string                `json:"status"`           // "pending", "running", "completed" or "failed"
+	Error  string                `json:"error,omitempty"`  // Why the fixture failed, e.g. a constraint violation
+	Result *fixtures.ApplyResult `json:"result,omitempty"` // Set once completed
+}
+
+// @Summary List fixtures
+// @Description List the fixture definitions that can be applied to branches
+// @Tags fixtures
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Fixture
+// @Router /api/fixtures [get]
+func (s *Server) listFixtures(c *gin.Context) {
+	var list []models.Fixture
+	if err := s.db.Order("name ASC").Find(&list).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list fixtures")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Create fixture
+// @Description Create a fixture definition: tables, row counts and value generators (admin only)
+// @Tags fixtures
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateFixtureRequest true "Create fixture request"
+// @Success 201 {object} models.Fixture
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/fixtures [post]
+func (s *Server) createFixture(c *gin.Context) {
+	var req CreateFixtureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fixture := models.Fixture{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Seed:        req.Seed,
+		Tables:      req.Tables,
+	}
+	if !s.validateFixture(c, &fixture) {
+		return
+	}
+
+	if err := s.db.Create(&fixture).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create fixture")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create fixture"})
+		return
+	}
+
+	setAuditResource(c, fixture.ID)
+	setAuditDetail(c, "name", fixture.Name)
+
+	c.JSON(http.StatusCreated, fixture)
+}
+
+// @Summary Update fixture
+// @Description Update a fixture definition (admin only)
+// @Tags fixtures
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Fixture ID"
+// @Param request body UpdateFixtureRequest true "Update fixture request"
+// @Success 200 {object} models.Fixture
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/fixtures/{id} [patch]
+func (s *Server) updateFixture(c *gin.Context) {
+	fixture, ok := s.findFixture(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req UpdateFixtureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		fixture.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		fixture.Description = *req.Description
+	}
+	if req.Seed != nil {
+		fixture.Seed = *req.Seed
+	}
+	if req.Tables != nil {
+		fixture.Tables = *req.Tables
+	}
+	if !s.validateFixture(c, fixture) {
+		return
+	}
+
+	if err := s.db.Save(fixture).Error; err != nil {
+		s.logger.Error().Err(err).Str("fixture_id", fixture.ID).Msg("Failed to update fixture")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update fixture"})
+		return
+	}
+
+	setAuditDetail(c, "name", fixture.Name)
+
+	c.JSON(http.StatusOK, fixture)
+}
+
+// @Summary Delete fixture
+// @Description Delete a fixture definition, data it generated in branches is kept (admin only)
+// @Tags fixtures
+// @Security BearerAuth
+// @Param id path string true "Fixture ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/fixtures/{id} [delete]
+func (s *Server) deleteFixture(c *gin.Context) {
+	fixture, ok := s.findFixture(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := s.db.Delete(fixture).Error; err != nil {
+		s.logger.Error().Err(err).Str("fixture_id", fixture.ID).Msg("Failed to delete fixture")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete fixture"})
+		return
+	}
+
+	setAuditDetail(c, "name", fixture.Name)
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Apply fixture to branch
+// @Description Generate a fixture's synthetic rows in a branch, e.g. to fill a schema-only branch
+// @Description Pass fixture_id for a stored fixture, or seed and tables for an inline definition
+// @Description The rows are generated in the background, poll GET /api/branches/{id}/fixtures/{task_id} for the result
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param request body ApplyFixtureRequest true "Fixture to apply"
+// @Success 202 {object} FixtureStatus
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/fixtures [post]
+func (s *Server) applyBranchFixture(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var req ApplyFixtureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if branch.SuspendedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Branch is suspended, resume it first"})
+		return
+	}
+
+	fixture := &models.Fixture{Name: "inline", Seed: req.Seed, Tables: req.Tables}
+	if req.FixtureID != "" {
+		var ok bool
+		if fixture, ok = s.findFixture(c, req.FixtureID); !ok {
+			return
+		}
+	} else if err := fixtures.Validate(fixture.Tables); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	task, err := tasks.NewApplyFixtureTask(tasks.ApplyFixturePayload{BranchID: branch.ID, Fixture: *fixture})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create fixture task")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	info, err := s.taskClient.Enqueue(task, tasks.Timeout(tasks.TypeApplyFixture, tasks.ApplyFixtureTimeout, s.config.Worker), asynq.MaxRetry(0), tasks.Retention(tasks.TypeApplyFixture, s.config.Redis), tasks.Queue(tasks.TypeApplyFixture, s.config.Worker))
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to enqueue fixture task")
+		s.respondEnqueueError(c, err, "Failed to start fixture")
+		return
+	}
+
+	setAuditDetail(c, "name", branch.Name)
+	setAuditDetail(c, "fixture", fixture.Name)
+	setAuditDetail(c, "task_id", info.ID)
+
+	c.JSON(http.StatusAccepted, FixtureStatus{ID: info.ID, Status: tasks.StatusPending})
+}
+
+// @Summary Get fixture status
+// @Description Reports the progress of a fixture applied to a branch and the rows it inserted once completed
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param task_id path string true "ID returned when the fixture was applied"
+// @Success 200 {object} FixtureStatus
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/fixtures/{task_id} [get]
+func (s *Server) getBranchFixture(c *gin.Context) {
+	branchID := c.Param("id")
+	taskID := c.Param("task_id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	info, err := s.taskInspector.GetTaskInfo(tasks.QueueOf(tasks.TypeApplyFixture, s.config.Worker), taskID)
+	if err != nil {
+		if !errors.Is(err, asynq.ErrTaskNotFound) && !errors.Is(err, asynq.ErrQueueNotFound) {
+			s.logger.Error().Err(err).Str("task_id", taskID).Msg("Failed to load fixture task")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fixture task not found"})
+		return
+	}
+	// Tasks of other branches (or other types) aren't reported here
+	task := asynq.NewTask(info.Type, info.Payload)
+	payload, err := tasks.ParseApplyFixturePayload(task)
+	if info.Type != tasks.TypeApplyFixture || err != nil || payload.BranchID != branch.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fixture task not found"})
+		return
+	}
+
+	status := FixtureStatus{ID: info.ID, Status: tasks.StatusOf(info)}
+	switch status.Status {
+	case tasks.StatusFailed:
+		status.Error = info.LastErr
+	case tasks.StatusCompleted:
+		var result fixtures.ApplyResult
+		if err := json.Unmarshal(info.Result, &result); err != nil {
+			s.logger.Error().Err(err).Str("task_id", taskID).Msg("Failed to decode fixture result")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		status.Result = &result
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// findFixture loads a fixture by ID, writing the error response if it can't
+func (s *Server) findFixture(c *gin.Context, fixtureID string) (*models.Fixture, bool) {
+	var fixture models.Fixture
+	if err := s.db.Where("id = ?", fixtureID).First(&fixture).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Fixture not found"})
+			return nil, false
+		}
+		s.logger.Error().Err(err).Str("fixture_id", fixtureID).Msg("Failed to find fixture")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	return &fixture, true
+}
+
+// validateFixture checks a fixture before it's saved, writing the error response if it's invalid
+func (s *Server) validateFixture(c *gin.Context, fixture *models.Fixture) bool {
+	if fixture.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return false
+	}
+	if err := fixtures.Validate(fixture.Tables); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	var count int64
+	if err := s.db.Model(&models.Fixture{}).Where("name = ? AND id != ?", fixture.Name, fixture.ID).Count(&count).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to check fixture name")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Fixture " + fixture.Name + " already exists"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/fleet"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+)
+
+// fleetHostHeader names the fleet host a branch was created on
+const fleetHostHeader = "X-Branchd-Fleet-Host"
+
+// CreateFleetAgentRequest represents a request to register an agent server
+type CreateFleetAgentRequest struct {
+	Name     string `json:"name" binding:"required"`
+	URL      string `json:"url" binding:"required"`   // API base URL of the agent, e.g. https://db2.example.com
+	Token    string `json:"token" binding:"required"` // API token of an admin of the agent
+	Insecure bool   `json:"insecure"`                 // Skip TLS verification (agents without a domain)
+}
+
+// @Summary Get fleet
+// @Description Hosts, branches and restores of this server and its registered agents (control-plane mode, FLEET_ENABLED)
+// @Description Unreachable agents are listed with their error and without branches or restores
+// @Tags fleet
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} fleet.View
+// @Router /api/fleet [get]
+func (s *Server) getFleet(c *gin.Context) {
+	view, err := fleet.NewService(s.db, s.config, s.logger).View(c.Request.Context())
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to get fleet")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get fleet"})
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// @Summary List fleet agents
+// @Description List the agent servers registered with this control plane, without their tokens (admin only)
+// @Tags fleet
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.FleetAgent
+// @Router /api/fleet/agents [get]
+func (s *Server) listFleetAgents(c *gin.Context) {
+	var list []models.FleetAgent
+	if err := s.db.Order("name ASC").Find(&list).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list fleet agents")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Register fleet agent
+// @Description Register a branchd server as an agent of this control plane, checking its URL and token first (admin only)
+// @Tags fleet
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateFleetAgentRequest true "Register fleet agent request"
+// @Success 201 {object} models.FleetAgent
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 502 {object} map[string]interface{}
+// @Router /api/fleet/agents [post]
+func (s *Server) createFleetAgent(c *gin.Context) {
+	var req CreateFleetAgentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	agent := models.FleetAgent{
+		Name:     strings.TrimSpace(req.Name),
+		URL:      strings.TrimRight(strings.TrimSpace(req.URL), "/"),
+		Insecure: req.Insecure,
+	}
+	if !s.validateFleetAgent(c, &agent) {
+		return
+	}
+
+	// Admin tokens of agents aren't stored in the clear
+	fleetService := fleet.NewService(s.db, s.config, s.logger)
+	token, err := fleet.SealToken(s.config.Fleet.TokenKey, agent.Name, strings.TrimSpace(req.Token))
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to seal fleet agent token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create fleet agent", "details": err.Error()})
+		return
+	}
+	agent.Token = token
+
+	// An agent that can't be queried would only show up as unreachable
+	client, err := fleetService.Client(&agent)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to open fleet agent token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create fleet agent", "details": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.config.Fleet.Timeout)
+	defer cancel()
+	if _, err := client.SystemInfo(ctx); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to reach fleet agent", "details": err.Error()})
+		return
+	}
+
+	if err := s.db.Create(&agent).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create fleet agent")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create fleet agent"})
+		return
+	}
+	fleetService.RecordOutcome(&agent, nil)
+
+	setAuditResource(c, agent.ID)
+	setAuditDetail(c, "name", agent.Name)
+	setAuditDetail(c, "url", agent.URL)
+
+	c.JSON(http.StatusCreated, agent)
+}
+
+// @Summary Delete fleet agent
+// @Description Unregister an agent server, its branches and restores are left as they are (admin only)
+// @Tags fleet
+// @Security BearerAuth
+// @Param id path string true "Fleet agent ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/fleet/agents/{id} [delete]
+func (s *Server) deleteFleetAgent(c *gin.Context) {
+	agentID := c.Param("id")
+	var agent models.FleetAgent
+	if err := s.db.Where("id = ?", agentID).First(&agent).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Fleet agent not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("agent_id", agentID).Msg("Failed to find fleet agent")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := s.db.Delete(&agent).Error; err != nil {
+		s.logger.Error().Err(err).Str("agent_id", agent.ID).Msg("Failed to delete fleet agent")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete fleet agent"})
+		return
+	}
+
+	setAuditDetail(c, "name", agent.Name)
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Create fleet branch
+// @Description Create a branch on the least-loaded fleet host: the reachable host with a ready restore, capacity for another branch and the fewest branches,
+// @Description the one with the most free disk space among equals. Takes and returns the same as POST /api/branches,
+// @Description the host is named in the X-Branchd-Fleet-Host header. Branches on agents are created as the admin the agent's token belongs to,
+// @Description so only admins (with two-factor authentication) may create them there: other users' branches are placed on the local server
+// @Description and naming an agent host is forbidden
+// @Tags fleet
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body CreateBranchRequest true "Branch creation request"
+// @Param host query string false "Create the branch on this host instead ('local' or an agent name)"
+// @Param snippets query string false "Comma-separated snippet formats (psql, rails, prisma, django, jdbc) or 'all' (default: all)"
+// @Success 201 {object} CreateBranchResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 502 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /api/fleet/branches [post]
+func (s *Server) createFleetBranch(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	fleetService := fleet.NewService(s.db, s.config, s.logger)
+	view, err := fleetService.View(c.Request.Context())
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to get fleet")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get fleet"})
+		return
+	}
+
+	host, ok := s.fleetBranchHost(c, view)
+	if !ok {
+		return
+	}
+	c.Header(fleetHostHeader, host.Name)
+	setAuditDetail(c, "host", host.Name)
+
+	if host.Name == fleet.LocalHost {
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		s.createBranch(c)
+		return
+	}
+
+	var req branchd.CreateBranchRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if snippets := c.Query("snippets"); snippets != "" {
+		req.Snippets = strings.Split(snippets, ",")
+	}
+
+	var agent models.FleetAgent
+	if err := s.db.Where("name = ?", host.Name).First(&agent).Error; err != nil {
+		s.logger.Error().Err(err).Str("agent", host.Name).Msg("Failed to find fleet agent")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	client, err := fleetService.Client(&agent)
+	if err != nil {
+		s.logger.Error().Err(err).Str("agent", agent.Name).Msg("Failed to open fleet agent token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create branch on " + agent.Name, "details": err.Error()})
+		return
+	}
+
+	// Branch creation waits for the branch's PostgreSQL, it's only bounded by the request
+	branch, err := client.CreateBranch(c.Request.Context(), req)
+	fleetService.RecordOutcome(&agent, err)
+	if err != nil {
+		var apiErr *branchd.APIError
+		if errors.As(err, &apiErr) && apiErr.Code == errorCodeCapacityExceeded {
+			// Filled up since the fleet was queried
+			respondCapacityExceeded(c, fmt.Errorf("%s: %s", agent.Name, apiErr.Message))
+			return
+		}
+		if errors.As(err, &apiErr) && apiErr.StatusCode < http.StatusInternalServerError {
+			// The agent's own validation errors are the caller's
+			c.JSON(apiErr.StatusCode, gin.H{"error": apiErr.Message, "details": apiErr.Details})
+			return
+		}
+		s.logger.Error().Err(err).Str("agent", agent.Name).Msg("Failed to create branch on fleet agent")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to create branch on " + agent.Name, "details": err.Error()})
+		return
+	}
+
+	setAuditResource(c, branch.ID)
+	setAuditDetail(c, "name", branch.Name)
+
+	c.JSON(http.StatusCreated, branch)
+}
+
+// fleetBranchHost picks the host of a new branch, the ?host= one or the least-loaded one
+// Writes the error response if there's none
+func (s *Server) fleetBranchHost(c *gin.Context, view *fleet.View) (*fleet.Host, bool) {
+	name := c.Query("host")
+	if name == "" {
+		// The local server comes first in the view
+		if sessionData, exists := GetSessionData(c); !exists || !sessionData.IsAdmin {
+			view = &fleet.View{Hosts: view.Hosts[:1]}
+		}
+		host, err := fleet.Place(view)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No fleet host can create branches", "details": err.Error()})
+			return nil, false
+		}
+		if host.Name != fleet.LocalHost && !s.requireAgentAdmin(c) {
+			return nil, false
+		}
+		return host, true
+	}
+
+	for i := range view.Hosts {
+		host := &view.Hosts[i]
+		if host.Name != name {
+			continue
+		}
+		if name != fleet.LocalHost && !s.requireAgentAdmin(c) {
+			return nil, false
+		}
+		if !host.Reachable {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Fleet host " + name + " is unreachable", "details": host.Error})
+			return nil, false
+		}
+		return host, true
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Fleet host " + name + " not found"})
+	return nil, false
+}
+
+// requireAgentAdmin checks that the requester may create branches on agents, writing the error response if not
+// They're created as the admin the agent's token belongs to, so only admins may, with two-factor authentication
+func (s *Server) requireAgentAdmin(c *gin.Context) bool {
+	sessionData, exists := GetSessionData(c)
+	if !exists || !sessionData.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Admin access required",
+			"details": "branches on fleet agents are created as the agent's admin, only admins may create them (use ?host=" + fleet.LocalHost + ")",
+		})
+		c.Abort()
+		return false
+	}
+	return checkTwoFactor(c, s.db, s.logger, s.config.Auth.TwoFactorGracePeriod)
+}
+
+// validateFleetAgent checks an agent before it's registered, writing the error response if it's invalid
+func (s *Server) validateFleetAgent(c *gin.Context, agent *models.FleetAgent) bool {
+	if agent.Name == "" || agent.Name == fleet.LocalHost {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required and can't be " + fleet.LocalHost})
+		return false
+	}
+	if parsed, err := url.Parse(agent.URL); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an http(s) URL"})
+		return false
+	}
+
+	var count int64
+	if err := s.db.Model(&models.FleetAgent{}).Where("name = ? AND id != ?", agent.Name, agent.ID).Count(&count).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to check fleet agent name")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Fleet agent " + agent.Name + " already exists"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/fleet"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/pkg/branchd"
+)
+
+// testFleetTokenKey seals the agent tokens of the tests (FLEET_TOKEN_KEY)
+const testFleetTokenKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+// newTestFleetAgent is an agent with one ready restore and no branches, recording the branch creation it's sent
+func newTestFleetAgent(t *testing.T, created *string) *httptest.Server {
+	t.Helper()
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body any
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/branches":
+			body = []branchd.Branch{}
+		case "GET /api/restores":
+			body = []branchd.Restore{{ID: "r1", Name: "restore_1", State: models.RestoreStateReady}}
+		case "GET /api/system/info":
+			body = branchd.SystemInfo{}
+		case "POST /api/branches":
+			request, _ := io.ReadAll(r.Body)
+			*created = string(request) + "?" + r.URL.RawQuery
+			w.WriteHeader(http.StatusCreated)
+			body = branchd.CreateBranchResponse{ID: "b1", Name: "feature-x", Host: "db2.example.com", Port: 15432}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(agent.Close)
+	return agent
+}
+
+func TestCreateFleetBranchOnAgent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+	s.config.Fleet = config.FleetConfig{Timeout: 5 * time.Second, TokenKey: testFleetTokenKey}
+
+	var created string
+	agent := newTestFleetAgent(t, &created)
+	token, err := fleet.SealToken(testFleetTokenKey, "db2", "token")
+	if err != nil {
+		t.Fatalf("SealToken() error = %v", err)
+	}
+	if err := s.db.Create(&models.FleetAgent{Name: "db2", URL: agent.URL, Token: token}).Error; err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	admin := &auth.SessionData{UserID: "user-1", Email: "admin@example.com", IsAdmin: true, TwoFactor: true}
+	user := &auth.SessionData{UserID: "user-2", Email: "carol@example.com"}
+
+	// The local server has no ready restore, the branch goes to db2
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/fleet/branches?snippets=psql", strings.NewReader(`{"name":"feature-x"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("session", admin)
+	s.createFleetBranch(c)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("createFleetBranch() status = %d, want 201: %s", w.Code, w.Body.String())
+	}
+	if host := w.Header().Get(fleetHostHeader); host != "db2" {
+		t.Errorf("%s = %q, want db2", fleetHostHeader, host)
+	}
+	if created != `{"name":"feature-x"}?snippets=psql` {
+		t.Errorf("agent got %q, want the request forwarded", created)
+	}
+	var branch branchd.CreateBranchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &branch); err != nil || branch.Host != "db2.example.com" {
+		t.Errorf("response = %s, want the agent's branch", w.Body.String())
+	}
+
+	// Unknown hosts aren't guessed
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/fleet/branches?host=db9", strings.NewReader(`{"name":"feature-y"}`))
+	c.Set("session", admin)
+	s.createFleetBranch(c)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("createFleetBranch(host=db9) status = %d, want 404", w.Code)
+	}
+
+	// Branches on agents are created as the agent's admin, other users' are only placed locally
+	created = ""
+	for query, want := range map[string]int{"": http.StatusServiceUnavailable, "?host=db2": http.StatusForbidden} {
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/fleet/branches"+query, strings.NewReader(`{"name":"feature-z"}`))
+		c.Set("session", user)
+		s.createFleetBranch(c)
+		if w.Code != want {
+			t.Errorf("createFleetBranch(%q) as a user status = %d, want %d", query, w.Code, want)
+		}
+	}
+	if created != "" {
+		t.Errorf("agent got %q, want no branch created for the user", created)
+	}
+}
+
+func TestCreateFleetAgentValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+	s.config.Fleet = config.FleetConfig{Timeout: 5 * time.Second, TokenKey: testFleetTokenKey}
+
+	var created string
+	agent := newTestFleetAgent(t, &created)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "registered", body: `{"name":"db2","url":"` + agent.URL + `/","token":"token"}`, want: http.StatusCreated},
+		{name: "duplicate name", body: `{"name":"db2","url":"` + agent.URL + `","token":"token"}`, want: http.StatusConflict},
+		{name: "reserved name", body: `{"name":"local","url":"` + agent.URL + `","token":"token"}`, want: http.StatusBadRequest},
+		{name: "invalid URL", body: `{"name":"db3","url":"db3.example.com","token":"token"}`, want: http.StatusBadRequest},
+		{name: "wrong token", body: `{"name":"db3","url":"` + agent.URL + `","token":"other"}`, want: http.StatusBadGateway},
+		{name: "unreachable", body: `{"name":"db3","url":"http://127.0.0.1:1","token":"token"}`, want: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/fleet/agents", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			s.createFleetAgent(c)
+
+			if w.Code != tt.want {
+				t.Fatalf("createFleetAgent() status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	var stored models.FleetAgent
+	if err := s.db.Where("name = ?", "db2").First(&stored).Error; err != nil {
+		t.Fatalf("failed to load agent: %v", err)
+	}
+	if stored.URL != agent.URL || stored.LastSeenAt == nil {
+		t.Errorf("agent = %+v, want its URL without the trailing slash and seen", stored)
+	}
+	if token, err := fleet.OpenToken(testFleetTokenKey, "db2", stored.Token); err != nil || stored.Token == "token" || token != "token" {
+		t.Errorf("stored token = %q, want the token sealed", stored.Token)
+	}
+}
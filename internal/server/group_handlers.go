@@ -0,0 +1,337 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// GroupDetail is a group with its members
+type GroupDetail struct {
+	models.Group
+	Members []GroupMemberDetail `json:"members"`
+}
+
+// GroupMemberDetail identifies a group member
+type GroupMemberDetail struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// CreateGroupRequest represents a request to create a group
+type CreateGroupRequest struct {
+	Name               string                      `json:"name" binding:"required"`
+	Description        string                      `json:"description"`
+	ResourceLimits     models.BranchResourceLimits `json:"resource_limits"`
+	MaxBranchesPerUser int                         `json:"max_branches_per_user"`
+	AllowedSources     []string                    `json:"allowed_sources"`
+	OIDCGroup          string                      `json:"oidc_group"` // SSO users in this IdP group become members on login
+}
+
+// UpdateGroupRequest updates the given group fields
+type UpdateGroupRequest struct {
+	Name               *string                      `json:"name"`
+	Description        *string                      `json:"description"`
+	ResourceLimits     *models.BranchResourceLimits `json:"resource_limits"`
+	MaxBranchesPerUser *int                         `json:"max_branches_per_user"`
+	AllowedSources     *[]string                    `json:"allowed_sources"`
+	OIDCGroup          *string                      `json:"oidc_group"` // Empty stops syncing members from SSO logins
+}
+
+// SetGroupMembersRequest replaces the members of a group
+type SetGroupMembersRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// @Summary List groups
+// @Description List all groups with their members (admin only)
+// @Tags groups
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} GroupDetail
+// @Router /api/groups [get]
+func (s *Server) listGroups(c *gin.Context) {
+	var groups []models.Group
+	if err := s.db.Order("name ASC").Find(&groups).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list groups")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var members []models.GroupMember
+	if err := s.db.Preload("User").Find(&members).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list group members")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	membersByGroup := make(map[string][]GroupMemberDetail)
+	for _, member := range members {
+		membersByGroup[member.GroupID] = append(membersByGroup[member.GroupID], GroupMemberDetail{
+			UserID: member.UserID,
+			Email:  member.User.Email,
+		})
+	}
+
+	details := make([]GroupDetail, len(groups))
+	for i, group := range groups {
+		details[i] = GroupDetail{Group: group, Members: membersByGroup[group.ID]}
+		if details[i].Members == nil {
+			details[i].Members = []GroupMemberDetail{}
+		}
+	}
+
+	c.JSON(http.StatusOK, details)
+}
+
+// @Summary Create group
+// @Description Create a group with a branch profile, quota and allowed sources (admin only)
+// @Description With oidc_group set, SSO users are added to or removed from the group on every login by their groups claim
+// @Tags groups
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateGroupRequest true "Create group request"
+// @Success 201 {object} models.Group
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/groups [post]
+func (s *Server) createGroup(c *gin.Context) {
+	var req CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group := models.Group{
+		Name:               strings.TrimSpace(req.Name),
+		Description:        req.Description,
+		ResourceLimits:     req.ResourceLimits,
+		MaxBranchesPerUser: req.MaxBranchesPerUser,
+		AllowedSources:     req.AllowedSources,
+		OIDCGroup:          strings.TrimSpace(req.OIDCGroup),
+	}
+	if err := s.validateGroup(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.Create(&group).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+
+	setAuditResource(c, group.ID)
+	setAuditDetail(c, "name", group.Name)
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// @Summary Update group
+// @Description Update a group's profile, quota or allowed sources (admin only)
+// @Tags groups
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Group ID"
+// @Param request body UpdateGroupRequest true "Update group request"
+// @Success 200 {object} models.Group
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/groups/{id} [patch]
+func (s *Server) updateGroup(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		group.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		group.Description = *req.Description
+	}
+	if req.ResourceLimits != nil {
+		group.ResourceLimits = *req.ResourceLimits
+	}
+	if req.MaxBranchesPerUser != nil {
+		group.MaxBranchesPerUser = *req.MaxBranchesPerUser
+	}
+	if req.AllowedSources != nil {
+		group.AllowedSources = *req.AllowedSources
+	}
+	if req.OIDCGroup != nil {
+		group.OIDCGroup = strings.TrimSpace(*req.OIDCGroup)
+	}
+	if err := s.validateGroup(group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.Save(group).Error; err != nil {
+		s.logger.Error().Err(err).Str("group_id", group.ID).Msg("Failed to update group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+
+	setAuditDetail(c, "name", group.Name)
+
+	c.JSON(http.StatusOK, group)
+}
+
+// @Summary Delete group
+// @Description Delete a group, its members lose the group's profile and quota (admin only)
+// @Tags groups
+// @Security BearerAuth
+// @Param id path string true "Group ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/groups/{id} [delete]
+func (s *Server) deleteGroup(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+
+	// Memberships are removed by the foreign key cascade
+	if err := s.db.Delete(group).Error; err != nil {
+		s.logger.Error().Err(err).Str("group_id", group.ID).Msg("Failed to delete group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+
+	setAuditDetail(c, "name", group.Name)
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Set group members
+// @Description Replace the members of a group (admin only)
+// @Description Members of groups with an oidc_group are also added or removed on each SSO login
+// @Tags groups
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Group ID"
+// @Param request body SetGroupMembersRequest true "Group members"
+// @Success 200 {array} GroupMemberDetail
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/groups/{id}/members [put]
+func (s *Server) setGroupMembers(c *gin.Context) {
+	group, ok := s.findGroup(c)
+	if !ok {
+		return
+	}
+
+	var req SetGroupMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var users []models.User
+	if len(req.UserIDs) > 0 {
+		if err := s.db.Where("id IN ?", req.UserIDs).Order("email ASC").Find(&users).Error; err != nil {
+			s.logger.Error().Err(err).Msg("Failed to load users")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+	}
+	found := make(map[string]bool, len(users))
+	for _, user := range users {
+		found[user.ID] = true
+	}
+	for _, userID := range req.UserIDs {
+		if !found[userID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("User %s not found", userID)})
+			return
+		}
+	}
+
+	members := make([]GroupMemberDetail, len(users))
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		for i, user := range users {
+			if err := tx.Create(&models.GroupMember{GroupID: group.ID, UserID: user.ID}).Error; err != nil {
+				return err
+			}
+			members[i] = GroupMemberDetail{UserID: user.ID, Email: user.Email}
+		}
+		return nil
+	}); err != nil {
+		s.logger.Error().Err(err).Str("group_id", group.ID).Msg("Failed to set group members")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set group members"})
+		return
+	}
+
+	setAuditDetail(c, "name", group.Name)
+	setAuditDetail(c, "members", strconv.Itoa(len(members)))
+
+	c.JSON(http.StatusOK, members)
+}
+
+// findGroup loads the group of the :id param, writing the error response if it can't
+func (s *Server) findGroup(c *gin.Context) (*models.Group, bool) {
+	groupID := c.Param("id")
+
+	var group models.Group
+	if err := s.db.Where("id = ?", groupID).First(&group).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return nil, false
+		}
+		s.logger.Error().Err(err).Str("group_id", groupID).Msg("Failed to find group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	return &group, true
+}
+
+// validateGroup checks a group before it's saved
+func (s *Server) validateGroup(group *models.Group) error {
+	if group.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	var count int64
+	if err := s.db.Model(&models.Group{}).Where("name = ? AND id != ?", group.Name, group.ID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check group name: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("group %s already exists", group.Name)
+	}
+
+	if err := branches.ValidateResourceLimits(group.ResourceLimits); err != nil {
+		return fmt.Errorf("invalid resource_limits: %w", err)
+	}
+	if group.MaxBranchesPerUser < 0 {
+		return fmt.Errorf("max_branches_per_user must be 0 (unlimited) or more")
+	}
+
+	for _, source := range group.AllowedSources {
+		if source == models.GroupSourceLatest {
+			continue
+		}
+		var restore models.Restore
+		if err := s.db.Where("id = ?", source).First(&restore).Error; err != nil {
+			return fmt.Errorf("allowed source %s is neither %q nor a restore ID", source, models.GroupSourceLatest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// maxWebhookPayloadBytes is the largest payload GitHub delivers (25 MB), enforced by bodyLimitMiddleware
+const maxWebhookPayloadBytes = 25 << 20
+
+// GitHubPullRequestEvent is the part of a pull_request webhook payload the integration uses
+type GitHubPullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Title string `json:"title"`
+	} `json:"pull_request"`
+	Repository struct {
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// @Summary GitHub webhook
+// @Description Creates a branch when a pull request is opened or reopened and deletes it when the pull request is closed
+// @Description Deliveries are authenticated with the X-Hub-Signature-256 header (github_webhook_secret), no token is required
+// @Description Branches are named <repository>-pr-<number> and owned by the admin who set the secret, closing a pull
+// @Description request only deletes the branch created for it
+// @Tags integrations
+// @Accept json
+// @Produce json
+// @Param X-GitHub-Event header string true "Event type (ping or pull_request)"
+// @Param X-Hub-Signature-256 header string true "HMAC-SHA256 of the payload"
+// @Success 200 {object} map[string]interface{}
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/integrations/github/webhook [post]
+func (s *Server) githubWebhook(c *gin.Context) {
+	// Unsigned deliveries are rejected without an audit event, anyone can send them
+	setAuditSkipped(c, true)
+
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+			return
+		}
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if config.GitHubWebhookSecret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "GitHub integration is not configured"})
+		return
+	}
+
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Payload too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read payload"})
+		return
+	}
+	if !validGitHubSignature(config.GitHubWebhookSecret, payload, c.GetHeader("X-Hub-Signature-256")) {
+		s.logger.Warn().Str("client_ip", c.ClientIP()).Msg("Rejected GitHub webhook delivery with an invalid signature")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	}
+	setAuditSkipped(c, false)
+
+	owner, ok := s.findGitHubWebhookUser(c, config.GitHubWebhookUserID)
+	if !ok {
+		return
+	}
+	setAuditUser(c, owner)
+
+	event := c.GetHeader("X-GitHub-Event")
+	setAuditDetail(c, "event", event)
+	switch event {
+	case "ping":
+		c.JSON(http.StatusOK, gin.H{"message": "pong"})
+		return
+	case "pull_request":
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Event " + event + " ignored"})
+		return
+	}
+
+	var pr GitHubPullRequestEvent
+	if err := json.Unmarshal(payload, &pr); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pull_request payload", "details": err.Error()})
+		return
+	}
+	if pr.Number <= 0 || pr.Repository.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payload has no pull request number or repository"})
+		return
+	}
+
+	branchName := pullRequestBranchName(pr.Repository.Name, pr.Number)
+	setAuditDetail(c, "action", pr.Action)
+	setAuditDetail(c, "repository", pr.Repository.FullName)
+	setAuditDetail(c, "pull_request", strconv.Itoa(pr.Number))
+	setAuditDetail(c, "name", branchName)
+
+	// GitHub gives up on deliveries after 10 seconds, so the branch is created or deleted by the worker
+	var task *asynq.Task
+	pullRequest := fmt.Sprintf("%s#%d", pr.Repository.FullName, pr.Number)
+	switch pr.Action {
+	case "opened", "reopened":
+		task, err = tasks.NewCreateBranchTask(tasks.BranchPayload{BranchName: branchName, CreatedByID: owner.ID, PullRequest: pullRequest})
+	case "closed":
+		// Only the branch created for this pull request, not one of the same name created by hand or for another
+		// owner's repository of the same name
+		task, err = tasks.NewDeleteBranchTask(tasks.BranchPayload{BranchName: branchName, PullRequest: pullRequest})
+	default:
+		// synchronize, edited, labeled... don't change the branch
+		c.JSON(http.StatusOK, gin.H{"message": "Action " + pr.Action + " ignored"})
+		return
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create pull request branch task")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if _, err := s.taskClient.Enqueue(task, tasks.Timeout(task.Type(), tasks.BranchTaskTimeout, s.config.Worker), tasks.Retention(task.Type(), s.config.Redis), tasks.Queue(task.Type(), s.config.Worker)); err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("repository", pr.Repository.FullName).
+			Int("pull_request", pr.Number).
+			Str("branch_name", branchName).
+			Msg("Failed to enqueue pull request branch task")
+		s.respondEnqueueError(c, err, "Failed to enqueue branch task")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"branch": branchName, "action": pr.Action})
+}
+
+// findGitHubWebhookUser loads the owner of pull request branches, writing the error response if it can't
+func (s *Server) findGitHubWebhookUser(c *gin.Context, userID string) (*models.User, bool) {
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "GitHub integration owner no longer exists, set the webhook secret again"})
+			return nil, false
+		}
+		s.logger.Error().Err(err).Str("user_id", userID).Msg("Failed to find GitHub integration owner")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// validGitHubSignature checks an X-Hub-Signature-256 header ("sha256=<hex HMAC of the payload>")
+func validGitHubSignature(secret string, payload []byte, header string) bool {
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// pullRequestBranchName names the branch of a pull request, e.g. "api-pr-42"
+// The repository part is reduced to lowercase letters, digits and dashes and shortened to fit the 50 character limit
+func pullRequestBranchName(repository string, number int) string {
+	suffix := "-pr-" + strconv.Itoa(number)
+
+	var name strings.Builder
+	for _, char := range strings.ToLower(repository) {
+		switch {
+		case (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9'):
+			name.WriteRune(char)
+		case !strings.HasSuffix(name.String(), "-") && name.Len() > 0:
+			name.WriteByte('-')
+		}
+	}
+
+	prefix := name.String()
+	if len(prefix) > 50-len(suffix) {
+		prefix = prefix[:50-len(suffix)]
+	}
+	prefix = strings.Trim(prefix, "-")
+	if prefix == "" {
+		prefix = "repo"
+	}
+	return prefix + suffix
+}
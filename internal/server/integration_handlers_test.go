@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func githubSignature(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidGitHubSignature(t *testing.T) {
+	payload := `{"action":"opened"}`
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "valid", header: githubSignature("secret", payload), want: true},
+		{name: "other secret", header: githubSignature("other", payload)},
+		{name: "other payload", header: githubSignature("secret", payload+" ")},
+		{name: "missing prefix", header: strings.TrimPrefix(githubSignature("secret", payload), "sha256=")},
+		{name: "sha1 header", header: "sha1=" + strings.TrimPrefix(githubSignature("secret", payload), "sha256=")},
+		{name: "not hex", header: "sha256=zz"},
+		{name: "empty", header: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validGitHubSignature("secret", []byte(payload), tt.header); got != tt.want {
+				t.Errorf("validGitHubSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPullRequestBranchName(t *testing.T) {
+	tests := []struct {
+		repository string
+		number     int
+		want       string
+	}{
+		{repository: "api", number: 42, want: "api-pr-42"},
+		{repository: "My.Web_App", number: 7, want: "my-web-app-pr-7"},
+		{repository: "--api--", number: 1, want: "api-pr-1"},
+		{repository: "日本", number: 3, want: "repo-pr-3"},
+		{repository: strings.Repeat("a", 60), number: 12345, want: strings.Repeat("a", 41) + "-pr-12345"},
+		{repository: strings.Repeat("a", 40) + "-b", number: 12345, want: strings.Repeat("a", 40) + "-pr-12345"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repository, func(t *testing.T) {
+			got := pullRequestBranchName(tt.repository, tt.number)
+			if got != tt.want {
+				t.Errorf("pullRequestBranchName(%q, %d) = %q, want %q", tt.repository, tt.number, got, tt.want)
+			}
+			if len(got) > 50 {
+				t.Errorf("pullRequestBranchName(%q, %d) is %d characters, want at most 50", tt.repository, tt.number, len(got))
+			}
+		})
+	}
+}
+
+func TestGitHubWebhookInvalidSignatureNotAudited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+	if err := s.db.Create(&models.Config{GitHubWebhookSecret: "secret"}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(s.auditMiddleware())
+	s.audit(&router.RouterGroup, "integration.github_webhook", "integration").POST("/api/integrations/github/webhook", s.githubWebhook)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/integrations/github/webhook", strings.NewReader(`{}`))
+	req.Header.Set("X-GitHub-Event", "ping")
+	req.Header.Set("X-Hub-Signature-256", githubSignature("wrong", `{}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("githubWebhook() status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	var count int64
+	s.db.Model(&models.AuditEvent{}).Count(&count)
+	if count != 0 {
+		t.Errorf("recorded %d audit events for an unsigned delivery, want 0", count)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// latestReleaseURL is the GitHub API endpoint of the latest release (replaced in tests)
+var latestReleaseURL = "https://api.github.com/repos/branchd-dev/branchd/releases/latest"
+
+const (
+	// latestVersionTTL is how long a successful lookup is served from the cache
+	latestVersionTTL = time.Hour
+
+	// latestVersionRetryAfter is how long a failed lookup is cached, so an unreachable
+	// GitHub isn't queried (and logged) on every page load
+	latestVersionRetryAfter = 10 * time.Minute
+)
+
+// latestVersionCache is the read-through cache of the latest release lookup
+type latestVersionCache struct {
+	mu        sync.Mutex
+	version   string
+	checkedAt time.Time // Last successful lookup, zero if none succeeded yet
+	err       error     // Error of the last lookup if it failed
+	expiresAt time.Time
+}
+
+// latestReleaseVersion returns the latest release tag, from the cache unless it expired or refresh is set
+// A failed lookup returns the error even if an older version is cached
+func (s *Server) latestReleaseVersion(ctx context.Context, refresh bool) (string, time.Time, error) {
+	cache := &s.latestVersion
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if !refresh && time.Now().Before(cache.expiresAt) {
+		return cache.version, cache.checkedAt, cache.err
+	}
+
+	version, err := fetchLatestRelease(ctx)
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to fetch latest release from GitHub")
+		cache.err = err
+		cache.expiresAt = time.Now().Add(latestVersionRetryAfter)
+		return cache.version, cache.checkedAt, err
+	}
+
+	cache.version = version
+	cache.checkedAt = time.Now()
+	cache.err = nil
+	cache.expiresAt = cache.checkedAt.Add(latestVersionTTL)
+	return cache.version, cache.checkedAt, nil
+}
+
+// fetchLatestRelease looks up the tag of the latest GitHub release
+func fetchLatestRelease(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "branchd-server")
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch latest release: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("failed to parse release: %w", err)
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("latest release has no tag")
+	}
+	return release.TagName, nil
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// fakeGitHub serves the latest release endpoint, counting lookups
+// An empty tag answers with 502 like an unreachable GitHub
+type fakeGitHub struct {
+	tag     string
+	lookups int
+}
+
+func newFakeGitHub(t *testing.T, tag string) *fakeGitHub {
+	t.Helper()
+	github := &fakeGitHub{tag: tag}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		github.lookups++
+		if github.tag == "" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"tag_name": github.tag})
+	}))
+	t.Cleanup(server.Close)
+
+	original := latestReleaseURL
+	latestReleaseURL = server.URL
+	t.Cleanup(func() { latestReleaseURL = original })
+	return github
+}
+
+func TestFetchLatestRelease(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    string
+		wantErr string
+	}{
+		{name: "latest release", status: http.StatusOK, body: `{"tag_name":"v1.2.3"}`, want: "v1.2.3"},
+		{name: "rate limited", status: http.StatusForbidden, body: `{"message":"API rate limit exceeded"}`, wantErr: "status 403"},
+		{name: "no tag", status: http.StatusOK, body: `{}`, wantErr: "no tag"},
+		{name: "not JSON", status: http.StatusOK, body: `<html>`, wantErr: "failed to parse release"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("User-Agent") == "" {
+					t.Error("request without User-Agent, GitHub rejects those")
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			original := latestReleaseURL
+			latestReleaseURL = server.URL
+			defer func() { latestReleaseURL = original }()
+
+			got, err := fetchLatestRelease(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("fetchLatestRelease() = %q, %v, want error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("fetchLatestRelease() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestReleaseVersionCache(t *testing.T) {
+	s := newTestServer(t)
+	github := newFakeGitHub(t, "v1.2.3")
+	ctx := context.Background()
+
+	version, checkedAt, err := s.latestReleaseVersion(ctx, false)
+	if err != nil || version != "v1.2.3" || checkedAt.IsZero() {
+		t.Fatalf("latestReleaseVersion() = %q, %v, %v", version, checkedAt, err)
+	}
+	s.latestReleaseVersion(ctx, false)
+	if github.lookups != 1 {
+		t.Errorf("%d lookups, want the second one served from the cache", github.lookups)
+	}
+
+	// refresh bypasses the cache
+	github.tag = "v1.3.0"
+	if version, _, _ := s.latestReleaseVersion(ctx, true); version != "v1.3.0" || github.lookups != 2 {
+		t.Errorf("refreshed latestReleaseVersion() = %q after %d lookups, want v1.3.0 after 2", version, github.lookups)
+	}
+
+	// A failed lookup reports the error with the last known version, and is cached as well
+	github.tag = ""
+	s.latestVersion.expiresAt = time.Time{}
+	version, checkedAt, err = s.latestReleaseVersion(ctx, false)
+	if err == nil || version != "v1.3.0" || checkedAt.IsZero() {
+		t.Errorf("failed latestReleaseVersion() = %q, %v, %v; want v1.3.0 with an error", version, checkedAt, err)
+	}
+	if _, _, err := s.latestReleaseVersion(ctx, false); err == nil || github.lookups != 3 {
+		t.Errorf("latestReleaseVersion() after a failure = %v after %d lookups, want the cached error after 3", err, github.lookups)
+	}
+	if wait := time.Until(s.latestVersion.expiresAt); wait > latestVersionRetryAfter || wait < latestVersionRetryAfter-time.Minute {
+		t.Errorf("failed lookup cached for %v, want %v", wait, latestVersionRetryAfter)
+	}
+}
+
+func TestGetLatestVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		config models.Config
+		tag    string
+		want   LatestVersionResponse
+	}{
+		{
+			name: "update available",
+			tag:  "v1.3.0",
+			want: LatestVersionResponse{LatestVersion: "v1.3.0", CurrentVersion: "v1.2.3", UpdateAvailable: true},
+		},
+		{
+			name: "up to date",
+			tag:  "v1.2.3",
+			want: LatestVersionResponse{LatestVersion: "v1.2.3", CurrentVersion: "v1.2.3"},
+		},
+		{
+			name: "GitHub unreachable",
+			want: LatestVersionResponse{CurrentVersion: "v1.2.3", Error: "GitHub API returned status 502"},
+		},
+		{
+			name:   "checks disabled",
+			config: models.Config{UpdateChecksDisabled: true},
+			tag:    "v1.3.0",
+			want:   LatestVersionResponse{CurrentVersion: "v1.2.3", ChecksDisabled: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.version = "v1.2.3"
+			if err := s.db.Create(&tt.config).Error; err != nil {
+				t.Fatalf("failed to create config: %v", err)
+			}
+			github := newFakeGitHub(t, tt.tag)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/system/latest-version", nil)
+			s.getLatestVersion(c)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("getLatestVersion() = %d %s, want 200", w.Code, w.Body.String())
+			}
+			var got LatestVersionResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if (got.LastCheckedAt != nil) != (tt.tag != "" && !tt.want.ChecksDisabled) {
+				t.Errorf("LastCheckedAt = %v", got.LastCheckedAt)
+			}
+			got.LastCheckedAt = nil
+			if got != tt.want {
+				t.Errorf("getLatestVersion() = %+v, want %+v", got, tt.want)
+			}
+			if tt.want.ChecksDisabled && github.lookups != 0 {
+				t.Errorf("looked up the latest release %d times with checks disabled", github.lookups)
+			}
+		})
+	}
+}
+
+func TestUpdateServerWithChecksDisabled(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.db.Create(&models.Config{UpdateChecksDisabled: true}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+	github := newFakeGitHub(t, "v1.3.0")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/system/update", nil)
+	s.updateServer(c)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "update_checks_disabled") {
+		t.Errorf("updateServer() = %d %s, want 400", w.Code, w.Body.String())
+	}
+	if github.lookups != 0 {
+		t.Errorf("looked up the latest release %d times with checks disabled", github.lookups)
+	}
+}
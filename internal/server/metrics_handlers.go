@@ -0,0 +1,86 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+)
+
+// branchMetric is a metric of the Prometheus text exposition format with a value per branch
+type branchMetric struct {
+	name  string
+	kind  string // "gauge" or "counter"
+	help  string
+	value func(m branches.BranchMetrics) string
+}
+
+func intValue(v int64) string { return strconv.FormatInt(v, 10) }
+
+var branchMetricFamilies = []branchMetric{
+	{"branchd_branch_up", "gauge", "Whether the branch answered the metrics query", func(m branches.BranchMetrics) string {
+		if m.Up {
+			return "1"
+		}
+		return "0"
+	}},
+	{"branchd_branch_connections", "gauge", "Client connections of the branch", func(m branches.BranchMetrics) string { return intValue(int64(m.Connections)) }},
+	{"branchd_branch_xact_commit_total", "counter", "Committed transactions of the branch database (TPS with rate())", func(m branches.BranchMetrics) string { return intValue(m.XactCommit) }},
+	{"branchd_branch_xact_rollback_total", "counter", "Rolled back transactions of the branch database", func(m branches.BranchMetrics) string { return intValue(m.XactRollback) }},
+	{"branchd_branch_blocks_hit_total", "counter", "Blocks of the branch database found in shared buffers", func(m branches.BranchMetrics) string { return intValue(m.BlocksHit) }},
+	{"branchd_branch_blocks_read_total", "counter", "Blocks of the branch database read from disk", func(m branches.BranchMetrics) string { return intValue(m.BlocksRead) }},
+	{"branchd_branch_cache_hit_ratio", "gauge", "Share of blocks found in shared buffers since the branch started", func(m branches.BranchMetrics) string {
+		return strconv.FormatFloat(m.CacheHitRatio(), 'f', -1, 64)
+	}},
+	{"branchd_branch_live_tuples", "gauge", "Estimated live rows of the branch's user tables", func(m branches.BranchMetrics) string { return intValue(m.LiveTuples) }},
+	{"branchd_branch_dead_tuples", "gauge", "Estimated dead rows of the branch's user tables (bloat until vacuumed)", func(m branches.BranchMetrics) string { return intValue(m.DeadTuples) }},
+}
+
+// @Summary Prometheus metrics of branches
+// @Description Per-branch PostgreSQL metrics (connections, transactions, cache hit ratio, dead tuples) in the Prometheus text format
+// @Description Only served with METRICS_ENABLED, scrapers authenticate with METRICS_TOKEN as bearer token
+// @Tags system
+// @Produce plain
+// @Success 200 {string} string
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /metrics [get]
+func (s *Server) getMetrics(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Metrics.Token)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid metrics token"})
+		return
+	}
+
+	metrics, err := s.branchesService.CollectBranchMetrics(c.Request.Context(), s.config.Metrics.Timeout)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to collect branch metrics")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to collect branch metrics"})
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	writeBranchMetrics(c.Writer, metrics)
+}
+
+// writeBranchMetrics writes the metrics in the Prometheus text exposition format, labeled by branch and restore
+func writeBranchMetrics(w io.Writer, metrics []branches.BranchMetrics) {
+	for _, family := range branchMetricFamilies {
+		fmt.Fprintf(w, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", family.name, family.kind)
+		for _, m := range metrics {
+			// Statistics of unreachable branches are unknown, not zero
+			if !m.Up && family.name != "branchd_branch_up" {
+				continue
+			}
+			fmt.Fprintf(w, "%s{branch=%q,restore=%q} %s\n", family.name, m.BranchName, m.RestoreName, family.value(m))
+		}
+	}
+}
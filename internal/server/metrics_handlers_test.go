@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+)
+
+func TestWriteBranchMetrics(t *testing.T) {
+	var out bytes.Buffer
+	writeBranchMetrics(&out, []branches.BranchMetrics{
+		{BranchName: "feature-x", RestoreName: "restore_20250101000000", Up: true, Connections: 3, XactCommit: 1200, BlocksHit: 3, BlocksRead: 1, DeadTuples: 250},
+		{BranchName: "feature-y", RestoreName: "restore_20250101000000"},
+	})
+	got := out.String()
+
+	for _, want := range []string{
+		"# TYPE branchd_branch_up gauge\n",
+		`branchd_branch_up{branch="feature-x",restore="restore_20250101000000"} 1` + "\n",
+		`branchd_branch_up{branch="feature-y",restore="restore_20250101000000"} 0` + "\n",
+		`branchd_branch_connections{branch="feature-x",restore="restore_20250101000000"} 3` + "\n",
+		"# TYPE branchd_branch_xact_commit_total counter\n",
+		`branchd_branch_xact_commit_total{branch="feature-x",restore="restore_20250101000000"} 1200` + "\n",
+		`branchd_branch_cache_hit_ratio{branch="feature-x",restore="restore_20250101000000"} 0.75` + "\n",
+		`branchd_branch_dead_tuples{branch="feature-x",restore="restore_20250101000000"} 250` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics don't contain %q", want)
+		}
+	}
+	// Only up is reported for branches that didn't answer
+	if strings.Count(got, `branch="feature-y"`) != 1 {
+		t.Errorf("metrics report statistics of an unreachable branch:\n%s", got)
+	}
+}
+
+func TestGetMetricsRequiresToken(t *testing.T) {
+	s := newTestServer(t)
+	s.config.Metrics.Enabled = true
+	s.config.Metrics.Token = "scrape-token"
+
+	for _, header := range []string{"", "Bearer wrong", "scrape-token-but-longer"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if header != "" {
+			c.Request.Header.Set("Authorization", header)
+		}
+		s.getMetrics(c)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("getMetrics() with Authorization %q = %d, want 401", header, w.Code)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
@@ -82,6 +83,13 @@ func JWTAuthMiddleware(db *gorm.DB, log zerolog.Logger) gin.HandlerFunc {
 			return
 		}
 
+		// A decommission rotates the secret in the worker, possibly another process, which must revoke
+		// every token issued before right away
+		var config models.Config
+		if err := db.Select("jwt_secret").First(&config).Error; err == nil && config.JWTSecret != "" {
+			auth.InitializeJWT(config.JWTSecret)
+		}
+
 		// Validate JWT token
 		claims, err := auth.ValidateToken(token)
 		if err != nil {
@@ -104,6 +112,10 @@ func JWTAuthMiddleware(db *gorm.DB, log zerolog.Logger) gin.HandlerFunc {
 			Email:      user.Email,
 			IsAdmin:    user.IsAdmin,
 			AuthMethod: "jwt", // Can be differentiated by endpoint if needed
+
+			TwoFactorEnabled:  user.TOTPEnabled,
+			TwoFactor:         claims.TwoFactor && user.TOTPEnabled,
+			TwoFactorDeadline: user.TwoFactorDeadline,
 		}
 		setSession(c, sessionData)
 
@@ -128,3 +140,88 @@ func AdminOnlyMiddleware(log zerolog.Logger) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// TwoFactorMiddleware ensures the token was issued after a TOTP code was verified
+// Used on all admin routes, users who haven't enrolled an authenticator yet get a grace period starting with their
+// first request here (the deadline is sent in the X-Two-Factor-Deadline header)
+func TwoFactorMiddleware(db *gorm.DB, log zerolog.Logger, gracePeriod time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkTwoFactor(c, db, log, gracePeriod) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkTwoFactor is TwoFactorMiddleware's check, responding and aborting if it fails
+func checkTwoFactor(c *gin.Context, db *gorm.DB, log zerolog.Logger, gracePeriod time.Duration) bool {
+	sessionData, exists := GetSessionData(c)
+	if !exists {
+		respondWithError(c, log, http.StatusUnauthorized, errors.New("no session"), "Unauthorized")
+		return false
+	}
+
+	if !sessionData.TwoFactor && !sessionData.TwoFactorEnabled && gracePeriod > 0 {
+		deadline, err := twoFactorDeadline(db, sessionData, gracePeriod)
+		if err != nil {
+			log.Error().Err(err).Str("user_id", sessionData.UserID).Msg("Failed to set two-factor deadline")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return false
+		}
+		if time.Now().Before(deadline) {
+			c.Header("X-Two-Factor-Deadline", deadline.UTC().Format(time.RFC3339))
+			return true
+		}
+	}
+
+	if !sessionData.TwoFactor {
+		message := "Two-factor authentication required, verify a code with POST /api/auth/2fa/verify"
+		if !sessionData.TwoFactorEnabled {
+			message = "Two-factor authentication required, enroll with POST /api/auth/2fa/setup"
+		}
+		log.Warn().Str("user_id", sessionData.UserID).Str("path", c.FullPath()).Msg(message)
+		c.JSON(http.StatusForbidden, gin.H{"error": message, "two_factor_required": true})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+// requireAdmin applies the checks of admin routes (AdminOnlyMiddleware and TwoFactorMiddleware) within a handler of a
+// route open to all users, for requests changing admin-only settings. Responds and returns false if they fail
+func (s *Server) requireAdmin(c *gin.Context, fields []string) bool {
+	sessionData, exists := GetSessionData(c)
+	if !exists || !sessionData.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required", "details": "only admins may change " + strings.Join(fields, ", ")})
+		c.Abort()
+		return false
+	}
+	return checkTwoFactor(c, s.db, s.logger, s.config.Auth.TwoFactorGracePeriod)
+}
+
+// twoFactorDeadline returns until when the user may skip two-factor authentication, starting the grace period if needed
+func twoFactorDeadline(db *gorm.DB, sessionData *auth.SessionData, gracePeriod time.Duration) (time.Time, error) {
+	if sessionData.TwoFactorDeadline != nil {
+		return *sessionData.TwoFactorDeadline, nil
+	}
+
+	// Conditional update, concurrent first requests must not push the deadline back
+	deadline := time.Now().Add(gracePeriod)
+	if err := db.Model(&models.User{}).
+		Where("id = ? AND two_factor_deadline IS NULL", sessionData.UserID).
+		Update("two_factor_deadline", deadline).Error; err != nil {
+		return time.Time{}, err
+	}
+
+	var user models.User
+	if err := db.Select("two_factor_deadline").Where("id = ?", sessionData.UserID).First(&user).Error; err != nil {
+		return time.Time{}, err
+	}
+	if user.TwoFactorDeadline == nil {
+		return time.Time{}, errors.New("two-factor deadline not set")
+	}
+	sessionData.TwoFactorDeadline = user.TwoFactorDeadline
+	return *user.TwoFactorDeadline, nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestTwoFactorMiddleware(t *testing.T) {
+	s := newTestServer(t)
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name         string
+		user         models.User
+		twoFactor    bool
+		gracePeriod  time.Duration
+		want         int
+		wantDeadline bool
+	}{
+		{name: "verified code", user: models.User{TOTPEnabled: true}, twoFactor: true, want: 200},
+		{name: "enrolled without code", user: models.User{TOTPEnabled: true}, gracePeriod: time.Hour, want: 403},
+		{name: "grace period starts", user: models.User{}, gracePeriod: time.Hour, want: 200, wantDeadline: true},
+		{name: "within grace period", user: models.User{TwoFactorDeadline: &future}, gracePeriod: time.Hour, want: 200, wantDeadline: true},
+		{name: "grace period over", user: models.User{TwoFactorDeadline: &past}, gracePeriod: time.Hour, want: 403},
+		{name: "no grace period", user: models.User{}, want: 403},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			user.Email = tt.name + "@example.com"
+			user.IsAdmin = true
+			createTestUser(t, s, &user)
+
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				setSession(c, &auth.SessionData{
+					UserID:            user.ID,
+					IsAdmin:           true,
+					TwoFactorEnabled:  user.TOTPEnabled,
+					TwoFactor:         tt.twoFactor,
+					TwoFactorDeadline: user.TwoFactorDeadline,
+				})
+			})
+			router.Use(TwoFactorMiddleware(s.db, s.logger, tt.gracePeriod))
+			router.GET("/api/audit", func(c *gin.Context) { c.Status(200) })
+
+			// The second request must keep the deadline of the first
+			var deadline string
+			for request := 0; request < 2; request++ {
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/audit", nil))
+				if rec.Code != tt.want {
+					t.Fatalf("test %d request %d: status = %d, want %d", i, request+1, rec.Code, tt.want)
+				}
+				got := rec.Header().Get("X-Two-Factor-Deadline")
+				if (got != "") != tt.wantDeadline {
+					t.Fatalf("X-Two-Factor-Deadline = %q, want set = %v", got, tt.wantDeadline)
+				}
+				if request == 1 && got != deadline {
+					t.Errorf("deadline moved from %q to %q", deadline, got)
+				}
+				deadline = got
+			}
+		})
+	}
+}
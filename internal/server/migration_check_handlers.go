@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// CheckMigrationRequest is a migration given as SQL, or as the files of a migration directory run in order
+type CheckMigrationRequest struct {
+	SQL   string                 `json:"sql"`
+	Files []models.MigrationFile `json:"files"` // Run after sql, in the order given
+}
+
+// MigrationCheckStatus is the progress of a migration check
+type MigrationCheckStatus struct {
+	ID     string                   `json:"id"`
+	Status string                   `json:"status"`           // "pending", "running", "completed" or "failed"
+	Error  string                   `json:"error,omitempty"`  // Why the check couldn't run, a failing migration is reported in the result
+	Result *branches.MigrationCheck `json:"result,omitempty"` // Set once completed
+}
+
+// @Summary Check migration
+// @Description Run a migration in a throwaway copy of a branch cloned from a fresh snapshot, and report the locks
+// @Description each statement takes, how long it runs and which tables it rewrites. The copy is destroyed afterwards,
+// @Description the branch isn't modified. Poll GET /api/branches/{id}/check-migration/{task_id} for the report
+// @Tags branches
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param request body CheckMigrationRequest true "Migration to check"
+// @Success 202 {object} MigrationCheckStatus
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/check-migration [post]
+func (s *Server) checkBranchMigration(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var req CheckMigrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	files := req.Files
+	if req.SQL != "" {
+		files = append([]models.MigrationFile{{SQL: req.SQL}}, files...)
+	}
+	if err := branches.ValidateMigration(files); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	setAuditDetail(c, "name", branch.Name)
+	if branch.SuspendedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Branch is suspended, resume it first"})
+		return
+	}
+	// The copy of a break-glass branch (raw restore) holds raw data, only the user it was granted to may query it
+	var restore models.Restore
+	if err := s.db.Where("id = ?", branch.RestoreID).First(&restore).Error; err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to load branch restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if restore.Raw {
+		if sessionData, exists := GetSessionData(c); !exists || sessionData.UserID != branch.CreatedByID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Break-glass branches can only be checked by the user they were granted to"})
+			return
+		}
+	}
+
+	task, err := tasks.NewCheckMigrationTask(tasks.CheckMigrationPayload{BranchID: branch.ID, Files: files})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create migration check task")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	info, err := s.taskClient.Enqueue(task, tasks.Timeout(tasks.TypeCheckMigration, tasks.CheckMigrationTimeout, s.config.Worker), asynq.MaxRetry(0), tasks.Retention(tasks.TypeCheckMigration, s.config.Redis), tasks.Queue(tasks.TypeCheckMigration, s.config.Worker))
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to enqueue migration check task")
+		s.respondEnqueueError(c, err, "Failed to start migration check")
+		return
+	}
+
+	setAuditDetail(c, "task_id", info.ID)
+
+	c.JSON(http.StatusAccepted, MigrationCheckStatus{ID: info.ID, Status: tasks.StatusPending})
+}
+
+// @Summary Get migration check
+// @Description Reports the progress of a migration check and, once completed, the locks, duration and table rewrites
+// @Description of each statement. A migration failing at a statement is a completed check with succeeded false
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Param task_id path string true "ID returned when the check was started"
+// @Success 200 {object} MigrationCheckStatus
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/check-migration/{task_id} [get]
+func (s *Server) getBranchMigrationCheck(c *gin.Context) {
+	branchID := c.Param("id")
+	taskID := c.Param("task_id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	info, err := s.taskInspector.GetTaskInfo(tasks.QueueOf(tasks.TypeCheckMigration, s.config.Worker), taskID)
+	if err != nil {
+		if !errors.Is(err, asynq.ErrTaskNotFound) && !errors.Is(err, asynq.ErrQueueNotFound) {
+			s.logger.Error().Err(err).Str("task_id", taskID).Msg("Failed to load migration check task")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Migration check not found"})
+		return
+	}
+	// Checks of other branches (or other task types) aren't reported here
+	task := asynq.NewTask(info.Type, info.Payload)
+	payload, err := tasks.ParseCheckMigrationPayload(task)
+	if info.Type != tasks.TypeCheckMigration || err != nil || payload.BranchID != branch.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Migration check not found"})
+		return
+	}
+
+	status := MigrationCheckStatus{ID: info.ID, Status: tasks.StatusOf(info)}
+	switch status.Status {
+	case tasks.StatusFailed:
+		status.Error = info.LastErr
+	case tasks.StatusCompleted:
+		var result branches.MigrationCheck
+		if err := json.Unmarshal(info.Result, &result); err != nil {
+			s.logger.Error().Err(err).Str("task_id", taskID).Msg("Failed to decode migration check")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		status.Result = &result
+	}
+
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestCheckBranchMigrationValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	if err := s.db.Create(&models.Restore{BaseModel: models.BaseModel{ID: "restore-raw"}, Name: "restore_raw", Raw: true}).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	suspendedAt := time.Now()
+	for _, branch := range []*models.Branch{
+		{Name: "feature-x", RestoreID: "restore-1", CreatedByID: "user-1", User: "u", Password: "p", Port: 6001},
+		{Name: "feature-y", RestoreID: "restore-1", CreatedByID: "user-1", User: "u", Password: "p", Port: 6002, SuspendedAt: &suspendedAt},
+		{Name: "break-glass", RestoreID: "restore-raw", CreatedByID: "user-2", User: "u", Password: "p", Port: 6003},
+	} {
+		if err := s.db.Create(branch).Error; err != nil {
+			t.Fatalf("failed to create branch: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		branch string
+		body   string
+		want   int
+	}{
+		{name: "no body", branch: "feature-x", want: http.StatusBadRequest},
+		{name: "no statements", branch: "feature-x", body: `{"sql":"-- TODO\n"}`, want: http.StatusBadRequest},
+		{name: "meta-command", branch: "feature-x", body: `{"files":[{"name":"001.sql","sql":"\\copy users FROM 'users.csv'"}]}`, want: http.StatusBadRequest},
+		{name: "unknown branch", branch: "feature-z", body: `{"sql":"SELECT 1"}`, want: http.StatusNotFound},
+		{name: "suspended branch", branch: "feature-y", body: `{"sql":"SELECT 1"}`, want: http.StatusBadRequest},
+		{name: "break-glass branch of another user", branch: "break-glass", body: `{"sql":"SELECT 1"}`, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/branches/"+tt.branch+"/check-migration", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = gin.Params{{Key: "id", Value: tt.branch}}
+			c.Set("session", &auth.SessionData{UserID: "user-1", Email: "carol@example.com"})
+			s.checkBranchMigration(c)
+
+			if w.Code != tt.want {
+				t.Errorf("checkBranchMigration() status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
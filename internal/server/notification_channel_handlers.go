@@ -0,0 +1,266 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/notify"
+)
+
+// CreateNotificationChannelRequest represents a request to create a notification channel
+type CreateNotificationChannelRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	Kind       string   `json:"kind"`                           // slack, discord or teams, inferred from the webhook URL when empty
+	WebhookURL string   `json:"webhook_url" binding:"required"` // Incoming webhook of the channel
+	Events     []string `json:"events"`                         // branch.created, branch.deleted, refresh.completed, restore.failed, break_glass, server.decommissioned; empty = all
+}
+
+// UpdateNotificationChannelRequest updates the given notification channel fields
+type UpdateNotificationChannelRequest struct {
+	Name       *string   `json:"name"`
+	Kind       *string   `json:"kind"`
+	WebhookURL *string   `json:"webhook_url"`
+	Events     *[]string `json:"events"`
+}
+
+// @Summary List notification channels
+// @Description List the Slack, Discord and Teams channels branch and restore events are posted to, without their webhook URLs (admin only)
+// @Tags notification-channels
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.NotificationChannel
+// @Router /api/notification-channels [get]
+func (s *Server) listNotificationChannels(c *gin.Context) {
+	var list []models.NotificationChannel
+	if err := s.db.Order("name ASC").Find(&list).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list notification channels")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Create notification channel
+// @Description Post formatted messages about the given events to a Slack, Discord or Teams incoming webhook (admin only)
+// @Tags notification-channels
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateNotificationChannelRequest true "Create notification channel request"
+// @Success 201 {object} models.NotificationChannel
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/notification-channels [post]
+func (s *Server) createNotificationChannel(c *gin.Context) {
+	var req CreateNotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	channel := models.NotificationChannel{
+		Name:       strings.TrimSpace(req.Name),
+		Kind:       strings.TrimSpace(req.Kind),
+		WebhookURL: strings.TrimSpace(req.WebhookURL),
+		Events:     req.Events,
+	}
+	if !s.validateNotificationChannel(c, &channel) {
+		return
+	}
+
+	if err := s.db.Create(&channel).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create notification channel")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification channel"})
+		return
+	}
+
+	setAuditResource(c, channel.ID)
+	setAuditDetail(c, "name", channel.Name)
+
+	c.JSON(http.StatusCreated, channel)
+}
+
+// @Summary Update notification channel
+// @Description Update a notification channel's name, kind, webhook URL or events (admin only)
+// @Tags notification-channels
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Notification channel ID"
+// @Param request body UpdateNotificationChannelRequest true "Update notification channel request"
+// @Success 200 {object} models.NotificationChannel
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/notification-channels/{id} [patch]
+func (s *Server) updateNotificationChannel(c *gin.Context) {
+	channel, ok := s.findNotificationChannel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req UpdateNotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		channel.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Kind != nil {
+		channel.Kind = strings.TrimSpace(*req.Kind)
+	}
+	if req.WebhookURL != nil {
+		channel.WebhookURL = strings.TrimSpace(*req.WebhookURL)
+		// A new webhook of another chat gets its kind unless one is given
+		if req.Kind == nil {
+			channel.Kind = ""
+		}
+	}
+	if req.Events != nil {
+		channel.Events = *req.Events
+	}
+	if !s.validateNotificationChannel(c, channel) {
+		return
+	}
+
+	if err := s.db.Save(channel).Error; err != nil {
+		s.logger.Error().Err(err).Str("channel_id", channel.ID).Msg("Failed to update notification channel")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification channel"})
+		return
+	}
+
+	setAuditDetail(c, "name", channel.Name)
+
+	c.JSON(http.StatusOK, channel)
+}
+
+// @Summary Delete notification channel
+// @Description Stop posting to a notification channel (admin only)
+// @Tags notification-channels
+// @Security BearerAuth
+// @Param id path string true "Notification channel ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/notification-channels/{id} [delete]
+func (s *Server) deleteNotificationChannel(c *gin.Context) {
+	channel, ok := s.findNotificationChannel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := s.db.Delete(channel).Error; err != nil {
+		s.logger.Error().Err(err).Str("channel_id", channel.ID).Msg("Failed to delete notification channel")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification channel"})
+		return
+	}
+
+	setAuditDetail(c, "name", channel.Name)
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Test notification channel
+// @Description Post a test message to a notification channel, whatever its events (admin only)
+// @Tags notification-channels
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Notification channel ID"
+// @Success 200 {object} models.NotificationChannel
+// @Failure 404 {object} map[string]interface{}
+// @Failure 502 {object} map[string]interface{}
+// @Router /api/notification-channels/{id}/test [post]
+func (s *Server) testNotificationChannel(c *gin.Context) {
+	channel, ok := s.findNotificationChannel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	message := notify.ChannelMessage{
+		Event:  notify.EventTest,
+		Title:  "Test message",
+		Fields: []notify.ChannelField{{Name: "Channel", Value: channel.Name}, {Name: "Events", Value: channelEventsText(channel)}},
+	}
+	if err := notify.NewService(s.db, s.config, s.logger).PostTo(c.Request.Context(), channel, message); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to post to notification channel", "details": err.Error()})
+		return
+	}
+
+	setAuditDetail(c, "name", channel.Name)
+
+	c.JSON(http.StatusOK, channel)
+}
+
+// findNotificationChannel loads a notification channel by ID, writing the error response if it can't
+func (s *Server) findNotificationChannel(c *gin.Context, channelID string) (*models.NotificationChannel, bool) {
+	var channel models.NotificationChannel
+	if err := s.db.Where("id = ?", channelID).First(&channel).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification channel not found"})
+			return nil, false
+		}
+		s.logger.Error().Err(err).Str("channel_id", channelID).Msg("Failed to find notification channel")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	return &channel, true
+}
+
+// validateNotificationChannel checks a notification channel before it's saved, inferring its kind when empty
+// Writes the error response if it's invalid
+func (s *Server) validateNotificationChannel(c *gin.Context, channel *models.NotificationChannel) bool {
+	if channel.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return false
+	}
+	if parsed, err := url.Parse(channel.WebhookURL); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "webhook_url must be an http(s) URL"})
+		return false
+	}
+
+	if channel.Kind == "" {
+		channel.Kind = notify.ChannelKind(channel.WebhookURL)
+		if channel.Kind == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "kind is required, it can't be inferred from the webhook URL (slack, discord or teams)"})
+			return false
+		}
+	}
+	if !slices.Contains([]string{models.ChannelKindSlack, models.ChannelKindDiscord, models.ChannelKindTeams}, channel.Kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be slack, discord or teams"})
+		return false
+	}
+
+	for _, event := range channel.Events {
+		if !slices.Contains(models.ChannelEvents, event) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event " + event, "details": "events must be among " + strings.Join(models.ChannelEvents, ", ")})
+			return false
+		}
+	}
+
+	var count int64
+	if err := s.db.Model(&models.NotificationChannel{}).Where("name = ? AND id != ?", channel.Name, channel.ID).Count(&count).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to check notification channel name")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Notification channel " + channel.Name + " already exists"})
+		return false
+	}
+	return true
+}
+
+// channelEventsText lists the events posted to a channel
+func channelEventsText(channel *models.NotificationChannel) string {
+	if len(channel.Events) == 0 {
+		return "all"
+	}
+	return strings.Join(channel.Events, ", ")
+}
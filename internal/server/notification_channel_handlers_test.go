@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestCreateNotificationChannelValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	if err := s.db.Create(&models.NotificationChannel{Name: "ops", Kind: models.ChannelKindSlack, WebhookURL: "https://hooks.slack.com/services/T0/B0/X"}).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		want     int
+		wantKind string
+	}{
+		{name: "kind inferred", body: `{"name":"eng","webhook_url":"https://discord.com/api/webhooks/1/abc","events":["branch.created"]}`, want: http.StatusCreated, wantKind: models.ChannelKindDiscord},
+		{name: "explicit kind", body: `{"name":"mattermost","kind":"slack","webhook_url":"https://chat.example.com/hooks/abc"}`, want: http.StatusCreated, wantKind: models.ChannelKindSlack},
+		{name: "unknown webhook", body: `{"name":"chat","webhook_url":"https://chat.example.com/hooks/abc"}`, want: http.StatusBadRequest},
+		{name: "unknown kind", body: `{"name":"chat","kind":"irc","webhook_url":"https://chat.example.com/hooks/abc"}`, want: http.StatusBadRequest},
+		{name: "invalid URL", body: `{"name":"chat","kind":"slack","webhook_url":"hooks.slack.com/services"}`, want: http.StatusBadRequest},
+		{name: "unknown event", body: `{"name":"chat","webhook_url":"https://hooks.slack.com/services/T0/B0/Y","events":["branch.renamed"]}`, want: http.StatusBadRequest},
+		{name: "duplicate name", body: `{"name":"ops","webhook_url":"https://hooks.slack.com/services/T0/B0/Y"}`, want: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/notification-channels", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			s.createNotificationChannel(c)
+
+			if w.Code != tt.want {
+				t.Fatalf("createNotificationChannel() status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.wantKind == "" {
+				return
+			}
+			var channel map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &channel); err != nil {
+				t.Fatalf("failed to decode channel: %v", err)
+			}
+			if channel["kind"] != tt.wantKind {
+				t.Errorf("kind = %v, want %s", channel["kind"], tt.wantKind)
+			}
+			if _, ok := channel["webhook_url"]; ok {
+				t.Error("response contains the webhook URL")
+			}
+		})
+	}
+}
@@ -0,0 +1,496 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+const (
+	// oidcProviderTTL is how long the provider's discovered configuration is cached
+	oidcProviderTTL = time.Hour
+
+	// oidcStateCookie carries the state and nonce of a login between the redirect and the callback
+	oidcStateCookie = "branchd_oidc"
+	oidcStateMaxAge = 10 * 60 // Seconds to complete the login at the provider
+
+	// oidcLoginPage is the web UI page the callback redirects to, with #token=... or #error=...
+	oidcLoginPage = "/login"
+)
+
+// errOIDCAccountNotLinked is returned for an SSO login whose email belongs to an account that wasn't linked to SSO
+var errOIDCAccountNotLinked = errors.New("account not linked to SSO")
+
+// oidcProviderCache holds the discovered configuration of the configured issuer
+// and the pending account links (POST /api/auth/oidc/link) of the API process
+type oidcProviderCache struct {
+	mu        sync.Mutex
+	issuerURL string
+	provider  *auth.OIDCProvider
+	expiresAt time.Time
+
+	links map[string]oidcLink // By link token
+}
+
+// oidcLink is a pending link of an account to the user's SSO identity
+type oidcLink struct {
+	userID    string
+	expiresAt time.Time
+}
+
+// OIDCLinkResponse is where the browser goes to link the account to SSO
+type OIDCLinkResponse struct {
+	LoginURL string `json:"login_url"`
+}
+
+// OIDCStatusResponse tells the login page whether SSO login is available
+type OIDCStatusResponse struct {
+	Enabled  bool   `json:"enabled"`
+	LoginURL string `json:"login_url,omitempty"`
+}
+
+// @Summary SSO login status
+// @Description Whether OpenID Connect login is configured (no authentication required)
+// @Description SSO needs the issuer, the client ID and the server's domain (the callback is https://<domain>/api/auth/oidc/callback)
+// @Tags auth
+// @Produce json
+// @Success 200 {object} OIDCStatusResponse
+// @Router /api/auth/oidc [get]
+func (s *Server) getOIDCStatus(c *gin.Context) {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil && err != gorm.ErrRecordNotFound {
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	response := OIDCStatusResponse{Enabled: oidcEnabled(&config)}
+	if response.Enabled {
+		response.LoginURL = "/api/auth/oidc/login"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary Start SSO login
+// @Description Redirects to the OpenID Connect provider (no authentication required)
+// @Tags auth
+// @Success 302
+// @Failure 404 {object} map[string]interface{}
+// @Failure 502 {object} map[string]interface{}
+// @Router /api/auth/oidc/login [get]
+func (s *Server) oidcLogin(c *gin.Context) {
+	config, provider, ok := s.loadOIDCProvider(c)
+	if !ok {
+		return
+	}
+
+	// Linking an account started with POST /api/auth/oidc/link, the token is checked again in the callback
+	link := c.Query("link")
+	if link != "" && !s.pendingOIDCLink(link) {
+		s.redirectOIDCError(c, "Account link expired, start it again from your account")
+		return
+	}
+
+	state, nonce := randomHex(16), randomHex(16)
+	if state == "" || nonce == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode) // Sent on the provider's top-level redirect back
+	c.SetCookie(oidcStateCookie, state+"."+nonce+"."+link, oidcStateMaxAge, "/api/auth/oidc", "", true, true)
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(s.oidcClientConfig(config), state, nonce))
+}
+
+// @Summary Link account to SSO
+// @Description Start linking the current user's account to their identity at the OpenID Connect provider
+// @Description SSO logins only sign in to accounts they provisioned or that were linked this way, never by matching emails
+// @Description Open login_url in the browser within 10 minutes; the callback links the account and logs in
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} OIDCLinkResponse
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/auth/oidc/link [post]
+func (s *Server) linkOIDCAccount(c *gin.Context) {
+	config, _, ok := s.loadOIDCProvider(c)
+	if !ok {
+		return
+	}
+	user, ok := s.findSessionUser(c)
+	if !ok {
+		return
+	}
+
+	token := randomHex(16)
+	if token == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start account link"})
+		return
+	}
+
+	cache := &s.oidc
+	cache.mu.Lock()
+	now := time.Now()
+	if cache.links == nil {
+		cache.links = map[string]oidcLink{}
+	}
+	for key, pending := range cache.links {
+		if now.After(pending.expiresAt) {
+			delete(cache.links, key)
+		}
+	}
+	cache.links[token] = oidcLink{userID: user.ID, expiresAt: now.Add(oidcStateMaxAge * time.Second)}
+	cache.mu.Unlock()
+
+	setAuditResource(c, user.ID)
+	setAuditDetail(c, "issuer", config.OIDCIssuerURL)
+
+	c.JSON(http.StatusOK, OIDCLinkResponse{LoginURL: "/api/auth/oidc/login?link=" + token})
+}
+
+// @Summary SSO login callback
+// @Description Completes an OpenID Connect login: users are provisioned on their first login,
+// @Description and are admins if they belong to one of oidc_admin_groups (when set)
+// @Description Group memberships follow the groups claim for groups with an oidc_group
+// @Description The provider must assert a verified email; existing password accounts must be linked first (POST /api/auth/oidc/link)
+// @Description Redirects to the web UI login page with #token=<JWT> or #error=<message>
+// @Tags auth
+// @Param code query string true "Authorization code"
+// @Param state query string true "State of the login request"
+// @Success 302
+// @Router /api/auth/oidc/callback [get]
+func (s *Server) oidcCallback(c *gin.Context) {
+	config, provider, ok := s.loadOIDCProvider(c)
+	if !ok {
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		s.redirectOIDCError(c, "Login failed at the identity provider: "+providerErr+" "+c.Query("error_description"))
+		return
+	}
+
+	// The state must match the cookie set by oidcLogin, so a callback can't be replayed into another browser
+	cookie, err := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", true, true)
+	parts := strings.Split(cookie, ".")
+	if err != nil || len(parts) != 3 || c.Query("state") != parts[0] {
+		s.redirectOIDCError(c, "Login expired or was started in another browser, try again")
+		return
+	}
+	nonce, link := parts[1], parts[2]
+
+	claims, err := provider.Exchange(c.Request.Context(), s.oidcClientConfig(config), c.Query("code"), nonce)
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("OIDC login failed")
+		s.redirectOIDCError(c, "Login failed: "+err.Error())
+		return
+	}
+
+	linkUserID := ""
+	if link != "" {
+		if linkUserID = s.consumeOIDCLink(link); linkUserID == "" {
+			s.redirectOIDCError(c, "Account link expired, start it again from your account")
+			return
+		}
+	}
+
+	user, provisioned, err := s.provisionOIDCUser(config, claims, linkUserID)
+	if errors.Is(err, errOIDCAccountNotLinked) {
+		s.logger.Warn().Str("email", claims.Email).Msg("SSO login of an account that isn't linked to SSO")
+		s.redirectOIDCError(c, "An account with this email already exists. Sign in with your password and link SSO from your account first")
+		return
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("email", claims.Email).Msg("Failed to provision SSO user")
+		s.redirectOIDCError(c, "Failed to provision user")
+		return
+	}
+
+	token, err := auth.GenerateToken(user.ID, user.Email, user.IsAdmin)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to generate token")
+		s.redirectOIDCError(c, "Failed to generate token")
+		return
+	}
+
+	s.logger.Info().
+		Str("user_id", user.ID).
+		Str("email", user.Email).
+		Bool("provisioned", provisioned).
+		Bool("is_admin", user.IsAdmin).
+		Msg("User logged in with SSO")
+
+	if provisioned || linkUserID != "" {
+		setAuditUser(c, user)
+		setAuditResource(c, user.ID)
+		setAuditDetail(c, "email", user.Email)
+		setAuditDetail(c, "is_admin", strconv.FormatBool(user.IsAdmin))
+		if linkUserID != "" {
+			setAuditDetail(c, "linked", "true")
+		}
+	}
+
+	// Fragments aren't sent to servers, so the token doesn't end up in proxy logs
+	c.Redirect(http.StatusFound, oidcLoginPage+"#token="+url.QueryEscape(token))
+}
+
+// provisionOIDCUser finds the user of an SSO login by subject, creating it on the first login
+// linkUserID links that account to the subject instead (the user started POST /api/auth/oidc/link)
+// With admin groups configured, the admin role follows the user's groups on every login
+func (s *Server) provisionOIDCUser(config *models.Config, claims *auth.OIDCClaims, linkUserID string) (*models.User, bool, error) {
+	adminGroups := splitCommaList(config.OIDCAdminGroups)
+	isAdmin := false
+	for _, group := range claims.Groups {
+		for _, adminGroup := range adminGroups {
+			if strings.EqualFold(group, adminGroup) {
+				isAdmin = true
+			}
+		}
+	}
+
+	var user models.User
+	provisioned := false
+	err := s.db.Where("oidc_subject = ?", claims.Subject).First(&user).Error
+	switch {
+	case linkUserID != "":
+		if err == nil && user.ID != linkUserID {
+			return nil, false, fmt.Errorf("SSO identity is already linked to %s", user.Email)
+		}
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return nil, false, err
+		}
+		if err := s.db.Where("id = ?", linkUserID).First(&user).Error; err != nil {
+			return nil, false, err
+		}
+		if err := s.db.Model(&user).Update("oidc_subject", claims.Subject).Error; err != nil {
+			return nil, false, err
+		}
+		s.logger.Info().Str("user_id", user.ID).Str("email", user.Email).Msg("Linked account to SSO")
+
+	case err == gorm.ErrRecordNotFound:
+		err = s.db.Where("LOWER(email) = ?", strings.ToLower(claims.Email)).First(&user).Error
+		if err == nil {
+			// Accounts SSO provisioned before subjects were recorded have no password, anything else needs an explicit link
+			if user.PasswordHash != "" || user.OIDCSubject != "" {
+				return nil, false, errOIDCAccountNotLinked
+			}
+			if err := s.db.Model(&user).Update("oidc_subject", claims.Subject).Error; err != nil {
+				return nil, false, err
+			}
+			break
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, false, err
+		}
+
+		name := claims.Name
+		if name == "" {
+			name = claims.Email
+		}
+		user = models.User{
+			Email:        claims.Email,
+			PasswordHash: "", // SSO users can't log in with a password
+			Name:         name,
+			IsAdmin:      isAdmin,
+			OIDCSubject:  claims.Subject,
+		}
+		if err := s.db.Create(&user).Error; err != nil {
+			return nil, false, err
+		}
+		provisioned = true
+
+	case err != nil:
+		return nil, false, err
+	}
+
+	s.syncOIDCGroups(&user, claims.Groups)
+	if provisioned {
+		return &user, true, nil
+	}
+
+	if len(adminGroups) == 0 || user.IsAdmin == isAdmin {
+		return &user, false, nil
+	}
+
+	// Never demote the last admin, nobody could fix the group mapping afterwards
+	if !isAdmin {
+		var admins int64
+		if err := s.db.Model(&models.User{}).Where("is_admin = ?", true).Count(&admins).Error; err != nil {
+			return nil, false, err
+		}
+		if admins <= 1 {
+			s.logger.Warn().Str("email", user.Email).Msg("Not removing admin role of the last admin, who isn't in an OIDC admin group")
+			return &user, false, nil
+		}
+	}
+
+	if err := s.db.Model(&user).Update("is_admin", isAdmin).Error; err != nil {
+		return nil, false, err
+	}
+	s.logger.Info().Str("email", user.Email).Bool("is_admin", isAdmin).Msg("Updated admin role from OIDC groups")
+	return &user, false, nil
+}
+
+// loadOIDCProvider loads the config and the discovered provider, writing the error response if SSO isn't available
+func (s *Server) loadOIDCProvider(c *gin.Context) (*models.Config, *auth.OIDCProvider, bool) {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil && err != gorm.ErrRecordNotFound {
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, nil, false
+	}
+	if !oidcEnabled(&config) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SSO login is not configured"})
+		return nil, nil, false
+	}
+
+	provider, err := s.oidcProvider(c.Request.Context(), config.OIDCIssuerURL)
+	if err != nil {
+		s.logger.Error().Err(err).Str("issuer", config.OIDCIssuerURL).Msg("Failed to discover OIDC provider")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return nil, nil, false
+	}
+	return &config, provider, true
+}
+
+// oidcProvider returns the discovered provider of an issuer, cached for oidcProviderTTL
+// The cached provider also keeps the signing keys, which are refetched when they rotate
+func (s *Server) oidcProvider(ctx context.Context, issuerURL string) (*auth.OIDCProvider, error) {
+	cache := &s.oidc
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.provider != nil && cache.issuerURL == issuerURL && time.Now().Before(cache.expiresAt) {
+		return cache.provider, nil
+	}
+
+	provider, err := auth.DiscoverOIDC(ctx, issuerURL)
+	if err != nil {
+		return nil, err
+	}
+	cache.issuerURL = issuerURL
+	cache.provider = provider
+	cache.expiresAt = time.Now().Add(oidcProviderTTL)
+	return provider, nil
+}
+
+// oidcClientConfig returns the client settings, the redirect URL is on the configured domain
+// The request's Host header is never used, it's chosen by the client
+// The groups scope is requested when admin groups or groups synced from SSO (Group.OIDCGroup) are configured
+func (s *Server) oidcClientConfig(config *models.Config) auth.OIDCConfig {
+	groupsScope := config.OIDCAdminGroups != ""
+	if !groupsScope {
+		var mapped int64
+		if err := s.db.Model(&models.Group{}).Where("oidc_group <> ''").Count(&mapped).Error; err != nil {
+			s.logger.Warn().Err(err).Msg("Failed to count groups mapped to SSO groups")
+		}
+		groupsScope = mapped > 0
+	}
+
+	return auth.OIDCConfig{
+		ClientID:     config.OIDCClientID,
+		ClientSecret: config.OIDCClientSecret,
+		RedirectURL:  "https://" + config.Domain + "/api/auth/oidc/callback",
+		GroupsScope:  groupsScope,
+	}
+}
+
+// syncOIDCGroups adds the user to the groups mapped to its IdP groups (Group.OIDCGroup) and removes it from the others
+// Groups without a mapping are left alone; failures are logged, the login goes on with the previous memberships
+func (s *Server) syncOIDCGroups(user *models.User, claimGroups []string) {
+	var groups []models.Group
+	if err := s.db.Where("oidc_group <> ''").Find(&groups).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load groups mapped to SSO groups")
+		return
+	}
+
+	for _, group := range groups {
+		member := false
+		for _, claimGroup := range claimGroups {
+			if strings.EqualFold(claimGroup, group.OIDCGroup) {
+				member = true
+			}
+		}
+
+		var err error
+		if member {
+			err = s.db.Where(models.GroupMember{GroupID: group.ID, UserID: user.ID}).
+				FirstOrCreate(&models.GroupMember{}).Error
+		} else {
+			err = s.db.Where("group_id = ? AND user_id = ?", group.ID, user.ID).Delete(&models.GroupMember{}).Error
+		}
+		if err != nil {
+			s.logger.Error().Err(err).Str("group", group.Name).Str("email", user.Email).Msg("Failed to sync SSO group membership")
+		}
+	}
+}
+
+// pendingOIDCLink reports whether a link token was issued and hasn't expired
+func (s *Server) pendingOIDCLink(token string) bool {
+	cache := &s.oidc
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	pending, ok := cache.links[token]
+	return ok && time.Now().Before(pending.expiresAt)
+}
+
+// consumeOIDCLink returns the user of a pending link token and removes it ("" if it's unknown or expired)
+func (s *Server) consumeOIDCLink(token string) string {
+	cache := &s.oidc
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	pending, ok := cache.links[token]
+	delete(cache.links, token)
+	if !ok || time.Now().After(pending.expiresAt) {
+		return ""
+	}
+	return pending.userID
+}
+
+// redirectOIDCError sends the browser back to the login page with the error
+func (s *Server) redirectOIDCError(c *gin.Context, message string) {
+	c.Redirect(http.StatusFound, oidcLoginPage+"#error="+url.QueryEscape(strings.TrimSpace(message)))
+}
+
+// oidcEnabled reports whether SSO login is configured
+// The domain is required: the callback URL registered at the provider must not depend on the request
+func oidcEnabled(config *models.Config) bool {
+	return config.OIDCIssuerURL != "" && config.OIDCClientID != "" && config.Domain != ""
+}
+
+// splitCommaList splits a comma-separated setting, dropping empty entries
+func splitCommaList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// randomHex returns n random bytes as hex, or "" if the system's randomness is unavailable
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
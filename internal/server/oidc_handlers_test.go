@@ -0,0 +1,152 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func oidcClaims(subject, email string, groups ...string) *auth.OIDCClaims {
+	return &auth.OIDCClaims{
+		Email:            email,
+		Groups:           groups,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: subject},
+	}
+}
+
+func TestProvisionOIDCUser(t *testing.T) {
+	s := newTestServer(t)
+	config := &models.Config{OIDCAdminGroups: "platform"}
+
+	admin := &models.User{Email: "admin@example.com", PasswordHash: "hash", IsAdmin: true}
+	createTestUser(t, s, admin)
+
+	// An IdP user asserting an existing account's email doesn't get it
+	if _, _, err := s.provisionOIDCUser(config, oidcClaims("okta|attacker", "Admin@example.com"), ""); !errors.Is(err, errOIDCAccountNotLinked) {
+		t.Fatalf("provisionOIDCUser(existing email) error = %v, want errOIDCAccountNotLinked", err)
+	}
+
+	// The account owner links it explicitly, later logins find it by subject
+	user, provisioned, err := s.provisionOIDCUser(config, oidcClaims("okta|admin", "admin@example.com", "platform"), admin.ID)
+	if err != nil {
+		t.Fatalf("provisionOIDCUser(link) error = %v", err)
+	}
+	if provisioned || user.ID != admin.ID {
+		t.Errorf("provisionOIDCUser(link) = %s (provisioned %v), want %s", user.ID, provisioned, admin.ID)
+	}
+	user, _, err = s.provisionOIDCUser(config, oidcClaims("okta|admin", "renamed@example.com", "platform"), "")
+	if err != nil || user.ID != admin.ID {
+		t.Fatalf("provisionOIDCUser(linked subject) = %v, %v, want %s", user, err, admin.ID)
+	}
+
+	// An identity links to one account only
+	other := &models.User{Email: "other@example.com", PasswordHash: "hash"}
+	createTestUser(t, s, other)
+	if _, _, err := s.provisionOIDCUser(config, oidcClaims("okta|admin", "other@example.com"), other.ID); err == nil {
+		t.Error("provisionOIDCUser() linked an identity that belongs to another account")
+	}
+
+	// New users are provisioned with their subject and admin role from groups
+	user, provisioned, err = s.provisionOIDCUser(config, oidcClaims("okta|new", "new@example.com", "Platform"), "")
+	if err != nil {
+		t.Fatalf("provisionOIDCUser(new) error = %v", err)
+	}
+	if !provisioned || user.OIDCSubject != "okta|new" || !user.IsAdmin || user.PasswordHash != "" {
+		t.Errorf("provisionOIDCUser(new) = %+v (provisioned %v)", user, provisioned)
+	}
+
+	// Accounts SSO provisioned before subjects were recorded have no password and are linked on their next login
+	legacy := &models.User{Email: "legacy@example.com"}
+	createTestUser(t, s, legacy)
+	user, provisioned, err = s.provisionOIDCUser(config, oidcClaims("okta|legacy", "legacy@example.com"), "")
+	if err != nil || provisioned || user.ID != legacy.ID {
+		t.Fatalf("provisionOIDCUser(legacy) = %v, %v, %v, want %s", user, provisioned, err, legacy.ID)
+	}
+	var reloaded models.User
+	s.db.First(&reloaded, "id = ?", legacy.ID)
+	if reloaded.OIDCSubject != "okta|legacy" {
+		t.Errorf("legacy OIDCSubject = %q, want okta|legacy", reloaded.OIDCSubject)
+	}
+}
+
+func TestOIDCLinks(t *testing.T) {
+	s := newTestServer(t)
+	s.oidc.links = map[string]oidcLink{}
+
+	if s.pendingOIDCLink("unknown") {
+		t.Error("pendingOIDCLink(unknown) = true")
+	}
+
+	s.oidc.links["token"] = oidcLink{userID: "user-1", expiresAt: time.Now().Add(time.Minute)}
+	s.oidc.links["expired"] = oidcLink{userID: "user-2", expiresAt: time.Now().Add(-time.Second)}
+	if s.pendingOIDCLink("expired") || s.consumeOIDCLink("expired") != "" {
+		t.Error("expired link accepted")
+	}
+	if !s.pendingOIDCLink("token") {
+		t.Error("pendingOIDCLink(token) = false")
+	}
+	if got := s.consumeOIDCLink("token"); got != "user-1" {
+		t.Errorf("consumeOIDCLink() = %q, want user-1", got)
+	}
+	if got := s.consumeOIDCLink("token"); got != "" {
+		t.Errorf("consumeOIDCLink() twice = %q, want empty", got)
+	}
+}
+
+func TestOIDCClientConfigUsesDomain(t *testing.T) {
+	s := newTestServer(t)
+	config := &models.Config{OIDCIssuerURL: "https://company.okta.com", OIDCClientID: "client"}
+	if oidcEnabled(config) {
+		t.Error("oidcEnabled() without a domain = true")
+	}
+	config.Domain = "db.example.com"
+	if !oidcEnabled(config) {
+		t.Error("oidcEnabled() = false")
+	}
+	if got := s.oidcClientConfig(config).RedirectURL; got != "https://db.example.com/api/auth/oidc/callback" {
+		t.Errorf("RedirectURL = %q", got)
+	}
+}
+
+func TestSyncOIDCGroups(t *testing.T) {
+	s := newTestServer(t)
+	user := &models.User{Email: "dev@example.com"}
+	createTestUser(t, s, user)
+
+	qa := models.Group{Name: "qa", OIDCGroup: "QA-Team"}
+	contractors := models.Group{Name: "contractors", OIDCGroup: "contractors"}
+	manual := models.Group{Name: "manual"}
+	for _, group := range []*models.Group{&qa, &contractors, &manual} {
+		if err := s.db.Create(group).Error; err != nil {
+			t.Fatalf("failed to create group: %v", err)
+		}
+	}
+	for _, groupID := range []string{contractors.ID, manual.ID} {
+		if err := s.db.Create(&models.GroupMember{GroupID: groupID, UserID: user.ID}).Error; err != nil {
+			t.Fatalf("failed to add member: %v", err)
+		}
+	}
+
+	members := func() map[string]bool {
+		var rows []models.GroupMember
+		s.db.Where("user_id = ?", user.ID).Find(&rows)
+		got := map[string]bool{}
+		for _, row := range rows {
+			got[row.GroupID] = true
+		}
+		return got
+	}
+
+	for i := 0; i < 2; i++ { // Idempotent
+		s.syncOIDCGroups(user, []string{"qa-team", "engineering"})
+		got := members()
+		if !got[qa.ID] || got[contractors.ID] || !got[manual.ID] || len(got) != 2 {
+			t.Errorf("memberships after sync %d = %v, want qa and manual", i+1, got)
+		}
+	}
+}
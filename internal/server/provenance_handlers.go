@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// maxLineageDepth bounds the restores followed from a branch back to its source
+const maxLineageDepth = 20
+
+// BranchProvenance is the source state a branch was derived from
+type BranchProvenance struct {
+	BranchID        string    `json:"branch_id"`
+	BranchName      string    `json:"branch_name"`
+	BranchCreatedAt time.Time `json:"branch_created_at"`
+
+	// The branch's restore first, then the restores it was cloned or promoted from back to the source's restore
+	Restores []RestoreLineage `json:"restores"`
+
+	// Provenance of the last restore, nil if it wasn't recorded (e.g. restores from before provenance was recorded)
+	Provenance *models.RestoreProvenance `json:"provenance"`
+}
+
+// RestoreLineage is one restore a branch was derived from
+type RestoreLineage struct {
+	ID                 string     `json:"id"`
+	Name               string     `json:"name"`
+	ReadyAt            *time.Time `json:"ready_at"`
+	ClonedFromID       string     `json:"cloned_from_id,omitempty"`
+	PromotedFromBranch string     `json:"promoted_from_branch,omitempty"`
+	AdoptedFrom        string     `json:"adopted_from,omitempty"`
+	Deleted            bool       `json:"deleted,omitempty"` // The restore no longer exists, only its ID is known
+}
+
+// @Summary Get branch provenance
+// @Description Which production state a branch was derived from: its restore, the restores that one was cloned or
+// @Description promoted from, and the source host, LSNs, tool versions and dump checksums of the original restore
+// @Tags branches
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch ID, short ID or name"
+// @Success 200 {object} BranchProvenance
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branches/{id}/provenance [get]
+func (s *Server) getBranchProvenance(c *gin.Context) {
+	branchID := c.Param("id")
+
+	var branch models.Branch
+	if err := models.FindBranch(s.db, branchID, &branch); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("branch_id", branchID).Msg("Failed to find branch")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	restores, provenance, err := s.restoreLineage(branch.RestoreID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("branch_id", branch.ID).Msg("Failed to load branch lineage")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, BranchProvenance{
+		BranchID:        branch.ID,
+		BranchName:      branch.Name,
+		BranchCreatedAt: branch.CreatedAt,
+		Restores:        restores,
+		Provenance:      provenance,
+	})
+}
+
+// restoreLineage follows a restore's clone and promotion origins until a restore with recorded provenance
+// Clones and promotions copy their origin's data, the origin's provenance applies to them
+func (s *Server) restoreLineage(restoreID string) ([]RestoreLineage, *models.RestoreProvenance, error) {
+	var lineage []RestoreLineage
+	for range maxLineageDepth {
+		var restore models.Restore
+		if err := s.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				lineage = append(lineage, RestoreLineage{ID: restoreID, Deleted: true})
+				return lineage, nil, nil
+			}
+			return nil, nil, err
+		}
+		lineage = append(lineage, RestoreLineage{
+			ID:                 restore.ID,
+			Name:               restore.Name,
+			ReadyAt:            restore.ReadyAt,
+			ClonedFromID:       restore.ClonedFromID,
+			PromotedFromBranch: restore.PromotedFromBranch,
+			AdoptedFrom:        restore.AdoptedFrom,
+		})
+
+		if restore.Provenance != nil {
+			return lineage, restore.Provenance, nil
+		}
+		switch {
+		case restore.ClonedFromID != "":
+			restoreID = restore.ClonedFromID
+		case restore.PromotedFromRestoreID != "":
+			restoreID = restore.PromotedFromRestoreID
+		default:
+			return lineage, nil, nil
+		}
+	}
+	return lineage, nil, nil
+}
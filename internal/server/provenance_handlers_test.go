@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestGetBranchProvenance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	readyAt := time.Now()
+	source := models.Restore{Name: "restore_20250101000000", SchemaReady: true, ReadyAt: &readyAt, Provenance: &models.RestoreProvenance{
+		Method:            "logical",
+		SourceHost:        "db.example.com:5432",
+		StartLSN:          "0/3000028",
+		Artifacts:         []models.RestoreArtifact{{Name: "dump.pgdump", SizeBytes: 1024, SHA256: "9f86d081"}},
+		ChecksumsVerified: true,
+	}}
+	if err := s.db.Create(&source).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	clone := models.Restore{Name: "restore_20250102000000", SchemaReady: true, ReadyAt: &readyAt, ClonedFromID: source.ID}
+	if err := s.db.Create(&clone).Error; err != nil {
+		t.Fatalf("failed to create clone: %v", err)
+	}
+	branch := models.Branch{Name: "feature-x", RestoreID: clone.ID, CreatedByID: "user-1", User: "u", Password: "p", Port: 6001}
+	if err := s.db.Create(&branch).Error; err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/branches/feature-x/provenance", nil)
+	c.Params = gin.Params{{Key: "id", Value: "feature-x"}}
+	s.getBranchProvenance(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("getBranchProvenance() status = %d: %s", w.Code, w.Body.String())
+	}
+	var got BranchProvenance
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(got.Restores) != 2 || got.Restores[0].ID != clone.ID || got.Restores[1].ID != source.ID {
+		t.Errorf("restores = %+v, want the clone, then its source", got.Restores)
+	}
+	if got.Provenance == nil || got.Provenance.SourceHost != "db.example.com:5432" || len(got.Provenance.Artifacts) != 1 || !got.Provenance.ChecksumsVerified {
+		t.Errorf("provenance = %+v, want the source restore's", got.Provenance)
+	}
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/purge"
+)
+
+// purgeTimeout bounds a purge across all restores and branches
+const purgeTimeout = time.Hour
+
+// CreatePurgeRequest represents a request to erase a data subject's rows
+type CreatePurgeRequest struct {
+	SubjectID string `json:"subject_id" binding:"required"` // Value of the purge key columns, e.g. the user's ID
+	Reference string `json:"reference"`                     // e.g. the ticket of the erasure request
+}
+
+// @Summary Purge data subject
+// @Description Delete a data subject's rows (e.g. for a GDPR erasure request) from all ready restores and all branches,
+// @Description using the purge_key_columns setting. Suspended branches are resumed first
+// @Description Runs in the background, the returned record is the proof of deletion once completed (admin only)
+// @Description Only a SHA-256 of subject_id is stored. The rows remain in the source database (purge it there too)
+// @Description and in the ZFS snapshots of existing branches until those branches are deleted
+// @Tags purges
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreatePurgeRequest true "Data subject"
+// @Success 202 {object} models.PurgeRequest
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/purges [post]
+func (s *Server) createPurge(c *gin.Context) {
+	var req CreatePurgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	keys, err := purge.ParseKeyColumns(config.PurgeKeyColumns)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purge key columns", "details": err.Error()})
+		return
+	}
+	if len(keys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No purge key columns configured, set purge_key_columns first"})
+		return
+	}
+
+	// Restores in progress would become ready with the subject's rows after the purge skipped them
+	var inProgress int64
+	if err := s.db.Model(&models.Restore{}).
+		Where("failed_at IS NULL AND (NOT (schema_ready = ? AND data_ready = ?) OR refreshing_since IS NOT NULL)", true, true).
+		Count(&inProgress).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to count restores in progress")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if inProgress > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":                "Restores are in progress, purge once they finished (or delete them)",
+			"restores_in_progress": inProgress,
+		})
+		return
+	}
+
+	request := models.PurgeRequest{
+		SubjectHash: purge.HashSubject(req.SubjectID),
+		Reference:   req.Reference,
+		KeyColumns:  config.PurgeKeyColumns,
+		Status:      models.PurgeStatusRunning,
+	}
+	if sessionData, exists := GetSessionData(c); exists {
+		request.RequestedByID = sessionData.UserID
+		request.RequestedByEmail = sessionData.Email
+	}
+	if err := s.db.Create(&request).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create purge request")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purge request"})
+		return
+	}
+
+	setAuditResource(c, request.ID)
+	setAuditDetail(c, "subject_hash", request.SubjectHash)
+	setAuditDetail(c, "reference", request.Reference)
+
+	// Runs in the server rather than as a task, so the subject identifier is never persisted in the queue
+	// Purges interrupted by a restart are failed by FailInterruptedPurges and must be submitted again
+	go s.runPurge(&request, keys, req.SubjectID, &config)
+
+	c.JSON(http.StatusAccepted, request)
+}
+
+// @Summary List purges
+// @Description List data subject purges, newest first (admin only)
+// @Tags purges
+// @Produce json
+// @Security BearerAuth
+// @Param subject_id query string false "Only purges of this data subject (matched by hash)"
+// @Success 200 {array} models.PurgeRequest
+// @Router /api/purges [get]
+func (s *Server) listPurges(c *gin.Context) {
+	query := s.db.Model(&models.PurgeRequest{})
+	if subjectID := c.Query("subject_id"); subjectID != "" {
+		query = query.Where("subject_hash = ?", purge.HashSubject(subjectID))
+	}
+
+	var list []models.PurgeRequest
+	if err := query.Order("created_at DESC").Find(&list).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list purge requests")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Get purge
+// @Description Get a data subject purge with the rows deleted from each restore and branch (admin only)
+// @Tags purges
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Purge ID"
+// @Success 200 {object} models.PurgeRequest
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/purges/{id} [get]
+func (s *Server) getPurge(c *gin.Context) {
+	var request models.PurgeRequest
+	if err := s.db.Where("id = ?", c.Param("id")).First(&request).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Purge not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("purge_id", c.Param("id")).Msg("Failed to find purge request")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+// runPurge deletes the subject's rows from every ready restore and branch, recording each target's result
+func (s *Server) runPurge(request *models.PurgeRequest, keys []purge.KeyColumn, subjectID string, config *models.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), purgeTimeout)
+	defer cancel()
+
+	logger := s.logger.With().Str("purge_id", request.ID).Logger()
+	logger.Info().Int("key_columns", len(keys)).Msg("Purge started")
+
+	// Same target database resolution as applyAnonymization
+	databaseName := config.DatabaseName
+	if config.CrunchyBridgeAPIKey != "" {
+		databaseName = config.CrunchyBridgeDatabaseName
+	}
+
+	var restores []models.Restore
+	if err := s.db.Where("schema_ready = ? AND data_ready = ?", true, true).Order("created_at ASC").Find(&restores).Error; err != nil {
+		s.finishPurge(request, logger, "failed to list restores: "+err.Error())
+		return
+	}
+	var branchList []models.Branch
+	if err := s.db.Where("port > 0").Order("created_at ASC").Find(&branchList).Error; err != nil {
+		s.finishPurge(request, logger, "failed to list branches: "+err.Error())
+		return
+	}
+
+	apply := func(target models.PurgeTarget, port int) {
+		result, err := purge.Apply(ctx, keys, subjectID, purge.Params{
+			DatabaseName: databaseName,
+			PostgresPort: port,
+		}, logger)
+		if err != nil {
+			target.Error = err.Error()
+		} else {
+			target.Tables = result.Tables
+			target.MissingTables = result.Missing
+			target.Rows = result.Rows
+		}
+		target.CompletedAt = time.Now().UTC()
+
+		request.Targets = append(request.Targets, target)
+		request.RowsDeleted += target.Rows
+		if err := s.db.Model(request).Select("targets", "rows_deleted").Updates(request).Error; err != nil {
+			logger.Error().Err(err).Msg("Failed to record purge progress")
+		}
+	}
+
+	for _, restore := range restores {
+		apply(models.PurgeTarget{Type: "restore", ID: restore.ID, Name: restore.Name}, restore.Port)
+	}
+	for _, branch := range branchList {
+		target := models.PurgeTarget{Type: "branch", ID: branch.ID, Name: branch.Name}
+		if branch.SuspendedAt != nil {
+			if err := s.branchesService.ResumeBranch(ctx, branch.ID); err != nil {
+				target.Error = "failed to resume branch: " + err.Error()
+				target.CompletedAt = time.Now().UTC()
+				request.Targets = append(request.Targets, target)
+				continue
+			}
+		}
+		apply(target, branch.Port)
+	}
+
+	s.finishPurge(request, logger, "")
+}
+
+// finishPurge records the final status of a purge, failed if any target couldn't be purged
+func (s *Server) finishPurge(request *models.PurgeRequest, logger zerolog.Logger, failure string) {
+	status := models.PurgeStatusCompleted
+	failedTargets := 0
+	for _, target := range request.Targets {
+		if target.Error != "" {
+			failedTargets++
+		}
+	}
+	if failure != "" || failedTargets > 0 {
+		status = models.PurgeStatusFailed
+	}
+
+	now := time.Now().UTC()
+	request.Status = status
+	request.Error = failure
+	request.CompletedAt = &now
+	if err := s.db.Model(request).Select("status", "targets", "rows_deleted", "error", "completed_at").Updates(request).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to record purge result")
+	}
+
+	event := logger.Info()
+	if status == models.PurgeStatusFailed {
+		event = logger.Error().Str("error", failure)
+	}
+	event.
+		Str("status", status).
+		Int("targets", len(request.Targets)).
+		Int("failed_targets", failedTargets).
+		Int("rows_deleted", request.RowsDeleted).
+		Msg("Purge finished")
+}
+
+// FailInterruptedPurges fails purges left running by a previous server process, which stopped before all
+// targets were purged. The subject identifier isn't stored, so they can't be resumed and must be submitted again
+func FailInterruptedPurges(db *gorm.DB, logger zerolog.Logger) error {
+	now := time.Now().UTC()
+	result := db.Model(&models.PurgeRequest{}).
+		Where("status = ?", models.PurgeStatusRunning).
+		Updates(map[string]interface{}{
+			"status":       models.PurgeStatusFailed,
+			"error":        "interrupted by a server restart, submit the purge again",
+			"completed_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		logger.Warn().Int64("purges", result.RowsAffected).Msg("Failed purges interrupted by a server restart")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestFailInterruptedPurges(t *testing.T) {
+	s := newTestServer(t)
+	running := models.PurgeRequest{SubjectHash: "a", Status: models.PurgeStatusRunning}
+	completed := models.PurgeRequest{SubjectHash: "b", Status: models.PurgeStatusCompleted}
+	for _, request := range []*models.PurgeRequest{&running, &completed} {
+		if err := s.db.Create(request).Error; err != nil {
+			t.Fatalf("failed to create purge request: %v", err)
+		}
+	}
+
+	if err := FailInterruptedPurges(s.db, zerolog.Nop()); err != nil {
+		t.Fatalf("FailInterruptedPurges() error = %v", err)
+	}
+
+	var got models.PurgeRequest
+	s.db.First(&got, "id = ?", running.ID)
+	if got.Status != models.PurgeStatusFailed || got.Error == "" || got.CompletedAt == nil {
+		t.Errorf("interrupted purge = %+v, want failed with an error", got)
+	}
+	var unchanged models.PurgeRequest
+	s.db.First(&unchanged, "id = ?", completed.ID)
+	if unchanged.Status != models.PurgeStatusCompleted {
+		t.Errorf("completed purge status = %q, want unchanged", unchanged.Status)
+	}
+}
+
+func TestCreatePurgeRejectsRestoresInProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+	if err := s.db.Create(&models.Config{PurgeKeyColumns: "public.users.id"}).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	failedAt := time.Now()
+	refreshing := time.Now()
+	tests := []struct {
+		name    string
+		restore models.Restore
+		want    int
+	}{
+		{name: "restore running", restore: models.Restore{SchemaReady: true}, want: http.StatusConflict},
+		{name: "incremental refresh", restore: models.Restore{SchemaReady: true, DataReady: true, RefreshingSince: &refreshing}, want: http.StatusConflict},
+		{name: "failed restore", restore: models.Restore{FailedAt: &failedAt}, want: http.StatusAccepted},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.db.Where("1 = 1").Delete(&models.Restore{})
+			restore := tt.restore
+			restore.Name = "restore_" + string(rune('a'+i))
+			if err := s.db.Create(&restore).Error; err != nil {
+				t.Fatalf("failed to create restore: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/purges", strings.NewReader(`{"subject_id":"42"}`))
+			c.Request.Header.Set("Content-Type", "application/json")
+			s.createPurge(c)
+
+			if w.Code != tt.want {
+				t.Errorf("createPurge() status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// errorCodeQueueUnavailable is the "code" of responses to requests that need Redis while it's unavailable,
+// clients retry them after Retry-After seconds
+const errorCodeQueueUnavailable = "queue_unavailable"
+
+// queueRetryAfterSeconds is the Retry-After of queue_unavailable responses, a restarting Redis is usually back by then
+const queueRetryAfterSeconds = "30"
+
+// respondEnqueueError responds to a request whose task couldn't be enqueued
+// A Redis outage gets 503 with the queue_unavailable code, other errors 500 with message
+func (s *Server) respondEnqueueError(c *gin.Context, err error, message string) {
+	if errors.Is(err, tasks.ErrQueueUnavailable) {
+		c.Header("Retry-After", queueRetryAfterSeconds)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Task queue unavailable (Redis can't be reached), retry in a moment",
+			"code":  errorCodeQueueUnavailable,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// queueStatus pings Redis and returns whether it accepts tasks, nil without Redis
+func (s *Server) queueStatus(ctx context.Context) *tasks.QueueStatus {
+	if s.queueClient == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	_ = s.queueClient.Ping(ctx) // Recorded in the status
+
+	status := s.queueClient.Status()
+	count, err := tasks.BufferedCount(s.db)
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to count buffered tasks")
+	}
+	status.BufferedTasks = count
+	return &status
+}
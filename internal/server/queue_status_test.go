@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+func TestRespondEnqueueError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	s.respondEnqueueError(c, fmt.Errorf("%w: dial tcp: connection refused", tasks.ErrQueueUnavailable), "Failed to start export")
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusServiceUnavailable || body.Code != errorCodeQueueUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("outage response = %d, code %q, Retry-After %q; want 503 queue_unavailable", w.Code, body.Code, w.Header().Get("Retry-After"))
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	s.respondEnqueueError(c, errors.New("task rejected"), "Failed to start export")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("other error response = %d, want 500", w.Code)
+	}
+}
+
+func TestReadinessCheckWithoutRedis(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+	s.readinessCheck(c)
+
+	var readiness ReadinessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &readiness); err != nil {
+		t.Fatalf("failed to decode readiness: %v", err)
+	}
+	if w.Code != http.StatusOK || readiness.Status != "ready" || !readiness.Database || readiness.Queue != nil {
+		t.Errorf("readiness = %d %+v; want ready without queue status", w.Code, readiness)
+	}
+}
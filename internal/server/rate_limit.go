@@ -0,0 +1,172 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// clientLimiterIdleTTL is how long the limiter of a token or IP without requests is kept
+const clientLimiterIdleTTL = 10 * time.Minute
+
+// requestLimiter enforces config.APIConfig's global and per-client rate limits
+type requestLimiter struct {
+	global *rate.Limiter // nil = no global limit
+
+	clientRate  rate.Limit
+	clientBurst int
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRequestLimiter(cfg config.APIConfig) *requestLimiter {
+	l := &requestLimiter{
+		clientRate:  rate.Limit(cfg.TokenRateLimit),
+		clientBurst: cfg.TokenRateBurst,
+		clients:     map[string]*clientLimiter{},
+		lastSweep:   time.Now(),
+	}
+	if cfg.RateLimit > 0 {
+		l.global = rate.NewLimiter(rate.Limit(cfg.RateLimit), cfg.RateBurst)
+	}
+	return l
+}
+
+// allow takes a request from the client's and the global budget
+// Returns how long the client should wait before retrying if either is exhausted
+func (l *requestLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	var clientReservation *rate.Reservation
+	if l.clientRate > 0 {
+		reservation, wait := reserve(l.clientLimiter(client, now), now)
+		if reservation == nil {
+			return false, wait
+		}
+		clientReservation = reservation
+	}
+	if l.global != nil {
+		if reservation, wait := reserve(l.global, now); reservation == nil {
+			// Requests the global limit rejects don't use up the client's budget
+			if clientReservation != nil {
+				clientReservation.CancelAt(now)
+			}
+			return false, wait
+		}
+	}
+	return true, 0
+}
+
+// clientLimiter returns the client's limiter, dropping the limiters of clients idle for clientLimiterIdleTTL
+func (l *requestLimiter) clientLimiter(client string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > clientLimiterIdleTTL {
+		for key, cl := range l.clients {
+			if now.Sub(cl.lastSeen) > clientLimiterIdleTTL {
+				delete(l.clients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	cl, ok := l.clients[client]
+	if !ok {
+		cl = &clientLimiter{limiter: rate.NewLimiter(l.clientRate, l.clientBurst)}
+		l.clients[client] = cl
+	}
+	cl.lastSeen = now
+	return cl.limiter
+}
+
+// reserve takes a token if one is available now, returning its reservation (to give it back with CancelAt),
+// otherwise returns nil and the wait until one is
+func reserve(limiter *rate.Limiter, now time.Time) (*rate.Reservation, time.Duration) {
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return nil, time.Second
+	}
+	if wait := reservation.DelayFrom(now); wait > 0 {
+		reservation.CancelAt(now)
+		return nil, wait
+	}
+	return reservation, 0
+}
+
+// rateLimitKey identifies the client of a request: the user of a valid bearer token, or its IP otherwise
+// Only the signature is checked here, so random or forged tokens can't mint fresh per-client budgets
+func rateLimitKey(c *gin.Context) string {
+	if token, err := extractBearerToken(c.GetHeader("Authorization")); err == nil {
+		if claims, err := auth.ValidateToken(token); err == nil {
+			return "user:" + claims.UserID
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// rateLimitMiddleware rejects requests over the configured rates with 429 and a Retry-After header
+// Health checks are never limited
+func (s *Server) rateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.URL.Path == "/health" || c.Request.URL.Path == "/health/ready" {
+			c.Next()
+			return
+		}
+
+		ok, wait := s.limiter.allow(rateLimitKey(c), time.Now())
+		if !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			s.logger.Warn().
+				Str("method", c.Request.Method).
+				Str("path", c.Request.URL.Path).
+				Str("client_ip", c.ClientIP()).
+				Int("retry_after", retryAfter).
+				Msg("Rate limit exceeded")
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, retry after " + strconv.Itoa(retryAfter) + "s"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// routeBodyLimits are routes whose bodies aren't bounded by config.APIConfig.MaxBodyBytes but by their own limit
+var routeBodyLimits = map[string]int64{
+	"/api/integrations/github/webhook": maxWebhookPayloadBytes,
+}
+
+// bodyLimitMiddleware rejects request bodies over config.APIConfig.MaxBodyBytes (or the route's own limit) with 413
+// Bodies without a Content-Length (chunked) fail to bind once they read past the limit
+func (s *Server) bodyLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maxBytes := s.config.API.MaxBodyBytes
+		if limit, ok := routeBodyLimits[c.FullPath()]; ok {
+			maxBytes = limit
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large (max " + strconv.FormatInt(maxBytes, 10) + " bytes)"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+
+		c.Next()
+	}
+}
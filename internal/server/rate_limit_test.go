@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	auth.InitializeJWT("rate-limit-test-secret")
+	token, err := auth.GenerateToken("user-1", "dev@example.com", false)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          string
+	}{
+		{name: "valid token", authorization: "Bearer " + token, want: "user:user-1"},
+		{name: "forged token", authorization: "Bearer " + token + "x", want: "ip:192.0.2.1"},
+		{name: "random token", authorization: "Bearer 3f9a0c", want: "ip:192.0.2.1"},
+		{name: "no token", want: "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/api/branches", nil)
+			c.Request.RemoteAddr = "192.0.2.1:51234"
+			if tt.authorization != "" {
+				c.Request.Header.Set("Authorization", tt.authorization)
+			}
+			if got := rateLimitKey(c); got != tt.want {
+				t.Errorf("rateLimitKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestLimiterClientBudget(t *testing.T) {
+	limiter := newRequestLimiter(config.APIConfig{RateLimit: 100, RateBurst: 100, TokenRateLimit: 1, TokenRateBurst: 2})
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow("ip:192.0.2.1", now); !ok {
+			t.Fatalf("request %d rejected within the burst", i+1)
+		}
+	}
+	ok, wait := limiter.allow("ip:192.0.2.1", now)
+	if ok {
+		t.Fatal("request over the burst allowed")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait = %v, want (0, 1s]", wait)
+	}
+
+	// Other clients keep their own budget
+	if ok, _ := limiter.allow("user:user-1", now); !ok {
+		t.Error("other client rejected")
+	}
+	if ok, _ := limiter.allow("ip:192.0.2.1", now.Add(time.Second)); !ok {
+		t.Error("request rejected after the budget refilled")
+	}
+}
+
+func TestRequestLimiterGlobalRejectionKeepsClientBudget(t *testing.T) {
+	limiter := newRequestLimiter(config.APIConfig{RateLimit: 1, RateBurst: 1, TokenRateLimit: 0.1, TokenRateBurst: 2})
+	now := time.Now()
+
+	// Another client uses up the global budget
+	if ok, _ := limiter.allow("ip:192.0.2.2", now); !ok {
+		t.Fatal("first request rejected")
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("ip:192.0.2.1", now); ok {
+			t.Fatalf("request %d allowed over the global limit", i+1)
+		}
+	}
+
+	// The global budget refills long before the client's would, the rejected requests didn't use it up
+	if ok, _ := limiter.allow("ip:192.0.2.1", now.Add(time.Second)); !ok {
+		t.Error("request rejected, want the client's budget untouched by globally rejected requests")
+	}
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	s := &Server{config: &config.Config{API: config.APIConfig{MaxBodyBytes: 1 << 10}}}
+	router := gin.New()
+	router.Use(s.bodyLimitMiddleware())
+	ok := func(c *gin.Context) { c.Status(200) }
+	router.POST("/api/branches", ok)
+	router.POST("/api/integrations/github/webhook", ok)
+
+	tests := []struct {
+		path string
+		size int
+		want int
+	}{
+		{path: "/api/branches", size: 1 << 10, want: 200},
+		{path: "/api/branches", size: 1<<10 + 1, want: 413},
+		{path: "/api/integrations/github/webhook", size: 1 << 20, want: 200},
+		{path: "/api/integrations/github/webhook", size: maxWebhookPayloadBytes + 1, want: 413},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("POST %s with %d bytes = %d, want %d", tt.path, tt.size, rec.Code, tt.want)
+		}
+	}
+}
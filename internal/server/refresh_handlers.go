@@ -0,0 +1,181 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+)
+
+// RefreshStatus is whether the scheduled refresh is due and what it waits for
+type RefreshStatus struct {
+	RefreshSchedule  string                   `json:"refresh_schedule"`
+	RefreshWindows   string                   `json:"refresh_windows"`
+	NextRefreshAt    *time.Time               `json:"next_refresh_at"`
+	Due              bool                     `json:"due"`
+	Forced           bool                     `json:"forced"`                   // Starts at the scheduler's next check without waiting
+	BlockedReason    string                   `json:"blocked_reason,omitempty"` // Why the due refresh waits, e.g. a branch creation in progress
+	BranchOperations []models.BranchOperation `json:"branch_operations"`        // In-flight branch creations refreshes wait for
+}
+
+// @Summary Get refresh status
+// @Description Whether the scheduled refresh is due, and whether it waits for its refresh window or in-flight branch creations
+// @Tags config
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} RefreshStatus
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/refresh [get]
+func (s *Server) getRefreshStatus(c *gin.Context) {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+			return
+		}
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	status, err := s.refreshStatus(&config, time.Now())
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to get refresh status")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// @Summary Force refresh
+// @Description Start the scheduled refresh within a minute, without waiting for its refresh window or in-flight
+// @Description branch creations; the schedule continues afterwards (admin only)
+// @Tags config
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} RefreshStatus
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/refresh/force [post]
+func (s *Server) forceRefresh(c *gin.Context) {
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+			return
+		}
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Without a schedule the refresh scheduler doesn't run, a restore has to be triggered instead
+	if config.RefreshSchedule == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No refresh schedule configured, trigger a restore instead"})
+		return
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&config).Updates(map[string]interface{}{
+		"refresh_forced":  true,
+		"next_refresh_at": now,
+	}).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to force refresh")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to force refresh"})
+		return
+	}
+	config.RefreshForced = true
+	config.NextRefreshAt = &now
+
+	status, err := s.refreshStatus(&config, now)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to get refresh status")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	setAuditResource(c, config.ID)
+	setAuditDetail(c, "branch_operations", strconv.Itoa(len(status.BranchOperations)))
+
+	c.JSON(http.StatusOK, status)
+}
+
+// refreshStatus builds the refresh status of config at now
+func (s *Server) refreshStatus(config *models.Config, now time.Time) (*RefreshStatus, error) {
+	status := &RefreshStatus{
+		RefreshSchedule:  config.RefreshSchedule,
+		RefreshWindows:   config.RefreshWindows,
+		NextRefreshAt:    config.NextRefreshAt,
+		Due:              config.RefreshSchedule != "" && (config.NextRefreshAt == nil || !config.NextRefreshAt.After(now)),
+		Forced:           config.RefreshForced,
+		BranchOperations: []models.BranchOperation{},
+	}
+
+	if err := s.db.Where("created_at > ?", now.Add(-models.BranchOperationTTL)).Order("created_at ASC").Find(&status.BranchOperations).Error; err != nil {
+		return nil, err
+	}
+
+	if status.Due {
+		reason, err := restore.RefreshBlocker(s.db, config, now)
+		if err != nil {
+			return nil, err
+		}
+		status.BlockedReason = reason
+	}
+	return status, nil
+}
+
+// maxRefreshHistoryDays bounds the days parameter of the refresh history
+const maxRefreshHistoryDays = 365
+
+// @Summary Get refresh history
+// @Description Every scheduled and manual refresh of the last days with its outcome, duration, bytes transferred and
+// @Description failure category, and the success rates over the last 1, 7, 30 and 90 days
+// @Tags config
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "Days of refresh runs to list (default 30)"
+// @Success 200 {object} restore.RefreshHistory
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/reports/refresh-history [get]
+func (s *Server) getRefreshHistory(c *gin.Context) {
+	days := 30
+	if daysStr := c.Query("days"); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d < 1 || d > maxRefreshHistoryDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and " + strconv.Itoa(maxRefreshHistoryDays)})
+			return
+		}
+		days = d
+	}
+
+	history, err := restore.GetRefreshHistory(s.db, time.Now(), days)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to get refresh history")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get refresh history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// startRefreshRun records a manually triggered restore in the refresh history
+// The restore goes ahead without it, the history would only miss this run
+func (s *Server) startRefreshRun(restoreModel *models.Restore) {
+	if err := restore.StartRefreshRun(s.db, restoreModel, models.RefreshTriggerManual, models.RefreshModeFull); err != nil {
+		s.logger.Warn().Err(err).Str("restore_id", restoreModel.ID).Msg("Failed to record refresh run")
+	}
+}
+
+// failRefreshRun records a manually triggered restore that couldn't be started as failed
+func (s *Server) failRefreshRun(restoreModel *models.Restore, reason string) {
+	if err := restore.FinishRefreshRun(s.db, restoreModel, models.RefreshOutcomeFailed, reason); err != nil {
+		s.logger.Warn().Err(err).Str("restore_id", restoreModel.ID).Msg("Failed to record refresh outcome")
+	}
+}
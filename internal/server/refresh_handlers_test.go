@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+)
+
+func TestForceRefresh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	config := models.Config{JWTSecret: "secret"}
+	if err := s.db.Create(&config).Error; err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	forceRefresh := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/refresh/force", nil)
+		s.forceRefresh(c)
+		return w
+	}
+
+	// Without a schedule there is no refresh to force
+	if w := forceRefresh(); w.Code != http.StatusBadRequest {
+		t.Fatalf("forceRefresh() without schedule status = %d, want 400", w.Code)
+	}
+
+	// A due refresh outside its window waiting for a branch creation
+	nextRefreshAt := time.Now().Add(-time.Minute)
+	now := time.Now().UTC()
+	window := now.Add(2*time.Hour).Format("15:04") + "-" + now.Add(3*time.Hour).Format("15:04")
+	if err := s.db.Model(&config).Updates(map[string]interface{}{
+		"refresh_schedule": "0 2 * * *",
+		"refresh_windows":  window,
+		"next_refresh_at":  nextRefreshAt,
+	}).Error; err != nil {
+		t.Fatalf("failed to update config: %v", err)
+	}
+	if err := s.db.Create(&models.BranchOperation{BranchName: "feature-x", Operation: "create"}).Error; err != nil {
+		t.Fatalf("failed to create branch operation: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/refresh", nil)
+	s.getRefreshStatus(c)
+	var status RefreshStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode refresh status: %v", err)
+	}
+	if !status.Due || status.BlockedReason == "" || len(status.BranchOperations) != 1 {
+		t.Errorf("refresh status = %+v, want a due refresh blocked by its window", status)
+	}
+
+	w = forceRefresh()
+	if w.Code != http.StatusOK {
+		t.Fatalf("forceRefresh() status = %d: %s", w.Code, w.Body.String())
+	}
+	var forced RefreshStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &forced); err != nil {
+		t.Fatalf("failed to decode refresh status: %v", err)
+	}
+	if !forced.Forced || !forced.Due || forced.BlockedReason != "" {
+		t.Errorf("forced refresh status = %+v, want due and unblocked", forced)
+	}
+
+	if err := s.db.First(&config).Error; err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if !config.RefreshForced {
+		t.Error("config refresh isn't forced")
+	}
+}
+
+func TestGetRefreshHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestServer(t)
+
+	if err := s.db.Create(&models.RefreshRun{RestoreID: "r1", RestoreName: "restore_20250101000000", Trigger: models.RefreshTriggerManual,
+		Mode: models.RefreshModeFull, Outcome: models.RefreshOutcomeSucceeded}).Error; err != nil {
+		t.Fatalf("failed to create refresh run: %v", err)
+	}
+
+	getHistory := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/reports/refresh-history"+query, nil)
+		s.getRefreshHistory(c)
+		return w
+	}
+
+	if w := getHistory("?days=0"); w.Code != http.StatusBadRequest {
+		t.Errorf("getRefreshHistory(days=0) status = %d, want 400", w.Code)
+	}
+
+	w := getHistory("")
+	if w.Code != http.StatusOK {
+		t.Fatalf("getRefreshHistory() status = %d, want 200", w.Code)
+	}
+	var history restore.RefreshHistory
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to decode refresh history: %v", err)
+	}
+	if history.Days != 30 || len(history.Runs) != 1 || len(history.Stats) != len(restore.RefreshStatsWindows) {
+		t.Errorf("refresh history = %d days, %d runs, %d stats; want 30 days with 1 run", history.Days, len(history.Runs), len(history.Stats))
+	}
+}
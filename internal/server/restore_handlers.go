@@ -2,10 +2,15 @@ package server
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,20 +19,38 @@ import (
 
 	"github.com/branchd-dev/branchd/internal/anonymize"
 	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
 	"github.com/branchd-dev/branchd/internal/tasks"
 )
 
 // @Summary List restores
-// @Description List all database restores
+// @Description List all database restores, optionally only those with a label or pinned
 // @Tags restores
 // @Produce json
 // @Security BearerAuth
+// @Param label query string false "Only restores with this label"
+// @Param pinned query bool false "Only pinned (true) or unpinned (false) restores"
 // @Success 200 {array} models.Restore
+// @Failure 400 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
 // @Router /api/restores [get]
 func (s *Server) listRestores(c *gin.Context) {
-	var restores []models.Restore
-	if err := s.db.Preload("Branches").Order("created_at ASC").Find(&restores).Error; err != nil {
+	query := s.db.Preload("Branches").Order("created_at ASC")
+	if label := c.Query("label"); label != "" {
+		query = query.Where("label = ?", label)
+	}
+	if pinned := c.Query("pinned"); pinned != "" {
+		value, err := strconv.ParseBool(pinned)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pinned must be true or false"})
+			return
+		}
+		query = query.Where("pinned = ?", value)
+	}
+
+	restores := []models.Restore{}
+	if err := query.Find(&restores).Error; err != nil {
 		s.logger.Error().Err(err).Msg("Failed to list restores")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list restores"})
 		return
@@ -63,15 +86,186 @@ func (s *Server) getRestore(c *gin.Context) {
 	c.JSON(http.StatusOK, restore)
 }
 
+// UpdateRestoreRequest changes the label, note or pin of a restore (nil fields are left unchanged)
+type UpdateRestoreRequest struct {
+	Label  *string `json:"label"` // Empty removes the label
+	Note   *string `json:"note"`
+	Pinned *bool   `json:"pinned"` // Pinned restores are kept by the retention policy, they need a label
+}
+
+// @Summary Update restore
+// @Description Label a restore, add a note or pin it so the retention policy keeps it until unpinned
+// @Description Pinned restores don't count towards max_restores, break-glass (raw) restores can't be pinned
+// @Tags restores
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Restore ID"
+// @Param request body UpdateRestoreRequest true "Update restore request"
+// @Success 200 {object} models.Restore
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/restores/{id} [patch]
+func (s *Server) updateRestore(c *gin.Context) {
+	restoreID := c.Param("id")
+
+	var req UpdateRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var record models.Restore
+	if err := s.db.Where("id = ?", restoreID).First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to find restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	setAuditDetail(c, "name", record.Name)
+
+	if req.Label != nil {
+		record.Label = strings.TrimSpace(*req.Label)
+	}
+	if req.Note != nil {
+		record.Note = strings.TrimSpace(*req.Note)
+	}
+	if req.Pinned != nil {
+		record.Pinned = *req.Pinned
+	}
+	if record.Pinned && record.Raw {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Break-glass restores end with their grant and can't be pinned"})
+		return
+	}
+	if err := restore.ValidateLabel(record.Label, record.Note, record.Pinned); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.Model(&record).Select("Label", "Note", "Pinned").Updates(&record).Error; err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to update restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update restore"})
+		return
+	}
+	setAuditDetail(c, "label", record.Label)
+	setAuditDetail(c, "pinned", strconv.FormatBool(record.Pinned))
+
+	c.JSON(http.StatusOK, record)
+}
+
+// @Summary Get restore comparison report
+// @Description Get the comparison between a restore and the restore before it (size, tables, tracked row counts)
+// @Tags restores
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Restore ID"
+// @Success 200 {object} models.RestoreReport
+// @Failure 404 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /api/restores/{id}/report [get]
+func (s *Server) getRestoreReport(c *gin.Context) {
+	restoreID := c.Param("id")
+
+	var report models.RestoreReport
+	if err := s.db.Where("restore_id = ?", restoreID).First(&report).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to find restore report")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// AnonymizationReportResponse lists the anonymization runs of a restore, newest first
+type AnonymizationReportResponse struct {
+	RestoreID   string           `json:"restore_id"`
+	RestoreName string           `json:"restore_name"`
+	Anonymized  bool             `json:"anonymized"` // The latest run succeeded
+	Runs        []models.AnonRun `json:"runs"`
+}
+
+// @Summary Get restore anonymization report
+// @Description List the anonymization runs of a restore with the rows each table's rules updated, newest first
+// @Description Runs are kept after the restore is deleted
+// @Tags restores
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Restore ID"
+// @Success 200 {object} AnonymizationReportResponse
+// @Failure 404 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /api/restores/{id}/anonymization-report [get]
+func (s *Server) getAnonymizationReport(c *gin.Context) {
+	restoreID := c.Param("id")
+
+	report := AnonymizationReportResponse{RestoreID: restoreID, Runs: []models.AnonRun{}}
+	if err := s.db.Where("restore_id = ?", restoreID).Order("created_at DESC").Find(&report.Runs).Error; err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to list anonymization runs")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var restore models.Restore
+	err := s.db.Where("id = ?", restoreID).First(&restore).Error
+	switch {
+	case err == nil:
+		report.RestoreName = restore.Name
+	case err != gorm.ErrRecordNotFound:
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to find restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	case len(report.Runs) == 0:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+		return
+	default:
+		report.RestoreName = report.Runs[0].RestoreName
+	}
+
+	if len(report.Runs) > 0 {
+		report.Anonymized = report.Runs[0].Status == models.AnonRunStatusSucceeded
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// @Summary List restore comparison reports
+// @Description List comparison reports of recent refreshes, newest first (reports outlive their restores)
+// @Tags restores
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.RestoreReport
+// @Failure 401 {object} map[string]interface{}
+// @Router /api/restore-reports [get]
+func (s *Server) listRestoreReports(c *gin.Context) {
+	var reports []models.RestoreReport
+	if err := s.db.Order("created_at DESC").Find(&reports).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list restore reports")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list restore reports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reports)
+}
+
 // @Summary Delete restore
-// @Description Delete a restore (only allowed if no branches exist)
+// @Description Delete a restore (only allowed if no branches or clones exist, see GET /api/restores/{id}/dependencies)
+// @Description With cascade=true its branches, clones and their branches are deleted first and schedules pinned to it disabled
 // @Tags restores
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Restore ID"
+// @Param cascade query bool false "Delete everything depending on the restore too"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/restores/{id} [delete]
 func (s *Server) deleteRestore(c *gin.Context) {
@@ -89,11 +283,41 @@ func (s *Server) deleteRestore(c *gin.Context) {
 		return
 	}
 
+	graph, err := s.dependencies.ForRestore(&restore)
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to load restore dependencies")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	setAuditDetail(c, "name", restore.Name)
+
+	if c.Query("cascade") == "true" {
+		s.cascadeDelete(c, graph)
+		return
+	}
+
 	// Check if restore has active branches
 	if len(restore.Branches) > 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error":    "Cannot delete restore with active branches",
-			"branches": len(restore.Branches),
+			"error":        "Cannot delete restore with active branches",
+			"branches":     len(restore.Branches),
+			"dependencies": graph,
+		})
+		return
+	}
+
+	// Check if restore has clones (their datasets depend on this restore's snapshots)
+	var cloneCount int64
+	if err := s.db.Model(&models.Restore{}).Where("cloned_from_id = ?", restore.ID).Count(&cloneCount).Error; err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to count restore clones")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if cloneCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":        "Cannot delete restore with clones",
+			"clones":       cloneCount,
+			"dependencies": graph,
 		})
 		return
 	}
@@ -109,17 +333,40 @@ func (s *Server) deleteRestore(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Restore deleted successfully"})
 }
 
+// TriggerRestoreRequest optionally labels a manually triggered restore
+type TriggerRestoreRequest struct {
+	Label  string `json:"label"`  // e.g. "pre-migration-baseline", lowercase letters, digits, '.', '_' and '-'
+	Note   string `json:"note"`   // Why the restore was taken
+	Pinned bool   `json:"pinned"` // Keep the restore until unpinned, needs a label
+}
+
 // @Summary Trigger database restore
-// @Description Manually trigger a database restore from the configured source
+// @Description Manually trigger a database restore from the configured source, optionally labeled and pinned
+// @Description Beyond max_concurrent_restores the restore is queued (queue_position > 0), or rejected with 409 if restore_queue_policy is "reject"
+// @Description While Redis is unavailable the trigger is buffered (202, buffered true) and enqueued once Redis is back
 // @Tags restores
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Param request body TriggerRestoreRequest false "Label, note and pin of the restore"
 // @Success 200 {object} map[string]interface{}
+// @Success 202 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/restores/trigger-restore [post]
 func (s *Server) triggerRestore(c *gin.Context) {
+	var req TriggerRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Label, req.Note = strings.TrimSpace(req.Label), strings.TrimSpace(req.Note)
+	if err := restore.ValidateLabel(req.Label, req.Note, req.Pinned); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var config models.Config
 	if err := s.db.First(&config).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -131,12 +378,13 @@ func (s *Server) triggerRestore(c *gin.Context) {
 		return
 	}
 
-	// Validate that a restore source is configured (either connection string or Crunchy Bridge)
+	// Validate that a restore source is configured (connection string, Crunchy Bridge or pgBackRest)
 	hasConnectionString := config.ConnectionString != ""
 	hasCrunchyBridge := config.CrunchyBridgeAPIKey != ""
+	hasPgBackRest := config.UsesPgBackRest()
 
-	if !hasConnectionString && !hasCrunchyBridge {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No restore source configured (need either connection string or Crunchy Bridge credentials)"})
+	if !hasConnectionString && !hasCrunchyBridge && !hasPgBackRest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No restore source configured (need either connection string, Crunchy Bridge credentials or a pgBackRest repository)"})
 		return
 	}
 
@@ -144,12 +392,18 @@ func (s *Server) triggerRestore(c *gin.Context) {
 		Str("config_id", config.ID).
 		Bool("has_connection_string", hasConnectionString).
 		Bool("has_crunchy_bridge", hasCrunchyBridge).
+		Bool("has_pgbackrest", hasPgBackRest).
 		Msg("Manually triggering restore")
 
+	orchestrator := s.restoresService.GetOrchestrator()
+	if !s.checkRestoreQueue(c, &config) {
+		return
+	}
+
 	// Determine schema-only flag
-	// Note: Crunchy Bridge (pgBackRest) doesn't support schema-only, only logical restore (pg_dump) does
+	// Note: Crunchy Bridge and pgBackRest restores don't support schema-only, only logical restore (pg_dump) does
 	schemaOnly := config.SchemaOnly
-	if hasCrunchyBridge {
+	if hasCrunchyBridge || hasPgBackRest {
 		schemaOnly = false
 	}
 
@@ -158,6 +412,9 @@ func (s *Server) triggerRestore(c *gin.Context) {
 		Name:       models.GenerateRestoreName(),
 		SchemaOnly: schemaOnly,
 		Port:       5432,
+		Label:      req.Label,
+		Note:       req.Note,
+		Pinned:     req.Pinned,
 	}
 
 	if err := s.db.Create(&restore).Error; err != nil {
@@ -165,6 +422,7 @@ func (s *Server) triggerRestore(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create restore"})
 		return
 	}
+	s.startRefreshRun(&restore)
 
 	// Enqueue restore task
 	restoreTask, err := tasks.NewTriggerRestoreTask(restore.ID)
@@ -174,26 +432,244 @@ func (s *Server) triggerRestore(c *gin.Context) {
 		return
 	}
 
-	taskInfo, err := s.asynqClient.Enqueue(restoreTask, asynq.Timeout(12*time.Hour))
+	// Buffered while Redis is unavailable, the restore starts once it's back
+	taskInfo, buffered, err := tasks.EnqueueOrBuffer(s.db, s.taskClient, restoreTask, s.config)
 	if err != nil {
 		s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to enqueue restore task")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start restore"})
+		// Without a task the restore would stay queued forever and hold up the restores after it
+		s.failRefreshRun(&restore, "failed to enqueue restore task: "+err.Error())
+		if err := s.db.Delete(&restore).Error; err != nil {
+			s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to delete restore record")
+		}
+		s.respondEnqueueError(c, err, "Failed to start restore")
 		return
 	}
 
+	// The worker starts the restore once no more than max_concurrent_restores are ahead of it
+	queuePosition := 0
+	if state, err := orchestrator.QueueState(c.Request.Context()); err != nil {
+		s.logger.Warn().Err(err).Str("restore_id", restore.ID).Msg("Failed to determine restore queue position")
+	} else {
+		queuePosition = state.Position(restore.ID, config.MaxConcurrentRestores)
+	}
+
+	taskID := ""
+	if taskInfo != nil {
+		taskID = taskInfo.ID
+	}
 	s.logger.Info().
 		Str("config_id", config.ID).
 		Str("restore_id", restore.ID).
-		Str("task_id", taskInfo.ID).
+		Str("task_id", taskID).
+		Bool("buffered", buffered).
 		Msg("Restore task enqueued successfully")
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":    "Restore triggered successfully",
-		"restore_id": restore.ID,
-		"task_id":    taskInfo.ID,
+	setAuditResource(c, restore.ID)
+	setAuditDetail(c, "name", restore.Name)
+	if restore.Label != "" {
+		setAuditDetail(c, "label", restore.Label)
+	}
+
+	status, message := http.StatusOK, "Restore triggered successfully"
+	if queuePosition > 0 {
+		message = fmt.Sprintf("Restore queued at position %d, it starts when a running restore finishes", queuePosition)
+	}
+	if buffered {
+		setAuditDetail(c, "buffered", "true")
+		status, message = http.StatusAccepted, "Task queue unavailable (Redis can't be reached), the restore starts once it's back"
+	}
+
+	c.JSON(status, gin.H{
+		"message":        message,
+		"restore_id":     restore.ID,
+		"task_id":        taskID,
+		"queue_position": queuePosition,
+		"buffered":       buffered,
 	})
 }
 
+// @Summary Clone restore
+// @Description ZFS-clone a ready restore into a new independent restore (own cluster and port) for destructive experiments.
+// @Description The clone is created in the background, poll it until ready_at (or failed_at) is set.
+// @Description Clones are never branched from or removed by refresh cleanup; delete them explicitly when done.
+// @Tags restores
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Restore ID"
+// @Success 202 {object} models.Restore
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/restores/{id}/clone [post]
+func (s *Server) cloneRestore(c *gin.Context) {
+	restoreID := c.Param("id")
+
+	var source models.Restore
+	if err := s.db.Where("id = ?", restoreID).First(&source).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to find restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if source.ReadyAt == nil || !source.SchemaReady {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Restore is not ready"})
+		return
+	}
+	// A clone would outlive the break-glass grant of the raw restore
+	if source.Raw {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Raw restores of break-glass grants can't be cloned"})
+		return
+	}
+
+	clone, err := s.restoresService.Clone(c.Request.Context(), &source)
+	if errors.Is(err, sysinfo.ErrInsufficientDiskSpace) {
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to clone restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to clone restore: %v", err)})
+		return
+	}
+
+	cloneTask, err := tasks.NewCloneRestoreTask(clone.ID)
+	if err == nil {
+		_, err = s.taskClient.Enqueue(cloneTask, tasks.Timeout(tasks.TypeCloneRestore, tasks.CloneRestoreTimeout, s.config.Worker), asynq.MaxRetry(0), tasks.Retention(tasks.TypeCloneRestore, s.config.Redis), tasks.Queue(tasks.TypeCloneRestore, s.config.Worker))
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", clone.ID).Msg("Failed to enqueue clone task")
+		s.db.Delete(clone)
+		s.respondEnqueueError(c, err, "Failed to start clone")
+		return
+	}
+
+	setAuditDetail(c, "clone_id", clone.ID)
+	setAuditDetail(c, "clone_name", clone.Name)
+
+	c.JSON(http.StatusAccepted, clone)
+}
+
+// checkRestoreQueue rejects a new restore when the reject queue policy is set and
+// Config.MaxConcurrentRestores restores are in progress, writing the error response
+func (s *Server) checkRestoreQueue(c *gin.Context, config *models.Config) bool {
+	if config.RestoreQueuePolicy != models.RestoreQueuePolicyReject {
+		return true
+	}
+
+	state, err := s.restoresService.GetOrchestrator().QueueState(c.Request.Context())
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to check running restores")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+	if state.Full(config.MaxConcurrentRestores) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":                   "Too many restores in progress, try again when one has finished",
+			"running_restores":        len(state.Running),
+			"queued_restores":         len(state.Queued),
+			"max_concurrent_restores": config.MaxConcurrentRestores,
+		})
+		return false
+	}
+	return true
+}
+
+// adoptDataDirectoryPattern limits data directories to paths that are safe to pass to the adoption script
+var adoptDataDirectoryPattern = regexp.MustCompile(`^/[A-Za-z0-9._/-]+$`)
+
+type AdoptRestoreRequest struct {
+	DataDirectory string `json:"data_directory" binding:"required"` // Absolute path of a stopped cluster on the VM, e.g. /var/lib/postgresql/16/main
+}
+
+// @Summary Adopt existing cluster
+// @Description Copy a stopped PostgreSQL cluster already on the VM into a new restore (admin only), e.g. one migrated over from another host.
+// @Description The cluster must match the configured PostgreSQL version and contain the configured database; its directory is only read.
+// @Description Extensions, post-restore SQL and anonymization run on the copy like on any restore.
+// @Description The copy waits for a restore slot (max_concurrent_restores), or is rejected with the reject queue policy.
+// @Tags restores
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body AdoptRestoreRequest true "Adopt restore request"
+// @Success 202 {object} models.Restore
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/restores/adopt [post]
+func (s *Server) adoptRestore(c *gin.Context) {
+	var req AdoptRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	dataDirectory := filepath.Clean(req.DataDirectory)
+	if !adoptDataDirectoryPattern.MatchString(dataDirectory) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "data_directory must be an absolute path of letters, digits, '.', '_', '-' and '/'"})
+		return
+	}
+
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+			return
+		}
+		s.logger.Error().Err(err).Msg("Failed to get config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Adoptions take a restore slot like any other restore
+	if !s.checkRestoreQueue(c, &config) {
+		return
+	}
+
+	// The port is assigned when the worker starts the adopted cluster
+	restore := models.Restore{
+		Name:        models.GenerateRestoreName(),
+		Port:        5432,
+		AdoptedFrom: dataDirectory,
+	}
+	if err := s.db.Create(&restore).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create restore record")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create restore"})
+		return
+	}
+
+	adoptTask, err := tasks.NewAdoptClusterTask(restore.ID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to create adopt task")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start adoption"})
+		return
+	}
+
+	// Not retried, a half-copied cluster is cleaned up by the script and the admin decides whether to try again
+	if _, err := s.taskClient.Enqueue(adoptTask, tasks.Timeout(tasks.TypeAdoptCluster, tasks.AdoptClusterTimeout, s.config.Worker), asynq.MaxRetry(0), tasks.Retention(tasks.TypeAdoptCluster, s.config.Redis), tasks.Queue(tasks.TypeAdoptCluster, s.config.Worker)); err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to enqueue adopt task")
+		if err := s.db.Delete(&restore).Error; err != nil {
+			s.logger.Error().Err(err).Str("restore_id", restore.ID).Msg("Failed to delete restore record")
+		}
+		s.respondEnqueueError(c, err, "Failed to start adoption")
+		return
+	}
+
+	s.logger.Info().
+		Str("restore_id", restore.ID).
+		Str("data_directory", dataDirectory).
+		Msg("Cluster adoption enqueued")
+
+	setAuditResource(c, restore.ID)
+	setAuditDetail(c, "name", restore.Name)
+	setAuditDetail(c, "data_directory", dataDirectory)
+
+	c.JSON(http.StatusAccepted, restore)
+}
+
 // @Summary Get restore logs
 // @Description Get logs for a specific restore
 // @Tags restores
@@ -208,14 +684,6 @@ func (s *Server) triggerRestore(c *gin.Context) {
 func (s *Server) getRestoreLogs(c *gin.Context) {
 	restoreID := c.Param("id")
 
-	// Get lines parameter (default to 50)
-	lines := 50
-	if linesStr := c.Query("lines"); linesStr != "" {
-		if l, err := strconv.Atoi(linesStr); err == nil && l > 0 && l <= 1000 {
-			lines = l
-		}
-	}
-
 	// Find restore
 	var restore models.Restore
 	if err := s.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
@@ -228,8 +696,18 @@ func (s *Server) getRestoreLogs(c *gin.Context) {
 		return
 	}
 
-	// Construct log file path
-	logPath := fmt.Sprintf("/var/log/branchd/restore-%s.log", restore.Name)
+	s.writeLogTail(c, fmt.Sprintf("/var/log/branchd/restore-%s.log", restore.Name))
+}
+
+// writeLogTail responds with the last lines (query parameter, default 50) of a log file, a missing file is an empty log
+func (s *Server) writeLogTail(c *gin.Context, logPath string) {
+	// Get lines parameter (default to 50)
+	lines := 50
+	if linesStr := c.Query("lines"); linesStr != "" {
+		if l, err := strconv.Atoi(linesStr); err == nil && l > 0 && l <= 1000 {
+			lines = l
+		}
+	}
 
 	// Check if log file exists
 	if _, err := os.Stat(logPath); os.IsNotExist(err) {
@@ -350,10 +828,12 @@ func (s *Server) applyAnonymization(c *gin.Context) {
 	}
 
 	// Apply anonymization rules
-	rulesApplied, err := anonymize.Apply(c.Request.Context(), s.db, anonymize.ApplyParams{
-		DatabaseName:    targetDatabase,
-		PostgresVersion: config.PostgresVersion,
-		PostgresPort:    restore.Port,
+	result, err := anonymize.Apply(c.Request.Context(), s.db, anonymize.ApplyParams{
+		DatabaseName: targetDatabase,
+		PostgresPort: restore.Port,
+		RestoreID:    restore.ID,
+		RestoreName:  restore.Name,
+		Trigger:      models.AnonRunTriggerManual,
 	}, s.logger)
 	if err != nil {
 		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to apply anonymization")
@@ -363,11 +843,189 @@ func (s *Server) applyAnonymization(c *gin.Context) {
 
 	s.logger.Info().
 		Str("restore_id", restoreID).
-		Int("rules_applied", rulesApplied).
+		Int("rules_applied", result.RulesApplied).
 		Msg("Anonymization completed successfully")
 
+	setAuditDetail(c, "rules_applied", strconv.Itoa(result.RulesApplied))
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":       "Anonymization completed successfully",
-		"rules_applied": rulesApplied,
+		"rules_applied": result.RulesApplied,
+		"tables":        result.Tables,
 	})
 }
+
+// Boost duration bounds
+const (
+	defaultBoostMinutes = 60
+	maxBoostMinutes     = 12 * 60
+)
+
+type BoostRestoreRequest struct {
+	DurationMinutes int `json:"duration_minutes"` // Optional: how long to boost (default 60, max 720)
+}
+
+// @Summary Boost restore priority
+// @Description Temporarily run an in-progress restore above branches (CPU/IO priority), e.g. when the team is waiting on it
+// @Tags restores
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Restore ID"
+// @Param request body BoostRestoreRequest false "Boost request"
+// @Success 200 {object} models.Restore
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/restores/{id}/boost [post]
+func (s *Server) boostRestore(c *gin.Context) {
+	restoreID := c.Param("id")
+
+	var req BoostRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if req.DurationMinutes == 0 {
+		req.DurationMinutes = defaultBoostMinutes
+	}
+	if req.DurationMinutes < 0 || req.DurationMinutes > maxBoostMinutes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("duration_minutes must be between 1 and %d", maxBoostMinutes)})
+		return
+	}
+
+	var restore models.Restore
+	if err := s.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to find restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if restore.Finished() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Restore is already " + restore.State})
+		return
+	}
+
+	if err := s.restoresService.GetOrchestrator().Boost(c.Request.Context(), &restore); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to boost restore: %v", err)})
+		return
+	}
+
+	boostedUntil := time.Now().Add(time.Duration(req.DurationMinutes) * time.Minute)
+	if err := s.db.Model(&restore).Update("boosted_until", boostedUntil).Error; err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to store boost expiry")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	restore.BoostedUntil = &boostedUntil
+
+	// Schedule the return to background priority
+	unboostTask, err := tasks.NewRestoreUnboostTask(restore.ID)
+	if err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to create unboost task")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule boost expiry"})
+		return
+	}
+	if _, err := s.taskClient.Enqueue(unboostTask, asynq.ProcessAt(boostedUntil), tasks.Timeout(tasks.TypeRestoreUnboost, tasks.DefaultTimeout, s.config.Worker), tasks.Retention(tasks.TypeRestoreUnboost, s.config.Redis), tasks.Queue(tasks.TypeRestoreUnboost, s.config.Worker)); err != nil {
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to enqueue unboost task")
+		s.respondEnqueueError(c, err, "Failed to schedule boost expiry")
+		return
+	}
+
+	s.logger.Info().
+		Str("restore_id", restore.ID).
+		Time("boosted_until", boostedUntil).
+		Msg("Restore boosted")
+
+	setAuditDetail(c, "duration_minutes", strconv.Itoa(req.DurationMinutes))
+
+	c.JSON(http.StatusOK, restore)
+}
+
+// @Summary End restore boost
+// @Description Return a boosted restore to background priority before the boost expires
+// @Tags restores
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Restore ID"
+// @Success 200 {object} models.Restore
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/restores/{id}/boost [delete]
+func (s *Server) unboostRestore(c *gin.Context) {
+	restoreID := c.Param("id")
+
+	var restore models.Restore
+	if err := s.db.Where("id = ?", restoreID).First(&restore).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to find restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if restore.BoostedUntil == nil {
+		c.JSON(http.StatusOK, restore)
+		return
+	}
+
+	if err := s.restoresService.GetOrchestrator().EndBoost(c.Request.Context(), &restore); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to end restore boost: %v", err)})
+		return
+	}
+
+	s.logger.Info().Str("restore_id", restore.ID).Msg("Restore boost ended")
+
+	c.JSON(http.StatusOK, restore)
+}
+
+// @Summary Cancel restore
+// @Description Stop a queued or running restore. The restore is kept as cancelled (and never becomes ready) until it's deleted
+// @Tags restores
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Restore ID"
+// @Success 200 {object} models.Restore
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/restores/{id}/cancel [post]
+func (s *Server) cancelRestore(c *gin.Context) {
+	restoreID := c.Param("id")
+
+	var restoreModel models.Restore
+	if err := s.db.Where("id = ?", restoreID).First(&restoreModel).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Restore not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to find restore")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if restoreModel.Finished() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Restore is already " + restoreModel.State})
+		return
+	}
+
+	cancelled, err := s.restoresService.GetOrchestrator().Cancel(c.Request.Context(), restoreModel.ID)
+	if errors.Is(err, restore.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to cancel restore: %v", err)})
+		return
+	}
+
+	setAuditDetail(c, "previous_state", restoreModel.State)
+
+	c.JSON(http.StatusOK, cancelled)
+}
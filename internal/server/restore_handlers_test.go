@@ -0,0 +1,248 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restores"
+)
+
+func TestBoostRestoreRejectsInvalidRequests(t *testing.T) {
+	s := newTestServer(t)
+
+	readyAt := time.Now()
+	ready := models.Restore{Name: "restore_20250101000000", State: models.RestoreStateReady, SchemaReady: true, DataReady: true, ReadyAt: &readyAt}
+	running := models.Restore{Name: "restore_20250102000000"}
+	for _, restore := range []*models.Restore{&ready, &running} {
+		if err := s.db.Create(restore).Error; err != nil {
+			t.Fatalf("failed to create restore: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		restoreID string
+		body      string
+		want      int
+	}{
+		{name: "negative duration", restoreID: running.ID, body: `{"duration_minutes":-5}`, want: http.StatusBadRequest},
+		{name: "duration above 12 hours", restoreID: running.ID, body: `{"duration_minutes":721}`, want: http.StatusBadRequest},
+		{name: "malformed body", restoreID: running.ID, body: `{"duration_minutes":"long"}`, want: http.StatusBadRequest},
+		{name: "unknown restore", restoreID: "missing", want: http.StatusNotFound},
+		{name: "completed restore", restoreID: ready.ID, body: `{"duration_minutes":30}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/restores/"+tt.restoreID+"/boost", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = gin.Params{{Key: "id", Value: tt.restoreID}}
+			s.boostRestore(c)
+
+			if w.Code != tt.want {
+				t.Errorf("boostRestore() status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	var got models.Restore
+	s.db.First(&got, "id = ?", running.ID)
+	if got.BoostedUntil != nil {
+		t.Errorf("rejected boost set boosted_until = %v", got.BoostedUntil)
+	}
+}
+
+func TestUnboostRestoreWithoutBoost(t *testing.T) {
+	s := newTestServer(t)
+	restore := models.Restore{Name: "restore_20250101000000"}
+	if err := s.db.Create(&restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+
+	// Nothing to undo, so the cluster isn't touched
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/api/restores/"+restore.ID+"/boost", nil)
+	c.Params = gin.Params{{Key: "id", Value: restore.ID}}
+	s.unboostRestore(c)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("unboostRestore() status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+}
+
+func TestCancelRestore(t *testing.T) {
+	s := newTestServer(t)
+	s.restoresService = restores.NewService(s.db, s.config, s.logger)
+
+	readyAt := time.Now()
+	ready := models.Restore{Name: "restore_20250101000000", State: models.RestoreStateReady, ReadyAt: &readyAt}
+	queued := models.Restore{Name: "restore_20250102000000"}
+	for _, restore := range []*models.Restore{&ready, &queued} {
+		if err := s.db.Create(restore).Error; err != nil {
+			t.Fatalf("failed to create restore: %v", err)
+		}
+	}
+
+	cancel := func(restoreID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/restores/"+restoreID+"/cancel", nil)
+		c.Params = gin.Params{{Key: "id", Value: restoreID}}
+		s.cancelRestore(c)
+		return w
+	}
+
+	// A queued restore has no process yet, it leaves the queue
+	if w := cancel(queued.ID); w.Code != http.StatusOK {
+		t.Fatalf("cancelRestore(queued) status = %d: %s", w.Code, w.Body.String())
+	}
+	var got models.Restore
+	s.db.First(&got, "id = ?", queued.ID)
+	if got.State != models.RestoreStateCancelled || got.CancelledAt == nil {
+		t.Errorf("cancelled restore state = %q, cancelled_at = %v", got.State, got.CancelledAt)
+	}
+
+	for name, tt := range map[string]struct {
+		restoreID string
+		want      int
+	}{
+		"ready":             {restoreID: ready.ID, want: http.StatusConflict},
+		"already cancelled": {restoreID: queued.ID, want: http.StatusConflict},
+		"unknown":           {restoreID: "missing", want: http.StatusNotFound},
+	} {
+		if w := cancel(tt.restoreID); w.Code != tt.want {
+			t.Errorf("cancelRestore(%s) status = %d, want %d: %s", name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+func TestUpdateAndFilterRestoreLabels(t *testing.T) {
+	s := newTestServer(t)
+
+	baseline := models.Restore{Name: "restore_20250101000000", State: models.RestoreStateReady}
+	other := models.Restore{Name: "restore_20250102000000", State: models.RestoreStateReady}
+	raw := models.Restore{Name: "restore_20250103000000", Raw: true}
+	for _, restore := range []*models.Restore{&baseline, &other, &raw} {
+		if err := s.db.Create(restore).Error; err != nil {
+			t.Fatalf("failed to create restore: %v", err)
+		}
+	}
+
+	update := func(restoreID, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/api/restores/"+restoreID, strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: restoreID}}
+		s.updateRestore(c)
+		return w
+	}
+
+	for name, tt := range map[string]struct {
+		restoreID string
+		body      string
+		want      int
+	}{
+		"pinned without label": {restoreID: other.ID, body: `{"pinned":true}`, want: http.StatusBadRequest},
+		"invalid label":        {restoreID: other.ID, body: `{"label":"Pre Migration"}`, want: http.StatusBadRequest},
+		"raw restore pinned":   {restoreID: raw.ID, body: `{"label":"incident","pinned":true}`, want: http.StatusBadRequest},
+		"unknown restore":      {restoreID: "missing", body: `{"label":"x"}`, want: http.StatusNotFound},
+	} {
+		if w := update(tt.restoreID, tt.body); w.Code != tt.want {
+			t.Errorf("updateRestore(%s) status = %d, want %d: %s", name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	if w := update(baseline.ID, `{"label":" pre-migration-baseline ","note":"Before the orders migration","pinned":true}`); w.Code != http.StatusOK {
+		t.Fatalf("updateRestore() status = %d: %s", w.Code, w.Body.String())
+	}
+	var got models.Restore
+	s.db.First(&got, "id = ?", baseline.ID)
+	if got.Label != "pre-migration-baseline" || got.Note != "Before the orders migration" || !got.Pinned {
+		t.Errorf("restore = label %q, note %q, pinned %v", got.Label, got.Note, got.Pinned)
+	}
+	// The label of a pinned restore can't be removed
+	if w := update(baseline.ID, `{"label":""}`); w.Code != http.StatusBadRequest {
+		t.Errorf("removing the label of a pinned restore status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	list := func(query string) []string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/restores?"+query, nil)
+		s.listRestores(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("listRestores(%s) status = %d: %s", query, w.Code, w.Body.String())
+		}
+		var restores []models.Restore
+		if err := json.Unmarshal(w.Body.Bytes(), &restores); err != nil {
+			t.Fatalf("failed to decode restores: %v", err)
+		}
+		var names []string
+		for _, restore := range restores {
+			names = append(names, restore.Name)
+		}
+		return names
+	}
+	if got := list("label=pre-migration-baseline"); len(got) != 1 || got[0] != baseline.Name {
+		t.Errorf("restores with the label = %v, want %s", got, baseline.Name)
+	}
+	if got := list("pinned=false"); len(got) != 2 {
+		t.Errorf("unpinned restores = %v, want the other two", got)
+	}
+	if got := list("label=missing"); len(got) != 0 {
+		t.Errorf("restores with an unknown label = %v, want none", got)
+	}
+}
+
+func TestGetAnonymizationReport(t *testing.T) {
+	s := newTestServer(t)
+	restore := models.Restore{Name: "restore_20250101000000"}
+	if err := s.db.Create(&restore).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+	for i, status := range []string{models.AnonRunStatusFailed, models.AnonRunStatusSucceeded} {
+		run := models.AnonRun{RestoreID: restore.ID, RestoreName: restore.Name, Status: status, Trigger: models.AnonRunTriggerRestore}
+		run.CreatedAt = time.Now().Add(time.Duration(i) * time.Minute)
+		if err := s.db.Create(&run).Error; err != nil {
+			t.Fatalf("failed to create anonymization run: %v", err)
+		}
+	}
+	// Runs of a deleted restore stay readable
+	deleted := models.AnonRun{RestoreID: "deleted", RestoreName: "restore_20241231000000", Status: models.AnonRunStatusSucceeded, Trigger: models.AnonRunTriggerRefresh}
+	if err := s.db.Create(&deleted).Error; err != nil {
+		t.Fatalf("failed to create anonymization run: %v", err)
+	}
+
+	report := func(restoreID string) (int, AnonymizationReportResponse) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/restores/"+restoreID+"/anonymization-report", nil)
+		c.Params = gin.Params{{Key: "id", Value: restoreID}}
+		s.getAnonymizationReport(c)
+
+		var response AnonymizationReportResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, got := report(restore.ID)
+	if code != http.StatusOK || len(got.Runs) != 2 || got.Runs[0].Status != models.AnonRunStatusSucceeded || !got.Anonymized {
+		t.Errorf("getAnonymizationReport() = %d %+v, want the successful run first", code, got)
+	}
+	if code, got := report("deleted"); code != http.StatusOK || got.RestoreName != deleted.RestoreName || len(got.Runs) != 1 {
+		t.Errorf("getAnonymizationReport(deleted) = %d %+v, want its run", code, got)
+	}
+	if code, _ := report("missing"); code != http.StatusNotFound {
+		t.Errorf("getAnonymizationReport(missing) status = %d, want %d", code, http.StatusNotFound)
+	}
+}
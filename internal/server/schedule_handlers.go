@@ -0,0 +1,294 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
+)
+
+// CreateBranchScheduleRequest represents a request to create a branch schedule
+// At least one of schedule and on_new_restore is required
+type CreateBranchScheduleRequest struct {
+	// Normalized and validated like the names of created branches
+	BranchName string                      `json:"branch_name" binding:"required" validate:"required"`
+	Schedule   string                      `json:"schedule"` // Cron expression, e.g. "0 6 * * *"
+	Resources  models.BranchResourceLimits `json:"resources"`
+	Enabled    *bool                       `json:"enabled"` // Defaults to true
+
+	RestoreID    string `json:"restore_id"`     // Source restore (e.g. a promoted restore), empty = latest ready restore
+	OnNewRestore bool   `json:"on_new_restore"` // Recreate the branch whenever a new restore is ready
+}
+
+// UpdateBranchScheduleRequest updates the given schedule fields
+type UpdateBranchScheduleRequest struct {
+	Schedule  *string                      `json:"schedule"` // Empty string removes the cron schedule
+	Resources *models.BranchResourceLimits `json:"resources"`
+	Enabled   *bool                        `json:"enabled"`
+
+	RestoreID    *string `json:"restore_id"` // Empty string = latest ready restore
+	OnNewRestore *bool   `json:"on_new_restore"`
+}
+
+// @Summary List branch schedules
+// @Description List the schedules recreating branches on a cron or when a new restore is ready (admin only)
+// @Tags branch-schedules
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.BranchSchedule
+// @Router /api/branch-schedules [get]
+func (s *Server) listBranchSchedules(c *gin.Context) {
+	var schedules []models.BranchSchedule
+	if err := s.db.Preload("CreatedBy").Order("branch_name ASC").Find(&schedules).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list branch schedules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// @Summary Create branch schedule
+// @Description Recreate a branch from the latest ready restore (or restore_id) on a cron schedule, owned by the calling admin (admin only)
+// @Description With on_new_restore the branch is also recreated within a minute of each new restore becoming ready,
+// @Description keeping its port and credentials (a standing branch, e.g. a nightly integration environment)
+// @Tags branch-schedules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateBranchScheduleRequest true "Create branch schedule request"
+// @Success 201 {object} models.BranchSchedule
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/branch-schedules [post]
+func (s *Server) createBranchSchedule(c *gin.Context) {
+	sessionData, exists := GetSessionData(c)
+	if !exists {
+		s.logger.Error().Msg("Session data not found in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var req CreateBranchScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.validator.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		return
+	}
+
+	branchName, ok := s.normalizeBranchName(c, req.BranchName)
+	if !ok {
+		return
+	}
+
+	schedule := models.BranchSchedule{
+		BranchName:     branchName,
+		Schedule:       strings.TrimSpace(req.Schedule),
+		CreatedByID:    sessionData.UserID,
+		Enabled:        req.Enabled == nil || *req.Enabled,
+		ResourceLimits: req.Resources,
+		RestoreID:      strings.TrimSpace(req.RestoreID),
+		OnNewRestore:   req.OnNewRestore,
+	}
+	if !s.prepareBranchSchedule(c, &schedule) {
+		return
+	}
+
+	var count int64
+	if err := s.db.Model(&models.BranchSchedule{}).Where("branch_name = ?", schedule.BranchName).Count(&count).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to check branch schedules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Branch " + schedule.BranchName + " already has a schedule"})
+		return
+	}
+
+	if err := s.db.Create(&schedule).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create branch schedule")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create branch schedule"})
+		return
+	}
+
+	setAuditResource(c, schedule.ID)
+	setAuditDetail(c, "branch_name", schedule.BranchName)
+	setAuditDetail(c, "schedule", schedule.Schedule)
+	if schedule.OnNewRestore {
+		setAuditDetail(c, "on_new_restore", "true")
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// @Summary Update branch schedule
+// @Description Update a branch schedule's cron expression, resources, source, new restore trigger or enabled state (admin only)
+// @Tags branch-schedules
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch schedule ID"
+// @Param request body UpdateBranchScheduleRequest true "Update branch schedule request"
+// @Success 200 {object} models.BranchSchedule
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branch-schedules/{id} [patch]
+func (s *Server) updateBranchSchedule(c *gin.Context) {
+	schedule, ok := s.findBranchSchedule(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateBranchScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Schedule != nil {
+		schedule.Schedule = strings.TrimSpace(*req.Schedule)
+	}
+	if req.Resources != nil {
+		schedule.ResourceLimits = *req.Resources
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	if req.RestoreID != nil {
+		schedule.RestoreID = strings.TrimSpace(*req.RestoreID)
+	}
+	if req.OnNewRestore != nil {
+		schedule.OnNewRestore = *req.OnNewRestore
+	}
+	if !s.prepareBranchSchedule(c, schedule) {
+		return
+	}
+
+	if err := s.db.Save(schedule).Error; err != nil {
+		s.logger.Error().Err(err).Str("schedule_id", schedule.ID).Msg("Failed to update branch schedule")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update branch schedule"})
+		return
+	}
+
+	setAuditDetail(c, "branch_name", schedule.BranchName)
+	setAuditDetail(c, "schedule", schedule.Schedule)
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// @Summary Delete branch schedule
+// @Description Delete a branch schedule, the branch it created is kept (admin only)
+// @Tags branch-schedules
+// @Security BearerAuth
+// @Param id path string true "Branch schedule ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/branch-schedules/{id} [delete]
+func (s *Server) deleteBranchSchedule(c *gin.Context) {
+	schedule, ok := s.findBranchSchedule(c)
+	if !ok {
+		return
+	}
+
+	if err := s.db.Delete(schedule).Error; err != nil {
+		s.logger.Error().Err(err).Str("schedule_id", schedule.ID).Msg("Failed to delete branch schedule")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete branch schedule"})
+		return
+	}
+
+	setAuditDetail(c, "branch_name", schedule.BranchName)
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Run branch schedule
+// @Description Recreate the schedule's branch now, the next scheduled run is unchanged (admin only)
+// @Tags branch-schedules
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Branch schedule ID"
+// @Success 201 {object} models.Branch
+// @Failure 404 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Failure 507 {object} map[string]interface{}
+// @Router /api/branch-schedules/{id}/run [post]
+func (s *Server) runBranchSchedule(c *gin.Context) {
+	schedule, ok := s.findBranchSchedule(c)
+	if !ok {
+		return
+	}
+
+	setAuditDetail(c, "branch_name", schedule.BranchName)
+
+	branch, err := s.branchesService.RunBranchSchedule(c.Request.Context(), schedule)
+	if errors.Is(err, sysinfo.ErrInsufficientDiskSpace) {
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, branches.ErrCapacityExceeded) {
+		respondCapacityExceeded(c, err)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, branch)
+}
+
+// findBranchSchedule loads the branch schedule of the :id param, writing the error response if it can't
+func (s *Server) findBranchSchedule(c *gin.Context) (*models.BranchSchedule, bool) {
+	scheduleID := c.Param("id")
+
+	var schedule models.BranchSchedule
+	if err := s.db.Where("id = ?", scheduleID).First(&schedule).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Branch schedule not found"})
+			return nil, false
+		}
+		s.logger.Error().Err(err).Str("schedule_id", scheduleID).Msg("Failed to find branch schedule")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	return &schedule, true
+}
+
+// prepareBranchSchedule validates a schedule and computes its next run, writing the error response if invalid
+func (s *Server) prepareBranchSchedule(c *gin.Context, schedule *models.BranchSchedule) bool {
+	if schedule.Schedule == "" && !schedule.OnNewRestore {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A cron schedule or on_new_restore is required"})
+		return false
+	}
+
+	var nextRunAt *time.Time
+	if schedule.Schedule != "" {
+		next, err := branches.NextScheduleRun(schedule.Schedule, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		nextRunAt = &next
+	}
+	if err := branches.ValidateResourceLimits(schedule.ResourceLimits); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resources", "details": err.Error()})
+		return false
+	}
+	if err := s.branchesService.ValidateScheduleSource(schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source", "details": err.Error()})
+		return false
+	}
+
+	schedule.NextRunAt = nextRunAt
+	return true
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+func TestPrepareBranchSchedule(t *testing.T) {
+	s := newTestServer(t)
+	s.branchesService = branches.NewService(s.db, s.config, s.logger)
+	readyAt := time.Now()
+	promoted := &models.Restore{Name: "restore_promoted", SchemaReady: true, ReadyAt: &readyAt, PromotedFromBranch: "feature-x"}
+	if err := s.db.Create(promoted).Error; err != nil {
+		t.Fatalf("failed to create restore: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		schedule    models.BranchSchedule
+		wantErr     string
+		wantNextRun bool
+	}{
+		{name: "cron", schedule: models.BranchSchedule{Schedule: "0 6 * * *"}, wantNextRun: true},
+		{name: "new restores only", schedule: models.BranchSchedule{OnNewRestore: true}},
+		{name: "cron from a pinned restore", schedule: models.BranchSchedule{Schedule: "0 6 * * *", RestoreID: promoted.ID}, wantNextRun: true},
+		{name: "no trigger", schedule: models.BranchSchedule{}, wantErr: "A cron schedule or on_new_restore is required"},
+		{name: "invalid cron", schedule: models.BranchSchedule{Schedule: "daily", OnNewRestore: true}, wantErr: "invalid schedule"},
+		{name: "pinned restore with new restores", schedule: models.BranchSchedule{RestoreID: promoted.ID, OnNewRestore: true}, wantErr: "on_new_restore requires the latest restore"},
+		{name: "unknown restore", schedule: models.BranchSchedule{Schedule: "0 6 * * *", RestoreID: "missing"}, wantErr: "restore not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			ok := s.prepareBranchSchedule(c, &tt.schedule)
+			if tt.wantErr != "" {
+				if ok || w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.wantErr) {
+					t.Fatalf("prepareBranchSchedule() = %v, %d %s; want 400 with %q", ok, w.Code, w.Body.String(), tt.wantErr)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("prepareBranchSchedule() rejected the schedule: %s", w.Body.String())
+			}
+			if (tt.schedule.NextRunAt != nil) != tt.wantNextRun {
+				t.Errorf("NextRunAt = %v, want set: %v", tt.schedule.NextRunAt, tt.wantNextRun)
+			}
+		})
+	}
+}
@@ -22,16 +22,22 @@ import (
 	"github.com/glebarez/sqlite"
 	"github.com/go-playground/validator/v10"
 	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
 	"github.com/branchd-dev/branchd/internal/auth"
 	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/breakglass"
 	"github.com/branchd-dev/branchd/internal/caddy"
 	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/dependencies"
+	"github.com/branchd-dev/branchd/internal/fleet"
 	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/pgclient"
 	"github.com/branchd-dev/branchd/internal/restores"
+	"github.com/branchd-dev/branchd/internal/tasks"
 )
 
 // Server represents the HTTP server
@@ -41,11 +47,25 @@ type Server struct {
 	config          *config.Config
 	logger          zerolog.Logger
 	validator       *validator.Validate
-	asynqClient     *asynq.Client
+	taskClient      tasks.Enqueuer     // queueClient, or taskRunner without Redis
+	queueClient     *tasks.QueueClient // Tracks Redis outages, nil without Redis
+	taskInspector   tasks.Inspector    // *asynq.Inspector, or taskRunner without Redis
+	taskRunner      *tasks.LocalRunner // Processes tasks in-process without Redis, nil with Redis
+	asynqInspector  *asynq.Inspector   // Task queue metrics, nil without Redis
+	redisClient     *redis.Client      // Task queue metrics, nil without Redis
 	branchesService *branches.Service
 	restoresService *restores.Service
+	breakGlass      *breakglass.Service
+	dependencies    *dependencies.Service
 	caddyService    *caddy.Service
+	sourcePool      *pgclient.Pool // Source database connections of API handlers
+	limiter         *requestLimiter
 	version         string
+	auditedRoutes   map[string]auditedRoute // By "METHOD route", registered with audit
+
+	decommission  decommissionConfirmation
+	latestVersion latestVersionCache
+	oidc          oidcProviderCache
 }
 
 // New creates a new server instance
@@ -74,35 +94,47 @@ func New(cfg *config.Config, zlog zerolog.Logger, version string) (*Server, erro
 		zlog.Info().Msg("No config found - JWT will be initialized during first setup")
 	}
 
-	// Initialize validator
-	validate := validator.New()
-
-	// Register custom validators
-	validate.RegisterValidation("alphanumdash", func(fl validator.FieldLevel) bool {
-		// Allow alphanumeric, hyphens, and underscores only (safe for filesystem paths)
-		value := fl.Field().String()
-		for _, char := range value {
-			if !((char >= 'a' && char <= 'z') ||
-				(char >= 'A' && char <= 'Z') ||
-				(char >= '0' && char <= '9') ||
-				char == '-' ||
-				char == '_') {
-				return false
-			}
+	// Agents registered before their tokens were sealed
+	if cfg.Fleet.Enabled {
+		if err := fleet.NewService(db, cfg, zlog).SealStoredTokens(); err != nil {
+			return nil, err
 		}
-		return true
-	})
+	}
 
-	// Initialize Asynq client for enqueueing tasks
-	asynqClient := asynq.NewClient(asynq.RedisClientOpt{
-		Addr: cfg.Redis.Address,
-	})
+	// Initialize validator, branch names follow branchd.ValidateBranchName
+	validate := validator.New()
+
+	var (
+		taskClient     tasks.Enqueuer
+		queueClient    *tasks.QueueClient
+		taskInspector  tasks.Inspector
+		taskRunner     *tasks.LocalRunner
+		asynqInspector *asynq.Inspector
+		redisClient    *redis.Client
+	)
+	if cfg.Redis.Enabled() {
+		// Redis client and inspector for task status and queue metrics
+		redisClient = redis.NewClient(&redis.Options{Addr: cfg.Redis.Address})
+		asynqInspector = asynq.NewInspectorFromRedisClient(redisClient)
+		taskInspector = asynqInspector
+
+		// Initialize Asynq client for enqueueing tasks, enqueueing during a Redis outage fails with ErrQueueUnavailable
+		queueClient = tasks.NewQueueClient(asynq.NewClient(asynq.RedisClientOpt{
+			Addr: cfg.Redis.Address,
+		}), redisClient)
+		taskClient = queueClient
+	} else {
+		// Without Redis, tasks are processed in this process (see workers.NewLocalWorker)
+		taskRunner = tasks.NewLocalRunner(cfg, zlog)
+		taskClient, taskInspector = taskRunner, taskRunner
+		zlog.Info().Msg("No Redis address configured - tasks are processed in-process")
+	}
 
 	// Initialize branches service (now runs locally, no SSH client needed)
 	branchesService := branches.NewService(db, cfg, zlog)
 
 	// Initialize restores service
-	restoresService := restores.NewService(db, zlog)
+	restoresService := restores.NewService(db, cfg, zlog)
 
 	// Initialize Caddy service for TLS configuration
 	caddyService, err := caddy.NewService(zlog)
@@ -117,10 +149,19 @@ func New(cfg *config.Config, zlog zerolog.Logger, version string) (*Server, erro
 		config:          cfg,
 		logger:          zlog,
 		validator:       validate,
-		asynqClient:     asynqClient,
+		taskClient:      taskClient,
+		queueClient:     queueClient,
+		taskInspector:   taskInspector,
+		taskRunner:      taskRunner,
+		asynqInspector:  asynqInspector,
+		redisClient:     redisClient,
 		branchesService: branchesService,
 		restoresService: restoresService,
+		breakGlass:      breakglass.NewService(db, cfg, branchesService, restoresService, zlog),
+		dependencies:    dependencies.NewService(db, branchesService, restoresService, zlog),
 		caddyService:    caddyService,
+		sourcePool:      pgclient.NewPool(pgclient.DefaultPoolConfig()),
+		limiter:         newRequestLimiter(cfg.API),
 		version:         version,
 	}
 
@@ -217,6 +258,9 @@ func (s *Server) setupRouter() {
 	// Add middleware
 	s.router.Use(gin.Recovery())
 	s.router.Use(s.loggingMiddleware())
+	s.router.Use(s.rateLimitMiddleware())
+	s.router.Use(s.bodyLimitMiddleware())
+	s.router.Use(s.auditMiddleware())
 
 	// CORS middleware
 	s.router.Use(cors.New(cors.Config{
@@ -230,10 +274,27 @@ func (s *Server) setupRouter() {
 
 	// Health check endpoint (no auth required)
 	s.router.GET("/health", s.healthCheck)
+	s.router.GET("/health/ready", s.readinessCheck)
+
+	// Prometheus metrics of branches (opt-in, authenticated by METRICS_TOKEN)
+	if s.config.Metrics.Enabled {
+		s.router.GET("/metrics", s.getMetrics)
+	}
 
 	// Public auth endpoints (no auth required)
-	s.router.POST("/api/setup", s.setupFirstAdmin)
+	s.audit(&s.router.RouterGroup, "user.setup", "user").POST("/api/setup", s.setupFirstAdmin)
 	s.router.POST("/api/auth/login", s.login)
+	s.router.GET("/api/auth/oidc", s.getOIDCStatus)
+	s.router.GET("/api/auth/oidc/login", s.oidcLogin)
+	// Also records account links (details.linked)
+	s.audit(&s.router.RouterGroup, "user.sso_provisioned", "user").GET("/api/auth/oidc/callback", s.oidcCallback)
+
+	// Decommission progress (authenticated by the unguessable ID, tokens are revoked while it runs)
+	s.router.GET("/api/system/decommission/:id", s.getDecommission)
+
+	// Integration webhooks (authenticated by their signature)
+	// Acting user is the integration owner (Config.GitHubWebhookUserID)
+	s.audit(&s.router.RouterGroup, "integration.github_webhook", "integration").POST("/api/integrations/github/webhook", s.githubWebhook)
 
 	// Authenticated API routes (JWT required)
 	api := s.router.Group("/api")
@@ -241,43 +302,166 @@ func (s *Server) setupRouter() {
 	{
 		// Auth endpoints
 		api.GET("/auth/me", s.getCurrentUser)
+		s.audit(api, "user.two_factor_setup", "user").POST("/auth/2fa/setup", s.setupTwoFactor)
+		s.audit(api, "user.two_factor_verified", "user").POST("/auth/2fa/verify", s.verifyTwoFactor)
+		s.audit(api, "user.sso_link_started", "user").POST("/auth/oidc/link", s.linkOIDCAccount)
+
+		// Admin routes (admin only, with two-factor authentication after the enrollment grace period)
+		admin := api.Group("", AdminOnlyMiddleware(s.logger), TwoFactorMiddleware(s.db, s.logger, s.config.Auth.TwoFactorGracePeriod))
 
 		// System information
 		api.GET("/system/info", s.getSystemInfo)
 		api.GET("/system/latest-version", s.getLatestVersion)
-		api.POST("/system/update", s.updateServer)
+		s.audit(admin, "system.updated", "system").POST("/system/update", s.updateServer)
+		admin.GET("/system/log-levels", s.getLogLevels)
+		s.audit(admin, "system.log_level_updated", "system").PUT("/system/log-level", s.updateLogLevel)
+		s.audit(admin, "system.backed_up", "system").POST("/system/backup", s.backupDatabase)
+		admin.GET("/system/reconcile", s.getReconcileReport)
+		s.audit(admin, "system.reconciled", "system").POST("/system/reconcile", s.reconcileResources)
+		// The decommission task records "system.decommissioned" itself so the final audit export includes it
+		s.audit(admin, "system.decommission_requested", "system").POST("/system/decommission/confirmation", s.requestDecommissionConfirmation)
+		s.audit(admin, "system.decommission_started", "system").POST("/system/decommission", s.decommissionServer)
 
 		// User management (admin only)
-		userRoutes := api.Group("/users")
-		userRoutes.Use(AdminOnlyMiddleware(s.logger))
+		userRoutes := admin.Group("/users")
 		{
 			userRoutes.GET("", s.listUsers)
-			userRoutes.POST("", s.createUser)
-			userRoutes.DELETE("/:id", s.deleteUser)
+			s.audit(userRoutes, "user.created", "user").POST("", s.createUser)
+			s.audit(userRoutes, "user.deleted", "user").DELETE("/:id", s.deleteUser)
+			s.audit(userRoutes, "user.two_factor_reset", "user").DELETE("/:id/2fa", s.resetUserTwoFactor)
+		}
+
+		// Groups: branch profiles, quotas and allowed sources (admin only)
+		groupRoutes := admin.Group("/groups")
+		{
+			groupRoutes.GET("", s.listGroups)
+			s.audit(groupRoutes, "group.created", "group").POST("", s.createGroup)
+			s.audit(groupRoutes, "group.updated", "group").PATCH("/:id", s.updateGroup)
+			s.audit(groupRoutes, "group.deleted", "group").DELETE("/:id", s.deleteGroup)
+			s.audit(groupRoutes, "group.members_updated", "group").PUT("/:id/members", s.setGroupMembers)
+		}
+
+		// Branch schedules: branches recreated on a cron (admin only)
+		scheduleRoutes := admin.Group("/branch-schedules")
+		{
+			scheduleRoutes.GET("", s.listBranchSchedules)
+			s.audit(scheduleRoutes, "branch_schedule.created", "branch_schedule").POST("", s.createBranchSchedule)
+			s.audit(scheduleRoutes, "branch_schedule.updated", "branch_schedule").PATCH("/:id", s.updateBranchSchedule)
+			s.audit(scheduleRoutes, "branch_schedule.deleted", "branch_schedule").DELETE("/:id", s.deleteBranchSchedule)
+			s.audit(scheduleRoutes, "branch_schedule.run", "branch_schedule").POST("/:id/run", s.runBranchSchedule)
 		}
 
+		// Audit log (admin only)
+		admin.GET("/audit", s.listAuditEvents)
+
 		// Onboarding & Configuration
 		api.GET("/config", s.getConfig)
-		api.PATCH("/config", s.updateConfig)
+		s.audit(api, "config.updated", "config").PATCH("/config", s.updateConfig)
+		s.audit(admin, "config.demo_started", "config").POST("/config/demo", s.startDemo)
+		s.audit(admin, "config.test_email_sent", "config").POST("/config/test-email", s.testEmail)
+		api.POST("/diagnostics/test-connection", s.testConnection)
+		api.GET("/refresh", s.getRefreshStatus)
+		s.audit(admin, "refresh.forced", "config").POST("/refresh/force", s.forceRefresh)
 
 		// Database management
 		api.GET("/restores", s.listRestores)
 		api.GET("/restores/:id", s.getRestore)
+		s.audit(api, "restore.updated", "restore").PATCH("/restores/:id", s.updateRestore)
 		api.GET("/restores/:id/logs", s.getRestoreLogs)
-		api.DELETE("/restores/:id", s.deleteRestore)
-		api.POST("/restores/trigger-restore", s.triggerRestore)
-		api.POST("/restores/:id/anonymize", s.applyAnonymization)
+		api.GET("/restores/:id/dependencies", s.getRestoreDependencies)
+		s.audit(api, "restore.deleted", "restore").DELETE("/restores/:id", s.deleteRestore)
+		s.audit(api, "restore.triggered", "restore").POST("/restores/trigger-restore", s.triggerRestore)
+		s.audit(admin, "restore.adopted", "restore").POST("/restores/adopt", s.adoptRestore)
+		s.audit(api, "restore.anonymized", "restore").POST("/restores/:id/anonymize", s.applyAnonymization)
+		s.audit(api, "restore.cloned", "restore").POST("/restores/:id/clone", s.cloneRestore)
+		api.GET("/restores/:id/report", s.getRestoreReport)
+		api.GET("/restores/:id/anonymization-report", s.getAnonymizationReport)
+		api.POST("/restores/:id/pii-scan", s.scanRestorePII)
+		api.GET("/restores/:id/branch-stats", s.getRestoreBranchStats)
+		s.audit(api, "restore.boosted", "restore").POST("/restores/:id/boost", s.boostRestore)
+		s.audit(api, "restore.unboosted", "restore").DELETE("/restores/:id/boost", s.unboostRestore)
+		s.audit(api, "restore.cancelled", "restore").POST("/restores/:id/cancel", s.cancelRestore)
+		api.GET("/restore-reports", s.listRestoreReports)
 
 		// Anonymization rules (global)
 		api.GET("/anon-rules", s.listAnonRules)
-		api.POST("/anon-rules", s.createAnonRule)
-		api.PUT("/anon-rules", s.updateAnonRules)
-		api.DELETE("/anon-rules/:id", s.deleteAnonRule)
+		s.audit(api, "anon_rule.created", "anon_rule").POST("/anon-rules", s.createAnonRule)
+		s.audit(api, "anon_rules.replaced", "anon_rule").PUT("/anon-rules", s.updateAnonRules)
+		api.POST("/anon-rules/preview", s.previewAnonRules)
+		s.audit(api, "anon_rules.imported", "anon_rule").POST("/anon-rules/import", s.importAnonRules)
+		api.GET("/anon-rules/validate", s.validateAnonRules)
+		s.audit(api, "anon_rule.deleted", "anon_rule").DELETE("/anon-rules/:id", s.deleteAnonRule)
 
 		// Branches
 		api.GET("/branches", s.listBranches)
-		api.POST("/branches", s.createBranch)
-		api.DELETE("/branches/:id", s.deleteBranch)
+		s.audit(api, "branch.created", "branch").POST("/branches", s.createBranch)
+		s.audit(api, "branch.deleted", "branch").DELETE("/branches/:id", s.deleteBranch)
+		s.audit(api, "branch.suspended", "branch").POST("/branches/:id/suspend", s.suspendBranch)
+		s.audit(api, "branch.resumed", "branch").POST("/branches/:id/resume", s.resumeBranch)
+		// Restarts triggered by the report are recorded as branch.recovered or branch.recovery_failed
+		s.audit(api, "branch.connection_failure_reported", "branch").POST("/branches/:id/connection-failure", s.reportBranchConnectionFailure)
+		s.audit(api, "branch.promoted", "branch").POST("/branches/:id/promote", s.promoteBranch)
+		s.audit(admin, "branch.disk_quota_updated", "branch").PUT("/branches/:id/disk-quota", s.setBranchDiskQuota)
+		api.GET("/branches/:id/hba", s.getBranchHBARules)
+		s.audit(admin, "branch.hba_updated", "branch").PUT("/branches/:id/hba", s.setBranchHBARules)
+		api.GET("/branches/:id/firewall", s.getBranchFirewall)
+		s.audit(admin, "branch.firewall_updated", "branch").PUT("/branches/:id/firewall", s.setBranchFirewall)
+		api.GET("/branches/:id/usage", s.getBranchUsage)
+		api.GET("/branches/:id/diff", s.getBranchDiff)
+		api.GET("/branches/:id/logs", s.getBranchLogs)
+		api.GET("/branches/:id/dependencies", s.getBranchDependencies)
+		api.GET("/branches/:id/provenance", s.getBranchProvenance)
+		s.audit(api, "branch.fixture_applied", "branch").POST("/branches/:id/fixtures", s.applyBranchFixture)
+		api.GET("/branches/:id/fixtures/:task_id", s.getBranchFixture)
+		s.audit(api, "branch.exported", "branch").POST("/branches/:id/export", s.exportBranch)
+		api.GET("/branches/:id/exports/:export_id", s.getBranchExport)
+		api.GET("/branches/:id/exports/:export_id/download", s.downloadBranchExport)
+		s.audit(api, "branch.shared", "branch").POST("/branches/:id/share", s.shareBranch)
+		api.GET("/branches/:id/shares", s.listBranchShares)
+		s.audit(api, "branch.share_revoked", "branch").DELETE("/branches/:id/shares/:share_id", s.revokeBranchShare)
+		s.audit(api, "branch.migration_checked", "branch").POST("/branches/:id/check-migration", s.checkBranchMigration)
+		api.GET("/branches/:id/check-migration/:task_id", s.getBranchMigrationCheck)
+
+		// Fixtures: synthetic data definitions applied to branches
+		api.GET("/fixtures", s.listFixtures)
+		s.audit(admin, "fixture.created", "fixture").POST("/fixtures", s.createFixture)
+		s.audit(admin, "fixture.updated", "fixture").PATCH("/fixtures/:id", s.updateFixture)
+		s.audit(admin, "fixture.deleted", "fixture").DELETE("/fixtures/:id", s.deleteFixture)
+		api.GET("/branch-stats", s.getBranchStats)
+		api.GET("/reports/branch-usage", s.getBranchUsageReport)
+		api.GET("/reports/refresh-history", s.getRefreshHistory)
+
+		// Branch templates: named presets selected by name at branch creation
+		api.GET("/branch-templates", s.listBranchTemplates)
+		s.audit(admin, "branch_template.created", "branch_template").POST("/branch-templates", s.createBranchTemplate)
+		s.audit(admin, "branch_template.updated", "branch_template").PATCH("/branch-templates/:id", s.updateBranchTemplate)
+		s.audit(admin, "branch_template.deleted", "branch_template").DELETE("/branch-templates/:id", s.deleteBranchTemplate)
+
+		// Notification channels: Slack, Discord and Teams webhooks branch and restore events are posted to (admin only)
+		admin.GET("/notification-channels", s.listNotificationChannels)
+		s.audit(admin, "notification_channel.created", "notification_channel").POST("/notification-channels", s.createNotificationChannel)
+		s.audit(admin, "notification_channel.updated", "notification_channel").PATCH("/notification-channels/:id", s.updateNotificationChannel)
+		s.audit(admin, "notification_channel.deleted", "notification_channel").DELETE("/notification-channels/:id", s.deleteNotificationChannel)
+		s.audit(admin, "notification_channel.tested", "notification_channel").POST("/notification-channels/:id/test", s.testNotificationChannel)
+
+		// Fleet: control-plane view of this server and its agents, branches placed on the least-loaded one (FLEET_ENABLED)
+		if s.config.Fleet.Enabled {
+			api.GET("/fleet", s.getFleet)
+			s.audit(api, "branch.created", "branch").POST("/fleet/branches", s.createFleetBranch)
+			admin.GET("/fleet/agents", s.listFleetAgents)
+			s.audit(admin, "fleet_agent.created", "fleet_agent").POST("/fleet/agents", s.createFleetAgent)
+			s.audit(admin, "fleet_agent.deleted", "fleet_agent").DELETE("/fleet/agents/:id", s.deleteFleetAgent)
+		}
+
+		// Purges: data subject erasure across restores and branches (admin only)
+		admin.GET("/purges", s.listPurges)
+		s.audit(admin, "purge.requested", "purge").POST("/purges", s.createPurge)
+		admin.GET("/purges/:id", s.getPurge)
+
+		// Break glass: time-boxed access to raw (not anonymized) data (admin only)
+		admin.GET("/break-glass", s.listBreakGlassGrants)
+		s.audit(admin, "break_glass.granted", "break_glass").POST("/break-glass", s.createBreakGlassGrant)
+		s.audit(admin, "break_glass.revoked", "break_glass").DELETE("/break-glass/:id", s.revokeBreakGlassGrant)
 	}
 }
 
@@ -309,28 +493,99 @@ func (s *Server) healthCheck(c *gin.Context) {
 	})
 }
 
+// ReadinessResponse is whether the API can serve requests and start tasks
+type ReadinessResponse struct {
+	Status        string             `json:"status"` // "ready", "degraded" (Redis unavailable, restore triggers are buffered) or "unavailable"
+	Database      bool               `json:"database"`
+	DatabaseError string             `json:"database_error,omitempty"`
+	Queue         *tasks.QueueStatus `json:"queue,omitempty"` // Omitted without Redis, tasks are processed in-process
+}
+
+// @Summary Readiness check
+// @Description Whether the database and Redis can be reached. A Redis outage degrades the API without making it
+// @Description unavailable: reads keep working, restore triggers are buffered and other tasks get 503 queue_unavailable
+// @Tags system
+// @Produce json
+// @Success 200 {object} ReadinessResponse
+// @Failure 503 {object} ReadinessResponse
+// @Router /health/ready [get]
+func (s *Server) readinessCheck(c *gin.Context) {
+	response := ReadinessResponse{Status: "ready", Database: true}
+
+	if sqlDB, err := s.db.DB(); err != nil {
+		response.Database, response.DatabaseError = false, err.Error()
+	} else if err := sqlDB.PingContext(c.Request.Context()); err != nil {
+		response.Database, response.DatabaseError = false, err.Error()
+	}
+
+	response.Queue = s.queueStatus(c.Request.Context())
+	if response.Queue != nil && !response.Queue.Available {
+		response.Status = "degraded"
+	}
+
+	if !response.Database {
+		response.Status = "unavailable"
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // GetDB returns the database connection for use by workers
 func (s *Server) GetDB() *gorm.DB {
 	return s.db
 }
 
-// Start starts the HTTP server
+// TaskRunner returns the in-process task runner the server enqueues tasks on without Redis, nil with Redis
+func (s *Server) TaskRunner() *tasks.LocalRunner {
+	return s.taskRunner
+}
+
+// Start starts the HTTP server and blocks until SIGINT or SIGTERM
 func (s *Server) Start() error {
-	port := ":8080"
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err := s.Serve(ctx)
+	s.Close()
+	return err
+}
 
-	// Setup signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+// Serve runs the HTTP server until ctx is done, then shuts it down gracefully
+// The database and Redis connections stay open, see Close
+func (s *Server) Serve(ctx context.Context) error {
+	port := ":8080"
 
 	// Create HTTP server with production timeouts
 	srv := &http.Server{
 		Addr:    port,
 		Handler: s.router,
 		// Timeouts for long-running operations like branch creation
-		ReadTimeout:       180 * time.Second, // 3 minutes
-		WriteTimeout:      180 * time.Second, // 3 minutes
-		ReadHeaderTimeout: 30 * time.Second,  // 30 seconds
-		IdleTimeout:       300 * time.Second, // 5 minutes
+		ReadTimeout:  180 * time.Second, // 3 minutes
+		WriteTimeout: 180 * time.Second, // 3 minutes
+		IdleTimeout:  300 * time.Second, // 5 minutes
+		// Slow client protection, request bodies are bounded by ReadTimeout and bodyLimitMiddleware
+		ReadHeaderTimeout: s.config.API.ReadHeaderTimeout,
+		MaxHeaderBytes:    s.config.API.MaxHeaderBytes,
+	}
+
+	// Purges run in the serving process (the worker also creates a Server), those of a previous one can't be resumed
+	if err := FailInterruptedPurges(s.db, s.logger); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to fail interrupted purges")
+	}
+
+	// Listen on suspended branches' ports and resume them on connection
+	wakerCtx, stopWaker := context.WithCancel(context.Background())
+	defer stopWaker()
+	s.branchesService.StartWaker(wakerCtx)
+
+	// Route branch connections on a single port, next to the branches' own ports
+	if s.config.Proxy.Address != "" {
+		proxyCtx, stopProxy := context.WithCancel(context.Background())
+		defer stopProxy()
+		if err := s.branchesService.StartProxy(proxyCtx, s.config.Proxy); err != nil {
+			s.logger.Error().Err(err).Str("address", s.config.Proxy.Address).Msg("Failed to start branch proxy")
+		}
 	}
 
 	// Start server in goroutine
@@ -342,15 +597,9 @@ func (s *Server) Start() error {
 	}()
 
 	// Wait for shutdown signal
-	<-sigChan
+	<-ctx.Done()
 	s.logger.Info().Msg("Received shutdown signal, shutting down gracefully...")
 
-	// Close Asynq client
-	if err := s.asynqClient.Close(); err != nil {
-		s.logger.Warn().Err(err).Msg("Error closing Asynq client")
-	}
-	s.logger.Info().Msg("Asynq client closed successfully")
-
 	// Shutdown HTTP server with timeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
@@ -362,6 +611,24 @@ func (s *Server) Start() error {
 	}
 
 	s.logger.Info().Msg("Server shutdown complete")
+	return nil
+}
+
+// Close closes the Asynq, Redis, source and database connections
+// Call it last, after the HTTP server and any in-process worker have stopped
+func (s *Server) Close() {
+	if err := s.taskClient.Close(); err != nil {
+		s.logger.Warn().Err(err).Msg("Error closing task client")
+	}
+	s.logger.Info().Msg("Task client closed successfully")
+
+	if s.redisClient != nil {
+		if err := s.redisClient.Close(); err != nil {
+			s.logger.Warn().Err(err).Msg("Error closing Redis client")
+		}
+	}
+
+	s.sourcePool.Close()
 
 	// Close database connection to flush WAL writes
 	if sqlDB, err := s.db.DB(); err == nil {
@@ -372,6 +639,4 @@ func (s *Server) Start() error {
 			s.logger.Info().Msg("Database closed successfully")
 		}
 	}
-
-	return nil
 }
@@ -6,26 +6,57 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"runtime"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
+	"github.com/branchd-dev/branchd/internal/backup"
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/logger"
 	"github.com/branchd-dev/branchd/internal/models"
 	"github.com/branchd-dev/branchd/internal/pgclient"
+	"github.com/branchd-dev/branchd/internal/reconcile"
 	"github.com/branchd-dev/branchd/internal/sysinfo"
+	"github.com/branchd-dev/branchd/internal/tasks"
 )
 
-// SystemInfoResponse contains VM and source database information
+// SystemInfoResponse contains VM, storage and source database information
 type SystemInfoResponse struct {
 	Version        string           `json:"version"`
 	VM             VMMetrics        `json:"vm"`
 	SourceDatabase *DatabaseMetrics `json:"source_database,omitempty"`
+	Redis          *RedisMetrics    `json:"redis,omitempty"`
+	Queue          *QueueStatus     `json:"queue,omitempty"` // Whether Redis accepts tasks, omitted without Redis
+	Storage        *StorageUsage    `json:"storage,omitempty"`
+	Capacity       *Capacity        `json:"capacity,omitempty"` // Headroom for new branches, omitted before onboarding
+	Worker         WorkerQueues     `json:"worker"`
+}
+
+// WorkerQueues reports how the worker prioritizes tasks
+type WorkerQueues struct {
+	Weights        map[string]int    `json:"weights"` // Share of picks per queue
+	StrictPriority bool              `json:"strict_priority"`
+	TaskQueues     map[string]string `json:"task_queues"` // Queue per task type
 }
 
 // VMMetrics contains VM resource information (aliased from sysinfo)
 type VMMetrics = sysinfo.Metrics
 
+// RedisMetrics contains Redis memory use and task queue sizes (aliased from tasks)
+type RedisMetrics = tasks.RedisMetrics
+
+// QueueStatus is whether Redis accepts tasks and how many restore triggers wait for it (aliased from tasks)
+type QueueStatus = tasks.QueueStatus
+
+// StorageUsage contains the data pool's space use by restores and branches (aliased from branches)
+type StorageUsage = branches.StorageUsage
+
+// Capacity is the headroom for new branches against the admission control thresholds (aliased from branches)
+type Capacity = branches.Capacity
+
 // DatabaseMetrics contains source database information
 type DatabaseMetrics struct {
 	Name         string  `json:"name"`
@@ -36,8 +67,21 @@ type DatabaseMetrics struct {
 	Error        string  `json:"error,omitempty"`
 }
 
+// errorCodeCapacityExceeded is the "code" of branch creations rejected by admission control (Config.Capacity*),
+// clients retry them after Retry-After seconds
+const errorCodeCapacityExceeded = "capacity_exceeded"
+
+// capacityRetryAfterSeconds is the Retry-After of capacity_exceeded responses, load spikes usually pass by then
+const capacityRetryAfterSeconds = "60"
+
+// respondCapacityExceeded responds to a branch creation rejected by admission control, err says what is short
+func respondCapacityExceeded(c *gin.Context, err error) {
+	c.Header("Retry-After", capacityRetryAfterSeconds)
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "code": errorCodeCapacityExceeded})
+}
+
 // @Summary Get system and source database information
-// @Description Returns VM metrics (CPU, memory, disk) and source database info if configured
+// @Description Returns VM metrics (CPU, memory, disk), headroom for new branches, Redis memory use and availability, worker queues and source database info if configured
 // @Tags system
 // @Produce json
 // @Success 200 {object} SystemInfoResponse
@@ -48,7 +92,7 @@ func (s *Server) getSystemInfo(c *gin.Context) {
 	defer cancel()
 
 	// Get VM metrics
-	vmMetrics, err := sysinfo.GetMetrics(ctx)
+	vmMetrics, err := sysinfo.GetMetrics(ctx, s.config.Storage.DatasetRoot)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Failed to get VM metrics")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get VM metrics: %v", err)})
@@ -58,14 +102,42 @@ func (s *Server) getSystemInfo(c *gin.Context) {
 	response := SystemInfoResponse{
 		Version: s.version,
 		VM:      vmMetrics,
+		Worker: WorkerQueues{
+			Weights:        s.config.Worker.Queues(),
+			StrictPriority: s.config.Worker.StrictPriority,
+			TaskQueues:     tasks.QueueMapping(s.config.Worker),
+		},
 	}
 
 	// Try to get source database metrics if config exists
 	var config models.Config
-	if err := s.db.First(&config).Error; err == nil && config.ConnectionString != "" {
+	configErr := s.db.First(&config).Error
+	if configErr == nil && config.ConnectionString != "" {
 		dbMetrics := s.getSourceDatabaseMetrics(ctx, config.ConnectionString, config.DatabaseName)
 		response.SourceDatabase = dbMetrics
 	}
+	if configErr == nil {
+		response.Capacity = s.branchesService.Capacity(ctx, &config)
+	}
+
+	// Redis metrics are best-effort, the endpoint still reports VM metrics when Redis is down (or not used)
+	response.Queue = s.queueStatus(ctx)
+	if s.redisClient != nil && response.Queue.Available {
+		redisMetrics, err := tasks.CollectRedisMetrics(ctx, s.asynqInspector, s.redisClient, s.config.Redis)
+		if err != nil {
+			s.logger.Warn().Err(err).Msg("Failed to get Redis metrics")
+		} else {
+			response.Redis = redisMetrics
+		}
+	}
+
+	// Storage usage is best-effort as well
+	storageUsage, err := s.branchesService.StorageUsage(ctx)
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to get storage usage")
+	} else {
+		response.Storage = storageUsage
+	}
 
 	c.JSON(http.StatusOK, response)
 }
@@ -77,25 +149,27 @@ func (s *Server) getSourceDatabaseMetrics(ctx context.Context, connectionString,
 		Connected: false,
 	}
 
-	// Get database info using pgclient
-	info, err := pgclient.GetDatabaseInfo(ctx, connectionString)
+	// Pooled with a circuit breaker, so a hanging source database doesn't slow down every system info request
+	var sizeGB float64
+	var version string
+	err := s.sourcePool.Do(ctx, connectionString, func(ctx context.Context, client *pgclient.Client) error {
+		var err error
+		if sizeGB, err = client.GetDatabaseSize(ctx); err != nil {
+			return err
+		}
+		version, err = client.GetVersion(ctx)
+		return err
+	})
 	if err != nil {
 		metrics.Error = err.Error()
 		return metrics
 	}
 
 	metrics.Connected = true
-	metrics.SizeGB = info.SizeGB
-	metrics.MajorVersion = info.MajorVersion
-	metrics.Version = fmt.Sprintf("PostgreSQL %d", info.MajorVersion)
-
-	// Try to get exact version string
-	client, err := pgclient.NewClient(connectionString)
-	if err == nil {
-		defer client.Close()
-		if version, err := client.GetVersion(ctx); err == nil {
-			metrics.Version = version
-		}
+	metrics.SizeGB = sizeGB
+	metrics.Version = version
+	if _, err := fmt.Sscanf(version, "%d", &metrics.MajorVersion); err != nil {
+		metrics.MajorVersion = 16 // Same default as pgclient.GetDatabaseInfo
 	}
 
 	return metrics
@@ -103,85 +177,89 @@ func (s *Server) getSourceDatabaseMetrics(ctx context.Context, connectionString,
 
 // LatestVersionResponse contains the latest available version from GitHub
 type LatestVersionResponse struct {
-	LatestVersion   string `json:"latest_version"`
-	CurrentVersion  string `json:"current_version"`
-	UpdateAvailable bool   `json:"update_available"`
+	LatestVersion   string     `json:"latest_version"`
+	CurrentVersion  string     `json:"current_version"`
+	UpdateAvailable bool       `json:"update_available"`
+	LastCheckedAt   *time.Time `json:"last_checked_at"` // Last successful lookup, nil if none succeeded yet
+	ChecksDisabled  bool       `json:"checks_disabled"` // Config.UpdateChecksDisabled, nothing is looked up
+	Error           string     `json:"error,omitempty"` // Why the last lookup failed
 }
 
 // @Summary Get latest version from GitHub releases
-// @Description Checks GitHub API for the latest Branchd release
+// @Description Returns the latest Branchd release, looked up on GitHub at most once an hour
 // @Tags system
 // @Produce json
 // @Success 200 {object} LatestVersionResponse
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/system/latest-version [get]
 func (s *Server) getLatestVersion(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Fetch latest release from GitHub API
-	cmd := exec.CommandContext(ctx, "curl", "-sL", "https://api.github.com/repos/branchd-dev/branchd/releases/latest")
-	output, err := cmd.Output()
-	if err != nil {
-		s.logger.Error().Err(err).Msg("Failed to fetch latest release from GitHub")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for updates"})
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil && err != gorm.ErrRecordNotFound {
+		s.logger.Error().Err(err).Msg("Failed to load config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	// Parse JSON to extract tag_name
-	cmd = exec.CommandContext(ctx, "bash", "-c", fmt.Sprintf("echo '%s' | jq -r '.tag_name'", string(output)))
-	latestVersionBytes, err := cmd.Output()
-	if err != nil {
-		s.logger.Error().Err(err).Msg("Failed to parse GitHub release response")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse update information"})
+	response := LatestVersionResponse{
+		CurrentVersion: s.version,
+		ChecksDisabled: config.UpdateChecksDisabled,
+	}
+	if config.UpdateChecksDisabled {
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
-	latestVersion := strings.TrimSpace(string(latestVersionBytes))
-	currentVersion := s.version
+	// A failed lookup still reports the last known version
+	latestVersion, checkedAt, err := s.latestReleaseVersion(c.Request.Context(), c.Query("refresh") == "true")
+	if err != nil {
+		response.Error = err.Error()
+	}
+	if !checkedAt.IsZero() {
+		response.LastCheckedAt = &checkedAt
+	}
 
 	// Compare versions (simple string comparison for now)
-	updateAvailable := latestVersion != "" && latestVersion != "null" && latestVersion != currentVersion
+	response.LatestVersion = latestVersion
+	response.UpdateAvailable = latestVersion != "" && latestVersion != s.version
 
-	c.JSON(http.StatusOK, LatestVersionResponse{
-		LatestVersion:   latestVersion,
-		CurrentVersion:  currentVersion,
-		UpdateAvailable: updateAvailable,
-	})
+	c.JSON(http.StatusOK, response)
 }
 
 // @Summary Update Branchd server to latest version
 // @Description Downloads and installs the latest Branchd release, then restarts services
+// @Description The previous version is restored if the new one doesn't answer /health or fails a branch smoke test, see /var/log/branchd-update.log
+// @Description Admin only, with two-factor authentication: it replaces the binaries on the host (any user could update before)
 // @Tags system
 // @Accept json
 // @Produce json
+// @Security BearerAuth
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/system/update [post]
 func (s *Server) updateServer(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Check if already on latest version
-	cmd := exec.CommandContext(ctx, "curl", "-sL", "https://api.github.com/repos/branchd-dev/branchd/releases/latest")
-	output, err := cmd.Output()
-	if err != nil {
-		s.logger.Error().Err(err).Msg("Failed to fetch latest release from GitHub")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for updates"})
+	var config models.Config
+	if err := s.db.First(&config).Error; err != nil && err != gorm.ErrRecordNotFound {
+		s.logger.Error().Err(err).Msg("Failed to load config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if config.UpdateChecksDisabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Update checks are disabled (update_checks_disabled), update the server manually"})
 		return
 	}
 
-	cmd = exec.CommandContext(ctx, "bash", "-c", fmt.Sprintf("echo '%s' | jq -r '.tag_name'", string(output)))
-	latestVersionBytes, err := cmd.Output()
+	// Check if already on latest version, bypassing the cache so the update installs the actual latest release
+	latestVersion, _, err := s.latestReleaseVersion(ctx, true)
 	if err != nil {
-		s.logger.Error().Err(err).Msg("Failed to parse GitHub release response")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse update information"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for updates"})
 		return
 	}
 
-	latestVersion := strings.TrimSpace(string(latestVersionBytes))
-
 	if latestVersion == s.version {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Already on latest version",
@@ -190,22 +268,37 @@ func (s *Server) updateServer(c *gin.Context) {
 		return
 	}
 
+	arch, err := bundleArch(runtime.GOARCH)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Trigger update in background (non-blocking)
-	go s.performUpdate(latestVersion)
+	go s.performUpdate(latestVersion, arch)
+
+	setAuditDetail(c, "from_version", s.version)
+	setAuditDetail(c, "to_version", latestVersion)
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":         "Update initiated - server will restart in a few seconds",
+		"message":         "Update initiated - server will restart in a few seconds and roll back if the new version fails its checks",
 		"current_version": s.version,
 		"new_version":     latestVersion,
 	})
 }
 
-// performUpdate downloads and installs the latest release
-func (s *Server) performUpdate(newVersion string) {
-	s.logger.Info().Str("current_version", s.version).Str("new_version", newVersion).Msg("Starting server update")
+// Rollback of a failed self-update
+const (
+	// updatePreviousDir keeps the binaries, web UI and a database snapshot from before the update, restored if the new
+	// version fails its checks (it may have migrated the database already)
+	updatePreviousDir = "/var/lib/branchd/previous"
+	// updateHealthTimeout is how long the new version has to answer /health after its services restart
+	updateHealthTimeout = 90 * time.Second
+)
 
-	// Create update script
-	updateScript := `#!/bin/bash
+// updateScriptTemplate installs a release bundle (arch, release tag, previous version directory and health timeout in
+// seconds) and rolls back to the previous version if the new one doesn't pass its health check and branch smoke test
+const updateScriptTemplate = `#!/bin/bash
 set -euo pipefail
 
 # Log everything to a file
@@ -214,11 +307,15 @@ exec > >(tee /var/log/branchd-update.log) 2>&1
 echo "=== Branchd Update Script Started at $(date) ==="
 
 GITHUB_REPO="branchd-dev/branchd"
-BRANCHD_ARCH="arm64"
+BRANCHD_ARCH="%s"
 BUNDLE_NAME="branchd-linux-${BRANCHD_ARCH}.tar.gz"
 RELEASE_TAG="%s"
 DOWNLOAD_URL="https://github.com/${GITHUB_REPO}/releases/download/${RELEASE_TAG}/${BUNDLE_NAME}"
 CHECKSUM_URL="https://github.com/${GITHUB_REPO}/releases/download/${RELEASE_TAG}/${BUNDLE_NAME}.sha256"
+PREVIOUS_DIR="%s"
+HEALTH_URL="http://127.0.0.1:8080/health"
+HEALTH_TIMEOUT=%d
+WEB_DIR="/var/www/branchd"
 
 echo "Downloading Branchd ${RELEASE_TAG}..."
 cd /tmp
@@ -246,35 +343,162 @@ if [ ! -d "${BUNDLE_DIR}" ]; then
     exit 1
 fi
 
-echo "Stopping services..."
-systemctl stop branchd-server branchd-worker
+# All-in-one installs (branchd-server --all-in-one) have no worker service
+SERVICES="branchd-server"
+if systemctl is-enabled --quiet branchd-worker 2>/dev/null; then
+    SERVICES="branchd-server branchd-worker"
+fi
+
+cleanup() {
+    cd /
+    rm -rf /tmp/branchd-* /tmp/"${BUNDLE_NAME}" /tmp/"${BUNDLE_NAME}.sha256" "${WEB_DIR}.new"
+}
+
+# install_version installs the binaries and web UI of a directory (server, worker, web)
+# Files are renamed into place, the running services keep their binaries until they restart
+install_version() {
+    local dir="$1"
+    install -m 755 "${dir}/server" /usr/local/bin/branchd-server.new
+    mv -f /usr/local/bin/branchd-server.new /usr/local/bin/branchd-server
+    if [ -f "${dir}/worker" ]; then
+        install -m 755 "${dir}/worker" /usr/local/bin/branchd-worker.new
+        mv -f /usr/local/bin/branchd-worker.new /usr/local/bin/branchd-worker
+    fi
+
+    rm -rf "${WEB_DIR}.new"
+    cp -r "${dir}/web" "${WEB_DIR}.new"
+    chown -R caddy:caddy "${WEB_DIR}.new"
+    rm -rf "${WEB_DIR}.old"
+    mv "${WEB_DIR}" "${WEB_DIR}.old"
+    mv "${WEB_DIR}.new" "${WEB_DIR}"
+    rm -rf "${WEB_DIR}.old"
+}
+
+# restart_services restarts branchd with the installed binaries, Caddy reloads without dropping connections
+restart_services() {
+    systemctl daemon-reload
+    systemctl restart ${SERVICES}
+    systemctl reload-or-restart caddy
+}
+
+# check_health waits for /health and makes sure no service crashed (and was restarted by Restart=always) since
+check_health() {
+    local deadline=$((SECONDS + HEALTH_TIMEOUT))
+    until curl -fsS --max-time 5 "${HEALTH_URL}" > /dev/null; do
+        if [ "${SECONDS}" -ge "${deadline}" ]; then
+            echo "ERROR: ${HEALTH_URL} didn't respond within ${HEALTH_TIMEOUT}s"
+            return 1
+        fi
+        sleep 2
+    done
+
+    local pids=""
+    for service in ${SERVICES}; do
+        pids="${pids} $(systemctl show -p MainPID --value "${service}")"
+    done
+    sleep 10
+    local current=""
+    for service in ${SERVICES}; do
+        if ! systemctl is-active --quiet "${service}"; then
+            echo "ERROR: ${service} is not running"
+            return 1
+        fi
+        current="${current} $(systemctl show -p MainPID --value "${service}")"
+    done
+    if [ "${pids}" != "${current}" ]; then
+        echo "ERROR: A service restarted after starting (PIDs${pids} are now${current})"
+        return 1
+    fi
+}
+
+# run_as_service runs a command in the working directory and environment of the running branchd-server, read from the
+# process so Environment= and EnvironmentFile= settings (and .env files) apply with their values as they are
+run_as_service() {
+    local pid
+    pid="$(systemctl show -p MainPID --value branchd-server)"
+    if [ "${pid}" = "0" ] || [ ! -r "/proc/${pid}/environ" ]; then
+        echo "ERROR: branchd-server is not running"
+        return 1
+    fi
+    local vars=()
+    mapfile -d '' vars < "/proc/${pid}/environ"
+    (cd "$(readlink -f "/proc/${pid}/cwd")" && env -i "${vars[@]}" "$@")
+}
+
+# smoke_test clones a restore's dataset with the new server binary, as the service runs it (DATABASE_URL, ...)
+smoke_test() {
+    if ! run_as_service /usr/local/bin/branchd-server --smoke-test; then
+        echo "ERROR: Branch smoke test failed"
+        return 1
+    fi
+}
+
+# restore_database puts back the database snapshot taken before the update, with the services stopped
+restore_database() {
+    rm -f "${DATABASE_FILE}-wal" "${DATABASE_FILE}-shm"
+    cp "${PREVIOUS_DIR}/branchd.sqlite" "${DATABASE_FILE}"
+}
+
+echo "Keeping the current version in ${PREVIOUS_DIR} for rollback..."
+rm -rf "${PREVIOUS_DIR}"
+mkdir -p "${PREVIOUS_DIR}"
+cp -a /usr/local/bin/branchd-server "${PREVIOUS_DIR}/server"
+if [ -f /usr/local/bin/branchd-worker ]; then
+    cp -a /usr/local/bin/branchd-worker "${PREVIOUS_DIR}/worker"
+fi
+cp -a "${WEB_DIR}" "${PREVIOUS_DIR}/web"
 
-echo "Installing binaries..."
-install -m 755 "${BUNDLE_DIR}/server" /usr/local/bin/branchd-server
-install -m 755 "${BUNDLE_DIR}/worker" /usr/local/bin/branchd-worker
+# The new version migrates the database when it starts, the previous one may not run on the migrated schema
+DATABASE_FILE="$(run_as_service sh -c 'realpath -m "${DATABASE_URL:-branchd.sqlite}"')"
+echo "Snapshotting the database ${DATABASE_FILE} for rollback..."
+(umask 077 && sqlite3 "${DATABASE_FILE}" ".backup '${PREVIOUS_DIR}/branchd.sqlite'")
 
-echo "Installing web UI..."
-rm -rf /var/www/branchd/*
-cp -r "${BUNDLE_DIR}/web"/* /var/www/branchd/
-chown -R caddy:caddy /var/www/branchd
+echo "Installing ${RELEASE_TAG}..."
+install_version "${BUNDLE_DIR}"
 
 echo "Restarting services..."
-systemctl daemon-reload
-systemctl start branchd-server branchd-worker
-systemctl restart caddy
+restart_services
+
+echo "Checking ${RELEASE_TAG}..."
+if ! check_health || ! smoke_test; then
+    echo "Rolling back to the previous version and database, changes made since ${RELEASE_TAG} started are lost..."
+    journalctl -u branchd-server -n 50 --no-pager || true
+    systemctl stop ${SERVICES}
+    install_version "${PREVIOUS_DIR}"
+    restore_database
+    restart_services
+    cleanup
+    if ! check_health; then
+        echo "ERROR: The previous version failed its health check as well, see journalctl -u branchd-server"
+    fi
+    echo "✗ Update to ${RELEASE_TAG} rolled back at $(date)"
+    exit 1
+fi
 
 echo "Cleanup..."
-cd /
-rm -rf /tmp/branchd-* /tmp/"${BUNDLE_NAME}" /tmp/"${BUNDLE_NAME}.sha256"
+cleanup
 
 echo "✓ Update complete to ${RELEASE_TAG} at $(date)"
 `
 
+// updateScript renders the update script installing the newVersion bundle for arch
+func updateScript(newVersion, arch string) string {
+	return fmt.Sprintf(updateScriptTemplate, arch, newVersion, updatePreviousDir, int(updateHealthTimeout.Seconds()))
+}
+
+// performUpdate downloads and installs the latest release bundle for arch, rolling back if it fails its checks
+func (s *Server) performUpdate(newVersion, arch string) {
+	s.logger.Info().
+		Str("current_version", s.version).
+		Str("new_version", newVersion).
+		Str("arch", arch).
+		Msg("Starting server update")
+
 	// Write script to /run directory
 	// Cannot use /tmp or /var/tmp because the service has PrivateTmp=true
 	// which creates private namespaces for both, making files inaccessible to systemd-run
 	// /run is not affected by PrivateTmp and is the standard location for runtime files
-	scriptContent := fmt.Sprintf(updateScript, newVersion)
+	scriptContent := updateScript(newVersion, arch)
 	scriptPath := "/run/branchd-update.sh"
 	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
 		s.logger.Error().Err(err).Msg("Failed to create update script")
@@ -294,3 +518,144 @@ echo "✓ Update complete to ${RELEASE_TAG} at $(date)"
 		s.logger.Info().Str("output", string(output)).Msg("Update process started successfully")
 	}
 }
+
+// bundleArch returns the release bundle architecture for a Go architecture
+// The server binary is built for the host, so its GOARCH identifies the bundle to install
+func bundleArch(goarch string) (string, error) {
+	switch goarch {
+	case "amd64", "arm64":
+		return goarch, nil
+	default:
+		return "", fmt.Errorf("self-update is not supported on %s (release bundles exist for amd64 and arm64)", goarch)
+	}
+}
+
+// UpdateLogLevelRequest changes the log level of a component or the default level
+type UpdateLogLevelRequest struct {
+	Component string `json:"component"` // e.g. "restore_orchestrator", empty = default level
+	Level     string `json:"level"`     // trace, debug, info, warn, error; empty resets the component to the default
+}
+
+// @Summary Get log levels
+// @Description Returns the default log level and the components logging at their own level (admin only)
+// @Tags system
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} logger.Levels
+// @Router /api/system/log-levels [get]
+func (s *Server) getLogLevels(c *gin.Context) {
+	c.JSON(http.StatusOK, logger.GetLevels())
+}
+
+// @Summary Change log level
+// @Description Changes a log level of this process until it restarts (admin only)
+// @Description A separate branchd-worker keeps the levels of LOG_LEVEL and LOG_COMPONENT_LEVELS
+// @Tags system
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateLogLevelRequest true "Log level"
+// @Success 200 {object} logger.Levels
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/system/log-level [put]
+func (s *Server) updateLogLevel(c *gin.Context) {
+	var req UpdateLogLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	component := strings.TrimSpace(req.Component)
+	if err := logger.SetLevel(component, req.Level); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setAuditDetail(c, "component", component)
+	setAuditDetail(c, "level", req.Level)
+
+	s.logger.Info().
+		Str("log_component", component).
+		Str("level", req.Level).
+		Msg("Log level changed")
+
+	c.JSON(http.StatusOK, logger.GetLevels())
+}
+
+// @Summary Back up database
+// @Description Archives a snapshot of the SQLite database and the server configuration to BACKUP_DIR, and to
+// @Description BACKUP_S3_BUCKET if set, deleting archives past BACKUP_KEEP (admin only)
+// @Description Restore an archive with branchd-server --restore-backup while branchd is stopped
+// @Description Archives aren't encrypted and hold the full database, including the JWT secret and all stored credentials
+// @Tags system
+// @Produce json
+// @Security BearerAuth
+// @Success 201 {object} backup.Result
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/system/backup [post]
+func (s *Server) backupDatabase(c *gin.Context) {
+	result, err := backup.Run(c.Request.Context(), s.db, s.config, s.logger)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to back up database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to back up database", "details": err.Error()})
+		return
+	}
+
+	setAuditDetail(c, "name", result.Name)
+	if result.S3URL != "" {
+		setAuditDetail(c, "s3_url", result.S3URL)
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// @Summary Get reconciliation report
+// @Description Lists ZFS datasets, systemd units, PostgreSQL processes, listening ports and firewall rules without a
+// @Description restore or branch record, and records whose dataset is gone (admin only)
+// @Description Ports and firewall rules aren't compared while branches are being created
+// @Tags system
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} reconcile.Report
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/system/reconcile [get]
+func (s *Server) getReconcileReport(c *gin.Context) {
+	report, err := reconcile.Run(c.Request.Context(), s.db, s.config, false, s.logger)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to reconcile resources")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile resources", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// @Summary Clean up orphaned resources
+// @Description Removes the units, stops the processes, closes the firewall rules and destroys the datasets of
+// @Description GET /api/system/reconcile's orphans (admin only)
+// @Description Records whose dataset is gone are only reported, delete them through their restore or branch
+// @Tags system
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} reconcile.Report
+// @Failure 500 {object} map[string]interface{}
+// @Router /api/system/reconcile [post]
+func (s *Server) reconcileResources(c *gin.Context) {
+	report, err := reconcile.Run(c.Request.Context(), s.db, s.config, true, s.logger)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to reconcile resources")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile resources", "details": err.Error()})
+		return
+	}
+
+	fixed := 0
+	for _, orphan := range report.Orphans {
+		if orphan.Fixed {
+			fixed++
+		}
+	}
+	setAuditDetail(c, "orphans", fmt.Sprint(len(report.Orphans)))
+	setAuditDetail(c, "fixed", fmt.Sprint(fixed))
+
+	c.JSON(http.StatusOK, report)
+}
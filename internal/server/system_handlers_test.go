@@ -0,0 +1,68 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBundleArch(t *testing.T) {
+	for _, goarch := range []string{"amd64", "arm64"} {
+		got, err := bundleArch(goarch)
+		if err != nil || got != goarch {
+			t.Errorf("bundleArch(%q) = %q, %v, want %q", goarch, got, err, goarch)
+		}
+	}
+	for _, goarch := range []string{"386", "riscv64", ""} {
+		if got, err := bundleArch(goarch); err == nil {
+			t.Errorf("bundleArch(%q) = %q, want an error", goarch, got)
+		}
+	}
+}
+
+func TestUpdateScriptInstallsHostBundle(t *testing.T) {
+	script := updateScript("v1.2.3", "amd64")
+
+	for _, want := range []string{
+		`BRANCHD_ARCH="amd64"`,
+		`RELEASE_TAG="v1.2.3"`,
+		`BUNDLE_NAME="branchd-linux-${BRANCHD_ARCH}.tar.gz"`,
+		`BUNDLE_DIR="branchd-${BRANCHD_ARCH}"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("update script doesn't contain %q", want)
+		}
+	}
+	if strings.Contains(script, "arm64") || strings.Contains(script, "%!") {
+		t.Error("update script mentions another architecture or has unfilled verbs")
+	}
+}
+
+func TestUpdateScriptRollsBack(t *testing.T) {
+	script := updateScript("v1.2.3", "amd64")
+
+	for _, want := range []string{
+		`PREVIOUS_DIR="/var/lib/branchd/previous"`,
+		`HEALTH_TIMEOUT=90`,
+		`cp -a /usr/local/bin/branchd-server "${PREVIOUS_DIR}/server"`,
+		`/usr/local/bin/branchd-server --smoke-test`,
+		`if ! check_health || ! smoke_test; then`,
+		`install_version "${PREVIOUS_DIR}"`,
+		`sqlite3 "${DATABASE_FILE}" ".backup '${PREVIOUS_DIR}/branchd.sqlite'"`,
+		`restore_database`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("update script doesn't contain %q", want)
+		}
+	}
+	// The previous version is kept before anything is installed
+	if strings.Index(script, `cp -a "${WEB_DIR}" "${PREVIOUS_DIR}/web"`) > strings.Index(script, `install_version "${BUNDLE_DIR}"`) {
+		t.Error("update script installs the new version before keeping the previous one")
+	}
+	if strings.Index(script, `.backup`) > strings.Index(script, `install_version "${BUNDLE_DIR}"`) {
+		t.Error("update script installs the new version before snapshotting the database")
+	}
+	// The smoke test gets the service's environment as it is, not word-split
+	if strings.Contains(script, "systemctl show -p Environment") {
+		t.Error("update script word-splits the service's Environment= settings")
+	}
+}
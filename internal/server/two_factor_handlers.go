@@ -0,0 +1,273 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// totpIssuer names the account in authenticator apps
+const totpIssuer = "branchd"
+
+// Guessing codes: after maxTOTPFailures wrong codes in a row the user's codes aren't checked for totpLockout,
+// doubling with every further wrong code up to totpMaxLockout. An accepted code or an admin's reset clears it
+const (
+	maxTOTPFailures = 5
+	totpLockout     = time.Minute
+	totpMaxLockout  = time.Hour
+)
+
+// TwoFactorSetupResponse is the secret to enroll in an authenticator app
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`      // Base32, for manual entry
+	OTPAuthURL string `json:"otpauth_url"` // otpauth:// URI, usually rendered as a QR code
+}
+
+// TwoFactorVerifyRequest is a code of the user's authenticator app
+type TwoFactorVerifyRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// @Summary Set up two-factor authentication
+// @Description Generate a TOTP secret for the current user's authenticator app
+// @Description Two-factor authentication is enabled once a code is verified with POST /api/auth/2fa/verify
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} TwoFactorSetupResponse
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/auth/2fa/setup [post]
+func (s *Server) setupTwoFactor(c *gin.Context) {
+	user, ok := s.findSessionUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to generate TOTP secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+	if err := s.db.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		s.logger.Error().Err(err).Str("user_id", user.ID).Msg("Failed to save TOTP secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+
+	setAuditResource(c, user.ID)
+
+	c.JSON(http.StatusOK, TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURL: auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// @Summary Verify two-factor code
+// @Description Verify a code of the current user's authenticator app, enabling two-factor authentication after setup
+// @Description Returns a new token that is allowed on routes requiring two-factor authentication (e.g. after an SSO login)
+// @Description After 5 wrong codes in a row codes aren't checked for a minute, doubling with every further wrong code (429)
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TwoFactorVerifyRequest true "Authenticator code"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /api/auth/2fa/verify [post]
+func (s *Server) verifyTwoFactor(c *gin.Context) {
+	var req TwoFactorVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := s.findSessionUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not set up, call POST /api/auth/2fa/setup first"})
+		return
+	}
+
+	valid, retryAfter, err := s.verifyTOTPCode(user, req.Code)
+	if err != nil {
+		s.logger.Error().Err(err).Str("user_id", user.ID).Msg("Failed to verify TOTP code")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	setAuditResource(c, user.ID)
+	if retryAfter > 0 {
+		respondTOTPLocked(c, retryAfter)
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		if err := s.db.Model(user).Update("totp_enabled", true).Error; err != nil {
+			s.logger.Error().Err(err).Str("user_id", user.ID).Msg("Failed to enable two-factor authentication")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		user.TOTPEnabled = true
+		setAuditDetail(c, "enabled", "true")
+		s.logger.Info().Str("user_id", user.ID).Str("email", user.Email).Msg("Two-factor authentication enabled")
+	}
+
+	token, err := auth.GenerateTwoFactorToken(user.ID, user.Email, user.IsAdmin)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to generate token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		Token: token,
+		User: &UserDetail{
+			ID:        user.ID,
+			Email:     user.Email,
+			Name:      user.Name,
+			IsAdmin:   user.IsAdmin,
+			CreatedAt: user.CreatedAt,
+
+			TwoFactorEnabled: user.TOTPEnabled,
+			SSOLinked:        user.OIDCSubject != "",
+		},
+	})
+}
+
+// @Summary Reset two-factor authentication
+// @Description Remove a user's authenticator, e.g. after the device was lost (admin only)
+// @Description The user can log in with the password alone and set up two-factor authentication again
+// @Tags users
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/users/{id}/2fa [delete]
+func (s *Server) resetUserTwoFactor(c *gin.Context) {
+	userID := c.Param("id")
+
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		s.logger.Error().Err(err).Str("user_id", userID).Msg("Failed to find user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := s.db.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":       "",
+		"totp_enabled":      false,
+		"totp_last_step":    0,
+		"totp_failures":     0,
+		"totp_locked_until": nil,
+	}).Error; err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msg("Failed to reset two-factor authentication")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	setAuditDetail(c, "email", user.Email)
+	s.logger.Info().Str("user_id", user.ID).Str("email", user.Email).Msg("Two-factor authentication reset")
+
+	c.Status(http.StatusNoContent)
+}
+
+// verifyTOTPCode checks a code of the user's authenticator, each code is only accepted once
+// While the user is locked out after too many wrong codes, the code isn't checked and retryAfter is set
+func (s *Server) verifyTOTPCode(user *models.User, code string) (valid bool, retryAfter time.Duration, err error) {
+	now := time.Now()
+
+	// Counted before checking the code, conditionally so requests racing past a lockout can't guess in parallel
+	result := s.db.Model(&models.User{}).
+		Where("id = ? AND (totp_locked_until IS NULL OR totp_locked_until <= ?)", user.ID, now).
+		Update("totp_failures", gorm.Expr("totp_failures + 1"))
+	if result.Error != nil {
+		return false, 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var locked models.User
+		if err := s.db.Select("totp_locked_until").Where("id = ?", user.ID).First(&locked).Error; err != nil {
+			return false, 0, err
+		}
+		if locked.TOTPLockedUntil == nil {
+			return false, 0, nil
+		}
+		return false, max(locked.TOTPLockedUntil.Sub(now).Round(time.Second), time.Second), nil
+	}
+
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, now); ok {
+		// Conditional update, so two requests racing with the same code can't both succeed
+		result := s.db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Updates(map[string]interface{}{"totp_last_step": step, "totp_failures": 0, "totp_locked_until": nil})
+		if result.Error != nil {
+			return false, 0, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return true, 0, nil
+		}
+	}
+
+	// Wrong or reused code, the attempt stays counted
+	var counted models.User
+	if err := s.db.Select("totp_failures").Where("id = ?", user.ID).First(&counted).Error; err != nil {
+		return false, 0, err
+	}
+	if counted.TOTPFailures >= maxTOTPFailures {
+		lockout := min(totpLockout<<min(counted.TOTPFailures-maxTOTPFailures, 6), totpMaxLockout)
+		if err := s.db.Model(&models.User{}).Where("id = ?", user.ID).Update("totp_locked_until", now.Add(lockout)).Error; err != nil {
+			return false, 0, err
+		}
+		s.logger.Warn().Str("user_id", user.ID).Int("failures", counted.TOTPFailures).Dur("lockout", lockout).
+			Msg("Too many wrong two-factor codes, user locked out of code checks")
+	}
+	return false, 0, nil
+}
+
+// respondTOTPLocked rejects a code of a user locked out after too many wrong codes, with a Retry-After header
+func respondTOTPLocked(c *gin.Context, retryAfter time.Duration) {
+	seconds := strconv.Itoa(int(retryAfter / time.Second))
+	c.Header("Retry-After", seconds)
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":               "Too many wrong two-factor codes, retry after " + seconds + "s",
+		"two_factor_required": true,
+	})
+}
+
+// findSessionUser loads the authenticated user, writing the error response if it can't
+func (s *Server) findSessionUser(c *gin.Context) (*models.User, bool) {
+	sessionData, exists := GetSessionData(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", sessionData.UserID).First(&user).Error; err != nil {
+		s.logger.Error().Err(err).Str("user_id", sessionData.UserID).Msg("Failed to find user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	return &user, true
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/branchd-dev/branchd/internal/auth"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// testTOTPCode computes the current code of a secret, as an authenticator app does (RFC 6238)
+func testTOTPCode(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("invalid secret: %v", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+func TestVerifyTOTPCodeLocksOut(t *testing.T) {
+	s := newTestServer(t)
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	user := models.User{Email: "carol@example.com", PasswordHash: "hash", TOTPSecret: secret, TOTPEnabled: true}
+	createTestUser(t, s, &user)
+	code := testTOTPCode(t, secret)
+	wrong := "000000"
+	if wrong == code {
+		wrong = "111111"
+	}
+
+	for i := range maxTOTPFailures {
+		valid, retryAfter, err := s.verifyTOTPCode(&user, wrong)
+		if err != nil || valid || retryAfter != 0 {
+			t.Fatalf("wrong code %d: verifyTOTPCode() = %v, %v, %v, want rejected", i+1, valid, retryAfter, err)
+		}
+	}
+
+	// Locked out, even the right code isn't checked
+	valid, retryAfter, err := s.verifyTOTPCode(&user, code)
+	if err != nil || valid || retryAfter <= 0 || retryAfter > totpLockout {
+		t.Fatalf("locked out: verifyTOTPCode() = %v, %v, %v, want a retry within %v", valid, retryAfter, err, totpLockout)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/auth/2fa/verify", strings.NewReader(`{"code":"`+code+`"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("session", &auth.SessionData{UserID: user.ID, Email: user.Email, TwoFactorEnabled: true})
+	s.verifyTwoFactor(c)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("verifyTwoFactor() while locked out status = %d, Retry-After = %q, want 429 with a Retry-After",
+			w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// The next wrong code after the lockout locks out for twice as long
+	past := time.Now().Add(-time.Second)
+	s.db.Model(&user).Update("totp_locked_until", past)
+	if _, _, err := s.verifyTOTPCode(&user, wrong); err != nil {
+		t.Fatalf("verifyTOTPCode() error = %v", err)
+	}
+	if _, retryAfter, _ := s.verifyTOTPCode(&user, code); retryAfter <= totpLockout {
+		t.Errorf("second lockout retry after = %v, want over %v", retryAfter, totpLockout)
+	}
+
+	// An accepted code clears the failures
+	s.db.Model(&user).Update("totp_locked_until", past)
+	if valid, _, err := s.verifyTOTPCode(&user, code); err != nil || !valid {
+		t.Fatalf("after the lockout: verifyTOTPCode() = %v, %v, want the code accepted", valid, err)
+	}
+	var stored models.User
+	if err := s.db.First(&stored, "id = ?", user.ID).Error; err != nil {
+		t.Fatalf("failed to load user: %v", err)
+	}
+	if stored.TOTPFailures != 0 || stored.TOTPLockedUntil != nil {
+		t.Errorf("failures = %d, locked until %v, want them cleared", stored.TOTPFailures, stored.TOTPLockedUntil)
+	}
+}
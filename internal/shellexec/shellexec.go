@@ -0,0 +1,54 @@
+// Package shellexec runs branchd's embedded bash scripts
+//
+// Scripts are never rendered: their text is constant and their parameters are passed in the environment
+// (fields tagged `env:"NAME"`) and as arguments ($1, $2, ...), so branch names, connection strings or SQL
+// can't change what a script runs, whatever characters they contain
+package shellexec
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+)
+
+// Command returns a command running script with bash, the env fields of params in its environment
+// (see Env) and args as the script's positional parameters
+func Command(ctx context.Context, script string, params any, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "bash", append([]string{"-c", script, "bash"}, args...)...)
+	cmd.Env = append(os.Environ(), Env(params)...)
+	return cmd
+}
+
+// Env returns NAME=value for each field of params (a struct or a pointer to one) tagged `env:"NAME"`
+// Slices are passed one element per line, other values formatted with fmt. params may be nil
+func Env(params any) []string {
+	if params == nil {
+		return nil
+	}
+	v := reflect.Indirect(reflect.ValueOf(params))
+	t := v.Type()
+
+	var env []string
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		env = append(env, name+"="+formatValue(v.Field(i)))
+	}
+	return env
+}
+
+func formatValue(field reflect.Value) string {
+	if field.Kind() != reflect.Slice {
+		return fmt.Sprint(field.Interface())
+	}
+	lines := make([]string, field.Len())
+	for i := range lines {
+		lines[i] = fmt.Sprint(field.Index(i).Interface())
+	}
+	return strings.Join(lines, "\n")
+}
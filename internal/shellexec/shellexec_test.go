@@ -0,0 +1,52 @@
+package shellexec
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testParams struct {
+	Name    string   `env:"NAME"`
+	Port    int      `env:"PORT"`
+	Enabled bool     `env:"ENABLED"`
+	SQL     []string `env:"SQL"`
+	Ignored string
+}
+
+func TestEnv(t *testing.T) {
+	got := Env(&testParams{
+		Name:    "my-branch",
+		Port:    15432,
+		Enabled: true,
+		SQL:     []string{"SELECT 1;", "SELECT 2;"},
+		Ignored: "x",
+	})
+	want := []string{"NAME=my-branch", "PORT=15432", "ENABLED=true", "SQL=SELECT 1;\nSELECT 2;"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Env() = %q, want %q", got, want)
+	}
+
+	if got := Env(nil); got != nil {
+		t.Errorf("Env(nil) = %q, want nil", got)
+	}
+}
+
+func TestCommandPassesValuesVerbatim(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+
+	// Values a template would have turned into code
+	name := `x"; echo injected; "$(echo injected)` + "`echo injected`"
+	arg := `'; echo injected; '`
+	output, err := Command(context.Background(), `printf '%s\n' "${NAME}" "$1"`, testParams{Name: name}, arg).Output()
+	if err != nil {
+		t.Fatalf("Command() error = %v", err)
+	}
+	if got := strings.TrimSuffix(string(output), "\n"); got != name+"\n"+arg {
+		t.Errorf("output = %q, want the values unchanged", got)
+	}
+}
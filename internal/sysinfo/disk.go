@@ -0,0 +1,86 @@
+package sysinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// DiskSpaceReserveBytes is kept free on top of every estimate so PostgreSQL and ZFS never run completely out of space
+const DiskSpaceReserveBytes = 1 << 30
+
+// ErrInsufficientDiskSpace is returned by CheckDiskSpace when the dataset can't fit the estimate
+var ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+
+// zfsAvailable prints the available bytes of a ZFS dataset (replaced in tests)
+var zfsAvailable = func(ctx context.Context, dataset string) ([]byte, error) {
+	return exec.CommandContext(ctx, "zfs", "list", "-H", "-p", "-o", "available", dataset).Output()
+}
+
+// AvailableDiskBytes returns the space available to new data in the given ZFS dataset
+func AvailableDiskBytes(ctx context.Context, dataset string) (int64, error) {
+	output, err := zfsAvailable(ctx, dataset)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get ZFS available space: %w", err)
+	}
+
+	available, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse available space: %w", err)
+	}
+	return available, nil
+}
+
+// zfsSpace prints the available and used bytes of a ZFS dataset (replaced in tests)
+var zfsSpace = func(ctx context.Context, dataset string) ([]byte, error) {
+	return exec.CommandContext(ctx, "zfs", "list", "-H", "-p", "-o", "available,used", dataset).Output()
+}
+
+// FreeDiskPercent returns how much of a ZFS dataset's space (used plus available) is still available, in percent,
+// and the available bytes
+func FreeDiskPercent(ctx context.Context, dataset string) (float64, int64, error) {
+	output, err := zfsSpace(ctx, dataset)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get ZFS space: %w", err)
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected zfs list output %q", strings.TrimSpace(string(output)))
+	}
+	available, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse available space: %w", err)
+	}
+	used, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse used space: %w", err)
+	}
+	if available+used == 0 {
+		return 0, 0, fmt.Errorf("dataset %s has no space", dataset)
+	}
+	return float64(available) * 100 / float64(available+used), available, nil
+}
+
+// CheckDiskSpace fails with ErrInsufficientDiskSpace unless the dataset has requiredBytes plus DiskSpaceReserveBytes available
+// The error reports required and available space so it can be shown to users as is
+func CheckDiskSpace(ctx context.Context, dataset string, requiredBytes int64) error {
+	available, err := AvailableDiskBytes(ctx, dataset)
+	if err != nil {
+		return err
+	}
+
+	required := requiredBytes + DiskSpaceReserveBytes
+	if available < required {
+		return fmt.Errorf("%w on %s: %s required, %s available", ErrInsufficientDiskSpace, dataset, FormatBytes(required), FormatBytes(available))
+	}
+	return nil
+}
+
+// FormatBytes formats a size in GB with one decimal (e.g. "12.5 GB")
+func FormatBytes(bytes int64) string {
+	return fmt.Sprintf("%.1f GB", float64(bytes)/(1024*1024*1024))
+}
@@ -0,0 +1,114 @@
+package sysinfo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        string
+		zfsErr        error
+		requiredBytes int64
+		wantErr       string
+		wantNoSpace   bool
+	}{
+		{
+			name:          "estimate and reserve fit",
+			output:        "3221225472\n", // 3 GB
+			requiredBytes: 2 << 30,
+		},
+		{
+			name:          "estimate fits but the reserve doesn't",
+			output:        "3221225472\n",
+			requiredBytes: 5 << 29, // 2.5 GB
+			wantErr:       "insufficient disk space on tank: 3.5 GB required, 3.0 GB available",
+			wantNoSpace:   true,
+		},
+		{
+			name:        "only the reserve left",
+			output:      "1073741823\n",
+			wantErr:     "1.0 GB required",
+			wantNoSpace: true,
+		},
+		{
+			name:    "zfs fails",
+			zfsErr:  errors.New("dataset does not exist"),
+			wantErr: "failed to get ZFS available space",
+		},
+		{
+			name:    "unexpected output",
+			output:  "-\n",
+			wantErr: "failed to parse available space",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := zfsAvailable
+			t.Cleanup(func() { zfsAvailable = original })
+			zfsAvailable = func(ctx context.Context, dataset string) ([]byte, error) {
+				if dataset != "tank" {
+					t.Errorf("zfs list %s, want tank", dataset)
+				}
+				return []byte(tt.output), tt.zfsErr
+			}
+
+			err := CheckDiskSpace(context.Background(), "tank", tt.requiredBytes)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckDiskSpace() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckDiskSpace() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrInsufficientDiskSpace) != tt.wantNoSpace {
+				t.Errorf("errors.Is(%v, ErrInsufficientDiskSpace) = %v, want %v", err, !tt.wantNoSpace, tt.wantNoSpace)
+			}
+		})
+	}
+}
+
+func TestFreeDiskPercent(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		wantPercent float64
+		wantErr     string
+	}{
+		{name: "quarter free", output: "25\t75\n", wantPercent: 25},
+		{name: "empty dataset", output: "100\t0\n", wantPercent: 100},
+		{name: "no space", output: "0\t0\n", wantErr: "has no space"},
+		{name: "missing column", output: "25\n", wantErr: "unexpected zfs list output"},
+		{name: "unexpected value", output: "-\t75\n", wantErr: "failed to parse available space"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := zfsSpace
+			t.Cleanup(func() { zfsSpace = original })
+			zfsSpace = func(ctx context.Context, dataset string) ([]byte, error) {
+				return []byte(tt.output), nil
+			}
+
+			percent, _, err := FreeDiskPercent(context.Background(), "tank")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("FreeDiskPercent() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FreeDiskPercent() error = %v", err)
+			}
+			if percent != tt.wantPercent {
+				t.Errorf("FreeDiskPercent() = %v, want %v", percent, tt.wantPercent)
+			}
+		})
+	}
+}
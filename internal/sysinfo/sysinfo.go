@@ -30,9 +30,10 @@ type Metrics struct {
 	DiskUsedPercent float64 `json:"disk_used_percent"`
 }
 
-// GetResources returns basic system resources for restore tuning
-func GetResources() (Resources, error) {
-	metrics, err := GetMetrics(context.Background())
+// GetResources returns basic system resources for restore tuning.
+// dataset is the ZFS dataset whose available space is reported (e.g. "tank").
+func GetResources(dataset string) (Resources, error) {
+	metrics, err := GetMetrics(context.Background(), dataset)
 	if err != nil {
 		// Return defaults on error
 		return Resources{
@@ -49,8 +50,8 @@ func GetResources() (Resources, error) {
 	}, nil
 }
 
-// GetMetrics returns detailed system metrics
-func GetMetrics(ctx context.Context) (Metrics, error) {
+// GetMetrics returns detailed system metrics, reporting disk usage for the given ZFS dataset
+func GetMetrics(ctx context.Context, dataset string) (Metrics, error) {
 	metrics := Metrics{
 		CPUCount: runtime.NumCPU(),
 	}
@@ -61,13 +62,48 @@ func GetMetrics(ctx context.Context) (Metrics, error) {
 	}
 
 	// Get disk info from ZFS pool
-	if err := getZFSDiskInfo(ctx, &metrics); err != nil {
+	if err := getZFSDiskInfo(ctx, dataset, &metrics); err != nil {
 		return metrics, fmt.Errorf("failed to get disk info: %w", err)
 	}
 
 	return metrics, nil
 }
 
+// TotalMemoryMB returns the VM's total memory in megabytes
+func TotalMemoryMB() (int, error) {
+	var metrics Metrics
+	if err := getMemoryInfo(&metrics); err != nil {
+		return 0, err
+	}
+	return int(metrics.MemoryTotalGB * 1024), nil
+}
+
+// AvailableMemoryMB returns the memory available to new processes without swapping (MemAvailable), in megabytes
+func AvailableMemoryMB() (int, error) {
+	var metrics Metrics
+	if err := getMemoryInfo(&metrics); err != nil {
+		return 0, err
+	}
+	return int(metrics.MemoryFreeGB * 1024), nil
+}
+
+// LoadAverage returns the 1-minute load average from /proc/loadavg
+func LoadAverage() (float64, error) {
+	content, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read /proc/loadavg: %w", err)
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/loadavg content %q", strings.TrimSpace(string(content)))
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse load average: %w", err)
+	}
+	return load, nil
+}
+
 // getMemoryInfo reads memory information from /proc/meminfo
 func getMemoryInfo(metrics *Metrics) error {
 	file, err := os.Open("/proc/meminfo")
@@ -109,11 +145,10 @@ func getMemoryInfo(metrics *Metrics) error {
 	return nil
 }
 
-// getZFSDiskInfo retrieves disk information from ZFS pool "tank"
-func getZFSDiskInfo(ctx context.Context, metrics *Metrics) error {
+// getZFSDiskInfo retrieves disk information from the given ZFS dataset
+func getZFSDiskInfo(ctx context.Context, dataset string, metrics *Metrics) error {
 	// Get ZFS pool info: available and used space
-	cmd := exec.CommandContext(ctx, "bash", "-c",
-		"zfs list -H -o available,used -p tank | head -1")
+	cmd := exec.CommandContext(ctx, "zfs", "list", "-H", "-o", "available,used", "-p", dataset)
 	output, err := cmd.Output()
 	if err != nil {
 		return fmt.Errorf("failed to get ZFS pool info: %w", err)
@@ -0,0 +1,112 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// MaxReplayAttempts is how often a buffered task rejected by Redis is replayed before it's dropped
+const MaxReplayAttempts = 5
+
+// bufferedOptions returns the enqueue options of the task types buffered while Redis is unavailable
+// Only restore triggers are buffered, they're started unattended (scheduled refreshes, CI pipelines) and their
+// restore record is already created. Callers of other tasks get ErrQueueUnavailable and retry themselves
+func bufferedOptions(taskType string, cfg *config.Config) ([]asynq.Option, bool) {
+	switch taskType {
+	case TypeTriggerRestore:
+		return []asynq.Option{
+			Timeout(TypeTriggerRestore, TriggerRestoreTimeout, cfg.Worker),
+			Retention(TypeTriggerRestore, cfg.Redis),
+			Queue(TypeTriggerRestore, cfg.Worker),
+		}, true
+	}
+	return nil, false
+}
+
+// EnqueueOrBuffer enqueues a task with the options of its type. A restore trigger that can't be enqueued because
+// Redis is unavailable is stored in the database instead and enqueued by ReplayBuffered once Redis is back
+// Returns whether the task was buffered, the task info is nil then
+func EnqueueOrBuffer(db *gorm.DB, client Enqueuer, task *asynq.Task, cfg *config.Config) (*asynq.TaskInfo, bool, error) {
+	opts, ok := bufferedOptions(task.Type(), cfg)
+	if !ok {
+		return nil, false, fmt.Errorf("tasks of type %s can't be buffered", task.Type())
+	}
+
+	info, err := client.Enqueue(task, opts...)
+	if err == nil || !errors.Is(err, ErrQueueUnavailable) {
+		return info, false, err
+	}
+
+	if err := db.Create(&models.BufferedTask{Type: task.Type(), Payload: task.Payload()}).Error; err != nil {
+		return nil, false, fmt.Errorf("%w (failed to buffer task: %v)", ErrQueueUnavailable, err)
+	}
+	return nil, true, nil
+}
+
+// BufferedCount returns the number of tasks waiting to be replayed
+func BufferedCount(db *gorm.DB) (int64, error) {
+	var count int64
+	err := db.Model(&models.BufferedTask{}).Count(&count).Error
+	return count, err
+}
+
+// ReplayBuffered enqueues the buffered tasks in the order they were buffered and deletes them
+// Stops at the first task that fails because Redis is still unavailable. Returns the number of tasks enqueued
+func ReplayBuffered(db *gorm.DB, client Enqueuer, cfg *config.Config, logger zerolog.Logger) (int, error) {
+	var buffered []models.BufferedTask
+	if err := db.Order("created_at ASC").Find(&buffered).Error; err != nil {
+		return 0, fmt.Errorf("failed to load buffered tasks: %w", err)
+	}
+
+	replayed := 0
+	for i := range buffered {
+		bufferedTask := &buffered[i]
+
+		opts, ok := bufferedOptions(bufferedTask.Type, cfg)
+		if !ok {
+			logger.Error().
+				Str("task_id", bufferedTask.ID).
+				Str("task_type", bufferedTask.Type).
+				Msg("Dropping buffered task of a type that isn't buffered")
+			if err := db.Delete(bufferedTask).Error; err != nil {
+				return replayed, fmt.Errorf("failed to delete buffered task: %w", err)
+			}
+			continue
+		}
+
+		_, err := client.Enqueue(asynq.NewTask(bufferedTask.Type, bufferedTask.Payload), opts...)
+		switch {
+		case errors.Is(err, ErrQueueUnavailable):
+			return replayed, err
+		case err != nil && bufferedTask.Attempts+1 < MaxReplayAttempts:
+			if err := db.Model(bufferedTask).Updates(map[string]interface{}{
+				"attempts":   bufferedTask.Attempts + 1,
+				"last_error": err.Error(),
+			}).Error; err != nil {
+				return replayed, fmt.Errorf("failed to record replay error: %w", err)
+			}
+			continue
+		case err != nil:
+			logger.Error().
+				Err(err).
+				Str("task_id", bufferedTask.ID).
+				Str("task_type", bufferedTask.Type).
+				Int("attempts", bufferedTask.Attempts+1).
+				Msg("Dropping buffered task rejected by Redis")
+		default:
+			replayed++
+		}
+
+		if err := db.Delete(bufferedTask).Error; err != nil {
+			return replayed, fmt.Errorf("failed to delete buffered task: %w", err)
+		}
+	}
+	return replayed, nil
+}
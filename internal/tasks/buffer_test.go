@@ -0,0 +1,139 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// fakeEnqueuer returns err from Enqueue and records the tasks it accepted
+type fakeEnqueuer struct {
+	err      error
+	enqueued []*asynq.Task
+}
+
+func (f *fakeEnqueuer) Enqueue(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.enqueued = append(f.enqueued, task)
+	return &asynq.TaskInfo{ID: fmt.Sprintf("task-%d", len(f.enqueued)), Type: task.Type()}, nil
+}
+
+func (f *fakeEnqueuer) Close() error { return nil }
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// In-memory databases exist per connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	return db
+}
+
+func TestEnqueueOrBufferReplaysOnceRedisIsBack(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &config.Config{}
+	client := &fakeEnqueuer{err: fmt.Errorf("%w: dial tcp: connection refused", ErrQueueUnavailable)}
+
+	for _, restoreID := range []string{"r1", "r2"} {
+		task, _ := NewTriggerRestoreTask(restoreID)
+		info, buffered, err := EnqueueOrBuffer(db, client, task, cfg)
+		if err != nil || !buffered || info != nil {
+			t.Fatalf("EnqueueOrBuffer() during outage = %v, %v, %v; want buffered", info, buffered, err)
+		}
+	}
+
+	// Still down, nothing is replayed or lost
+	if replayed, err := ReplayBuffered(db, client, cfg, zerolog.Nop()); replayed != 0 || !errors.Is(err, ErrQueueUnavailable) {
+		t.Errorf("ReplayBuffered() during outage = %d, %v; want 0, ErrQueueUnavailable", replayed, err)
+	}
+	if count, _ := BufferedCount(db); count != 2 {
+		t.Fatalf("buffered tasks = %d, want 2", count)
+	}
+
+	client.err = nil
+	if replayed, err := ReplayBuffered(db, client, cfg, zerolog.Nop()); replayed != 2 || err != nil {
+		t.Fatalf("ReplayBuffered() = %d, %v; want 2", replayed, err)
+	}
+	for i, want := range []string{"r1", "r2"} {
+		payload, _ := ParseTaskPayload(client.enqueued[i])
+		if payload.RestoreID != want {
+			t.Errorf("replayed task %d = restore %s, want %s (buffered order)", i, payload.RestoreID, want)
+		}
+	}
+	if count, _ := BufferedCount(db); count != 0 {
+		t.Errorf("buffered tasks after replay = %d, want 0", count)
+	}
+}
+
+func TestEnqueueOrBufferReturnsOtherErrors(t *testing.T) {
+	db := newTestDB(t)
+	client := &fakeEnqueuer{err: asynq.ErrDuplicateTask}
+
+	task, _ := NewTriggerRestoreTask("r1")
+	if _, buffered, err := EnqueueOrBuffer(db, client, task, &config.Config{}); buffered || !errors.Is(err, asynq.ErrDuplicateTask) {
+		t.Errorf("EnqueueOrBuffer() = buffered %v, %v; want ErrDuplicateTask", buffered, err)
+	}
+
+	// Only restore triggers are buffered
+	branchTask := asynq.NewTask(TypeCreateBranch, nil)
+	if _, _, err := EnqueueOrBuffer(db, client, branchTask, &config.Config{}); err == nil {
+		t.Error("EnqueueOrBuffer() of a branch task succeeded")
+	}
+}
+
+func TestReplayBufferedDropsRejectedTasks(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Create(&models.BufferedTask{Type: TypeTriggerRestore, Payload: []byte(`{"restore_id":"r1"}`), Attempts: MaxReplayAttempts - 1}).Error; err != nil {
+		t.Fatalf("failed to create buffered task: %v", err)
+	}
+
+	client := &fakeEnqueuer{err: errors.New("task rejected")}
+	if replayed, err := ReplayBuffered(db, client, &config.Config{}, zerolog.Nop()); replayed != 0 || err != nil {
+		t.Errorf("ReplayBuffered() = %d, %v; want 0, nil", replayed, err)
+	}
+	if count, _ := BufferedCount(db); count != 0 {
+		t.Errorf("buffered tasks = %d, want the rejected task dropped", count)
+	}
+}
+
+func TestQueueClientReportsOutage(t *testing.T) {
+	// Nothing listens on port 1
+	redisClient := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { redisClient.Close() })
+	client := NewQueueClient(asynq.NewClient(asynq.RedisClientOpt{Addr: "127.0.0.1:1"}), redisClient)
+	t.Cleanup(func() { client.Close() })
+
+	if status := client.Status(); !status.Available {
+		t.Fatalf("Status() before any enqueue = %+v, want available", status)
+	}
+
+	task, _ := NewTriggerRestoreTask("r1")
+	if _, err := client.Enqueue(task); !errors.Is(err, ErrQueueUnavailable) {
+		t.Fatalf("Enqueue() without Redis error = %v, want ErrQueueUnavailable", err)
+	}
+	status := client.Status()
+	if status.Available || status.UnavailableSince == nil || status.Error == "" {
+		t.Errorf("Status() after failed enqueue = %+v, want unavailable", status)
+	}
+}
@@ -0,0 +1,31 @@
+package tasks
+
+import (
+	"context"
+
+	"github.com/hibiken/asynq"
+)
+
+// Enqueuer enqueues tasks: an *asynq.Client, or the LocalRunner when running without Redis
+type Enqueuer interface {
+	Enqueue(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error)
+	Close() error
+}
+
+// Inspector looks up enqueued tasks: an *asynq.Inspector, or the LocalRunner when running without Redis
+type Inspector interface {
+	GetTaskInfo(queue, id string) (*asynq.TaskInfo, error)
+}
+
+// localResultKey is the context key of the result writer of a task processed by the LocalRunner
+type localResultKey struct{}
+
+// WriteResult stores the result of the task being processed, clients read it from the task's TaskInfo
+func WriteResult(ctx context.Context, t *asynq.Task, data []byte) error {
+	if write, ok := ctx.Value(localResultKey{}).(func([]byte)); ok {
+		write(data)
+		return nil
+	}
+	_, err := t.ResultWriter().Write(data)
+	return err
+}
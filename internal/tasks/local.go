@@ -0,0 +1,372 @@
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// localDefaultMaxRetry is how often a task enqueued without asynq.MaxRetry is retried (asynq's default)
+const localDefaultMaxRetry = 25
+
+// localPollInterval is how often the LocalRunner checks for scheduled tasks and retries that became due
+const localPollInterval = time.Second
+
+// localShutdownTimeout is how long Shutdown waits for running tasks before cancelling them
+const localShutdownTimeout = 30 * time.Second
+
+// ErrRunnerClosed is returned when enqueueing on a LocalRunner that has been closed
+var ErrRunnerClosed = errors.New("task runner is closed")
+
+// LocalRunner processes tasks in-process, replacing Redis and the asynq server on single-box installs
+// (config.RedisConfig.Address empty). Tasks are enqueued and inspected like with asynq, with the same queue
+// weights, timeouts, delays, retries and retention, but they only live in memory: tasks pending at shutdown are lost
+type LocalRunner struct {
+	cfg    *config.Config
+	logger zerolog.Logger
+
+	mu     sync.Mutex
+	tasks  map[string]*localTask // By ID, finished tasks until their retention expires
+	seq    uint64                // Enqueue counter, due tasks of a queue run in enqueue order
+	active int                   // Tasks being processed, at most cfg.Worker.Concurrency
+	closed bool
+	wake   chan struct{} // Signals the dispatcher that a task was enqueued or finished
+
+	stop        context.CancelFunc // Stops the dispatcher
+	stopped     chan struct{}      // Closed once the dispatcher returned
+	cancelTasks context.CancelFunc // Cancels the contexts of running tasks
+	running     sync.WaitGroup
+}
+
+// localTask is a task held by the LocalRunner
+type localTask struct {
+	info asynq.TaskInfo
+	seq  uint64
+}
+
+// NewLocalRunner creates an in-process task runner, tasks are processed once Start is called
+func NewLocalRunner(cfg *config.Config, logger zerolog.Logger) *LocalRunner {
+	return &LocalRunner{
+		cfg:    cfg,
+		logger: logger,
+		tasks:  map[string]*localTask{},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Enqueue adds a task, honoring the asynq queue, timeout, deadline, retry, delay, task ID and retention options
+func (r *LocalRunner) Enqueue(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	now := time.Now()
+	info := asynq.TaskInfo{
+		Queue:         config.QueueDefault,
+		Type:          task.Type(),
+		Payload:       task.Payload(),
+		State:         asynq.TaskStatePending,
+		MaxRetry:      localDefaultMaxRetry,
+		NextProcessAt: now,
+	}
+	for _, opt := range opts {
+		switch opt.Type() {
+		case asynq.QueueOpt:
+			info.Queue = opt.Value().(string)
+		case asynq.TimeoutOpt:
+			info.Timeout = opt.Value().(time.Duration)
+		case asynq.DeadlineOpt:
+			info.Deadline = opt.Value().(time.Time)
+		case asynq.MaxRetryOpt:
+			info.MaxRetry = max(opt.Value().(int), 0)
+		case asynq.TaskIDOpt:
+			info.ID = opt.Value().(string)
+		case asynq.ProcessAtOpt:
+			info.NextProcessAt = opt.Value().(time.Time)
+		case asynq.ProcessInOpt:
+			info.NextProcessAt = now.Add(opt.Value().(time.Duration))
+		case asynq.RetentionOpt:
+			info.Retention = opt.Value().(time.Duration)
+		}
+	}
+	if info.Timeout == 0 && info.Deadline.IsZero() {
+		info.Timeout = DefaultTimeout
+	}
+	if info.NextProcessAt.After(now) {
+		info.State = asynq.TaskStateScheduled
+	}
+	if info.ID == "" {
+		idBytes := make([]byte, 16)
+		if _, err := rand.Read(idBytes); err != nil {
+			return nil, fmt.Errorf("failed to generate task ID: %w", err)
+		}
+		info.ID = hex.EncodeToString(idBytes)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, ErrRunnerClosed
+	}
+	r.prune(now)
+	if _, ok := r.tasks[info.ID]; ok {
+		return nil, asynq.ErrTaskIDConflict
+	}
+	r.seq++
+	r.tasks[info.ID] = &localTask{info: info, seq: r.seq}
+	r.notify()
+
+	return &info, nil
+}
+
+// GetTaskInfo returns a task until its retention expires, asynq.ErrTaskNotFound afterwards
+func (r *LocalRunner) GetTaskInfo(queue, id string) (*asynq.TaskInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune(time.Now())
+
+	task, ok := r.tasks[id]
+	if !ok || task.info.Queue != queue {
+		return nil, asynq.ErrTaskNotFound
+	}
+	info := task.info
+	return &info, nil
+}
+
+// Close rejects tasks enqueued afterwards, Shutdown stops processing
+func (r *LocalRunner) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+// Start processes tasks with handler until Shutdown (non-blocking)
+func (r *LocalRunner) Start(handler asynq.Handler) {
+	ctx, stop := context.WithCancel(context.Background())
+	taskCtx, cancelTasks := context.WithCancel(context.Background())
+	r.stop, r.cancelTasks = stop, cancelTasks
+	r.stopped = make(chan struct{})
+
+	go r.dispatch(ctx, taskCtx, handler)
+}
+
+// Shutdown stops starting tasks and rejects new ones, then waits for running tasks
+// Tasks still running after localShutdownTimeout are cancelled
+func (r *LocalRunner) Shutdown() {
+	_ = r.Close()
+	if r.stop == nil {
+		return
+	}
+	r.stop()
+	<-r.stopped
+
+	finished := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(localShutdownTimeout):
+		r.logger.Warn().Msg("Cancelling tasks still running at shutdown")
+		r.cancelTasks()
+		<-finished
+	}
+	r.cancelTasks()
+}
+
+// dispatch starts due tasks while workers are free, until ctx is done
+func (r *LocalRunner) dispatch(ctx, taskCtx context.Context, handler asynq.Handler) {
+	defer close(r.stopped)
+
+	ticker := time.NewTicker(localPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for task := r.next(time.Now()); task != nil; task = r.next(time.Now()) {
+			r.running.Add(1)
+			go func() {
+				defer r.running.Done()
+				r.process(taskCtx, handler, task)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// next marks the next due task active and returns it, nil if none is due or all workers are busy
+// Like asynq, the queue is picked at random by weight, or the heaviest queue with a due task with StrictPriority
+func (r *LocalRunner) next(now time.Time) *localTask {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active >= max(r.cfg.Worker.Concurrency, 1) {
+		return nil
+	}
+
+	// The first due task of every queue
+	due := map[string]*localTask{}
+	for _, task := range r.tasks {
+		switch task.info.State {
+		case asynq.TaskStatePending, asynq.TaskStateScheduled, asynq.TaskStateRetry:
+		default:
+			continue
+		}
+		if task.info.NextProcessAt.After(now) {
+			continue
+		}
+		if first, ok := due[task.info.Queue]; !ok || task.seq < first.seq {
+			due[task.info.Queue] = task
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	task := due[r.pickQueue(due)]
+	task.info.State = asynq.TaskStateActive
+	r.active++
+	return task
+}
+
+// pickQueue picks one of the queues with a due task
+func (r *LocalRunner) pickQueue(due map[string]*localTask) string {
+	weights := r.cfg.Worker.Queues()
+	queues := make([]string, 0, len(due))
+	total := 0
+	for queue := range due {
+		queues = append(queues, queue)
+		total += max(weights[queue], 1)
+	}
+	// Heaviest first, so StrictPriority takes the first one
+	sort.Slice(queues, func(i, j int) bool {
+		if weights[queues[i]] != weights[queues[j]] {
+			return weights[queues[i]] > weights[queues[j]]
+		}
+		return queues[i] < queues[j]
+	})
+	if r.cfg.Worker.StrictPriority {
+		return queues[0]
+	}
+
+	n := mathrand.IntN(total)
+	for _, queue := range queues {
+		n -= max(weights[queue], 1)
+		if n < 0 {
+			return queue
+		}
+	}
+	return queues[len(queues)-1]
+}
+
+// process runs an active task within its timeout and records the outcome
+func (r *LocalRunner) process(ctx context.Context, handler asynq.Handler, task *localTask) {
+	r.mu.Lock()
+	info := task.info
+	r.mu.Unlock()
+
+	if info.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, info.Timeout)
+		defer cancel()
+	}
+	if !info.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, info.Deadline)
+		defer cancel()
+	}
+	ctx = context.WithValue(ctx, localResultKey{}, func(data []byte) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		task.info.Result = data
+	})
+
+	err := runHandler(ctx, handler, asynq.NewTask(info.Type, info.Payload))
+	r.finish(task, err, time.Now())
+}
+
+// runHandler runs handler, a panic fails the task like with asynq
+func runHandler(ctx context.Context, handler asynq.Handler, t *asynq.Task) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return handler.ProcessTask(ctx, t)
+}
+
+// finish records the outcome of a processed task: completed, retried later or archived without retries left
+func (r *LocalRunner) finish(task *localTask, err error, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.notify()
+	r.active--
+
+	if err == nil {
+		task.info.State = asynq.TaskStateCompleted
+		task.info.CompletedAt = now
+		return
+	}
+
+	task.info.LastErr = err.Error()
+	task.info.LastFailedAt = now
+	if errors.Is(err, asynq.SkipRetry) || task.info.Retried >= task.info.MaxRetry {
+		task.info.State = asynq.TaskStateArchived
+		r.logger.Error().Err(err).
+			Str("task_id", task.info.ID).
+			Str("task_type", task.info.Type).
+			Int("retried", task.info.Retried).
+			Msg("Task failed without retries left")
+		return
+	}
+
+	delay := asynq.DefaultRetryDelayFunc(task.info.Retried, err, asynq.NewTask(task.info.Type, task.info.Payload))
+	task.info.Retried++
+	task.info.State = asynq.TaskStateRetry
+	task.info.NextProcessAt = now.Add(delay)
+	r.logger.Warn().Err(err).
+		Str("task_id", task.info.ID).
+		Str("task_type", task.info.Type).
+		Int("retried", task.info.Retried).
+		Dur("retry_in", delay).
+		Msg("Task failed, retrying")
+}
+
+// prune removes completed tasks past their retention and archived tasks past Redis.ArchivedTaskRetention
+// Callers hold r.mu
+func (r *LocalRunner) prune(now time.Time) {
+	for id, task := range r.tasks {
+		switch task.info.State {
+		case asynq.TaskStateCompleted:
+			if now.Sub(task.info.CompletedAt) >= task.info.Retention {
+				delete(r.tasks, id)
+			}
+		case asynq.TaskStateArchived:
+			if now.Sub(task.info.LastFailedAt) > r.cfg.Redis.ArchivedTaskRetention {
+				delete(r.tasks, id)
+			}
+		}
+	}
+}
+
+// notify wakes the dispatcher without blocking
+func (r *LocalRunner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
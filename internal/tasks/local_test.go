@@ -0,0 +1,180 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+func newTestRunner(t *testing.T, handler asynq.HandlerFunc) *LocalRunner {
+	t.Helper()
+	runner := NewLocalRunner(&config.Config{
+		Worker: config.WorkerConfig{Concurrency: 2, CriticalWeight: 6, DefaultWeight: 3, LowWeight: 1},
+		Redis:  config.RedisConfig{ArchivedTaskRetention: time.Hour},
+	}, zerolog.Nop())
+	runner.Start(handler)
+	t.Cleanup(runner.Shutdown)
+	return runner
+}
+
+// waitForState polls a task until it reaches state
+func waitForState(t *testing.T, runner *LocalRunner, queue, id string, state asynq.TaskState) *asynq.TaskInfo {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := runner.GetTaskInfo(queue, id)
+		if err == nil && info.State == state {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("task %s didn't reach state %s: %+v, %v", id, state, info, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLocalRunnerProcessesTasks(t *testing.T) {
+	runner := newTestRunner(t, func(ctx context.Context, task *asynq.Task) error {
+		return WriteResult(ctx, task, append([]byte("done: "), task.Payload()...))
+	})
+
+	info, err := runner.Enqueue(asynq.NewTask(TypeApplyFixture, []byte("fixture")), asynq.Queue(config.QueueCritical), asynq.Retention(time.Hour))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	completed := waitForState(t, runner, config.QueueCritical, info.ID, asynq.TaskStateCompleted)
+	if string(completed.Result) != "done: fixture" || completed.CompletedAt.IsZero() {
+		t.Errorf("completed task = result %q, completed at %v", completed.Result, completed.CompletedAt)
+	}
+
+	// Tasks are looked up in their queue, like with asynq
+	if _, err := runner.GetTaskInfo(config.QueueDefault, info.ID); !errors.Is(err, asynq.ErrTaskNotFound) {
+		t.Errorf("GetTaskInfo() in another queue error = %v, want ErrTaskNotFound", err)
+	}
+}
+
+func TestLocalRunnerDropsCompletedTasksWithoutRetention(t *testing.T) {
+	done := make(chan struct{})
+	runner := newTestRunner(t, func(ctx context.Context, task *asynq.Task) error {
+		close(done)
+		return nil
+	})
+
+	info, err := runner.Enqueue(asynq.NewTask(TypeRestoreWaitComplete, nil))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	<-done
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := runner.GetTaskInfo(config.QueueDefault, info.ID); errors.Is(err, asynq.ErrTaskNotFound) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("completed task without retention is still inspectable")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLocalRunnerArchivesFailedTasks(t *testing.T) {
+	runner := newTestRunner(t, func(ctx context.Context, task *asynq.Task) error {
+		if string(task.Payload()) == "skip" {
+			return fmt.Errorf("restore failed: %w", asynq.SkipRetry)
+		}
+		panic("boom")
+	})
+
+	skipped, err := runner.Enqueue(asynq.NewTask(TypeTriggerRestore, []byte("skip")))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	info := waitForState(t, runner, config.QueueDefault, skipped.ID, asynq.TaskStateArchived)
+	if info.Retried != 0 || info.LastErr != "restore failed: skip retry for the task" {
+		t.Errorf("task failed with SkipRetry = retried %d, last error %q", info.Retried, info.LastErr)
+	}
+
+	panicked, err := runner.Enqueue(asynq.NewTask(TypeTriggerRestore, nil), asynq.MaxRetry(0))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	info = waitForState(t, runner, config.QueueDefault, panicked.ID, asynq.TaskStateArchived)
+	if info.LastErr != "panic: boom" || StatusOf(info) != StatusFailed {
+		t.Errorf("panicking task = last error %q, status %s", info.LastErr, StatusOf(info))
+	}
+}
+
+func TestLocalRunnerRetriesFailedTasks(t *testing.T) {
+	runner := newTestRunner(t, func(ctx context.Context, task *asynq.Task) error {
+		return errors.New("source unreachable")
+	})
+
+	enqueued, err := runner.Enqueue(asynq.NewTask(TypeTriggerRestore, nil), asynq.MaxRetry(3))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	info := waitForState(t, runner, config.QueueDefault, enqueued.ID, asynq.TaskStateRetry)
+	if info.Retried != 1 || info.LastErr != "source unreachable" || !info.NextProcessAt.After(time.Now()) {
+		t.Errorf("retried task = retried %d, last error %q, next process at %v", info.Retried, info.LastErr, info.NextProcessAt)
+	}
+}
+
+func TestLocalRunnerEnqueue(t *testing.T) {
+	runner := NewLocalRunner(&config.Config{}, zerolog.Nop())
+
+	info, err := runner.Enqueue(asynq.NewTask(TypeDecommission, nil), asynq.TaskID("decommission-1"), asynq.ProcessIn(time.Hour), asynq.Queue(config.QueueCritical))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if info.ID != "decommission-1" || info.State != asynq.TaskStateScheduled || info.Timeout != DefaultTimeout || info.MaxRetry != localDefaultMaxRetry {
+		t.Errorf("Enqueue() = %+v", info)
+	}
+
+	if _, err := runner.Enqueue(asynq.NewTask(TypeDecommission, nil), asynq.TaskID("decommission-1"), asynq.Queue(config.QueueCritical)); !errors.Is(err, asynq.ErrTaskIDConflict) {
+		t.Errorf("Enqueue() with a taken task ID error = %v, want ErrTaskIDConflict", err)
+	}
+
+	if err := runner.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := runner.Enqueue(asynq.NewTask(TypeDecommission, nil)); !errors.Is(err, ErrRunnerClosed) {
+		t.Errorf("Enqueue() after Close error = %v, want ErrRunnerClosed", err)
+	}
+}
+
+func TestLocalRunnerNextPicksQueues(t *testing.T) {
+	runner := NewLocalRunner(&config.Config{
+		Worker: config.WorkerConfig{Concurrency: 1, CriticalWeight: 6, DefaultWeight: 3, LowWeight: 1, StrictPriority: true},
+	}, zerolog.Nop())
+
+	for _, queue := range []string{config.QueueLow, config.QueueDefault, config.QueueCritical} {
+		if _, err := runner.Enqueue(asynq.NewTask(queue, nil), asynq.Queue(queue)); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	if _, err := runner.Enqueue(asynq.NewTask("later", nil), asynq.Queue(config.QueueCritical), asynq.ProcessIn(time.Hour)); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	task := runner.next(time.Now())
+	if task == nil || task.info.Queue != config.QueueCritical || task.info.Type != config.QueueCritical {
+		t.Fatalf("next() with strict priority = %+v, want the due critical task", task)
+	}
+	if task := runner.next(time.Now()); task != nil {
+		t.Errorf("next() with all workers busy = %+v, want nil", task.info)
+	}
+
+	runner.finish(task, nil, time.Now())
+	if task := runner.next(time.Now()); task == nil || task.info.Queue != config.QueueDefault {
+		t.Errorf("next() after the critical task = %+v, want the default task", task)
+	}
+}
@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+)
+
+// queuePingTimeout bounds the Redis ping that tells an outage from a rejected task
+const queuePingTimeout = 2 * time.Second
+
+// ErrQueueUnavailable is returned when enqueueing while Redis can't be reached, e.g. while it restarts
+var ErrQueueUnavailable = errors.New("task queue unavailable")
+
+// QueueStatus is whether Redis accepts tasks, reported by /health/ready and the system info
+type QueueStatus struct {
+	Available        bool       `json:"available"`
+	UnavailableSince *time.Time `json:"unavailable_since,omitempty"` // First failed enqueue or ping of the current outage
+	Error            string     `json:"error,omitempty"`             // Why Redis couldn't be reached
+	BufferedTasks    int64      `json:"buffered_tasks"`              // Tasks waiting to be replayed once Redis is back (see EnqueueOrBuffer)
+}
+
+// QueueClient enqueues tasks on Redis and keeps track of Redis outages
+// Enqueue errors caused by an outage are returned as ErrQueueUnavailable, so callers can tell them from rejected tasks
+type QueueClient struct {
+	client *asynq.Client
+	redis  *redis.Client
+
+	mu               sync.Mutex
+	unavailableSince *time.Time
+	lastError        string
+}
+
+// NewQueueClient creates a queue client, redisClient is only used to ping Redis and isn't closed by Close
+func NewQueueClient(client *asynq.Client, redisClient *redis.Client) *QueueClient {
+	return &QueueClient{client: client, redis: redisClient}
+}
+
+// Enqueue enqueues a task, returning an error wrapping ErrQueueUnavailable when Redis can't be reached
+func (q *QueueClient) Enqueue(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	info, err := q.client.Enqueue(task, opts...)
+	if err == nil {
+		q.setAvailable(nil)
+		return info, nil
+	}
+	// Redis answered, the task itself was rejected
+	if errors.Is(err, asynq.ErrDuplicateTask) || errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queuePingTimeout)
+	defer cancel()
+	if pingErr := q.Ping(ctx); pingErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrQueueUnavailable, err)
+	}
+	return nil, err
+}
+
+// Ping checks whether Redis can be reached and records the outcome for Status
+func (q *QueueClient) Ping(ctx context.Context) error {
+	err := q.redis.Ping(ctx).Err()
+	q.setAvailable(err)
+	return err
+}
+
+// Status returns whether Redis could be reached at the last enqueue or ping
+// BufferedTasks is left to the caller, the buffer lives in the database
+func (q *QueueClient) Status() QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStatus{
+		Available:        q.unavailableSince == nil,
+		UnavailableSince: q.unavailableSince,
+		Error:            q.lastError,
+	}
+}
+
+// Close closes the asynq client
+func (q *QueueClient) Close() error {
+	return q.client.Close()
+}
+
+// setAvailable records whether Redis could be reached, err is nil when it could
+func (q *QueueClient) setAvailable(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err == nil {
+		q.unavailableSince = nil
+		q.lastError = ""
+		return
+	}
+	if q.unavailableSince == nil {
+		now := time.Now()
+		q.unavailableSince = &now
+	}
+	q.lastError = err.Error()
+}
@@ -0,0 +1,62 @@
+package tasks
+
+import (
+	"time"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// defaultQueues maps task types to the queue they run on unless config.WorkerConfig.TaskQueues overrides it
+// A developer waiting on a branch mustn't queue behind background work: branch operations are critical, restore
+// completions and refreshes running for hours are low
+var defaultQueues = map[string]string{
+	TypeCreateBranch: config.QueueCritical,
+	TypeDeleteBranch: config.QueueCritical,
+	TypeApplyFixture: config.QueueCritical,
+	TypeDecommission: config.QueueCritical,
+
+	TypeTriggerRestore: config.QueueDefault,
+	TypeAdoptCluster:   config.QueueDefault,
+	TypeCloneRestore:   config.QueueDefault,
+	TypePromoteBranch:  config.QueueDefault,
+	TypeExportBranch:   config.QueueDefault,
+
+	TypeRestoreWaitComplete: config.QueueLow,
+	TypeRestoreUnboost:      config.QueueLow,
+	TypeIncrementalRefresh:  config.QueueLow,
+}
+
+// QueueOf returns the queue tasks of a type are enqueued on
+func QueueOf(taskType string, cfg config.WorkerConfig) string {
+	if queue, ok := cfg.TaskQueues[taskType]; ok {
+		return queue
+	}
+	if queue, ok := defaultQueues[taskType]; ok {
+		return queue
+	}
+	return config.QueueDefault
+}
+
+// Queue returns the asynq.Queue option for a task type
+func Queue(taskType string, cfg config.WorkerConfig) asynq.Option {
+	return asynq.Queue(QueueOf(taskType, cfg))
+}
+
+// Timeout returns the asynq.Timeout option for a task type: its queue's configured timeout, else timeout
+func Timeout(taskType string, timeout time.Duration, cfg config.WorkerConfig) asynq.Option {
+	if queueTimeout, ok := cfg.QueueTimeouts[QueueOf(taskType, cfg)]; ok {
+		return asynq.Timeout(queueTimeout)
+	}
+	return asynq.Timeout(timeout)
+}
+
+// QueueMapping returns the queue of every task type, overrides applied
+func QueueMapping(cfg config.WorkerConfig) map[string]string {
+	mapping := make(map[string]string, len(defaultQueues))
+	for taskType := range defaultQueues {
+		mapping[taskType] = QueueOf(taskType, cfg)
+	}
+	return mapping
+}
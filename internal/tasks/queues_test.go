@@ -0,0 +1,48 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+func TestQueueOf(t *testing.T) {
+	cfg := config.WorkerConfig{TaskQueues: map[string]string{TypeExportBranch: config.QueueLow}}
+
+	tests := []struct {
+		taskType string
+		want     string
+	}{
+		{TypeCreateBranch, config.QueueCritical},
+		{TypeDeleteBranch, config.QueueCritical},
+		{TypeTriggerRestore, config.QueueDefault},
+		{TypeRestoreWaitComplete, config.QueueLow},
+		{TypeIncrementalRefresh, config.QueueLow},
+		{TypeExportBranch, config.QueueLow}, // Overridden
+		{"unknown:type", config.QueueDefault},
+	}
+	for _, tt := range tests {
+		if got := QueueOf(tt.taskType, cfg); got != tt.want {
+			t.Errorf("QueueOf(%s) = %s, want %s", tt.taskType, got, tt.want)
+		}
+	}
+
+	// Every registered task type is in the mapping, overrides applied
+	mapping := QueueMapping(cfg)
+	if mapping[TypeExportBranch] != config.QueueLow || mapping[TypeApplyFixture] != config.QueueCritical || len(mapping) != len(defaultQueues) {
+		t.Errorf("QueueMapping() = %v", mapping)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	cfg := config.WorkerConfig{QueueTimeouts: map[string]time.Duration{config.QueueDefault: 12 * time.Hour}}
+
+	// Tasks on a queue with a configured timeout get it, others keep their own
+	if got := Timeout(TypeExportBranch, ExportBranchTimeout, cfg).Value(); got != 12*time.Hour {
+		t.Errorf("Timeout(%s) = %v, want the default queue's 12h", TypeExportBranch, got)
+	}
+	if got := Timeout(TypeCreateBranch, BranchTaskTimeout, cfg).Value(); got != BranchTaskTimeout {
+		t.Errorf("Timeout(%s) = %v, want its own %v", TypeCreateBranch, got, BranchTaskTimeout)
+	}
+}
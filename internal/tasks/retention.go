@@ -0,0 +1,184 @@
+package tasks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// Retention returns the asynq.Retention option for a task type
+func Retention(taskType string, cfg config.RedisConfig) asynq.Option {
+	return asynq.Retention(cfg.CompletedTaskRetention)
+}
+
+// trimPageSize is the number of tasks listed per inspector call while trimming
+const trimPageSize = 500
+
+// historyInspector is the part of *asynq.Inspector TrimHistory uses
+type historyInspector interface {
+	Queues() ([]string, error)
+	ListCompletedTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	ListArchivedTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error)
+	DeleteTask(queue, id string) error
+}
+
+// TrimResult counts the tasks removed by TrimHistory
+type TrimResult struct {
+	Completed int
+	Archived  int
+}
+
+// TrimHistory deletes completed and archived tasks older than the configured retention
+// Completed tasks normally expire on their own; trimming catches tasks enqueued with a longer
+// retention before the setting was lowered
+func TrimHistory(inspector historyInspector, cfg config.RedisConfig, now time.Time) (TrimResult, error) {
+	var result TrimResult
+
+	queues, err := inspector.Queues()
+	if err != nil {
+		return result, fmt.Errorf("failed to list queues: %w", err)
+	}
+
+	for _, queue := range queues {
+		completed, err := trimTasks(inspector, queue, inspector.ListCompletedTasks, func(task *asynq.TaskInfo) bool {
+			return now.Sub(task.CompletedAt) > cfg.CompletedTaskRetention
+		})
+		result.Completed += completed
+		if err != nil {
+			return result, fmt.Errorf("failed to trim completed tasks in queue %s: %w", queue, err)
+		}
+
+		archived, err := trimTasks(inspector, queue, inspector.ListArchivedTasks, func(task *asynq.TaskInfo) bool {
+			return now.Sub(task.LastFailedAt) > cfg.ArchivedTaskRetention
+		})
+		result.Archived += archived
+		if err != nil {
+			return result, fmt.Errorf("failed to trim archived tasks in queue %s: %w", queue, err)
+		}
+	}
+
+	return result, nil
+}
+
+// trimTasks deletes the tasks of one state for which expired returns true
+// IDs are collected before deleting so removals don't shift the pages being listed
+func trimTasks(
+	inspector historyInspector,
+	queue string,
+	list func(string, ...asynq.ListOption) ([]*asynq.TaskInfo, error),
+	expired func(*asynq.TaskInfo) bool,
+) (int, error) {
+	var ids []string
+	for page := 1; ; page++ {
+		taskInfos, err := list(queue, asynq.Page(page), asynq.PageSize(trimPageSize))
+		if err != nil {
+			return 0, err
+		}
+		for _, task := range taskInfos {
+			if expired(task) {
+				ids = append(ids, task.ID)
+			}
+		}
+		if len(taskInfos) < trimPageSize {
+			break
+		}
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if err := inspector.DeleteTask(queue, id); err != nil && err != asynq.ErrTaskNotFound {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// RedisMetrics reports Redis memory use and task counts
+type RedisMetrics struct {
+	UsedMemoryBytes    int64          `json:"used_memory_bytes"`
+	PeakMemoryBytes    int64          `json:"peak_memory_bytes"`
+	MaxMemoryBytes     int64          `json:"max_memory_bytes"` // 0 = no limit
+	TaskMemoryBytes    int64          `json:"task_memory_bytes"`
+	Queues             []QueueMetrics `json:"queues"`
+	CompletedRetention string         `json:"completed_retention"`
+	ArchivedRetention  string         `json:"archived_retention"`
+}
+
+// QueueMetrics reports the task counts and approximate memory of one queue
+type QueueMetrics struct {
+	Queue       string `json:"queue"`
+	MemoryBytes int64  `json:"memory_bytes"` // Sampled estimate by asynq
+	Pending     int    `json:"pending"`
+	Active      int    `json:"active"`
+	Scheduled   int    `json:"scheduled"`
+	Retry       int    `json:"retry"`
+	Archived    int    `json:"archived"`
+	Completed   int    `json:"completed"`
+}
+
+// CollectRedisMetrics reads Redis memory usage (INFO memory) and per-queue task counts
+func CollectRedisMetrics(ctx context.Context, inspector *asynq.Inspector, rdb *redis.Client, cfg config.RedisConfig) (*RedisMetrics, error) {
+	info, err := rdb.Info(ctx, "memory").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redis memory info: %w", err)
+	}
+
+	memory := parseRedisInfo(info)
+	metrics := &RedisMetrics{
+		UsedMemoryBytes:    memory["used_memory"],
+		PeakMemoryBytes:    memory["used_memory_peak"],
+		MaxMemoryBytes:     memory["maxmemory"],
+		Queues:             []QueueMetrics{},
+		CompletedRetention: cfg.CompletedTaskRetention.String(),
+		ArchivedRetention:  cfg.ArchivedTaskRetention.String(),
+	}
+
+	queues, err := inspector.Queues()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queues: %w", err)
+	}
+	for _, queue := range queues {
+		queueInfo, err := inspector.GetQueueInfo(queue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get queue info for %s: %w", queue, err)
+		}
+		metrics.TaskMemoryBytes += queueInfo.MemoryUsage
+		metrics.Queues = append(metrics.Queues, QueueMetrics{
+			Queue:       queue,
+			MemoryBytes: queueInfo.MemoryUsage,
+			Pending:     queueInfo.Pending,
+			Active:      queueInfo.Active,
+			Scheduled:   queueInfo.Scheduled,
+			Retry:       queueInfo.Retry,
+			Archived:    queueInfo.Archived,
+			Completed:   queueInfo.Completed,
+		})
+	}
+
+	return metrics, nil
+}
+
+// parseRedisInfo parses the integer fields of an INFO section ("key:value" lines)
+func parseRedisInfo(info string) map[string]int64 {
+	values := map[string]int64{}
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			values[key] = n
+		}
+	}
+	return values
+}
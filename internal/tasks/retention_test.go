@@ -0,0 +1,182 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// fakeInspector serves task history from memory, tasks by queue and ID
+type fakeInspector struct {
+	completed map[string][]*asynq.TaskInfo
+	archived  map[string][]*asynq.TaskInfo
+	deleted   []string // "<queue>/<id>"
+	missing   string   // ID reported as ErrTaskNotFound, e.g. expired meanwhile
+}
+
+func (f *fakeInspector) Queues() ([]string, error) {
+	seen := map[string]bool{}
+	for queue := range f.completed {
+		seen[queue] = true
+	}
+	for queue := range f.archived {
+		seen[queue] = true
+	}
+	var queues []string
+	for queue := range seen {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+	return queues, nil
+}
+
+func (f *fakeInspector) ListCompletedTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error) {
+	return page(f.completed[queue], opts), nil
+}
+
+func (f *fakeInspector) ListArchivedTasks(queue string, opts ...asynq.ListOption) ([]*asynq.TaskInfo, error) {
+	return page(f.archived[queue], opts), nil
+}
+
+func (f *fakeInspector) DeleteTask(queue, id string) error {
+	if id == f.missing {
+		return asynq.ErrTaskNotFound
+	}
+	f.deleted = append(f.deleted, queue+"/"+id)
+	return nil
+}
+
+// page applies the Page and PageSize options like the inspector (defaults page 1 of 30)
+// The option types are unexported, so they are told apart by the types of asynq.Page and asynq.PageSize
+func page(tasks []*asynq.TaskInfo, opts []asynq.ListOption) []*asynq.TaskInfo {
+	pageType, sizeType := reflect.TypeOf(asynq.Page(1)), reflect.TypeOf(asynq.PageSize(1))
+	number, size := 1, 30
+	for _, opt := range opts {
+		switch value := reflect.ValueOf(opt); value.Type() {
+		case pageType:
+			number = int(value.Int())
+		case sizeType:
+			size = int(value.Int())
+		}
+	}
+	start := (number - 1) * size
+	if start >= len(tasks) {
+		return nil
+	}
+	return tasks[start:min(start+size, len(tasks))]
+}
+
+func TestRetention(t *testing.T) {
+	cfg := config.RedisConfig{CompletedTaskRetention: 24 * time.Hour}
+
+	for _, taskType := range []string{TypeTriggerRestore, TypeRestoreWaitComplete} {
+		if got := Retention(taskType, cfg); got.Value() != 24*time.Hour {
+			t.Errorf("Retention(%s) = %v, want the completed task retention", taskType, got.Value())
+		}
+	}
+}
+
+func TestTrimHistory(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	cfg := config.RedisConfig{CompletedTaskRetention: 24 * time.Hour, ArchivedTaskRetention: 7 * 24 * time.Hour}
+
+	completed := func(id, taskType string, age time.Duration) *asynq.TaskInfo {
+		return &asynq.TaskInfo{ID: id, Type: taskType, CompletedAt: now.Add(-age)}
+	}
+	archived := func(id string, age time.Duration) *asynq.TaskInfo {
+		return &asynq.TaskInfo{ID: id, Type: TypeTriggerRestore, LastFailedAt: now.Add(-age)}
+	}
+
+	// More tasks than fit one page, so trimming has to list every page
+	var many []*asynq.TaskInfo
+	for i := 0; i < trimPageSize+10; i++ {
+		many = append(many, completed(fmt.Sprintf("old-%d", i), TypeTriggerRestore, 48*time.Hour))
+	}
+
+	inspector := &fakeInspector{
+		completed: map[string][]*asynq.TaskInfo{
+			"default": append(many,
+				completed("recent", TypeTriggerRestore, time.Hour),
+				completed("complete", TypeRestoreWaitComplete, time.Minute),
+			),
+			"critical": {
+				completed("gone", TypeTriggerRestore, 48*time.Hour),
+			},
+		},
+		archived: map[string][]*asynq.TaskInfo{
+			"default": {
+				archived("failed-old", 8*24*time.Hour),
+				archived("failed-recent", 6*24*time.Hour),
+			},
+		},
+		missing: "gone",
+	}
+
+	result, err := TrimHistory(inspector, cfg, now)
+	if err != nil {
+		t.Fatalf("TrimHistory() error = %v", err)
+	}
+
+	// Tasks expired meanwhile count as trimmed
+	if want := (TrimResult{Completed: trimPageSize + 10 + 1, Archived: 1}); result != want {
+		t.Errorf("TrimHistory() = %+v, want %+v", result, want)
+	}
+
+	deleted := map[string]bool{}
+	for _, key := range inspector.deleted {
+		deleted[key] = true
+	}
+	for _, key := range []string{"default/old-0", fmt.Sprintf("default/old-%d", trimPageSize+9), "default/failed-old"} {
+		if !deleted[key] {
+			t.Errorf("%s not trimmed", key)
+		}
+	}
+	for _, key := range []string{"default/recent", "default/complete", "default/failed-recent"} {
+		if deleted[key] {
+			t.Errorf("%s trimmed within its retention", key)
+		}
+	}
+}
+
+func TestTrimHistoryStopsOnDeleteError(t *testing.T) {
+	inspector := &failingInspector{fakeInspector: fakeInspector{
+		completed: map[string][]*asynq.TaskInfo{"default": {{ID: "old", Type: TypeTriggerRestore}}},
+	}}
+
+	_, err := TrimHistory(inspector, config.RedisConfig{CompletedTaskRetention: time.Hour}, time.Now())
+	if err == nil {
+		t.Fatal("TrimHistory() succeeded although deleting failed")
+	}
+}
+
+// failingInspector fails every delete, e.g. when Redis is unreachable
+type failingInspector struct {
+	fakeInspector
+}
+
+func (f *failingInspector) DeleteTask(queue, id string) error {
+	return errors.New("connection refused")
+}
+
+func TestParseRedisInfo(t *testing.T) {
+	info := "# Memory\r\nused_memory:1048576\r\nused_memory_human:1.00M\r\nused_memory_peak:2097152\r\nmaxmemory:0\r\n"
+
+	got := parseRedisInfo(info)
+
+	want := map[string]int64{"used_memory": 1048576, "used_memory_peak": 2097152, "maxmemory": 0}
+	if len(got) != len(want) {
+		t.Errorf("parseRedisInfo() = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %d, want %d", key, got[key], value)
+		}
+	}
+}
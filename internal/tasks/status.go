@@ -0,0 +1,25 @@
+package tasks
+
+import "github.com/hibiken/asynq"
+
+// Statuses of tasks that clients poll (e.g. GET /api/system/decommission/:id)
+const (
+	StatusPending   = "pending"   // Waiting for a worker
+	StatusRunning   = "running"   // A worker is processing it
+	StatusCompleted = "completed" // Finished, the result is available until the retention expires
+	StatusFailed    = "failed"    // Failed without retries left
+)
+
+// StatusOf maps an asynq task state to the status reported to clients
+func StatusOf(info *asynq.TaskInfo) string {
+	switch info.State {
+	case asynq.TaskStateActive:
+		return StatusRunning
+	case asynq.TaskStateCompleted:
+		return StatusCompleted
+	case asynq.TaskStateArchived:
+		return StatusFailed
+	default: // Pending, scheduled, retry and aggregating tasks still run later
+		return StatusPending
+	}
+}
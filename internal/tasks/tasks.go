@@ -3,16 +3,61 @@ package tasks
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/hibiken/asynq"
+
+	"github.com/branchd-dev/branchd/internal/models"
 )
 
 // Task type constants
 const (
 	TypeTriggerRestore      = "restore:trigger"
 	TypeRestoreWaitComplete = "restore:wait_complete"
+	TypeRestoreUnboost      = "restore:unboost"
+	TypeIncrementalRefresh  = "restore:incremental_refresh"
+	TypeAdoptCluster        = "restore:adopt"
+	TypeCloneRestore        = "restore:clone"
+	TypePromoteBranch       = "restore:promote"
+	TypeDecommission        = "system:decommission"
+	TypeCreateBranch        = "branch:create"
+	TypeDeleteBranch        = "branch:delete"
+	TypeApplyFixture        = "branch:apply_fixture"
+	TypeExportBranch        = "branch:export"
+	TypeCheckMigration      = "branch:check_migration"
 )
 
+// DefaultTimeout bounds tasks enqueued without a timeout of their own (asynq's default)
+const DefaultTimeout = 30 * time.Minute
+
+// TriggerRestoreTimeout bounds a trigger restore task, which only launches the restore script
+// How long the restore itself may run is set by Config.RestoreDeadlineHours
+const TriggerRestoreTimeout = 30 * time.Minute
+
+// AdoptClusterTimeout bounds copying an existing cluster into a restore (terabytes at disk speed)
+const AdoptClusterTimeout = 24 * time.Hour
+
+// CloneRestoreTimeout bounds cloning a restore (a ZFS clone and starting its cluster)
+const CloneRestoreTimeout = 30 * time.Minute
+
+// PromoteBranchTimeout bounds promoting a branch (stopping it, zfs promote and starting the restore's cluster)
+const PromoteBranchTimeout = 30 * time.Minute
+
+// DecommissionTimeout bounds tearing down all branches and restores
+const DecommissionTimeout = 2 * time.Hour
+
+// BranchTaskTimeout bounds creating or deleting a branch in the background
+const BranchTaskTimeout = 10 * time.Minute
+
+// ApplyFixtureTimeout bounds generating a fixture's rows in a branch
+const ApplyFixtureTimeout = time.Hour
+
+// CheckMigrationTimeout bounds running a migration in a copy of a branch, table rewrites take long on big tables
+const CheckMigrationTimeout = 2 * time.Hour
+
+// ExportBranchTimeout bounds dumping a branch with pg_dump and uploading the archive
+const ExportBranchTimeout = 6 * time.Hour
+
 // TaskPayload is the common payload for all tasks
 type TaskPayload struct {
 	RestoreID string `json:"database_id,omitempty"`
@@ -29,7 +74,7 @@ func NewTriggerRestoreTask(restoreID string) (*asynq.Task, error) {
 	return asynq.NewTask(TypeTriggerRestore, payload), nil
 }
 
-// NewTriggerRestoreWaitCompleteTask creates a task to wait for restore completion
+// NewTriggerRestoreWaitCompleteTask creates a task to finalize a restore whose process exited
 func NewTriggerRestoreWaitCompleteTask(restoreID string) (*asynq.Task, error) {
 	payload, err := json.Marshal(TaskPayload{
 		RestoreID: restoreID,
@@ -40,6 +85,146 @@ func NewTriggerRestoreWaitCompleteTask(restoreID string) (*asynq.Task, error) {
 	return asynq.NewTask(TypeRestoreWaitComplete, payload), nil
 }
 
+// NewRestoreUnboostTask creates a task to return a boosted restore to background priority
+func NewRestoreUnboostTask(restoreID string) (*asynq.Task, error) {
+	payload, err := json.Marshal(TaskPayload{
+		RestoreID: restoreID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypeRestoreUnboost, payload), nil
+}
+
+// NewIncrementalRefreshTask creates a task to apply the source's changes onto an existing restore
+func NewIncrementalRefreshTask(restoreID string) (*asynq.Task, error) {
+	payload, err := json.Marshal(TaskPayload{
+		RestoreID: restoreID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypeIncrementalRefresh, payload), nil
+}
+
+// NewAdoptClusterTask creates a task to copy an existing local cluster into a restore (see Restore.AdoptedFrom)
+func NewAdoptClusterTask(restoreID string) (*asynq.Task, error) {
+	payload, err := json.Marshal(TaskPayload{
+		RestoreID: restoreID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypeAdoptCluster, payload), nil
+}
+
+// NewCloneRestoreTask creates a task to create a clone recorded by restore.Orchestrator.CreateClone
+func NewCloneRestoreTask(restoreID string) (*asynq.Task, error) {
+	payload, err := json.Marshal(TaskPayload{
+		RestoreID: restoreID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypeCloneRestore, payload), nil
+}
+
+// NewPromoteBranchTask creates a task to promote the branch of a restore recorded by restore.Orchestrator.CreatePromotion
+func NewPromoteBranchTask(restoreID string) (*asynq.Task, error) {
+	payload, err := json.Marshal(TaskPayload{
+		RestoreID: restoreID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypePromoteBranch, payload), nil
+}
+
+// DecommissionPayload identifies the admin who confirmed a decommission, for its audit event
+type DecommissionPayload struct {
+	UserID    string `json:"user_id"`
+	UserEmail string `json:"user_email"`
+	ClientIP  string `json:"client_ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+// NewDecommissionTask creates a task to tear down the server (see decommission.Run)
+func NewDecommissionTask(payload DecommissionPayload) (*asynq.Task, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypeDecommission, data), nil
+}
+
+// ParseDecommissionPayload parses a decommission task payload
+func ParseDecommissionPayload(task *asynq.Task) (DecommissionPayload, error) {
+	var payload DecommissionPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return payload, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	return payload, nil
+}
+
+// BranchPayload identifies the branch of a branch task
+type BranchPayload struct {
+	BranchName  string `json:"branch_name"`
+	CreatedByID string `json:"created_by_id,omitempty"` // Owner of a created branch
+	PullRequest string `json:"pull_request,omitempty"`  // GitHub pull request of the branch, see models.Branch.PullRequest
+}
+
+// NewCreateBranchTask creates a task to create a branch (e.g. for a pull request)
+func NewCreateBranchTask(payload BranchPayload) (*asynq.Task, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypeCreateBranch, data), nil
+}
+
+// NewDeleteBranchTask creates a task to delete a branch, only the branch of payload.PullRequest if set
+func NewDeleteBranchTask(payload BranchPayload) (*asynq.Task, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypeDeleteBranch, data), nil
+}
+
+// ParseBranchPayload parses a branch task payload
+func ParseBranchPayload(task *asynq.Task) (BranchPayload, error) {
+	var payload BranchPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return payload, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	return payload, nil
+}
+
+// ApplyFixturePayload is the fixture an apply fixture task generates in a branch
+// The definition is copied, later edits of a stored fixture don't change a queued task
+type ApplyFixturePayload struct {
+	BranchID string         `json:"branch_id"`
+	Fixture  models.Fixture `json:"fixture"`
+}
+
+// NewApplyFixtureTask creates a task to apply a fixture to a branch
+func NewApplyFixtureTask(payload ApplyFixturePayload) (*asynq.Task, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypeApplyFixture, data), nil
+}
+
+// ParseApplyFixturePayload parses an apply fixture task payload
+func ParseApplyFixturePayload(task *asynq.Task) (ApplyFixturePayload, error) {
+	var payload ApplyFixturePayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return payload, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	return payload, nil
+}
+
 // ParseTaskPayload parses task payload from Asynq task
 func ParseTaskPayload(task *asynq.Task) (TaskPayload, error) {
 	var payload TaskPayload
@@ -48,3 +233,51 @@ func ParseTaskPayload(task *asynq.Task) (TaskPayload, error) {
 	}
 	return payload, nil
 }
+
+// ExportBranchPayload is the export an export branch task runs
+type ExportBranchPayload struct {
+	ExportID  string `json:"export_id"`
+	UploadURL string `json:"upload_url,omitempty"` // Pre-signed PUT URL, not stored with the export
+}
+
+// NewExportBranchTask creates a task to dump a branch to an archive
+func NewExportBranchTask(payload ExportBranchPayload) (*asynq.Task, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypeExportBranch, data), nil
+}
+
+// ParseExportBranchPayload parses an export branch task payload
+func ParseExportBranchPayload(task *asynq.Task) (ExportBranchPayload, error) {
+	var payload ExportBranchPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return payload, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	return payload, nil
+}
+
+// CheckMigrationPayload is the migration a check migration task runs in a copy of a branch
+type CheckMigrationPayload struct {
+	BranchID string                 `json:"branch_id"`
+	Files    []models.MigrationFile `json:"files"`
+}
+
+// NewCheckMigrationTask creates a task to check a migration against a branch
+func NewCheckMigrationTask(payload CheckMigrationPayload) (*asynq.Task, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return asynq.NewTask(TypeCheckMigration, data), nil
+}
+
+// ParseCheckMigrationPayload parses a check migration task payload
+func ParseCheckMigrationPayload(task *asynq.Task) (CheckMigrationPayload, error) {
+	var payload CheckMigrationPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return payload, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,69 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// HandleCreateBranch creates a branch from the latest ready restore
+// CreateBranch returns the existing branch if the name is taken, so retries are safe
+func HandleCreateBranch(ctx context.Context, t *asynq.Task, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+	payload, err := tasks.ParseBranchPayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	service := branches.NewService(db, cfg, logger)
+	if _, err := service.CreateBranch(ctx, branches.CreateBranchParams{
+		BranchName:  payload.BranchName,
+		CreatedByID: payload.CreatedByID,
+		PullRequest: payload.PullRequest,
+	}); err != nil {
+		logger.Error().Err(err).Str("branch_name", payload.BranchName).Msg("Failed to create branch")
+		return err
+	}
+
+	logger.Info().Str("branch_name", payload.BranchName).Msg("Branch created")
+	return nil
+}
+
+// HandleDeleteBranch deletes a branch, branches that don't exist (anymore) are skipped
+// With a pull request, the branch is only deleted if it was created for it (not by hand or for another repository's)
+func HandleDeleteBranch(ctx context.Context, t *asynq.Task, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+	payload, err := tasks.ParseBranchPayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	query := db.Where("name = ?", payload.BranchName)
+	if payload.PullRequest != "" {
+		query = query.Where("pull_request = ?", payload.PullRequest)
+	}
+	var branch models.Branch
+	if err := query.First(&branch).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Info().Str("branch_name", payload.BranchName).Str("pull_request", payload.PullRequest).Msg("Branch already deleted")
+			return nil
+		}
+		return fmt.Errorf("failed to find branch: %w", err)
+	}
+
+	service := branches.NewService(db, cfg, logger)
+	if err := service.DeleteBranch(ctx, branches.DeleteBranchParams{BranchName: payload.BranchName}); err != nil {
+		logger.Error().Err(err).Str("branch_name", payload.BranchName).Msg("Failed to delete branch")
+		return err
+	}
+
+	logger.Info().Str("branch_name", payload.BranchName).Msg("Branch deleted")
+	return nil
+}
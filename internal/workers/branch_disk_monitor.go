@@ -0,0 +1,34 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// branchDiskCheckInterval is how often branch space use is compared to the branches' ZFS quotas
+const branchDiskCheckInterval = 5 * time.Minute
+
+// StartBranchDiskMonitor periodically records the disk quota state of branches (Branch.DiskQuotaState)
+func StartBranchDiskMonitor(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	service := branches.NewService(db, cfg, logger)
+
+	ticker := time.NewTicker(branchDiskCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.CheckDiskQuotas(ctx); err != nil {
+				logger.Error().Err(err).Msg("Failed to check branch disk quotas")
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// branchExpiryCheckInterval bounds how long a branch outlives its template's TTL
+const branchExpiryCheckInterval = 5 * time.Minute
+
+// StartBranchExpiryJanitor deletes branches once the TTL of the template they were created from passes
+// and drops the roles of expired branch shares
+func StartBranchExpiryJanitor(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	service := branches.NewService(db, cfg, logger)
+
+	ticker := time.NewTicker(branchExpiryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.DeleteExpiredBranches(ctx); err != nil {
+				logger.Error().Err(err).Msg("Failed to delete expired branches")
+			}
+			if err := service.RevokeExpiredShares(ctx); err != nil {
+				logger.Error().Err(err).Msg("Failed to revoke expired branch shares")
+			}
+		}
+	}
+}
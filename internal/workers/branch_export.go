@@ -0,0 +1,49 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/exports"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// exportJanitorInterval bounds how long an archive outlives its expiry
+const exportJanitorInterval = time.Hour
+
+// HandleExportBranch dumps a branch to a custom-format archive, the result is recorded on the BranchExport
+// Not retried, a failed export is requested again
+func HandleExportBranch(ctx context.Context, t *asynq.Task, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+	payload, err := tasks.ParseExportBranchPayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+	return exports.Run(ctx, db, cfg.Storage, payload.ExportID, payload.UploadURL, logger)
+}
+
+// StartBranchExportJanitor deletes downloadable archives once they expire
+func StartBranchExportJanitor(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	ticker := time.NewTicker(exportJanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := exports.DeleteExpired(db, cfg.Storage, time.Now())
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to delete expired branch exports")
+			}
+			if deleted > 0 {
+				logger.Info().Int("count", deleted).Msg("Deleted expired branch exports")
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// branchHealthCheckInterval is how often every branch is probed with pg_isready
+const branchHealthCheckInterval = time.Minute
+
+// StartBranchHealthMonitor periodically records whether branches are running, stopped or crashed (Branch.Status)
+// and restarts crashed branches, after making sure branch units start on boot
+func StartBranchHealthMonitor(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	service := branches.NewService(db, cfg, logger)
+
+	// Branches come back after a host reboot once their units are ordered after the ZFS import and enabled
+	if err := service.EnsureBranchUnits(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to ensure branch units")
+	}
+
+	ticker := time.NewTicker(branchHealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.CheckBranchHealth(ctx); err != nil {
+				logger.Error().Err(err).Msg("Failed to check branch health")
+			}
+		}
+	}
+}
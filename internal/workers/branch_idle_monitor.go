@@ -0,0 +1,52 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// branchIdleCheckInterval is how often branch activity is sampled from pg_stat_activity and pg_stat_database
+const branchIdleCheckInterval = 5 * time.Minute
+
+// StartBranchIdleMonitor periodically records branch activity, for the branch usage report, and suspends idle
+// branches when auto-suspend is enabled
+// The API server resumes suspended branches on their next connection attempt
+// Stops when ctx is done, a running check finishes first so no branch is left half suspended
+func StartBranchIdleMonitor(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	service := branches.NewService(db, cfg, logger)
+
+	ticker := time.NewTicker(branchIdleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkIdleBranches(service, db, logger)
+		}
+	}
+}
+
+func checkIdleBranches(service *branches.Service, db *gorm.DB, logger zerolog.Logger) {
+	var config models.Config
+	if err := db.First(&config).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logger.Error().Err(err).Msg("Failed to query config for idle branch check")
+		}
+		return
+	}
+
+	// Activity is recorded either way, 0 hours only disables suspending
+	idleAfter := time.Duration(config.BranchIdleSuspendHours) * time.Hour
+	if err := service.SuspendIdleBranches(context.Background(), idleAfter); err != nil {
+		logger.Error().Err(err).Msg("Failed to suspend idle branches")
+	}
+}
@@ -0,0 +1,116 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+)
+
+// StartBranchScheduler runs due branch schedules and those waiting for a new restore (checked every minute)
+// Stops when ctx is done, running schedules finish first so their branches aren't left half created
+func StartBranchScheduler(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	service := branches.NewService(db, cfg, logger)
+
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runDueBranchSchedules(service, db, logger)
+			runNewRestoreBranchSchedules(service, db, logger)
+		}
+	}
+}
+
+func runDueBranchSchedules(service *branches.Service, db *gorm.DB, logger zerolog.Logger) {
+	now := time.Now()
+
+	var schedules []models.BranchSchedule
+	if err := db.Where("enabled = ? AND next_run_at <= ?", true, now).Find(&schedules).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to query due branch schedules")
+		return
+	}
+
+	for i := range schedules {
+		schedule := &schedules[i]
+		if !claimBranchSchedule(db, schedule, now, logger) {
+			continue
+		}
+		// Failures are recorded on the schedule (LastError), the next run tries again
+		service.RunBranchSchedule(context.Background(), schedule)
+	}
+}
+
+// claimBranchSchedule moves the schedule's next run forward before it runs
+// Returns false if another worker (e.g. an all-in-one server) claimed it first, or the schedule is invalid
+func claimBranchSchedule(db *gorm.DB, schedule *models.BranchSchedule, now time.Time, logger zerolog.Logger) bool {
+	next, err := branches.NextScheduleRun(schedule.Schedule, now)
+	if err != nil {
+		logger.Error().Err(err).Str("schedule_id", schedule.ID).Msg("Invalid branch schedule")
+		return false
+	}
+
+	result := db.Model(&models.BranchSchedule{}).
+		Where("id = ? AND next_run_at <= ?", schedule.ID, now).
+		Update("next_run_at", next)
+	if result.Error != nil {
+		logger.Error().Err(result.Error).Str("schedule_id", schedule.ID).Msg("Failed to update next_run_at")
+		return false
+	}
+	schedule.NextRunAt = &next
+	return result.RowsAffected == 1
+}
+
+// runNewRestoreBranchSchedules recreates the branches of on_new_restore schedules once a newer restore is ready
+func runNewRestoreBranchSchedules(service *branches.Service, db *gorm.DB, logger zerolog.Logger) {
+	var schedules []models.BranchSchedule
+	if err := db.Where("enabled = ? AND on_new_restore = ? AND restore_id = ''", true, true).Find(&schedules).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to query new restore branch schedules")
+		return
+	}
+	if len(schedules) == 0 {
+		return
+	}
+
+	latest, err := service.LatestReadyRestore()
+	if err != nil {
+		return // No ready restore yet
+	}
+
+	for i := range schedules {
+		schedule := &schedules[i]
+		if schedule.LastRestoreID == latest.ID {
+			continue
+		}
+
+		// Claimed like cron runs: a failed run is retried on the next restore, cron run or manual run
+		result := db.Model(&models.BranchSchedule{}).
+			Where("id = ? AND last_restore_id = ?", schedule.ID, schedule.LastRestoreID).
+			Update("last_restore_id", latest.ID)
+		if result.Error != nil {
+			logger.Error().Err(result.Error).Str("schedule_id", schedule.ID).Msg("Failed to update last_restore_id")
+			continue
+		}
+		if result.RowsAffected != 1 {
+			continue
+		}
+		schedule.LastRestoreID = latest.ID
+
+		logger.Info().
+			Str("schedule_id", schedule.ID).
+			Str("branch_name", schedule.BranchName).
+			Str("restore_id", latest.ID).
+			Str("restore_name", latest.Name).
+			Msg("New restore ready, recreating scheduled branch")
+		service.RunBranchSchedule(context.Background(), schedule)
+	}
+}
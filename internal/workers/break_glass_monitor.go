@@ -0,0 +1,35 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/breakglass"
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// breakGlassCheckInterval bounds how long a break-glass grant outlives its expiry
+const breakGlassCheckInterval = time.Minute
+
+// StartBreakGlassMonitor gives users of break-glass grants their branch once the raw restore is ready,
+// and deletes branch and raw restore when the grant expires
+func StartBreakGlassMonitor(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	service := breakglass.NewWorkerService(db, cfg, logger)
+
+	ticker := time.NewTicker(breakGlassCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.Check(ctx); err != nil {
+				logger.Error().Err(err).Msg("Failed to check break-glass grants")
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/backup"
+	"github.com/branchd-dev/branchd/internal/config"
+)
+
+// StartDatabaseBackup backs up the SQLite database every cfg.Backup.Interval
+func StartDatabaseBackup(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	ticker := time.NewTicker(cfg.Backup.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := backup.Run(ctx, db, cfg, logger); err != nil {
+				logger.Error().Err(err).Msg("Failed to back up database")
+			}
+		}
+	}
+}
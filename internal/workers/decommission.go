@@ -0,0 +1,40 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/decommission"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// HandleDecommission tears down the server and stores the decommission.Result as the task result
+// Failed steps are reported in the result rather than retried, the teardown isn't repeatable
+func HandleDecommission(ctx context.Context, t *asynq.Task, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+	payload, err := tasks.ParseDecommissionPayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	result := decommission.Run(ctx, db, cfg, logger, decommission.Params{
+		UserID:    payload.UserID,
+		UserEmail: payload.UserEmail,
+		ClientIP:  payload.ClientIP,
+		UserAgent: payload.UserAgent,
+	})
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal decommission result: %w", err)
+	}
+	if err := tasks.WriteResult(ctx, t, data); err != nil {
+		return fmt.Errorf("failed to write decommission result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/fixtures"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// HandleApplyFixture generates a fixture's rows in a branch and stores the fixtures.ApplyResult as the task result
+// Not retried, rows a failed attempt inserted stay in the branch
+func HandleApplyFixture(ctx context.Context, t *asynq.Task, db *gorm.DB, logger zerolog.Logger) error {
+	payload, err := tasks.ParseApplyFixturePayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	var branch models.Branch
+	if err := db.Where("id = ?", payload.BranchID).First(&branch).Error; err != nil {
+		return fmt.Errorf("failed to load branch: %w", err)
+	}
+	if branch.SuspendedAt != nil {
+		return fmt.Errorf("branch %s is suspended", branch.Name)
+	}
+	var restore models.Restore
+	if err := db.Where("id = ?", branch.RestoreID).First(&restore).Error; err != nil {
+		return fmt.Errorf("failed to load branch restore: %w", err)
+	}
+	var config models.Config
+	if err := db.First(&config).Error; err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Same target database resolution as createBranch
+	databaseName := config.DatabaseName
+	if config.CrunchyBridgeDatabaseName != "" {
+		databaseName = config.CrunchyBridgeDatabaseName
+	}
+
+	result, err := fixtures.Apply(ctx, &payload.Fixture, fixtures.ApplyParams{
+		DatabaseName:    databaseName,
+		PostgresVersion: restore.ClusterPostgresVersion(&config),
+		PostgresPort:    branch.Port,
+	}, logger.With().Str("branch_id", branch.ID).Logger())
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixture result: %w", err)
+	}
+	if err := tasks.WriteResult(ctx, t, data); err != nil {
+		return fmt.Errorf("failed to write fixture result: %w", err)
+	}
+	return nil
+}
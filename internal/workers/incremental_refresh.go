@@ -0,0 +1,45 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// HandleIncrementalRefresh applies the source's changes onto an existing restore
+// If the changes can't be applied (slot lost, schema changed, ...) a full refresh is scheduled instead
+func HandleIncrementalRefresh(ctx context.Context, t *asynq.Task, client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+	payload, err := tasks.ParseTaskPayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	orchestrator := restore.NewOrchestrator(db, cfg, logger)
+	refreshErr := orchestrator.RefreshIncremental(ctx, payload.RestoreID)
+	if refreshErr == nil {
+		return nil
+	}
+
+	logger.Error().
+		Err(refreshErr).
+		Str("restore_id", payload.RestoreID).
+		Msg("Incremental refresh failed - falling back to a full refresh")
+
+	var config models.Config
+	if err := db.First(&config).Error; err != nil {
+		return fmt.Errorf("%w (failed to load config for full refresh: %v)", refreshErr, err)
+	}
+	if err := enqueueFullRefresh(client, db, cfg, &config, models.RefreshTriggerScheduled, logger); err != nil {
+		return fmt.Errorf("%w (failed to schedule full refresh: %v)", refreshErr, err)
+	}
+
+	return refreshErr
+}
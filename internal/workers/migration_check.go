@@ -0,0 +1,44 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/branches"
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// HandleCheckMigration runs a migration in a copy of a branch and stores the branches.MigrationCheck as the task result
+// A migration failing is reported in the result, the task only fails when the check couldn't run
+func HandleCheckMigration(ctx context.Context, t *asynq.Task, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+	payload, err := tasks.ParseCheckMigrationPayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	var branch models.Branch
+	if err := db.Where("id = ?", payload.BranchID).First(&branch).Error; err != nil {
+		return fmt.Errorf("failed to load branch: %w", err)
+	}
+
+	check, err := branches.NewService(db, cfg, logger).CheckMigration(ctx, &branch, payload.Files)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(check)
+	if err != nil {
+		return fmt.Errorf("failed to marshal migration check: %w", err)
+	}
+	if err := tasks.WriteResult(ctx, t, data); err != nil {
+		return fmt.Errorf("failed to write migration check: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/notify"
+)
+
+// notificationCheckInterval bounds how late admins learn of a failed refresh, a slow restore or low disk space
+const notificationCheckInterval = time.Minute
+
+// StartNotificationMonitor periodically emails admins about failed scheduled refreshes, slow restores and low
+// disk space (see Config.SMTPHost), and posts completed refreshes and failed restores to notification channels
+func StartNotificationMonitor(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	service := notify.NewService(db, cfg, logger)
+
+	ticker := time.NewTicker(notificationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.Check(ctx); err != nil {
+				logger.Error().Err(err).Msg("Failed to check notifications")
+			}
+		}
+	}
+}
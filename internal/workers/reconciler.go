@@ -0,0 +1,32 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/reconcile"
+)
+
+const reconcileInterval = time.Hour
+
+// StartReconciler logs resources without restore or branch records (and records without datasets) every hour
+// Nothing is cleaned up, admins do that through POST /api/system/reconcile
+func StartReconciler(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := reconcile.Run(ctx, db, cfg, false, logger); err != nil {
+				logger.Error().Err(err).Msg("Failed to reconcile resources")
+			}
+		}
+	}
+}
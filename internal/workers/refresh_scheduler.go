@@ -1,6 +1,8 @@
 package workers
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/hibiken/asynq"
@@ -8,24 +10,31 @@ import (
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
 
+	"github.com/branchd-dev/branchd/internal/config"
 	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
 	"github.com/branchd-dev/branchd/internal/tasks"
 )
 
 // StartRefreshScheduler runs a periodic check (every minute) for config refresh
-func StartRefreshScheduler(client *asynq.Client, db *gorm.DB, logger zerolog.Logger) {
+func StartRefreshScheduler(ctx context.Context, client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
 	// Run immediately on startup, then every minute
-	checkAndEnqueueRefreshTasks(client, db, logger)
+	checkAndEnqueueRefreshTasks(client, db, cfg, logger)
 
-	for range ticker.C {
-		checkAndEnqueueRefreshTasks(client, db, logger)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkAndEnqueueRefreshTasks(client, db, cfg, logger)
+		}
 	}
 }
 
-func checkAndEnqueueRefreshTasks(client *asynq.Client, db *gorm.DB, logger zerolog.Logger) {
+func checkAndEnqueueRefreshTasks(client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
 	// Load the singleton config
 	var config models.Config
 	err := db.First(&config).Error
@@ -52,9 +61,21 @@ func checkAndEnqueueRefreshTasks(client *asynq.Client, db *gorm.DB, logger zerol
 		return
 	}
 
+	// A due refresh waits for its window and for in-flight branch creations, unless it's forced
+	reason, err := restore.RefreshBlocker(db, &config, time.Now())
+	if err != nil {
+		logger.Error().Err(err).Str("config_id", config.ID).Msg("Failed to check whether refresh can start")
+		return
+	}
+	if reason != "" {
+		logger.Debug().Str("reason", reason).Msg("Refresh due but deferred")
+		return
+	}
+
 	logger.Info().
 		Str("config_id", config.ID).
 		Str("refresh_schedule", config.RefreshSchedule).
+		Bool("forced", config.RefreshForced).
 		Time("next_refresh_at", func() time.Time {
 			if config.NextRefreshAt != nil {
 				return *config.NextRefreshAt
@@ -63,15 +84,97 @@ func checkAndEnqueueRefreshTasks(client *asynq.Client, db *gorm.DB, logger zerol
 		}()).
 		Msg("Config refresh due - checking if new restore can be created")
 
-	// Check if we're already at or above max_restores limit
-	var totalRestores int64
-	if err := db.Model(&models.Restore{}).Count(&totalRestores).Error; err != nil {
-		logger.Error().Err(err).Msg("Failed to count restores")
+	// A forced refresh was started by hand, its run counts as manual in the refresh history
+	trigger := models.RefreshTriggerScheduled
+	if config.RefreshForced {
+		trigger = models.RefreshTriggerManual
+	}
+
+	// Incremental mode applies the source's changes onto the latest restore instead of re-dumping
+	// Without a restore that has a subscription (e.g. the first refresh) a full refresh runs
+	if config.RefreshMode == models.RefreshModeIncremental {
+		scheduled, err := enqueueIncrementalRefresh(client, db, cfg, trigger, logger)
+		if err != nil {
+			logger.Error().Err(err).Str("config_id", config.ID).Msg("Failed to schedule incremental refresh")
+			return
+		}
+		if scheduled {
+			updateNextRefreshAt(db, &config, logger)
+			return
+		}
+	}
+
+	if err := enqueueFullRefresh(client, db, cfg, &config, trigger, logger); err != nil {
+		logger.Error().Err(err).Str("config_id", config.ID).Msg("Failed to schedule refresh restore")
 		return
 	}
 
-	// If we're at or above max_restores, skip creating new restore
-	// Cleanup will happen after successful restores complete
+	// Calculate and update NextRefreshAt immediately after scheduling
+	// This prevents the scheduler from creating new restores every minute
+	updateNextRefreshAt(db, &config, logger)
+}
+
+// enqueueIncrementalRefresh enqueues an incremental refresh of the latest restore with a subscription
+// Returns false when no restore can be refreshed incrementally
+func enqueueIncrementalRefresh(client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, trigger string, logger zerolog.Logger) (bool, error) {
+	var restoreModel models.Restore
+	err := db.Where("ready_at IS NOT NULL AND cloned_from_id = '' AND subscription_name != '' AND refreshing_since IS NULL").
+		Order("ready_at DESC").
+		First(&restoreModel).Error
+	if err == gorm.ErrRecordNotFound {
+		logger.Info().Msg("No restore with a subscription found - falling back to a full refresh")
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load restore: %w", err)
+	}
+
+	task, err := tasks.NewIncrementalRefreshTask(restoreModel.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to create incremental refresh task: %w", err)
+	}
+
+	// Recorded before the task can finish it
+	if err := restore.StartRefreshRun(db, &restoreModel, trigger, models.RefreshModeIncremental); err != nil {
+		logger.Warn().Err(err).Str("restore_id", restoreModel.ID).Msg("Failed to record refresh run")
+	}
+
+	// No retries, a failed incremental refresh falls back to a full refresh
+	if _, err := client.Enqueue(task, tasks.Timeout(tasks.TypeIncrementalRefresh, 12*time.Hour, cfg.Worker), asynq.MaxRetry(0), tasks.Retention(tasks.TypeIncrementalRefresh, cfg.Redis), tasks.Queue(tasks.TypeIncrementalRefresh, cfg.Worker)); err != nil {
+		if err := restore.FinishRefreshRun(db, &restoreModel, models.RefreshOutcomeFailed, "failed to enqueue incremental refresh task: "+err.Error()); err != nil {
+			logger.Warn().Err(err).Str("restore_id", restoreModel.ID).Msg("Failed to record refresh outcome")
+		}
+		return false, fmt.Errorf("failed to enqueue incremental refresh task: %w", err)
+	}
+
+	logger.Info().
+		Str("restore_id", restoreModel.ID).
+		Str("restore_name", restoreModel.Name).
+		Msg("Incremental refresh task enqueued successfully")
+
+	return true, nil
+}
+
+// enqueueFullRefresh creates a new restore record and enqueues its restore task
+// Nothing is created when max_restores is already reached, trigger is recorded in the refresh history
+func enqueueFullRefresh(client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, config *models.Config, trigger string, logger zerolog.Logger) error {
+	// Check if we're already at or above max_restores limit (clones, promoted, raw and pinned restores don't count towards it)
+	var totalRestores int64
+	if err := db.Model(&models.Restore{}).Where("cloned_from_id = '' AND promoted_from_branch = '' AND raw = ? AND pinned = ?", false, false).Count(&totalRestores).Error; err != nil {
+		return fmt.Errorf("failed to count restores: %w", err)
+	}
+
+	// At max_restores the retention policy makes room for the new restore, unless the restores it always keeps
+	// (restores with branches, the newest ready ones) fill every place
+	if int(totalRestores) >= config.MaxRestores {
+		deleted, err := restore.NewOrchestrator(db, cfg, logger).ApplyRetention(context.Background(), 1)
+		if err != nil {
+			return fmt.Errorf("failed to apply restore retention policy: %w", err)
+		}
+		totalRestores -= int64(len(deleted))
+	}
+
+	// If we're still at or above max_restores, skip creating new restore
 	if int(totalRestores) >= config.MaxRestores {
 		// Count restores with branches for logging
 		var restoresWithBranches int64
@@ -79,8 +182,7 @@ func checkAndEnqueueRefreshTasks(client *asynq.Client, db *gorm.DB, logger zerol
 			Joins("JOIN branches ON branches.restore_id = restores.id").
 			Distinct("restores.id").
 			Count(&restoresWithBranches).Error; err != nil {
-			logger.Error().Err(err).Msg("Failed to count restores with branches")
-			return
+			return fmt.Errorf("failed to count restores with branches: %w", err)
 		}
 
 		logger.Warn().
@@ -88,20 +190,29 @@ func checkAndEnqueueRefreshTasks(client *asynq.Client, db *gorm.DB, logger zerol
 			Int64("restores_with_branches", restoresWithBranches).
 			Int("max_restores", config.MaxRestores).
 			Msg("Cannot create new restore - at max_restores limit")
+		return nil
+	}
 
-		// Still update NextRefreshAt to prevent retrying every minute
-		now := time.Now()
-		nextRefresh := calculateNextRefreshTime(config.RefreshSchedule, now)
-		if nextRefresh != nil {
-			db.Model(&config).Update("next_refresh_at", nextRefresh)
+	// With the reject policy a refresh doesn't wait for running restores, it's skipped until the next run
+	if config.RestoreQueuePolicy == models.RestoreQueuePolicyReject {
+		state, err := restore.NewOrchestrator(db, cfg, logger).QueueState(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to check running restores: %w", err)
+		}
+		if state.Full(config.MaxConcurrentRestores) {
+			logger.Warn().
+				Int("running_restores", len(state.Running)).
+				Int("queued_restores", len(state.Queued)).
+				Int("max_concurrent_restores", config.MaxConcurrentRestores).
+				Msg("Cannot create new restore - at max_concurrent_restores limit")
+			return nil
 		}
-		return
 	}
 
 	// Determine schema-only flag
-	// Note: Crunchy Bridge (pgBackRest) doesn't support schema-only, only logical restore (pg_dump) does
+	// Note: Crunchy Bridge and pgBackRest restores don't support schema-only, only logical restore (pg_dump) does
 	schemaOnly := config.SchemaOnly
-	if config.CrunchyBridgeAPIKey != "" {
+	if config.CrunchyBridgeAPIKey != "" || config.UsesPgBackRest() {
 		schemaOnly = false
 	}
 
@@ -113,11 +224,7 @@ func checkAndEnqueueRefreshTasks(client *asynq.Client, db *gorm.DB, logger zerol
 	}
 
 	if err := db.Create(&database).Error; err != nil {
-		logger.Error().
-			Err(err).
-			Str("config_id", config.ID).
-			Msg("Failed to create database record for refresh")
-		return
+		return fmt.Errorf("failed to create database record for refresh: %w", err)
 	}
 
 	logger.Info().
@@ -126,42 +233,28 @@ func checkAndEnqueueRefreshTasks(client *asynq.Client, db *gorm.DB, logger zerol
 		Str("database_name", database.Name).
 		Msg("Created new database record for refresh")
 
+	// The run finishes when the restore does, a restore whose task fails to enqueue can still be resumed
+	if err := restore.StartRefreshRun(db, &database, trigger, models.RefreshModeFull); err != nil {
+		logger.Warn().Err(err).Str("database_id", database.ID).Msg("Failed to record refresh run")
+	}
+
 	// Enqueue restore task
 	task, err := tasks.NewTriggerRestoreTask(database.ID)
 	if err != nil {
-		logger.Error().
-			Err(err).
-			Str("config_id", config.ID).
-			Str("database_id", database.ID).
-			Msg("Failed to create restore task")
-		return
+		return fmt.Errorf("failed to create restore task: %w", err)
 	}
 
-	if _, err := client.Enqueue(task, asynq.Timeout(12*time.Hour)); err != nil {
-		logger.Error().
-			Err(err).
+	// Buffered while Redis is unavailable, the restore starts once it's back
+	_, buffered, err := tasks.EnqueueOrBuffer(db, client, task, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue restore task: %w", err)
+	}
+	if buffered {
+		logger.Warn().
 			Str("config_id", config.ID).
 			Str("database_id", database.ID).
-			Msg("Failed to enqueue restore task")
-		return
-	}
-
-	// Calculate and update NextRefreshAt immediately after scheduling
-	// This prevents the scheduler from creating new restores every minute
-	now := time.Now()
-	nextRefresh := calculateNextRefreshTime(config.RefreshSchedule, now)
-	if nextRefresh != nil {
-		if err := db.Model(&config).Update("next_refresh_at", nextRefresh).Error; err != nil {
-			logger.Error().
-				Err(err).
-				Str("config_id", config.ID).
-				Msg("Failed to update next_refresh_at")
-		} else {
-			logger.Info().
-				Str("config_id", config.ID).
-				Time("next_refresh_at", *nextRefresh).
-				Msg("Updated next_refresh_at")
-		}
+			Msg("Redis unavailable - buffered refresh restore task until it's back")
+		return nil
 	}
 
 	logger.Info().
@@ -169,6 +262,32 @@ func checkAndEnqueueRefreshTasks(client *asynq.Client, db *gorm.DB, logger zerol
 		Str("database_id", database.ID).
 		Bool("schema_only", config.SchemaOnly).
 		Msg("Refresh restore task enqueued successfully")
+
+	return nil
+}
+
+// updateNextRefreshAt moves next_refresh_at to the schedule's next run and clears a forced refresh
+func updateNextRefreshAt(db *gorm.DB, config *models.Config, logger zerolog.Logger) {
+	now := time.Now()
+	nextRefresh := calculateNextRefreshTime(config.RefreshSchedule, now)
+	if nextRefresh == nil {
+		return
+	}
+
+	if err := db.Model(config).Updates(map[string]interface{}{
+		"next_refresh_at": nextRefresh,
+		"refresh_forced":  false,
+	}).Error; err != nil {
+		logger.Error().
+			Err(err).
+			Str("config_id", config.ID).
+			Msg("Failed to update next_refresh_at")
+	} else {
+		logger.Info().
+			Str("config_id", config.ID).
+			Time("next_refresh_at", *nextRefresh).
+			Msg("Updated next_refresh_at")
+	}
 }
 
 // calculateNextRefreshTime calculates next refresh time from cron schedule
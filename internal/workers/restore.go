@@ -2,7 +2,9 @@ package workers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/hibiken/asynq"
@@ -10,59 +12,110 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
 	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/sysinfo"
 	"github.com/branchd-dev/branchd/internal/tasks"
 )
 
+// restoreQueuePollInterval is how often a queued restore checks for a free slot
+const restoreQueuePollInterval = 30 * time.Second
+
+// restoreStartMu serializes the concurrency check and start of restores
+// so that two trigger tasks can't both take the last slot
+var restoreStartMu sync.Mutex
+
 // HandleTriggerRestore starts the restore process for a database
 // This is a thin adapter that delegates to the restore orchestrator
-func HandleTriggerRestore(ctx context.Context, t *asynq.Task, client *asynq.Client, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+func HandleTriggerRestore(ctx context.Context, t *asynq.Task, client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
 	payload, err := tasks.ParseTaskPayload(t)
 	if err != nil {
 		return fmt.Errorf("failed to parse payload: %w", err)
 	}
 
-	// Create orchestrator
-	orchestrator := restore.NewOrchestrator(db, logger)
-
-	// Start the restore
-	if err := orchestrator.Start(ctx, payload.RestoreID); err != nil {
-		return fmt.Errorf("failed to start restore: %w", err)
+	if finished, err := restoreFinished(db, payload.RestoreID, logger); err != nil || finished {
+		return err
 	}
 
-	// Check if restore is already running (orchestrator.Start returns nil if already running)
-	isRunning, _, err := orchestrator.IsRunning(ctx, payload.RestoreID)
+	// Create orchestrator
+	orchestrator := restore.NewOrchestrator(db, cfg, logger)
+
+	started, err := startRestoreIfSlotFree(ctx, orchestrator, db, payload.RestoreID, orchestrator.Start, logger)
 	if err != nil {
-		logger.Warn().Err(err).Msg("Failed to check if restore is running")
+		return err
+	}
+	if !started {
+		// Queued behind other restores, check again later
+		_, err := client.Enqueue(t,
+			asynq.ProcessIn(restoreQueuePollInterval),
+			tasks.Timeout(tasks.TypeTriggerRestore, tasks.TriggerRestoreTimeout, cfg.Worker),
+			tasks.Retention(tasks.TypeTriggerRestore, cfg.Redis),
+			tasks.Queue(tasks.TypeTriggerRestore, cfg.Worker),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to requeue restore task: %w", err)
+		}
+		return nil
 	}
 
-	// Enqueue wait task to monitor restore completion
-	waitTask, err := tasks.NewTriggerRestoreWaitCompleteTask(payload.RestoreID)
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to create wait complete task")
-		return fmt.Errorf("failed to create wait complete task: %w", err)
+	// The restore supervisor completes the restore once its process exits
+	logger.Info().
+		Str("restore_id", payload.RestoreID).
+		Msg("Restore triggered successfully")
+
+	return nil
+}
+
+// restoreFinished reports whether a restore finished before its task ran, e.g. it was cancelled while queued
+func restoreFinished(db *gorm.DB, restoreID string, logger zerolog.Logger) (bool, error) {
+	var restoreModel models.Restore
+	if err := db.Where("id = ?", restoreID).First(&restoreModel).Error; err != nil {
+		return false, fmt.Errorf("failed to load restore: %w", err)
+	}
+	if !restoreModel.Finished() {
+		return false, nil
 	}
 
-	// Schedule first check - if already running, we still want to monitor it
-	delay := 10 * time.Second
-	if isRunning {
-		logger.Info().
-			Str("restore_id", payload.RestoreID).
-			Msg("Restore is already running, scheduling monitoring")
+	logger.Info().
+		Str("restore_id", restoreID).
+		Str("state", restoreModel.State).
+		Msg("Restore already finished, not starting it")
+	return true, nil
+}
+
+// startRestoreIfSlotFree starts the restore with start unless Config.MaxConcurrentRestores restores are running
+// or queued before it, returns false if the restore has to wait
+func startRestoreIfSlotFree(ctx context.Context, orchestrator *restore.Orchestrator, db *gorm.DB, restoreID string,
+	start func(ctx context.Context, restoreID string) error, logger zerolog.Logger) (bool, error) {
+	restoreStartMu.Lock()
+	defer restoreStartMu.Unlock()
+
+	var config models.Config
+	if err := db.First(&config).Error; err != nil {
+		return false, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	_, err = client.Enqueue(waitTask,
-		asynq.ProcessIn(delay),
-		asynq.MaxRetry(4320), // 12 hours at 10s intervals
-	)
+	state, err := orchestrator.QueueState(ctx)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to enqueue wait complete task")
-		return fmt.Errorf("failed to enqueue wait complete task: %w", err)
+		return false, fmt.Errorf("failed to check running restores: %w", err)
 	}
 
-	logger.Info().
-		Str("restore_id", payload.RestoreID).
-		Msg("Restore triggered successfully")
+	if position := state.Position(restoreID, config.MaxConcurrentRestores); position > 0 {
+		logger.Info().
+			Str("restore_id", restoreID).
+			Int("queue_position", position).
+			Int("running_restores", len(state.Running)).
+			Int("max_concurrent_restores", config.MaxConcurrentRestores).
+			Msg("Restore queued - waiting for a running restore to finish")
+		return false, nil
+	}
 
-	return nil
+	if err := start(ctx, restoreID); err != nil {
+		// The restore was marked failed, retrying can't free up space
+		if errors.Is(err, sysinfo.ErrInsufficientDiskSpace) {
+			return false, fmt.Errorf("failed to start restore: %v: %w", err, asynq.SkipRetry)
+		}
+		return false, fmt.Errorf("failed to start restore: %w", err)
+	}
+	return true, nil
 }
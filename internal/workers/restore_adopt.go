@@ -0,0 +1,68 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// HandleAdoptCluster copies an existing local cluster into a restore, marking the restore failed if it can't
+// Adoptions wait for a slot like triggered restores (Config.MaxConcurrentRestores)
+func HandleAdoptCluster(ctx context.Context, t *asynq.Task, client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+	payload, err := tasks.ParseTaskPayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	if finished, err := restoreFinished(db, payload.RestoreID, logger); err != nil || finished {
+		return err
+	}
+
+	orchestrator := restore.NewOrchestrator(db, cfg, logger)
+
+	started, err := startRestoreIfSlotFree(ctx, orchestrator, db, payload.RestoreID, orchestrator.MarkStarted, logger)
+	if err != nil {
+		// Not retried, a queued restore that never starts would hold up the ones after it
+		if failErr := orchestrator.Fail(ctx, payload.RestoreID, err.Error()); failErr != nil {
+			logger.Error().Err(failErr).Str("restore_id", payload.RestoreID).Msg("Failed to mark restore as failed")
+		}
+		return err
+	}
+	if !started {
+		// Queued behind other restores, check again later
+		_, err := client.Enqueue(t,
+			asynq.ProcessIn(restoreQueuePollInterval),
+			tasks.Timeout(tasks.TypeAdoptCluster, tasks.AdoptClusterTimeout, cfg.Worker),
+			asynq.MaxRetry(0),
+			tasks.Retention(tasks.TypeAdoptCluster, cfg.Redis),
+			tasks.Queue(tasks.TypeAdoptCluster, cfg.Worker),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to requeue adopt task: %w", err)
+		}
+		return nil
+	}
+	if adoptErr := orchestrator.Adopt(ctx, payload.RestoreID); adoptErr != nil {
+		logger.Error().
+			Err(adoptErr).
+			Str("restore_id", payload.RestoreID).
+			Msg("Cluster adoption failed")
+		if err := orchestrator.Fail(ctx, payload.RestoreID, adoptErr.Error()); err != nil {
+			logger.Error().Err(err).Str("restore_id", payload.RestoreID).Msg("Failed to mark restore as failed")
+		}
+		return adoptErr
+	}
+
+	logger.Info().
+		Str("restore_id", payload.RestoreID).
+		Msg("Cluster adopted successfully")
+
+	return nil
+}
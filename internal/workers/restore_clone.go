@@ -0,0 +1,32 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// HandleCloneRestore creates a clone of a restore, marking the clone failed if it can't
+func HandleCloneRestore(ctx context.Context, t *asynq.Task, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+	payload, err := tasks.ParseTaskPayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	orchestrator := restore.NewOrchestrator(db, cfg, logger)
+	if cloneErr := orchestrator.RunClone(ctx, payload.RestoreID); cloneErr != nil {
+		if err := orchestrator.Fail(ctx, payload.RestoreID, cloneErr.Error()); err != nil {
+			logger.Error().Err(err).Str("restore_id", payload.RestoreID).Msg("Failed to mark restore as failed")
+		}
+		return cloneErr
+	}
+
+	return nil
+}
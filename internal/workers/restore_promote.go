@@ -0,0 +1,33 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// HandlePromoteBranch turns a branch into its promoted restore, marking the restore failed if it can't
+// The branch is kept when the promotion fails
+func HandlePromoteBranch(ctx context.Context, t *asynq.Task, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+	payload, err := tasks.ParseTaskPayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	orchestrator := restore.NewOrchestrator(db, cfg, logger)
+	if promoteErr := orchestrator.RunPromotion(ctx, payload.RestoreID); promoteErr != nil {
+		if err := orchestrator.Fail(ctx, payload.RestoreID, promoteErr.Error()); err != nil {
+			logger.Error().Err(err).Str("restore_id", payload.RestoreID).Msg("Failed to mark restore as failed")
+		}
+		return promoteErr
+	}
+
+	return nil
+}
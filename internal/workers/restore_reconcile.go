@@ -0,0 +1,117 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// reconcileRestores brings unfinished restores back under supervision when the worker starts, before the restore
+// supervisor's first check:
+//   - restores whose process still runs are left to the restore supervisor, which completes them once it exits
+//   - restores whose process was interrupted without a result (e.g. the VM rebooted) are queued and triggered again,
+//     up to restore.MaxResumes times, then marked failed
+//   - without Redis (tasksLost), queued restores are triggered again and clones, promotions and adoptions that ran in
+//     a task of the previous process are marked failed, the in-process runner's tasks don't survive restarts
+func reconcileRestores(ctx context.Context, client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, logger zerolog.Logger, tasksLost bool) {
+	orchestrator := restore.NewOrchestrator(db, cfg, logger)
+
+	var started []models.Restore
+	if err := db.Where("state IN ?", []string{models.RestoreStateDumping, models.RestoreStateRestoring}).
+		Order("created_at ASC").
+		Find(&started).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to find started restores")
+		return
+	}
+
+	for i := range started {
+		restoreModel := &started[i]
+
+		// Clones, promotions and adoptions run in a worker task rather than a restore process
+		if restoreModel.ClonedFromID != "" || restoreModel.PromotedFromBranch != "" || restoreModel.AdoptedFrom != "" {
+			if tasksLost {
+				failRestore(ctx, orchestrator, restoreModel.ID, "interrupted by a worker restart, delete the restore and try again", logger)
+			}
+			continue
+		}
+
+		interrupted, err := orchestrator.Interrupted(ctx, restoreModel)
+		if err != nil {
+			logger.Warn().Err(err).Str("restore_id", restoreModel.ID).Msg("Failed to check interrupted restore")
+			continue
+		}
+		if !interrupted {
+			continue
+		}
+
+		if restoreModel.ResumeCount >= restore.MaxResumes {
+			failRestore(ctx, orchestrator, restoreModel.ID, fmt.Sprintf("restore process was interrupted %d times", restoreModel.ResumeCount+1), logger)
+			continue
+		}
+		if err := orchestrator.Requeue(ctx, restoreModel); err != nil {
+			logger.Error().Err(err).Str("restore_id", restoreModel.ID).Msg("Failed to queue interrupted restore")
+			continue
+		}
+		// Queued without Redis too, resumed with the other queued restores below
+		if !tasksLost {
+			resumeRestore(client, restoreModel.ID, cfg, logger)
+		}
+	}
+
+	if tasksLost {
+		resumeQueuedRestores(client, db, cfg, logger)
+	}
+}
+
+// resumeQueuedRestores triggers queued restores again, for the in-process task runner whose tasks don't survive restarts
+func resumeQueuedRestores(client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	var restores []models.Restore
+	if err := db.Where("state = ? AND cloned_from_id = '' AND promoted_from_branch = '' AND adopted_from = ''", models.RestoreStatePending).
+		Order("created_at ASC").
+		Find(&restores).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to find queued restores")
+		return
+	}
+
+	for _, restoreModel := range restores {
+		resumeRestore(client, restoreModel.ID, cfg, logger)
+	}
+}
+
+// resumeRestore enqueues the trigger task of a queued restore
+func resumeRestore(client tasks.Enqueuer, restoreID string, cfg *config.Config, logger zerolog.Logger) {
+	task, err := tasks.NewTriggerRestoreTask(restoreID)
+	if err == nil {
+		_, err = client.Enqueue(task,
+			tasks.Timeout(tasks.TypeTriggerRestore, tasks.TriggerRestoreTimeout, cfg.Worker),
+			tasks.Retention(tasks.TypeTriggerRestore, cfg.Redis),
+			tasks.Queue(tasks.TypeTriggerRestore, cfg.Worker),
+		)
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to resume restore")
+		return
+	}
+
+	logger.Info().
+		Str("restore_id", restoreID).
+		Msg("Resumed queued restore after restart")
+}
+
+// failRestore marks a restore failed, logging errors since reconciliation continues with the next restore
+func failRestore(ctx context.Context, orchestrator *restore.Orchestrator, restoreID, reason string, logger zerolog.Logger) {
+	logger.Warn().
+		Str("restore_id", restoreID).
+		Str("reason", reason).
+		Msg("Marking restore failed after restart")
+	if err := orchestrator.Fail(ctx, restoreID, reason); err != nil {
+		logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to mark restore as failed")
+	}
+}
@@ -0,0 +1,36 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/restore"
+)
+
+// restoreRetentionInterval is how often restores are checked against the retention policy,
+// besides after every completed restore
+const restoreRetentionInterval = 15 * time.Minute
+
+// StartRestoreRetention deletes the restores the retention policy no longer keeps, e.g. once they pass
+// restore_max_age_days or lose their last branch
+func StartRestoreRetention(ctx context.Context, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	orchestrator := restore.NewOrchestrator(db, cfg, logger)
+
+	ticker := time.NewTicker(restoreRetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := orchestrator.ApplyRetention(ctx, 0); err != nil {
+				logger.Error().Err(err).Msg("Failed to apply restore retention policy")
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// restoreSupervisorInterval is how often the processes of running restores are checked
+const restoreSupervisorInterval = 10 * time.Second
+
+// StartRestoreSupervisor drives started restores through their states: it moves dumping restores to restoring
+// once pg_dump finished and enqueues one completion task per restore once its process exited or its deadline passed.
+// Checking a process is a local PID lookup, so one goroutine replaces a polling task per restore every 10 seconds.
+// Restores that finished, or whose completion was interrupted, while the worker was down are completed on the first check
+func StartRestoreSupervisor(ctx context.Context, client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	orchestrator := restore.NewOrchestrator(db, cfg, logger)
+
+	ticker := time.NewTicker(restoreSupervisorInterval)
+	defer ticker.Stop()
+
+	for {
+		superviseRestores(ctx, orchestrator, client, db, cfg, logger)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func superviseRestores(ctx context.Context, orchestrator *restore.Orchestrator, client tasks.Enqueuer, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	var restores []models.Restore
+	if err := db.Where("state IN ? AND cloned_from_id = '' AND promoted_from_branch = '' AND adopted_from = ''",
+		[]string{models.RestoreStateDumping, models.RestoreStateRestoring, models.RestoreStateAnonymizing}).
+		Find(&restores).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to find running restores")
+		return
+	}
+	if len(restores) == 0 {
+		return
+	}
+
+	var serverConfig models.Config
+	if err := db.First(&serverConfig).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to load config for restore supervisor")
+		return
+	}
+
+	for i := range restores {
+		restoreModel := &restores[i]
+
+		// The process exited before, its completion didn't finish (e.g. the worker restarted meanwhile)
+		if restoreModel.State == models.RestoreStateAnonymizing {
+			enqueueRestoreComplete(client, restoreModel.ID, cfg, logger)
+			continue
+		}
+
+		if err := orchestrator.SyncPhase(restoreModel); err != nil {
+			logger.Warn().Err(err).Str("restore_id", restoreModel.ID).Msg("Failed to read restore phase")
+		}
+		if err := orchestrator.UpdateProgress(restoreModel, time.Now()); err != nil {
+			logger.Warn().Err(err).Str("restore_id", restoreModel.ID).Msg("Failed to read restore progress")
+		}
+
+		isRunning, _, err := orchestrator.GetProcessManager().CheckIfRunning(ctx, restoreModel.Name)
+		if err != nil {
+			logger.Warn().Err(err).Str("restore_id", restoreModel.ID).Msg("Failed to check restore process")
+			continue
+		}
+		if deadline := restore.Deadline(restoreModel, &serverConfig); isRunning && (deadline == nil || time.Now().Before(*deadline)) {
+			continue
+		}
+
+		enqueueRestoreComplete(client, restoreModel.ID, cfg, logger)
+	}
+}
+
+// enqueueRestoreComplete enqueues the completion task of a restore
+// The task ID is derived from the restore, so checks until the task ran (or several workers) don't enqueue it twice
+func enqueueRestoreComplete(client tasks.Enqueuer, restoreID string, cfg *config.Config, logger zerolog.Logger) {
+	task, err := tasks.NewTriggerRestoreWaitCompleteTask(restoreID)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create restore completion task")
+		return
+	}
+
+	_, err = client.Enqueue(task,
+		asynq.TaskID("restore-complete-"+restoreID),
+		asynq.MaxRetry(restoreCompleteMaxRetry),
+		tasks.Timeout(tasks.TypeRestoreWaitComplete, tasks.DefaultTimeout, cfg.Worker),
+		tasks.Retention(tasks.TypeRestoreWaitComplete, cfg.Redis),
+		tasks.Queue(tasks.TypeRestoreWaitComplete, cfg.Worker),
+	)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("restore_id", restoreID).Msg("Failed to enqueue restore completion task")
+		return
+	}
+
+	logger.Info().
+		Str("restore_id", restoreID).
+		Msg("Restore process exited, enqueued completion")
+}
@@ -0,0 +1,49 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/models"
+	"github.com/branchd-dev/branchd/internal/restore"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// HandleRestoreUnboost returns a boosted restore to background priority once its boost expires
+func HandleRestoreUnboost(ctx context.Context, t *asynq.Task, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
+	payload, err := tasks.ParseTaskPayload(t)
+	if err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+
+	var restoreModel models.Restore
+	if err := db.Where("id = ?", payload.RestoreID).First(&restoreModel).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			// Restore was deleted while boosted, nothing to do
+			return nil
+		}
+		return fmt.Errorf("failed to load restore: %w", err)
+	}
+
+	// Already unboosted, or boosted again with a later expiry (that boost has its own task)
+	if restoreModel.BoostedUntil == nil || restoreModel.BoostedUntil.After(time.Now()) {
+		return nil
+	}
+
+	orchestrator := restore.NewOrchestrator(db, cfg, logger)
+	if err := orchestrator.EndBoost(ctx, &restoreModel); err != nil {
+		return fmt.Errorf("failed to unboost restore: %w", err)
+	}
+
+	logger.Info().
+		Str("restore_id", restoreModel.ID).
+		Msg("Restore boost expired, returned to background priority")
+
+	return nil
+}
@@ -9,14 +9,18 @@ import (
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
 
+	"github.com/branchd-dev/branchd/internal/config"
 	"github.com/branchd-dev/branchd/internal/models"
 	"github.com/branchd-dev/branchd/internal/restore"
 	"github.com/branchd-dev/branchd/internal/tasks"
 )
 
-// HandleRestoreWaitComplete polls for restore completion
+// restoreCompleteMaxRetry is how often a failing completion (e.g. post-restore SQL) is retried
+const restoreCompleteMaxRetry = 20
+
+// HandleRestoreWaitComplete finalizes a restore once its process exited, the restore supervisor enqueues it
 // This handler is a thin adapter that uses the restore orchestrator
-func HandleRestoreWaitComplete(ctx context.Context, t *asynq.Task, client *asynq.Client, db *gorm.DB, logger zerolog.Logger) error {
+func HandleRestoreWaitComplete(ctx context.Context, t *asynq.Task, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) error {
 	payload, err := tasks.ParseTaskPayload(t)
 	if err != nil {
 		return fmt.Errorf("failed to parse payload: %w", err)
@@ -28,8 +32,30 @@ func HandleRestoreWaitComplete(ctx context.Context, t *asynq.Task, client *asynq
 		return fmt.Errorf("failed to load restore: %w", err)
 	}
 
+	if restoreModel.Finished() {
+		logger.Info().
+			Str("restore_id", restoreModel.ID).
+			Str("state", restoreModel.State).
+			Str("failure_reason", restoreModel.FailureReason).
+			Msg("Restore already finished")
+		return nil
+	}
+
 	// Create orchestrator
-	orchestrator := restore.NewOrchestrator(db, logger)
+	orchestrator := restore.NewOrchestrator(db, cfg, logger)
+
+	// Its process exited before, the previous completion attempt was interrupted
+	if restoreModel.State == models.RestoreStateAnonymizing {
+		if err := orchestrator.Complete(ctx, payload.RestoreID); err != nil {
+			return fmt.Errorf("failed to complete restore: %w", err)
+		}
+		return nil
+	}
+
+	var serverConfig models.Config
+	if err := db.First(&serverConfig).Error; err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
 
 	// Check progress
 	status, isRunning, logTail, err := orchestrator.CheckProgress(ctx, payload.RestoreID)
@@ -37,23 +63,24 @@ func HandleRestoreWaitComplete(ctx context.Context, t *asynq.Task, client *asynq
 		return fmt.Errorf("failed to check restore progress: %w", err)
 	}
 
-	if isRunning {
-		// Enqueue another wait task
-		waitTask, err := tasks.NewTriggerRestoreWaitCompleteTask(restoreModel.ID)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to create wait complete task")
-			return fmt.Errorf("failed to create wait complete task: %w", err)
-		}
+	if deadline := restore.Deadline(&restoreModel, &serverConfig); isRunning && deadline != nil && time.Now().After(*deadline) {
+		logger.Error().
+			Str("restore_id", restoreModel.ID).
+			Time("started_at", *restoreModel.StartedAt).
+			Int("restore_deadline_hours", serverConfig.RestoreDeadlineHours).
+			Msg("Restore deadline exceeded")
 
-		_, err = client.Enqueue(waitTask,
-			asynq.ProcessIn(10*time.Second),
-			asynq.MaxRetry(4320),
-		)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to enqueue next wait complete task")
-			return fmt.Errorf("failed to enqueue next wait complete task: %w", err)
+		if err := orchestrator.StopDeadlineExceeded(ctx, &restoreModel, serverConfig.RestoreDeadlineHours); err != nil {
+			return fmt.Errorf("failed to stop restore after deadline: %w", err)
 		}
+		return nil
+	}
 
+	if isRunning {
+		// Polling tasks enqueued before the restore supervisor existed end here, it completes the restore
+		logger.Info().
+			Str("restore_id", restoreModel.ID).
+			Msg("Restore still running, the restore supervisor completes it once its process exits")
 		return nil
 	}
 
@@ -75,13 +102,20 @@ func HandleRestoreWaitComplete(ctx context.Context, t *asynq.Task, client *asynq
 			Str("restore_id", restoreModel.ID).
 			Str("log_tail", logTail).
 			Msg("Restore failed")
-		return fmt.Errorf("restore failed - log tail: %s", logTail)
+		if err := orchestrator.Fail(ctx, restoreModel.ID, fmt.Sprintf("restore failed: %s", logTail)); err != nil {
+			return err
+		}
+		// Checking again won't change the result
+		return fmt.Errorf("restore failed - log tail: %s: %w", logTail, asynq.SkipRetry)
 
 	default:
 		logger.Error().
 			Str("restore_id", restoreModel.ID).
 			Str("status", string(status)).
 			Msg("Restore process died without clear result")
-		return fmt.Errorf("restore process died - status: %s, log: %s", status, logTail)
+		if err := orchestrator.Fail(ctx, restoreModel.ID, fmt.Sprintf("restore process died (status %s): %s", status, logTail)); err != nil {
+			return err
+		}
+		return fmt.Errorf("restore process died - status: %s, log: %s: %w", status, logTail, asynq.SkipRetry)
 	}
 }
@@ -0,0 +1,64 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// taskBufferReplayInterval is how often buffered tasks are retried while Redis is unavailable
+const taskBufferReplayInterval = 15 * time.Second
+
+// StartTaskBufferReplay enqueues the restore triggers buffered while Redis was unavailable once it's back
+// (see tasks.EnqueueOrBuffer), so a Redis restart delays restores instead of losing them
+func StartTaskBufferReplay(ctx context.Context, client *tasks.QueueClient, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	ticker := time.NewTicker(taskBufferReplayInterval)
+	defer ticker.Stop()
+
+	// Run immediately on startup, then every interval
+	replayBufferedTasks(ctx, client, db, cfg, logger)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			replayBufferedTasks(ctx, client, db, cfg, logger)
+		}
+	}
+}
+
+func replayBufferedTasks(ctx context.Context, client *tasks.QueueClient, db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	count, err := tasks.BufferedCount(db)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to count buffered tasks")
+		return
+	}
+	if count == 0 {
+		return
+	}
+
+	// Skip the replay while Redis is still down, every enqueue would wait for its own connection timeout
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx); err != nil {
+		logger.Warn().Err(err).Int64("buffered_tasks", count).Msg("Redis still unavailable, keeping buffered tasks")
+		return
+	}
+
+	replayed, err := tasks.ReplayBuffered(db, client, cfg, logger)
+	if replayed > 0 {
+		logger.Info().Int("replayed", replayed).Msg("Enqueued tasks buffered while Redis was unavailable")
+	}
+	if errors.Is(err, tasks.ErrQueueUnavailable) {
+		logger.Warn().Err(err).Msg("Redis became unavailable again while replaying buffered tasks")
+	} else if err != nil {
+		logger.Error().Err(err).Msg("Failed to replay buffered tasks")
+	}
+}
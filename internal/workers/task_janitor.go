@@ -0,0 +1,67 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// StartTaskJanitor periodically trims asynq task history and logs Redis memory use
+// Without it, months of restore polling and failed tasks grow Redis until it OOMs on small VMs
+func StartTaskJanitor(ctx context.Context, rdb *redis.Client, cfg *config.Config, logger zerolog.Logger) {
+	inspector := asynq.NewInspectorFromRedisClient(rdb)
+
+	ticker := time.NewTicker(cfg.Redis.TaskGCInterval)
+	defer ticker.Stop()
+
+	// Run immediately on startup, then every interval
+	runTaskJanitor(ctx, inspector, rdb, cfg.Redis, logger)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runTaskJanitor(ctx, inspector, rdb, cfg.Redis, logger)
+		}
+	}
+}
+
+func runTaskJanitor(ctx context.Context, inspector *asynq.Inspector, rdb *redis.Client, cfg config.RedisConfig, logger zerolog.Logger) {
+	result, err := tasks.TrimHistory(inspector, cfg, time.Now())
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to trim task history")
+	}
+	if result.Completed > 0 || result.Archived > 0 {
+		logger.Info().
+			Int("completed_deleted", result.Completed).
+			Int("archived_deleted", result.Archived).
+			Msg("Trimmed task history")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	metrics, err := tasks.CollectRedisMetrics(ctx, inspector, rdb, cfg)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to collect Redis metrics")
+		return
+	}
+
+	event := logger.Info()
+	if metrics.MaxMemoryBytes > 0 && metrics.UsedMemoryBytes > metrics.MaxMemoryBytes*8/10 {
+		event = logger.Warn()
+	}
+	event.
+		Int64("used_memory_bytes", metrics.UsedMemoryBytes).
+		Int64("peak_memory_bytes", metrics.PeakMemoryBytes).
+		Int64("max_memory_bytes", metrics.MaxMemoryBytes).
+		Int64("task_memory_bytes", metrics.TaskMemoryBytes).
+		Msg("Redis memory usage")
+}
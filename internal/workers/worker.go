@@ -0,0 +1,270 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+
+	"github.com/branchd-dev/branchd/internal/config"
+	"github.com/branchd-dev/branchd/internal/tasks"
+)
+
+// Worker processes asynq tasks and runs the periodic jobs (restore supervisor, refresh scheduler, idle branch monitor, notifications, task janitor)
+// Runs in the worker process, or in the server process with --all-in-one or without Redis
+type Worker struct {
+	db     *gorm.DB
+	cfg    *config.Config
+	logger zerolog.Logger
+
+	client      tasks.Enqueuer     // For enqueueing next tasks in chain
+	queueClient *tasks.QueueClient // Same as client with Redis, nil without Redis
+	asynqServer *asynq.Server      // nil without Redis
+	redisClient *redis.Client      // nil without Redis
+	runner      *tasks.LocalRunner // Processes the tasks without Redis, nil with Redis
+
+	stopJobs context.CancelFunc // Stops the periodic jobs
+	jobs     sync.WaitGroup     // Running periodic jobs, waited for before the database closes
+}
+
+// NewWorker creates a worker using the given database
+func NewWorker(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *Worker {
+	asynqServer := asynq.NewServer(
+		asynq.RedisClientOpt{
+			Addr: cfg.Redis.Address,
+		},
+		asynq.Config{
+			Concurrency:    cfg.Worker.Concurrency,
+			Queues:         cfg.Worker.Queues(),
+			StrictPriority: cfg.Worker.StrictPriority,
+			// Logging
+			Logger: &asynqLogger{log: logger},
+		},
+	)
+
+	redisClient := redis.NewClient(&redis.Options{Addr: cfg.Redis.Address})
+	queueClient := tasks.NewQueueClient(asynq.NewClient(asynq.RedisClientOpt{Addr: cfg.Redis.Address}), redisClient)
+
+	return &Worker{
+		db:          db,
+		cfg:         cfg,
+		logger:      logger,
+		client:      queueClient,
+		queueClient: queueClient,
+		asynqServer: asynqServer,
+		redisClient: redisClient,
+	}
+}
+
+// NewLocalWorker creates a worker processing the tasks of an in-process runner, for running without Redis
+// The runner is shared with the server enqueueing the tasks, so both run in the same process
+func NewLocalWorker(db *gorm.DB, cfg *config.Config, runner *tasks.LocalRunner, logger zerolog.Logger) *Worker {
+	return &Worker{
+		db:     db,
+		cfg:    cfg,
+		logger: logger,
+		client: runner,
+		runner: runner,
+	}
+}
+
+// Start registers the task handlers and starts processing tasks and the periodic jobs (non-blocking)
+func (w *Worker) Start() error {
+	db, cfg, log, client := w.db, w.cfg, w.logger, w.client
+
+	// Register task handlers
+	mux := asynq.NewServeMux()
+
+	// Restore workflow tasks
+	mux.HandleFunc(tasks.TypeTriggerRestore, func(ctx context.Context, t *asynq.Task) error {
+		return HandleTriggerRestore(ctx, t, client, db, cfg, log)
+	})
+	mux.HandleFunc(tasks.TypeRestoreWaitComplete, func(ctx context.Context, t *asynq.Task) error {
+		return HandleRestoreWaitComplete(ctx, t, db, cfg, log)
+	})
+	mux.HandleFunc(tasks.TypeRestoreUnboost, func(ctx context.Context, t *asynq.Task) error {
+		return HandleRestoreUnboost(ctx, t, db, cfg, log)
+	})
+	mux.HandleFunc(tasks.TypeIncrementalRefresh, func(ctx context.Context, t *asynq.Task) error {
+		return HandleIncrementalRefresh(ctx, t, client, db, cfg, log)
+	})
+	mux.HandleFunc(tasks.TypeAdoptCluster, func(ctx context.Context, t *asynq.Task) error {
+		return HandleAdoptCluster(ctx, t, client, db, cfg, log)
+	})
+	mux.HandleFunc(tasks.TypeCloneRestore, func(ctx context.Context, t *asynq.Task) error {
+		return HandleCloneRestore(ctx, t, db, cfg, log)
+	})
+	mux.HandleFunc(tasks.TypePromoteBranch, func(ctx context.Context, t *asynq.Task) error {
+		return HandlePromoteBranch(ctx, t, db, cfg, log)
+	})
+
+	// Branch tasks
+	mux.HandleFunc(tasks.TypeCreateBranch, func(ctx context.Context, t *asynq.Task) error {
+		return HandleCreateBranch(ctx, t, db, cfg, log)
+	})
+	mux.HandleFunc(tasks.TypeDeleteBranch, func(ctx context.Context, t *asynq.Task) error {
+		return HandleDeleteBranch(ctx, t, db, cfg, log)
+	})
+	mux.HandleFunc(tasks.TypeApplyFixture, func(ctx context.Context, t *asynq.Task) error {
+		return HandleApplyFixture(ctx, t, db, log)
+	})
+	mux.HandleFunc(tasks.TypeExportBranch, func(ctx context.Context, t *asynq.Task) error {
+		return HandleExportBranch(ctx, t, db, cfg, log)
+	})
+	mux.HandleFunc(tasks.TypeCheckMigration, func(ctx context.Context, t *asynq.Task) error {
+		return HandleCheckMigration(ctx, t, db, cfg, log)
+	})
+
+	// System tasks
+	mux.HandleFunc(tasks.TypeDecommission, func(ctx context.Context, t *asynq.Task) error {
+		return HandleDecommission(ctx, t, db, cfg, log)
+	})
+
+	if w.runner != nil {
+		log.Info().
+			Int("concurrency", cfg.Worker.Concurrency).
+			Interface("queues", cfg.Worker.Queues()).
+			Interface("queue_timeouts", cfg.Worker.QueueTimeouts).
+			Bool("strict_priority", cfg.Worker.StrictPriority).
+			Msg("Starting in-process task runner (no Redis)...")
+		w.runner.Start(mux)
+	} else {
+		log.Info().
+			Int("concurrency", cfg.Worker.Concurrency).
+			Interface("queues", cfg.Worker.Queues()).
+			Interface("queue_timeouts", cfg.Worker.QueueTimeouts).
+			Bool("strict_priority", cfg.Worker.StrictPriority).
+			Msg("Starting Asynq worker server...")
+		if err := w.asynqServer.Start(mux); err != nil {
+			return fmt.Errorf("failed to start asynq worker server: %w", err)
+		}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	w.stopJobs = stop
+
+	// Restores interrupted by the restart are queued again, without Redis queued restores are triggered again
+	reconcileRestores(ctx, client, db, cfg, log, w.runner != nil)
+
+	// Start restore supervisor (enqueues the completion of restores whose process exited)
+	w.startJob(func() { StartRestoreSupervisor(ctx, client, db, cfg, log) })
+
+	// Start restore retention (deletes restores past max_restores or restore_max_age_days)
+	w.startJob(func() { StartRestoreRetention(ctx, db, cfg, log) })
+
+	// Start refresh scheduler (checks every minute for configs needing a refresh)
+	w.startJob(func() { StartRefreshScheduler(ctx, client, db, cfg, log) })
+
+	// Start idle branch monitor (suspends branches without connections, see Config.BranchIdleSuspendHours)
+	w.startJob(func() { StartBranchIdleMonitor(ctx, db, cfg, log) })
+
+	// Start branch disk monitor (records branches near or at their ZFS quota)
+	w.startJob(func() { StartBranchDiskMonitor(ctx, db, cfg, log) })
+
+	// Start branch health monitor (records running, stopped or crashed branches)
+	w.startJob(func() { StartBranchHealthMonitor(ctx, db, cfg, log) })
+
+	// Start break-glass monitor (activates grants once their raw restore is ready, revokes expired ones)
+	w.startJob(func() { StartBreakGlassMonitor(ctx, db, cfg, log) })
+
+	// Start branch scheduler (recreates branches of due BranchSchedules)
+	w.startJob(func() { StartBranchScheduler(ctx, db, cfg, log) })
+
+	// Start branch expiry janitor (deletes branches past their template's TTL, revokes expired shares)
+	w.startJob(func() { StartBranchExpiryJanitor(ctx, db, cfg, log) })
+
+	// Start branch export janitor (deletes downloadable archives past exports.Retention)
+	w.startJob(func() { StartBranchExportJanitor(ctx, db, cfg, log) })
+
+	// Start notification monitor (emails admins about failed refreshes, slow restores and low disk space, posts to notification channels)
+	w.startJob(func() { StartNotificationMonitor(ctx, db, cfg, log) })
+
+	// Start database backup (archives the SQLite database, see Config.Backup), 0 = only on request
+	if cfg.Backup.Interval > 0 {
+		w.startJob(func() { StartDatabaseBackup(ctx, db, cfg, log) })
+	}
+
+	// Start reconciler (logs datasets, units, processes and ports without restore or branch records)
+	w.startJob(func() { StartReconciler(ctx, db, cfg, log) })
+
+	// Start task history janitor (trims completed/archived tasks, reports Redis memory)
+	// The in-process runner drops expired tasks itself
+	if w.redisClient != nil {
+		w.startJob(func() { StartTaskJanitor(ctx, w.redisClient, cfg, log) })
+	}
+
+	// Start task buffer replay (enqueues restore triggers buffered while Redis was unavailable)
+	if w.queueClient != nil {
+		w.startJob(func() { StartTaskBufferReplay(ctx, w.queueClient, db, cfg, log) })
+	}
+
+	return nil
+}
+
+// startJob runs a periodic job until Shutdown
+func (w *Worker) startJob(job func()) {
+	w.jobs.Add(1)
+	go func() {
+		defer w.jobs.Done()
+		job()
+	}()
+}
+
+// Shutdown stops the periodic jobs and fetching tasks, waits for running jobs and tasks to finish
+// and closes the Redis connections. The database stays open, the caller closes it afterwards
+func (w *Worker) Shutdown() {
+	if w.stopJobs != nil {
+		w.logger.Info().Msg("Stopping periodic jobs...")
+		w.stopJobs()
+		w.jobs.Wait()
+	}
+
+	// The runner's enqueueing side belongs to the server, it's closed with it
+	if w.runner != nil {
+		w.logger.Info().Msg("Stopping in-process task runner - waiting for tasks to finish (30s timeout)...")
+		w.runner.Shutdown()
+		w.logger.Info().Msg("Worker shutdown complete")
+		return
+	}
+
+	w.logger.Info().Msg("Stopping Asynq worker - waiting for tasks to finish (30s timeout)...")
+	w.asynqServer.Shutdown()
+
+	if err := w.client.Close(); err != nil {
+		w.logger.Warn().Err(err).Msg("Error closing worker Asynq client")
+	}
+	if err := w.redisClient.Close(); err != nil {
+		w.logger.Warn().Err(err).Msg("Error closing worker Redis client")
+	}
+
+	w.logger.Info().Msg("Worker shutdown complete")
+}
+
+// asynqLogger is a wrapper to make zerolog compatible with Asynq's logger interface
+type asynqLogger struct {
+	log zerolog.Logger
+}
+
+func (l *asynqLogger) Debug(args ...interface{}) {
+	l.log.Debug().Msg(fmt.Sprint(args...))
+}
+
+func (l *asynqLogger) Info(args ...interface{}) {
+	l.log.Info().Msg(fmt.Sprint(args...))
+}
+
+func (l *asynqLogger) Warn(args ...interface{}) {
+	l.log.Warn().Msg(fmt.Sprint(args...))
+}
+
+func (l *asynqLogger) Error(args ...interface{}) {
+	l.log.Error().Msg(fmt.Sprint(args...))
+}
+
+func (l *asynqLogger) Fatal(args ...interface{}) {
+	l.log.Fatal().Msg(fmt.Sprint(args...))
+}
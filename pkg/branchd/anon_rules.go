@@ -0,0 +1,330 @@
+package branchd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// AnonRule is a stored anonymization rule
+type AnonRule struct {
+	ID              string              `json:"id"`
+	CreatedAt       time.Time           `json:"created_at"`
+	Table           string              `json:"table"`
+	Column          string              `json:"column"`
+	Template        string              `json:"template"`
+	ColumnType      string              `json:"column_type"`
+	JSONPath        string              `json:"json_path,omitempty"`
+	Function        string              `json:"function"`
+	FunctionOptions AnonFunctionOptions `json:"function_options"`
+	Consistent      bool                `json:"consistent"`
+}
+
+// AnonFunctionOptions holds the arguments for built-in anonymization functions
+type AnonFunctionOptions struct {
+	Salt        string            `json:"salt,omitempty"`        // md5, sha256, consistent rules
+	KeepLast    int               `json:"keep_last,omitempty"`   // mask
+	MaskChar    string            `json:"mask_char,omitempty"`   // mask
+	Pattern     string            `json:"pattern,omitempty"`     // regex
+	Replacement string            `json:"replacement,omitempty"` // regex
+	Mapping     map[string]string `json:"mapping,omitempty"`     // lookup
+	Default     *string           `json:"default,omitempty"`     // lookup: value for unmapped rows (nil = keep original)
+}
+
+// AnonRuleInput creates an anonymization rule
+type AnonRuleInput struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+
+	// JSON template value (e.g. "user_${index}@example.com", 0, true, null), required unless Function is set
+	Template json.RawMessage `json:"template,omitempty"`
+	Type     string          `json:"type,omitempty"` // Optional: "text", "integer", "boolean", "null", "date", "timestamp", "uuid"
+
+	// Optional: replace this field of a jsonb column (e.g. "contact.email") instead of the whole column
+	JSONPath string `json:"json_path,omitempty"`
+
+	// Optional built-in function ("md5", "sha256", "fake_name", "fake_email", "fake_address", "mask", "regex", "lookup")
+	Function        string               `json:"function,omitempty"`
+	FunctionOptions *AnonFunctionOptions `json:"function_options,omitempty"`
+
+	// Optional: the same value gets the same output in every table (templates with ${index} and fake_* functions)
+	// Rules meant to match must use the same FunctionOptions.Salt
+	Consistent bool `json:"consistent,omitempty"`
+}
+
+// AnonRuleValidationError describes a rule that does not match the restored schema
+type AnonRuleValidationError struct {
+	Index      int    `json:"index"`
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	Code       string `json:"code"` // missing_table, missing_column, type_mismatch, not_nullable
+	Message    string `json:"message"`
+	ColumnType string `json:"column_type,omitempty"`
+}
+
+// AnonRulesValidation is the result of ValidateAnonRules
+type AnonRulesValidation struct {
+	RestoreID string                    `json:"restore_id"`
+	Valid     bool                      `json:"valid"`
+	Errors    []AnonRuleValidationError `json:"errors"`
+}
+
+// PreviewAnonRulesRequest dry-runs rules against a restore
+type PreviewAnonRulesRequest struct {
+	RestoreID  string          `json:"restore_id,omitempty"`  // Optional: defaults to the latest ready restore
+	Rules      []AnonRuleInput `json:"rules,omitempty"`       // Optional: defaults to the stored rules
+	SampleSize int             `json:"sample_size,omitempty"` // Optional: sample rows per table (default 10, max 100)
+}
+
+// AnonPreview contains the outcome of a dry run for each table
+type AnonPreview struct {
+	Tables []AnonTablePreview `json:"tables"`
+}
+
+// AnonTablePreview describes what the rules would do to a single table
+type AnonTablePreview struct {
+	Table       string              `json:"table"`
+	OrderedBy   string              `json:"ordered_by"`
+	TotalRows   int64               `json:"total_rows"`
+	RowsUpdated int64               `json:"rows_updated"`
+	RowsSkipped int64               `json:"rows_skipped"`
+	Columns     []AnonColumnPreview `json:"columns"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// AnonColumnPreview contains before/after samples for a single column
+type AnonColumnPreview struct {
+	Column   string            `json:"column"`
+	JSONPath string            `json:"json_path,omitempty"`
+	Samples  []AnonSampleValue `json:"samples"`
+}
+
+// AnonSampleValue is a single before/after pair (nil means SQL NULL)
+type AnonSampleValue struct {
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
+
+// AnonRuleOption configures CreateAnonRule and UpdateAnonRules
+type AnonRuleOption func(url.Values)
+
+// SkipSchemaValidation saves rules even if they don't match the latest restore's schema
+func SkipSchemaValidation() AnonRuleOption {
+	return func(query url.Values) {
+		query.Set("skip_validation", "true")
+	}
+}
+
+// ValidationErrors returns the schema validation errors of a rejected rule change (nil if err is something else)
+func ValidationErrors(err error) []AnonRuleValidationError {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity {
+		return nil
+	}
+
+	var body struct {
+		ValidationErrors []AnonRuleValidationError `json:"validation_errors"`
+	}
+	if json.Unmarshal(apiErr.Body, &body) != nil {
+		return nil
+	}
+	return body.ValidationErrors
+}
+
+// ListAnonRules returns the stored anonymization rules
+func (c *Client) ListAnonRules(ctx context.Context) ([]AnonRule, error) {
+	var rules []AnonRule
+	if err := c.do(ctx, http.MethodGet, "/api/anon-rules", nil, nil, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// CreateAnonRule adds an anonymization rule
+func (c *Client) CreateAnonRule(ctx context.Context, rule AnonRuleInput, opts ...AnonRuleOption) (*AnonRule, error) {
+	var created AnonRule
+	if err := c.do(ctx, http.MethodPost, "/api/anon-rules", anonRuleQuery(opts), rule, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateAnonRules replaces all anonymization rules
+func (c *Client) UpdateAnonRules(ctx context.Context, rules []AnonRuleInput, opts ...AnonRuleOption) ([]AnonRule, error) {
+	req := struct {
+		Rules []AnonRuleInput `json:"rules"`
+	}{Rules: rules}
+	if req.Rules == nil {
+		req.Rules = []AnonRuleInput{}
+	}
+
+	var updated []AnonRule
+	if err := c.do(ctx, http.MethodPut, "/api/anon-rules", anonRuleQuery(opts), req, &updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// AnonRulesDiff is what UpdateAnonRules would change, rules being matched by table and column
+type AnonRulesDiff struct {
+	DryRun    bool             `json:"dry_run"`
+	Added     []AnonRule       `json:"added"`
+	Removed   []AnonRule       `json:"removed"`
+	Changed   []AnonRuleChange `json:"changed"`
+	Unchanged []AnonRule       `json:"unchanged"`
+}
+
+// AnonRuleChange is a column whose rule would be replaced
+type AnonRuleChange struct {
+	Before AnonRule `json:"before"`
+	After  AnonRule `json:"after"`
+}
+
+// Empty reports whether applying the rules would change nothing
+func (d *AnonRulesDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffAnonRules returns what UpdateAnonRules would change without saving anything
+// Rules are validated like UpdateAnonRules does (see SkipSchemaValidation)
+func (c *Client) DiffAnonRules(ctx context.Context, rules []AnonRuleInput, opts ...AnonRuleOption) (*AnonRulesDiff, error) {
+	req := struct {
+		Rules []AnonRuleInput `json:"rules"`
+	}{Rules: rules}
+	if req.Rules == nil {
+		req.Rules = []AnonRuleInput{}
+	}
+
+	query := anonRuleQuery(opts)
+	query.Set("dry_run", "true")
+
+	var diff AnonRulesDiff
+	if err := c.do(ctx, http.MethodPut, "/api/anon-rules", query, req, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// DeleteAnonRule deletes an anonymization rule by ID
+func (c *Client) DeleteAnonRule(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/anon-rules/"+pathEscape(id), nil, nil, nil)
+}
+
+// Import formats for ImportAnonRules
+const (
+	ImportFormatDBT  = "dbt"  // dbt schema.yml or manifest.json (column meta "pii"/"anonymize" and the "pii" tag)
+	ImportFormatDBML = "dbml" // DBML column notes (e.g. note: 'pii: fake_email')
+	ImportFormatSQL  = "sql"  // COMMENT ON COLUMN statements (e.g. 'pii: mask')
+)
+
+// ImportAnonRulesRequest generates rules from PII annotations
+type ImportAnonRulesRequest struct {
+	Format  string `json:"format"`
+	Content string `json:"content"`
+	Replace bool   `json:"replace"` // Replace all rules instead of merging by table and column
+	DryRun  bool   `json:"dry_run"` // Return the generated rules without saving them
+}
+
+// AnonRulesImport is the result of ImportAnonRules
+type AnonRulesImport struct {
+	Rules   []AnonRule          `json:"rules"`
+	Skipped []AnonImportSkipped `json:"skipped"`
+	DryRun  bool                `json:"dry_run"`
+}
+
+// AnonImportSkipped is an annotated column no rule was generated for
+type AnonImportSkipped struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Reason string `json:"reason"`
+}
+
+// ImportAnonRules generates anonymization rules from dbt, DBML or SQL comment PII annotations
+func (c *Client) ImportAnonRules(ctx context.Context, req ImportAnonRulesRequest, opts ...AnonRuleOption) (*AnonRulesImport, error) {
+	var result AnonRulesImport
+	if err := c.do(ctx, http.MethodPost, "/api/anon-rules/import", anonRuleQuery(opts), req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PreviewAnonRules dry-runs rules against a restore and returns before/after samples
+func (c *Client) PreviewAnonRules(ctx context.Context, req PreviewAnonRulesRequest) (*AnonPreview, error) {
+	var preview AnonPreview
+	if err := c.do(ctx, http.MethodPost, "/api/anon-rules/preview", nil, req, &preview); err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// ValidateAnonRules checks the stored rules against a restore's schema
+// An empty restoreID uses the latest ready restore
+func (c *Client) ValidateAnonRules(ctx context.Context, restoreID string) (*AnonRulesValidation, error) {
+	var query url.Values
+	if restoreID != "" {
+		query = url.Values{"restore_id": {restoreID}}
+	}
+
+	var validation AnonRulesValidation
+	if err := c.do(ctx, http.MethodGet, "/api/anon-rules/validate", query, nil, &validation); err != nil {
+		return nil, err
+	}
+	return &validation, nil
+}
+
+// PIIScan lists the columns of a restore that look like PII and have no rule yet
+type PIIScan struct {
+	RestoreID      string          `json:"restore_id"`
+	TablesScanned  int             `json:"tables_scanned"`
+	ColumnsScanned int             `json:"columns_scanned"`
+	Suggestions    []PIISuggestion `json:"suggestions"`
+}
+
+// PIISuggestion is a column that looks like PII, with a rule anonymizing it
+type PIISuggestion struct {
+	Table         string   `json:"table"`
+	Column        string   `json:"column"`
+	DataType      string   `json:"data_type"`
+	Kind          string   `json:"kind"`       // email, phone, ssn, credit_card, name, address
+	Confidence    string   `json:"confidence"` // high (sampled values match) or medium (only the column name does)
+	SampledValues int      `json:"sampled_values"`
+	MatchedValues int      `json:"matched_values"`
+	Rule          AnonRule `json:"rule"`
+}
+
+// Input returns the suggested rule, to accept it with CreateAnonRule or UpdateAnonRules
+func (s PIISuggestion) Input() AnonRuleInput {
+	options := s.Rule.FunctionOptions
+	return AnonRuleInput{
+		Table:           s.Rule.Table,
+		Column:          s.Rule.Column,
+		Type:            s.Rule.ColumnType,
+		Function:        s.Rule.Function,
+		FunctionOptions: &options,
+	}
+}
+
+// ScanPII samples a restore's text columns and suggests rules for those that look like PII
+// sampleSize is the number of rows sampled per table (0 = server default)
+func (c *Client) ScanPII(ctx context.Context, restoreID string, sampleSize int) (*PIIScan, error) {
+	req := struct {
+		SampleSize int `json:"sample_size,omitempty"`
+	}{SampleSize: sampleSize}
+
+	var scan PIIScan
+	if err := c.do(ctx, http.MethodPost, "/api/restores/"+pathEscape(restoreID)+"/pii-scan", nil, req, &scan); err != nil {
+		return nil, err
+	}
+	return &scan, nil
+}
+
+func anonRuleQuery(opts []AnonRuleOption) url.Values {
+	query := url.Values{}
+	for _, opt := range opts {
+		opt(query)
+	}
+	return query
+}
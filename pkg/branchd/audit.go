@@ -0,0 +1,113 @@
+package branchd
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AuditEvent records a state-changing API request
+type AuditEvent struct {
+	ID           string            `json:"id"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UserID       string            `json:"user_id"`
+	UserEmail    string            `json:"user_email"`
+	Action       string            `json:"action"`
+	ResourceType string            `json:"resource_type"`
+	ResourceID   string            `json:"resource_id"`
+	Method       string            `json:"method"`
+	Path         string            `json:"path"`
+	StatusCode   int               `json:"status_code"`
+	Success      bool              `json:"success"`
+	ClientIP     string            `json:"client_ip"`
+	UserAgent    string            `json:"user_agent"`
+	Details      map[string]string `json:"details,omitempty"`
+}
+
+// AuditFilter narrows ListAuditEvents (zero values are ignored)
+type AuditFilter struct {
+	Action       string // e.g. "branch.created"
+	ResourceType string // branch, restore, anon_rule, config, user, system
+	ResourceID   string
+	UserID       string
+	Success      *bool
+	Since        time.Time
+	Until        time.Time
+	Limit        int    // Server default 100, max 1000
+	Before       string // ID of the last event of the previous page
+}
+
+// ListAuditEvents returns a page of audit events matching filter, newest first (admin only)
+func (c *Client) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"action":        filter.Action,
+		"resource_type": filter.ResourceType,
+		"resource_id":   filter.ResourceID,
+		"user_id":       filter.UserID,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if filter.Success != nil {
+		query.Set("success", strconv.FormatBool(*filter.Success))
+	}
+	if !filter.Since.IsZero() {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		query.Set("until", filter.Until.Format(time.RFC3339))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.Before != "" {
+		query.Set("before", filter.Before)
+	}
+
+	var events []AuditEvent
+	if err := c.do(ctx, http.MethodGet, "/api/audit", query, nil, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// auditPageSize is the page size of AuditEvents when the filter sets no limit
+const auditPageSize = 1000
+
+// AuditEvents iterates over all audit events matching filter, newest first, fetching them a page
+// (filter.Limit events) at a time (admin only). Iteration stops at the first error.
+//
+//	for event, err := range client.AuditEvents(ctx, branchd.AuditFilter{Action: "branch.deleted"}) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(event.CreatedAt, event.ResourceID)
+//	}
+func (c *Client) AuditEvents(ctx context.Context, filter AuditFilter) iter.Seq2[AuditEvent, error] {
+	if filter.Limit <= 0 {
+		filter.Limit = auditPageSize
+	}
+	return func(yield func(AuditEvent, error) bool) {
+		for {
+			page, err := c.ListAuditEvents(ctx, filter)
+			if err != nil {
+				yield(AuditEvent{}, err)
+				return
+			}
+			for _, event := range page {
+				if !yield(event, nil) {
+					return
+				}
+			}
+			if len(page) < filter.Limit {
+				return
+			}
+			filter.Before = page[len(page)-1].ID
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// User is a Branchd user account
+type User struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	IsAdmin   bool      `json:"is_admin"`
+	CreatedAt time.Time `json:"created_at"`
+
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+	SSOLinked        bool `json:"sso_linked"` // The user can log in with SSO
+
+	TwoFactorDeadline *time.Time `json:"two_factor_deadline,omitempty"` // Admin routes require two-factor authentication after this
+}
+
+// LoginResponse is returned by Login and Setup
+type LoginResponse struct {
+	Token string `json:"token"`
+	User  User   `json:"user"`
+}
+
+// SetupRequest creates the first admin account on a fresh server
+type SetupRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+// CreateUserRequest creates a user (admin only)
+type CreateUserRequest struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+// Setup creates the first admin account and authenticates the client as that user
+func (c *Client) Setup(ctx context.Context, req SetupRequest) (*LoginResponse, error) {
+	var resp LoginResponse
+	if err := c.do(ctx, http.MethodPost, "/api/setup", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	c.SetToken(resp.Token)
+	return &resp, nil
+}
+
+// TwoFactorSetup is the secret to enroll in an authenticator app
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`      // Base32, for manual entry
+	OTPAuthURL string `json:"otpauth_url"` // otpauth:// URI, usually rendered as a QR code
+}
+
+// Login authenticates with email and password and uses the returned token for subsequent requests
+// Users with two-factor authentication must use LoginWithTOTP (see IsTwoFactorRequired)
+func (c *Client) Login(ctx context.Context, email, password string) (*LoginResponse, error) {
+	return c.LoginWithTOTP(ctx, email, password, "")
+}
+
+// LoginWithTOTP authenticates with email, password and a code of the user's authenticator app
+func (c *Client) LoginWithTOTP(ctx context.Context, email, password, totpCode string) (*LoginResponse, error) {
+	req := struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		TOTPCode string `json:"totp_code,omitempty"`
+	}{Email: email, Password: password, TOTPCode: totpCode}
+
+	var resp LoginResponse
+	if err := c.do(ctx, http.MethodPost, "/api/auth/login", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	c.SetToken(resp.Token)
+	return &resp, nil
+}
+
+// SetupTwoFactor generates a TOTP secret for the authenticated user
+// Two-factor authentication is enabled once VerifyTwoFactor accepts a code of the secret
+func (c *Client) SetupTwoFactor(ctx context.Context) (*TwoFactorSetup, error) {
+	var setup TwoFactorSetup
+	if err := c.do(ctx, http.MethodPost, "/api/auth/2fa/setup", nil, nil, &setup); err != nil {
+		return nil, err
+	}
+	return &setup, nil
+}
+
+// VerifyTwoFactor verifies a code of the authenticated user's authenticator app and uses the returned token,
+// which is allowed on routes requiring two-factor authentication (user management, server updates)
+func (c *Client) VerifyTwoFactor(ctx context.Context, code string) (*LoginResponse, error) {
+	req := struct {
+		Code string `json:"code"`
+	}{Code: code}
+
+	var resp LoginResponse
+	if err := c.do(ctx, http.MethodPost, "/api/auth/2fa/verify", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	c.SetToken(resp.Token)
+	return &resp, nil
+}
+
+// Me returns the authenticated user
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodGet, "/api/auth/me", nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers returns all users (admin only)
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	var users []User
+	if err := c.do(ctx, http.MethodGet, "/api/users", nil, nil, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// CreateUser creates a user (admin only)
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	var resp struct {
+		User User `json:"user"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/users", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.User, nil
+}
+
+// DeleteUser deletes a user by ID (admin only)
+func (c *Client) DeleteUser(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/users/"+pathEscape(id), nil, nil, nil)
+}
+
+// ResetUserTwoFactor removes a user's authenticator, e.g. after the device was lost (admin only)
+func (c *Client) ResetUserTwoFactor(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/users/"+pathEscape(id)+"/2fa", nil, nil, nil)
+}
@@ -0,0 +1,75 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// BranchTemplate is a named preset of branch options, selected with CreateBranchRequest.Template
+type BranchTemplate struct {
+	ID             string               `json:"id"`
+	CreatedAt      time.Time            `json:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+	Name           string               `json:"name"`
+	Description    string               `json:"description"`
+	ResourceLimits BranchResourceLimits `json:"resource_limits"` // Used when the create request has no resources
+	PostgresqlConf string               `json:"postgresql_conf"` // Applied after the configured branch settings
+	PostBranchSQL  string               `json:"post_branch_sql"` // Run between the configured and the request's SQL
+	TTLHours       int                  `json:"ttl_hours"`       // Branches are deleted this long after creation, 0 = kept
+	HBARules       []BranchHBARule      `json:"hba_rules"`       // Used when the create request has none
+}
+
+// BranchTemplateInput creates a branch template
+type BranchTemplateInput struct {
+	Name           string                `json:"name"`
+	Description    string                `json:"description,omitempty"`
+	Resources      *BranchResourceLimits `json:"resources,omitempty"`
+	PostgresqlConf string                `json:"postgresql_conf,omitempty"`
+	PostBranchSQL  string                `json:"post_branch_sql,omitempty"`
+	TTLHours       int                   `json:"ttl_hours,omitempty"`
+	HBARules       []BranchHBARule       `json:"hba_rules,omitempty"`
+}
+
+// UpdateBranchTemplateRequest updates the non-nil branch template fields
+type UpdateBranchTemplateRequest struct {
+	Name           *string               `json:"name,omitempty"`
+	Description    *string               `json:"description,omitempty"`
+	Resources      *BranchResourceLimits `json:"resources,omitempty"`
+	PostgresqlConf *string               `json:"postgresql_conf,omitempty"`
+	PostBranchSQL  *string               `json:"post_branch_sql,omitempty"`
+	TTLHours       *int                  `json:"ttl_hours,omitempty"`
+	HBARules       *[]BranchHBARule      `json:"hba_rules,omitempty"`
+}
+
+// ListBranchTemplates returns all branch templates
+func (c *Client) ListBranchTemplates(ctx context.Context) ([]BranchTemplate, error) {
+	var templates []BranchTemplate
+	if err := c.do(ctx, http.MethodGet, "/api/branch-templates", nil, nil, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// CreateBranchTemplate creates a branch template (admin only)
+func (c *Client) CreateBranchTemplate(ctx context.Context, input BranchTemplateInput) (*BranchTemplate, error) {
+	var template BranchTemplate
+	if err := c.do(ctx, http.MethodPost, "/api/branch-templates", nil, input, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// UpdateBranchTemplate updates a branch template, existing branches keep their options (admin only)
+func (c *Client) UpdateBranchTemplate(ctx context.Context, id string, req UpdateBranchTemplateRequest) (*BranchTemplate, error) {
+	var template BranchTemplate
+	if err := c.do(ctx, http.MethodPatch, "/api/branch-templates/"+pathEscape(id), nil, req, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// DeleteBranchTemplate deletes a branch template (admin only)
+func (c *Client) DeleteBranchTemplate(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/branch-templates/"+pathEscape(id), nil, nil, nil)
+}
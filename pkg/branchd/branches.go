@@ -0,0 +1,458 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Branch is a database branch as returned by ListBranches
+type Branch struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	CreatedAt     string `json:"created_at"`
+	CreatedBy     string `json:"created_by"`
+	RestoreID     string `json:"restore_id"`
+	RestoreName   string `json:"restore_name"`
+	Port          int    `json:"port"`
+	ConnectionURL string `json:"connection_url"`
+	Suspended     bool   `json:"suspended"` // Stopped while idle, resumed on the next connection or ResumeBranch
+
+	// Client activity sampled every few minutes by the server, as of ActivitySampledAt (nil = not sampled yet)
+	ActiveConnections int        `json:"active_connections"`
+	TransactionCount  int64      `json:"transaction_count"` // Since the branch's PostgreSQL started
+	LastActivityAt    *time.Time `json:"last_activity_at"`  // Last connection or transaction seen (nil = never)
+	ActivitySampledAt *time.Time `json:"activity_sampled_at"`
+
+	DiskUsedBytes       int64 `json:"disk_used_bytes"`       // Space the branch wrote (data shared with the restore is not counted)
+	DiskReferencedBytes int64 `json:"disk_referenced_bytes"` // Data the branch holds, what the quota limits
+	DiskQuotaBytes      int64 `json:"disk_quota_bytes"`      // 0 = no quota
+
+	// ok, near_limit or exceeded (writes fail), empty without quota
+	DiskQuotaState string `json:"disk_quota_state"`
+
+	// Short DNS-safe identifier, accepted wherever a branch ID is
+	ShortID string `json:"short_id"`
+
+	// running, stopped or crashed as of LastCheckedAt (empty until the worker's first check)
+	Status        string     `json:"status"`
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+
+	// Failed automatic restarts since the branch crashed (0 while it runs)
+	RecoveryAttempts int `json:"recovery_attempts,omitempty"`
+
+	// BranchTemplate the branch was created from, and when its TTL deletes the branch (nil = kept)
+	Template  string     `json:"template,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// GitHub pull request ("<owner>/<repository>#<number>") the branch was created for, deleted when it's closed
+	PullRequest string `json:"pull_request,omitempty"`
+}
+
+// BranchResourceLimits caps the resources a branch can use (zero values mean unlimited)
+type BranchResourceLimits struct {
+	CPUCores       float64 `json:"cpu_cores,omitempty"`
+	MemoryMB       int     `json:"memory_mb,omitempty"`
+	MaxConnections int     `json:"max_connections,omitempty"`
+
+	DiskQuotaGB       int `json:"disk_quota_gb,omitempty"`       // ZFS refquota, data shared with the restore included
+	DiskReservationGB int `json:"disk_reservation_gb,omitempty"` // ZFS space guaranteed to the branch
+}
+
+// BranchHBARule is a pg_hba.conf rule of a branch's user, matched in order
+type BranchHBARule struct {
+	CIDR   string `json:"cidr"`             // e.g. "10.0.0.0/8"
+	Method string `json:"method,omitempty"` // scram-sha-256 (default), md5, cert or reject
+	SSL    string `json:"ssl,omitempty"`    // require (default), optional or disable
+}
+
+// BranchHBARules lists the pg_hba.conf rules of a branch's user
+type BranchHBARules struct {
+	BranchID string          `json:"branch_id"`
+	Rules    []BranchHBARule `json:"rules"`
+	Default  bool            `json:"default"` // No rules of its own, connections from anywhere over SSL are allowed
+}
+
+// BranchFirewall lists the networks a branch's port is open to
+type BranchFirewall struct {
+	BranchID     string   `json:"branch_id"`
+	AllowedCIDRs []string `json:"allowed_cidrs"` // The branch's own allowlist, empty = the config's branch_allowed_cidrs
+	Effective    []string `json:"effective"`     // What the firewall allows, empty = anywhere
+}
+
+// CreateBranchRequest creates a branch from the latest ready restore
+type CreateBranchRequest struct {
+	Name      string                `json:"name"` // Normalized by the server, see NormalizeBranchName
+	Resources *BranchResourceLimits `json:"resources,omitempty"`
+	RestoreID string                `json:"restore_id,omitempty"` // Branch from this restore instead (e.g. a promoted restore)
+
+	// pg_hba.conf rules of the branch's user, empty = the template's or connections from anywhere over SSL
+	HBARules []BranchHBARule `json:"hba_rules,omitempty"`
+
+	// Networks the branch's port is open to, within the config's branch_allowed_cidrs, empty = the config's
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
+
+	// SQL run in the new branch after the configured post-branch SQL, the branch isn't created if it fails
+	PostBranchSQL string `json:"post_branch_sql,omitempty"`
+
+	// BranchTemplate name, its options apply where the request sets none (e.g. "ci-small")
+	Template string `json:"template,omitempty"`
+
+	// Snippet formats to render (psql, rails, prisma, django, jdbc), empty = all
+	// Sent as a query parameter
+	Snippets []string `json:"-"`
+}
+
+// CreateBranchResponse contains the connection details of a created branch
+type CreateBranchResponse struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"` // Normalized branch name, see NormalizeBranchName
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Database string `json:"database"`
+
+	// Snippets holds rendered connection snippets keyed by format (psql, rails, prisma, django, jdbc)
+	Snippets map[string]string `json:"snippets,omitempty"`
+
+	// Short DNS-safe identifier, accepted wherever a branch ID is
+	ShortID string `json:"short_id"`
+}
+
+// BranchUsage is the ZFS space use of a branch
+type BranchUsage struct {
+	BranchID         string  `json:"branch_id"`
+	BranchName       string  `json:"branch_name"`
+	ReferencedBytes  int64   `json:"referenced_bytes"` // Including data shared with the restore
+	UsedBytes        int64   `json:"used_bytes"`       // Space the branch wrote, freed when it's deleted
+	LogicalUsedBytes int64   `json:"logical_used_bytes"`
+	CompressRatio    float64 `json:"compress_ratio"`
+	QuotaBytes       int64   `json:"quota_bytes"` // 0 = no quota
+	ReservationBytes int64   `json:"reservation_bytes"`
+	WALUsedBytes     int64   `json:"wal_used_bytes"`
+	QuotaState       string  `json:"quota_state"` // ok, near_limit or exceeded, empty without quota
+}
+
+// SchemaChange is a schema object that differs between a branch and its restore
+type SchemaChange struct {
+	Kind   string `json:"kind"`   // table, column, index, constraint, trigger, view or function
+	Name   string `json:"name"`   // Schema-qualified, columns, constraints and triggers prefixed with their table
+	Change string `json:"change"` // added, removed or changed on the branch
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// RowCountChange is a table whose row count differs between a branch and its restore
+type RowCountChange struct {
+	Table       string `json:"table"`
+	RestoreRows *int64 `json:"restore_rows"` // nil if the branch added the table
+	BranchRows  *int64 `json:"branch_rows"`  // nil if the branch dropped the table
+	Delta       int64  `json:"delta"`
+	Estimated   bool   `json:"estimated"` // Planner estimate (tables of over a million rows aren't counted)
+}
+
+// BranchDiff compares a branch against the current state of its restore
+type BranchDiff struct {
+	BranchID       string           `json:"branch_id"`
+	BranchName     string           `json:"branch_name"`
+	RestoreID      string           `json:"restore_id"`
+	RestoreName    string           `json:"restore_name"`
+	SchemaChanges  []SchemaChange   `json:"schema_changes"`
+	RowCounts      []RowCountChange `json:"row_counts"`
+	TablesCompared int              `json:"tables_compared"` // Tables in both, unchanged ones aren't listed in RowCounts
+	ComparedAt     time.Time        `json:"compared_at"`
+}
+
+// BranchCreator is the number of branches a user created from a restore
+type BranchCreator struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Count  int    `json:"count"`
+}
+
+// RestoreFanOut summarizes the branches created from one restore
+type RestoreFanOut struct {
+	RestoreID       string          `json:"restore_id"`
+	RestoreName     string          `json:"restore_name"`
+	RestoreDeleted  bool            `json:"restore_deleted"`
+	BranchesCreated int             `json:"branches_created"`
+	ActiveBranches  int             `json:"active_branches"`
+	Creators        []BranchCreator `json:"creators"`
+	FirstBranchAt   *string         `json:"first_branch_at"`
+	LastBranchAt    *string         `json:"last_branch_at"`
+}
+
+// BranchStats aggregates branch creations over all restores, newest restore first
+type BranchStats struct {
+	Restores                  []RestoreFanOut `json:"restores"`
+	TotalBranchesCreated      int             `json:"total_branches_created"`
+	RestoresNeverBranched     int             `json:"restores_never_branched"`
+	AverageBranchesPerRestore float64         `json:"average_branches_per_restore"`
+}
+
+// BranchActivity is when a branch was last connected to
+type BranchActivity struct {
+	BranchID       string  `json:"branch_id"`
+	BranchName     string  `json:"branch_name"`
+	RestoreID      string  `json:"restore_id"`
+	CreatedByID    string  `json:"created_by_id"`
+	CreatedByEmail string  `json:"created_by_email"`
+	CreatedAt      string  `json:"created_at"`
+	LastActivityAt *string `json:"last_activity_at"` // nil = never connected to
+	IdleDays       int     `json:"idle_days"`
+	Suspended      bool    `json:"suspended"`
+	Stale          bool    `json:"stale"`
+}
+
+// UserActivity is how much a user uses branches
+type UserActivity struct {
+	UserID              string  `json:"user_id"`
+	Email               string  `json:"email"`
+	Branches            int     `json:"branches"`
+	StaleBranches       int     `json:"stale_branches"`
+	BranchesCreated     int     `json:"branches_created"` // In the report's window
+	LastBranchCreatedAt *string `json:"last_branch_created_at"`
+	LastActivityAt      *string `json:"last_activity_at"`
+}
+
+// BranchUsageReport shows which branches are still used and who uses branches
+type BranchUsageReport struct {
+	GeneratedAt   string           `json:"generated_at"`
+	StaleDays     int              `json:"stale_days"`
+	WindowDays    int              `json:"window_days"`
+	Branches      []BranchActivity `json:"branches"` // Least recently used first
+	StaleBranches []BranchActivity `json:"stale_branches"`
+	Users         []UserActivity   `json:"users"`   // Most recently active first
+	Heatmap       [7][24]int       `json:"heatmap"` // Branch creations by UTC weekday (0 = Sunday) and hour
+}
+
+// ListBranches returns all branches
+func (c *Client) ListBranches(ctx context.Context) ([]Branch, error) {
+	var branches []Branch
+	if err := c.do(ctx, http.MethodGet, "/api/branches", nil, nil, &branches); err != nil {
+		return nil, err
+	}
+	return branches, nil
+}
+
+// FindBranch returns the branch with the given ID, name or short ID, or nil if it doesn't exist
+// Names that only differ in case match last, the server stores names in lowercase
+func (c *Client) FindBranch(ctx context.Context, ref string) (*Branch, error) {
+	branches, err := c.ListBranches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if branch := MatchBranch(branches, ref); branch != nil {
+		return branch, nil
+	}
+	for i := range branches {
+		if ref != "" && strings.EqualFold(branches[i].Name, ref) {
+			return &branches[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// MatchBranch returns the branch whose ID, name or short ID is ref, checked in that order
+// like the server resolves branch references (see models.FindBranch), or nil if none matches
+func MatchBranch(branches []Branch, ref string) *Branch {
+	if ref == "" {
+		return nil
+	}
+	for i := range branches {
+		if branches[i].ID == ref {
+			return &branches[i]
+		}
+	}
+	for i := range branches {
+		if branches[i].Name == ref {
+			return &branches[i]
+		}
+	}
+	for i := range branches {
+		if branches[i].ShortID == ref {
+			return &branches[i]
+		}
+	}
+	return nil
+}
+
+// CreateBranch creates a branch (or returns the existing branch with the same name)
+func (c *Client) CreateBranch(ctx context.Context, req CreateBranchRequest) (*CreateBranchResponse, error) {
+	var query url.Values
+	if len(req.Snippets) > 0 {
+		query = url.Values{"snippets": {strings.Join(req.Snippets, ",")}}
+	}
+
+	var resp CreateBranchResponse
+	if err := c.do(ctx, http.MethodPost, "/api/branches", query, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteBranch deletes a branch by ID
+func (c *Client) DeleteBranch(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/branches/"+pathEscape(id), nil, nil, nil)
+}
+
+// SuspendBranch stops a branch's PostgreSQL until its next connection or ResumeBranch
+func (c *Client) SuspendBranch(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/branches/"+pathEscape(id)+"/suspend", nil, nil, nil)
+}
+
+// ResumeBranch starts a suspended branch and waits until it accepts connections
+func (c *Client) ResumeBranch(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/branches/"+pathEscape(id)+"/resume", nil, nil, nil)
+}
+
+// ReportBranchConnectionFailure tells the server a client couldn't connect to a branch
+// The branch is checked right away and restarted if it crashed, returns its status afterwards
+func (c *Client) ReportBranchConnectionFailure(ctx context.Context, id string) (string, error) {
+	var resp struct {
+		Status string `json:"status"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/branches/"+pathEscape(id)+"/connection-failure", nil, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Status, nil
+}
+
+// PromoteBranch starts turning a branch into a restore other branches can be created from
+// The promotion runs in the background, use WaitForRestore with the returned restore's ID
+// Once ready the branch is replaced by the restore and its credentials stop working
+func (c *Client) PromoteBranch(ctx context.Context, id string) (*Restore, error) {
+	var restore Restore
+	if err := c.do(ctx, http.MethodPost, "/api/branches/"+pathEscape(id)+"/promote", nil, nil, &restore); err != nil {
+		return nil, err
+	}
+	return &restore, nil
+}
+
+// SetBranchDiskQuota changes the ZFS refquota and reservation of a branch in GB, 0 = none (admin only)
+func (c *Client) SetBranchDiskQuota(ctx context.Context, id string, quotaGB, reservationGB int) error {
+	req := struct {
+		DiskQuotaGB       int `json:"disk_quota_gb"`
+		DiskReservationGB int `json:"disk_reservation_gb"`
+	}{DiskQuotaGB: quotaGB, DiskReservationGB: reservationGB}
+	return c.do(ctx, http.MethodPut, "/api/branches/"+pathEscape(id)+"/disk-quota", nil, req, nil)
+}
+
+// GetBranchHBARules returns the pg_hba.conf rules of a branch's user
+func (c *Client) GetBranchHBARules(ctx context.Context, id string) (*BranchHBARules, error) {
+	var rules BranchHBARules
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(id)+"/hba", nil, nil, &rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// SetBranchHBARules replaces the pg_hba.conf rules of a branch's user and reloads the branch, empty = the defaults (admin only)
+func (c *Client) SetBranchHBARules(ctx context.Context, id string, rules []BranchHBARule) (*BranchHBARules, error) {
+	req := struct {
+		Rules []BranchHBARule `json:"rules"`
+	}{Rules: rules}
+	var updated BranchHBARules
+	if err := c.do(ctx, http.MethodPut, "/api/branches/"+pathEscape(id)+"/hba", nil, req, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// GetBranchFirewall returns the networks a branch's port is open to
+func (c *Client) GetBranchFirewall(ctx context.Context, id string) (*BranchFirewall, error) {
+	var firewall BranchFirewall
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(id)+"/firewall", nil, nil, &firewall); err != nil {
+		return nil, err
+	}
+	return &firewall, nil
+}
+
+// SetBranchFirewall replaces the networks a branch's port is open to, empty = the config's allowlist (admin only)
+func (c *Client) SetBranchFirewall(ctx context.Context, id string, cidrs []string) (*BranchFirewall, error) {
+	req := struct {
+		AllowedCIDRs []string `json:"allowed_cidrs"`
+	}{AllowedCIDRs: cidrs}
+	var updated BranchFirewall
+	if err := c.do(ctx, http.MethodPut, "/api/branches/"+pathEscape(id)+"/firewall", nil, req, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// GetBranchUsage returns the disk usage of a branch
+func (c *Client) GetBranchUsage(ctx context.Context, id string) (*BranchUsage, error) {
+	var usage BranchUsage
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(id)+"/usage", nil, nil, &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// DiffBranch compares the schema and per-table row counts of a branch against its restore
+func (c *Client) DiffBranch(ctx context.Context, id string) (*BranchDiff, error) {
+	var diff BranchDiff
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(id)+"/diff", nil, nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// BranchLogs contains the tail of a branch's log file, e.g. the output of its post-branch SQL
+type BranchLogs = RestoreLogs
+
+// GetBranchLogs returns the last lines of a branch's log (0 = server default of 50, max 1000)
+func (c *Client) GetBranchLogs(ctx context.Context, id string, lines int) (*BranchLogs, error) {
+	var query url.Values
+	if lines > 0 {
+		query = url.Values{"lines": {strconv.Itoa(lines)}}
+	}
+
+	var logs BranchLogs
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(id)+"/logs", query, nil, &logs); err != nil {
+		return nil, err
+	}
+	return &logs, nil
+}
+
+// GetBranchStats returns how many branches were created from each restore and by whom
+func (c *Client) GetBranchStats(ctx context.Context) (*BranchStats, error) {
+	var stats BranchStats
+	if err := c.do(ctx, http.MethodGet, "/api/branch-stats", nil, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetRestoreBranchStats returns the branches created from one restore
+func (c *Client) GetRestoreBranchStats(ctx context.Context, restoreID string) (*RestoreFanOut, error) {
+	var fanOut RestoreFanOut
+	if err := c.do(ctx, http.MethodGet, "/api/restores/"+pathEscape(restoreID)+"/branch-stats", nil, nil, &fanOut); err != nil {
+		return nil, err
+	}
+	return &fanOut, nil
+}
+
+// GetBranchUsageReport returns the branch usage report, branches without connections in staleDays are stale
+// (0 = server default of 14)
+func (c *Client) GetBranchUsageReport(ctx context.Context, staleDays int) (*BranchUsageReport, error) {
+	var query url.Values
+	if staleDays > 0 {
+		query = url.Values{"stale_days": {strconv.Itoa(staleDays)}}
+	}
+
+	var report BranchUsageReport
+	if err := c.do(ctx, http.MethodGet, "/api/reports/branch-usage", query, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// pathEscape escapes a single path segment
+func pathEscape(segment string) string {
+	return url.PathEscape(segment)
+}
@@ -0,0 +1,289 @@
+// Package branchd is a Go client for the Branchd API.
+//
+// It covers every endpoint exposed by the API server and is used by the
+// branchd CLI. All methods take a context and return typed responses;
+// non-2xx responses are returned as *APIError. Idempotent requests are
+// retried on network errors and 429/502/503/504 responses, waiting at
+// least as long as the Retry-After header asks. List methods return
+// complete collections, except for the audit log, which is paginated:
+// ListAuditEvents returns one page and AuditEvents iterates over all pages.
+//
+//	client := branchd.New("https://branchd.example.com", branchd.WithToken(token))
+//	branch, err := client.CreateBranch(ctx, branchd.CreateBranchRequest{Name: "feature-x"})
+package branchd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default client settings
+const (
+	DefaultTimeout    = 30 * time.Second
+	DefaultMaxRetries = 3
+	DefaultRetryWait  = 500 * time.Millisecond
+)
+
+// Client is a Branchd API client
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	maxRetries int
+	retryWait  time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithToken sets the JWT used to authenticate requests (see Client.Login)
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient replaces the underlying HTTP client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithInsecureSkipVerify disables TLS certificate verification
+// Servers without a domain serve a self-signed certificate
+func WithInsecureSkipVerify() Option {
+	return func(c *Client) {
+		c.httpClient = &http.Client{
+			Timeout: c.httpClient.Timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
+			},
+		}
+	}
+}
+
+// WithRetries sets how often idempotent requests are retried on network errors
+// and 429/502/503/504 responses, and the initial wait between attempts (doubled each retry)
+// maxRetries 0 disables retries
+func WithRetries(maxRetries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryWait = wait
+	}
+}
+
+// New creates a client for the server at baseURL (e.g. "https://10.0.0.5")
+// A bare host is treated as https://host
+func New(baseURL string, opts ...Option) *Client {
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		maxRetries: DefaultMaxRetries,
+		retryWait:  DefaultRetryWait,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetToken sets the JWT used to authenticate subsequent requests
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// Token returns the JWT the client authenticates with
+func (c *Client) Token() string {
+	return c.token
+}
+
+// APIError is returned for non-2xx responses
+type APIError struct {
+	StatusCode int
+	Message    string          // "error" field of the response body
+	Details    string          // "details" field of the response body, if any
+	Code       string          // "code" field of the response body, e.g. "queue_unavailable"
+	Body       json.RawMessage // Raw response body (e.g. for structured validation errors)
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = strings.TrimSpace(string(e.Body))
+	}
+	if e.Details != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Details)
+	}
+	return fmt.Sprintf("branchd API error (status %d): %s", e.StatusCode, msg)
+}
+
+// IsNotFound reports whether err is an APIError with status 404
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsQueueUnavailable reports whether err is an APIError because Redis was unavailable, the request can be retried
+// once it's back (see Readiness)
+func IsQueueUnavailable(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == "queue_unavailable"
+}
+
+// IsTwoFactorRequired reports whether err is an APIError asking for a two-factor code
+// (login of a user with two-factor authentication, or a route requiring it)
+func IsTwoFactorRequired(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	var body struct {
+		TwoFactorRequired bool `json:"two_factor_required"`
+	}
+	return json.Unmarshal(apiErr.Body, &body) == nil && body.TwoFactorRequired
+}
+
+// do sends a request and decodes the JSON response into out (if non-nil)
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	retries := 0
+	if isIdempotent(method) {
+		retries = c.maxRetries
+	}
+	wait := c.retryWait
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, endpoint, payload)
+		if (err == nil && !isRetryableStatus(resp.StatusCode)) || attempt >= retries {
+			if err != nil {
+				return fmt.Errorf("failed to send request: %w", err)
+			}
+			return decodeResponse(resp, out)
+		}
+		delay := wait
+		if resp != nil {
+			// Rate limited responses say when the server accepts requests again
+			if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > delay {
+				delay = retryAfter
+			}
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		wait *= 2
+	}
+}
+
+// send performs a single HTTP request
+func (c *Client) send(ctx context.Context, method, endpoint string, payload []byte) (*http.Response, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// decodeResponse turns non-2xx responses into APIError and decodes successful ones into out
+func decodeResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Body: respBody}
+		var errBody struct {
+			Error   string `json:"error"`
+			Details string `json:"details"`
+			Code    string `json:"code"`
+		}
+		if json.Unmarshal(respBody, &errBody) == nil {
+			apiErr.Message = errBody.Error
+			apiErr.Details = errBody.Details
+			apiErr.Code = errBody.Code
+		}
+		return apiErr
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header in seconds (0 if missing or an HTTP date)
+func parseRetryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
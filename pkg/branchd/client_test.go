@@ -0,0 +1,363 @@
+package branchd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientAuthAndDecode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/auth/login":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"token": "jwt-token",
+				"user":  map[string]interface{}{"id": "user-1", "email": "a@b.com", "is_admin": true},
+			})
+		case "/api/branches":
+			if got := r.Header.Get("Authorization"); got != "Bearer jwt-token" {
+				t.Errorf("Authorization = %q, want %q", got, "Bearer jwt-token")
+			}
+			if r.Method == http.MethodPost {
+				if got := r.URL.Query().Get("snippets"); got != "psql,prisma" {
+					t.Errorf("snippets = %q, want %q", got, "psql,prisma")
+				}
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(map[string]interface{}{"id": "branch-1", "port": 6001})
+				return
+			}
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"id": "branch-1", "name": "Feature-X", "short_id": "k3m9x2ab"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := New(server.URL)
+
+	login, err := client.Login(ctx, "a@b.com", "secret")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if login.User.ID != "user-1" || !login.User.IsAdmin || client.Token() != "jwt-token" {
+		t.Fatalf("Login() = %+v, token %q", login, client.Token())
+	}
+
+	created, err := client.CreateBranch(ctx, CreateBranchRequest{Name: "feature-x", Snippets: []string{"psql", "prisma"}})
+	if err != nil {
+		t.Fatalf("CreateBranch() error = %v", err)
+	}
+	if created.ID != "branch-1" || created.Port != 6001 {
+		t.Errorf("CreateBranch() = %+v", created)
+	}
+
+	branch, err := client.FindBranch(ctx, "feature-x")
+	if err != nil {
+		t.Fatalf("FindBranch() error = %v", err)
+	}
+	if branch == nil || branch.ID != "branch-1" {
+		t.Errorf("FindBranch() = %+v, want branch-1", branch)
+	}
+
+	branch, err = client.FindBranch(ctx, "k3m9x2ab")
+	if err != nil {
+		t.Fatalf("FindBranch() error = %v", err)
+	}
+	if branch == nil || branch.ID != "branch-1" {
+		t.Errorf("FindBranch() by short ID = %+v, want branch-1", branch)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/restores/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Restore not found"}`))
+		case "/api/anon-rules":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"error":"Anonymization rules do not match the database schema","validation_errors":[{"index":0,"table":"users","column":"email","code":"missing_column"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := New(server.URL)
+
+	_, err := client.GetRestore(ctx, "missing")
+	if !IsNotFound(err) {
+		t.Fatalf("GetRestore() error = %v, want not found", err)
+	}
+	if apiErr := err.(*APIError); apiErr.Message != "Restore not found" {
+		t.Errorf("Message = %q, want %q", apiErr.Message, "Restore not found")
+	}
+
+	_, err = client.UpdateAnonRules(ctx, []AnonRuleInput{{Table: "users", Column: "email", Function: "fake_email"}})
+	validationErrors := ValidationErrors(err)
+	if len(validationErrors) != 1 || validationErrors[0].Code != "missing_column" {
+		t.Errorf("ValidationErrors() = %+v, want one missing_column error", validationErrors)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	attempts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts[r.Method]++
+		if attempts[r.Method] < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := New(server.URL, WithRetries(3, time.Millisecond))
+
+	if _, err := client.ListBranches(ctx); err != nil {
+		t.Fatalf("ListBranches() error = %v", err)
+	}
+	if attempts[http.MethodGet] != 3 {
+		t.Errorf("GET attempts = %d, want 3", attempts[http.MethodGet])
+	}
+
+	// POST is not idempotent and must not be retried
+	if _, err := client.TriggerRestore(ctx); err == nil {
+		t.Fatal("TriggerRestore() error = nil, want 503")
+	}
+	if attempts[http.MethodPost] != 1 {
+		t.Errorf("POST attempts = %d, want 1", attempts[http.MethodPost])
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"0", 0},
+		{"-1", 0},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestDecommissionPartialResult(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if r.URL.Path != "/api/system/decommission/task-1" {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": "Decommission not found"})
+				return
+			}
+			polls++
+			if polls == 1 {
+				json.NewEncoder(w).Encode(map[string]interface{}{"id": "task-1", "status": "running"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":     "task-1",
+				"status": "completed",
+				"result": map[string]interface{}{
+					"branches_deleted": []string{"feature-x"},
+					"errors":           []string{"delete restore restore_1: busy"},
+					"audit_events":     []map[string]interface{}{{"action": "system.decommissioned"}},
+				},
+			})
+			return
+		}
+
+		var req struct {
+			ConfirmationToken string `json:"confirmation_token"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.ConfirmationToken != "confirm-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "Invalid or expired confirmation token"})
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "task-1", "status": "pending"})
+	}))
+	defer server.Close()
+
+	client := New(server.URL, WithRetries(0, 0))
+
+	status, err := client.StartDecommission(context.Background(), "confirm-1")
+	if err != nil || status.ID != "task-1" {
+		t.Fatalf("StartDecommission() = %+v, %v", status, err)
+	}
+	result, err := client.WaitForDecommission(context.Background(), status.ID, time.Millisecond)
+	if err == nil || result == nil {
+		t.Fatalf("WaitForDecommission() = %+v, %v; want partial result and error", result, err)
+	}
+	if polls != 2 || len(result.BranchesDeleted) != 1 || len(result.AuditEvents) != 1 {
+		t.Errorf("WaitForDecommission() result = %+v after %d polls", result, polls)
+	}
+
+	if result, err := client.Decommission(context.Background(), "wrong"); err == nil || result != nil {
+		t.Errorf("Decommission() with invalid token = %+v, %v; want error only", result, err)
+	}
+}
+
+func TestWaitForDecommissionFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "task-1", "status": "failed", "error": "task timed out"})
+	}))
+	defer server.Close()
+
+	client := New(server.URL, WithRetries(0, 0))
+	result, err := client.WaitForDecommission(context.Background(), "task-1", time.Millisecond)
+	if err == nil || result != nil || !strings.Contains(err.Error(), "task timed out") {
+		t.Errorf("WaitForDecommission() = %+v, %v; want the task error", result, err)
+	}
+}
+
+func TestWaitForRestoreFailed(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		restore := map[string]interface{}{"id": "r1", "name": "restore_20250101000000"}
+		if polls > 1 {
+			restore["failed_at"] = time.Now()
+			restore["failure_reason"] = "deadline_exceeded: restore still running after 12 hours (restore_deadline_hours)"
+		}
+		json.NewEncoder(w).Encode(restore)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, WithRetries(0, 0))
+	restore, err := client.WaitForRestore(context.Background(), "r1", time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "deadline_exceeded") {
+		t.Fatalf("WaitForRestore() error = %v, want the failure reason", err)
+	}
+	if restore == nil || !restore.Failed() || restore.Ready() || polls != 2 {
+		t.Errorf("WaitForRestore() = %+v after %d polls, want the failed restore", restore, polls)
+	}
+}
+
+func TestAuditEventsPages(t *testing.T) {
+	events := []string{"e5", "e4", "e3", "e2", "e1"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("limit"); got != "2" {
+			t.Errorf("limit = %q, want 2", got)
+		}
+		start := 0
+		if before := r.URL.Query().Get("before"); before != "" {
+			for i, id := range events {
+				if id == before {
+					start = i + 1
+				}
+			}
+		}
+		page := []map[string]interface{}{}
+		for _, id := range events[start:min(start+2, len(events))] {
+			page = append(page, map[string]interface{}{"id": id})
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, WithRetries(0, 0))
+	var got []string
+	for event, err := range client.AuditEvents(context.Background(), AuditFilter{Limit: 2}) {
+		if err != nil {
+			t.Fatalf("AuditEvents() error = %v", err)
+		}
+		got = append(got, event.ID)
+	}
+	if strings.Join(got, ",") != strings.Join(events, ",") {
+		t.Errorf("AuditEvents() = %v, want %v", got, events)
+	}
+
+	// Stopping early fetches no further pages
+	for event := range client.AuditEvents(context.Background(), AuditFilter{Limit: 2}) {
+		if event.ID != "e5" {
+			t.Errorf("first event = %q, want e5", event.ID)
+		}
+		break
+	}
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			TOTPCode string `json:"totp_code"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.TOTPCode != "123456" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Two-factor code required","two_factor_required":true}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token": "jwt-2fa",
+			"user":  map[string]interface{}{"id": "user-1", "two_factor_enabled": true},
+		})
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := New(server.URL)
+
+	_, err := client.Login(ctx, "a@b.com", "secret")
+	if !IsTwoFactorRequired(err) {
+		t.Fatalf("Login() error = %v, want two-factor required", err)
+	}
+	if IsTwoFactorRequired(nil) {
+		t.Error("IsTwoFactorRequired(nil) = true")
+	}
+
+	login, err := client.LoginWithTOTP(ctx, "a@b.com", "secret", "123456")
+	if err != nil {
+		t.Fatalf("LoginWithTOTP() error = %v", err)
+	}
+	if !login.User.TwoFactorEnabled || client.Token() != "jwt-2fa" {
+		t.Errorf("LoginWithTOTP() = %+v, token %q", login, client.Token())
+	}
+}
+
+func TestMatchBranch(t *testing.T) {
+	branches := []Branch{
+		{ID: "01J9ZQ3V7RMX0B5K8N2D4F6H1A", Name: "k3m9x2ab", ShortID: "p7q2r4st"},
+		{ID: "01J9ZQ3V7RMX0B5K8N2D4F6H1B", Name: "feature-x", ShortID: "k3m9x2ab"},
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "01J9ZQ3V7RMX0B5K8N2D4F6H1B", want: "01J9ZQ3V7RMX0B5K8N2D4F6H1B"},
+		{ref: "feature-x", want: "01J9ZQ3V7RMX0B5K8N2D4F6H1B"},
+		{ref: "Feature-X"}, // Case-sensitive like the server, see Client.FindBranch
+		{ref: "p7q2r4st", want: "01J9ZQ3V7RMX0B5K8N2D4F6H1A"},
+		// A name wins over another branch's short ID, like on the server
+		{ref: "k3m9x2ab", want: "01J9ZQ3V7RMX0B5K8N2D4F6H1A"},
+		{ref: "missing"},
+		{ref: ""},
+	}
+	for _, tt := range tests {
+		got := MatchBranch(branches, tt.ref)
+		if tt.want == "" {
+			if got != nil {
+				t.Errorf("MatchBranch(%q) = %s, want nil", tt.ref, got.ID)
+			}
+			continue
+		}
+		if got == nil || got.ID != tt.want {
+			t.Errorf("MatchBranch(%q) = %+v, want %s", tt.ref, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// DependencyNode is a restore, branch, branch_schedule or break_glass_grant in a dependency graph
+type DependencyNode struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Blocks bool   `json:"blocks"`           // Prevents deleting the root without cascade
+	Action string `json:"action,omitempty"` // What a cascade does to it: delete, disable or end
+}
+
+// DependencyEdge links a node to the node it depends on
+type DependencyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"` // branch_of, clone_of, schedule_of, grant_of or promotion_of
+}
+
+// DependencyGraph is everything that depends on a restore or branch
+type DependencyGraph struct {
+	Root           DependencyNode   `json:"root"`
+	Nodes          []DependencyNode `json:"nodes"`
+	Edges          []DependencyEdge `json:"edges"`
+	Blockers       []string         `json:"blockers"`      // IDs of the nodes that prevent a plain delete
+	CascadeOrder   []string         `json:"cascade_order"` // IDs in the order a cascade handles them, the root last
+	CascadeBlocked string           `json:"cascade_blocked,omitempty"`
+}
+
+// CascadeResult lists what a cascading delete did, in order
+type CascadeResult struct {
+	Message  string           `json:"message"`
+	Deleted  []DependencyNode `json:"deleted"`
+	Disabled []DependencyNode `json:"disabled"`
+}
+
+// GetRestoreDependencies returns what depends on a restore and what blocks deleting it
+func (c *Client) GetRestoreDependencies(ctx context.Context, id string) (*DependencyGraph, error) {
+	var graph DependencyGraph
+	if err := c.do(ctx, http.MethodGet, "/api/restores/"+pathEscape(id)+"/dependencies", nil, nil, &graph); err != nil {
+		return nil, err
+	}
+	return &graph, nil
+}
+
+// GetBranchDependencies returns what depends on a branch and what blocks deleting it
+func (c *Client) GetBranchDependencies(ctx context.Context, id string) (*DependencyGraph, error) {
+	var graph DependencyGraph
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(id)+"/dependencies", nil, nil, &graph); err != nil {
+		return nil, err
+	}
+	return &graph, nil
+}
+
+// DeleteRestoreCascade deletes a restore after its branches and clones, and disables schedules pinned to it
+func (c *Client) DeleteRestoreCascade(ctx context.Context, id string) (*CascadeResult, error) {
+	var result CascadeResult
+	if err := c.do(ctx, http.MethodDelete, "/api/restores/"+pathEscape(id), url.Values{"cascade": {"true"}}, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteBranchCascade deletes a branch and disables the schedule recreating it
+func (c *Client) DeleteBranchCascade(ctx context.Context, id string) (*CascadeResult, error) {
+	var result CascadeResult
+	if err := c.do(ctx, http.MethodDelete, "/api/branches/"+pathEscape(id), url.Values{"cascade": {"true"}}, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
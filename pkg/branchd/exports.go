@@ -0,0 +1,96 @@
+package branchd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// BranchExport is a pg_dump custom-format archive of a branch, restorable with pg_restore
+type BranchExport struct {
+	ID            string     `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	BranchID      string     `json:"branch_id"`
+	BranchName    string     `json:"branch_name"`
+	RequestedByID string     `json:"requested_by_id"`
+	Status        string     `json:"status"`
+	Uploaded      bool       `json:"uploaded"` // Sent to the upload URL, nothing to download
+	SizeBytes     int64      `json:"size_bytes"`
+	Error         string     `json:"error"`
+	CompletedAt   *time.Time `json:"completed_at"`
+	ExpiresAt     *time.Time `json:"expires_at"` // The downloadable archive is deleted then
+}
+
+// Export statuses
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	ExportExpired   = "expired"
+)
+
+// ExportBranch starts dumping a branch, poll the export with GetBranchExport or WaitForExport
+// With uploadURL (a pre-signed PUT URL, e.g. of an S3 object) the archive is uploaded there,
+// without it the archive can be downloaded with DownloadBranchExport for 24 hours
+func (c *Client) ExportBranch(ctx context.Context, branchID, uploadURL string) (*BranchExport, error) {
+	req := struct {
+		UploadURL string `json:"upload_url,omitempty"`
+	}{UploadURL: uploadURL}
+	var export BranchExport
+	if err := c.do(ctx, http.MethodPost, "/api/branches/"+pathEscape(branchID)+"/export", nil, req, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// GetBranchExport returns the progress of a branch export
+func (c *Client) GetBranchExport(ctx context.Context, branchID, id string) (*BranchExport, error) {
+	var export BranchExport
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(branchID)+"/exports/"+pathEscape(id), nil, nil, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// WaitForExport polls a branch export until it completed or failed, or ctx is done
+func (c *Client) WaitForExport(ctx context.Context, branchID, id string, interval time.Duration) (*BranchExport, error) {
+	for {
+		export, err := c.GetBranchExport(ctx, branchID, id)
+		if err != nil {
+			return nil, err
+		}
+		switch export.Status {
+		case ExportFailed:
+			return nil, fmt.Errorf("export failed: %s", export.Error)
+		case ExportCompleted:
+			return export, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DownloadBranchExport writes the archive of a completed export to w
+func (c *Client) DownloadBranchExport(ctx context.Context, branchID, id string, w io.Writer) error {
+	endpoint := c.baseURL + "/api/branches/" + pathEscape(branchID) + "/exports/" + pathEscape(id) + "/download"
+	resp, err := c.send(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeResponse(resp, nil)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to download archive: %w", err)
+	}
+	return nil
+}
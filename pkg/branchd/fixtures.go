@@ -0,0 +1,203 @@
+package branchd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Fixture declares synthetic rows to generate in a branch
+// Values only depend on the row number and Seed, so applying a fixture twice produces the same data
+type Fixture struct {
+	ID          string         `json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Seed        int64          `json:"seed"`
+	Tables      []FixtureTable `json:"tables"`
+}
+
+// FixtureTable generates Rows rows in a table, columns that aren't listed get their default
+type FixtureTable struct {
+	Table    string          `json:"table"` // e.g. "public.users"
+	Rows     int             `json:"rows"`
+	Truncate bool            `json:"truncate,omitempty"`
+	Columns  []FixtureColumn `json:"columns"`
+}
+
+// FixtureColumn generates the values of one column
+// Generator is one of sequence, integer, decimal, boolean, text, choice, timestamp, uuid,
+// reference, fake_name, fake_email, fake_address or null
+type FixtureColumn struct {
+	Column     string   `json:"column"`
+	Generator  string   `json:"generator"`
+	Start      int64    `json:"start,omitempty"`      // sequence: first value (default 1)
+	Min        float64  `json:"min,omitempty"`        // integer, decimal
+	Max        float64  `json:"max,omitempty"`        // integer, decimal (default 1000)
+	Ratio      float64  `json:"ratio,omitempty"`      // boolean: share of true values (default 0.5)
+	Template   string   `json:"template,omitempty"`   // text: ${index} is replaced by the row number
+	Values     []string `json:"values,omitempty"`     // choice
+	From       string   `json:"from,omitempty"`       // timestamp: RFC 3339 or YYYY-MM-DD
+	To         string   `json:"to,omitempty"`         // timestamp
+	References string   `json:"references,omitempty"` // reference: earlier table with a sequence column
+	NullRatio  float64  `json:"null_ratio,omitempty"` // Share of NULL values (0..1)
+}
+
+// FixtureInput creates a fixture
+type FixtureInput struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Seed        int64          `json:"seed"`
+	Tables      []FixtureTable `json:"tables"`
+}
+
+// UpdateFixtureRequest updates the non-nil fixture fields
+type UpdateFixtureRequest struct {
+	Name        *string         `json:"name,omitempty"`
+	Description *string         `json:"description,omitempty"`
+	Seed        *int64          `json:"seed,omitempty"`
+	Tables      *[]FixtureTable `json:"tables,omitempty"`
+}
+
+// FixtureResult reports the rows ApplyFixture inserted
+type FixtureResult struct {
+	Tables []FixtureTableResult `json:"tables"`
+	Rows   int                  `json:"rows"`
+}
+
+// FixtureTableResult reports the rows inserted into one table
+type FixtureTableResult struct {
+	Table string `json:"table"`
+	Rows  int    `json:"rows"`
+}
+
+// Fixture statuses
+const (
+	FixturePending   = "pending"
+	FixtureRunning   = "running"
+	FixtureCompleted = "completed"
+	FixtureFailed    = "failed"
+)
+
+// FixtureStatus is the progress of a fixture started with StartFixture
+type FixtureStatus struct {
+	ID     string         `json:"id"`
+	Status string         `json:"status"`
+	Error  string         `json:"error,omitempty"`  // Why the fixture failed, e.g. a constraint violation
+	Result *FixtureResult `json:"result,omitempty"` // Set once completed
+}
+
+// fixturePollInterval is how often ApplyFixture checks on a started fixture
+const fixturePollInterval = time.Second
+
+// ListFixtures returns all fixture definitions
+func (c *Client) ListFixtures(ctx context.Context) ([]Fixture, error) {
+	var fixtures []Fixture
+	if err := c.do(ctx, http.MethodGet, "/api/fixtures", nil, nil, &fixtures); err != nil {
+		return nil, err
+	}
+	return fixtures, nil
+}
+
+// CreateFixture creates a fixture definition (admin only)
+func (c *Client) CreateFixture(ctx context.Context, input FixtureInput) (*Fixture, error) {
+	var fixture Fixture
+	if err := c.do(ctx, http.MethodPost, "/api/fixtures", nil, input, &fixture); err != nil {
+		return nil, err
+	}
+	return &fixture, nil
+}
+
+// UpdateFixture updates a fixture definition (admin only)
+func (c *Client) UpdateFixture(ctx context.Context, id string, req UpdateFixtureRequest) (*Fixture, error) {
+	var fixture Fixture
+	if err := c.do(ctx, http.MethodPatch, "/api/fixtures/"+pathEscape(id), nil, req, &fixture); err != nil {
+		return nil, err
+	}
+	return &fixture, nil
+}
+
+// DeleteFixture deletes a fixture definition (admin only)
+func (c *Client) DeleteFixture(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/fixtures/"+pathEscape(id), nil, nil, nil)
+}
+
+// ApplyFixture generates a stored fixture's rows in a branch and waits for them (see StartFixture)
+func (c *Client) ApplyFixture(ctx context.Context, branchID, fixtureID string) (*FixtureResult, error) {
+	status, err := c.StartFixture(ctx, branchID, fixtureID)
+	if err != nil {
+		return nil, err
+	}
+	return c.WaitForFixture(ctx, branchID, status.ID, fixturePollInterval)
+}
+
+// ApplyInlineFixture generates rows of an unsaved definition in a branch and waits for them
+func (c *Client) ApplyInlineFixture(ctx context.Context, branchID string, seed int64, tables []FixtureTable) (*FixtureResult, error) {
+	status, err := c.StartInlineFixture(ctx, branchID, seed, tables)
+	if err != nil {
+		return nil, err
+	}
+	return c.WaitForFixture(ctx, branchID, status.ID, fixturePollInterval)
+}
+
+// StartFixture starts generating a stored fixture's rows in a branch
+// The rows are generated on the server, poll them with GetFixture or WaitForFixture
+func (c *Client) StartFixture(ctx context.Context, branchID, fixtureID string) (*FixtureStatus, error) {
+	req := struct {
+		FixtureID string `json:"fixture_id"`
+	}{FixtureID: fixtureID}
+	return c.startFixture(ctx, branchID, req)
+}
+
+// StartInlineFixture starts generating rows of an unsaved definition in a branch
+func (c *Client) StartInlineFixture(ctx context.Context, branchID string, seed int64, tables []FixtureTable) (*FixtureStatus, error) {
+	req := struct {
+		Seed   int64          `json:"seed"`
+		Tables []FixtureTable `json:"tables"`
+	}{Seed: seed, Tables: tables}
+	return c.startFixture(ctx, branchID, req)
+}
+
+func (c *Client) startFixture(ctx context.Context, branchID string, req any) (*FixtureStatus, error) {
+	var status FixtureStatus
+	if err := c.do(ctx, http.MethodPost, "/api/branches/"+pathEscape(branchID)+"/fixtures", nil, req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetFixture returns the progress of a fixture started in a branch
+func (c *Client) GetFixture(ctx context.Context, branchID, id string) (*FixtureStatus, error) {
+	var status FixtureStatus
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(branchID)+"/fixtures/"+pathEscape(id), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// WaitForFixture polls a fixture until it completed or failed, or ctx is done
+func (c *Client) WaitForFixture(ctx context.Context, branchID, id string, interval time.Duration) (*FixtureResult, error) {
+	for {
+		status, err := c.GetFixture(ctx, branchID, id)
+		if err != nil {
+			return nil, err
+		}
+		switch status.Status {
+		case FixtureFailed:
+			return nil, fmt.Errorf("fixture failed: %s", status.Error)
+		case FixtureCompleted:
+			if status.Result == nil {
+				return nil, fmt.Errorf("fixture completed without a result")
+			}
+			return status.Result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
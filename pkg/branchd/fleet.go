@@ -0,0 +1,124 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FleetHost is a server of a fleet: the control plane ("local") or one of its agents
+type FleetHost struct {
+	Name            string     `json:"name"`
+	URL             string     `json:"url,omitempty"` // Empty for the control plane itself
+	Reachable       bool       `json:"reachable"`
+	Error           string     `json:"error,omitempty"` // Why the host couldn't be queried
+	BranchCount     int        `json:"branch_count"`
+	ReadyRestores   int        `json:"ready_restores"`
+	FreeDiskPercent *float64   `json:"free_disk_percent"` // Nil when unknown
+	LastSeenAt      *time.Time `json:"last_seen_at,omitempty"`
+
+	// Whether the host has capacity for another branch, see Capacity
+	Admits          bool     `json:"admits"`
+	CapacityReasons []string `json:"capacity_reasons,omitempty"`
+}
+
+// FleetBranch is a branch of a fleet host, without its credentials
+type FleetBranch struct {
+	Host        string `json:"host"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	CreatedAt   string `json:"created_at"`
+	CreatedBy   string `json:"created_by"`
+	RestoreName string `json:"restore_name"`
+	Port        int    `json:"port"`
+}
+
+// FleetRestore is a restore of a fleet host
+type FleetRestore struct {
+	Host      string     `json:"host"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadyAt   *time.Time `json:"ready_at"`
+}
+
+// Fleet is the unified view of a control plane and its agents
+type Fleet struct {
+	Hosts    []FleetHost    `json:"hosts"`
+	Branches []FleetBranch  `json:"branches"`
+	Restores []FleetRestore `json:"restores"`
+}
+
+// FleetAgent is a server registered with a control plane
+type FleetAgent struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Name       string     `json:"name"`
+	URL        string     `json:"url"`
+	Insecure   bool       `json:"insecure"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	LastError  string     `json:"last_error"` // Of the last request to the agent, empty if it succeeded
+}
+
+// FleetAgentInput registers a fleet agent
+type FleetAgentInput struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`   // API base URL of the agent
+	Token    string `json:"token"` // API token of an admin of the agent, branches are created on it as that user
+	Insecure bool   `json:"insecure,omitempty"`
+}
+
+// GetFleet returns the hosts, branches and restores of a control plane and its agents
+// Returns an APIError with status 404 when the server isn't in control-plane mode
+func (c *Client) GetFleet(ctx context.Context) (*Fleet, error) {
+	var fleet Fleet
+	if err := c.do(ctx, http.MethodGet, "/api/fleet", nil, nil, &fleet); err != nil {
+		return nil, err
+	}
+	return &fleet, nil
+}
+
+// ListFleetAgents returns the agents of a control plane, without their tokens (admin only)
+func (c *Client) ListFleetAgents(ctx context.Context) ([]FleetAgent, error) {
+	var agents []FleetAgent
+	if err := c.do(ctx, http.MethodGet, "/api/fleet/agents", nil, nil, &agents); err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+// CreateFleetAgent registers an agent with a control plane (admin only)
+// Returns an APIError with status 502 when the control plane can't query the agent
+func (c *Client) CreateFleetAgent(ctx context.Context, input FleetAgentInput) (*FleetAgent, error) {
+	var agent FleetAgent
+	if err := c.do(ctx, http.MethodPost, "/api/fleet/agents", nil, input, &agent); err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+// DeleteFleetAgent unregisters an agent, its branches and restores are left as they are (admin only)
+func (c *Client) DeleteFleetAgent(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/fleet/agents/"+pathEscape(id), nil, nil, nil)
+}
+
+// CreateFleetBranch creates a branch on the least-loaded host with capacity for it, or on host when not empty
+func (c *Client) CreateFleetBranch(ctx context.Context, host string, req CreateBranchRequest) (*CreateBranchResponse, error) {
+	query := url.Values{}
+	if host != "" {
+		query.Set("host", host)
+	}
+	if len(req.Snippets) > 0 {
+		query.Set("snippets", strings.Join(req.Snippets, ","))
+	}
+
+	var resp CreateBranchResponse
+	if err := c.do(ctx, http.MethodPost, "/api/fleet/branches", query, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,96 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// SourceLatest in Group.AllowedSources allows branching from the latest ready restore
+const SourceLatest = "latest"
+
+// Group applies a branch profile, quota and allowed sources to its members
+type Group struct {
+	ID                 string               `json:"id"`
+	CreatedAt          time.Time            `json:"created_at"`
+	UpdatedAt          time.Time            `json:"updated_at"`
+	Name               string               `json:"name"`
+	Description        string               `json:"description"`
+	ResourceLimits     BranchResourceLimits `json:"resource_limits"`       // Applied to branches created without resources
+	MaxBranchesPerUser int                  `json:"max_branches_per_user"` // 0 = unlimited
+	AllowedSources     []string             `json:"allowed_sources"`       // Restore IDs or SourceLatest, empty = any restore
+	OIDCGroup          string               `json:"oidc_group"`            // SSO users in this IdP group are synced in on login
+
+	Members []GroupMember `json:"members,omitempty"` // Set by ListGroups
+}
+
+// GroupMember identifies a member of a group
+type GroupMember struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// GroupInput creates a group
+type GroupInput struct {
+	Name               string               `json:"name"`
+	Description        string               `json:"description,omitempty"`
+	ResourceLimits     BranchResourceLimits `json:"resource_limits"`
+	MaxBranchesPerUser int                  `json:"max_branches_per_user"`
+	AllowedSources     []string             `json:"allowed_sources,omitempty"`
+	OIDCGroup          string               `json:"oidc_group,omitempty"`
+}
+
+// UpdateGroupRequest updates the non-nil group fields
+type UpdateGroupRequest struct {
+	Name               *string               `json:"name,omitempty"`
+	Description        *string               `json:"description,omitempty"`
+	ResourceLimits     *BranchResourceLimits `json:"resource_limits,omitempty"`
+	MaxBranchesPerUser *int                  `json:"max_branches_per_user,omitempty"`
+	AllowedSources     *[]string             `json:"allowed_sources,omitempty"`
+	OIDCGroup          *string               `json:"oidc_group,omitempty"`
+}
+
+// ListGroups returns all groups with their members (admin only)
+func (c *Client) ListGroups(ctx context.Context) ([]Group, error) {
+	var groups []Group
+	if err := c.do(ctx, http.MethodGet, "/api/groups", nil, nil, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// CreateGroup creates a group (admin only)
+func (c *Client) CreateGroup(ctx context.Context, input GroupInput) (*Group, error) {
+	var group Group
+	if err := c.do(ctx, http.MethodPost, "/api/groups", nil, input, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// UpdateGroup updates a group (admin only)
+func (c *Client) UpdateGroup(ctx context.Context, id string, req UpdateGroupRequest) (*Group, error) {
+	var group Group
+	if err := c.do(ctx, http.MethodPatch, "/api/groups/"+pathEscape(id), nil, req, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// DeleteGroup deletes a group by ID (admin only)
+func (c *Client) DeleteGroup(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/groups/"+pathEscape(id), nil, nil, nil)
+}
+
+// SetGroupMembers replaces the members of a group (admin only)
+func (c *Client) SetGroupMembers(ctx context.Context, id string, userIDs []string) ([]GroupMember, error) {
+	req := struct {
+		UserIDs []string `json:"user_ids"`
+	}{UserIDs: userIDs}
+
+	var members []GroupMember
+	if err := c.do(ctx, http.MethodPut, "/api/groups/"+pathEscape(id)+"/members", nil, req, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
@@ -0,0 +1,119 @@
+package branchd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// MigrationFile is one file of a migration directory, files run in the order given
+type MigrationFile struct {
+	Name string `json:"name"`
+	SQL  string `json:"sql"`
+}
+
+// MigrationLock is the strongest lock a statement held on a relation
+type MigrationLock struct {
+	Relation string `json:"relation"`
+	Mode     string `json:"mode"` // pg_locks mode, e.g. AccessExclusiveLock
+}
+
+// MigrationStatement reports how one statement of a migration ran
+type MigrationStatement struct {
+	File          string          `json:"file,omitempty"`
+	SQL           string          `json:"sql"`
+	DurationMs    float64         `json:"duration_ms"`
+	Transactional bool            `json:"transactional"` // False for e.g. CREATE INDEX CONCURRENTLY, whose locks aren't observed
+	Locks         []MigrationLock `json:"locks"`
+	Rewrites      []string        `json:"rewrites"` // Tables whose data was rewritten (every row copied)
+	Warnings      []string        `json:"warnings"`
+	Error         string          `json:"error,omitempty"` // Set on the statement the migration failed at
+}
+
+// MigrationCheck reports a migration run in a throwaway copy of a branch
+type MigrationCheck struct {
+	BranchID   string               `json:"branch_id"`
+	BranchName string               `json:"branch_name"`
+	Succeeded  bool                 `json:"succeeded"`
+	Statements []MigrationStatement `json:"statements"`
+	Warnings   int                  `json:"warnings"`
+	DurationMs float64              `json:"duration_ms"`
+	CheckedAt  time.Time            `json:"checked_at"`
+}
+
+// Migration check statuses
+const (
+	MigrationCheckPending   = "pending"
+	MigrationCheckRunning   = "running"
+	MigrationCheckCompleted = "completed"
+	MigrationCheckFailed    = "failed"
+)
+
+// MigrationCheckStatus is the progress of a check started with StartMigrationCheck
+type MigrationCheckStatus struct {
+	ID     string          `json:"id"`
+	Status string          `json:"status"`
+	Error  string          `json:"error,omitempty"`  // Why the check couldn't run, a failing migration is reported in the result
+	Result *MigrationCheck `json:"result,omitempty"` // Set once completed
+}
+
+// migrationCheckPollInterval is how often CheckMigration checks on a started check
+const migrationCheckPollInterval = 2 * time.Second
+
+// CheckMigration runs a migration in a copy of a branch and waits for the report (see StartMigrationCheck)
+func (c *Client) CheckMigration(ctx context.Context, branchID, sql string, files []MigrationFile) (*MigrationCheck, error) {
+	status, err := c.StartMigrationCheck(ctx, branchID, sql, files)
+	if err != nil {
+		return nil, err
+	}
+	return c.WaitForMigrationCheck(ctx, branchID, status.ID, migrationCheckPollInterval)
+}
+
+// StartMigrationCheck starts running sql, then files, in a throwaway copy of a branch, the branch isn't modified
+// The check runs on the server, poll it with GetMigrationCheck or WaitForMigrationCheck
+func (c *Client) StartMigrationCheck(ctx context.Context, branchID, sql string, files []MigrationFile) (*MigrationCheckStatus, error) {
+	req := struct {
+		SQL   string          `json:"sql,omitempty"`
+		Files []MigrationFile `json:"files,omitempty"`
+	}{SQL: sql, Files: files}
+	var status MigrationCheckStatus
+	if err := c.do(ctx, http.MethodPost, "/api/branches/"+pathEscape(branchID)+"/check-migration", nil, req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetMigrationCheck returns the progress of a migration check
+func (c *Client) GetMigrationCheck(ctx context.Context, branchID, id string) (*MigrationCheckStatus, error) {
+	var status MigrationCheckStatus
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(branchID)+"/check-migration/"+pathEscape(id), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// WaitForMigrationCheck polls a migration check until it completed or failed, or ctx is done
+func (c *Client) WaitForMigrationCheck(ctx context.Context, branchID, id string, interval time.Duration) (*MigrationCheck, error) {
+	for {
+		status, err := c.GetMigrationCheck(ctx, branchID, id)
+		if err != nil {
+			return nil, err
+		}
+		switch status.Status {
+		case MigrationCheckFailed:
+			return nil, fmt.Errorf("migration check failed: %s", status.Error)
+		case MigrationCheckCompleted:
+			if status.Result == nil {
+				return nil, fmt.Errorf("migration check completed without a result")
+			}
+			return status.Result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package branchd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxBranchNameLength is the longest branch name the server accepts
+const MaxBranchNameLength = 50
+
+// ReservedBranchNamePrefixes can't start a branch name: restore datasets share the branch namespace
+// (restore_20250915120000), branchd names its own units and roles, and pg_ is reserved by PostgreSQL
+var ReservedBranchNamePrefixes = []string{"restore_", "branchd", "pg_"}
+
+var (
+	// branchNamePattern is a valid branch name: it becomes a ZFS dataset, a mountpoint and a value in shell scripts
+	branchNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+	// branchNameSeparators are runs of characters NormalizeBranchName replaces with a dash
+	branchNameSeparators = regexp.MustCompile(`[^a-z0-9_-]+`)
+)
+
+// NormalizeBranchName makes a name follow the naming policy where it can: it's lowercased, other characters
+// (e.g. the slash of "feature/ABC-123") become dashes and leading or trailing dashes and underscores are removed
+// The result can still be invalid, e.g. too long or reserved, check it with ValidateBranchName
+func NormalizeBranchName(name string) string {
+	name = branchNameSeparators.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-")
+	return strings.Trim(name, "-_")
+}
+
+// ValidateBranchName checks a name against the naming policy: 1 to 50 lowercase letters, digits, - and _,
+// starting with a letter or digit and without a reserved prefix
+func ValidateBranchName(name string) error {
+	if name == "" {
+		return fmt.Errorf("branch name is required")
+	}
+	if len(name) > MaxBranchNameLength {
+		return fmt.Errorf("branch name %q is %d characters long, at most %d are allowed", name, len(name), MaxBranchNameLength)
+	}
+	if !branchNamePattern.MatchString(name) {
+		return fmt.Errorf("branch name %q may only contain lowercase letters, digits, - and _, and must start with a letter or digit", name)
+	}
+	for _, prefix := range ReservedBranchNamePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("branch name %q starts with the reserved prefix %q", name, prefix)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package branchd
+
+import "testing"
+
+func TestNormalizeBranchName(t *testing.T) {
+	tests := map[string]string{
+		"feature/ABC-123":    "feature-abc-123",
+		"  Fix login bug ":   "fix-login-bug",
+		"release/v1.2.0":     "release-v1-2-0",
+		"_wip--":             "wip",
+		"jane.doe_dev":       "jane-doe_dev",
+		"already-normalized": "already-normalized",
+	}
+	for name, want := range tests {
+		if got := NormalizeBranchName(name); got != want {
+			t.Errorf("NormalizeBranchName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestValidateBranchName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "feature-abc-123"},
+		{name: "a"},
+		{name: "pr_42"},
+		{name: "", wantErr: true},
+		{name: "Feature", wantErr: true},
+		{name: "feature/x", wantErr: true},
+		{name: "-feature", wantErr: true},
+		{name: "restore_20250915120000", wantErr: true},
+		{name: "branchd-api", wantErr: true},
+		{name: "pg_stat", wantErr: true},
+		{name: "012345678901234567890123456789012345678901234567890", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := ValidateBranchName(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateBranchName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
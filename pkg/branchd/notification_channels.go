@@ -0,0 +1,77 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// NotificationChannel is a Slack, Discord or Teams channel branch and restore events are posted to
+type NotificationChannel struct {
+	ID           string     `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Name         string     `json:"name"`
+	Kind         string     `json:"kind"`   // "slack", "discord" or "teams"
+	Events       []string   `json:"events"` // e.g. "branch.created", empty = all
+	LastPostedAt *time.Time `json:"last_posted_at"`
+	LastError    string     `json:"last_error"` // Of the last post, empty if it succeeded
+}
+
+// NotificationChannelInput creates a notification channel
+type NotificationChannelInput struct {
+	Name       string   `json:"name"`
+	Kind       string   `json:"kind,omitempty"` // Empty = inferred from the webhook URL
+	WebhookURL string   `json:"webhook_url"`
+	Events     []string `json:"events,omitempty"` // "branch.created", "branch.deleted", "refresh.completed", "restore.failed", "break_glass", "server.decommissioned"
+}
+
+// UpdateNotificationChannelRequest updates the non-nil notification channel fields
+type UpdateNotificationChannelRequest struct {
+	Name       *string   `json:"name,omitempty"`
+	Kind       *string   `json:"kind,omitempty"`
+	WebhookURL *string   `json:"webhook_url,omitempty"`
+	Events     *[]string `json:"events,omitempty"`
+}
+
+// ListNotificationChannels returns all notification channels, without their webhook URLs (admin only)
+func (c *Client) ListNotificationChannels(ctx context.Context) ([]NotificationChannel, error) {
+	var channels []NotificationChannel
+	if err := c.do(ctx, http.MethodGet, "/api/notification-channels", nil, nil, &channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// CreateNotificationChannel creates a notification channel (admin only)
+func (c *Client) CreateNotificationChannel(ctx context.Context, input NotificationChannelInput) (*NotificationChannel, error) {
+	var channel NotificationChannel
+	if err := c.do(ctx, http.MethodPost, "/api/notification-channels", nil, input, &channel); err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// UpdateNotificationChannel updates a notification channel (admin only)
+func (c *Client) UpdateNotificationChannel(ctx context.Context, id string, req UpdateNotificationChannelRequest) (*NotificationChannel, error) {
+	var channel NotificationChannel
+	if err := c.do(ctx, http.MethodPatch, "/api/notification-channels/"+pathEscape(id), nil, req, &channel); err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// DeleteNotificationChannel deletes a notification channel (admin only)
+func (c *Client) DeleteNotificationChannel(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/notification-channels/"+pathEscape(id), nil, nil, nil)
+}
+
+// TestNotificationChannel posts a test message to a notification channel (admin only)
+// Returns an APIError with status 502 when the webhook rejects it
+func (c *Client) TestNotificationChannel(ctx context.Context, id string) (*NotificationChannel, error) {
+	var channel NotificationChannel
+	if err := c.do(ctx, http.MethodPost, "/api/notification-channels/"+pathEscape(id)+"/test", nil, nil, &channel); err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
@@ -0,0 +1,65 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RestoreProvenance records where a restore's data came from and the artifacts it was restored from
+type RestoreProvenance struct {
+	Method         string `json:"method"` // "logical" (pg_dump), "crunchy_bridge" or "pgbackrest" (pgBackRest)
+	SourceHost     string `json:"source_host,omitempty"`
+	SourceDatabase string `json:"source_database,omitempty"`
+	SourceVersion  string `json:"source_version,omitempty"`
+	SourceSystemID string `json:"source_system_identifier,omitempty"`
+	DumpTool       string `json:"dump_tool,omitempty"`
+	RestoreTool    string `json:"restore_tool,omitempty"`
+
+	// WAL position of the source when the dump started and ended, the backup's start position for pgBackRest
+	StartLSN   string `json:"start_lsn,omitempty"`
+	EndLSN     string `json:"end_lsn,omitempty"`
+	SnapshotID string `json:"snapshot_id,omitempty"` // pgBackRest backup label
+
+	Artifacts         []RestoreArtifact `json:"artifacts,omitempty"`
+	ChecksumsVerified bool              `json:"checksums_verified"` // Artifacts matched their checksums before they were restored
+}
+
+// RestoreArtifact is a file a restore was restored from
+type RestoreArtifact struct {
+	Name      string `json:"name"`
+	SizeBytes int64  `json:"size_bytes"`
+	SHA256    string `json:"sha256,omitempty"`
+}
+
+// BranchProvenance is the source state a branch was derived from
+type BranchProvenance struct {
+	BranchID        string    `json:"branch_id"`
+	BranchName      string    `json:"branch_name"`
+	BranchCreatedAt time.Time `json:"branch_created_at"`
+
+	// The branch's restore first, then the restores it was cloned or promoted from
+	Restores []RestoreLineage `json:"restores"`
+
+	Provenance *RestoreProvenance `json:"provenance"` // Of the last restore, nil if it wasn't recorded
+}
+
+// RestoreLineage is one restore a branch was derived from
+type RestoreLineage struct {
+	ID                 string     `json:"id"`
+	Name               string     `json:"name"`
+	ReadyAt            *time.Time `json:"ready_at"`
+	ClonedFromID       string     `json:"cloned_from_id,omitempty"`
+	PromotedFromBranch string     `json:"promoted_from_branch,omitempty"`
+	AdoptedFrom        string     `json:"adopted_from,omitempty"`
+	Deleted            bool       `json:"deleted,omitempty"` // Only the restore's ID is known
+}
+
+// GetBranchProvenance returns which production state a branch was derived from
+func (c *Client) GetBranchProvenance(ctx context.Context, id string) (*BranchProvenance, error) {
+	var provenance BranchProvenance
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(id)+"/provenance", nil, nil, &provenance); err != nil {
+		return nil, err
+	}
+	return &provenance, nil
+}
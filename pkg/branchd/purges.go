@@ -0,0 +1,82 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Purge is the proof of deletion of a data subject's rows from restores and branches
+// Only the SHA-256 of the subject identifier is stored
+type Purge struct {
+	ID               string        `json:"id"`
+	CreatedAt        time.Time     `json:"created_at"`
+	SubjectHash      string        `json:"subject_hash"`
+	Reference        string        `json:"reference"`
+	RequestedByID    string        `json:"requested_by_id"`
+	RequestedByEmail string        `json:"requested_by_email"`
+	KeyColumns       string        `json:"key_columns"`
+	Status           string        `json:"status"` // "running", "completed" or "failed"
+	RowsDeleted      int           `json:"rows_deleted"`
+	Targets          []PurgeTarget `json:"targets"`
+	Error            string        `json:"error,omitempty"` // Why the purge stopped before all targets
+	CompletedAt      *time.Time    `json:"completed_at"`
+}
+
+// PurgeTarget reports the rows deleted from one restore or branch
+type PurgeTarget struct {
+	Type          string             `json:"type"` // "restore" or "branch"
+	ID            string             `json:"id"`
+	Name          string             `json:"name"`
+	Tables        []PurgeTableResult `json:"tables,omitempty"`
+	MissingTables []string           `json:"missing_tables,omitempty"`
+	Rows          int                `json:"rows"`
+	Error         string             `json:"error,omitempty"`
+	CompletedAt   time.Time          `json:"completed_at"`
+}
+
+// PurgeTableResult reports the rows deleted through one key column
+type PurgeTableResult struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Rows   int    `json:"rows"`
+}
+
+// CreatePurge deletes a data subject's rows from all restores and branches (admin only)
+// The purge runs in the background, poll GetPurge until its status isn't "running"
+func (c *Client) CreatePurge(ctx context.Context, subjectID, reference string) (*Purge, error) {
+	req := struct {
+		SubjectID string `json:"subject_id"`
+		Reference string `json:"reference,omitempty"`
+	}{SubjectID: subjectID, Reference: reference}
+
+	var purge Purge
+	if err := c.do(ctx, http.MethodPost, "/api/purges", nil, req, &purge); err != nil {
+		return nil, err
+	}
+	return &purge, nil
+}
+
+// ListPurges returns purges, newest first, only those of subjectID if it's not empty (admin only)
+func (c *Client) ListPurges(ctx context.Context, subjectID string) ([]Purge, error) {
+	query := url.Values{}
+	if subjectID != "" {
+		query.Set("subject_id", subjectID)
+	}
+
+	var purges []Purge
+	if err := c.do(ctx, http.MethodGet, "/api/purges", query, nil, &purges); err != nil {
+		return nil, err
+	}
+	return purges, nil
+}
+
+// GetPurge returns a purge with its per-target results (admin only)
+func (c *Client) GetPurge(ctx context.Context, id string) (*Purge, error) {
+	var purge Purge
+	if err := c.do(ctx, http.MethodGet, "/api/purges/"+pathEscape(id), nil, nil, &purge); err != nil {
+		return nil, err
+	}
+	return &purge, nil
+}
@@ -0,0 +1,97 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RefreshStatus is whether the scheduled refresh is due and what it waits for
+type RefreshStatus struct {
+	RefreshSchedule  string            `json:"refresh_schedule"`
+	RefreshWindows   string            `json:"refresh_windows"` // UTC ranges the refresh may start in, empty = any time
+	NextRefreshAt    *time.Time        `json:"next_refresh_at"`
+	Due              bool              `json:"due"`
+	Forced           bool              `json:"forced"`                   // Starts within a minute without waiting
+	BlockedReason    string            `json:"blocked_reason,omitempty"` // Why the due refresh waits, e.g. a branch creation in progress
+	BranchOperations []BranchOperation `json:"branch_operations"`
+}
+
+// BranchOperation is a branch creation in progress, due scheduled refreshes wait for it
+type BranchOperation struct {
+	ID          string    `json:"id"`
+	BranchName  string    `json:"branch_name"`
+	Operation   string    `json:"operation"`
+	CreatedByID string    `json:"created_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GetRefreshStatus returns whether the scheduled refresh is due and whether it's deferred
+func (c *Client) GetRefreshStatus(ctx context.Context) (*RefreshStatus, error) {
+	var status RefreshStatus
+	if err := c.do(ctx, http.MethodGet, "/api/refresh", nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ForceRefresh starts the scheduled refresh within a minute, without waiting for its refresh window or
+// in-flight branch creations (admin only)
+func (c *Client) ForceRefresh(ctx context.Context) (*RefreshStatus, error) {
+	var status RefreshStatus
+	if err := c.do(ctx, http.MethodPost, "/api/refresh/force", nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RefreshRun is one scheduled or manual refresh attempt
+type RefreshRun struct {
+	ID               string     `json:"id"`
+	RestoreID        string     `json:"restore_id"`
+	RestoreName      string     `json:"restore_name"`
+	Trigger          string     `json:"trigger"` // "scheduled" or "manual"
+	Mode             string     `json:"mode"`    // "full" or "incremental"
+	Outcome          string     `json:"outcome"` // "running", "succeeded", "failed" or "cancelled"
+	FinishedAt       *time.Time `json:"finished_at"`
+	DurationSeconds  int64      `json:"duration_seconds"`
+	BytesTransferred int64      `json:"bytes_transferred"` // Size of the artifacts restored from, 0 when unknown (e.g. incremental refreshes)
+	FailureCategory  string     `json:"failure_category,omitempty"`
+	FailureReason    string     `json:"failure_reason,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// RefreshStats summarizes the finished refresh runs of a rolling window
+type RefreshStats struct {
+	WindowDays            int            `json:"window_days"`
+	Total                 int            `json:"total"`
+	Succeeded             int            `json:"succeeded"`
+	Failed                int            `json:"failed"`
+	Cancelled             int            `json:"cancelled"`
+	SuccessRate           *float64       `json:"success_rate"` // Percentage, nil without succeeded or failed runs
+	MedianDurationSeconds int64          `json:"median_duration_seconds"`
+	FailureCategories     map[string]int `json:"failure_categories"`
+}
+
+// RefreshHistory lists the refresh runs of the last days, newest first, with success rates over 1, 7, 30 and 90 days
+type RefreshHistory struct {
+	Days  int            `json:"days"`
+	Runs  []RefreshRun   `json:"runs"`
+	Stats []RefreshStats `json:"stats"`
+}
+
+// GetRefreshHistory returns the refresh runs of the last days (0 = server default of 30) and their success rates
+func (c *Client) GetRefreshHistory(ctx context.Context, days int) (*RefreshHistory, error) {
+	var query url.Values
+	if days > 0 {
+		query = url.Values{"days": {strconv.Itoa(days)}}
+	}
+
+	var history RefreshHistory
+	if err := c.do(ctx, http.MethodGet, "/api/reports/refresh-history", query, nil, &history); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
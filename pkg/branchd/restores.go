@@ -0,0 +1,334 @@
+package branchd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Restore is a restore of the source database that branches are created from
+type Restore struct {
+	ID               string     `json:"id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	Name             string     `json:"name"`
+	SchemaOnly       bool       `json:"schema_only"`
+	SchemaReady      bool       `json:"schema_ready"`
+	DataReady        bool       `json:"data_ready"`
+	State            string     `json:"state"` // pending, dumping, restoring, anonymizing, ready, failed or cancelled
+	ReadyAt          *time.Time `json:"ready_at"`
+	StartedAt        *time.Time `json:"started_at"`     // Nil while queued behind other restores
+	RestoringAt      *time.Time `json:"restoring_at"`   // When data started loading (after the dump for logical restores)
+	AnonymizingAt    *time.Time `json:"anonymizing_at"` // When post-restore SQL and anonymization started
+	CancelledAt      *time.Time `json:"cancelled_at"`
+	FailedAt         *time.Time `json:"failed_at"`
+	FailureReason    string     `json:"failure_reason"` // e.g. "deadline_exceeded: ..." when stopped after the restore deadline
+	ResumeCount      int        `json:"resume_count"`   // Times the restore started over after its process was interrupted
+	Port             int        `json:"port"`
+	PostgresVersion  string     `json:"postgres_version"` // Major version of the restore's cluster
+	BoostedUntil     *time.Time `json:"boosted_until"`
+	ClonedFromID     string     `json:"cloned_from_id"`    // Empty unless created by CloneRestore
+	SubscriptionName string     `json:"subscription_name"` // Set when the restore is refreshed incrementally
+	RefreshingSince  *time.Time `json:"refreshing_since"`  // Set while an incremental refresh is applied
+
+	// Set when the restore was created by PromoteBranch
+	PromotedFromBranch    string `json:"promoted_from_branch"`
+	PromotedFromRestoreID string `json:"promoted_from_restore_id"`
+
+	AdoptedFrom string `json:"adopted_from"` // Data directory the restore was copied from by AdoptRestore
+
+	// Set by TriggerRestoreWith or UpdateRestore, pinned restores are kept by the retention policy
+	Label  string `json:"label"` // e.g. "pre-migration-baseline"
+	Note   string `json:"note"`
+	Pinned bool   `json:"pinned"`
+
+	// Data load progress of logical restores while restoring, weighted by table size. TablesTotal is 0 when unknown
+	TablesTotal           int        `json:"tables_total"`
+	TablesRestored        int        `json:"tables_restored"`
+	ProgressPercent       float64    `json:"progress_percent"`
+	EstimatedDataLoadedAt *time.Time `json:"estimated_data_loaded_at"` // Nil until a table was loaded and once all were
+
+	// Source state the restore holds, nil for clones, promoted and adopted restores (see GetBranchProvenance)
+	Provenance *RestoreProvenance `json:"provenance,omitempty"`
+
+	Branches []RestoreBranch `json:"branches,omitempty"`
+}
+
+// Ready reports whether branches can be created from the restore
+func (r *Restore) Ready() bool {
+	return r.ReadyAt != nil
+}
+
+// Failed reports whether the restore failed and will never become ready
+func (r *Restore) Failed() bool {
+	return r.FailedAt != nil
+}
+
+// Cancelled reports whether the restore was cancelled by CancelRestore
+func (r *Restore) Cancelled() bool {
+	return r.CancelledAt != nil
+}
+
+// RestoreBranch is a branch as embedded in a Restore
+type RestoreBranch struct {
+	ID             string               `json:"id"`
+	CreatedAt      time.Time            `json:"created_at"`
+	Name           string               `json:"name"`
+	RestoreID      string               `json:"restore_id"`
+	CreatedByID    string               `json:"created_by_id"`
+	Port           int                  `json:"port"`
+	ResourceLimits BranchResourceLimits `json:"resource_limits"`
+}
+
+// RestoreLogs contains the tail of a restore's log file
+type RestoreLogs struct {
+	Logs       []string `json:"logs"`
+	TotalLines int      `json:"total_lines"`
+	Exists     bool     `json:"exists"`
+}
+
+// RestoreFilter narrows FindRestores (zero values are ignored)
+type RestoreFilter struct {
+	Label  string
+	Pinned *bool
+}
+
+// TriggerRestoreRequest labels a restore started by TriggerRestoreWith
+type TriggerRestoreRequest struct {
+	Label  string `json:"label,omitempty"` // Lowercase letters, digits, '.', '_' and '-'
+	Note   string `json:"note,omitempty"`
+	Pinned bool   `json:"pinned,omitempty"` // Keep the restore until unpinned, needs a label
+}
+
+// UpdateRestoreRequest changes the label, note or pin of a restore (nil fields are left unchanged)
+type UpdateRestoreRequest struct {
+	Label  *string `json:"label,omitempty"` // Empty removes the label
+	Note   *string `json:"note,omitempty"`
+	Pinned *bool   `json:"pinned,omitempty"`
+}
+
+// TriggerRestoreResponse is returned by TriggerRestore
+type TriggerRestoreResponse struct {
+	Message       string `json:"message"`
+	RestoreID     string `json:"restore_id"`
+	TaskID        string `json:"task_id"`
+	QueuePosition int    `json:"queue_position"` // 0 = starting now, otherwise waiting for running restores
+	Buffered      bool   `json:"buffered"`       // Redis was unavailable, the restore starts once it's back (TaskID is empty)
+}
+
+// AnonymizeResponse is returned by ApplyAnonymization
+type AnonymizeResponse struct {
+	Message      string `json:"message"`
+	RulesApplied int    `json:"rules_applied"`
+}
+
+// RestoreReport compares a restore with the previous one
+type RestoreReport struct {
+	ID                  string          `json:"id"`
+	CreatedAt           time.Time       `json:"created_at"`
+	RestoreID           string          `json:"restore_id"`
+	RestoreName         string          `json:"restore_name"`
+	PreviousRestoreID   string          `json:"previous_restore_id"`
+	PreviousRestoreName string          `json:"previous_restore_name"`
+	SizeBytes           int64           `json:"size_bytes"`
+	TableCount          int             `json:"table_count"`
+	SizeDeltaBytes      int64           `json:"size_delta_bytes"`
+	TableCountDelta     int             `json:"table_count_delta"`
+	NewTables           []string        `json:"new_tables"`
+	DroppedTables       []string        `json:"dropped_tables"`
+	RowCountDrift       []RowCountDrift `json:"row_count_drift"`
+	Warnings            []string        `json:"warnings"`
+}
+
+// RowCountDrift describes the row count change of a tracked table between two restores
+type RowCountDrift struct {
+	Table        string  `json:"table"`
+	PreviousRows int64   `json:"previous_rows"`
+	CurrentRows  int64   `json:"current_rows"`
+	Delta        int64   `json:"delta"`
+	DeltaPercent float64 `json:"delta_percent"`
+}
+
+// ListRestores returns all restores, oldest first
+func (c *Client) ListRestores(ctx context.Context) ([]Restore, error) {
+	return c.FindRestores(ctx, RestoreFilter{})
+}
+
+// FindRestores returns the restores matching filter, oldest first
+func (c *Client) FindRestores(ctx context.Context, filter RestoreFilter) ([]Restore, error) {
+	query := url.Values{}
+	if filter.Label != "" {
+		query.Set("label", filter.Label)
+	}
+	if filter.Pinned != nil {
+		query.Set("pinned", strconv.FormatBool(*filter.Pinned))
+	}
+
+	var restores []Restore
+	if err := c.do(ctx, http.MethodGet, "/api/restores", query, nil, &restores); err != nil {
+		return nil, err
+	}
+	return restores, nil
+}
+
+// UpdateRestore changes the label, note or pin of a restore and returns it
+func (c *Client) UpdateRestore(ctx context.Context, id string, req UpdateRestoreRequest) (*Restore, error) {
+	var restore Restore
+	if err := c.do(ctx, http.MethodPatch, "/api/restores/"+pathEscape(id), nil, req, &restore); err != nil {
+		return nil, err
+	}
+	return &restore, nil
+}
+
+// GetRestore returns a restore by ID
+func (c *Client) GetRestore(ctx context.Context, id string) (*Restore, error) {
+	var restore Restore
+	if err := c.do(ctx, http.MethodGet, "/api/restores/"+pathEscape(id), nil, nil, &restore); err != nil {
+		return nil, err
+	}
+	return &restore, nil
+}
+
+// GetRestoreLogs returns the last lines of a restore's log (0 = server default of 50, max 1000)
+func (c *Client) GetRestoreLogs(ctx context.Context, id string, lines int) (*RestoreLogs, error) {
+	var query url.Values
+	if lines > 0 {
+		query = url.Values{"lines": {strconv.Itoa(lines)}}
+	}
+
+	var logs RestoreLogs
+	if err := c.do(ctx, http.MethodGet, "/api/restores/"+pathEscape(id)+"/logs", query, nil, &logs); err != nil {
+		return nil, err
+	}
+	return &logs, nil
+}
+
+// DeleteRestore deletes a restore (only allowed if it has no branches)
+func (c *Client) DeleteRestore(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/restores/"+pathEscape(id), nil, nil, nil)
+}
+
+// CloneRestore ZFS-clones a ready restore into a new independent restore and returns it
+// The clone is created in the background, wait for it with WaitForRestore
+// Clones are never branched from or cleaned up by refreshes; delete them with DeleteRestore
+func (c *Client) CloneRestore(ctx context.Context, id string) (*Restore, error) {
+	var restore Restore
+	if err := c.do(ctx, http.MethodPost, "/api/restores/"+pathEscape(id)+"/clone", nil, nil, &restore); err != nil {
+		return nil, err
+	}
+	return &restore, nil
+}
+
+// TriggerRestore starts a new restore of the source database
+func (c *Client) TriggerRestore(ctx context.Context) (*TriggerRestoreResponse, error) {
+	return c.TriggerRestoreWith(ctx, TriggerRestoreRequest{})
+}
+
+// TriggerRestoreWith starts a new restore of the source database with a label, note or pin
+func (c *Client) TriggerRestoreWith(ctx context.Context, req TriggerRestoreRequest) (*TriggerRestoreResponse, error) {
+	var resp TriggerRestoreResponse
+	if err := c.do(ctx, http.MethodPost, "/api/restores/trigger-restore", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AdoptRestore copies a stopped PostgreSQL cluster on the VM into a new restore and returns it
+// The copy runs in the background, use WaitForRestore to wait until the restore is ready
+func (c *Client) AdoptRestore(ctx context.Context, dataDirectory string) (*Restore, error) {
+	req := struct {
+		DataDirectory string `json:"data_directory"`
+	}{DataDirectory: dataDirectory}
+
+	var restore Restore
+	if err := c.do(ctx, http.MethodPost, "/api/restores/adopt", nil, req, &restore); err != nil {
+		return nil, err
+	}
+	return &restore, nil
+}
+
+// ApplyAnonymization re-applies the anonymization rules to a restore
+func (c *Client) ApplyAnonymization(ctx context.Context, id string) (*AnonymizeResponse, error) {
+	var resp AnonymizeResponse
+	if err := c.do(ctx, http.MethodPost, "/api/restores/"+pathEscape(id)+"/anonymize", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetRestoreReport returns the comparison report of a restore
+func (c *Client) GetRestoreReport(ctx context.Context, id string) (*RestoreReport, error) {
+	var report RestoreReport
+	if err := c.do(ctx, http.MethodGet, "/api/restores/"+pathEscape(id)+"/report", nil, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ListRestoreReports returns the comparison reports of recent refreshes, newest first
+func (c *Client) ListRestoreReports(ctx context.Context) ([]RestoreReport, error) {
+	var reports []RestoreReport
+	if err := c.do(ctx, http.MethodGet, "/api/restore-reports", nil, nil, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// BoostRestore raises an in-progress restore's CPU/IO priority for the given duration
+// A zero duration uses the server default (60 minutes)
+func (c *Client) BoostRestore(ctx context.Context, id string, duration time.Duration) (*Restore, error) {
+	req := struct {
+		DurationMinutes int `json:"duration_minutes,omitempty"`
+	}{DurationMinutes: int(duration / time.Minute)}
+
+	var restore Restore
+	if err := c.do(ctx, http.MethodPost, "/api/restores/"+pathEscape(id)+"/boost", nil, req, &restore); err != nil {
+		return nil, err
+	}
+	return &restore, nil
+}
+
+// UnboostRestore returns a restore to background priority
+func (c *Client) UnboostRestore(ctx context.Context, id string) (*Restore, error) {
+	var restore Restore
+	if err := c.do(ctx, http.MethodDelete, "/api/restores/"+pathEscape(id)+"/boost", nil, nil, &restore); err != nil {
+		return nil, err
+	}
+	return &restore, nil
+}
+
+// CancelRestore stops a queued or running restore, it's kept as cancelled until deleted
+func (c *Client) CancelRestore(ctx context.Context, id string) (*Restore, error) {
+	var restore Restore
+	if err := c.do(ctx, http.MethodPost, "/api/restores/"+pathEscape(id)+"/cancel", nil, nil, &restore); err != nil {
+		return nil, err
+	}
+	return &restore, nil
+}
+
+// WaitForRestore polls a restore until it is ready for branching, it failed or was cancelled, or ctx is done
+func (c *Client) WaitForRestore(ctx context.Context, id string, interval time.Duration) (*Restore, error) {
+	for {
+		restore, err := c.GetRestore(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if restore.Ready() {
+			return restore, nil
+		}
+		if restore.Failed() {
+			return restore, fmt.Errorf("restore %s failed: %s", restore.Name, restore.FailureReason)
+		}
+		if restore.Cancelled() {
+			return restore, fmt.Errorf("restore %s was cancelled", restore.Name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// BranchSchedule recreates a branch from the latest ready restore on a cron schedule
+// and/or whenever a new restore is ready, keeping its port and credentials
+type BranchSchedule struct {
+	ID             string               `json:"id"`
+	CreatedAt      time.Time            `json:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+	BranchName     string               `json:"branch_name"`
+	Schedule       string               `json:"schedule"` // Cron expression, e.g. "0 6 * * *"
+	CreatedByID    string               `json:"created_by_id"`
+	Enabled        bool                 `json:"enabled"`
+	ResourceLimits BranchResourceLimits `json:"resource_limits"`
+	NextRunAt      *time.Time           `json:"next_run_at"`
+	LastRunAt      *time.Time           `json:"last_run_at"`
+	LastError      string               `json:"last_error"` // Empty if the last run succeeded
+
+	RestoreID     string `json:"restore_id"`      // Source restore, empty = latest ready restore
+	OnNewRestore  bool   `json:"on_new_restore"`  // Recreated whenever a new restore is ready
+	LastRestoreID string `json:"last_restore_id"` // Restore the current branch was created from
+}
+
+// BranchScheduleInput creates a branch schedule, Schedule or OnNewRestore is required
+type BranchScheduleInput struct {
+	BranchName string               `json:"branch_name"`
+	Schedule   string               `json:"schedule,omitempty"`
+	Resources  BranchResourceLimits `json:"resources"`
+	Enabled    *bool                `json:"enabled,omitempty"` // Defaults to true
+
+	RestoreID    string `json:"restore_id,omitempty"` // e.g. a promoted restore, empty = latest ready restore
+	OnNewRestore bool   `json:"on_new_restore,omitempty"`
+}
+
+// UpdateBranchScheduleRequest updates the non-nil schedule fields
+type UpdateBranchScheduleRequest struct {
+	Schedule  *string               `json:"schedule,omitempty"`
+	Resources *BranchResourceLimits `json:"resources,omitempty"`
+	Enabled   *bool                 `json:"enabled,omitempty"`
+
+	RestoreID    *string `json:"restore_id,omitempty"` // Empty string = latest ready restore
+	OnNewRestore *bool   `json:"on_new_restore,omitempty"`
+}
+
+// ScheduledBranch is the branch created by RunBranchSchedule
+type ScheduledBranch struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	RestoreID string `json:"restore_id"`
+	Port      int    `json:"port"`
+}
+
+// ListBranchSchedules returns all branch schedules (admin only)
+func (c *Client) ListBranchSchedules(ctx context.Context) ([]BranchSchedule, error) {
+	var schedules []BranchSchedule
+	if err := c.do(ctx, http.MethodGet, "/api/branch-schedules", nil, nil, &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// CreateBranchSchedule creates a branch schedule owned by the calling admin (admin only)
+func (c *Client) CreateBranchSchedule(ctx context.Context, input BranchScheduleInput) (*BranchSchedule, error) {
+	var schedule BranchSchedule
+	if err := c.do(ctx, http.MethodPost, "/api/branch-schedules", nil, input, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// UpdateBranchSchedule updates a branch schedule (admin only)
+func (c *Client) UpdateBranchSchedule(ctx context.Context, id string, req UpdateBranchScheduleRequest) (*BranchSchedule, error) {
+	var schedule BranchSchedule
+	if err := c.do(ctx, http.MethodPatch, "/api/branch-schedules/"+pathEscape(id), nil, req, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// DeleteBranchSchedule deletes a branch schedule, its branch is kept (admin only)
+func (c *Client) DeleteBranchSchedule(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/branch-schedules/"+pathEscape(id), nil, nil, nil)
+}
+
+// RunBranchSchedule recreates the schedule's branch now (admin only)
+func (c *Client) RunBranchSchedule(ctx context.Context, id string) (*ScheduledBranch, error) {
+	var branch ScheduledBranch
+	if err := c.do(ctx, http.MethodPost, "/api/branch-schedules/"+pathEscape(id)+"/run", nil, nil, &branch); err != nil {
+		return nil, err
+	}
+	return &branch, nil
+}
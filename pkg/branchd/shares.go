@@ -0,0 +1,63 @@
+package branchd
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// BranchShare is a time-limited read-only role in a branch, for someone without a branchd user
+type BranchShare struct {
+	ID          string     `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	BranchID    string     `json:"branch_id"`
+	BranchName  string     `json:"branch_name"`
+	CreatedByID string     `json:"created_by_id"`
+	Note        string     `json:"note"`
+	User        string     `json:"user"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`    // Also set once the janitor dropped an expired share's role
+	RevokedByID string     `json:"revoked_by_id"` // Empty = expired
+}
+
+// SharedBranch holds the credentials of a new share, the password isn't returned again
+type SharedBranch struct {
+	BranchShare
+	Password         string `json:"password"`
+	Host             string `json:"host"`
+	Port             int    `json:"port"`
+	Database         string `json:"database"`
+	ConnectionString string `json:"connection_string"`
+	RevokeURL        string `json:"revoke_url"`
+}
+
+// ShareBranch creates a read-only role in a branch that can log in for ttlHours (0 = 24, at most 168)
+func (c *Client) ShareBranch(ctx context.Context, branchID string, ttlHours int, note string) (*SharedBranch, error) {
+	req := struct {
+		TTLHours int    `json:"ttl_hours,omitempty"`
+		Note     string `json:"note,omitempty"`
+	}{TTLHours: ttlHours, Note: note}
+	var shared SharedBranch
+	if err := c.do(ctx, http.MethodPost, "/api/branches/"+pathEscape(branchID)+"/share", nil, req, &shared); err != nil {
+		return nil, err
+	}
+	return &shared, nil
+}
+
+// ListBranchShares returns the shares of a branch, newest first
+func (c *Client) ListBranchShares(ctx context.Context, branchID string) ([]BranchShare, error) {
+	var shares []BranchShare
+	if err := c.do(ctx, http.MethodGet, "/api/branches/"+pathEscape(branchID)+"/shares", nil, nil, &shares); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// RevokeBranchShare drops a share's role and terminates its connections before it expires
+func (c *Client) RevokeBranchShare(ctx context.Context, branchID, id string) (*BranchShare, error) {
+	var share BranchShare
+	if err := c.do(ctx, http.MethodDelete, "/api/branches/"+pathEscape(branchID)+"/shares/"+pathEscape(id), nil, nil, &share); err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
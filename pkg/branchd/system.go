@@ -0,0 +1,583 @@
+package branchd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SystemInfo contains VM, storage and source database information
+type SystemInfo struct {
+	Version        string           `json:"version"`
+	VM             VMMetrics        `json:"vm"`
+	SourceDatabase *DatabaseMetrics `json:"source_database,omitempty"`
+	Redis          *RedisMetrics    `json:"redis,omitempty"`
+	Queue          *QueueStatus     `json:"queue,omitempty"` // Omitted without Redis
+	Storage        *StorageUsage    `json:"storage,omitempty"`
+	Capacity       *Capacity        `json:"capacity,omitempty"` // Omitted before onboarding
+	Worker         WorkerQueues     `json:"worker"`
+}
+
+// Capacity is the server's headroom for new branches, branch creation fails with status 503
+// (code "capacity_exceeded") while it doesn't admit them
+type Capacity struct {
+	Admits  bool     `json:"admits"`
+	Reasons []string `json:"reasons,omitempty"` // Why branches are rejected
+
+	Memory *CapacityHeadroom `json:"memory,omitempty"` // Available memory in MB
+	Load   *CapacityHeadroom `json:"load,omitempty"`   // 1-minute load average per CPU core in percent
+	Disk   *CapacityHeadroom `json:"disk,omitempty"`   // Free ZFS space in percent
+}
+
+// CapacityHeadroom is a resource's current value against its admission control threshold
+type CapacityHeadroom struct {
+	Current  float64 `json:"current"`
+	Limit    float64 `json:"limit"`    // 0 = not checked
+	Headroom float64 `json:"headroom"` // Negative once the limit is crossed
+}
+
+// QueueStatus is whether Redis accepts tasks
+type QueueStatus struct {
+	Available        bool       `json:"available"`
+	UnavailableSince *time.Time `json:"unavailable_since,omitempty"`
+	Error            string     `json:"error,omitempty"`
+	BufferedTasks    int64      `json:"buffered_tasks"` // Restore triggers waiting for Redis, enqueued once it's back
+}
+
+// Readiness is whether the server can serve requests and start tasks
+type Readiness struct {
+	Status        string       `json:"status"` // "ready", "degraded" (Redis unavailable, restore triggers are buffered) or "unavailable"
+	Database      bool         `json:"database"`
+	DatabaseError string       `json:"database_error,omitempty"`
+	Queue         *QueueStatus `json:"queue,omitempty"` // Omitted without Redis
+}
+
+// WorkerQueues reports how the worker prioritizes tasks: critical (branch operations), default and low
+// (restore progress polls, refreshes) queues picked in proportion to their weights
+type WorkerQueues struct {
+	Weights        map[string]int    `json:"weights"`
+	StrictPriority bool              `json:"strict_priority"` // Lower queues only run while higher ones are empty
+	TaskQueues     map[string]string `json:"task_queues"`     // Queue per task type, e.g. "branch:create" -> "critical"
+}
+
+// StorageUsage contains the data pool's space use by restores and branches
+type StorageUsage struct {
+	UsedBytes         int64   `json:"used_bytes"`
+	AvailableBytes    int64   `json:"available_bytes"`
+	CompressRatio     float64 `json:"compress_ratio"`
+	RestoresUsedBytes int64   `json:"restores_used_bytes"`
+	BranchesUsedBytes int64   `json:"branches_used_bytes"` // Space written by branches, data shared with restores is not counted
+	BranchCount       int     `json:"branch_count"`
+}
+
+// RedisMetrics contains Redis memory use and task queue sizes
+type RedisMetrics struct {
+	UsedMemoryBytes    int64          `json:"used_memory_bytes"`
+	PeakMemoryBytes    int64          `json:"peak_memory_bytes"`
+	MaxMemoryBytes     int64          `json:"max_memory_bytes"` // 0 = no limit
+	TaskMemoryBytes    int64          `json:"task_memory_bytes"`
+	Queues             []QueueMetrics `json:"queues"`
+	CompletedRetention string         `json:"completed_retention"`
+	ArchivedRetention  string         `json:"archived_retention"`
+}
+
+// QueueMetrics contains the task counts and approximate memory of one task queue
+type QueueMetrics struct {
+	Queue       string `json:"queue"`
+	MemoryBytes int64  `json:"memory_bytes"`
+	Pending     int    `json:"pending"`
+	Active      int    `json:"active"`
+	Scheduled   int    `json:"scheduled"`
+	Retry       int    `json:"retry"`
+	Archived    int    `json:"archived"`
+	Completed   int    `json:"completed"`
+}
+
+// VMMetrics contains VM resource information
+type VMMetrics struct {
+	CPUCount        int     `json:"cpu_count"`
+	MemoryTotalGB   float64 `json:"memory_total_gb"`
+	MemoryUsedGB    float64 `json:"memory_used_gb"`
+	MemoryFreeGB    float64 `json:"memory_free_gb"`
+	DiskTotalGB     float64 `json:"disk_total_gb"`
+	DiskUsedGB      float64 `json:"disk_used_gb"`
+	DiskAvailableGB float64 `json:"disk_available_gb"`
+	DiskUsedPercent float64 `json:"disk_used_percent"`
+}
+
+// DatabaseMetrics contains source database information
+type DatabaseMetrics struct {
+	Name         string  `json:"name"`
+	Version      string  `json:"version"`
+	MajorVersion int     `json:"major_version"`
+	SizeGB       float64 `json:"size_gb"`
+	Connected    bool    `json:"connected"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// LatestVersion contains the latest available release
+type LatestVersion struct {
+	LatestVersion   string     `json:"latest_version"`
+	CurrentVersion  string     `json:"current_version"`
+	UpdateAvailable bool       `json:"update_available"`
+	LastCheckedAt   *time.Time `json:"last_checked_at"` // Last successful lookup on GitHub, cached for an hour
+	ChecksDisabled  bool       `json:"checks_disabled"` // Update checks are disabled in the config
+	Error           string     `json:"error,omitempty"` // Why the last lookup failed
+}
+
+// UpdateServerResponse is returned by UpdateServer
+type UpdateServerResponse struct {
+	Message        string `json:"message"`
+	Version        string `json:"version,omitempty"`         // Set when already on the latest version
+	CurrentVersion string `json:"current_version,omitempty"` // Set when an update was initiated
+	NewVersion     string `json:"new_version,omitempty"`
+}
+
+// Config is the server configuration
+type Config struct {
+	ID                        string     `json:"id"`
+	ConnectionString          string     `json:"connection_string"`
+	DemoMode                  bool       `json:"demo_mode"` // The source is the bundled sample database, see StartDemo
+	PostgresVersion           string     `json:"postgres_version"`
+	TargetPostgresVersion     string     `json:"target_postgres_version"`
+	SchemaOnly                bool       `json:"schema_only"`
+	RefreshSchedule           string     `json:"refresh_schedule"`
+	RefreshMode               string     `json:"refresh_mode"`
+	RefreshWindows            string     `json:"refresh_windows"`
+	RefreshForced             bool       `json:"refresh_forced"`
+	BranchPostgresqlConf      string     `json:"branch_postgresql_conf"`
+	DatabaseName              string     `json:"database_name"`
+	Domain                    string     `json:"domain"`
+	LetsEncryptEmail          string     `json:"lets_encrypt_email"`
+	MaxRestores               int        `json:"max_restores"`
+	RestoreMaxAgeDays         int        `json:"restore_max_age_days"`
+	RestoreKeepLatest         int        `json:"restore_keep_latest"`
+	MaxConcurrentRestores     int        `json:"max_concurrent_restores"`
+	RestoreQueuePolicy        string     `json:"restore_queue_policy"`
+	RestoreDeadlineHours      int        `json:"restore_deadline_hours"`
+	BranchIdleSuspendHours    int        `json:"branch_idle_suspend_hours"`
+	BranchDiskQuotaGB         int        `json:"branch_disk_quota_gb"`
+	BranchAllowedCIDRs        string     `json:"branch_allowed_cidrs"`
+	UpdateChecksDisabled      bool       `json:"update_checks_disabled"`
+	LastRefreshedAt           *time.Time `json:"last_refreshed_at"`
+	NextRefreshAt             *time.Time `json:"next_refresh_at"`
+	CreatedAt                 time.Time  `json:"created_at"`
+	CrunchyBridgeAPIKey       string     `json:"crunchy_bridge_api_key"`
+	CrunchyBridgeClusterName  string     `json:"crunchy_bridge_cluster_name"`
+	CrunchyBridgeDatabaseName string     `json:"crunchy_bridge_database_name"`
+	PgBackRestStanza          string     `json:"pgbackrest_stanza"`
+	PgBackRestRepoPath        string     `json:"pgbackrest_repo_path"`
+	PgBackRestS3Bucket        string     `json:"pgbackrest_s3_bucket"`
+	PgBackRestS3Endpoint      string     `json:"pgbackrest_s3_endpoint"`
+	PgBackRestS3Region        string     `json:"pgbackrest_s3_region"`
+	PgBackRestS3Key           string     `json:"pgbackrest_s3_key"`
+	PgBackRestS3KeySecret     string     `json:"pgbackrest_s3_key_secret"` // Redacted
+	PgBackRestCipherPass      string     `json:"pgbackrest_cipher_pass"`   // Redacted
+	PgBackRestDatabaseName    string     `json:"pgbackrest_database_name"`
+	PostRestoreSQL            string     `json:"post_restore_sql"`
+	SeedSQL                   string     `json:"seed_sql"`
+	PostBranchSQL             string     `json:"post_branch_sql"`
+	ReportTrackedTables       string     `json:"report_tracked_tables"`
+	RestoreIncludeTables      string     `json:"restore_include_tables"`
+	RestoreExcludeTables      string     `json:"restore_exclude_tables"`
+	RestoreTableSamples       string     `json:"restore_table_samples"`
+	GitHubWebhookSecret       string     `json:"github_webhook_secret"`    // "***" when set
+	NotificationWebhookURL    string     `json:"notification_webhook_url"` // "***" when set
+	SMTPHost                  string     `json:"smtp_host"`
+	SMTPPort                  int        `json:"smtp_port"`
+	SMTPUsername              string     `json:"smtp_username"`
+	SMTPPassword              string     `json:"smtp_password"` // "***" when set
+	SMTPFrom                  string     `json:"smtp_from"`
+	NotifyRestoreHours        int        `json:"notify_restore_hours"`
+	NotifyDiskFreePercent     int        `json:"notify_disk_free_percent"`
+	CapacityMinMemoryMB       int        `json:"capacity_min_memory_mb"`
+	CapacityMaxLoadPercent    int        `json:"capacity_max_load_percent"`
+	CapacityMinDiskPercent    int        `json:"capacity_min_disk_percent"`
+	OIDCIssuerURL             string     `json:"oidc_issuer_url"`
+	OIDCClientID              string     `json:"oidc_client_id"`
+	OIDCClientSecret          string     `json:"oidc_client_secret"` // "***" when set
+	OIDCAdminGroups           string     `json:"oidc_admin_groups"`
+	PurgeKeyColumns           string     `json:"purge_key_columns"`
+	Extensions                string     `json:"extensions"`
+}
+
+// UpdateConfigRequest is a partial configuration update
+// Empty strings and nil pointers leave the current value unchanged
+type UpdateConfigRequest struct {
+	ConnectionString          string  `json:"connectionString,omitempty"`
+	PostgresVersion           string  `json:"postgresVersion,omitempty"`
+	TargetPostgresVersion     *string `json:"targetPostgresVersion,omitempty"` // Major version of restores and branches (e.g. "16" for a 14 source), "" = the source's
+	SchemaOnly                *bool   `json:"schemaOnly,omitempty"`
+	RefreshSchedule           string  `json:"refreshSchedule,omitempty"`
+	RefreshMode               string  `json:"refreshMode,omitempty"`    // "full" or "incremental"
+	RefreshWindows            *string `json:"refreshWindows,omitempty"` // UTC ranges scheduled refreshes may start in, e.g. "01:00-05:00,22:00-02:00", "" = any time
+	Domain                    string  `json:"domain,omitempty"`
+	LetsEncryptEmail          string  `json:"letsEncryptEmail,omitempty"`
+	MaxRestores               *int    `json:"maxRestores,omitempty"`
+	RestoreMaxAgeDays         *int    `json:"restoreMaxAgeDays,omitempty"`      // Restores older than this many days are deleted, 0 = no age limit
+	RestoreKeepLatest         *int    `json:"restoreKeepLatest,omitempty"`      // Newest data-ready restores never deleted by retention
+	MaxConcurrentRestores     *int    `json:"maxConcurrentRestores,omitempty"`  // Restores running at once, 0 = unlimited
+	RestoreQueuePolicy        string  `json:"restoreQueuePolicy,omitempty"`     // "queue" (wait for a free slot) or "reject"
+	RestoreDeadlineHours      *int    `json:"restoreDeadlineHours,omitempty"`   // Running restores are stopped after this many hours, 0 = no deadline
+	BranchIdleSuspendHours    *int    `json:"branchIdleSuspendHours,omitempty"` // 0 = never suspend idle branches
+	BranchDiskQuotaGB         *int    `json:"branchDiskQuotaGB,omitempty"`      // Default ZFS refquota of new branches in GB, 0 = none
+	BranchAllowedCIDRs        *string `json:"branchAllowedCIDRs,omitempty"`     // Comma-separated networks branch ports are open to, empty = anywhere
+	BranchPostgresqlConf      *string `json:"branchPostgresqlConf,omitempty"`   // postgresql.conf lines for new branches, memory settings are capped per VM size
+	UpdateChecksDisabled      *bool   `json:"updateChecksDisabled,omitempty"`   // Disables GitHub lookups of the latest release, for air-gapped installs
+	CrunchyBridgeAPIKey       string  `json:"crunchyBridgeApiKey,omitempty"`
+	CrunchyBridgeClusterName  string  `json:"crunchyBridgeClusterName,omitempty"`
+	CrunchyBridgeDatabaseName string  `json:"crunchyBridgeDatabaseName,omitempty"`
+	PgBackRestStanza          *string `json:"pgBackRestStanza,omitempty"`   // Restores from a self-hosted pgBackRest repository, empty = switch to another source
+	PgBackRestRepoPath        *string `json:"pgBackRestRepoPath,omitempty"` // repo1-path, e.g. /var/lib/pgbackrest
+	PgBackRestS3Bucket        *string `json:"pgBackRestS3Bucket,omitempty"` // Empty = posix repository (local disk or NFS mount)
+	PgBackRestS3Endpoint      *string `json:"pgBackRestS3Endpoint,omitempty"`
+	PgBackRestS3Region        *string `json:"pgBackRestS3Region,omitempty"`
+	PgBackRestS3Key           *string `json:"pgBackRestS3Key,omitempty"` // Empty = instance credentials
+	PgBackRestS3KeySecret     *string `json:"pgBackRestS3KeySecret,omitempty"`
+	PgBackRestCipherPass      *string `json:"pgBackRestCipherPass,omitempty"` // Empty = unencrypted repository
+	PgBackRestDatabaseName    *string `json:"pgBackRestDatabaseName,omitempty"`
+	PostRestoreSQL            *string `json:"postRestoreSQL,omitempty"`
+	SeedSQL                   *string `json:"seedSQL,omitempty"`       // Run after anonymization and after every refresh, so it must be idempotent
+	PostBranchSQL             *string `json:"postBranchSQL,omitempty"` // Run in every new branch, e.g. to create app roles or truncate queue tables
+	ReportTrackedTables       *string `json:"reportTrackedTables,omitempty"`
+	RestoreIncludeTables      *string `json:"restoreIncludeTables,omitempty"`   // Comma-separated pg_dump table patterns, empty = all tables
+	RestoreExcludeTables      *string `json:"restoreExcludeTables,omitempty"`   // Tables restored without data
+	RestoreTableSamples       *string `json:"restoreTableSamples,omitempty"`    // Tables restored with a row limit, e.g. "public.events:10000"
+	GitHubWebhookSecret       *string `json:"githubWebhookSecret,omitempty"`    // Secret of the GitHub pull request webhook, empty disables it
+	NotificationWebhookURL    *string `json:"notificationWebhookUrl,omitempty"` // Slack-compatible webhook notifying branch owners, empty = only logged
+	SMTPHost                  *string `json:"smtpHost,omitempty"`               // SMTP server emailing admins about failed refreshes, slow restores and low disk space, empty = only logged
+	SMTPPort                  *int    `json:"smtpPort,omitempty"`               // 465 = implicit TLS, otherwise STARTTLS when offered
+	SMTPUsername              *string `json:"smtpUsername,omitempty"`           // Empty = no authentication
+	SMTPPassword              *string `json:"smtpPassword,omitempty"`
+	SMTPFrom                  *string `json:"smtpFrom,omitempty"`               // Sender address, required with smtpHost
+	NotifyRestoreHours        *int    `json:"notifyRestoreHours,omitempty"`     // Admins are emailed about restores running longer, 0 = never
+	NotifyDiskFreePercent     *int    `json:"notifyDiskFreePercent,omitempty"`  // Admins are emailed when less ZFS space is free, 0 = never
+	CapacityMinMemoryMB       *int    `json:"capacityMinMemoryMB,omitempty"`    // Branches aren't created with less memory available, 0 = not checked
+	CapacityMaxLoadPercent    *int    `json:"capacityMaxLoadPercent,omitempty"` // or a higher load average (100 = one runnable process per CPU core)
+	CapacityMinDiskPercent    *int    `json:"capacityMinDiskPercent,omitempty"` // or less ZFS free space
+	OIDCIssuerURL             *string `json:"oidcIssuerUrl,omitempty"`          // OpenID Connect issuer for SSO login (e.g. Okta), empty disables it
+	OIDCClientID              *string `json:"oidcClientId,omitempty"`
+	OIDCClientSecret          *string `json:"oidcClientSecret,omitempty"`
+	OIDCAdminGroups           *string `json:"oidcAdminGroups,omitempty"` // Comma-separated groups whose members are admins
+	PurgeKeyColumns           *string `json:"purgeKeyColumns,omitempty"` // Columns identifying a data subject's rows, e.g. "public.orders.user_id,public.users.id"
+	Extensions                *string `json:"extensions,omitempty"`      // Extensions created in every restore and branch, e.g. "vector,postgis,pg_trgm,uuid-ossp"
+}
+
+// Health checks that the server is up (no authentication required)
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/health", nil, nil, nil)
+}
+
+// Ready returns whether the database and Redis can be reached (no authentication required)
+// An unreachable database is returned as an APIError with status 503
+func (c *Client) Ready(ctx context.Context) (*Readiness, error) {
+	var readiness Readiness
+	if err := c.do(ctx, http.MethodGet, "/health/ready", nil, nil, &readiness); err != nil {
+		return nil, err
+	}
+	return &readiness, nil
+}
+
+// SystemInfo returns VM metrics and source database information
+func (c *Client) SystemInfo(ctx context.Context) (*SystemInfo, error) {
+	var info SystemInfo
+	if err := c.do(ctx, http.MethodGet, "/api/system/info", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// LatestVersion checks for a newer Branchd release
+func (c *Client) LatestVersion(ctx context.Context) (*LatestVersion, error) {
+	var version LatestVersion
+	if err := c.do(ctx, http.MethodGet, "/api/system/latest-version", nil, nil, &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// UpdateServer updates the server to the latest release (the server restarts shortly after)
+func (c *Client) UpdateServer(ctx context.Context) (*UpdateServerResponse, error) {
+	var resp UpdateServerResponse
+	if err := c.do(ctx, http.MethodPost, "/api/system/update", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LogLevels are the log levels of the server process
+type LogLevels struct {
+	Default    string            `json:"default"`
+	Components map[string]string `json:"components"` // Components logging at their own level
+}
+
+// LogLevels returns the server's log levels (admin only)
+func (c *Client) LogLevels(ctx context.Context) (*LogLevels, error) {
+	var levels LogLevels
+	if err := c.do(ctx, http.MethodGet, "/api/system/log-levels", nil, nil, &levels); err != nil {
+		return nil, err
+	}
+	return &levels, nil
+}
+
+// SetLogLevel changes the level of a component, or the default level if component is empty,
+// until the server restarts; an empty level resets the component to the default (admin only)
+func (c *Client) SetLogLevel(ctx context.Context, component, level string) (*LogLevels, error) {
+	req := struct {
+		Component string `json:"component,omitempty"`
+		Level     string `json:"level"`
+	}{Component: component, Level: level}
+
+	var levels LogLevels
+	if err := c.do(ctx, http.MethodPut, "/api/system/log-level", nil, req, &levels); err != nil {
+		return nil, err
+	}
+	return &levels, nil
+}
+
+// DatabaseBackup is an archive of the server's SQLite database and configuration
+type DatabaseBackup struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"` // On the server
+	SizeBytes int64     `json:"size_bytes"`
+	S3URL     string    `json:"s3_url,omitempty"` // s3://bucket/key of the uploaded copy
+	Deleted   []string  `json:"deleted"`          // Older archives deleted past the server's BACKUP_KEEP
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BackupDatabase archives the server's SQLite database, restored with branchd-server --restore-backup (admin only)
+func (c *Client) BackupDatabase(ctx context.Context) (*DatabaseBackup, error) {
+	var backup DatabaseBackup
+	if err := c.do(ctx, http.MethodPost, "/api/system/backup", nil, nil, &backup); err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// ReconcileOrphan is a resource on the server without the restore or branch record it belongs to
+type ReconcileOrphan struct {
+	Kind   string `json:"kind"`             // dataset, unit, process, port or firewall
+	Name   string `json:"name"`             // Dataset, unit, PID or port
+	Owner  string `json:"owner,omitempty"`  // Name of the restore or branch the resource was created for, if known
+	Detail string `json:"detail,omitempty"` // e.g. the mountpoint of a dataset or the data directory of a process
+	Fixed  bool   `json:"fixed"`
+	Error  string `json:"error,omitempty"` // Why it couldn't be cleaned up
+}
+
+// ReconcileMissing is a restore or branch record whose dataset is gone
+type ReconcileMissing struct {
+	Kind    string `json:"kind"` // "restore" or "branch"
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Dataset string `json:"dataset"`
+}
+
+// ReconcileReport lists the server's resources and records that don't match
+type ReconcileReport struct {
+	Orphans   []ReconcileOrphan  `json:"orphans"`
+	Missing   []ReconcileMissing `json:"missing"`
+	Errors    []string           `json:"errors"` // Resources that couldn't be listed
+	Fix       bool               `json:"fix"`    // Orphans were cleaned up
+	CheckedAt time.Time          `json:"checked_at"`
+}
+
+// Reconcile compares the server's datasets, units, processes and ports against its records (admin only)
+func (c *Client) Reconcile(ctx context.Context) (*ReconcileReport, error) {
+	var report ReconcileReport
+	if err := c.do(ctx, http.MethodGet, "/api/system/reconcile", nil, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// FixOrphans compares like Reconcile and cleans the orphans up (admin only)
+func (c *Client) FixOrphans(ctx context.Context) (*ReconcileReport, error) {
+	var report ReconcileReport
+	if err := c.do(ctx, http.MethodPost, "/api/system/reconcile", nil, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// GetConfig returns the server configuration
+func (c *Client) GetConfig(ctx context.Context) (*Config, error) {
+	var config Config
+	if err := c.do(ctx, http.MethodGet, "/api/config", nil, nil, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// UpdateConfig applies a partial configuration update and returns the resulting configuration
+func (c *Client) UpdateConfig(ctx context.Context, req UpdateConfigRequest) (*Config, error) {
+	var config Config
+	if err := c.do(ctx, http.MethodPatch, "/api/config", nil, req, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// TestEmail emails all admins through the configured SMTP server
+// Returns an APIError with status 400 without an SMTP server and 502 when sending fails
+func (c *Client) TestEmail(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/api/config/test-email", nil, nil, nil)
+}
+
+// StartDemo restores the bundled sample database instead of a production source and creates a "demo" branch once
+// it's ready. Only available before another source is configured
+func (c *Client) StartDemo(ctx context.Context) (*TriggerRestoreResponse, error) {
+	var resp TriggerRestoreResponse
+	if err := c.do(ctx, http.MethodPost, "/api/config/demo", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ConnectionCheck is the result of one step of TestConnection
+type ConnectionCheck struct {
+	Name       string `json:"name"`   // parse, dns, tcp, tls, auth, privileges, size or wal_level
+	Status     string `json:"status"` // pass, warn, fail or skip
+	Message    string `json:"message"`
+	Hint       string `json:"hint,omitempty"` // How to fix a failure or warning
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// ConnectionReport is returned by TestConnection
+type ConnectionReport struct {
+	OK     bool              `json:"ok"` // No check failed, warnings don't count
+	Checks []ConnectionCheck `json:"checks"`
+}
+
+// TestConnection checks a candidate source connection string step by step without saving it
+// A failing connection is reported in the checks, not as an error
+func (c *Client) TestConnection(ctx context.Context, connectionString string) (*ConnectionReport, error) {
+	req := struct {
+		ConnectionString string `json:"connectionString"`
+	}{ConnectionString: connectionString}
+
+	var report ConnectionReport
+	if err := c.do(ctx, http.MethodPost, "/api/diagnostics/test-connection", nil, req, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// BranchOwner lists the branches of one user that a decommission deletes
+type BranchOwner struct {
+	UserID   string   `json:"user_id"`
+	Email    string   `json:"email"`
+	Branches []string `json:"branches"`
+	Notified bool     `json:"notified"` // The server's notification webhook reached the owner
+}
+
+// DecommissionPreview is returned by RequestDecommission
+type DecommissionPreview struct {
+	ConfirmationToken string        `json:"confirmation_token"` // Pass to Decommission, valid for 10 minutes
+	ExpiresAt         time.Time     `json:"expires_at"`
+	Branches          int           `json:"branches"`
+	Restores          int           `json:"restores"`
+	BranchOwners      []BranchOwner `json:"branch_owners"`
+}
+
+// DecommissionResult reports what a decommission removed
+type DecommissionResult struct {
+	BranchesDeleted   []string      `json:"branches_deleted"`
+	RestoresDeleted   []string      `json:"restores_deleted"`
+	DatasetsDestroyed []string      `json:"datasets_destroyed"`
+	BackupsDeleted    []string      `json:"backups_deleted"`
+	BranchOwners      []BranchOwner `json:"branch_owners"`
+	Errors            []string      `json:"errors"`
+	AuditEvents       []AuditEvent  `json:"audit_events"` // Final export of the audit log, oldest first
+}
+
+// Decommission statuses (DecommissionStatus.Status)
+const (
+	DecommissionPending   = "pending"
+	DecommissionRunning   = "running"
+	DecommissionCompleted = "completed"
+	DecommissionFailed    = "failed"
+)
+
+// DecommissionStatus is the progress of a decommission started with StartDecommission
+type DecommissionStatus struct {
+	ID     string              `json:"id"`
+	Status string              `json:"status"`
+	Error  string              `json:"error,omitempty"`  // Why a failed decommission stopped
+	Result *DecommissionResult `json:"result,omitempty"` // Set once completed
+}
+
+// decommissionPollInterval is how often Decommission checks on a started decommission
+const decommissionPollInterval = 2 * time.Second
+
+// RequestDecommission returns a confirmation token for Decommission and what it would delete (admin only)
+func (c *Client) RequestDecommission(ctx context.Context) (*DecommissionPreview, error) {
+	var preview DecommissionPreview
+	if err := c.do(ctx, http.MethodPost, "/api/system/decommission/confirmation", nil, nil, &preview); err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// StartDecommission starts deleting all branches and restores, clearing stored credentials and revoking
+// all tokens, including the client's own (admin only)
+// The decommission runs on the server, poll it with GetDecommission or WaitForDecommission
+func (c *Client) StartDecommission(ctx context.Context, confirmationToken string) (*DecommissionStatus, error) {
+	req := struct {
+		ConfirmationToken string `json:"confirmation_token"`
+	}{ConfirmationToken: confirmationToken}
+
+	var status DecommissionStatus
+	if err := c.do(ctx, http.MethodPost, "/api/system/decommission", nil, req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetDecommission returns the progress of a decommission, it needs no token
+func (c *Client) GetDecommission(ctx context.Context, id string) (*DecommissionStatus, error) {
+	var status DecommissionStatus
+	if err := c.do(ctx, http.MethodGet, "/api/system/decommission/"+pathEscape(id), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// WaitForDecommission polls a decommission until it completed or failed, or ctx is done
+// When some steps failed, the partial result is returned together with the error
+func (c *Client) WaitForDecommission(ctx context.Context, id string, interval time.Duration) (*DecommissionResult, error) {
+	for {
+		status, err := c.GetDecommission(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch status.Status {
+		case DecommissionFailed:
+			return nil, fmt.Errorf("decommission failed: %s", status.Error)
+		case DecommissionCompleted:
+			if status.Result == nil {
+				return nil, fmt.Errorf("decommission completed without a result")
+			}
+			if len(status.Result.Errors) > 0 {
+				return status.Result, fmt.Errorf("decommission incomplete: %s", strings.Join(status.Result.Errors, "; "))
+			}
+			return status.Result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Decommission starts a decommission and waits for it (see StartDecommission and WaitForDecommission)
+func (c *Client) Decommission(ctx context.Context, confirmationToken string) (*DecommissionResult, error) {
+	status, err := c.StartDecommission(ctx, confirmationToken)
+	if err != nil {
+		return nil, err
+	}
+	return c.WaitForDecommission(ctx, status.ID, decommissionPollInterval)
+}
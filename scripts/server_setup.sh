@@ -421,10 +421,11 @@ sudo tee /etc/logrotate.d/branchd-system > /dev/null << 'EOF'
 }
 EOF
 
-# Configure log rotation for branchd restore logs
-echo "Configuring log rotation for branchd restore logs..."
+# Configure log rotation for branchd restore and branch logs
+echo "Configuring log rotation for branchd restore and branch logs..."
 sudo tee /etc/logrotate.d/branchd-restore > /dev/null << 'EOF'
 /var/log/branchd/restore-*.log
+/var/log/branchd/branch-*.log
 {
     # Rotate when file reaches 50MB
     size 50M
@@ -761,8 +762,16 @@ echo "✓ Caddy installed and configured (will start on first boot)"
 
 echo "=== Branchd Installation ==="
 
-# Hardcoded for ARM64 Ubuntu 24.04 deployment
-BRANCHD_ARCH="arm64"
+# Pick the bundle matching the host architecture
+case "$(uname -m)" in
+    aarch64|arm64) BRANCHD_ARCH="arm64" ;;
+    x86_64|amd64) BRANCHD_ARCH="amd64" ;;
+    *)
+        echo "ERROR: Unsupported architecture: $(uname -m) (Branchd supports arm64 and amd64)"
+        exit 1
+        ;;
+esac
+echo "Detected architecture: ${BRANCHD_ARCH}"
 
 # Download latest release from GitHub
 GITHUB_REPO="branchd-dev/branchd"
@@ -869,6 +878,9 @@ Group=root
 WorkingDirectory=/usr/local/bin
 
 # Binary
+# For a single service, use "branchd-server --all-in-one" and disable branchd-worker
+# Without Redis, set REDIS_ADDRESS= (empty): the server processes tasks itself and branchd-worker isn't used
+# To reach every branch on one port, set PROXY_ADDRESS (e.g. 0.0.0.0:5432) and open only that port
 ExecStart=/usr/local/bin/branchd-server
 
 # Restart policy
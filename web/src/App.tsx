@@ -5,6 +5,7 @@ import { DashboardPage } from "./pages/DashboardPage";
 import { SettingsPage } from "./pages/SettingsPage";
 import { AnonRulesPage } from "./pages/AnonRulesPage";
 import { UsersPage } from "./pages/UsersPage";
+import { TwoFactorPage } from "./pages/TwoFactorPage";
 import { DashboardLayout } from "./DashboardLayout";
 import { auth } from "@/lib/auth";
 
@@ -82,6 +83,14 @@ export function App() {
           </ProtectedRoute>
         }
       />
+      <Route
+        path="/two-factor"
+        element={
+          <ProtectedRoute>
+            <TwoFactorPage />
+          </ProtectedRoute>
+        }
+      />
     </Routes>
   );
 }
@@ -29,6 +29,9 @@ interface User {
   email: string;
   name: string;
   is_admin: boolean;
+  sso_linked?: boolean;
+  two_factor_enabled?: boolean;
+  two_factor_deadline?: string;
 }
 
 export function DashboardLayout({ children }: DashboardLayoutProps) {
@@ -39,6 +42,7 @@ export function DashboardLayout({ children }: DashboardLayoutProps) {
   const [updateAvailable, setUpdateAvailable] = useState<boolean>(false);
   const [showUpdateDialog, setShowUpdateDialog] = useState<boolean>(false);
   const [isUpdating, setIsUpdating] = useState<boolean>(false);
+  const [ssoEnabled, setSsoEnabled] = useState<boolean>(false);
 
   useEffect(() => {
     // Fetch current user info to determine admin status
@@ -54,6 +58,19 @@ export function DashboardLayout({ children }: DashboardLayoutProps) {
     fetchCurrentUser();
   }, [api.api]);
 
+  useEffect(() => {
+    const fetchOIDCStatus = async () => {
+      try {
+        const response = await api.api.authOidcList();
+        setSsoEnabled(response.data.enabled || false);
+      } catch (err) {
+        console.error("Failed to fetch SSO status:", err);
+      }
+    };
+
+    fetchOIDCStatus();
+  }, [api.api]);
+
   useEffect(() => {
     // Check for updates
     const checkForUpdates = async () => {
@@ -78,6 +95,19 @@ export function DashboardLayout({ children }: DashboardLayoutProps) {
     auth.logout();
   };
 
+  const handleLinkSso = async () => {
+    try {
+      // Signing in with the provider links it to this account
+      const response = await api.api.authOidcLinkCreate();
+      if (response.data.login_url) {
+        window.location.assign(response.data.login_url);
+      }
+    } catch (err) {
+      console.error("Failed to link SSO account:", err);
+      alert("Failed to link SSO account. Please try again.");
+    }
+  };
+
   const handleUpdateClick = () => {
     if (updateAvailable) {
       setShowUpdateDialog(true);
@@ -151,8 +181,8 @@ export function DashboardLayout({ children }: DashboardLayoutProps) {
           </div>
 
           <div className="flex items-center gap-2">
-            {/* Version button with update indicator */}
-            {currentVersion && (
+            {/* Version button with update indicator (updating is admin only) */}
+            {currentVersion && currentUser?.is_admin && (
               <Button
                 variant={updateAvailable ? "default" : "ghost"}
                 size="sm"
@@ -182,6 +212,14 @@ export function DashboardLayout({ children }: DashboardLayoutProps) {
                 </Button>
               </DropdownMenuTrigger>
               <DropdownMenuContent align="end">
+                <DropdownMenuItem asChild>
+                  <Link to="/two-factor">Two-factor authentication</Link>
+                </DropdownMenuItem>
+                {ssoEnabled && currentUser && !currentUser.sso_linked && (
+                  <DropdownMenuItem onClick={handleLinkSso}>
+                    Link SSO account
+                  </DropdownMenuItem>
+                )}
                 <DropdownMenuItem onClick={handleLogout}>
                   Log out
                 </DropdownMenuItem>
@@ -191,6 +229,19 @@ export function DashboardLayout({ children }: DashboardLayoutProps) {
         </div>
       </header>
 
+      {/* Admins have to enroll an authenticator before their grace period ends */}
+      {currentUser?.is_admin && !currentUser.two_factor_enabled && (
+        <div className="border-b bg-muted px-6 py-2 text-sm">
+          Admin pages require two-factor authentication
+          {currentUser.two_factor_deadline &&
+            ` after ${new Date(currentUser.two_factor_deadline).toLocaleString()}`}
+          .{" "}
+          <Link to="/two-factor" className="underline">
+            Set up an authenticator
+          </Link>
+        </div>
+      )}
+
       {/* Update confirmation dialog */}
       <AlertDialog open={showUpdateDialog} onOpenChange={setShowUpdateDialog}>
         <AlertDialogContent>
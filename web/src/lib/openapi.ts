@@ -37,7 +37,10 @@ export interface GithubComBranchdDevBranchdInternalModelsRestore {
   created_at?: string;
   data_ready?: boolean;
   id?: string;
+  label?: string;
   name?: string;
+  note?: string;
+  pinned?: boolean;
   port?: number;
   ready_at?: string;
   schema_only?: boolean;
@@ -78,10 +81,14 @@ export interface InternalServerConfigResponse {
   lets_encrypt_email?: string;
   max_restores?: number;
   next_refresh_at?: string;
+  post_branch_sql?: string;
   post_restore_sql?: string;
   postgres_version?: string;
   refresh_schedule?: string;
+  restore_keep_latest?: number;
+  restore_max_age_days?: number;
   schema_only?: boolean;
+  seed_sql?: string;
 }
 
 export interface InternalServerCreateAnonRuleRequest {
@@ -99,6 +106,7 @@ export interface InternalServerCreateBranchResponse {
   database?: string;
   host?: string;
   id?: string;
+  name?: string;
   password?: string;
   port?: number;
   user?: string;
@@ -133,6 +141,7 @@ export interface InternalServerLatestVersionResponse {
 export interface InternalServerLoginRequest {
   email: string;
   password: string;
+  totp_code?: string;
 }
 
 export interface InternalServerLoginResponse {
@@ -140,6 +149,15 @@ export interface InternalServerLoginResponse {
   user?: InternalServerUserDetail;
 }
 
+export interface InternalServerOIDCLinkResponse {
+  login_url?: string;
+}
+
+export interface InternalServerOIDCStatusResponse {
+  enabled?: boolean;
+  login_url?: string;
+}
+
 export interface InternalServerSetupRequest {
   email: string;
   name: string;
@@ -152,6 +170,15 @@ export interface InternalServerSystemInfoResponse {
   vm?: InternalServerVMMetrics;
 }
 
+export interface InternalServerTwoFactorSetupResponse {
+  otpauth_url?: string;
+  secret?: string;
+}
+
+export interface InternalServerTwoFactorVerifyRequest {
+  code: string;
+}
+
 export interface InternalServerUpdateAnonRulesRequest {
   rules: InternalServerCreateAnonRuleRequest[];
 }
@@ -164,10 +191,14 @@ export interface InternalServerUpdateConfigRequest {
   domain?: string;
   letsEncryptEmail?: string;
   maxRestores?: number;
+  postBranchSQL?: string;
   postRestoreSQL?: string;
   postgresVersion?: string;
   refreshSchedule?: string;
+  restoreKeepLatest?: number;
+  restoreMaxAgeDays?: number;
   schemaOnly?: boolean;
+  seedSQL?: string;
 }
 
 export interface InternalServerUserDetail {
@@ -176,6 +207,10 @@ export interface InternalServerUserDetail {
   id?: string;
   is_admin?: boolean;
   name?: string;
+  sso_linked?: boolean;
+  two_factor_deadline?: string;
+  two_factor_enabled?: boolean;
+  two_factor_verified?: boolean;
 }
 
 export interface InternalServerVMMetrics {
@@ -478,6 +513,29 @@ export class Api<
         ...params,
       }),
 
+    auth2FaSetupCreate: (params: RequestParams = {}) =>
+      this.request<InternalServerTwoFactorSetupResponse, Record<string, any>>({
+        path: `/api/auth/2fa/setup`,
+        method: "POST",
+        secure: true,
+        format: "json",
+        ...params,
+      }),
+
+    auth2FaVerifyCreate: (
+      request: InternalServerTwoFactorVerifyRequest,
+      params: RequestParams = {},
+    ) =>
+      this.request<InternalServerLoginResponse, Record<string, any>>({
+        path: `/api/auth/2fa/verify`,
+        method: "POST",
+        body: request,
+        secure: true,
+        type: ContentType.Json,
+        format: "json",
+        ...params,
+      }),
+
     authLoginCreate: (
       request: InternalServerLoginRequest,
       params: RequestParams = {},
@@ -500,6 +558,23 @@ export class Api<
         ...params,
       }),
 
+    authOidcList: (params: RequestParams = {}) =>
+      this.request<InternalServerOIDCStatusResponse, any>({
+        path: `/api/auth/oidc`,
+        method: "GET",
+        format: "json",
+        ...params,
+      }),
+
+    authOidcLinkCreate: (params: RequestParams = {}) =>
+      this.request<InternalServerOIDCLinkResponse, Record<string, any>>({
+        path: `/api/auth/oidc/link`,
+        method: "POST",
+        secure: true,
+        format: "json",
+        ...params,
+      }),
+
     branchesList: (params: RequestParams = {}) =>
       this.request<InternalServerBranchListResponse[], any>({
         path: `/api/branches`,
@@ -43,6 +43,7 @@ import {
   Clock,
   RotateCw,
   FileText,
+  Pin,
 } from "lucide-react";
 import {
   Card,
@@ -192,8 +193,12 @@ export function DashboardPage() {
         setCreatedBranch(null);
       }, 2000);
     } catch (err: any) {
+      // Invalid names explain the naming policy in details
+      const details = err.error?.details;
       setCreateError(
-        err.error?.error || err.message || "Failed to create branch",
+        details && err.status === 422
+          ? `${err.error.error}: ${details}`
+          : err.error?.error || err.message || "Failed to create branch",
       );
     } finally {
       setCreating(false);
@@ -611,6 +616,12 @@ export function DashboardPage() {
                     <TableCell className="font-mono text-sm">
                       <div className="flex items-center gap-2">
                         {restore.name}
+                        {restore.label && (
+                          <Badge variant="outline" title={restore.note || undefined}>
+                            {restore.pinned && <Pin className="h-3 w-3 mr-1" />}
+                            {restore.label}
+                          </Badge>
+                        )}
                         <Button
                           variant="ghost"
                           size="sm"
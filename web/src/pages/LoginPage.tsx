@@ -1,4 +1,4 @@
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { useNavigate } from "react-router";
 import {
   Card,
@@ -19,8 +19,40 @@ export function Login() {
   const api = useApi();
   const [email, setEmail] = useState("");
   const [password, setPassword] = useState("");
+  const [totpCode, setTotpCode] = useState("");
+  const [twoFactorRequired, setTwoFactorRequired] = useState(false);
   const [error, setError] = useState("");
   const [loading, setLoading] = useState(false);
+  const [ssoLoginUrl, setSsoLoginUrl] = useState("");
+
+  useEffect(() => {
+    // The SSO callback redirects here with #token=<JWT> or #error=<message>
+    const fragment = new URLSearchParams(window.location.hash.slice(1));
+    window.history.replaceState(null, "", window.location.pathname);
+    const token = fragment.get("token");
+    if (token) {
+      auth.setToken(token);
+      navigate("/", { replace: true });
+      return;
+    }
+    const ssoError = fragment.get("error");
+    if (ssoError) {
+      setError(ssoError);
+    }
+
+    const fetchOIDCStatus = async () => {
+      try {
+        const response = await api.api.authOidcList();
+        if (response.data.enabled && response.data.login_url) {
+          setSsoLoginUrl(response.data.login_url);
+        }
+      } catch (err) {
+        console.error("Failed to fetch SSO status:", err);
+      }
+    };
+
+    fetchOIDCStatus();
+  }, [api.api, navigate]);
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -28,7 +60,11 @@ export function Login() {
     setLoading(true);
 
     try {
-      const response = await api.api.authLoginCreate({ email, password });
+      const response = await api.api.authLoginCreate({
+        email,
+        password,
+        totp_code: twoFactorRequired ? totpCode : undefined,
+      });
 
       // Store token
       if (response.data.token) {
@@ -37,8 +73,20 @@ export function Login() {
 
       // Redirect to instances page
       navigate("/", { replace: true });
-    } catch (err) {
-      setError(err instanceof Error ? err.message : "Login failed");
+    } catch (err: any) {
+      // Users with two-factor authentication also enter a code of their authenticator app
+      if (err?.error?.two_factor_required) {
+        if (twoFactorRequired) {
+          setError(err.error.error || "Invalid two-factor code");
+        }
+        setTwoFactorRequired(true);
+        setTotpCode("");
+        return;
+      }
+      setError(
+        err?.error?.error ||
+          (err instanceof Error ? err.message : "Login failed"),
+      );
     } finally {
       setLoading(false);
     }
@@ -88,9 +136,38 @@ export function Login() {
                 />
               </div>
 
+              {twoFactorRequired && (
+                <div className="space-y-2">
+                  <Label htmlFor="totp-code">Authenticator code</Label>
+                  <Input
+                    id="totp-code"
+                    inputMode="numeric"
+                    placeholder="123456"
+                    value={totpCode}
+                    onChange={(e) => setTotpCode(e.target.value)}
+                    required
+                    disabled={loading}
+                    autoComplete="one-time-code"
+                    autoFocus
+                  />
+                </div>
+              )}
+
               <Button type="submit" className="w-full" disabled={loading}>
                 {loading ? "Signing in..." : "Sign in"}
               </Button>
+
+              {ssoLoginUrl && (
+                <Button
+                  type="button"
+                  variant="outline"
+                  className="w-full"
+                  disabled={loading}
+                  onClick={() => window.location.assign(ssoLoginUrl)}
+                >
+                  Sign in with SSO
+                </Button>
+              )}
             </form>
           </CardContent>
         </Card>
@@ -52,9 +52,13 @@ export function SettingsPage() {
   const [schemaOnly, setSchemaOnly] = useState<"schema" | "full">("schema");
   const [refreshSchedule, setRefreshSchedule] = useState("");
   const [maxRestores, setMaxRestores] = useState(1);
+  const [restoreMaxAgeDays, setRestoreMaxAgeDays] = useState(0);
+  const [restoreKeepLatest, setRestoreKeepLatest] = useState(1);
   const [domain, setDomain] = useState("");
   const [letsEncryptEmail, setLetsEncryptEmail] = useState("");
   const [postRestoreSQL, setPostRestoreSQL] = useState("");
+  const [seedSQL, setSeedSQL] = useState("");
+  const [postBranchSQL, setPostBranchSQL] = useState("");
   const [saving, setSaving] = useState(false);
   const [saveError, setSaveError] = useState<string | null>(null);
   const [saveSuccess, setSaveSuccess] = useState(false);
@@ -104,9 +108,13 @@ export function SettingsPage() {
       setSchemaOnly(configData.schema_only ? "schema" : "full");
       setRefreshSchedule(configData.refresh_schedule || "");
       setMaxRestores(configData.max_restores || 1);
+      setRestoreMaxAgeDays(configData.restore_max_age_days ?? 0);
+      setRestoreKeepLatest(configData.restore_keep_latest ?? 1);
       setDomain(configData.domain || "");
       setLetsEncryptEmail(configData.lets_encrypt_email || "");
       setPostRestoreSQL(configData.post_restore_sql || "");
+      setSeedSQL(configData.seed_sql || "");
+      setPostBranchSQL(configData.post_branch_sql || "");
 
       // Fetch system info
       try {
@@ -152,9 +160,13 @@ export function SettingsPage() {
         schemaOnly: schemaOnly === "schema",
         refreshSchedule: refreshSchedule, // Send empty string to clear
         maxRestores: maxRestores,
+        restoreMaxAgeDays: restoreMaxAgeDays,
+        restoreKeepLatest: restoreKeepLatest,
         domain: domain || undefined,
         letsEncryptEmail: letsEncryptEmail || undefined,
         postRestoreSQL: postRestoreSQL, // Send empty string to clear
+        seedSQL: seedSQL, // Send empty string to clear
+        postBranchSQL: postBranchSQL, // Send empty string to clear
       };
 
       if (restoreSource === "direct") {
@@ -602,6 +614,41 @@ export function SettingsPage() {
                   })()}
               </div>
 
+              <div className="grid grid-cols-2 gap-4">
+                <div className="space-y-2">
+                  <Label htmlFor="restoreMaxAgeDays">Maximum Restore Age (days)</Label>
+                  <Input
+                    id="restoreMaxAgeDays"
+                    type="number"
+                    min="0"
+                    value={restoreMaxAgeDays}
+                    onChange={(e) =>
+                      setRestoreMaxAgeDays(Math.max(0, parseInt(e.target.value) || 0))
+                    }
+                    disabled={saving}
+                  />
+                  <p className="text-xs text-gray-500 dark:text-gray-400">
+                    Older restores are deleted, 0 = no age limit
+                  </p>
+                </div>
+                <div className="space-y-2">
+                  <Label htmlFor="restoreKeepLatest">Always Keep Latest</Label>
+                  <Input
+                    id="restoreKeepLatest"
+                    type="number"
+                    min="0"
+                    value={restoreKeepLatest}
+                    onChange={(e) =>
+                      setRestoreKeepLatest(Math.max(0, parseInt(e.target.value) || 0))
+                    }
+                    disabled={saving}
+                  />
+                  <p className="text-xs text-gray-500 dark:text-gray-400">
+                    Newest restores with data kept regardless of age or count
+                  </p>
+                </div>
+              </div>
+
               <Alert>
                 <Info className="h-4 w-4" />
                 <AlertDescription className="text-sm space-y-2">
@@ -622,6 +669,9 @@ export function SettingsPage() {
                       Restores with active branches are never deleted,
                       regardless of age
                     </li>
+                    <li>
+                      Deleted restores are recorded in the audit log
+                    </li>
                     <li>New branches automatically use the latest restore</li>
                   </ul>
                 </AlertDescription>
@@ -653,6 +703,74 @@ export function SettingsPage() {
                   These run before anonymization rules are applied. Leave empty
                   to skip.
                 </p>
+                <p className="text-xs text-gray-500">
+                  Supports template variables such as{" "}
+                  <code>{"{{.RestoreName}}"}</code>, <code>{"{{.Port}}"}</code>{" "}
+                  and <code>{"{{.Date}}"}</code>, quoting with{" "}
+                  <code>{"{{literal .Date}}"}</code>, and secrets from the
+                  worker's <code>BRANCHD_SECRET_*</code> environment variables
+                  with <code>{'{{secret "NAME"}}'}</code>.
+                </p>
+              </div>
+            </div>
+
+            <div className="border-t pt-4 space-y-4">
+              <div>
+                <Label htmlFor="seedSQL" className="text-base">
+                  Seed SQL
+                </Label>
+                <p className="text-sm text-gray-500 mt-1 mb-3">
+                  SQL statements to run after anonymization, e.g. to add
+                  synthetic tenants
+                </p>
+              </div>
+
+              <div className="space-y-2">
+                <Textarea
+                  id="seedSQL"
+                  placeholder="INSERT INTO tenants (name) VALUES ({{literal .Date}}) ON CONFLICT DO NOTHING;"
+                  value={seedSQL}
+                  onChange={(e) => setSeedSQL(e.target.value)}
+                  className="font-mono text-sm min-h-[120px]"
+                  disabled={saving}
+                />
+                <p className="text-xs text-gray-500">
+                  Runs after every restore and incremental refresh, so
+                  statements should be idempotent. Supports the same template
+                  variables and secrets as post-restore SQL. Leave empty to
+                  skip.
+                </p>
+              </div>
+            </div>
+
+            <div className="border-t pt-4 space-y-4">
+              <div>
+                <Label htmlFor="postBranchSQL" className="text-base">
+                  Post-branch SQL
+                </Label>
+                <p className="text-sm text-gray-500 mt-1 mb-3">
+                  SQL statements to run in every new branch, e.g. to create app
+                  roles or truncate queue tables
+                </p>
+              </div>
+
+              <div className="space-y-2">
+                <Textarea
+                  id="postBranchSQL"
+                  placeholder="TRUNCATE job_queue;&#10;INSERT INTO tenants (name) VALUES ({{literal .BranchName}});"
+                  value={postBranchSQL}
+                  onChange={(e) => setPostBranchSQL(e.target.value)}
+                  className="font-mono text-sm min-h-[120px]"
+                  disabled={saving}
+                />
+                <p className="text-xs text-gray-500">
+                  Runs right after a branch is cloned, before the branch's own
+                  SQL from its create request. A failing statement fails the
+                  branch creation, the output is kept in the branch log.
+                  Supports <code>{"{{.BranchName}}"}</code>,{" "}
+                  <code>{"{{.ShortID}}"}</code>, <code>{"{{.Port}}"}</code> and
+                  the secrets of post-restore SQL. Leave empty to skip.
+                </p>
               </div>
             </div>
           </CardContent>
@@ -0,0 +1,180 @@
+import { useEffect, useState } from "react";
+import { useNavigate } from "react-router";
+import {
+  Card,
+  CardContent,
+  CardHeader,
+  CardTitle,
+  CardDescription,
+} from "@/shadcn/components/ui/card";
+import { Button } from "@/shadcn/components/ui/button";
+import { Input } from "@/shadcn/components/ui/input";
+import { Label } from "@/shadcn/components/ui/label";
+import { Alert, AlertDescription } from "@/shadcn/components/ui/alert";
+import { auth } from "@/lib/auth";
+import { useApi } from "@/hooks/use-api";
+
+interface TwoFactorStatus {
+  two_factor_enabled?: boolean;
+  two_factor_verified?: boolean;
+  two_factor_deadline?: string;
+}
+
+interface TwoFactorSetup {
+  secret?: string;
+  otpauth_url?: string;
+}
+
+export function TwoFactorPage() {
+  const navigate = useNavigate();
+  const api = useApi();
+  const [status, setStatus] = useState<TwoFactorStatus | null>(null);
+  const [setup, setSetup] = useState<TwoFactorSetup | null>(null);
+  const [code, setCode] = useState("");
+  const [error, setError] = useState("");
+  const [loading, setLoading] = useState(false);
+
+  useEffect(() => {
+    const fetchStatus = async () => {
+      try {
+        const response = await api.api.authMeList();
+        setStatus(response.data);
+      } catch (err: any) {
+        setError(err?.error?.error || "Failed to load two-factor status");
+      }
+    };
+
+    fetchStatus();
+  }, [api.api]);
+
+  const handleSetup = async () => {
+    setError("");
+    setLoading(true);
+    try {
+      const response = await api.api.auth2FaSetupCreate();
+      setSetup(response.data);
+    } catch (err: any) {
+      setError(err?.error?.error || "Failed to set up two-factor authentication");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleVerify = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError("");
+    setLoading(true);
+    try {
+      // The new token is allowed on admin routes
+      const response = await api.api.auth2FaVerifyCreate({ code });
+      if (response.data.token) {
+        auth.setToken(response.data.token);
+      }
+      // Reload so API clients pick up the new token
+      window.location.assign("/");
+    } catch (err: any) {
+      setError(err?.error?.error || "Invalid two-factor code");
+      setCode("");
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const enrolled = status?.two_factor_enabled;
+  const showCodeForm = enrolled ? !status?.two_factor_verified : !!setup;
+
+  return (
+    <div className="max-w-2xl mx-auto space-y-6 p-6">
+      <Card>
+        <CardHeader>
+          <CardTitle>Two-factor authentication</CardTitle>
+          <CardDescription>
+            Admin pages require a code of an authenticator app (e.g. 1Password,
+            Google Authenticator)
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          {error && (
+            <Alert variant="destructive">
+              <AlertDescription>{error}</AlertDescription>
+            </Alert>
+          )}
+
+          {!enrolled && status?.two_factor_deadline && (
+            <Alert>
+              <AlertDescription>
+                Admin pages stay available without a code until{" "}
+                {new Date(status.two_factor_deadline).toLocaleString()}.
+              </AlertDescription>
+            </Alert>
+          )}
+
+          {enrolled && status?.two_factor_verified && (
+            <p className="text-sm text-muted-foreground">
+              Two-factor authentication is enabled and this session is
+              verified.
+            </p>
+          )}
+
+          {status && !enrolled && !setup && (
+            <Button onClick={handleSetup} disabled={loading}>
+              {loading ? "Setting up..." : "Set up authenticator"}
+            </Button>
+          )}
+
+          {setup && (
+            <div className="space-y-2">
+              <Label htmlFor="totp-secret">
+                Add this key to your authenticator app
+              </Label>
+              <Input
+                id="totp-secret"
+                value={setup.secret || ""}
+                readOnly
+                className="font-mono"
+              />
+              <p className="text-sm text-muted-foreground break-all">
+                Or open{" "}
+                <a className="underline" href={setup.otpauth_url}>
+                  {setup.otpauth_url}
+                </a>{" "}
+                on a device with an authenticator app.
+              </p>
+            </div>
+          )}
+
+          {showCodeForm && (
+            <form onSubmit={handleVerify} className="space-y-4">
+              <div className="space-y-2">
+                <Label htmlFor="totp-code">Authenticator code</Label>
+                <Input
+                  id="totp-code"
+                  inputMode="numeric"
+                  placeholder="123456"
+                  value={code}
+                  onChange={(e) => setCode(e.target.value)}
+                  required
+                  disabled={loading}
+                  autoComplete="one-time-code"
+                />
+              </div>
+              <div className="flex gap-2">
+                <Button type="submit" disabled={loading}>
+                  {loading ? "Verifying..." : "Verify"}
+                </Button>
+                <Button
+                  type="button"
+                  variant="outline"
+                  onClick={() => navigate("/")}
+                  disabled={loading}
+                >
+                  Cancel
+                </Button>
+              </div>
+            </form>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  );
+}